@@ -11,9 +11,11 @@ import (
 	"net"
 	"net/http"
 	"net/netip"
+	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"runtime/debug"
 	"sort"
@@ -38,9 +40,11 @@ import (
 	"cdr.dev/slog"
 	"github.com/coder/retry"
 
+	"github.com/coder/coder/v2/agent/agentcodeserver"
 	"github.com/coder/coder/v2/agent/agentproc"
 	"github.com/coder/coder/v2/agent/agentscripts"
 	"github.com/coder/coder/v2/agent/agentssh"
+	"github.com/coder/coder/v2/agent/agentupdate"
 	"github.com/coder/coder/v2/agent/proto"
 	"github.com/coder/coder/v2/agent/reconnectingpty"
 	"github.com/coder/coder/v2/buildinfo"
@@ -58,6 +62,10 @@ const (
 	ProtocolDial            = "dial"
 )
 
+// authorizedKeysRefreshInterval is how often the authorized keys of the
+// workspace owner are fetched.
+const authorizedKeysRefreshInterval = 2 * time.Minute
+
 // EnvProcPrioMgmt determines whether we attempt to manage
 // process CPU and OOM Killer priority.
 const EnvProcPrioMgmt = "CODER_PROC_PRIO_MGMT"
@@ -80,7 +88,34 @@ type Options struct {
 	PrometheusRegistry           *prometheus.Registry
 	ReportMetadataInterval       time.Duration
 	ServiceBannerRefreshInterval time.Duration
-	Syscaller                    agentproc.Syscaller
+	// BuildStatusRefreshInterval is how often the agent checks whether the
+	// workspace build completed, to run the scripts that run once it does.
+	BuildStatusRefreshInterval time.Duration
+	Syscaller                  agentproc.Syscaller
+	// SSHCrypto restricts the algorithms the SSH server accepts. It must
+	// resolve, see agentssh.CryptoConfig.Resolve.
+	SSHCrypto agentssh.CryptoConfig
+	// UpdatedFrom is the version of the agent this agent replaced, see
+	// agentupdate.EnvUpdatedFrom.
+	UpdatedFrom string
+	// LogCipher encrypts the logs and script artifacts the agent sends to
+	// coderd, so coderd only stores ciphertext. If nil, they're sent as is.
+	LogCipher *agentsdk.LogCipher
+	// ConfigureGit sets the Git identity of the owner of the workspace on
+	// startup, keeping values the owner configured. GitCredentialHelper is
+	// added as credential helper if the deployment has Git external auth
+	// providers, replacing helpers matching GitCredentialHelperRegex. See
+	// agentgit.
+	ConfigureGit             bool
+	GitCredentialHelper      string
+	GitCredentialHelperRegex *regexp.Regexp
+	// ScheduledTasksPath persists the tasks scheduled with the agent API.
+	// Defaults to a file in the user config directory, which survives
+	// restarts of the workspace if the home directory is persistent.
+	ScheduledTasksPath string
+	// ScriptHistoryPath persists the history of script runs served by the
+	// agent API. Defaults to a file in the user config directory.
+	ScriptHistoryPath string
 	// ModifiedProcesses is used for testing process priority management.
 	ModifiedProcesses chan []*agentproc.Process
 	// ProcessManagementTick is used for testing process priority management.
@@ -92,7 +127,16 @@ type Client interface {
 	PostLifecycle(ctx context.Context, state agentsdk.PostLifecycleRequest) error
 	PostMetadata(ctx context.Context, req agentsdk.PostMetadataRequest) error
 	PatchLogs(ctx context.Context, req agentsdk.PatchLogs) error
+	PostLogSource(ctx context.Context, req agentsdk.PostLogSource) (codersdk.WorkspaceAgentLogSource, error)
+	PostScriptArtifacts(ctx context.Context, req agentsdk.ScriptArtifacts) error
+	PostConnectionFailures(ctx context.Context, req agentsdk.PostConnectionFailuresRequest) error
+	DiagnoseConnectionFailure(ctx context.Context, err error) agentsdk.ConnectionFailure
+	AuthorizedKeys(ctx context.Context) (agentsdk.AuthorizedKeysResponse, error)
+	Manifest(ctx context.Context) (agentsdk.Manifest, error)
+	PostStats(ctx context.Context, stats *agentsdk.Stats) (agentsdk.StatsResponse, error)
 	RewriteDERPMap(derpMap *tailcfg.DERPMap)
+	BuildInfo(ctx context.Context) (codersdk.BuildInfoResponse, error)
+	AgentBinaryURL(goos, goarch string) *url.URL
 }
 
 type Agent interface {
@@ -115,6 +159,20 @@ func New(options Options) Agent {
 		}
 		options.LogDir = options.TempDir
 	}
+	if options.ScheduledTasksPath == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			configDir = options.TempDir
+		}
+		options.ScheduledTasksPath = filepath.Join(configDir, "coderv2", "agent-scheduled-tasks.json")
+	}
+	if options.ScriptHistoryPath == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			configDir = options.TempDir
+		}
+		options.ScriptHistoryPath = filepath.Join(configDir, "coderv2", "agent-script-history.json")
+	}
 	if options.ExchangeToken == nil {
 		options.ExchangeToken = func(ctx context.Context) (string, error) {
 			return "", nil
@@ -126,6 +184,9 @@ func New(options Options) Agent {
 	if options.ServiceBannerRefreshInterval == 0 {
 		options.ServiceBannerRefreshInterval = 2 * time.Minute
 	}
+	if options.BuildStatusRefreshInterval == 0 {
+		options.BuildStatusRefreshInterval = 10 * time.Second
+	}
 	if options.PortCacheDuration == 0 {
 		options.PortCacheDuration = 1 * time.Second
 	}
@@ -159,12 +220,21 @@ func New(options Options) Agent {
 		portCacheDuration:            options.PortCacheDuration,
 		reportMetadataInterval:       options.ReportMetadataInterval,
 		serviceBannerRefreshInterval: options.ServiceBannerRefreshInterval,
+		buildStatusRefreshInterval:   options.BuildStatusRefreshInterval,
 		sshMaxTimeout:                options.SSHMaxTimeout,
+		sshCrypto:                    options.SSHCrypto,
 		subsystems:                   options.Subsystems,
 		addresses:                    options.Addresses,
 		syscaller:                    options.Syscaller,
 		modifiedProcs:                options.ModifiedProcesses,
 		processManagementTick:        options.ProcessManagementTick,
+		updatedFrom:                  options.UpdatedFrom,
+		scheduledTasksPath:           options.ScheduledTasksPath,
+		scriptHistoryPath:            options.ScriptHistoryPath,
+		logCipher:                    options.LogCipher,
+		configureGit:                 options.ConfigureGit,
+		gitCredentialHelper:          options.GitCredentialHelper,
+		gitCredentialHelperRegex:     options.GitCredentialHelperRegex,
 
 		prometheusRegistry: prometheusRegistry,
 		metrics:            newAgentMetrics(prometheusRegistry),
@@ -173,6 +243,33 @@ func New(options Options) Agent {
 	return a
 }
 
+// patchLogs sends logs to coderd, encrypted with the log cipher if one is
+// configured.
+func (a *agent) patchLogs(ctx context.Context, req agentsdk.PatchLogs) error {
+	if a.logCipher == nil {
+		return a.client.PatchLogs(ctx, req)
+	}
+	return agentsdk.EncryptPatchLogs(a.client.PatchLogs, a.logCipher)(ctx, req)
+}
+
+// uploadScriptArtifacts uploads the artifacts of scripts to coderd,
+// encrypted with the log cipher if one is configured.
+func (a *agent) uploadScriptArtifacts(ctx context.Context, req agentsdk.ScriptArtifacts) error {
+	if a.logCipher == nil {
+		return a.client.PostScriptArtifacts(ctx, req)
+	}
+	return agentsdk.EncryptScriptArtifacts(a.client.PostScriptArtifacts, a.logCipher)(ctx, req)
+}
+
+// postNotification raises a notification for the workspace owner.
+func (a *agent) postNotification(ctx context.Context, notification agentsdk.Notification) error {
+	post := a.notificationPoster.Load()
+	if post == nil {
+		return xerrors.New("not connected to coderd")
+	}
+	return (*post)(ctx, notification)
+}
+
 type agent struct {
 	logger            slog.Logger
 	client            Client
@@ -191,6 +288,8 @@ type agent struct {
 	reconnectingPTYs       sync.Map
 	reconnectingPTYTimeout time.Duration
 
+	metadataCollectors metadataCollectors
+
 	connCloseWait sync.WaitGroup
 	closeCancel   context.CancelFunc
 	closeMutex    sync.Mutex
@@ -198,14 +297,36 @@ type agent struct {
 
 	envVars map[string]string
 
-	manifest                     atomic.Pointer[agentsdk.Manifest] // manifest is atomic because values can change after reconnection.
-	reportMetadataInterval       time.Duration
-	scriptRunner                 *agentscripts.Runner
+	manifest               atomic.Pointer[agentsdk.Manifest] // manifest is atomic because values can change after reconnection.
+	reportMetadataInterval time.Duration
+	scriptRunner           *agentscripts.Runner
+	codeServer             *agentcodeserver.Supervisor
+	updater                *agentupdate.Updater
+	// updatedFrom is set if this agent replaced an older version, which
+	// already ran the startup scripts.
+	updatedFrom        string
+	scheduledTasksPath string
+	scriptHistoryPath  string
+	logCipher          *agentsdk.LogCipher
+	// configureGit and gitCredentialHelper are used by applyGitConfig.
+	configureGit             bool
+	gitCredentialHelper      string
+	gitCredentialHelperRegex *regexp.Regexp
+	// appHealth is the latest health of apps reported to coderd.
+	appHealth                    atomic.Pointer[agentsdk.PostAppHealthsRequest]
 	serviceBanner                atomic.Pointer[codersdk.ServiceBannerConfig] // serviceBanner is atomic because it is periodically updated.
 	serviceBannerRefreshInterval time.Duration
-	sessionToken                 atomic.Pointer[string]
-	sshServer                    *agentssh.Server
-	sshMaxTimeout                time.Duration
+	// motd is the latest MOTD of the workspace, refreshed on the interval
+	// of the service banner. It's nil if the manifest has no MOTD.
+	motd                       atomic.Pointer[agentsdk.MOTDConfig]
+	buildStatusRefreshInterval time.Duration
+	// buildScriptsStarted is set once the agent waits for the workspace
+	// build to complete, so build scripts run once per agent.
+	buildScriptsStarted atomic.Bool
+	sessionToken        atomic.Pointer[string]
+	sshServer           *agentssh.Server
+	sshMaxTimeout       time.Duration
+	sshCrypto           agentssh.CryptoConfig
 
 	lifecycleUpdate   chan struct{}
 	lifecycleReported chan codersdk.WorkspaceAgentLifecycle
@@ -216,6 +337,12 @@ type agent struct {
 	addresses     []netip.Prefix
 	statsReporter *statsReporter
 
+	connectionFailures connectionFailures
+
+	// notificationPoster raises notifications over the current connection
+	// to coderd, it's nil while the agent isn't connected.
+	notificationPoster atomic.Pointer[func(context.Context, agentsdk.Notification) error]
+
 	connCountReconnectingPTY atomic.Int64
 
 	prometheusRegistry *prometheus.Registry
@@ -235,7 +362,10 @@ func (a *agent) TailnetConn() *tailnet.Conn {
 }
 
 func (a *agent) init(ctx context.Context) {
-	sshSrv, err := agentssh.NewServer(ctx, a.logger.Named("ssh-server"), a.prometheusRegistry, a.filesystem, a.sshMaxTimeout, "")
+	sshSrv, err := agentssh.NewServer(ctx, a.logger.Named("ssh-server"), a.prometheusRegistry, a.filesystem, &agentssh.Config{
+		MaxTimeout: a.sshMaxTimeout,
+		Crypto:     a.sshCrypto,
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -243,17 +373,53 @@ func (a *agent) init(ctx context.Context) {
 	sshSrv.AgentToken = func() string { return *a.sessionToken.Load() }
 	sshSrv.Manifest = &a.manifest
 	sshSrv.ServiceBanner = &a.serviceBanner
+	sshSrv.MOTD = &a.motd
 	a.sshServer = sshSrv
 	a.scriptRunner = agentscripts.New(agentscripts.Options{
 		LogDir:     a.logDir,
 		Logger:     a.logger,
 		SSHServer:  sshSrv,
 		Filesystem: a.filesystem,
-		PatchLogs:  a.client.PatchLogs,
+		PatchLogs:  a.patchLogs,
+
+		UploadArtifacts: a.uploadScriptArtifacts,
+		TasksPath:       a.scheduledTasksPath,
+		HistoryPath:     a.scriptHistoryPath,
+		Manifest:        &a.manifest,
+
+		PostNotification: a.postNotification,
+	})
+	err = a.scriptRunner.LoadScriptRunHistory()
+	if err != nil {
+		a.logger.Error(ctx, "load script run history", slog.Error(err))
+	}
+	// Scheduled tasks run once the cron is started after the startup
+	// scripts.
+	err = a.scriptRunner.LoadScheduledTasks()
+	if err != nil {
+		a.logger.Error(ctx, "load scheduled tasks", slog.Error(err))
+	}
+	a.codeServer = agentcodeserver.New(agentcodeserver.Options{
+		Logger:        a.logger.Named("code-server"),
+		InstallDir:    codeServerInstallDir(a.tempDir),
+		LogDir:        a.logDir,
+		CreateCommand: sshSrv.CreateCommand,
+	})
+	a.updater = agentupdate.New(agentupdate.Options{
+		Logger:         a.logger.Named("update"),
+		CurrentVersion: buildinfo.Version(),
+		Dir:            filepath.Join(a.tempDir, "coder-agent-update"),
+		BuildInfo:      a.client.BuildInfo,
+		BinaryURL:      a.client.AgentBinaryURL,
+		Idle:           a.isIdle,
+		Exec:           a.execUpdate,
 	})
 	// Register runner metrics. If the prom registry is nil, the metrics
 	// will not report anywhere.
 	a.scriptRunner.RegisterMetrics(a.prometheusRegistry)
+	// Quit web terminal sessions persisted by a previous agent that are not
+	// reattached.
+	go reconnectingpty.ExpirePersistedSessions(ctx, a.logger.Named("reconnecting-pty"), a.reconnectingPTYTimeout)
 	go a.runLoop(ctx)
 }
 
@@ -265,6 +431,8 @@ func (a *agent) runLoop(ctx context.Context) {
 	go a.reportLifecycleLoop(ctx)
 	go a.reportMetadataLoop(ctx)
 	go a.manageProcessPriorityLoop(ctx)
+	go a.watchDiskUsageLoop(ctx)
+	go a.updater.Run(ctx)
 
 	for retrier := retry.New(100*time.Millisecond, 10*time.Second); retrier.Wait(ctx); {
 		a.logger.Info(ctx, "connecting to coderd")
@@ -290,6 +458,10 @@ func (a *agent) runLoop(ctx context.Context) {
 }
 
 func (a *agent) collectMetadata(ctx context.Context, md codersdk.WorkspaceAgentMetadataDescription, now time.Time) *codersdk.WorkspaceAgentMetadataResult {
+	if md.Collector != "" {
+		return a.metadataCollectors.collect(md.Collector, now)
+	}
+
 	var out bytes.Buffer
 	result := &codersdk.WorkspaceAgentMetadataResult{
 		// CollectedAt is set here for testing purposes and overrode by
@@ -653,6 +825,26 @@ func (a *agent) setLifecycle(ctx context.Context, state codersdk.WorkspaceAgentL
 	}
 }
 
+// isIdle reports whether the agent can be replaced by an update without
+// interrupting the workspace owner: the startup scripts are done, nobody is
+// connected and code-server isn't supervised.
+func (a *agent) isIdle() bool {
+	a.lifecycleMu.RLock()
+	state := a.lifecycleStates[len(a.lifecycleStates)-1].State
+	a.lifecycleMu.RUnlock()
+	if state != codersdk.WorkspaceAgentLifecycleReady {
+		return false
+	}
+	sshStats := a.sshServer.ConnStats()
+	if sshStats.Sessions > 0 || sshStats.VSCode > 0 || sshStats.JetBrains > 0 {
+		return false
+	}
+	if a.connCountReconnectingPTY.Load() > 0 {
+		return false
+	}
+	return a.codeServer.Status().State == agentcodeserver.StateDisabled
+}
+
 // fetchServiceBannerLoop fetches the service banner on an interval.  It will
 // not be fetched immediately; the expectation is that it is primed elsewhere
 // (and must be done before the session actually starts).
@@ -678,6 +870,118 @@ func (a *agent) fetchServiceBannerLoop(ctx context.Context, aAPI proto.DRPCAgent
 	}
 }
 
+// fetchMOTDLoop refreshes the MOTD on the interval of the service banner,
+// since the deadline and the builds of the workspace change while the agent
+// runs. Failures are only logged, e.g. older coderd don't serve the MOTD.
+func (a *agent) fetchMOTDLoop(ctx context.Context, aAPI proto.DRPCAgentClient) {
+	ticker := time.NewTicker(a.serviceBannerRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if a.motd.Load() == nil {
+				// The manifest has no MOTD.
+				continue
+			}
+			motd, err := aAPI.GetMOTD(ctx, &proto.GetMOTDRequest{})
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				a.logger.Warn(ctx, "failed to update MOTD", slog.Error(err))
+				continue
+			}
+			a.motd.Store(agentsdk.MOTDConfigFromProto(motd))
+		}
+	}
+}
+
+// handleBuildScripts runs the scripts that run once the workspace build
+// completes. The agent usually starts before the build completes, so it
+// checks the status of the build until it does.
+func (a *agent) handleBuildScripts(ctx context.Context, aAPI proto.DRPCAgentClient, manifest agentsdk.Manifest) error {
+	if a.updatedFrom != "" {
+		// The agent we replaced ran the build scripts.
+		return nil
+	}
+	hasBuildScripts := slices.ContainsFunc(manifest.Scripts, func(script codersdk.WorkspaceAgentScript) bool {
+		return script.RunOnBuildSuccess || script.RunOnBuildFailure
+	})
+	if !hasBuildScripts || !a.buildScriptsStarted.CompareAndSwap(false, true) {
+		return nil
+	}
+	return a.trackConnGoroutine(func() {
+		status := manifest.BuildStatus
+		ticker := time.NewTicker(a.buildStatusRefreshInterval)
+		defer ticker.Stop()
+		for status == codersdk.ProvisionerJobRunning {
+			select {
+			case <-ctx.Done():
+				// Wait for the build again once reconnected.
+				a.buildScriptsStarted.Store(false)
+				return
+			case <-ticker.C:
+			}
+			mp, err := aAPI.GetManifest(ctx, &proto.GetManifestRequest{})
+			if err != nil {
+				if ctx.Err() == nil {
+					a.logger.Warn(ctx, "failed to fetch workspace build status", slog.Error(err))
+				}
+				continue
+			}
+			status = agentsdk.BuildStatusFromProto(mp.BuildStatus)
+		}
+		if status == "" {
+			a.logger.Warn(ctx, "coderd doesn't report the workspace build status, skipping build scripts")
+			return
+		}
+		a.logger.Info(ctx, "workspace build completed, running build scripts", slog.F("status", status))
+		err := a.scriptRunner.ExecuteBuildScripts(ctx, status)
+		if err != nil {
+			a.logger.Warn(ctx, "build script(s) failed", slog.Error(err))
+		}
+	})
+}
+
+// fetchAuthorizedKeys updates the public keys the SSH server accepts in
+// addition to connections authenticated by coderd.
+func (a *agent) fetchAuthorizedKeys(ctx context.Context) {
+	resp, err := a.client.AuthorizedKeys(ctx)
+	if err != nil {
+		var sdkErr *codersdk.Error
+		switch {
+		case ctx.Err() != nil:
+		case xerrors.As(err, &sdkErr) && sdkErr.StatusCode() == http.StatusNotFound:
+			// Older versions of coderd don't serve authorized keys.
+			a.logger.Debug(ctx, "authorized keys are not supported by coderd")
+		default:
+			a.logger.Warn(ctx, "failed to fetch authorized keys", slog.Error(err))
+		}
+		return
+	}
+	err = a.sshServer.SetAuthorizedKeys(resp)
+	if err != nil {
+		a.logger.Warn(ctx, "invalid authorized keys", slog.Error(err))
+	}
+}
+
+// fetchAuthorizedKeysLoop refreshes the authorized keys on an interval, so
+// revoked keys stop being accepted.
+func (a *agent) fetchAuthorizedKeysLoop(ctx context.Context) {
+	ticker := time.NewTicker(authorizedKeysRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.fetchAuthorizedKeys(ctx)
+		}
+	}
+}
+
 func (a *agent) run(ctx context.Context) error {
 	// This allows the agent to refresh it's token if necessary.
 	// For instance identity this is required, since the instance
@@ -691,6 +995,7 @@ func (a *agent) run(ctx context.Context) error {
 	// ConnectRPC returns the dRPC connection we use for the Agent and Tailnet v2+ APIs
 	conn, err := a.client.ConnectRPC(ctx)
 	if err != nil {
+		a.recordCoderdFailure(ctx, err)
 		return err
 	}
 	defer func() {
@@ -700,7 +1005,19 @@ func (a *agent) run(ctx context.Context) error {
 		}
 	}()
 
-	aAPI := proto.NewDRPCAgentClient(conn)
+	// Requests that fail because the connection is degraded are retried
+	// on a new connection, or over the HTTP API.
+	aAPI := agentsdk.NewFallbackAgentAPI(conn, a.client.ConnectRPC, a.client, a.logger.Named("agentapi"))
+	defer func() {
+		cErr := aAPI.Close()
+		if cErr != nil {
+			a.logger.Debug(ctx, "error closing agent API fallback connection", slog.Error(cErr))
+		}
+	}()
+	postNotification := agentsdk.NotificationPoster(aAPI)
+	a.notificationPoster.Store(&postNotification)
+	defer a.notificationPoster.CompareAndSwap(&postNotification, nil)
+
 	sbp, err := aAPI.GetServiceBanner(ctx, &proto.GetServiceBannerRequest{})
 	if err != nil {
 		return xerrors.Errorf("fetch service banner: %w", err)
@@ -745,8 +1062,12 @@ func (a *agent) run(ctx context.Context) error {
 	if err != nil {
 		return xerrors.Errorf("update workspace agent startup: %w", err)
 	}
+	a.reportConnectionFailures(ctx)
+	a.fetchAuthorizedKeys(ctx)
 
 	oldManifest := a.manifest.Swap(&manifest)
+	a.motd.Store(manifest.MOTD)
+	a.updater.SetPolicy(manifest.UpdatePolicy)
 
 	// The startup script should only execute on the first run!
 	if oldManifest == nil {
@@ -765,16 +1086,24 @@ func (a *agent) run(ctx context.Context) error {
 				a.logger.Warn(ctx, "failed to override vscode git auth configs", slog.Error(err))
 			}
 		}
+		if a.configureGit {
+			a.applyGitConfig(ctx, manifest)
+		}
 
 		err = a.scriptRunner.Init(manifest.Scripts)
 		if err != nil {
 			return xerrors.Errorf("init script runner: %w", err)
 		}
 		err = a.trackConnGoroutine(func() {
+			if a.updatedFrom != "" {
+				// The agent we replaced ran the startup scripts.
+				a.logger.Info(ctx, "skipping startup scripts after update", slog.F("updated_from", a.updatedFrom))
+				a.setLifecycle(ctx, codersdk.WorkspaceAgentLifecycleReady)
+				a.scriptRunner.StartCron()
+				return
+			}
 			start := time.Now()
-			err := a.scriptRunner.Execute(ctx, func(script codersdk.WorkspaceAgentScript) bool {
-				return script.RunOnStart
-			})
+			err := a.scriptRunner.Execute(ctx, agentscripts.ExecuteStartScripts)
 			// Measure the time immediately after the script has finished
 			dur := time.Since(start).Seconds()
 			if err != nil {
@@ -794,17 +1123,49 @@ func (a *agent) run(ctx context.Context) error {
 			}
 			a.metrics.startupScriptSeconds.WithLabelValues(label).Set(dur)
 			a.scriptRunner.StartCron()
+
+			// Post-start scripts run once the lifecycle was reported, so
+			// they don't delay the startup of the workspace.
+			err = a.scriptRunner.Execute(ctx, agentscripts.ExecutePostStartScripts)
+			if err != nil {
+				a.logger.Warn(ctx, "post-start script(s) failed", slog.Error(err))
+			}
 		})
 		if err != nil {
 			return xerrors.Errorf("track conn goroutine: %w", err)
 		}
+
+		if manifest.CodeServer != nil {
+			err = a.codeServer.Start(*manifest.CodeServer)
+			if err != nil {
+				a.logger.Error(ctx, "start code-server", slog.Error(err))
+			}
+		}
+	} else {
+		// Scheduled scripts follow updates of the manifest, scripts that
+		// run on start have already run.
+		err = a.scriptRunner.Init(manifest.Scripts)
+		if err != nil {
+			a.logger.Warn(ctx, "failed to update scripts", slog.Error(err))
+		}
+	}
+	err = a.handleBuildScripts(ctx, aAPI, manifest)
+	if err != nil {
+		return xerrors.Errorf("handle build scripts: %w", err)
 	}
 
 	// This automatically closes when the context ends!
 	appReporterCtx, appReporterCtxCancel := context.WithCancel(ctx)
 	defer appReporterCtxCancel()
-	go NewWorkspaceAppHealthReporter(
-		a.logger, manifest.Apps, agentsdk.AppHealthPoster(aAPI))(appReporterCtx)
+	var healthcheckProxy func(*http.Request) (*url.URL, error)
+	if manifest.Proxy != nil {
+		healthcheckProxy = manifest.Proxy.ProxyFunc()
+	}
+	postAppHealth := agentsdk.AppHealthPoster(aAPI)
+	go NewWorkspaceAppHealthReporter(a.logger, manifest.Apps, func(ctx context.Context, req agentsdk.PostAppHealthsRequest) error {
+		a.appHealth.Store(&req)
+		return postAppHealth(ctx, req)
+	}, healthcheckProxy)(appReporterCtx)
 
 	a.closeMutex.Lock()
 	network := a.network
@@ -839,6 +1200,10 @@ func (a *agent) run(ctx context.Context) error {
 		network.SetBlockEndpoints(manifest.DisableDirectConnections)
 	}
 
+	// The agent starts with the primary regions of the DERP map, like every
+	// agent sharing the manifest.
+	derpMapFailover := agentsdk.NewDERPMapFailover(manifest, network.SetDERPMap)
+
 	eg, egCtx := errgroup.WithContext(ctx)
 	eg.Go(func() error {
 		a.logger.Debug(egCtx, "running tailnet connection coordinator")
@@ -851,13 +1216,25 @@ func (a *agent) run(ctx context.Context) error {
 
 	eg.Go(func() error {
 		a.logger.Debug(egCtx, "running derp map subscriber")
-		err := a.runDERPMapSubscriber(egCtx, conn, network)
+		err := a.runDERPMapSubscriber(egCtx, conn, network, derpMapFailover)
 		if err != nil {
 			return xerrors.Errorf("run derp map subscriber: %w", err)
 		}
 		return nil
 	})
 
+	eg.Go(func() error {
+		a.checkDERPConnectivity(egCtx, network, manifest.DERPMap)
+		return nil
+	})
+
+	if len(manifest.DERPMapFallbacks) > 0 {
+		eg.Go(func() error {
+			a.runDERPMapFailover(egCtx, network, derpMapFailover)
+			return nil
+		})
+	}
+
 	eg.Go(func() error {
 		a.logger.Debug(egCtx, "running fetch server banner loop")
 		err := a.fetchServiceBannerLoop(egCtx, aAPI)
@@ -867,6 +1244,16 @@ func (a *agent) run(ctx context.Context) error {
 		return nil
 	})
 
+	eg.Go(func() error {
+		a.fetchMOTDLoop(egCtx, aAPI)
+		return nil
+	})
+
+	eg.Go(func() error {
+		a.fetchAuthorizedKeysLoop(egCtx)
+		return nil
+	})
+
 	eg.Go(func() error {
 		a.logger.Debug(egCtx, "running stats report loop")
 		err := a.statsReporter.reportLoop(egCtx, aAPI)
@@ -916,6 +1303,10 @@ func (a *agent) createTailnet(ctx context.Context, agentID uuid.UUID, derpMap *t
 		Logger:              a.logger.Named("net.tailnet"),
 		ListenPort:          a.tailnetListenPort,
 		BlockEndpoints:      disableDirectConnections,
+		// Forwarded ports are only authenticated by coderd.
+		ForwardFilter: func(string, netip.AddrPort) error {
+			return a.sshServer.AuthorizeWithoutKey()
+		},
 	})
 	if err != nil {
 		return nil, xerrors.Errorf("create tailnet: %w", err)
@@ -1115,7 +1506,8 @@ func (a *agent) runCoordinator(ctx context.Context, conn drpc.Conn, network *tai
 }
 
 // runDERPMapSubscriber runs a coordinator and returns if a reconnect should occur.
-func (a *agent) runDERPMapSubscriber(ctx context.Context, conn drpc.Conn, network *tailnet.Conn) error {
+// Updates of the DERP map keep the regions the agent failed over to.
+func (a *agent) runDERPMapSubscriber(ctx context.Context, conn drpc.Conn, network *tailnet.Conn, failover *agentsdk.DERPMapFailover) error {
 	defer a.logger.Debug(ctx, "disconnected from derp map RPC")
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -1138,7 +1530,7 @@ func (a *agent) runDERPMapSubscriber(ctx context.Context, conn drpc.Conn, networ
 		}
 		dm := tailnet.DERPMapFromProto(dmp)
 		a.client.RewriteDERPMap(dm)
-		network.SetDERPMap(dm)
+		failover.SetDERPMap(dm)
 	}
 }
 
@@ -1170,6 +1562,11 @@ func (a *agent) handleReconnectingPTY(ctx context.Context, logger slog.Logger, m
 		connLogger.Info(ctx, "reconnecting pty connection closed")
 	}()
 
+	err := a.sshServer.AuthorizeWithoutKey()
+	if err != nil {
+		return xerrors.Errorf("authorize reconnecting pty: %w", err)
+	}
+
 	var rpty reconnectingpty.ReconnectingPTY
 	sendConnected := make(chan reconnectingpty.ReconnectingPTY, 1)
 	// On store, reserve this ID to prevent multiple concurrent new connections.
@@ -1197,6 +1594,12 @@ func (a *agent) handleReconnectingPTY(ctx context.Context, logger slog.Logger, m
 			}
 		}()
 
+		err := a.sshServer.CheckExecPolicy(ctx, connLogger, agentssh.ExecPolicySourceReconnectingPTY, msg.Command, conn)
+		if err != nil {
+			a.metrics.reconnectingPTYErrors.WithLabelValues("exec_policy").Add(1)
+			return err
+		}
+
 		// Empty command will default to the users shell!
 		cmd, err := a.sshServer.CreateCommand(ctx, msg.Command, nil)
 		if err != nil {
@@ -1204,10 +1607,16 @@ func (a *agent) handleReconnectingPTY(ctx context.Context, logger slog.Logger, m
 			return xerrors.Errorf("create command: %w", err)
 		}
 
-		rpty = reconnectingpty.New(ctx, cmd, &reconnectingpty.Options{
+		options := &reconnectingpty.Options{
 			Timeout: a.reconnectingPTYTimeout,
 			Metrics: a.metrics.reconnectingPTYErrors,
-		}, logger.With(slog.F("message_id", msg.ID)))
+			ID:      msg.ID.String(),
+		}
+		if manifest := a.manifest.Load(); manifest != nil {
+			options.Persist = manifest.ReconnectingPTYPersistence
+			options.ScrollbackLines = manifest.ReconnectingPTYScrollbackLines
+		}
+		rpty = reconnectingpty.New(ctx, cmd, options, logger.With(slog.F("message_id", msg.ID)))
 
 		if err = a.trackConnGoroutine(func() {
 			rpty.Wait()
@@ -1219,6 +1628,14 @@ func (a *agent) handleReconnectingPTY(ctx context.Context, logger slog.Logger, m
 
 		connected = true
 		sendConnected <- rpty
+
+		// Show the MOTD to the connection that started the session, like a
+		// login over SSH.
+		err = a.sshServer.WriteMOTD(conn, msg.Command)
+		if err != nil {
+			connLogger.Warn(ctx, "failed to show MOTD", slog.Error(err))
+			a.metrics.reconnectingPTYErrors.WithLabelValues("motd").Add(1)
+		}
 	}
 	return rpty.Attach(ctx, connectionID, conn, msg.Height, msg.Width, connLogger)
 }
@@ -1467,6 +1884,11 @@ func (a *agent) HTTPDebug() http.Handler {
 		_, _ = fmt.Fprintf(w, "updated magicsock debug logging to %v", stateBool)
 	})
 
+	r.Get("/debug/manifest", a.handleHTTPDebugManifest)
+	// The history is also served here, since the agent API isn't reachable
+	// from within the workspace.
+	r.Get("/debug/script-runs", a.handleScriptRuns)
+
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		_, _ = w.Write([]byte("404 not found"))
@@ -1476,6 +1898,13 @@ func (a *agent) HTTPDebug() http.Handler {
 }
 
 func (a *agent) Close() error {
+	return a.close(true)
+}
+
+// close closes the agent. The shutdown scripts run and the shutdown is
+// reported if shutdown is set, otherwise the workspace keeps running, e.g.
+// while the agent is replaced by an update.
+func (a *agent) close(shutdown bool) error {
 	a.closeMutex.Lock()
 	defer a.closeMutex.Unlock()
 	if a.isClosed() {
@@ -1483,8 +1912,10 @@ func (a *agent) Close() error {
 	}
 
 	ctx := context.Background()
-	a.logger.Info(ctx, "shutting down agent")
-	a.setLifecycle(ctx, codersdk.WorkspaceAgentLifecycleShuttingDown)
+	a.logger.Info(ctx, "shutting down agent", slog.F("shutdown_workspace", shutdown))
+	if shutdown {
+		a.setLifecycle(ctx, codersdk.WorkspaceAgentLifecycleShuttingDown)
+	}
 
 	// Attempt to gracefully shut down all active SSH connections and
 	// stop accepting new ones.
@@ -1494,36 +1925,42 @@ func (a *agent) Close() error {
 	}
 
 	lifecycleState := codersdk.WorkspaceAgentLifecycleOff
-	err = a.scriptRunner.Execute(ctx, func(script codersdk.WorkspaceAgentScript) bool {
-		return script.RunOnStop
-	})
-	if err != nil {
-		a.logger.Warn(ctx, "shutdown script(s) failed", slog.Error(err))
-		if errors.Is(err, agentscripts.ErrTimeout) {
-			lifecycleState = codersdk.WorkspaceAgentLifecycleShutdownTimeout
-		} else {
-			lifecycleState = codersdk.WorkspaceAgentLifecycleShutdownError
+	if shutdown {
+		err = a.scriptRunner.Execute(ctx, agentscripts.ExecuteStopScripts)
+		if err != nil {
+			a.logger.Warn(ctx, "shutdown script(s) failed", slog.Error(err))
+			if errors.Is(err, agentscripts.ErrTimeout) {
+				lifecycleState = codersdk.WorkspaceAgentLifecycleShutdownTimeout
+			} else {
+				lifecycleState = codersdk.WorkspaceAgentLifecycleShutdownError
+			}
 		}
+		a.setLifecycle(ctx, lifecycleState)
 	}
-	a.setLifecycle(ctx, lifecycleState)
 
 	err = a.scriptRunner.Close()
 	if err != nil {
 		a.logger.Error(ctx, "script runner close", slog.Error(err))
 	}
+	err = a.codeServer.Close()
+	if err != nil {
+		a.logger.Error(ctx, "code-server close", slog.Error(err))
+	}
 
-	// Wait for the lifecycle to be reported, but don't wait forever so
-	// that we don't break user expectations.
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-lifecycleWaitLoop:
-	for {
-		select {
-		case <-ctx.Done():
-			break lifecycleWaitLoop
-		case s := <-a.lifecycleReported:
-			if s == lifecycleState {
+	if shutdown {
+		// Wait for the lifecycle to be reported, but don't wait forever so
+		// that we don't break user expectations.
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+	lifecycleWaitLoop:
+		for {
+			select {
+			case <-ctx.Done():
 				break lifecycleWaitLoop
+			case s := <-a.lifecycleReported:
+				if s == lifecycleState {
+					break lifecycleWaitLoop
+				}
 			}
 		}
 	}
@@ -1539,6 +1976,36 @@ lifecycleWaitLoop:
 	return nil
 }
 
+// execUpdate replaces the agent with the updated binary. The agent is closed
+// first, so its connections and the processes it supervises are shut down
+// cleanly, but the workspace keeps running.
+func (a *agent) execUpdate(binary string) error {
+	if !agentupdate.CanExec {
+		return agentupdate.ExecBinary(binary, buildinfo.Version())
+	}
+	err := a.close(false)
+	if err != nil {
+		return xerrors.Errorf("close agent: %w", err)
+	}
+	err = agentupdate.ExecBinary(binary, buildinfo.Version())
+	// The closed agent can't be started again, so exit for the supervisor
+	// of the agent to restart it.
+	a.logger.Critical(context.Background(), "replace agent with update", slog.Error(err))
+	os.Exit(1)
+	return err
+}
+
+// codeServerInstallDir returns where code-server is installed. The cache
+// directory of the user is preferred, as it's usually persisted across
+// workspace restarts.
+func codeServerInstallDir(tempDir string) string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(tempDir, "coder-code-server")
+	}
+	return filepath.Join(cacheDir, "coder", "code-server")
+}
+
 // userHomeDir returns the home directory of the current user, giving
 // priority to the $HOME environment variable.
 func userHomeDir() (string, error) {
@@ -0,0 +1,227 @@
+// Package agentcodeserver installs code-server in the workspace and keeps it
+// running, so templates don't have to ship their own install script.
+package agentcodeserver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/pty"
+	"github.com/coder/retry"
+)
+
+// DefaultPort is the port code-server listens on if the config doesn't set
+// one.
+const DefaultPort = 13337
+
+// State is the state of the supervised code-server.
+type State string
+
+const (
+	// StateDisabled is reported before code-server is started, or if the
+	// manifest doesn't configure it.
+	StateDisabled   State = "disabled"
+	StateInstalling State = "installing"
+	StateRunning    State = "running"
+	// StateExited is reported while code-server is restarted after it
+	// exited.
+	StateExited State = "exited"
+	// StateFailed is reported while the installation is retried after it
+	// failed.
+	StateFailed State = "failed"
+)
+
+// Status reports the health of code-server.
+type Status struct {
+	State   State  `json:"state"`
+	Version string `json:"version,omitempty"`
+	Port    int    `json:"port,omitempty"`
+	// Restarts counts how often code-server exited and was started again.
+	Restarts int `json:"restarts"`
+	// Error is the reason of the last failure.
+	Error string `json:"error,omitempty"`
+}
+
+// Options are a set of options for the supervisor.
+type Options struct {
+	Logger slog.Logger
+	// InstallDir stores the installed releases of code-server, one
+	// directory per version, so they are reused across agent restarts.
+	InstallDir string
+	// LogDir receives the output of code-server in code-server.log.
+	LogDir string
+	// DownloadURL is the base URL of the releases. Defaults to
+	// DefaultDownloadURL.
+	DownloadURL string
+	// CreateCommand creates the commands running code-server, e.g. with the
+	// environment of SSH sessions.
+	CreateCommand func(ctx context.Context, script string, env []string) (*pty.Cmd, error)
+}
+
+// New creates a supervisor, which does nothing until it's started.
+func New(opts Options) *Supervisor {
+	if opts.DownloadURL == "" {
+		opts.DownloadURL = DefaultDownloadURL
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Supervisor{
+		opts:   opts,
+		ctx:    ctx,
+		cancel: cancel,
+		status: Status{State: StateDisabled},
+	}
+}
+
+// Supervisor installs code-server and restarts it when it exits.
+type Supervisor struct {
+	opts   Options
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex // Protects following.
+	started bool
+	status  Status
+}
+
+// Start installs and runs code-server in the background until the
+// supervisor is closed. It may only be called once.
+func (s *Supervisor) Start(config agentsdk.CodeServerConfig) error {
+	if config.Version == "" {
+		return xerrors.New("code-server version is required")
+	}
+	if config.Port == 0 {
+		config.Port = DefaultPort
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return xerrors.New("start: closed")
+	}
+	if s.started {
+		return xerrors.New("start: already started")
+	}
+	s.started = true
+	s.status = Status{State: StateInstalling, Version: config.Version, Port: config.Port}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.supervise(s.ctx, config)
+	}()
+	return nil
+}
+
+// Status returns the current status of code-server.
+func (s *Supervisor) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Close stops code-server and waits for it to exit.
+func (s *Supervisor) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Supervisor) setStatus(fn func(status *Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.status)
+}
+
+func (s *Supervisor) supervise(ctx context.Context, config agentsdk.CodeServerConfig) {
+	logger := s.opts.Logger.With(slog.F("version", config.Version), slog.F("port", config.Port))
+
+	var binary string
+	for r := retry.New(time.Second, time.Minute); r.Wait(ctx); {
+		var err error
+		binary, err = s.install(ctx, config)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn(ctx, "install code-server failed", slog.Error(err))
+		s.setStatus(func(status *Status) {
+			status.State = StateFailed
+			status.Error = err.Error()
+		})
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	for _, extension := range config.Extensions {
+		err := s.run(ctx, fmt.Sprintf("%s --install-extension %s", quote(binary), quote(extension)))
+		if err != nil && ctx.Err() == nil {
+			// code-server is still useful without the extension.
+			logger.Warn(ctx, "install code-server extension failed", slog.F("extension", extension), slog.Error(err))
+		}
+	}
+
+	script := fmt.Sprintf("%s --auth none --bind-addr 127.0.0.1:%d --disable-telemetry", quote(binary), config.Port)
+	for r := retry.New(time.Second, 30*time.Second); r.Wait(ctx); {
+		s.setStatus(func(status *Status) {
+			status.State = StateRunning
+		})
+		logger.Info(ctx, "starting code-server")
+		start := time.Now()
+		err := s.run(ctx, script)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = xerrors.New("exited")
+		}
+		// Restart immediately if code-server ran for a while, only
+		// crash loops are backed off.
+		if time.Since(start) > time.Minute {
+			r.Reset()
+		}
+		logger.Warn(ctx, "code-server exited, restarting", slog.Error(err))
+		s.setStatus(func(status *Status) {
+			status.State = StateExited
+			status.Restarts++
+			status.Error = err.Error()
+		})
+	}
+}
+
+// run runs the script until it exits, appending its output to the log.
+func (s *Supervisor) run(ctx context.Context, script string) error {
+	cmdPty, err := s.opts.CreateCommand(ctx, script, nil)
+	if err != nil {
+		return xerrors.Errorf("create command: %w", err)
+	}
+	cmd := cmdPty.AsExec()
+	cmd.WaitDelay = 10 * time.Second
+	if s.opts.LogDir != "" {
+		logPath := filepath.Join(s.opts.LogDir, "code-server.log")
+		logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return xerrors.Errorf("open log %q: %w", logPath, err)
+		}
+		defer logFile.Close()
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+	}
+	return cmd.Run()
+}
+
+// quote quotes s for POSIX shells.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,306 @@
+package agentcodeserver_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/coder/v2/agent/agentcodeserver"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/pty"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// fakeCodeServer records its arguments and exits, so it's restarted by the
+// supervisor.
+const fakeCodeServer = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/../invocations"
+`
+
+func TestSupervisor(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("code-server isn't available on Windows")
+	}
+
+	const version = "4.20.0"
+	name := fmt.Sprintf("code-server-%s-%s", version, platform())
+	archive := releaseArchive(t, name, fakeCodeServer)
+	checksums := map[string]string{platform(): checksum(archive)}
+
+	var downloads atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/v%s/%s.tar.gz", version, name) {
+			http.NotFound(w, r)
+			return
+		}
+		downloads.Add(1)
+		_, _ = w.Write(archive)
+	}))
+	defer srv.Close()
+
+	installDir := t.TempDir()
+	supervisor := agentcodeserver.New(agentcodeserver.Options{
+		Logger:      slogtest.Make(t, nil),
+		InstallDir:  installDir,
+		LogDir:      t.TempDir(),
+		DownloadURL: srv.URL,
+		CreateCommand: func(ctx context.Context, script string, env []string) (*pty.Cmd, error) {
+			return pty.CommandContext(ctx, "sh", "-c", script), nil
+		},
+	})
+	defer supervisor.Close()
+	require.Equal(t, agentcodeserver.StateDisabled, supervisor.Status().State)
+
+	err := supervisor.Start(agentsdk.CodeServerConfig{
+		Version:    version,
+		Extensions: []string{"golang.go"},
+		Checksums:  checksums,
+	})
+	require.NoError(t, err)
+	require.Error(t, supervisor.Start(agentsdk.CodeServerConfig{Version: version}), "only started once")
+
+	invocationsPath := filepath.Join(installDir, name, "invocations")
+	var invocations []string
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(invocationsPath)
+		if err != nil {
+			return false
+		}
+		invocations = strings.Split(strings.TrimSpace(string(data)), "\n")
+		return len(invocations) >= 3
+	}, testutil.WaitLong, testutil.IntervalFast)
+	require.Equal(t, "--install-extension golang.go", invocations[0])
+	serverArgs := fmt.Sprintf("--auth none --bind-addr 127.0.0.1:%d --disable-telemetry", agentcodeserver.DefaultPort)
+	require.Equal(t, serverArgs, invocations[1])
+	require.Equal(t, serverArgs, invocations[2], "code-server is restarted")
+
+	status := supervisor.Status()
+	require.Equal(t, version, status.Version)
+	require.GreaterOrEqual(t, status.Restarts, 1)
+	require.NoError(t, supervisor.Close())
+	require.EqualValues(t, 1, downloads.Load())
+
+	// Installed releases are reused.
+	supervisor = agentcodeserver.New(agentcodeserver.Options{
+		Logger:      slogtest.Make(t, nil),
+		InstallDir:  installDir,
+		DownloadURL: srv.URL,
+		CreateCommand: func(ctx context.Context, script string, env []string) (*pty.Cmd, error) {
+			return pty.CommandContext(ctx, "sh", "-c", script), nil
+		},
+	})
+	defer supervisor.Close()
+	require.NoError(t, supervisor.Start(agentsdk.CodeServerConfig{Version: version, Port: 8080, Checksums: checksums}))
+	require.Eventually(t, func() bool {
+		return supervisor.Status().Restarts > 0
+	}, testutil.WaitLong, testutil.IntervalFast)
+	require.NoError(t, supervisor.Close())
+	require.EqualValues(t, 1, downloads.Load())
+}
+
+func TestSupervisor_InstallFailure(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("code-server isn't available on Windows")
+	}
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	supervisor := agentcodeserver.New(agentcodeserver.Options{
+		Logger:      slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+		InstallDir:  t.TempDir(),
+		DownloadURL: srv.URL,
+		CreateCommand: func(ctx context.Context, script string, env []string) (*pty.Cmd, error) {
+			return pty.CommandContext(ctx, "sh", "-c", script), nil
+		},
+	})
+	defer supervisor.Close()
+	require.Error(t, supervisor.Start(agentsdk.CodeServerConfig{}), "version is required")
+	require.NoError(t, supervisor.Start(agentsdk.CodeServerConfig{
+		Version:   "4.20.0",
+		Checksums: map[string]string{platform(): checksum(nil)},
+	}))
+	require.Eventually(t, func() bool {
+		status := supervisor.Status()
+		return status.State == agentcodeserver.StateFailed && strings.Contains(status.Error, "404")
+	}, testutil.WaitLong, testutil.IntervalFast)
+}
+
+func TestSupervisor_InvalidRelease(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("code-server isn't available on Windows")
+	}
+
+	const version = "4.20.0"
+	name := fmt.Sprintf("code-server-%s-%s", version, platform())
+
+	for _, tc := range []struct {
+		name    string
+		archive func(t *testing.T, outside string) []byte
+		// checksum overrides the checksum of the archive if set.
+		checksum string
+		err      string
+	}{{
+		name: "NoChecksum",
+		archive: func(t *testing.T, _ string) []byte {
+			return releaseArchive(t, name, fakeCodeServer)
+		},
+		checksum: "-",
+		err:      "no checksum",
+	}, {
+		name: "ChecksumMismatch",
+		archive: func(t *testing.T, _ string) []byte {
+			return releaseArchive(t, name, fakeCodeServer)
+		},
+		checksum: checksum([]byte("other")),
+		err:      "checksum mismatch",
+	}, {
+		name: "SymlinkEscape",
+		archive: func(t *testing.T, outside string) []byte {
+			return releaseArchive(t, name, fakeCodeServer, &tar.Header{
+				Name:     name + "/lib",
+				Typeflag: tar.TypeSymlink,
+				Linkname: "../../../../" + filepath.Base(outside),
+			}, &tar.Header{
+				Name:     name + "/lib/pwned",
+				Typeflag: tar.TypeReg,
+				Mode:     0o644,
+			})
+		},
+		err: "outside of the install directory",
+	}, {
+		name: "AbsoluteSymlink",
+		archive: func(t *testing.T, outside string) []byte {
+			return releaseArchive(t, name, fakeCodeServer, &tar.Header{
+				Name:     name + "/lib",
+				Typeflag: tar.TypeSymlink,
+				Linkname: outside,
+			})
+		},
+		err: "absolute symlink target",
+	}, {
+		name: "HardLink",
+		archive: func(t *testing.T, outside string) []byte {
+			return releaseArchive(t, name, fakeCodeServer, &tar.Header{
+				Name:     name + "/lib",
+				Typeflag: tar.TypeLink,
+				Linkname: outside,
+			})
+		},
+		err: "hard links are not supported",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The install directory is nested, so relative symlinks
+			// escaping it end up in root.
+			root := t.TempDir()
+			outside := filepath.Join(root, "outside")
+			require.NoError(t, os.Mkdir(outside, 0o755))
+			installDir := filepath.Join(root, "agent", "code-server")
+
+			archive := tc.archive(t, outside)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(archive)
+			}))
+			defer srv.Close()
+
+			checksums := map[string]string{platform(): checksum(archive)}
+			switch tc.checksum {
+			case "":
+			case "-":
+				checksums = nil
+			default:
+				checksums[platform()] = tc.checksum
+			}
+			supervisor := agentcodeserver.New(agentcodeserver.Options{
+				Logger:      slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+				InstallDir:  installDir,
+				DownloadURL: srv.URL,
+				CreateCommand: func(ctx context.Context, script string, env []string) (*pty.Cmd, error) {
+					return pty.CommandContext(ctx, "sh", "-c", script), nil
+				},
+			})
+			defer supervisor.Close()
+			require.NoError(t, supervisor.Start(agentsdk.CodeServerConfig{Version: version, Checksums: checksums}))
+			require.Eventually(t, func() bool {
+				status := supervisor.Status()
+				return status.State == agentcodeserver.StateFailed && strings.Contains(status.Error, tc.err)
+			}, testutil.WaitLong, testutil.IntervalFast)
+			require.NoError(t, supervisor.Close())
+
+			entries, err := os.ReadDir(outside)
+			require.NoError(t, err)
+			require.Empty(t, entries, "nothing is written outside of the install directory")
+			_, err = os.Stat(filepath.Join(installDir, name))
+			require.ErrorIs(t, err, os.ErrNotExist, "invalid releases aren't installed")
+		})
+	}
+}
+
+// platform returns the platform of the release archives of code-server.
+func platform() string {
+	osName := runtime.GOOS
+	if osName == "darwin" {
+		osName = "macos"
+	}
+	return osName + "-" + runtime.GOARCH
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// releaseArchive returns a release archive with the binary, followed by the
+// extra entries, which are empty.
+func releaseArchive(t *testing.T, name, binary string, extra ...*tar.Header) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     name + "/bin/",
+		Typeflag: tar.TypeDir,
+		Mode:     0o755,
+	}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     name + "/bin/code-server",
+		Typeflag: tar.TypeReg,
+		Mode:     0o755,
+		Size:     int64(len(binary)),
+	}))
+	_, err := tw.Write([]byte(binary))
+	require.NoError(t, err)
+	for _, header := range extra {
+		require.NoError(t, tw.WriteHeader(header))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
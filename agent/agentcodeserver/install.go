@@ -0,0 +1,246 @@
+package agentcodeserver
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// DefaultDownloadURL is the base URL of code-server releases.
+const DefaultDownloadURL = "https://github.com/coder/code-server/releases/download"
+
+// releasePlatform returns the platform of the code-server release archives,
+// e.g. "linux-amd64", which keys their checksums.
+func releasePlatform(goos, goarch string) (string, error) {
+	switch goos {
+	case "linux":
+	case "darwin":
+		goos = "macos"
+	default:
+		return "", xerrors.Errorf("code-server is not available for %s", goos)
+	}
+	switch goarch {
+	case "amd64", "arm64":
+	case "arm":
+		goarch = "armv7l"
+	default:
+		return "", xerrors.Errorf("code-server is not available for %s", goarch)
+	}
+	return goos + "-" + goarch, nil
+}
+
+// install downloads the version of code-server into the install directory
+// unless it's installed already, and returns the path of its binary. The
+// release archive must match its pinned SHA256 checksum.
+func (s *Supervisor) install(ctx context.Context, config agentsdk.CodeServerConfig) (string, error) {
+	platform, err := releasePlatform(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("code-server-%s-%s", config.Version, platform)
+	dir := filepath.Join(s.opts.InstallDir, name)
+	binary := filepath.Join(dir, "bin", "code-server")
+	if _, err := os.Stat(binary); err == nil {
+		return binary, nil
+	}
+	checksum, ok := config.Checksums[platform]
+	if !ok {
+		return "", xerrors.Errorf("no checksum of code-server %s for %s is configured", config.Version, platform)
+	}
+
+	err = os.MkdirAll(s.opts.InstallDir, 0o755)
+	if err != nil {
+		return "", xerrors.Errorf("create install dir: %w", err)
+	}
+	// Extract next to the final directory and rename it, so interrupted
+	// installations are never mistaken for complete ones.
+	tmpDir, err := os.MkdirTemp(s.opts.InstallDir, "."+name+"-*")
+	if err != nil {
+		return "", xerrors.Errorf("create temporary dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	url := fmt.Sprintf("%s/v%s/%s.tar.gz", strings.TrimSuffix(s.opts.DownloadURL, "/"), config.Version, name)
+	archive, err := download(ctx, url, filepath.Join(tmpDir, "release.tar.gz"), checksum)
+	if err != nil {
+		return "", xerrors.Errorf("download %s: %w", url, err)
+	}
+	defer archive.Close()
+	releaseDir := filepath.Join(tmpDir, "release")
+	err = extractRelease(archive, releaseDir)
+	if err != nil {
+		return "", xerrors.Errorf("extract %s: %w", url, err)
+	}
+	if _, err := os.Stat(filepath.Join(releaseDir, "bin", "code-server")); err != nil {
+		return "", xerrors.Errorf("release %s doesn't contain bin/code-server", url)
+	}
+	err = os.Rename(releaseDir, dir)
+	if err != nil {
+		return "", xerrors.Errorf("rename %q: %w", releaseDir, err)
+	}
+	return binary, nil
+}
+
+// download downloads url to path and returns the file, rewound, if its
+// SHA256 checksum matches the hex-encoded checksum.
+func download(ctx context.Context, url, path, checksum string) (*os.File, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("create request: %w", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("unexpected status %s", res.Status)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), res.Body)
+	if err == nil {
+		if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, checksum) {
+			err = xerrors.Errorf("checksum mismatch: got sha256 %s, expected %s", sum, checksum)
+		}
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// extractRelease extracts a gzipped release archive into dir. The top-level
+// directory of the archive is stripped. Every entry, and the target of every
+// symlink, must resolve within dir, so an archive can't write outside of it
+// through the symlinks it contains. Hard links are rejected.
+func extractRelease(r io.Reader, dir string) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if xerrors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, name, ok := strings.Cut(filepath.ToSlash(filepath.Clean(header.Name)), "/")
+		if !ok || name == "" {
+			continue
+		}
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return xerrors.Errorf("invalid path %q", header.Name)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err = checkWithin(dir, path)
+		if err != nil {
+			return xerrors.Errorf("%q: %w", header.Name, err)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0o755)
+		case tar.TypeReg:
+			err = extractFile(tr, path, header.FileInfo().Mode().Perm())
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) {
+				return xerrors.Errorf("%q: absolute symlink target %q", header.Name, header.Linkname)
+			}
+			err = checkWithin(dir, filepath.Join(filepath.Dir(path), header.Linkname))
+			if err != nil {
+				return xerrors.Errorf("%q: symlink target %q: %w", header.Name, header.Linkname, err)
+			}
+			err = os.MkdirAll(filepath.Dir(path), 0o755)
+			if err == nil {
+				err = os.Symlink(header.Linkname, path)
+			}
+		case tar.TypeLink:
+			return xerrors.Errorf("%q: hard links are not supported", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkWithin returns an error unless path resolves within dir, following
+// the symlinks of its longest existing prefix. dir must be resolved already.
+func checkWithin(dir, path string) error {
+	existing := filepath.Clean(path)
+	var rest []string
+	for {
+		_, err := os.Lstat(existing)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		rest = append([]string{filepath.Base(existing)}, rest...)
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return err
+	}
+	resolved = filepath.Join(append([]string{resolved}, rest...)...)
+	rel, err := filepath.Rel(dir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return xerrors.Errorf("resolves to %q outside of the install directory", resolved)
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, path string, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	//nolint:gosec // Releases are verified by their checksum.
+	_, err = io.Copy(f, r)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,157 @@
+// Package agentgit configures Git for the owner of the workspace when the
+// agent starts, so templates don't have to ship their own snippets setting
+// the identity and credentials of the owner.
+package agentgit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+)
+
+// ErrGitNotFound is returned if git isn't installed in the workspace.
+var ErrGitNotFound = xerrors.New("git is not installed")
+
+// Config is the configuration applied to Git.
+type Config struct {
+	// UserName and UserEmail are set as "user.name" and "user.email".
+	// Empty values are skipped.
+	UserName  string
+	UserEmail string
+	// CredentialHelper is added to the "credential.helper" list, e.g. the
+	// agent fetching tokens of external auth providers. Empty to skip.
+	CredentialHelper string
+	// CredentialHelperRegex matches the helpers added by earlier agents,
+	// which are replaced by CredentialHelper. They break every Git command
+	// once their executable is gone, e.g. when the agent was downloaded to
+	// another temporary directory. Git must support it as value regex.
+	CredentialHelperRegex *regexp.Regexp
+	// Env is the environment git runs with. Defaults to the environment of
+	// the agent.
+	Env []string
+}
+
+// Configure writes the configuration to the global Git configuration of the
+// user the agent runs as. Values the user already configured, e.g. with
+// their dotfiles, are kept. It returns a description of each change and of
+// each kept value, to be shown to the user.
+func Configure(ctx context.Context, cfg Config) ([]string, error) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return nil, ErrGitNotFound
+	}
+	if cfg.Env == nil {
+		cfg.Env = os.Environ()
+	}
+	g := &gitConfig{path: gitPath, env: cfg.Env}
+
+	var changes []string
+	for _, kv := range []struct{ key, value string }{
+		{"user.name", cfg.UserName},
+		{"user.email", cfg.UserEmail},
+	} {
+		if kv.value == "" {
+			continue
+		}
+		current, err := g.get(ctx, kv.key)
+		if err != nil {
+			return changes, err
+		}
+		if len(current) > 0 {
+			changes = append(changes, fmt.Sprintf("Kept %s %q", kv.key, current[len(current)-1]))
+			continue
+		}
+		err = g.run(ctx, "--global", kv.key, kv.value)
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, fmt.Sprintf("Set %s to %q", kv.key, kv.value))
+	}
+
+	if cfg.CredentialHelper != "" {
+		helpers, err := g.get(ctx, "credential.helper")
+		if err != nil {
+			return changes, err
+		}
+		var previous []string
+		if cfg.CredentialHelperRegex != nil {
+			for _, helper := range helpers {
+				if cfg.CredentialHelperRegex.MatchString(helper) {
+					previous = append(previous, helper)
+				}
+			}
+		}
+		switch {
+		case len(previous) > 0 && !slices.Equal(previous, []string{cfg.CredentialHelper}):
+			err = g.run(ctx, "--global", "--unset-all", "credential.helper", cfg.CredentialHelperRegex.String())
+			if err != nil {
+				return changes, err
+			}
+			err = g.addCredentialHelper(ctx, cfg.CredentialHelper)
+			if err != nil {
+				return changes, err
+			}
+			changes = append(changes, "Replaced the Coder credential helper of a previous agent")
+		case !slices.Contains(helpers, cfg.CredentialHelper):
+			err = g.addCredentialHelper(ctx, cfg.CredentialHelper)
+			if err != nil {
+				return changes, err
+			}
+			changes = append(changes, "Added the Coder credential helper for external auth providers")
+		}
+	}
+	return changes, nil
+}
+
+type gitConfig struct {
+	path string
+	env  []string
+}
+
+// addCredentialHelper appends the helper to the list. Git asks the helpers
+// in order, so helpers the user configured are asked first.
+func (g *gitConfig) addCredentialHelper(ctx context.Context, helper string) error {
+	return g.run(ctx, "--global", "--add", "credential.helper", helper)
+}
+
+// get returns all values of the key in the global configuration.
+func (g *gitConfig) get(ctx context.Context, key string) ([]string, error) {
+	var stdout bytes.Buffer
+	err := g.exec(ctx, &stdout, "--global", "--get-all", key)
+	var exitErr *exec.ExitError
+	// Exit code 1 means the key isn't set.
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(stdout.String(), "\n"), "\n"), nil
+}
+
+func (g *gitConfig) run(ctx context.Context, args ...string) error {
+	return g.exec(ctx, io.Discard, args...)
+}
+
+func (g *gitConfig) exec(ctx context.Context, stdout io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	//nolint:gosec // The arguments are not user input.
+	cmd := exec.CommandContext(ctx, g.path, append([]string{"config"}, args...)...)
+	cmd.Env = g.env
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return xerrors.Errorf("git config %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package agentgit_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/agent/agentgit"
+	"github.com/coder/coder/v2/cli/gitauth"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestConfigure(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	gitEnv := func(t *testing.T) []string {
+		home := t.TempDir()
+		return []string{"HOME=" + home, "XDG_CONFIG_HOME=" + home, "GIT_CONFIG_NOSYSTEM=1"}
+	}
+	gitConfig := func(t *testing.T, env []string, key string) string {
+		cmd := exec.Command("git", "config", "--global", "--get-all", key)
+		cmd.Env = env
+		out, _ := cmd.Output()
+		return strings.TrimSpace(string(out))
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		env := gitEnv(t)
+		cfg := agentgit.Config{
+			UserName:         "kyle",
+			UserEmail:        "kyle@coder.com",
+			CredentialHelper: "!'/usr/bin/coder' gitaskpass",
+			Env:              env,
+		}
+		changes, err := agentgit.Configure(ctx, cfg)
+		require.NoError(t, err)
+		require.Len(t, changes, 3)
+		require.Equal(t, "kyle", gitConfig(t, env, "user.name"))
+		require.Equal(t, "kyle@coder.com", gitConfig(t, env, "user.email"))
+		require.Equal(t, cfg.CredentialHelper, gitConfig(t, env, "credential.helper"))
+
+		// Configuring again doesn't add the helper twice.
+		_, err = agentgit.Configure(ctx, cfg)
+		require.NoError(t, err)
+		require.Equal(t, cfg.CredentialHelper, gitConfig(t, env, "credential.helper"))
+	})
+
+	t.Run("KeepsUserConfig", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		env := gitEnv(t)
+		for _, args := range [][]string{
+			{"user.name", "Kyle Carberry"},
+			{"credential.helper", "store"},
+		} {
+			cmd := exec.Command("git", append([]string{"config", "--global"}, args...)...)
+			cmd.Env = env
+			require.NoError(t, cmd.Run())
+		}
+
+		changes, err := agentgit.Configure(ctx, agentgit.Config{
+			UserName:         "kyle",
+			CredentialHelper: "!'/usr/bin/coder' gitaskpass",
+			Env:              env,
+		})
+		require.NoError(t, err)
+		require.Contains(t, changes, `Kept user.name "Kyle Carberry"`)
+		require.Equal(t, "Kyle Carberry", gitConfig(t, env, "user.name"))
+		require.Empty(t, gitConfig(t, env, "user.email"))
+		// The helper of the user is asked first.
+		require.Equal(t, "store\n!'/usr/bin/coder' gitaskpass", gitConfig(t, env, "credential.helper"))
+	})
+
+	t.Run("ReplacesPreviousHelpers", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		env := gitEnv(t)
+		// Agents bootstrapped to temporary directories each added a helper.
+		for _, helper := range []string{"!'/tmp/coder.abc/coder' gitaskpass", "store", "!'/tmp/coder.def/coder' gitaskpass"} {
+			cmd := exec.Command("git", "config", "--global", "--add", "credential.helper", helper)
+			cmd.Env = env
+			require.NoError(t, cmd.Run())
+		}
+
+		cfg := agentgit.Config{
+			CredentialHelper:      "!'/tmp/coder.ghi/coder' gitaskpass",
+			CredentialHelperRegex: gitauth.CredentialHelperRegex,
+			Env:                   env,
+		}
+		changes, err := agentgit.Configure(ctx, cfg)
+		require.NoError(t, err)
+		require.Equal(t, []string{"Replaced the Coder credential helper of a previous agent"}, changes)
+		require.Equal(t, "store\n!'/tmp/coder.ghi/coder' gitaskpass", gitConfig(t, env, "credential.helper"))
+
+		// The current helper is kept.
+		changes, err = agentgit.Configure(ctx, cfg)
+		require.NoError(t, err)
+		require.Empty(t, changes)
+		require.Equal(t, "store\n!'/tmp/coder.ghi/coder' gitaskpass", gitConfig(t, env, "credential.helper"))
+	})
+}
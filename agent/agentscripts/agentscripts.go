@@ -9,19 +9,22 @@ import (
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"sync"
-	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/robfig/cron/v3"
 	"github.com/spf13/afero"
+	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/xerrors"
 
 	"cdr.dev/slog"
 
 	"github.com/coder/coder/v2/agent/agentssh"
+	"github.com/coder/coder/v2/agent/procgroup"
 	"github.com/coder/coder/v2/codersdk"
 	"github.com/coder/coder/v2/codersdk/agentsdk"
 )
@@ -41,6 +44,15 @@ var (
 	parser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.DowOptional)
 )
 
+const (
+	// DefaultLogRateLimit is the default rate of log lines per second a
+	// script sends to coderd.
+	DefaultLogRateLimit = 100
+	// DefaultLogRateLimitBurst is the default number of log lines a script
+	// sends at once before it's rate limited.
+	DefaultLogRateLimitBurst = 1000
+)
+
 // Options are a set of options for the runner.
 type Options struct {
 	LogDir     string
@@ -48,6 +60,46 @@ type Options struct {
 	SSHServer  *agentssh.Server
 	Filesystem afero.Fs
 	PatchLogs  func(ctx context.Context, req agentsdk.PatchLogs) error
+	// UploadArtifacts is called with an archive of the files a script wrote
+	// to its artifacts directory. If nil, scripts are not given an artifacts
+	// directory.
+	UploadArtifacts func(ctx context.Context, req agentsdk.ScriptArtifacts) error
+	// ArtifactsMaxSize limits the size of the artifacts archive of a single
+	// script execution. Defaults to DefaultArtifactsMaxSize.
+	ArtifactsMaxSize int64
+	// ArtifactsBytesPerSecond limits the bandwidth artifacts are uploaded
+	// with, so they don't slow down the workspace's connection. Defaults
+	// to DefaultArtifactsBytesPerSecond.
+	ArtifactsBytesPerSecond int64
+	// Hooks are called around every script execution, in order.
+	Hooks []Hook
+	// TasksPath persists the tasks scheduled by the workspace owner at
+	// runtime. If empty, tasks are lost when the agent restarts.
+	TasksPath string
+	// Manifest provides the variables scripts are expanded with, see
+	// TemplateData. If nil, scripts aren't expanded.
+	Manifest *atomic.Pointer[agentsdk.Manifest]
+	// LogRateLimit limits the log lines per second every script sends to
+	// coderd, lines exceeding the limit are only written to the log file of
+	// the script and summarized. Defaults to DefaultLogRateLimit, a
+	// negative value disables the limit.
+	LogRateLimit float64
+	// LogRateLimitBurst is the number of log lines a script sends at once
+	// before it's rate limited. Defaults to DefaultLogRateLimitBurst.
+	LogRateLimitBurst int
+	// LogFlushTimeout bounds the time the logs of a script are flushed for
+	// once it exited, and the time Close flushes the pending logs of all
+	// scripts for. Defaults to DefaultLogFlushTimeout.
+	LogFlushTimeout time.Duration
+	// HistoryPath persists the history of script runs. If empty, the
+	// history is lost when the agent restarts.
+	HistoryPath string
+	// HistorySize is the number of script runs kept in the history.
+	// Defaults to DefaultHistorySize.
+	HistorySize int
+	// PostNotification notifies the workspace owner when a scheduled script
+	// starts failing. If nil, failures are only logged.
+	PostNotification func(ctx context.Context, notification agentsdk.Notification) error
 }
 
 // New creates a runner for the provided scripts.
@@ -58,6 +110,10 @@ func New(opts Options) *Runner {
 		cronCtx:       cronCtx,
 		cronCtxCancel: cronCtxCancel,
 		cron:          cron.New(cron.WithParser(parser)),
+		cronEntries:   make(map[codersdk.WorkspaceAgentScript][]cron.EntryID),
+		tasks:         make(map[uuid.UUID]scheduledTask),
+		statuses:      make(map[codersdk.WorkspaceAgentScript]ScriptStatus),
+		logSenders:    make(map[*scriptLogSender]struct{}),
 		closed:        make(chan struct{}),
 		scriptsExecuted: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Namespace: "agent",
@@ -76,8 +132,29 @@ type Runner struct {
 	closed        chan struct{}
 	closeMutex    sync.Mutex
 	cron          *cron.Cron
-	initialized   atomic.Bool
-	scripts       []codersdk.WorkspaceAgentScript
+
+	scriptsMu sync.Mutex // Protects following.
+	scripts   []codersdk.WorkspaceAgentScript
+	// cronEntries are the cron entries of scheduled scripts.
+	cronEntries map[codersdk.WorkspaceAgentScript][]cron.EntryID
+	// tasks are the tasks scheduled by the workspace owner, which aren't
+	// affected by Init.
+	tasks map[uuid.UUID]scheduledTask
+
+	statusMu sync.Mutex
+	// statuses are the statuses of the last execution of scripts.
+	statuses map[codersdk.WorkspaceAgentScript]ScriptStatus
+
+	historyMu sync.Mutex
+	// history are the recent runs of scripts, oldest first.
+	history []ScriptRun
+
+	logSendersMu sync.Mutex
+	// logSenders are the log senders of scripts that are running or
+	// flushing their logs.
+	logSenders map[*scriptLogSender]struct{}
+	// logShutdown is set once the runner is closing, see startLogShutdown.
+	logShutdown *logShutdown
 
 	// scriptsExecuted includes all scripts executed by the workspace agent. Agents
 	// execute startup scripts, and scripts on a cron schedule. Both will increment
@@ -96,29 +173,73 @@ func (r *Runner) RegisterMetrics(reg prometheus.Registerer) {
 // Init initializes the runner with the provided scripts.
 // It also schedules any scripts that have a schedule.
 // This function must be called before Execute.
+//
+// Init may be called again with an updated set of scripts, e.g. after the
+// manifest changed. Scheduled scripts that were removed are unscheduled and
+// added ones are scheduled, unchanged scripts keep their schedule. Scripts
+// that run on start aren't run again.
 func (r *Runner) Init(scripts []codersdk.WorkspaceAgentScript) error {
-	if r.initialized.Load() {
-		return xerrors.New("init: already initialized")
+	r.scriptsMu.Lock()
+	defer r.scriptsMu.Unlock()
+	if r.isClosed() {
+		return xerrors.New("init: closed")
 	}
-	r.initialized.Store(true)
-	r.scripts = scripts
-	r.Logger.Info(r.cronCtx, "initializing agent scripts", slog.F("script_count", len(scripts)), slog.F("log_dir", r.LogDir))
 
+	// Count the wanted schedules of every script, identical scripts may be
+	// specified more than once.
+	wanted := make(map[codersdk.WorkspaceAgentScript]int)
 	for _, script := range scripts {
 		if script.Cron == "" {
 			continue
 		}
-		script := script
-		_, err := r.cron.AddFunc(script.Cron, func() {
-			err := r.trackRun(r.cronCtx, script)
-			if err != nil {
-				r.Logger.Warn(context.Background(), "run agent script on schedule", slog.Error(err))
-			}
-		})
+		wanted[script]++
+	}
+	// Validate all schedules first, so a failed update doesn't leave the
+	// runner with only some of its scripts.
+	schedules := make(map[codersdk.WorkspaceAgentScript]cron.Schedule, len(wanted))
+	for script := range wanted {
+		schedule, err := parseSchedule(script.Cron)
 		if err != nil {
 			return xerrors.Errorf("add schedule: %w", err)
 		}
+		schedules[script] = schedule
+	}
+
+	removed := 0
+	for script, entries := range r.cronEntries {
+		for len(entries) > wanted[script] {
+			r.cron.Remove(entries[len(entries)-1])
+			entries = entries[:len(entries)-1]
+			removed++
+		}
+		if len(entries) == 0 {
+			delete(r.cronEntries, script)
+			continue
+		}
+		r.cronEntries[script] = entries
+	}
+	added := 0
+	for script, count := range wanted {
+		script := script
+		for len(r.cronEntries[script]) < count {
+			id := r.cron.Schedule(schedules[script], cron.FuncJob(func() {
+				err := r.trackRun(r.cronCtx, script, codersdk.WorkspaceAgentScriptStageCron)
+				if err != nil {
+					r.Logger.Warn(context.Background(), "run agent script on schedule", slog.Error(err))
+				}
+			}))
+			r.cronEntries[script] = append(r.cronEntries[script], id)
+			added++
+		}
 	}
+
+	if r.scripts == nil {
+		r.Logger.Info(r.cronCtx, "initializing agent scripts", slog.F("script_count", len(scripts)), slog.F("log_dir", r.LogDir))
+	} else {
+		r.Logger.Info(r.cronCtx, "updated agent scripts", slog.F("script_count", len(scripts)),
+			slog.F("added_schedules", added), slog.F("removed_schedules", removed))
+	}
+	r.scripts = append(make([]codersdk.WorkspaceAgentScript, 0, len(scripts)), scripts...)
 	return nil
 }
 
@@ -147,22 +268,119 @@ func (r *Runner) StartCron() {
 	}
 }
 
-// Execute runs a set of scripts according to a filter.
-func (r *Runner) Execute(ctx context.Context, filter func(script codersdk.WorkspaceAgentScript) bool) error {
-	if filter == nil {
-		// Execute em' all!
-		filter = func(script codersdk.WorkspaceAgentScript) bool {
-			return true
+// ExecuteOption selects the scripts run by Execute.
+type ExecuteOption int
+
+const (
+	// ExecuteAllScripts runs every script.
+	ExecuteAllScripts ExecuteOption = iota
+	// ExecuteStartScripts runs the scripts that run on start.
+	ExecuteStartScripts
+	// ExecuteStopScripts runs the scripts that run on stop.
+	ExecuteStopScripts
+	// ExecuteCronScripts runs the scripts that have a schedule once, outside
+	// of their schedule.
+	ExecuteCronScripts
+	// ExecutePostStartScripts runs the scripts that run once the agent is
+	// ready, so they don't delay the startup of the workspace.
+	ExecutePostStartScripts
+	// ExecuteBuildSuccessScripts runs the scripts that run once the
+	// workspace build succeeds.
+	ExecuteBuildSuccessScripts
+	// ExecuteBuildFailureScripts runs the scripts that run once the
+	// workspace build fails.
+	ExecuteBuildFailureScripts
+)
+
+func (o ExecuteOption) String() string {
+	switch o {
+	case ExecuteAllScripts:
+		return "all"
+	case ExecuteStartScripts:
+		return "start"
+	case ExecuteStopScripts:
+		return "stop"
+	case ExecuteCronScripts:
+		return "cron"
+	case ExecutePostStartScripts:
+		return "post_start"
+	case ExecuteBuildSuccessScripts:
+		return "build_success"
+	case ExecuteBuildFailureScripts:
+		return "build_failure"
+	default:
+		return fmt.Sprintf("ExecuteOption(%d)", int(o))
+	}
+}
+
+// matches returns whether the script is run for the option.
+func (o ExecuteOption) matches(script codersdk.WorkspaceAgentScript) bool {
+	switch o {
+	case ExecuteAllScripts:
+		return true
+	case ExecuteStartScripts:
+		return script.RunOnStart
+	case ExecuteStopScripts:
+		return script.RunOnStop
+	case ExecuteCronScripts:
+		return script.Cron != ""
+	case ExecutePostStartScripts:
+		return script.RunOnPostStart
+	case ExecuteBuildSuccessScripts:
+		return script.RunOnBuildSuccess
+	case ExecuteBuildFailureScripts:
+		return script.RunOnBuildFailure
+	default:
+		return false
+	}
+}
+
+// stage returns the stage the script runs in when it's selected by the
+// option. Scripts run by ExecuteAllScripts are in the first stage they run
+// in.
+func (o ExecuteOption) stage(script codersdk.WorkspaceAgentScript) codersdk.WorkspaceAgentScriptStage {
+	switch o {
+	case ExecuteStartScripts:
+		return codersdk.WorkspaceAgentScriptStageStart
+	case ExecuteStopScripts:
+		return codersdk.WorkspaceAgentScriptStageStop
+	case ExecuteCronScripts:
+		return codersdk.WorkspaceAgentScriptStageCron
+	case ExecutePostStartScripts:
+		return codersdk.WorkspaceAgentScriptStagePostStart
+	case ExecuteBuildSuccessScripts:
+		return codersdk.WorkspaceAgentScriptStageBuildSuccess
+	case ExecuteBuildFailureScripts:
+		return codersdk.WorkspaceAgentScriptStageBuildFailure
+	}
+	for _, option := range []ExecuteOption{
+		ExecuteStartScripts, ExecutePostStartScripts, ExecuteStopScripts,
+		ExecuteCronScripts, ExecuteBuildSuccessScripts, ExecuteBuildFailureScripts,
+	} {
+		if option.matches(script) {
+			return option.stage(script)
 		}
 	}
+	if script.DiskPressurePath != "" {
+		return codersdk.WorkspaceAgentScriptStageDiskPressure
+	}
+	return ""
+}
+
+// Execute runs the scripts selected by the option.
+func (r *Runner) Execute(ctx context.Context, option ExecuteOption) error {
+	r.scriptsMu.Lock()
+	scripts := r.scripts
+	r.scriptsMu.Unlock()
+
 	var eg errgroup.Group
-	for _, script := range r.scripts {
-		if !filter(script) {
+	for _, script := range scripts {
+		if !option.matches(script) {
 			continue
 		}
 		script := script
 		eg.Go(func() error {
-			err := r.trackRun(ctx, script)
+			err := r.trackRun(ctx, script, option.stage(script))
 			if err != nil {
 				return xerrors.Errorf("run agent script %q: %w", script.LogSourceID, err)
 			}
@@ -172,9 +390,68 @@ func (r *Runner) Execute(ctx context.Context, filter func(script codersdk.Worksp
 	return eg.Wait()
 }
 
-// trackRun wraps "run" with metrics.
-func (r *Runner) trackRun(ctx context.Context, script codersdk.WorkspaceAgentScript) error {
-	err := r.run(ctx, script)
+// ExecuteBuildScripts runs the scripts that run once the workspace build
+// completes, according to the status of the build. It's a no-op while the
+// build is still running.
+func (r *Runner) ExecuteBuildScripts(ctx context.Context, status codersdk.ProvisionerJobStatus) error {
+	switch status {
+	case codersdk.ProvisionerJobSucceeded:
+		return r.Execute(ctx, ExecuteBuildSuccessScripts)
+	case codersdk.ProvisionerJobFailed:
+		return r.Execute(ctx, ExecuteBuildFailureScripts)
+	default:
+		return nil
+	}
+}
+
+// ExecuteScript runs the script with the log source ID once, e.g. a
+// cleanup script when the disk usage crosses its threshold.
+func (r *Runner) ExecuteScript(ctx context.Context, logSourceID uuid.UUID) error {
+	r.scriptsMu.Lock()
+	var (
+		script codersdk.WorkspaceAgentScript
+		found  bool
+	)
+	for _, s := range r.scripts {
+		if s.LogSourceID == logSourceID {
+			script, found = s, true
+			break
+		}
+	}
+	r.scriptsMu.Unlock()
+	if !found {
+		return xerrors.Errorf("agent script %q not found", logSourceID)
+	}
+
+	stage := ExecuteAllScripts.stage(script)
+	if script.DiskPressurePath != "" {
+		stage = codersdk.WorkspaceAgentScriptStageDiskPressure
+	}
+	err := r.trackRun(ctx, script, stage)
+	if err != nil {
+		return xerrors.Errorf("run agent script %q: %w", logSourceID, err)
+	}
+	return nil
+}
+
+// trackRun wraps "run" with metrics, statuses and the run history.
+func (r *Runner) trackRun(ctx context.Context, script codersdk.WorkspaceAgentScript, stage codersdk.WorkspaceAgentScriptStage) error {
+	previous := r.scriptState(script)
+	r.setStatusRunning(script)
+	output := newOutputTail(historyOutputLines)
+	err := r.run(ctx, script, stage, output)
+	status := r.setStatusCompleted(script, err)
+	// Scheduled scripts run unattended, so their owner is notified once
+	// they start failing rather than on every failed run.
+	if err != nil && stage == codersdk.WorkspaceAgentScriptStageCron &&
+		previous != ScriptStateFailed && previous != ScriptStateTimedOut {
+		r.notifyScriptFailed(ctx, status)
+	}
+	r.recordRun(ctx, ScriptRun{
+		ScriptStatus: status,
+		Duration:     status.CompletedAt.Sub(status.StartedAt),
+		Output:       output.Lines(),
+	})
 	if err != nil {
 		r.scriptsExecuted.WithLabelValues("false").Add(1)
 	} else {
@@ -183,11 +460,47 @@ func (r *Runner) trackRun(ctx context.Context, script codersdk.WorkspaceAgentScr
 	return err
 }
 
-// run executes the provided script with the timeout.
+// notifyScriptFailed notifies the workspace owner of the failed run of a
+// scheduled script.
+func (r *Runner) notifyScriptFailed(ctx context.Context, status ScriptStatus) {
+	if r.PostNotification == nil {
+		return
+	}
+	name := status.Script.DisplayName
+	if name == "" {
+		name = status.Script.LogSourceID.String()
+	}
+	title := fmt.Sprintf("Scheduled script %q failed", name)
+	if len(title) > agentsdk.MaxNotificationTitleLength {
+		title = title[:agentsdk.MaxNotificationTitleLength]
+	}
+	message := status.Error
+	if len(message) > agentsdk.MaxNotificationMessageLength {
+		message = message[:agentsdk.MaxNotificationMessageLength]
+	}
+	err := r.PostNotification(ctx, agentsdk.Notification{
+		Severity:  agentsdk.NotificationSeverityError,
+		Kind:      agentsdk.NotificationKindScriptFailed,
+		Title:     title,
+		Message:   message,
+		CreatedAt: status.CompletedAt,
+		Labels: map[string]string{
+			"log_source_id": status.Script.LogSourceID.String(),
+			"exit_code":     strconv.Itoa(status.ExitCode),
+		},
+	})
+	if err != nil {
+		r.Logger.Warn(ctx, "notify of failed scheduled script", slog.F("log_source_id", status.Script.LogSourceID), slog.Error(err))
+	}
+}
+
+// run executes the provided script with the timeout, and copies its output
+// to output. Its logs are annotated with the script and the stage it runs
+// in.
 // If the timeout is exceeded, the process is sent an interrupt signal.
 // If the process does not exit after a few seconds, it is forcefully killed.
 // This function immediately returns after a timeout, and does not wait for the process to exit.
-func (r *Runner) run(ctx context.Context, script codersdk.WorkspaceAgentScript) error {
+func (r *Runner) run(ctx context.Context, script codersdk.WorkspaceAgentScript, stage codersdk.WorkspaceAgentScriptStage, output io.Writer) (err error) {
 	logPath := script.LogPath
 	if logPath == "" {
 		logPath = fmt.Sprintf("coder-script-%s.log", script.LogSourceID)
@@ -208,8 +521,9 @@ func (r *Runner) run(ctx context.Context, script codersdk.WorkspaceAgentScript)
 	if !filepath.IsAbs(logPath) {
 		logPath = filepath.Join(r.LogDir, logPath)
 	}
-	logger := r.Logger.With(slog.F("log_path", logPath))
+	logger := r.Logger.With(slog.F("log_path", logPath), slog.F("stage", stage))
 	logger.Info(ctx, "running agent script", slog.F("script", script.Script))
+	patchLogs := annotateLogs(r.PatchLogs, scriptLogFields(script, stage))
 
 	fileWriter, err := r.Filesystem.OpenFile(logPath, os.O_CREATE|os.O_RDWR, 0o600)
 	if err != nil {
@@ -222,6 +536,25 @@ func (r *Runner) run(ctx context.Context, script codersdk.WorkspaceAgentScript)
 		}
 	}()
 
+	scriptText, err := r.expandScript(script)
+	if err != nil {
+		// The error is shown alongside the logs of the script, since it's
+		// most likely a mistake of the template author.
+		_, _ = fmt.Fprintln(fileWriter, err.Error())
+		patchErr := patchLogs(ctx, agentsdk.PatchLogs{
+			LogSourceID: script.LogSourceID,
+			Logs: []agentsdk.Log{{
+				CreatedAt: time.Now(),
+				Output:    err.Error(),
+				Level:     codersdk.LogLevelError,
+			}},
+		})
+		if patchErr != nil {
+			logger.Warn(ctx, "send script template error", slog.Error(patchErr))
+		}
+		return xerrors.Errorf("%s script: %w", logPath, err)
+	}
+
 	var cmd *exec.Cmd
 	cmdCtx := ctx
 	if script.Timeout > 0 {
@@ -229,51 +562,87 @@ func (r *Runner) run(ctx context.Context, script codersdk.WorkspaceAgentScript)
 		cmdCtx, ctxCancel = context.WithTimeout(ctx, script.Timeout)
 		defer ctxCancel()
 	}
-	cmdPty, err := r.SSHServer.CreateCommand(cmdCtx, script.Script, nil)
+	var env []string
+	if script.Login {
+		// The environment of the agent still takes precedence, e.g. so the
+		// profile of the user can't override the agent token.
+		env, err = r.SSHServer.LoginEnv(cmdCtx)
+		if err != nil {
+			return xerrors.Errorf("%s script: login environment: %w", logPath, err)
+		}
+	}
+	if r.UploadArtifacts != nil {
+		artifactsDir, err := r.prepareArtifactsDir(script)
+		if err != nil {
+			return xerrors.Errorf("%s script: %w", logPath, err)
+		}
+		env = append(env, ArtifactsDirEnvironmentVariable+"="+artifactsDir)
+		defer func() {
+			// Artifacts are uploaded regardless of the script outcome, since
+			// diagnostic dumps are most useful when a script fails.
+			err := r.uploadArtifacts(ctx, logger, script, artifactsDir)
+			if err != nil {
+				logger.Warn(ctx, "upload script artifacts failed", slog.Error(err))
+			}
+		}()
+	}
+	execution := &Execution{Script: script, Env: env}
+	postExecute, err := r.preExecute(ctx, execution)
+	if err != nil {
+		return xerrors.Errorf("%s script: pre execute hook: %w", logPath, err)
+	}
+	defer func() {
+		postExecute(err)
+	}()
+	env = execution.Env
+
+	cmdPty, err := r.SSHServer.CreateCommand(cmdCtx, scriptText, env)
 	if err != nil {
 		return xerrors.Errorf("%s script: create command: %w", logPath, err)
 	}
 	cmd = cmdPty.AsExec()
-	cmd.SysProcAttr = cmdSysProcAttr()
-	cmd.WaitDelay = 10 * time.Second
-	cmd.Cancel = cmdCancel(cmd)
-
-	send, flushAndClose := agentsdk.LogsSender(script.LogSourceID, r.PatchLogs, logger)
-	// If ctx is canceled here (or in a writer below), we may be
-	// discarding logs, but that's okay because we're shutting down
-	// anyway. We could consider creating a new context here if we
-	// want better control over flush during shutdown.
+	group := procgroup.New(cmd, procgroup.Options{KillDelay: 10 * time.Second})
+	defer group.Close()
+	// Children of the script may leave its group, so they are recorded to
+	// be killed once the script exited.
+	var tree processTreeSnapshot
+	stopGroup := cmd.Cancel
+	cmd.Cancel = func() error {
+		tree.record(cmd.Process.Pid)
+		return stopGroup()
+	}
+
+	logSender := r.newLogSender(script.LogSourceID, patchLogs, logger)
 	defer func() {
-		if err := flushAndClose(ctx); err != nil {
-			logger.Warn(ctx, "flush startup logs failed", slog.Error(err))
+		if err := r.closeLogSender(logSender); err != nil {
+			logger.Warn(ctx, "flush script logs failed", slog.Error(err))
 		}
 	}()
+	send := logSender.send
 
-	infoW := agentsdk.LogsWriter(ctx, send, script.LogSourceID, codersdk.LogLevelInfo)
+	// Progress markers are converted to structured logs, the log file and
+	// the run history keep the output as it was written.
+	markers := agentsdk.LogsWriterParser((&progressMarkers{}).parse)
+	infoW := agentsdk.LogsStreamWriter(ctx, send, script.LogSourceID, codersdk.LogLevelInfo, codersdk.LogStreamStdout, markers)
 	defer infoW.Close()
-	errW := agentsdk.LogsWriter(ctx, send, script.LogSourceID, codersdk.LogLevelError)
+	errW := agentsdk.LogsStreamWriter(ctx, send, script.LogSourceID, codersdk.LogLevelError, codersdk.LogStreamStderr, markers)
 	defer errW.Close()
-	cmd.Stdout = io.MultiWriter(fileWriter, infoW)
-	cmd.Stderr = io.MultiWriter(fileWriter, errW)
+	cmd.Stdout = io.MultiWriter(fileWriter, infoW, output)
+	cmd.Stderr = io.MultiWriter(fileWriter, errW, output)
 
 	start := time.Now()
 	defer func() {
 		end := time.Now()
 		execTime := end.Sub(start)
-		exitCode := 0
+		exitCode := scriptExitCode(err)
 		if err != nil {
-			exitCode = 255 // Unknown status.
-			var exitError *exec.ExitError
-			if xerrors.As(err, &exitError) {
-				exitCode = exitError.ExitCode()
-			}
 			logger.Warn(ctx, fmt.Sprintf("%s script failed", logPath), slog.F("execution_time", execTime), slog.F("exit_code", exitCode), slog.Error(err))
 		} else {
 			logger.Info(ctx, fmt.Sprintf("%s script completed", logPath), slog.F("execution_time", execTime), slog.F("exit_code", exitCode))
 		}
 	}()
 
-	err = cmd.Start()
+	err = group.Start()
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
 			return ErrTimeout
@@ -296,6 +665,10 @@ func (r *Runner) run(ctx context.Context, script codersdk.WorkspaceAgentScript)
 		case <-time.After(10 * time.Second):
 		}
 		err = cmdCtx.Err()
+		if killed := tree.kill(); len(killed) > 0 {
+			_, _ = fmt.Fprintf(cmd.Stderr, "Killed %d processes left running by the script: %s\n", len(killed), formatProcesses(killed))
+			logger.Warn(ctx, "killed processes left running by script", slog.F("processes", formatProcesses(killed)))
+		}
 	case err = <-cmdDone:
 	}
 	switch {
@@ -319,17 +692,62 @@ func (r *Runner) run(ctx context.Context, script codersdk.WorkspaceAgentScript)
 	return err
 }
 
+// logRateLimit returns the rate limit of the logs of every script, a rate of
+// zero disables the limit.
+func (r *Runner) logRateLimit() (float64, int) {
+	rateLimit, burst := r.LogRateLimit, r.LogRateLimitBurst
+	if rateLimit == 0 {
+		rateLimit = DefaultLogRateLimit
+	}
+	if rateLimit < 0 {
+		return 0, 0
+	}
+	if burst <= 0 {
+		burst = DefaultLogRateLimitBurst
+	}
+	return rateLimit, burst
+}
+
+// expandScript expands the template variables of the script with the
+// current manifest.
+func (r *Runner) expandScript(script codersdk.WorkspaceAgentScript) (string, error) {
+	if r.Manifest == nil {
+		return script.Script, nil
+	}
+	manifest := r.Manifest.Load()
+	if manifest == nil {
+		return script.Script, nil
+	}
+	return ExpandScript(script.Script, TemplateDataFromManifest(*manifest))
+}
+
+// scriptExitCode returns the exit code of a script that returned err.
+func scriptExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitError *exec.ExitError
+	if xerrors.As(err, &exitError) {
+		return exitError.ExitCode()
+	}
+	return 255 // Unknown status.
+}
+
 func (r *Runner) Close() error {
 	r.closeMutex.Lock()
 	defer r.closeMutex.Unlock()
 	if r.isClosed() {
 		return nil
 	}
+	// The scripts running now get a shutdown marker, even if they exit
+	// and flush their logs before the runner does.
+	r.startLogShutdown()
 	close(r.closed)
 	// Must cancel the cron ctx BEFORE stopping the cron.
 	r.cronCtxCancel()
 	<-r.cron.Stop().Done()
 	r.cmdCloseWait.Wait()
+	r.flushLogs()
 	return nil
 }
 
@@ -0,0 +1,214 @@
+package agentscripts
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestInitReload(t *testing.T) {
+	t.Parallel()
+
+	runner := New(Options{Logger: slogtest.Make(t, nil)})
+	defer runner.Close()
+
+	hourly := codersdk.WorkspaceAgentScript{LogSourceID: uuid.New(), Script: "echo hourly", Cron: "0 0 * * * *"}
+	daily := codersdk.WorkspaceAgentScript{LogSourceID: uuid.New(), Script: "echo daily", Cron: "0 0 2 * * *"}
+	onStart := codersdk.WorkspaceAgentScript{LogSourceID: uuid.New(), Script: "echo start", RunOnStart: true}
+
+	require.NoError(t, runner.Init([]codersdk.WorkspaceAgentScript{hourly, daily, onStart}))
+	require.Len(t, runner.cron.Entries(), 2)
+	hourlyEntry := runner.cronEntries[hourly][0]
+
+	// Changing a script replaces its schedule, unchanged scripts keep it.
+	changed := daily
+	changed.Script = "echo nightly"
+	require.NoError(t, runner.Init([]codersdk.WorkspaceAgentScript{hourly, changed}))
+	require.Len(t, runner.cron.Entries(), 2)
+	require.Equal(t, hourlyEntry, runner.cronEntries[hourly][0])
+	require.NotContains(t, runner.cronEntries, daily)
+	require.Contains(t, runner.cronEntries, changed)
+	require.Len(t, runner.scripts, 2)
+
+	// Invalid schedules leave the runner unchanged.
+	invalid := codersdk.WorkspaceAgentScript{LogSourceID: uuid.New(), Cron: "not a schedule"}
+	require.Error(t, runner.Init([]codersdk.WorkspaceAgentScript{invalid}))
+	require.Len(t, runner.cron.Entries(), 2)
+
+	require.NoError(t, runner.Init(nil))
+	require.Empty(t, runner.cron.Entries())
+	require.Empty(t, runner.cronEntries)
+
+	require.NoError(t, runner.Close())
+	require.Error(t, runner.Init([]codersdk.WorkspaceAgentScript{hourly}))
+}
+
+func TestOutputTail(t *testing.T) {
+	t.Parallel()
+
+	tail := newOutputTail(2)
+	_, _ = tail.Write([]byte("one\r\ntw"))
+	_, _ = tail.Write([]byte("o\nthree\nfour"))
+	require.Equal(t, []string{"three", "four"}, tail.Lines())
+	_, _ = tail.Write([]byte("\n"))
+	require.Equal(t, []string{"three", "four"}, tail.Lines())
+
+	_, _ = tail.Write([]byte(strings.Repeat("a", historyMaxLineLength+10)))
+	lines := tail.Lines()
+	require.Len(t, lines[1], historyMaxLineLength)
+}
+
+func TestScriptRunHistorySize(t *testing.T) {
+	t.Parallel()
+
+	runner := New(Options{Logger: slogtest.Make(t, nil), HistorySize: 2})
+	defer runner.Close()
+	for i := 0; i < 3; i++ {
+		runner.recordRun(context.Background(), ScriptRun{ScriptStatus: ScriptStatus{ExitCode: i}})
+	}
+	runs := runner.ScriptRunHistory()
+	require.Len(t, runs, 2)
+	// Newest first.
+	require.Equal(t, 2, runs[0].ExitCode)
+	require.Equal(t, 1, runs[1].ExitCode)
+}
+
+func TestCloseFlushesLogs(t *testing.T) {
+	t.Parallel()
+
+	const marker = "Agent shutting down"
+	// setup returns a runner whose patchLogs records the logs, and fails
+	// to send logs other than the shutdown marker if fail is set.
+	setup := func(t *testing.T, fail bool) (*Runner, func() []agentsdk.Log) {
+		t.Helper()
+		var (
+			mu   sync.Mutex
+			logs []agentsdk.Log
+		)
+		runner := New(Options{
+			Logger:          slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+			LogFlushTimeout: testutil.IntervalMedium,
+			PatchLogs: func(ctx context.Context, req agentsdk.PatchLogs) error {
+				if fail && !strings.HasPrefix(req.Logs[0].Output, marker) {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				logs = append(logs, req.Logs...)
+				return nil
+			},
+		})
+		return runner, func() []agentsdk.Log {
+			mu.Lock()
+			defer mu.Unlock()
+			return logs
+		}
+	}
+
+	t.Run("Flushed", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		runner, logs := setup(t, false)
+		// The script is still running when the agent shuts down, so its
+		// logs are pending.
+		sender := runner.newLogSender(uuid.New(), runner.PatchLogs, runner.Logger)
+		require.NoError(t, sender.send(ctx, agentsdk.Log{CreatedAt: time.Now(), Output: "stopping"}))
+
+		require.NoError(t, runner.Close())
+		got := logs()
+		require.Len(t, got, 2)
+		require.Equal(t, "stopping", got[0].Output)
+		require.Equal(t, "Agent shutting down, 1 log lines flushed, 0 dropped", got[1].Output)
+		require.Equal(t, codersdk.LogLevelInfo, got[1].Level)
+	})
+
+	t.Run("Dropped", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		runner, logs := setup(t, true)
+		sender := runner.newLogSender(uuid.New(), runner.PatchLogs, runner.Logger)
+		require.NoError(t, sender.send(ctx, agentsdk.Log{CreatedAt: time.Now(), Output: "stopping"}))
+
+		require.NoError(t, runner.Close())
+		got := logs()
+		require.Len(t, got, 1)
+		require.Equal(t, "Agent shutting down, 0 log lines flushed, 1 dropped", got[0].Output)
+		require.Equal(t, codersdk.LogLevelWarn, got[0].Level)
+	})
+
+	t.Run("Finished", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		runner, logs := setup(t, false)
+		// Scripts that exited flushed their logs already, so there's no
+		// marker.
+		sender := runner.newLogSender(uuid.New(), runner.PatchLogs, runner.Logger)
+		require.NoError(t, sender.send(ctx, agentsdk.Log{CreatedAt: time.Now(), Output: "done"}))
+		require.NoError(t, runner.closeLogSender(sender))
+
+		require.NoError(t, runner.Close())
+		got := logs()
+		require.Len(t, got, 1)
+		require.Equal(t, "done", got[0].Output)
+	})
+
+	t.Run("ExitedOnShutdown", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		runner, logs := setup(t, false)
+		// The script exits when the agent shuts down, and flushes its logs
+		// before the runner does.
+		sender := runner.newLogSender(uuid.New(), runner.PatchLogs, runner.Logger)
+		require.NoError(t, sender.send(ctx, agentsdk.Log{CreatedAt: time.Now(), Output: "stopping"}))
+		err := runner.trackCommandGoroutine(func() {
+			<-runner.closed
+			_ = runner.closeLogSender(sender)
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, runner.Close())
+		got := logs()
+		require.Len(t, got, 2)
+		require.Equal(t, "stopping", got[0].Output)
+		require.Equal(t, "Agent shutting down, 1 log lines flushed, 0 dropped", got[1].Output)
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		runner, logs := setup(t, true)
+		// Flushing the logs of the script exiting on shutdown and the logs
+		// of the scripts still running share the deadline of the shutdown.
+		exiting := runner.newLogSender(uuid.New(), runner.PatchLogs, runner.Logger)
+		require.NoError(t, exiting.send(ctx, agentsdk.Log{CreatedAt: time.Now(), Output: "stopping"}))
+		err := runner.trackCommandGoroutine(func() {
+			<-runner.closed
+			_ = runner.closeLogSender(exiting)
+		})
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			running := runner.newLogSender(uuid.New(), runner.PatchLogs, runner.Logger)
+			require.NoError(t, running.send(ctx, agentsdk.Log{CreatedAt: time.Now(), Output: "running"}))
+		}
+
+		start := time.Now()
+		require.NoError(t, runner.Close())
+		require.Less(t, time.Since(start), 2*testutil.IntervalMedium)
+		got := logs()
+		require.Len(t, got, 4)
+		for _, log := range got {
+			require.Equal(t, "Agent shutting down, 0 log lines flushed, 1 dropped", log.Output)
+		}
+	})
+}
@@ -1,21 +1,33 @@
 package agentscripts_test
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 	"go.uber.org/goleak"
+	"golang.org/x/xerrors"
 
 	"cdr.dev/slog/sloggers/slogtest"
 	"github.com/coder/coder/v2/agent/agentscripts"
 	"github.com/coder/coder/v2/agent/agentssh"
 	"github.com/coder/coder/v2/codersdk"
 	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
 )
 
 func TestMain(m *testing.M) {
@@ -34,11 +46,348 @@ func TestExecuteBasic(t *testing.T) {
 		Script: "echo hello",
 	}})
 	require.NoError(t, err)
-	require.NoError(t, runner.Execute(context.Background(), func(script codersdk.WorkspaceAgentScript) bool {
-		return true
-	}))
+	require.NoError(t, runner.Execute(context.Background(), agentscripts.ExecuteAllScripts))
 	log := <-logs
 	require.Equal(t, "hello", log.Logs[0].Output)
+	require.Equal(t, codersdk.LogStreamStdout, log.Logs[0].Stream)
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	t.Parallel()
+	logs := make(chan agentsdk.PatchLogs, 1)
+	runner := setup(t, func(ctx context.Context, req agentsdk.PatchLogs) error {
+		logs <- req
+		return nil
+	})
+	defer runner.Close()
+	runner.Manifest = atomic.NewPointer(&agentsdk.Manifest{
+		WorkspaceName: "dev",
+		OwnerName:     "alice",
+	})
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		Script:     agentscripts.TemplateDirective + "\necho {{ .OwnerName }}/{{ .WorkspaceName }}",
+		RunOnStart: true,
+	}, {
+		Script:    agentscripts.TemplateDirective + "\ndocker ps --format '{{ .Names }}'",
+		RunOnStop: true,
+	}})
+	require.NoError(t, err)
+	require.NoError(t, runner.Execute(context.Background(), agentscripts.ExecuteStartScripts))
+	log := <-logs
+	require.Equal(t, "alice/dev", log.Logs[0].Output)
+
+	err = runner.Execute(context.Background(), agentscripts.ExecuteStopScripts)
+	require.ErrorIs(t, err, agentscripts.ErrInvalidTemplate)
+	log = <-logs
+	require.Equal(t, codersdk.LogLevelError, log.Logs[0].Level)
+	require.Contains(t, log.Logs[0].Output, "Names")
+}
+
+func TestExpandScript(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("values are quoted for PowerShell on Windows")
+	}
+
+	data := agentscripts.TemplateData{
+		WorkspaceName: "dev",
+		OwnerEmail:    "o'brien@example.com; rm -rf ~",
+	}
+	directive := agentscripts.TemplateDirective + "\n"
+	for _, tc := range []struct {
+		name     string
+		script   string
+		expected string
+		err      bool
+	}{{
+		name:     "NoDirective",
+		script:   "docker ps --format '{{ .Names }}'",
+		expected: "docker ps --format '{{ .Names }}'",
+	}, {
+		name:     "DirectiveAfterCommand",
+		script:   "echo {{ .Names }}\n" + directive,
+		expected: "echo {{ .Names }}\n" + directive,
+	}, {
+		name:     "Variable",
+		script:   "#!/bin/sh\n" + directive + "echo {{ .WorkspaceName }}",
+		expected: "#!/bin/sh\n" + directive + "echo 'dev'",
+	}, {
+		name:     "Quoted",
+		script:   directive + "git config --global user.email {{ .OwnerEmail }}",
+		expected: directive + `git config --global user.email 'o'\''brien@example.com; rm -rf ~'`,
+	}, {
+		name:     "Escaped",
+		script:   directive + `docker ps --format '{{"{{"}} .Names {{"}}"}}'`,
+		expected: directive + "docker ps --format '{{ .Names }}'",
+	}, {
+		name:   "UnknownField",
+		script: directive + "echo {{ .Names }}",
+		err:    true,
+	}, {
+		name:   "Malformed",
+		script: directive + "echo {{ .WorkspaceName",
+		err:    true,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			expanded, err := agentscripts.ExpandScript(tc.script, data)
+			if tc.err {
+				require.ErrorIs(t, err, agentscripts.ErrInvalidTemplate)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, expanded)
+		})
+	}
+}
+
+func TestExecuteBuildScripts(t *testing.T) {
+	t.Parallel()
+	logs := make(chan agentsdk.PatchLogs, 2)
+	runner := setup(t, func(ctx context.Context, req agentsdk.PatchLogs) error {
+		logs <- req
+		return nil
+	})
+	defer runner.Close()
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		LogSourceID:       uuid.New(),
+		Script:            "echo success",
+		RunOnBuildSuccess: true,
+	}, {
+		LogSourceID:       uuid.New(),
+		Script:            "echo failure",
+		RunOnBuildFailure: true,
+	}})
+	require.NoError(t, err)
+
+	// Nothing runs while the build is running.
+	require.NoError(t, runner.ExecuteBuildScripts(context.Background(), codersdk.ProvisionerJobRunning))
+	require.NoError(t, runner.ExecuteBuildScripts(context.Background(), codersdk.ProvisionerJobSucceeded))
+	log := <-logs
+	require.Equal(t, "success", log.Logs[0].Output)
+	require.Empty(t, logs)
+}
+
+func TestExecuteScript(t *testing.T) {
+	t.Parallel()
+	logs := make(chan agentsdk.PatchLogs, 2)
+	runner := setup(t, func(ctx context.Context, req agentsdk.PatchLogs) error {
+		logs <- req
+		return nil
+	})
+	defer runner.Close()
+	cleanup := codersdk.WorkspaceAgentScript{
+		LogSourceID:           uuid.New(),
+		Script:                "echo cleanup",
+		DiskPressurePath:      "/",
+		DiskPressureThreshold: 90,
+	}
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		LogSourceID: uuid.New(),
+		Script:      "echo start",
+		RunOnStart:  true,
+	}, cleanup})
+	require.NoError(t, err)
+
+	require.NoError(t, runner.ExecuteScript(context.Background(), cleanup.LogSourceID))
+	log := <-logs
+	require.Equal(t, cleanup.LogSourceID, log.LogSourceID)
+	require.Equal(t, "cleanup", log.Logs[0].Output)
+	require.Empty(t, logs)
+
+	require.Error(t, runner.ExecuteScript(context.Background(), uuid.New()))
+}
+
+func TestExecuteOptions(t *testing.T) {
+	t.Parallel()
+	logs := make(chan agentsdk.PatchLogs, 4)
+	runner := setup(t, func(ctx context.Context, req agentsdk.PatchLogs) error {
+		logs <- req
+		return nil
+	})
+	defer runner.Close()
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		LogSourceID: uuid.New(),
+		Script:      "echo start",
+		RunOnStart:  true,
+	}, {
+		LogSourceID:    uuid.New(),
+		Script:         "echo post-start",
+		RunOnPostStart: true,
+	}, {
+		LogSourceID: uuid.New(),
+		Script:      "echo cron",
+		Cron:        "0 0 * * * *",
+	}, {
+		LogSourceID: uuid.New(),
+		Script:      "echo stop",
+		RunOnStop:   true,
+	}})
+	require.NoError(t, err)
+
+	for option, expected := range map[agentscripts.ExecuteOption]string{
+		agentscripts.ExecuteStartScripts:     "start",
+		agentscripts.ExecutePostStartScripts: "post-start",
+		agentscripts.ExecuteCronScripts:      "cron",
+		agentscripts.ExecuteStopScripts:      "stop",
+	} {
+		require.NoError(t, runner.Execute(context.Background(), option), option.String())
+		log := <-logs
+		require.Equal(t, expected, log.Logs[0].Output, option.String())
+		require.Empty(t, logs, option.String())
+	}
+}
+
+func TestTimeoutKillsChildren(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS != "linux" {
+		t.Skip("process trees are only tracked on Linux")
+	}
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	runner := setup(t, nil)
+	defer runner.Close()
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		// nohup ignores the SIGHUP sent on timeout.
+		Script:  fmt.Sprintf("nohup sleep 30 >/dev/null 2>&1 & echo $! > %s; sleep 30", pidFile),
+		Timeout: time.Second,
+	}})
+	require.NoError(t, err)
+	require.ErrorIs(t, runner.Execute(context.Background(), agentscripts.ExecuteAllScripts), agentscripts.ErrTimeout)
+
+	data, err := os.ReadFile(pidFile)
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		// Killed children may be left as zombies if nothing reaps them.
+		return err != nil || strings.Contains(string(stat), ") Z ")
+	}, testutil.WaitShort, testutil.IntervalFast)
+}
+
+func TestExecuteStderr(t *testing.T) {
+	t.Parallel()
+	logs := make(chan agentsdk.PatchLogs, 1)
+	runner := setup(t, func(ctx context.Context, req agentsdk.PatchLogs) error {
+		logs <- req
+		return nil
+	})
+	defer runner.Close()
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		Script: "echo oops >&2",
+	}})
+	require.NoError(t, err)
+	require.NoError(t, runner.Execute(context.Background(), agentscripts.ExecuteAllScripts))
+	log := <-logs
+	require.Equal(t, "oops", log.Logs[0].Output)
+	require.Equal(t, codersdk.LogLevelError, log.Logs[0].Level)
+	require.Equal(t, codersdk.LogStreamStderr, log.Logs[0].Stream)
+}
+
+func TestExecuteProgressMarkers(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("this test uses a POSIX shell script")
+	}
+	logs := make(chan agentsdk.Log, 10)
+	runner := setup(t, func(ctx context.Context, req agentsdk.PatchLogs) error {
+		for _, log := range req.Logs {
+			logs <- log
+		}
+		return nil
+	})
+	defer runner.Close()
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		Script: "echo ::group::Install && sleep 0.1 && echo ::progress::50 >&2",
+	}})
+	require.NoError(t, err)
+	require.NoError(t, runner.Execute(context.Background(), agentscripts.ExecuteAllScripts))
+	log := <-logs
+	require.Equal(t, "Install", log.Output)
+	require.Equal(t, string(codersdk.WorkspaceAgentLogEventGroupStart), log.Fields[codersdk.WorkspaceAgentLogFieldEvent])
+	// The section spans both output streams.
+	log = <-logs
+	require.Equal(t, "50%", log.Output)
+	require.Equal(t, codersdk.LogStreamStderr, log.Stream)
+	require.Equal(t, "Install", log.Fields[codersdk.WorkspaceAgentLogFieldGroup])
+	require.Equal(t, "50", log.Fields[codersdk.WorkspaceAgentLogFieldProgress])
+}
+
+func TestExecuteAnnotatesLogs(t *testing.T) {
+	t.Parallel()
+	logs := make(chan agentsdk.Log, 10)
+	runner := setup(t, func(ctx context.Context, req agentsdk.PatchLogs) error {
+		for _, log := range req.Logs {
+			logs <- log
+		}
+		return nil
+	})
+	defer runner.Close()
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		LogSourceID: uuid.New(),
+		DisplayName: "Install",
+		Script:      "echo install",
+		RunOnStart:  true,
+	}, {
+		LogSourceID: uuid.New(),
+		DisplayName: "Backup",
+		Script:      "echo backup",
+		RunOnStop:   true,
+	}})
+	require.NoError(t, err)
+
+	require.NoError(t, runner.Execute(context.Background(), agentscripts.ExecuteStartScripts))
+	log := <-logs
+	require.Equal(t, "install", strings.TrimSpace(log.Output))
+	require.Equal(t, "Install", log.Fields[codersdk.WorkspaceAgentLogFieldScript])
+	require.Equal(t, string(codersdk.WorkspaceAgentScriptStageStart), log.Fields[codersdk.WorkspaceAgentLogFieldStage])
+
+	require.NoError(t, runner.Execute(context.Background(), agentscripts.ExecuteAllScripts))
+	for i := 0; i < 2; i++ {
+		log = <-logs
+		switch strings.TrimSpace(log.Output) {
+		case "install":
+			require.Equal(t, string(codersdk.WorkspaceAgentScriptStageStart), log.Fields[codersdk.WorkspaceAgentLogFieldStage])
+		case "backup":
+			require.Equal(t, "Backup", log.Fields[codersdk.WorkspaceAgentLogFieldScript])
+			require.Equal(t, string(codersdk.WorkspaceAgentScriptStageStop), log.Fields[codersdk.WorkspaceAgentLogFieldStage])
+		default:
+			t.Fatalf("unexpected log %q", log.Output)
+		}
+	}
+}
+
+//nolint:paralleltest // Sets HOME.
+func TestExecuteLogin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("login shells aren't supported on Windows")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, name := range []string{".bash_profile", ".zprofile", ".profile"} {
+		err := os.WriteFile(filepath.Join(home, name), []byte("export CODER_TEST_PROFILE=sourced\n"), 0o600)
+		require.NoError(t, err)
+	}
+
+	logs := make(chan agentsdk.PatchLogs, 2)
+	runner := setup(t, func(ctx context.Context, req agentsdk.PatchLogs) error {
+		logs <- req
+		return nil
+	})
+	defer runner.Close()
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		LogSourceID: uuid.New(),
+		Script:      "echo login=$CODER_TEST_PROFILE",
+		Login:       true,
+	}, {
+		LogSourceID: uuid.New(),
+		Script:      "echo login=$CODER_TEST_PROFILE",
+	}})
+	require.NoError(t, err)
+	require.NoError(t, runner.Execute(context.Background(), agentscripts.ExecuteAllScripts))
+	outputs := []string{(<-logs).Logs[0].Output, (<-logs).Logs[0].Output}
+	require.ElementsMatch(t, []string{"login=sourced", "login="}, outputs)
 }
 
 func TestTimeout(t *testing.T) {
@@ -50,7 +399,303 @@ func TestTimeout(t *testing.T) {
 		Timeout: time.Millisecond,
 	}})
 	require.NoError(t, err)
-	require.ErrorIs(t, runner.Execute(context.Background(), nil), agentscripts.ErrTimeout)
+	require.ErrorIs(t, runner.Execute(context.Background(), agentscripts.ExecuteAllScripts), agentscripts.ErrTimeout)
+}
+
+func TestScriptStatuses(t *testing.T) {
+	t.Parallel()
+	runner := setup(t, nil)
+	defer runner.Close()
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		LogSourceID: uuid.New(),
+		Script:      "exit 3",
+		RunOnStart:  true,
+	}, {
+		LogSourceID: uuid.New(),
+		Script:      "echo stop",
+		RunOnStop:   true,
+	}})
+	require.NoError(t, err)
+	require.Error(t, runner.Execute(context.Background(), agentscripts.ExecuteStartScripts))
+
+	statuses := runner.ScriptStatuses()
+	require.Len(t, statuses, 2)
+	require.Equal(t, agentscripts.ScriptStateFailed, statuses[0].State)
+	require.Equal(t, 3, statuses[0].ExitCode)
+	require.False(t, statuses[0].StartedAt.IsZero())
+	require.False(t, statuses[0].CompletedAt.IsZero())
+	require.NotEmpty(t, statuses[0].Error)
+	require.Equal(t, agentscripts.ScriptStatePending, statuses[1].State)
+	require.True(t, statuses[1].StartedAt.IsZero())
+}
+
+func TestCronScriptFailureNotification(t *testing.T) {
+	t.Parallel()
+	runner := setup(t, nil)
+	defer runner.Close()
+	var notifications []agentsdk.Notification
+	runner.PostNotification = func(_ context.Context, notification agentsdk.Notification) error {
+		notifications = append(notifications, notification)
+		return nil
+	}
+	script := codersdk.WorkspaceAgentScript{
+		LogSourceID: uuid.New(),
+		Script:      "exit 3",
+		Cron:        "0 0 * * * *",
+		DisplayName: "Backup",
+	}
+	require.NoError(t, runner.Init([]codersdk.WorkspaceAgentScript{script}))
+
+	// Consecutive failures are notified once.
+	require.Error(t, runner.Execute(context.Background(), agentscripts.ExecuteCronScripts))
+	require.Error(t, runner.Execute(context.Background(), agentscripts.ExecuteCronScripts))
+	require.Len(t, notifications, 1)
+	require.Equal(t, agentsdk.NotificationSeverityError, notifications[0].Severity)
+	require.Equal(t, agentsdk.NotificationKindScriptFailed, notifications[0].Kind)
+	require.Equal(t, `Scheduled script "Backup" failed`, notifications[0].Title)
+	require.Equal(t, script.LogSourceID.String(), notifications[0].Labels["log_source_id"])
+	require.Equal(t, "3", notifications[0].Labels["exit_code"])
+	require.NoError(t, notifications[0].Validate())
+}
+
+func TestScriptRunHistory(t *testing.T) {
+	t.Parallel()
+	runner := setup(t, nil)
+	defer runner.Close()
+	runner.HistoryPath = "/config/history.json"
+	script := codersdk.WorkspaceAgentScript{
+		LogSourceID: uuid.New(),
+		Script:      "for i in $(seq 1 60); do echo line $i; done; exit 2",
+		RunOnStart:  true,
+	}
+	require.NoError(t, runner.Init([]codersdk.WorkspaceAgentScript{script}))
+	require.Error(t, runner.Execute(context.Background(), agentscripts.ExecuteStartScripts))
+	require.NoError(t, runner.Execute(context.Background(), agentscripts.ExecuteStopScripts))
+
+	runs := runner.ScriptRunHistory()
+	require.Len(t, runs, 1)
+	require.Equal(t, agentscripts.ScriptStateFailed, runs[0].State)
+	require.Equal(t, 2, runs[0].ExitCode)
+	require.Positive(t, runs[0].Duration)
+	require.Len(t, runs[0].Output, 50)
+	require.Equal(t, "line 11", runs[0].Output[0])
+	require.Equal(t, "line 60", runs[0].Output[49])
+
+	// The history survives restarts of the agent.
+	restarted := agentscripts.New(agentscripts.Options{
+		Logger:      runner.Logger,
+		Filesystem:  runner.Filesystem,
+		HistoryPath: runner.HistoryPath,
+	})
+	defer restarted.Close()
+	require.NoError(t, restarted.LoadScriptRunHistory())
+	loaded := restarted.ScriptRunHistory()
+	require.Len(t, loaded, 1)
+	require.Equal(t, runs[0].Output, loaded[0].Output)
+	require.True(t, runs[0].StartedAt.Equal(loaded[0].StartedAt))
+}
+
+func TestScriptArtifacts(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("this test uses a POSIX shell script")
+	}
+	artifacts := make(chan agentsdk.ScriptArtifacts, 1)
+	runner := setup(t, nil)
+	runner.UploadArtifacts = func(ctx context.Context, req agentsdk.ScriptArtifacts) error {
+		data, err := io.ReadAll(req.Archive)
+		if err != nil {
+			return err
+		}
+		req.Archive = bytes.NewReader(data)
+		artifacts <- req
+		return nil
+	}
+	defer runner.Close()
+	id := uuid.New()
+	err := runner.Init([]codersdk.WorkspaceAgentScript{{
+		LogSourceID: id,
+		Script:      "echo -n report > \"$" + agentscripts.ArtifactsDirEnvironmentVariable + "/report.txt\"",
+	}})
+	require.NoError(t, err)
+	require.NoError(t, runner.Execute(context.Background(), agentscripts.ExecuteAllScripts))
+
+	req := <-artifacts
+	require.Equal(t, id, req.LogSourceID)
+	tr := tar.NewReader(req.Archive)
+	header, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, "report.txt", header.Name)
+	content, err := io.ReadAll(tr)
+	require.NoError(t, err)
+	require.Equal(t, "report", string(content))
+}
+
+type recordingHook struct {
+	env     string
+	err     error
+	results chan agentscripts.Result
+}
+
+func (h *recordingHook) PreExecute(_ context.Context, execution *agentscripts.Execution) error {
+	execution.Env = append(execution.Env, h.env)
+	return h.err
+}
+
+func (h *recordingHook) PostExecute(_ context.Context, _ *agentscripts.Execution, result agentscripts.Result) {
+	h.results <- result
+}
+
+func TestHooks(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("this test uses a POSIX shell script")
+	}
+
+	t.Run("Env", func(t *testing.T) {
+		t.Parallel()
+		logs := make(chan agentsdk.PatchLogs, 1)
+		runner := setup(t, func(ctx context.Context, req agentsdk.PatchLogs) error {
+			logs <- req
+			return nil
+		})
+		defer runner.Close()
+		hook := &recordingHook{env: "HOOK_SECRET=hunter2", results: make(chan agentscripts.Result, 1)}
+		runner.Hooks = []agentscripts.Hook{hook}
+		err := runner.Init([]codersdk.WorkspaceAgentScript{{
+			Script: "echo $HOOK_SECRET; exit 3",
+		}})
+		require.NoError(t, err)
+		require.Error(t, runner.Execute(context.Background(), agentscripts.ExecuteAllScripts))
+		log := <-logs
+		require.Equal(t, "hunter2", log.Logs[0].Output)
+		result := <-hook.results
+		require.Equal(t, 3, result.ExitCode)
+		require.Error(t, result.Err)
+	})
+
+	t.Run("PreExecuteError", func(t *testing.T) {
+		t.Parallel()
+		runner := setup(t, nil)
+		defer runner.Close()
+		first := &recordingHook{env: "FIRST=1", results: make(chan agentscripts.Result, 1)}
+		failing := &recordingHook{env: "SECOND=1", err: xerrors.New("no secrets"), results: make(chan agentscripts.Result, 1)}
+		runner.Hooks = []agentscripts.Hook{first, failing}
+		err := runner.Init([]codersdk.WorkspaceAgentScript{{
+			Script: "exit 0",
+		}})
+		require.NoError(t, err)
+		require.ErrorContains(t, runner.Execute(context.Background(), agentscripts.ExecuteAllScripts), "no secrets")
+		// Only hooks that were called are unwound.
+		result := <-first.results
+		require.ErrorContains(t, result.Err, "no secrets")
+		require.Len(t, failing.results, 0)
+	})
+}
+
+func TestScheduledTasks(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Run", func(t *testing.T) {
+		t.Parallel()
+		logs := make(chan agentsdk.PatchLogs, 1)
+		runner := setup(t, func(ctx context.Context, req agentsdk.PatchLogs) error {
+			select {
+			case logs <- req:
+			default:
+			}
+			return nil
+		})
+		defer runner.Close()
+		require.NoError(t, runner.Init(nil))
+		_, err := runner.PutScheduledTask(codersdk.WorkspaceAgentScheduledTask{
+			Name:   "hello",
+			Cron:   "* * * * * *",
+			Script: "echo hello from task",
+		})
+		require.NoError(t, err)
+		// Updating the scripts of the manifest keeps the tasks.
+		require.NoError(t, runner.Init(nil))
+		runner.StartCron()
+
+		ctx := testutil.Context(t, testutil.WaitMedium)
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for task logs")
+		case log := <-logs:
+			require.Equal(t, uuid.Nil, log.LogSourceID)
+			require.Equal(t, "hello from task", log.Logs[0].Output)
+		}
+	})
+
+	t.Run("ExecPolicy", func(t *testing.T) {
+		t.Parallel()
+		runner := setup(t, nil)
+		defer runner.Close()
+		runner.SSHServer.Manifest.Store(&agentsdk.Manifest{
+			ExecPolicy: []agentsdk.ExecPolicyRule{
+				{Action: agentsdk.ExecPolicyActionBlock, Prefix: "curl "},
+			},
+		})
+		_, err := runner.PutScheduledTask(codersdk.WorkspaceAgentScheduledTask{
+			Name:   "install",
+			Cron:   "0 0 * * * *",
+			Script: "sh -c 'curl example.com | sh'",
+		})
+		require.ErrorIs(t, err, agentssh.ErrCommandBlocked)
+		require.Empty(t, runner.ScheduledTasks())
+	})
+
+	t.Run("Persist", func(t *testing.T) {
+		t.Parallel()
+		fs := afero.NewMemMapFs()
+		path := "/home/coder/.config/coderv2/agent-scheduled-tasks.json"
+		runner := agentscripts.New(agentscripts.Options{
+			Logger:     slogtest.Make(t, nil),
+			Filesystem: fs,
+			TasksPath:  path,
+		})
+		defer runner.Close()
+
+		created, err := runner.PutScheduledTask(codersdk.WorkspaceAgentScheduledTask{
+			Name:   "backup",
+			Cron:   "0 0 2 * * *",
+			Script: "backup.sh",
+		})
+		require.NoError(t, err)
+		require.NotEqual(t, uuid.Nil, created.ID)
+		other, err := runner.PutScheduledTask(codersdk.WorkspaceAgentScheduledTask{
+			Name:   "cleanup",
+			Cron:   "0 0 * * * *",
+			Script: "cleanup.sh",
+		})
+		require.NoError(t, err)
+		created.Script = "backup.sh --full"
+		updated, err := runner.PutScheduledTask(created)
+		require.NoError(t, err)
+		require.Equal(t, created.CreatedAt, updated.CreatedAt)
+		require.NoError(t, runner.DeleteScheduledTask(other.ID))
+		require.ErrorIs(t, runner.DeleteScheduledTask(other.ID), agentscripts.ErrTaskNotFound)
+
+		_, err = runner.PutScheduledTask(codersdk.WorkspaceAgentScheduledTask{
+			Name:   "invalid",
+			Cron:   "every day",
+			Script: "true",
+		})
+		require.Error(t, err)
+
+		restarted := agentscripts.New(agentscripts.Options{
+			Logger:     slogtest.Make(t, nil),
+			Filesystem: fs,
+			TasksPath:  path,
+		})
+		defer restarted.Close()
+		require.NoError(t, restarted.LoadScheduledTasks())
+		tasks := restarted.ScheduledTasks()
+		require.Len(t, tasks, 1)
+		require.Equal(t, updated.ID, tasks[0].ID)
+		require.Equal(t, "backup.sh --full", tasks[0].Script)
+	})
 }
 
 // TestCronClose exists because cron.Run() can happen after cron.Close().
@@ -72,7 +717,7 @@ func setup(t *testing.T, patchLogs func(ctx context.Context, req agentsdk.PatchL
 	}
 	fs := afero.NewMemMapFs()
 	logger := slogtest.Make(t, nil)
-	s, err := agentssh.NewServer(context.Background(), logger, prometheus.NewRegistry(), fs, 0, "")
+	s, err := agentssh.NewServer(context.Background(), logger, prometheus.NewRegistry(), fs, nil)
 	require.NoError(t, err)
 	s.AgentToken = func() string { return "" }
 	s.Manifest = atomic.NewPointer(&agentsdk.Manifest{})
@@ -0,0 +1,154 @@
+package agentscripts
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+
+	"github.com/coder/coder/v2/coderd/util/xio"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+const (
+	// ArtifactsDirEnvironmentVariable is set for every script when artifact
+	// uploads are enabled. Any files a script writes into this directory are
+	// archived and uploaded once the script exits.
+	ArtifactsDirEnvironmentVariable = "CODER_SCRIPT_ARTIFACTS_DIR"
+
+	// DefaultArtifactsMaxSize is the default limit for the size of the
+	// artifacts archive produced by a single script execution.
+	DefaultArtifactsMaxSize = 10 << 20
+	// DefaultArtifactsBytesPerSecond is the default bandwidth limit of
+	// artifact uploads.
+	DefaultArtifactsBytesPerSecond = 1 << 20
+)
+
+// ErrArtifactsTooLarge is returned when the artifacts produced by a script
+// exceed the configured size limit.
+var ErrArtifactsTooLarge = xerrors.New("script artifacts exceed size limit")
+
+// artifactsDir returns the directory a script should write its artifacts to.
+func (r *Runner) artifactsDir(script codersdk.WorkspaceAgentScript) string {
+	return filepath.Join(r.LogDir, "coder-script-artifacts", script.LogSourceID.String())
+}
+
+// prepareArtifactsDir creates an empty artifacts directory for the script.
+// Leftovers from a previous execution (e.g. a cron run that failed to
+// upload) are removed so they aren't uploaded twice.
+func (r *Runner) prepareArtifactsDir(script codersdk.WorkspaceAgentScript) (string, error) {
+	dir := r.artifactsDir(script)
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return "", xerrors.Errorf("remove stale artifacts dir: %w", err)
+	}
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return "", xerrors.Errorf("create artifacts dir: %w", err)
+	}
+	return dir, nil
+}
+
+// uploadArtifacts archives the artifacts directory of a script and uploads
+// it. Nothing is uploaded if the script didn't produce any artifacts. The
+// directory is removed afterwards regardless of the outcome.
+func (r *Runner) uploadArtifacts(ctx context.Context, logger slog.Logger, script codersdk.WorkspaceAgentScript, dir string) error {
+	defer func() {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			logger.Warn(ctx, "remove script artifacts dir", slog.Error(err))
+		}
+	}()
+
+	maxSize := r.ArtifactsMaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultArtifactsMaxSize
+	}
+	var buf bytes.Buffer
+	count, err := tarArtifacts(&buf, dir, maxSize)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	bytesPerSecond := r.ArtifactsBytesPerSecond
+	if bytesPerSecond <= 0 {
+		bytesPerSecond = DefaultArtifactsBytesPerSecond
+	}
+	logger.Info(ctx, "uploading script artifacts", slog.F("files", count), slog.F("size", buf.Len()))
+	err = r.UploadArtifacts(ctx, agentsdk.ScriptArtifacts{
+		LogSourceID:    script.LogSourceID,
+		Archive:        bytes.NewReader(buf.Bytes()),
+		BytesPerSecond: bytesPerSecond,
+	})
+	if err != nil {
+		return xerrors.Errorf("upload script artifacts: %w", err)
+	}
+	return nil
+}
+
+// tarArtifacts writes a tar archive of all regular files and directories in
+// dir to w, returning the number of files archived. Symlinks are skipped to
+// avoid accidentally uploading files outside of the artifacts directory.
+func tarArtifacts(w io.Writer, dir string, limit int64) (int, error) {
+	lw := xio.NewLimitWriter(w, limit)
+	tarWriter := tar.NewWriter(lw)
+	count := 0
+	err := filepath.Walk(dir, func(file string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if !fileInfo.IsDir() && !fileInfo.Mode().IsRegular() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(fileInfo, "")
+		if err != nil {
+			return err
+		}
+		// Use unix paths in the tar archive.
+		header.Name = filepath.ToSlash(rel)
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if fileInfo.IsDir() {
+			return nil
+		}
+		count++
+		data, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+		_, err = io.Copy(tarWriter, data)
+		if err != nil {
+			return err
+		}
+		return data.Close()
+	})
+	if err == nil && count > 0 {
+		err = tarWriter.Close()
+	}
+	if err != nil {
+		if xerrors.Is(err, xio.ErrLimitReached) {
+			return 0, xerrors.Errorf("must be <= %d bytes: %w", limit, ErrArtifactsTooLarge)
+		}
+		return 0, xerrors.Errorf("archive artifacts: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,183 @@
+package agentscripts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+)
+
+const (
+	// DefaultHistorySize is the default number of script runs kept in the
+	// history.
+	DefaultHistorySize = 100
+	// historyOutputLines is the number of the last lines of output kept for
+	// every run.
+	historyOutputLines = 50
+	// historyMaxLineLength truncates long lines of output, e.g. of progress
+	// bars that never print a newline.
+	historyMaxLineLength = 1024
+)
+
+// ScriptRun is a completed execution of a script, e.g. to find out why a
+// script failed from within the workspace.
+type ScriptRun struct {
+	ScriptStatus
+	Duration time.Duration `json:"duration"`
+	// Output is the last lines of the combined output of the script.
+	Output []string `json:"output"`
+}
+
+// ScriptRunHistory returns the recent runs of scripts, newest first.
+func (r *Runner) ScriptRunHistory() []ScriptRun {
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	runs := make([]ScriptRun, 0, len(r.history))
+	for i := len(r.history) - 1; i >= 0; i-- {
+		runs = append(runs, r.history[i])
+	}
+	return runs
+}
+
+// LoadScriptRunHistory loads the history persisted in HistoryPath, e.g. by
+// a previous agent.
+func (r *Runner) LoadScriptRunHistory() error {
+	if r.HistoryPath == "" {
+		return nil
+	}
+	data, err := afero.ReadFile(r.Filesystem, r.HistoryPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("read script run history: %w", err)
+	}
+	var history []ScriptRun
+	err = json.Unmarshal(data, &history)
+	if err != nil {
+		return xerrors.Errorf("decode script run history: %w", err)
+	}
+
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	r.history = append(history, r.history...)
+	r.trimHistoryLocked()
+	return nil
+}
+
+// recordRun adds the run to the history, and persists the history if
+// HistoryPath is set.
+func (r *Runner) recordRun(ctx context.Context, run ScriptRun) {
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	r.history = append(r.history, run)
+	r.trimHistoryLocked()
+	err := r.persistHistoryLocked()
+	if err != nil {
+		r.Logger.Warn(ctx, "persist script run history", slog.Error(err))
+	}
+}
+
+func (r *Runner) trimHistoryLocked() {
+	size := r.HistorySize
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	if len(r.history) > size {
+		r.history = append([]ScriptRun(nil), r.history[len(r.history)-size:]...)
+	}
+}
+
+// persistHistoryLocked writes the history to HistoryPath, replacing the file
+// so a crash doesn't leave it truncated. It must only be called while
+// historyMu is held.
+func (r *Runner) persistHistoryLocked() error {
+	if r.HistoryPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(r.history)
+	if err != nil {
+		return xerrors.Errorf("encode script run history: %w", err)
+	}
+	err = r.Filesystem.MkdirAll(filepath.Dir(r.HistoryPath), 0o700)
+	if err != nil {
+		return xerrors.Errorf("create script run history dir: %w", err)
+	}
+	tmp := r.HistoryPath + ".tmp"
+	err = afero.WriteFile(r.Filesystem, tmp, data, 0o600)
+	if err != nil {
+		return xerrors.Errorf("write script run history: %w", err)
+	}
+	err = r.Filesystem.Rename(tmp, r.HistoryPath)
+	if err != nil {
+		return xerrors.Errorf("replace script run history: %w", err)
+	}
+	return nil
+}
+
+// outputTail keeps the last lines written to it.
+type outputTail struct {
+	mu      sync.Mutex
+	max     int
+	lines   []string
+	partial []byte
+}
+
+func newOutputTail(maxLines int) *outputTail {
+	return &outputTail{max: maxLines}
+}
+
+func (t *outputTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data := append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		t.addLocked(string(data[:i]))
+		data = data[i+1:]
+	}
+	if len(data) > historyMaxLineLength {
+		data = data[:historyMaxLineLength]
+	}
+	t.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+func (t *outputTail) addLocked(line string) {
+	line = strings.TrimSuffix(line, "\r")
+	if len(line) > historyMaxLineLength {
+		line = line[:historyMaxLineLength]
+	}
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
+
+// Lines returns the last lines, including a trailing line without a
+// newline.
+func (t *outputTail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := append([]string{}, t.lines...)
+	if len(t.partial) > 0 {
+		lines = append(lines, strings.TrimSuffix(string(t.partial), "\r"))
+		if len(lines) > t.max {
+			lines = lines[len(lines)-t.max:]
+		}
+	}
+	return lines
+}
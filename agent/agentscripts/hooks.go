@@ -0,0 +1,68 @@
+package agentscripts
+
+import (
+	"context"
+	"time"
+
+	"github.com/coder/coder/v2/codersdk"
+)
+
+// Hook is called around every script execution of a runner. Hooks allow
+// builds of the agent to attach behavior to scripts, e.g. injecting secrets
+// into the environment or sending notifications, without changing the
+// runner.
+type Hook interface {
+	// PreExecute is called before the script is started. Environment
+	// variables added to the execution are passed to the script. If an
+	// error is returned, the script isn't run and the error is returned by
+	// the runner.
+	PreExecute(ctx context.Context, execution *Execution) error
+	// PostExecute is called once the script exited, or failed to start.
+	PostExecute(ctx context.Context, execution *Execution, result Result)
+}
+
+// Execution is a single run of a script.
+type Execution struct {
+	Script codersdk.WorkspaceAgentScript
+	// Env is the environment of the script in addition to the environment
+	// of the agent, as "KEY=value" pairs.
+	Env []string
+}
+
+// Result is the outcome of an execution.
+type Result struct {
+	// ExitCode is 255 if the exit code of the script is unknown, e.g. if it
+	// timed out.
+	ExitCode  int
+	Err       error
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// preExecute calls the PreExecute hooks in order. If a hook fails, the
+// PostExecute of the hooks that were already called is run with the error.
+func (r *Runner) preExecute(ctx context.Context, execution *Execution) (func(error), error) {
+	start := time.Now()
+	called := make([]Hook, 0, len(r.Hooks))
+	post := func(err error) {
+		result := Result{
+			ExitCode:  scriptExitCode(err),
+			Err:       err,
+			StartedAt: start,
+			Duration:  time.Since(start),
+		}
+		// Hooks are unwound in reverse, like deferred calls.
+		for i := len(called) - 1; i >= 0; i-- {
+			called[i].PostExecute(ctx, execution, result)
+		}
+	}
+	for _, hook := range r.Hooks {
+		err := hook.PreExecute(ctx, execution)
+		if err != nil {
+			post(err)
+			return nil, err
+		}
+		called = append(called, hook)
+	}
+	return post, nil
+}
@@ -0,0 +1,46 @@
+package agentscripts
+
+import (
+	"context"
+
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// scriptLogFields returns the fields the logs of a script run are annotated
+// with, so the output of scripts running at the same time can be told
+// apart without guessing from their content.
+func scriptLogFields(script codersdk.WorkspaceAgentScript, stage codersdk.WorkspaceAgentScriptStage) map[string]string {
+	fields := map[string]string{}
+	if script.DisplayName != "" {
+		fields[codersdk.WorkspaceAgentLogFieldScript] = script.DisplayName
+	}
+	if stage != "" {
+		fields[codersdk.WorkspaceAgentLogFieldStage] = string(stage)
+	}
+	return fields
+}
+
+// annotateLogs returns a patchLogs that adds the fields to every log,
+// including the summaries of repeated and suppressed logs.
+func annotateLogs(patchLogs func(ctx context.Context, req agentsdk.PatchLogs) error, fields map[string]string) func(ctx context.Context, req agentsdk.PatchLogs) error {
+	if len(fields) == 0 {
+		return patchLogs
+	}
+	return func(ctx context.Context, req agentsdk.PatchLogs) error {
+		logs := make([]agentsdk.Log, 0, len(req.Logs))
+		for _, log := range req.Logs {
+			annotated := make(map[string]string, len(log.Fields)+len(fields))
+			for k, v := range log.Fields {
+				annotated[k] = v
+			}
+			for k, v := range fields {
+				annotated[k] = v
+			}
+			log.Fields = annotated
+			logs = append(logs, log)
+		}
+		req.Logs = logs
+		return patchLogs(ctx, req)
+	}
+}
@@ -0,0 +1,230 @@
+package agentscripts
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/atomic"
+
+	"cdr.dev/slog"
+
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// DefaultLogFlushTimeout is the default time the logs of a script are
+// flushed for once it exited, and the pending logs of all scripts are
+// flushed for when the runner is closed.
+const DefaultLogFlushTimeout = 10 * time.Second
+
+// logShutdownMarkerTimeout is the time the shutdown markers are sent for
+// after the logs were flushed or the flush timed out.
+const logShutdownMarkerTimeout = 2 * time.Second
+
+// logShutdown tracks flushing the logs of the scripts when the runner is
+// closed. All logs are flushed until a single deadline, so closing the runner
+// is bounded regardless of the number of scripts and when they exit.
+type logShutdown struct {
+	// ctx bounds flushing logs, including the flushes of scripts exiting
+	// while the runner is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// markerDeadline bounds sending the shutdown markers.
+	markerDeadline time.Time
+	// senders are the senders of the scripts that ran when the runner was
+	// closed, with the number of logs each had sent by then. They're kept
+	// once the scripts exited, so each of them gets a shutdown marker.
+	senders map[*scriptLogSender]int64
+}
+
+// scriptLogSender sends the logs of a script run to coderd. It's tracked by
+// the runner while the script runs, so logs still pending when the agent
+// shuts down are flushed rather than discarded.
+type scriptLogSender struct {
+	sourceID  uuid.UUID
+	patchLogs func(ctx context.Context, req agentsdk.PatchLogs) error
+	// sendMu serializes send, which is called by the writers of both output
+	// streams of the script but doesn't support concurrent calls.
+	sendMu  sync.Mutex
+	sendLog func(ctx context.Context, logs ...agentsdk.Log) error
+
+	flushAndClose func(ctx context.Context) error
+	closeOnce     sync.Once
+	closed        chan struct{}
+	closeErr      error
+
+	// sent and discarded count the logs sent to coderd and the logs that
+	// couldn't be sent.
+	sent      atomic.Int64
+	discarded atomic.Int64
+}
+
+// newLogSender returns a sender for the logs of a script run, which must be
+// closed with closeLogSender.
+func (r *Runner) newLogSender(sourceID uuid.UUID, patchLogs func(ctx context.Context, req agentsdk.PatchLogs) error, logger slog.Logger) *scriptLogSender {
+	s := &scriptLogSender{
+		sourceID:  sourceID,
+		patchLogs: patchLogs,
+		closed:    make(chan struct{}),
+	}
+	countSent := func(ctx context.Context, req agentsdk.PatchLogs) error {
+		err := patchLogs(ctx, req)
+		if err == nil {
+			s.sent.Add(int64(len(req.Logs)))
+		}
+		return err
+	}
+	// Scripts stuck in retry loops tend to repeat the same error, which is
+	// summarized instead of sent over and over. Scripts printing in a tight
+	// loop are rate limited, so they can't flood the connection to coderd.
+	s.sendLog, s.flushAndClose = agentsdk.LogsSender(sourceID, countSent, logger,
+		agentsdk.LogsSenderDeduplicate(time.Minute),
+		agentsdk.LogsSenderRateLimit(r.logRateLimit()),
+		agentsdk.LogsSenderOnDiscard(func(count int) {
+			s.discarded.Add(int64(count))
+		}))
+
+	r.logSendersMu.Lock()
+	r.logSenders[s] = struct{}{}
+	if r.logShutdown != nil {
+		r.logShutdown.senders[s] = 0
+	}
+	r.logSendersMu.Unlock()
+	return s
+}
+
+func (s *scriptLogSender) send(ctx context.Context, logs ...agentsdk.Log) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.sendLog(ctx, logs...)
+}
+
+// close flushes the pending logs of the sender until ctx is done. Concurrent
+// calls wait for the first one, which is bounded by its own context.
+func (s *scriptLogSender) close(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.flushAndClose(ctx)
+		close(s.closed)
+	})
+	<-s.closed
+	return s.closeErr
+}
+
+// closeLogSender flushes the logs of a script run once it exited. Logs are
+// flushed regardless of whether the context of the run was canceled, e.g.
+// by the shutdown of the agent, but not for longer than the flush timeout,
+// nor past the deadline of the shutdown.
+func (r *Runner) closeLogSender(s *scriptLogSender) error {
+	flushCtx := context.Background()
+	r.logSendersMu.Lock()
+	if r.logShutdown != nil {
+		flushCtx = r.logShutdown.ctx
+	}
+	r.logSendersMu.Unlock()
+	ctx, cancel := context.WithTimeout(flushCtx, r.logFlushTimeout())
+	defer cancel()
+	err := s.close(ctx)
+
+	r.logSendersMu.Lock()
+	delete(r.logSenders, s)
+	r.logSendersMu.Unlock()
+	return err
+}
+
+// startLogShutdown records the senders of the scripts running when the runner
+// is closed and starts the deadline of flushing their logs. It must be called
+// before the scripts are stopped, as scripts exiting remove their senders.
+func (r *Runner) startLogShutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.logFlushTimeout())
+	shutdown := &logShutdown{
+		ctx:            ctx,
+		cancel:         cancel,
+		markerDeadline: time.Now().Add(r.logFlushTimeout() + logShutdownMarkerTimeout),
+		senders:        make(map[*scriptLogSender]int64),
+	}
+	r.logSendersMu.Lock()
+	defer r.logSendersMu.Unlock()
+	for s := range r.logSenders {
+		shutdown.senders[s] = s.sent.Load()
+	}
+	r.logShutdown = shutdown
+}
+
+// flushLogs flushes the logs of the scripts that were running when the runner
+// was closed and are still flushing, and sends a marker with the number of
+// logs flushed since and discarded to each of them, so logs of stop scripts
+// aren't silently lost. Both are bounded by the deadlines of the shutdown.
+func (r *Runner) flushLogs() {
+	r.logSendersMu.Lock()
+	shutdown := r.logShutdown
+	senders := make(map[*scriptLogSender]int64, len(shutdown.senders))
+	for s, sent := range shutdown.senders {
+		senders[s] = sent
+	}
+	r.logSendersMu.Unlock()
+	defer shutdown.cancel()
+	if len(senders) == 0 {
+		return
+	}
+
+	markerCtx, cancel := context.WithDeadline(context.Background(), shutdown.markerDeadline)
+	defer cancel()
+	var (
+		wg                 sync.WaitGroup
+		totalMu            sync.Mutex
+		flushed, discarded int64
+	)
+	for s, sentBefore := range senders {
+		s, sentBefore := s, sentBefore
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Senders closed by their scripts already return the result of
+			// that flush.
+			err := s.close(shutdown.ctx)
+			if err != nil {
+				r.Logger.Warn(shutdown.ctx, "flush script logs on shutdown", slog.F("log_source_id", s.sourceID), slog.Error(err))
+			}
+			sent, dropped := s.sent.Load()-sentBefore, s.discarded.Load()
+			totalMu.Lock()
+			flushed += sent
+			discarded += dropped
+			totalMu.Unlock()
+			r.sendShutdownMarker(markerCtx, s, sent, dropped)
+		}()
+	}
+	wg.Wait()
+	r.Logger.Info(markerCtx, "flushed script logs on shutdown",
+		slog.F("scripts", len(senders)), slog.F("flushed", flushed), slog.F("discarded", discarded))
+}
+
+// sendShutdownMarker sends the final log of a script run that was running
+// when the agent shut down.
+func (r *Runner) sendShutdownMarker(ctx context.Context, s *scriptLogSender, flushed, discarded int64) {
+	level := codersdk.LogLevelInfo
+	if discarded > 0 {
+		level = codersdk.LogLevelWarn
+	}
+	err := s.patchLogs(ctx, agentsdk.PatchLogs{
+		LogSourceID: s.sourceID,
+		Logs: []agentsdk.Log{{
+			CreatedAt: time.Now(),
+			Level:     level,
+			Output:    fmt.Sprintf("Agent shutting down, %d log lines flushed, %d dropped", flushed, discarded),
+		}},
+	})
+	if err != nil {
+		r.Logger.Warn(ctx, "send script log shutdown marker", slog.F("log_source_id", s.sourceID), slog.Error(err))
+	}
+}
+
+// logFlushTimeout returns the time logs are flushed for.
+func (r *Runner) logFlushTimeout() time.Duration {
+	if r.LogFlushTimeout > 0 {
+		return r.LogFlushTimeout
+	}
+	return DefaultLogFlushTimeout
+}
@@ -0,0 +1,54 @@
+package agentscripts
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// process is a process started by a script.
+type process struct {
+	PID     int
+	Command string
+	// startTime distinguishes the process from later processes reusing
+	// its PID.
+	startTime uint64
+}
+
+func (p process) String() string {
+	return fmt.Sprintf("%d (%s)", p.PID, p.Command)
+}
+
+func formatProcesses(procs []process) string {
+	names := make([]string, 0, len(procs))
+	for _, proc := range procs {
+		names = append(names, proc.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// processTreeSnapshot holds the processes of a script when it was canceled.
+// Once the script exits, its children are reparented and can't be found
+// anymore, so they're recorded before the script is signaled.
+type processTreeSnapshot struct {
+	mu    sync.Mutex
+	procs []process
+}
+
+func (s *processTreeSnapshot) record(pid int) {
+	procs, err := processTree(pid)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.procs = procs
+}
+
+// kill kills the recorded processes that are still running, and returns
+// them.
+func (s *processTreeSnapshot) kill() []process {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return killProcesses(s.procs)
+}
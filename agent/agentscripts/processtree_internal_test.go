@@ -0,0 +1,54 @@
+//go:build linux
+
+package agentscripts
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/agent/procgroup"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestProcessTree(t *testing.T) {
+	t.Parallel()
+
+	// One child ignores SIGHUP, the other moves to a new session.
+	cmd := exec.CommandContext(context.Background(), "sh", "-c", "nohup sleep 30 >/dev/null 2>&1 & setsid sleep 30 & wait")
+	group := procgroup.New(cmd, procgroup.Options{})
+	require.NoError(t, group.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		_ = group.Close()
+	})
+
+	var tree processTreeSnapshot
+	require.Eventually(t, func() bool {
+		tree.record(cmd.Process.Pid)
+		sleeps := 0
+		for _, proc := range tree.procs {
+			if proc.Command == "sleep" {
+				sleeps++
+			}
+		}
+		return sleeps == 2
+	}, testutil.WaitShort, testutil.IntervalFast)
+
+	// The shell exits on SIGHUP, orphaning its children.
+	require.NoError(t, syscall.Kill(-cmd.Process.Pid, syscall.SIGHUP))
+	_ = cmd.Wait()
+
+	killed := tree.kill()
+	require.Len(t, killed, 2)
+	for _, proc := range killed {
+		require.Equal(t, "sleep", proc.Command)
+	}
+	require.Eventually(t, func() bool {
+		return len(tree.kill()) == 0
+	}, testutil.WaitShort, testutil.IntervalFast, "killed processes exit")
+}
@@ -0,0 +1,134 @@
+package agentscripts
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// procStat are the fields of /proc/<pid>/stat needed to find the processes
+// of a script.
+type procStat struct {
+	process
+	state   string
+	ppid    int
+	session int
+}
+
+// readProcStat parses /proc/<pid>/stat, see proc(5).
+func readProcStat(pid int) (procStat, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	stat := string(data)
+	// The command is in parentheses and may contain any character.
+	open := strings.IndexByte(stat, '(')
+	closing := strings.LastIndexByte(stat, ')')
+	if open < 0 || closing < open {
+		return procStat{}, xerrors.Errorf("invalid stat of process %d", pid)
+	}
+	// Fields following the command, starting with the state (3).
+	fields := strings.Fields(stat[closing+1:])
+	if len(fields) < 20 {
+		return procStat{}, xerrors.Errorf("invalid stat of process %d", pid)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procStat{}, xerrors.Errorf("parse ppid of process %d: %w", pid, err)
+	}
+	session, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return procStat{}, xerrors.Errorf("parse session of process %d: %w", pid, err)
+	}
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procStat{}, xerrors.Errorf("parse start time of process %d: %w", pid, err)
+	}
+	return procStat{
+		process: process{
+			PID:       pid,
+			Command:   stat[open+1 : closing],
+			startTime: startTime,
+		},
+		state:   fields[0],
+		ppid:    ppid,
+		session: session,
+	}, nil
+}
+
+// processTree returns the process root and all its descendants. Processes
+// in the session of root are included too, since scripts are started in
+// their own session and orphaned processes of the session are reparented.
+// Descendants that moved to a new session are found by their parent.
+func processTree(root int) ([]process, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, xerrors.Errorf("read /proc: %w", err)
+	}
+	stats := make(map[int]procStat, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := readProcStat(pid)
+		if err != nil {
+			// The process exited.
+			continue
+		}
+		stats[pid] = stat
+	}
+
+	inTree := func(stat procStat) bool {
+		if stat.session == root {
+			return true
+		}
+		// Processes are reparented to init or a subreaper when their
+		// parent exits, so the chain is finite.
+		for seen := 0; seen < len(stats); seen++ {
+			if stat.PID == root {
+				return true
+			}
+			parent, ok := stats[stat.ppid]
+			if !ok || parent.PID == stat.PID {
+				return false
+			}
+			stat = parent
+		}
+		return false
+	}
+	procs := make([]process, 0)
+	for _, stat := range stats {
+		if inTree(stat) {
+			procs = append(procs, stat.process)
+		}
+	}
+	return procs, nil
+}
+
+// killProcesses kills the processes that are still running, and returns
+// them.
+func killProcesses(procs []process) []process {
+	killed := make([]process, 0)
+	for _, proc := range procs {
+		stat, err := readProcStat(proc.PID)
+		if err != nil || stat.startTime != proc.startTime {
+			// The process exited, and the PID may have been reused.
+			continue
+		}
+		if stat.state == "Z" {
+			// The process exited, but isn't reaped yet.
+			continue
+		}
+		err = syscall.Kill(proc.PID, syscall.SIGKILL)
+		if err == nil {
+			killed = append(killed, proc)
+		}
+	}
+	return killed
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package agentscripts
+
+// processTree isn't supported on this platform, the processes of a script
+// are only signaled through its process group.
+func processTree(int) ([]process, error) {
+	return nil, nil
+}
+
+func killProcesses([]process) []process {
+	return nil
+}
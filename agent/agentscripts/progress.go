@@ -0,0 +1,91 @@
+package agentscripts
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coder/coder/v2/codersdk"
+)
+
+// Scripts report their progress by printing markers on lines of their own,
+// which are converted to structured logs so the dashboard can render
+// collapsible sections and progress bars:
+//
+//	::group::Installing dependencies
+//	::progress::40
+//	::progress::80::Building the project
+//	::endgroup::
+//
+// Sections don't nest, a section is ended when the next one starts. Lines
+// that look like markers but aren't valid are logged as they are.
+const (
+	progressMarkerGroup    = "::group::"
+	progressMarkerEndGroup = "::endgroup::"
+	progressMarkerProgress = "::progress::"
+)
+
+// progressMarkers parses the progress markers of a script run. The
+// section of a run is shared between its stdout and stderr.
+type progressMarkers struct {
+	mu    sync.Mutex
+	group string
+}
+
+// parse implements agentsdk.LogLineParser.
+func (p *progressMarkers) parse(line string) (string, map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(trimmed, progressMarkerGroup):
+		title := strings.TrimSpace(strings.TrimPrefix(trimmed, progressMarkerGroup))
+		if title == "" {
+			break
+		}
+		p.group = title
+		return title, map[string]string{
+			codersdk.WorkspaceAgentLogFieldEvent: string(codersdk.WorkspaceAgentLogEventGroupStart),
+			codersdk.WorkspaceAgentLogFieldGroup: title,
+		}
+	case trimmed == progressMarkerEndGroup:
+		if p.group == "" {
+			break
+		}
+		title := p.group
+		p.group = ""
+		return title, map[string]string{
+			codersdk.WorkspaceAgentLogFieldEvent: string(codersdk.WorkspaceAgentLogEventGroupEnd),
+			codersdk.WorkspaceAgentLogFieldGroup: title,
+		}
+	case strings.HasPrefix(trimmed, progressMarkerProgress):
+		raw, message, _ := strings.Cut(strings.TrimPrefix(trimmed, progressMarkerProgress), "::")
+		percent, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || percent < 0 || percent > 100 {
+			break
+		}
+		message = strings.TrimSpace(message)
+		if message == "" {
+			message = strconv.Itoa(percent) + "%"
+		}
+		fields := p.fieldsLocked()
+		fields[codersdk.WorkspaceAgentLogFieldEvent] = string(codersdk.WorkspaceAgentLogEventProgress)
+		fields[codersdk.WorkspaceAgentLogFieldProgress] = strconv.Itoa(percent)
+		return message, fields
+	}
+	if p.group == "" {
+		return line, nil
+	}
+	return line, p.fieldsLocked()
+}
+
+// fieldsLocked returns the fields of a log written within the current
+// section.
+func (p *progressMarkers) fieldsLocked() map[string]string {
+	fields := map[string]string{}
+	if p.group != "" {
+		fields[codersdk.WorkspaceAgentLogFieldGroup] = p.group
+	}
+	return fields
+}
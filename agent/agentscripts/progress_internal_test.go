@@ -0,0 +1,65 @@
+package agentscripts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressMarkers(t *testing.T) {
+	t.Parallel()
+
+	var markers progressMarkers
+	for _, tc := range []struct {
+		line   string
+		output string
+		fields map[string]string
+	}{{
+		line:   "starting",
+		output: "starting",
+	}, {
+		// Ending a section that wasn't started is just output.
+		line:   "::endgroup::",
+		output: "::endgroup::",
+	}, {
+		line:   "::group::Install",
+		output: "Install",
+		fields: map[string]string{"event": "group_start", "group": "Install"},
+	}, {
+		line:   "npm ci",
+		output: "npm ci",
+		fields: map[string]string{"group": "Install"},
+	}, {
+		line:   "::progress::40",
+		output: "40%",
+		fields: map[string]string{"event": "progress", "group": "Install", "progress": "40"},
+	}, {
+		line:   "::progress::80::Linking",
+		output: "Linking",
+		fields: map[string]string{"event": "progress", "group": "Install", "progress": "80"},
+	}, {
+		line:   "::progress::120",
+		output: "::progress::120",
+		fields: map[string]string{"group": "Install"},
+	}, {
+		// Sections don't nest.
+		line:   "::group::Build",
+		output: "Build",
+		fields: map[string]string{"event": "group_start", "group": "Build"},
+	}, {
+		line:   "::endgroup::",
+		output: "Build",
+		fields: map[string]string{"event": "group_end", "group": "Build"},
+	}, {
+		line:   "::group::",
+		output: "::group::",
+	}, {
+		line:   "::progress::100",
+		output: "100%",
+		fields: map[string]string{"event": "progress", "progress": "100"},
+	}} {
+		output, fields := markers.parse(tc.line)
+		require.Equal(t, tc.output, output, tc.line)
+		require.Equal(t, tc.fields, fields, tc.line)
+	}
+}
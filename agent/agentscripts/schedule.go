@@ -0,0 +1,108 @@
+package agentscripts
+
+import (
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"golang.org/x/xerrors"
+)
+
+// allHours is the hour field of a cron spec with a wildcard hour.
+const allHours = 1<<24 - 1
+
+// parseSchedule parses a script cron schedule. Schedules may be prefixed with
+// `CRON_TZ=<zone>` (or `TZ=<zone>`) to run in a timezone other than the one
+// of the agent, e.g. `CRON_TZ=Europe/Berlin 0 0 2 * * *`.
+//
+// Schedules at fixed hours follow the wall clock of the timezone across
+// daylight saving time transitions: runs that fall into the hour skipped
+// when clocks go forward happen right after the transition, and runs in the
+// hour repeated when clocks go back only happen once. Schedules running
+// every hour are unaffected.
+func parseSchedule(spec string) (cron.Schedule, error) {
+	schedule, err := parser.Parse(spec)
+	if err != nil {
+		return nil, xerrors.Errorf("parse cron %q: %w", spec, err)
+	}
+	specSchedule, ok := schedule.(*cron.SpecSchedule)
+	if !ok || specSchedule.Hour&allHours == allHours {
+		return schedule, nil
+	}
+	return &wallClockSchedule{spec: specSchedule}, nil
+}
+
+// wallClockSchedule evaluates a cron spec against the wall clock of its
+// location instead of elapsed time.
+type wallClockSchedule struct {
+	spec *cron.SpecSchedule
+}
+
+func (s *wallClockSchedule) Next(t time.Time) time.Time {
+	loc := s.spec.Location
+	if loc == nil || loc == time.Local {
+		loc = t.Location()
+	}
+
+	// Evaluate the schedule on a timeline without transitions, UTC with the
+	// fields of the wall clock.
+	wallSpec := *s.spec
+	wallSpec.Location = time.UTC
+	wall := wallTime(t.In(loc))
+	for {
+		wall = wallSpec.Next(wall)
+		if wall.IsZero() {
+			return wall
+		}
+		// The first occurrence of a repeated wall time has already passed
+		// if the agent started in the repeated hour, in which case the
+		// second occurrence is used.
+		for _, next := range wallTimeInstants(wall, loc) {
+			if next.After(t) {
+				return next.In(t.Location())
+			}
+		}
+	}
+}
+
+// wallTime returns the wall clock of t as a UTC time.
+func wallTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// wallTimeInstants returns the instants the wall clock in loc shows wall, in
+// order. A wall time is shown twice in the hour repeated when clocks go back.
+// If the wall time doesn't exist because clocks went forward, the instant of
+// the transition is returned.
+func wallTimeInstants(wall time.Time, loc *time.Location) []time.Time {
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+	if !wallTime(t).Equal(wall) {
+		start, end := t.ZoneBounds()
+		if wallTime(t).After(wall) {
+			return []time.Time{start}
+		}
+		return []time.Time{end}
+	}
+
+	instants := []time.Time{t}
+	// Look for the same wall time in the adjacent zones.
+	start, end := t.ZoneBounds()
+	if !start.IsZero() {
+		if earlier := sameWallTime(t, start.Add(-time.Nanosecond)); earlier.Before(start) && wallTime(earlier.In(loc)).Equal(wall) {
+			instants = []time.Time{earlier, t}
+		}
+	}
+	if !end.IsZero() {
+		if later := sameWallTime(t, end); !later.Before(end) && wallTime(later.In(loc)).Equal(wall) {
+			instants = append(instants, later)
+		}
+	}
+	return instants
+}
+
+// sameWallTime returns the instant with the wall clock of t in the zone in
+// effect at zone.
+func sameWallTime(t, zone time.Time) time.Time {
+	_, offset := t.Zone()
+	_, zoneOffset := zone.Zone()
+	return t.Add(time.Duration(offset-zoneOffset) * time.Second)
+}
@@ -0,0 +1,86 @@
+package agentscripts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	t.Parallel()
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name string
+		spec string
+		from time.Time
+		want []time.Time
+	}{{
+		name: "Timezone",
+		spec: "CRON_TZ=America/New_York 0 0 2 * * *",
+		from: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC),
+		want: []time.Time{
+			time.Date(2024, time.January, 10, 7, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 11, 7, 0, 0, 0, time.UTC),
+		},
+	}, {
+		// 02:30 doesn't exist on March 10th, the script runs when clocks
+		// jump to 03:00 instead of being skipped.
+		name: "SpringForward",
+		spec: "CRON_TZ=America/New_York 0 30 2 * * *",
+		from: time.Date(2024, time.March, 9, 12, 0, 0, 0, newYork),
+		want: []time.Time{
+			time.Date(2024, time.March, 10, 3, 0, 0, 0, newYork),
+			time.Date(2024, time.March, 11, 2, 30, 0, 0, newYork),
+		},
+	}, {
+		// 01:30 happens twice on November 3rd, the script only runs once.
+		name: "FallBack",
+		spec: "CRON_TZ=America/New_York 0 30 1 * * *",
+		from: time.Date(2024, time.November, 2, 12, 0, 0, 0, newYork),
+		want: []time.Time{
+			time.Date(2024, time.November, 3, 5, 30, 0, 0, time.UTC),
+			time.Date(2024, time.November, 4, 6, 30, 0, 0, time.UTC),
+		},
+	}, {
+		// The agent started in the repeated hour after the first 01:30.
+		name: "FallBackStartedInRepeatedHour",
+		spec: "CRON_TZ=America/New_York 0 30 1 * * *",
+		from: time.Date(2024, time.November, 3, 6, 10, 0, 0, time.UTC),
+		want: []time.Time{
+			time.Date(2024, time.November, 3, 6, 30, 0, 0, time.UTC),
+			time.Date(2024, time.November, 4, 6, 30, 0, 0, time.UTC),
+		},
+	}, {
+		// Hourly schedules run every elapsed hour.
+		name: "Hourly",
+		spec: "CRON_TZ=America/New_York 0 0 * * * *",
+		from: time.Date(2024, time.November, 3, 4, 30, 0, 0, time.UTC),
+		want: []time.Time{
+			time.Date(2024, time.November, 3, 5, 0, 0, 0, time.UTC),
+			time.Date(2024, time.November, 3, 6, 0, 0, 0, time.UTC),
+			time.Date(2024, time.November, 3, 7, 0, 0, 0, time.UTC),
+		},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			schedule, err := parseSchedule(tc.spec)
+			require.NoError(t, err)
+			next := tc.from
+			for _, want := range tc.want {
+				next = schedule.Next(next)
+				require.True(t, want.Equal(next), "want %s, got %s", want, next)
+			}
+		})
+	}
+
+	t.Run("InvalidTimezone", func(t *testing.T) {
+		t.Parallel()
+		_, err := parseSchedule("CRON_TZ=Mars/Olympus_Mons 0 0 2 * * *")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,99 @@
+package agentscripts
+
+import (
+	"errors"
+	"time"
+
+	"github.com/coder/coder/v2/codersdk"
+)
+
+// ScriptState is the state of the last execution of a script.
+type ScriptState string
+
+const (
+	ScriptStatePending   ScriptState = "pending"
+	ScriptStateRunning   ScriptState = "running"
+	ScriptStateSucceeded ScriptState = "succeeded"
+	ScriptStateFailed    ScriptState = "failed"
+	ScriptStateTimedOut  ScriptState = "timed_out"
+)
+
+// ScriptStatus is the status of the last execution of a script, e.g. to
+// debug startup scripts from within the workspace.
+type ScriptStatus struct {
+	Script codersdk.WorkspaceAgentScript `json:"script"`
+	State  ScriptState                   `json:"state"`
+	// StartedAt and CompletedAt are zero until the script started and
+	// completed.
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+	// ExitCode is set once the script completed.
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ScriptStatuses returns the status of the scripts of the agent, in the
+// order of the manifest. Scripts that weren't executed yet are pending.
+func (r *Runner) ScriptStatuses() []ScriptStatus {
+	r.scriptsMu.Lock()
+	scripts := r.scripts
+	r.scriptsMu.Unlock()
+
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	statuses := make([]ScriptStatus, 0, len(scripts))
+	for _, script := range scripts {
+		status, ok := r.statuses[script]
+		if !ok {
+			status = ScriptStatus{Script: script, State: ScriptStatePending}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// scriptState returns the state of the last execution of the script.
+func (r *Runner) scriptState(script codersdk.WorkspaceAgentScript) ScriptState {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	status, ok := r.statuses[script]
+	if !ok {
+		return ScriptStatePending
+	}
+	return status.State
+}
+
+// setStatusRunning records the start of an execution of the script.
+func (r *Runner) setStatusRunning(script codersdk.WorkspaceAgentScript) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	r.statuses[script] = ScriptStatus{
+		Script:    script,
+		State:     ScriptStateRunning,
+		StartedAt: time.Now(),
+	}
+}
+
+// setStatusCompleted records the outcome of an execution of the script, and
+// returns the status.
+func (r *Runner) setStatusCompleted(script codersdk.WorkspaceAgentScript, err error) ScriptStatus {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	status := r.statuses[script]
+	status.Script = script
+	status.CompletedAt = time.Now()
+	status.ExitCode = scriptExitCode(err)
+	switch {
+	case err == nil:
+		status.State = ScriptStateSucceeded
+	case errors.Is(err, ErrTimeout):
+		status.State = ScriptStateTimedOut
+	default:
+		status.State = ScriptStateFailed
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	r.statuses[script] = status
+	return status
+}
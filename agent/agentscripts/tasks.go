@@ -0,0 +1,226 @@
+package agentscripts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/afero"
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/agent/agentssh"
+	"github.com/coder/coder/v2/codersdk"
+)
+
+// ErrTaskNotFound is returned when a scheduled task doesn't exist.
+var ErrTaskNotFound = xerrors.New("scheduled task not found")
+
+// scheduledTask is a task scheduled on the cron of the runner.
+type scheduledTask struct {
+	task  codersdk.WorkspaceAgentScheduledTask
+	entry cron.EntryID
+}
+
+// taskScript returns the script executing a task. Tasks log to the
+// "External" log source and have a log file of their own, their logs are
+// annotated with the name of the task.
+func taskScript(task codersdk.WorkspaceAgentScheduledTask) codersdk.WorkspaceAgentScript {
+	return codersdk.WorkspaceAgentScript{
+		LogPath:     "coder-scheduled-task-" + task.ID.String() + ".log",
+		Script:      task.Script,
+		Cron:        task.Cron,
+		Timeout:     time.Duration(task.TimeoutSeconds) * time.Second,
+		DisplayName: task.Name,
+	}
+}
+
+// LoadScheduledTasks schedules the tasks persisted in TasksPath, e.g. by a
+// previous agent. Tasks are scheduled once the cron is started.
+func (r *Runner) LoadScheduledTasks() error {
+	if r.TasksPath == "" {
+		return nil
+	}
+	data, err := afero.ReadFile(r.Filesystem, r.TasksPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("read scheduled tasks: %w", err)
+	}
+	var tasks []codersdk.WorkspaceAgentScheduledTask
+	err = json.Unmarshal(data, &tasks)
+	if err != nil {
+		return xerrors.Errorf("decode scheduled tasks: %w", err)
+	}
+
+	r.scriptsMu.Lock()
+	defer r.scriptsMu.Unlock()
+	for _, task := range tasks {
+		err := r.scheduleTask(task)
+		if err != nil {
+			// Skip invalid tasks instead of dropping all of them, e.g. if a
+			// timezone isn't available anymore.
+			r.Logger.Warn(context.Background(), "skip invalid scheduled task",
+				slog.F("task_id", task.ID), slog.F("name", task.Name), slog.Error(err))
+		}
+	}
+	r.Logger.Info(context.Background(), "loaded scheduled tasks", slog.F("task_count", len(r.tasks)), slog.F("path", r.TasksPath))
+	return nil
+}
+
+// ScheduledTasks returns the scheduled tasks, oldest first.
+func (r *Runner) ScheduledTasks() []codersdk.WorkspaceAgentScheduledTask {
+	r.scriptsMu.Lock()
+	defer r.scriptsMu.Unlock()
+	return r.scheduledTasksLocked()
+}
+
+func (r *Runner) scheduledTasksLocked() []codersdk.WorkspaceAgentScheduledTask {
+	tasks := make([]codersdk.WorkspaceAgentScheduledTask, 0, len(r.tasks))
+	for _, t := range r.tasks {
+		tasks = append(tasks, t.task)
+	}
+	slices.SortFunc(tasks, func(a, b codersdk.WorkspaceAgentScheduledTask) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return slices.Compare(a.ID[:], b.ID[:])
+	})
+	return tasks
+}
+
+// PutScheduledTask creates the task, or replaces it if a task with the ID
+// exists, and persists the tasks.
+func (r *Runner) PutScheduledTask(task codersdk.WorkspaceAgentScheduledTask) (codersdk.WorkspaceAgentScheduledTask, error) {
+	if task.Name == "" {
+		return codersdk.WorkspaceAgentScheduledTask{}, xerrors.New("name is required")
+	}
+	if task.Script == "" {
+		return codersdk.WorkspaceAgentScheduledTask{}, xerrors.New("script is required")
+	}
+	if task.TimeoutSeconds < 0 {
+		return codersdk.WorkspaceAgentScheduledTask{}, xerrors.New("timeout must not be negative")
+	}
+	_, err := parseSchedule(task.Cron)
+	if err != nil {
+		return codersdk.WorkspaceAgentScheduledTask{}, err
+	}
+	err = r.checkExecPolicy(context.Background(), task)
+	if err != nil {
+		return codersdk.WorkspaceAgentScheduledTask{}, err
+	}
+
+	r.scriptsMu.Lock()
+	defer r.scriptsMu.Unlock()
+	if r.isClosed() {
+		return codersdk.WorkspaceAgentScheduledTask{}, xerrors.New("put scheduled task: closed")
+	}
+	now := time.Now().UTC()
+	previous, exists := r.tasks[task.ID]
+	if exists {
+		task.CreatedAt = previous.task.CreatedAt
+		r.cron.Remove(previous.entry)
+		delete(r.tasks, task.ID)
+	} else {
+		if task.ID == uuid.Nil {
+			task.ID = uuid.New()
+		}
+		task.CreatedAt = now
+	}
+	task.UpdatedAt = now
+	err = r.scheduleTask(task)
+	if err != nil {
+		return codersdk.WorkspaceAgentScheduledTask{}, err
+	}
+	err = r.persistTasksLocked()
+	if err != nil {
+		return codersdk.WorkspaceAgentScheduledTask{}, err
+	}
+	r.Logger.Info(context.Background(), "scheduled task", slog.F("task_id", task.ID), slog.F("name", task.Name), slog.F("cron", task.Cron))
+	return task, nil
+}
+
+// DeleteScheduledTask unschedules the task and persists the tasks.
+func (r *Runner) DeleteScheduledTask(id uuid.UUID) error {
+	r.scriptsMu.Lock()
+	defer r.scriptsMu.Unlock()
+	t, ok := r.tasks[id]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	r.cron.Remove(t.entry)
+	delete(r.tasks, id)
+	err := r.persistTasksLocked()
+	if err != nil {
+		return err
+	}
+	r.Logger.Info(context.Background(), "deleted scheduled task", slog.F("task_id", id), slog.F("name", t.task.Name))
+	return nil
+}
+
+// scheduleTask must only be called while scriptsMu is held.
+func (r *Runner) scheduleTask(task codersdk.WorkspaceAgentScheduledTask) error {
+	schedule, err := parseSchedule(task.Cron)
+	if err != nil {
+		return err
+	}
+	script := taskScript(task)
+	entry := r.cron.Schedule(schedule, cron.FuncJob(func() {
+		// The policy is checked for every run, since it may have changed
+		// since the task was scheduled.
+		err := r.checkExecPolicy(r.cronCtx, task)
+		if err == nil {
+			err = r.trackRun(r.cronCtx, script, codersdk.WorkspaceAgentScriptStageCron)
+		}
+		if err != nil {
+			r.Logger.Warn(context.Background(), "run scheduled task", slog.F("task_id", task.ID), slog.F("name", task.Name), slog.Error(err))
+		}
+	}))
+	r.tasks[task.ID] = scheduledTask{task: task, entry: entry}
+	return nil
+}
+
+// checkExecPolicy enforces the exec policy of the workspace for the script
+// of a task, since users schedule tasks like they execute commands over
+// SSH.
+func (r *Runner) checkExecPolicy(ctx context.Context, task codersdk.WorkspaceAgentScheduledTask) error {
+	if r.SSHServer == nil {
+		return nil
+	}
+	logger := r.Logger.With(slog.F("task_id", task.ID), slog.F("name", task.Name))
+	return r.SSHServer.CheckExecPolicy(ctx, logger, agentssh.ExecPolicySourceScheduledTask, task.Script, nil)
+}
+
+// persistTasksLocked writes the tasks to TasksPath, replacing the file so a
+// crash doesn't leave it truncated. It must only be called while scriptsMu
+// is held.
+func (r *Runner) persistTasksLocked() error {
+	if r.TasksPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.scheduledTasksLocked(), "", "  ")
+	if err != nil {
+		return xerrors.Errorf("encode scheduled tasks: %w", err)
+	}
+	err = r.Filesystem.MkdirAll(filepath.Dir(r.TasksPath), 0o700)
+	if err != nil {
+		return xerrors.Errorf("create scheduled tasks dir: %w", err)
+	}
+	tmp := r.TasksPath + ".tmp"
+	err = afero.WriteFile(r.Filesystem, tmp, data, 0o600)
+	if err != nil {
+		return xerrors.Errorf("write scheduled tasks: %w", err)
+	}
+	err = r.Filesystem.Rename(tmp, r.TasksPath)
+	if err != nil {
+		return xerrors.Errorf("replace scheduled tasks: %w", err)
+	}
+	return nil
+}
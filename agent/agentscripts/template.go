@@ -0,0 +1,104 @@
+package agentscripts
+
+import (
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// TemplateDirective opts a script into expansion as a template. It must be
+// a comment line before the first command of the script.
+const TemplateDirective = "# coder:template"
+
+// ErrInvalidTemplate is returned when a script references unknown template
+// variables, or isn't a valid template.
+var ErrInvalidTemplate = xerrors.New("invalid script template")
+
+// TemplateData are the variables scripts are expanded with, e.g.
+// {{ .WorkspaceName }}. Values are quoted for the shell the script runs in.
+type TemplateData struct {
+	WorkspaceID   uuid.UUID
+	WorkspaceName string
+	OwnerName     string
+	OwnerEmail    string
+	AgentID       uuid.UUID
+	AgentName     string
+	Directory     string
+}
+
+// TemplateDataFromManifest returns the variables of the manifest.
+func TemplateDataFromManifest(manifest agentsdk.Manifest) TemplateData {
+	return TemplateData{
+		WorkspaceID:   manifest.WorkspaceID,
+		WorkspaceName: manifest.WorkspaceName,
+		OwnerName:     manifest.OwnerName,
+		OwnerEmail:    manifest.OwnerEmail,
+		AgentID:       manifest.AgentID,
+		AgentName:     manifest.AgentName,
+		Directory:     manifest.Directory,
+	}
+}
+
+// quoted returns the variables quoted for the shell.
+func (d TemplateData) quoted() map[string]string {
+	return map[string]string{
+		"WorkspaceID":   shellQuote(d.WorkspaceID.String()),
+		"WorkspaceName": shellQuote(d.WorkspaceName),
+		"OwnerName":     shellQuote(d.OwnerName),
+		"OwnerEmail":    shellQuote(d.OwnerEmail),
+		"AgentID":       shellQuote(d.AgentID.String()),
+		"AgentName":     shellQuote(d.AgentName),
+		"Directory":     shellQuote(d.Directory),
+	}
+}
+
+// ExpandScript expands the template variables of scripts that opt in with
+// TemplateDirective. Other scripts are returned unchanged, so commands that
+// take templates themselves, e.g. docker ps --format '{{ .Names }}', keep
+// working.
+func ExpandScript(script string, data TemplateData) (string, error) {
+	if !hasTemplateDirective(script) {
+		return script, nil
+	}
+	tmpl, err := template.New("script").Option("missingkey=error").Parse(script)
+	if err != nil {
+		return "", xerrors.Errorf("%w: %s", ErrInvalidTemplate, err.Error())
+	}
+	var expanded strings.Builder
+	err = tmpl.Execute(&expanded, data.quoted())
+	if err != nil {
+		return "", xerrors.Errorf("%w: %s", ErrInvalidTemplate, err.Error())
+	}
+	return expanded.String(), nil
+}
+
+// hasTemplateDirective returns whether one of the comment lines the script
+// starts with is TemplateDirective.
+func hasTemplateDirective(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			return false
+		}
+		if line == TemplateDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote quotes the value for POSIX shells, or PowerShell on Windows.
+func shellQuote(value string) string {
+	if runtime.GOOS == "windows" {
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
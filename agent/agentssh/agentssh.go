@@ -30,6 +30,7 @@ import (
 
 	"cdr.dev/slog"
 
+	"github.com/coder/coder/v2/agent/procgroup"
 	"github.com/coder/coder/v2/agent/usershell"
 	"github.com/coder/coder/v2/codersdk"
 	"github.com/coder/coder/v2/codersdk/agentsdk"
@@ -61,7 +62,9 @@ type Server struct {
 	listeners map[net.Listener]struct{}
 	conns     map[net.Conn]struct{}
 	sessions  map[ssh.Session]struct{}
-	closing   chan struct{}
+	// subsystems are the SSH subsystems served, see RegisterSubsystem.
+	subsystems map[string]Subsystem
+	closing    chan struct{}
 	// Wait for goroutines to exit, waited without
 	// a lock on mu but protected by closing.
 	wg sync.WaitGroup
@@ -74,15 +77,54 @@ type Server struct {
 	AgentToken    func() string
 	Manifest      *atomic.Pointer[agentsdk.Manifest]
 	ServiceBanner *atomic.Pointer[codersdk.ServiceBannerConfig]
+	// MOTD is the latest MOTD configuration fetched from coderd, which is
+	// shown instead of the one of the manifest.
+	MOTD *atomic.Pointer[agentsdk.MOTDConfig]
+
+	// authorizedKeys are public keys accepted in addition to connections
+	// authenticated by coderd.
+	authorizedKeys atomic.Pointer[authorizedKeys]
+	// execPolicy is the compiled exec policy of the manifest, see
+	// CheckExecPolicy.
+	execPolicy atomic.Pointer[execPolicy]
+
+	// bruteForce bans sources that repeatedly fail to authenticate, which
+	// matters once the server is reachable without coderd, e.g. through a
+	// forwarded port.
+	bruteForce *bruteForceGuard
 
 	connCountVSCode     atomic.Int64
 	connCountJetBrains  atomic.Int64
 	connCountSSHSession atomic.Int64
 
 	metrics *sshServerMetrics
+	// sessionPeakRSS is the largest peak RSS reported for sessions by
+	// metric labels, since gauges can't keep the maximum themselves.
+	sessionPeakRSSMu sync.Mutex
+	sessionPeakRSS   map[string]int64
 }
 
-func NewServer(ctx context.Context, logger slog.Logger, prometheusRegistry *prometheus.Registry, fs afero.Fs, maxTimeout time.Duration, x11SocketDir string) (*Server, error) {
+// Config sets configuration parameters for the agent SSH server.
+type Config struct {
+	// MaxTimeout sets the absolute connection timeout, none if empty. If set
+	// to 3 seconds or more, keep alive will be used instead.
+	MaxTimeout time.Duration
+	// X11SocketDir is the directory where X11 sockets are created. Default
+	// is /tmp/.X11-unix.
+	X11SocketDir string
+	// Crypto restricts the key exchange algorithms, ciphers and MACs the
+	// server accepts.
+	Crypto CryptoConfig
+}
+
+func NewServer(ctx context.Context, logger slog.Logger, prometheusRegistry *prometheus.Registry, fs afero.Fs, config *Config) (*Server, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	crypto, err := config.Crypto.Resolve()
+	if err != nil {
+		return nil, err
+	}
 	// Clients' should ignore the host key when connecting.
 	// The agent needs to authenticate with coderd to SSH,
 	// so SSH authentication doesn't improve security.
@@ -94,6 +136,7 @@ func NewServer(ctx context.Context, logger slog.Logger, prometheusRegistry *prom
 	if err != nil {
 		return nil, err
 	}
+	x11SocketDir := config.X11SocketDir
 	if x11SocketDir == "" {
 		x11SocketDir = filepath.Join(os.TempDir(), ".X11-unix")
 	}
@@ -109,19 +152,32 @@ func NewServer(ctx context.Context, logger slog.Logger, prometheusRegistry *prom
 		sessions:     make(map[ssh.Session]struct{}),
 		logger:       logger,
 		x11SocketDir: x11SocketDir,
+		bruteForce:   newBruteForceGuard(logger),
 
 		metrics: metrics,
 	}
+	s.subsystems = map[string]Subsystem{
+		"sftp": {Handler: s.sftpHandler},
+	}
 
 	srv := &ssh.Server{
 		ChannelHandlers: map[string]ssh.ChannelHandler{
-			"direct-tcpip": func(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+			"direct-tcpip": s.withKeepAlive(func(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
 				// Wrapper is designed to find and track JetBrains Gateway connections.
 				wrapped := NewJetbrainsChannelWatcher(ctx, s.logger, newChan, &s.connCountJetBrains)
 				ssh.DirectTCPIPHandler(srv, conn, wrapped, ctx)
-			},
-			"direct-streamlocal@openssh.com": directStreamLocalHandler,
-			"session":                        ssh.DefaultSessionHandler,
+			}),
+			"direct-streamlocal@openssh.com": s.withKeepAlive(directStreamLocalHandler),
+			"session":                        s.withKeepAlive(ssh.DefaultSessionHandler),
+		},
+		ConnCallback: func(ctx ssh.Context, conn net.Conn) net.Conn {
+			if s.bruteForce.banned(conn.RemoteAddr()) {
+				s.logger.Debug(ctx, "refused ssh connection from banned source",
+					slog.F("remote_addr", conn.RemoteAddr()))
+				metrics.bannedConnectionsTotal.Add(1)
+				return nil
+			}
+			return conn
 		},
 		ConnectionFailedCallback: func(conn net.Conn, err error) {
 			s.logger.Warn(ctx, "ssh connection failed",
@@ -129,6 +185,7 @@ func NewServer(ctx context.Context, logger slog.Logger, prometheusRegistry *prom
 				slog.F("local_addr", conn.LocalAddr()),
 				slog.Error(err))
 			metrics.failedConnectionsTotal.Add(1)
+			s.bruteForce.connectionFailed(ctx, conn.RemoteAddr(), err)
 		},
 		ConnectionCompleteCallback: func(conn *gossh.ServerConn, err error) {
 			s.logger.Info(ctx, "ssh connection complete",
@@ -163,23 +220,37 @@ func NewServer(ctx context.Context, logger slog.Logger, prometheusRegistry *prom
 		},
 		X11Callback: s.x11Callback,
 		ServerConfigCallback: func(ctx ssh.Context) *gossh.ServerConfig {
-			return &gossh.ServerConfig{
-				NoClientAuth: true,
+			serverConfig := &gossh.ServerConfig{
+				NoClientAuth:         true,
+				NoClientAuthCallback: s.noClientAuthCallback,
+				AuthLogCallback: func(conn gossh.ConnMetadata, method string, err error) {
+					// Without authorized keys, public keys are never
+					// accepted and there's nothing to guess.
+					if s.hasAuthorizedKeys() {
+						s.bruteForce.authAttempted(conn.RemoteAddr(), method, err)
+					}
+				},
 			}
+			crypto.apply(serverConfig)
+			return serverConfig
 		},
+		PublicKeyHandler:       s.publicKeyHandler,
+		SessionRequestCallback: s.sessionRequestCallback,
+		// Subsystems are looked up by the session handler, since they can
+		// be registered at any time.
 		SubsystemHandlers: map[string]ssh.SubsystemHandler{
-			"sftp": s.sessionHandler,
+			"default": s.sessionHandler,
 		},
 	}
 
 	// The MaxTimeout functionality has been substituted with the introduction of the KeepAlive feature.
 	// In cases where very short timeouts are set, the SSH server will automatically switch to the connection timeout for both read and write operations.
-	if maxTimeout >= 3*time.Second {
+	if config.MaxTimeout >= 3*time.Second {
 		srv.ClientAliveCountMax = 3
-		srv.ClientAliveInterval = maxTimeout / time.Duration(srv.ClientAliveCountMax)
+		srv.ClientAliveInterval = config.MaxTimeout / time.Duration(srv.ClientAliveCountMax)
 		srv.MaxTimeout = 0
 	} else {
-		srv.MaxTimeout = maxTimeout
+		srv.MaxTimeout = config.MaxTimeout
 	}
 
 	s.srv = srv
@@ -231,14 +302,14 @@ func (s *Server) sessionHandler(session ssh.Session) {
 		extraEnv = append(extraEnv, fmt.Sprintf("DISPLAY=:%d.0", x11.ScreenNumber))
 	}
 
-	switch ss := session.Subsystem(); ss {
-	case "":
-	case "sftp":
-		s.sftpHandler(logger, session)
-		return
-	default:
-		logger.Warn(ctx, "unsupported subsystem", slog.F("subsystem", ss))
-		_ = session.Exit(1)
+	if ss := session.Subsystem(); ss != "" {
+		subsystem, ok := s.subsystem(ss)
+		if !ok {
+			logger.Warn(ctx, "unsupported subsystem", slog.F("subsystem", ss))
+			_ = session.Exit(1)
+			return
+		}
+		subsystem.Handler(logger.With(slog.F("subsystem", ss)), session)
 		return
 	}
 
@@ -311,6 +382,16 @@ func (s *Server) sessionStart(logger slog.Logger, session ssh.Session, extraEnv
 	magicTypeLabel := magicTypeMetricLabel(magicType)
 	sshPty, windowSize, isPty := session.Pty()
 
+	err := s.CheckExecPolicy(ctx, logger, magicTypeLabel, session.RawCommand(), session.Stderr())
+	if err != nil {
+		ptyLabel := "no"
+		if isPty {
+			ptyLabel = "yes"
+		}
+		s.metrics.sessionErrors.WithLabelValues(magicTypeLabel, ptyLabel, "exec_policy").Add(1)
+		return err
+	}
+
 	cmd, err := s.CreateCommand(ctx, session.RawCommand(), env)
 	if err != nil {
 		ptyLabel := "no"
@@ -362,7 +443,12 @@ func (s *Server) startNonPTYSession(logger slog.Logger, session ssh.Session, mag
 		}
 		_ = stdinPipe.Close()
 	}()
-	err = cmd.Start()
+	// The command runs in its own process group, which is stopped when the
+	// session ends. Like scripts, children that keep the output of the
+	// session open are given the kill delay to exit once the command did.
+	group := procgroup.New(cmd, procgroup.Options{})
+	defer group.Close()
+	err = group.Start()
 	if err != nil {
 		s.metrics.sessionErrors.WithLabelValues(magicTypeLabel, "no", "start_command").Add(1)
 		return xerrors.Errorf("start: %w", err)
@@ -378,7 +464,9 @@ func (s *Server) startNonPTYSession(logger slog.Logger, session ssh.Session, mag
 			s.handleSignal(logger, sig, cmd.Process, magicTypeLabel)
 		}
 	}()
-	return cmd.Wait()
+	err = cmd.Wait()
+	s.recordSessionUsage(magicTypeLabel, "no", cmd.ProcessState)
+	return err
 }
 
 // ptySession is the interface to the ssh.Session that startPTYSession uses
@@ -410,17 +498,10 @@ func (s *Server) startPTYSession(logger slog.Logger, session ptySession, magicTy
 		}
 	}
 
-	if !isQuietLogin(s.fs, session.RawCommand()) {
-		manifest := s.Manifest.Load()
-		if manifest != nil {
-			err := showMOTD(s.fs, session, manifest.MOTDFile)
-			if err != nil {
-				logger.Error(ctx, "agent failed to show MOTD", slog.Error(err))
-				s.metrics.sessionErrors.WithLabelValues(magicTypeLabel, "yes", "motd").Add(1)
-			}
-		} else {
-			logger.Warn(ctx, "metadata lookup failed, unable to show MOTD")
-		}
+	err := s.WriteMOTD(session, session.RawCommand())
+	if err != nil {
+		logger.Error(ctx, "agent failed to show MOTD", slog.Error(err))
+		s.metrics.sessionErrors.WithLabelValues(magicTypeLabel, "yes", "motd").Add(1)
 	}
 
 	cmd.Env = append(cmd.Env, fmt.Sprintf("TERM=%s", sshPty.Term))
@@ -503,6 +584,7 @@ func (s *Server) startPTYSession(logger slog.Logger, session ptySession, magicTy
 	// complete so that we can get the exit code.  This returns
 	// immediately if the TTY was closed as part of the command exiting.
 	err = process.Wait()
+	s.recordSessionUsage(magicTypeLabel, "yes", process.ProcessState())
 	var exitErr *exec.ExitError
 	// ExitErrors just mean the command we run returned a non-zero exit code, which is normal
 	// and not something to be concerned about.  But, if it's something else, we should log it.
@@ -682,14 +764,21 @@ func (s *Server) CreateCommand(ctx context.Context, script string, env []string)
 	// This adds the ports dialog to code-server that enables
 	// proxying a port dynamically.
 	// If this is empty string, do not set anything. Code-server auto defaults
-	// using its basepath to construct a path based port proxy.
-	if manifest.VSCodePortProxyURI != "" {
+	// using its basepath to construct a path based port proxy. The dialog
+	// is hidden if the port forwarding helper is disabled for the agent.
+	if manifest.VSCodePortProxyURI != "" && manifest.DisplayAppEnabled(codersdk.DisplayAppPortForward) {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("VSCODE_PROXY_URI=%s", manifest.VSCodePortProxyURI))
 	}
 
 	// Hide Coder message on code-server's "Getting Started" page
 	cmd.Env = append(cmd.Env, "CS_DISABLE_GETTING_STARTED_OVERRIDE=true")
 
+	// Proxies configured for the workspace, so tools work behind corporate
+	// proxies without templates setting them for every command.
+	if manifest.Proxy != nil {
+		cmd.Env = append(cmd.Env, manifest.Proxy.Environ()...)
+	}
+
 	// Load environment variables passed via the agent.
 	// These should override all variables we manually specify.
 	for envKey, value := range manifest.EnvironmentVariables {
@@ -6,13 +6,19 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 	"testing"
 
+	gliderssh "github.com/gliderlabs/ssh"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
@@ -20,7 +26,9 @@ import (
 	"go.uber.org/atomic"
 	"go.uber.org/goleak"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/xerrors"
 
+	"cdr.dev/slog"
 	"cdr.dev/slog/sloggers/slogtest"
 
 	"github.com/coder/coder/v2/agent/agentssh"
@@ -38,7 +46,7 @@ func TestNewServer_ServeClient(t *testing.T) {
 
 	ctx := context.Background()
 	logger := slogtest.Make(t, nil)
-	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), 0, "")
+	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
 	require.NoError(t, err)
 	defer s.Close()
 
@@ -75,6 +83,427 @@ func TestNewServer_ServeClient(t *testing.T) {
 	<-done
 }
 
+func TestNewServer_KeepAlive(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slogtest.Make(t, nil)
+	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.AgentToken = func() string { return "" }
+	s.Manifest = atomic.NewPointer(&agentsdk.Manifest{
+		SSHKeepAlive: &agentsdk.SSHKeepAliveConfig{
+			IntervalSeconds: 1,
+			CountMax:        1,
+		},
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := s.Serve(ln)
+		assert.Error(t, err) // Server is closed.
+	}()
+
+	// Only forward a port, without a session.
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer target.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, "localhost:22", &ssh.ClientConfig{
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(), //nolint:gosec // This is a test.
+	})
+	require.NoError(t, err)
+	defer sshConn.Close()
+	keepAlives := make(chan *ssh.Request)
+	otherRequests := make(chan *ssh.Request)
+	go func() {
+		defer close(otherRequests)
+		for req := range requests {
+			if req.Type == "keepalive@openssh.com" {
+				keepAlives <- req
+				continue
+			}
+			_ = req.Reply(false, nil)
+		}
+	}()
+	c := ssh.NewClient(sshConn, channels, otherRequests)
+	fwd, err := c.Dial("tcp", target.Addr().String())
+	require.NoError(t, err)
+	defer fwd.Close()
+
+	waitCtx, cancel := context.WithTimeout(ctx, testutil.WaitMedium)
+	defer cancel()
+	select {
+	case req := <-keepAlives:
+		require.True(t, req.WantReply)
+		require.NoError(t, req.Reply(false, nil))
+	case <-waitCtx.Done():
+		t.Fatal("timed out waiting for keepalive")
+	}
+
+	// The connection is closed if keepalives aren't answered.
+	select {
+	case <-keepAlives:
+	case <-waitCtx.Done():
+		t.Fatal("timed out waiting for keepalive")
+	}
+	closed := make(chan error, 1)
+	go func() {
+		closed <- sshConn.Wait()
+	}()
+	select {
+	case <-closed:
+	case <-waitCtx.Done():
+		t.Fatal("timed out waiting for the connection to be closed")
+	}
+
+	err = s.Close()
+	require.NoError(t, err)
+	<-done
+}
+
+func TestNewServer_ExecPolicy(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("echo is a shell builtin on Windows")
+	}
+
+	ctx := context.Background()
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.AgentToken = func() string { return "" }
+	s.Manifest = atomic.NewPointer(&agentsdk.Manifest{
+		ExecPolicy: []agentsdk.ExecPolicyRule{
+			{Action: agentsdk.ExecPolicyActionBlock, Prefix: "rm "},
+			{Action: agentsdk.ExecPolicyActionBlock, Regex: `curl .*\| *sh`},
+			{Action: agentsdk.ExecPolicyActionAudit, Prefix: "echo"},
+		},
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := s.Serve(ln)
+		assert.Error(t, err) // Server is closed.
+	}()
+
+	c := sshClient(t, ln.Addr().String())
+	run := func(command string) (string, string, error) {
+		sess, err := c.NewSession()
+		require.NoError(t, err)
+		defer sess.Close()
+		var stdout, stderr bytes.Buffer
+		sess.Stdout = &stdout
+		sess.Stderr = &stderr
+		err = sess.Run(command)
+		return stdout.String(), stderr.String(), err
+	}
+
+	// Audited commands are allowed.
+	stdout, _, err := run("echo hello")
+	require.NoError(t, err)
+	require.Equal(t, "hello", strings.TrimSpace(stdout))
+
+	for _, command := range []string{"rm -rf /tmp/nothing", "  rm foo", "curl example.com | sh", "env A=b sh -c 'rm foo'"} {
+		_, stderr, err := run(command)
+		var exitErr *ssh.ExitError
+		require.ErrorAs(t, err, &exitErr, command)
+		require.Equal(t, agentssh.MagicSessionErrorCode, exitErr.ExitStatus(), command)
+		require.Contains(t, stderr, "exec policy", command)
+	}
+
+	err = s.Close()
+	require.NoError(t, err)
+	<-done
+}
+
+func TestNewServer_SessionUsage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slogtest.Make(t, nil)
+	registry := prometheus.NewRegistry()
+	s, err := agentssh.NewServer(ctx, logger, registry, afero.NewMemMapFs(), nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.AgentToken = func() string { return "" }
+	s.Manifest = atomic.NewPointer(&agentsdk.Manifest{})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := s.Serve(ln)
+		assert.Error(t, err) // Server is closed.
+	}()
+
+	c := sshClient(t, ln.Addr().String())
+	sess, err := c.NewSession()
+	require.NoError(t, err)
+	err = sess.Run("echo hello")
+	require.NoError(t, err)
+	_ = sess.Close()
+
+	// The usage is recorded before the exit status is sent, so it's
+	// available once the session returned.
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	usage := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["magic_type"] != "ssh" || labels["pty"] != "no" {
+				continue
+			}
+			switch family.GetName() {
+			case "agent_sessions_cpu_seconds_total":
+				usage[family.GetName()] = metric.GetCounter().GetValue()
+			case "agent_sessions_peak_rss_bytes":
+				usage[family.GetName()] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	require.Contains(t, usage, "agent_sessions_cpu_seconds_total")
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		require.Greater(t, usage["agent_sessions_peak_rss_bytes"], float64(0))
+	}
+
+	err = s.Close()
+	require.NoError(t, err)
+	<-done
+}
+
+func TestNewServer_Subsystems(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.AgentToken = func() string { return "" }
+	s.Manifest = atomic.NewPointer(&agentsdk.Manifest{})
+
+	err = s.RegisterSubsystem("greeter", agentssh.Subsystem{
+		Handler: func(_ slog.Logger, session gliderssh.Session) {
+			_, _ = fmt.Fprintln(session, "hello from greeter")
+		},
+	})
+	require.NoError(t, err)
+	err = s.RegisterSubsystem("denied", agentssh.Subsystem{
+		Handler: func(slog.Logger, gliderssh.Session) {
+			t.Error("denied subsystem was served")
+		},
+		Policy: func(gliderssh.Session) error {
+			return xerrors.New("not allowed")
+		},
+	})
+	require.NoError(t, err)
+	// The built-in sftp subsystem can't be replaced.
+	err = s.RegisterSubsystem("sftp", agentssh.Subsystem{
+		Handler: func(slog.Logger, gliderssh.Session) {},
+	})
+	require.Error(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := s.Serve(ln)
+		assert.Error(t, err) // Server is closed.
+	}()
+
+	c := sshClient(t, ln.Addr().String())
+	requestSubsystem := func(name string) (string, error) {
+		sess, err := c.NewSession()
+		require.NoError(t, err)
+		defer sess.Close()
+		stdout, err := sess.StdoutPipe()
+		require.NoError(t, err)
+		err = sess.RequestSubsystem(name)
+		if err != nil {
+			return "", err
+		}
+		out, err := io.ReadAll(stdout)
+		return string(out), err
+	}
+
+	out, err := requestSubsystem("greeter")
+	require.NoError(t, err)
+	require.Equal(t, "hello from greeter", strings.TrimSpace(out))
+
+	_, err = requestSubsystem("denied")
+	require.Error(t, err)
+	_, err = requestSubsystem("unknown")
+	require.Error(t, err)
+
+	// Unregistered subsystems are no longer served.
+	s.UnregisterSubsystem("greeter")
+	_, err = requestSubsystem("greeter")
+	require.Error(t, err)
+
+	err = s.Close()
+	require.NoError(t, err)
+	<-done
+}
+
+func TestNewServer_AuthorizedKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slogtest.Make(t, nil)
+	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
+	require.NoError(t, err)
+	defer s.Close()
+	s.AgentToken = func() string { return "" }
+	s.Manifest = atomic.NewPointer(&agentsdk.Manifest{})
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	require.NoError(t, err)
+	authorizedKey := string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := s.Serve(ln)
+		assert.Error(t, err) // Server is closed.
+	}()
+
+	connect := func(user string, auth ...ssh.AuthMethod) error {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		sshConn, _, _, err := ssh.NewClientConn(conn, "localhost:22", &ssh.ClientConfig{
+			User:            user,
+			Auth:            auth,
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(), //nolint:gosec // This is a test.
+		})
+		if err != nil {
+			return err
+		}
+		return sshConn.Close()
+	}
+
+	err = s.SetAuthorizedKeys(agentsdk.AuthorizedKeysResponse{
+		Keys: []agentsdk.AuthorizedKey{
+			{PublicKey: authorizedKey, Principals: []string{"alice"}},
+			{PublicKey: "not a key"},
+		},
+	})
+	require.Error(t, err, "invalid keys are reported")
+	require.NoError(t, connect("bob"), "connections authenticated by coderd are accepted")
+	require.NoError(t, connect("alice", ssh.PublicKeys(signer)))
+
+	err = s.SetAuthorizedKeys(agentsdk.AuthorizedKeysResponse{
+		Keys:     []agentsdk.AuthorizedKey{{PublicKey: authorizedKey, Principals: []string{"alice"}}},
+		Required: true,
+	})
+	require.NoError(t, err)
+	require.Error(t, connect("alice"), "key is required")
+	require.Error(t, connect("bob", ssh.PublicKeys(signer)), "key is limited to alice")
+	require.NoError(t, connect("alice", ssh.PublicKeys(signer)))
+
+	err = s.Close()
+	require.NoError(t, err)
+	<-done
+}
+
+func TestNewServer_BruteForce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
+	require.NoError(t, err)
+	defer s.Close()
+	s.AgentToken = func() string { return "" }
+	s.Manifest = atomic.NewPointer(&agentsdk.Manifest{})
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	require.NoError(t, err)
+	err = s.SetAuthorizedKeys(agentsdk.AuthorizedKeysResponse{
+		Keys:     []agentsdk.AuthorizedKey{{PublicKey: string(ssh.MarshalAuthorizedKey(signer.PublicKey()))}},
+		Required: true,
+	})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := s.Serve(ln)
+		assert.Error(t, err) // Server is closed.
+	}()
+
+	connect := func(auth ...ssh.AuthMethod) error {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		sshConn, _, _, err := ssh.NewClientConn(conn, "localhost:22", &ssh.ClientConfig{
+			User:            "coder",
+			Auth:            auth,
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(), //nolint:gosec // This is a test.
+		})
+		if err != nil {
+			return err
+		}
+		return sshConn.Close()
+	}
+
+	_, otherPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherSigner, err := ssh.NewSignerFromKey(otherPrivateKey)
+	require.NoError(t, err)
+
+	require.NoError(t, connect(ssh.PublicKeys(signer)))
+	// Connections without keys fail, but aren't guessing keys.
+	for i := 0; i < 5; i++ {
+		require.Error(t, connect(), "key is required")
+	}
+	require.NoError(t, connect(ssh.PublicKeys(signer)))
+	for i := 0; i < 5; i++ {
+		require.Error(t, connect(ssh.PublicKeys(otherSigner)), "key isn't authorized")
+	}
+	// Clients see the failure before the server records it.
+	require.Eventually(t, func() bool {
+		return connect(ssh.PublicKeys(signer)) != nil
+	}, testutil.WaitShort, testutil.IntervalFast, "source is banned")
+
+	err = s.Close()
+	require.NoError(t, err)
+	<-done
+}
+
 func TestNewServer_ExecuteShebang(t *testing.T) {
 	t.Parallel()
 	if runtime.GOOS == "windows" {
@@ -83,7 +512,7 @@ func TestNewServer_ExecuteShebang(t *testing.T) {
 
 	ctx := context.Background()
 	logger := slogtest.Make(t, nil)
-	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), 0, "")
+	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
 	require.NoError(t, err)
 	t.Cleanup(func() {
 		_ = s.Close()
@@ -116,7 +545,7 @@ func TestNewServer_CloseActiveConnections(t *testing.T) {
 
 	ctx := context.Background()
 	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
-	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), 0, "")
+	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
 	require.NoError(t, err)
 	defer s.Close()
 
@@ -171,7 +600,7 @@ func TestNewServer_Signal(t *testing.T) {
 
 		ctx := context.Background()
 		logger := slogtest.Make(t, nil)
-		s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), 0, "")
+		s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
 		require.NoError(t, err)
 		defer s.Close()
 
@@ -240,7 +669,7 @@ func TestNewServer_Signal(t *testing.T) {
 
 		ctx := context.Background()
 		logger := slogtest.Make(t, nil)
-		s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), 0, "")
+		s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
 		require.NoError(t, err)
 		defer s.Close()
 
@@ -336,3 +765,39 @@ func sshClient(t *testing.T, addr string) *ssh.Client {
 	})
 	return c
 }
+
+//nolint:paralleltest // Sets HOME.
+func TestNewServer_LoginEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("login shells aren't supported on Windows")
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	// bash, zsh and sh read different profile files.
+	for _, name := range []string{".bash_profile", ".zprofile", ".profile"} {
+		err := os.WriteFile(filepath.Join(home, name), []byte("echo 'welcome'\nexport CODER_TEST_PROFILE=\"sourced by $0\"\n"), 0o600)
+		require.NoError(t, err)
+	}
+
+	ctx := context.Background()
+	logger := slogtest.Make(t, nil)
+	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	s.AgentToken = func() string { return "" }
+	s.Manifest = atomic.NewPointer(&agentsdk.Manifest{})
+
+	env, err := s.LoginEnv(ctx)
+	require.NoError(t, err)
+	var profile string
+	for _, kv := range env {
+		if value, ok := strings.CutPrefix(kv, "CODER_TEST_PROFILE="); ok {
+			profile = value
+		}
+		require.False(t, strings.HasPrefix(kv, "SHLVL="), kv)
+	}
+	require.True(t, strings.HasPrefix(profile, "sourced by"), profile)
+}
@@ -0,0 +1,111 @@
+package agentssh
+
+import (
+	"errors"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// ErrPublicKeyRequired is returned when a connection skips public key
+// authentication while the workspace owner requires it.
+var ErrPublicKeyRequired = xerrors.New("public key authentication required")
+
+type authorizedKey struct {
+	key        gossh.PublicKey
+	comment    string
+	principals []string
+}
+
+type authorizedKeys struct {
+	keys     []authorizedKey
+	required bool
+}
+
+// SetAuthorizedKeys replaces the public keys that may authenticate to the
+// server. Keys that fail to parse are skipped and returned as an error.
+func (s *Server) SetAuthorizedKeys(resp agentsdk.AuthorizedKeysResponse) error {
+	parsed := &authorizedKeys{
+		keys:     make([]authorizedKey, 0, len(resp.Keys)),
+		required: resp.Required,
+	}
+	var errs []error
+	for i, key := range resp.Keys {
+		publicKey, comment, _, _, err := gossh.ParseAuthorizedKey([]byte(key.PublicKey))
+		if err != nil {
+			errs = append(errs, xerrors.Errorf("parse authorized key %d: %w", i, err))
+			continue
+		}
+		parsed.keys = append(parsed.keys, authorizedKey{
+			key:        publicKey,
+			comment:    comment,
+			principals: key.Principals,
+		})
+	}
+	// Requiring a key without any valid keys would lock the owner out.
+	if len(parsed.keys) == 0 {
+		parsed.required = false
+	}
+	s.authorizedKeys.Store(parsed)
+	return errors.Join(errs...)
+}
+
+// hasAuthorizedKeys reports whether the owner authorized any public keys.
+func (s *Server) hasAuthorizedKeys() bool {
+	keys := s.authorizedKeys.Load()
+	return keys != nil && len(keys.keys) > 0
+}
+
+// AuthorizeWithoutKey returns ErrPublicKeyRequired if the owner requires a
+// key. Every session that's only authenticated by coderd, e.g. SSH without
+// client authentication, reconnecting PTYs and port forwarding, must be
+// authorized by it.
+func (s *Server) AuthorizeWithoutKey() error {
+	keys := s.authorizedKeys.Load()
+	if keys != nil && keys.required {
+		return ErrPublicKeyRequired
+	}
+	return nil
+}
+
+// noClientAuthCallback accepts connections without client authentication,
+// which are authenticated by coderd, unless the owner requires a key.
+func (s *Server) noClientAuthCallback(conn gossh.ConnMetadata) (*gossh.Permissions, error) {
+	err := s.AuthorizeWithoutKey()
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// publicKeyHandler accepts the authorized keys of the workspace owner, for
+// the usernames they're limited to.
+func (s *Server) publicKeyHandler(ctx ssh.Context, key ssh.PublicKey) bool {
+	keys := s.authorizedKeys.Load()
+	if keys == nil {
+		return false
+	}
+	for _, authorized := range keys.keys {
+		if !ssh.KeysEqual(key, authorized.key) {
+			continue
+		}
+		if len(authorized.principals) > 0 && !slices.Contains(authorized.principals, ctx.User()) {
+			s.logger.Warn(ctx, "authorized key not allowed for user",
+				slog.F("user", ctx.User()),
+				slog.F("key_comment", authorized.comment),
+				slog.F("fingerprint", gossh.FingerprintSHA256(key)))
+			return false
+		}
+		s.logger.Info(ctx, "authenticated with authorized key",
+			slog.F("user", ctx.User()),
+			slog.F("key_comment", authorized.comment),
+			slog.F("fingerprint", gossh.FingerprintSHA256(key)))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package agentssh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"cdr.dev/slog"
+)
+
+const (
+	// bruteForceMaxFailures is the number of connections failing to
+	// authenticate within bruteForceWindow after which a source is banned.
+	bruteForceMaxFailures = 5
+	bruteForceWindow      = 10 * time.Minute
+	// bruteForceBanDuration is how long connections from a banned source are
+	// refused.
+	bruteForceBanDuration = 15 * time.Minute
+)
+
+// bruteForceGuard bans sources that repeatedly fail to authenticate, like
+// fail2ban. Failures are counted per connection rather than per attempted
+// key, since clients offering several keys fail some attempts regardless.
+// Only public key authentication counts, clients try the "none" method
+// first, which fails whenever a key is required.
+type bruteForceGuard struct {
+	logger      slog.Logger
+	maxFailures int
+	window      time.Duration
+	banDuration time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]*bruteForceSource
+	// attempts are the open connections that failed to authenticate with a
+	// public key, by remote address.
+	attempts map[string]struct{}
+}
+
+type bruteForceSource struct {
+	// failures are the times of the failures within the window.
+	failures    []time.Time
+	bannedUntil time.Time
+}
+
+func newBruteForceGuard(logger slog.Logger) *bruteForceGuard {
+	return &bruteForceGuard{
+		logger:      logger,
+		maxFailures: bruteForceMaxFailures,
+		window:      bruteForceWindow,
+		banDuration: bruteForceBanDuration,
+		now:         time.Now,
+		sources:     make(map[string]*bruteForceSource),
+		attempts:    make(map[string]struct{}),
+	}
+}
+
+// sourceOf returns the host of the address, so all connections of a peer
+// count toward the same source.
+func sourceOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// isAuthFailure reports whether the handshake failed because the client
+// didn't authenticate, as opposed to a network error or a client that
+// disconnected before trying.
+func isAuthFailure(err error) bool {
+	var authErr *gossh.ServerAuthError
+	if errors.As(err, &authErr) {
+		return len(authErr.Errors) > 0
+	}
+	// The server disconnects clients exceeding MaxAuthTries with an error
+	// of an unexported type.
+	return err != nil && strings.Contains(err.Error(), "too many authentication failures")
+}
+
+// banned reports whether connections from the address are refused.
+func (g *bruteForceGuard) banned(addr net.Addr) bool {
+	source := sourceOf(addr)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.sources[source]
+	return ok && g.now().Before(s.bannedUntil)
+}
+
+// authAttempted records an authentication attempt of the connection from the
+// address.
+func (g *bruteForceGuard) authAttempted(addr net.Addr, method string, err error) {
+	g.mu.Lock()
+	if err != nil {
+		if method == "publickey" {
+			g.attempts[addr.String()] = struct{}{}
+		}
+		g.mu.Unlock()
+		return
+	}
+	delete(g.attempts, addr.String())
+	g.mu.Unlock()
+	if method == "publickey" {
+		g.succeeded(addr)
+	}
+}
+
+// connectionFailed records a connection from the address that failed, which
+// counts as a failure if it failed to authenticate with a public key.
+func (g *bruteForceGuard) connectionFailed(ctx context.Context, addr net.Addr, err error) {
+	g.mu.Lock()
+	_, attempted := g.attempts[addr.String()]
+	delete(g.attempts, addr.String())
+	g.mu.Unlock()
+	if attempted && isAuthFailure(err) {
+		g.failed(ctx, addr, err)
+	}
+}
+
+// failed records a connection from the address that failed to
+// authenticate, and bans the source once it failed too often.
+func (g *bruteForceGuard) failed(ctx context.Context, addr net.Addr, err error) {
+	source := sourceOf(addr)
+	now := g.now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pruneLocked(now)
+	s, ok := g.sources[source]
+	if !ok {
+		s = &bruteForceSource{}
+		g.sources[source] = s
+	}
+	s.failures = append(s.failures, now)
+	g.logger.Warn(ctx, "ssh authentication failed",
+		slog.F("source", source),
+		slog.F("failures", len(s.failures)),
+		slog.F("max_failures", g.maxFailures),
+		slog.Error(err))
+	if len(s.failures) < g.maxFailures {
+		return
+	}
+	s.failures = nil
+	s.bannedUntil = now.Add(g.banDuration)
+	g.logger.Warn(ctx, "banned ssh source after repeated authentication failures",
+		slog.F("source", source),
+		slog.F("window", g.window),
+		slog.F("ban_duration", g.banDuration),
+		slog.F("banned_until", s.bannedUntil))
+}
+
+// succeeded forgets the failures of a source once it authenticated, so
+// owners mistyping their key aren't banned eventually.
+func (g *bruteForceGuard) succeeded(addr net.Addr) {
+	source := sourceOf(addr)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if s, ok := g.sources[source]; ok && !g.now().Before(s.bannedUntil) {
+		delete(g.sources, source)
+	}
+}
+
+// pruneLocked drops failures outside of the window and expired bans.
+func (g *bruteForceGuard) pruneLocked(now time.Time) {
+	for source, s := range g.sources {
+		i := 0
+		for i < len(s.failures) && now.Sub(s.failures[i]) >= g.window {
+			i++
+		}
+		s.failures = s.failures[i:]
+		if len(s.failures) == 0 && !now.Before(s.bannedUntil) {
+			delete(g.sources, source)
+		}
+	}
+}
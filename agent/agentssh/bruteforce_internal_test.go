@@ -0,0 +1,96 @@
+package agentssh
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog/sloggers/slogtest"
+)
+
+func TestBruteForceGuard(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := newBruteForceGuard(slogtest.Make(t, nil))
+	g.now = func() time.Time { return now }
+	attacker := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 50000}
+	owner := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 50000}
+	authErr := &gossh.ServerAuthError{Errors: []error{gossh.ErrNoAuth}}
+
+	// Failures outside of the window are forgotten.
+	for i := 0; i < bruteForceMaxFailures-1; i++ {
+		g.failed(ctx, attacker, authErr)
+	}
+	now = now.Add(bruteForceWindow)
+	g.failed(ctx, attacker, authErr)
+	require.False(t, g.banned(attacker))
+
+	for i := 0; i < bruteForceMaxFailures-1; i++ {
+		// Connections from other ports of the same host count.
+		attacker.Port++
+		g.failed(ctx, attacker, authErr)
+	}
+	require.True(t, g.banned(attacker))
+	require.False(t, g.banned(owner))
+
+	// Authenticating doesn't lift a ban.
+	g.succeeded(attacker)
+	require.True(t, g.banned(attacker))
+	now = now.Add(bruteForceBanDuration)
+	require.False(t, g.banned(attacker))
+
+	// Authenticating forgets previous failures.
+	for i := 0; i < bruteForceMaxFailures-1; i++ {
+		g.failed(ctx, owner, authErr)
+	}
+	g.succeeded(owner)
+	g.failed(ctx, owner, authErr)
+	require.False(t, g.banned(owner))
+}
+
+func TestBruteForceGuard_Attempts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	g := newBruteForceGuard(slogtest.Make(t, nil))
+	source := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 50000}
+	authErr := &gossh.ServerAuthError{Errors: []error{gossh.ErrNoAuth}}
+	connect := func(method string) {
+		source.Port++
+		g.authAttempted(source, method, gossh.ErrNoAuth)
+		g.connectionFailed(ctx, source, authErr)
+	}
+
+	// Clients failing the "none" method aren't guessing keys.
+	for i := 0; i < bruteForceMaxFailures; i++ {
+		connect("none")
+	}
+	require.False(t, g.banned(source))
+
+	for i := 0; i < bruteForceMaxFailures-1; i++ {
+		connect("publickey")
+	}
+	// Authenticating with the "none" method doesn't forget failures.
+	g.authAttempted(source, "none", nil)
+	connect("publickey")
+	require.True(t, g.banned(source))
+	require.Empty(t, g.attempts)
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, isAuthFailure(&gossh.ServerAuthError{Errors: []error{gossh.ErrNoAuth}}))
+	require.True(t, isAuthFailure(xerrors.New("ssh: disconnect, reason 2: too many authentication failures")))
+	// Clients disconnecting before trying to authenticate, like port
+	// scanners, aren't counted.
+	require.False(t, isAuthFailure(&gossh.ServerAuthError{}))
+	require.False(t, isAuthFailure(xerrors.New("EOF")))
+}
@@ -0,0 +1,136 @@
+package agentssh
+
+import (
+	"strings"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+)
+
+// CryptoPreset names a set of key exchange algorithms, ciphers and MACs the
+// SSH server accepts.
+type CryptoPreset string
+
+const (
+	// CryptoPresetDefault accepts the defaults of golang.org/x/crypto/ssh.
+	CryptoPresetDefault CryptoPreset = "default"
+	// CryptoPresetModern only accepts Curve25519 and ECDH key exchanges,
+	// AEAD ciphers and encrypt-then-MAC MACs.
+	CryptoPresetModern CryptoPreset = "modern"
+	// CryptoPresetFIPS only accepts FIPS 140-2 approved algorithms, i.e. no
+	// Curve25519, ChaCha20-Poly1305 or SHA-1.
+	CryptoPresetFIPS CryptoPreset = "fips"
+)
+
+// CryptoPresets are the valid presets.
+var CryptoPresets = []CryptoPreset{CryptoPresetDefault, CryptoPresetModern, CryptoPresetFIPS}
+
+// Algorithms the server half of golang.org/x/crypto/ssh supports, in
+// preference order. Algorithms that are broken, e.g. arcfour, 3des-cbc and
+// diffie-hellman-group1-sha1, are left out so they can't be enabled.
+var (
+	supportedKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512", "diffie-hellman-group14-sha1",
+	}
+	supportedCiphers = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+	}
+	supportedMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512",
+		"hmac-sha1", "hmac-sha1-96",
+	}
+)
+
+var cryptoPresets = map[CryptoPreset]CryptoConfig{
+	// Empty lists use the defaults of golang.org/x/crypto/ssh.
+	CryptoPresetDefault: {},
+	CryptoPresetModern: {
+		KeyExchanges: []string{
+			"curve25519-sha256", "curve25519-sha256@libssh.org",
+			"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		},
+		Ciphers: []string{
+			"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+			"chacha20-poly1305@openssh.com",
+		},
+		MACs: []string{
+			"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		},
+	},
+	CryptoPresetFIPS: {
+		KeyExchanges: []string{
+			"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+			"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512",
+		},
+		Ciphers: []string{
+			"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+			"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		},
+		MACs: []string{
+			"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+			"hmac-sha2-256", "hmac-sha2-512",
+		},
+	},
+}
+
+// CryptoConfig restricts the algorithms the SSH server accepts, e.g. for
+// deployments that must comply with FIPS 140-2. Lists that are set replace
+// the lists of the preset.
+type CryptoConfig struct {
+	// Preset defaults to CryptoPresetDefault.
+	Preset       CryptoPreset
+	KeyExchanges []string
+	Ciphers      []string
+	MACs         []string
+}
+
+// Resolve returns the algorithms of the config, with the lists that aren't
+// set taken from its preset. Empty lists use the defaults of
+// golang.org/x/crypto/ssh. Unknown presets and algorithms the server doesn't
+// support are errors, since they'd otherwise only fail once clients connect.
+func (c CryptoConfig) Resolve() (CryptoConfig, error) {
+	preset := c.Preset
+	if preset == "" {
+		preset = CryptoPresetDefault
+	}
+	resolved, ok := cryptoPresets[preset]
+	if !ok {
+		return CryptoConfig{}, xerrors.Errorf("unknown SSH crypto preset %q, must be one of %v", c.Preset, CryptoPresets)
+	}
+	resolved.Preset = preset
+	for _, list := range []struct {
+		name      string
+		set       []string
+		supported []string
+		resolved  *[]string
+	}{
+		{"key exchange algorithm", c.KeyExchanges, supportedKeyExchanges, &resolved.KeyExchanges},
+		{"cipher", c.Ciphers, supportedCiphers, &resolved.Ciphers},
+		{"MAC", c.MACs, supportedMACs, &resolved.MACs},
+	} {
+		if len(list.set) == 0 {
+			continue
+		}
+		for _, algorithm := range list.set {
+			if !slices.Contains(list.supported, algorithm) {
+				return CryptoConfig{}, xerrors.Errorf("unsupported SSH %s %q, must be one of %s",
+					list.name, algorithm, strings.Join(list.supported, ", "))
+			}
+		}
+		*list.resolved = list.set
+	}
+	return resolved, nil
+}
+
+// apply restricts the algorithms of the server config.
+func (c CryptoConfig) apply(config *gossh.ServerConfig) {
+	config.KeyExchanges = c.KeyExchanges
+	config.Ciphers = c.Ciphers
+	config.MACs = c.MACs
+}
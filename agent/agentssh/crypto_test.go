@@ -0,0 +1,121 @@
+package agentssh_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"golang.org/x/crypto/ssh"
+
+	"cdr.dev/slog/sloggers/slogtest"
+
+	"github.com/coder/coder/v2/agent/agentssh"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+func TestCryptoConfig_Resolve(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Default", func(t *testing.T) {
+		t.Parallel()
+		resolved, err := agentssh.CryptoConfig{}.Resolve()
+		require.NoError(t, err)
+		require.Equal(t, agentssh.CryptoPresetDefault, resolved.Preset)
+		require.Empty(t, resolved.KeyExchanges)
+		require.Empty(t, resolved.Ciphers)
+		require.Empty(t, resolved.MACs)
+	})
+
+	t.Run("FIPS", func(t *testing.T) {
+		t.Parallel()
+		resolved, err := agentssh.CryptoConfig{Preset: agentssh.CryptoPresetFIPS}.Resolve()
+		require.NoError(t, err)
+		require.NotContains(t, resolved.KeyExchanges, "curve25519-sha256")
+		require.NotContains(t, resolved.Ciphers, "chacha20-poly1305@openssh.com")
+		require.NotContains(t, resolved.MACs, "hmac-sha1")
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		t.Parallel()
+		resolved, err := agentssh.CryptoConfig{
+			Preset:  agentssh.CryptoPresetFIPS,
+			Ciphers: []string{"aes256-gcm@openssh.com"},
+		}.Resolve()
+		require.NoError(t, err)
+		require.Equal(t, []string{"aes256-gcm@openssh.com"}, resolved.Ciphers)
+		require.NotEmpty(t, resolved.KeyExchanges)
+	})
+
+	t.Run("UnknownPreset", func(t *testing.T) {
+		t.Parallel()
+		_, err := agentssh.CryptoConfig{Preset: "legacy"}.Resolve()
+		require.ErrorContains(t, err, `unknown SSH crypto preset "legacy"`)
+	})
+
+	t.Run("UnsupportedAlgorithm", func(t *testing.T) {
+		t.Parallel()
+		_, err := agentssh.CryptoConfig{Ciphers: []string{"arcfour"}}.Resolve()
+		require.ErrorContains(t, err, `unsupported SSH cipher "arcfour"`)
+	})
+}
+
+func TestNewServer_Crypto(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := slogtest.Make(t, nil)
+	_, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), &agentssh.Config{
+		Crypto: agentssh.CryptoConfig{MACs: []string{"hmac-md5"}},
+	})
+	require.ErrorContains(t, err, `unsupported SSH MAC "hmac-md5"`)
+
+	s, err := agentssh.NewServer(ctx, logger, prometheus.NewRegistry(), afero.NewMemMapFs(), &agentssh.Config{
+		Crypto: agentssh.CryptoConfig{Preset: agentssh.CryptoPresetFIPS},
+	})
+	require.NoError(t, err)
+	defer s.Close()
+	s.AgentToken = func() string { return "" }
+	s.Manifest = atomic.NewPointer(&agentsdk.Manifest{})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := s.Serve(ln)
+		assert.Error(t, err) // Server is closed.
+	}()
+
+	dial := func(config ssh.Config) error {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		sshConn, _, _, err := ssh.NewClientConn(conn, "localhost:22", &ssh.ClientConfig{
+			Config:          config,
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(), //nolint:gosec // This is a test.
+		})
+		if err != nil {
+			return err
+		}
+		return sshConn.Close()
+	}
+
+	// Clients that only offer algorithms outside of the preset are refused.
+	err = dial(ssh.Config{KeyExchanges: []string{"curve25519-sha256"}})
+	require.ErrorContains(t, err, "no common algorithm for key exchange")
+	err = dial(ssh.Config{Ciphers: []string{"chacha20-poly1305@openssh.com"}})
+	require.ErrorContains(t, err, "no common algorithm for client to server cipher")
+	require.NoError(t, dial(ssh.Config{
+		KeyExchanges: []string{"ecdh-sha2-nistp256"},
+		Ciphers:      []string{"aes256-gcm@openssh.com"},
+	}))
+
+	err = s.Close()
+	require.NoError(t, err)
+	<-done
+}
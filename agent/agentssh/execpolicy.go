@@ -0,0 +1,483 @@
+package agentssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// ErrCommandBlocked is returned when a command is rejected by the exec
+// policy of the workspace.
+var ErrCommandBlocked = xerrors.New("command blocked by exec policy")
+
+// Sources of commands the exec policy is enforced for, besides SSH
+// sessions, which are labeled by their magic type.
+const (
+	ExecPolicySourceReconnectingPTY = "reconnecting_pty"
+	ExecPolicySourceScheduledTask   = "scheduled_task"
+)
+
+// execPolicy is the exec policy of a manifest, with its regular
+// expressions compiled once rather than for every command.
+type execPolicy struct {
+	manifest *agentsdk.Manifest
+	rules    []execPolicyRule
+}
+
+type execPolicyRule struct {
+	agentsdk.ExecPolicyRule
+	regex *regexp.Regexp
+	// invalid is set if the regex doesn't compile.
+	invalid bool
+}
+
+func compileExecPolicy(rules []agentsdk.ExecPolicyRule) []execPolicyRule {
+	compiled := make([]execPolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		r := execPolicyRule{ExecPolicyRule: rule}
+		if rule.Regex != "" {
+			re, err := regexp.Compile(rule.Regex)
+			r.regex, r.invalid = re, err != nil
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled
+}
+
+// matches returns whether the rule matches any of the forms of a command.
+// A rule without a prefix and a regex matches every command. A rule with
+// an invalid regular expression fails closed: it matches every command,
+// unless it allows them.
+func (r execPolicyRule) matches(forms ...string) bool {
+	if r.invalid {
+		return r.Action != agentsdk.ExecPolicyActionAllow
+	}
+	for _, form := range forms {
+		if r.Prefix != "" && !strings.HasPrefix(form, r.Prefix) {
+			continue
+		}
+		if r.regex != nil && !r.regex.MatchString(form) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// execPolicyResult is the outcome of evaluating the exec policy for a
+// command.
+type execPolicyResult struct {
+	blocked bool
+	// matched are the rules that decided or audited the command.
+	matched []agentsdk.ExecPolicyRule
+	// reason is set if the command was blocked because it couldn't be
+	// evaluated.
+	reason string
+}
+
+// evaluateExecPolicy evaluates the rules for every simple command the
+// command executes, see simpleCommands. The first allow or block rule
+// matching a simple command decides it, and the command is blocked if any
+// of its simple commands is. Commands no rule decides are allowed, so an
+// allowlist ends with a block rule matching every command. Audit rules
+// only log the commands they match.
+//
+// Rules with a prefix or a regex are also evaluated for the whole command,
+// so they can match pipelines, e.g. `curl .*\| *sh`.
+func evaluateExecPolicy(rules []execPolicyRule, command string) execPolicyResult {
+	command = strings.TrimSpace(command)
+	var result execPolicyResult
+	matched := make([]bool, len(rules))
+	decide := func(matchAll bool, forms ...string) {
+		for i, rule := range rules {
+			if !matchAll && rule.Prefix == "" && rule.Regex == "" {
+				continue
+			}
+			if !rule.matches(forms...) {
+				continue
+			}
+			matched[i] = true
+			switch rule.Action {
+			case agentsdk.ExecPolicyActionBlock:
+				result.blocked = true
+				return
+			case agentsdk.ExecPolicyActionAllow:
+				return
+			}
+		}
+	}
+
+	decide(false, command)
+	commands, err := simpleCommands(command)
+	if err != nil {
+		result.blocked = true
+		result.reason = err.Error()
+	}
+	for _, forms := range commands {
+		decide(true, forms...)
+	}
+	for i, rule := range rules {
+		if matched[i] {
+			result.matched = append(result.matched, rule.ExecPolicyRule)
+		}
+	}
+	return result
+}
+
+// CheckExecPolicy enforces the exec policy of the manifest for a command a
+// user executes, e.g. over SSH or as a scheduled task. Audited commands are
+// logged, blocked commands are reported to stderr if it isn't nil and
+// ErrCommandBlocked is returned. Source labels the metrics of the policy.
+func (s *Server) CheckExecPolicy(ctx context.Context, logger slog.Logger, source, command string, stderr io.Writer) error {
+	manifest := s.Manifest.Load()
+	if manifest == nil || len(manifest.ExecPolicy) == 0 || strings.TrimSpace(command) == "" {
+		return nil
+	}
+	policy := s.execPolicy.Load()
+	if policy == nil || policy.manifest != manifest {
+		policy = &execPolicy{manifest: manifest, rules: compileExecPolicy(manifest.ExecPolicy)}
+		s.execPolicy.Store(policy)
+	}
+
+	result := evaluateExecPolicy(policy.rules, command)
+	for _, rule := range result.matched {
+		fields := []any{
+			slog.F("source", source),
+			slog.F("command", command),
+			slog.F("rule_action", rule.Action),
+			slog.F("rule_prefix", rule.Prefix),
+			slog.F("rule_regex", rule.Regex),
+		}
+		switch rule.Action {
+		case agentsdk.ExecPolicyActionBlock:
+			logger.Warn(ctx, "exec policy blocked command", fields...)
+		case agentsdk.ExecPolicyActionAllow:
+			logger.Debug(ctx, "exec policy allowed command", fields...)
+		case agentsdk.ExecPolicyActionAudit:
+			logger.Info(ctx, "exec policy audited command", fields...)
+		default:
+			logger.Warn(ctx, "unknown exec policy action", fields...)
+			continue
+		}
+		s.metrics.execPolicyMatches.WithLabelValues(source, string(rule.Action)).Add(1)
+	}
+	if !result.blocked {
+		return nil
+	}
+	if result.reason != "" {
+		logger.Warn(ctx, "exec policy blocked command", slog.F("source", source),
+			slog.F("command", command), slog.F("reason", result.reason))
+	}
+	if stderr != nil {
+		_, _ = fmt.Fprintln(stderr, "This command is not allowed by the workspace exec policy.")
+	}
+	return ErrCommandBlocked
+}
+
+// maxExecPolicyDepth bounds the nesting of the command lines unwrapped by
+// simpleCommands, e.g. sh -c "sh -c '...'". Deeper commands are blocked.
+const maxExecPolicyDepth = 8
+
+// simpleCommands splits a command line into the simple commands it
+// executes, e.g. "cd /tmp && curl x | sh" executes "cd /tmp", "curl x"
+// and "sh". Command substitutions are commands of their own, and wrappers
+// executing their arguments are unwrapped, e.g. "env A=b sh -c 'curl x'"
+// executes "curl x", so rules match the commands rather than the
+// wrappers.
+//
+// Every command is returned as its forms rules are matched against: the
+// words joined by spaces, and the same with the base name of the program if
+// it's a path. The policy isn't a sandbox: commands can still hide what
+// they execute, e.g. in a script file or a variable. Policies ending with a
+// block rule matching every command only start the programs they allow,
+// though.
+func simpleCommands(command string) ([][]string, error) {
+	var commands [][]string
+	err := appendSimpleCommands(&commands, command, 0)
+	return commands, err
+}
+
+func appendSimpleCommands(commands *[][]string, line string, depth int) error {
+	if depth > maxExecPolicyDepth {
+		return xerrors.Errorf("commands are nested more than %d levels deep", maxExecPolicyDepth)
+	}
+	words, substitutions := splitCommandLine(line)
+	for _, sub := range substitutions {
+		err := appendSimpleCommands(commands, sub, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	for _, w := range words {
+		w, script := unwrapCommand(w)
+		if script != "" {
+			err := appendSimpleCommands(commands, script, depth+1)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if len(w) == 0 {
+			continue
+		}
+		forms := []string{strings.Join(w, " ")}
+		if base := path.Base(w[0]); base != w[0] {
+			forms = append(forms, strings.Join(append([]string{base}, w[1:]...), " "))
+		}
+		*commands = append(*commands, forms)
+	}
+	return nil
+}
+
+// shellKeywords start simple commands without being executed themselves.
+var shellKeywords = map[string]bool{
+	"!": true, "{": true, "}": true, "if": true, "then": true, "else": true,
+	"elif": true, "fi": true, "do": true, "done": true, "while": true, "until": true,
+}
+
+// commandWrappers execute their arguments as a command. They're mapped to
+// their options taking a separate value.
+var commandWrappers = map[string][]string{
+	"builtin": nil,
+	"busybox": nil,
+	"command": nil,
+	"doas":    {"-u", "-C"},
+	"env":     {"-u", "--unset", "-C", "--chdir"},
+	"exec":    {"-a"},
+	"nice":    {"-n", "--adjustment"},
+	"nohup":   nil,
+	"setsid":  nil,
+	"stdbuf":  {"-i", "-o", "-e", "--input", "--output", "--error"},
+	"sudo":    {"-u", "--user", "-g", "--group", "-C", "--close-from", "-D", "--chdir", "-h", "--host", "-p", "--prompt", "-r", "--role", "-t", "--type", "-U", "--other-user"},
+	"time":    {"-f", "--format", "-o", "--output"},
+	"timeout": {"-k", "--kill-after", "-s", "--signal"},
+	"xargs":   {"-a", "--arg-file", "-d", "--delimiter", "-E", "-I", "-L", "-n", "--max-args", "-P", "--max-procs", "-s", "--max-chars"},
+}
+
+// shells execute the command line following their -c option.
+var shells = map[string]bool{
+	"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true,
+	"mksh": true, "ash": true, "fish": true,
+}
+
+// unwrapCommand strips variable assignments, keywords and wrappers from
+// the words of a simple command. If the command executes a command line,
+// e.g. sh -c or eval, the command line is returned instead.
+func unwrapCommand(words []string) ([]string, string) {
+	for len(words) > 0 {
+		if shellKeywords[words[0]] || isAssignment(words[0]) {
+			words = words[1:]
+			continue
+		}
+		name := path.Base(words[0])
+		switch {
+		case name == "for" || name == "case" || name == "select" || name == "function":
+			// The words of these keywords aren't commands.
+			return nil, ""
+		case name == "eval":
+			return nil, strings.Join(words[1:], " ")
+		case shells[name]:
+			return unwrapShell(words)
+		}
+		valueOptions, ok := commandWrappers[name]
+		if !ok {
+			return words, ""
+		}
+		words = words[1:]
+		for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+			option := words[0]
+			words = words[1:]
+			if option == "--" {
+				break
+			}
+			if name == "env" && (option == "-S" || option == "--split-string") && len(words) > 0 {
+				// The value is split into the command and its arguments.
+				return nil, strings.Join(words, " ")
+			}
+			for _, o := range valueOptions {
+				if option == o && len(words) > 0 {
+					words = words[1:]
+					break
+				}
+			}
+		}
+		if name == "timeout" && len(words) > 0 {
+			// The duration precedes the command.
+			words = words[1:]
+		}
+	}
+	return nil, ""
+}
+
+// unwrapShell returns the command line a shell executes with -c, or the
+// words of the shell if it executes a script file or its input.
+func unwrapShell(words []string) ([]string, string) {
+	command := false
+	i := 1
+	for ; i < len(words); i++ {
+		option := words[i]
+		if option == "--" || option == "-" {
+			i++
+			break
+		}
+		if !strings.HasPrefix(option, "-") && !strings.HasPrefix(option, "+") {
+			break
+		}
+		switch option {
+		case "-o", "+o", "-O", "+O", "--rcfile", "--init-file":
+			i++
+			continue
+		}
+		if !strings.HasPrefix(option, "--") && strings.ContainsRune(option[1:], 'c') {
+			command = true
+		}
+	}
+	if !command {
+		return words, ""
+	}
+	if i >= len(words) {
+		return nil, ""
+	}
+	return nil, words[i]
+}
+
+var assignmentRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\+?=`)
+
+func isAssignment(word string) bool {
+	return assignmentRegex.MatchString(word)
+}
+
+// splitCommandLine splits a shell command line into the words of its
+// simple commands, and returns the command lines of its command
+// substitutions. Quotes and escapes are removed, variables and command
+// substitutions are kept as they are.
+func splitCommandLine(line string) ([][]string, []string) {
+	var (
+		commands      [][]string
+		substitutions []string
+		words         []string
+		word          strings.Builder
+		inWord        bool
+	)
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			commands = append(commands, words)
+			words = nil
+		}
+	}
+	// substitution returns the command line of the substitution starting
+	// at i, and the index of its last character.
+	substitution := func(i int) (string, int) {
+		if line[i] == '`' {
+			end := strings.IndexByte(line[i+1:], '`')
+			if end < 0 {
+				return line[i+1:], len(line) - 1
+			}
+			return line[i+1 : i+1+end], i + 1 + end
+		}
+		depth := 0
+		for j := i + 2; j < len(line); j++ {
+			switch line[j] {
+			case '(':
+				depth++
+			case ')':
+				if depth == 0 {
+					return line[i+2 : j], j
+				}
+				depth--
+			}
+		}
+		return line[i+2:], len(line) - 1
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\':
+			if i+1 < len(line) {
+				i++
+				if line[i] != '\n' {
+					word.WriteByte(line[i])
+					inWord = true
+				}
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				end = len(line) - i - 1
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+		case strings.HasPrefix(line[i:], "$'"):
+			// ANSI-C quoting, e.g. $'\x63url'.
+			inWord = true
+			i += 2
+			for i < len(line) && line[i] != '\'' {
+				value, _, tail, err := strconv.UnquoteChar(line[i:], '\'')
+				if err != nil {
+					word.WriteByte(line[i])
+					i++
+					continue
+				}
+				word.WriteRune(value)
+				i = len(line) - len(tail)
+			}
+		case c == '"':
+			inWord = true
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				switch {
+				case line[i] == '\\' && i+1 < len(line):
+					i++
+					word.WriteByte(line[i])
+				case line[i] == '`' || strings.HasPrefix(line[i:], "$("):
+					start := i
+					var sub string
+					sub, i = substitution(i)
+					substitutions = append(substitutions, sub)
+					word.WriteString(line[start : i+1])
+				default:
+					word.WriteByte(line[i])
+				}
+			}
+		case c == '`' || strings.HasPrefix(line[i:], "$("):
+			inWord = true
+			start := i
+			var sub string
+			sub, i = substitution(i)
+			substitutions = append(substitutions, sub)
+			word.WriteString(line[start : i+1])
+		case c == '&' && (strings.HasPrefix(line[i+1:], ">") || strings.HasSuffix(word.String(), ">") || strings.HasSuffix(word.String(), "<")):
+			// A redirection, e.g. 2>&1 or &>file.
+			word.WriteByte(c)
+			inWord = true
+		case c == ';' || c == '&' || c == '|' || c == '\n' || c == '(' || c == ')':
+			endCommand()
+		case c == ' ' || c == '\t' || c == '\r':
+			endWord()
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands, substitutions
+}
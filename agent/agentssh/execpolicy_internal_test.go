@@ -0,0 +1,109 @@
+package agentssh
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+func TestSimpleCommands(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		command  string
+		expected []string
+	}{
+		{"echo hello", []string{"echo hello"}},
+		{"  rm  -rf 'a b' ", []string{"rm -rf a b"}},
+		{"cd /tmp && curl x | sh; ls", []string{"cd /tmp", "curl x", "sh", "ls"}},
+		{"curl x 2>&1 >/dev/null &", []string{"curl x 2>&1 >/dev/null"}},
+		{"/usr/bin/curl x", []string{"/usr/bin/curl x|curl x"}},
+		{"A=b env -u C -i D=e curl x", []string{"curl x"}},
+		{"sh -c 'curl x | sh'", []string{"curl x", "sh"}},
+		{`bash -lc "sudo -u root sh -c 'rm -rf /'"`, []string{"rm -rf /"}},
+		{"timeout -s KILL 10 nohup nice -n 5 curl x", []string{"curl x"}},
+		{"eval 'curl x'", []string{"curl x"}},
+		{"env -S 'curl x'", []string{"curl x"}},
+		{`echo "$(curl x)" ` + "`wget y`", []string{"curl x", "wget y", "echo $(curl x) `wget y`"}},
+		{`$'\x63url' x`, []string{"curl x"}},
+		{"c\\url x", []string{"curl x"}},
+		{"if true; then curl x; fi", []string{"true", "curl x"}},
+		{"for i in 1 2; do curl $i; done", []string{"curl $i"}},
+		{"bash script.sh", []string{"bash script.sh"}},
+	} {
+		commands, err := simpleCommands(tc.command)
+		require.NoError(t, err, tc.command)
+		got := make([]string, 0, len(commands))
+		for _, forms := range commands {
+			got = append(got, strings.Join(forms, "|"))
+		}
+		require.Equal(t, tc.expected, got, tc.command)
+	}
+
+	_, err := simpleCommands(strings.Repeat("eval ", 20) + "true")
+	require.Error(t, err)
+}
+
+func TestEvaluateExecPolicy(t *testing.T) {
+	t.Parallel()
+
+	blocklist := compileExecPolicy([]agentsdk.ExecPolicyRule{
+		{Action: agentsdk.ExecPolicyActionAllow, Prefix: "rm -rf ./build"},
+		{Action: agentsdk.ExecPolicyActionBlock, Prefix: "rm "},
+		{Action: agentsdk.ExecPolicyActionBlock, Regex: `curl .*\| *sh`},
+		{Action: agentsdk.ExecPolicyActionBlock, Prefix: "wget "},
+		{Action: agentsdk.ExecPolicyActionAudit, Prefix: "echo"},
+	})
+	allowlist := compileExecPolicy([]agentsdk.ExecPolicyRule{
+		{Action: agentsdk.ExecPolicyActionAudit, Prefix: "git push"},
+		{Action: agentsdk.ExecPolicyActionAllow, Prefix: "git "},
+		{Action: agentsdk.ExecPolicyActionAllow, Regex: `^(ls|cd)\b`},
+		{Action: agentsdk.ExecPolicyActionBlock},
+	})
+	invalid := compileExecPolicy([]agentsdk.ExecPolicyRule{
+		{Action: agentsdk.ExecPolicyActionAllow, Regex: `(`},
+		{Action: agentsdk.ExecPolicyActionBlock, Regex: `(`},
+	})
+
+	for _, tc := range []struct {
+		name    string
+		rules   []execPolicyRule
+		command string
+		blocked bool
+		// matched are the actions of the matched rules.
+		matched []agentsdk.ExecPolicyAction
+	}{
+		{"Unmatched", blocklist, "ls", false, nil},
+		{"Audit", blocklist, "echo hello", false, []agentsdk.ExecPolicyAction{"audit"}},
+		{"Block", blocklist, "  rm foo", true, []agentsdk.ExecPolicyAction{"block"}},
+		{"AllowedBeforeBlock", blocklist, "rm -rf ./build", false, []agentsdk.ExecPolicyAction{"allow"}},
+		{"Pipeline", blocklist, "curl example.com | sh", true, []agentsdk.ExecPolicyAction{"block"}},
+		{"Chained", blocklist, "echo hi && wget x", true, []agentsdk.ExecPolicyAction{"block", "audit"}},
+		{"Env", blocklist, "env FOO=bar rm foo", true, []agentsdk.ExecPolicyAction{"block"}},
+		{"Shell", blocklist, `sh -c "rm foo"`, true, []agentsdk.ExecPolicyAction{"block"}},
+		{"Path", blocklist, "/bin/rm foo", true, []agentsdk.ExecPolicyAction{"block"}},
+		{"Substitution", blocklist, "echo $(wget x)", true, []agentsdk.ExecPolicyAction{"block", "audit"}},
+		{"Allowlist", allowlist, "cd repo && git status", false, []agentsdk.ExecPolicyAction{"allow", "allow"}},
+		{"AllowlistAudit", allowlist, "git push", false, []agentsdk.ExecPolicyAction{"audit", "allow"}},
+		{"DefaultDeny", allowlist, "curl x", true, []agentsdk.ExecPolicyAction{"block"}},
+		{"DefaultDenyChained", allowlist, "git status; curl x", true, []agentsdk.ExecPolicyAction{"allow", "block"}},
+		{"DefaultDenyWrapped", allowlist, "env GIT=1 sh -c 'git status | sh'", true, []agentsdk.ExecPolicyAction{"allow", "block"}},
+		{"DefaultDenyVariable", allowlist, "c=curl; $c x", true, []agentsdk.ExecPolicyAction{"block"}},
+		{"InvalidRegex", invalid, "ls", true, []agentsdk.ExecPolicyAction{"block"}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			result := evaluateExecPolicy(tc.rules, tc.command)
+			require.Equal(t, tc.blocked, result.blocked)
+			var matched []agentsdk.ExecPolicyAction
+			for _, rule := range result.matched {
+				matched = append(matched, rule.Action)
+			}
+			require.Equal(t, tc.matched, matched)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package agentssh
+
+import (
+	"context"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+)
+
+// keepAliveRequestType is the global request sent to keep connections alive.
+// OpenSSH and x/crypto clients reply to it, even if only with a failure.
+const keepAliveRequestType = "keepalive@openssh.com"
+
+// defaultKeepAliveCountMax is the number of unanswered keepalive requests
+// after which a connection is closed, unless the manifest sets one.
+const defaultKeepAliveCountMax = 3
+
+type keepAliveContextKey struct{}
+
+// withKeepAlive wraps a channel handler to start the keepalive of the
+// connection with its first channel.
+func (s *Server) withKeepAlive(handler ssh.ChannelHandler) ssh.ChannelHandler {
+	return func(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+		s.startKeepAlive(ctx, conn)
+		handler(srv, conn, newChan, ctx)
+	}
+}
+
+// startKeepAlive sends keepalive requests on the connection if the manifest
+// configures them. Session keepalives only cover connections with an open
+// session, this also covers connections that only forward ports, like the
+// ones of IDEs, which NAT gateways and firewalls otherwise drop silently
+// when they are idle.
+func (s *Server) startKeepAlive(ctx ssh.Context, conn *gossh.ServerConn) {
+	manifest := s.Manifest.Load()
+	if manifest == nil || manifest.SSHKeepAlive == nil || manifest.SSHKeepAlive.IntervalSeconds <= 0 {
+		return
+	}
+	interval := time.Duration(manifest.SSHKeepAlive.IntervalSeconds) * time.Second
+	countMax := manifest.SSHKeepAlive.CountMax
+	if countMax <= 0 {
+		countMax = defaultKeepAliveCountMax
+	}
+
+	ctx.Lock()
+	started := ctx.Value(keepAliveContextKey{}) != nil
+	if !started {
+		ctx.SetValue(keepAliveContextKey{}, true)
+	}
+	ctx.Unlock()
+	if started {
+		return
+	}
+
+	go func() {
+		err := keepConnAlive(ctx, conn, interval, countMax)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Info(ctx, "ssh connection keepalive failed",
+				slog.F("remote_addr", conn.RemoteAddr()),
+				slog.Error(err))
+		}
+	}()
+}
+
+// keepConnAlive sends a keepalive request every interval until ctx is done
+// or the connection is closed. The connection is closed if no reply was
+// received for countMax intervals.
+func keepConnAlive(ctx context.Context, conn gossh.Conn, interval time.Duration, countMax int) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// At most one request is in flight, so the reply never blocks.
+	replies := make(chan error, 1)
+	inFlight := false
+	missed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-replies:
+			inFlight = false
+			if err != nil {
+				return xerrors.Errorf("send keepalive: %w", err)
+			}
+			missed = 0
+		case <-ticker.C:
+			if inFlight {
+				missed++
+				if missed >= countMax {
+					_ = conn.Close()
+					return xerrors.Errorf("no reply to %d keepalive requests", missed)
+				}
+				continue
+			}
+			inFlight = true
+			go func() {
+				_, _, err := conn.SendRequest(keepAliveRequestType, true, nil)
+				replies <- err
+			}()
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package agentssh
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// LoginEnv returns the environment of a login shell of the user, i.e. after
+// the shell sourced the profile files of the user. It works with any shell
+// that accepts commands on stdin, e.g. bash, zsh and fish.
+func (s *Server) LoginEnv(ctx context.Context) ([]string, error) {
+	if runtime.GOOS == "windows" {
+		return nil, xerrors.New("login shells aren't supported on Windows")
+	}
+	dir, err := os.MkdirTemp("", "coder-login-env-")
+	if err != nil {
+		return nil, xerrors.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	envPath := filepath.Join(dir, "env")
+
+	// Without a script, the user's shell is started as a login shell.
+	cmdPty, err := s.CreateCommand(ctx, "", nil)
+	if err != nil {
+		return nil, xerrors.Errorf("create login shell: %w", err)
+	}
+	cmd := cmdPty.AsExec()
+	// Profile files may print to stdout, so the environment is written to a
+	// file instead. The syntax is the same in POSIX shells and fish.
+	cmd.Stdin = strings.NewReader("env -0 > '" + envPath + "'\nexit\n")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, xerrors.Errorf("run login shell: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	data, err := os.ReadFile(envPath)
+	if err != nil {
+		return nil, xerrors.Errorf("read login shell environment: %w", err)
+	}
+	env := strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+	// Variables of the shell session itself don't apply to other commands.
+	filtered := env[:0]
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		switch name {
+		case "", "_", "PWD", "OLDPWD", "SHLVL":
+			continue
+		}
+		filtered = append(filtered, kv)
+	}
+	return filtered, nil
+}
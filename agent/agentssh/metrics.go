@@ -8,11 +8,15 @@ import (
 
 type sshServerMetrics struct {
 	failedConnectionsTotal prometheus.Counter
+	bannedConnectionsTotal prometheus.Counter
 	sftpConnectionsTotal   prometheus.Counter
 	sftpServerErrors       prometheus.Counter
 	x11HandlerErrors       *prometheus.CounterVec
 	sessionsTotal          *prometheus.CounterVec
 	sessionErrors          *prometheus.CounterVec
+	execPolicyMatches      *prometheus.CounterVec
+	sessionCPUSeconds      *prometheus.CounterVec
+	sessionPeakRSSBytes    *prometheus.GaugeVec
 }
 
 func newSSHServerMetrics(registerer prometheus.Registerer) *sshServerMetrics {
@@ -21,6 +25,11 @@ func newSSHServerMetrics(registerer prometheus.Registerer) *sshServerMetrics {
 	})
 	registerer.MustRegister(failedConnectionsTotal)
 
+	bannedConnectionsTotal := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "agent", Subsystem: "ssh_server", Name: "banned_connections_total",
+	})
+	registerer.MustRegister(bannedConnectionsTotal)
+
 	sftpConnectionsTotal := prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "agent", Subsystem: "ssh_server", Name: "sftp_connections_total",
 	})
@@ -61,13 +70,50 @@ func newSSHServerMetrics(registerer prometheus.Registerer) *sshServerMetrics {
 	)
 	registerer.MustRegister(sessionErrors)
 
+	execPolicyMatches := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "agent",
+			Subsystem: "sessions",
+			Name:      "exec_policy_matches_total",
+			Help:      "Exec policy rules matching commands, by the source of the command and the action of the rule.",
+		},
+		[]string{"source", "action"},
+	)
+	registerer.MustRegister(execPolicyMatches)
+
+	sessionCPUSeconds := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "agent",
+			Subsystem: "sessions",
+			Name:      "cpu_seconds_total",
+			Help:      "CPU time used by the process trees of finished sessions.",
+		},
+		[]string{"magic_type", "pty"},
+	)
+	registerer.MustRegister(sessionCPUSeconds)
+
+	sessionPeakRSSBytes := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "agent",
+			Subsystem: "sessions",
+			Name:      "peak_rss_bytes",
+			Help:      "Largest resident set size of a process of a finished session.",
+		},
+		[]string{"magic_type", "pty"},
+	)
+	registerer.MustRegister(sessionPeakRSSBytes)
+
 	return &sshServerMetrics{
 		failedConnectionsTotal: failedConnectionsTotal,
+		bannedConnectionsTotal: bannedConnectionsTotal,
 		sftpConnectionsTotal:   sftpConnectionsTotal,
 		sftpServerErrors:       sftpServerErrors,
 		x11HandlerErrors:       x11HandlerErrors,
 		sessionsTotal:          sessionsTotal,
 		sessionErrors:          sessionErrors,
+		execPolicyMatches:      execPolicyMatches,
+		sessionCPUSeconds:      sessionCPUSeconds,
+		sessionPeakRSSBytes:    sessionPeakRSSBytes,
 	}
 }
 
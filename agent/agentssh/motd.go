@@ -0,0 +1,112 @@
+package agentssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/afero"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// defaultMOTDTemplate shows the MOTD file, then when the workspace stops and
+// the outstanding warnings.
+const defaultMOTDTemplate = `{{ with .File }}{{ . }}
+{{ end }}{{ with .Deadline }}Workspace {{ $.WorkspaceName }} will stop in {{ until . }}.
+{{ end }}{{ range .Warnings }}Warning: {{ . }}
+{{ end }}`
+
+// MOTDData is the data a MOTD template is rendered with.
+type MOTDData struct {
+	WorkspaceName string
+	OwnerName     string
+	AgentName     string
+	// File is the contents of the MOTD file of the manifest, if it exists.
+	File     string
+	Deadline *time.Time
+	Warnings []string
+}
+
+var motdFuncs = template.FuncMap{
+	"until": untilDeadline,
+}
+
+// untilDeadline formats the time left until t for humans, e.g. "1h 5m".
+func untilDeadline(t time.Time) string {
+	d := time.Until(t).Round(time.Minute)
+	switch {
+	case d <= 0:
+		return "less than a minute"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int((d % time.Hour).Minutes()))
+	}
+}
+
+// WriteMOTD writes the message of the day of a session started with
+// rawCommand to dest. Nothing is written for non-login shells, or when the
+// user created a .hushlogin file.
+func (s *Server) WriteMOTD(dest io.Writer, rawCommand string) error {
+	if isQuietLogin(s.fs, rawCommand) {
+		return nil
+	}
+	manifest := s.Manifest.Load()
+	if manifest == nil {
+		return xerrors.New("metadata lookup failed, unable to show MOTD")
+	}
+	motd := manifest.MOTD
+	if s.MOTD != nil && motd != nil {
+		if latest := s.MOTD.Load(); latest != nil {
+			motd = latest
+		}
+	}
+	return renderMOTD(s.fs, dest, manifest, motd)
+}
+
+// renderMOTD renders motd to dest, or only the MOTD file of the manifest if
+// motd is nil.
+func renderMOTD(fs afero.Fs, dest io.Writer, manifest *agentsdk.Manifest, motd *agentsdk.MOTDConfig) error {
+	if motd == nil {
+		return showMOTD(fs, dest, manifest.MOTDFile)
+	}
+
+	text := motd.Template
+	if text == "" {
+		text = defaultMOTDTemplate
+	}
+	tmpl, err := template.New("motd").Funcs(motdFuncs).Parse(text)
+	if err != nil {
+		return xerrors.Errorf("parse MOTD template: %w", err)
+	}
+
+	data := MOTDData{
+		WorkspaceName: manifest.WorkspaceName,
+		OwnerName:     manifest.OwnerName,
+		AgentName:     manifest.AgentName,
+		Deadline:      motd.Deadline,
+		Warnings:      motd.Warnings,
+	}
+	if manifest.MOTDFile != "" {
+		file, err := afero.ReadFile(fs, manifest.MOTDFile)
+		if err != nil && !xerrors.Is(err, os.ErrNotExist) {
+			return xerrors.Errorf("read MOTD: %w", err)
+		}
+		data.File = strings.TrimRight(string(file), "\n")
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return xerrors.Errorf("render MOTD template: %w", err)
+	}
+	return writeWithCarriageReturn(&buf, dest)
+}
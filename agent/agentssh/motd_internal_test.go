@@ -0,0 +1,96 @@
+package agentssh
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+func TestRenderMOTD(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "/etc/motd", []byte("Welcome!\n"), 0o600)
+	require.NoError(t, err)
+	deadline := time.Now().Add(2*time.Hour + 5*time.Minute + 10*time.Second)
+
+	tests := []struct {
+		name     string
+		manifest agentsdk.Manifest
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "File",
+			manifest: agentsdk.Manifest{MOTDFile: "/etc/motd"},
+			want:     "Welcome!\r\n",
+		},
+		{
+			name: "Default",
+			manifest: agentsdk.Manifest{
+				WorkspaceName: "dev",
+				MOTDFile:      "/etc/motd",
+				MOTD: &agentsdk.MOTDConfig{
+					Deadline: &deadline,
+					Warnings: []string{"The last build failed."},
+				},
+			},
+			want: "Welcome!\r\nWorkspace dev will stop in 2h 5m.\r\nWarning: The last build failed.\r\n",
+		},
+		{
+			name: "MissingFile",
+			manifest: agentsdk.Manifest{
+				MOTDFile: "/etc/missing",
+				MOTD:     &agentsdk.MOTDConfig{Warnings: []string{"Outdated."}},
+			},
+			want: "Warning: Outdated.\r\n",
+		},
+		{
+			name: "Template",
+			manifest: agentsdk.Manifest{
+				WorkspaceName: "dev",
+				OwnerName:     "alice",
+				MOTDFile:      "/etc/motd",
+				MOTD: &agentsdk.MOTDConfig{
+					Template: "{{ .File }}\nHello {{ .OwnerName }}, this is {{ .WorkspaceName }}.",
+				},
+			},
+			want: "Welcome!\r\nHello alice, this is dev.\r\n",
+		},
+		{
+			name: "InvalidTemplate",
+			manifest: agentsdk.Manifest{
+				MOTD: &agentsdk.MOTDConfig{Template: "{{ .Missing"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got strings.Builder
+			err := renderMOTD(fs, &got, &tt.manifest, tt.manifest.MOTD)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestUntilDeadline(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	require.Equal(t, "less than a minute", untilDeadline(now.Add(-time.Hour)))
+	require.Equal(t, "30m", untilDeadline(now.Add(30*time.Minute+10*time.Second)))
+	require.Equal(t, "3h", untilDeadline(now.Add(3*time.Hour+10*time.Second)))
+}
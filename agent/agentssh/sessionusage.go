@@ -0,0 +1,34 @@
+package agentssh
+
+import (
+	"os"
+)
+
+// recordSessionUsage adds the resources used by the process tree of a
+// finished session to the session metrics, which are reported with the agent
+// stats. The usage includes the descendants of the session process that were
+// waited for, e.g. the commands run by a shell.
+func (s *Server) recordSessionUsage(magicTypeLabel, ptyLabel string, state *os.ProcessState) {
+	if state == nil {
+		// The process couldn't be waited for.
+		return
+	}
+	cpu := state.UserTime() + state.SystemTime()
+	s.metrics.sessionCPUSeconds.WithLabelValues(magicTypeLabel, ptyLabel).Add(cpu.Seconds())
+
+	rss, ok := peakRSSBytes(state)
+	if !ok {
+		return
+	}
+	s.sessionPeakRSSMu.Lock()
+	defer s.sessionPeakRSSMu.Unlock()
+	key := magicTypeLabel + "/" + ptyLabel
+	if rss <= s.sessionPeakRSS[key] {
+		return
+	}
+	if s.sessionPeakRSS == nil {
+		s.sessionPeakRSS = map[string]int64{}
+	}
+	s.sessionPeakRSS[key] = rss
+	s.metrics.sessionPeakRSSBytes.WithLabelValues(magicTypeLabel, ptyLabel).Set(float64(rss))
+}
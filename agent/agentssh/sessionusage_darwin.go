@@ -0,0 +1,15 @@
+package agentssh
+
+import (
+	"os"
+	"syscall"
+)
+
+func peakRSSBytes(state *os.ProcessState) (int64, bool) {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0, false
+	}
+	// macOS reports the maximum resident set size in bytes.
+	return usage.Maxrss, true
+}
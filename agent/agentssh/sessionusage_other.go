@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package agentssh
+
+import "os"
+
+// peakRSSBytes isn't supported on this platform, only the CPU time of
+// sessions is recorded.
+func peakRSSBytes(*os.ProcessState) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package agentssh
+
+import (
+	"github.com/gliderlabs/ssh"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+)
+
+// Subsystem is an SSH subsystem served by the server, e.g. an alternate
+// sftp server or a tunnel broker.
+type Subsystem struct {
+	// Handler serves a session of the subsystem. The session exits with
+	// status 0 once the handler returns, unless the handler exited it.
+	Handler func(logger slog.Logger, session ssh.Session)
+	// Policy decides whether a session may use the subsystem, e.g. based on
+	// the user or the remote address. Requests of denied sessions are
+	// rejected. If nil, every session may use the subsystem.
+	Policy func(session ssh.Session) error
+}
+
+// RegisterSubsystem registers a subsystem with the name, which clients
+// request with e.g. "ssh -s". Names must be unique, including the built-in
+// "sftp" subsystem.
+func (s *Server) RegisterSubsystem(name string, subsystem Subsystem) error {
+	if name == "" {
+		return xerrors.New("subsystem name is required")
+	}
+	if subsystem.Handler == nil {
+		return xerrors.Errorf("subsystem %q has no handler", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subsystems[name]; ok {
+		return xerrors.Errorf("subsystem %q is already registered", name)
+	}
+	s.subsystems[name] = subsystem
+	return nil
+}
+
+// UnregisterSubsystem removes the subsystem with the name, sessions of the
+// subsystem that are already served aren't affected.
+func (s *Server) UnregisterSubsystem(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subsystems, name)
+}
+
+func (s *Server) subsystem(name string) (Subsystem, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subsystem, ok := s.subsystems[name]
+	return subsystem, ok
+}
+
+// sessionRequestCallback rejects requests for subsystems that aren't
+// registered or are denied by their policy.
+func (s *Server) sessionRequestCallback(session ssh.Session, requestType string) bool {
+	if requestType != "subsystem" {
+		return true
+	}
+	ctx := session.Context()
+	logger := s.logger.With(
+		slog.F("remote_addr", session.RemoteAddr()),
+		slog.F("subsystem", session.Subsystem()),
+	)
+	subsystem, ok := s.subsystem(session.Subsystem())
+	if !ok {
+		logger.Warn(ctx, "unsupported subsystem")
+		return false
+	}
+	if subsystem.Policy == nil {
+		return true
+	}
+	err := subsystem.Policy(session)
+	if err != nil {
+		logger.Warn(ctx, "subsystem denied by policy", slog.Error(err))
+		return false
+	}
+	return true
+}
@@ -2,7 +2,9 @@ package agenttest
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"net/url"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -11,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"storj.io/drpc"
@@ -20,6 +23,7 @@ import (
 
 	"cdr.dev/slog"
 	agentproto "github.com/coder/coder/v2/agent/proto"
+	"github.com/coder/coder/v2/buildinfo"
 	"github.com/coder/coder/v2/codersdk"
 	"github.com/coder/coder/v2/codersdk/agentsdk"
 	drpcsdk "github.com/coder/coder/v2/codersdk/drpc"
@@ -90,12 +94,24 @@ type Client struct {
 	mu              sync.Mutex // Protects following.
 	lifecycleStates []codersdk.WorkspaceAgentLifecycle
 	logs            []agentsdk.Log
+	logSources      map[uuid.UUID]codersdk.WorkspaceAgentLogSource
+	scriptArtifacts map[uuid.UUID][]byte
+	connFailures    []agentsdk.ConnectionFailure
+	authorizedKeys  agentsdk.AuthorizedKeysResponse
 	derpMapUpdates  chan *tailcfg.DERPMap
 	derpMapOnce     sync.Once
 }
 
 func (*Client) RewriteDERPMap(*tailcfg.DERPMap) {}
 
+func (*Client) BuildInfo(context.Context) (codersdk.BuildInfoResponse, error) {
+	return codersdk.BuildInfoResponse{Version: buildinfo.Version()}, nil
+}
+
+func (*Client) AgentBinaryURL(goos, goarch string) *url.URL {
+	return &url.URL{Scheme: "http", Host: "localhost", Path: fmt.Sprintf("/bin/coder-%s-%s", goos, goarch)}
+}
+
 func (c *Client) Close() {
 	c.derpMapOnce.Do(func() { close(c.derpMapUpdates) })
 }
@@ -176,10 +192,119 @@ func (c *Client) PatchLogs(ctx context.Context, logs agentsdk.PatchLogs) error {
 	return nil
 }
 
+func (c *Client) GetLogSources() map[uuid.UUID]codersdk.WorkspaceAgentLogSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.logSources)
+}
+
+func (c *Client) PostLogSource(ctx context.Context, req agentsdk.PostLogSource) (codersdk.WorkspaceAgentLogSource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.logSources == nil {
+		c.logSources = make(map[uuid.UUID]codersdk.WorkspaceAgentLogSource)
+	}
+	source, ok := c.logSources[req.ID]
+	if !ok {
+		source = codersdk.WorkspaceAgentLogSource{
+			WorkspaceAgentID: c.agentID,
+			ID:               req.ID,
+			CreatedAt:        time.Now(),
+			DisplayName:      req.DisplayName,
+			Icon:             req.Icon,
+		}
+		c.logSources[req.ID] = source
+	}
+	c.logger.Debug(ctx, "post log source", slog.F("req", req))
+	return source, nil
+}
+
+func (c *Client) GetScriptArtifacts() map[uuid.UUID][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.scriptArtifacts)
+}
+
+func (c *Client) PostScriptArtifacts(ctx context.Context, req agentsdk.ScriptArtifacts) error {
+	data, err := io.ReadAll(req.Archive)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.scriptArtifacts == nil {
+		c.scriptArtifacts = make(map[uuid.UUID][]byte)
+	}
+	c.scriptArtifacts[req.LogSourceID] = data
+	c.logger.Debug(ctx, "post script artifacts", slog.F("log_source_id", req.LogSourceID), slog.F("size", len(data)))
+	return nil
+}
+
+func (c *Client) GetConnectionFailures() []agentsdk.ConnectionFailure {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]agentsdk.ConnectionFailure(nil), c.connFailures...)
+}
+
+func (c *Client) PostConnectionFailures(ctx context.Context, req agentsdk.PostConnectionFailuresRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connFailures = append(c.connFailures, req.Failures...)
+	c.logger.Debug(ctx, "post connection failures", slog.F("failures", req.Failures))
+	return nil
+}
+
+func (c *Client) SetAuthorizedKeys(resp agentsdk.AuthorizedKeysResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authorizedKeys = resp
+}
+
+func (c *Client) AuthorizedKeys(context.Context) (agentsdk.AuthorizedKeysResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authorizedKeys, nil
+}
+
+func (c *Client) Manifest(ctx context.Context) (agentsdk.Manifest, error) {
+	mp, err := c.fakeAgentAPI.GetManifest(ctx, &agentproto.GetManifestRequest{})
+	if err != nil {
+		return agentsdk.Manifest{}, err
+	}
+	return agentsdk.ManifestFromProto(mp)
+}
+
+func (c *Client) PostStats(ctx context.Context, stats *agentsdk.Stats) (agentsdk.StatsResponse, error) {
+	ps, err := agentsdk.ProtoFromStats(stats)
+	if err != nil {
+		return agentsdk.StatsResponse{}, err
+	}
+	resp, err := c.fakeAgentAPI.UpdateStats(ctx, &agentproto.UpdateStatsRequest{Stats: ps})
+	if err != nil {
+		return agentsdk.StatsResponse{}, err
+	}
+	return agentsdk.StatsResponse{ReportInterval: resp.ReportInterval.AsDuration()}, nil
+}
+
+func (*Client) DiagnoseConnectionFailure(_ context.Context, err error) agentsdk.ConnectionFailure {
+	now := time.Now()
+	return agentsdk.ConnectionFailure{
+		Stage:       agentsdk.ConnectionFailureStageCoderd,
+		Error:       err.Error(),
+		Count:       1,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+}
+
 func (c *Client) SetServiceBannerFunc(f func() (codersdk.ServiceBannerConfig, error)) {
 	c.fakeAgentAPI.SetServiceBannerFunc(f)
 }
 
+func (c *Client) SetMOTDFunc(f func() (*agentproto.MOTDConfig, error)) {
+	c.fakeAgentAPI.SetMOTDFunc(f)
+}
+
 func (c *Client) PushDERPMapUpdate(update *tailcfg.DERPMap) error {
 	timer := time.NewTimer(testutil.WaitShort)
 	defer timer.Stop()
@@ -203,6 +328,8 @@ type FakeAgentAPI struct {
 	appHealthCh chan *agentproto.BatchUpdateAppHealthRequest
 
 	getServiceBannerFunc func() (codersdk.ServiceBannerConfig, error)
+	notifications        []*agentproto.Notification
+	getMOTDFunc          func() (*agentproto.MOTDConfig, error)
 }
 
 func (f *FakeAgentAPI) GetManifest(context.Context, *agentproto.GetManifestRequest) (*agentproto.Manifest, error) {
@@ -268,6 +395,44 @@ func (*FakeAgentAPI) BatchCreateLogs(context.Context, *agentproto.BatchCreateLog
 	panic("implement me")
 }
 
+func (*FakeAgentAPI) CreateLogSource(context.Context, *agentproto.CreateLogSourceRequest) (*agentproto.LogSource, error) {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (f *FakeAgentAPI) CreateNotification(ctx context.Context, req *agentproto.CreateNotificationRequest) (*agentproto.CreateNotificationResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.logger.Debug(ctx, "create notification", slog.F("req", req))
+	f.notifications = append(f.notifications, req.GetNotification())
+	return &agentproto.CreateNotificationResponse{}, nil
+}
+
+func (f *FakeAgentAPI) SetMOTDFunc(fn func() (*agentproto.MOTDConfig, error)) {
+	f.Lock()
+	defer f.Unlock()
+	f.getMOTDFunc = fn
+	f.logger.Info(context.Background(), "updated MOTDFunc")
+}
+
+func (f *FakeAgentAPI) GetMOTD(context.Context, *agentproto.GetMOTDRequest) (*agentproto.MOTDConfig, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.getMOTDFunc == nil {
+		if f.manifest.GetMotd() != nil {
+			return f.manifest.GetMotd(), nil
+		}
+		return &agentproto.MOTDConfig{}, nil
+	}
+	return f.getMOTDFunc()
+}
+
+func (f *FakeAgentAPI) GetNotifications() []*agentproto.Notification {
+	f.Lock()
+	defer f.Unlock()
+	return slices.Clone(f.notifications)
+}
+
 func NewFakeAgentAPI(t testing.TB, logger slog.Logger, manifest *agentproto.Manifest, statsCh chan *agentproto.Stats) *FakeAgentAPI {
 	return &FakeAgentAPI{
 		t:           t,
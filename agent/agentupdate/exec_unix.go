@@ -0,0 +1,23 @@
+//go:build !windows
+
+package agentupdate
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// CanExec reports whether the agent can be replaced in place on this
+// platform.
+const CanExec = true
+
+// ExecBinary replaces the process with the binary, keeping the arguments
+// and the process ID so supervisors like systemd don't notice the update.
+func ExecBinary(binary, currentVersion string) error {
+	env := append(os.Environ(), EnvUpdatedFrom+"="+currentVersion)
+	//nolint:gosec // The binary was verified before.
+	err := syscall.Exec(binary, append([]string{binary}, os.Args[1:]...), env)
+	return xerrors.Errorf("exec: %w", err)
+}
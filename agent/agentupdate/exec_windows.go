@@ -0,0 +1,12 @@
+package agentupdate
+
+import "golang.org/x/xerrors"
+
+// CanExec reports whether the agent can be replaced in place on this
+// platform. Windows can't replace a running process.
+const CanExec = false
+
+// ExecBinary isn't supported on Windows.
+func ExecBinary(string, string) error {
+	return xerrors.New("replacing the agent is not supported on windows")
+}
@@ -0,0 +1,354 @@
+// Package agentupdate replaces the running agent with newer versions of the
+// binary according to the update policy of the manifest.
+package agentupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/semver"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// EnvUpdatedFrom is set to the previous version of the agent when it
+// replaced itself with a newer version. The new agent skips the startup
+// scripts, which already ran.
+const EnvUpdatedFrom = "CODER_AGENT_UPDATED_FROM"
+
+// Options are a set of options for the updater.
+type Options struct {
+	Logger slog.Logger
+	// CurrentVersion is the version of the running agent.
+	CurrentVersion string
+	// Dir receives the downloaded binaries.
+	Dir string
+	// HTTPClient downloads the binaries. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// BuildInfo returns the build information of the deployment, which
+	// determines the version of the "deployment" channel.
+	BuildInfo func(ctx context.Context) (codersdk.BuildInfoResponse, error)
+	// BinaryURL returns the URL of the binary served by the deployment for
+	// the platform.
+	BinaryURL func(goos, goarch string) *url.URL
+	// Idle reports whether the agent can be replaced without interrupting
+	// the workspace owner.
+	Idle func() bool
+	// Exec replaces the running agent with the binary. It only returns if
+	// that failed. Defaults to executing the binary with the arguments of
+	// the running agent.
+	Exec func(binary string) error
+	// CheckInterval is how often the deployment is checked for a new
+	// version. Defaults to an hour.
+	CheckInterval time.Duration
+	// IdleInterval is how often a downloaded update checks whether the agent
+	// is idle. Defaults to a minute.
+	IdleInterval time.Duration
+}
+
+// New creates an updater, which does nothing until a policy is set and it's
+// run.
+func New(opts Options) *Updater {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.Exec == nil {
+		opts.Exec = func(binary string) error {
+			return ExecBinary(binary, opts.CurrentVersion)
+		}
+	}
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = time.Hour
+	}
+	if opts.IdleInterval == 0 {
+		opts.IdleInterval = time.Minute
+	}
+	return &Updater{
+		opts:          opts,
+		policyChanged: make(chan struct{}, 1),
+	}
+}
+
+// Updater downloads and verifies new versions of the agent, and executes
+// them once the agent is idle.
+type Updater struct {
+	opts          Options
+	policyChanged chan struct{}
+
+	mu     sync.Mutex // Protects following.
+	policy *agentsdk.AgentUpdatePolicy
+	// downloaded is the verified binary of a newer version, which is reused
+	// while the version is current.
+	downloaded *download
+}
+
+type download struct {
+	version string
+	sha256  string
+	path    string
+}
+
+// SetPolicy updates the policy, e.g. when the manifest is fetched again. A
+// nil policy or an empty channel disables updates.
+func (u *Updater) SetPolicy(policy *agentsdk.AgentUpdatePolicy) {
+	u.mu.Lock()
+	u.policy = policy
+	u.mu.Unlock()
+	select {
+	case u.policyChanged <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks for updates until the context is canceled, or until the agent
+// is replaced.
+func (u *Updater) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.opts.CheckInterval)
+	defer ticker.Stop()
+	for {
+		binary, err := u.Check(ctx)
+		if err != nil && ctx.Err() == nil {
+			u.opts.Logger.Warn(ctx, "check for agent update", slog.Error(err))
+		}
+		if binary != "" && u.waitIdle(ctx) {
+			u.opts.Logger.Info(ctx, "replacing idle agent with update", slog.F("binary", binary))
+			err := u.opts.Exec(binary)
+			if err == nil {
+				return
+			}
+			u.opts.Logger.Error(ctx, "execute agent update", slog.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-u.policyChanged:
+		}
+	}
+}
+
+// waitIdle returns true once the agent is idle, or false if the policy
+// changed or the context was canceled before.
+func (u *Updater) waitIdle(ctx context.Context) bool {
+	if u.opts.Idle == nil || u.opts.Idle() {
+		return true
+	}
+	u.opts.Logger.Debug(ctx, "waiting for agent to be idle to update")
+	ticker := time.NewTicker(u.opts.IdleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-u.policyChanged:
+			// Check the new policy before updating.
+			select {
+			case u.policyChanged <- struct{}{}:
+			default:
+			}
+			return false
+		case <-ticker.C:
+			if u.opts.Idle() {
+				return true
+			}
+		}
+	}
+}
+
+// Check returns the path of the verified binary the agent should update to,
+// downloading it if necessary. It returns an empty path if the agent is up
+// to date, or the policy disables updates.
+func (u *Updater) Check(ctx context.Context) (string, error) {
+	u.mu.Lock()
+	policy := u.policy
+	downloaded := u.downloaded
+	u.mu.Unlock()
+	if policy == nil || policy.Channel == "" {
+		return "", nil
+	}
+	if policy.Channel != agentsdk.AgentUpdateChannelDeployment {
+		return "", xerrors.Errorf("unknown update channel %q", policy.Channel)
+	}
+
+	current := canonicalVersion(u.opts.CurrentVersion)
+	if current == "" {
+		// Development builds aren't replaced.
+		return "", nil
+	}
+	buildInfo, err := u.opts.BuildInfo(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("fetch build info: %w", err)
+	}
+	target := buildInfo.CanonicalVersion()
+	if target == "" || semver.Compare(target, current) <= 0 {
+		return "", nil
+	}
+	constraints, err := ParseVersionRange(policy.VersionRange)
+	if err != nil {
+		return "", xerrors.Errorf("parse version range: %w", err)
+	}
+	if !constraints.Allows(target) {
+		u.opts.Logger.Debug(ctx, "agent update excluded by version range",
+			slog.F("version", target), slog.F("version_range", policy.VersionRange))
+		return "", nil
+	}
+	if policy.SHA256 == "" {
+		// Binaries are only executed once they match the checksum sent
+		// by coderd, wherever they're downloaded from.
+		return "", xerrors.Errorf("no checksum of %s for %s/%s is available", target, runtime.GOOS, runtime.GOARCH)
+	}
+	if downloaded != nil && downloaded.version == target && strings.EqualFold(downloaded.sha256, policy.SHA256) {
+		return downloaded.path, nil
+	}
+
+	binaryURL, err := u.binaryURL(policy, target)
+	if err != nil {
+		return "", err
+	}
+	u.opts.Logger.Info(ctx, "downloading agent update",
+		slog.F("current_version", current), slog.F("version", target), slog.F("url", binaryURL))
+	path, err := u.download(ctx, binaryURL, target, policy.SHA256)
+	if err != nil {
+		return "", xerrors.Errorf("download %s: %w", target, err)
+	}
+	err = verifyVersion(ctx, path, target)
+	if err != nil {
+		_ = os.Remove(path)
+		return "", xerrors.Errorf("verify %s: %w", target, err)
+	}
+
+	u.mu.Lock()
+	if u.downloaded != nil && u.downloaded.path != path {
+		_ = os.Remove(u.downloaded.path)
+	}
+	u.downloaded = &download{version: target, sha256: policy.SHA256, path: path}
+	u.mu.Unlock()
+	return path, nil
+}
+
+func (u *Updater) binaryURL(policy *agentsdk.AgentUpdatePolicy, version string) (string, error) {
+	if policy.BinaryURL == "" {
+		if u.opts.BinaryURL == nil {
+			return "", xerrors.New("no binary url")
+		}
+		return u.opts.BinaryURL(runtime.GOOS, runtime.GOARCH).String(), nil
+	}
+	raw := strings.NewReplacer(
+		"{os}", runtime.GOOS,
+		"{arch}", runtime.GOARCH,
+		"{version}", version,
+	).Replace(policy.BinaryURL)
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", xerrors.Errorf("parse binary url: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", xerrors.Errorf("binary url %q must use http or https", raw)
+	}
+	return parsed.String(), nil
+}
+
+// download writes the binary to the directory if its SHA256 matches the
+// checksum. The binary is removed otherwise, so it's never executed.
+func (u *Updater) download(ctx context.Context, binaryURL, version, checksum string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, binaryURL, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := u.opts.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", xerrors.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	err = os.MkdirAll(u.opts.Dir, 0o700)
+	if err != nil {
+		return "", xerrors.Errorf("create dir: %w", err)
+	}
+	name := "coder-" + version
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	path := filepath.Join(u.opts.Dir, name)
+	tmp, err := os.CreateTemp(u.opts.Dir, name+".*")
+	if err != nil {
+		return "", xerrors.Errorf("create file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), res.Body)
+	if err != nil {
+		return "", xerrors.Errorf("write file: %w", err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, checksum) {
+		return "", xerrors.Errorf("checksum mismatch: got sha256 %s, expected %s", sum, checksum)
+	}
+	err = tmp.Chmod(0o755)
+	if err != nil {
+		return "", xerrors.Errorf("chmod: %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", xerrors.Errorf("close file: %w", err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return "", xerrors.Errorf("rename: %w", err)
+	}
+	return path, nil
+}
+
+// verifyVersion runs the binary to ensure it's executable on this platform
+// and reports the expected version. It's only called once the binary
+// matched its checksum.
+func verifyVersion(ctx context.Context, binary, version string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	//nolint:gosec // The binary matched the checksum sent by coderd.
+	out, err := exec.CommandContext(ctx, binary, "version", "--output", "json").Output()
+	if err != nil {
+		return xerrors.Errorf("run version: %w", err)
+	}
+	var info struct {
+		Version string `json:"version"`
+	}
+	err = json.Unmarshal(out, &info)
+	if err != nil {
+		return xerrors.Errorf("decode version: %w", err)
+	}
+	if canonicalVersion(info.Version) != version {
+		return xerrors.Errorf("binary reports version %q", info.Version)
+	}
+	return nil
+}
+
+// canonicalVersion trims build information from the version like
+// codersdk.BuildInfoResponse.CanonicalVersion, and returns an empty string
+// for development builds.
+func canonicalVersion(version string) string {
+	if strings.Contains(version, "-devel") {
+		return ""
+	}
+	return semver.Canonical(version)
+}
@@ -0,0 +1,305 @@
+package agentupdate_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/coder/v2/agent/agentupdate"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// fakeBinary prints its version like `coder version --output json`.
+func fakeBinary(version string) []byte {
+	return []byte(fmt.Sprintf("#!/bin/sh\necho '{\"version\": \"%s\"}'\n", version))
+}
+
+func checksum(binary []byte) string {
+	sum := sha256.Sum256(binary)
+	return hex.EncodeToString(sum[:])
+}
+
+// policy returns the policy of the deployment channel with the checksum of
+// the binary sent by coderd.
+func policy(binary []byte) *agentsdk.AgentUpdatePolicy {
+	return &agentsdk.AgentUpdatePolicy{
+		Channel: agentsdk.AgentUpdateChannelDeployment,
+		SHA256:  checksum(binary),
+	}
+}
+
+func serveBinary(t *testing.T, binary []byte) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var downloads atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		_, _ = w.Write(binary)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &downloads
+}
+
+func newUpdater(t *testing.T, srv *httptest.Server, deploymentVersion string, mut func(*agentupdate.Options)) *agentupdate.Updater {
+	t.Helper()
+	opts := agentupdate.Options{
+		Logger:         slogtest.Make(t, nil),
+		CurrentVersion: "v2.5.0+abcdef0",
+		Dir:            t.TempDir(),
+		BuildInfo: func(context.Context) (codersdk.BuildInfoResponse, error) {
+			return codersdk.BuildInfoResponse{Version: deploymentVersion}, nil
+		},
+		BinaryURL: func(goos, goarch string) *url.URL {
+			u, _ := url.Parse(srv.URL)
+			return u.JoinPath("bin", "coder-"+goos+"-"+goarch)
+		},
+		Exec: func(string) error {
+			return nil
+		},
+	}
+	if mut != nil {
+		mut(&opts)
+	}
+	return agentupdate.New(opts)
+}
+
+func TestUpdater_Check(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binary is a shell script")
+	}
+
+	t.Run("Update", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		srv, downloads := serveBinary(t, fakeBinary("v2.6.0+1234567"))
+		u := newUpdater(t, srv, "v2.6.0+1234567", nil)
+		u.SetPolicy(policy(fakeBinary("v2.6.0+1234567")))
+
+		binary, err := u.Check(ctx)
+		require.NoError(t, err)
+		require.NotEmpty(t, binary)
+		content, err := os.ReadFile(binary)
+		require.NoError(t, err)
+		require.Equal(t, fakeBinary("v2.6.0+1234567"), content)
+
+		// The download is reused.
+		again, err := u.Check(ctx)
+		require.NoError(t, err)
+		require.Equal(t, binary, again)
+		require.EqualValues(t, 1, downloads.Load())
+	})
+
+	t.Run("BinaryURLOverride", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		var path atomic.Value
+		binary := fakeBinary("v2.6.0")
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path.Store(r.URL.Path)
+			_, _ = w.Write(binary)
+		}))
+		t.Cleanup(srv.Close)
+		u := newUpdater(t, srv, "v2.6.0", func(opts *agentupdate.Options) {
+			opts.BinaryURL = nil
+		})
+		u.SetPolicy(&agentsdk.AgentUpdatePolicy{
+			Channel:   agentsdk.AgentUpdateChannelDeployment,
+			BinaryURL: srv.URL + "/mirror/{version}/coder-{os}-{arch}",
+			SHA256:    checksum(binary),
+		})
+
+		got, err := u.Check(ctx)
+		require.NoError(t, err)
+		require.NotEmpty(t, got)
+		require.Equal(t, fmt.Sprintf("/mirror/v2.6.0/coder-%s-%s", runtime.GOOS, runtime.GOARCH), path.Load())
+	})
+
+	t.Run("NoUpdate", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		srv, downloads := serveBinary(t, fakeBinary("v2.6.0"))
+
+		for _, tc := range []struct {
+			name    string
+			version string
+			policy  *agentsdk.AgentUpdatePolicy
+		}{
+			{"NoPolicy", "v2.6.0", nil},
+			{"NoChannel", "v2.6.0", &agentsdk.AgentUpdatePolicy{VersionRange: ">= 2.0.0"}},
+			{"SameVersion", "v2.5.0", &agentsdk.AgentUpdatePolicy{Channel: agentsdk.AgentUpdateChannelDeployment}},
+			{"OlderVersion", "v2.4.1", &agentsdk.AgentUpdatePolicy{Channel: agentsdk.AgentUpdateChannelDeployment}},
+			{"OutOfRange", "v2.6.0", &agentsdk.AgentUpdatePolicy{Channel: agentsdk.AgentUpdateChannelDeployment, VersionRange: "< 2.6.0"}},
+		} {
+			u := newUpdater(t, srv, tc.version, nil)
+			u.SetPolicy(tc.policy)
+			binary, err := u.Check(ctx)
+			require.NoError(t, err, tc.name)
+			require.Empty(t, binary, tc.name)
+		}
+		require.Zero(t, downloads.Load())
+	})
+
+	t.Run("DevelopmentBuild", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		srv, downloads := serveBinary(t, fakeBinary("v2.6.0"))
+		u := newUpdater(t, srv, "v2.6.0", func(opts *agentupdate.Options) {
+			opts.CurrentVersion = "v0.0.0-devel+abcdef0"
+		})
+		u.SetPolicy(policy(fakeBinary("v2.6.0")))
+
+		binary, err := u.Check(ctx)
+		require.NoError(t, err)
+		require.Empty(t, binary)
+		require.Zero(t, downloads.Load())
+	})
+
+	t.Run("UnknownChannel", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		srv, _ := serveBinary(t, fakeBinary("v2.6.0"))
+		u := newUpdater(t, srv, "v2.6.0", nil)
+		u.SetPolicy(&agentsdk.AgentUpdatePolicy{Channel: "nightly"})
+
+		_, err := u.Check(ctx)
+		require.ErrorContains(t, err, "unknown update channel")
+	})
+
+	t.Run("NoChecksum", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		srv, downloads := serveBinary(t, fakeBinary("v2.6.0"))
+		u := newUpdater(t, srv, "v2.6.0", nil)
+		u.SetPolicy(&agentsdk.AgentUpdatePolicy{Channel: agentsdk.AgentUpdateChannelDeployment})
+
+		_, err := u.Check(ctx)
+		require.ErrorContains(t, err, "no checksum")
+		require.Zero(t, downloads.Load())
+	})
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		// A mirror serving another binary, which must never run.
+		marker := filepath.Join(t.TempDir(), "executed")
+		binary := []byte(fmt.Sprintf("#!/bin/sh\ntouch %q\necho '{\"version\": \"v2.6.0\"}'\n", marker))
+		srv, _ := serveBinary(t, binary)
+		dir := t.TempDir()
+		u := newUpdater(t, srv, "v2.6.0", func(opts *agentupdate.Options) {
+			opts.Dir = dir
+		})
+		u.SetPolicy(policy(fakeBinary("v2.6.0")))
+
+		_, err := u.Check(ctx)
+		require.ErrorContains(t, err, "checksum mismatch")
+		require.NoFileExists(t, marker)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Empty(t, entries, "the binary is removed")
+	})
+
+	t.Run("VersionMismatch", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		srv, _ := serveBinary(t, fakeBinary("v2.5.1"))
+		u := newUpdater(t, srv, "v2.6.0", nil)
+		u.SetPolicy(policy(fakeBinary("v2.5.1")))
+
+		_, err := u.Check(ctx)
+		require.ErrorContains(t, err, `binary reports version "v2.5.1"`)
+	})
+}
+
+func TestUpdater_Run(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binary is a shell script")
+	}
+
+	ctx := testutil.Context(t, testutil.WaitLong)
+	srv, _ := serveBinary(t, fakeBinary("v2.6.0"))
+	var idle atomic.Bool
+	executed := make(chan string, 1)
+	u := newUpdater(t, srv, "v2.6.0", func(opts *agentupdate.Options) {
+		opts.Idle = idle.Load
+		opts.IdleInterval = testutil.IntervalFast
+		opts.Exec = func(binary string) error {
+			executed <- binary
+			return nil
+		}
+	})
+	u.SetPolicy(policy(fakeBinary("v2.6.0")))
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		u.Run(runCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// The update waits for the agent to be idle.
+	select {
+	case <-executed:
+		t.Fatal("executed update while busy")
+	case <-time.After(testutil.IntervalSlow):
+	}
+	idle.Store(true)
+	binary := testutil.RequireRecvCtx(ctx, t, executed)
+	require.NotEmpty(t, binary)
+}
+
+func TestParseVersionRange(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		versionRange string
+		allowed      []string
+		denied       []string
+		err          string
+	}{
+		{versionRange: "", allowed: []string{"v1.0.0", "v3.0.0"}},
+		{versionRange: ">= 2.6.0, < v3.0.0", allowed: []string{"v2.6.0", "v2.9.1"}, denied: []string{"v2.5.9", "v3.0.0"}},
+		{versionRange: "> 2.6.0", allowed: []string{"v2.6.1"}, denied: []string{"v2.6.0"}},
+		{versionRange: "<=2.6.0", allowed: []string{"v2.6.0"}, denied: []string{"v2.6.1"}},
+		{versionRange: "!= 2.6.0", allowed: []string{"v2.6.1"}, denied: []string{"v2.6.0"}},
+		{versionRange: "2.6", allowed: []string{"v2.6.0"}, denied: []string{"v2.6.1"}},
+		{versionRange: ">= latest", err: "invalid version"},
+	} {
+		r, err := agentupdate.ParseVersionRange(tc.versionRange)
+		if tc.err != "" {
+			require.ErrorContains(t, err, tc.err, tc.versionRange)
+			continue
+		}
+		require.NoError(t, err, tc.versionRange)
+		for _, v := range tc.allowed {
+			require.True(t, r.Allows(v), "%q should allow %s", tc.versionRange, v)
+		}
+		for _, v := range tc.denied {
+			require.False(t, r.Allows(v), "%q should deny %s", tc.versionRange, v)
+		}
+	}
+}
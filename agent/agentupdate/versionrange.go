@@ -0,0 +1,72 @@
+package agentupdate
+
+import (
+	"strings"
+
+	"golang.org/x/mod/semver"
+	"golang.org/x/xerrors"
+)
+
+// VersionRange is a set of constraints a version must satisfy.
+type VersionRange []versionConstraint
+
+type versionConstraint struct {
+	op      string
+	version string
+}
+
+// ParseVersionRange parses comma-separated comparisons like
+// ">= 2.6.0, < 3.0.0". The operators are "=", "!=", "<", "<=", ">" and
+// ">=". An empty range allows every version.
+func ParseVersionRange(s string) (VersionRange, error) {
+	var r VersionRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		op := "="
+		for _, candidate := range []string{"!=", "<=", ">=", "<", ">", "="} {
+			if strings.HasPrefix(part, candidate) {
+				op = candidate
+				part = strings.TrimSpace(strings.TrimPrefix(part, candidate))
+				break
+			}
+		}
+		version := part
+		if !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+		if !semver.IsValid(version) {
+			return nil, xerrors.Errorf("invalid version %q", part)
+		}
+		r = append(r, versionConstraint{op: op, version: semver.Canonical(version)})
+	}
+	return r, nil
+}
+
+// Allows reports whether the version satisfies all constraints.
+func (r VersionRange) Allows(version string) bool {
+	for _, c := range r {
+		cmp := semver.Compare(version, c.version)
+		var ok bool
+		switch c.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -1,14 +1,19 @@
 package agent
 
 import (
+	"errors"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
 
+	"github.com/coder/coder/v2/agent/agentscripts"
 	"github.com/coder/coder/v2/coderd/httpapi"
 	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
 )
 
 func (a *agent) apiHandler() http.Handler {
@@ -36,10 +41,107 @@ func (a *agent) apiHandler() http.Handler {
 		cacheDuration: cacheDuration,
 	}
 	r.Get("/api/v0/listening-ports", lp.handler)
+	r.Get("/api/v0/code-server", func(rw http.ResponseWriter, r *http.Request) {
+		httpapi.Write(r.Context(), rw, http.StatusOK, a.codeServer.Status())
+	})
+	r.Get("/api/v0/app-health", func(rw http.ResponseWriter, r *http.Request) {
+		reports := map[uuid.UUID]agentsdk.AppHealthReport{}
+		if req := a.appHealth.Load(); req != nil {
+			reports = req.Reports
+		}
+		httpapi.Write(r.Context(), rw, http.StatusOK, reports)
+	})
+	r.Get("/api/v0/script-runs", a.handleScriptRuns)
+	r.Route("/api/v0/scheduled-tasks", func(r chi.Router) {
+		r.Get("/", a.handleScheduledTasks)
+		r.Post("/", a.handlePutScheduledTask)
+		r.Put("/{task}", a.handlePutScheduledTask)
+		r.Delete("/{task}", a.handleDeleteScheduledTask)
+	})
 
 	return r
 }
 
+// handleScriptRuns returns the recent runs of scripts, newest first.
+func (a *agent) handleScriptRuns(rw http.ResponseWriter, r *http.Request) {
+	httpapi.Write(r.Context(), rw, http.StatusOK, a.scriptRunner.ScriptRunHistory())
+}
+
+func (a *agent) handleScheduledTasks(rw http.ResponseWriter, r *http.Request) {
+	httpapi.Write(r.Context(), rw, http.StatusOK, a.scriptRunner.ScheduledTasks())
+}
+
+// handlePutScheduledTask creates a task, or updates the task in the URL.
+func (a *agent) handlePutScheduledTask(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req codersdk.PutWorkspaceAgentScheduledTaskRequest
+	if !httpapi.Read(ctx, rw, r, &req) {
+		return
+	}
+	task := codersdk.WorkspaceAgentScheduledTask{
+		Name:           req.Name,
+		Cron:           req.Cron,
+		Script:         req.Script,
+		TimeoutSeconds: req.TimeoutSeconds,
+	}
+	status := http.StatusCreated
+	if chi.URLParam(r, "task") != "" {
+		id, ok := parseScheduledTaskID(rw, r)
+		if !ok {
+			return
+		}
+		if !slices.ContainsFunc(a.scriptRunner.ScheduledTasks(), func(t codersdk.WorkspaceAgentScheduledTask) bool {
+			return t.ID == id
+		}) {
+			httpapi.ResourceNotFound(rw)
+			return
+		}
+		task.ID = id
+		status = http.StatusOK
+	}
+	task, err := a.scriptRunner.PutScheduledTask(task)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: "Invalid scheduled task.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	httpapi.Write(ctx, rw, status, task)
+}
+
+func (a *agent) handleDeleteScheduledTask(rw http.ResponseWriter, r *http.Request) {
+	id, ok := parseScheduledTaskID(rw, r)
+	if !ok {
+		return
+	}
+	err := a.scriptRunner.DeleteScheduledTask(id)
+	if errors.Is(err, agentscripts.ErrTaskNotFound) {
+		httpapi.ResourceNotFound(rw)
+		return
+	}
+	if err != nil {
+		httpapi.Write(r.Context(), rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Failed to delete scheduled task.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func parseScheduledTaskID(rw http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "task"))
+	if err != nil {
+		httpapi.Write(r.Context(), rw, http.StatusBadRequest, codersdk.Response{
+			Message: "Invalid scheduled task ID.",
+			Detail:  err.Error(),
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
 type listeningPortsHandler struct {
 	ignorePorts   map[int]string
 	cacheDuration time.Duration
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
@@ -15,6 +16,16 @@ import (
 	"github.com/coder/retry"
 )
 
+const (
+	// appHealthHeartbeatMinInterval is how often the health of apps is
+	// reported after it changed, even if it doesn't change again, so
+	// latencies and errors are kept up to date.
+	appHealthHeartbeatMinInterval = 30 * time.Second
+	// appHealthHeartbeatMaxInterval bounds the heartbeat interval, which
+	// doubles while the health of apps is stable.
+	appHealthHeartbeatMaxInterval = 5 * time.Minute
+)
+
 // WorkspaceAgentApps fetches the workspace apps.
 type WorkspaceAgentApps func(context.Context) ([]codersdk.WorkspaceApp, error)
 
@@ -25,7 +36,11 @@ type PostWorkspaceAgentAppHealth func(context.Context, agentsdk.PostAppHealthsRe
 type WorkspaceAppHealthReporter func(ctx context.Context)
 
 // NewWorkspaceAppHealthReporter creates a WorkspaceAppHealthReporter that reports app health to coderd.
-func NewWorkspaceAppHealthReporter(logger slog.Logger, apps []codersdk.WorkspaceApp, postWorkspaceAgentAppHealth PostWorkspaceAgentAppHealth) WorkspaceAppHealthReporter {
+// Health checks use proxy to select the proxy of requests, the proxy environment variables are used if nil.
+func NewWorkspaceAppHealthReporter(logger slog.Logger, apps []codersdk.WorkspaceApp, postWorkspaceAgentAppHealth PostWorkspaceAgentAppHealth, proxy func(*http.Request) (*url.URL, error)) WorkspaceAppHealthReporter {
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
 	logger = logger.Named("apphealth")
 
 	runHealthcheckLoop := func(ctx context.Context) error {
@@ -39,11 +54,13 @@ func NewWorkspaceAppHealthReporter(logger slog.Logger, apps []codersdk.Workspace
 
 		hasHealthchecksEnabled := false
 		health := make(map[uuid.UUID]codersdk.WorkspaceAppHealth, 0)
+		reports := make(map[uuid.UUID]agentsdk.AppHealthReport, 0)
 		for _, app := range apps {
 			if app.Health == codersdk.WorkspaceAppHealthDisabled {
 				continue
 			}
 			health[app.ID] = app.Health
+			reports[app.ID] = agentsdk.AppHealthReport{Health: app.Health}
 			hasHealthchecksEnabled = true
 		}
 
@@ -52,6 +69,10 @@ func NewWorkspaceAppHealthReporter(logger slog.Logger, apps []codersdk.Workspace
 			return nil
 		}
 
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = proxy
+		defer transport.CloseIdleConnections()
+
 		// run a ticker for each app health check.
 		var mu sync.RWMutex
 		failures := make(map[uuid.UUID]int, 0)
@@ -72,8 +93,10 @@ func NewWorkspaceAppHealthReporter(logger slog.Logger, apps []codersdk.Workspace
 					}
 					// we set the http timeout to the healthcheck interval to prevent getting too backed up.
 					client := &http.Client{
-						Timeout: time.Duration(app.Healthcheck.Interval) * time.Second,
+						Timeout:   time.Duration(app.Healthcheck.Interval) * time.Second,
+						Transport: transport,
 					}
+					start := time.Now()
 					err := func() error {
 						req, err := http.NewRequestWithContext(ctx, http.MethodGet, app.Healthcheck.URL, nil)
 						if err != nil {
@@ -91,7 +114,12 @@ func NewWorkspaceAppHealthReporter(logger slog.Logger, apps []codersdk.Workspace
 
 						return nil
 					}()
+					report := agentsdk.AppHealthReport{
+						LatencyMilliseconds: float64(time.Since(start).Microseconds()) / 1000,
+						CheckedAt:           time.Now(),
+					}
 					if err != nil {
+						report.Error = err.Error()
 						nowUnhealthy := false
 						mu.Lock()
 						if failures[app.ID] < int(app.Healthcheck.Threshold) {
@@ -104,6 +132,8 @@ func NewWorkspaceAppHealthReporter(logger slog.Logger, apps []codersdk.Workspace
 							health[app.ID] = codersdk.WorkspaceAppHealthUnhealthy
 							nowUnhealthy = true
 						}
+						report.Health = health[app.ID]
+						reports[app.ID] = report
 						mu.Unlock()
 						logger.Debug(ctx, "error checking app health",
 							slog.F("id", app.ID.String()),
@@ -115,6 +145,8 @@ func NewWorkspaceAppHealthReporter(logger slog.Logger, apps []codersdk.Workspace
 						// we only need one successful health check to be considered healthy.
 						health[app.ID] = codersdk.WorkspaceAppHealthHealthy
 						failures[app.ID] = 0
+						report.Health = health[app.ID]
+						reports[app.ID] = report
 						mu.Unlock()
 						logger.Debug(ctx, "workspace app healthy", slog.F("id", app.ID.String()), slog.F("slug", app.Slug))
 					}
@@ -129,25 +161,39 @@ func NewWorkspaceAppHealthReporter(logger slog.Logger, apps []codersdk.Workspace
 		mu.Unlock()
 		reportTicker := time.NewTicker(time.Second)
 		defer reportTicker.Stop()
+		heartbeatInterval := appHealthHeartbeatMinInterval
+		nextHeartbeat := time.Now().Add(heartbeatInterval)
 		// every second we check if the health values of the apps have changed
-		// and if there is a change we will report the new values.
+		// and if there is a change we will report the new values. All
+		// values are reported on a heartbeat too, which slows down while
+		// the health doesn't change.
 		for {
 			select {
 			case <-ctx.Done():
 				return nil
-			case <-reportTicker.C:
+			case now := <-reportTicker.C:
 				mu.RLock()
 				changed := healthChanged(lastHealth, health)
 				mu.RUnlock()
-				if !changed {
+				if changed {
+					heartbeatInterval = appHealthHeartbeatMinInterval
+				} else if now.Before(nextHeartbeat) {
 					continue
+				} else {
+					heartbeatInterval = min(2*heartbeatInterval, appHealthHeartbeatMaxInterval)
 				}
+				nextHeartbeat = now.Add(heartbeatInterval)
 
 				mu.Lock()
 				lastHealth = copyHealth(health)
+				lastReports := make(map[uuid.UUID]agentsdk.AppHealthReport, len(reports))
+				for id, report := range reports {
+					lastReports[id] = report
+				}
 				mu.Unlock()
 				err := postWorkspaceAgentAppHealth(ctx, agentsdk.PostAppHealthsRequest{
 					Healths: lastHealth,
+					Reports: lastReports,
 				})
 				if err != nil {
 					logger.Error(ctx, "failed to report workspace app health", slog.Error(err))
@@ -177,6 +177,53 @@ func TestAppHealth_NotSpamming(t *testing.T) {
 	require.LessOrEqual(t, atomic.LoadInt32(counter), int32(2))
 }
 
+func TestAppHealth_Reports(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), testutil.WaitLong)
+	defer cancel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpapi.Write(r.Context(), w, http.StatusInternalServerError, nil)
+	}))
+	defer srv.Close()
+	app := codersdk.WorkspaceApp{
+		ID:   uuid.New(),
+		Slug: "app",
+		Healthcheck: codersdk.Healthcheck{
+			URL:       srv.URL,
+			Interval:  1,
+			Threshold: 1,
+		},
+		Health: codersdk.WorkspaceAppHealthInitializing,
+	}
+
+	reqs := make(chan agentsdk.PostAppHealthsRequest, 1)
+	go agent.NewWorkspaceAppHealthReporter(slogtest.Make(t, nil), []codersdk.WorkspaceApp{app}, func(ctx context.Context, req agentsdk.PostAppHealthsRequest) error {
+		select {
+		case reqs <- req:
+		case <-ctx.Done():
+		}
+		return nil
+	}, nil)(ctx)
+
+	for {
+		var req agentsdk.PostAppHealthsRequest
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for an unhealthy report")
+		case req = <-reqs:
+		}
+		report := req.Reports[app.ID]
+		if report.Health != codersdk.WorkspaceAppHealthUnhealthy {
+			continue
+		}
+		require.Equal(t, codersdk.WorkspaceAppHealthUnhealthy, req.Healths[app.ID])
+		require.Equal(t, "error status code: 500", report.Error)
+		require.False(t, report.CheckedAt.IsZero())
+		require.GreaterOrEqual(t, report.LatencyMilliseconds, float64(0))
+		return
+	}
+}
+
 func setupAppReporter(ctx context.Context, t *testing.T, apps []codersdk.WorkspaceApp, handlers []http.Handler) (agent.WorkspaceAgentApps, func()) {
 	closers := []func(){}
 	for i, app := range apps {
@@ -239,7 +286,7 @@ func setupAppReporter(ctx context.Context, t *testing.T, apps []codersdk.Workspa
 		}
 	}()
 
-	go agent.NewWorkspaceAppHealthReporter(slogtest.Make(t, nil).Leveled(slog.LevelDebug), apps, agentsdk.AppHealthPoster(fakeAAPI))(ctx)
+	go agent.NewWorkspaceAppHealthReporter(slogtest.Make(t, nil).Leveled(slog.LevelDebug), apps, agentsdk.AppHealthPoster(fakeAAPI), nil)(ctx)
 
 	return workspaceAgentApps, func() {
 		for _, closeFn := range closers {
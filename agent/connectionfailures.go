@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	"tailscale.com/tailcfg"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/tailnet"
+)
+
+const (
+	// maxConnectionFailures is the number of distinct failures kept while
+	// the agent is disconnected. The oldest failures are dropped first.
+	maxConnectionFailures = 20
+	// derpConnectivityTimeout is how long the agent waits for a connection
+	// to a DERP region before collecting diagnostics.
+	derpConnectivityTimeout = 30 * time.Second
+)
+
+// connectionFailures buffers connection failure diagnostics until they can
+// be reported to coderd. Consecutive failures with the same error are
+// counted instead of being diagnosed again.
+type connectionFailures struct {
+	mu       sync.Mutex
+	failures []agentsdk.ConnectionFailure
+}
+
+func (c *connectionFailures) record(stage agentsdk.ConnectionFailureStage, err error, diagnose func() agentsdk.ConnectionFailure) {
+	c.mu.Lock()
+	if n := len(c.failures); n > 0 {
+		last := &c.failures[n-1]
+		if last.Stage == stage && last.Error == err.Error() {
+			last.Count++
+			last.LastSeenAt = time.Now()
+			c.mu.Unlock()
+			return
+		}
+	}
+	c.mu.Unlock()
+
+	// Diagnosing makes network requests, so it's done without the lock.
+	failure := diagnose()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = append(c.failures, failure)
+	if len(c.failures) > maxConnectionFailures {
+		c.failures = c.failures[len(c.failures)-maxConnectionFailures:]
+	}
+}
+
+// report posts the buffered failures. They're only dropped once the post
+// succeeds.
+func (c *connectionFailures) report(ctx context.Context, post func(context.Context, agentsdk.PostConnectionFailuresRequest) error) error {
+	c.mu.Lock()
+	failures := make([]agentsdk.ConnectionFailure, len(c.failures))
+	copy(failures, c.failures)
+	c.mu.Unlock()
+	if len(failures) == 0 {
+		return nil
+	}
+
+	err := post(ctx, agentsdk.PostConnectionFailuresRequest{Failures: failures})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Failures may have been recorded or counted concurrently, only drop
+	// what was reported.
+	type failureKey struct {
+		stage     agentsdk.ConnectionFailureStage
+		err       string
+		firstSeen int64
+	}
+	reported := make(map[failureKey]int, len(failures))
+	for _, failure := range failures {
+		reported[failureKey{failure.Stage, failure.Error, failure.FirstSeenAt.UnixNano()}] = failure.Count
+	}
+	remaining := make([]agentsdk.ConnectionFailure, 0)
+	for _, failure := range c.failures {
+		count, ok := reported[failureKey{failure.Stage, failure.Error, failure.FirstSeenAt.UnixNano()}]
+		if ok && failure.Count <= count {
+			continue
+		}
+		failure.Count -= count
+		remaining = append(remaining, failure)
+	}
+	c.failures = remaining
+	return nil
+}
+
+// recordCoderdFailure records a failed connection to coderd.
+func (a *agent) recordCoderdFailure(ctx context.Context, err error) {
+	if ctx.Err() != nil || a.isClosed() {
+		return
+	}
+	// coderd was reached if it responded with an error.
+	var sdkErr *codersdk.Error
+	if xerrors.As(err, &sdkErr) {
+		return
+	}
+	a.connectionFailures.record(agentsdk.ConnectionFailureStageCoderd, err, func() agentsdk.ConnectionFailure {
+		a.logger.Debug(ctx, "diagnosing coderd connection failure", slog.Error(err))
+		return a.client.DiagnoseConnectionFailure(ctx, err)
+	})
+}
+
+// reportConnectionFailures reports the failures that happened while the
+// agent was disconnected. Errors are logged since the failures are retried
+// after the next reconnection.
+func (a *agent) reportConnectionFailures(ctx context.Context) {
+	err := a.connectionFailures.report(ctx, a.client.PostConnectionFailures)
+	if err != nil {
+		a.logger.Warn(ctx, "failed to report connection failures", slog.Error(err))
+	}
+}
+
+// checkDERPConnectivity collects diagnostics for every DERP region if the
+// agent hasn't connected to a home DERP region within
+// derpConnectivityTimeout.
+func (a *agent) checkDERPConnectivity(ctx context.Context, network *tailnet.Conn, derpMap *tailcfg.DERPMap) {
+	if derpMap == nil || len(derpMap.Regions) == 0 {
+		return
+	}
+	timer := time.NewTimer(derpConnectivityTimeout)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+	if node := network.Node(); node == nil || node.PreferredDERP != 0 {
+		return
+	}
+
+	a.logger.Warn(ctx, "no connection to a DERP region, collecting diagnostics")
+	for _, derpURL := range derpURLs(derpMap) {
+		derpURL := derpURL
+		err := xerrors.Errorf("no connection to DERP server %s", derpURL.Host)
+		a.connectionFailures.record(agentsdk.ConnectionFailureStageDERP, err, func() agentsdk.ConnectionFailure {
+			return agentsdk.DiagnoseConnectionFailure(ctx, http.DefaultClient, agentsdk.ConnectionFailureStageDERP, derpURL, err)
+		})
+	}
+	a.reportConnectionFailures(ctx)
+}
+
+// derpURLs returns the URL of the first DERP node of every region, ordered by
+// region ID.
+func derpURLs(derpMap *tailcfg.DERPMap) []*url.URL {
+	regionIDs := make([]int, 0, len(derpMap.Regions))
+	for id := range derpMap.Regions {
+		regionIDs = append(regionIDs, id)
+	}
+	sort.Ints(regionIDs)
+
+	urls := make([]*url.URL, 0, len(regionIDs))
+	for _, id := range regionIDs {
+		region := derpMap.Regions[id]
+		if region == nil {
+			continue
+		}
+		for _, node := range region.Nodes {
+			if node.STUNOnly || node.HostName == "" {
+				continue
+			}
+			u := &url.URL{
+				Scheme: "https",
+				Host:   node.HostName,
+				Path:   "/derp",
+			}
+			if node.ForceHTTP {
+				u.Scheme = "http"
+			}
+			if node.DERPPort != 0 {
+				u.Host = net.JoinHostPort(node.HostName, strconv.Itoa(node.DERPPort))
+			}
+			urls = append(urls, u)
+			break
+		}
+	}
+	return urls
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"tailscale.com/tailcfg"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+func TestConnectionFailures(t *testing.T) {
+	t.Parallel()
+
+	var failures connectionFailures
+	diagnosed := 0
+	record := func(err error) {
+		failures.record(agentsdk.ConnectionFailureStageCoderd, err, func() agentsdk.ConnectionFailure {
+			diagnosed++
+			return agentsdk.ConnectionFailure{
+				Stage:       agentsdk.ConnectionFailureStageCoderd,
+				Error:       err.Error(),
+				Count:       1,
+				FirstSeenAt: time.Now(),
+			}
+		})
+	}
+	record(xerrors.New("dial tcp: connection refused"))
+	record(xerrors.New("dial tcp: connection refused"))
+	record(xerrors.New("x509: certificate signed by unknown authority"))
+	// Consecutive failures with the same error are only diagnosed once.
+	require.Equal(t, 2, diagnosed)
+
+	var posted []agentsdk.ConnectionFailure
+	err := failures.report(context.Background(), func(_ context.Context, req agentsdk.PostConnectionFailuresRequest) error {
+		// A failure happening while reporting must be kept.
+		record(xerrors.New("x509: certificate signed by unknown authority"))
+		posted = req.Failures
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, posted, 2)
+	require.Equal(t, 2, posted[0].Count)
+	require.Equal(t, 1, posted[1].Count)
+	require.Len(t, failures.failures, 1)
+	require.Equal(t, 1, failures.failures[0].Count)
+
+	err = failures.report(context.Background(), func(context.Context, agentsdk.PostConnectionFailuresRequest) error {
+		return xerrors.New("unavailable")
+	})
+	require.Error(t, err)
+	require.Len(t, failures.failures, 1, "failures must be kept if reporting fails")
+}
+
+func TestDERPURLs(t *testing.T) {
+	t.Parallel()
+
+	urls := derpURLs(&tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			2: {Nodes: []*tailcfg.DERPNode{{HostName: "stun.example.com", STUNOnly: true}, {HostName: "derp.example.com", DERPPort: 8443}}},
+			1: {Nodes: []*tailcfg.DERPNode{{HostName: "coder.example.com", ForceHTTP: true}}},
+		},
+	})
+	require.Len(t, urls, 2)
+	require.Equal(t, "http://coder.example.com/derp", urls[0].String())
+	require.Equal(t, "https://derp.example.com:8443/derp", urls[1].String())
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coder/coder/v2/agent/agentscripts"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// redactedValue replaces secrets in the debug dump.
+const redactedValue = "<redacted>"
+
+// debugManifest is the effective configuration of the agent served on the
+// debug endpoint, so it can be inspected from within the workspace without
+// access to coderd. Any local process can read it, so the values of
+// environment variables and the bodies of scripts are redacted: they're
+// where templates put secrets, and their names can't tell which do.
+type debugManifest struct {
+	Manifest agentsdk.Manifest `json:"manifest"`
+	// Environment is the environment of scripts and SSH sessions.
+	Environment map[string]string           `json:"environment"`
+	Scripts     []agentscripts.ScriptStatus `json:"scripts"`
+}
+
+func (a *agent) handleHTTPDebugManifest(w http.ResponseWriter, r *http.Request) {
+	manifest := a.manifest.Load()
+	if manifest == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("manifest is not ready yet"))
+		return
+	}
+	cmd, err := a.sshServer.CreateCommand(r.Context(), "", nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("resolve environment: " + err.Error()))
+		return
+	}
+	scripts := a.scriptRunner.ScriptStatuses()
+	for i := range scripts {
+		scripts[i].Script.Script = redactedValue
+	}
+	dump := debugManifest{
+		Manifest:    sanitizeManifest(*manifest),
+		Environment: sanitizeEnviron(cmd.Env),
+		Scripts:     scripts,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(dump)
+}
+
+// sanitizeManifest redacts the environment variables, scripts and proxy
+// credentials of the manifest.
+func sanitizeManifest(manifest agentsdk.Manifest) agentsdk.Manifest {
+	env := make(map[string]string, len(manifest.EnvironmentVariables))
+	for key := range manifest.EnvironmentVariables {
+		env[key] = redactedValue
+	}
+	manifest.EnvironmentVariables = env
+	scripts := make([]codersdk.WorkspaceAgentScript, len(manifest.Scripts))
+	for i, script := range manifest.Scripts {
+		script.Script = redactedValue
+		scripts[i] = script
+	}
+	manifest.Scripts = scripts
+	metadata := make([]codersdk.WorkspaceAgentMetadataDescription, len(manifest.Metadata))
+	for i, md := range manifest.Metadata {
+		if md.Script != "" {
+			md.Script = redactedValue
+		}
+		metadata[i] = md
+	}
+	manifest.Metadata = metadata
+	if manifest.Proxy != nil {
+		proxy := *manifest.Proxy
+		proxy.HTTPProxy = redactURLPassword(proxy.HTTPProxy)
+		proxy.HTTPSProxy = redactURLPassword(proxy.HTTPSProxy)
+		manifest.Proxy = &proxy
+	}
+	return manifest
+}
+
+// sanitizeEnviron converts the environment to a map, in which later
+// variables override earlier ones like they do for processes, and redacts
+// the values.
+func sanitizeEnviron(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		key, _, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		env[key] = redactedValue
+	}
+	return env
+}
+
+// redactURLPassword redacts the password of the value if it's a URL with
+// one.
+func redactURLPassword(value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	return u.Redacted()
+}
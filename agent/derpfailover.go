@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/tailnet"
+)
+
+// runDERPMapFailover fails over through the DERP map fallbacks of the
+// manifest while the agent isn't connected to a relay of the current
+// regions. Every fallback gets derpConnectivityTimeout to connect, like the
+// primary regions.
+func (a *agent) runDERPMapFailover(ctx context.Context, network *tailnet.Conn, failover *agentsdk.DERPMapFailover) {
+	ticker := time.NewTicker(derpConnectivityTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := failover.Current()
+		next, ok := failDERPMapRegions(network.Node(), failover)
+		if !ok {
+			continue
+		}
+		a.logger.Warn(ctx, "no connection to a DERP region, failing over to the next DERP regions",
+			slog.F("from", current), slog.F("to", next))
+	}
+}
+
+// failDERPMapRegions fails the current regions over if the node isn't
+// connected to a relay. It returns the name of the regions failed over to,
+// and is false if the current regions are kept.
+func failDERPMapRegions(node *tailnet.Node, failover *agentsdk.DERPMapFailover) (string, bool) {
+	if node == nil || node.PreferredDERP != 0 {
+		return "", false
+	}
+	current := failover.Current()
+	next := failover.Fail(current)
+	return next, next != current
+}
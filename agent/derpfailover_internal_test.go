@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/tailnet"
+)
+
+func TestFailDERPMapRegions(t *testing.T) {
+	t.Parallel()
+
+	fallback := &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{2: {RegionID: 2}}}
+	derpMap, err := agentsdk.DERPMapWithFallbacks(&tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{1: {RegionID: 1}},
+	}, []agentsdk.DERPMapSource{{Name: "fallback", DERPMap: fallback}})
+	require.NoError(t, err)
+	var applied *tailcfg.DERPMap
+	failover := agentsdk.NewDERPMapFailover(agentsdk.Manifest{
+		DERPMap:          derpMap,
+		DERPMapFallbacks: []agentsdk.DERPMapSource{{Name: "fallback", DERPMap: fallback}},
+	}, func(derpMap *tailcfg.DERPMap) {
+		applied = derpMap
+	})
+
+	// Nodes connected to a relay keep the current regions.
+	_, ok := failDERPMapRegions(&tailnet.Node{PreferredDERP: 1}, failover)
+	require.False(t, ok)
+	_, ok = failDERPMapRegions(nil, failover)
+	require.False(t, ok)
+	require.Nil(t, applied)
+
+	next, ok := failDERPMapRegions(&tailnet.Node{}, failover)
+	require.True(t, ok)
+	require.Equal(t, "fallback", next)
+	require.True(t, applied.Regions[1].Avoid)
+	require.False(t, applied.Regions[2].Avoid)
+
+	next, ok = failDERPMapRegions(&tailnet.Node{}, failover)
+	require.True(t, ok)
+	require.Equal(t, agentsdk.DERPMapSourcePrimary, next)
+	require.False(t, applied.Regions[1].Avoid)
+	require.True(t, applied.Regions[2].Avoid)
+}
+
+func TestFailDERPMapRegions_NoFallbacks(t *testing.T) {
+	t.Parallel()
+
+	failover := agentsdk.NewDERPMapFailover(agentsdk.Manifest{
+		DERPMap: &tailcfg.DERPMap{},
+	}, func(*tailcfg.DERPMap) {
+		t.Fatal("the DERP map must not change")
+	})
+	_, ok := failDERPMapRegions(&tailnet.Node{}, failover)
+	require.False(t, ok)
+}
@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/cli/clistat"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// diskWatchdogInterval is how often the disk usage of the paths watched by
+// cleanup scripts is measured.
+const diskWatchdogInterval = time.Minute
+
+// diskWatchdogCleanupTimeout bounds cleanup scripts without a timeout of
+// their own, so a hanging cleanup doesn't stop the script from running on
+// the next crossing.
+const diskWatchdogCleanupTimeout = 10 * time.Minute
+
+// diskWatchdog runs cleanup scripts once the disk usage of their path
+// crosses their threshold, so a workspace filling its volume with caches
+// or build artifacts can recover before it becomes unusable. A script runs
+// once per crossing: if it doesn't bring the usage below the threshold, it
+// runs again only after the usage dropped below the threshold.
+//
+// Cleanup scripts run in the background, so a slow script doesn't delay
+// measuring the paths of the others.
+type diskWatchdog struct {
+	logger slog.Logger
+	// usage returns the disk usage of the path in percent.
+	usage func(path string) (float64, error)
+	// execute runs the script with the log source ID.
+	execute   func(ctx context.Context, logSourceID uuid.UUID) error
+	patchLogs func(ctx context.Context, req agentsdk.PatchLogs) error
+	// notify notifies the workspace owner when a cleanup script doesn't
+	// bring the usage below the threshold.
+	notify func(ctx context.Context, notification agentsdk.Notification) error
+
+	mu sync.Mutex
+	// triggered are the scripts that ran since the usage of their path
+	// crossed the threshold.
+	triggered map[uuid.UUID]struct{}
+	// running are the scripts running at the moment.
+	running map[uuid.UUID]struct{}
+	wg      sync.WaitGroup
+}
+
+// check measures the disk usage of the paths watched by the scripts and
+// starts the scripts whose threshold is crossed.
+func (w *diskWatchdog) check(ctx context.Context, scripts []codersdk.WorkspaceAgentScript) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.triggered == nil {
+		w.triggered = map[uuid.UUID]struct{}{}
+		w.running = map[uuid.UUID]struct{}{}
+	}
+	for _, script := range scripts {
+		if script.DiskPressurePath == "" || script.DiskPressureThreshold <= 0 {
+			continue
+		}
+		if _, ok := w.running[script.LogSourceID]; ok {
+			continue
+		}
+		logger := w.logger.With(slog.F("log_source_id", script.LogSourceID), slog.F("path", script.DiskPressurePath))
+		threshold := float64(script.DiskPressureThreshold)
+		before, err := w.usage(script.DiskPressurePath)
+		if err != nil {
+			logger.Warn(ctx, "measure disk usage", slog.Error(err))
+			continue
+		}
+		if before < threshold {
+			delete(w.triggered, script.LogSourceID)
+			continue
+		}
+		if _, ok := w.triggered[script.LogSourceID]; ok {
+			continue
+		}
+		w.triggered[script.LogSourceID] = struct{}{}
+		w.running[script.LogSourceID] = struct{}{}
+
+		logger.Info(ctx, "disk usage crossed threshold, running cleanup script",
+			slog.F("usage", before), slog.F("threshold", script.DiskPressureThreshold))
+		w.log(ctx, script, codersdk.LogLevelInfo, "Disk usage of %s is %.1f%%, which crossed the threshold of %d%%, running cleanup script",
+			script.DiskPressurePath, before, script.DiskPressureThreshold)
+		script := script
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.cleanup(ctx, logger, script, before)
+		}()
+	}
+}
+
+// cleanup runs the cleanup script and reports the disk usage after it.
+func (w *diskWatchdog) cleanup(ctx context.Context, logger slog.Logger, script codersdk.WorkspaceAgentScript, before float64) {
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, script.LogSourceID)
+		w.mu.Unlock()
+	}()
+
+	timeout := diskWatchdogCleanupTimeout
+	if script.Timeout > 0 {
+		timeout = script.Timeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	err := w.execute(runCtx, script.LogSourceID)
+	cancel()
+	if err != nil {
+		logger.Warn(ctx, "run cleanup script", slog.Error(err))
+		w.log(ctx, script, codersdk.LogLevelError, "Cleanup script failed: %s", err)
+	}
+
+	after, err := w.usage(script.DiskPressurePath)
+	if err != nil {
+		logger.Warn(ctx, "measure disk usage", slog.Error(err))
+		return
+	}
+	if after >= float64(script.DiskPressureThreshold) {
+		w.log(ctx, script, codersdk.LogLevelWarn, "Disk usage of %s is still %.1f%% after the cleanup script, which is above the threshold of %d%%",
+			script.DiskPressurePath, after, script.DiskPressureThreshold)
+		err = w.notify(ctx, agentsdk.Notification{
+			Severity: agentsdk.NotificationSeverityWarning,
+			Kind:     agentsdk.NotificationKindLowDisk,
+			Title:    fmt.Sprintf("Disk of %s is almost full", script.DiskPressurePath),
+			Message: fmt.Sprintf("Disk usage of %s is %.1f%%, which is above the threshold of %d%% even after the cleanup script ran.",
+				script.DiskPressurePath, after, script.DiskPressureThreshold),
+			CreatedAt: time.Now(),
+			Labels: map[string]string{
+				"path":          script.DiskPressurePath,
+				"log_source_id": script.LogSourceID.String(),
+			},
+		})
+		if err != nil {
+			logger.Warn(ctx, "notify of low disk", slog.Error(err))
+		}
+		return
+	}
+	w.mu.Lock()
+	delete(w.triggered, script.LogSourceID)
+	w.mu.Unlock()
+	w.log(ctx, script, codersdk.LogLevelInfo, "Disk usage of %s is %.1f%% after the cleanup script, down from %.1f%%",
+		script.DiskPressurePath, after, before)
+}
+
+// wait waits for the running cleanup scripts to exit.
+func (w *diskWatchdog) wait() {
+	w.wg.Wait()
+}
+
+// log reports the watchdog's actions alongside the output of the script.
+func (w *diskWatchdog) log(ctx context.Context, script codersdk.WorkspaceAgentScript, level codersdk.LogLevel, format string, args ...any) {
+	err := w.patchLogs(ctx, agentsdk.PatchLogs{
+		LogSourceID: script.LogSourceID,
+		Logs: []agentsdk.Log{{
+			CreatedAt: time.Now(),
+			Output:    fmt.Sprintf(format, args...),
+			Level:     level,
+		}},
+	})
+	if err != nil {
+		w.logger.Warn(ctx, "send disk watchdog log", slog.F("log_source_id", script.LogSourceID), slog.Error(err))
+	}
+}
+
+// diskUsage returns the disk usage of the path in percent.
+func (a *agent) diskUsage(path string) (float64, error) {
+	statter, err := a.metadataCollectors.getStatter()
+	if err != nil {
+		return 0, xerrors.Errorf("create statter: %w", err)
+	}
+	result, err := statter.Disk(clistat.PrefixDefault, path)
+	if err != nil {
+		return 0, err
+	}
+	if result.Total == nil || *result.Total == 0 {
+		return 0, xerrors.Errorf("unknown size of the disk of %q", path)
+	}
+	return result.Used / *result.Total * 100, nil
+}
+
+// watchDiskUsageLoop runs the cleanup scripts of the manifest when the disk
+// usage of their path crosses their threshold.
+func (a *agent) watchDiskUsageLoop(ctx context.Context) {
+	watchdog := &diskWatchdog{
+		logger:    a.logger.Named("disk-watchdog"),
+		usage:     a.diskUsage,
+		execute:   a.scriptRunner.ExecuteScript,
+		patchLogs: a.patchLogs,
+		notify:    a.postNotification,
+	}
+	ticker := time.NewTicker(diskWatchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			watchdog.wait()
+			return
+		case <-ticker.C:
+		}
+		manifest := a.manifest.Load()
+		if manifest == nil {
+			continue
+		}
+		watchdog.check(ctx, manifest.Scripts)
+	}
+}
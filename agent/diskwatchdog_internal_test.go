@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestDiskWatchdog(t *testing.T) {
+	t.Parallel()
+
+	var (
+		usage         float64
+		executed      []uuid.UUID
+		logs          []agentsdk.Log
+		notifications []agentsdk.Notification
+	)
+	cleanup := codersdk.WorkspaceAgentScript{
+		LogSourceID:           uuid.New(),
+		Script:                "rm -rf ~/.cache",
+		DiskPressurePath:      "/home/coder",
+		DiskPressureThreshold: 90,
+	}
+	scripts := []codersdk.WorkspaceAgentScript{{
+		LogSourceID: uuid.New(),
+		Script:      "echo start",
+		RunOnStart:  true,
+	}, cleanup}
+	watchdog := &diskWatchdog{
+		logger: slogtest.Make(t, nil),
+		usage: func(path string) (float64, error) {
+			require.Equal(t, cleanup.DiskPressurePath, path)
+			return usage, nil
+		},
+		execute: func(_ context.Context, logSourceID uuid.UUID) error {
+			executed = append(executed, logSourceID)
+			usage = 50
+			return nil
+		},
+		patchLogs: func(_ context.Context, req agentsdk.PatchLogs) error {
+			require.Equal(t, cleanup.LogSourceID, req.LogSourceID)
+			logs = append(logs, req.Logs...)
+			return nil
+		},
+		notify: func(_ context.Context, notification agentsdk.Notification) error {
+			notifications = append(notifications, notification)
+			return nil
+		},
+	}
+	ctx := context.Background()
+
+	usage = 80
+	watchdog.check(ctx, scripts)
+	watchdog.wait()
+	require.Empty(t, executed)
+
+	usage = 95
+	watchdog.check(ctx, scripts)
+	watchdog.wait()
+	require.Equal(t, []uuid.UUID{cleanup.LogSourceID}, executed)
+	require.Len(t, logs, 2)
+	require.Equal(t, "Disk usage of /home/coder is 95.0%, which crossed the threshold of 90%, running cleanup script", logs[0].Output)
+	require.Equal(t, "Disk usage of /home/coder is 50.0% after the cleanup script, down from 95.0%", logs[1].Output)
+
+	// The script runs again once the usage crosses the threshold again.
+	usage = 92
+	watchdog.check(ctx, scripts)
+	watchdog.wait()
+	require.Len(t, executed, 2)
+	require.Empty(t, notifications)
+
+	// A cleanup that doesn't free enough space runs once per crossing.
+	watchdog.execute = func(_ context.Context, logSourceID uuid.UUID) error {
+		executed = append(executed, logSourceID)
+		return nil
+	}
+	usage = 96
+	watchdog.check(ctx, scripts)
+	watchdog.wait()
+	require.Len(t, executed, 3)
+	require.Equal(t, codersdk.LogLevelWarn, logs[len(logs)-1].Level)
+	require.Len(t, notifications, 1)
+	require.Equal(t, agentsdk.NotificationSeverityWarning, notifications[0].Severity)
+	require.Equal(t, agentsdk.NotificationKindLowDisk, notifications[0].Kind)
+	require.Equal(t, "/home/coder", notifications[0].Labels["path"])
+	require.NoError(t, notifications[0].Validate())
+	watchdog.check(ctx, scripts)
+	watchdog.wait()
+	require.Len(t, executed, 3)
+	require.Len(t, notifications, 1)
+}
+
+func TestDiskWatchdogHangingCleanup(t *testing.T) {
+	t.Parallel()
+
+	hanging := codersdk.WorkspaceAgentScript{
+		LogSourceID:           uuid.New(),
+		Script:                "sleep infinity",
+		DiskPressurePath:      "/home/coder",
+		DiskPressureThreshold: 90,
+	}
+	cleanup := codersdk.WorkspaceAgentScript{
+		LogSourceID:           uuid.New(),
+		Script:                "rm -rf ~/.cache",
+		DiskPressurePath:      "/var/cache",
+		DiskPressureThreshold: 90,
+	}
+	var (
+		mu       sync.Mutex
+		executed []uuid.UUID
+	)
+	started := make(chan time.Time, 1)
+	watchdog := &diskWatchdog{
+		logger: slogtest.Make(t, nil),
+		usage: func(string) (float64, error) {
+			return 95, nil
+		},
+		execute: func(ctx context.Context, logSourceID uuid.UUID) error {
+			mu.Lock()
+			executed = append(executed, logSourceID)
+			mu.Unlock()
+			if logSourceID != hanging.LogSourceID {
+				return nil
+			}
+			// The script hangs until it's canceled, which it is at the
+			// latest after the cleanup timeout.
+			deadline, _ := ctx.Deadline()
+			started <- deadline
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		patchLogs: func(context.Context, agentsdk.PatchLogs) error {
+			return nil
+		},
+		notify: func(context.Context, agentsdk.Notification) error {
+			return nil
+		},
+	}
+	// The context has no deadline of its own, so the script's is the
+	// cleanup timeout.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testCtx := testutil.Context(t, testutil.WaitShort)
+
+	// The hanging script runs in the background, so check returns and
+	// doesn't run the script again while it's running.
+	scripts := []codersdk.WorkspaceAgentScript{hanging, cleanup}
+	watchdog.check(ctx, scripts)
+	deadline := testutil.RequireRecvCtx(testCtx, t, started)
+	require.WithinDuration(t, time.Now().Add(diskWatchdogCleanupTimeout), deadline, time.Minute)
+	watchdog.check(ctx, scripts)
+
+	cancel()
+	watchdog.wait()
+	require.ElementsMatch(t, []uuid.UUID{hanging.LogSourceID, cleanup.LogSourceID}, executed)
+	require.Empty(t, watchdog.running)
+}
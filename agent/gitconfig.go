@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/agent/agentgit"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// gitConfigLogSourceID is the log source of the Git configuration. It's
+// statically defined, so restarts of the agent don't create new sources.
+var gitConfigLogSourceID = uuid.MustParse("e715bf64-933b-4b78-b803-3c6091b811db")
+
+// applyGitConfig sets the Git identity of the owner of the workspace, and the
+// agent as credential helper if the deployment has Git external auth
+// providers. The changes are shown in the "Git" log source.
+func (a *agent) applyGitConfig(ctx context.Context, manifest agentsdk.Manifest) {
+	logger := a.logger.Named("git")
+	cfg := agentgit.Config{
+		UserName:  manifest.OwnerName,
+		UserEmail: manifest.OwnerEmail,
+	}
+	if manifest.GitAuthConfigs > 0 {
+		cfg.CredentialHelper = a.gitCredentialHelper
+		cfg.CredentialHelperRegex = a.gitCredentialHelperRegex
+	}
+	changes, err := agentgit.Configure(ctx, cfg)
+
+	logs := make([]agentsdk.Log, 0, len(changes)+1)
+	for _, change := range changes {
+		logs = append(logs, agentsdk.Log{CreatedAt: time.Now(), Output: change, Level: codersdk.LogLevelInfo})
+	}
+	switch {
+	case errors.Is(err, agentgit.ErrGitNotFound):
+		logs = append(logs, agentsdk.Log{CreatedAt: time.Now(), Output: "Git is not installed, skipping its configuration", Level: codersdk.LogLevelWarn})
+	case err != nil:
+		logger.Warn(ctx, "configure git", slog.Error(err))
+		logs = append(logs, agentsdk.Log{CreatedAt: time.Now(), Output: "Failed to configure Git: " + err.Error(), Level: codersdk.LogLevelError})
+	}
+	if len(logs) == 0 {
+		return
+	}
+
+	_, err = a.client.PostLogSource(ctx, agentsdk.PostLogSource{
+		ID:          gitConfigLogSourceID,
+		DisplayName: "Git",
+		Icon:        "/icon/git.svg",
+	})
+	if err != nil {
+		logger.Warn(ctx, "create git log source", slog.Error(err))
+		return
+	}
+	err = a.patchLogs(ctx, agentsdk.PatchLogs{
+		LogSourceID: gitConfigLogSourceID,
+		Logs:        logs,
+	})
+	if err != nil {
+		logger.Warn(ctx, "send git logs", slog.Error(err))
+	}
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/cli/clistat"
+	"github.com/coder/coder/v2/codersdk"
+)
+
+// metadataCollectors collect metadata with the built-in collectors instead
+// of running scripts. They read the usage and limits of the container's
+// cgroup when the agent runs in a container, and fall back to the totals of
+// the host otherwise.
+type metadataCollectors struct {
+	mu      sync.Mutex
+	statter *clistat.Statter
+}
+
+// getStatter returns the statter, which is created on first use since
+// collecting host information may be expensive.
+func (c *metadataCollectors) getStatter() (*clistat.Statter, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.statter != nil {
+		return c.statter, nil
+	}
+	statter, err := clistat.New()
+	if err != nil {
+		return nil, err
+	}
+	c.statter = statter
+	return statter, nil
+}
+
+// collect returns the metadata collected by the collector.
+func (c *metadataCollectors) collect(collector codersdk.WorkspaceAgentMetadataCollector, now time.Time) *codersdk.WorkspaceAgentMetadataResult {
+	result := &codersdk.WorkspaceAgentMetadataResult{
+		// See collectMetadata.
+		CollectedAt: now,
+	}
+	value, err := c.measure(collector)
+	if err != nil {
+		result.Error = fmt.Sprintf("collect %s: %+v", collector, err)
+		return result
+	}
+	result.Value = value.String()
+	return result
+}
+
+func (c *metadataCollectors) measure(collector codersdk.WorkspaceAgentMetadataCollector) (*clistat.Result, error) {
+	statter, err := c.getStatter()
+	if err != nil {
+		return nil, xerrors.Errorf("create statter: %w", err)
+	}
+	switch collector {
+	case codersdk.WorkspaceAgentMetadataCollectorCPU:
+		// The container's usage is nil outside of containers.
+		result, err := statter.ContainerCPU()
+		if err != nil || result != nil {
+			return result, err
+		}
+		return statter.HostCPU()
+	case codersdk.WorkspaceAgentMetadataCollectorMemory:
+		result, err := statter.ContainerMemory(clistat.PrefixGibi)
+		if err != nil || result != nil {
+			return result, err
+		}
+		return statter.HostMemory(clistat.PrefixGibi)
+	case codersdk.WorkspaceAgentMetadataCollectorDisk:
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, xerrors.Errorf("get home directory: %w", err)
+		}
+		return statter.Disk(clistat.PrefixGibi, home)
+	default:
+		return nil, xerrors.Errorf("unknown collector %q", collector)
+	}
+}
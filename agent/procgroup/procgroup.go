@@ -0,0 +1,127 @@
+// Package procgroup starts commands in a process group, so the processes
+// they start are stopped along with them. On Unix the group is a new session,
+// on Windows a job object.
+package procgroup
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DefaultKillDelay is how long a stopped group has to exit before it's
+// killed, if Options.KillDelay isn't set.
+const DefaultKillDelay = 10 * time.Second
+
+// Options configure a Group.
+type Options struct {
+	// KillDelay is how long the group has to exit after it's sent the stop
+	// signal before it's killed. It's also the WaitDelay of the command.
+	// Defaults to DefaultKillDelay.
+	KillDelay time.Duration
+}
+
+// Group is the process group of a command.
+type Group struct {
+	cmd       *exec.Cmd
+	killDelay time.Duration
+
+	mu        sync.Mutex
+	started   bool
+	stopped   bool
+	closed    bool
+	killTimer *time.Timer
+	// job is the job object of the group on Windows.
+	job uintptr
+}
+
+// New configures cmd to start in a new process group. When the context of
+// cmd is canceled, the group is stopped, see Stop. cmd must be created with
+// exec.CommandContext and started with Start, and Close must be called once
+// it exited.
+func New(cmd *exec.Cmd, opts Options) *Group {
+	if opts.KillDelay == 0 {
+		opts.KillDelay = DefaultKillDelay
+	}
+	g := &Group{
+		cmd:       cmd,
+		killDelay: opts.KillDelay,
+	}
+	cmd.SysProcAttr = sysProcAttr(cmd.SysProcAttr)
+	cmd.Cancel = g.Stop
+	cmd.WaitDelay = opts.KillDelay
+	return g
+}
+
+// Start starts the command and adds it to the group.
+func (g *Group) Start() error {
+	err := g.cmd.Start()
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.started = true
+	g.assign()
+	return nil
+}
+
+// Stop sends the stop signal to the group, SIGHUP on Unix, and kills the
+// group if it's still running after the kill delay. Console processes can't
+// be signaled on Windows, so the group is killed right away.
+func (g *Group) Stop() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.started || g.closed {
+		return os.ErrProcessDone
+	}
+	if g.stopped {
+		return nil
+	}
+	g.stopped = true
+	g.killTimer = time.AfterFunc(g.killDelay, func() {
+		_ = g.Kill()
+	})
+	return g.signal()
+}
+
+// Kill kills all processes of the group.
+func (g *Group) Kill() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.started || g.closed {
+		return os.ErrProcessDone
+	}
+	if g.killTimer != nil {
+		g.killTimer.Stop()
+	}
+	return g.kill()
+}
+
+// Close releases the group. Processes of a stopped group that are still
+// running are killed, since they ignored the stop signal; those of a group
+// that wasn't stopped are left running, like the children of a command that
+// exited on its own.
+func (g *Group) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	if !g.started {
+		return nil
+	}
+	var err error
+	if g.stopped {
+		g.killTimer.Stop()
+		err = g.kill()
+		if errors.Is(err, os.ErrProcessDone) {
+			err = nil
+		}
+	}
+	g.release()
+	return err
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package procgroup
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func sysProcAttr(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	if attr == nil {
+		attr = &syscall.SysProcAttr{}
+	}
+	// A new session is also a new process group, and detaches the command
+	// from the terminal of the agent.
+	attr.Setsid = true
+	return attr
+}
+
+// assign is a no-op, the command is the leader of the group once started.
+func (*Group) assign() {}
+
+func (g *Group) signal() error {
+	return g.signalGroup(syscall.SIGHUP)
+}
+
+func (g *Group) kill() error {
+	return g.signalGroup(syscall.SIGKILL)
+}
+
+func (g *Group) signalGroup(sig syscall.Signal) error {
+	// The ID of the group is the PID of its leader. The group exists as long
+	// as any of its processes does, even if the leader exited.
+	err := syscall.Kill(-g.cmd.Process.Pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+func (*Group) release() {}
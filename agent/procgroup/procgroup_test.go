@@ -0,0 +1,97 @@
+//go:build linux
+
+package procgroup_test
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/agent/procgroup"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestGroup(t *testing.T) {
+	t.Parallel()
+
+	t.Run("StopSignalsChildren", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", "sleep 30 >/dev/null & echo $!; wait")
+		group := procgroup.New(cmd, procgroup.Options{KillDelay: testutil.WaitLong})
+		defer group.Close()
+		child := startAndReadPID(t, cmd, group)
+
+		cancel()
+		_ = cmd.Wait()
+		require.Eventually(t, func() bool {
+			return exited(child)
+		}, testutil.WaitShort, testutil.IntervalFast)
+	})
+
+	t.Run("KillAfterDelay", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// Ignored signals are inherited, so neither the shell nor its child
+		// exit on the stop signal.
+		cmd := exec.CommandContext(ctx, "sh", "-c", "trap '' HUP; sleep 30 >/dev/null & echo $!; wait")
+		group := procgroup.New(cmd, procgroup.Options{KillDelay: 100 * time.Millisecond})
+		defer group.Close()
+		child := startAndReadPID(t, cmd, group)
+
+		cancel()
+		err := cmd.Wait()
+		require.Error(t, err)
+		require.Eventually(t, func() bool {
+			return exited(child)
+		}, testutil.WaitShort, testutil.IntervalFast)
+	})
+
+	t.Run("CloseLeavesChildrenOfExitedCommand", func(t *testing.T) {
+		t.Parallel()
+		cmd := exec.CommandContext(context.Background(), "sh", "-c", "sleep 30 >/dev/null & echo $!")
+		group := procgroup.New(cmd, procgroup.Options{})
+		child := startAndReadPID(t, cmd, group)
+		t.Cleanup(func() {
+			_ = group.Kill()
+		})
+
+		require.NoError(t, cmd.Wait())
+		require.NoError(t, group.Close())
+		require.False(t, exited(child))
+	})
+}
+
+func startAndReadPID(t *testing.T, cmd *exec.Cmd, group *procgroup.Group) int {
+	t.Helper()
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, group.Start())
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	require.NoError(t, err)
+	return pid
+}
+
+// exited returns whether the process exited. Orphans may not be reaped in
+// containers, so zombies count as exited.
+func exited(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true
+	}
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	return len(fields) > 0 && fields[0] == "Z"
+}
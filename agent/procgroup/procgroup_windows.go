@@ -0,0 +1,54 @@
+package procgroup
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+func sysProcAttr(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	if attr == nil {
+		attr = &syscall.SysProcAttr{}
+	}
+	return attr
+}
+
+// assign adds the process to a new job object. Processes it starts are
+// added to the job as well. Processes started before it's assigned escape
+// the group, so failing to create the job falls back to the process alone.
+func (g *Group) assign() {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return
+	}
+	proc, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(g.cmd.Process.Pid))
+	if err != nil {
+		_ = windows.CloseHandle(job)
+		return
+	}
+	defer windows.CloseHandle(proc)
+	err = windows.AssignProcessToJobObject(job, proc)
+	if err != nil {
+		_ = windows.CloseHandle(job)
+		return
+	}
+	g.job = uintptr(job)
+}
+
+func (g *Group) signal() error {
+	return g.kill()
+}
+
+func (g *Group) kill() error {
+	if g.job == 0 {
+		return g.cmd.Process.Kill()
+	}
+	return windows.TerminateJobObject(windows.Handle(g.job), 1)
+}
+
+func (g *Group) release() {
+	if g.job != 0 {
+		_ = windows.CloseHandle(windows.Handle(g.job))
+		g.job = 0
+	}
+}
@@ -46,6 +46,9 @@ type DRPCAgentClient interface {
 	UpdateStartup(ctx context.Context, in *UpdateStartupRequest) (*Startup, error)
 	BatchUpdateMetadata(ctx context.Context, in *BatchUpdateMetadataRequest) (*BatchUpdateMetadataResponse, error)
 	BatchCreateLogs(ctx context.Context, in *BatchCreateLogsRequest) (*BatchCreateLogsResponse, error)
+	CreateLogSource(ctx context.Context, in *CreateLogSourceRequest) (*LogSource, error)
+	CreateNotification(ctx context.Context, in *CreateNotificationRequest) (*CreateNotificationResponse, error)
+	GetMOTD(ctx context.Context, in *GetMOTDRequest) (*MOTDConfig, error)
 }
 
 type drpcAgentClient struct {
@@ -130,6 +133,33 @@ func (c *drpcAgentClient) BatchCreateLogs(ctx context.Context, in *BatchCreateLo
 	return out, nil
 }
 
+func (c *drpcAgentClient) CreateLogSource(ctx context.Context, in *CreateLogSourceRequest) (*LogSource, error) {
+	out := new(LogSource)
+	err := c.cc.Invoke(ctx, "/coder.agent.v2.Agent/CreateLogSource", drpcEncoding_File_agent_proto_agent_proto{}, in, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *drpcAgentClient) CreateNotification(ctx context.Context, in *CreateNotificationRequest) (*CreateNotificationResponse, error) {
+	out := new(CreateNotificationResponse)
+	err := c.cc.Invoke(ctx, "/coder.agent.v2.Agent/CreateNotification", drpcEncoding_File_agent_proto_agent_proto{}, in, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *drpcAgentClient) GetMOTD(ctx context.Context, in *GetMOTDRequest) (*MOTDConfig, error) {
+	out := new(MOTDConfig)
+	err := c.cc.Invoke(ctx, "/coder.agent.v2.Agent/GetMOTD", drpcEncoding_File_agent_proto_agent_proto{}, in, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 type DRPCAgentServer interface {
 	GetManifest(context.Context, *GetManifestRequest) (*Manifest, error)
 	GetServiceBanner(context.Context, *GetServiceBannerRequest) (*ServiceBanner, error)
@@ -139,6 +169,9 @@ type DRPCAgentServer interface {
 	UpdateStartup(context.Context, *UpdateStartupRequest) (*Startup, error)
 	BatchUpdateMetadata(context.Context, *BatchUpdateMetadataRequest) (*BatchUpdateMetadataResponse, error)
 	BatchCreateLogs(context.Context, *BatchCreateLogsRequest) (*BatchCreateLogsResponse, error)
+	CreateLogSource(context.Context, *CreateLogSourceRequest) (*LogSource, error)
+	CreateNotification(context.Context, *CreateNotificationRequest) (*CreateNotificationResponse, error)
+	GetMOTD(context.Context, *GetMOTDRequest) (*MOTDConfig, error)
 }
 
 type DRPCAgentUnimplementedServer struct{}
@@ -175,9 +208,21 @@ func (s *DRPCAgentUnimplementedServer) BatchCreateLogs(context.Context, *BatchCr
 	return nil, drpcerr.WithCode(errors.New("Unimplemented"), drpcerr.Unimplemented)
 }
 
+func (s *DRPCAgentUnimplementedServer) CreateLogSource(context.Context, *CreateLogSourceRequest) (*LogSource, error) {
+	return nil, drpcerr.WithCode(errors.New("Unimplemented"), drpcerr.Unimplemented)
+}
+
+func (s *DRPCAgentUnimplementedServer) CreateNotification(context.Context, *CreateNotificationRequest) (*CreateNotificationResponse, error) {
+	return nil, drpcerr.WithCode(errors.New("Unimplemented"), drpcerr.Unimplemented)
+}
+
+func (s *DRPCAgentUnimplementedServer) GetMOTD(context.Context, *GetMOTDRequest) (*MOTDConfig, error) {
+	return nil, drpcerr.WithCode(errors.New("Unimplemented"), drpcerr.Unimplemented)
+}
+
 type DRPCAgentDescription struct{}
 
-func (DRPCAgentDescription) NumMethods() int { return 8 }
+func (DRPCAgentDescription) NumMethods() int { return 11 }
 
 func (DRPCAgentDescription) Method(n int) (string, drpc.Encoding, drpc.Receiver, interface{}, bool) {
 	switch n {
@@ -253,6 +298,33 @@ func (DRPCAgentDescription) Method(n int) (string, drpc.Encoding, drpc.Receiver,
 						in1.(*BatchCreateLogsRequest),
 					)
 			}, DRPCAgentServer.BatchCreateLogs, true
+	case 8:
+		return "/coder.agent.v2.Agent/CreateLogSource", drpcEncoding_File_agent_proto_agent_proto{},
+			func(srv interface{}, ctx context.Context, in1, in2 interface{}) (drpc.Message, error) {
+				return srv.(DRPCAgentServer).
+					CreateLogSource(
+						ctx,
+						in1.(*CreateLogSourceRequest),
+					)
+			}, DRPCAgentServer.CreateLogSource, true
+	case 9:
+		return "/coder.agent.v2.Agent/CreateNotification", drpcEncoding_File_agent_proto_agent_proto{},
+			func(srv interface{}, ctx context.Context, in1, in2 interface{}) (drpc.Message, error) {
+				return srv.(DRPCAgentServer).
+					CreateNotification(
+						ctx,
+						in1.(*CreateNotificationRequest),
+					)
+			}, DRPCAgentServer.CreateNotification, true
+	case 10:
+		return "/coder.agent.v2.Agent/GetMOTD", drpcEncoding_File_agent_proto_agent_proto{},
+			func(srv interface{}, ctx context.Context, in1, in2 interface{}) (drpc.Message, error) {
+				return srv.(DRPCAgentServer).
+					GetMOTD(
+						ctx,
+						in1.(*GetMOTDRequest),
+					)
+			}, DRPCAgentServer.GetMOTD, true
 	default:
 		return "", nil, nil, nil, false
 	}
@@ -389,3 +461,51 @@ func (x *drpcAgent_BatchCreateLogsStream) SendAndClose(m *BatchCreateLogsRespons
 	}
 	return x.CloseSend()
 }
+
+type DRPCAgent_CreateLogSourceStream interface {
+	drpc.Stream
+	SendAndClose(*LogSource) error
+}
+
+type drpcAgent_CreateLogSourceStream struct {
+	drpc.Stream
+}
+
+func (x *drpcAgent_CreateLogSourceStream) SendAndClose(m *LogSource) error {
+	if err := x.MsgSend(m, drpcEncoding_File_agent_proto_agent_proto{}); err != nil {
+		return err
+	}
+	return x.CloseSend()
+}
+
+type DRPCAgent_CreateNotificationStream interface {
+	drpc.Stream
+	SendAndClose(*CreateNotificationResponse) error
+}
+
+type drpcAgent_CreateNotificationStream struct {
+	drpc.Stream
+}
+
+func (x *drpcAgent_CreateNotificationStream) SendAndClose(m *CreateNotificationResponse) error {
+	if err := x.MsgSend(m, drpcEncoding_File_agent_proto_agent_proto{}); err != nil {
+		return err
+	}
+	return x.CloseSend()
+}
+
+type DRPCAgent_GetMOTDStream interface {
+	drpc.Stream
+	SendAndClose(*MOTDConfig) error
+}
+
+type drpcAgent_GetMOTDStream struct {
+	drpc.Stream
+}
+
+func (x *drpcAgent_GetMOTDStream) SendAndClose(m *MOTDConfig) error {
+	if err := x.MsgSend(m, drpcEncoding_File_agent_proto_agent_proto{}); err != nil {
+		return err
+	}
+	return x.CloseSend()
+}
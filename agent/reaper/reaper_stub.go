@@ -2,11 +2,18 @@
 
 package reaper
 
+import "golang.org/x/xerrors"
+
 // IsInitProcess returns true if the current process's PID is 1.
 func IsInitProcess() bool {
 	return false
 }
 
+// SetChildSubreaper is only supported on Linux.
+func SetChildSubreaper() error {
+	return xerrors.New("child subreapers are only supported on Linux")
+}
+
 func ForkReap(_ ...Option) error {
 	return nil
 }
@@ -7,6 +7,8 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -100,3 +102,46 @@ func TestReapInterrupt(t *testing.T) {
 
 	require.NoError(t, <-errC)
 }
+
+// TestSetChildSubreaper checks that orphaned grandchildren are reparented to
+// a subreaper instead of PID 1. The subreaper attribute can't be unset, so
+// the test process only runs the check in a subprocess of itself.
+func TestSetChildSubreaper(t *testing.T) {
+	if os.Getenv("TEST_SUBPROCESS") == "1" {
+		checkChildSubreaper(t)
+		return
+	}
+	t.Parallel()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSetChildSubreaper$", "-test.v") //nolint:gosec
+	cmd.Env = append(os.Environ(), "TEST_SUBPROCESS=1")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func checkChildSubreaper(t *testing.T) {
+	err := reaper.SetChildSubreaper()
+	require.NoError(t, err)
+
+	// The shell exits right away, orphaning the sleep.
+	out, err := exec.Command("/bin/sh", "-c", "sleep 10 >/dev/null 2>&1 & echo $!").Output()
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+		var wstatus syscall.WaitStatus
+		_, _ = syscall.Wait4(pid, &wstatus, 0, nil)
+	})
+
+	require.Eventually(t, func() bool {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return false
+		}
+		// The parent PID is the second field after the command name,
+		// which may contain spaces.
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		return len(fields) > 1 && fields[1] == strconv.Itoa(os.Getpid())
+	}, testutil.WaitShort, testutil.IntervalFast)
+}
@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	"github.com/hashicorp/go-reap"
+	"golang.org/x/sys/unix"
 	"golang.org/x/xerrors"
 )
 
@@ -16,6 +17,18 @@ func IsInitProcess() bool {
 	return os.Getpid() == 1
 }
 
+// SetChildSubreaper marks the current process as a child subreaper, so
+// orphaned descendants are reparented to it instead of PID 1. This lets the
+// agent reap zombies when it isn't PID 1, e.g. when it's started by a shell
+// entrypoint that doesn't reap its children.
+func SetChildSubreaper() error {
+	err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+	if err != nil {
+		return xerrors.Errorf("set child subreaper: %w", err)
+	}
+	return nil
+}
+
 func catchSignals(pid int, sigs []os.Signal) {
 	if len(sigs) == 0 {
 		return
@@ -0,0 +1,104 @@
+package reconnectingpty
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+)
+
+const (
+	// DefaultScrollbackLines is the number of lines of history screen keeps
+	// for a session.
+	DefaultScrollbackLines = 1000
+	// MaxScrollbackLines bounds the history of a session, screen keeps the
+	// whole history in memory.
+	MaxScrollbackLines = 100000
+)
+
+// persistedSessionsDir holds a file for every persisted screen session,
+// named after the screen session. The modification time of the file is the
+// last time the session was attached.
+func persistedSessionsDir() string {
+	return filepath.Join(os.TempDir(), "coder-screen", "sessions")
+}
+
+// persistedScreenID derives the screen session name from the ID of the
+// reconnecting pty, so the session can be found again after the agent
+// restarts. It is kept short because socket paths are limited.
+func persistedScreenID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// touchPersistedSession records that a persisted session was attached.
+func touchPersistedSession(screenID string) error {
+	dir := persistedSessionsDir()
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return xerrors.Errorf("make sessions dir: %w", err)
+	}
+	path := filepath.Join(dir, screenID)
+	now := time.Now()
+	err = os.Chtimes(path, now, now)
+	if xerrors.Is(err, os.ErrNotExist) {
+		err = os.WriteFile(path, nil, 0o600)
+	}
+	if err != nil {
+		return xerrors.Errorf("record session: %w", err)
+	}
+	return nil
+}
+
+func removePersistedSession(screenID string) {
+	_ = os.Remove(filepath.Join(persistedSessionsDir(), screenID))
+}
+
+// ExpirePersistedSessions quits the screen sessions persisted by a previous
+// agent that are not reattached within timeout. It blocks until the timeout
+// elapses or the context ends.
+func ExpirePersistedSessions(ctx context.Context, logger slog.Logger, timeout time.Duration) {
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	started := time.Now()
+	entries, err := os.ReadDir(persistedSessionsDir())
+	if err != nil || len(entries) == 0 {
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	for _, entry := range entries {
+		info, err := os.Stat(filepath.Join(persistedSessionsDir(), entry.Name()))
+		if err != nil {
+			// Removed when the session was closed.
+			continue
+		}
+		if info.ModTime().After(started) {
+			// Reattached since the agent started, the session is now
+			// managed by its reconnecting pty.
+			continue
+		}
+		logger.Info(ctx, "quitting expired persisted screen session", slog.F("screen_id", entry.Name()))
+		//nolint:gosec
+		cmd := exec.CommandContext(ctx, "screen", "-S", entry.Name(), "-X", "quit")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			logger.Debug(ctx, "quit persisted screen session", slog.Error(err), slog.F("output", string(out)))
+		}
+		removePersistedSession(entry.Name())
+	}
+}
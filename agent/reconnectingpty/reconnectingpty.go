@@ -25,6 +25,10 @@ import (
 // able to start up the daemon and for the buffered pty to start.
 const attachTimeout = 30 * time.Second
 
+// defaultTimeout is how long a reconnecting pty is kept alive without
+// connections by default.
+const defaultTimeout = 5 * time.Minute
+
 // Options allows configuring the reconnecting pty.
 type Options struct {
 	// Timeout describes how long to keep the pty alive without any connections.
@@ -32,6 +36,16 @@ type Options struct {
 	Timeout time.Duration
 	// Metrics tracks various error counters.
 	Metrics *prometheus.CounterVec
+	// ID identifies the reconnecting pty across connections.
+	ID string
+	// Persist keeps the session running when the agent shuts down so it can
+	// be reattached after the agent restarts, e.g. after an upgrade. Only
+	// the screen backend supports persistence.
+	Persist bool
+	// ScrollbackLines is the number of lines of history kept by the screen
+	// backend. Defaults to DefaultScrollbackLines and is capped at
+	// MaxScrollbackLines.
+	ScrollbackLines int
 }
 
 // ReconnectingPTY is a pty that can be reconnected within a timeout and to
@@ -58,7 +72,17 @@ type ReconnectingPTY interface {
 // backend only).
 func New(ctx context.Context, cmd *pty.Cmd, options *Options, logger slog.Logger) ReconnectingPTY {
 	if options.Timeout == 0 {
-		options.Timeout = 5 * time.Minute
+		options.Timeout = defaultTimeout
+	}
+	if options.ScrollbackLines <= 0 {
+		options.ScrollbackLines = DefaultScrollbackLines
+	}
+	if options.ScrollbackLines > MaxScrollbackLines {
+		options.ScrollbackLines = MaxScrollbackLines
+	}
+	if options.Persist && options.ID == "" {
+		logger.Warn(ctx, "reconnecting pty can't be persisted without an id")
+		options.Persist = false
 	}
 	// Screen seems flaky on Darwin.  Locally the tests pass 100% of the time (100
 	// runs) but in CI screen often incorrectly claims the session name does not
@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"os"
@@ -45,6 +46,8 @@ type screenReconnectingPTY struct {
 	configFile string
 
 	metrics *prometheus.CounterVec
+	// persist keeps the screen session running when the agent shuts down.
+	persist bool
 
 	state *ptyState
 	// timer will close the reconnecting pty when it expires.  The timer will be
@@ -65,20 +68,26 @@ func newScreen(ctx context.Context, cmd *pty.Cmd, options *Options, logger slog.
 		metrics: options.Metrics,
 		state:   newState(),
 		timeout: options.Timeout,
+		persist: options.Persist,
 	}
 
 	go rpty.lifecycle(ctx, logger)
 
 	// Socket paths are limited to around 100 characters on Linux and macOS which
 	// depending on the temporary directory can be a problem.  To give more leeway
-	// use a short ID.
-	buf := make([]byte, 4)
-	_, err := rand.Read(buf)
-	if err != nil {
-		rpty.state.setState(StateDone, xerrors.Errorf("generate screen id: %w", err))
-		return rpty
+	// use a short ID.  Persisted sessions derive the ID from the reconnecting pty
+	// so a restarted agent attaches to the existing session.
+	if rpty.persist {
+		rpty.id = persistedScreenID(options.ID)
+	} else {
+		buf := make([]byte, 4)
+		_, err := rand.Read(buf)
+		if err != nil {
+			rpty.state.setState(StateDone, xerrors.Errorf("generate screen id: %w", err))
+			return rpty
+		}
+		rpty.id = hex.EncodeToString(buf)
 	}
-	rpty.id = hex.EncodeToString(buf)
 
 	settings := []string{
 		// Tell screen not to handle motion for xterm* terminals which allows
@@ -102,10 +111,12 @@ func newScreen(ctx context.Context, cmd *pty.Cmd, options *Options, logger slog.
 		// wheel scroll wonky due to the terminal doing the scrolling rather than
 		// screen itself (but again copy mode will work just fine).
 		"escape ^Ss",
+		// Bound the history kept in memory by the daemon.
+		fmt.Sprintf("defscrollback %d", options.ScrollbackLines),
 	}
 
 	rpty.configFile = filepath.Join(os.TempDir(), "coder-screen", "config")
-	err = os.MkdirAll(filepath.Dir(rpty.configFile), 0o700)
+	err := os.MkdirAll(filepath.Dir(rpty.configFile), 0o700)
 	if err != nil {
 		rpty.state.setState(StateDone, xerrors.Errorf("make screen config dir: %w", err))
 		return rpty
@@ -131,17 +142,27 @@ func (rpty *screenReconnectingPTY) lifecycle(ctx context.Context, logger slog.Lo
 	rpty.state.setState(StateReady, nil)
 
 	state, reasonErr := rpty.state.waitForStateOrContext(ctx, StateClosing)
-	if state < StateClosing {
+	agentClosing := state < StateClosing
+	if agentClosing {
 		// If we have not closed yet then the context is what unblocked us (which
 		// means the agent is shutting down) so move into the closing phase.
 		rpty.Close(reasonErr)
 	}
 	rpty.timer.Stop()
 
-	// If the command errors that the session is already gone that is fine.
-	err := rpty.sendCommand(context.Background(), "quit", []string{"No screen session found"})
-	if err != nil {
-		logger.Error(ctx, "close screen session", slog.Error(err))
+	if agentClosing && rpty.persist {
+		// Leave the session running for the next agent to reattach.  It is
+		// quit by ExpirePersistedSessions if nobody does.
+		logger.Info(ctx, "persisting screen session", slog.F("screen_id", rpty.id))
+	} else {
+		// If the command errors that the session is already gone that is fine.
+		err := rpty.sendCommand(context.Background(), "quit", []string{"No screen session found"})
+		if err != nil {
+			logger.Error(ctx, "close screen session", slog.Error(err))
+		}
+		if rpty.persist {
+			removePersistedSession(rpty.id)
+		}
 	}
 
 	logger.Info(ctx, "closed reconnecting pty")
@@ -162,6 +183,13 @@ func (rpty *screenReconnectingPTY) Attach(ctx context.Context, _ string, conn ne
 
 	go heartbeat(ctx, rpty.timer, rpty.timeout)
 
+	if rpty.persist {
+		err := touchPersistedSession(rpty.id)
+		if err != nil {
+			logger.Warn(ctx, "record persisted screen session", slog.Error(err))
+		}
+	}
+
 	ptty, process, err := rpty.doAttach(ctx, conn, height, width, logger)
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
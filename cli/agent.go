@@ -29,9 +29,12 @@ import (
 	"cdr.dev/slog/sloggers/slogstackdriver"
 	"github.com/coder/coder/v2/agent"
 	"github.com/coder/coder/v2/agent/agentproc"
+	"github.com/coder/coder/v2/agent/agentssh"
+	"github.com/coder/coder/v2/agent/agentupdate"
 	"github.com/coder/coder/v2/agent/reaper"
 	"github.com/coder/coder/v2/buildinfo"
 	"github.com/coder/coder/v2/cli/clibase"
+	"github.com/coder/coder/v2/cli/gitauth"
 	"github.com/coder/coder/v2/codersdk"
 	"github.com/coder/coder/v2/codersdk/agentsdk"
 )
@@ -42,13 +45,23 @@ func (r *RootCmd) workspaceAgent() *clibase.Cmd {
 		logDir              string
 		pprofAddress        string
 		noReap              bool
+		subreaper           bool
 		sshMaxTimeout       time.Duration
+		sshCryptoPreset     string
+		sshKeyExchanges     []string
+		sshCiphers          []string
+		sshMACs             []string
 		tailnetListenPort   int64
 		prometheusAddress   string
 		debugAddress        string
 		slogHumanPath       string
 		slogJSONPath        string
 		slogStackdriverPath string
+		tlsClientCertFile   string
+		tlsClientKeyFile    string
+		maxConnections      int64
+		logEncryptionKey    string
+		configureGit        bool
 	)
 	cmd := &clibase.Cmd{
 		Use:   "agent",
@@ -106,7 +119,17 @@ func (r *RootCmd) workspaceAgent() *clibase.Cmd {
 
 			// Spawn a reaper so that we don't accumulate a ton
 			// of zombie processes.
-			if reaper.IsInitProcess() && !noReap && isLinux {
+			reap := reaper.IsInitProcess()
+			if !reap && subreaper && !noReap && isLinux {
+				// Orphans are reparented to the nearest subreaper, so
+				// the reaper below reaps them as if it was PID 1.
+				err := reaper.SetChildSubreaper()
+				if err != nil {
+					return xerrors.Errorf("subreaper: %w", err)
+				}
+				reap = true
+			}
+			if reap && !noReap && isLinux {
 				logWriter := &lumberjackWriteCloseFixer{w: &lumberjack.Logger{
 					Filename: filepath.Join(logDir, "coder-agent-init.log"),
 					MaxSize:  5, // MB
@@ -175,6 +198,22 @@ func (r *RootCmd) workspaceAgent() *clibase.Cmd {
 			// with large payloads can take a bit. e.g. startup scripts
 			// may take a while to insert.
 			client.SDK.HTTPClient.Timeout = 30 * time.Second
+			if tlsClientCertFile != "" || tlsClientKeyFile != "" {
+				cert, err := agentsdk.NewClientCertificate(tlsClientCertFile, tlsClientKeyFile)
+				if err != nil {
+					return xerrors.Errorf("load tls client certificate: %w", err)
+				}
+				err = client.UseClientCertificate(cert)
+				if err != nil {
+					return xerrors.Errorf("use tls client certificate: %w", err)
+				}
+			}
+			err := client.UseConnectionPool(agentsdk.ConnectionPoolOptions{
+				MaxConnections: int(maxConnections),
+			})
+			if err != nil {
+				return xerrors.Errorf("use connection pool: %w", err)
+			}
 
 			// Enable pprof handler
 			// This prevents the pprof import from being accidentally deleted.
@@ -278,6 +317,39 @@ func (r *RootCmd) workspaceAgent() *clibase.Cmd {
 				subsystems = append(subsystems, subsystem)
 			}
 
+			sshCrypto := agentssh.CryptoConfig{
+				Preset:       agentssh.CryptoPreset(sshCryptoPreset),
+				KeyExchanges: sshKeyExchanges,
+				Ciphers:      sshCiphers,
+				MACs:         sshMACs,
+			}
+			// The SSH server is created once the agent runs, so the config is
+			// validated upfront.
+			if _, err := sshCrypto.Resolve(); err != nil {
+				return xerrors.Errorf("ssh crypto: %w", err)
+			}
+
+			// The key is unset so it doesn't leak into the processes started
+			// by the agent.
+			_ = os.Unsetenv("CODER_AGENT_LOG_ENCRYPTION_KEY")
+			var logCipher *agentsdk.LogCipher
+			if logEncryptionKey != "" {
+				key, err := agentsdk.ParseLogEncryptionKey(logEncryptionKey)
+				if err != nil {
+					return xerrors.Errorf("log encryption key: %w", err)
+				}
+				logCipher, err = agentsdk.NewLogCipher(key)
+				if err != nil {
+					return xerrors.Errorf("log encryption key: %w", err)
+				}
+				logger.Info(ctx, "encrypting log output", slog.F("key_id", logCipher.KeyID()))
+			}
+
+			// Set when the agent replaced itself with an update. It's unset so
+			// it doesn't leak into the processes started by the agent.
+			updatedFrom := os.Getenv(agentupdate.EnvUpdatedFrom)
+			_ = os.Unsetenv(agentupdate.EnvUpdatedFrom)
+
 			procTicker := time.NewTicker(time.Second)
 			defer procTicker.Stop()
 			agnt := agent.New(agent.Options{
@@ -302,10 +374,16 @@ func (r *RootCmd) workspaceAgent() *clibase.Cmd {
 				},
 				IgnorePorts:   ignorePorts,
 				SSHMaxTimeout: sshMaxTimeout,
+				SSHCrypto:     sshCrypto,
 				Subsystems:    subsystems,
 
-				PrometheusRegistry: prometheusRegistry,
-				Syscaller:          agentproc.NewSyscaller(),
+				PrometheusRegistry:       prometheusRegistry,
+				Syscaller:                agentproc.NewSyscaller(),
+				UpdatedFrom:              updatedFrom,
+				LogCipher:                logCipher,
+				ConfigureGit:             configureGit,
+				GitCredentialHelper:      gitauth.CredentialHelper(executablePath),
+				GitCredentialHelperRegex: gitauth.CredentialHelperRegex,
 				// Intentionally set this to nil. It's mainly used
 				// for testing.
 				ModifiedProcesses: nil,
@@ -351,6 +429,12 @@ func (r *RootCmd) workspaceAgent() *clibase.Cmd {
 			Description: "Do not start a process reaper.",
 			Value:       clibase.BoolOf(&noReap),
 		},
+		{
+			Flag:        "subreaper",
+			Env:         "CODER_AGENT_SUBREAPER",
+			Description: "Start a process reaper even if the agent isn't PID 1, by registering the agent as a child subreaper. Useful when the agent is started by an entrypoint that doesn't reap zombie processes. Linux only.",
+			Value:       clibase.BoolOf(&subreaper),
+		},
 		{
 			Flag: "ssh-max-timeout",
 			// tcpip.KeepaliveIdleOption = 72h + 1min (forwardTCPSockOpts() in tailnet/conn.go)
@@ -359,6 +443,43 @@ func (r *RootCmd) workspaceAgent() *clibase.Cmd {
 			Description: "Specify the max timeout for a SSH connection, it is advisable to set it to a minimum of 60s, but no more than 72h.",
 			Value:       clibase.DurationOf(&sshMaxTimeout),
 		},
+		{
+			Flag:        "ssh-crypto-preset",
+			Default:     string(agentssh.CryptoPresetDefault),
+			Env:         "CODER_AGENT_SSH_CRYPTO_PRESET",
+			Description: "The key exchange algorithms, ciphers and MACs the SSH server accepts. \"modern\" only accepts AEAD ciphers and encrypt-then-MAC MACs, \"fips\" only accepts FIPS 140-2 approved algorithms.",
+			Value:       clibase.EnumOf(&sshCryptoPreset, string(agentssh.CryptoPresetDefault), string(agentssh.CryptoPresetModern), string(agentssh.CryptoPresetFIPS)),
+		},
+		{
+			Flag:        "ssh-kex-algorithms",
+			Env:         "CODER_AGENT_SSH_KEX_ALGORITHMS",
+			Description: "The key exchange algorithms the SSH server accepts, in order of preference. Overrides the preset.",
+			Value:       clibase.StringArrayOf(&sshKeyExchanges),
+		},
+		{
+			Flag:        "ssh-ciphers",
+			Env:         "CODER_AGENT_SSH_CIPHERS",
+			Description: "The ciphers the SSH server accepts, in order of preference. Overrides the preset.",
+			Value:       clibase.StringArrayOf(&sshCiphers),
+		},
+		{
+			Flag:        "ssh-macs",
+			Env:         "CODER_AGENT_SSH_MACS",
+			Description: "The MACs the SSH server accepts, in order of preference. Overrides the preset.",
+			Value:       clibase.StringArrayOf(&sshMACs),
+		},
+		{
+			Flag:        "configure-git",
+			Env:         "CODER_AGENT_CONFIGURE_GIT",
+			Description: "Set the Git user name and email of the workspace owner on startup, and use Coder as credential helper for Git external auth providers. Values the owner already configured are kept.",
+			Value:       clibase.BoolOf(&configureGit),
+		},
+		{
+			Flag:        "log-encryption-key",
+			Env:         "CODER_AGENT_LOG_ENCRYPTION_KEY",
+			Description: "The base64 encoded 32-byte key logs and script artifacts are encrypted with before they're sent to Coder. The key must reach the workspace without passing through Coder, e.g. from a secret manager, not the env of the coder_agent resource. Read them with \"coder logs --log-encryption-key\".",
+			Value:       clibase.StringOf(&logEncryptionKey),
+		},
 		{
 			Flag:        "tailnet-listen-port",
 			Default:     "0",
@@ -366,6 +487,25 @@ func (r *RootCmd) workspaceAgent() *clibase.Cmd {
 			Description: "Specify a static port for Tailscale to use for listening.",
 			Value:       clibase.Int64Of(&tailnetListenPort),
 		},
+		{
+			Flag:        "max-connections",
+			Default:     strconv.Itoa(agentsdk.DefaultMaxConnections),
+			Env:         "CODER_AGENT_MAX_CONNECTIONS",
+			Description: "The maximum number of connections to Coder, shared by API requests and the agent RPC connection. Requests are multiplexed over a single connection when Coder is served over TLS.",
+			Value:       clibase.Int64Of(&maxConnections),
+		},
+		{
+			Flag:        "tls-client-cert-file",
+			Env:         "CODER_AGENT_TLS_CLIENT_CERT_FILE",
+			Description: "Path to a PEM encoded client certificate presented to Coder for mutual TLS. The file is reloaded when it changes.",
+			Value:       clibase.StringOf(&tlsClientCertFile),
+		},
+		{
+			Flag:        "tls-client-key-file",
+			Env:         "CODER_AGENT_TLS_CLIENT_KEY_FILE",
+			Description: "Path to the PEM encoded private key of the client certificate. The file is reloaded when it changes.",
+			Value:       clibase.StringOf(&tlsClientKeyFile),
+		},
 		{
 			Flag:        "prometheus-address",
 			Default:     "127.0.0.1:2112",
@@ -70,6 +70,10 @@ func WorkspaceResources(writer io.Writer, resources []codersdk.WorkspaceResource
 			// callers to hide resources eventually.
 			continue
 		}
+		if resource.Action == codersdk.WorkspaceResourceActionDelete {
+			// The build deleted the resource, so it no longer exists.
+			continue
+		}
 		resourceAddress := resource.Type + "." + resource.Name
 
 		// Sort agents by name for consistent output.
@@ -28,7 +28,23 @@ func (r *RootCmd) gitAskpass() *clibase.Cmd {
 			ctx, stop := inv.SignalNotifyContext(ctx, InterruptSignals...)
 			defer stop()
 
-			user, host, err := gitauth.ParseAskpass(inv.Args[0])
+			// Git runs credential helpers with the action as the argument
+			// and the request on stdin, see gitauth.CredentialHelper.
+			credentialHelper := gitauth.IsCredentialAction(inv.Args[0])
+			if credentialHelper && inv.Args[0] != "get" {
+				// Tokens are stored by Coder, there's nothing to store or
+				// erase.
+				return nil
+			}
+			var (
+				user, host string
+				err        error
+			)
+			if credentialHelper {
+				user, host, err = gitauth.ParseCredentialRequest(inv.Stdin)
+			} else {
+				user, host, err = gitauth.ParseAskpass(inv.Args[0])
+			}
 			if err != nil {
 				return xerrors.Errorf("parse host: %w", err)
 			}
@@ -53,6 +69,11 @@ func (r *RootCmd) gitAskpass() *clibase.Cmd {
 					cliui.Warn(inv.Stderr, "Coder was unable to handle this git request. The default git behavior will be used instead.",
 						lines...,
 					)
+					if credentialHelper {
+						// Git asks the next helper, or prompts, if the
+						// helper doesn't return credentials.
+						return nil
+					}
 					return cliui.Canceled
 				}
 				return xerrors.Errorf("get git token: %w", err)
@@ -77,6 +98,13 @@ func (r *RootCmd) gitAskpass() *clibase.Cmd {
 				}
 			}
 
+			if credentialHelper {
+				password := token.Password
+				if password == "" {
+					password = token.Username
+				}
+				return gitauth.WriteCredential(inv.Stdout, token.Username, password)
+			}
 			if token.Password != "" {
 				if user == "" {
 					_, _ = fmt.Fprintln(inv.Stdout, token.Username)
@@ -0,0 +1,83 @@
+package gitauth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// CredentialHelper returns the value of the "credential.helper" Git
+// configuration that makes Git ask the Coder binary at executablePath for
+// credentials, see
+// https://git-scm.com/docs/gitcredentials#_custom_helpers.
+func CredentialHelper(executablePath string) string {
+	// The helper is run by the shell with the action appended.
+	return fmt.Sprintf("!'%s' gitaskpass", strings.ReplaceAll(executablePath, "'", `'\''`))
+}
+
+// CredentialHelperRegex matches the values CredentialHelper returns for any
+// executable path, so helpers of earlier agents can be replaced.
+var CredentialHelperRegex = regexp.MustCompile(`^!'.*' gitaskpass$`)
+
+// IsCredentialAction returns whether the argument is an action Git passes
+// to credential helpers.
+func IsCredentialAction(arg string) bool {
+	switch arg {
+	case "get", "store", "erase":
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseCredentialRequest returns the user and host of the credentials Git
+// asks a credential helper for, in the format ParseAskpass returns them.
+// For details on the format of the request, see
+// https://git-scm.com/docs/git-credential#IOFMT.
+func ParseCredentialRequest(r io.Reader) (user string, host string, err error) {
+	attrs := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// The request ends with a blank line or EOF.
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return "", "", xerrors.Errorf("invalid credential attribute: %q", line)
+		}
+		attrs[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", xerrors.Errorf("read credential request: %w", err)
+	}
+
+	switch attrs["protocol"] {
+	case "http", "https":
+	default:
+		return "", "", xerrors.Errorf("unsupported protocol: %q", attrs["protocol"])
+	}
+	if attrs["host"] == "" {
+		return "", "", xerrors.Errorf("host is empty")
+	}
+	u := url.URL{Scheme: attrs["protocol"], Host: attrs["host"]}
+	return attrs["username"], u.String(), nil
+}
+
+// WriteCredential writes the response of a credential helper.
+func WriteCredential(w io.Writer, username, password string) error {
+	for _, value := range []string{username, password} {
+		// Values can't span lines, see the format of requests.
+		if strings.ContainsAny(value, "\n\x00") {
+			return xerrors.New("credentials must not contain newlines or null bytes")
+		}
+	}
+	_, err := fmt.Fprintf(w, "username=%s\npassword=%s\n", username, password)
+	return err
+}
@@ -0,0 +1,72 @@
+package gitauth_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/cli/gitauth"
+)
+
+func TestParseCredentialRequest(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		in       string
+		wantUser string
+		wantHost string
+		wantErr  string
+	}{{
+		name:     "Host",
+		in:       "protocol=https\nhost=github.com\n\n",
+		wantHost: "https://github.com",
+	}, {
+		name:     "UserAndPort",
+		in:       "protocol=http\nhost=gitlab.example.com:8080\nusername=kyle\npath=org/repo.git\n",
+		wantUser: "kyle",
+		wantHost: "http://gitlab.example.com:8080",
+	}, {
+		name:    "SSH",
+		in:      "protocol=ssh\nhost=github.com\n",
+		wantErr: "unsupported protocol",
+	}, {
+		name:    "NoHost",
+		in:      "protocol=https\n",
+		wantErr: "host is empty",
+	}, {
+		name:    "Invalid",
+		in:      "protocol\n",
+		wantErr: "invalid credential attribute",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			user, host, err := gitauth.ParseCredentialRequest(strings.NewReader(tc.in))
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantUser, user)
+			require.Equal(t, tc.wantHost, host)
+		})
+	}
+}
+
+func TestWriteCredential(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	require.NoError(t, gitauth.WriteCredential(&buf, "oauth2", "token"))
+	require.Equal(t, "username=oauth2\npassword=token\n", buf.String())
+	require.Error(t, gitauth.WriteCredential(&buf, "oauth2", "token\nhost=evil.com"))
+}
+
+func TestCredentialHelper(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, `!'/usr/bin/coder' gitaskpass`, gitauth.CredentialHelper("/usr/bin/coder"))
+	require.Equal(t, `!'/tmp/it'\''s/coder' gitaskpass`, gitauth.CredentialHelper("/tmp/it's/coder"))
+	require.True(t, gitauth.CredentialHelperRegex.MatchString(gitauth.CredentialHelper("/tmp/it's/coder")))
+	require.False(t, gitauth.CredentialHelperRegex.MatchString("store"))
+}
@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/cli/clibase"
+	"github.com/coder/coder/v2/cli/cliui"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+func (r *RootCmd) logs() *clibase.Cmd {
+	var (
+		follow           bool
+		logEncryptionKey string
+		artifactsDir     string
+	)
+	client := new(codersdk.Client)
+	cmd := &clibase.Cmd{
+		Use:   "logs <workspace>[.<agent>]",
+		Short: "Show the logs of a workspace agent, decrypting them with the key the agent encrypted them with",
+		Middleware: clibase.Chain(
+			clibase.RequireNArgs(1),
+			r.InitClient(client),
+		),
+		Handler: func(inv *clibase.Invocation) error {
+			ctx := inv.Context()
+			workspaceName, agentName, _ := strings.Cut(inv.Args[0], ".")
+			workspace, err := namedWorkspace(ctx, client, workspaceName)
+			if err != nil {
+				return xerrors.Errorf("get workspace: %w", err)
+			}
+			agent, err := getWorkspaceAgent(workspace, agentName)
+			if err != nil {
+				return err
+			}
+
+			var logCipher *agentsdk.LogCipher
+			if logEncryptionKey != "" {
+				key, err := agentsdk.ParseLogEncryptionKey(logEncryptionKey)
+				if err != nil {
+					return xerrors.Errorf("log encryption key: %w", err)
+				}
+				logCipher, err = agentsdk.NewLogCipher(key)
+				if err != nil {
+					return xerrors.Errorf("log encryption key: %w", err)
+				}
+			}
+
+			if artifactsDir != "" {
+				return downloadScriptArtifacts(inv, client, agent, logCipher, artifactsDir)
+			}
+
+			logs, closer, err := client.WorkspaceAgentLogsAfter(ctx, agent.ID, 0, follow)
+			if err != nil {
+				return xerrors.Errorf("get logs: %w", err)
+			}
+			defer closer.Close()
+			warned := false
+			for batch := range logs {
+				for _, log := range batch {
+					if logCipher != nil {
+						decrypted, err := logCipher.DecryptLog(log)
+						if err != nil {
+							return xerrors.Errorf("decrypt log %d: %w", log.ID, err)
+						}
+						log = decrypted
+					} else if agentsdk.IsEncryptedLog(log.Output) && !warned {
+						warned = true
+						cliui.Warn(inv.Stderr, "The logs are encrypted.", "Pass the key of the workspace with --log-encryption-key to read them.")
+					}
+					_, _ = fmt.Fprintln(inv.Stdout, formatAgentLog(log))
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Options = clibase.OptionSet{
+		{
+			Flag:          "follow",
+			FlagShorthand: "f",
+			Description:   "Keep printing new logs until the agent is ready.",
+			Value:         clibase.BoolOf(&follow),
+		},
+		{
+			Flag:        "log-encryption-key",
+			Env:         "CODER_LOG_ENCRYPTION_KEY",
+			Description: "The base64 encoded 32-byte key the agent encrypts logs and script artifacts with.",
+			Value:       clibase.StringOf(&logEncryptionKey),
+		},
+		{
+			Flag:        "artifacts-dir",
+			Description: "Download the script artifacts of the agent to this directory instead of showing its logs.",
+			Value:       clibase.StringOf(&artifactsDir),
+		},
+	}
+	return cmd
+}
+
+// formatAgentLog returns the output of a log followed by its fields, sorted
+// by name.
+func formatAgentLog(log codersdk.WorkspaceAgentLog) string {
+	if len(log.Fields) == 0 {
+		return log.Output
+	}
+	names := make([]string, 0, len(log.Fields))
+	for name := range log.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	_, _ = sb.WriteString(log.Output)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(&sb, " %s=%q", name, log.Fields[name])
+	}
+	return sb.String()
+}
+
+// downloadScriptArtifacts writes the tar archives of the script artifacts of
+// the agent to dir, decrypting them if logCipher is set.
+func downloadScriptArtifacts(inv *clibase.Invocation, client *codersdk.Client, agent codersdk.WorkspaceAgent, logCipher *agentsdk.LogCipher, dir string) error {
+	ctx := inv.Context()
+	artifacts, err := client.WorkspaceAgentScriptArtifacts(ctx, agent.ID)
+	if err != nil {
+		return xerrors.Errorf("list script artifacts: %w", err)
+	}
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return xerrors.Errorf("create artifacts directory: %w", err)
+	}
+	for _, artifact := range artifacts {
+		archive, err := client.WorkspaceAgentScriptArtifactArchive(ctx, agent.ID, artifact.ID)
+		if err != nil {
+			return xerrors.Errorf("download script artifacts %s: %w", artifact.ID, err)
+		}
+		if logCipher != nil {
+			archive, err = logCipher.DecryptArtifacts(archive)
+			if err != nil {
+				return xerrors.Errorf("decrypt script artifacts %s: %w", artifact.ID, err)
+			}
+		} else if agentsdk.IsEncryptedArtifacts(archive) {
+			return xerrors.Errorf("script artifacts %s are encrypted, pass the key of the workspace with --log-encryption-key", artifact.ID)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s.tar", artifact.CreatedAt.Format("20060102T150405"), artifact.ID))
+		err = os.WriteFile(path, archive, 0o600)
+		if err != nil {
+			return xerrors.Errorf("write script artifacts: %w", err)
+		}
+		_, _ = fmt.Fprintln(inv.Stdout, path)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/cli/clitest"
+	"github.com/coder/coder/v2/coderd/coderdtest"
+	"github.com/coder/coder/v2/coderd/database"
+	"github.com/coder/coder/v2/coderd/database/dbfake"
+	"github.com/coder/coder/v2/coderd/database/dbtime"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestLogs(t *testing.T) {
+	t.Parallel()
+
+	ctx := testutil.Context(t, testutil.WaitLong)
+	client, db := coderdtest.NewWithDatabase(t, nil)
+	owner := coderdtest.CreateFirstUser(t, client)
+	member, memberUser := coderdtest.CreateAnotherUser(t, client, owner.OrganizationID)
+	r := dbfake.WorkspaceBuild(t, db, database.Workspace{
+		OrganizationID: owner.OrganizationID,
+		OwnerID:        memberUser.ID,
+	}).WithAgent().Do()
+
+	key := bytes.Repeat([]byte{1}, agentsdk.LogEncryptionKeySize)
+	logCipher, err := agentsdk.NewLogCipher(key)
+	require.NoError(t, err)
+	agentClient := agentsdk.New(client.URL)
+	agentClient.SetSessionToken(r.AgentToken)
+	patchLogs := agentsdk.EncryptPatchLogs(agentClient.PatchLogs, logCipher)
+	err = patchLogs(ctx, agentsdk.PatchLogs{
+		Logs: []agentsdk.Log{{
+			CreatedAt: dbtime.Now(),
+			Output:    "secret output",
+			Fields:    map[string]string{"script": "secret script"},
+		}},
+	})
+	require.NoError(t, err)
+
+	t.Run("Decrypt", func(t *testing.T) {
+		t.Parallel()
+		inv, root := clitest.New(t, "logs", r.Workspace.Name, "--log-encryption-key", base64.StdEncoding.EncodeToString(key))
+		clitest.SetupConfig(t, member, root)
+		var stdout bytes.Buffer
+		inv.Stdout = &stdout
+		err := inv.WithContext(ctx).Run()
+		require.NoError(t, err)
+		require.Equal(t, `secret output script="secret script"`, strings.TrimSpace(stdout.String()))
+	})
+
+	t.Run("NoKey", func(t *testing.T) {
+		t.Parallel()
+		inv, root := clitest.New(t, "logs", r.Workspace.Name)
+		clitest.SetupConfig(t, member, root)
+		var stdout, stderr bytes.Buffer
+		inv.Stdout = &stdout
+		inv.Stderr = &stderr
+		err := inv.WithContext(ctx).Run()
+		require.NoError(t, err)
+		require.NotContains(t, stdout.String(), "secret")
+		require.Contains(t, stderr.String(), "The logs are encrypted.")
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		t.Parallel()
+		inv, root := clitest.New(t, "logs", r.Workspace.Name, "--log-encryption-key", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, agentsdk.LogEncryptionKeySize)))
+		clitest.SetupConfig(t, member, root)
+		err := inv.WithContext(ctx).Run()
+		require.ErrorContains(t, err, "encrypted with key")
+	})
+}
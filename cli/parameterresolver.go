@@ -155,9 +155,10 @@ next:
 			continue // do not propagate invalid options
 		}
 
+		buildParameter.Source = codersdk.WorkspaceBuildParameterSourcePreviousBuild
 		for i, r := range resolved {
 			if r.Name == buildParameter.Name {
-				resolved[i].Value = buildParameter.Value
+				resolved[i] = buildParameter
 				continue next
 			}
 		}
@@ -109,8 +109,9 @@ func TestRestart(t *testing.T) {
 		actualParameters, err := client.WorkspaceBuildParameters(ctx, workspace.LatestBuild.ID)
 		require.NoError(t, err)
 		require.Contains(t, actualParameters, codersdk.WorkspaceBuildParameter{
-			Name:  ephemeralParameterName,
-			Value: ephemeralParameterValue,
+			Name:   ephemeralParameterName,
+			Value:  ephemeralParameterValue,
+			Source: codersdk.WorkspaceBuildParameterSourceUserInput,
 		})
 	})
 
@@ -163,8 +164,9 @@ func TestRestart(t *testing.T) {
 		actualParameters, err := client.WorkspaceBuildParameters(ctx, workspace.LatestBuild.ID)
 		require.NoError(t, err)
 		require.Contains(t, actualParameters, codersdk.WorkspaceBuildParameter{
-			Name:  ephemeralParameterName,
-			Value: ephemeralParameterValue,
+			Name:   ephemeralParameterName,
+			Value:  ephemeralParameterValue,
+			Source: codersdk.WorkspaceBuildParameterSourceUserInput,
 		})
 	})
 }
@@ -235,8 +237,9 @@ func TestRestartWithParameters(t *testing.T) {
 		actualParameters, err := client.WorkspaceBuildParameters(ctx, workspace.LatestBuild.ID)
 		require.NoError(t, err)
 		require.Contains(t, actualParameters, codersdk.WorkspaceBuildParameter{
-			Name:  immutableParameterName,
-			Value: immutableParameterValue,
+			Name:   immutableParameterName,
+			Value:  immutableParameterValue,
+			Source: codersdk.WorkspaceBuildParameterSourcePreviousBuild,
 		})
 	})
 
@@ -286,8 +289,9 @@ func TestRestartWithParameters(t *testing.T) {
 		actualParameters, err := client.WorkspaceBuildParameters(ctx, workspace.LatestBuild.ID)
 		require.NoError(t, err)
 		require.Contains(t, actualParameters, codersdk.WorkspaceBuildParameter{
-			Name:  mutableParameterName,
-			Value: newValue,
+			Name:   mutableParameterName,
+			Value:  newValue,
+			Source: codersdk.WorkspaceBuildParameterSourceUserInput,
 		})
 	})
 }
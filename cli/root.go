@@ -102,6 +102,7 @@ func (r *RootCmd) Core() []*clibase.Cmd {
 		r.deleteWorkspace(),
 		r.favorite(),
 		r.list(),
+		r.logs(),
 		r.open(),
 		r.ping(),
 		r.rename(),
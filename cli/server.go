@@ -55,6 +55,7 @@ import (
 
 	"cdr.dev/slog"
 	"cdr.dev/slog/sloggers/sloghuman"
+	"github.com/coder/coder/v2/agent/agentupdate"
 	"github.com/coder/coder/v2/buildinfo"
 	"github.com/coder/coder/v2/cli/clibase"
 	"github.com/coder/coder/v2/cli/clilog"
@@ -88,6 +89,7 @@ import (
 	"github.com/coder/coder/v2/coderd/workspaceapps"
 	"github.com/coder/coder/v2/coderd/workspaceapps/appurl"
 	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
 	"github.com/coder/coder/v2/codersdk/drpc"
 	"github.com/coder/coder/v2/cryptorand"
 	"github.com/coder/coder/v2/provisioner/echo"
@@ -509,6 +511,20 @@ func (r *RootCmd) Server(newAPI func(context.Context, *coderd.Options) (*coderd.
 			if err != nil {
 				return xerrors.Errorf("create derp map: %w", err)
 			}
+			derpMapFallbacks := make([]agentsdk.DERPMapSource, 0, len(vals.DERP.Config.FallbackPaths.Value()))
+			for _, path := range vals.DERP.Config.FallbackPaths.Value() {
+				fallback, err := tailnet.NewDERPMap(ctx, nil, nil, "", path, vals.DERP.Config.BlockDirect.Value())
+				if err != nil {
+					return xerrors.Errorf("create fallback derp map %q: %w", path, err)
+				}
+				derpMapFallbacks = append(derpMapFallbacks, agentsdk.DERPMapSource{Name: path, DERPMap: fallback})
+			}
+			// Clients and coderd must reach agents that failed over, so
+			// the fallback regions are distributed with the DERP map.
+			derpMap, err = agentsdk.DERPMapWithFallbacks(derpMap, derpMapFallbacks)
+			if err != nil {
+				return xerrors.Errorf("add fallback derp maps: %w", err)
+			}
 
 			appHostname := vals.WildcardAccessURL.String()
 			var appHostnameRegex *regexp.Regexp
@@ -552,6 +568,25 @@ func (r *RootCmd) Server(newAPI func(context.Context, *coderd.Options) (*coderd.
 				return xerrors.Errorf("parse ssh config options %q: %w", vals.SSHConfig.SSHConfigOptions.String(), err)
 			}
 
+			for i, rule := range vals.AgentExecPolicy.Value {
+				err := rule.Validate()
+				if err != nil {
+					return xerrors.Errorf("invalid agent exec policy rule %d: %w", i, err)
+				}
+			}
+
+			switch vals.AgentUpdateChannel.Value() {
+			case "", agentsdk.AgentUpdateChannelDeployment:
+			default:
+				return xerrors.Errorf("unknown agent update channel %q, only %q is supported", vals.AgentUpdateChannel.Value(), agentsdk.AgentUpdateChannelDeployment)
+			}
+			if vals.AgentUpdateVersionRange.Value() != "" {
+				_, err := agentupdate.ParseVersionRange(vals.AgentUpdateVersionRange.Value())
+				if err != nil {
+					return xerrors.Errorf("parse agent update version range %q: %w", vals.AgentUpdateVersionRange.Value(), err)
+				}
+			}
+
 			options := &coderd.Options{
 				AccessURL:                   vals.AccessURL.Value(),
 				AppHostname:                 appHostname,
@@ -559,6 +594,7 @@ func (r *RootCmd) Server(newAPI func(context.Context, *coderd.Options) (*coderd.
 				Logger:                      logger.Named("coderd"),
 				Database:                    dbmem.New(),
 				BaseDERPMap:                 derpMap,
+				DERPMapFallbacks:            derpMapFallbacks,
 				Pubsub:                      pubsub.NewInMemory(),
 				CacheDir:                    cacheDir,
 				GoogleTokenValidator:        googleTokenValidator,
@@ -1371,20 +1407,36 @@ func newProvisionerDaemon(
 			_ = terraformClient.Close()
 			_ = terraformServer.Close()
 		}()
+		options, err := TerraformServeOptions(&cfg.Provisioner)
+		if err != nil {
+			return nil, err
+		}
+		if templates := cfg.Provisioner.PrewarmTemplates.Value(); templates > 0 {
+			options.Prewarm = &terraform.PrewarmOptions{
+				// Stale plugins are cleaned from the terraform dir.
+				Dir:          filepath.Join(cacheDir, "prewarm"),
+				MaxTemplates: int(templates),
+				MaxDiskBytes: cfg.Provisioner.PrewarmMaxSizeMB.Value() << 20,
+			}
+		}
+		options.ServeOptions = &provisionersdk.ServeOptions{
+			Listener:      terraformServer,
+			Logger:        logger.Named("terraform"),
+			WorkDirectory: workDir,
+			WorkDirectoryRetention: provisionersdk.WorkDirectoryRetention{
+				KeepOnFailure: cfg.Provisioner.WorkDirectoryKeepOnFailure.Value(),
+				TTL:           cfg.Provisioner.WorkDirectoryTTL.Value(),
+				MaxDiskBytes:  cfg.Provisioner.WorkDirectoryMaxDisk.Value(),
+			},
+		}
+		options.CachePath = tfDir
+		options.Tracer = tracer
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			defer cancel()
 
-			err := terraform.Serve(ctx, &terraform.ServeOptions{
-				ServeOptions: &provisionersdk.ServeOptions{
-					Listener:      terraformServer,
-					Logger:        logger.Named("terraform"),
-					WorkDirectory: workDir,
-				},
-				CachePath: tfDir,
-				Tracer:    tracer,
-			})
+			err := terraform.Serve(ctx, options)
 			if err != nil && !xerrors.Is(err, context.Canceled) {
 				select {
 				case errCh <- err:
@@ -1410,6 +1462,74 @@ func newProvisionerDaemon(
 	}), nil
 }
 
+// TerraformServeOptions returns the options of the Terraform provisioner
+// set by the provisioner config, shared by the built-in and the external
+// provisioner daemons. The caller sets the options of the daemon, such as
+// ServeOptions and CachePath.
+func TerraformServeOptions(cfg *codersdk.ProvisionerConfig) (*terraform.ServeOptions, error) {
+	var sandbox *terraform.SandboxOptions
+	if sandboxRuntime := cfg.Sandbox.String(); sandboxRuntime != "" {
+		sandbox = &terraform.SandboxOptions{
+			Runtime:         terraform.SandboxRuntime(sandboxRuntime),
+			SeccompProfile:  cfg.SandboxSeccompProfile.String(),
+			EgressAllowlist: cfg.SandboxEgressAllowlist.Value(),
+		}
+	}
+	providerCredentials := make([]terraform.ProviderCredentials, 0, len(cfg.ProviderCredentials.Value))
+	for _, c := range cfg.ProviderCredentials.Value {
+		providerCredentials = append(providerCredentials, terraform.ProviderCredentials{
+			Type:           terraform.ProviderCredentialsType(c.Type),
+			ExternalAuthID: c.ExternalAuthID,
+			RoleARN:        c.RoleARN,
+			Audience:       c.Audience,
+			ServiceAccount: c.ServiceAccount,
+			ClientID:       c.ClientID,
+			TenantID:       c.TenantID,
+		})
+	}
+	var secretsResolvers []terraform.SecretsResolver
+	for _, name := range cfg.SecretsResolvers.Value() {
+		switch name {
+		case "vault":
+			secretsResolvers = append(secretsResolvers, terraform.VaultSecretsResolverFromEnv())
+		case "aws-secrets-manager":
+			secretsResolvers = append(secretsResolvers, &terraform.AWSSecretsManagerResolver{})
+		default:
+			return nil, xerrors.Errorf("unsupported provisioner secrets resolver %q", name)
+		}
+	}
+	trustedProviderHashes := map[string][]string{}
+	for _, entry := range cfg.TrustedProviderHashes.Value() {
+		source, hash, ok := strings.Cut(entry, "=")
+		if !ok || source == "" || hash == "" {
+			return nil, xerrors.Errorf("invalid trusted provider hash %q, must be <source>=<hash>", entry)
+		}
+		trustedProviderHashes[source] = append(trustedProviderHashes[source], hash)
+	}
+	return &terraform.ServeOptions{
+		Sandbox:             sandbox,
+		HangTimeout:         cfg.HangTimeout.Value(),
+		DataSourceTimeout:   cfg.DataSourceTimeout.Value(),
+		ProviderCredentials: providerCredentials,
+		Guardrails: terraform.Guardrails{
+			MaxResources: int(cfg.MaxResources.Value()),
+			MaxDestroys:  int(cfg.MaxDestroys.Value()),
+		},
+		AirGapped: terraform.AirGappedOptions{
+			FilesystemMirrors: cfg.FilesystemMirrors.Value(),
+			NetworkMirrors:    cfg.NetworkMirrors.Value(),
+		},
+		ApplyRetry: terraform.ApplyRetryOptions{
+			MaxAttempts: int(cfg.MaxApplyRetries.Value()),
+		},
+		SecretsResolvers: secretsResolvers,
+		ProviderVerification: terraform.ProviderVerificationOptions{
+			Enabled:       cfg.VerifyProviders.Value(),
+			TrustedHashes: trustedProviderHashes,
+		},
+	}, nil
+}
+
 // nolint: revive
 func PrintLogo(inv *clibase.Invocation, daemonTitle string) {
 	// Only print the logo in TTYs.
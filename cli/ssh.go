@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -19,11 +20,11 @@ import (
 	"github.com/gofrs/flock"
 	"github.com/google/uuid"
 	"github.com/mattn/go-isatty"
+	"go.uber.org/atomic"
 	gossh "golang.org/x/crypto/ssh"
 	gosshagent "golang.org/x/crypto/ssh/agent"
 	"golang.org/x/term"
 	"golang.org/x/xerrors"
-	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
 
 	"github.com/coder/retry"
 
@@ -56,6 +57,7 @@ func (r *RootCmd) ssh() *clibase.Cmd {
 		logDirPath       string
 		remoteForwards   []string
 		disableAutostart bool
+		multiplex        bool
 	)
 	client := new(codersdk.Client)
 	cmd := &clibase.Cmd{
@@ -75,8 +77,29 @@ func (r *RootCmd) ssh() *clibase.Cmd {
 			// OpenSSH sends SIGHUP to terminate a proxy command.
 			ctx, stop := inv.SignalNotifyContext(inv.Context(), InterruptSignals...)
 			defer stop()
+			signalCtx := ctx
+			if multiplex {
+				// A multiplexing master only exits once the multiplexed
+				// sessions ended too, since they share its connection, so
+				// signals are handled below.
+				ctx = inv.Context()
+			}
 			ctx, cancel := context.WithCancel(ctx)
 			defer cancel()
+			var muxMaster atomic.Pointer[sshMuxMaster]
+			if multiplex {
+				go func() {
+					select {
+					case <-signalCtx.Done():
+					case <-ctx.Done():
+						return
+					}
+					if master := muxMaster.Load(); master != nil {
+						_ = master.Shutdown(ctx)
+					}
+					cancel()
+				}()
+			}
 
 			logger := inv.Logger
 			defer func() {
@@ -155,12 +178,37 @@ func (r *RootCmd) ssh() *clibase.Cmd {
 					}
 				}
 			}
+			if multiplex && !stdio {
+				return xerrors.Errorf("multiplex can only be enabled in the stdio mode")
+			}
 
 			workspace, workspaceAgent, err := getWorkspaceAndAgent(ctx, inv, client, !disableAutostart, codersdk.Me, inv.Args[0])
 			if err != nil {
 				return err
 			}
 
+			var muxPath string
+			if multiplex {
+				// Share the connection of a master connected to the same
+				// agent, which skips the agent wait and the tailnet
+				// handshake.
+				muxPath, err = sshMuxSocketPath(workspaceAgent.ID.String())
+				if err != nil {
+					return xerrors.Errorf("multiplex: %w", err)
+				}
+				muxConn, muxErr := dialSSHMux(ctx, muxPath)
+				if muxErr == nil {
+					logger.Debug(ctx, "connected to multiplexing master", slog.F("path", muxPath))
+					copier := newRawSSHCopier(logger, muxConn, stdioReader, stdioWriter)
+					if err = stack.push("rawSSHCopier", copier); err != nil {
+						return err
+					}
+					copier.copy(&wg)
+					return nil
+				}
+				logger.Debug(ctx, "no multiplexing master, connecting to the agent", slog.Error(muxErr))
+			}
+
 			// Select the startup script behavior based on template configuration or flags.
 			var wait bool
 			switch waitEnum {
@@ -242,6 +290,26 @@ func (r *RootCmd) ssh() *clibase.Cmd {
 				if err != nil {
 					return xerrors.Errorf("connect SSH: %w", err)
 				}
+				var master *sshMuxMaster
+				if multiplex {
+					master, err = listenSSHMux(logger, muxPath, func(ctx context.Context) (net.Conn, error) {
+						rawSSH, err := conn.SSH(ctx)
+						if err != nil {
+							return nil, err
+						}
+						return rawSSH, nil
+					})
+					if err != nil {
+						// Another master may have won the race, this
+						// session just isn't shared.
+						logger.Warn(ctx, "serve multiplexed connections", slog.Error(err))
+					} else {
+						muxMaster.Store(master)
+						if err = stack.push("muxMaster", master); err != nil {
+							return err
+						}
+					}
+				}
 				copier := newRawSSHCopier(logger, rawSSH, stdioReader, stdioWriter)
 				if err = stack.push("rawSSHCopier", copier); err != nil {
 					return err
@@ -256,6 +324,9 @@ func (r *RootCmd) ssh() *clibase.Cmd {
 					}, logger, client, workspace)
 				}()
 				copier.copy(&wg)
+				if master != nil {
+					_ = master.Shutdown(ctx)
+				}
 				return nil
 			}
 
@@ -426,6 +497,12 @@ func (r *RootCmd) ssh() *clibase.Cmd {
 			Description: "Specifies whether to emit SSH output over stdin/stdout.",
 			Value:       clibase.BoolOf(&stdio),
 		},
+		{
+			Flag:        "multiplex",
+			Env:         "CODER_SSH_MULTIPLEX",
+			Description: "Share a single connection to the workspace agent between stdio sessions, similar to the ControlMaster option of OpenSSH. The first session serves the others and exits once all of them ended.",
+			Value:       clibase.BoolOf(&multiplex),
+		},
 		{
 			Flag:          "forward-agent",
 			FlagShorthand: "A",
@@ -922,9 +999,16 @@ func (c *closerStack) push(name string, closer io.Closer) error {
 	return nil
 }
 
+// halfCloser is a raw SSH connection that can be closed for writing, e.g.
+// *gonet.TCPConn or *net.UnixConn.
+type halfCloser interface {
+	io.ReadWriter
+	CloseWrite() error
+}
+
 // rawSSHCopier handles copying raw SSH data between the conn and the pair (r, w).
 type rawSSHCopier struct {
-	conn   *gonet.TCPConn
+	conn   halfCloser
 	logger slog.Logger
 	r      io.Reader
 	w      io.Writer
@@ -932,7 +1016,7 @@ type rawSSHCopier struct {
 	done chan struct{}
 }
 
-func newRawSSHCopier(logger slog.Logger, conn *gonet.TCPConn, r io.Reader, w io.Writer) *rawSSHCopier {
+func newRawSSHCopier(logger slog.Logger, conn halfCloser, r io.Reader, w io.Writer) *rawSSHCopier {
 	return &rawSSHCopier{conn: conn, logger: logger, r: r, w: w, done: make(chan struct{})}
 }
 
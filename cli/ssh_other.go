@@ -9,9 +9,11 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"syscall"
 
 	gossh "golang.org/x/crypto/ssh"
 	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
 )
 
 func listenWindowSize(ctx context.Context) <-chan os.Signal {
@@ -46,3 +48,16 @@ func forwardGPGAgent(ctx context.Context, stderr io.Writer, sshClient *gossh.Cli
 
 	return sshRemoteForward(ctx, stderr, sshClient, localAddr, remoteAddr)
 }
+
+// checkSSHMuxDirPrivate verifies that only the current user can access the
+// directory of the multiplexing sockets.
+func checkSSHMuxDirPrivate(dir string, info os.FileInfo) error {
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		return xerrors.Errorf("socket directory %q must have mode 0700, not %#o", dir, perm)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || int(stat.Uid) != os.Getuid() {
+		return xerrors.Errorf("socket directory %q is not owned by the current user", dir)
+	}
+	return nil
+}
@@ -103,3 +103,9 @@ func forwardGPGAgent(ctx context.Context, stderr io.Writer, sshClient *gossh.Cli
 
 	return sshRemoteForward(ctx, stderr, sshClient, localAddr, remoteAddr)
 }
+
+// checkSSHMuxDirPrivate is a no-op, the temporary directory is private to the
+// user on Windows and modes aren't supported.
+func checkSSHMuxDirPrivate(string, os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+)
+
+// errSSHMuxActive is returned by listenSSHMux when another master serves the
+// socket.
+var errSSHMuxActive = xerrors.New("multiplexing master is already active")
+
+// sshMuxDialer dials a new raw SSH connection to the agent, e.g. over the
+// tailnet connection of the master.
+type sshMuxDialer func(ctx context.Context) (net.Conn, error)
+
+// sshMuxMaster lets clients connecting to the same agent share a single
+// tailnet connection, similar to the ControlMaster of OpenSSH. The first
+// client becomes the master and serves a unix socket. Every connection
+// accepted on the socket is a new SSH connection to the agent over the
+// tailnet connection of the master, so later clients skip the tailnet
+// handshake entirely.
+type sshMuxMaster struct {
+	logger   slog.Logger
+	listener net.Listener
+	dial     sshMuxDialer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	idle   chan struct{}
+	closed bool
+}
+
+// sshMuxSocketPath returns the path of the socket for the agent. The socket
+// is in $XDG_RUNTIME_DIR if set, or in a directory private to the current
+// user in the temporary directory otherwise.
+func sshMuxSocketPath(agentID string) (string, error) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("coder-ssh-mux-%d", os.Getuid()))
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		dir = filepath.Join(runtimeDir, "coder-ssh-mux")
+	}
+	err := ensureSSHMuxDir(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, agentID+".sock"), nil
+}
+
+// ensureSSHMuxDir creates the directory of the sockets, or verifies that an
+// existing one is private to the current user. Otherwise, another user could
+// serve the socket and receive the sessions of the clients.
+func ensureSSHMuxDir(dir string) error {
+	err := os.Mkdir(dir, 0o700)
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return xerrors.Errorf("create socket directory: %w", err)
+	}
+	// Lstat, since the directory must not be a symlink to a directory of
+	// another user.
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return xerrors.Errorf("stat socket directory: %w", err)
+	}
+	if !info.IsDir() {
+		return xerrors.Errorf("socket directory %q is not a directory", dir)
+	}
+	return checkSSHMuxDirPrivate(dir, info)
+}
+
+// dialSSHMux connects to the master serving the socket.
+func dialSSHMux(ctx context.Context, path string) (*net.UnixConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, xerrors.Errorf("dial multiplexing master: %w", err)
+	}
+	return conn.(*net.UnixConn), nil
+}
+
+// listenSSHMux creates the socket of a new master. Stale sockets left behind
+// by masters that exited are replaced. Connections are served until Close or
+// Shutdown is called.
+func listenSSHMux(logger slog.Logger, path string, dial sshMuxDialer) (*sshMuxMaster, error) {
+	listener, err := net.Listen("unix", path)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		conn, dialErr := net.Dial("unix", path)
+		if dialErr == nil {
+			_ = conn.Close()
+			return nil, errSSHMuxActive
+		}
+		_ = os.Remove(path)
+		listener, err = net.Listen("unix", path)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("listen on %q: %w", path, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &sshMuxMaster{
+		logger:   logger,
+		listener: listener,
+		dial:     dial,
+		ctx:      ctx,
+		cancel:   cancel,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	m.wg.Add(1)
+	go m.serve()
+	return m, nil
+}
+
+func (m *sshMuxMaster) serve() {
+	defer m.wg.Done()
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				m.logger.Warn(m.ctx, "accept multiplexed connection", slog.Error(err))
+			}
+			return
+		}
+		if !m.trackConn(conn, true) {
+			_ = conn.Close()
+			return
+		}
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			defer m.trackConn(conn, false)
+			m.handle(conn)
+		}()
+	}
+}
+
+func (m *sshMuxMaster) handle(conn net.Conn) {
+	defer conn.Close()
+
+	upstream, err := m.dial(m.ctx)
+	if err != nil {
+		m.logger.Warn(m.ctx, "dial agent for multiplexed connection", slog.Error(err))
+		return
+	}
+	defer upstream.Close()
+	stop := context.AfterFunc(m.ctx, func() {
+		_ = upstream.Close()
+	})
+	defer stop()
+	m.logger.Debug(m.ctx, "serving multiplexed connection")
+
+	// Connections are half-closed, so the SSH server sees the client going
+	// away while reading and shuts the session down cleanly.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(upstream, conn)
+		closeWrite(upstream)
+	}()
+	_, _ = io.Copy(conn, upstream)
+	closeWrite(conn)
+	wg.Wait()
+	m.logger.Debug(m.ctx, "multiplexed connection closed")
+}
+
+// trackConn adds or removes an active connection. It returns false if the
+// master no longer accepts connections.
+func (m *sshMuxMaster) trackConn(conn net.Conn, add bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if add {
+		if m.closed {
+			return false
+		}
+		m.conns[conn] = struct{}{}
+		return true
+	}
+	delete(m.conns, conn)
+	if len(m.conns) == 0 && m.idle != nil {
+		close(m.idle)
+		m.idle = nil
+	}
+	return true
+}
+
+// Active returns the number of active multiplexed connections.
+func (m *sshMuxMaster) Active() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.conns)
+}
+
+// Shutdown stops accepting connections and removes the socket, so the next
+// client becomes a new master. It then waits for the active connections to
+// finish, or closes them when the context is done.
+func (m *sshMuxMaster) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closed = true
+	var idle chan struct{}
+	if len(m.conns) > 0 {
+		if m.idle == nil {
+			m.idle = make(chan struct{})
+		}
+		idle = m.idle
+	}
+	m.mu.Unlock()
+	_ = m.listener.Close()
+
+	if idle != nil {
+		m.logger.Debug(ctx, "waiting for multiplexed connections", slog.F("active", m.Active()))
+		select {
+		case <-idle:
+		case <-ctx.Done():
+		}
+	}
+	err := m.Close()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Close stops accepting connections and closes the active ones.
+func (m *sshMuxMaster) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	for conn := range m.conns {
+		_ = conn.Close()
+	}
+	m.mu.Unlock()
+	m.cancel()
+	err := m.listener.Close()
+	m.wg.Wait()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestSSHMux(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not supported on all Windows versions")
+	}
+
+	// The echo server stands in for the SSH server of the agent.
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = echo.Close() })
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	dial := func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", echo.Addr().String())
+	}
+
+	logger := slogtest.Make(t, nil)
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	master, err := listenSSHMux(logger, path, dial)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = master.Close() })
+
+	_, err = listenSSHMux(logger, path, dial)
+	require.ErrorIs(t, err, errSSHMuxActive)
+
+	ctx := testutil.Context(t, testutil.WaitShort)
+	conn, err := dialSSHMux(ctx, path)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	got := make([]byte, 5)
+	_, err = io.ReadFull(conn, got)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(got))
+	require.Equal(t, 1, master.Active())
+
+	// Shutdown waits for the active connection, but new clients can't
+	// connect anymore.
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- master.Shutdown(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		_, err := dialSSHMux(ctx, path)
+		return err != nil
+	}, testutil.WaitShort, testutil.IntervalFast)
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned with an active connection: %v", err)
+	default:
+	}
+
+	_, err = conn.Write([]byte("again"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, got)
+	require.NoError(t, err)
+	require.Equal(t, "again", string(got))
+
+	require.NoError(t, conn.CloseWrite())
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	select {
+	case err := <-shutdown:
+		require.NoError(t, err)
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for shutdown")
+	}
+
+	// A new master takes over the socket.
+	master, err = listenSSHMux(logger, path, dial)
+	require.NoError(t, err)
+	require.NoError(t, master.Close())
+}
+
+func TestEnsureSSHMuxDir(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("modes are not supported on Windows")
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		t.Parallel()
+		dir := filepath.Join(t.TempDir(), "mux")
+		require.NoError(t, ensureSSHMuxDir(dir))
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+		// Existing private directories are reused.
+		require.NoError(t, ensureSSHMuxDir(dir))
+	})
+
+	t.Run("Mode", func(t *testing.T) {
+		t.Parallel()
+		dir := filepath.Join(t.TempDir(), "mux")
+		require.NoError(t, os.Mkdir(dir, 0o700))
+		require.NoError(t, os.Chmod(dir, 0o755))
+		require.ErrorContains(t, ensureSSHMuxDir(dir), "mode")
+	})
+
+	t.Run("Symlink", func(t *testing.T) {
+		t.Parallel()
+		target := t.TempDir()
+		dir := filepath.Join(t.TempDir(), "mux")
+		require.NoError(t, os.Symlink(target, dir))
+		require.ErrorContains(t, ensureSSHMuxDir(dir), "not a directory")
+	})
+}
@@ -149,8 +149,9 @@ func TestStart(t *testing.T) {
 		actualParameters, err := client.WorkspaceBuildParameters(ctx, workspace.LatestBuild.ID)
 		require.NoError(t, err)
 		require.Contains(t, actualParameters, codersdk.WorkspaceBuildParameter{
-			Name:  ephemeralParameterName,
-			Value: ephemeralParameterValue,
+			Name:   ephemeralParameterName,
+			Value:  ephemeralParameterValue,
+			Source: codersdk.WorkspaceBuildParameterSourceUserInput,
 		})
 	})
 
@@ -192,8 +193,9 @@ func TestStart(t *testing.T) {
 		actualParameters, err := client.WorkspaceBuildParameters(ctx, workspace.LatestBuild.ID)
 		require.NoError(t, err)
 		require.Contains(t, actualParameters, codersdk.WorkspaceBuildParameter{
-			Name:  ephemeralParameterName,
-			Value: ephemeralParameterValue,
+			Name:   ephemeralParameterName,
+			Value:  ephemeralParameterValue,
+			Source: codersdk.WorkspaceBuildParameterSourceUserInput,
 		})
 	})
 }
@@ -248,8 +250,9 @@ func TestStartWithParameters(t *testing.T) {
 		actualParameters, err := client.WorkspaceBuildParameters(ctx, workspace.LatestBuild.ID)
 		require.NoError(t, err)
 		require.Contains(t, actualParameters, codersdk.WorkspaceBuildParameter{
-			Name:  immutableParameterName,
-			Value: immutableParameterValue,
+			Name:   immutableParameterName,
+			Value:  immutableParameterValue,
+			Source: codersdk.WorkspaceBuildParameterSourcePreviousBuild,
 		})
 	})
 
@@ -303,8 +306,9 @@ func TestStartWithParameters(t *testing.T) {
 		actualParameters, err := client.WorkspaceBuildParameters(ctx, workspace.LatestBuild.ID)
 		require.NoError(t, err)
 		require.Contains(t, actualParameters, codersdk.WorkspaceBuildParameter{
-			Name:  mutableParameterName,
-			Value: newValue,
+			Name:   mutableParameterName,
+			Value:  newValue,
+			Source: codersdk.WorkspaceBuildParameterSourceUserInput,
 		})
 	})
 }
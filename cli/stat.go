@@ -1,12 +1,16 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/spf13/afero"
 	"golang.org/x/xerrors"
 
+	"github.com/coder/coder/v2/agent/agentscripts"
 	"github.com/coder/coder/v2/cli/clibase"
 	"github.com/coder/coder/v2/cli/clistat"
 	"github.com/coder/coder/v2/cli/cliui"
@@ -49,6 +53,7 @@ func (r *RootCmd) stat() *clibase.Cmd {
 			r.statCPU(fs),
 			r.statMem(fs),
 			r.statDisk(fs),
+			r.statScripts(),
 		},
 		Handler: func(inv *clibase.Invocation) error {
 			var sr statsRow
@@ -290,3 +295,105 @@ type statsRow struct {
 	ContainerCPU    *clistat.Result `json:"container_cpu" table:"container_cpu"`
 	ContainerMemory *clistat.Result `json:"container_memory" table:"container_memory"`
 }
+
+type scriptRunRow struct {
+	agentscripts.ScriptRun `table:"-"`
+
+	StartedAt  string `json:"-" table:"started at,default_sort"`
+	Script     string `json:"-" table:"script"`
+	State      string `json:"-" table:"state"`
+	ExitCode   int    `json:"-" table:"exit code"`
+	Duration   string `json:"-" table:"duration"`
+	Error      string `json:"-" table:"error"`
+	LastOutput string `json:"-" table:"last output"`
+}
+
+func scriptRunRowFromRun(run agentscripts.ScriptRun) scriptRunRow {
+	script := run.Script.LogPath
+	if script == "" {
+		script = run.Script.LogSourceID.String()
+	}
+	var lastOutput string
+	if len(run.Output) > 0 {
+		lastOutput = run.Output[len(run.Output)-1]
+	}
+	return scriptRunRow{
+		ScriptRun:  run,
+		StartedAt:  run.StartedAt.Format(time.DateTime),
+		Script:     script,
+		State:      string(run.State),
+		ExitCode:   run.ExitCode,
+		Duration:   run.Duration.Round(time.Millisecond).String(),
+		Error:      run.Error,
+		LastOutput: lastOutput,
+	}
+}
+
+func (*RootCmd) statScripts() *clibase.Cmd {
+	var (
+		debugAddress string
+		failedOnly   bool
+		formatter    = cliui.NewOutputFormatter(
+			cliui.TableFormat([]scriptRunRow{}, []string{"started_at", "script", "state", "exit_code", "duration", "last_output"}),
+			cliui.JSONFormat(),
+		)
+	)
+	cmd := &clibase.Cmd{
+		Use:   "scripts",
+		Short: "Show the recent runs of the scripts of the workspace agent.",
+		Options: clibase.OptionSet{
+			{
+				Flag:        "agent-debug-address",
+				Env:         "CODER_AGENT_DEBUG_ADDRESS",
+				Default:     "127.0.0.1:2113",
+				Value:       clibase.StringOf(&debugAddress),
+				Description: "The address of the debug HTTP server of the workspace agent.",
+			},
+			{
+				Flag:        "failed",
+				Value:       clibase.BoolOf(&failedOnly),
+				Description: "Only show runs that failed or timed out.",
+			},
+		},
+		Handler: func(inv *clibase.Invocation) error {
+			ctx := inv.Context()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+debugAddress+"/debug/script-runs", nil)
+			if err != nil {
+				return xerrors.Errorf("create request: %w", err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return xerrors.Errorf("query the workspace agent, is it running in this workspace? %w", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				return xerrors.Errorf("query the workspace agent: unexpected status %d", res.StatusCode)
+			}
+			var runs []agentscripts.ScriptRun
+			err = json.NewDecoder(res.Body).Decode(&runs)
+			if err != nil {
+				return xerrors.Errorf("decode script runs: %w", err)
+			}
+
+			rows := make([]scriptRunRow, 0, len(runs))
+			for _, run := range runs {
+				if failedOnly && run.State == agentscripts.ScriptStateSucceeded {
+					continue
+				}
+				rows = append(rows, scriptRunRowFromRun(run))
+			}
+			if len(rows) == 0 {
+				_, _ = fmt.Fprintln(inv.Stderr, "No script runs found.")
+				return nil
+			}
+			out, err := formatter.Format(ctx, rows)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(inv.Stdout, out)
+			return err
+		},
+	}
+	formatter.AttachOptions(&cmd.Options)
+	return cmd
+}
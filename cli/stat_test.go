@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/coder/coder/v2/agent/agentscripts"
 	"github.com/coder/coder/v2/cli/clistat"
 	"github.com/coder/coder/v2/cli/clitest"
+	"github.com/coder/coder/v2/codersdk"
 	"github.com/coder/coder/v2/testutil"
 )
 
@@ -183,3 +188,57 @@ func TestStatDiskCmd(t *testing.T) {
 		require.Contains(t, err.Error(), `not found: "/this/path/does/not/exist"`)
 	})
 }
+
+func TestStatScriptsCmd(t *testing.T) {
+	t.Parallel()
+
+	runs := []agentscripts.ScriptRun{{
+		ScriptStatus: agentscripts.ScriptStatus{
+			Script:    codersdk.WorkspaceAgentScript{LogPath: "coder-startup-script.log"},
+			State:     agentscripts.ScriptStateFailed,
+			StartedAt: time.Now().Add(-time.Minute),
+			ExitCode:  1,
+			Error:     "exit status 1",
+		},
+		Duration: time.Second,
+		Output:   []string{"installing", "permission denied"},
+	}, {
+		ScriptStatus: agentscripts.ScriptStatus{
+			Script:    codersdk.WorkspaceAgentScript{LogPath: "coder-backup.log"},
+			State:     agentscripts.ScriptStateSucceeded,
+			StartedAt: time.Now().Add(-2 * time.Minute),
+		},
+	}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/debug/script-runs", r.URL.Path)
+		_ = json.NewEncoder(w).Encode(runs)
+	}))
+	t.Cleanup(srv.Close)
+	address := strings.TrimPrefix(srv.URL, "http://")
+
+	t.Run("Table", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		inv, _ := clitest.New(t, "stat", "scripts", "--agent-debug-address", address)
+		buf := new(bytes.Buffer)
+		inv.Stdout = buf
+		err := inv.WithContext(ctx).Run()
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), "coder-startup-script.log")
+		require.Contains(t, buf.String(), "permission denied")
+		require.Contains(t, buf.String(), "coder-backup.log")
+	})
+	t.Run("FailedJSON", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		inv, _ := clitest.New(t, "stat", "scripts", "--agent-debug-address", address, "--failed", "--output=json")
+		buf := new(bytes.Buffer)
+		inv.Stdout = buf
+		err := inv.WithContext(ctx).Run()
+		require.NoError(t, err)
+		var got []agentscripts.ScriptRun
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+		require.Len(t, got, 1)
+		require.Equal(t, runs[0].Output, got[0].Output)
+	})
+}
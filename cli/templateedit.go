@@ -35,6 +35,9 @@ func (r *RootCmd) templateEdit() *clibase.Cmd {
 		allowUserAutostop              bool
 		requireActiveVersion           bool
 		deprecationMessage             string
+		maxAppSharingLevel             string
+		codeServer                     bool
+		replaceOnFailure               bool
 		disableEveryone                bool
 	)
 	client := new(codersdk.Client)
@@ -162,6 +165,22 @@ func (r *RootCmd) templateEdit() *clibase.Cmd {
 				deprecated = &deprecationMessage
 			}
 
+			var appSharingLevel *codersdk.WorkspaceAppSharingLevel
+			if userSetOption(inv, "max-app-sharing-level") {
+				level := codersdk.WorkspaceAppSharingLevel(maxAppSharingLevel)
+				appSharingLevel = &level
+			}
+
+			var codeServerEnabled *bool
+			if userSetOption(inv, "code-server") {
+				codeServerEnabled = &codeServer
+			}
+
+			var replaceResourcesOnFailure *bool
+			if userSetOption(inv, "replace-on-failure") {
+				replaceResourcesOnFailure = &replaceOnFailure
+			}
+
 			var disableEveryoneGroup bool
 			if userSetOption(inv, "private") {
 				disableEveryoneGroup = disableEveryone
@@ -190,6 +209,9 @@ func (r *RootCmd) templateEdit() *clibase.Cmd {
 				RequireActiveVersion:           requireActiveVersion,
 				DeprecationMessage:             deprecated,
 				DisableEveryoneGroupAccess:     disableEveryoneGroup,
+				MaxAppSharingLevel:             appSharingLevel,
+				CodeServerEnabled:              codeServerEnabled,
+				ReplaceOnFailure:               replaceResourcesOnFailure,
 			}
 
 			_, err = client.UpdateTemplateMeta(inv.Context(), template.ID, req)
@@ -320,6 +342,25 @@ func (r *RootCmd) templateEdit() *clibase.Cmd {
 			Value:       clibase.BoolOf(&requireActiveVersion),
 			Default:     "false",
 		},
+		{
+			Flag:        "max-app-sharing-level",
+			Description: "Edit the widest sharing level the apps of workspaces built from this template may use. Builds planning apps shared more widely fail.",
+			Value: clibase.EnumOf(&maxAppSharingLevel,
+				string(codersdk.WorkspaceAppSharingLevelOwner),
+				string(codersdk.WorkspaceAppSharingLevelAuthenticated),
+				string(codersdk.WorkspaceAppSharingLevelPublic),
+			),
+		},
+		{
+			Flag:        "code-server",
+			Description: "Enable the code-server installed and supervised by the agents of workspaces built from this template. It applies to workspaces when they're next built.",
+			Value:       clibase.BoolOf(&codeServer),
+		},
+		{
+			Flag:        "replace-on-failure",
+			Description: "Replace the resources that failed to update in the previous build of a workspace, or whose agents failed to connect or start, when the workspace is next built.",
+			Value:       clibase.BoolOf(&replaceOnFailure),
+		},
 		{
 			Flag: "private",
 			Description: "Disable the default behavior of granting template access to the 'everyone' group. " +
@@ -220,8 +220,9 @@ func TestUpdateWithRichParameters(t *testing.T) {
 		actualParameters, err := client.WorkspaceBuildParameters(ctx, workspace.LatestBuild.ID)
 		require.NoError(t, err)
 		require.Contains(t, actualParameters, codersdk.WorkspaceBuildParameter{
-			Name:  ephemeralParameterName,
-			Value: ephemeralParameterValue,
+			Name:   ephemeralParameterName,
+			Value:  ephemeralParameterValue,
+			Source: codersdk.WorkspaceBuildParameterSourceUserInput,
 		})
 	})
 
@@ -270,8 +271,9 @@ func TestUpdateWithRichParameters(t *testing.T) {
 		actualParameters, err := client.WorkspaceBuildParameters(ctx, workspace.LatestBuild.ID)
 		require.NoError(t, err)
 		require.Contains(t, actualParameters, codersdk.WorkspaceBuildParameter{
-			Name:  ephemeralParameterName,
-			Value: ephemeralParameterValue,
+			Name:   ephemeralParameterName,
+			Value:  ephemeralParameterValue,
+			Source: codersdk.WorkspaceBuildParameterSourceUserInput,
 		})
 	})
 }
@@ -41,6 +41,7 @@ type API struct {
 	*AppsAPI
 	*MetadataAPI
 	*LogsAPI
+	*NotificationsAPI
 	*tailnet.DRPCService
 
 	mu                sync.Mutex
@@ -64,13 +65,23 @@ type Options struct {
 	PublishWorkspaceUpdateFn          func(ctx context.Context, workspaceID uuid.UUID)
 	PublishWorkspaceAgentLogsUpdateFn func(ctx context.Context, workspaceAgentID uuid.UUID, msg agentsdk.LogsNotifyMessage)
 
-	AccessURL                 *url.URL
-	AppHostname               string
-	AgentStatsRefreshInterval time.Duration
-	DisableDirectConnections  bool
-	DerpForceWebSockets       bool
-	DerpMapUpdateFrequency    time.Duration
-	ExternalAuthConfigs       []*externalauth.Config
+	AccessURL                      *url.URL
+	AppHostname                    string
+	AgentStatsRefreshInterval      time.Duration
+	DisableDirectConnections       bool
+	DerpForceWebSockets            bool
+	DerpMapUpdateFrequency         time.Duration
+	DerpMapFallbacks               []agentsdk.DERPMapSource
+	ExternalAuthConfigs            []*externalauth.Config
+	ExecPolicy                     []agentsdk.ExecPolicyRule
+	ReconnectingPTYPersistence     bool
+	ReconnectingPTYScrollbackLines int
+	Proxy                          *agentsdk.ProxyConfig
+	MOTDTemplate                   string
+	CodeServer                     *agentsdk.CodeServerConfig
+	SSHKeepAlive                   *agentsdk.SSHKeepAliveConfig
+	UpdatePolicy                   *agentsdk.AgentUpdatePolicy
+	AgentBinarySHA256              func(goos, goarch string) (string, error)
 
 	// Optional:
 	// WorkspaceID avoids a future lookup to find the workspace ID by setting
@@ -87,14 +98,24 @@ func New(opts Options) *API {
 	}
 
 	api.ManifestAPI = &ManifestAPI{
-		AccessURL:                opts.AccessURL,
-		AppHostname:              opts.AppHostname,
-		ExternalAuthConfigs:      opts.ExternalAuthConfigs,
-		DisableDirectConnections: opts.DisableDirectConnections,
-		DerpForceWebSockets:      opts.DerpForceWebSockets,
-		AgentFn:                  api.agent,
-		Database:                 opts.Database,
-		DerpMapFn:                opts.DerpMapFn,
+		AccessURL:                      opts.AccessURL,
+		AppHostname:                    opts.AppHostname,
+		ExternalAuthConfigs:            opts.ExternalAuthConfigs,
+		DisableDirectConnections:       opts.DisableDirectConnections,
+		DerpForceWebSockets:            opts.DerpForceWebSockets,
+		ExecPolicy:                     opts.ExecPolicy,
+		ReconnectingPTYPersistence:     opts.ReconnectingPTYPersistence,
+		ReconnectingPTYScrollbackLines: opts.ReconnectingPTYScrollbackLines,
+		Proxy:                          opts.Proxy,
+		MOTDTemplate:                   opts.MOTDTemplate,
+		CodeServer:                     opts.CodeServer,
+		SSHKeepAlive:                   opts.SSHKeepAlive,
+		UpdatePolicy:                   opts.UpdatePolicy,
+		AgentBinarySHA256:              opts.AgentBinarySHA256,
+		AgentFn:                        api.agent,
+		Database:                       opts.Database,
+		DerpMapFn:                      opts.DerpMapFn,
+		DerpMapFallbacks:               opts.DerpMapFallbacks,
 		WorkspaceIDFn: func(ctx context.Context, wa *database.WorkspaceAgent) (uuid.UUID, error) {
 			if opts.WorkspaceID != uuid.Nil {
 				return opts.WorkspaceID, nil
@@ -151,6 +172,13 @@ func New(opts Options) *API {
 		PublishWorkspaceAgentLogsUpdateFn: opts.PublishWorkspaceAgentLogsUpdateFn,
 	}
 
+	api.NotificationsAPI = &NotificationsAPI{
+		AgentFn:  api.agent,
+		Database: opts.Database,
+		Pubsub:   opts.Pubsub,
+		Log:      opts.Log,
+	}
+
 	api.DRPCService = &tailnet.DRPCService{
 		CoordPtr:               opts.TailnetCoordinator,
 		Logger:                 opts.Log,
@@ -2,6 +2,7 @@ package agentapi
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 	"golang.org/x/xerrors"
@@ -38,7 +39,10 @@ func (a *AppsAPI) BatchUpdateAppHealths(ctx context.Context, req *agentproto.Bat
 		return nil, xerrors.Errorf("get workspace apps by agent ID %q: %w", workspaceAgent.ID, err)
 	}
 
-	var newApps []database.WorkspaceApp
+	var (
+		newApps       []database.WorkspaceApp
+		healthChanged bool
+	)
 	for _, update := range req.Updates {
 		updateID, err := uuid.FromBytes(update.Id)
 		if err != nil {
@@ -76,10 +80,24 @@ func (a *AppsAPI) BatchUpdateAppHealths(ctx context.Context, req *agentproto.Bat
 			return nil, xerrors.Errorf("unknown health status %q for app %q (%q)", update.Health, updateID, old.Slug)
 		}
 
+		// The agent resends the latest healthcheck of every app on a
+		// heartbeat, only store it if it's a newer one.
+		reportChanged := false
+		if update.CheckedAt != nil {
+			checkedAt := update.CheckedAt.AsTime()
+			reportChanged = !old.HealthCheckedAt.Valid || !old.HealthCheckedAt.Time.Equal(checkedAt)
+			old.HealthLatencyMs = update.LatencyMs
+			old.HealthError = update.Error
+			old.HealthCheckedAt = sql.NullTime{Time: checkedAt, Valid: true}
+		}
+
 		// Don't bother updating if the value hasn't changed.
-		if old.Health == newHealth {
+		if old.Health == newHealth && !reportChanged {
 			continue
 		}
+		if old.Health != newHealth {
+			healthChanged = true
+		}
 		old.Health = newHealth
 
 		newApps = append(newApps, *old)
@@ -87,15 +105,20 @@ func (a *AppsAPI) BatchUpdateAppHealths(ctx context.Context, req *agentproto.Bat
 
 	for _, app := range newApps {
 		err = a.Database.UpdateWorkspaceAppHealthByID(ctx, database.UpdateWorkspaceAppHealthByIDParams{
-			ID:     app.ID,
-			Health: app.Health,
+			ID:              app.ID,
+			Health:          app.Health,
+			HealthLatencyMs: app.HealthLatencyMs,
+			HealthError:     app.HealthError,
+			HealthCheckedAt: app.HealthCheckedAt,
 		})
 		if err != nil {
 			return nil, xerrors.Errorf("update workspace app health for app %q (%q): %w", err, app.ID, app.Slug)
 		}
 	}
 
-	if a.PublishWorkspaceUpdateFn != nil && len(newApps) > 0 {
+	// Healthcheck results alone don't warrant waking up every watcher of
+	// the workspace, they're served with the next update.
+	if a.PublishWorkspaceUpdateFn != nil && healthChanged {
 		err = a.PublishWorkspaceUpdateFn(ctx, &workspaceAgent)
 		if err != nil {
 			return nil, xerrors.Errorf("publish workspace update: %w", err)
@@ -2,11 +2,13 @@ package agentapi_test
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"cdr.dev/slog/sloggers/slogtest"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/coder/coder/v2/coderd/agentapi"
 	"github.com/coder/coder/v2/coderd/database"
 	"github.com/coder/coder/v2/coderd/database/dbmock"
+	"github.com/coder/coder/v2/coderd/database/dbtime"
 )
 
 func TestBatchUpdateAppHealths(t *testing.T) {
@@ -126,6 +129,56 @@ func TestBatchUpdateAppHealths(t *testing.T) {
 		require.False(t, publishCalled)
 	})
 
+	t.Run("Report", func(t *testing.T) {
+		t.Parallel()
+
+		checkedAt := dbtime.Now()
+		dbM := dbmock.NewMockStore(gomock.NewController(t))
+		dbM.EXPECT().GetWorkspaceAppsByAgentID(gomock.Any(), agent.ID).Return([]database.WorkspaceApp{app1, app2}, nil)
+		dbM.EXPECT().UpdateWorkspaceAppHealthByID(gomock.Any(), database.UpdateWorkspaceAppHealthByIDParams{
+			ID:              app2.ID,
+			Health:          database.WorkspaceAppHealthHealthy,
+			HealthLatencyMs: 12.5,
+			HealthError:     "error status code: 502",
+			HealthCheckedAt: sql.NullTime{Time: checkedAt, Valid: true},
+		}).Return(nil)
+
+		publishCalled := false
+		api := &agentapi.AppsAPI{
+			AgentFn: func(context.Context) (database.WorkspaceAgent, error) {
+				return agent, nil
+			},
+			Database: dbM,
+			Log:      slogtest.Make(t, nil),
+			PublishWorkspaceUpdateFn: func(ctx context.Context, wa *database.WorkspaceAgent) error {
+				publishCalled = true
+				return nil
+			},
+		}
+
+		// A new healthcheck result is stored even though the health didn't
+		// change, but watchers aren't notified.
+		resp, err := api.BatchUpdateAppHealths(context.Background(), &agentproto.BatchUpdateAppHealthRequest{
+			Updates: []*agentproto.BatchUpdateAppHealthRequest_HealthUpdate{
+				{
+					Id:     app1.ID[:],
+					Health: agentproto.AppHealth_INITIALIZING,
+				},
+				{
+					Id:        app2.ID[:],
+					Health:    agentproto.AppHealth_HEALTHY,
+					LatencyMs: 12.5,
+					Error:     "error status code: 502",
+					CheckedAt: timestamppb.New(checkedAt),
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, &agentproto.BatchUpdateAppHealthResponse{}, resp)
+
+		require.False(t, publishCalled)
+	})
+
 	t.Run("Empty", func(t *testing.T) {
 		t.Parallel()
 
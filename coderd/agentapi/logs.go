@@ -2,18 +2,27 @@ package agentapi
 
 import (
 	"context"
+	"encoding/json"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/exp/maps"
 	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"cdr.dev/slog"
 	agentproto "github.com/coder/coder/v2/agent/proto"
 	"github.com/coder/coder/v2/coderd/database"
 	"github.com/coder/coder/v2/coderd/database/dbtime"
+	"github.com/coder/coder/v2/codersdk"
 	"github.com/coder/coder/v2/codersdk/agentsdk"
 )
 
+// maxLogFields is the maximum number of fields stored with a log.
+const maxLogFields = 32
+
 type LogsAPI struct {
 	AgentFn                           func(context.Context) (database.WorkspaceAgent, error)
 	Database                          database.Store
@@ -74,11 +83,35 @@ func (a *LogsAPI) BatchCreateLogs(ctx context.Context, req *agentproto.BatchCrea
 
 	output := make([]string, 0)
 	level := make([]database.LogLevel, 0)
+	fields := make([]string, 0)
+	stream := make([]string, 0)
 	outputLength := 0
 	for _, logEntry := range req.Logs {
 		output = append(output, logEntry.Output)
 		outputLength += len(logEntry.Output)
 
+		logFields := "{}"
+		if len(logEntry.Fields) > 0 {
+			data, err := json.Marshal(a.sanitizeLogFields(ctx, logEntry.Fields))
+			if err != nil {
+				return nil, xerrors.Errorf("marshal log fields: %w", err)
+			}
+			logFields = string(data)
+			// Fields are stored with the output, so they count toward
+			// the logs limit of the agent.
+			outputLength += len(logFields)
+		}
+		fields = append(fields, logFields)
+
+		var logStream string
+		switch logEntry.Stream {
+		case agentproto.Log_STDOUT:
+			logStream = string(codersdk.LogStreamStdout)
+		case agentproto.Log_STDERR:
+			logStream = string(codersdk.LogStreamStderr)
+		}
+		stream = append(stream, logStream)
+
 		var dbLevel database.LogLevel
 		switch logEntry.Level {
 		case agentproto.Log_TRACE:
@@ -106,6 +139,8 @@ func (a *LogsAPI) BatchCreateLogs(ctx context.Context, req *agentproto.BatchCrea
 		Level:        level,
 		LogSourceID:  logSourceID,
 		OutputLength: int32(outputLength),
+		Fields:       fields,
+		Stream:       stream,
 	})
 	if err != nil {
 		if !database.IsWorkspaceAgentLogsLimitError(err) {
@@ -151,3 +186,90 @@ func (a *LogsAPI) BatchCreateLogs(ctx context.Context, req *agentproto.BatchCrea
 
 	return &agentproto.BatchCreateLogsResponse{}, nil
 }
+
+// sanitizeLogFields removes NUL characters from the fields of a log, since
+// jsonb can't store them and a single one would fail the whole batch. Logs
+// keep at most maxLogFields fields, the first in the order of their keys.
+func (a *LogsAPI) sanitizeLogFields(ctx context.Context, fields map[string]string) map[string]string {
+	keys := maps.Keys(fields)
+	slices.Sort(keys)
+	if len(keys) > maxLogFields {
+		a.Log.Warn(ctx, "dropping fields of workspace agent log",
+			slog.F("fields", len(keys)), slog.F("max_fields", maxLogFields))
+		keys = keys[:maxLogFields]
+	}
+	sanitized := make(map[string]string, len(keys))
+	for _, key := range keys {
+		sanitized[strings.ReplaceAll(key, "\x00", "")] = strings.ReplaceAll(fields[key], "\x00", "")
+	}
+	return sanitized
+}
+
+// CreateLogSource registers a log source of the agent. Registering a source
+// again returns the existing one unchanged, so scripts and subsystems can
+// register their statically defined sources every time they start.
+func (a *LogsAPI) CreateLogSource(ctx context.Context, req *agentproto.CreateLogSourceRequest) (*agentproto.LogSource, error) {
+	workspaceAgent, err := a.AgentFn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logSourceID, err := uuid.FromBytes(req.Id)
+	if err != nil {
+		return nil, xerrors.Errorf("parse log source ID %q: %w", req.Id, err)
+	}
+	if logSourceID == uuid.Nil {
+		return nil, xerrors.New("log source ID is required")
+	}
+	if req.DisplayName == "" {
+		return nil, xerrors.New("log source display name is required")
+	}
+	if len(req.DisplayName) > 127 {
+		return nil, xerrors.New("log source display name must be at most 127 characters")
+	}
+
+	sources, err := a.Database.InsertWorkspaceAgentLogSources(ctx, database.InsertWorkspaceAgentLogSourcesParams{
+		WorkspaceAgentID: workspaceAgent.ID,
+		CreatedAt:        a.now(),
+		ID:               []uuid.UUID{logSourceID},
+		DisplayName:      []string{req.DisplayName},
+		Icon:             []string{req.Icon},
+	})
+	if database.IsUniqueViolation(err, database.UniqueWorkspaceAgentLogSourcesPkey) {
+		existing, err := a.Database.GetWorkspaceAgentLogSourcesByAgentIDs(ctx, []uuid.UUID{workspaceAgent.ID})
+		if err != nil {
+			return nil, xerrors.Errorf("get workspace agent log sources: %w", err)
+		}
+		for _, source := range existing {
+			if source.ID == logSourceID {
+				return protoFromLogSource(source), nil
+			}
+		}
+		return nil, xerrors.Errorf("log source %s conflicts but doesn't exist", logSourceID)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("insert workspace agent log source: %w", err)
+	}
+	if len(sources) != 1 {
+		return nil, xerrors.Errorf("inserted %d workspace agent log sources, expected 1", len(sources))
+	}
+
+	// The dashboard lists the log sources of agents, so it must refetch
+	// the workspace.
+	if a.PublishWorkspaceUpdateFn != nil {
+		err = a.PublishWorkspaceUpdateFn(ctx, &workspaceAgent)
+		if err != nil {
+			return nil, xerrors.Errorf("publish workspace update: %w", err)
+		}
+	}
+	return protoFromLogSource(sources[0]), nil
+}
+
+func protoFromLogSource(source database.WorkspaceAgentLogSource) *agentproto.LogSource {
+	return &agentproto.LogSource{
+		Id:               source.ID[:],
+		WorkspaceAgentId: source.WorkspaceAgentID[:],
+		CreatedAt:        timestamppb.New(source.CreatedAt),
+		DisplayName:      source.DisplayName,
+		Icon:             source.Icon,
+	}
+}
@@ -2,6 +2,8 @@ package agentapi_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -81,6 +83,7 @@ func TestBatchCreateLogs(t *testing.T) {
 					CreatedAt: timestamppb.New(now.Add(2 * time.Hour)),
 					Level:     agentproto.Log_INFO,
 					Output:    "log line 3",
+					Fields:    map[string]string{"step": "git"},
 				},
 				{
 					CreatedAt: timestamppb.New(now.Add(3 * time.Hour)),
@@ -91,6 +94,7 @@ func TestBatchCreateLogs(t *testing.T) {
 					CreatedAt: timestamppb.New(now.Add(4 * time.Hour)),
 					Level:     agentproto.Log_ERROR,
 					Output:    "log line 5",
+					Stream:    agentproto.Log_STDERR,
 				},
 				{
 					CreatedAt: timestamppb.New(now.Add(5 * time.Hour)),
@@ -108,6 +112,8 @@ func TestBatchCreateLogs(t *testing.T) {
 			Output:       make([]string, len(req.Logs)),
 			Level:        make([]database.LogLevel, len(req.Logs)),
 			OutputLength: 0,
+			Fields:       make([]string, len(req.Logs)),
+			Stream:       make([]string, len(req.Logs)),
 		}
 		insertWorkspaceAgentLogsReturn := make([]database.WorkspaceAgentLog, len(req.Logs))
 		for i, logEntry := range req.Logs {
@@ -118,6 +124,14 @@ func TestBatchCreateLogs(t *testing.T) {
 			}
 			insertWorkspaceAgentLogsParams.Level[i] = level
 			insertWorkspaceAgentLogsParams.OutputLength += int32(len(logEntry.Output))
+			insertWorkspaceAgentLogsParams.Fields[i] = "{}"
+			if logEntry.Fields != nil {
+				insertWorkspaceAgentLogsParams.Fields[i] = `{"step":"git"}`
+				insertWorkspaceAgentLogsParams.OutputLength += int32(len(`{"step":"git"}`))
+			}
+			if logEntry.Stream == agentproto.Log_STDERR {
+				insertWorkspaceAgentLogsParams.Stream[i] = "stderr"
+			}
 
 			insertWorkspaceAgentLogsReturn[i] = database.WorkspaceAgentLog{
 				AgentID:     agent.ID,
@@ -126,6 +140,8 @@ func TestBatchCreateLogs(t *testing.T) {
 				Output:      logEntry.Output,
 				Level:       insertWorkspaceAgentLogsParams.Level[i],
 				LogSourceID: logSource.ID,
+				Fields:      logEntry.Fields,
+				Stream:      insertWorkspaceAgentLogsParams.Stream[i],
 			}
 		}
 
@@ -186,6 +202,49 @@ func TestBatchCreateLogs(t *testing.T) {
 		require.True(t, publishWorkspaceAgentLogsUpdateCalled)
 	})
 
+	t.Run("Fields", func(t *testing.T) {
+		t.Parallel()
+
+		dbM := dbmock.NewMockStore(gomock.NewController(t))
+		api := &agentapi.LogsAPI{
+			AgentFn: func(context.Context) (database.WorkspaceAgent, error) {
+				return agent, nil
+			},
+			Database: dbM,
+			Log:      slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+		}
+
+		fields := map[string]string{"a\x00": "b\x00c"}
+		for i := 0; i < 40; i++ {
+			fields[fmt.Sprintf("z%02d", i)] = "v"
+		}
+		dbM.EXPECT().InsertWorkspaceAgentLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, params database.InsertWorkspaceAgentLogsParams) ([]database.WorkspaceAgentLog, error) {
+				require.Len(t, params.Fields, 1)
+				var stored map[string]string
+				require.NoError(t, json.Unmarshal([]byte(params.Fields[0]), &stored))
+				// NULs are removed, and only the first fields are kept.
+				require.Len(t, stored, 32)
+				require.Equal(t, "bc", stored["a"])
+				require.Equal(t, "v", stored["z30"])
+				require.NotContains(t, stored, "z31")
+				require.EqualValues(t, len("output")+len(params.Fields[0]), params.OutputLength)
+				return []database.WorkspaceAgentLog{{ID: 1}}, nil
+			})
+
+		resp, err := api.BatchCreateLogs(context.Background(), &agentproto.BatchCreateLogsRequest{
+			LogSourceId: logSource.ID[:],
+			Logs: []*agentproto.Log{{
+				CreatedAt: timestamppb.New(dbtime.Now()),
+				Level:     agentproto.Log_INFO,
+				Output:    "output",
+				Fields:    fields,
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, &agentproto.BatchCreateLogsResponse{}, resp)
+	})
+
 	t.Run("AlreadyOverflowed", func(t *testing.T) {
 		t.Parallel()
 
@@ -270,6 +329,8 @@ func TestBatchCreateLogs(t *testing.T) {
 			Output:       []string{"hello world"},
 			Level:        []database.LogLevel{database.LogLevelInfo},
 			OutputLength: int32(len(req.Logs[0].Output)),
+			Fields:       []string{"{}"},
+			Stream:       []string{""},
 		}
 		dbInsertRes := []database.WorkspaceAgentLog{
 			{
@@ -426,3 +487,111 @@ func TestBatchCreateLogs(t *testing.T) {
 		require.False(t, publishWorkspaceAgentLogsUpdateCalled)
 	})
 }
+
+func TestCreateLogSource(t *testing.T) {
+	t.Parallel()
+
+	var (
+		agent = database.WorkspaceAgent{
+			ID: uuid.New(),
+		}
+		sourceID = uuid.New()
+		now      = dbtime.Now()
+	)
+
+	newAPI := func(t *testing.T, dbM *dbmock.MockStore, published *bool) *agentapi.LogsAPI {
+		return &agentapi.LogsAPI{
+			AgentFn: func(context.Context) (database.WorkspaceAgent, error) {
+				return agent, nil
+			},
+			Database: dbM,
+			Log:      slogtest.Make(t, nil),
+			PublishWorkspaceUpdateFn: func(ctx context.Context, wa *database.WorkspaceAgent) error {
+				*published = true
+				return nil
+			},
+			TimeNowFn: func() time.Time { return now },
+		}
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		t.Parallel()
+
+		dbM := dbmock.NewMockStore(gomock.NewController(t))
+		published := false
+		api := newAPI(t, dbM, &published)
+
+		dbM.EXPECT().InsertWorkspaceAgentLogSources(gomock.Any(), database.InsertWorkspaceAgentLogSourcesParams{
+			WorkspaceAgentID: agent.ID,
+			CreatedAt:        now,
+			ID:               []uuid.UUID{sourceID},
+			DisplayName:      []string{"Dotfiles"},
+			Icon:             []string{"/icon/dotfiles.svg"},
+		}).Return([]database.WorkspaceAgentLogSource{{
+			WorkspaceAgentID: agent.ID,
+			CreatedAt:        now,
+			ID:               sourceID,
+			DisplayName:      "Dotfiles",
+			Icon:             "/icon/dotfiles.svg",
+		}}, nil)
+
+		source, err := api.CreateLogSource(context.Background(), &agentproto.CreateLogSourceRequest{
+			Id:          sourceID[:],
+			DisplayName: "Dotfiles",
+			Icon:        "/icon/dotfiles.svg",
+		})
+		require.NoError(t, err)
+		require.Equal(t, sourceID[:], source.Id)
+		require.Equal(t, agent.ID[:], source.WorkspaceAgentId)
+		require.Equal(t, "Dotfiles", source.DisplayName)
+		require.Equal(t, "/icon/dotfiles.svg", source.Icon)
+		require.True(t, published)
+	})
+
+	t.Run("Exists", func(t *testing.T) {
+		t.Parallel()
+
+		dbM := dbmock.NewMockStore(gomock.NewController(t))
+		published := false
+		api := newAPI(t, dbM, &published)
+
+		dbM.EXPECT().InsertWorkspaceAgentLogSources(gomock.Any(), gomock.Any()).Return(nil, &pq.Error{
+			Code:       pq.ErrorCode("23505"), // unique_violation
+			Constraint: string(database.UniqueWorkspaceAgentLogSourcesPkey),
+		})
+		dbM.EXPECT().GetWorkspaceAgentLogSourcesByAgentIDs(gomock.Any(), []uuid.UUID{agent.ID}).Return([]database.WorkspaceAgentLogSource{{
+			WorkspaceAgentID: agent.ID,
+			CreatedAt:        now.Add(-time.Hour),
+			ID:               sourceID,
+			DisplayName:      "Dotfiles",
+		}}, nil)
+
+		source, err := api.CreateLogSource(context.Background(), &agentproto.CreateLogSourceRequest{
+			Id:          sourceID[:],
+			DisplayName: "Renamed",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "Dotfiles", source.DisplayName)
+		require.Equal(t, now.Add(-time.Hour), source.CreatedAt.AsTime())
+		require.False(t, published)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+
+		dbM := dbmock.NewMockStore(gomock.NewController(t))
+		published := false
+		api := newAPI(t, dbM, &published)
+
+		_, err := api.CreateLogSource(context.Background(), &agentproto.CreateLogSourceRequest{
+			Id:          uuid.Nil[:],
+			DisplayName: "Dotfiles",
+		})
+		require.ErrorContains(t, err, "ID is required")
+
+		_, err = api.CreateLogSource(context.Background(), &agentproto.CreateLogSourceRequest{
+			Id: sourceID[:],
+		})
+		require.ErrorContains(t, err, "display name is required")
+	})
+}
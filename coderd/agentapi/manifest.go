@@ -11,6 +11,7 @@ import (
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/xerrors"
 	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"tailscale.com/tailcfg"
 
 	agentproto "github.com/coder/coder/v2/agent/proto"
@@ -20,6 +21,7 @@ import (
 	"github.com/coder/coder/v2/coderd/externalauth"
 	"github.com/coder/coder/v2/coderd/workspaceapps/appurl"
 	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
 	"github.com/coder/coder/v2/tailnet"
 )
 
@@ -29,11 +31,29 @@ type ManifestAPI struct {
 	ExternalAuthConfigs      []*externalauth.Config
 	DisableDirectConnections bool
 	DerpForceWebSockets      bool
+	ExecPolicy               []agentsdk.ExecPolicyRule
+	// ReconnectingPTYPersistence and ReconnectingPTYScrollbackLines
+	// configure web terminal sessions backed by screen.
+	ReconnectingPTYPersistence     bool
+	ReconnectingPTYScrollbackLines int
+	Proxy                          *agentsdk.ProxyConfig
+	// MOTDTemplate enables the message of the day rendered by the agent,
+	// with the deadline and the warnings of the workspace.
+	MOTDTemplate string
+	// CodeServer is sent to the agents of templates enabling code-server.
+	CodeServer   *agentsdk.CodeServerConfig
+	SSHKeepAlive *agentsdk.SSHKeepAliveConfig
+	UpdatePolicy *agentsdk.AgentUpdatePolicy
+	// AgentBinarySHA256 returns the checksum of the agent binary of the
+	// deployment for a platform, which is added to the update policy.
+	AgentBinarySHA256 func(goos, goarch string) (string, error)
 
 	AgentFn       func(context.Context) (database.WorkspaceAgent, error)
 	WorkspaceIDFn func(context.Context, *database.WorkspaceAgent) (uuid.UUID, error)
 	Database      database.Store
 	DerpMapFn     func() *tailcfg.DERPMap
+	// DerpMapFallbacks are the DERP maps agents fail over to, in order.
+	DerpMapFallbacks []agentsdk.DERPMapSource
 }
 
 func (a *ManifestAPI) GetManifest(ctx context.Context, _ *agentproto.GetManifestRequest) (*agentproto.Manifest, error) {
@@ -49,9 +69,13 @@ func (a *ManifestAPI) GetManifest(ctx context.Context, _ *agentproto.GetManifest
 	var (
 		dbApps    []database.WorkspaceApp
 		scripts   []database.WorkspaceAgentScript
+		sources   []database.WorkspaceAgentLogSource
 		metadata  []database.WorkspaceAgentMetadatum
 		workspace database.Workspace
 		owner     database.User
+		job       database.ProvisionerJob
+		motd      *agentproto.MOTDConfig
+		template  database.Template
 	)
 
 	var eg errgroup.Group
@@ -67,6 +91,13 @@ func (a *ManifestAPI) GetManifest(ctx context.Context, _ *agentproto.GetManifest
 		scripts, err = a.Database.GetWorkspaceAgentScriptsByAgentIDs(dbauthz.AsSystemRestricted(ctx), []uuid.UUID{workspaceAgent.ID})
 		return err
 	})
+	eg.Go(func() (err error) {
+		// The agent annotates the logs of scripts with the display names of
+		// their log sources.
+		// nolint:gocritic // This is necessary to fetch agent log sources!
+		sources, err = a.Database.GetWorkspaceAgentLogSourcesByAgentIDs(dbauthz.AsSystemRestricted(ctx), []uuid.UUID{workspaceAgent.ID})
+		return err
+	})
 	eg.Go(func() (err error) {
 		metadata, err = a.Database.GetWorkspaceAgentMetadata(ctx, database.GetWorkspaceAgentMetadataParams{
 			WorkspaceAgentID: workspaceAgent.ID,
@@ -83,13 +114,41 @@ func (a *ManifestAPI) GetManifest(ctx context.Context, _ *agentproto.GetManifest
 		if err != nil {
 			return xerrors.Errorf("getting workspace owner by id: %w", err)
 		}
-		return err
+		// nolint:gocritic // This is necessary to fetch the template settings
+		// and the active template version!
+		template, err = a.Database.GetTemplateByID(dbauthz.AsSystemRestricted(ctx), workspace.TemplateID)
+		if err != nil {
+			return xerrors.Errorf("getting template by id: %w", err)
+		}
+		return nil
+	})
+	eg.Go(func() (err error) {
+		// The status of the build lets the agent run scripts once the build
+		// completes.
+		// nolint:gocritic // This is necessary to fetch the agent's build!
+		resource, err := a.Database.GetWorkspaceResourceByID(dbauthz.AsSystemRestricted(ctx), workspaceAgent.ResourceID)
+		if err != nil {
+			return xerrors.Errorf("getting workspace resource by id: %w", err)
+		}
+		// nolint:gocritic // This is necessary to fetch the agent's build!
+		job, err = a.Database.GetProvisionerJobByID(dbauthz.AsSystemRestricted(ctx), resource.JobID)
+		if err != nil {
+			return xerrors.Errorf("getting provisioner job by id: %w", err)
+		}
+		return nil
 	})
 	err = eg.Wait()
 	if err != nil {
 		return nil, xerrors.Errorf("fetching workspace agent data: %w", err)
 	}
 
+	if a.MOTDTemplate != "" {
+		motd, err = a.motd(ctx, workspace, template)
+		if err != nil {
+			return nil, xerrors.Errorf("getting motd: %w", err)
+		}
+	}
+
 	appSlug := appurl.ApplicationURL{
 		AppSlugOrPort: "{{port}}",
 		AgentName:     workspaceAgent.Name,
@@ -116,10 +175,36 @@ func (a *ManifestAPI) GetManifest(ctx context.Context, _ *agentproto.GetManifest
 		return nil, xerrors.Errorf("converting workspace apps: %w", err)
 	}
 
+	execPolicy, err := agentsdk.ProtoFromExecPolicy(a.ExecPolicy)
+	if err != nil {
+		return nil, xerrors.Errorf("converting exec policy: %w", err)
+	}
+
+	// Display apps are always reported, since agents enable all of them if
+	// they aren't, even if the template disabled all of them.
+	displayApps := agentsdk.ProtoFromDisplayApps(db2sdk.DisplayApps(workspaceAgent.DisplayApps))
+
+	var updatePolicy *agentsdk.AgentUpdatePolicy
+	if a.UpdatePolicy != nil {
+		policy := *a.UpdatePolicy
+		if a.AgentBinarySHA256 != nil {
+			// Without a checksum agents refuse to update, so errors, e.g.
+			// if the deployment doesn't serve the platform, disable it.
+			policy.SHA256, _ = a.AgentBinarySHA256(workspaceAgent.OperatingSystem, workspaceAgent.Architecture)
+		}
+		updatePolicy = &policy
+	}
+
+	var codeServer *agentsdk.CodeServerConfig
+	if template.CodeServerEnabled {
+		codeServer = a.CodeServer
+	}
+
 	return &agentproto.Manifest{
 		AgentId:                  workspaceAgent.ID[:],
 		AgentName:                workspaceAgent.Name,
 		OwnerUsername:            owner.Username,
+		OwnerEmail:               owner.Email,
 		WorkspaceId:              workspace.ID[:],
 		WorkspaceName:            workspace.Name,
 		GitAuthConfigs:           gitAuthConfigs,
@@ -130,13 +215,82 @@ func (a *ManifestAPI) GetManifest(ctx context.Context, _ *agentproto.GetManifest
 		DisableDirectConnections: a.DisableDirectConnections,
 		DerpForceWebsockets:      a.DerpForceWebSockets,
 
-		DerpMap:  tailnet.DERPMapToProto(a.DerpMapFn()),
-		Scripts:  dbAgentScriptsToProto(scripts),
-		Apps:     apps,
-		Metadata: dbAgentMetadataToProtoDescription(metadata),
+		DerpMap:          tailnet.DERPMapToProto(a.DerpMapFn()),
+		DerpMapFallbacks: agentsdk.ProtoFromDERPMapSources(a.DerpMapFallbacks),
+		Scripts:          dbAgentScriptsToProto(scripts, sources),
+		Apps:             apps,
+		Metadata:         dbAgentMetadataToProtoDescription(metadata),
+
+		BuildStatus: agentsdk.ProtoFromBuildStatus(codersdk.ProvisionerJobStatus(job.JobStatus)),
+		DisplayApps: displayApps,
+		ExecPolicy:  execPolicy,
+
+		ReconnectingPtyPersistence:     a.ReconnectingPTYPersistence,
+		ReconnectingPtyScrollbackLines: int32(a.ReconnectingPTYScrollbackLines),
+		Proxy:                          agentsdk.ProtoFromProxyConfig(a.Proxy),
+		Motd:                           motd,
+		CodeServer:                     agentsdk.ProtoFromCodeServerConfig(codeServer),
+		SshKeepalive:                   agentsdk.ProtoFromSSHKeepAliveConfig(a.SSHKeepAlive),
+		UpdatePolicy:                   agentsdk.ProtoFromAgentUpdatePolicy(updatePolicy),
 	}, nil
 }
 
+// GetMOTD returns the message of the day of the workspace. Agents refresh
+// it periodically, since the deadline and the builds of the workspace change
+// while the agent runs. It's empty if the MOTD isn't enabled.
+func (a *ManifestAPI) GetMOTD(ctx context.Context, _ *agentproto.GetMOTDRequest) (*agentproto.MOTDConfig, error) {
+	if a.MOTDTemplate == "" {
+		return &agentproto.MOTDConfig{}, nil
+	}
+	workspaceAgent, err := a.AgentFn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	workspaceID, err := a.WorkspaceIDFn(ctx, &workspaceAgent)
+	if err != nil {
+		return nil, err
+	}
+	workspace, err := a.Database.GetWorkspaceByID(ctx, workspaceID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting workspace by id: %w", err)
+	}
+	// nolint:gocritic // This is necessary to fetch the active template version!
+	template, err := a.Database.GetTemplateByID(dbauthz.AsSystemRestricted(ctx), workspace.TemplateID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting template by id: %w", err)
+	}
+	return a.motd(ctx, workspace, template)
+}
+
+// motd returns the message of the day of the workspace, with the deadline and
+// the warnings of the latest build. The build that created the agent can't
+// have failed while the agent runs, but later builds, e.g. updates, can.
+func (a *ManifestAPI) motd(ctx context.Context, workspace database.Workspace, template database.Template) (*agentproto.MOTDConfig, error) {
+	// nolint:gocritic // This is necessary to fetch the latest build!
+	build, err := a.Database.GetLatestWorkspaceBuildByWorkspaceID(dbauthz.AsSystemRestricted(ctx), workspace.ID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting latest workspace build: %w", err)
+	}
+	// nolint:gocritic // This is necessary to fetch the latest build!
+	job, err := a.Database.GetProvisionerJobByID(dbauthz.AsSystemRestricted(ctx), build.JobID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting provisioner job by id: %w", err)
+	}
+	motd := &agentproto.MOTDConfig{
+		Template: a.MOTDTemplate,
+	}
+	if !build.Deadline.IsZero() {
+		motd.Deadline = timestamppb.New(build.Deadline)
+	}
+	if job.JobStatus == database.ProvisionerJobStatusFailed {
+		motd.Warnings = append(motd.Warnings, "The last build of the workspace failed.")
+	}
+	if build.TemplateVersionID != template.ActiveVersionID {
+		motd.Warnings = append(motd.Warnings, "The workspace is outdated, update it to the active template version.")
+	}
+	return motd, nil
+}
+
 func vscodeProxyURI(app appurl.ApplicationURL, accessURL *url.URL, appHost string) string {
 	// Proxying by port only works for subdomains. If subdomain support is not
 	// available, return an empty string.
@@ -165,27 +319,39 @@ func dbAgentMetadatumToProtoDescription(metadatum database.WorkspaceAgentMetadat
 		Script:      metadatum.Script,
 		Interval:    durationpb.New(time.Duration(metadatum.Interval)),
 		Timeout:     durationpb.New(time.Duration(metadatum.Timeout)),
+		Collector:   metadatum.Collector,
 	}
 }
 
-func dbAgentScriptsToProto(scripts []database.WorkspaceAgentScript) []*agentproto.WorkspaceAgentScript {
+func dbAgentScriptsToProto(scripts []database.WorkspaceAgentScript, sources []database.WorkspaceAgentLogSource) []*agentproto.WorkspaceAgentScript {
+	displayNames := make(map[uuid.UUID]string, len(sources))
+	for _, source := range sources {
+		displayNames[source.ID] = source.DisplayName
+	}
 	ret := make([]*agentproto.WorkspaceAgentScript, len(scripts))
 	for i, script := range scripts {
-		ret[i] = dbAgentScriptToProto(script)
+		ret[i] = dbAgentScriptToProto(script, displayNames[script.LogSourceID])
 	}
 	return ret
 }
 
-func dbAgentScriptToProto(script database.WorkspaceAgentScript) *agentproto.WorkspaceAgentScript {
+func dbAgentScriptToProto(script database.WorkspaceAgentScript, displayName string) *agentproto.WorkspaceAgentScript {
 	return &agentproto.WorkspaceAgentScript{
-		LogSourceId:      script.LogSourceID[:],
-		LogPath:          script.LogPath,
-		Script:           script.Script,
-		Cron:             script.Cron,
-		RunOnStart:       script.RunOnStart,
-		RunOnStop:        script.RunOnStop,
-		StartBlocksLogin: script.StartBlocksLogin,
-		Timeout:          durationpb.New(time.Duration(script.TimeoutSeconds) * time.Second),
+		LogSourceId:           script.LogSourceID[:],
+		LogPath:               script.LogPath,
+		Script:                script.Script,
+		Cron:                  script.Cron,
+		RunOnStart:            script.RunOnStart,
+		RunOnStop:             script.RunOnStop,
+		StartBlocksLogin:      script.StartBlocksLogin,
+		Timeout:               durationpb.New(time.Duration(script.TimeoutSeconds) * time.Second),
+		RunOnBuildSuccess:     script.RunOnBuildSuccess,
+		RunOnBuildFailure:     script.RunOnBuildFailure,
+		RunOnPostStart:        script.RunOnPostStart,
+		Login:                 script.Login,
+		DiskPressurePath:      script.DiskPressurePath,
+		DiskPressureThreshold: script.DiskPressureThreshold,
+		DisplayName:           displayName,
 	}
 }
 
@@ -14,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"tailscale.com/tailcfg"
 
 	agentproto "github.com/coder/coder/v2/agent/proto"
@@ -23,6 +24,7 @@ import (
 	"github.com/coder/coder/v2/coderd/database/dbtime"
 	"github.com/coder/coder/v2/coderd/externalauth"
 	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
 	"github.com/coder/coder/v2/tailnet"
 )
 
@@ -50,15 +52,26 @@ func TestGetManifest(t *testing.T) {
 			OwnerID: owner.ID,
 			Name:    "cool-workspace",
 		}
+		job = database.ProvisionerJob{
+			ID:        uuid.New(),
+			JobStatus: database.ProvisionerJobStatusRunning,
+		}
+		resource = database.WorkspaceResource{
+			ID:    uuid.New(),
+			JobID: job.ID,
+		}
 		agent = database.WorkspaceAgent{
-			ID:   uuid.New(),
-			Name: "cool-agent",
+			ID:         uuid.New(),
+			ResourceID: resource.ID,
+			Name:       "cool-agent",
 			EnvironmentVariables: pqtype.NullRawMessage{
 				RawMessage: expectedEnvVarsJSON,
 				Valid:      true,
 			},
-			Directory: "/cool/dir",
-			MOTDFile:  "/cool/motd",
+			Directory:       "/cool/dir",
+			MOTDFile:        "/cool/motd",
+			OperatingSystem: "linux",
+			Architecture:    "amd64",
 		}
 		apps = []database.WorkspaceApp{
 			{
@@ -116,16 +129,24 @@ func TestGetManifest(t *testing.T) {
 				RunOnStop:        false,
 				TimeoutSeconds:   60,
 			},
+			{
+				WorkspaceAgentID:  agent.ID,
+				LogSourceID:       uuid.New(),
+				LogPath:           "/cool/log/path/2",
+				Script:            "cool script 2",
+				Cron:              "",
+				StartBlocksLogin:  false,
+				RunOnStart:        false,
+				RunOnStop:         true,
+				RunOnBuildSuccess: true,
+				TimeoutSeconds:    30,
+			},
+		}
+		logSources = []database.WorkspaceAgentLogSource{
 			{
 				WorkspaceAgentID: agent.ID,
-				LogSourceID:      uuid.New(),
-				LogPath:          "/cool/log/path/2",
-				Script:           "cool script 2",
-				Cron:             "",
-				StartBlocksLogin: false,
-				RunOnStart:       false,
-				RunOnStop:        true,
-				TimeoutSeconds:   30,
+				ID:               scripts[0].LogSourceID,
+				DisplayName:      "Cool Script",
 			},
 		}
 		metadata = []database.WorkspaceAgentMetadatum{
@@ -230,16 +251,18 @@ func TestGetManifest(t *testing.T) {
 				RunOnStop:        scripts[0].RunOnStop,
 				StartBlocksLogin: scripts[0].StartBlocksLogin,
 				Timeout:          durationpb.New(time.Duration(scripts[0].TimeoutSeconds) * time.Second),
+				DisplayName:      logSources[0].DisplayName,
 			},
 			{
-				LogSourceId:      scripts[1].LogSourceID[:],
-				LogPath:          scripts[1].LogPath,
-				Script:           scripts[1].Script,
-				Cron:             scripts[1].Cron,
-				RunOnStart:       scripts[1].RunOnStart,
-				RunOnStop:        scripts[1].RunOnStop,
-				StartBlocksLogin: scripts[1].StartBlocksLogin,
-				Timeout:          durationpb.New(time.Duration(scripts[1].TimeoutSeconds) * time.Second),
+				LogSourceId:       scripts[1].LogSourceID[:],
+				LogPath:           scripts[1].LogPath,
+				Script:            scripts[1].Script,
+				Cron:              scripts[1].Cron,
+				RunOnStart:        scripts[1].RunOnStart,
+				RunOnStop:         scripts[1].RunOnStop,
+				StartBlocksLogin:  scripts[1].StartBlocksLogin,
+				Timeout:           durationpb.New(time.Duration(scripts[1].TimeoutSeconds) * time.Second),
+				RunOnBuildSuccess: scripts[1].RunOnBuildSuccess,
 			},
 		}
 		protoMetadata = []*agentproto.WorkspaceAgentMetadata_Description{
@@ -265,6 +288,26 @@ func TestGetManifest(t *testing.T) {
 
 		mDB := dbmock.NewMockStore(gomock.NewController(t))
 
+		agent := agent
+		agent.DisplayApps = []database.DisplayApp{database.DisplayAppVscode, database.DisplayAppWebTerminal}
+		template := database.Template{
+			ID:                workspace.TemplateID,
+			ActiveVersionID:   uuid.New(),
+			CodeServerEnabled: true,
+		}
+		// The MOTD is of the latest build, e.g. a failed update, rather
+		// than the build that created the agent.
+		latestJob := database.ProvisionerJob{
+			ID:        uuid.New(),
+			JobStatus: database.ProvisionerJobStatusFailed,
+		}
+		latestBuild := database.WorkspaceBuild{
+			ID:                uuid.New(),
+			JobID:             latestJob.ID,
+			TemplateVersionID: uuid.New(),
+			Deadline:          someTime,
+		}
+
 		api := &agentapi.ManifestAPI{
 			AccessURL:   &url.URL{Scheme: "https", Host: "example.com"},
 			AppHostname: "*--apps.example.com",
@@ -275,6 +318,34 @@ func TestGetManifest(t *testing.T) {
 			},
 			DisableDirectConnections: true,
 			DerpForceWebSockets:      true,
+			ExecPolicy: []agentsdk.ExecPolicyRule{
+				{Action: agentsdk.ExecPolicyActionBlock, Prefix: "rm -rf /"},
+				{Action: agentsdk.ExecPolicyActionAudit, Regex: "^curl .*"},
+			},
+			ReconnectingPTYPersistence:     true,
+			ReconnectingPTYScrollbackLines: 5000,
+			Proxy: &agentsdk.ProxyConfig{
+				HTTPSProxy: "http://proxy.example.com:3128",
+				NoProxy:    "localhost",
+			},
+			MOTDTemplate: "Welcome to {{ .WorkspaceName }}!",
+			SSHKeepAlive: &agentsdk.SSHKeepAliveConfig{
+				IntervalSeconds: 30,
+				CountMax:        3,
+			},
+			UpdatePolicy: &agentsdk.AgentUpdatePolicy{
+				Channel:      agentsdk.AgentUpdateChannelDeployment,
+				VersionRange: ">= 2.6.0",
+			},
+			AgentBinarySHA256: func(goos, goarch string) (string, error) {
+				return "sha256-of-coder-" + goos + "-" + goarch, nil
+			},
+			CodeServer: &agentsdk.CodeServerConfig{
+				Version:    "4.20.0",
+				Port:       13337,
+				Extensions: []string{"golang.go"},
+				Checksums:  map[string]string{"linux-amd64": "abc123"},
+			},
 
 			AgentFn: func(ctx context.Context) (database.WorkspaceAgent, error) {
 				return agent, nil
@@ -288,12 +359,18 @@ func TestGetManifest(t *testing.T) {
 
 		mDB.EXPECT().GetWorkspaceAppsByAgentID(gomock.Any(), agent.ID).Return(apps, nil)
 		mDB.EXPECT().GetWorkspaceAgentScriptsByAgentIDs(gomock.Any(), []uuid.UUID{agent.ID}).Return(scripts, nil)
+		mDB.EXPECT().GetWorkspaceAgentLogSourcesByAgentIDs(gomock.Any(), []uuid.UUID{agent.ID}).Return(logSources, nil)
 		mDB.EXPECT().GetWorkspaceAgentMetadata(gomock.Any(), database.GetWorkspaceAgentMetadataParams{
 			WorkspaceAgentID: agent.ID,
 			Keys:             nil, // all
 		}).Return(metadata, nil)
 		mDB.EXPECT().GetWorkspaceByID(gomock.Any(), workspace.ID).Return(workspace, nil)
 		mDB.EXPECT().GetUserByID(gomock.Any(), workspace.OwnerID).Return(owner, nil)
+		mDB.EXPECT().GetWorkspaceResourceByID(gomock.Any(), resource.ID).Return(resource, nil)
+		mDB.EXPECT().GetProvisionerJobByID(gomock.Any(), job.ID).Return(job, nil)
+		mDB.EXPECT().GetLatestWorkspaceBuildByWorkspaceID(gomock.Any(), workspace.ID).Return(latestBuild, nil)
+		mDB.EXPECT().GetProvisionerJobByID(gomock.Any(), latestJob.ID).Return(latestJob, nil)
+		mDB.EXPECT().GetTemplateByID(gomock.Any(), workspace.TemplateID).Return(template, nil)
 
 		got, err := api.GetManifest(context.Background(), &agentproto.GetManifestRequest{})
 		require.NoError(t, err)
@@ -318,6 +395,46 @@ func TestGetManifest(t *testing.T) {
 			Scripts:  protoScripts,
 			Apps:     protoApps,
 			Metadata: protoMetadata,
+
+			BuildStatus: agentproto.Manifest_RUNNING,
+			DisplayApps: &agentproto.DisplayApps{
+				Vscode:      true,
+				WebTerminal: true,
+			},
+			ExecPolicy: []*agentproto.ExecPolicyRule{
+				{Action: agentproto.ExecPolicyRule_BLOCK, Prefix: "rm -rf /"},
+				{Action: agentproto.ExecPolicyRule_AUDIT, Regex: "^curl .*"},
+			},
+
+			ReconnectingPtyPersistence:     true,
+			ReconnectingPtyScrollbackLines: 5000,
+			Proxy: &agentproto.ProxyConfig{
+				HttpsProxy: "http://proxy.example.com:3128",
+				NoProxy:    "localhost",
+			},
+			Motd: &agentproto.MOTDConfig{
+				Template: "Welcome to {{ .WorkspaceName }}!",
+				Deadline: timestamppb.New(someTime),
+				Warnings: []string{
+					"The last build of the workspace failed.",
+					"The workspace is outdated, update it to the active template version.",
+				},
+			},
+			CodeServer: &agentproto.CodeServerConfig{
+				Version:    "4.20.0",
+				Port:       13337,
+				Extensions: []string{"golang.go"},
+				Checksums:  map[string]string{"linux-amd64": "abc123"},
+			},
+			SshKeepalive: &agentproto.SSHKeepAliveConfig{
+				IntervalSeconds: 30,
+				CountMax:        3,
+			},
+			UpdatePolicy: &agentproto.AgentUpdatePolicy{
+				Channel:      agentsdk.AgentUpdateChannelDeployment,
+				VersionRange: ">= 2.6.0",
+				Sha256:       "sha256-of-coder-linux-amd64",
+			},
 		}
 
 		// Log got and expected with spew.
@@ -342,6 +459,8 @@ func TestGetManifest(t *testing.T) {
 			},
 			DisableDirectConnections: true,
 			DerpForceWebSockets:      true,
+			// The template doesn't enable code-server.
+			CodeServer: &agentsdk.CodeServerConfig{Version: "4.20.0"},
 
 			AgentFn: func(ctx context.Context) (database.WorkspaceAgent, error) {
 				return agent, nil
@@ -355,12 +474,16 @@ func TestGetManifest(t *testing.T) {
 
 		mDB.EXPECT().GetWorkspaceAppsByAgentID(gomock.Any(), agent.ID).Return(apps, nil)
 		mDB.EXPECT().GetWorkspaceAgentScriptsByAgentIDs(gomock.Any(), []uuid.UUID{agent.ID}).Return(scripts, nil)
+		mDB.EXPECT().GetWorkspaceAgentLogSourcesByAgentIDs(gomock.Any(), []uuid.UUID{agent.ID}).Return(logSources, nil)
 		mDB.EXPECT().GetWorkspaceAgentMetadata(gomock.Any(), database.GetWorkspaceAgentMetadataParams{
 			WorkspaceAgentID: agent.ID,
 			Keys:             nil, // all
 		}).Return(metadata, nil)
 		mDB.EXPECT().GetWorkspaceByID(gomock.Any(), workspace.ID).Return(workspace, nil)
 		mDB.EXPECT().GetUserByID(gomock.Any(), workspace.OwnerID).Return(owner, nil)
+		mDB.EXPECT().GetWorkspaceResourceByID(gomock.Any(), resource.ID).Return(resource, nil)
+		mDB.EXPECT().GetProvisionerJobByID(gomock.Any(), job.ID).Return(job, nil)
+		mDB.EXPECT().GetTemplateByID(gomock.Any(), workspace.TemplateID).Return(database.Template{ID: workspace.TemplateID}, nil)
 
 		got, err := api.GetManifest(context.Background(), &agentproto.GetManifestRequest{})
 		require.NoError(t, err)
@@ -385,6 +508,11 @@ func TestGetManifest(t *testing.T) {
 			Scripts:  protoScripts,
 			Apps:     protoApps,
 			Metadata: protoMetadata,
+
+			BuildStatus: agentproto.Manifest_RUNNING,
+			// The template disabled every display app, which is sent as
+			// an empty set rather than omitted.
+			DisplayApps: &agentproto.DisplayApps{},
 		}
 
 		// Log got and expected with spew.
@@ -394,3 +522,58 @@ func TestGetManifest(t *testing.T) {
 		require.Equal(t, expected, got)
 	})
 }
+
+func TestGetMOTD(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		api := &agentapi.ManifestAPI{
+			Database: dbmock.NewMockStore(gomock.NewController(t)),
+		}
+		got, err := api.GetMOTD(context.Background(), &agentproto.GetMOTDRequest{})
+		require.NoError(t, err)
+		require.Equal(t, &agentproto.MOTDConfig{}, got)
+	})
+
+	t.Run("LatestBuild", func(t *testing.T) {
+		t.Parallel()
+
+		mDB := dbmock.NewMockStore(gomock.NewController(t))
+		agent := database.WorkspaceAgent{ID: uuid.New()}
+		workspace := database.Workspace{ID: uuid.New(), TemplateID: uuid.New()}
+		template := database.Template{ID: workspace.TemplateID, ActiveVersionID: uuid.New()}
+		job := database.ProvisionerJob{ID: uuid.New(), JobStatus: database.ProvisionerJobStatusSucceeded}
+		// The deadline was extended after the agent fetched its manifest.
+		deadline := dbtime.Now().Add(4 * time.Hour)
+		build := database.WorkspaceBuild{
+			ID:                uuid.New(),
+			JobID:             job.ID,
+			TemplateVersionID: template.ActiveVersionID,
+			Deadline:          deadline,
+		}
+		api := &agentapi.ManifestAPI{
+			MOTDTemplate: "Welcome!",
+			AgentFn: func(ctx context.Context) (database.WorkspaceAgent, error) {
+				return agent, nil
+			},
+			WorkspaceIDFn: func(ctx context.Context, _ *database.WorkspaceAgent) (uuid.UUID, error) {
+				return workspace.ID, nil
+			},
+			Database: mDB,
+		}
+
+		mDB.EXPECT().GetWorkspaceByID(gomock.Any(), workspace.ID).Return(workspace, nil)
+		mDB.EXPECT().GetTemplateByID(gomock.Any(), workspace.TemplateID).Return(template, nil)
+		mDB.EXPECT().GetLatestWorkspaceBuildByWorkspaceID(gomock.Any(), workspace.ID).Return(build, nil)
+		mDB.EXPECT().GetProvisionerJobByID(gomock.Any(), job.ID).Return(job, nil)
+
+		got, err := api.GetMOTD(context.Background(), &agentproto.GetMOTDRequest{})
+		require.NoError(t, err)
+		require.Equal(t, &agentproto.MOTDConfig{
+			Template: "Welcome!",
+			Deadline: timestamppb.New(deadline),
+		}, got)
+	})
+}
@@ -0,0 +1,94 @@
+package agentapi
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	agentproto "github.com/coder/coder/v2/agent/proto"
+	"github.com/coder/coder/v2/coderd/database"
+	"github.com/coder/coder/v2/coderd/database/dbtime"
+	"github.com/coder/coder/v2/coderd/database/pubsub"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+type NotificationsAPI struct {
+	AgentFn  func(context.Context) (database.WorkspaceAgent, error)
+	Database database.Store
+	Pubsub   pubsub.Pubsub
+	Log      slog.Logger
+
+	TimeNowFn func() time.Time // defaults to dbtime.Now()
+}
+
+func (a *NotificationsAPI) now() time.Time {
+	if a.TimeNowFn != nil {
+		return a.TimeNowFn()
+	}
+	return dbtime.Now()
+}
+
+// CreateNotification routes a notification raised by the agent to the
+// notification channels of the workspace owner, which subscribe to
+// WatchUserNotificationsChannel.
+func (a *NotificationsAPI) CreateNotification(ctx context.Context, req *agentproto.CreateNotificationRequest) (*agentproto.CreateNotificationResponse, error) {
+	workspaceAgent, err := a.AgentFn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	notification, err := agentsdk.NotificationFromProto(req.Notification)
+	if err != nil {
+		return nil, xerrors.Errorf("convert notification: %w", err)
+	}
+	err = notification.Validate()
+	if err != nil {
+		return nil, xerrors.Errorf("invalid notification: %w", err)
+	}
+	// We ignore the CreatedAt from the agent to avoid bugs caused by clock
+	// skew.
+	notification.CreatedAt = a.now()
+
+	workspace, err := a.Database.GetWorkspaceByAgentID(ctx, workspaceAgent.ID)
+	if err != nil {
+		return nil, xerrors.Errorf("get workspace by agent id %q: %w", workspaceAgent.ID, err)
+	}
+	payload, err := json.Marshal(UserNotificationChannelPayload{
+		WorkspaceID:   workspace.Workspace.ID,
+		WorkspaceName: workspace.Workspace.Name,
+		AgentID:       workspaceAgent.ID,
+		AgentName:     workspaceAgent.Name,
+		Notification:  notification,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("marshal notification channel payload: %w", err)
+	}
+	err = a.Pubsub.Publish(WatchUserNotificationsChannel(workspace.Workspace.OwnerID), payload)
+	if err != nil {
+		return nil, xerrors.Errorf("publish notification: %w", err)
+	}
+
+	a.Log.Debug(ctx, "accepted agent notification",
+		slog.F("kind", notification.Kind),
+		slog.F("severity", notification.Severity),
+		slog.F("title", ellipse(notification.Title, 32)),
+	)
+	return &agentproto.CreateNotificationResponse{}, nil
+}
+
+// UserNotificationChannelPayload is a notification raised by an agent of a
+// workspace of the user.
+type UserNotificationChannelPayload struct {
+	WorkspaceID   uuid.UUID             `json:"workspace_id"`
+	WorkspaceName string                `json:"workspace_name"`
+	AgentID       uuid.UUID             `json:"agent_id"`
+	AgentName     string                `json:"agent_name"`
+	Notification  agentsdk.Notification `json:"notification"`
+}
+
+func WatchUserNotificationsChannel(userID uuid.UUID) string {
+	return "user_notifications:" + userID.String()
+}
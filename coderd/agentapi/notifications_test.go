@@ -0,0 +1,104 @@
+package agentapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"cdr.dev/slog/sloggers/slogtest"
+
+	agentproto "github.com/coder/coder/v2/agent/proto"
+	"github.com/coder/coder/v2/coderd/agentapi"
+	"github.com/coder/coder/v2/coderd/database"
+	"github.com/coder/coder/v2/coderd/database/dbmock"
+	"github.com/coder/coder/v2/coderd/database/dbtime"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+func TestCreateNotification(t *testing.T) {
+	t.Parallel()
+
+	agent := database.WorkspaceAgent{
+		ID:   uuid.New(),
+		Name: "dev",
+	}
+	workspace := database.Workspace{
+		ID:      uuid.New(),
+		OwnerID: uuid.New(),
+		Name:    "workspace",
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		t.Parallel()
+
+		dbM := dbmock.NewMockStore(gomock.NewController(t))
+		pub := &fakePublisher{}
+		now := dbtime.Now()
+
+		dbM.EXPECT().GetWorkspaceByAgentID(gomock.Any(), agent.ID).Return(database.GetWorkspaceByAgentIDRow{
+			Workspace: workspace,
+		}, nil)
+
+		api := &agentapi.NotificationsAPI{
+			AgentFn: func(context.Context) (database.WorkspaceAgent, error) {
+				return agent, nil
+			},
+			Database: dbM,
+			Pubsub:   pub,
+			Log:      slogtest.Make(t, nil),
+			TimeNowFn: func() time.Time {
+				return now
+			},
+		}
+		resp, err := api.CreateNotification(context.Background(), &agentproto.CreateNotificationRequest{
+			Notification: &agentproto.Notification{
+				Severity: agentproto.Notification_WARNING,
+				Kind:     agentsdk.NotificationKindLowDisk,
+				Title:    "Disk almost full",
+				// The time of the agent is ignored.
+				CreatedAt: timestamppb.New(now.Add(-time.Hour)),
+				Labels:    map[string]string{"path": "/home/coder"},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, &agentproto.CreateNotificationResponse{}, resp)
+
+		require.Len(t, pub.publishes, 1)
+		var got agentapi.UserNotificationChannelPayload
+		require.NoError(t, json.Unmarshal(pub.publishes[0], &got))
+		require.Equal(t, workspace.ID, got.WorkspaceID)
+		require.Equal(t, agent.ID, got.AgentID)
+		require.Equal(t, agentsdk.NotificationSeverityWarning, got.Notification.Severity)
+		require.True(t, now.Equal(got.Notification.CreatedAt))
+		require.Equal(t, map[string]string{"path": "/home/coder"}, got.Notification.Labels)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+
+		dbM := dbmock.NewMockStore(gomock.NewController(t))
+		pub := &fakePublisher{}
+		api := &agentapi.NotificationsAPI{
+			AgentFn: func(context.Context) (database.WorkspaceAgent, error) {
+				return agent, nil
+			},
+			Database: dbM,
+			Pubsub:   pub,
+			Log:      slogtest.Make(t, nil),
+		}
+		_, err := api.CreateNotification(context.Background(), &agentproto.CreateNotificationRequest{
+			Notification: &agentproto.Notification{
+				Severity: agentproto.Notification_INFO,
+				Kind:     agentsdk.NotificationKindOOM,
+			},
+		})
+		require.ErrorContains(t, err, "title is required")
+		require.Empty(t, pub.publishes)
+	})
+}
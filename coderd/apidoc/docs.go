@@ -4191,6 +4191,84 @@ const docTemplate = `{
                 }
             }
         },
+        "/users/{user}/authorized-keys": {
+            "get": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get user authorized SSH keys",
+                "operationId": "get-user-authorized-ssh-keys",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID, name, or me",
+                        "name": "user",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/codersdk.UserAuthorizedKeys"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Update user authorized SSH keys",
+                "operationId": "update-user-authorized-ssh-keys",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID, name, or me",
+                        "name": "user",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Authorized keys",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/codersdk.UpdateUserAuthorizedKeysRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/codersdk.UserAuthorizedKeys"
+                        }
+                    }
+                }
+            }
+        },
         "/users/{user}/autofill-parameters": {
             "get": {
                 "security": [
@@ -4648,6 +4726,40 @@ const docTemplate = `{
                 }
             }
         },
+        "/users/{user}/notifications/watch": {
+            "get": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Watch notifications of user",
+                "operationId": "watch-notifications-of-user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID, name, or me",
+                        "name": "user",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/codersdk.UserNotification"
+                        }
+                    }
+                }
+            }
+        },
         "/users/{user}/organizations": {
             "get": {
                 "security": [
@@ -5355,6 +5467,70 @@ const docTemplate = `{
                 }
             }
         },
+        "/workspaceagents/me/authorized-keys": {
+            "get": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Agents"
+                ],
+                "summary": "Get workspace agent authorized SSH keys",
+                "operationId": "get-workspace-agent-authorized-ssh-keys",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/agentsdk.AuthorizedKeysResponse"
+                        }
+                    }
+                },
+                "x-apidocgen": {
+                    "skip": true
+                }
+            }
+        },
+        "/workspaceagents/me/connection-failures": {
+            "post": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Agents"
+                ],
+                "summary": "Submit workspace agent connection failures",
+                "operationId": "submit-workspace-agent-connection-failures",
+                "parameters": [
+                    {
+                        "description": "Connection failures",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/agentsdk.PostConnectionFailuresRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    }
+                },
+                "x-apidocgen": {
+                    "skip": true
+                }
+            }
+        },
         "/workspaceagents/me/coordinate": {
             "get": {
                 "security": [
@@ -5494,6 +5670,45 @@ const docTemplate = `{
                 }
             }
         },
+        "/workspaceagents/me/log-source": {
+            "post": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Agents"
+                ],
+                "summary": "Post workspace agent log source",
+                "operationId": "post-workspace-agent-log-source",
+                "parameters": [
+                    {
+                        "description": "Log source request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/agentsdk.PostLogSource"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/codersdk.WorkspaceAgentLogSource"
+                        }
+                    }
+                }
+            }
+        },
         "/workspaceagents/me/logs": {
             "patch": {
                 "security": [
@@ -5738,111 +5953,203 @@ const docTemplate = `{
                 }
             }
         },
-        "/workspaceagents/me/startup": {
+        "/workspaceagents/me/script-artifacts/{logsource}": {
             "post": {
                 "security": [
                     {
                         "CoderSessionToken": []
                     }
                 ],
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
                 "tags": [
                     "Agents"
                 ],
-                "summary": "Submit workspace agent startup",
-                "operationId": "submit-workspace-agent-startup",
+                "summary": "Upload workspace agent script artifacts",
+                "operationId": "upload-workspace-agent-script-artifacts",
                 "parameters": [
                     {
-                        "description": "Startup request",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/agentsdk.PostStartupRequest"
-                        }
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Log source ID",
+                        "name": "logsource",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK"
+                    "201": {
+                        "description": "Created"
                     }
                 },
                 "x-apidocgen": {
                     "skip": true
                 }
-            }
-        },
-        "/workspaceagents/me/startup-logs": {
-            "patch": {
+            },
+            "head": {
                 "security": [
                     {
                         "CoderSessionToken": []
                     }
                 ],
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
                 "tags": [
                     "Agents"
                 ],
-                "summary": "Removed: Patch workspace agent logs",
-                "operationId": "removed-patch-workspace-agent-logs",
+                "summary": "Get workspace agent script artifacts upload offset",
+                "operationId": "get-workspace-agent-script-artifacts-upload-offset",
                 "parameters": [
                     {
-                        "description": "logs",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/agentsdk.PatchLogs"
-                        }
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Log source ID",
+                        "name": "logsource",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/codersdk.Response"
-                        }
+                        "description": "OK"
                     }
+                },
+                "x-apidocgen": {
+                    "skip": true
                 }
-            }
-        },
-        "/workspaceagents/{workspaceagent}": {
-            "get": {
+            },
+            "patch": {
                 "security": [
                     {
                         "CoderSessionToken": []
                     }
                 ],
-                "produces": [
-                    "application/json"
-                ],
                 "tags": [
                     "Agents"
                 ],
-                "summary": "Get workspace agent by ID",
-                "operationId": "get-workspace-agent-by-id",
+                "summary": "Upload workspace agent script artifacts chunk",
+                "operationId": "upload-workspace-agent-script-artifacts-chunk",
                 "parameters": [
                     {
                         "type": "string",
                         "format": "uuid",
-                        "description": "Workspace agent ID",
-                        "name": "workspaceagent",
+                        "description": "Log source ID",
+                        "name": "logsource",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
+                    "201": {
+                        "description": "Created"
+                    }
+                },
+                "x-apidocgen": {
+                    "skip": true
+                }
+            }
+        },
+        "/workspaceagents/me/startup": {
+            "post": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Agents"
+                ],
+                "summary": "Submit workspace agent startup",
+                "operationId": "submit-workspace-agent-startup",
+                "parameters": [
+                    {
+                        "description": "Startup request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/agentsdk.PostStartupRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                },
+                "x-apidocgen": {
+                    "skip": true
+                }
+            }
+        },
+        "/workspaceagents/me/startup-logs": {
+            "patch": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Agents"
+                ],
+                "summary": "Removed: Patch workspace agent logs",
+                "operationId": "removed-patch-workspace-agent-logs",
+                "parameters": [
+                    {
+                        "description": "logs",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/agentsdk.PatchLogs"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/codersdk.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/workspaceagents/{workspaceagent}": {
+            "get": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Agents"
+                ],
+                "summary": "Get workspace agent by ID",
+                "operationId": "get-workspace-agent-by-id",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Workspace agent ID",
+                        "name": "workspaceagent",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/codersdk.WorkspaceAgent"
@@ -5997,6 +6304,24 @@ const docTemplate = `{
                         "description": "Disable compression for WebSocket connection",
                         "name": "no_compression",
                         "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of logs, all if 0",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated log levels to filter by",
+                        "name": "level",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated log source IDs to filter by",
+                        "name": "log_source_ids",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -6041,6 +6366,81 @@ const docTemplate = `{
                 }
             }
         },
+        "/workspaceagents/{workspaceagent}/script-artifacts": {
+            "get": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Agents"
+                ],
+                "summary": "Get script artifacts by workspace agent",
+                "operationId": "get-script-artifacts-by-workspace-agent",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Workspace agent ID",
+                        "name": "workspaceagent",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/codersdk.WorkspaceAgentScriptArtifact"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/workspaceagents/{workspaceagent}/script-artifacts/{artifact}": {
+            "get": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "tags": [
+                    "Agents"
+                ],
+                "summary": "Download script artifact by workspace agent",
+                "operationId": "download-script-artifact-by-workspace-agent",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Workspace agent ID",
+                        "name": "workspaceagent",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Artifact ID",
+                        "name": "artifact",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                }
+            }
+        },
         "/workspaceagents/{workspaceagent}/startup-logs": {
             "get": {
                 "security": [
@@ -6203,6 +6603,74 @@ const docTemplate = `{
                 }
             }
         },
+        "/workspacebuilds/{workspacebuild}/capacity-fallback": {
+            "get": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Builds"
+                ],
+                "summary": "Get capacity fallback of workspace build",
+                "operationId": "get-capacity-fallback-of-workspace-build",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Workspace build ID",
+                        "name": "workspacebuild",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/codersdk.WorkspaceBuildCapacityFallback"
+                        }
+                    }
+                }
+            }
+        },
+        "/workspacebuilds/{workspacebuild}/diagnostic-bundle": {
+            "get": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Builds"
+                ],
+                "summary": "Get diagnostic bundle of failed workspace build",
+                "operationId": "get-diagnostic-bundle-of-failed-workspace-build",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Workspace build ID",
+                        "name": "workspacebuild",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/codersdk.WorkspaceBuildDiagnosticBundle"
+                        }
+                    }
+                }
+            }
+        },
         "/workspacebuilds/{workspacebuild}/logs": {
             "get": {
                 "security": [
@@ -6251,7 +6719,44 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/codersdk.ProvisionerJobLog"
+                                "$ref": "#/definitions/codersdk.ProvisionerJobLog"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/workspacebuilds/{workspacebuild}/metadata": {
+            "get": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Builds"
+                ],
+                "summary": "Get template outputs for workspace build",
+                "operationId": "get-template-outputs-for-workspace-build",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Workspace build ID",
+                        "name": "workspacebuild",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/codersdk.WorkspaceResourceMetadata"
                             }
                         }
                     }
@@ -6366,6 +6871,40 @@ const docTemplate = `{
                 }
             }
         },
+        "/workspacebuilds/{workspacebuild}/work-directory": {
+            "get": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Builds"
+                ],
+                "summary": "Get work directory listing of failed workspace build",
+                "operationId": "get-work-directory-listing-of-failed-workspace-build",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Workspace build ID",
+                        "name": "workspacebuild",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/codersdk.WorkspaceBuildWorkDirectory"
+                        }
+                    }
+                }
+            }
+        },
         "/workspaceproxies": {
             "get": {
                 "security": [
@@ -7188,6 +7727,42 @@ const docTemplate = `{
                 }
             }
         },
+        "/workspaces/{workspace}/refresh": {
+            "post": {
+                "security": [
+                    {
+                        "CoderSessionToken": []
+                    }
+                ],
+                "description": "Refreshes the resources of the latest build without changing them, and updates their metadata.\nIf a refresh of the latest build is already queued or running, it's returned instead.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Workspaces"
+                ],
+                "summary": "Refresh workspace resources",
+                "operationId": "refresh-workspace-resources",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Workspace ID",
+                        "name": "workspace",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/codersdk.ProvisionerJob"
+                        }
+                    }
+                }
+            }
+        },
         "/workspaces/{workspace}/resolve-autostart": {
             "get": {
                 "security": [
@@ -7375,6 +7950,72 @@ const docTemplate = `{
                 "AgentMetricTypeGauge"
             ]
         },
+        "agentsdk.AppHealthReport": {
+            "type": "object",
+            "properties": {
+                "checked_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error is why the latest healthcheck failed, so it's known why an app\nis unhealthy.",
+                    "type": "string"
+                },
+                "health": {
+                    "$ref": "#/definitions/codersdk.WorkspaceAppHealth"
+                },
+                "latency_ms": {
+                    "description": "LatencyMilliseconds is how long the latest healthcheck took.",
+                    "type": "number"
+                }
+            }
+        },
+        "agentsdk.AppUsage": {
+            "type": "object",
+            "required": [
+                "slug"
+            ],
+            "properties": {
+                "connection_type": {
+                    "enum": [
+                        "path",
+                        "subdomain",
+                        "port_forward",
+                        "ssh"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/agentsdk.AppUsageConnectionType"
+                        }
+                    ]
+                },
+                "duration": {
+                    "description": "Duration is how long the app was in use during the interval.",
+                    "type": "integer"
+                },
+                "session_count": {
+                    "description": "SessionCount is the number of sessions of the app during the\ninterval.",
+                    "type": "integer"
+                },
+                "slug": {
+                    "type": "string"
+                }
+            }
+        },
+        "agentsdk.AppUsageConnectionType": {
+            "type": "string",
+            "enum": [
+                "path",
+                "subdomain",
+                "port_forward",
+                "ssh"
+            ],
+            "x-enum-varnames": [
+                "AppUsageConnectionTypePath",
+                "AppUsageConnectionTypeSubdomain",
+                "AppUsageConnectionTypePortForward",
+                "AppUsageConnectionTypeSSH"
+            ]
+        },
         "agentsdk.AuthenticateResponse": {
             "type": "object",
             "properties": {
@@ -7383,6 +8024,37 @@ const docTemplate = `{
                 }
             }
         },
+        "agentsdk.AuthorizedKey": {
+            "type": "object",
+            "properties": {
+                "principals": {
+                    "description": "Principals limit the usernames the key may log in as. Any username is\naccepted if empty.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "public_key": {
+                    "description": "PublicKey is in the authorized_keys format.",
+                    "type": "string"
+                }
+            }
+        },
+        "agentsdk.AuthorizedKeysResponse": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/agentsdk.AuthorizedKey"
+                    }
+                },
+                "required": {
+                    "description": "Required makes connections authenticate with one of the keys in\naddition to coderd, e.g. to require a hardware-backed key. Reconnecting\nPTYs and port forwarding can't present a key, so they're refused.",
+                    "type": "boolean"
+                }
+            }
+        },
         "agentsdk.AzureInstanceIdentityToken": {
             "type": "object",
             "required": [
@@ -7398,6 +8070,78 @@ const docTemplate = `{
                 }
             }
         },
+        "agentsdk.ConnectionFailure": {
+            "type": "object",
+            "properties": {
+                "captive_portal": {
+                    "description": "CaptivePortal is true if a plain HTTP request to the host was answered\nby something other than the host, e.g. a captive portal or an\nintercepting proxy.",
+                    "type": "boolean"
+                },
+                "count": {
+                    "description": "Count is the number of consecutive failures with the same error.",
+                    "type": "integer"
+                },
+                "dns": {
+                    "$ref": "#/definitions/agentsdk.ConnectionFailureDNS"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "first_seen_at": {
+                    "type": "string"
+                },
+                "last_seen_at": {
+                    "type": "string"
+                },
+                "proxy_env": {
+                    "description": "ProxyEnv contains the proxy environment variables of the agent with\ncredentials redacted.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "stage": {
+                    "$ref": "#/definitions/agentsdk.ConnectionFailureStage"
+                },
+                "tls_error": {
+                    "type": "string"
+                },
+                "tls_error_class": {
+                    "$ref": "#/definitions/agentsdk.TLSErrorClass"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "agentsdk.ConnectionFailureDNS": {
+            "type": "object",
+            "properties": {
+                "addresses": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "error": {
+                    "type": "string"
+                },
+                "host": {
+                    "type": "string"
+                }
+            }
+        },
+        "agentsdk.ConnectionFailureStage": {
+            "type": "string",
+            "enum": [
+                "coderd",
+                "derp"
+            ],
+            "x-enum-varnames": [
+                "ConnectionFailureStageCoderd",
+                "ConnectionFailureStageDERP"
+            ]
+        },
         "agentsdk.ExternalAuthResponse": {
             "type": "object",
             "properties": {
@@ -7451,11 +8195,30 @@ const docTemplate = `{
                 "created_at": {
                     "type": "string"
                 },
+                "fields": {
+                    "description": "Fields are structured key/value fields of the log, e.g. parsed from\nthe line by a LogsWriterParser. They're stored alongside the output so\nlogs can be filtered by field.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "level": {
                     "$ref": "#/definitions/codersdk.LogLevel"
                 },
                 "output": {
                     "type": "string"
+                },
+                "stream": {
+                    "description": "Stream is the output stream of the process the log was written to,\nif it's known. It allows separating errors from regular output\nregardless of the log level.",
+                    "enum": [
+                        "stdout",
+                        "stderr"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/codersdk.LogStream"
+                        }
+                    ]
                 }
             }
         },
@@ -7571,6 +8334,24 @@ const docTemplate = `{
                     "additionalProperties": {
                         "$ref": "#/definitions/codersdk.WorkspaceAppHealth"
                     }
+                },
+                "reports": {
+                    "description": "Reports are the results of the latest healthchecks of all apps with\nhealthchecks, keyed like Healths.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/agentsdk.AppHealthReport"
+                    }
+                }
+            }
+        },
+        "agentsdk.PostConnectionFailuresRequest": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/agentsdk.ConnectionFailure"
+                    }
                 }
             }
         },
@@ -7585,6 +8366,22 @@ const docTemplate = `{
                 }
             }
         },
+        "agentsdk.PostLogSource": {
+            "type": "object",
+            "properties": {
+                "display_name": {
+                    "type": "string"
+                },
+                "icon": {
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID is a unique identifier for the log source.\nIt is scoped to a workspace agent, and can be statically\ndefined inside code to prevent duplicate sources from being\ncreated for the same agent.",
+                    "type": "string",
+                    "format": "uuid"
+                }
+            }
+        },
         "agentsdk.PostMetadataRequest": {
             "type": "object",
             "properties": {
@@ -7635,6 +8432,13 @@ const docTemplate = `{
         "agentsdk.Stats": {
             "type": "object",
             "properties": {
+                "app_usage": {
+                    "description": "AppUsage is the usage of apps during the interval, e.g. to find apps\nnobody uses in a template.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/agentsdk.AppUsage"
+                    }
+                },
                 "connection_count": {
                     "description": "ConnectionCount is the number of connections received by an agent.",
                     "type": "integer"
@@ -7700,6 +8504,27 @@ const docTemplate = `{
                 }
             }
         },
+        "agentsdk.TLSErrorClass": {
+            "type": "string",
+            "enum": [
+                "",
+                "unknown_authority",
+                "hostname_mismatch",
+                "expired",
+                "invalid_certificate",
+                "not_tls",
+                "handshake"
+            ],
+            "x-enum-varnames": [
+                "TLSErrorClassNone",
+                "TLSErrorClassUnknownAuthority",
+                "TLSErrorClassHostnameMismatch",
+                "TLSErrorClassExpired",
+                "TLSErrorClassInvalidCertificate",
+                "TLSErrorClassNotTLS",
+                "TLSErrorClassHandshake"
+            ]
+        },
         "clibase.Annotations": {
             "type": "object",
             "additionalProperties": {
@@ -7804,6 +8629,17 @@ const docTemplate = `{
         "clibase.Regexp": {
             "type": "object"
         },
+        "clibase.Struct-array_codersdk_AgentExecPolicyRule": {
+            "type": "object",
+            "properties": {
+                "value": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/codersdk.AgentExecPolicyRule"
+                    }
+                }
+            }
+        },
         "clibase.Struct-array_codersdk_ExternalAuthConfig": {
             "type": "object",
             "properties": {
@@ -7821,7 +8657,18 @@ const docTemplate = `{
                 "value": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/codersdk.LinkConfig"
+                        "$ref": "#/definitions/codersdk.LinkConfig"
+                    }
+                }
+            }
+        },
+        "clibase.Struct-array_codersdk_ProviderCredentialsConfig": {
+            "type": "object",
+            "properties": {
+                "value": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/codersdk.ProviderCredentialsConfig"
                     }
                 }
             }
@@ -8077,6 +8924,25 @@ const docTemplate = `{
                 }
             }
         },
+        "codersdk.AgentExecPolicyRule": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "enum": [
+                        "allow",
+                        "block",
+                        "audit"
+                    ]
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "regex": {
+                    "type": "string"
+                }
+            }
+        },
         "codersdk.AgentSubsystem": {
             "type": "string",
             "enum": [
@@ -8962,6 +9828,12 @@ const docTemplate = `{
                 "block_direct": {
                     "type": "boolean"
                 },
+                "fallback_paths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "force_websockets": {
                     "type": "boolean"
                 },
@@ -9078,12 +9950,66 @@ const docTemplate = `{
                         }
                     ]
                 },
+                "agent_code_server_checksums": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "agent_code_server_extensions": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "agent_code_server_port": {
+                    "type": "integer"
+                },
+                "agent_code_server_version": {
+                    "type": "string"
+                },
+                "agent_exec_policy": {
+                    "$ref": "#/definitions/clibase.Struct-array_codersdk_AgentExecPolicyRule"
+                },
                 "agent_fallback_troubleshooting_url": {
                     "$ref": "#/definitions/clibase.URL"
                 },
+                "agent_http_proxy": {
+                    "type": "string"
+                },
+                "agent_https_proxy": {
+                    "type": "string"
+                },
+                "agent_motd_template": {
+                    "type": "string"
+                },
+                "agent_no_proxy": {
+                    "type": "string"
+                },
+                "agent_reconnecting_pty_persistence": {
+                    "type": "boolean"
+                },
+                "agent_reconnecting_pty_scrollback_lines": {
+                    "type": "integer"
+                },
+                "agent_ssh_keepalive_count_max": {
+                    "type": "integer"
+                },
+                "agent_ssh_keepalive_interval": {
+                    "type": "integer"
+                },
                 "agent_stat_refresh_interval": {
                     "type": "integer"
                 },
+                "agent_update_binary_url": {
+                    "type": "string"
+                },
+                "agent_update_channel": {
+                    "type": "string"
+                },
+                "agent_update_version_range": {
+                    "type": "string"
+                },
                 "allow_workspace_renames": {
                     "type": "boolean"
                 },
@@ -9749,10 +10675,12 @@ const docTemplate = `{
         "codersdk.JobErrorCode": {
             "type": "string",
             "enum": [
-                "REQUIRED_TEMPLATE_VARIABLES"
+                "REQUIRED_TEMPLATE_VARIABLES",
+                "GUARDRAIL_EXCEEDED"
             ],
             "x-enum-varnames": [
-                "RequiredTemplateVariables"
+                "RequiredTemplateVariables",
+                "GuardrailExceeded"
             ]
         },
         "codersdk.License": {
@@ -9823,6 +10751,17 @@ const docTemplate = `{
                 "LogSourceProvisioner"
             ]
         },
+        "codersdk.LogStream": {
+            "type": "string",
+            "enum": [
+                "stdout",
+                "stderr"
+            ],
+            "x-enum-varnames": [
+                "LogStreamStdout",
+                "LogStreamStderr"
+            ]
+        },
         "codersdk.LoggingConfig": {
             "type": "object",
             "properties": {
@@ -10306,6 +11245,45 @@ const docTemplate = `{
                 }
             }
         },
+        "codersdk.ProviderCredentialsConfig": {
+            "type": "object",
+            "properties": {
+                "audience": {
+                    "description": "Audience is the audience of the Google workload identity pool\nprovider.",
+                    "type": "string"
+                },
+                "client_id": {
+                    "description": "ClientID and TenantID identify the Azure application the token is\nfederated with.",
+                    "type": "string"
+                },
+                "external_auth_id": {
+                    "description": "ExternalAuthID is the ID of the external auth provider whose access\ntoken is exchanged. The OIDC access token of the owner is used if\nempty.",
+                    "type": "string"
+                },
+                "role_arn": {
+                    "description": "RoleARN is the AWS role assumed with the token.",
+                    "type": "string"
+                },
+                "service_account": {
+                    "description": "ServiceAccount is the email of the Google service account to\nimpersonate, if any.",
+                    "type": "string"
+                },
+                "tenant_id": {
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type is the Terraform provider the credentials are for.",
+                    "type": "string",
+                    "enum": [
+                        "github",
+                        "gitlab",
+                        "aws",
+                        "google",
+                        "azurerm"
+                    ]
+                }
+            }
+        },
         "codersdk.ProvisionerConfig": {
             "type": "object",
             "properties": {
@@ -10324,8 +11302,80 @@ const docTemplate = `{
                 "daemons_echo": {
                     "type": "boolean"
                 },
+                "data_source_timeout": {
+                    "type": "integer"
+                },
+                "filesystem_mirrors": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "force_cancel_interval": {
                     "type": "integer"
+                },
+                "hang_timeout": {
+                    "type": "integer"
+                },
+                "max_apply_retries": {
+                    "type": "integer"
+                },
+                "max_destroys": {
+                    "type": "integer"
+                },
+                "max_resources": {
+                    "type": "integer"
+                },
+                "network_mirrors": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "prewarm_max_size_mb": {
+                    "type": "integer"
+                },
+                "prewarm_templates": {
+                    "type": "integer"
+                },
+                "provider_credentials": {
+                    "$ref": "#/definitions/clibase.Struct-array_codersdk_ProviderCredentialsConfig"
+                },
+                "sandbox": {
+                    "type": "string"
+                },
+                "sandbox_egress_allowlist": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "sandbox_seccomp_profile": {
+                    "type": "string"
+                },
+                "secrets_resolvers": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "trusted_provider_hashes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "verify_providers": {
+                    "type": "boolean"
+                },
+                "work_directory_keep_on_failure": {
+                    "type": "boolean"
+                },
+                "work_directory_max_disk": {
+                    "type": "integer"
+                },
+                "work_directory_ttl": {
+                    "type": "integer"
                 }
             }
         },
@@ -10387,7 +11437,8 @@ const docTemplate = `{
                 },
                 "error_code": {
                     "enum": [
-                        "REQUIRED_TEMPLATE_VARIABLES"
+                        "REQUIRED_TEMPLATE_VARIABLES",
+                        "GUARDRAIL_EXCEEDED"
                     ],
                     "allOf": [
                         {
@@ -10978,6 +12029,10 @@ const docTemplate = `{
                 "build_time_stats": {
                     "$ref": "#/definitions/codersdk.TemplateBuildTimeStats"
                 },
+                "code_server_enabled": {
+                    "description": "CodeServerEnabled makes the agents of workspaces built from the\ntemplate install and supervise the code-server release configured by\nthe deployment, exposed with a \"code-server\" app.",
+                    "type": "boolean"
+                },
                 "created_at": {
                     "type": "string",
                     "format": "date-time"
@@ -11004,6 +12059,10 @@ const docTemplate = `{
                 "display_name": {
                     "type": "string"
                 },
+                "docs_url": {
+                    "description": "DocsURL links to the documentation of the template, as described by\nthe coder_template local of the active version.",
+                    "type": "string"
+                },
                 "failure_ttl_ms": {
                     "description": "FailureTTLMillis, TimeTilDormantMillis, and TimeTilDormantAutoDeleteMillis are enterprise-only. Their\nvalues are used if your license is entitled to use the advanced\ntemplate scheduling feature.",
                     "type": "integer"
@@ -11015,6 +12074,19 @@ const docTemplate = `{
                     "type": "string",
                     "format": "uuid"
                 },
+                "max_app_sharing_level": {
+                    "description": "MaxAppSharingLevel is the widest sharing level the apps of workspaces\nbuilt from the template may use.",
+                    "enum": [
+                        "owner",
+                        "authenticated",
+                        "public"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/codersdk.WorkspaceAppSharingLevel"
+                        }
+                    ]
+                },
                 "max_ttl_ms": {
                     "description": "TODO(@dean): remove max_ttl once autostop_requirement is matured",
                     "type": "integer"
@@ -11032,6 +12104,10 @@ const docTemplate = `{
                         "terraform"
                     ]
                 },
+                "replace_on_failure": {
+                    "description": "ReplaceOnFailure makes builds replace the resources that failed to\nupdate in the previous build, or whose agents failed to connect or\nstart in it.",
+                    "type": "boolean"
+                },
                 "require_active_version": {
                     "description": "RequireActiveVersion mandates that workspaces are built with the active\ntemplate version.",
                     "type": "boolean"
@@ -11743,6 +12819,20 @@ const docTemplate = `{
                 }
             }
         },
+        "codersdk.UpdateUserAuthorizedKeysRequest": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/codersdk.UserAuthorizedKey"
+                    }
+                },
+                "required": {
+                    "type": "boolean"
+                }
+            }
+        },
         "codersdk.UpdateUserPasswordRequest": {
             "type": "object",
             "required": [
@@ -11960,6 +13050,41 @@ const docTemplate = `{
                 }
             }
         },
+        "codersdk.UserAuthorizedKey": {
+            "type": "object",
+            "properties": {
+                "principals": {
+                    "description": "Principals limit the usernames the key may log in as. Any username is\naccepted if empty.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "public_key": {
+                    "description": "PublicKey is in the authorized_keys format.",
+                    "type": "string"
+                }
+            }
+        },
+        "codersdk.UserAuthorizedKeys": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/codersdk.UserAuthorizedKey"
+                    }
+                },
+                "required": {
+                    "description": "Required makes connections to workspaces authenticate with one of the\nkeys in addition to coderd.",
+                    "type": "boolean"
+                },
+                "updated_at": {
+                    "type": "string",
+                    "format": "date-time"
+                }
+            }
+        },
         "codersdk.UserLatency": {
             "type": "object",
             "properties": {
@@ -11993,40 +13118,95 @@ const docTemplate = `{
                     "type": "string",
                     "format": "date-time"
                 },
-                "start_time": {
+                "start_time": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "template_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string",
+                        "format": "uuid"
+                    }
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/codersdk.UserLatency"
+                    }
+                }
+            }
+        },
+        "codersdk.UserLatencyInsightsResponse": {
+            "type": "object",
+            "properties": {
+                "report": {
+                    "$ref": "#/definitions/codersdk.UserLatencyInsightsReport"
+                }
+            }
+        },
+        "codersdk.UserLoginType": {
+            "type": "object",
+            "properties": {
+                "login_type": {
+                    "$ref": "#/definitions/codersdk.LoginType"
+                }
+            }
+        },
+        "codersdk.UserNotification": {
+            "type": "object",
+            "properties": {
+                "agent_id": {
+                    "type": "string",
+                    "format": "uuid"
+                },
+                "agent_name": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "kind": {
+                    "description": "Kind groups notifications with the same cause, e.g. \"low_disk\".",
+                    "type": "string"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                },
+                "severity": {
+                    "$ref": "#/definitions/codersdk.UserNotificationSeverity"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "workspace_id": {
                     "type": "string",
-                    "format": "date-time"
-                },
-                "template_ids": {
-                    "type": "array",
-                    "items": {
-                        "type": "string",
-                        "format": "uuid"
-                    }
+                    "format": "uuid"
                 },
-                "users": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/codersdk.UserLatency"
-                    }
-                }
-            }
-        },
-        "codersdk.UserLatencyInsightsResponse": {
-            "type": "object",
-            "properties": {
-                "report": {
-                    "$ref": "#/definitions/codersdk.UserLatencyInsightsReport"
+                "workspace_name": {
+                    "type": "string"
                 }
             }
         },
-        "codersdk.UserLoginType": {
-            "type": "object",
-            "properties": {
-                "login_type": {
-                    "$ref": "#/definitions/codersdk.LoginType"
-                }
-            }
+        "codersdk.UserNotificationSeverity": {
+            "type": "string",
+            "enum": [
+                "info",
+                "warning",
+                "error"
+            ],
+            "x-enum-varnames": [
+                "UserNotificationSeverityInfo",
+                "UserNotificationSeverityWarning",
+                "UserNotificationSeverityError"
+            ]
         },
         "codersdk.UserParameter": {
             "type": "object",
@@ -12370,6 +13550,14 @@ const docTemplate = `{
                 "troubleshooting_url": {
                     "type": "string"
                 },
+                "troubleshooting_urls": {
+                    "description": "TroubleshootingURLs are the troubleshooting URLs by class of failure,\nthey default to TroubleshootingURL.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/codersdk.WorkspaceAgentTroubleshootingURLs"
+                        }
+                    ]
+                },
                 "updated_at": {
                     "type": "string",
                     "format": "date-time"
@@ -12468,6 +13656,13 @@ const docTemplate = `{
                     "type": "string",
                     "format": "date-time"
                 },
+                "fields": {
+                    "description": "Fields are structured key/value fields of the log.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "id": {
                     "type": "integer"
                 },
@@ -12480,6 +13675,18 @@ const docTemplate = `{
                 "source_id": {
                     "type": "string",
                     "format": "uuid"
+                },
+                "stream": {
+                    "description": "Stream is the output stream the log was written to, if it's known.",
+                    "enum": [
+                        "stdout",
+                        "stderr"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/codersdk.LogStream"
+                        }
+                    ]
                 }
             }
         },
@@ -12506,9 +13713,30 @@ const docTemplate = `{
                 }
             }
         },
+        "codersdk.WorkspaceAgentMetadataCollector": {
+            "type": "string",
+            "enum": [
+                "cpu",
+                "memory",
+                "disk"
+            ],
+            "x-enum-varnames": [
+                "WorkspaceAgentMetadataCollectorCPU",
+                "WorkspaceAgentMetadataCollectorMemory",
+                "WorkspaceAgentMetadataCollectorDisk"
+            ]
+        },
         "codersdk.WorkspaceAgentMetadataDescription": {
             "type": "object",
             "properties": {
+                "collector": {
+                    "description": "Collector collects the metadata with a built-in collector of the\nagent instead of running the script.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/codersdk.WorkspaceAgentMetadataCollector"
+                        }
+                    ]
+                },
                 "display_name": {
                     "type": "string"
                 },
@@ -12532,6 +13760,18 @@ const docTemplate = `{
                 "cron": {
                     "type": "string"
                 },
+                "disk_pressure_path": {
+                    "description": "DiskPressurePath makes the script a cleanup script, which the agent\nruns once the disk usage of the path crosses DiskPressureThreshold.",
+                    "type": "string"
+                },
+                "disk_pressure_threshold": {
+                    "description": "DiskPressureThreshold is the disk usage in percent that runs the\nscript.",
+                    "type": "integer"
+                },
+                "display_name": {
+                    "description": "DisplayName is the display name of the log source of the script, which\nits logs are annotated with.",
+                    "type": "string"
+                },
                 "log_path": {
                     "type": "string"
                 },
@@ -12539,6 +13779,22 @@ const docTemplate = `{
                     "type": "string",
                     "format": "uuid"
                 },
+                "login": {
+                    "description": "Login runs the script with the environment of a login shell of\nthe user, so it sees the same PATH as interactive sessions.",
+                    "type": "boolean"
+                },
+                "run_on_build_failure": {
+                    "description": "RunOnBuildFailure runs the script once the workspace build that\ncreated the agent fails.",
+                    "type": "boolean"
+                },
+                "run_on_build_success": {
+                    "description": "RunOnBuildSuccess runs the script once the workspace build that\ncreated the agent succeeds, e.g. to prime caches.",
+                    "type": "boolean"
+                },
+                "run_on_post_start": {
+                    "description": "RunOnPostStart runs the script once the agent is ready, so\nnon-critical scripts don't delay the startup of the workspace.",
+                    "type": "boolean"
+                },
                 "run_on_start": {
                     "type": "boolean"
                 },
@@ -12556,6 +13812,27 @@ const docTemplate = `{
                 }
             }
         },
+        "codersdk.WorkspaceAgentScriptArtifact": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "id": {
+                    "type": "string",
+                    "format": "uuid"
+                },
+                "log_source_id": {
+                    "type": "string",
+                    "format": "uuid"
+                },
+                "size": {
+                    "description": "Size is the size of the archive in bytes.",
+                    "type": "integer"
+                }
+            }
+        },
         "codersdk.WorkspaceAgentStartupScriptBehavior": {
             "type": "string",
             "enum": [
@@ -12582,6 +13859,23 @@ const docTemplate = `{
                 "WorkspaceAgentTimeout"
             ]
         },
+        "codersdk.WorkspaceAgentTroubleshootingURLs": {
+            "type": "object",
+            "properties": {
+                "connection_timeout": {
+                    "description": "ConnectionTimeout is for agents that don't connect within their\nconnection timeout.",
+                    "type": "string"
+                },
+                "start_error": {
+                    "description": "StartError is for agents with a failed startup script.",
+                    "type": "string"
+                },
+                "token_invalid": {
+                    "description": "TokenInvalid is for agents that fail to authenticate with their token.",
+                    "type": "string"
+                }
+            }
+        },
         "codersdk.WorkspaceApp": {
             "type": "object",
             "properties": {
@@ -12599,6 +13893,14 @@ const docTemplate = `{
                 "health": {
                     "$ref": "#/definitions/codersdk.WorkspaceAppHealth"
                 },
+                "health_report": {
+                    "description": "HealthReport is the result of the latest healthcheck reported by the\nagent, if any.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/codersdk.WorkspaceAppHealthReport"
+                        }
+                    ]
+                },
                 "healthcheck": {
                     "description": "Healthcheck specifies the configuration for checking app health.",
                     "allOf": [
@@ -12660,6 +13962,23 @@ const docTemplate = `{
                 "WorkspaceAppHealthUnhealthy"
             ]
         },
+        "codersdk.WorkspaceAppHealthReport": {
+            "type": "object",
+            "properties": {
+                "checked_at": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "error": {
+                    "description": "Error is why the healthcheck failed, empty if it succeeded.",
+                    "type": "string"
+                },
+                "latency_ms": {
+                    "description": "LatencyMilliseconds is how long the healthcheck took.",
+                    "type": "number"
+                }
+            }
+        },
         "codersdk.WorkspaceAppSharingLevel": {
             "type": "string",
             "enum": [
@@ -12787,17 +14106,158 @@ const docTemplate = `{
                 }
             }
         },
+        "codersdk.WorkspaceBuildCapacityAttempt": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "description": "Error is the capacity error the apply with the option failed with."
+                },
+                "option": {
+                    "type": "string"
+                }
+            }
+        },
+        "codersdk.WorkspaceBuildCapacityFallback": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/codersdk.WorkspaceBuildCapacityAttempt"
+                    }
+                },
+                "selected": {
+                    "type": "string",
+                    "description": "Selected is the option the build succeeded with. Later builds of the\nworkspace start with it."
+                }
+            }
+        },
+        "codersdk.WorkspaceBuildDiagnosticBundle": {
+            "type": "object",
+            "properties": {
+                "environment": {
+                    "description": "Environment summarizes the host and the terraform environment\nvariables of the provisioner, with values that may be secrets redacted.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "graph": {
+                    "description": "Graph is the dependency graph of the template in DOT format.",
+                    "type": "string"
+                },
+                "logs": {
+                    "description": "Logs are the last provisioner logs of the build.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/codersdk.WorkspaceBuildDiagnosticLog"
+                    }
+                },
+                "plan_json": {
+                    "description": "PlanJSON is the plan of the build, with variable and sensitive values\nredacted.",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "terraform_version": {
+                    "type": "string"
+                }
+            }
+        },
+        "codersdk.WorkspaceBuildDiagnosticLog": {
+            "type": "object",
+            "properties": {
+                "level": {
+                    "$ref": "#/definitions/codersdk.LogLevel"
+                },
+                "output": {
+                    "type": "string"
+                }
+            }
+        },
         "codersdk.WorkspaceBuildParameter": {
             "type": "object",
             "properties": {
                 "name": {
                     "type": "string"
                 },
+                "source": {
+                    "description": "Source is where the value came from. Clients that copy the value of\nthe previous build should set it to \"previous_build\", any other value\nthey send is considered user input.",
+                    "enum": [
+                        "template_default",
+                        "previous_build",
+                        "user_input"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/codersdk.WorkspaceBuildParameterSource"
+                        }
+                    ]
+                },
                 "value": {
                     "type": "string"
                 }
             }
         },
+        "codersdk.WorkspaceBuildParameterSource": {
+            "type": "string",
+            "enum": [
+                "template_default",
+                "previous_build",
+                "user_input"
+            ],
+            "x-enum-varnames": [
+                "WorkspaceBuildParameterSourceTemplateDefault",
+                "WorkspaceBuildParameterSourcePreviousBuild",
+                "WorkspaceBuildParameterSourceUserInput"
+            ]
+        },
+        "codersdk.WorkspaceBuildWorkDirectory": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/codersdk.WorkspaceBuildWorkDirectoryEntry"
+                    }
+                },
+                "kept": {
+                    "description": "Kept is true if the work directory was kept on the provisioner host.",
+                    "type": "boolean"
+                },
+                "path": {
+                    "description": "Path is the work directory on the provisioner host.",
+                    "type": "string"
+                },
+                "truncated": {
+                    "description": "Truncated is true if the work directory had more entries than were\nlisted.",
+                    "type": "boolean"
+                }
+            }
+        },
+        "codersdk.WorkspaceBuildWorkDirectoryEntry": {
+            "type": "object",
+            "properties": {
+                "mode": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Path is relative to the work directory.",
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
         "codersdk.WorkspaceConnectionLatencyMS": {
             "type": "object",
             "properties": {
@@ -12947,6 +14407,21 @@ const docTemplate = `{
         "codersdk.WorkspaceResource": {
             "type": "object",
             "properties": {
+                "action": {
+                    "description": "Action is the change the build made to the resource, empty if\nunknown. Deleted resources only have a type and a name.",
+                    "enum": [
+                        "no_op",
+                        "create",
+                        "update",
+                        "replace",
+                        "delete"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/codersdk.WorkspaceResourceAction"
+                        }
+                    ]
+                },
                 "agents": {
                     "type": "array",
                     "items": {
@@ -13000,12 +14475,37 @@ const docTemplate = `{
                 }
             }
         },
+        "codersdk.WorkspaceResourceAction": {
+            "type": "string",
+            "enum": [
+                "no_op",
+                "create",
+                "update",
+                "replace",
+                "delete"
+            ],
+            "x-enum-varnames": [
+                "WorkspaceResourceActionNoOp",
+                "WorkspaceResourceActionCreate",
+                "WorkspaceResourceActionUpdate",
+                "WorkspaceResourceActionReplace",
+                "WorkspaceResourceActionDelete"
+            ]
+        },
         "codersdk.WorkspaceResourceMetadata": {
             "type": "object",
             "properties": {
+                "group": {
+                    "description": "Group is the name of the group the item is shown in, if any.",
+                    "type": "string"
+                },
                 "key": {
                     "type": "string"
                 },
+                "order": {
+                    "description": "Order is the position of the item defined by the template. Items are sorted by it.",
+                    "type": "integer"
+                },
                 "sensitive": {
                     "type": "boolean"
                 },
@@ -0,0 +1,210 @@
+package coderd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/coder/coder/v2/coderd/database"
+	"github.com/coder/coder/v2/coderd/database/dbtime"
+	"github.com/coder/coder/v2/coderd/httpapi"
+	"github.com/coder/coder/v2/coderd/httpmw"
+	"github.com/coder/coder/v2/coderd/rbac"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// @Summary Get user authorized SSH keys
+// @ID get-user-authorized-ssh-keys
+// @Security CoderSessionToken
+// @Produce json
+// @Tags Users
+// @Param user path string true "User ID, name, or me"
+// @Success 200 {object} codersdk.UserAuthorizedKeys
+// @Router /users/{user}/authorized-keys [get]
+func (api *API) userAuthorizedKeys(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := httpmw.UserParam(r)
+
+	// Users without keys don't have a row, which must not hide that the
+	// keys of other users can't be read.
+	if !api.Authorize(r, rbac.ActionRead, rbac.ResourceUserData.WithOwner(user.ID.String()).WithID(user.ID)) {
+		httpapi.ResourceNotFound(rw)
+		return
+	}
+	keys, err := api.Database.GetUserAuthorizedKeys(ctx, user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching user's authorized keys.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	resp, err := convertUserAuthorizedKeys(keys)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error converting user's authorized keys.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	httpapi.Write(ctx, rw, http.StatusOK, resp)
+}
+
+// @Summary Update user authorized SSH keys
+// @ID update-user-authorized-ssh-keys
+// @Security CoderSessionToken
+// @Accept json
+// @Produce json
+// @Tags Users
+// @Param user path string true "User ID, name, or me"
+// @Param request body codersdk.UpdateUserAuthorizedKeysRequest true "Authorized keys"
+// @Success 200 {object} codersdk.UserAuthorizedKeys
+// @Router /users/{user}/authorized-keys [put]
+func (api *API) putUserAuthorizedKeys(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := httpmw.UserParam(r)
+
+	var req codersdk.UpdateUserAuthorizedKeysRequest
+	if !httpapi.Read(ctx, rw, r, &req) {
+		return
+	}
+	var validErrs []codersdk.ValidationError
+	for i, key := range req.Keys {
+		_, _, _, _, err := gossh.ParseAuthorizedKey([]byte(key.PublicKey))
+		if err != nil {
+			validErrs = append(validErrs, codersdk.ValidationError{
+				Field:  fmt.Sprintf("keys[%d].public_key", i),
+				Detail: err.Error(),
+			})
+		}
+		for _, principal := range key.Principals {
+			if principal == "" {
+				validErrs = append(validErrs, codersdk.ValidationError{
+					Field:  fmt.Sprintf("keys[%d].principals", i),
+					Detail: "Principals must not be empty.",
+				})
+				break
+			}
+		}
+	}
+	if len(validErrs) > 0 {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message:     "Invalid authorized keys.",
+			Validations: validErrs,
+		})
+		return
+	}
+	if req.Keys == nil {
+		req.Keys = []codersdk.UserAuthorizedKey{}
+	}
+	rawKeys, err := json.Marshal(req.Keys)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error encoding authorized keys.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	keys, err := api.Database.UpsertUserAuthorizedKeys(ctx, database.UpsertUserAuthorizedKeysParams{
+		UserID:    user.ID,
+		Keys:      rawKeys,
+		Required:  req.Required,
+		UpdatedAt: dbtime.Now(),
+	})
+	if httpapi.Is404Error(err) {
+		httpapi.ResourceNotFound(rw)
+		return
+	}
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error updating user's authorized keys.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	resp, err := convertUserAuthorizedKeys(keys)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error converting user's authorized keys.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	httpapi.Write(ctx, rw, http.StatusOK, resp)
+}
+
+// @Summary Get workspace agent authorized SSH keys
+// @ID get-workspace-agent-authorized-ssh-keys
+// @Security CoderSessionToken
+// @Produce json
+// @Tags Agents
+// @Success 200 {object} agentsdk.AuthorizedKeysResponse
+// @Router /workspaceagents/me/authorized-keys [get]
+// @x-apidocgen {"skip": true}
+func (api *API) workspaceAgentAuthorizedKeys(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	agent := httpmw.WorkspaceAgent(r)
+
+	workspace, err := api.Database.GetWorkspaceByAgentID(ctx, agent.ID)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching workspace.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	keys, err := api.Database.GetUserAuthorizedKeys(ctx, workspace.Workspace.OwnerID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching authorized keys.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	userKeys, err := convertUserAuthorizedKeys(keys)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error converting authorized keys.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	resp := agentsdk.AuthorizedKeysResponse{
+		Keys:     make([]agentsdk.AuthorizedKey, 0, len(userKeys.Keys)),
+		Required: userKeys.Required,
+	}
+	for _, key := range userKeys.Keys {
+		resp.Keys = append(resp.Keys, agentsdk.AuthorizedKey{
+			PublicKey:  key.PublicKey,
+			Principals: key.Principals,
+		})
+	}
+	httpapi.Write(ctx, rw, http.StatusOK, resp)
+}
+
+// convertUserAuthorizedKeys converts the authorized keys of a user, users
+// without keys have an empty row.
+func convertUserAuthorizedKeys(keys database.UserAuthorizedKeys) (codersdk.UserAuthorizedKeys, error) {
+	resp := codersdk.UserAuthorizedKeys{
+		Keys:      []codersdk.UserAuthorizedKey{},
+		Required:  keys.Required,
+		UpdatedAt: keys.UpdatedAt,
+	}
+	if len(keys.Keys) == 0 {
+		return resp, nil
+	}
+	err := json.Unmarshal(keys.Keys, &resp.Keys)
+	if err != nil {
+		return codersdk.UserAuthorizedKeys{}, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,134 @@
+package coderd_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/coderd/coderdtest"
+	"github.com/coder/coder/v2/coderd/database"
+	"github.com/coder/coder/v2/coderd/database/dbfake"
+	"github.com/coder/coder/v2/coderd/gitsshkey"
+	"github.com/coder/coder/v2/coderd/rbac"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestUserAuthorizedKeys(t *testing.T) {
+	t.Parallel()
+	t.Run("None", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		client := coderdtest.New(t, nil)
+		_ = coderdtest.CreateFirstUser(t, client)
+
+		keys, err := client.UserAuthorizedKeys(ctx, codersdk.Me)
+		require.NoError(t, err)
+		require.Empty(t, keys.Keys)
+		require.False(t, keys.Required)
+	})
+	t.Run("Update", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		client := coderdtest.New(t, nil)
+		_ = coderdtest.CreateFirstUser(t, client)
+		_, publicKey, err := gitsshkey.Generate(gitsshkey.AlgorithmEd25519)
+		require.NoError(t, err)
+
+		updated, err := client.UpdateUserAuthorizedKeys(ctx, codersdk.Me, codersdk.UpdateUserAuthorizedKeysRequest{
+			Keys: []codersdk.UserAuthorizedKey{{
+				PublicKey:  publicKey,
+				Principals: []string{"coder"},
+			}},
+			Required: true,
+		})
+		require.NoError(t, err)
+		keys, err := client.UserAuthorizedKeys(ctx, codersdk.Me)
+		require.NoError(t, err)
+		require.Equal(t, updated, keys)
+		require.Len(t, keys.Keys, 1)
+		require.Equal(t, publicKey, keys.Keys[0].PublicKey)
+		require.Equal(t, []string{"coder"}, keys.Keys[0].Principals)
+		require.True(t, keys.Required)
+
+		// Updating replaces the keys.
+		keys, err = client.UpdateUserAuthorizedKeys(ctx, codersdk.Me, codersdk.UpdateUserAuthorizedKeysRequest{})
+		require.NoError(t, err)
+		require.Empty(t, keys.Keys)
+		require.False(t, keys.Required)
+	})
+	t.Run("InvalidKey", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		client := coderdtest.New(t, nil)
+		_ = coderdtest.CreateFirstUser(t, client)
+
+		_, err := client.UpdateUserAuthorizedKeys(ctx, codersdk.Me, codersdk.UpdateUserAuthorizedKeysRequest{
+			Keys: []codersdk.UserAuthorizedKey{{
+				PublicKey: "not a key",
+			}},
+		})
+		var apiErr *codersdk.Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusBadRequest, apiErr.StatusCode())
+		require.Len(t, apiErr.Validations, 1)
+		require.Equal(t, "keys[0].public_key", apiErr.Validations[0].Field)
+	})
+	t.Run("OtherUser", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		client := coderdtest.New(t, nil)
+		owner := coderdtest.CreateFirstUser(t, client)
+		// Template admins can read users, but not their data.
+		member, _ := coderdtest.CreateAnotherUser(t, client, owner.OrganizationID, rbac.RoleTemplateAdmin())
+
+		_, err := member.UserAuthorizedKeys(ctx, owner.UserID.String())
+		var apiErr *codersdk.Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusNotFound, apiErr.StatusCode())
+		_, err = member.UpdateUserAuthorizedKeys(ctx, owner.UserID.String(), codersdk.UpdateUserAuthorizedKeysRequest{})
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusNotFound, apiErr.StatusCode())
+	})
+}
+
+func TestWorkspaceAgentAuthorizedKeys(t *testing.T) {
+	t.Parallel()
+	ctx := testutil.Context(t, testutil.WaitLong)
+	client, db := coderdtest.NewWithDatabase(t, nil)
+	user := coderdtest.CreateFirstUser(t, client)
+	r := dbfake.WorkspaceBuild(t, db, database.Workspace{
+		OrganizationID: user.OrganizationID,
+		OwnerID:        user.UserID,
+	}).WithAgent().Do()
+	agentClient := agentsdk.New(client.URL)
+	agentClient.SetSessionToken(r.AgentToken)
+
+	resp, err := agentClient.AuthorizedKeys(ctx)
+	require.NoError(t, err)
+	require.Empty(t, resp.Keys)
+	require.False(t, resp.Required)
+
+	_, publicKey, err := gitsshkey.Generate(gitsshkey.AlgorithmEd25519)
+	require.NoError(t, err)
+	_, err = client.UpdateUserAuthorizedKeys(ctx, codersdk.Me, codersdk.UpdateUserAuthorizedKeysRequest{
+		Keys: []codersdk.UserAuthorizedKey{{
+			PublicKey:  publicKey,
+			Principals: []string{"coder"},
+		}},
+		Required: true,
+	})
+	require.NoError(t, err)
+
+	resp, err = agentClient.AuthorizedKeys(ctx)
+	require.NoError(t, err)
+	require.Equal(t, agentsdk.AuthorizedKeysResponse{
+		Keys: []agentsdk.AuthorizedKey{{
+			PublicKey:  publicKey,
+			Principals: []string{"coder"},
+		}},
+		Required: true,
+	}, resp)
+}
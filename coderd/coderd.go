@@ -66,6 +66,7 @@ import (
 	"github.com/coder/coder/v2/coderd/util/slice"
 	"github.com/coder/coder/v2/coderd/workspaceapps"
 	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
 	"github.com/coder/coder/v2/codersdk/drpc"
 	"github.com/coder/coder/v2/provisionerd/proto"
 	"github.com/coder/coder/v2/provisionersdk"
@@ -126,8 +127,12 @@ type Options struct {
 	TailnetCoordinator tailnet.Coordinator
 	DERPServer         *derp.Server
 	// BaseDERPMap is used as the base DERP map for all clients and agents.
-	// Proxies are added to this list.
+	// Proxies are added to this list. Agents fail over to the regions of
+	// DERPMapFallbacks, in order, when none of the other relays are
+	// reachable. BaseDERPMap must include them, see
+	// agentsdk.DERPMapWithFallbacks.
 	BaseDERPMap                 *tailcfg.DERPMap
+	DERPMapFallbacks            []agentsdk.DERPMapSource
 	DERPMapUpdateFrequency      time.Duration
 	SwaggerEndpoint             bool
 	SetUserGroups               func(ctx context.Context, logger slog.Logger, tx database.Store, userID uuid.UUID, groupNames []string, createMissingGroups bool) error
@@ -827,12 +832,15 @@ func New(options *Options) *API {
 					r.Get("/", api.userByName)
 					r.Get("/autofill-parameters", api.userAutofillParameters)
 					r.Get("/login-type", api.userLoginType)
+					r.Get("/notifications/watch", api.watchUserNotifications)
 					r.Put("/profile", api.putUserProfile)
 					r.Route("/status", func(r chi.Router) {
 						r.Put("/suspend", api.putSuspendUserAccount())
 						r.Put("/activate", api.putActivateUserAccount())
 					})
 					r.Put("/appearance", api.putUserAppearanceSettings)
+					r.Get("/authorized-keys", api.userAuthorizedKeys)
+					r.Put("/authorized-keys", api.putUserAuthorizedKeys)
 					r.Route("/password", func(r chi.Router) {
 						r.Put("/", api.putUserPassword)
 					})
@@ -894,6 +902,12 @@ func New(options *Options) *API {
 				r.Post("/startup", api.postWorkspaceAgentStartup)
 				r.Patch("/startup-logs", api.patchWorkspaceAgentLogsDeprecated)
 				r.Patch("/logs", api.patchWorkspaceAgentLogs)
+				r.Post("/log-source", api.workspaceAgentPostLogSource)
+				r.Post("/connection-failures", api.workspaceAgentPostConnectionFailures)
+				r.Get("/authorized-keys", api.workspaceAgentAuthorizedKeys)
+				r.Head("/script-artifacts/{logsource}", api.headWorkspaceAgentScriptArtifacts)
+				r.Patch("/script-artifacts/{logsource}", api.patchWorkspaceAgentScriptArtifacts)
+				r.Post("/script-artifacts/{logsource}", api.postWorkspaceAgentScriptArtifacts)
 				r.Post("/app-health", api.postWorkspaceAppHealth)
 				// Deprecated: Required to support legacy agents
 				r.Get("/gitauth", api.workspaceAgentsGitAuth)
@@ -923,6 +937,8 @@ func New(options *Options) *API {
 				r.Get("/startup-logs", api.workspaceAgentLogsDeprecated)
 				r.Get("/logs", api.workspaceAgentLogs)
 				r.Get("/listening-ports", api.workspaceAgentListeningPorts)
+				r.Get("/script-artifacts", api.workspaceAgentScriptArtifacts)
+				r.Get("/script-artifacts/{artifact}", api.workspaceAgentScriptArtifact)
 				r.Get("/connection", api.workspaceAgentConnection)
 				r.Get("/coordinate", api.workspaceAgentClientCoordinate)
 
@@ -957,6 +973,7 @@ func New(options *Options) *API {
 				r.Delete("/favorite", api.deleteFavoriteWorkspace)
 				r.Put("/autoupdates", api.putWorkspaceAutoupdates)
 				r.Get("/resolve-autostart", api.resolveAutostart)
+				r.Post("/refresh", api.postWorkspaceRefresh)
 			})
 		})
 		r.Route("/workspacebuilds/{workspacebuild}", func(r chi.Router) {
@@ -968,9 +985,13 @@ func New(options *Options) *API {
 			r.Get("/", api.workspaceBuild)
 			r.Patch("/cancel", api.patchCancelWorkspaceBuild)
 			r.Get("/logs", api.workspaceBuildLogs)
+			r.Get("/metadata", api.workspaceBuildMetadata)
+			r.Get("/capacity-fallback", api.workspaceBuildCapacityFallback)
 			r.Get("/parameters", api.workspaceBuildParameters)
 			r.Get("/resources", api.workspaceBuildResources)
 			r.Get("/state", api.workspaceBuildState)
+			r.Get("/diagnostic-bundle", api.workspaceBuildDiagnosticBundle)
+			r.Get("/work-directory", api.workspaceBuildWorkDirectory)
 		})
 		r.Route("/authcheck", func(r chi.Router) {
 			r.Use(apiKeyMiddleware)
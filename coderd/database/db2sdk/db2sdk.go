@@ -59,8 +59,9 @@ func WorkspaceBuildParameters(params []database.WorkspaceBuildParameter) []coder
 
 func WorkspaceBuildParameter(p database.WorkspaceBuildParameter) codersdk.WorkspaceBuildParameter {
 	return codersdk.WorkspaceBuildParameter{
-		Name:  p.Name,
-		Value: p.Value,
+		Name:   p.Name,
+		Value:  p.Value,
+		Source: codersdk.WorkspaceBuildParameterSource(p.Source),
 	}
 }
 
@@ -255,7 +256,7 @@ func OAuth2ProviderApps(accessURL *url.URL, dbApps []database.OAuth2ProviderApp)
 	return apps
 }
 
-func convertDisplayApps(apps []database.DisplayApp) []codersdk.DisplayApp {
+func DisplayApps(apps []database.DisplayApp) []codersdk.DisplayApp {
 	dapps := make([]codersdk.DisplayApp, 0, len(apps))
 	for _, app := range apps {
 		switch codersdk.DisplayApp(app) {
@@ -291,6 +292,20 @@ func WorkspaceAgent(derpMap *tailcfg.DERPMap, coordinator tailnet.Coordinator,
 	if dbAgent.TroubleshootingURL != "" {
 		troubleshootingURL = dbAgent.TroubleshootingURL
 	}
+	var troubleshootingURLs codersdk.WorkspaceAgentTroubleshootingURLs
+	if len(dbAgent.TroubleshootingURLs) > 0 {
+		err = json.Unmarshal(dbAgent.TroubleshootingURLs, &troubleshootingURLs)
+		if err != nil {
+			return codersdk.WorkspaceAgent{}, xerrors.Errorf("unmarshal troubleshooting urls: %w", err)
+		}
+	}
+	// Failures without a troubleshooting URL of their own fall back to the
+	// troubleshooting URL of the agent.
+	for _, u := range []*string{&troubleshootingURLs.ConnectionTimeout, &troubleshootingURLs.StartError, &troubleshootingURLs.TokenInvalid} {
+		if *u == "" {
+			*u = troubleshootingURL
+		}
+	}
 	subsystems := make([]codersdk.AgentSubsystem, len(dbAgent.Subsystems))
 	for i, subsystem := range dbAgent.Subsystems {
 		subsystems[i] = codersdk.AgentSubsystem(subsystem)
@@ -329,9 +344,10 @@ func WorkspaceAgent(derpMap *tailcfg.DERPMap, coordinator tailnet.Coordinator,
 		Apps:                     apps,
 		ConnectionTimeoutSeconds: dbAgent.ConnectionTimeoutSeconds,
 		TroubleshootingURL:       troubleshootingURL,
+		TroubleshootingURLs:      troubleshootingURLs,
 		LifecycleState:           codersdk.WorkspaceAgentLifecycle(dbAgent.LifecycleState),
 		Subsystems:               subsystems,
-		DisplayApps:              convertDisplayApps(dbAgent.DisplayApps),
+		DisplayApps:              DisplayApps(dbAgent.DisplayApps),
 	}
 	node := coordinator.Node(dbAgent.ID)
 	if node != nil {
@@ -427,6 +443,14 @@ func Apps(dbApps []database.WorkspaceApp, agent database.WorkspaceAgent, ownerNa
 
 	apps := make([]codersdk.WorkspaceApp, 0)
 	for _, dbApp := range dbApps {
+		var healthReport *codersdk.WorkspaceAppHealthReport
+		if dbApp.HealthCheckedAt.Valid {
+			healthReport = &codersdk.WorkspaceAppHealthReport{
+				LatencyMilliseconds: dbApp.HealthLatencyMs,
+				Error:               dbApp.HealthError,
+				CheckedAt:           dbApp.HealthCheckedAt.Time,
+			}
+		}
 		apps = append(apps, codersdk.WorkspaceApp{
 			ID:            dbApp.ID,
 			URL:           dbApp.Url.String,
@@ -443,7 +467,8 @@ func Apps(dbApps []database.WorkspaceApp, agent database.WorkspaceAgent, ownerNa
 				Interval:  dbApp.HealthcheckInterval,
 				Threshold: dbApp.HealthcheckThreshold,
 			},
-			Health: codersdk.WorkspaceAppHealth(dbApp.Health),
+			Health:       codersdk.WorkspaceAppHealth(dbApp.Health),
+			HealthReport: healthReport,
 		})
 	}
 	return apps
@@ -11,6 +11,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 
+	"cdr.dev/slog/sloggers/slogtest"
+
 	"github.com/coder/coder/v2/coderd/database"
 	"github.com/coder/coder/v2/coderd/database/db2sdk"
 	"github.com/coder/coder/v2/coderd/database/dbgen"
@@ -18,6 +20,7 @@ import (
 	"github.com/coder/coder/v2/coderd/database/dbtime"
 	"github.com/coder/coder/v2/codersdk"
 	"github.com/coder/coder/v2/provisionersdk/proto"
+	"github.com/coder/coder/v2/tailnet"
 )
 
 func TestProvisionerJobStatus(t *testing.T) {
@@ -208,3 +211,41 @@ func TestTemplateVersionParameter_BadDescription(t *testing.T) {
 	req.NoError(err)
 	req.NotEmpty(sdk.DescriptionPlaintext, "broke the markdown parser with %v", desc)
 }
+
+func TestWorkspaceAgent_TroubleshootingURLs(t *testing.T) {
+	t.Parallel()
+
+	coordinator := tailnet.NewCoordinator(slogtest.Make(t, nil))
+	t.Cleanup(func() {
+		_ = coordinator.Close()
+	})
+
+	convert := func(agent database.WorkspaceAgent, fallback string) codersdk.WorkspaceAgent {
+		converted, err := db2sdk.WorkspaceAgent(nil, coordinator, agent, nil, nil, nil, time.Minute, fallback)
+		require.NoError(t, err)
+		return converted
+	}
+
+	// Failures without a URL of their own use the URL of the agent.
+	agent := convert(database.WorkspaceAgent{
+		ID:                  uuid.New(),
+		TroubleshootingURL:  "https://example.com/agent",
+		TroubleshootingURLs: json.RawMessage(`{"start_error":"https://example.com/start"}`),
+	}, "https://example.com/fallback")
+	require.Equal(t, codersdk.WorkspaceAgentTroubleshootingURLs{
+		ConnectionTimeout: "https://example.com/agent",
+		StartError:        "https://example.com/start",
+		TokenInvalid:      "https://example.com/agent",
+	}, agent.TroubleshootingURLs)
+
+	// Agents created before troubleshooting URLs by class of failure use the
+	// deployment fallback.
+	agent = convert(database.WorkspaceAgent{
+		ID: uuid.New(),
+	}, "https://example.com/fallback")
+	require.Equal(t, codersdk.WorkspaceAgentTroubleshootingURLs{
+		ConnectionTimeout: "https://example.com/fallback",
+		StartError:        "https://example.com/fallback",
+		TokenInvalid:      "https://example.com/fallback",
+	}, agent.TroubleshootingURLs)
+}
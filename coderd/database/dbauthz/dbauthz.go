@@ -163,6 +163,7 @@ var (
 				Site: rbac.Permissions(map[string][]rbac.Action{
 					// TODO: Add ProvisionerJob resource type.
 					rbac.ResourceFile.Type:           {rbac.ActionRead},
+					rbac.ResourceGroup.Type:          {rbac.ActionRead},
 					rbac.ResourceSystem.Type:         {rbac.WildcardSymbol},
 					rbac.ResourceTemplate.Type:       {rbac.ActionRead, rbac.ActionUpdate},
 					rbac.ResourceUser.Type:           {rbac.ActionRead},
@@ -656,6 +657,23 @@ func authorizedTemplateVersionFromJob(ctx context.Context, q *querier, job datab
 	}
 }
 
+// workspaceFromRefreshJob returns the workspace a refresh job refreshes the
+// resources of. The caller must authorize access to it.
+func workspaceFromRefreshJob(ctx context.Context, q *querier, job database.ProvisionerJob) (database.Workspace, error) {
+	tmp := struct {
+		WorkspaceBuildID uuid.UUID `json:"workspace_build_id"`
+	}{}
+	err := json.Unmarshal(job.Input, &tmp)
+	if err != nil {
+		return database.Workspace{}, xerrors.Errorf("refresh unmarshal: %w", err)
+	}
+	build, err := q.db.GetWorkspaceBuildByID(ctx, tmp.WorkspaceBuildID)
+	if err != nil {
+		return database.Workspace{}, err
+	}
+	return q.db.GetWorkspaceByID(ctx, build.WorkspaceID)
+}
+
 func (q *querier) AcquireLock(ctx context.Context, id int64) error {
 	return q.db.AcquireLock(ctx, id)
 }
@@ -684,6 +702,19 @@ func (q *querier) AllUserIDs(ctx context.Context) ([]uuid.UUID, error) {
 	return q.db.AllUserIDs(ctx)
 }
 
+func (q *querier) AppendWorkspaceAgentUploadChunk(ctx context.Context, arg database.AppendWorkspaceAgentUploadChunkParams) (int64, error) {
+	workspace, err := q.db.GetWorkspaceByAgentID(ctx, arg.WorkspaceAgentID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := q.authorizeContext(ctx, rbac.ActionUpdate, workspace); err != nil {
+		return 0, err
+	}
+
+	return q.db.AppendWorkspaceAgentUploadChunk(ctx, arg)
+}
+
 func (q *querier) ArchiveUnusedTemplateVersions(ctx context.Context, arg database.ArchiveUnusedTemplateVersionsParams) ([]uuid.UUID, error) {
 	tpl, err := q.db.GetTemplateByID(ctx, arg.TemplateID)
 	if err != nil {
@@ -842,6 +873,13 @@ func (q *querier) DeleteOldWorkspaceAgentLogs(ctx context.Context) error {
 	return q.db.DeleteOldWorkspaceAgentLogs(ctx)
 }
 
+func (q *querier) DeleteOldWorkspaceAgentScriptArtifacts(ctx context.Context) error {
+	if err := q.authorizeContext(ctx, rbac.ActionDelete, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.DeleteOldWorkspaceAgentScriptArtifacts(ctx)
+}
+
 func (q *querier) DeleteOldWorkspaceAgentStats(ctx context.Context) error {
 	if err := q.authorizeContext(ctx, rbac.ActionDelete, rbac.ResourceSystem); err != nil {
 		return err
@@ -849,6 +887,20 @@ func (q *querier) DeleteOldWorkspaceAgentStats(ctx context.Context) error {
 	return q.db.DeleteOldWorkspaceAgentStats(ctx)
 }
 
+func (q *querier) DeleteOldWorkspaceAgentUploads(ctx context.Context) error {
+	if err := q.authorizeContext(ctx, rbac.ActionDelete, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.DeleteOldWorkspaceAgentUploads(ctx)
+}
+
+func (q *querier) DeleteProvisionerJobCheckpointByJobID(ctx context.Context, jobID uuid.UUID) error {
+	if err := q.authorizeContext(ctx, rbac.ActionDelete, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.DeleteProvisionerJobCheckpointByJobID(ctx, jobID)
+}
+
 func (q *querier) DeleteReplicasUpdatedBefore(ctx context.Context, updatedAt time.Time) error {
 	if err := q.authorizeContext(ctx, rbac.ActionDelete, rbac.ResourceSystem); err != nil {
 		return err
@@ -891,6 +943,26 @@ func (q *querier) DeleteTailnetTunnel(ctx context.Context, arg database.DeleteTa
 	return q.db.DeleteTailnetTunnel(ctx, arg)
 }
 
+func (q *querier) DeleteWorkspaceAgentUpload(ctx context.Context, arg database.DeleteWorkspaceAgentUploadParams) error {
+	workspace, err := q.db.GetWorkspaceByAgentID(ctx, arg.WorkspaceAgentID)
+	if err != nil {
+		return err
+	}
+
+	if err := q.authorizeContext(ctx, rbac.ActionUpdate, workspace); err != nil {
+		return err
+	}
+
+	return q.db.DeleteWorkspaceAgentUpload(ctx, arg)
+}
+
+func (q *querier) DeleteWorkspaceResourceMetadataByResourceID(ctx context.Context, workspaceResourceID uuid.UUID) error {
+	if err := q.authorizeContext(ctx, rbac.ActionDelete, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.DeleteWorkspaceResourceMetadataByResourceID(ctx, workspaceResourceID)
+}
+
 func (q *querier) FavoriteWorkspace(ctx context.Context, id uuid.UUID) error {
 	fetch := func(ctx context.Context, id uuid.UUID) (database.Workspace, error) {
 		return q.db.GetWorkspaceByID(ctx, id)
@@ -1094,6 +1166,10 @@ func (q *querier) GetGroupMembers(ctx context.Context, id uuid.UUID) ([]database
 	return q.db.GetGroupMembers(ctx, id)
 }
 
+func (q *querier) GetGroupsByOrganizationAndUserID(ctx context.Context, arg database.GetGroupsByOrganizationAndUserIDParams) ([]database.Group, error) {
+	return fetchWithPostFilter(q.auth, q.db.GetGroupsByOrganizationAndUserID)(ctx, arg)
+}
+
 func (q *querier) GetGroupsByOrganizationID(ctx context.Context, organizationID uuid.UUID) ([]database.Group, error) {
 	return fetchWithPostFilter(q.auth, q.db.GetGroupsByOrganizationID)(ctx, organizationID)
 }
@@ -1132,6 +1208,13 @@ func (q *querier) GetLatestWorkspaceBuildByWorkspaceID(ctx context.Context, work
 	return q.db.GetLatestWorkspaceBuildByWorkspaceID(ctx, workspaceID)
 }
 
+func (q *querier) GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID(ctx context.Context, workspaceID uuid.UUID) (database.WorkspaceBuildCapacityFallback, error) {
+	if _, err := q.GetWorkspaceByID(ctx, workspaceID); err != nil {
+		return database.WorkspaceBuildCapacityFallback{}, err
+	}
+	return q.db.GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID(ctx, workspaceID)
+}
+
 func (q *querier) GetLatestWorkspaceBuilds(ctx context.Context) ([]database.WorkspaceBuild, error) {
 	// This function is a system function until we implement a join for workspace builds.
 	// This is because we need to query for all related workspaces to the returned builds.
@@ -1298,6 +1381,14 @@ func (q *querier) GetProvisionerJobByID(ctx context.Context, id uuid.UUID) (data
 		if err != nil {
 			return database.ProvisionerJob{}, err
 		}
+	case database.ProvisionerJobTypeWorkspaceRefresh:
+		workspace, err := workspaceFromRefreshJob(ctx, q, job)
+		if err != nil {
+			return database.ProvisionerJob{}, err
+		}
+		if err := q.authorizeContext(ctx, rbac.ActionRead, workspace); err != nil {
+			return database.ProvisionerJob{}, err
+		}
 	default:
 		return database.ProvisionerJob{}, xerrors.Errorf("unknown job type: %q", job.Type)
 	}
@@ -1305,6 +1396,27 @@ func (q *querier) GetProvisionerJobByID(ctx context.Context, id uuid.UUID) (data
 	return job, nil
 }
 
+func (q *querier) GetProvisionerJobCheckpointByJobID(ctx context.Context, jobID uuid.UUID) (database.ProvisionerJobCheckpoint, error) {
+	if err := q.authorizeContext(ctx, rbac.ActionRead, rbac.ResourceSystem); err != nil {
+		return database.ProvisionerJobCheckpoint{}, err
+	}
+	return q.db.GetProvisionerJobCheckpointByJobID(ctx, jobID)
+}
+
+func (q *querier) GetProvisionerJobDiagnosticBundleByJobID(ctx context.Context, jobID uuid.UUID) (database.ProvisionerJobDiagnosticBundle, error) {
+	if err := q.authorizeContext(ctx, rbac.ActionRead, rbac.ResourceSystem); err != nil {
+		return database.ProvisionerJobDiagnosticBundle{}, err
+	}
+	return q.db.GetProvisionerJobDiagnosticBundleByJobID(ctx, jobID)
+}
+
+func (q *querier) GetProvisionerJobWorkDirectoryByJobID(ctx context.Context, jobID uuid.UUID) (database.ProvisionerJobWorkDirectory, error) {
+	if err := q.authorizeContext(ctx, rbac.ActionRead, rbac.ResourceSystem); err != nil {
+		return database.ProvisionerJobWorkDirectory{}, err
+	}
+	return q.db.GetProvisionerJobWorkDirectoryByJobID(ctx, jobID)
+}
+
 // TODO: we need to add a provisioner job resource
 func (q *querier) GetProvisionerJobsByIDs(ctx context.Context, ids []uuid.UUID) ([]database.ProvisionerJob, error) {
 	// if err := q.authorizeContext(ctx, rbac.ActionRead, rbac.ResourceSystem); err != nil {
@@ -1588,6 +1700,14 @@ func (q *querier) GetTemplateVersionByTemplateIDAndName(ctx context.Context, arg
 	return tv, nil
 }
 
+func (q *querier) GetTemplateVersionMetadataByTemplateVersionID(ctx context.Context, templateVersionID uuid.UUID) (database.TemplateVersionMetadatum, error) {
+	// An actor can read the metadata if they can read the template version.
+	if _, err := q.GetTemplateVersionByID(ctx, templateVersionID); err != nil {
+		return database.TemplateVersionMetadatum{}, err
+	}
+	return q.db.GetTemplateVersionMetadataByTemplateVersionID(ctx, templateVersionID)
+}
+
 func (q *querier) GetTemplateVersionParameters(ctx context.Context, templateVersionID uuid.UUID) ([]database.TemplateVersionParameter, error) {
 	// An actor can read template version parameters if they can read the related template.
 	tv, err := q.db.GetTemplateVersionByID(ctx, templateVersionID)
@@ -1688,6 +1808,14 @@ func (q *querier) GetUnexpiredLicenses(ctx context.Context) ([]database.License,
 	return q.db.GetUnexpiredLicenses(ctx)
 }
 
+func (q *querier) GetUnfinishedWorkspaceRefreshJobByBuildID(ctx context.Context, workspaceBuildID uuid.UUID) (database.ProvisionerJob, error) {
+	// Refreshes are authorized like the build they refresh.
+	if _, err := q.GetWorkspaceBuildByID(ctx, workspaceBuildID); err != nil {
+		return database.ProvisionerJob{}, err
+	}
+	return q.db.GetUnfinishedWorkspaceRefreshJobByBuildID(ctx, workspaceBuildID)
+}
+
 func (q *querier) GetUserActivityInsights(ctx context.Context, arg database.GetUserActivityInsightsParams) ([]database.GetUserActivityInsightsRow, error) {
 	// Used by insights endpoints. Need to check both for auditors and for regular users with template acl perms.
 	if err := q.authorizeContext(ctx, rbac.ActionRead, rbac.ResourceTemplateInsights); err != nil {
@@ -1710,6 +1838,10 @@ func (q *querier) GetUserActivityInsights(ctx context.Context, arg database.GetU
 	return q.db.GetUserActivityInsights(ctx, arg)
 }
 
+func (q *querier) GetUserAuthorizedKeys(ctx context.Context, userID uuid.UUID) (database.UserAuthorizedKeys, error) {
+	return fetch(q.log, q.auth, q.db.GetUserAuthorizedKeys)(ctx, userID)
+}
+
 func (q *querier) GetUserByEmailOrUsername(ctx context.Context, arg database.GetUserByEmailOrUsernameParams) (database.User, error) {
 	return fetch(q.log, q.auth, q.db.GetUserByEmailOrUsername)(ctx, arg)
 }
@@ -1868,6 +2000,37 @@ func (q *querier) GetWorkspaceAgentMetadata(ctx context.Context, arg database.Ge
 	return q.db.GetWorkspaceAgentMetadata(ctx, arg)
 }
 
+func (q *querier) GetWorkspaceAgentScriptArtifactByID(ctx context.Context, id uuid.UUID) (database.WorkspaceAgentScriptArtifact, error) {
+	artifact, err := q.db.GetWorkspaceAgentScriptArtifactByID(ctx, id)
+	if err != nil {
+		return database.WorkspaceAgentScriptArtifact{}, err
+	}
+
+	workspace, err := q.db.GetWorkspaceByAgentID(ctx, artifact.WorkspaceAgentID)
+	if err != nil {
+		return database.WorkspaceAgentScriptArtifact{}, err
+	}
+
+	if err := q.authorizeContext(ctx, rbac.ActionRead, workspace); err != nil {
+		return database.WorkspaceAgentScriptArtifact{}, err
+	}
+
+	return artifact, nil
+}
+
+func (q *querier) GetWorkspaceAgentScriptArtifactsByAgentID(ctx context.Context, workspaceAgentID uuid.UUID) ([]database.GetWorkspaceAgentScriptArtifactsByAgentIDRow, error) {
+	workspace, err := q.db.GetWorkspaceByAgentID(ctx, workspaceAgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.authorizeContext(ctx, rbac.ActionRead, workspace); err != nil {
+		return nil, err
+	}
+
+	return q.db.GetWorkspaceAgentScriptArtifactsByAgentID(ctx, workspaceAgentID)
+}
+
 func (q *querier) GetWorkspaceAgentScriptsByAgentIDs(ctx context.Context, ids []uuid.UUID) ([]database.WorkspaceAgentScript, error) {
 	if err := q.authorizeContext(ctx, rbac.ActionRead, rbac.ResourceSystem); err != nil {
 		return nil, err
@@ -1883,6 +2046,32 @@ func (q *querier) GetWorkspaceAgentStatsAndLabels(ctx context.Context, createdAf
 	return q.db.GetWorkspaceAgentStatsAndLabels(ctx, createdAfter)
 }
 
+func (q *querier) GetWorkspaceAgentUpload(ctx context.Context, arg database.GetWorkspaceAgentUploadParams) (database.WorkspaceAgentUpload, error) {
+	workspace, err := q.db.GetWorkspaceByAgentID(ctx, arg.WorkspaceAgentID)
+	if err != nil {
+		return database.WorkspaceAgentUpload{}, err
+	}
+
+	if err := q.authorizeContext(ctx, rbac.ActionRead, workspace); err != nil {
+		return database.WorkspaceAgentUpload{}, err
+	}
+
+	return q.db.GetWorkspaceAgentUpload(ctx, arg)
+}
+
+func (q *querier) GetWorkspaceAgentUploadData(ctx context.Context, arg database.GetWorkspaceAgentUploadDataParams) ([]byte, error) {
+	workspace, err := q.db.GetWorkspaceByAgentID(ctx, arg.WorkspaceAgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.authorizeContext(ctx, rbac.ActionRead, workspace); err != nil {
+		return nil, err
+	}
+
+	return q.db.GetWorkspaceAgentUploadData(ctx, arg)
+}
+
 // GetWorkspaceAgentsByResourceIDs
 // The workspace/job is already fetched.
 func (q *querier) GetWorkspaceAgentsByResourceIDs(ctx context.Context, ids []uuid.UUID) ([]database.WorkspaceAgent, error) {
@@ -1971,6 +2160,28 @@ func (q *querier) GetWorkspaceBuildByWorkspaceIDAndBuildNumber(ctx context.Conte
 	return q.db.GetWorkspaceBuildByWorkspaceIDAndBuildNumber(ctx, arg)
 }
 
+func (q *querier) GetWorkspaceBuildCapacityFallbackByBuildID(ctx context.Context, workspaceBuildID uuid.UUID) (database.WorkspaceBuildCapacityFallback, error) {
+	// Authorized call to get the workspace build. If we can read the build,
+	// we can read the capacity options it tried.
+	_, err := q.GetWorkspaceBuildByID(ctx, workspaceBuildID)
+	if err != nil {
+		return database.WorkspaceBuildCapacityFallback{}, err
+	}
+
+	return q.db.GetWorkspaceBuildCapacityFallbackByBuildID(ctx, workspaceBuildID)
+}
+
+func (q *querier) GetWorkspaceBuildMetadataByBuildID(ctx context.Context, workspaceBuildID uuid.UUID) ([]database.WorkspaceBuildMetadatum, error) {
+	// Authorized call to get the workspace build. If we can read the build,
+	// we can read the metadata.
+	_, err := q.GetWorkspaceBuildByID(ctx, workspaceBuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.db.GetWorkspaceBuildMetadataByBuildID(ctx, workspaceBuildID)
+}
+
 func (q *querier) GetWorkspaceBuildParameters(ctx context.Context, workspaceBuildID uuid.UUID) ([]database.WorkspaceBuildParameter, error) {
 	// Authorized call to get the workspace build. If we can read the build,
 	// we can read the params.
@@ -2102,6 +2313,12 @@ func (q *querier) GetWorkspaceResourcesByJobID(ctx context.Context, jobID uuid.U
 			return nil, err
 		}
 		obj = workspace
+	case database.ProvisionerJobTypeWorkspaceRefresh:
+		workspace, err := workspaceFromRefreshJob(ctx, q, job)
+		if err != nil {
+			return nil, err
+		}
+		obj = workspace
 	default:
 		return nil, xerrors.Errorf("unknown job type: %s", job.Type)
 	}
@@ -2259,6 +2476,13 @@ func (q *querier) InsertProvisionerJob(ctx context.Context, arg database.InsertP
 	return q.db.InsertProvisionerJob(ctx, arg)
 }
 
+func (q *querier) InsertProvisionerJobDiagnosticBundle(ctx context.Context, arg database.InsertProvisionerJobDiagnosticBundleParams) error {
+	if err := q.authorizeContext(ctx, rbac.ActionCreate, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.InsertProvisionerJobDiagnosticBundle(ctx, arg)
+}
+
 // TODO: We need to create a ProvisionerJob resource type
 func (q *querier) InsertProvisionerJobLogs(ctx context.Context, arg database.InsertProvisionerJobLogsParams) ([]database.ProvisionerJobLog, error) {
 	// if err := q.authorizeContext(ctx, rbac.ActionCreate, rbac.ResourceSystem); err != nil {
@@ -2267,6 +2491,13 @@ func (q *querier) InsertProvisionerJobLogs(ctx context.Context, arg database.Ins
 	return q.db.InsertProvisionerJobLogs(ctx, arg)
 }
 
+func (q *querier) InsertProvisionerJobWorkDirectory(ctx context.Context, arg database.InsertProvisionerJobWorkDirectoryParams) error {
+	if err := q.authorizeContext(ctx, rbac.ActionCreate, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.InsertProvisionerJobWorkDirectory(ctx, arg)
+}
+
 func (q *querier) InsertReplica(ctx context.Context, arg database.InsertReplicaParams) (database.Replica, error) {
 	if err := q.authorizeContext(ctx, rbac.ActionCreate, rbac.ResourceSystem); err != nil {
 		return database.Replica{}, err
@@ -2380,6 +2611,19 @@ func (q *querier) InsertWorkspaceAgentMetadata(ctx context.Context, arg database
 	return q.db.InsertWorkspaceAgentMetadata(ctx, arg)
 }
 
+func (q *querier) InsertWorkspaceAgentScriptArtifact(ctx context.Context, arg database.InsertWorkspaceAgentScriptArtifactParams) error {
+	workspace, err := q.db.GetWorkspaceByAgentID(ctx, arg.WorkspaceAgentID)
+	if err != nil {
+		return err
+	}
+
+	if err := q.authorizeContext(ctx, rbac.ActionUpdate, workspace); err != nil {
+		return err
+	}
+
+	return q.db.InsertWorkspaceAgentScriptArtifact(ctx, arg)
+}
+
 func (q *querier) InsertWorkspaceAgentScripts(ctx context.Context, arg database.InsertWorkspaceAgentScriptsParams) ([]database.WorkspaceAgentScript, error) {
 	if err := q.authorizeContext(ctx, rbac.ActionCreate, rbac.ResourceSystem); err != nil {
 		return []database.WorkspaceAgentScript{}, err
@@ -2409,6 +2653,19 @@ func (q *querier) InsertWorkspaceAgentStats(ctx context.Context, arg database.In
 	return q.db.InsertWorkspaceAgentStats(ctx, arg)
 }
 
+func (q *querier) InsertWorkspaceAgentUpload(ctx context.Context, arg database.InsertWorkspaceAgentUploadParams) (int64, error) {
+	workspace, err := q.db.GetWorkspaceByAgentID(ctx, arg.WorkspaceAgentID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := q.authorizeContext(ctx, rbac.ActionUpdate, workspace); err != nil {
+		return 0, err
+	}
+
+	return q.db.InsertWorkspaceAgentUpload(ctx, arg)
+}
+
 func (q *querier) InsertWorkspaceApp(ctx context.Context, arg database.InsertWorkspaceAppParams) (database.WorkspaceApp, error) {
 	if err := q.authorizeContext(ctx, rbac.ActionCreate, rbac.ResourceSystem); err != nil {
 		return database.WorkspaceApp{}, err
@@ -2462,6 +2719,20 @@ func (q *querier) InsertWorkspaceBuild(ctx context.Context, arg database.InsertW
 	return q.db.InsertWorkspaceBuild(ctx, arg)
 }
 
+func (q *querier) InsertWorkspaceBuildCapacityFallback(ctx context.Context, arg database.InsertWorkspaceBuildCapacityFallbackParams) error {
+	if err := q.authorizeContext(ctx, rbac.ActionCreate, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.InsertWorkspaceBuildCapacityFallback(ctx, arg)
+}
+
+func (q *querier) InsertWorkspaceBuildMetadata(ctx context.Context, arg database.InsertWorkspaceBuildMetadataParams) error {
+	if err := q.authorizeContext(ctx, rbac.ActionCreate, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.InsertWorkspaceBuildMetadata(ctx, arg)
+}
+
 func (q *querier) InsertWorkspaceBuildParameters(ctx context.Context, arg database.InsertWorkspaceBuildParametersParams) error {
 	// TODO: Optimize this. We always have the workspace and build already fetched.
 	build, err := q.db.GetWorkspaceBuildByID(ctx, arg.WorkspaceBuildID)
@@ -2626,6 +2897,13 @@ func (q *querier) UpdateProvisionerJobByID(ctx context.Context, arg database.Upd
 	return q.db.UpdateProvisionerJobByID(ctx, arg)
 }
 
+func (q *querier) UpdateProvisionerJobCheckpointResumedByJobID(ctx context.Context, arg database.UpdateProvisionerJobCheckpointResumedByJobIDParams) error {
+	if err := q.authorizeContext(ctx, rbac.ActionUpdate, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.UpdateProvisionerJobCheckpointResumedByJobID(ctx, arg)
+}
+
 func (q *querier) UpdateProvisionerJobWithCancelByID(ctx context.Context, arg database.UpdateProvisionerJobWithCancelByIDParams) error {
 	job, err := q.db.GetProvisionerJobByID(ctx, arg.ID)
 	if err != nil {
@@ -2687,6 +2965,17 @@ func (q *querier) UpdateProvisionerJobWithCancelByID(ctx context.Context, arg da
 				return err
 			}
 		}
+	case database.ProvisionerJobTypeWorkspaceRefresh:
+		// Refreshes don't change resources, so anyone who can start one can
+		// cancel it.
+		workspace, err := workspaceFromRefreshJob(ctx, q, job)
+		if err != nil {
+			return err
+		}
+		err = q.authorizeContext(ctx, rbac.ActionUpdate, workspace)
+		if err != nil {
+			return err
+		}
 	default:
 		return xerrors.Errorf("unknown job type: %q", job.Type)
 	}
@@ -2701,6 +2990,13 @@ func (q *querier) UpdateProvisionerJobWithCompleteByID(ctx context.Context, arg
 	return q.db.UpdateProvisionerJobWithCompleteByID(ctx, arg)
 }
 
+func (q *querier) UpdateProvisionerJobWithRequeueByID(ctx context.Context, arg database.UpdateProvisionerJobWithRequeueByIDParams) error {
+	if err := q.authorizeContext(ctx, rbac.ActionUpdate, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.UpdateProvisionerJobWithRequeueByID(ctx, arg)
+}
+
 func (q *querier) UpdateReplica(ctx context.Context, arg database.UpdateReplicaParams) (database.Replica, error) {
 	if err := q.authorizeContext(ctx, rbac.ActionUpdate, rbac.ResourceSystem); err != nil {
 		return database.Replica{}, err
@@ -3007,6 +3303,13 @@ func (q *querier) UpdateWorkspaceAgentMetadata(ctx context.Context, arg database
 	return q.db.UpdateWorkspaceAgentMetadata(ctx, arg)
 }
 
+func (q *querier) UpdateWorkspaceAgentResourceIDByID(ctx context.Context, arg database.UpdateWorkspaceAgentResourceIDByIDParams) error {
+	if err := q.authorizeContext(ctx, rbac.ActionUpdate, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.UpdateWorkspaceAgentResourceIDByID(ctx, arg)
+}
+
 func (q *querier) UpdateWorkspaceAgentStartupByID(ctx context.Context, arg database.UpdateWorkspaceAgentStartupByIDParams) error {
 	agent, err := q.db.GetWorkspaceAgentByID(ctx, arg.ID)
 	if err != nil {
@@ -3224,6 +3527,13 @@ func (q *querier) UpsertProvisionerDaemon(ctx context.Context, arg database.Upse
 	return q.db.UpsertProvisionerDaemon(ctx, arg)
 }
 
+func (q *querier) UpsertProvisionerJobCheckpoint(ctx context.Context, arg database.UpsertProvisionerJobCheckpointParams) error {
+	if err := q.authorizeContext(ctx, rbac.ActionUpdate, rbac.ResourceSystem); err != nil {
+		return err
+	}
+	return q.db.UpsertProvisionerJobCheckpoint(ctx, arg)
+}
+
 func (q *querier) UpsertServiceBanner(ctx context.Context, value string) error {
 	if err := q.authorizeContext(ctx, rbac.ActionCreate, rbac.ResourceDeploymentValues); err != nil {
 		return err
@@ -3273,6 +3583,35 @@ func (q *querier) UpsertTailnetTunnel(ctx context.Context, arg database.UpsertTa
 	return q.db.UpsertTailnetTunnel(ctx, arg)
 }
 
+func (q *querier) UpsertTemplateVersionMetadata(ctx context.Context, arg database.UpsertTemplateVersionMetadataParams) error {
+	// An actor is allowed to update the template version metadata if they are authorized to update the template.
+	tv, err := q.db.GetTemplateVersionByID(ctx, arg.TemplateVersionID)
+	if err != nil {
+		return err
+	}
+	var obj rbac.Objecter
+	if !tv.TemplateID.Valid {
+		obj = rbac.ResourceTemplate.InOrg(tv.OrganizationID)
+	} else {
+		tpl, err := q.db.GetTemplateByID(ctx, tv.TemplateID.UUID)
+		if err != nil {
+			return err
+		}
+		obj = tpl
+	}
+	if err := q.authorizeContext(ctx, rbac.ActionUpdate, obj); err != nil {
+		return err
+	}
+	return q.db.UpsertTemplateVersionMetadata(ctx, arg)
+}
+
+func (q *querier) UpsertUserAuthorizedKeys(ctx context.Context, arg database.UpsertUserAuthorizedKeysParams) (database.UserAuthorizedKeys, error) {
+	if err := q.authorizeContext(ctx, rbac.ActionUpdate, rbac.ResourceUserData.WithOwner(arg.UserID.String()).WithID(arg.UserID)); err != nil {
+		return database.UserAuthorizedKeys{}, err
+	}
+	return q.db.UpsertUserAuthorizedKeys(ctx, arg)
+}
+
 func (q *querier) GetAuthorizedTemplates(ctx context.Context, arg database.GetTemplatesWithFilterParams, _ rbac.PreparedAuthorized) ([]database.Template, error) {
 	// TODO Delete this function, all GetTemplates should be authorized. For now just call getTemplates on the authz querier.
 	return q.GetTemplatesWithFilter(ctx, arg)
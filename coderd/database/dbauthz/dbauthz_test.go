@@ -432,6 +432,17 @@ func (s *MethodTestSuite) TestProvisionerJob() {
 		})
 		check.Args(j.ID).Asserts(v.RBACObject(tpl), rbac.ActionRead).Returns(j)
 	}))
+	s.Run("WorkspaceRefresh/GetProvisionerJobByID", s.Subtest(func(db database.Store, check *expects) {
+		w := dbgen.Workspace(s.T(), db, database.Workspace{})
+		b := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{JobID: uuid.New(), WorkspaceID: w.ID})
+		j := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{
+			Type: database.ProvisionerJobTypeWorkspaceRefresh,
+			Input: must(json.Marshal(struct {
+				WorkspaceBuildID uuid.UUID `json:"workspace_build_id"`
+			}{WorkspaceBuildID: b.ID})),
+		})
+		check.Args(j.ID).Asserts(w, rbac.ActionRead).Returns(j)
+	}))
 	s.Run("Build/UpdateProvisionerJobWithCancelByID", s.Subtest(func(db database.Store, check *expects) {
 		tpl := dbgen.Template(s.T(), db, database.Template{AllowUserCancelWorkspaceJobs: true})
 		w := dbgen.Workspace(s.T(), db, database.Workspace{TemplateID: tpl.ID})
@@ -559,6 +570,18 @@ func (s *MethodTestSuite) TestLicense() {
 }
 
 func (s *MethodTestSuite) TestOrganization() {
+	s.Run("GetGroupsByOrganizationAndUserID", s.Subtest(func(db database.Store, check *expects) {
+		o := dbgen.Organization(s.T(), db, database.Organization{})
+		u := dbgen.User(s.T(), db, database.User{})
+		a := dbgen.Group(s.T(), db, database.Group{OrganizationID: o.ID})
+		_ = dbgen.Group(s.T(), db, database.Group{OrganizationID: o.ID})
+		dbgen.GroupMember(s.T(), db, database.GroupMember{GroupID: a.ID, UserID: u.ID})
+		check.Args(database.GetGroupsByOrganizationAndUserIDParams{
+			UserID:         u.ID,
+			OrganizationID: o.ID,
+		}).Asserts(a, rbac.ActionRead).
+			Returns([]database.Group{a})
+	}))
 	s.Run("GetGroupsByOrganizationID", s.Subtest(func(db database.Store, check *expects) {
 		o := dbgen.Organization(s.T(), db, database.Organization{})
 		a := dbgen.Group(s.T(), db, database.Group{OrganizationID: o.ID})
@@ -748,6 +771,21 @@ func (s *MethodTestSuite) TestTemplate() {
 			TemplateID: uuid.NullUUID{UUID: t1.ID, Valid: true},
 		}).Asserts(t1, rbac.ActionRead).Returns(tv)
 	}))
+	s.Run("GetTemplateVersionMetadataByTemplateVersionID", s.Subtest(func(db database.Store, check *expects) {
+		t1 := dbgen.Template(s.T(), db, database.Template{})
+		tv := dbgen.TemplateVersion(s.T(), db, database.TemplateVersion{
+			TemplateID: uuid.NullUUID{UUID: t1.ID, Valid: true},
+		})
+		metadata := database.TemplateVersionMetadatum{
+			TemplateVersionID: tv.ID,
+			DisplayName:       "Docker",
+		}
+		require.NoError(s.T(), db.UpsertTemplateVersionMetadata(context.Background(), database.UpsertTemplateVersionMetadataParams{
+			TemplateVersionID: tv.ID,
+			DisplayName:       metadata.DisplayName,
+		}))
+		check.Args(tv.ID).Asserts(t1, rbac.ActionRead).Returns(metadata)
+	}))
 	s.Run("GetTemplateVersionParameters", s.Subtest(func(db database.Store, check *expects) {
 		t1 := dbgen.Template(s.T(), db, database.Template{})
 		tv := dbgen.TemplateVersion(s.T(), db, database.TemplateVersion{
@@ -890,7 +928,8 @@ func (s *MethodTestSuite) TestTemplate() {
 	s.Run("UpdateTemplateMetaByID", s.Subtest(func(db database.Store, check *expects) {
 		t1 := dbgen.Template(s.T(), db, database.Template{})
 		check.Args(database.UpdateTemplateMetaByIDParams{
-			ID: t1.ID,
+			ID:                 t1.ID,
+			MaxAppSharingLevel: database.AppSharingLevelPublic,
 		}).Asserts(t1, rbac.ActionUpdate)
 	}))
 	s.Run("UpdateTemplateVersionByID", s.Subtest(func(db database.Store, check *expects) {
@@ -917,6 +956,16 @@ func (s *MethodTestSuite) TestTemplate() {
 			Readme: "foo",
 		}).Asserts(t1, rbac.ActionUpdate).Returns()
 	}))
+	s.Run("UpsertTemplateVersionMetadata", s.Subtest(func(db database.Store, check *expects) {
+		t1 := dbgen.Template(s.T(), db, database.Template{})
+		tv := dbgen.TemplateVersion(s.T(), db, database.TemplateVersion{
+			TemplateID: uuid.NullUUID{UUID: t1.ID, Valid: true},
+		})
+		check.Args(database.UpsertTemplateVersionMetadataParams{
+			TemplateVersionID: tv.ID,
+			DisplayName:       "Docker",
+		}).Asserts(t1, rbac.ActionUpdate).Returns()
+	}))
 	s.Run("UpdateTemplateVersionExternalAuthProvidersByJobID", s.Subtest(func(db database.Store, check *expects) {
 		jobID := uuid.New()
 		t1 := dbgen.Template(s.T(), db, database.Template{})
@@ -1100,6 +1149,24 @@ func (s *MethodTestSuite) TestUser() {
 			UpdatedAt: key.UpdatedAt,
 		}).Asserts(key, rbac.ActionUpdate).Returns(key)
 	}))
+	s.Run("GetUserAuthorizedKeys", s.Subtest(func(db database.Store, check *expects) {
+		u := dbgen.User(s.T(), db, database.User{})
+		keys, err := db.UpsertUserAuthorizedKeys(context.Background(), database.UpsertUserAuthorizedKeysParams{
+			UserID:    u.ID,
+			Keys:      json.RawMessage("[]"),
+			UpdatedAt: dbtime.Now(),
+		})
+		s.NoError(err, "upsert user authorized keys")
+		check.Args(u.ID).Asserts(keys, rbac.ActionRead).Returns(keys)
+	}))
+	s.Run("UpsertUserAuthorizedKeys", s.Subtest(func(db database.Store, check *expects) {
+		u := dbgen.User(s.T(), db, database.User{})
+		check.Args(database.UpsertUserAuthorizedKeysParams{
+			UserID:    u.ID,
+			Keys:      json.RawMessage("[]"),
+			UpdatedAt: dbtime.Now(),
+		}).Asserts(rbac.ResourceUserData.WithID(u.ID).WithOwner(u.ID.String()), rbac.ActionUpdate)
+	}))
 	s.Run("GetExternalAuthLink", s.Subtest(func(db database.Store, check *expects) {
 		link := dbgen.ExternalAuthLink(s.T(), db, database.ExternalAuthLink{})
 		check.Args(database.GetExternalAuthLinkParams{
@@ -1239,6 +1306,163 @@ func (s *MethodTestSuite) TestWorkspace() {
 			LifecycleState: database.WorkspaceAgentLifecycleStateCreated,
 		}).Asserts(ws, rbac.ActionUpdate).Returns()
 	}))
+	s.Run("InsertWorkspaceAgentUpload", s.Subtest(func(db database.Store, check *expects) {
+		tpl := dbgen.Template(s.T(), db, database.Template{})
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{
+			TemplateID: tpl.ID,
+		})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, JobID: uuid.New()})
+		res := dbgen.WorkspaceResource(s.T(), db, database.WorkspaceResource{JobID: build.JobID})
+		agt := dbgen.WorkspaceAgent(s.T(), db, database.WorkspaceAgent{ResourceID: res.ID})
+		check.Args(database.InsertWorkspaceAgentUploadParams{
+			WorkspaceAgentID: agt.ID,
+			Name:             "artifacts",
+			Checksum:         "sha256=checksum",
+			Size:             1,
+			CreatedAt:        time.Now(),
+			MaxUploads:       1,
+		}).Asserts(ws, rbac.ActionUpdate).Returns(int64(1))
+	}))
+	s.Run("GetWorkspaceAgentUpload", s.Subtest(func(db database.Store, check *expects) {
+		tpl := dbgen.Template(s.T(), db, database.Template{})
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{
+			TemplateID: tpl.ID,
+		})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, JobID: uuid.New()})
+		res := dbgen.WorkspaceResource(s.T(), db, database.WorkspaceResource{JobID: build.JobID})
+		agt := dbgen.WorkspaceAgent(s.T(), db, database.WorkspaceAgent{ResourceID: res.ID})
+		_, err := db.InsertWorkspaceAgentUpload(context.Background(), database.InsertWorkspaceAgentUploadParams{
+			WorkspaceAgentID: agt.ID,
+			Name:             "artifacts",
+			Checksum:         "sha256=checksum",
+			Size:             1,
+			CreatedAt:        time.Now(),
+			MaxUploads:       1,
+		})
+		s.NoError(err, "insert workspace agent upload")
+		check.Args(database.GetWorkspaceAgentUploadParams{
+			WorkspaceAgentID: agt.ID,
+			Name:             "artifacts",
+			Checksum:         "sha256=checksum",
+		}).Asserts(ws, rbac.ActionRead)
+	}))
+	s.Run("GetWorkspaceAgentUploadData", s.Subtest(func(db database.Store, check *expects) {
+		tpl := dbgen.Template(s.T(), db, database.Template{})
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{
+			TemplateID: tpl.ID,
+		})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, JobID: uuid.New()})
+		res := dbgen.WorkspaceResource(s.T(), db, database.WorkspaceResource{JobID: build.JobID})
+		agt := dbgen.WorkspaceAgent(s.T(), db, database.WorkspaceAgent{ResourceID: res.ID})
+		_, err := db.InsertWorkspaceAgentUpload(context.Background(), database.InsertWorkspaceAgentUploadParams{
+			WorkspaceAgentID: agt.ID,
+			Name:             "artifacts",
+			Checksum:         "sha256=checksum",
+			Size:             1,
+			CreatedAt:        time.Now(),
+			MaxUploads:       1,
+		})
+		s.NoError(err, "insert workspace agent upload")
+		check.Args(database.GetWorkspaceAgentUploadDataParams{
+			WorkspaceAgentID: agt.ID,
+			Name:             "artifacts",
+			Checksum:         "sha256=checksum",
+		}).Asserts(ws, rbac.ActionRead).Returns([]byte{})
+	}))
+	s.Run("AppendWorkspaceAgentUploadChunk", s.Subtest(func(db database.Store, check *expects) {
+		tpl := dbgen.Template(s.T(), db, database.Template{})
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{
+			TemplateID: tpl.ID,
+		})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, JobID: uuid.New()})
+		res := dbgen.WorkspaceResource(s.T(), db, database.WorkspaceResource{JobID: build.JobID})
+		agt := dbgen.WorkspaceAgent(s.T(), db, database.WorkspaceAgent{ResourceID: res.ID})
+		_, err := db.InsertWorkspaceAgentUpload(context.Background(), database.InsertWorkspaceAgentUploadParams{
+			WorkspaceAgentID: agt.ID,
+			Name:             "artifacts",
+			Checksum:         "sha256=checksum",
+			Size:             1,
+			CreatedAt:        time.Now(),
+			MaxUploads:       1,
+		})
+		s.NoError(err, "insert workspace agent upload")
+		check.Args(database.AppendWorkspaceAgentUploadChunkParams{
+			Chunk:            []byte{1},
+			UpdatedAt:        time.Now(),
+			WorkspaceAgentID: agt.ID,
+			Name:             "artifacts",
+			Checksum:         "sha256=checksum",
+			Offset:           0,
+		}).Asserts(ws, rbac.ActionUpdate).Returns(int64(1))
+	}))
+	s.Run("DeleteWorkspaceAgentUpload", s.Subtest(func(db database.Store, check *expects) {
+		tpl := dbgen.Template(s.T(), db, database.Template{})
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{
+			TemplateID: tpl.ID,
+		})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, JobID: uuid.New()})
+		res := dbgen.WorkspaceResource(s.T(), db, database.WorkspaceResource{JobID: build.JobID})
+		agt := dbgen.WorkspaceAgent(s.T(), db, database.WorkspaceAgent{ResourceID: res.ID})
+		_, err := db.InsertWorkspaceAgentUpload(context.Background(), database.InsertWorkspaceAgentUploadParams{
+			WorkspaceAgentID: agt.ID,
+			Name:             "artifacts",
+			Checksum:         "sha256=checksum",
+			Size:             1,
+			CreatedAt:        time.Now(),
+			MaxUploads:       1,
+		})
+		s.NoError(err, "insert workspace agent upload")
+		check.Args(database.DeleteWorkspaceAgentUploadParams{
+			WorkspaceAgentID: agt.ID,
+			Name:             "artifacts",
+			Checksum:         "sha256=checksum",
+		}).Asserts(ws, rbac.ActionUpdate).Returns()
+	}))
+	s.Run("InsertWorkspaceAgentScriptArtifact", s.Subtest(func(db database.Store, check *expects) {
+		tpl := dbgen.Template(s.T(), db, database.Template{})
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{
+			TemplateID: tpl.ID,
+		})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, JobID: uuid.New()})
+		res := dbgen.WorkspaceResource(s.T(), db, database.WorkspaceResource{JobID: build.JobID})
+		agt := dbgen.WorkspaceAgent(s.T(), db, database.WorkspaceAgent{ResourceID: res.ID})
+		check.Args(database.InsertWorkspaceAgentScriptArtifactParams{
+			ID:               uuid.New(),
+			WorkspaceAgentID: agt.ID,
+			LogSourceID:      uuid.New(),
+			Archive:          []byte{1},
+			CreatedAt:        time.Now(),
+		}).Asserts(ws, rbac.ActionUpdate).Returns()
+	}))
+	s.Run("GetWorkspaceAgentScriptArtifactsByAgentID", s.Subtest(func(db database.Store, check *expects) {
+		tpl := dbgen.Template(s.T(), db, database.Template{})
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{
+			TemplateID: tpl.ID,
+		})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, JobID: uuid.New()})
+		res := dbgen.WorkspaceResource(s.T(), db, database.WorkspaceResource{JobID: build.JobID})
+		agt := dbgen.WorkspaceAgent(s.T(), db, database.WorkspaceAgent{ResourceID: res.ID})
+		check.Args(agt.ID).Asserts(ws, rbac.ActionRead).Returns([]database.GetWorkspaceAgentScriptArtifactsByAgentIDRow{})
+	}))
+	s.Run("GetWorkspaceAgentScriptArtifactByID", s.Subtest(func(db database.Store, check *expects) {
+		tpl := dbgen.Template(s.T(), db, database.Template{})
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{
+			TemplateID: tpl.ID,
+		})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, JobID: uuid.New()})
+		res := dbgen.WorkspaceResource(s.T(), db, database.WorkspaceResource{JobID: build.JobID})
+		agt := dbgen.WorkspaceAgent(s.T(), db, database.WorkspaceAgent{ResourceID: res.ID})
+		params := database.InsertWorkspaceAgentScriptArtifactParams{
+			ID:               uuid.New(),
+			WorkspaceAgentID: agt.ID,
+			LogSourceID:      uuid.New(),
+			Archive:          []byte{1},
+			CreatedAt:        dbtime.Now(),
+		}
+		err := db.InsertWorkspaceAgentScriptArtifact(context.Background(), params)
+		require.NoError(s.T(), err)
+		check.Args(params.ID).Asserts(ws, rbac.ActionRead).Returns(database.WorkspaceAgentScriptArtifact(params))
+	}))
 	s.Run("UpdateWorkspaceAgentMetadata", s.Subtest(func(db database.Store, check *expects) {
 		tpl := dbgen.Template(s.T(), db, database.Template{})
 		ws := dbgen.Workspace(s.T(), db, database.Workspace{
@@ -1329,6 +1553,15 @@ func (s *MethodTestSuite) TestWorkspace() {
 		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID})
 		check.Args(build.JobID).Asserts(ws, rbac.ActionRead).Returns(build)
 	}))
+	s.Run("GetUnfinishedWorkspaceRefreshJobByBuildID", s.Subtest(func(db database.Store, check *expects) {
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID})
+		job := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{
+			Type:  database.ProvisionerJobTypeWorkspaceRefresh,
+			Input: []byte(`{"workspace_build_id":"` + build.ID.String() + `"}`),
+		})
+		check.Args(build.ID).Asserts(ws, rbac.ActionRead).Returns(job)
+	}))
 	s.Run("GetWorkspaceBuildByWorkspaceIDAndBuildNumber", s.Subtest(func(db database.Store, check *expects) {
 		ws := dbgen.Workspace(s.T(), db, database.Workspace{})
 		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, BuildNumber: 10})
@@ -1343,6 +1576,44 @@ func (s *MethodTestSuite) TestWorkspace() {
 		check.Args(build.ID).Asserts(ws, rbac.ActionRead).
 			Returns([]database.WorkspaceBuildParameter{})
 	}))
+	s.Run("GetWorkspaceBuildCapacityFallbackByBuildID", s.Subtest(func(db database.Store, check *expects) {
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID})
+		err := db.InsertWorkspaceBuildCapacityFallback(context.Background(), database.InsertWorkspaceBuildCapacityFallbackParams{
+			WorkspaceBuildID: build.ID,
+			Selected:         "on-demand",
+			Attempts:         json.RawMessage("[]"),
+		})
+		require.NoError(s.T(), err)
+		check.Args(build.ID).Asserts(ws, rbac.ActionRead).
+			Returns(database.WorkspaceBuildCapacityFallback{
+				WorkspaceBuildID: build.ID,
+				Selected:         "on-demand",
+				Attempts:         json.RawMessage("[]"),
+			})
+	}))
+	s.Run("GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID", s.Subtest(func(db database.Store, check *expects) {
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID})
+		err := db.InsertWorkspaceBuildCapacityFallback(context.Background(), database.InsertWorkspaceBuildCapacityFallbackParams{
+			WorkspaceBuildID: build.ID,
+			Selected:         "spot",
+			Attempts:         json.RawMessage("[]"),
+		})
+		require.NoError(s.T(), err)
+		check.Args(ws.ID).Asserts(ws, rbac.ActionRead).
+			Returns(database.WorkspaceBuildCapacityFallback{
+				WorkspaceBuildID: build.ID,
+				Selected:         "spot",
+				Attempts:         json.RawMessage("[]"),
+			})
+	}))
+	s.Run("GetWorkspaceBuildMetadataByBuildID", s.Subtest(func(db database.Store, check *expects) {
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID})
+		check.Args(build.ID).Asserts(ws, rbac.ActionRead).
+			Returns([]database.WorkspaceBuildMetadatum{})
+	}))
 	s.Run("GetWorkspaceBuildsByWorkspaceID", s.Subtest(func(db database.Store, check *expects) {
 		ws := dbgen.Workspace(s.T(), db, database.Workspace{})
 		_ = dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, BuildNumber: 1})
@@ -1487,6 +1758,7 @@ func (s *MethodTestSuite) TestWorkspace() {
 			WorkspaceBuildID: b.ID,
 			Name:             []string{"foo", "bar"},
 			Value:            []string{"baz", "qux"},
+			Source:           []string{"user_input", "template_default"},
 		}).Asserts(w, rbac.ActionUpdate)
 	}))
 	s.Run("UpdateWorkspace", s.Subtest(func(db database.Store, check *expects) {
@@ -2021,11 +2293,35 @@ func (s *MethodTestSuite) TestSystemFunctions() {
 			SharingLevel: database.AppSharingLevelOwner,
 		}).Asserts(rbac.ResourceSystem, rbac.ActionCreate)
 	}))
+	s.Run("InsertWorkspaceBuildCapacityFallback", s.Subtest(func(db database.Store, check *expects) {
+		check.Args(database.InsertWorkspaceBuildCapacityFallbackParams{
+			WorkspaceBuildID: uuid.New(),
+			Attempts:         json.RawMessage("[]"),
+		}).Asserts(rbac.ResourceSystem, rbac.ActionCreate)
+	}))
+	s.Run("InsertWorkspaceBuildMetadata", s.Subtest(func(db database.Store, check *expects) {
+		check.Args(database.InsertWorkspaceBuildMetadataParams{
+			WorkspaceBuildID: uuid.New(),
+		}).Asserts(rbac.ResourceSystem, rbac.ActionCreate)
+	}))
 	s.Run("InsertWorkspaceResourceMetadata", s.Subtest(func(db database.Store, check *expects) {
 		check.Args(database.InsertWorkspaceResourceMetadataParams{
 			WorkspaceResourceID: uuid.New(),
 		}).Asserts(rbac.ResourceSystem, rbac.ActionCreate)
 	}))
+	s.Run("DeleteWorkspaceResourceMetadataByResourceID", s.Subtest(func(db database.Store, check *expects) {
+		check.Args(uuid.New()).Asserts(rbac.ResourceSystem, rbac.ActionDelete)
+	}))
+	s.Run("UpdateWorkspaceAgentResourceIDByID", s.Subtest(func(db database.Store, check *expects) {
+		ws := dbgen.Workspace(s.T(), db, database.Workspace{})
+		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, JobID: uuid.New()})
+		res := dbgen.WorkspaceResource(s.T(), db, database.WorkspaceResource{JobID: build.JobID})
+		agt := dbgen.WorkspaceAgent(s.T(), db, database.WorkspaceAgent{ResourceID: res.ID})
+		check.Args(database.UpdateWorkspaceAgentResourceIDByIDParams{
+			ID:         agt.ID,
+			ResourceID: res.ID,
+		}).Asserts(rbac.ResourceSystem, rbac.ActionUpdate).Returns()
+	}))
 	s.Run("UpdateWorkspaceAgentConnectionByID", s.Subtest(func(db database.Store, check *expects) {
 		ws := dbgen.Workspace(s.T(), db, database.Workspace{})
 		build := dbgen.WorkspaceBuild(s.T(), db, database.WorkspaceBuild{WorkspaceID: ws.ID, JobID: uuid.New()})
@@ -2058,6 +2354,80 @@ func (s *MethodTestSuite) TestSystemFunctions() {
 			UpdatedAt: time.Now(),
 		}).Asserts( /*rbac.ResourceSystem, rbac.ActionUpdate*/ )
 	}))
+	s.Run("UpdateProvisionerJobWithRequeueByID", s.Subtest(func(db database.Store, check *expects) {
+		j := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{})
+		check.Args(database.UpdateProvisionerJobWithRequeueByIDParams{
+			ID:        j.ID,
+			UpdatedAt: time.Now(),
+		}).Asserts(rbac.ResourceSystem, rbac.ActionUpdate)
+	}))
+	s.Run("UpsertProvisionerJobCheckpoint", s.Subtest(func(db database.Store, check *expects) {
+		j := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{})
+		check.Args(database.UpsertProvisionerJobCheckpointParams{
+			JobID:      j.ID,
+			Stage:      "init",
+			Checkpoint: []byte{},
+			CreatedAt:  time.Now(),
+		}).Asserts(rbac.ResourceSystem, rbac.ActionUpdate)
+	}))
+	s.Run("GetProvisionerJobCheckpointByJobID", s.Subtest(func(db database.Store, check *expects) {
+		j := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{})
+		err := db.UpsertProvisionerJobCheckpoint(context.Background(), database.UpsertProvisionerJobCheckpointParams{
+			JobID:      j.ID,
+			Stage:      "init",
+			Checkpoint: []byte{},
+			CreatedAt:  time.Now(),
+		})
+		s.NoError(err, "upsert provisioner job checkpoint")
+		check.Args(j.ID).Asserts(rbac.ResourceSystem, rbac.ActionRead)
+	}))
+	s.Run("InsertProvisionerJobDiagnosticBundle", s.Subtest(func(db database.Store, check *expects) {
+		j := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{})
+		check.Args(database.InsertProvisionerJobDiagnosticBundleParams{
+			JobID:     j.ID,
+			Bundle:    []byte{},
+			CreatedAt: time.Now(),
+		}).Asserts(rbac.ResourceSystem, rbac.ActionCreate)
+	}))
+	s.Run("GetProvisionerJobDiagnosticBundleByJobID", s.Subtest(func(db database.Store, check *expects) {
+		j := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{})
+		err := db.InsertProvisionerJobDiagnosticBundle(context.Background(), database.InsertProvisionerJobDiagnosticBundleParams{
+			JobID:     j.ID,
+			Bundle:    []byte{},
+			CreatedAt: time.Now(),
+		})
+		s.NoError(err, "insert provisioner job diagnostic bundle")
+		check.Args(j.ID).Asserts(rbac.ResourceSystem, rbac.ActionRead)
+	}))
+	s.Run("InsertProvisionerJobWorkDirectory", s.Subtest(func(db database.Store, check *expects) {
+		j := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{})
+		check.Args(database.InsertProvisionerJobWorkDirectoryParams{
+			JobID:     j.ID,
+			Listing:   []byte{},
+			CreatedAt: time.Now(),
+		}).Asserts(rbac.ResourceSystem, rbac.ActionCreate)
+	}))
+	s.Run("GetProvisionerJobWorkDirectoryByJobID", s.Subtest(func(db database.Store, check *expects) {
+		j := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{})
+		err := db.InsertProvisionerJobWorkDirectory(context.Background(), database.InsertProvisionerJobWorkDirectoryParams{
+			JobID:     j.ID,
+			Listing:   []byte{},
+			CreatedAt: time.Now(),
+		})
+		s.NoError(err, "insert provisioner job work directory")
+		check.Args(j.ID).Asserts(rbac.ResourceSystem, rbac.ActionRead)
+	}))
+	s.Run("UpdateProvisionerJobCheckpointResumedByJobID", s.Subtest(func(db database.Store, check *expects) {
+		j := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{})
+		check.Args(database.UpdateProvisionerJobCheckpointResumedByJobIDParams{
+			JobID:     j.ID,
+			UpdatedAt: time.Now(),
+		}).Asserts(rbac.ResourceSystem, rbac.ActionUpdate)
+	}))
+	s.Run("DeleteProvisionerJobCheckpointByJobID", s.Subtest(func(db database.Store, check *expects) {
+		j := dbgen.ProvisionerJob(s.T(), db, nil, database.ProvisionerJob{})
+		check.Args(j.ID).Asserts(rbac.ResourceSystem, rbac.ActionDelete)
+	}))
 	s.Run("InsertProvisionerJob", s.Subtest(func(db database.Store, check *expects) {
 		// TODO: we need to create a ProvisionerJob resource
 		check.Args(database.InsertProvisionerJobParams{
@@ -2104,6 +2474,12 @@ func (s *MethodTestSuite) TestSystemFunctions() {
 	s.Run("DeleteOldWorkspaceAgentLogs", s.Subtest(func(db database.Store, check *expects) {
 		check.Args().Asserts(rbac.ResourceSystem, rbac.ActionDelete)
 	}))
+	s.Run("DeleteOldWorkspaceAgentUploads", s.Subtest(func(db database.Store, check *expects) {
+		check.Args().Asserts(rbac.ResourceSystem, rbac.ActionDelete)
+	}))
+	s.Run("DeleteOldWorkspaceAgentScriptArtifacts", s.Subtest(func(db database.Store, check *expects) {
+		check.Args().Asserts(rbac.ResourceSystem, rbac.ActionDelete)
+	}))
 	s.Run("InsertWorkspaceAgentStats", s.Subtest(func(db database.Store, check *expects) {
 		check.Args(database.InsertWorkspaceAgentStatsParams{}).Asserts(rbac.ResourceSystem, rbac.ActionCreate).Errors(errMatchAny)
 	}))
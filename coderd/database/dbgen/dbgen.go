@@ -162,6 +162,7 @@ func WorkspaceAgent(t testing.TB, db database.Store, orig database.WorkspaceAgen
 		},
 		ConnectionTimeoutSeconds: takeFirst(orig.ConnectionTimeoutSeconds, 3600),
 		TroubleshootingURL:       takeFirst(orig.TroubleshootingURL, "https://example.com"),
+		TroubleshootingURLs:      takeFirstSlice(orig.TroubleshootingURLs, []byte("{}")),
 		MOTDFile:                 takeFirst(orig.TroubleshootingURL, ""),
 		DisplayApps:              append([]database.DisplayApp{}, orig.DisplayApps...),
 	})
@@ -242,13 +243,15 @@ func WorkspaceBuildParameters(t testing.TB, db database.Store, orig []database.W
 	}
 
 	var (
-		names  = make([]string, 0, len(orig))
-		values = make([]string, 0, len(orig))
-		params []database.WorkspaceBuildParameter
+		names   = make([]string, 0, len(orig))
+		values  = make([]string, 0, len(orig))
+		sources = make([]string, 0, len(orig))
+		params  []database.WorkspaceBuildParameter
 	)
 	for _, param := range orig {
 		names = append(names, param.Name)
 		values = append(values, param.Value)
+		sources = append(sources, param.Source)
 	}
 	err := db.InTx(func(tx database.Store) error {
 		id := takeFirst(orig[0].WorkspaceBuildID, uuid.New())
@@ -256,6 +259,7 @@ func WorkspaceBuildParameters(t testing.TB, db database.Store, orig []database.W
 			WorkspaceBuildID: id,
 			Name:             names,
 			Value:            values,
+			Source:           sources,
 		})
 		if err != nil {
 			return err
@@ -486,6 +490,8 @@ func WorkspaceResource(t testing.TB, db database.Store, orig database.WorkspaceR
 			Valid:  takeFirst(orig.InstanceType.Valid, false),
 		},
 		DailyCost: takeFirst(orig.DailyCost, 0),
+		Action:    orig.Action,
+		Address:   orig.Address,
 	})
 	require.NoError(t, err, "insert resource")
 	return resource
@@ -497,6 +503,8 @@ func WorkspaceResourceMetadatums(t testing.TB, db database.Store, seed database.
 		Key:                 []string{takeFirst(seed.Key, namesgenerator.GetRandomName(1))},
 		Value:               []string{takeFirst(seed.Value.String, namesgenerator.GetRandomName(1))},
 		Sensitive:           []bool{takeFirst(seed.Sensitive, false)},
+		DisplayOrder:        []int32{takeFirst(seed.DisplayOrder, 0)},
+		DisplayGroup:        []string{takeFirst(seed.DisplayGroup, "")},
 	})
 	require.NoError(t, err, "insert meta data")
 	return meta
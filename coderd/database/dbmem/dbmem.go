@@ -118,44 +118,54 @@ type data struct {
 	organizations       []database.Organization
 	organizationMembers []database.OrganizationMember
 	users               []database.User
+	userAuthorizedKeys  []database.UserAuthorizedKeys
 	userLinks           []database.UserLink
 
 	// New tables
-	workspaceAgentStats           []database.WorkspaceAgentStat
-	auditLogs                     []database.AuditLog
-	dbcryptKeys                   []database.DBCryptKey
-	files                         []database.File
-	externalAuthLinks             []database.ExternalAuthLink
-	gitSSHKey                     []database.GitSSHKey
-	groupMembers                  []database.GroupMember
-	groups                        []database.Group
-	jfrogXRayScans                []database.JfrogXrayScan
-	licenses                      []database.License
-	oauth2ProviderApps            []database.OAuth2ProviderApp
-	oauth2ProviderAppSecrets      []database.OAuth2ProviderAppSecret
-	parameterSchemas              []database.ParameterSchema
-	provisionerDaemons            []database.ProvisionerDaemon
-	provisionerJobLogs            []database.ProvisionerJobLog
-	provisionerJobs               []database.ProvisionerJob
-	replicas                      []database.Replica
-	templateVersions              []database.TemplateVersionTable
-	templateVersionParameters     []database.TemplateVersionParameter
-	templateVersionVariables      []database.TemplateVersionVariable
-	templates                     []database.TemplateTable
-	workspaceAgents               []database.WorkspaceAgent
-	workspaceAgentMetadata        []database.WorkspaceAgentMetadatum
-	workspaceAgentLogs            []database.WorkspaceAgentLog
-	workspaceAgentLogSources      []database.WorkspaceAgentLogSource
-	workspaceAgentScripts         []database.WorkspaceAgentScript
-	workspaceApps                 []database.WorkspaceApp
-	workspaceAppStatsLastInsertID int64
-	workspaceAppStats             []database.WorkspaceAppStat
-	workspaceBuilds               []database.WorkspaceBuildTable
-	workspaceBuildParameters      []database.WorkspaceBuildParameter
-	workspaceResourceMetadata     []database.WorkspaceResourceMetadatum
-	workspaceResources            []database.WorkspaceResource
-	workspaces                    []database.Workspace
-	workspaceProxies              []database.WorkspaceProxy
+	workspaceAgentStats             []database.WorkspaceAgentStat
+	auditLogs                       []database.AuditLog
+	dbcryptKeys                     []database.DBCryptKey
+	files                           []database.File
+	externalAuthLinks               []database.ExternalAuthLink
+	gitSSHKey                       []database.GitSSHKey
+	groupMembers                    []database.GroupMember
+	groups                          []database.Group
+	jfrogXRayScans                  []database.JfrogXrayScan
+	licenses                        []database.License
+	oauth2ProviderApps              []database.OAuth2ProviderApp
+	oauth2ProviderAppSecrets        []database.OAuth2ProviderAppSecret
+	parameterSchemas                []database.ParameterSchema
+	provisionerDaemons              []database.ProvisionerDaemon
+	provisionerJobCheckpoints       []database.ProvisionerJobCheckpoint
+	provisionerJobDiagnosticBundles []database.ProvisionerJobDiagnosticBundle
+	provisionerJobLogs              []database.ProvisionerJobLog
+	provisionerJobs                 []database.ProvisionerJob
+	provisionerJobWorkDirectories   []database.ProvisionerJobWorkDirectory
+	replicas                        []database.Replica
+	templateVersions                []database.TemplateVersionTable
+	templateVersionMetadata         []database.TemplateVersionMetadatum
+	templateVersionParameters       []database.TemplateVersionParameter
+	templateVersionVariables        []database.TemplateVersionVariable
+	templates                       []database.TemplateTable
+	workspaceAgents                 []database.WorkspaceAgent
+	workspaceAgentMetadata          []database.WorkspaceAgentMetadatum
+	workspaceAgentLogs              []database.WorkspaceAgentLog
+	workspaceAgentLogSources        []database.WorkspaceAgentLogSource
+	workspaceAgentScriptArtifacts   []database.WorkspaceAgentScriptArtifact
+	workspaceAgentScripts           []database.WorkspaceAgentScript
+	workspaceAgentUploads           []database.WorkspaceAgentUpload
+	workspaceAgentUploadChunks      []database.WorkspaceAgentUploadChunk
+	workspaceApps                   []database.WorkspaceApp
+	workspaceAppStatsLastInsertID   int64
+	workspaceAppStats               []database.WorkspaceAppStat
+	workspaceBuilds                 []database.WorkspaceBuildTable
+	workspaceBuildCapacityFallbacks []database.WorkspaceBuildCapacityFallback
+	workspaceBuildMetadata          []database.WorkspaceBuildMetadatum
+	workspaceBuildParameters        []database.WorkspaceBuildParameter
+	workspaceResourceMetadata       []database.WorkspaceResourceMetadatum
+	workspaceResources              []database.WorkspaceResource
+	workspaces                      []database.Workspace
+	workspaceProxies                []database.WorkspaceProxy
 	// Locks is a map of lock names. Any keys within the map are currently
 	// locked.
 	locks                   map[int64]struct{}
@@ -440,6 +450,14 @@ func (q *FakeQuerier) getWorkspaceByAgentIDNoLock(_ context.Context, agentID uui
 	return database.Workspace{}, sql.ErrNoRows
 }
 
+// deleteWorkspaceAgentUploadChunksNoLock deletes the chunks of the upload,
+// like the foreign key cascading the deletion of the upload.
+func (q *FakeQuerier) deleteWorkspaceAgentUploadChunksNoLock(agentID uuid.UUID, name, checksum string) {
+	q.workspaceAgentUploadChunks = slices.DeleteFunc(q.workspaceAgentUploadChunks, func(chunk database.WorkspaceAgentUploadChunk) bool {
+		return chunk.WorkspaceAgentID == agentID && chunk.Name == name && chunk.Checksum == checksum
+	})
+}
+
 func (q *FakeQuerier) getWorkspaceBuildByIDNoLock(_ context.Context, id uuid.UUID) (database.WorkspaceBuild, error) {
 	for _, build := range q.workspaceBuilds {
 		if build.ID == id {
@@ -889,6 +907,38 @@ func (q *FakeQuerier) AllUserIDs(_ context.Context) ([]uuid.UUID, error) {
 	return userIDs, nil
 }
 
+func (q *FakeQuerier) AppendWorkspaceAgentUploadChunk(_ context.Context, arg database.AppendWorkspaceAgentUploadChunkParams) (int64, error) {
+	if err := validateDatabaseType(arg); err != nil {
+		return 0, err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, upload := range q.workspaceAgentUploads {
+		if upload.WorkspaceAgentID != arg.WorkspaceAgentID || upload.Name != arg.Name || upload.Checksum != arg.Checksum {
+			continue
+		}
+		if upload.Received != arg.Offset {
+			return 0, sql.ErrNoRows
+		}
+		if len(arg.Chunk) > 0 {
+			q.workspaceAgentUploadChunks = append(q.workspaceAgentUploadChunks, database.WorkspaceAgentUploadChunk{
+				WorkspaceAgentID: arg.WorkspaceAgentID,
+				Name:             arg.Name,
+				Checksum:         arg.Checksum,
+				ChunkOffset:      arg.Offset,
+				Data:             slices.Clone(arg.Chunk),
+			})
+		}
+		upload.Received += int64(len(arg.Chunk))
+		upload.UpdatedAt = arg.UpdatedAt
+		q.workspaceAgentUploads[i] = upload
+		return upload.Received, nil
+	}
+	return 0, sql.ErrNoRows
+}
+
 func (q *FakeQuerier) ArchiveUnusedTemplateVersions(_ context.Context, arg database.ArchiveUnusedTemplateVersionsParams) ([]uuid.UUID, error) {
 	err := validateDatabaseType(arg)
 	if err != nil {
@@ -1255,6 +1305,23 @@ func (q *FakeQuerier) DeleteOldWorkspaceAgentLogs(_ context.Context) error {
 	return nil
 }
 
+func (q *FakeQuerier) DeleteOldWorkspaceAgentScriptArtifacts(_ context.Context) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	weekAgo := dbtime.Now().Add(-7 * 24 * time.Hour)
+
+	var validArtifacts []database.WorkspaceAgentScriptArtifact
+	for _, artifact := range q.workspaceAgentScriptArtifacts {
+		if artifact.CreatedAt.Before(weekAgo) {
+			continue
+		}
+		validArtifacts = append(validArtifacts, artifact)
+	}
+	q.workspaceAgentScriptArtifacts = validArtifacts
+	return nil
+}
+
 func (q *FakeQuerier) DeleteOldWorkspaceAgentStats(_ context.Context) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
@@ -1274,6 +1341,37 @@ func (q *FakeQuerier) DeleteOldWorkspaceAgentStats(_ context.Context) error {
 	return nil
 }
 
+func (q *FakeQuerier) DeleteOldWorkspaceAgentUploads(_ context.Context) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	dayAgo := dbtime.Now().Add(-24 * time.Hour)
+
+	var validUploads []database.WorkspaceAgentUpload
+	for _, upload := range q.workspaceAgentUploads {
+		if upload.UpdatedAt.Before(dayAgo) {
+			q.deleteWorkspaceAgentUploadChunksNoLock(upload.WorkspaceAgentID, upload.Name, upload.Checksum)
+			continue
+		}
+		validUploads = append(validUploads, upload)
+	}
+	q.workspaceAgentUploads = validUploads
+	return nil
+}
+
+func (q *FakeQuerier) DeleteProvisionerJobCheckpointByJobID(_ context.Context, jobID uuid.UUID) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, checkpoint := range q.provisionerJobCheckpoints {
+		if checkpoint.JobID == jobID {
+			q.provisionerJobCheckpoints = append(q.provisionerJobCheckpoints[:i], q.provisionerJobCheckpoints[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
 func (q *FakeQuerier) DeleteReplicasUpdatedBefore(_ context.Context, before time.Time) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
@@ -1317,6 +1415,38 @@ func (*FakeQuerier) DeleteTailnetTunnel(_ context.Context, arg database.DeleteTa
 	return database.DeleteTailnetTunnelRow{}, ErrUnimplemented
 }
 
+func (q *FakeQuerier) DeleteWorkspaceAgentUpload(_ context.Context, arg database.DeleteWorkspaceAgentUploadParams) error {
+	if err := validateDatabaseType(arg); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, upload := range q.workspaceAgentUploads {
+		if upload.WorkspaceAgentID == arg.WorkspaceAgentID && upload.Name == arg.Name && upload.Checksum == arg.Checksum {
+			q.workspaceAgentUploads = append(q.workspaceAgentUploads[:i], q.workspaceAgentUploads[i+1:]...)
+			q.deleteWorkspaceAgentUploadChunksNoLock(arg.WorkspaceAgentID, arg.Name, arg.Checksum)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (q *FakeQuerier) DeleteWorkspaceResourceMetadataByResourceID(_ context.Context, workspaceResourceID uuid.UUID) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	metadata := q.workspaceResourceMetadata[:0]
+	for _, metadatum := range q.workspaceResourceMetadata {
+		if metadatum.WorkspaceResourceID != workspaceResourceID {
+			metadata = append(metadata, metadatum)
+		}
+	}
+	q.workspaceResourceMetadata = metadata
+	return nil
+}
+
 func (q *FakeQuerier) FavoriteWorkspace(_ context.Context, arg uuid.UUID) error {
 	err := validateDatabaseType(arg)
 	if err != nil {
@@ -1945,6 +2075,31 @@ func (q *FakeQuerier) GetGroupMembers(_ context.Context, id uuid.UUID) ([]databa
 	return users, nil
 }
 
+func (q *FakeQuerier) GetGroupsByOrganizationAndUserID(_ context.Context, arg database.GetGroupsByOrganizationAndUserIDParams) ([]database.Group, error) {
+	err := validateDatabaseType(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	groupIDs := make(map[uuid.UUID]struct{})
+	for _, member := range q.groupMembers {
+		if member.UserID == arg.UserID {
+			groupIDs[member.GroupID] = struct{}{}
+		}
+	}
+	groups := []database.Group{}
+	for _, group := range q.groups {
+		if _, ok := groupIDs[group.ID]; ok && group.OrganizationID == arg.OrganizationID {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups, nil
+}
+
 func (q *FakeQuerier) GetGroupsByOrganizationID(_ context.Context, id uuid.UUID) ([]database.Group, error) {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
@@ -2022,6 +2177,31 @@ func (q *FakeQuerier) GetLatestWorkspaceBuildByWorkspaceID(ctx context.Context,
 	return q.getLatestWorkspaceBuildByWorkspaceIDNoLock(ctx, workspaceID)
 }
 
+func (q *FakeQuerier) GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID(_ context.Context, workspaceID uuid.UUID) (database.WorkspaceBuildCapacityFallback, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	var (
+		latest      database.WorkspaceBuildCapacityFallback
+		buildNumber int32
+	)
+	for _, fallback := range q.workspaceBuildCapacityFallbacks {
+		for _, build := range q.workspaceBuilds {
+			if build.ID != fallback.WorkspaceBuildID || build.WorkspaceID != workspaceID {
+				continue
+			}
+			if build.BuildNumber > buildNumber {
+				latest = fallback
+				buildNumber = build.BuildNumber
+			}
+		}
+	}
+	if buildNumber == 0 {
+		return database.WorkspaceBuildCapacityFallback{}, sql.ErrNoRows
+	}
+	return latest, nil
+}
+
 func (q *FakeQuerier) GetLatestWorkspaceBuilds(_ context.Context) ([]database.WorkspaceBuild, error) {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
@@ -2386,6 +2566,45 @@ func (q *FakeQuerier) GetProvisionerJobByID(ctx context.Context, id uuid.UUID) (
 	return q.getProvisionerJobByIDNoLock(ctx, id)
 }
 
+func (q *FakeQuerier) GetProvisionerJobCheckpointByJobID(_ context.Context, jobID uuid.UUID) (database.ProvisionerJobCheckpoint, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	for _, checkpoint := range q.provisionerJobCheckpoints {
+		if checkpoint.JobID == jobID {
+			checkpoint.Checkpoint = slices.Clone(checkpoint.Checkpoint)
+			return checkpoint, nil
+		}
+	}
+	return database.ProvisionerJobCheckpoint{}, sql.ErrNoRows
+}
+
+func (q *FakeQuerier) GetProvisionerJobDiagnosticBundleByJobID(_ context.Context, jobID uuid.UUID) (database.ProvisionerJobDiagnosticBundle, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	for _, bundle := range q.provisionerJobDiagnosticBundles {
+		if bundle.JobID == jobID {
+			bundle.Bundle = slices.Clone(bundle.Bundle)
+			return bundle, nil
+		}
+	}
+	return database.ProvisionerJobDiagnosticBundle{}, sql.ErrNoRows
+}
+
+func (q *FakeQuerier) GetProvisionerJobWorkDirectoryByJobID(_ context.Context, jobID uuid.UUID) (database.ProvisionerJobWorkDirectory, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	for _, workDirectory := range q.provisionerJobWorkDirectories {
+		if workDirectory.JobID == jobID {
+			workDirectory.Listing = slices.Clone(workDirectory.Listing)
+			return workDirectory, nil
+		}
+	}
+	return database.ProvisionerJobWorkDirectory{}, sql.ErrNoRows
+}
+
 func (q *FakeQuerier) GetProvisionerJobsByIDs(_ context.Context, ids []uuid.UUID) ([]database.ProvisionerJob, error) {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
@@ -3339,6 +3558,18 @@ func (q *FakeQuerier) GetTemplateVersionByTemplateIDAndName(_ context.Context, a
 	return database.TemplateVersion{}, sql.ErrNoRows
 }
 
+func (q *FakeQuerier) GetTemplateVersionMetadataByTemplateVersionID(_ context.Context, templateVersionID uuid.UUID) (database.TemplateVersionMetadatum, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	for _, metadata := range q.templateVersionMetadata {
+		if metadata.TemplateVersionID == templateVersionID {
+			return metadata, nil
+		}
+	}
+	return database.TemplateVersionMetadatum{}, sql.ErrNoRows
+}
+
 func (q *FakeQuerier) GetTemplateVersionParameters(_ context.Context, templateVersionID uuid.UUID) ([]database.TemplateVersionParameter, error) {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
@@ -3513,6 +3744,36 @@ func (q *FakeQuerier) GetUnexpiredLicenses(_ context.Context) ([]database.Licens
 	return results, nil
 }
 
+func (q *FakeQuerier) GetUnfinishedWorkspaceRefreshJobByBuildID(_ context.Context, workspaceBuildID uuid.UUID) (database.ProvisionerJob, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	var latest database.ProvisionerJob
+	for _, provisionerJob := range q.provisionerJobs {
+		if provisionerJob.Type != database.ProvisionerJobTypeWorkspaceRefresh ||
+			provisionerJob.CompletedAt.Valid || provisionerJob.CanceledAt.Valid {
+			continue
+		}
+		var input struct {
+			WorkspaceBuildID uuid.UUID `json:"workspace_build_id"`
+		}
+		if err := json.Unmarshal(provisionerJob.Input, &input); err != nil {
+			return database.ProvisionerJob{}, err
+		}
+		if input.WorkspaceBuildID != workspaceBuildID {
+			continue
+		}
+		if latest.ID == uuid.Nil || provisionerJob.CreatedAt.After(latest.CreatedAt) {
+			latest = provisionerJob
+		}
+	}
+	if latest.ID == uuid.Nil {
+		return database.ProvisionerJob{}, sql.ErrNoRows
+	}
+	latest.Tags = maps.Clone(latest.Tags)
+	return latest, nil
+}
+
 func (q *FakeQuerier) GetUserActivityInsights(ctx context.Context, arg database.GetUserActivityInsightsParams) ([]database.GetUserActivityInsightsRow, error) {
 	err := validateDatabaseType(arg)
 	if err != nil {
@@ -3649,6 +3910,18 @@ func (q *FakeQuerier) GetUserActivityInsights(ctx context.Context, arg database.
 	return rows, nil
 }
 
+func (q *FakeQuerier) GetUserAuthorizedKeys(_ context.Context, userID uuid.UUID) (database.UserAuthorizedKeys, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	for _, keys := range q.userAuthorizedKeys {
+		if keys.UserID == userID {
+			return keys, nil
+		}
+	}
+	return database.UserAuthorizedKeys{}, sql.ErrNoRows
+}
+
 func (q *FakeQuerier) GetUserByEmailOrUsername(_ context.Context, arg database.GetUserByEmailOrUsernameParams) (database.User, error) {
 	if err := validateDatabaseType(arg); err != nil {
 		return database.User{}, err
@@ -4129,7 +4402,16 @@ func (q *FakeQuerier) GetWorkspaceAgentLogsAfter(_ context.Context, arg database
 		if arg.CreatedAfter != 0 && log.ID <= arg.CreatedAfter {
 			continue
 		}
+		if len(arg.Levels) > 0 && !slices.Contains(arg.Levels, log.Level) {
+			continue
+		}
+		if len(arg.LogSourceIDs) > 0 && !slices.Contains(arg.LogSourceIDs, log.LogSourceID) {
+			continue
+		}
 		logs = append(logs, log)
+		if arg.LimitOpt > 0 && len(logs) >= int(arg.LimitOpt) {
+			break
+		}
 	}
 	return logs, nil
 }
@@ -4154,6 +4436,42 @@ func (q *FakeQuerier) GetWorkspaceAgentMetadata(_ context.Context, arg database.
 	return metadata, nil
 }
 
+func (q *FakeQuerier) GetWorkspaceAgentScriptArtifactByID(_ context.Context, id uuid.UUID) (database.WorkspaceAgentScriptArtifact, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	for _, artifact := range q.workspaceAgentScriptArtifacts {
+		if artifact.ID == id {
+			artifact.Archive = slices.Clone(artifact.Archive)
+			return artifact, nil
+		}
+	}
+	return database.WorkspaceAgentScriptArtifact{}, sql.ErrNoRows
+}
+
+func (q *FakeQuerier) GetWorkspaceAgentScriptArtifactsByAgentID(_ context.Context, workspaceAgentID uuid.UUID) ([]database.GetWorkspaceAgentScriptArtifactsByAgentIDRow, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	artifacts := make([]database.GetWorkspaceAgentScriptArtifactsByAgentIDRow, 0)
+	for _, artifact := range q.workspaceAgentScriptArtifacts {
+		if artifact.WorkspaceAgentID != workspaceAgentID {
+			continue
+		}
+		artifacts = append(artifacts, database.GetWorkspaceAgentScriptArtifactsByAgentIDRow{
+			ID:               artifact.ID,
+			WorkspaceAgentID: artifact.WorkspaceAgentID,
+			LogSourceID:      artifact.LogSourceID,
+			Size:             int64(len(artifact.Archive)),
+			CreatedAt:        artifact.CreatedAt,
+		})
+	}
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		return artifacts[i].CreatedAt.Before(artifacts[j].CreatedAt)
+	})
+	return artifacts, nil
+}
+
 func (q *FakeQuerier) GetWorkspaceAgentScriptsByAgentIDs(_ context.Context, ids []uuid.UUID) ([]database.WorkspaceAgentScript, error) {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
@@ -4318,6 +4636,46 @@ func (q *FakeQuerier) GetWorkspaceAgentStatsAndLabels(ctx context.Context, creat
 	return stats, nil
 }
 
+func (q *FakeQuerier) GetWorkspaceAgentUpload(_ context.Context, arg database.GetWorkspaceAgentUploadParams) (database.WorkspaceAgentUpload, error) {
+	if err := validateDatabaseType(arg); err != nil {
+		return database.WorkspaceAgentUpload{}, err
+	}
+
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	for _, upload := range q.workspaceAgentUploads {
+		if upload.WorkspaceAgentID == arg.WorkspaceAgentID && upload.Name == arg.Name && upload.Checksum == arg.Checksum {
+			return upload, nil
+		}
+	}
+	return database.WorkspaceAgentUpload{}, sql.ErrNoRows
+}
+
+func (q *FakeQuerier) GetWorkspaceAgentUploadData(_ context.Context, arg database.GetWorkspaceAgentUploadDataParams) ([]byte, error) {
+	if err := validateDatabaseType(arg); err != nil {
+		return nil, err
+	}
+
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	var chunks []database.WorkspaceAgentUploadChunk
+	for _, chunk := range q.workspaceAgentUploadChunks {
+		if chunk.WorkspaceAgentID == arg.WorkspaceAgentID && chunk.Name == arg.Name && chunk.Checksum == arg.Checksum {
+			chunks = append(chunks, chunk)
+		}
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].ChunkOffset < chunks[j].ChunkOffset
+	})
+	data := []byte{}
+	for _, chunk := range chunks {
+		data = append(data, chunk.Data...)
+	}
+	return data, nil
+}
+
 func (q *FakeQuerier) GetWorkspaceAgentsByResourceIDs(ctx context.Context, resourceIDs []uuid.UUID) ([]database.WorkspaceAgent, error) {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
@@ -4462,6 +4820,35 @@ func (q *FakeQuerier) GetWorkspaceBuildByWorkspaceIDAndBuildNumber(_ context.Con
 	return database.WorkspaceBuild{}, sql.ErrNoRows
 }
 
+func (q *FakeQuerier) GetWorkspaceBuildCapacityFallbackByBuildID(_ context.Context, workspaceBuildID uuid.UUID) (database.WorkspaceBuildCapacityFallback, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	for _, fallback := range q.workspaceBuildCapacityFallbacks {
+		if fallback.WorkspaceBuildID == workspaceBuildID {
+			return fallback, nil
+		}
+	}
+	return database.WorkspaceBuildCapacityFallback{}, sql.ErrNoRows
+}
+
+func (q *FakeQuerier) GetWorkspaceBuildMetadataByBuildID(_ context.Context, workspaceBuildID uuid.UUID) ([]database.WorkspaceBuildMetadatum, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	metadata := make([]database.WorkspaceBuildMetadatum, 0)
+	for _, m := range q.workspaceBuildMetadata {
+		if m.WorkspaceBuildID != workspaceBuildID {
+			continue
+		}
+		metadata = append(metadata, m)
+	}
+	sort.Slice(metadata, func(i, j int) bool {
+		return metadata[i].DisplayOrder < metadata[j].DisplayOrder
+	})
+	return metadata, nil
+}
+
 func (q *FakeQuerier) GetWorkspaceBuildParameters(_ context.Context, workspaceBuildID uuid.UUID) ([]database.WorkspaceBuildParameter, error) {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
@@ -4728,6 +5115,12 @@ func (q *FakeQuerier) GetWorkspaceResourceMetadataByResourceIDs(_ context.Contex
 			}
 		}
 	}
+	sort.SliceStable(metadata, func(i, j int) bool {
+		if metadata[i].DisplayOrder != metadata[j].DisplayOrder {
+			return metadata[i].DisplayOrder < metadata[j].DisplayOrder
+		}
+		return metadata[i].ID < metadata[j].ID
+	})
 	return metadata, nil
 }
 
@@ -5290,6 +5683,28 @@ func (q *FakeQuerier) InsertProvisionerJob(_ context.Context, arg database.Inser
 	return job, nil
 }
 
+func (q *FakeQuerier) InsertProvisionerJobDiagnosticBundle(_ context.Context, arg database.InsertProvisionerJobDiagnosticBundleParams) error {
+	err := validateDatabaseType(arg)
+	if err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, bundle := range q.provisionerJobDiagnosticBundles {
+		if bundle.JobID == arg.JobID {
+			return errDuplicateKey
+		}
+	}
+	q.provisionerJobDiagnosticBundles = append(q.provisionerJobDiagnosticBundles, database.ProvisionerJobDiagnosticBundle{
+		JobID:     arg.JobID,
+		Bundle:    slices.Clone(arg.Bundle),
+		CreatedAt: arg.CreatedAt,
+	})
+	return nil
+}
+
 func (q *FakeQuerier) InsertProvisionerJobLogs(_ context.Context, arg database.InsertProvisionerJobLogsParams) ([]database.ProvisionerJobLog, error) {
 	if err := validateDatabaseType(arg); err != nil {
 		return nil, err
@@ -5319,6 +5734,28 @@ func (q *FakeQuerier) InsertProvisionerJobLogs(_ context.Context, arg database.I
 	return logs, nil
 }
 
+func (q *FakeQuerier) InsertProvisionerJobWorkDirectory(_ context.Context, arg database.InsertProvisionerJobWorkDirectoryParams) error {
+	err := validateDatabaseType(arg)
+	if err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, workDirectory := range q.provisionerJobWorkDirectories {
+		if workDirectory.JobID == arg.JobID {
+			return errDuplicateKey
+		}
+	}
+	q.provisionerJobWorkDirectories = append(q.provisionerJobWorkDirectories, database.ProvisionerJobWorkDirectory{
+		JobID:     arg.JobID,
+		Listing:   slices.Clone(arg.Listing),
+		CreatedAt: arg.CreatedAt,
+	})
+	return nil
+}
+
 func (q *FakeQuerier) InsertReplica(_ context.Context, arg database.InsertReplicaParams) (database.Replica, error) {
 	if err := validateDatabaseType(arg); err != nil {
 		return database.Replica{}, err
@@ -5369,6 +5806,7 @@ func (q *FakeQuerier) InsertTemplate(_ context.Context, arg database.InsertTempl
 		AllowUserCancelWorkspaceJobs: arg.AllowUserCancelWorkspaceJobs,
 		AllowUserAutostart:           true,
 		AllowUserAutostop:            true,
+		MaxAppSharingLevel:           database.AppSharingLevelPublic,
 	}
 	q.templates = append(q.templates, template)
 	return nil
@@ -5597,10 +6035,14 @@ func (q *FakeQuerier) InsertWorkspaceAgent(_ context.Context, arg database.Inser
 		ResourceMetadata:         arg.ResourceMetadata,
 		ConnectionTimeoutSeconds: arg.ConnectionTimeoutSeconds,
 		TroubleshootingURL:       arg.TroubleshootingURL,
+		TroubleshootingURLs:      arg.TroubleshootingURLs,
 		MOTDFile:                 arg.MOTDFile,
 		LifecycleState:           database.WorkspaceAgentLifecycleStateCreated,
 		DisplayApps:              arg.DisplayApps,
 	}
+	if len(agent.TroubleshootingURLs) == 0 {
+		agent.TroubleshootingURLs = json.RawMessage("{}")
+	}
 
 	q.workspaceAgents = append(q.workspaceAgents, agent)
 	return agent, nil
@@ -5646,6 +6088,17 @@ func (q *FakeQuerier) InsertWorkspaceAgentLogs(_ context.Context, arg database.I
 	outputLength := int32(0)
 	for index, output := range arg.Output {
 		id++
+		fields := database.StringMap{}
+		if index < len(arg.Fields) {
+			err := json.Unmarshal([]byte(arg.Fields[index]), &fields)
+			if err != nil {
+				return nil, err
+			}
+		}
+		stream := ""
+		if index < len(arg.Stream) {
+			stream = arg.Stream[index]
+		}
 		logs = append(logs, database.WorkspaceAgentLog{
 			ID:          id,
 			AgentID:     arg.AgentID,
@@ -5653,6 +6106,8 @@ func (q *FakeQuerier) InsertWorkspaceAgentLogs(_ context.Context, arg database.I
 			Level:       arg.Level[index],
 			LogSourceID: arg.LogSourceID,
 			Output:      output,
+			Fields:      fields,
+			Stream:      stream,
 		})
 		outputLength += int32(len(output))
 	}
@@ -5688,12 +6143,31 @@ func (q *FakeQuerier) InsertWorkspaceAgentMetadata(_ context.Context, arg databa
 		Timeout:          arg.Timeout,
 		Interval:         arg.Interval,
 		DisplayOrder:     arg.DisplayOrder,
+		Collector:        arg.Collector,
 	}
 
 	q.workspaceAgentMetadata = append(q.workspaceAgentMetadata, metadatum)
 	return nil
 }
 
+func (q *FakeQuerier) InsertWorkspaceAgentScriptArtifact(_ context.Context, arg database.InsertWorkspaceAgentScriptArtifactParams) error {
+	if err := validateDatabaseType(arg); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.workspaceAgentScriptArtifacts = append(q.workspaceAgentScriptArtifacts, database.WorkspaceAgentScriptArtifact{
+		ID:               arg.ID,
+		WorkspaceAgentID: arg.WorkspaceAgentID,
+		LogSourceID:      arg.LogSourceID,
+		Archive:          slices.Clone(arg.Archive),
+		CreatedAt:        arg.CreatedAt,
+	})
+	return nil
+}
+
 func (q *FakeQuerier) InsertWorkspaceAgentScripts(_ context.Context, arg database.InsertWorkspaceAgentScriptsParams) ([]database.WorkspaceAgentScript, error) {
 	err := validateDatabaseType(arg)
 	if err != nil {
@@ -5706,16 +6180,22 @@ func (q *FakeQuerier) InsertWorkspaceAgentScripts(_ context.Context, arg databas
 	scripts := make([]database.WorkspaceAgentScript, 0)
 	for index, source := range arg.LogSourceID {
 		script := database.WorkspaceAgentScript{
-			LogSourceID:      source,
-			WorkspaceAgentID: arg.WorkspaceAgentID,
-			LogPath:          arg.LogPath[index],
-			Script:           arg.Script[index],
-			Cron:             arg.Cron[index],
-			StartBlocksLogin: arg.StartBlocksLogin[index],
-			RunOnStart:       arg.RunOnStart[index],
-			RunOnStop:        arg.RunOnStop[index],
-			TimeoutSeconds:   arg.TimeoutSeconds[index],
-			CreatedAt:        arg.CreatedAt,
+			LogSourceID:           source,
+			WorkspaceAgentID:      arg.WorkspaceAgentID,
+			LogPath:               arg.LogPath[index],
+			Script:                arg.Script[index],
+			Cron:                  arg.Cron[index],
+			StartBlocksLogin:      arg.StartBlocksLogin[index],
+			RunOnStart:            arg.RunOnStart[index],
+			RunOnStop:             arg.RunOnStop[index],
+			RunOnBuildSuccess:     arg.RunOnBuildSuccess[index],
+			RunOnBuildFailure:     arg.RunOnBuildFailure[index],
+			RunOnPostStart:        arg.RunOnPostStart[index],
+			Login:                 arg.Login[index],
+			DiskPressurePath:      arg.DiskPressurePath[index],
+			DiskPressureThreshold: arg.DiskPressureThreshold[index],
+			TimeoutSeconds:        arg.TimeoutSeconds[index],
+			CreatedAt:             arg.CreatedAt,
 		}
 		scripts = append(scripts, script)
 	}
@@ -5797,6 +6277,38 @@ func (q *FakeQuerier) InsertWorkspaceAgentStats(_ context.Context, arg database.
 	return nil
 }
 
+func (q *FakeQuerier) InsertWorkspaceAgentUpload(_ context.Context, arg database.InsertWorkspaceAgentUploadParams) (int64, error) {
+	if err := validateDatabaseType(arg); err != nil {
+		return 0, err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var uploads int64
+	for _, upload := range q.workspaceAgentUploads {
+		if upload.WorkspaceAgentID != arg.WorkspaceAgentID {
+			continue
+		}
+		if upload.Name == arg.Name && upload.Checksum == arg.Checksum {
+			return 0, nil
+		}
+		uploads++
+	}
+	if uploads >= arg.MaxUploads {
+		return 0, nil
+	}
+	q.workspaceAgentUploads = append(q.workspaceAgentUploads, database.WorkspaceAgentUpload{
+		WorkspaceAgentID: arg.WorkspaceAgentID,
+		Name:             arg.Name,
+		Checksum:         arg.Checksum,
+		Size:             arg.Size,
+		CreatedAt:        arg.CreatedAt,
+		UpdatedAt:        arg.CreatedAt,
+	})
+	return 1, nil
+}
+
 func (q *FakeQuerier) InsertWorkspaceApp(_ context.Context, arg database.InsertWorkspaceAppParams) (database.WorkspaceApp, error) {
 	if err := validateDatabaseType(arg); err != nil {
 		return database.WorkspaceApp{}, err
@@ -5897,6 +6409,52 @@ func (q *FakeQuerier) InsertWorkspaceBuild(_ context.Context, arg database.Inser
 	return nil
 }
 
+func (q *FakeQuerier) InsertWorkspaceBuildCapacityFallback(_ context.Context, arg database.InsertWorkspaceBuildCapacityFallbackParams) error {
+	if err := validateDatabaseType(arg); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, fallback := range q.workspaceBuildCapacityFallbacks {
+		if fallback.WorkspaceBuildID == arg.WorkspaceBuildID {
+			return errDuplicateKey
+		}
+	}
+	q.workspaceBuildCapacityFallbacks = append(q.workspaceBuildCapacityFallbacks, database.WorkspaceBuildCapacityFallback{
+		WorkspaceBuildID: arg.WorkspaceBuildID,
+		Selected:         arg.Selected,
+		Attempts:         arg.Attempts,
+	})
+	return nil
+}
+
+func (q *FakeQuerier) InsertWorkspaceBuildMetadata(_ context.Context, arg database.InsertWorkspaceBuildMetadataParams) error {
+	if err := validateDatabaseType(arg); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for index, key := range arg.Key {
+		for _, m := range q.workspaceBuildMetadata {
+			if m.WorkspaceBuildID == arg.WorkspaceBuildID && m.Key == key {
+				return errDuplicateKey
+			}
+		}
+		q.workspaceBuildMetadata = append(q.workspaceBuildMetadata, database.WorkspaceBuildMetadatum{
+			WorkspaceBuildID: arg.WorkspaceBuildID,
+			Key:              key,
+			Value:            arg.Value[index],
+			Sensitive:        arg.Sensitive[index],
+			DisplayOrder:     arg.DisplayOrder[index],
+		})
+	}
+	return nil
+}
+
 func (q *FakeQuerier) InsertWorkspaceBuildParameters(_ context.Context, arg database.InsertWorkspaceBuildParametersParams) error {
 	if err := validateDatabaseType(arg); err != nil {
 		return err
@@ -5910,6 +6468,7 @@ func (q *FakeQuerier) InsertWorkspaceBuildParameters(_ context.Context, arg data
 			WorkspaceBuildID: arg.WorkspaceBuildID,
 			Name:             name,
 			Value:            arg.Value[index],
+			Source:           arg.Source[index],
 		})
 	}
 	return nil
@@ -5965,6 +6524,8 @@ func (q *FakeQuerier) InsertWorkspaceResource(_ context.Context, arg database.In
 		Hide:       arg.Hide,
 		Icon:       arg.Icon,
 		DailyCost:  arg.DailyCost,
+		Action:     arg.Action,
+		Address:    arg.Address,
 	}
 	q.workspaceResources = append(q.workspaceResources, resource)
 	return resource, nil
@@ -5994,7 +6555,9 @@ func (q *FakeQuerier) InsertWorkspaceResourceMetadata(_ context.Context, arg dat
 				String: value,
 				Valid:  value != "",
 			},
-			Sensitive: arg.Sensitive[index],
+			Sensitive:    arg.Sensitive[index],
+			DisplayOrder: arg.DisplayOrder[index],
+			DisplayGroup: arg.DisplayGroup[index],
 		})
 	}
 	q.workspaceResourceMetadata = append(q.workspaceResourceMetadata, metadata...)
@@ -6348,6 +6911,25 @@ func (q *FakeQuerier) UpdateProvisionerJobByID(_ context.Context, arg database.U
 	return sql.ErrNoRows
 }
 
+func (q *FakeQuerier) UpdateProvisionerJobCheckpointResumedByJobID(_ context.Context, arg database.UpdateProvisionerJobCheckpointResumedByJobIDParams) error {
+	if err := validateDatabaseType(arg); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, checkpoint := range q.provisionerJobCheckpoints {
+		if checkpoint.JobID == arg.JobID {
+			checkpoint.ResumeCount++
+			checkpoint.UpdatedAt = arg.UpdatedAt
+			q.provisionerJobCheckpoints[i] = checkpoint
+			return nil
+		}
+	}
+	return nil
+}
+
 func (q *FakeQuerier) UpdateProvisionerJobWithCancelByID(_ context.Context, arg database.UpdateProvisionerJobWithCancelByIDParams) error {
 	if err := validateDatabaseType(arg); err != nil {
 		return err
@@ -6392,6 +6974,28 @@ func (q *FakeQuerier) UpdateProvisionerJobWithCompleteByID(_ context.Context, ar
 	return sql.ErrNoRows
 }
 
+func (q *FakeQuerier) UpdateProvisionerJobWithRequeueByID(_ context.Context, arg database.UpdateProvisionerJobWithRequeueByIDParams) error {
+	if err := validateDatabaseType(arg); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for index, job := range q.provisionerJobs {
+		if arg.ID != job.ID || job.CompletedAt.Valid {
+			continue
+		}
+		job.UpdatedAt = arg.UpdatedAt
+		job.StartedAt = sql.NullTime{}
+		job.WorkerID = uuid.NullUUID{}
+		job.JobStatus = provisonerJobStatus(job)
+		q.provisionerJobs[index] = job
+		return nil
+	}
+	return nil
+}
+
 func (q *FakeQuerier) UpdateReplica(_ context.Context, arg database.UpdateReplicaParams) (database.Replica, error) {
 	if err := validateDatabaseType(arg); err != nil {
 		return database.Replica{}, err
@@ -6520,6 +7124,10 @@ func (q *FakeQuerier) UpdateTemplateMetaByID(_ context.Context, arg database.Upd
 		tpl.Icon = arg.Icon
 		tpl.GroupACL = arg.GroupACL
 		tpl.AllowUserCancelWorkspaceJobs = arg.AllowUserCancelWorkspaceJobs
+		tpl.MaxAppSharingLevel = arg.MaxAppSharingLevel
+		tpl.CodeServerEnabled = arg.CodeServerEnabled
+		tpl.DocsURL = arg.DocsURL
+		tpl.ReplaceOnFailure = arg.ReplaceOnFailure
 		q.templates[idx] = tpl
 		return nil
 	}
@@ -7003,6 +7611,24 @@ func (q *FakeQuerier) UpdateWorkspaceAgentMetadata(_ context.Context, arg databa
 	return nil
 }
 
+func (q *FakeQuerier) UpdateWorkspaceAgentResourceIDByID(_ context.Context, arg database.UpdateWorkspaceAgentResourceIDByIDParams) error {
+	if err := validateDatabaseType(arg); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, agent := range q.workspaceAgents {
+		if agent.ID == arg.ID {
+			agent.ResourceID = arg.ResourceID
+			agent.UpdatedAt = arg.UpdatedAt
+			q.workspaceAgents[i] = agent
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
 func (q *FakeQuerier) UpdateWorkspaceAgentStartupByID(_ context.Context, arg database.UpdateWorkspaceAgentStartupByIDParams) error {
 	if err := validateDatabaseType(arg); err != nil {
 		return err
@@ -7056,6 +7682,9 @@ func (q *FakeQuerier) UpdateWorkspaceAppHealthByID(_ context.Context, arg databa
 			continue
 		}
 		app.Health = arg.Health
+		app.HealthLatencyMs = arg.HealthLatencyMs
+		app.HealthError = arg.HealthError
+		app.HealthCheckedAt = arg.HealthCheckedAt
 		q.workspaceApps[index] = app
 		return nil
 	}
@@ -7467,6 +8096,33 @@ func (q *FakeQuerier) UpsertProvisionerDaemon(_ context.Context, arg database.Up
 	return d, nil
 }
 
+func (q *FakeQuerier) UpsertProvisionerJobCheckpoint(_ context.Context, arg database.UpsertProvisionerJobCheckpointParams) error {
+	if err := validateDatabaseType(arg); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, checkpoint := range q.provisionerJobCheckpoints {
+		if checkpoint.JobID == arg.JobID {
+			checkpoint.Stage = arg.Stage
+			checkpoint.Checkpoint = slices.Clone(arg.Checkpoint)
+			checkpoint.UpdatedAt = arg.CreatedAt
+			q.provisionerJobCheckpoints[i] = checkpoint
+			return nil
+		}
+	}
+	q.provisionerJobCheckpoints = append(q.provisionerJobCheckpoints, database.ProvisionerJobCheckpoint{
+		JobID:      arg.JobID,
+		Stage:      arg.Stage,
+		Checkpoint: slices.Clone(arg.Checkpoint),
+		CreatedAt:  arg.CreatedAt,
+		UpdatedAt:  arg.CreatedAt,
+	})
+	return nil
+}
+
 func (q *FakeQuerier) UpsertServiceBanner(_ context.Context, data string) error {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
@@ -7509,6 +8165,55 @@ func (*FakeQuerier) UpsertTailnetTunnel(_ context.Context, arg database.UpsertTa
 	return database.TailnetTunnel{}, ErrUnimplemented
 }
 
+func (q *FakeQuerier) UpsertTemplateVersionMetadata(_ context.Context, arg database.UpsertTemplateVersionMetadataParams) error {
+	if err := validateDatabaseType(arg); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	metadata := database.TemplateVersionMetadatum{
+		TemplateVersionID: arg.TemplateVersionID,
+		DisplayName:       arg.DisplayName,
+		Icon:              arg.Icon,
+		Description:       arg.Description,
+		DocsURL:           arg.DocsURL,
+	}
+	for i, existing := range q.templateVersionMetadata {
+		if existing.TemplateVersionID == arg.TemplateVersionID {
+			q.templateVersionMetadata[i] = metadata
+			return nil
+		}
+	}
+	q.templateVersionMetadata = append(q.templateVersionMetadata, metadata)
+	return nil
+}
+
+func (q *FakeQuerier) UpsertUserAuthorizedKeys(_ context.Context, arg database.UpsertUserAuthorizedKeysParams) (database.UserAuthorizedKeys, error) {
+	if err := validateDatabaseType(arg); err != nil {
+		return database.UserAuthorizedKeys{}, err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	keys := database.UserAuthorizedKeys{
+		UserID:    arg.UserID,
+		Keys:      arg.Keys,
+		Required:  arg.Required,
+		UpdatedAt: arg.UpdatedAt,
+	}
+	for i, existing := range q.userAuthorizedKeys {
+		if existing.UserID == arg.UserID {
+			q.userAuthorizedKeys[i] = keys
+			return keys, nil
+		}
+	}
+	q.userAuthorizedKeys = append(q.userAuthorizedKeys, keys)
+	return keys, nil
+}
+
 func (q *FakeQuerier) GetAuthorizedTemplates(ctx context.Context, arg database.GetTemplatesWithFilterParams, prepared rbac.PreparedAuthorized) ([]database.Template, error) {
 	if err := validateDatabaseType(arg); err != nil {
 		return nil, err
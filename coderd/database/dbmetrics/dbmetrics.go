@@ -107,6 +107,13 @@ func (m metricsStore) AllUserIDs(ctx context.Context) ([]uuid.UUID, error) {
 	return r0, r1
 }
 
+func (m metricsStore) AppendWorkspaceAgentUploadChunk(ctx context.Context, arg database.AppendWorkspaceAgentUploadChunkParams) (int64, error) {
+	start := time.Now()
+	r0, r1 := m.s.AppendWorkspaceAgentUploadChunk(ctx, arg)
+	m.queryLatencies.WithLabelValues("AppendWorkspaceAgentUploadChunk").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
 func (m metricsStore) ArchiveUnusedTemplateVersions(ctx context.Context, arg database.ArchiveUnusedTemplateVersionsParams) ([]uuid.UUID, error) {
 	start := time.Now()
 	r0, r1 := m.s.ArchiveUnusedTemplateVersions(ctx, arg)
@@ -253,6 +260,13 @@ func (m metricsStore) DeleteOldWorkspaceAgentLogs(ctx context.Context) error {
 	return r0
 }
 
+func (m metricsStore) DeleteOldWorkspaceAgentScriptArtifacts(ctx context.Context) error {
+	start := time.Now()
+	r0 := m.s.DeleteOldWorkspaceAgentScriptArtifacts(ctx)
+	m.queryLatencies.WithLabelValues("DeleteOldWorkspaceAgentScriptArtifacts").Observe(time.Since(start).Seconds())
+	return r0
+}
+
 func (m metricsStore) DeleteOldWorkspaceAgentStats(ctx context.Context) error {
 	start := time.Now()
 	err := m.s.DeleteOldWorkspaceAgentStats(ctx)
@@ -260,6 +274,20 @@ func (m metricsStore) DeleteOldWorkspaceAgentStats(ctx context.Context) error {
 	return err
 }
 
+func (m metricsStore) DeleteOldWorkspaceAgentUploads(ctx context.Context) error {
+	start := time.Now()
+	r0 := m.s.DeleteOldWorkspaceAgentUploads(ctx)
+	m.queryLatencies.WithLabelValues("DeleteOldWorkspaceAgentUploads").Observe(time.Since(start).Seconds())
+	return r0
+}
+
+func (m metricsStore) DeleteProvisionerJobCheckpointByJobID(ctx context.Context, jobID uuid.UUID) error {
+	start := time.Now()
+	r0 := m.s.DeleteProvisionerJobCheckpointByJobID(ctx, jobID)
+	m.queryLatencies.WithLabelValues("DeleteProvisionerJobCheckpointByJobID").Observe(time.Since(start).Seconds())
+	return r0
+}
+
 func (m metricsStore) DeleteReplicasUpdatedBefore(ctx context.Context, updatedAt time.Time) error {
 	start := time.Now()
 	err := m.s.DeleteReplicasUpdatedBefore(ctx, updatedAt)
@@ -300,6 +328,20 @@ func (m metricsStore) DeleteTailnetTunnel(ctx context.Context, arg database.Dele
 	return r0, r1
 }
 
+func (m metricsStore) DeleteWorkspaceAgentUpload(ctx context.Context, arg database.DeleteWorkspaceAgentUploadParams) error {
+	start := time.Now()
+	r0 := m.s.DeleteWorkspaceAgentUpload(ctx, arg)
+	m.queryLatencies.WithLabelValues("DeleteWorkspaceAgentUpload").Observe(time.Since(start).Seconds())
+	return r0
+}
+
+func (m metricsStore) DeleteWorkspaceResourceMetadataByResourceID(ctx context.Context, workspaceResourceID uuid.UUID) error {
+	start := time.Now()
+	r0 := m.s.DeleteWorkspaceResourceMetadataByResourceID(ctx, workspaceResourceID)
+	m.queryLatencies.WithLabelValues("DeleteWorkspaceResourceMetadataByResourceID").Observe(time.Since(start).Seconds())
+	return r0
+}
+
 func (m metricsStore) FavoriteWorkspace(ctx context.Context, arg uuid.UUID) error {
 	start := time.Now()
 	r0 := m.s.FavoriteWorkspace(ctx, arg)
@@ -524,6 +566,13 @@ func (m metricsStore) GetGroupMembers(ctx context.Context, groupID uuid.UUID) ([
 	return users, err
 }
 
+func (m metricsStore) GetGroupsByOrganizationAndUserID(ctx context.Context, arg database.GetGroupsByOrganizationAndUserIDParams) ([]database.Group, error) {
+	start := time.Now()
+	groups, err := m.s.GetGroupsByOrganizationAndUserID(ctx, arg)
+	m.queryLatencies.WithLabelValues("GetGroupsByOrganizationAndUserID").Observe(time.Since(start).Seconds())
+	return groups, err
+}
+
 func (m metricsStore) GetGroupsByOrganizationID(ctx context.Context, organizationID uuid.UUID) ([]database.Group, error) {
 	start := time.Now()
 	groups, err := m.s.GetGroupsByOrganizationID(ctx, organizationID)
@@ -566,6 +615,13 @@ func (m metricsStore) GetLatestWorkspaceBuildByWorkspaceID(ctx context.Context,
 	return build, err
 }
 
+func (m metricsStore) GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID(ctx context.Context, workspaceID uuid.UUID) (database.WorkspaceBuildCapacityFallback, error) {
+	start := time.Now()
+	fallback, err := m.s.GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID(ctx, workspaceID)
+	m.queryLatencies.WithLabelValues("GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID").Observe(time.Since(start).Seconds())
+	return fallback, err
+}
+
 func (m metricsStore) GetLatestWorkspaceBuilds(ctx context.Context) ([]database.WorkspaceBuild, error) {
 	start := time.Now()
 	builds, err := m.s.GetLatestWorkspaceBuilds(ctx)
@@ -713,6 +769,27 @@ func (m metricsStore) GetProvisionerJobByID(ctx context.Context, id uuid.UUID) (
 	return job, err
 }
 
+func (m metricsStore) GetProvisionerJobCheckpointByJobID(ctx context.Context, jobID uuid.UUID) (database.ProvisionerJobCheckpoint, error) {
+	start := time.Now()
+	r0, r1 := m.s.GetProvisionerJobCheckpointByJobID(ctx, jobID)
+	m.queryLatencies.WithLabelValues("GetProvisionerJobCheckpointByJobID").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
+func (m metricsStore) GetProvisionerJobDiagnosticBundleByJobID(ctx context.Context, jobID uuid.UUID) (database.ProvisionerJobDiagnosticBundle, error) {
+	start := time.Now()
+	r0, r1 := m.s.GetProvisionerJobDiagnosticBundleByJobID(ctx, jobID)
+	m.queryLatencies.WithLabelValues("GetProvisionerJobDiagnosticBundleByJobID").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
+func (m metricsStore) GetProvisionerJobWorkDirectoryByJobID(ctx context.Context, jobID uuid.UUID) (database.ProvisionerJobWorkDirectory, error) {
+	start := time.Now()
+	r0, r1 := m.s.GetProvisionerJobWorkDirectoryByJobID(ctx, jobID)
+	m.queryLatencies.WithLabelValues("GetProvisionerJobWorkDirectoryByJobID").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
 func (m metricsStore) GetProvisionerJobsByIDs(ctx context.Context, ids []uuid.UUID) ([]database.ProvisionerJob, error) {
 	start := time.Now()
 	jobs, err := m.s.GetProvisionerJobsByIDs(ctx, ids)
@@ -900,6 +977,13 @@ func (m metricsStore) GetTemplateVersionByTemplateIDAndName(ctx context.Context,
 	return version, err
 }
 
+func (m metricsStore) GetTemplateVersionMetadataByTemplateVersionID(ctx context.Context, templateVersionID uuid.UUID) (database.TemplateVersionMetadatum, error) {
+	start := time.Now()
+	r0, r1 := m.s.GetTemplateVersionMetadataByTemplateVersionID(ctx, templateVersionID)
+	m.queryLatencies.WithLabelValues("GetTemplateVersionMetadataByTemplateVersionID").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
 func (m metricsStore) GetTemplateVersionParameters(ctx context.Context, templateVersionID uuid.UUID) ([]database.TemplateVersionParameter, error) {
 	start := time.Now()
 	parameters, err := m.s.GetTemplateVersionParameters(ctx, templateVersionID)
@@ -956,6 +1040,13 @@ func (m metricsStore) GetUnexpiredLicenses(ctx context.Context) ([]database.Lice
 	return licenses, err
 }
 
+func (m metricsStore) GetUnfinishedWorkspaceRefreshJobByBuildID(ctx context.Context, workspaceBuildID uuid.UUID) (database.ProvisionerJob, error) {
+	start := time.Now()
+	r0, r1 := m.s.GetUnfinishedWorkspaceRefreshJobByBuildID(ctx, workspaceBuildID)
+	m.queryLatencies.WithLabelValues("GetUnfinishedWorkspaceRefreshJobByBuildID").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
 func (m metricsStore) GetUserActivityInsights(ctx context.Context, arg database.GetUserActivityInsightsParams) ([]database.GetUserActivityInsightsRow, error) {
 	start := time.Now()
 	r0, r1 := m.s.GetUserActivityInsights(ctx, arg)
@@ -963,6 +1054,13 @@ func (m metricsStore) GetUserActivityInsights(ctx context.Context, arg database.
 	return r0, r1
 }
 
+func (m metricsStore) GetUserAuthorizedKeys(ctx context.Context, userID uuid.UUID) (database.UserAuthorizedKeys, error) {
+	start := time.Now()
+	r0, r1 := m.s.GetUserAuthorizedKeys(ctx, userID)
+	m.queryLatencies.WithLabelValues("GetUserAuthorizedKeys").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
 func (m metricsStore) GetUserByEmailOrUsername(ctx context.Context, arg database.GetUserByEmailOrUsernameParams) (database.User, error) {
 	start := time.Now()
 	user, err := m.s.GetUserByEmailOrUsername(ctx, arg)
@@ -1082,6 +1180,20 @@ func (m metricsStore) GetWorkspaceAgentMetadata(ctx context.Context, workspaceAg
 	return metadata, err
 }
 
+func (m metricsStore) GetWorkspaceAgentScriptArtifactByID(ctx context.Context, id uuid.UUID) (database.WorkspaceAgentScriptArtifact, error) {
+	start := time.Now()
+	r0, r1 := m.s.GetWorkspaceAgentScriptArtifactByID(ctx, id)
+	m.queryLatencies.WithLabelValues("GetWorkspaceAgentScriptArtifactByID").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
+func (m metricsStore) GetWorkspaceAgentScriptArtifactsByAgentID(ctx context.Context, workspaceAgentID uuid.UUID) ([]database.GetWorkspaceAgentScriptArtifactsByAgentIDRow, error) {
+	start := time.Now()
+	r0, r1 := m.s.GetWorkspaceAgentScriptArtifactsByAgentID(ctx, workspaceAgentID)
+	m.queryLatencies.WithLabelValues("GetWorkspaceAgentScriptArtifactsByAgentID").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
 func (m metricsStore) GetWorkspaceAgentScriptsByAgentIDs(ctx context.Context, ids []uuid.UUID) ([]database.WorkspaceAgentScript, error) {
 	start := time.Now()
 	r0, r1 := m.s.GetWorkspaceAgentScriptsByAgentIDs(ctx, ids)
@@ -1103,6 +1215,20 @@ func (m metricsStore) GetWorkspaceAgentStatsAndLabels(ctx context.Context, creat
 	return stats, err
 }
 
+func (m metricsStore) GetWorkspaceAgentUpload(ctx context.Context, arg database.GetWorkspaceAgentUploadParams) (database.WorkspaceAgentUpload, error) {
+	start := time.Now()
+	r0, r1 := m.s.GetWorkspaceAgentUpload(ctx, arg)
+	m.queryLatencies.WithLabelValues("GetWorkspaceAgentUpload").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
+func (m metricsStore) GetWorkspaceAgentUploadData(ctx context.Context, arg database.GetWorkspaceAgentUploadDataParams) ([]byte, error) {
+	start := time.Now()
+	r0, r1 := m.s.GetWorkspaceAgentUploadData(ctx, arg)
+	m.queryLatencies.WithLabelValues("GetWorkspaceAgentUploadData").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
 func (m metricsStore) GetWorkspaceAgentsByResourceIDs(ctx context.Context, ids []uuid.UUID) ([]database.WorkspaceAgent, error) {
 	start := time.Now()
 	agents, err := m.s.GetWorkspaceAgentsByResourceIDs(ctx, ids)
@@ -1173,6 +1299,20 @@ func (m metricsStore) GetWorkspaceBuildByWorkspaceIDAndBuildNumber(ctx context.C
 	return build, err
 }
 
+func (m metricsStore) GetWorkspaceBuildCapacityFallbackByBuildID(ctx context.Context, workspaceBuildID uuid.UUID) (database.WorkspaceBuildCapacityFallback, error) {
+	start := time.Now()
+	fallback, err := m.s.GetWorkspaceBuildCapacityFallbackByBuildID(ctx, workspaceBuildID)
+	m.queryLatencies.WithLabelValues("GetWorkspaceBuildCapacityFallbackByBuildID").Observe(time.Since(start).Seconds())
+	return fallback, err
+}
+
+func (m metricsStore) GetWorkspaceBuildMetadataByBuildID(ctx context.Context, workspaceBuildID uuid.UUID) ([]database.WorkspaceBuildMetadatum, error) {
+	start := time.Now()
+	metadata, err := m.s.GetWorkspaceBuildMetadataByBuildID(ctx, workspaceBuildID)
+	m.queryLatencies.WithLabelValues("GetWorkspaceBuildMetadataByBuildID").Observe(time.Since(start).Seconds())
+	return metadata, err
+}
+
 func (m metricsStore) GetWorkspaceBuildParameters(ctx context.Context, workspaceBuildID uuid.UUID) ([]database.WorkspaceBuildParameter, error) {
 	start := time.Now()
 	params, err := m.s.GetWorkspaceBuildParameters(ctx, workspaceBuildID)
@@ -1439,6 +1579,13 @@ func (m metricsStore) InsertProvisionerJob(ctx context.Context, arg database.Ins
 	return job, err
 }
 
+func (m metricsStore) InsertProvisionerJobDiagnosticBundle(ctx context.Context, arg database.InsertProvisionerJobDiagnosticBundleParams) error {
+	start := time.Now()
+	r0 := m.s.InsertProvisionerJobDiagnosticBundle(ctx, arg)
+	m.queryLatencies.WithLabelValues("InsertProvisionerJobDiagnosticBundle").Observe(time.Since(start).Seconds())
+	return r0
+}
+
 func (m metricsStore) InsertProvisionerJobLogs(ctx context.Context, arg database.InsertProvisionerJobLogsParams) ([]database.ProvisionerJobLog, error) {
 	start := time.Now()
 	logs, err := m.s.InsertProvisionerJobLogs(ctx, arg)
@@ -1446,6 +1593,13 @@ func (m metricsStore) InsertProvisionerJobLogs(ctx context.Context, arg database
 	return logs, err
 }
 
+func (m metricsStore) InsertProvisionerJobWorkDirectory(ctx context.Context, arg database.InsertProvisionerJobWorkDirectoryParams) error {
+	start := time.Now()
+	r0 := m.s.InsertProvisionerJobWorkDirectory(ctx, arg)
+	m.queryLatencies.WithLabelValues("InsertProvisionerJobWorkDirectory").Observe(time.Since(start).Seconds())
+	return r0
+}
+
 func (m metricsStore) InsertReplica(ctx context.Context, arg database.InsertReplicaParams) (database.Replica, error) {
 	start := time.Now()
 	replica, err := m.s.InsertReplica(ctx, arg)
@@ -1537,6 +1691,13 @@ func (m metricsStore) InsertWorkspaceAgentMetadata(ctx context.Context, arg data
 	return err
 }
 
+func (m metricsStore) InsertWorkspaceAgentScriptArtifact(ctx context.Context, arg database.InsertWorkspaceAgentScriptArtifactParams) error {
+	start := time.Now()
+	r0 := m.s.InsertWorkspaceAgentScriptArtifact(ctx, arg)
+	m.queryLatencies.WithLabelValues("InsertWorkspaceAgentScriptArtifact").Observe(time.Since(start).Seconds())
+	return r0
+}
+
 func (m metricsStore) InsertWorkspaceAgentScripts(ctx context.Context, arg database.InsertWorkspaceAgentScriptsParams) ([]database.WorkspaceAgentScript, error) {
 	start := time.Now()
 	r0, r1 := m.s.InsertWorkspaceAgentScripts(ctx, arg)
@@ -1558,6 +1719,13 @@ func (m metricsStore) InsertWorkspaceAgentStats(ctx context.Context, arg databas
 	return r0
 }
 
+func (m metricsStore) InsertWorkspaceAgentUpload(ctx context.Context, arg database.InsertWorkspaceAgentUploadParams) (int64, error) {
+	start := time.Now()
+	r0, r1 := m.s.InsertWorkspaceAgentUpload(ctx, arg)
+	m.queryLatencies.WithLabelValues("InsertWorkspaceAgentUpload").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
 func (m metricsStore) InsertWorkspaceApp(ctx context.Context, arg database.InsertWorkspaceAppParams) (database.WorkspaceApp, error) {
 	start := time.Now()
 	app, err := m.s.InsertWorkspaceApp(ctx, arg)
@@ -1579,6 +1747,20 @@ func (m metricsStore) InsertWorkspaceBuild(ctx context.Context, arg database.Ins
 	return err
 }
 
+func (m metricsStore) InsertWorkspaceBuildCapacityFallback(ctx context.Context, arg database.InsertWorkspaceBuildCapacityFallbackParams) error {
+	start := time.Now()
+	err := m.s.InsertWorkspaceBuildCapacityFallback(ctx, arg)
+	m.queryLatencies.WithLabelValues("InsertWorkspaceBuildCapacityFallback").Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (m metricsStore) InsertWorkspaceBuildMetadata(ctx context.Context, arg database.InsertWorkspaceBuildMetadataParams) error {
+	start := time.Now()
+	err := m.s.InsertWorkspaceBuildMetadata(ctx, arg)
+	m.queryLatencies.WithLabelValues("InsertWorkspaceBuildMetadata").Observe(time.Since(start).Seconds())
+	return err
+}
+
 func (m metricsStore) InsertWorkspaceBuildParameters(ctx context.Context, arg database.InsertWorkspaceBuildParametersParams) error {
 	start := time.Now()
 	err := m.s.InsertWorkspaceBuildParameters(ctx, arg)
@@ -1712,6 +1894,13 @@ func (m metricsStore) UpdateProvisionerJobByID(ctx context.Context, arg database
 	return err
 }
 
+func (m metricsStore) UpdateProvisionerJobCheckpointResumedByJobID(ctx context.Context, arg database.UpdateProvisionerJobCheckpointResumedByJobIDParams) error {
+	start := time.Now()
+	r0 := m.s.UpdateProvisionerJobCheckpointResumedByJobID(ctx, arg)
+	m.queryLatencies.WithLabelValues("UpdateProvisionerJobCheckpointResumedByJobID").Observe(time.Since(start).Seconds())
+	return r0
+}
+
 func (m metricsStore) UpdateProvisionerJobWithCancelByID(ctx context.Context, arg database.UpdateProvisionerJobWithCancelByIDParams) error {
 	start := time.Now()
 	err := m.s.UpdateProvisionerJobWithCancelByID(ctx, arg)
@@ -1726,6 +1915,13 @@ func (m metricsStore) UpdateProvisionerJobWithCompleteByID(ctx context.Context,
 	return err
 }
 
+func (m metricsStore) UpdateProvisionerJobWithRequeueByID(ctx context.Context, arg database.UpdateProvisionerJobWithRequeueByIDParams) error {
+	start := time.Now()
+	r0 := m.s.UpdateProvisionerJobWithRequeueByID(ctx, arg)
+	m.queryLatencies.WithLabelValues("UpdateProvisionerJobWithRequeueByID").Observe(time.Since(start).Seconds())
+	return r0
+}
+
 func (m metricsStore) UpdateReplica(ctx context.Context, arg database.UpdateReplicaParams) (database.Replica, error) {
 	start := time.Now()
 	replica, err := m.s.UpdateReplica(ctx, arg)
@@ -1915,6 +2111,13 @@ func (m metricsStore) UpdateWorkspaceAgentMetadata(ctx context.Context, arg data
 	return err
 }
 
+func (m metricsStore) UpdateWorkspaceAgentResourceIDByID(ctx context.Context, arg database.UpdateWorkspaceAgentResourceIDByIDParams) error {
+	start := time.Now()
+	r0 := m.s.UpdateWorkspaceAgentResourceIDByID(ctx, arg)
+	m.queryLatencies.WithLabelValues("UpdateWorkspaceAgentResourceIDByID").Observe(time.Since(start).Seconds())
+	return r0
+}
+
 func (m metricsStore) UpdateWorkspaceAgentStartupByID(ctx context.Context, arg database.UpdateWorkspaceAgentStartupByIDParams) error {
 	start := time.Now()
 	err := m.s.UpdateWorkspaceAgentStartupByID(ctx, arg)
@@ -2076,6 +2279,13 @@ func (m metricsStore) UpsertProvisionerDaemon(ctx context.Context, arg database.
 	return r0, r1
 }
 
+func (m metricsStore) UpsertProvisionerJobCheckpoint(ctx context.Context, arg database.UpsertProvisionerJobCheckpointParams) error {
+	start := time.Now()
+	r0 := m.s.UpsertProvisionerJobCheckpoint(ctx, arg)
+	m.queryLatencies.WithLabelValues("UpsertProvisionerJobCheckpoint").Observe(time.Since(start).Seconds())
+	return r0
+}
+
 func (m metricsStore) UpsertServiceBanner(ctx context.Context, value string) error {
 	start := time.Now()
 	r0 := m.s.UpsertServiceBanner(ctx, value)
@@ -2122,6 +2332,20 @@ func (m metricsStore) UpsertTailnetTunnel(ctx context.Context, arg database.Upse
 	return r0, r1
 }
 
+func (m metricsStore) UpsertTemplateVersionMetadata(ctx context.Context, arg database.UpsertTemplateVersionMetadataParams) error {
+	start := time.Now()
+	r0 := m.s.UpsertTemplateVersionMetadata(ctx, arg)
+	m.queryLatencies.WithLabelValues("UpsertTemplateVersionMetadata").Observe(time.Since(start).Seconds())
+	return r0
+}
+
+func (m metricsStore) UpsertUserAuthorizedKeys(ctx context.Context, arg database.UpsertUserAuthorizedKeysParams) (database.UserAuthorizedKeys, error) {
+	start := time.Now()
+	r0, r1 := m.s.UpsertUserAuthorizedKeys(ctx, arg)
+	m.queryLatencies.WithLabelValues("UpsertUserAuthorizedKeys").Observe(time.Since(start).Seconds())
+	return r0, r1
+}
+
 func (m metricsStore) GetAuthorizedTemplates(ctx context.Context, arg database.GetTemplatesWithFilterParams, prepared rbac.PreparedAuthorized) ([]database.Template, error) {
 	start := time.Now()
 	templates, err := m.s.GetAuthorizedTemplates(ctx, arg, prepared)
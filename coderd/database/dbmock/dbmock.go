@@ -39,6 +39,34 @@ func NewMockStore(ctrl *gomock.Controller) *MockStore {
 	return mock
 }
 
+// DeleteOldWorkspaceAgentScriptArtifacts mocks base method.
+func (m *MockStore) DeleteOldWorkspaceAgentScriptArtifacts(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOldWorkspaceAgentScriptArtifacts", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteOldWorkspaceAgentScriptArtifacts indicates an expected call of DeleteOldWorkspaceAgentScriptArtifacts.
+func (mr *MockStoreMockRecorder) DeleteOldWorkspaceAgentScriptArtifacts(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOldWorkspaceAgentScriptArtifacts", reflect.TypeOf((*MockStore)(nil).DeleteOldWorkspaceAgentScriptArtifacts), arg0)
+}
+
+// DeleteProvisionerJobCheckpointByJobID mocks base method.
+func (m *MockStore) DeleteProvisionerJobCheckpointByJobID(arg0 context.Context, arg1 uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteProvisionerJobCheckpointByJobID", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteProvisionerJobCheckpointByJobID indicates an expected call of DeleteProvisionerJobCheckpointByJobID.
+func (mr *MockStoreMockRecorder) DeleteProvisionerJobCheckpointByJobID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProvisionerJobCheckpointByJobID", reflect.TypeOf((*MockStore)(nil).DeleteProvisionerJobCheckpointByJobID), arg0, arg1)
+}
+
 // EXPECT returns an object that allows the caller to indicate expected use.
 func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
@@ -102,6 +130,21 @@ func (mr *MockStoreMockRecorder) AllUserIDs(arg0 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllUserIDs", reflect.TypeOf((*MockStore)(nil).AllUserIDs), arg0)
 }
 
+// AppendWorkspaceAgentUploadChunk mocks base method.
+func (m *MockStore) AppendWorkspaceAgentUploadChunk(arg0 context.Context, arg1 database.AppendWorkspaceAgentUploadChunkParams) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppendWorkspaceAgentUploadChunk", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AppendWorkspaceAgentUploadChunk indicates an expected call of AppendWorkspaceAgentUploadChunk.
+func (mr *MockStoreMockRecorder) AppendWorkspaceAgentUploadChunk(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendWorkspaceAgentUploadChunk", reflect.TypeOf((*MockStore)(nil).AppendWorkspaceAgentUploadChunk), arg0, arg1)
+}
+
 // ArchiveUnusedTemplateVersions mocks base method.
 func (m *MockStore) ArchiveUnusedTemplateVersions(arg0 context.Context, arg1 database.ArchiveUnusedTemplateVersionsParams) ([]uuid.UUID, error) {
 	m.ctrl.T.Helper()
@@ -412,6 +455,20 @@ func (mr *MockStoreMockRecorder) DeleteOldWorkspaceAgentStats(arg0 any) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOldWorkspaceAgentStats", reflect.TypeOf((*MockStore)(nil).DeleteOldWorkspaceAgentStats), arg0)
 }
 
+// DeleteOldWorkspaceAgentUploads mocks base method.
+func (m *MockStore) DeleteOldWorkspaceAgentUploads(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOldWorkspaceAgentUploads", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteOldWorkspaceAgentUploads indicates an expected call of DeleteOldWorkspaceAgentUploads.
+func (mr *MockStoreMockRecorder) DeleteOldWorkspaceAgentUploads(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOldWorkspaceAgentUploads", reflect.TypeOf((*MockStore)(nil).DeleteOldWorkspaceAgentUploads), arg0)
+}
+
 // DeleteReplicasUpdatedBefore mocks base method.
 func (m *MockStore) DeleteReplicasUpdatedBefore(arg0 context.Context, arg1 time.Time) error {
 	m.ctrl.T.Helper()
@@ -500,6 +557,34 @@ func (mr *MockStoreMockRecorder) DeleteTailnetTunnel(arg0, arg1 any) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTailnetTunnel", reflect.TypeOf((*MockStore)(nil).DeleteTailnetTunnel), arg0, arg1)
 }
 
+// DeleteWorkspaceAgentUpload mocks base method.
+func (m *MockStore) DeleteWorkspaceAgentUpload(arg0 context.Context, arg1 database.DeleteWorkspaceAgentUploadParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWorkspaceAgentUpload", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWorkspaceAgentUpload indicates an expected call of DeleteWorkspaceAgentUpload.
+func (mr *MockStoreMockRecorder) DeleteWorkspaceAgentUpload(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWorkspaceAgentUpload", reflect.TypeOf((*MockStore)(nil).DeleteWorkspaceAgentUpload), arg0, arg1)
+}
+
+// DeleteWorkspaceResourceMetadataByResourceID mocks base method.
+func (m *MockStore) DeleteWorkspaceResourceMetadataByResourceID(arg0 context.Context, arg1 uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWorkspaceResourceMetadataByResourceID", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWorkspaceResourceMetadataByResourceID indicates an expected call of DeleteWorkspaceResourceMetadataByResourceID.
+func (mr *MockStoreMockRecorder) DeleteWorkspaceResourceMetadataByResourceID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWorkspaceResourceMetadataByResourceID", reflect.TypeOf((*MockStore)(nil).DeleteWorkspaceResourceMetadataByResourceID), arg0, arg1)
+}
+
 // FavoriteWorkspace mocks base method.
 func (m *MockStore) FavoriteWorkspace(arg0 context.Context, arg1 uuid.UUID) error {
 	m.ctrl.T.Helper()
@@ -1024,6 +1109,21 @@ func (mr *MockStoreMockRecorder) GetGroupMembers(arg0, arg1 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroupMembers", reflect.TypeOf((*MockStore)(nil).GetGroupMembers), arg0, arg1)
 }
 
+// GetGroupsByOrganizationAndUserID mocks base method.
+func (m *MockStore) GetGroupsByOrganizationAndUserID(arg0 context.Context, arg1 database.GetGroupsByOrganizationAndUserIDParams) ([]database.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroupsByOrganizationAndUserID", arg0, arg1)
+	ret0, _ := ret[0].([]database.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroupsByOrganizationAndUserID indicates an expected call of GetGroupsByOrganizationAndUserID.
+func (mr *MockStoreMockRecorder) GetGroupsByOrganizationAndUserID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroupsByOrganizationAndUserID", reflect.TypeOf((*MockStore)(nil).GetGroupsByOrganizationAndUserID), arg0, arg1)
+}
+
 // GetGroupsByOrganizationID mocks base method.
 func (m *MockStore) GetGroupsByOrganizationID(arg0 context.Context, arg1 uuid.UUID) ([]database.Group, error) {
 	m.ctrl.T.Helper()
@@ -1114,6 +1214,21 @@ func (mr *MockStoreMockRecorder) GetLatestWorkspaceBuildByWorkspaceID(arg0, arg1
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLatestWorkspaceBuildByWorkspaceID", reflect.TypeOf((*MockStore)(nil).GetLatestWorkspaceBuildByWorkspaceID), arg0, arg1)
 }
 
+// GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID mocks base method.
+func (m *MockStore) GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID(arg0 context.Context, arg1 uuid.UUID) (database.WorkspaceBuildCapacityFallback, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID", arg0, arg1)
+	ret0, _ := ret[0].(database.WorkspaceBuildCapacityFallback)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID indicates an expected call of GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID.
+func (mr *MockStoreMockRecorder) GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID", reflect.TypeOf((*MockStore)(nil).GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID), arg0, arg1)
+}
+
 // GetLatestWorkspaceBuilds mocks base method.
 func (m *MockStore) GetLatestWorkspaceBuilds(arg0 context.Context) ([]database.WorkspaceBuild, error) {
 	m.ctrl.T.Helper()
@@ -1429,6 +1544,51 @@ func (mr *MockStoreMockRecorder) GetProvisionerJobByID(arg0, arg1 any) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProvisionerJobByID", reflect.TypeOf((*MockStore)(nil).GetProvisionerJobByID), arg0, arg1)
 }
 
+// GetProvisionerJobCheckpointByJobID mocks base method.
+func (m *MockStore) GetProvisionerJobCheckpointByJobID(arg0 context.Context, arg1 uuid.UUID) (database.ProvisionerJobCheckpoint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProvisionerJobCheckpointByJobID", arg0, arg1)
+	ret0, _ := ret[0].(database.ProvisionerJobCheckpoint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProvisionerJobCheckpointByJobID indicates an expected call of GetProvisionerJobCheckpointByJobID.
+func (mr *MockStoreMockRecorder) GetProvisionerJobCheckpointByJobID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProvisionerJobCheckpointByJobID", reflect.TypeOf((*MockStore)(nil).GetProvisionerJobCheckpointByJobID), arg0, arg1)
+}
+
+// GetProvisionerJobDiagnosticBundleByJobID mocks base method.
+func (m *MockStore) GetProvisionerJobDiagnosticBundleByJobID(arg0 context.Context, arg1 uuid.UUID) (database.ProvisionerJobDiagnosticBundle, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProvisionerJobDiagnosticBundleByJobID", arg0, arg1)
+	ret0, _ := ret[0].(database.ProvisionerJobDiagnosticBundle)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProvisionerJobDiagnosticBundleByJobID indicates an expected call of GetProvisionerJobDiagnosticBundleByJobID.
+func (mr *MockStoreMockRecorder) GetProvisionerJobDiagnosticBundleByJobID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProvisionerJobDiagnosticBundleByJobID", reflect.TypeOf((*MockStore)(nil).GetProvisionerJobDiagnosticBundleByJobID), arg0, arg1)
+}
+
+// GetProvisionerJobWorkDirectoryByJobID mocks base method.
+func (m *MockStore) GetProvisionerJobWorkDirectoryByJobID(arg0 context.Context, arg1 uuid.UUID) (database.ProvisionerJobWorkDirectory, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProvisionerJobWorkDirectoryByJobID", arg0, arg1)
+	ret0, _ := ret[0].(database.ProvisionerJobWorkDirectory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProvisionerJobWorkDirectoryByJobID indicates an expected call of GetProvisionerJobWorkDirectoryByJobID.
+func (mr *MockStoreMockRecorder) GetProvisionerJobWorkDirectoryByJobID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProvisionerJobWorkDirectoryByJobID", reflect.TypeOf((*MockStore)(nil).GetProvisionerJobWorkDirectoryByJobID), arg0, arg1)
+}
+
 // GetProvisionerJobsByIDs mocks base method.
 func (m *MockStore) GetProvisionerJobsByIDs(arg0 context.Context, arg1 []uuid.UUID) ([]database.ProvisionerJob, error) {
 	m.ctrl.T.Helper()
@@ -1864,6 +2024,21 @@ func (mr *MockStoreMockRecorder) GetTemplateVersionByTemplateIDAndName(arg0, arg
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTemplateVersionByTemplateIDAndName", reflect.TypeOf((*MockStore)(nil).GetTemplateVersionByTemplateIDAndName), arg0, arg1)
 }
 
+// GetTemplateVersionMetadataByTemplateVersionID mocks base method.
+func (m *MockStore) GetTemplateVersionMetadataByTemplateVersionID(arg0 context.Context, arg1 uuid.UUID) (database.TemplateVersionMetadatum, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTemplateVersionMetadataByTemplateVersionID", arg0, arg1)
+	ret0, _ := ret[0].(database.TemplateVersionMetadatum)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTemplateVersionMetadataByTemplateVersionID indicates an expected call of GetTemplateVersionMetadataByTemplateVersionID.
+func (mr *MockStoreMockRecorder) GetTemplateVersionMetadataByTemplateVersionID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTemplateVersionMetadataByTemplateVersionID", reflect.TypeOf((*MockStore)(nil).GetTemplateVersionMetadataByTemplateVersionID), arg0, arg1)
+}
+
 // GetTemplateVersionParameters mocks base method.
 func (m *MockStore) GetTemplateVersionParameters(arg0 context.Context, arg1 uuid.UUID) ([]database.TemplateVersionParameter, error) {
 	m.ctrl.T.Helper()
@@ -1984,6 +2159,21 @@ func (mr *MockStoreMockRecorder) GetUnexpiredLicenses(arg0 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnexpiredLicenses", reflect.TypeOf((*MockStore)(nil).GetUnexpiredLicenses), arg0)
 }
 
+// GetUnfinishedWorkspaceRefreshJobByBuildID mocks base method.
+func (m *MockStore) GetUnfinishedWorkspaceRefreshJobByBuildID(arg0 context.Context, arg1 uuid.UUID) (database.ProvisionerJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUnfinishedWorkspaceRefreshJobByBuildID", arg0, arg1)
+	ret0, _ := ret[0].(database.ProvisionerJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUnfinishedWorkspaceRefreshJobByBuildID indicates an expected call of GetUnfinishedWorkspaceRefreshJobByBuildID.
+func (mr *MockStoreMockRecorder) GetUnfinishedWorkspaceRefreshJobByBuildID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnfinishedWorkspaceRefreshJobByBuildID", reflect.TypeOf((*MockStore)(nil).GetUnfinishedWorkspaceRefreshJobByBuildID), arg0, arg1)
+}
+
 // GetUserActivityInsights mocks base method.
 func (m *MockStore) GetUserActivityInsights(arg0 context.Context, arg1 database.GetUserActivityInsightsParams) ([]database.GetUserActivityInsightsRow, error) {
 	m.ctrl.T.Helper()
@@ -1999,6 +2189,21 @@ func (mr *MockStoreMockRecorder) GetUserActivityInsights(arg0, arg1 any) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserActivityInsights", reflect.TypeOf((*MockStore)(nil).GetUserActivityInsights), arg0, arg1)
 }
 
+// GetUserAuthorizedKeys mocks base method.
+func (m *MockStore) GetUserAuthorizedKeys(arg0 context.Context, arg1 uuid.UUID) (database.UserAuthorizedKeys, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserAuthorizedKeys", arg0, arg1)
+	ret0, _ := ret[0].(database.UserAuthorizedKeys)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserAuthorizedKeys indicates an expected call of GetUserAuthorizedKeys.
+func (mr *MockStoreMockRecorder) GetUserAuthorizedKeys(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserAuthorizedKeys", reflect.TypeOf((*MockStore)(nil).GetUserAuthorizedKeys), arg0, arg1)
+}
+
 // GetUserByEmailOrUsername mocks base method.
 func (m *MockStore) GetUserByEmailOrUsername(arg0 context.Context, arg1 database.GetUserByEmailOrUsernameParams) (database.User, error) {
 	m.ctrl.T.Helper()
@@ -2254,6 +2459,36 @@ func (mr *MockStoreMockRecorder) GetWorkspaceAgentMetadata(arg0, arg1 any) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceAgentMetadata", reflect.TypeOf((*MockStore)(nil).GetWorkspaceAgentMetadata), arg0, arg1)
 }
 
+// GetWorkspaceAgentScriptArtifactByID mocks base method.
+func (m *MockStore) GetWorkspaceAgentScriptArtifactByID(arg0 context.Context, arg1 uuid.UUID) (database.WorkspaceAgentScriptArtifact, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceAgentScriptArtifactByID", arg0, arg1)
+	ret0, _ := ret[0].(database.WorkspaceAgentScriptArtifact)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceAgentScriptArtifactByID indicates an expected call of GetWorkspaceAgentScriptArtifactByID.
+func (mr *MockStoreMockRecorder) GetWorkspaceAgentScriptArtifactByID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceAgentScriptArtifactByID", reflect.TypeOf((*MockStore)(nil).GetWorkspaceAgentScriptArtifactByID), arg0, arg1)
+}
+
+// GetWorkspaceAgentScriptArtifactsByAgentID mocks base method.
+func (m *MockStore) GetWorkspaceAgentScriptArtifactsByAgentID(arg0 context.Context, arg1 uuid.UUID) ([]database.GetWorkspaceAgentScriptArtifactsByAgentIDRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceAgentScriptArtifactsByAgentID", arg0, arg1)
+	ret0, _ := ret[0].([]database.GetWorkspaceAgentScriptArtifactsByAgentIDRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceAgentScriptArtifactsByAgentID indicates an expected call of GetWorkspaceAgentScriptArtifactsByAgentID.
+func (mr *MockStoreMockRecorder) GetWorkspaceAgentScriptArtifactsByAgentID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceAgentScriptArtifactsByAgentID", reflect.TypeOf((*MockStore)(nil).GetWorkspaceAgentScriptArtifactsByAgentID), arg0, arg1)
+}
+
 // GetWorkspaceAgentScriptsByAgentIDs mocks base method.
 func (m *MockStore) GetWorkspaceAgentScriptsByAgentIDs(arg0 context.Context, arg1 []uuid.UUID) ([]database.WorkspaceAgentScript, error) {
 	m.ctrl.T.Helper()
@@ -2299,6 +2534,36 @@ func (mr *MockStoreMockRecorder) GetWorkspaceAgentStatsAndLabels(arg0, arg1 any)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceAgentStatsAndLabels", reflect.TypeOf((*MockStore)(nil).GetWorkspaceAgentStatsAndLabels), arg0, arg1)
 }
 
+// GetWorkspaceAgentUpload mocks base method.
+func (m *MockStore) GetWorkspaceAgentUpload(arg0 context.Context, arg1 database.GetWorkspaceAgentUploadParams) (database.WorkspaceAgentUpload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceAgentUpload", arg0, arg1)
+	ret0, _ := ret[0].(database.WorkspaceAgentUpload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceAgentUpload indicates an expected call of GetWorkspaceAgentUpload.
+func (mr *MockStoreMockRecorder) GetWorkspaceAgentUpload(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceAgentUpload", reflect.TypeOf((*MockStore)(nil).GetWorkspaceAgentUpload), arg0, arg1)
+}
+
+// GetWorkspaceAgentUploadData mocks base method.
+func (m *MockStore) GetWorkspaceAgentUploadData(arg0 context.Context, arg1 database.GetWorkspaceAgentUploadDataParams) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceAgentUploadData", arg0, arg1)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceAgentUploadData indicates an expected call of GetWorkspaceAgentUploadData.
+func (mr *MockStoreMockRecorder) GetWorkspaceAgentUploadData(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceAgentUploadData", reflect.TypeOf((*MockStore)(nil).GetWorkspaceAgentUploadData), arg0, arg1)
+}
+
 // GetWorkspaceAgentsByResourceIDs mocks base method.
 func (m *MockStore) GetWorkspaceAgentsByResourceIDs(arg0 context.Context, arg1 []uuid.UUID) ([]database.WorkspaceAgent, error) {
 	m.ctrl.T.Helper()
@@ -2449,6 +2714,36 @@ func (mr *MockStoreMockRecorder) GetWorkspaceBuildByWorkspaceIDAndBuildNumber(ar
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceBuildByWorkspaceIDAndBuildNumber", reflect.TypeOf((*MockStore)(nil).GetWorkspaceBuildByWorkspaceIDAndBuildNumber), arg0, arg1)
 }
 
+// GetWorkspaceBuildCapacityFallbackByBuildID mocks base method.
+func (m *MockStore) GetWorkspaceBuildCapacityFallbackByBuildID(arg0 context.Context, arg1 uuid.UUID) (database.WorkspaceBuildCapacityFallback, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceBuildCapacityFallbackByBuildID", arg0, arg1)
+	ret0, _ := ret[0].(database.WorkspaceBuildCapacityFallback)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceBuildCapacityFallbackByBuildID indicates an expected call of GetWorkspaceBuildCapacityFallbackByBuildID.
+func (mr *MockStoreMockRecorder) GetWorkspaceBuildCapacityFallbackByBuildID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceBuildCapacityFallbackByBuildID", reflect.TypeOf((*MockStore)(nil).GetWorkspaceBuildCapacityFallbackByBuildID), arg0, arg1)
+}
+
+// GetWorkspaceBuildMetadataByBuildID mocks base method.
+func (m *MockStore) GetWorkspaceBuildMetadataByBuildID(arg0 context.Context, arg1 uuid.UUID) ([]database.WorkspaceBuildMetadatum, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceBuildMetadataByBuildID", arg0, arg1)
+	ret0, _ := ret[0].([]database.WorkspaceBuildMetadatum)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceBuildMetadataByBuildID indicates an expected call of GetWorkspaceBuildMetadataByBuildID.
+func (mr *MockStoreMockRecorder) GetWorkspaceBuildMetadataByBuildID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceBuildMetadataByBuildID", reflect.TypeOf((*MockStore)(nil).GetWorkspaceBuildMetadataByBuildID), arg0, arg1)
+}
+
 // GetWorkspaceBuildParameters mocks base method.
 func (m *MockStore) GetWorkspaceBuildParameters(arg0 context.Context, arg1 uuid.UUID) ([]database.WorkspaceBuildParameter, error) {
 	m.ctrl.T.Helper()
@@ -3029,6 +3324,20 @@ func (mr *MockStoreMockRecorder) InsertProvisionerJob(arg0, arg1 any) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertProvisionerJob", reflect.TypeOf((*MockStore)(nil).InsertProvisionerJob), arg0, arg1)
 }
 
+// InsertProvisionerJobDiagnosticBundle mocks base method.
+func (m *MockStore) InsertProvisionerJobDiagnosticBundle(arg0 context.Context, arg1 database.InsertProvisionerJobDiagnosticBundleParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertProvisionerJobDiagnosticBundle", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertProvisionerJobDiagnosticBundle indicates an expected call of InsertProvisionerJobDiagnosticBundle.
+func (mr *MockStoreMockRecorder) InsertProvisionerJobDiagnosticBundle(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertProvisionerJobDiagnosticBundle", reflect.TypeOf((*MockStore)(nil).InsertProvisionerJobDiagnosticBundle), arg0, arg1)
+}
+
 // InsertProvisionerJobLogs mocks base method.
 func (m *MockStore) InsertProvisionerJobLogs(arg0 context.Context, arg1 database.InsertProvisionerJobLogsParams) ([]database.ProvisionerJobLog, error) {
 	m.ctrl.T.Helper()
@@ -3044,6 +3353,20 @@ func (mr *MockStoreMockRecorder) InsertProvisionerJobLogs(arg0, arg1 any) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertProvisionerJobLogs", reflect.TypeOf((*MockStore)(nil).InsertProvisionerJobLogs), arg0, arg1)
 }
 
+// InsertProvisionerJobWorkDirectory mocks base method.
+func (m *MockStore) InsertProvisionerJobWorkDirectory(arg0 context.Context, arg1 database.InsertProvisionerJobWorkDirectoryParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertProvisionerJobWorkDirectory", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertProvisionerJobWorkDirectory indicates an expected call of InsertProvisionerJobWorkDirectory.
+func (mr *MockStoreMockRecorder) InsertProvisionerJobWorkDirectory(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertProvisionerJobWorkDirectory", reflect.TypeOf((*MockStore)(nil).InsertProvisionerJobWorkDirectory), arg0, arg1)
+}
+
 // InsertReplica mocks base method.
 func (m *MockStore) InsertReplica(arg0 context.Context, arg1 database.InsertReplicaParams) (database.Replica, error) {
 	m.ctrl.T.Helper()
@@ -3235,6 +3558,20 @@ func (mr *MockStoreMockRecorder) InsertWorkspaceAgentMetadata(arg0, arg1 any) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWorkspaceAgentMetadata", reflect.TypeOf((*MockStore)(nil).InsertWorkspaceAgentMetadata), arg0, arg1)
 }
 
+// InsertWorkspaceAgentScriptArtifact mocks base method.
+func (m *MockStore) InsertWorkspaceAgentScriptArtifact(arg0 context.Context, arg1 database.InsertWorkspaceAgentScriptArtifactParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertWorkspaceAgentScriptArtifact", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertWorkspaceAgentScriptArtifact indicates an expected call of InsertWorkspaceAgentScriptArtifact.
+func (mr *MockStoreMockRecorder) InsertWorkspaceAgentScriptArtifact(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWorkspaceAgentScriptArtifact", reflect.TypeOf((*MockStore)(nil).InsertWorkspaceAgentScriptArtifact), arg0, arg1)
+}
+
 // InsertWorkspaceAgentScripts mocks base method.
 func (m *MockStore) InsertWorkspaceAgentScripts(arg0 context.Context, arg1 database.InsertWorkspaceAgentScriptsParams) ([]database.WorkspaceAgentScript, error) {
 	m.ctrl.T.Helper()
@@ -3279,6 +3616,21 @@ func (mr *MockStoreMockRecorder) InsertWorkspaceAgentStats(arg0, arg1 any) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWorkspaceAgentStats", reflect.TypeOf((*MockStore)(nil).InsertWorkspaceAgentStats), arg0, arg1)
 }
 
+// InsertWorkspaceAgentUpload mocks base method.
+func (m *MockStore) InsertWorkspaceAgentUpload(arg0 context.Context, arg1 database.InsertWorkspaceAgentUploadParams) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertWorkspaceAgentUpload", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertWorkspaceAgentUpload indicates an expected call of InsertWorkspaceAgentUpload.
+func (mr *MockStoreMockRecorder) InsertWorkspaceAgentUpload(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWorkspaceAgentUpload", reflect.TypeOf((*MockStore)(nil).InsertWorkspaceAgentUpload), arg0, arg1)
+}
+
 // InsertWorkspaceApp mocks base method.
 func (m *MockStore) InsertWorkspaceApp(arg0 context.Context, arg1 database.InsertWorkspaceAppParams) (database.WorkspaceApp, error) {
 	m.ctrl.T.Helper()
@@ -3322,6 +3674,34 @@ func (mr *MockStoreMockRecorder) InsertWorkspaceBuild(arg0, arg1 any) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWorkspaceBuild", reflect.TypeOf((*MockStore)(nil).InsertWorkspaceBuild), arg0, arg1)
 }
 
+// InsertWorkspaceBuildCapacityFallback mocks base method.
+func (m *MockStore) InsertWorkspaceBuildCapacityFallback(arg0 context.Context, arg1 database.InsertWorkspaceBuildCapacityFallbackParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertWorkspaceBuildCapacityFallback", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertWorkspaceBuildCapacityFallback indicates an expected call of InsertWorkspaceBuildCapacityFallback.
+func (mr *MockStoreMockRecorder) InsertWorkspaceBuildCapacityFallback(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWorkspaceBuildCapacityFallback", reflect.TypeOf((*MockStore)(nil).InsertWorkspaceBuildCapacityFallback), arg0, arg1)
+}
+
+// InsertWorkspaceBuildMetadata mocks base method.
+func (m *MockStore) InsertWorkspaceBuildMetadata(arg0 context.Context, arg1 database.InsertWorkspaceBuildMetadataParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertWorkspaceBuildMetadata", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertWorkspaceBuildMetadata indicates an expected call of InsertWorkspaceBuildMetadata.
+func (mr *MockStoreMockRecorder) InsertWorkspaceBuildMetadata(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWorkspaceBuildMetadata", reflect.TypeOf((*MockStore)(nil).InsertWorkspaceBuildMetadata), arg0, arg1)
+}
+
 // InsertWorkspaceBuildParameters mocks base method.
 func (m *MockStore) InsertWorkspaceBuildParameters(arg0 context.Context, arg1 database.InsertWorkspaceBuildParametersParams) error {
 	m.ctrl.T.Helper()
@@ -3615,6 +3995,20 @@ func (mr *MockStoreMockRecorder) UpdateProvisionerJobByID(arg0, arg1 any) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProvisionerJobByID", reflect.TypeOf((*MockStore)(nil).UpdateProvisionerJobByID), arg0, arg1)
 }
 
+// UpdateProvisionerJobCheckpointResumedByJobID mocks base method.
+func (m *MockStore) UpdateProvisionerJobCheckpointResumedByJobID(arg0 context.Context, arg1 database.UpdateProvisionerJobCheckpointResumedByJobIDParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProvisionerJobCheckpointResumedByJobID", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProvisionerJobCheckpointResumedByJobID indicates an expected call of UpdateProvisionerJobCheckpointResumedByJobID.
+func (mr *MockStoreMockRecorder) UpdateProvisionerJobCheckpointResumedByJobID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProvisionerJobCheckpointResumedByJobID", reflect.TypeOf((*MockStore)(nil).UpdateProvisionerJobCheckpointResumedByJobID), arg0, arg1)
+}
+
 // UpdateProvisionerJobWithCancelByID mocks base method.
 func (m *MockStore) UpdateProvisionerJobWithCancelByID(arg0 context.Context, arg1 database.UpdateProvisionerJobWithCancelByIDParams) error {
 	m.ctrl.T.Helper()
@@ -3643,6 +4037,20 @@ func (mr *MockStoreMockRecorder) UpdateProvisionerJobWithCompleteByID(arg0, arg1
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProvisionerJobWithCompleteByID", reflect.TypeOf((*MockStore)(nil).UpdateProvisionerJobWithCompleteByID), arg0, arg1)
 }
 
+// UpdateProvisionerJobWithRequeueByID mocks base method.
+func (m *MockStore) UpdateProvisionerJobWithRequeueByID(arg0 context.Context, arg1 database.UpdateProvisionerJobWithRequeueByIDParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProvisionerJobWithRequeueByID", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProvisionerJobWithRequeueByID indicates an expected call of UpdateProvisionerJobWithRequeueByID.
+func (mr *MockStoreMockRecorder) UpdateProvisionerJobWithRequeueByID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProvisionerJobWithRequeueByID", reflect.TypeOf((*MockStore)(nil).UpdateProvisionerJobWithRequeueByID), arg0, arg1)
+}
+
 // UpdateReplica mocks base method.
 func (m *MockStore) UpdateReplica(arg0 context.Context, arg1 database.UpdateReplicaParams) (database.Replica, error) {
 	m.ctrl.T.Helper()
@@ -4032,6 +4440,20 @@ func (mr *MockStoreMockRecorder) UpdateWorkspaceAgentMetadata(arg0, arg1 any) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateWorkspaceAgentMetadata", reflect.TypeOf((*MockStore)(nil).UpdateWorkspaceAgentMetadata), arg0, arg1)
 }
 
+// UpdateWorkspaceAgentResourceIDByID mocks base method.
+func (m *MockStore) UpdateWorkspaceAgentResourceIDByID(arg0 context.Context, arg1 database.UpdateWorkspaceAgentResourceIDByIDParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateWorkspaceAgentResourceIDByID", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateWorkspaceAgentResourceIDByID indicates an expected call of UpdateWorkspaceAgentResourceIDByID.
+func (mr *MockStoreMockRecorder) UpdateWorkspaceAgentResourceIDByID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateWorkspaceAgentResourceIDByID", reflect.TypeOf((*MockStore)(nil).UpdateWorkspaceAgentResourceIDByID), arg0, arg1)
+}
+
 // UpdateWorkspaceAgentStartupByID mocks base method.
 func (m *MockStore) UpdateWorkspaceAgentStartupByID(arg0 context.Context, arg1 database.UpdateWorkspaceAgentStartupByIDParams) error {
 	m.ctrl.T.Helper()
@@ -4357,6 +4779,20 @@ func (mr *MockStoreMockRecorder) UpsertProvisionerDaemon(arg0, arg1 any) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertProvisionerDaemon", reflect.TypeOf((*MockStore)(nil).UpsertProvisionerDaemon), arg0, arg1)
 }
 
+// UpsertProvisionerJobCheckpoint mocks base method.
+func (m *MockStore) UpsertProvisionerJobCheckpoint(arg0 context.Context, arg1 database.UpsertProvisionerJobCheckpointParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertProvisionerJobCheckpoint", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpsertProvisionerJobCheckpoint indicates an expected call of UpsertProvisionerJobCheckpoint.
+func (mr *MockStoreMockRecorder) UpsertProvisionerJobCheckpoint(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertProvisionerJobCheckpoint", reflect.TypeOf((*MockStore)(nil).UpsertProvisionerJobCheckpoint), arg0, arg1)
+}
+
 // UpsertServiceBanner mocks base method.
 func (m *MockStore) UpsertServiceBanner(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -4460,6 +4896,35 @@ func (mr *MockStoreMockRecorder) UpsertTailnetTunnel(arg0, arg1 any) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertTailnetTunnel", reflect.TypeOf((*MockStore)(nil).UpsertTailnetTunnel), arg0, arg1)
 }
 
+// UpsertTemplateVersionMetadata mocks base method.
+func (m *MockStore) UpsertTemplateVersionMetadata(arg0 context.Context, arg1 database.UpsertTemplateVersionMetadataParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertTemplateVersionMetadata", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpsertTemplateVersionMetadata indicates an expected call of UpsertTemplateVersionMetadata.
+func (mr *MockStoreMockRecorder) UpsertTemplateVersionMetadata(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertTemplateVersionMetadata", reflect.TypeOf((*MockStore)(nil).UpsertTemplateVersionMetadata), arg0, arg1)
+}
+
+// UpsertUserAuthorizedKeys mocks base method.
+func (m *MockStore) UpsertUserAuthorizedKeys(arg0 context.Context, arg1 database.UpsertUserAuthorizedKeysParams) (database.UserAuthorizedKeys, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertUserAuthorizedKeys", arg0, arg1)
+	ret0, _ := ret[0].(database.UserAuthorizedKeys)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpsertUserAuthorizedKeys indicates an expected call of UpsertUserAuthorizedKeys.
+func (mr *MockStoreMockRecorder) UpsertUserAuthorizedKeys(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertUserAuthorizedKeys", reflect.TypeOf((*MockStore)(nil).UpsertUserAuthorizedKeys), arg0, arg1)
+}
+
 // Wrappers mocks base method.
 func (m *MockStore) Wrappers() []string {
 	m.ctrl.T.Helper()
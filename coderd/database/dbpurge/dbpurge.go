@@ -45,6 +45,12 @@ func New(ctx context.Context, logger slog.Logger, db database.Store) io.Closer {
 		eg.Go(func() error {
 			return db.DeleteOldProvisionerDaemons(ctx)
 		})
+		eg.Go(func() error {
+			return db.DeleteOldWorkspaceAgentUploads(ctx)
+		})
+		eg.Go(func() error {
+			return db.DeleteOldWorkspaceAgentScriptArtifacts(ctx)
+		})
 		err := eg.Wait()
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
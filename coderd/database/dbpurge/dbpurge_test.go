@@ -3,6 +3,7 @@ package dbpurge_test
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"testing"
 	"time"
 
@@ -163,6 +164,8 @@ func mustCreateAgentWithLogs(ctx context.Context, t *testing.T, db database.Stor
 		CreatedAt: agentLastConnectedAt,
 		Output:    []string{output},
 		Level:     []database.LogLevel{database.LogLevelDebug},
+		Fields:    []string{"{}"},
+		Stream:    []string{""},
 	})
 	require.NoError(t, err)
 	return agent.ID
@@ -282,3 +285,115 @@ func containsProvisionerDaemon(daemons []database.ProvisionerDaemon, name string
 		return d.Name == name
 	})
 }
+
+func TestDeleteOldWorkspaceAgentUploads(t *testing.T) {
+	t.Parallel()
+
+	db, _ := dbtestutil.NewDB(t)
+	org := dbgen.Organization(t, db, database.Organization{})
+	user := dbgen.User(t, db, database.User{})
+	_ = dbgen.OrganizationMember(t, db, database.OrganizationMember{UserID: user.ID, OrganizationID: org.ID})
+	tv := dbgen.TemplateVersion(t, db, database.TemplateVersion{OrganizationID: org.ID, CreatedBy: user.ID})
+	tmpl := dbgen.Template(t, db, database.Template{OrganizationID: org.ID, ActiveVersionID: tv.ID, CreatedBy: user.ID})
+	agent := mustCreateAgent(t, db, user, org, tmpl, tv)
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testutil.WaitShort)
+	defer cancel()
+
+	now := dbtime.Now()
+
+	// given
+	// Upload that didn't receive a chunk for 2 days, should be deleted.
+	_, err := db.InsertWorkspaceAgentUpload(ctx, database.InsertWorkspaceAgentUploadParams{
+		WorkspaceAgentID: agent.ID,
+		Name:             "abandoned",
+		Checksum:         "sha256=abandoned",
+		Size:             10,
+		CreatedAt:        now.Add(-2 * 24 * time.Hour),
+		MaxUploads:       2,
+	})
+	require.NoError(t, err)
+	// Upload that received a chunk an hour ago, should not be deleted.
+	_, err = db.InsertWorkspaceAgentUpload(ctx, database.InsertWorkspaceAgentUploadParams{
+		WorkspaceAgentID: agent.ID,
+		Name:             "in-progress",
+		Checksum:         "sha256=in-progress",
+		Size:             10,
+		CreatedAt:        now.Add(-time.Hour),
+		MaxUploads:       2,
+	})
+	require.NoError(t, err)
+
+	// when
+	closer := dbpurge.New(ctx, logger, db)
+	defer closer.Close()
+
+	// then
+	require.Eventually(t, func() bool {
+		_, err := db.GetWorkspaceAgentUpload(ctx, database.GetWorkspaceAgentUploadParams{
+			WorkspaceAgentID: agent.ID,
+			Name:             "abandoned",
+			Checksum:         "sha256=abandoned",
+		})
+		return errors.Is(err, sql.ErrNoRows)
+	}, testutil.WaitShort, testutil.IntervalFast)
+	_, err = db.GetWorkspaceAgentUpload(ctx, database.GetWorkspaceAgentUploadParams{
+		WorkspaceAgentID: agent.ID,
+		Name:             "in-progress",
+		Checksum:         "sha256=in-progress",
+	})
+	require.NoError(t, err)
+}
+
+func TestDeleteOldWorkspaceAgentScriptArtifacts(t *testing.T) {
+	t.Parallel()
+
+	db, _ := dbtestutil.NewDB(t)
+	org := dbgen.Organization(t, db, database.Organization{})
+	user := dbgen.User(t, db, database.User{})
+	_ = dbgen.OrganizationMember(t, db, database.OrganizationMember{UserID: user.ID, OrganizationID: org.ID})
+	tv := dbgen.TemplateVersion(t, db, database.TemplateVersion{OrganizationID: org.ID, CreatedBy: user.ID})
+	tmpl := dbgen.Template(t, db, database.Template{OrganizationID: org.ID, ActiveVersionID: tv.ID, CreatedBy: user.ID})
+	agent := mustCreateAgent(t, db, user, org, tmpl, tv)
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testutil.WaitShort)
+	defer cancel()
+
+	now := dbtime.Now()
+
+	// given
+	// Artifacts of 8 days ago, should be deleted.
+	old := uuid.New()
+	err := db.InsertWorkspaceAgentScriptArtifact(ctx, database.InsertWorkspaceAgentScriptArtifactParams{
+		ID:               old,
+		WorkspaceAgentID: agent.ID,
+		LogSourceID:      uuid.New(),
+		Archive:          []byte("old"),
+		CreatedAt:        now.Add(-8 * 24 * time.Hour),
+	})
+	require.NoError(t, err)
+	// Artifacts of an hour ago, should not be deleted.
+	recent := uuid.New()
+	err = db.InsertWorkspaceAgentScriptArtifact(ctx, database.InsertWorkspaceAgentScriptArtifactParams{
+		ID:               recent,
+		WorkspaceAgentID: agent.ID,
+		LogSourceID:      uuid.New(),
+		Archive:          []byte("recent"),
+		CreatedAt:        now.Add(-time.Hour),
+	})
+	require.NoError(t, err)
+
+	// when
+	closer := dbpurge.New(ctx, logger, db)
+	defer closer.Close()
+
+	// then
+	require.Eventually(t, func() bool {
+		_, err := db.GetWorkspaceAgentScriptArtifactByID(ctx, old)
+		return errors.Is(err, sql.ErrNoRows)
+	}, testutil.WaitShort, testutil.IntervalFast)
+	_, err = db.GetWorkspaceAgentScriptArtifactByID(ctx, recent)
+	require.NoError(t, err)
+}
@@ -109,7 +109,8 @@ COMMENT ON TYPE provisioner_job_status IS 'Computed status of a provisioner job.
 CREATE TYPE provisioner_job_type AS ENUM (
     'template_version_import',
     'workspace_build',
-    'template_version_dry_run'
+    'template_version_dry_run',
+    'workspace_refresh'
 );
 
 CREATE TYPE provisioner_storage_method AS ENUM (
@@ -551,6 +552,31 @@ CREATE TABLE provisioner_daemons (
 
 COMMENT ON COLUMN provisioner_daemons.api_version IS 'The API version of the provisioner daemon';
 
+CREATE TABLE provisioner_job_checkpoints (
+    job_id uuid NOT NULL,
+    stage text NOT NULL,
+    checkpoint bytea NOT NULL,
+    resume_count integer DEFAULT 0 NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+COMMENT ON TABLE provisioner_job_checkpoints IS 'Checkpoints of running workspace builds, so a build can be resumed by another provisioner daemon.';
+
+COMMENT ON COLUMN provisioner_job_checkpoints.checkpoint IS 'The checkpoint reported by the provisioner, encoded as protobuf.';
+
+COMMENT ON COLUMN provisioner_job_checkpoints.resume_count IS 'The number of times the job was resumed from the checkpoint.';
+
+CREATE TABLE provisioner_job_diagnostic_bundles (
+    job_id uuid NOT NULL,
+    bundle bytea NOT NULL,
+    created_at timestamp with time zone NOT NULL
+);
+
+COMMENT ON TABLE provisioner_job_diagnostic_bundles IS 'Diagnostic bundles of failed workspace builds, so support escalations are self-contained.';
+
+COMMENT ON COLUMN provisioner_job_diagnostic_bundles.bundle IS 'The bundle reported by the provisioner without the work directory listing, encoded as protobuf.';
+
 CREATE TABLE provisioner_job_logs (
     job_id uuid NOT NULL,
     created_at timestamp with time zone NOT NULL,
@@ -570,6 +596,16 @@ CREATE SEQUENCE provisioner_job_logs_id_seq
 
 ALTER SEQUENCE provisioner_job_logs_id_seq OWNED BY provisioner_job_logs.id;
 
+CREATE TABLE provisioner_job_work_directories (
+    job_id uuid NOT NULL,
+    listing bytea NOT NULL,
+    created_at timestamp with time zone NOT NULL
+);
+
+COMMENT ON TABLE provisioner_job_work_directories IS 'Listings of the work directories of failed workspace builds, so they can be debugged without a shell on the provisioner host.';
+
+COMMENT ON COLUMN provisioner_job_work_directories.listing IS 'The listing reported by the provisioner, encoded as protobuf.';
+
 CREATE TABLE provisioner_jobs (
     id uuid NOT NULL,
     created_at timestamp with time zone NOT NULL,
@@ -672,6 +708,16 @@ CREATE TABLE tailnet_tunnels (
     updated_at timestamp with time zone NOT NULL
 );
 
+CREATE TABLE template_version_metadata (
+    template_version_id uuid NOT NULL,
+    display_name text NOT NULL,
+    icon text NOT NULL,
+    description text NOT NULL,
+    docs_url text NOT NULL
+);
+
+COMMENT ON TABLE template_version_metadata IS 'Metadata templates describe themselves with, applied to the template when the version is promoted.';
+
 CREATE TABLE template_version_parameters (
     template_version_id uuid NOT NULL,
     name text NOT NULL,
@@ -849,7 +895,11 @@ CREATE TABLE templates (
     autostart_block_days_of_week smallint DEFAULT 0 NOT NULL,
     require_active_version boolean DEFAULT false NOT NULL,
     deprecated text DEFAULT ''::text NOT NULL,
-    use_max_ttl boolean DEFAULT false NOT NULL
+    use_max_ttl boolean DEFAULT false NOT NULL,
+    max_app_sharing_level app_sharing_level DEFAULT 'public'::app_sharing_level NOT NULL,
+    code_server_enabled boolean DEFAULT false NOT NULL,
+    docs_url text DEFAULT ''::text NOT NULL,
+    replace_on_failure boolean DEFAULT false NOT NULL
 );
 
 COMMENT ON COLUMN templates.default_ttl IS 'The default duration for autostop for workspaces created from this template.';
@@ -870,6 +920,14 @@ COMMENT ON COLUMN templates.autostart_block_days_of_week IS 'A bitmap of days of
 
 COMMENT ON COLUMN templates.deprecated IS 'If set to a non empty string, the template will no longer be able to be used. The message will be displayed to the user.';
 
+COMMENT ON COLUMN templates.max_app_sharing_level IS 'The widest sharing level the apps of workspaces built from the template may use.';
+
+COMMENT ON COLUMN templates.code_server_enabled IS 'Whether the agents of workspaces built from the template install and supervise code-server.';
+
+COMMENT ON COLUMN templates.docs_url IS 'URL of the documentation of the template, from the metadata of the active version.';
+
+COMMENT ON COLUMN templates.replace_on_failure IS 'Whether builds replace the resources that failed to update or whose agents were unhealthy in the previous build.';
+
 CREATE VIEW template_with_users AS
  SELECT templates.id,
     templates.created_at,
@@ -899,6 +957,10 @@ CREATE VIEW template_with_users AS
     templates.require_active_version,
     templates.deprecated,
     templates.use_max_ttl,
+    templates.max_app_sharing_level,
+    templates.code_server_enabled,
+    templates.docs_url,
+    templates.replace_on_failure,
     COALESCE(visible_users.avatar_url, ''::text) AS created_by_avatar_url,
     COALESCE(visible_users.username, ''::text) AS created_by_username
    FROM (public.templates
@@ -906,6 +968,19 @@ CREATE VIEW template_with_users AS
 
 COMMENT ON VIEW template_with_users IS 'Joins in the username + avatar url of the created by user.';
 
+CREATE TABLE user_authorized_keys (
+    user_id uuid NOT NULL,
+    keys jsonb DEFAULT '[]'::jsonb NOT NULL,
+    required boolean DEFAULT false NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+COMMENT ON TABLE user_authorized_keys IS 'Public keys of a user that may authenticate to the SSH server of their workspace agents, e.g. hardware-backed keys.';
+
+COMMENT ON COLUMN user_authorized_keys.keys IS 'The public keys in the authorized_keys format, each optionally limited to a set of principals.';
+
+COMMENT ON COLUMN user_authorized_keys.required IS 'Connections authenticated by coderd must also authenticate with one of the keys.';
+
 CREATE TABLE user_links (
     user_id uuid NOT NULL,
     login_type login_type NOT NULL,
@@ -938,9 +1013,15 @@ CREATE UNLOGGED TABLE workspace_agent_logs (
     output character varying(1024) NOT NULL,
     id bigint NOT NULL,
     level log_level DEFAULT 'info'::log_level NOT NULL,
-    log_source_id uuid DEFAULT '00000000-0000-0000-0000-000000000000'::uuid NOT NULL
+    log_source_id uuid DEFAULT '00000000-0000-0000-0000-000000000000'::uuid NOT NULL,
+    fields jsonb DEFAULT '{}'::jsonb NOT NULL,
+    stream text DEFAULT ''::text NOT NULL
 );
 
+COMMENT ON COLUMN workspace_agent_logs.fields IS 'Structured key/value fields of the log, e.g. to filter logs by field.';
+
+COMMENT ON COLUMN workspace_agent_logs.stream IS 'The output stream the log was written to, either stdout or stderr, or empty if unknown.';
+
 CREATE UNLOGGED TABLE workspace_agent_metadata (
     workspace_agent_id uuid NOT NULL,
     display_name character varying(127) NOT NULL,
@@ -951,11 +1032,28 @@ CREATE UNLOGGED TABLE workspace_agent_metadata (
     timeout bigint NOT NULL,
     "interval" bigint NOT NULL,
     collected_at timestamp with time zone DEFAULT '0001-01-01 00:00:00+00'::timestamp with time zone NOT NULL,
-    display_order integer DEFAULT 0 NOT NULL
+    display_order integer DEFAULT 0 NOT NULL,
+    collector character varying(127) DEFAULT ''::character varying NOT NULL
 );
 
 COMMENT ON COLUMN workspace_agent_metadata.display_order IS 'Specifies the order in which to display agent metadata in user interfaces.';
 
+COMMENT ON COLUMN workspace_agent_metadata.collector IS 'The built-in collector of the agent that collects the metadata instead of the script.';
+
+CREATE TABLE workspace_agent_script_artifacts (
+    id uuid NOT NULL,
+    workspace_agent_id uuid NOT NULL,
+    log_source_id uuid NOT NULL,
+    archive bytea NOT NULL,
+    created_at timestamp with time zone NOT NULL
+);
+
+COMMENT ON TABLE workspace_agent_script_artifacts IS 'Files workspace agent scripts wrote to their artifacts directory, e.g. build reports.';
+
+COMMENT ON COLUMN workspace_agent_script_artifacts.log_source_id IS 'The log source of the script that produced the artifacts.';
+
+COMMENT ON COLUMN workspace_agent_script_artifacts.archive IS 'A tar archive of the artifacts directory of the script.';
+
 CREATE TABLE workspace_agent_scripts (
     workspace_agent_id uuid NOT NULL,
     log_source_id uuid NOT NULL,
@@ -966,9 +1064,27 @@ CREATE TABLE workspace_agent_scripts (
     start_blocks_login boolean NOT NULL,
     run_on_start boolean NOT NULL,
     run_on_stop boolean NOT NULL,
-    timeout_seconds integer NOT NULL
+    timeout_seconds integer NOT NULL,
+    run_on_build_success boolean DEFAULT false NOT NULL,
+    run_on_build_failure boolean DEFAULT false NOT NULL,
+    run_on_post_start boolean DEFAULT false NOT NULL,
+    login boolean DEFAULT false NOT NULL,
+    disk_pressure_path text DEFAULT ''::text NOT NULL,
+    disk_pressure_threshold integer DEFAULT 0 NOT NULL
 );
 
+COMMENT ON COLUMN workspace_agent_scripts.run_on_build_success IS 'Runs the script once the workspace build that created the agent succeeds.';
+
+COMMENT ON COLUMN workspace_agent_scripts.run_on_build_failure IS 'Runs the script once the workspace build that created the agent fails.';
+
+COMMENT ON COLUMN workspace_agent_scripts.run_on_post_start IS 'Runs the script once the agent is ready, without delaying the startup of the workspace.';
+
+COMMENT ON COLUMN workspace_agent_scripts.login IS 'Runs the script with the environment of a login shell of the user.';
+
+COMMENT ON COLUMN workspace_agent_scripts.disk_pressure_path IS 'Path whose disk usage is watched by the agent, the script runs as a cleanup script once the usage crosses disk_pressure_threshold.';
+
+COMMENT ON COLUMN workspace_agent_scripts.disk_pressure_threshold IS 'Disk usage of disk_pressure_path in percent that runs the script.';
+
 CREATE SEQUENCE workspace_agent_startup_logs_id_seq
     START WITH 1
     INCREMENT BY 1
@@ -998,6 +1114,38 @@ CREATE TABLE workspace_agent_stats (
     session_count_ssh bigint DEFAULT 0 NOT NULL
 );
 
+CREATE TABLE workspace_agent_upload_chunks (
+    workspace_agent_id uuid NOT NULL,
+    name text NOT NULL,
+    checksum text NOT NULL,
+    chunk_offset bigint NOT NULL,
+    data bytea NOT NULL
+);
+
+COMMENT ON TABLE workspace_agent_upload_chunks IS 'The chunks of files workspace agents are uploading. Chunks are stored separately so appending one doesn''t rewrite the ones received before, and are assembled once the upload completes.';
+
+COMMENT ON COLUMN workspace_agent_upload_chunks.chunk_offset IS 'The offset of the chunk in the whole file.';
+
+CREATE TABLE workspace_agent_uploads (
+    workspace_agent_id uuid NOT NULL,
+    name text NOT NULL,
+    checksum text NOT NULL,
+    size bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL,
+    received bigint DEFAULT 0 NOT NULL
+);
+
+COMMENT ON TABLE workspace_agent_uploads IS 'Files workspace agents are uploading in chunks, so an interrupted upload can be resumed. Rows are deleted once the upload completes.';
+
+COMMENT ON COLUMN workspace_agent_uploads.name IS 'Identifies what is uploaded, e.g. the artifacts of a script.';
+
+COMMENT ON COLUMN workspace_agent_uploads.checksum IS 'The checksum of the whole file, as sent in the Upload-Checksum header.';
+
+COMMENT ON COLUMN workspace_agent_uploads.size IS 'The size of the whole file in bytes.';
+
+COMMENT ON COLUMN workspace_agent_uploads.received IS 'The number of bytes received so far, the offset of the next chunk.';
+
 CREATE TABLE workspace_agents (
     id uuid NOT NULL,
     created_at timestamp with time zone NOT NULL,
@@ -1029,6 +1177,7 @@ CREATE TABLE workspace_agents (
     subsystems workspace_agent_subsystem[] DEFAULT '{}'::workspace_agent_subsystem[],
     display_apps display_app[] DEFAULT '{vscode,vscode_insiders,web_terminal,ssh_helper,port_forwarding_helper}'::display_app[],
     api_version text DEFAULT ''::text NOT NULL,
+    troubleshooting_urls jsonb DEFAULT '{}'::jsonb NOT NULL,
     CONSTRAINT max_logs_length CHECK ((logs_length <= 1048576)),
     CONSTRAINT subsystems_not_none CHECK ((NOT ('none'::workspace_agent_subsystem = ANY (subsystems))))
 );
@@ -1053,6 +1202,8 @@ COMMENT ON COLUMN workspace_agents.started_at IS 'The time the agent entered the
 
 COMMENT ON COLUMN workspace_agents.ready_at IS 'The time the agent entered the ready or start_error lifecycle state';
 
+COMMENT ON COLUMN workspace_agents.troubleshooting_urls IS 'URLs for troubleshooting specific failures of the agent by class of failure, they override troubleshooting_url.';
+
 CREATE TABLE workspace_app_stats (
     id bigint NOT NULL,
     user_id uuid NOT NULL,
@@ -1113,21 +1264,59 @@ CREATE TABLE workspace_apps (
     sharing_level app_sharing_level DEFAULT 'owner'::app_sharing_level NOT NULL,
     slug text NOT NULL,
     external boolean DEFAULT false NOT NULL,
-    display_order integer DEFAULT 0 NOT NULL
+    display_order integer DEFAULT 0 NOT NULL,
+    health_latency_ms double precision DEFAULT 0 NOT NULL,
+    health_error text DEFAULT ''::text NOT NULL,
+    health_checked_at timestamp with time zone
 );
 
 COMMENT ON COLUMN workspace_apps.display_order IS 'Specifies the order in which to display agent app in user interfaces.';
 
+COMMENT ON COLUMN workspace_apps.health_latency_ms IS 'How long the latest healthcheck reported by the agent took.';
+
+COMMENT ON COLUMN workspace_apps.health_error IS 'Why the latest healthcheck reported by the agent failed, empty if it succeeded.';
+
+COMMENT ON COLUMN workspace_apps.health_checked_at IS 'When the latest healthcheck reported by the agent ran, null if none was reported.';
+
+CREATE TABLE workspace_build_capacity_fallbacks (
+    workspace_build_id uuid NOT NULL,
+    selected text NOT NULL,
+    attempts jsonb DEFAULT '[]'::jsonb NOT NULL
+);
+
+COMMENT ON TABLE workspace_build_capacity_fallbacks IS 'The capacity options tried by builds of templates that set coder_capacity_fallback.';
+
+COMMENT ON COLUMN workspace_build_capacity_fallbacks.selected IS 'The capacity option the build succeeded with. Later builds of the workspace start with it.';
+
+COMMENT ON COLUMN workspace_build_capacity_fallbacks.attempts IS 'The options that ran out of capacity before the selected one, with their errors.';
+
+CREATE TABLE workspace_build_metadata (
+    workspace_build_id uuid NOT NULL,
+    key text NOT NULL,
+    value text NOT NULL,
+    sensitive boolean NOT NULL,
+    display_order integer NOT NULL
+);
+
+COMMENT ON TABLE workspace_build_metadata IS 'Metadata of workspace builds converted from the outputs of the template.';
+
+COMMENT ON COLUMN workspace_build_metadata.value IS 'The value of the output, empty for sensitive outputs since their values are never sent to coderd.';
+
+COMMENT ON COLUMN workspace_build_metadata.display_order IS 'Outputs are ordered by name.';
+
 CREATE TABLE workspace_build_parameters (
     workspace_build_id uuid NOT NULL,
     name text NOT NULL,
-    value text NOT NULL
+    value text NOT NULL,
+    source text DEFAULT ''::text NOT NULL
 );
 
 COMMENT ON COLUMN workspace_build_parameters.name IS 'Parameter name';
 
 COMMENT ON COLUMN workspace_build_parameters.value IS 'Parameter value';
 
+COMMENT ON COLUMN workspace_build_parameters.source IS 'Where the value came from: template_default, previous_build or user_input, or empty if unknown.';
+
 CREATE TABLE workspace_builds (
     id uuid NOT NULL,
     created_at timestamp with time zone NOT NULL,
@@ -1211,9 +1400,15 @@ CREATE TABLE workspace_resource_metadata (
     key character varying(1024) NOT NULL,
     value character varying(65536),
     sensitive boolean NOT NULL,
-    id bigint NOT NULL
+    id bigint NOT NULL,
+    display_order integer DEFAULT 0 NOT NULL,
+    display_group text DEFAULT ''::text NOT NULL
 );
 
+COMMENT ON COLUMN workspace_resource_metadata.display_order IS 'Specifies the order in which to display resource metadata in user interfaces.';
+
+COMMENT ON COLUMN workspace_resource_metadata.display_group IS 'Groups related resource metadata in user interfaces.';
+
 CREATE SEQUENCE workspace_resource_metadata_id_seq
     START WITH 1
     INCREMENT BY 1
@@ -1233,9 +1428,15 @@ CREATE TABLE workspace_resources (
     hide boolean DEFAULT false NOT NULL,
     icon character varying(256) DEFAULT ''::character varying NOT NULL,
     instance_type character varying(256),
-    daily_cost integer DEFAULT 0 NOT NULL
+    daily_cost integer DEFAULT 0 NOT NULL,
+    action text DEFAULT ''::text NOT NULL,
+    address text DEFAULT ''::text NOT NULL
 );
 
+COMMENT ON COLUMN workspace_resources.action IS 'The change the build made to the resource: no_op, create, update, replace or delete, or empty if unknown.';
+
+COMMENT ON COLUMN workspace_resources.address IS 'The Terraform address of the resource, including its module path and index, or empty if unknown.';
+
 CREATE TABLE workspaces (
     id uuid NOT NULL,
     created_at timestamp with time zone NOT NULL,
@@ -1349,9 +1550,18 @@ ALTER TABLE ONLY parameter_values
 ALTER TABLE ONLY provisioner_daemons
     ADD CONSTRAINT provisioner_daemons_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY provisioner_job_checkpoints
+    ADD CONSTRAINT provisioner_job_checkpoints_pkey PRIMARY KEY (job_id);
+
+ALTER TABLE ONLY provisioner_job_diagnostic_bundles
+    ADD CONSTRAINT provisioner_job_diagnostic_bundles_pkey PRIMARY KEY (job_id);
+
 ALTER TABLE ONLY provisioner_job_logs
     ADD CONSTRAINT provisioner_job_logs_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY provisioner_job_work_directories
+    ADD CONSTRAINT provisioner_job_work_directories_pkey PRIMARY KEY (job_id);
+
 ALTER TABLE ONLY provisioner_jobs
     ADD CONSTRAINT provisioner_jobs_pkey PRIMARY KEY (id);
 
@@ -1376,6 +1586,9 @@ ALTER TABLE ONLY tailnet_peers
 ALTER TABLE ONLY tailnet_tunnels
     ADD CONSTRAINT tailnet_tunnels_pkey PRIMARY KEY (coordinator_id, src_id, dst_id);
 
+ALTER TABLE ONLY template_version_metadata
+    ADD CONSTRAINT template_version_metadata_pkey PRIMARY KEY (template_version_id);
+
 ALTER TABLE ONLY template_version_parameters
     ADD CONSTRAINT template_version_parameters_template_version_id_name_key UNIQUE (template_version_id, name);
 
@@ -1391,6 +1604,9 @@ ALTER TABLE ONLY template_versions
 ALTER TABLE ONLY templates
     ADD CONSTRAINT templates_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY user_authorized_keys
+    ADD CONSTRAINT user_authorized_keys_pkey PRIMARY KEY (user_id);
+
 ALTER TABLE ONLY user_links
     ADD CONSTRAINT user_links_pkey PRIMARY KEY (user_id, login_type);
 
@@ -1403,9 +1619,18 @@ ALTER TABLE ONLY workspace_agent_log_sources
 ALTER TABLE ONLY workspace_agent_metadata
     ADD CONSTRAINT workspace_agent_metadata_pkey PRIMARY KEY (workspace_agent_id, key);
 
+ALTER TABLE ONLY workspace_agent_script_artifacts
+    ADD CONSTRAINT workspace_agent_script_artifacts_pkey PRIMARY KEY (id);
+
 ALTER TABLE ONLY workspace_agent_logs
     ADD CONSTRAINT workspace_agent_startup_logs_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY workspace_agent_upload_chunks
+    ADD CONSTRAINT workspace_agent_upload_chunks_pkey PRIMARY KEY (workspace_agent_id, name, checksum, chunk_offset);
+
+ALTER TABLE ONLY workspace_agent_uploads
+    ADD CONSTRAINT workspace_agent_uploads_pkey PRIMARY KEY (workspace_agent_id, name, checksum);
+
 ALTER TABLE ONLY workspace_agents
     ADD CONSTRAINT workspace_agents_pkey PRIMARY KEY (id);
 
@@ -1421,6 +1646,12 @@ ALTER TABLE ONLY workspace_apps
 ALTER TABLE ONLY workspace_apps
     ADD CONSTRAINT workspace_apps_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY workspace_build_capacity_fallbacks
+    ADD CONSTRAINT workspace_build_capacity_fallbacks_pkey PRIMARY KEY (workspace_build_id);
+
+ALTER TABLE ONLY workspace_build_metadata
+    ADD CONSTRAINT workspace_build_metadata_pkey PRIMARY KEY (workspace_build_id, key);
+
 ALTER TABLE ONLY workspace_build_parameters
     ADD CONSTRAINT workspace_build_parameters_workspace_build_id_name_key UNIQUE (workspace_build_id, name);
 
@@ -1499,6 +1730,8 @@ CREATE UNIQUE INDEX users_email_lower_idx ON users USING btree (lower(email)) WH
 
 CREATE UNIQUE INDEX users_username_lower_idx ON users USING btree (lower(username)) WHERE (deleted = false);
 
+CREATE INDEX workspace_agent_script_artifacts_workspace_agent_id_idx ON workspace_agent_script_artifacts USING btree (workspace_agent_id);
+
 CREATE INDEX workspace_agent_startup_logs_id_agent_id_idx ON workspace_agent_logs USING btree (agent_id, id);
 
 CREATE INDEX workspace_agent_stats_template_id_created_at_user_id_idx ON workspace_agent_stats USING btree (template_id, created_at, user_id) INCLUDE (session_count_vscode, session_count_jetbrains, session_count_reconnecting_pty, session_count_ssh, connection_median_latency_ms) WHERE (connection_count > 0);
@@ -1572,9 +1805,18 @@ ALTER TABLE ONLY organization_members
 ALTER TABLE ONLY parameter_schemas
     ADD CONSTRAINT parameter_schemas_job_id_fkey FOREIGN KEY (job_id) REFERENCES provisioner_jobs(id) ON DELETE CASCADE;
 
+ALTER TABLE ONLY provisioner_job_checkpoints
+    ADD CONSTRAINT provisioner_job_checkpoints_job_id_fkey FOREIGN KEY (job_id) REFERENCES provisioner_jobs(id) ON DELETE CASCADE;
+
+ALTER TABLE ONLY provisioner_job_diagnostic_bundles
+    ADD CONSTRAINT provisioner_job_diagnostic_bundles_job_id_fkey FOREIGN KEY (job_id) REFERENCES provisioner_jobs(id) ON DELETE CASCADE;
+
 ALTER TABLE ONLY provisioner_job_logs
     ADD CONSTRAINT provisioner_job_logs_job_id_fkey FOREIGN KEY (job_id) REFERENCES provisioner_jobs(id) ON DELETE CASCADE;
 
+ALTER TABLE ONLY provisioner_job_work_directories
+    ADD CONSTRAINT provisioner_job_work_directories_job_id_fkey FOREIGN KEY (job_id) REFERENCES provisioner_jobs(id) ON DELETE CASCADE;
+
 ALTER TABLE ONLY provisioner_jobs
     ADD CONSTRAINT provisioner_jobs_organization_id_fkey FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE;
 
@@ -1593,6 +1835,9 @@ ALTER TABLE ONLY tailnet_peers
 ALTER TABLE ONLY tailnet_tunnels
     ADD CONSTRAINT tailnet_tunnels_coordinator_id_fkey FOREIGN KEY (coordinator_id) REFERENCES tailnet_coordinators(id) ON DELETE CASCADE;
 
+ALTER TABLE ONLY template_version_metadata
+    ADD CONSTRAINT template_version_metadata_template_version_id_fkey FOREIGN KEY (template_version_id) REFERENCES template_versions(id) ON DELETE CASCADE;
+
 ALTER TABLE ONLY template_version_parameters
     ADD CONSTRAINT template_version_parameters_template_version_id_fkey FOREIGN KEY (template_version_id) REFERENCES template_versions(id) ON DELETE CASCADE;
 
@@ -1614,6 +1859,9 @@ ALTER TABLE ONLY templates
 ALTER TABLE ONLY templates
     ADD CONSTRAINT templates_organization_id_fkey FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE;
 
+ALTER TABLE ONLY user_authorized_keys
+    ADD CONSTRAINT user_authorized_keys_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
 ALTER TABLE ONLY user_links
     ADD CONSTRAINT user_links_oauth_access_token_key_id_fkey FOREIGN KEY (oauth_access_token_key_id) REFERENCES dbcrypt_keys(active_key_digest);
 
@@ -1629,12 +1877,21 @@ ALTER TABLE ONLY workspace_agent_log_sources
 ALTER TABLE ONLY workspace_agent_metadata
     ADD CONSTRAINT workspace_agent_metadata_workspace_agent_id_fkey FOREIGN KEY (workspace_agent_id) REFERENCES workspace_agents(id) ON DELETE CASCADE;
 
+ALTER TABLE ONLY workspace_agent_script_artifacts
+    ADD CONSTRAINT workspace_agent_script_artifacts_workspace_agent_id_fkey FOREIGN KEY (workspace_agent_id) REFERENCES workspace_agents(id) ON DELETE CASCADE;
+
 ALTER TABLE ONLY workspace_agent_scripts
     ADD CONSTRAINT workspace_agent_scripts_workspace_agent_id_fkey FOREIGN KEY (workspace_agent_id) REFERENCES workspace_agents(id) ON DELETE CASCADE;
 
 ALTER TABLE ONLY workspace_agent_logs
     ADD CONSTRAINT workspace_agent_startup_logs_agent_id_fkey FOREIGN KEY (agent_id) REFERENCES workspace_agents(id) ON DELETE CASCADE;
 
+ALTER TABLE ONLY workspace_agent_upload_chunks
+    ADD CONSTRAINT workspace_agent_upload_chunks_upload_fkey FOREIGN KEY (workspace_agent_id, name, checksum) REFERENCES workspace_agent_uploads(workspace_agent_id, name, checksum) ON DELETE CASCADE;
+
+ALTER TABLE ONLY workspace_agent_uploads
+    ADD CONSTRAINT workspace_agent_uploads_workspace_agent_id_fkey FOREIGN KEY (workspace_agent_id) REFERENCES workspace_agents(id) ON DELETE CASCADE;
+
 ALTER TABLE ONLY workspace_agents
     ADD CONSTRAINT workspace_agents_resource_id_fkey FOREIGN KEY (resource_id) REFERENCES workspace_resources(id) ON DELETE CASCADE;
 
@@ -1650,6 +1907,12 @@ ALTER TABLE ONLY workspace_app_stats
 ALTER TABLE ONLY workspace_apps
     ADD CONSTRAINT workspace_apps_agent_id_fkey FOREIGN KEY (agent_id) REFERENCES workspace_agents(id) ON DELETE CASCADE;
 
+ALTER TABLE ONLY workspace_build_capacity_fallbacks
+    ADD CONSTRAINT workspace_build_capacity_fallbacks_workspace_build_id_fkey FOREIGN KEY (workspace_build_id) REFERENCES workspace_builds(id) ON DELETE CASCADE;
+
+ALTER TABLE ONLY workspace_build_metadata
+    ADD CONSTRAINT workspace_build_metadata_workspace_build_id_fkey FOREIGN KEY (workspace_build_id) REFERENCES workspace_builds(id) ON DELETE CASCADE;
+
 ALTER TABLE ONLY workspace_build_parameters
     ADD CONSTRAINT workspace_build_parameters_workspace_build_id_fkey FOREIGN KEY (workspace_build_id) REFERENCES workspace_builds(id) ON DELETE CASCADE;
 
@@ -0,0 +1,3 @@
+ALTER TABLE workspace_resource_metadata
+	DROP COLUMN display_order,
+	DROP COLUMN display_group;
@@ -0,0 +1,9 @@
+ALTER TABLE workspace_resource_metadata
+	ADD COLUMN display_order integer NOT NULL DEFAULT 0,
+	ADD COLUMN display_group text NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN workspace_resource_metadata.display_order
+IS 'Specifies the order in which to display resource metadata in user interfaces.';
+
+COMMENT ON COLUMN workspace_resource_metadata.display_group
+IS 'Groups related resource metadata in user interfaces.';
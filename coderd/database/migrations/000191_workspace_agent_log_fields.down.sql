@@ -0,0 +1,2 @@
+ALTER TABLE workspace_agent_logs
+	DROP COLUMN fields;
@@ -0,0 +1,5 @@
+ALTER TABLE workspace_agent_logs
+	ADD COLUMN fields jsonb NOT NULL DEFAULT '{}'::jsonb;
+
+COMMENT ON COLUMN workspace_agent_logs.fields
+IS 'Structured key/value fields of the log, e.g. to filter logs by field.';
@@ -0,0 +1,3 @@
+ALTER TABLE workspace_agent_scripts
+	DROP COLUMN run_on_build_success,
+	DROP COLUMN run_on_build_failure;
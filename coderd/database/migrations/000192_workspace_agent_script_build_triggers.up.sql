@@ -0,0 +1,9 @@
+ALTER TABLE workspace_agent_scripts
+	ADD COLUMN run_on_build_success boolean NOT NULL DEFAULT false,
+	ADD COLUMN run_on_build_failure boolean NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN workspace_agent_scripts.run_on_build_success
+IS 'Runs the script once the workspace build that created the agent succeeds.';
+
+COMMENT ON COLUMN workspace_agent_scripts.run_on_build_failure
+IS 'Runs the script once the workspace build that created the agent fails.';
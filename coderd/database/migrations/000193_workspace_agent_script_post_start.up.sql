@@ -0,0 +1,5 @@
+ALTER TABLE workspace_agent_scripts
+	ADD COLUMN run_on_post_start boolean NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN workspace_agent_scripts.run_on_post_start
+IS 'Runs the script once the agent is ready, without delaying the startup of the workspace.';
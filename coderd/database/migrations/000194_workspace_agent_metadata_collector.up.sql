@@ -0,0 +1,5 @@
+ALTER TABLE workspace_agent_metadata
+	ADD COLUMN collector varchar(127) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN workspace_agent_metadata.collector
+IS 'The built-in collector of the agent that collects the metadata instead of the script.';
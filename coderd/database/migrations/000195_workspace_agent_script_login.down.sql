@@ -0,0 +1,2 @@
+ALTER TABLE workspace_agent_scripts
+	DROP COLUMN login;
@@ -0,0 +1,5 @@
+ALTER TABLE workspace_agent_scripts
+	ADD COLUMN login boolean NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN workspace_agent_scripts.login
+IS 'Runs the script with the environment of a login shell of the user.';
@@ -0,0 +1,14 @@
+CREATE TABLE provisioner_job_checkpoints (
+	job_id uuid NOT NULL PRIMARY KEY REFERENCES provisioner_jobs (id) ON DELETE CASCADE,
+	stage text NOT NULL,
+	checkpoint bytea NOT NULL,
+	resume_count integer NOT NULL DEFAULT 0,
+	created_at timestamp with time zone NOT NULL,
+	updated_at timestamp with time zone NOT NULL
+);
+
+COMMENT ON TABLE provisioner_job_checkpoints IS 'Checkpoints of running workspace builds, so a build can be resumed by another provisioner daemon.';
+
+COMMENT ON COLUMN provisioner_job_checkpoints.checkpoint IS 'The checkpoint reported by the provisioner, encoded as protobuf.';
+
+COMMENT ON COLUMN provisioner_job_checkpoints.resume_count IS 'The number of times the job was resumed from the checkpoint.';
@@ -0,0 +1,5 @@
+ALTER TABLE workspace_agents
+	ADD COLUMN troubleshooting_urls jsonb NOT NULL DEFAULT '{}'::jsonb;
+
+COMMENT ON COLUMN workspace_agents.troubleshooting_urls
+IS 'URLs for troubleshooting specific failures of the agent by class of failure, they override troubleshooting_url.';
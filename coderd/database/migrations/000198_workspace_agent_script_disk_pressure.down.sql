@@ -0,0 +1,3 @@
+ALTER TABLE workspace_agent_scripts
+	DROP COLUMN disk_pressure_path,
+	DROP COLUMN disk_pressure_threshold;
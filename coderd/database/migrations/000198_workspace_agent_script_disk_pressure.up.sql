@@ -0,0 +1,9 @@
+ALTER TABLE workspace_agent_scripts
+	ADD COLUMN disk_pressure_path text NOT NULL DEFAULT '',
+	ADD COLUMN disk_pressure_threshold integer NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN workspace_agent_scripts.disk_pressure_path
+IS 'Path whose disk usage is watched by the agent, the script runs as a cleanup script once the usage crosses disk_pressure_threshold.';
+
+COMMENT ON COLUMN workspace_agent_scripts.disk_pressure_threshold
+IS 'Disk usage of disk_pressure_path in percent that runs the script.';
@@ -0,0 +1,20 @@
+CREATE TABLE workspace_agent_uploads (
+	workspace_agent_id uuid NOT NULL REFERENCES workspace_agents (id) ON DELETE CASCADE,
+	name text NOT NULL,
+	checksum text NOT NULL,
+	size bigint NOT NULL,
+	data bytea NOT NULL DEFAULT ''::bytea,
+	created_at timestamp with time zone NOT NULL,
+	updated_at timestamp with time zone NOT NULL,
+	PRIMARY KEY (workspace_agent_id, name, checksum)
+);
+
+COMMENT ON TABLE workspace_agent_uploads IS 'Files workspace agents are uploading in chunks, so an interrupted upload can be resumed. Rows are deleted once the upload completes.';
+
+COMMENT ON COLUMN workspace_agent_uploads.name IS 'Identifies what is uploaded, e.g. the artifacts of a script.';
+
+COMMENT ON COLUMN workspace_agent_uploads.checksum IS 'The checksum of the whole file, as sent in the Upload-Checksum header.';
+
+COMMENT ON COLUMN workspace_agent_uploads.size IS 'The size of the whole file in bytes.';
+
+COMMENT ON COLUMN workspace_agent_uploads.data IS 'The chunks received so far.';
@@ -0,0 +1,9 @@
+CREATE TABLE provisioner_job_work_directories (
+	job_id uuid NOT NULL PRIMARY KEY REFERENCES provisioner_jobs (id) ON DELETE CASCADE,
+	listing bytea NOT NULL,
+	created_at timestamp with time zone NOT NULL
+);
+
+COMMENT ON TABLE provisioner_job_work_directories IS 'Listings of the work directories of failed workspace builds, so they can be debugged without a shell on the provisioner host.';
+
+COMMENT ON COLUMN provisioner_job_work_directories.listing IS 'The listing reported by the provisioner, encoded as protobuf.';
@@ -0,0 +1,2 @@
+-- This has to be outside a transaction
+ALTER TYPE provisioner_job_type ADD VALUE IF NOT EXISTS 'workspace_refresh';
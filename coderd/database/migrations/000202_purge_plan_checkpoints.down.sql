@@ -0,0 +1 @@
+-- noop, purged checkpoints can't be restored
@@ -0,0 +1,4 @@
+-- Plan checkpoints contained the plan, state and agent tokens of the build
+-- in plaintext, including the values of secret variables. Only init
+-- checkpoints are persisted now.
+DELETE FROM provisioner_job_checkpoints WHERE stage <> 'init';
@@ -0,0 +1 @@
+DROP TABLE workspace_agent_script_artifacts;
@@ -0,0 +1,15 @@
+CREATE TABLE workspace_agent_script_artifacts (
+	id uuid NOT NULL PRIMARY KEY,
+	workspace_agent_id uuid NOT NULL REFERENCES workspace_agents (id) ON DELETE CASCADE,
+	log_source_id uuid NOT NULL,
+	archive bytea NOT NULL,
+	created_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX workspace_agent_script_artifacts_workspace_agent_id_idx ON workspace_agent_script_artifacts (workspace_agent_id);
+
+COMMENT ON TABLE workspace_agent_script_artifacts IS 'Files workspace agent scripts wrote to their artifacts directory, e.g. build reports.';
+
+COMMENT ON COLUMN workspace_agent_script_artifacts.log_source_id IS 'The log source of the script that produced the artifacts.';
+
+COMMENT ON COLUMN workspace_agent_script_artifacts.archive IS 'A tar archive of the artifacts directory of the script.';
@@ -0,0 +1,12 @@
+CREATE TABLE user_authorized_keys (
+	user_id uuid NOT NULL PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	keys jsonb DEFAULT '[]'::jsonb NOT NULL,
+	required boolean DEFAULT false NOT NULL,
+	updated_at timestamp with time zone NOT NULL
+);
+
+COMMENT ON TABLE user_authorized_keys IS 'Public keys of a user that may authenticate to the SSH server of their workspace agents, e.g. hardware-backed keys.';
+
+COMMENT ON COLUMN user_authorized_keys.keys IS 'The public keys in the authorized_keys format, each optionally limited to a set of principals.';
+
+COMMENT ON COLUMN user_authorized_keys.required IS 'Connections authenticated by coderd must also authenticate with one of the keys.';
@@ -0,0 +1,21 @@
+ALTER TABLE templates ADD COLUMN max_app_sharing_level app_sharing_level NOT NULL DEFAULT 'public'::app_sharing_level;
+
+COMMENT ON COLUMN templates.max_app_sharing_level IS 'The widest sharing level the apps of workspaces built from the template may use.';
+
+DROP VIEW template_with_users;
+
+CREATE VIEW
+    template_with_users
+AS
+    SELECT
+        templates.*,
+		coalesce(visible_users.avatar_url, '') AS created_by_avatar_url,
+		coalesce(visible_users.username, '') AS created_by_username
+    FROM
+        templates
+    LEFT JOIN
+		visible_users
+	ON
+	    templates.created_by = visible_users.id;
+
+COMMENT ON VIEW template_with_users IS 'Joins in the username + avatar url of the created by user.';
@@ -0,0 +1,18 @@
+ALTER TABLE workspace_agent_uploads ADD COLUMN data bytea NOT NULL DEFAULT ''::bytea;
+
+COMMENT ON COLUMN workspace_agent_uploads.data IS 'The chunks received so far.';
+
+UPDATE workspace_agent_uploads SET data = chunks.data
+FROM (
+	SELECT workspace_agent_id, name, checksum, string_agg(data, ''::bytea ORDER BY chunk_offset) AS data
+	FROM workspace_agent_upload_chunks
+	GROUP BY workspace_agent_id, name, checksum
+) AS chunks
+WHERE
+	workspace_agent_uploads.workspace_agent_id = chunks.workspace_agent_id
+	AND workspace_agent_uploads.name = chunks.name
+	AND workspace_agent_uploads.checksum = chunks.checksum;
+
+ALTER TABLE workspace_agent_uploads DROP COLUMN received;
+
+DROP TABLE workspace_agent_upload_chunks;
@@ -0,0 +1,24 @@
+CREATE TABLE workspace_agent_upload_chunks (
+	workspace_agent_id uuid NOT NULL,
+	name text NOT NULL,
+	checksum text NOT NULL,
+	chunk_offset bigint NOT NULL,
+	data bytea NOT NULL,
+	PRIMARY KEY (workspace_agent_id, name, checksum, chunk_offset),
+	CONSTRAINT workspace_agent_upload_chunks_upload_fkey FOREIGN KEY (workspace_agent_id, name, checksum) REFERENCES workspace_agent_uploads (workspace_agent_id, name, checksum) ON DELETE CASCADE
+);
+
+COMMENT ON TABLE workspace_agent_upload_chunks IS 'The chunks of files workspace agents are uploading. Chunks are stored separately so appending one doesn''t rewrite the ones received before, and are assembled once the upload completes.';
+
+COMMENT ON COLUMN workspace_agent_upload_chunks.chunk_offset IS 'The offset of the chunk in the whole file.';
+
+ALTER TABLE workspace_agent_uploads ADD COLUMN received bigint NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN workspace_agent_uploads.received IS 'The number of bytes received so far, the offset of the next chunk.';
+
+INSERT INTO workspace_agent_upload_chunks (workspace_agent_id, name, checksum, chunk_offset, data)
+SELECT workspace_agent_id, name, checksum, 0, data FROM workspace_agent_uploads WHERE octet_length(data) > 0;
+
+UPDATE workspace_agent_uploads SET received = octet_length(data);
+
+ALTER TABLE workspace_agent_uploads DROP COLUMN data;
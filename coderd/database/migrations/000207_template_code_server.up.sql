@@ -0,0 +1,21 @@
+ALTER TABLE templates ADD COLUMN code_server_enabled boolean NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN templates.code_server_enabled IS 'Whether the agents of workspaces built from the template install and supervise code-server.';
+
+DROP VIEW template_with_users;
+
+CREATE VIEW
+    template_with_users
+AS
+    SELECT
+        templates.*,
+		coalesce(visible_users.avatar_url, '') AS created_by_avatar_url,
+		coalesce(visible_users.username, '') AS created_by_username
+    FROM
+        templates
+    LEFT JOIN
+		visible_users
+	ON
+	    templates.created_by = visible_users.id;
+
+COMMENT ON VIEW template_with_users IS 'Joins in the username + avatar url of the created by user.';
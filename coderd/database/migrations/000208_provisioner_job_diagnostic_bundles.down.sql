@@ -0,0 +1 @@
+DROP TABLE provisioner_job_diagnostic_bundles;
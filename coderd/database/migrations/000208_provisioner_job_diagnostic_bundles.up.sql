@@ -0,0 +1,9 @@
+CREATE TABLE provisioner_job_diagnostic_bundles (
+	job_id uuid NOT NULL PRIMARY KEY REFERENCES provisioner_jobs (id) ON DELETE CASCADE,
+	bundle bytea NOT NULL,
+	created_at timestamp with time zone NOT NULL
+);
+
+COMMENT ON TABLE provisioner_job_diagnostic_bundles IS 'Diagnostic bundles of failed workspace builds, so support escalations are self-contained.';
+
+COMMENT ON COLUMN provisioner_job_diagnostic_bundles.bundle IS 'The bundle reported by the provisioner without the work directory listing, encoded as protobuf.';
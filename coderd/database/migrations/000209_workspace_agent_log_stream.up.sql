@@ -0,0 +1,5 @@
+ALTER TABLE workspace_agent_logs
+	ADD COLUMN stream text NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN workspace_agent_logs.stream
+IS 'The output stream the log was written to, either stdout or stderr, or empty if unknown.';
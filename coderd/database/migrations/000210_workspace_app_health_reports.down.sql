@@ -0,0 +1,4 @@
+ALTER TABLE workspace_apps
+	DROP COLUMN health_checked_at,
+	DROP COLUMN health_error,
+	DROP COLUMN health_latency_ms;
@@ -0,0 +1,10 @@
+ALTER TABLE workspace_apps
+	ADD COLUMN health_latency_ms double precision NOT NULL DEFAULT 0,
+	ADD COLUMN health_error text NOT NULL DEFAULT '',
+	ADD COLUMN health_checked_at timestamp with time zone;
+
+COMMENT ON COLUMN workspace_apps.health_latency_ms IS 'How long the latest healthcheck reported by the agent took.';
+
+COMMENT ON COLUMN workspace_apps.health_error IS 'Why the latest healthcheck reported by the agent failed, empty if it succeeded.';
+
+COMMENT ON COLUMN workspace_apps.health_checked_at IS 'When the latest healthcheck reported by the agent ran, null if none was reported.';
@@ -0,0 +1,14 @@
+CREATE TABLE workspace_build_metadata (
+	workspace_build_id uuid NOT NULL REFERENCES workspace_builds (id) ON DELETE CASCADE,
+	key text NOT NULL,
+	value text NOT NULL,
+	sensitive boolean NOT NULL,
+	display_order integer NOT NULL,
+	PRIMARY KEY (workspace_build_id, key)
+);
+
+COMMENT ON TABLE workspace_build_metadata IS 'Metadata of workspace builds converted from the outputs of the template.';
+
+COMMENT ON COLUMN workspace_build_metadata.value IS 'The value of the output, empty for sensitive outputs since their values are never sent to coderd.';
+
+COMMENT ON COLUMN workspace_build_metadata.display_order IS 'Outputs are ordered by name.';
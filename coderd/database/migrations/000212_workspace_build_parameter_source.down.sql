@@ -0,0 +1,2 @@
+ALTER TABLE workspace_build_parameters
+	DROP COLUMN source;
@@ -0,0 +1,5 @@
+ALTER TABLE workspace_build_parameters
+	ADD COLUMN source text NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN workspace_build_parameters.source
+IS 'Where the value came from: template_default, previous_build or user_input, or empty if unknown.';
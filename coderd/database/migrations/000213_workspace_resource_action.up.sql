@@ -0,0 +1,5 @@
+ALTER TABLE workspace_resources
+	ADD COLUMN action text NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN workspace_resources.action
+IS 'The change the build made to the resource: no_op, create, update, replace or delete, or empty if unknown.';
@@ -0,0 +1,11 @@
+CREATE TABLE workspace_build_capacity_fallbacks (
+	workspace_build_id uuid NOT NULL PRIMARY KEY REFERENCES workspace_builds (id) ON DELETE CASCADE,
+	selected text NOT NULL,
+	attempts jsonb NOT NULL DEFAULT '[]'::jsonb
+);
+
+COMMENT ON TABLE workspace_build_capacity_fallbacks IS 'The capacity options tried by builds of templates that set coder_capacity_fallback.';
+
+COMMENT ON COLUMN workspace_build_capacity_fallbacks.selected IS 'The capacity option the build succeeded with. Later builds of the workspace start with it.';
+
+COMMENT ON COLUMN workspace_build_capacity_fallbacks.attempts IS 'The options that ran out of capacity before the selected one, with their errors.';
@@ -0,0 +1,31 @@
+CREATE TABLE template_version_metadata (
+	template_version_id uuid NOT NULL PRIMARY KEY REFERENCES template_versions (id) ON DELETE CASCADE,
+	display_name text NOT NULL,
+	icon text NOT NULL,
+	description text NOT NULL,
+	docs_url text NOT NULL
+);
+
+COMMENT ON TABLE template_version_metadata IS 'Metadata templates describe themselves with, applied to the template when the version is promoted.';
+
+ALTER TABLE templates ADD COLUMN docs_url text NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN templates.docs_url IS 'URL of the documentation of the template, from the metadata of the active version.';
+
+DROP VIEW template_with_users;
+
+CREATE VIEW
+    template_with_users
+AS
+    SELECT
+        templates.*,
+		coalesce(visible_users.avatar_url, '') AS created_by_avatar_url,
+		coalesce(visible_users.username, '') AS created_by_username
+    FROM
+        templates
+    LEFT JOIN
+		visible_users
+	ON
+	    templates.created_by = visible_users.id;
+
+COMMENT ON VIEW template_with_users IS 'Joins in the username + avatar url of the created by user.';
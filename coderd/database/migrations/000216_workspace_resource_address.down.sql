@@ -0,0 +1,2 @@
+ALTER TABLE workspace_resources
+	DROP COLUMN address;
@@ -0,0 +1,5 @@
+ALTER TABLE workspace_resources
+	ADD COLUMN address text NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN workspace_resources.address
+IS 'The Terraform address of the resource, including its module path and index, or empty if unknown.';
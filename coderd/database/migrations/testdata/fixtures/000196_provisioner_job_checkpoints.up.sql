@@ -0,0 +1,9 @@
+INSERT INTO provisioner_job_checkpoints
+	(job_id, stage, checkpoint, created_at, updated_at)
+VALUES (
+	'424a58cb-61d6-4627-9907-613c396c4a38',
+	'init',
+	'\x0a04696e6974',
+	'2024-03-01 12:00:00+00',
+	'2024-03-01 12:00:00+00'
+);
@@ -0,0 +1,11 @@
+INSERT INTO workspace_agent_uploads
+	(workspace_agent_id, name, checksum, size, data, created_at, updated_at)
+VALUES (
+	'45e89705-e09d-4850-bcec-f9a937f5d78d',
+	'script-artifacts/4d1ce0b4-3f3e-4c33-93d3-e8f9e1fa0c2f',
+	'sha256=2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824',
+	10,
+	'\x68656c6c6f',
+	'2024-03-01 12:00:00+00',
+	'2024-03-01 12:00:00+00'
+);
@@ -0,0 +1,7 @@
+INSERT INTO provisioner_job_work_directories
+	(job_id, listing, created_at)
+VALUES (
+	'424a58cb-61d6-4627-9907-613c396c4a38',
+	'\x0a0c2f746d702f53657373696f6e',
+	'2024-03-01 12:00:00+00'
+);
@@ -0,0 +1,9 @@
+INSERT INTO workspace_agent_script_artifacts
+	(id, workspace_agent_id, log_source_id, archive, created_at)
+VALUES (
+	'b8a7c1f2-8e4b-4d7a-9a51-2f0e6c3d9b14',
+	'45e89705-e09d-4850-bcec-f9a937f5d78d',
+	'4d1ce0b4-3f3e-4c33-93d3-e8f9e1fa0c2f',
+	'\x',
+	'2024-03-01 12:00:00+00'
+);
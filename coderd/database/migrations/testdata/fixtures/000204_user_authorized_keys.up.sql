@@ -0,0 +1,8 @@
+INSERT INTO user_authorized_keys
+	(user_id, keys, required, updated_at)
+VALUES (
+	'30095c71-380b-457a-8995-97b8ee6e5307',
+	'[{"public_key": "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGnSWSgvI2+2m3Jk4/aYQGgmp4YF+kVu1XwODG2WiaJt admin@coder.com", "principals": ["coder"]}]',
+	true,
+	'2024-03-01 12:00:00+00'
+);
@@ -0,0 +1,7 @@
+INSERT INTO provisioner_job_diagnostic_bundles
+	(job_id, bundle, created_at)
+VALUES (
+	'424a58cb-61d6-4627-9907-613c396c4a38',
+	'\x120764696772617068',
+	'2024-03-01 12:00:00+00'
+);
@@ -0,0 +1,9 @@
+INSERT INTO workspace_build_metadata
+	(workspace_build_id, key, value, sensitive, display_order)
+VALUES (
+	'a8c0b8c5-c9a8-4f33-93a4-8142e6858244',
+	'url',
+	'https://example.com',
+	false,
+	0
+);
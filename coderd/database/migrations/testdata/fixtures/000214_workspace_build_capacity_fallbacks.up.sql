@@ -0,0 +1,7 @@
+INSERT INTO workspace_build_capacity_fallbacks
+	(workspace_build_id, selected, attempts)
+VALUES (
+	'a8c0b8c5-c9a8-4f33-93a4-8142e6858244',
+	'on-demand',
+	'[{"option": "spot", "error": "InsufficientInstanceCapacity"}]'
+);
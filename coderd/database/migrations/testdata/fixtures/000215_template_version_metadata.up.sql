@@ -0,0 +1,9 @@
+INSERT INTO template_version_metadata
+	(template_version_id, display_name, icon, description, docs_url)
+VALUES (
+	'920baba5-4c64-4686-8b7d-d1bef5683eae',
+	'Docker',
+	'/icon/docker.png',
+	'Develop in a Docker container',
+	'https://example.com/docs/docker'
+);
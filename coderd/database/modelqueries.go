@@ -90,6 +90,10 @@ func (q *sqlQuerier) GetAuthorizedTemplates(ctx context.Context, arg GetTemplate
 			&i.RequireActiveVersion,
 			&i.Deprecated,
 			&i.UseMaxTtl,
+			&i.MaxAppSharingLevel,
+			&i.CodeServerEnabled,
+			&i.DocsURL,
+			&i.ReplaceOnFailure,
 			&i.CreatedByAvatarURL,
 			&i.CreatedByUsername,
 		); err != nil {
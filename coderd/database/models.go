@@ -975,6 +975,7 @@ const (
 	ProvisionerJobTypeTemplateVersionImport ProvisionerJobType = "template_version_import"
 	ProvisionerJobTypeWorkspaceBuild        ProvisionerJobType = "workspace_build"
 	ProvisionerJobTypeTemplateVersionDryRun ProvisionerJobType = "template_version_dry_run"
+	ProvisionerJobTypeWorkspaceRefresh      ProvisionerJobType = "workspace_refresh"
 )
 
 func (e *ProvisionerJobType) Scan(src interface{}) error {
@@ -1016,7 +1017,8 @@ func (e ProvisionerJobType) Valid() bool {
 	switch e {
 	case ProvisionerJobTypeTemplateVersionImport,
 		ProvisionerJobTypeWorkspaceBuild,
-		ProvisionerJobTypeTemplateVersionDryRun:
+		ProvisionerJobTypeTemplateVersionDryRun,
+		ProvisionerJobTypeWorkspaceRefresh:
 		return true
 	}
 	return false
@@ -1027,6 +1029,7 @@ func AllProvisionerJobTypeValues() []ProvisionerJobType {
 		ProvisionerJobTypeTemplateVersionImport,
 		ProvisionerJobTypeWorkspaceBuild,
 		ProvisionerJobTypeTemplateVersionDryRun,
+		ProvisionerJobTypeWorkspaceRefresh,
 	}
 }
 
@@ -1901,6 +1904,26 @@ type ProvisionerJob struct {
 	JobStatus ProvisionerJobStatus `db:"job_status" json:"job_status"`
 }
 
+// Checkpoints of running workspace builds, so a build can be resumed by another provisioner daemon.
+type ProvisionerJobCheckpoint struct {
+	JobID uuid.UUID `db:"job_id" json:"job_id"`
+	Stage string    `db:"stage" json:"stage"`
+	// The checkpoint reported by the provisioner, encoded as protobuf.
+	Checkpoint []byte `db:"checkpoint" json:"checkpoint"`
+	// The number of times the job was resumed from the checkpoint.
+	ResumeCount int32     `db:"resume_count" json:"resume_count"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Diagnostic bundles of failed workspace builds, so support escalations are self-contained.
+type ProvisionerJobDiagnosticBundle struct {
+	JobID uuid.UUID `db:"job_id" json:"job_id"`
+	// The bundle reported by the provisioner without the work directory listing, encoded as protobuf.
+	Bundle    []byte    `db:"bundle" json:"bundle"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
 type ProvisionerJobLog struct {
 	JobID     uuid.UUID `db:"job_id" json:"job_id"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
@@ -1911,6 +1934,14 @@ type ProvisionerJobLog struct {
 	ID        int64     `db:"id" json:"id"`
 }
 
+// Listings of the work directories of failed workspace builds, so they can be debugged without a shell on the provisioner host.
+type ProvisionerJobWorkDirectory struct {
+	JobID uuid.UUID `db:"job_id" json:"job_id"`
+	// The listing reported by the provisioner, encoded as protobuf.
+	Listing   []byte    `db:"listing" json:"listing"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
 type Replica struct {
 	ID              uuid.UUID    `db:"id" json:"id"`
 	CreatedAt       time.Time    `db:"created_at" json:"created_at"`
@@ -2003,6 +2034,10 @@ type Template struct {
 	RequireActiveVersion          bool            `db:"require_active_version" json:"require_active_version"`
 	Deprecated                    string          `db:"deprecated" json:"deprecated"`
 	UseMaxTtl                     bool            `db:"use_max_ttl" json:"use_max_ttl"`
+	MaxAppSharingLevel            AppSharingLevel `db:"max_app_sharing_level" json:"max_app_sharing_level"`
+	CodeServerEnabled             bool            `db:"code_server_enabled" json:"code_server_enabled"`
+	DocsURL                       string          `db:"docs_url" json:"docs_url"`
+	ReplaceOnFailure              bool            `db:"replace_on_failure" json:"replace_on_failure"`
 	CreatedByAvatarURL            string          `db:"created_by_avatar_url" json:"created_by_avatar_url"`
 	CreatedByUsername             string          `db:"created_by_username" json:"created_by_username"`
 }
@@ -2045,6 +2080,14 @@ type TemplateTable struct {
 	// If set to a non empty string, the template will no longer be able to be used. The message will be displayed to the user.
 	Deprecated string `db:"deprecated" json:"deprecated"`
 	UseMaxTtl  bool   `db:"use_max_ttl" json:"use_max_ttl"`
+	// The widest sharing level the apps of workspaces built from the template may use.
+	MaxAppSharingLevel AppSharingLevel `db:"max_app_sharing_level" json:"max_app_sharing_level"`
+	// Whether the agents of workspaces built from the template install and supervise code-server.
+	CodeServerEnabled bool `db:"code_server_enabled" json:"code_server_enabled"`
+	// URL of the documentation of the template, from the metadata of the active version.
+	DocsURL string `db:"docs_url" json:"docs_url"`
+	// Whether builds replace the resources that failed to update or whose agents were unhealthy in the previous build.
+	ReplaceOnFailure bool `db:"replace_on_failure" json:"replace_on_failure"`
 }
 
 // Joins in the username + avatar url of the created by user.
@@ -2065,6 +2108,15 @@ type TemplateVersion struct {
 	CreatedByUsername     string        `db:"created_by_username" json:"created_by_username"`
 }
 
+// Metadata templates describe themselves with, applied to the template when the version is promoted.
+type TemplateVersionMetadatum struct {
+	TemplateVersionID uuid.UUID `db:"template_version_id" json:"template_version_id"`
+	DisplayName       string    `db:"display_name" json:"display_name"`
+	Icon              string    `db:"icon" json:"icon"`
+	Description       string    `db:"description" json:"description"`
+	DocsURL           string    `db:"docs_url" json:"docs_url"`
+}
+
 type TemplateVersionParameter struct {
 	TemplateVersionID uuid.UUID `db:"template_version_id" json:"template_version_id"`
 	// Parameter name
@@ -2157,6 +2209,16 @@ type User struct {
 	Name string `db:"name" json:"name"`
 }
 
+// Public keys of a user that may authenticate to the SSH server of their workspace agents, e.g. hardware-backed keys.
+type UserAuthorizedKeys struct {
+	UserID uuid.UUID `db:"user_id" json:"user_id"`
+	// The public keys in the authorized_keys format, each optionally limited to a set of principals.
+	Keys json.RawMessage `db:"keys" json:"keys"`
+	// Connections authenticated by coderd must also authenticate with one of the keys.
+	Required  bool      `db:"required" json:"required"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
 type UserLink struct {
 	UserID            uuid.UUID `db:"user_id" json:"user_id"`
 	LoginType         LoginType `db:"login_type" json:"login_type"`
@@ -2239,6 +2301,8 @@ type WorkspaceAgent struct {
 	Subsystems  []WorkspaceAgentSubsystem `db:"subsystems" json:"subsystems"`
 	DisplayApps []DisplayApp              `db:"display_apps" json:"display_apps"`
 	APIVersion  string                    `db:"api_version" json:"api_version"`
+	// URLs for troubleshooting specific failures of the agent by class of failure, they override troubleshooting_url.
+	TroubleshootingURLs json.RawMessage `db:"troubleshooting_urls" json:"troubleshooting_urls"`
 }
 
 type WorkspaceAgentLog struct {
@@ -2248,6 +2312,10 @@ type WorkspaceAgentLog struct {
 	ID          int64     `db:"id" json:"id"`
 	Level       LogLevel  `db:"level" json:"level"`
 	LogSourceID uuid.UUID `db:"log_source_id" json:"log_source_id"`
+	// Structured key/value fields of the log, e.g. to filter logs by field.
+	Fields StringMap `db:"fields" json:"fields"`
+	// The output stream the log was written to, either stdout or stderr, or empty if unknown.
+	Stream string `db:"stream" json:"stream"`
 }
 
 type WorkspaceAgentLogSource struct {
@@ -2270,6 +2338,8 @@ type WorkspaceAgentMetadatum struct {
 	CollectedAt      time.Time `db:"collected_at" json:"collected_at"`
 	// Specifies the order in which to display agent metadata in user interfaces.
 	DisplayOrder int32 `db:"display_order" json:"display_order"`
+	// The built-in collector of the agent that collects the metadata instead of the script.
+	Collector string `db:"collector" json:"collector"`
 }
 
 type WorkspaceAgentScript struct {
@@ -2283,6 +2353,29 @@ type WorkspaceAgentScript struct {
 	RunOnStart       bool      `db:"run_on_start" json:"run_on_start"`
 	RunOnStop        bool      `db:"run_on_stop" json:"run_on_stop"`
 	TimeoutSeconds   int32     `db:"timeout_seconds" json:"timeout_seconds"`
+	// Runs the script once the workspace build that created the agent succeeds.
+	RunOnBuildSuccess bool `db:"run_on_build_success" json:"run_on_build_success"`
+	// Runs the script once the workspace build that created the agent fails.
+	RunOnBuildFailure bool `db:"run_on_build_failure" json:"run_on_build_failure"`
+	// Runs the script once the agent is ready, without delaying the startup of the workspace.
+	RunOnPostStart bool `db:"run_on_post_start" json:"run_on_post_start"`
+	// Runs the script with the environment of a login shell of the user.
+	Login bool `db:"login" json:"login"`
+	// Path whose disk usage is watched by the agent, the script runs as a cleanup script once the usage crosses disk_pressure_threshold.
+	DiskPressurePath string `db:"disk_pressure_path" json:"disk_pressure_path"`
+	// Disk usage of disk_pressure_path in percent that runs the script.
+	DiskPressureThreshold int32 `db:"disk_pressure_threshold" json:"disk_pressure_threshold"`
+}
+
+// Files workspace agent scripts wrote to their artifacts directory, e.g. build reports.
+type WorkspaceAgentScriptArtifact struct {
+	ID               uuid.UUID `db:"id" json:"id"`
+	WorkspaceAgentID uuid.UUID `db:"workspace_agent_id" json:"workspace_agent_id"`
+	// The log source of the script that produced the artifacts.
+	LogSourceID uuid.UUID `db:"log_source_id" json:"log_source_id"`
+	// A tar archive of the artifacts directory of the script.
+	Archive   []byte    `db:"archive" json:"archive"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
 }
 
 type WorkspaceAgentStat struct {
@@ -2305,6 +2398,31 @@ type WorkspaceAgentStat struct {
 	SessionCountSSH             int64           `db:"session_count_ssh" json:"session_count_ssh"`
 }
 
+// The chunks of files workspace agents are uploading. Chunks are stored separately so appending one doesn't rewrite the ones received before, and are assembled once the upload completes.
+type WorkspaceAgentUploadChunk struct {
+	WorkspaceAgentID uuid.UUID `db:"workspace_agent_id" json:"workspace_agent_id"`
+	Name             string    `db:"name" json:"name"`
+	Checksum         string    `db:"checksum" json:"checksum"`
+	// The offset of the chunk in the whole file.
+	ChunkOffset int64  `db:"chunk_offset" json:"chunk_offset"`
+	Data        []byte `db:"data" json:"data"`
+}
+
+// Files workspace agents are uploading in chunks, so an interrupted upload can be resumed. Rows are deleted once the upload completes.
+type WorkspaceAgentUpload struct {
+	WorkspaceAgentID uuid.UUID `db:"workspace_agent_id" json:"workspace_agent_id"`
+	// Identifies what is uploaded, e.g. the artifacts of a script.
+	Name string `db:"name" json:"name"`
+	// The checksum of the whole file, as sent in the Upload-Checksum header.
+	Checksum string `db:"checksum" json:"checksum"`
+	// The size of the whole file in bytes.
+	Size      int64     `db:"size" json:"size"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	// The number of bytes received so far, the offset of the next chunk.
+	Received int64 `db:"received" json:"received"`
+}
+
 type WorkspaceApp struct {
 	ID                   uuid.UUID          `db:"id" json:"id"`
 	CreatedAt            time.Time          `db:"created_at" json:"created_at"`
@@ -2323,6 +2441,12 @@ type WorkspaceApp struct {
 	External             bool               `db:"external" json:"external"`
 	// Specifies the order in which to display agent app in user interfaces.
 	DisplayOrder int32 `db:"display_order" json:"display_order"`
+	// How long the latest healthcheck reported by the agent took.
+	HealthLatencyMs float64 `db:"health_latency_ms" json:"health_latency_ms"`
+	// Why the latest healthcheck reported by the agent failed, empty if it succeeded.
+	HealthError string `db:"health_error" json:"health_error"`
+	// When the latest healthcheck reported by the agent ran, null if none was reported.
+	HealthCheckedAt sql.NullTime `db:"health_checked_at" json:"health_checked_at"`
 }
 
 // A record of workspace app usage statistics
@@ -2369,12 +2493,34 @@ type WorkspaceBuild struct {
 	InitiatorByUsername  string              `db:"initiator_by_username" json:"initiator_by_username"`
 }
 
+// The capacity options tried by builds of templates that set coder_capacity_fallback.
+type WorkspaceBuildCapacityFallback struct {
+	WorkspaceBuildID uuid.UUID `db:"workspace_build_id" json:"workspace_build_id"`
+	// The capacity option the build succeeded with. Later builds of the workspace start with it.
+	Selected string `db:"selected" json:"selected"`
+	// The options that ran out of capacity before the selected one, with their errors.
+	Attempts json.RawMessage `db:"attempts" json:"attempts"`
+}
+
+// Metadata of workspace builds converted from the outputs of the template.
+type WorkspaceBuildMetadatum struct {
+	WorkspaceBuildID uuid.UUID `db:"workspace_build_id" json:"workspace_build_id"`
+	Key              string    `db:"key" json:"key"`
+	// The value of the output, empty for sensitive outputs since their values are never sent to coderd.
+	Value     string `db:"value" json:"value"`
+	Sensitive bool   `db:"sensitive" json:"sensitive"`
+	// Outputs are ordered by name.
+	DisplayOrder int32 `db:"display_order" json:"display_order"`
+}
+
 type WorkspaceBuildParameter struct {
 	WorkspaceBuildID uuid.UUID `db:"workspace_build_id" json:"workspace_build_id"`
 	// Parameter name
 	Name string `db:"name" json:"name"`
 	// Parameter value
 	Value string `db:"value" json:"value"`
+	// Where the value came from: template_default, previous_build or user_input, or empty if unknown.
+	Source string `db:"source" json:"source"`
 }
 
 type WorkspaceBuildTable struct {
@@ -2428,6 +2574,10 @@ type WorkspaceResource struct {
 	Icon         string              `db:"icon" json:"icon"`
 	InstanceType sql.NullString      `db:"instance_type" json:"instance_type"`
 	DailyCost    int32               `db:"daily_cost" json:"daily_cost"`
+	// The change the build made to the resource: no_op, create, update, replace or delete, or empty if unknown.
+	Action string `db:"action" json:"action"`
+	// The Terraform address of the resource, including its module path and index, or empty if unknown.
+	Address string `db:"address" json:"address"`
 }
 
 type WorkspaceResourceMetadatum struct {
@@ -2436,4 +2586,8 @@ type WorkspaceResourceMetadatum struct {
 	Value               sql.NullString `db:"value" json:"value"`
 	Sensitive           bool           `db:"sensitive" json:"sensitive"`
 	ID                  int64          `db:"id" json:"id"`
+	// Specifies the order in which to display resource metadata in user interfaces.
+	DisplayOrder int32 `db:"display_order" json:"display_order"`
+	// Groups related resource metadata in user interfaces.
+	DisplayGroup string `db:"display_group" json:"display_group"`
 }
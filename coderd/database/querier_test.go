@@ -121,6 +121,8 @@ func TestInsertWorkspaceAgentLogs(t *testing.T) {
 		Output:      []string{"first"},
 		Level:       []database.LogLevel{database.LogLevelInfo},
 		LogSourceID: source.ID,
+		Fields:      []string{"{}"},
+		Stream:      []string{""},
 		// 1 MB is the max
 		OutputLength: 1 << 20,
 	})
@@ -134,6 +136,8 @@ func TestInsertWorkspaceAgentLogs(t *testing.T) {
 		Level:        []database.LogLevel{database.LogLevelInfo},
 		LogSourceID:  source.ID,
 		OutputLength: 1,
+		Fields:       []string{"{}"},
+		Stream:       []string{""},
 	})
 	require.True(t, database.IsWorkspaceAgentLogsLimitError(err))
 }
@@ -1482,6 +1482,62 @@ func (q *sqlQuerier) GetGroupByOrgAndName(ctx context.Context, arg GetGroupByOrg
 	return i, err
 }
 
+const getGroupsByOrganizationAndUserID = `-- name: GetGroupsByOrganizationAndUserID :many
+SELECT
+	groups.id, groups.name, groups.organization_id, groups.avatar_url, groups.quota_allowance, groups.display_name, groups.source
+FROM
+	groups
+WHERE
+	groups.id IN (
+		SELECT
+			group_id
+		FROM
+			group_members
+		WHERE
+			group_members.user_id = $1
+	)
+AND
+	groups.organization_id = $2
+`
+
+type GetGroupsByOrganizationAndUserIDParams struct {
+	UserID         uuid.UUID `db:"user_id" json:"user_id"`
+	OrganizationID uuid.UUID `db:"organization_id" json:"organization_id"`
+}
+
+// Returns the groups of the organization the user is a member of. The
+// Everyone group isn't returned, since its members are implicit.
+func (q *sqlQuerier) GetGroupsByOrganizationAndUserID(ctx context.Context, arg GetGroupsByOrganizationAndUserIDParams) ([]Group, error) {
+	rows, err := q.db.QueryContext(ctx, getGroupsByOrganizationAndUserID, arg.UserID, arg.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Group
+	for rows.Next() {
+		var i Group
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.OrganizationID,
+			&i.AvatarURL,
+			&i.QuotaAllowance,
+			&i.DisplayName,
+			&i.Source,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getGroupsByOrganizationID = `-- name: GetGroupsByOrganizationID :many
 SELECT
 	id, name, organization_id, avatar_url, quota_allowance, display_name, source
@@ -3491,6 +3547,124 @@ func (q *sqlQuerier) UpsertProvisionerDaemon(ctx context.Context, arg UpsertProv
 	return i, err
 }
 
+const deleteProvisionerJobCheckpointByJobID = `-- name: DeleteProvisionerJobCheckpointByJobID :exec
+DELETE FROM
+	provisioner_job_checkpoints
+WHERE
+	job_id = $1
+`
+
+func (q *sqlQuerier) DeleteProvisionerJobCheckpointByJobID(ctx context.Context, jobID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteProvisionerJobCheckpointByJobID, jobID)
+	return err
+}
+
+const getProvisionerJobCheckpointByJobID = `-- name: GetProvisionerJobCheckpointByJobID :one
+SELECT
+	job_id, stage, checkpoint, resume_count, created_at, updated_at
+FROM
+	provisioner_job_checkpoints
+WHERE
+	job_id = $1
+`
+
+func (q *sqlQuerier) GetProvisionerJobCheckpointByJobID(ctx context.Context, jobID uuid.UUID) (ProvisionerJobCheckpoint, error) {
+	row := q.db.QueryRowContext(ctx, getProvisionerJobCheckpointByJobID, jobID)
+	var i ProvisionerJobCheckpoint
+	err := row.Scan(
+		&i.JobID,
+		&i.Stage,
+		&i.Checkpoint,
+		&i.ResumeCount,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const updateProvisionerJobCheckpointResumedByJobID = `-- name: UpdateProvisionerJobCheckpointResumedByJobID :exec
+UPDATE
+	provisioner_job_checkpoints
+SET
+	resume_count = resume_count + 1,
+	updated_at = $2
+WHERE
+	job_id = $1
+`
+
+type UpdateProvisionerJobCheckpointResumedByJobIDParams struct {
+	JobID     uuid.UUID `db:"job_id" json:"job_id"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+func (q *sqlQuerier) UpdateProvisionerJobCheckpointResumedByJobID(ctx context.Context, arg UpdateProvisionerJobCheckpointResumedByJobIDParams) error {
+	_, err := q.db.ExecContext(ctx, updateProvisionerJobCheckpointResumedByJobID, arg.JobID, arg.UpdatedAt)
+	return err
+}
+
+const upsertProvisionerJobCheckpoint = `-- name: UpsertProvisionerJobCheckpoint :exec
+INSERT INTO
+	provisioner_job_checkpoints (job_id, stage, checkpoint, created_at, updated_at)
+VALUES
+	($1, $2, $3, $4, $4)
+ON CONFLICT (job_id)
+DO UPDATE SET
+	stage = EXCLUDED.stage,
+	checkpoint = EXCLUDED.checkpoint,
+	updated_at = EXCLUDED.updated_at
+`
+
+type UpsertProvisionerJobCheckpointParams struct {
+	JobID      uuid.UUID `db:"job_id" json:"job_id"`
+	Stage      string    `db:"stage" json:"stage"`
+	Checkpoint []byte    `db:"checkpoint" json:"checkpoint"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+func (q *sqlQuerier) UpsertProvisionerJobCheckpoint(ctx context.Context, arg UpsertProvisionerJobCheckpointParams) error {
+	_, err := q.db.ExecContext(ctx, upsertProvisionerJobCheckpoint,
+		arg.JobID,
+		arg.Stage,
+		arg.Checkpoint,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const getProvisionerJobDiagnosticBundleByJobID = `-- name: GetProvisionerJobDiagnosticBundleByJobID :one
+SELECT
+	job_id, bundle, created_at
+FROM
+	provisioner_job_diagnostic_bundles
+WHERE
+	job_id = $1
+`
+
+func (q *sqlQuerier) GetProvisionerJobDiagnosticBundleByJobID(ctx context.Context, jobID uuid.UUID) (ProvisionerJobDiagnosticBundle, error) {
+	row := q.db.QueryRowContext(ctx, getProvisionerJobDiagnosticBundleByJobID, jobID)
+	var i ProvisionerJobDiagnosticBundle
+	err := row.Scan(&i.JobID, &i.Bundle, &i.CreatedAt)
+	return i, err
+}
+
+const insertProvisionerJobDiagnosticBundle = `-- name: InsertProvisionerJobDiagnosticBundle :exec
+INSERT INTO
+	provisioner_job_diagnostic_bundles (job_id, bundle, created_at)
+VALUES
+	($1, $2, $3)
+`
+
+type InsertProvisionerJobDiagnosticBundleParams struct {
+	JobID     uuid.UUID `db:"job_id" json:"job_id"`
+	Bundle    []byte    `db:"bundle" json:"bundle"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+func (q *sqlQuerier) InsertProvisionerJobDiagnosticBundle(ctx context.Context, arg InsertProvisionerJobDiagnosticBundleParams) error {
+	_, err := q.db.ExecContext(ctx, insertProvisionerJobDiagnosticBundle, arg.JobID, arg.Bundle, arg.CreatedAt)
+	return err
+}
+
 const getProvisionerLogsAfterID = `-- name: GetProvisionerLogsAfterID :many
 SELECT
 	job_id, created_at, source, level, stage, output, id
@@ -3944,6 +4118,51 @@ func (q *sqlQuerier) GetProvisionerJobsCreatedAfter(ctx context.Context, created
 	return items, nil
 }
 
+const getUnfinishedWorkspaceRefreshJobByBuildID = `-- name: GetUnfinishedWorkspaceRefreshJobByBuildID :one
+SELECT
+	id, created_at, updated_at, started_at, canceled_at, completed_at, error, organization_id, initiator_id, provisioner, storage_method, type, input, worker_id, file_id, tags, error_code, trace_metadata, job_status
+FROM
+	provisioner_jobs
+WHERE
+	type = 'workspace_refresh'
+	AND (input ->> 'workspace_build_id') :: uuid = $1 :: uuid
+	AND completed_at IS NULL
+	AND canceled_at IS NULL
+ORDER BY
+	created_at DESC
+LIMIT
+	1
+`
+
+// Refreshes of a build are deduplicated, so at most one is queued or running
+// at a time.
+func (q *sqlQuerier) GetUnfinishedWorkspaceRefreshJobByBuildID(ctx context.Context, workspaceBuildID uuid.UUID) (ProvisionerJob, error) {
+	row := q.db.QueryRowContext(ctx, getUnfinishedWorkspaceRefreshJobByBuildID, workspaceBuildID)
+	var i ProvisionerJob
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.StartedAt,
+		&i.CanceledAt,
+		&i.CompletedAt,
+		&i.Error,
+		&i.OrganizationID,
+		&i.InitiatorID,
+		&i.Provisioner,
+		&i.StorageMethod,
+		&i.Type,
+		&i.Input,
+		&i.WorkerID,
+		&i.FileID,
+		&i.Tags,
+		&i.ErrorCode,
+		&i.TraceMetadata,
+		&i.JobStatus,
+	)
+	return i, err
+}
+
 const insertProvisionerJob = `-- name: InsertProvisionerJob :one
 INSERT INTO
 	provisioner_jobs (
@@ -4090,6 +4309,64 @@ func (q *sqlQuerier) UpdateProvisionerJobWithCompleteByID(ctx context.Context, a
 	return err
 }
 
+const updateProvisionerJobWithRequeueByID = `-- name: UpdateProvisionerJobWithRequeueByID :exec
+UPDATE
+	provisioner_jobs
+SET
+	updated_at = $2,
+	started_at = NULL,
+	worker_id = NULL
+WHERE
+	id = $1
+	AND completed_at IS NULL
+`
+
+type UpdateProvisionerJobWithRequeueByIDParams struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Returns a started job to the queue, so another provisioner daemon
+// acquires it, e.g. to resume it from its checkpoint.
+func (q *sqlQuerier) UpdateProvisionerJobWithRequeueByID(ctx context.Context, arg UpdateProvisionerJobWithRequeueByIDParams) error {
+	_, err := q.db.ExecContext(ctx, updateProvisionerJobWithRequeueByID, arg.ID, arg.UpdatedAt)
+	return err
+}
+
+const getProvisionerJobWorkDirectoryByJobID = `-- name: GetProvisionerJobWorkDirectoryByJobID :one
+SELECT
+	job_id, listing, created_at
+FROM
+	provisioner_job_work_directories
+WHERE
+	job_id = $1
+`
+
+func (q *sqlQuerier) GetProvisionerJobWorkDirectoryByJobID(ctx context.Context, jobID uuid.UUID) (ProvisionerJobWorkDirectory, error) {
+	row := q.db.QueryRowContext(ctx, getProvisionerJobWorkDirectoryByJobID, jobID)
+	var i ProvisionerJobWorkDirectory
+	err := row.Scan(&i.JobID, &i.Listing, &i.CreatedAt)
+	return i, err
+}
+
+const insertProvisionerJobWorkDirectory = `-- name: InsertProvisionerJobWorkDirectory :exec
+INSERT INTO
+	provisioner_job_work_directories (job_id, listing, created_at)
+VALUES
+	($1, $2, $3)
+`
+
+type InsertProvisionerJobWorkDirectoryParams struct {
+	JobID     uuid.UUID `db:"job_id" json:"job_id"`
+	Listing   []byte    `db:"listing" json:"listing"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+func (q *sqlQuerier) InsertProvisionerJobWorkDirectory(ctx context.Context, arg InsertProvisionerJobWorkDirectoryParams) error {
+	_, err := q.db.ExecContext(ctx, insertProvisionerJobWorkDirectory, arg.JobID, arg.Listing, arg.CreatedAt)
+	return err
+}
+
 const getWorkspaceProxies = `-- name: GetWorkspaceProxies :many
 SELECT
 	id, name, display_name, icon, url, wildcard_hostname, created_at, updated_at, deleted, token_hashed_secret, region_id, derp_enabled, derp_only, version
@@ -5720,7 +5997,7 @@ func (q *sqlQuerier) GetTemplateAverageBuildTime(ctx context.Context, arg GetTem
 
 const getTemplateByID = `-- name: GetTemplateByID :one
 SELECT
-	id, created_at, updated_at, organization_id, deleted, name, provisioner, active_version_id, description, default_ttl, created_by, icon, user_acl, group_acl, display_name, allow_user_cancel_workspace_jobs, max_ttl, allow_user_autostart, allow_user_autostop, failure_ttl, time_til_dormant, time_til_dormant_autodelete, autostop_requirement_days_of_week, autostop_requirement_weeks, autostart_block_days_of_week, require_active_version, deprecated, use_max_ttl, created_by_avatar_url, created_by_username
+	id, created_at, updated_at, organization_id, deleted, name, provisioner, active_version_id, description, default_ttl, created_by, icon, user_acl, group_acl, display_name, allow_user_cancel_workspace_jobs, max_ttl, allow_user_autostart, allow_user_autostop, failure_ttl, time_til_dormant, time_til_dormant_autodelete, autostop_requirement_days_of_week, autostop_requirement_weeks, autostart_block_days_of_week, require_active_version, deprecated, use_max_ttl, max_app_sharing_level, code_server_enabled, docs_url, replace_on_failure, created_by_avatar_url, created_by_username
 FROM
 	template_with_users
 WHERE
@@ -5761,6 +6038,10 @@ func (q *sqlQuerier) GetTemplateByID(ctx context.Context, id uuid.UUID) (Templat
 		&i.RequireActiveVersion,
 		&i.Deprecated,
 		&i.UseMaxTtl,
+		&i.MaxAppSharingLevel,
+		&i.CodeServerEnabled,
+		&i.DocsURL,
+		&i.ReplaceOnFailure,
 		&i.CreatedByAvatarURL,
 		&i.CreatedByUsername,
 	)
@@ -5769,7 +6050,7 @@ func (q *sqlQuerier) GetTemplateByID(ctx context.Context, id uuid.UUID) (Templat
 
 const getTemplateByOrganizationAndName = `-- name: GetTemplateByOrganizationAndName :one
 SELECT
-	id, created_at, updated_at, organization_id, deleted, name, provisioner, active_version_id, description, default_ttl, created_by, icon, user_acl, group_acl, display_name, allow_user_cancel_workspace_jobs, max_ttl, allow_user_autostart, allow_user_autostop, failure_ttl, time_til_dormant, time_til_dormant_autodelete, autostop_requirement_days_of_week, autostop_requirement_weeks, autostart_block_days_of_week, require_active_version, deprecated, use_max_ttl, created_by_avatar_url, created_by_username
+	id, created_at, updated_at, organization_id, deleted, name, provisioner, active_version_id, description, default_ttl, created_by, icon, user_acl, group_acl, display_name, allow_user_cancel_workspace_jobs, max_ttl, allow_user_autostart, allow_user_autostop, failure_ttl, time_til_dormant, time_til_dormant_autodelete, autostop_requirement_days_of_week, autostop_requirement_weeks, autostart_block_days_of_week, require_active_version, deprecated, use_max_ttl, max_app_sharing_level, code_server_enabled, docs_url, replace_on_failure, created_by_avatar_url, created_by_username
 FROM
 	template_with_users AS templates
 WHERE
@@ -5818,6 +6099,10 @@ func (q *sqlQuerier) GetTemplateByOrganizationAndName(ctx context.Context, arg G
 		&i.RequireActiveVersion,
 		&i.Deprecated,
 		&i.UseMaxTtl,
+		&i.MaxAppSharingLevel,
+		&i.CodeServerEnabled,
+		&i.DocsURL,
+		&i.ReplaceOnFailure,
 		&i.CreatedByAvatarURL,
 		&i.CreatedByUsername,
 	)
@@ -5825,7 +6110,7 @@ func (q *sqlQuerier) GetTemplateByOrganizationAndName(ctx context.Context, arg G
 }
 
 const getTemplates = `-- name: GetTemplates :many
-SELECT id, created_at, updated_at, organization_id, deleted, name, provisioner, active_version_id, description, default_ttl, created_by, icon, user_acl, group_acl, display_name, allow_user_cancel_workspace_jobs, max_ttl, allow_user_autostart, allow_user_autostop, failure_ttl, time_til_dormant, time_til_dormant_autodelete, autostop_requirement_days_of_week, autostop_requirement_weeks, autostart_block_days_of_week, require_active_version, deprecated, use_max_ttl, created_by_avatar_url, created_by_username FROM template_with_users AS templates
+SELECT id, created_at, updated_at, organization_id, deleted, name, provisioner, active_version_id, description, default_ttl, created_by, icon, user_acl, group_acl, display_name, allow_user_cancel_workspace_jobs, max_ttl, allow_user_autostart, allow_user_autostop, failure_ttl, time_til_dormant, time_til_dormant_autodelete, autostop_requirement_days_of_week, autostop_requirement_weeks, autostart_block_days_of_week, require_active_version, deprecated, use_max_ttl, max_app_sharing_level, code_server_enabled, docs_url, replace_on_failure, created_by_avatar_url, created_by_username FROM template_with_users AS templates
 ORDER BY (name, id) ASC
 `
 
@@ -5867,6 +6152,10 @@ func (q *sqlQuerier) GetTemplates(ctx context.Context) ([]Template, error) {
 			&i.RequireActiveVersion,
 			&i.Deprecated,
 			&i.UseMaxTtl,
+			&i.MaxAppSharingLevel,
+			&i.CodeServerEnabled,
+			&i.DocsURL,
+			&i.ReplaceOnFailure,
 			&i.CreatedByAvatarURL,
 			&i.CreatedByUsername,
 		); err != nil {
@@ -5885,7 +6174,7 @@ func (q *sqlQuerier) GetTemplates(ctx context.Context) ([]Template, error) {
 
 const getTemplatesWithFilter = `-- name: GetTemplatesWithFilter :many
 SELECT
-	id, created_at, updated_at, organization_id, deleted, name, provisioner, active_version_id, description, default_ttl, created_by, icon, user_acl, group_acl, display_name, allow_user_cancel_workspace_jobs, max_ttl, allow_user_autostart, allow_user_autostop, failure_ttl, time_til_dormant, time_til_dormant_autodelete, autostop_requirement_days_of_week, autostop_requirement_weeks, autostart_block_days_of_week, require_active_version, deprecated, use_max_ttl, created_by_avatar_url, created_by_username
+	id, created_at, updated_at, organization_id, deleted, name, provisioner, active_version_id, description, default_ttl, created_by, icon, user_acl, group_acl, display_name, allow_user_cancel_workspace_jobs, max_ttl, allow_user_autostart, allow_user_autostop, failure_ttl, time_til_dormant, time_til_dormant_autodelete, autostop_requirement_days_of_week, autostop_requirement_weeks, autostart_block_days_of_week, require_active_version, deprecated, use_max_ttl, max_app_sharing_level, code_server_enabled, docs_url, replace_on_failure, created_by_avatar_url, created_by_username
 FROM
 	template_with_users AS templates
 WHERE
@@ -5977,6 +6266,10 @@ func (q *sqlQuerier) GetTemplatesWithFilter(ctx context.Context, arg GetTemplate
 			&i.RequireActiveVersion,
 			&i.Deprecated,
 			&i.UseMaxTtl,
+			&i.MaxAppSharingLevel,
+			&i.CodeServerEnabled,
+			&i.DocsURL,
+			&i.ReplaceOnFailure,
 			&i.CreatedByAvatarURL,
 			&i.CreatedByUsername,
 		); err != nil {
@@ -6146,20 +6439,28 @@ SET
 	icon = $5,
 	display_name = $6,
 	allow_user_cancel_workspace_jobs = $7,
-	group_acl = $8
+	group_acl = $8,
+	max_app_sharing_level = $9,
+	code_server_enabled = $10,
+	docs_url = $11,
+	replace_on_failure = $12
 WHERE
 	id = $1
 `
 
 type UpdateTemplateMetaByIDParams struct {
-	ID                           uuid.UUID   `db:"id" json:"id"`
-	UpdatedAt                    time.Time   `db:"updated_at" json:"updated_at"`
-	Description                  string      `db:"description" json:"description"`
-	Name                         string      `db:"name" json:"name"`
-	Icon                         string      `db:"icon" json:"icon"`
-	DisplayName                  string      `db:"display_name" json:"display_name"`
-	AllowUserCancelWorkspaceJobs bool        `db:"allow_user_cancel_workspace_jobs" json:"allow_user_cancel_workspace_jobs"`
-	GroupACL                     TemplateACL `db:"group_acl" json:"group_acl"`
+	ID                           uuid.UUID       `db:"id" json:"id"`
+	UpdatedAt                    time.Time       `db:"updated_at" json:"updated_at"`
+	Description                  string          `db:"description" json:"description"`
+	Name                         string          `db:"name" json:"name"`
+	Icon                         string          `db:"icon" json:"icon"`
+	DisplayName                  string          `db:"display_name" json:"display_name"`
+	AllowUserCancelWorkspaceJobs bool            `db:"allow_user_cancel_workspace_jobs" json:"allow_user_cancel_workspace_jobs"`
+	GroupACL                     TemplateACL     `db:"group_acl" json:"group_acl"`
+	MaxAppSharingLevel           AppSharingLevel `db:"max_app_sharing_level" json:"max_app_sharing_level"`
+	CodeServerEnabled            bool            `db:"code_server_enabled" json:"code_server_enabled"`
+	DocsURL                      string          `db:"docs_url" json:"docs_url"`
+	ReplaceOnFailure             bool            `db:"replace_on_failure" json:"replace_on_failure"`
 }
 
 func (q *sqlQuerier) UpdateTemplateMetaByID(ctx context.Context, arg UpdateTemplateMetaByIDParams) error {
@@ -6172,6 +6473,10 @@ func (q *sqlQuerier) UpdateTemplateMetaByID(ctx context.Context, arg UpdateTempl
 		arg.DisplayName,
 		arg.AllowUserCancelWorkspaceJobs,
 		arg.GroupACL,
+		arg.MaxAppSharingLevel,
+		arg.CodeServerEnabled,
+		arg.DocsURL,
+		arg.ReplaceOnFailure,
 	)
 	return err
 }
@@ -6276,6 +6581,59 @@ func (q *sqlQuerier) GetTemplateVersionParameters(ctx context.Context, templateV
 	return items, nil
 }
 
+const getTemplateVersionMetadataByTemplateVersionID = `-- name: GetTemplateVersionMetadataByTemplateVersionID :one
+SELECT
+	template_version_id, display_name, icon, description, docs_url
+FROM
+	template_version_metadata
+WHERE
+	template_version_id = $1
+`
+
+func (q *sqlQuerier) GetTemplateVersionMetadataByTemplateVersionID(ctx context.Context, templateVersionID uuid.UUID) (TemplateVersionMetadatum, error) {
+	row := q.db.QueryRowContext(ctx, getTemplateVersionMetadataByTemplateVersionID, templateVersionID)
+	var i TemplateVersionMetadatum
+	err := row.Scan(
+		&i.TemplateVersionID,
+		&i.DisplayName,
+		&i.Icon,
+		&i.Description,
+		&i.DocsURL,
+	)
+	return i, err
+}
+
+const upsertTemplateVersionMetadata = `-- name: UpsertTemplateVersionMetadata :exec
+INSERT INTO
+	template_version_metadata (template_version_id, display_name, icon, description, docs_url)
+VALUES
+	($1, $2, $3, $4, $5)
+ON CONFLICT (template_version_id) DO UPDATE SET
+	display_name = $2,
+	icon = $3,
+	description = $4,
+	docs_url = $5
+`
+
+type UpsertTemplateVersionMetadataParams struct {
+	TemplateVersionID uuid.UUID `db:"template_version_id" json:"template_version_id"`
+	DisplayName       string    `db:"display_name" json:"display_name"`
+	Icon              string    `db:"icon" json:"icon"`
+	Description       string    `db:"description" json:"description"`
+	DocsURL           string    `db:"docs_url" json:"docs_url"`
+}
+
+func (q *sqlQuerier) UpsertTemplateVersionMetadata(ctx context.Context, arg UpsertTemplateVersionMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, upsertTemplateVersionMetadata,
+		arg.TemplateVersionID,
+		arg.DisplayName,
+		arg.Icon,
+		arg.Description,
+		arg.DocsURL,
+	)
+	return err
+}
+
 const insertTemplateVersionParameter = `-- name: InsertTemplateVersionParameter :one
 INSERT INTO
     template_version_parameters (
@@ -7294,30 +7652,89 @@ func (q *sqlQuerier) UpdateUserLinkedID(ctx context.Context, arg UpdateUserLinke
 	return i, err
 }
 
-const allUserIDs = `-- name: AllUserIDs :many
-SELECT DISTINCT id FROM USERS
+const getUserAuthorizedKeys = `-- name: GetUserAuthorizedKeys :one
+SELECT
+	user_id, keys, required, updated_at
+FROM
+	user_authorized_keys
+WHERE
+	user_id = $1
 `
 
-// AllUserIDs returns all UserIDs regardless of user status or deletion.
-func (q *sqlQuerier) AllUserIDs(ctx context.Context) ([]uuid.UUID, error) {
-	rows, err := q.db.QueryContext(ctx, allUserIDs)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []uuid.UUID
-	for rows.Next() {
-		var id uuid.UUID
-		if err := rows.Scan(&id); err != nil {
-			return nil, err
-		}
-		items = append(items, id)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+func (q *sqlQuerier) GetUserAuthorizedKeys(ctx context.Context, userID uuid.UUID) (UserAuthorizedKeys, error) {
+	row := q.db.QueryRowContext(ctx, getUserAuthorizedKeys, userID)
+	var i UserAuthorizedKeys
+	err := row.Scan(
+		&i.UserID,
+		&i.Keys,
+		&i.Required,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const upsertUserAuthorizedKeys = `-- name: UpsertUserAuthorizedKeys :one
+INSERT INTO
+	user_authorized_keys (user_id, keys, required, updated_at)
+VALUES
+	($1, $2, $3, $4)
+ON CONFLICT
+	(user_id)
+DO UPDATE SET
+	keys = $2,
+	required = $3,
+	updated_at = $4
+RETURNING user_id, keys, required, updated_at
+`
+
+type UpsertUserAuthorizedKeysParams struct {
+	UserID    uuid.UUID       `db:"user_id" json:"user_id"`
+	Keys      json.RawMessage `db:"keys" json:"keys"`
+	Required  bool            `db:"required" json:"required"`
+	UpdatedAt time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+func (q *sqlQuerier) UpsertUserAuthorizedKeys(ctx context.Context, arg UpsertUserAuthorizedKeysParams) (UserAuthorizedKeys, error) {
+	row := q.db.QueryRowContext(ctx, upsertUserAuthorizedKeys,
+		arg.UserID,
+		arg.Keys,
+		arg.Required,
+		arg.UpdatedAt,
+	)
+	var i UserAuthorizedKeys
+	err := row.Scan(
+		&i.UserID,
+		&i.Keys,
+		&i.Required,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const allUserIDs = `-- name: AllUserIDs :many
+SELECT DISTINCT id FROM USERS
+`
+
+// AllUserIDs returns all UserIDs regardless of user status or deletion.
+func (q *sqlQuerier) AllUserIDs(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, allUserIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 	return items, nil
 }
@@ -8141,7 +8558,7 @@ func (q *sqlQuerier) DeleteOldWorkspaceAgentLogs(ctx context.Context) error {
 
 const getWorkspaceAgentAndOwnerByAuthToken = `-- name: GetWorkspaceAgentAndOwnerByAuthToken :one
 SELECT
-	workspace_agents.id, workspace_agents.created_at, workspace_agents.updated_at, workspace_agents.name, workspace_agents.first_connected_at, workspace_agents.last_connected_at, workspace_agents.disconnected_at, workspace_agents.resource_id, workspace_agents.auth_token, workspace_agents.auth_instance_id, workspace_agents.architecture, workspace_agents.environment_variables, workspace_agents.operating_system, workspace_agents.instance_metadata, workspace_agents.resource_metadata, workspace_agents.directory, workspace_agents.version, workspace_agents.last_connected_replica_id, workspace_agents.connection_timeout_seconds, workspace_agents.troubleshooting_url, workspace_agents.motd_file, workspace_agents.lifecycle_state, workspace_agents.expanded_directory, workspace_agents.logs_length, workspace_agents.logs_overflowed, workspace_agents.started_at, workspace_agents.ready_at, workspace_agents.subsystems, workspace_agents.display_apps, workspace_agents.api_version,
+	workspace_agents.id, workspace_agents.created_at, workspace_agents.updated_at, workspace_agents.name, workspace_agents.first_connected_at, workspace_agents.last_connected_at, workspace_agents.disconnected_at, workspace_agents.resource_id, workspace_agents.auth_token, workspace_agents.auth_instance_id, workspace_agents.architecture, workspace_agents.environment_variables, workspace_agents.operating_system, workspace_agents.instance_metadata, workspace_agents.resource_metadata, workspace_agents.directory, workspace_agents.version, workspace_agents.last_connected_replica_id, workspace_agents.connection_timeout_seconds, workspace_agents.troubleshooting_url, workspace_agents.motd_file, workspace_agents.lifecycle_state, workspace_agents.expanded_directory, workspace_agents.logs_length, workspace_agents.logs_overflowed, workspace_agents.started_at, workspace_agents.ready_at, workspace_agents.subsystems, workspace_agents.display_apps, workspace_agents.api_version, workspace_agents.troubleshooting_urls,
 	workspaces.id AS workspace_id,
 	users.id AS owner_id,
 	users.username AS owner_name,
@@ -8243,6 +8660,7 @@ func (q *sqlQuerier) GetWorkspaceAgentAndOwnerByAuthToken(ctx context.Context, a
 		pq.Array(&i.WorkspaceAgent.Subsystems),
 		pq.Array(&i.WorkspaceAgent.DisplayApps),
 		&i.WorkspaceAgent.APIVersion,
+		&i.WorkspaceAgent.TroubleshootingURLs,
 		&i.WorkspaceID,
 		&i.OwnerID,
 		&i.OwnerName,
@@ -8257,7 +8675,7 @@ func (q *sqlQuerier) GetWorkspaceAgentAndOwnerByAuthToken(ctx context.Context, a
 
 const getWorkspaceAgentByID = `-- name: GetWorkspaceAgentByID :one
 SELECT
-	id, created_at, updated_at, name, first_connected_at, last_connected_at, disconnected_at, resource_id, auth_token, auth_instance_id, architecture, environment_variables, operating_system, instance_metadata, resource_metadata, directory, version, last_connected_replica_id, connection_timeout_seconds, troubleshooting_url, motd_file, lifecycle_state, expanded_directory, logs_length, logs_overflowed, started_at, ready_at, subsystems, display_apps, api_version
+	id, created_at, updated_at, name, first_connected_at, last_connected_at, disconnected_at, resource_id, auth_token, auth_instance_id, architecture, environment_variables, operating_system, instance_metadata, resource_metadata, directory, version, last_connected_replica_id, connection_timeout_seconds, troubleshooting_url, motd_file, lifecycle_state, expanded_directory, logs_length, logs_overflowed, started_at, ready_at, subsystems, display_apps, api_version, troubleshooting_urls
 FROM
 	workspace_agents
 WHERE
@@ -8298,13 +8716,14 @@ func (q *sqlQuerier) GetWorkspaceAgentByID(ctx context.Context, id uuid.UUID) (W
 		pq.Array(&i.Subsystems),
 		pq.Array(&i.DisplayApps),
 		&i.APIVersion,
+		&i.TroubleshootingURLs,
 	)
 	return i, err
 }
 
 const getWorkspaceAgentByInstanceID = `-- name: GetWorkspaceAgentByInstanceID :one
 SELECT
-	id, created_at, updated_at, name, first_connected_at, last_connected_at, disconnected_at, resource_id, auth_token, auth_instance_id, architecture, environment_variables, operating_system, instance_metadata, resource_metadata, directory, version, last_connected_replica_id, connection_timeout_seconds, troubleshooting_url, motd_file, lifecycle_state, expanded_directory, logs_length, logs_overflowed, started_at, ready_at, subsystems, display_apps, api_version
+	id, created_at, updated_at, name, first_connected_at, last_connected_at, disconnected_at, resource_id, auth_token, auth_instance_id, architecture, environment_variables, operating_system, instance_metadata, resource_metadata, directory, version, last_connected_replica_id, connection_timeout_seconds, troubleshooting_url, motd_file, lifecycle_state, expanded_directory, logs_length, logs_overflowed, started_at, ready_at, subsystems, display_apps, api_version, troubleshooting_urls
 FROM
 	workspace_agents
 WHERE
@@ -8347,6 +8766,7 @@ func (q *sqlQuerier) GetWorkspaceAgentByInstanceID(ctx context.Context, authInst
 		pq.Array(&i.Subsystems),
 		pq.Array(&i.DisplayApps),
 		&i.APIVersion,
+		&i.TroubleshootingURLs,
 	)
 	return i, err
 }
@@ -8410,23 +8830,48 @@ func (q *sqlQuerier) GetWorkspaceAgentLogSourcesByAgentIDs(ctx context.Context,
 
 const getWorkspaceAgentLogsAfter = `-- name: GetWorkspaceAgentLogsAfter :many
 SELECT
-	agent_id, created_at, output, id, level, log_source_id
+	agent_id, created_at, output, id, level, log_source_id, fields, stream
 FROM
 	workspace_agent_logs
 WHERE
 	agent_id = $1
 	AND (
 		id > $2
-	) ORDER BY id ASC
+	)
+	-- Filter by level
+	AND CASE
+		WHEN cardinality($3 :: log_level[]) > 0 THEN
+			level = ANY($3 :: log_level[])
+		ELSE true
+	END
+	-- Filter by log source
+	AND CASE
+		WHEN cardinality($4 :: uuid[]) > 0 THEN
+			log_source_id = ANY($4 :: uuid[])
+		ELSE true
+	END
+ORDER BY id ASC
+LIMIT
+	-- A null limit means "no limit", so 0 means return all
+	NULLIF($5 :: int, 0)
 `
 
 type GetWorkspaceAgentLogsAfterParams struct {
-	AgentID      uuid.UUID `db:"agent_id" json:"agent_id"`
-	CreatedAfter int64     `db:"created_after" json:"created_after"`
+	AgentID      uuid.UUID   `db:"agent_id" json:"agent_id"`
+	CreatedAfter int64       `db:"created_after" json:"created_after"`
+	Levels       []LogLevel  `db:"levels" json:"levels"`
+	LogSourceIDs []uuid.UUID `db:"log_source_ids" json:"log_source_ids"`
+	LimitOpt     int32       `db:"limit_opt" json:"limit_opt"`
 }
 
 func (q *sqlQuerier) GetWorkspaceAgentLogsAfter(ctx context.Context, arg GetWorkspaceAgentLogsAfterParams) ([]WorkspaceAgentLog, error) {
-	rows, err := q.db.QueryContext(ctx, getWorkspaceAgentLogsAfter, arg.AgentID, arg.CreatedAfter)
+	rows, err := q.db.QueryContext(ctx, getWorkspaceAgentLogsAfter,
+		arg.AgentID,
+		arg.CreatedAfter,
+		pq.Array(arg.Levels),
+		pq.Array(arg.LogSourceIDs),
+		arg.LimitOpt,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -8441,6 +8886,8 @@ func (q *sqlQuerier) GetWorkspaceAgentLogsAfter(ctx context.Context, arg GetWork
 			&i.ID,
 			&i.Level,
 			&i.LogSourceID,
+			&i.Fields,
+			&i.Stream,
 		); err != nil {
 			return nil, err
 		}
@@ -8457,7 +8904,7 @@ func (q *sqlQuerier) GetWorkspaceAgentLogsAfter(ctx context.Context, arg GetWork
 
 const getWorkspaceAgentMetadata = `-- name: GetWorkspaceAgentMetadata :many
 SELECT
-	workspace_agent_id, display_name, key, script, value, error, timeout, interval, collected_at, display_order
+	workspace_agent_id, display_name, key, script, value, error, timeout, interval, collected_at, display_order, collector
 FROM
 	workspace_agent_metadata
 WHERE
@@ -8490,6 +8937,7 @@ func (q *sqlQuerier) GetWorkspaceAgentMetadata(ctx context.Context, arg GetWorks
 			&i.Interval,
 			&i.CollectedAt,
 			&i.DisplayOrder,
+			&i.Collector,
 		); err != nil {
 			return nil, err
 		}
@@ -8506,7 +8954,7 @@ func (q *sqlQuerier) GetWorkspaceAgentMetadata(ctx context.Context, arg GetWorks
 
 const getWorkspaceAgentsByResourceIDs = `-- name: GetWorkspaceAgentsByResourceIDs :many
 SELECT
-	id, created_at, updated_at, name, first_connected_at, last_connected_at, disconnected_at, resource_id, auth_token, auth_instance_id, architecture, environment_variables, operating_system, instance_metadata, resource_metadata, directory, version, last_connected_replica_id, connection_timeout_seconds, troubleshooting_url, motd_file, lifecycle_state, expanded_directory, logs_length, logs_overflowed, started_at, ready_at, subsystems, display_apps, api_version
+	id, created_at, updated_at, name, first_connected_at, last_connected_at, disconnected_at, resource_id, auth_token, auth_instance_id, architecture, environment_variables, operating_system, instance_metadata, resource_metadata, directory, version, last_connected_replica_id, connection_timeout_seconds, troubleshooting_url, motd_file, lifecycle_state, expanded_directory, logs_length, logs_overflowed, started_at, ready_at, subsystems, display_apps, api_version, troubleshooting_urls
 FROM
 	workspace_agents
 WHERE
@@ -8553,6 +9001,7 @@ func (q *sqlQuerier) GetWorkspaceAgentsByResourceIDs(ctx context.Context, ids []
 			pq.Array(&i.Subsystems),
 			pq.Array(&i.DisplayApps),
 			&i.APIVersion,
+			&i.TroubleshootingURLs,
 		); err != nil {
 			return nil, err
 		}
@@ -8568,7 +9017,7 @@ func (q *sqlQuerier) GetWorkspaceAgentsByResourceIDs(ctx context.Context, ids []
 }
 
 const getWorkspaceAgentsCreatedAfter = `-- name: GetWorkspaceAgentsCreatedAfter :many
-SELECT id, created_at, updated_at, name, first_connected_at, last_connected_at, disconnected_at, resource_id, auth_token, auth_instance_id, architecture, environment_variables, operating_system, instance_metadata, resource_metadata, directory, version, last_connected_replica_id, connection_timeout_seconds, troubleshooting_url, motd_file, lifecycle_state, expanded_directory, logs_length, logs_overflowed, started_at, ready_at, subsystems, display_apps, api_version FROM workspace_agents WHERE created_at > $1
+SELECT id, created_at, updated_at, name, first_connected_at, last_connected_at, disconnected_at, resource_id, auth_token, auth_instance_id, architecture, environment_variables, operating_system, instance_metadata, resource_metadata, directory, version, last_connected_replica_id, connection_timeout_seconds, troubleshooting_url, motd_file, lifecycle_state, expanded_directory, logs_length, logs_overflowed, started_at, ready_at, subsystems, display_apps, api_version, troubleshooting_urls FROM workspace_agents WHERE created_at > $1
 `
 
 func (q *sqlQuerier) GetWorkspaceAgentsCreatedAfter(ctx context.Context, createdAt time.Time) ([]WorkspaceAgent, error) {
@@ -8611,6 +9060,7 @@ func (q *sqlQuerier) GetWorkspaceAgentsCreatedAfter(ctx context.Context, created
 			pq.Array(&i.Subsystems),
 			pq.Array(&i.DisplayApps),
 			&i.APIVersion,
+			&i.TroubleshootingURLs,
 		); err != nil {
 			return nil, err
 		}
@@ -8627,7 +9077,7 @@ func (q *sqlQuerier) GetWorkspaceAgentsCreatedAfter(ctx context.Context, created
 
 const getWorkspaceAgentsInLatestBuildByWorkspaceID = `-- name: GetWorkspaceAgentsInLatestBuildByWorkspaceID :many
 SELECT
-	workspace_agents.id, workspace_agents.created_at, workspace_agents.updated_at, workspace_agents.name, workspace_agents.first_connected_at, workspace_agents.last_connected_at, workspace_agents.disconnected_at, workspace_agents.resource_id, workspace_agents.auth_token, workspace_agents.auth_instance_id, workspace_agents.architecture, workspace_agents.environment_variables, workspace_agents.operating_system, workspace_agents.instance_metadata, workspace_agents.resource_metadata, workspace_agents.directory, workspace_agents.version, workspace_agents.last_connected_replica_id, workspace_agents.connection_timeout_seconds, workspace_agents.troubleshooting_url, workspace_agents.motd_file, workspace_agents.lifecycle_state, workspace_agents.expanded_directory, workspace_agents.logs_length, workspace_agents.logs_overflowed, workspace_agents.started_at, workspace_agents.ready_at, workspace_agents.subsystems, workspace_agents.display_apps, workspace_agents.api_version
+	workspace_agents.id, workspace_agents.created_at, workspace_agents.updated_at, workspace_agents.name, workspace_agents.first_connected_at, workspace_agents.last_connected_at, workspace_agents.disconnected_at, workspace_agents.resource_id, workspace_agents.auth_token, workspace_agents.auth_instance_id, workspace_agents.architecture, workspace_agents.environment_variables, workspace_agents.operating_system, workspace_agents.instance_metadata, workspace_agents.resource_metadata, workspace_agents.directory, workspace_agents.version, workspace_agents.last_connected_replica_id, workspace_agents.connection_timeout_seconds, workspace_agents.troubleshooting_url, workspace_agents.motd_file, workspace_agents.lifecycle_state, workspace_agents.expanded_directory, workspace_agents.logs_length, workspace_agents.logs_overflowed, workspace_agents.started_at, workspace_agents.ready_at, workspace_agents.subsystems, workspace_agents.display_apps, workspace_agents.api_version, workspace_agents.troubleshooting_urls
 FROM
 	workspace_agents
 JOIN
@@ -8686,6 +9136,7 @@ func (q *sqlQuerier) GetWorkspaceAgentsInLatestBuildByWorkspaceID(ctx context.Co
 			pq.Array(&i.Subsystems),
 			pq.Array(&i.DisplayApps),
 			&i.APIVersion,
+			&i.TroubleshootingURLs,
 		); err != nil {
 			return nil, err
 		}
@@ -8719,10 +9170,11 @@ INSERT INTO
 		connection_timeout_seconds,
 		troubleshooting_url,
 		motd_file,
-		display_apps
+		display_apps,
+		troubleshooting_urls
 	)
 VALUES
-	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id, created_at, updated_at, name, first_connected_at, last_connected_at, disconnected_at, resource_id, auth_token, auth_instance_id, architecture, environment_variables, operating_system, instance_metadata, resource_metadata, directory, version, last_connected_replica_id, connection_timeout_seconds, troubleshooting_url, motd_file, lifecycle_state, expanded_directory, logs_length, logs_overflowed, started_at, ready_at, subsystems, display_apps, api_version
+	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18) RETURNING id, created_at, updated_at, name, first_connected_at, last_connected_at, disconnected_at, resource_id, auth_token, auth_instance_id, architecture, environment_variables, operating_system, instance_metadata, resource_metadata, directory, version, last_connected_replica_id, connection_timeout_seconds, troubleshooting_url, motd_file, lifecycle_state, expanded_directory, logs_length, logs_overflowed, started_at, ready_at, subsystems, display_apps, api_version, troubleshooting_urls
 `
 
 type InsertWorkspaceAgentParams struct {
@@ -8743,6 +9195,7 @@ type InsertWorkspaceAgentParams struct {
 	TroubleshootingURL       string                `db:"troubleshooting_url" json:"troubleshooting_url"`
 	MOTDFile                 string                `db:"motd_file" json:"motd_file"`
 	DisplayApps              []DisplayApp          `db:"display_apps" json:"display_apps"`
+	TroubleshootingURLs      json.RawMessage       `db:"troubleshooting_urls" json:"troubleshooting_urls"`
 }
 
 func (q *sqlQuerier) InsertWorkspaceAgent(ctx context.Context, arg InsertWorkspaceAgentParams) (WorkspaceAgent, error) {
@@ -8764,6 +9217,7 @@ func (q *sqlQuerier) InsertWorkspaceAgent(ctx context.Context, arg InsertWorkspa
 		arg.TroubleshootingURL,
 		arg.MOTDFile,
 		pq.Array(arg.DisplayApps),
+		arg.TroubleshootingURLs,
 	)
 	var i WorkspaceAgent
 	err := row.Scan(
@@ -8797,6 +9251,7 @@ func (q *sqlQuerier) InsertWorkspaceAgent(ctx context.Context, arg InsertWorkspa
 		pq.Array(&i.Subsystems),
 		pq.Array(&i.DisplayApps),
 		&i.APIVersion,
+		&i.TroubleshootingURLs,
 	)
 	return i, err
 }
@@ -8862,14 +9317,16 @@ WITH new_length AS (
 	logs_length = logs_length + $6 WHERE workspace_agents.id = $1
 )
 INSERT INTO
-		workspace_agent_logs (agent_id, created_at, output, level, log_source_id)
+		workspace_agent_logs (agent_id, created_at, output, level, log_source_id, fields, stream)
 	SELECT
 		$1 :: uuid AS agent_id,
 		$2 :: timestamptz AS created_at,
 		unnest($3 :: VARCHAR(1024) [ ]) AS output,
 		unnest($4 :: log_level [ ]) AS level,
-		$5 :: uuid AS log_source_id
-	RETURNING workspace_agent_logs.agent_id, workspace_agent_logs.created_at, workspace_agent_logs.output, workspace_agent_logs.id, workspace_agent_logs.level, workspace_agent_logs.log_source_id
+		$5 :: uuid AS log_source_id,
+		unnest($7 :: text [ ]) :: jsonb AS fields,
+		unnest($8 :: text [ ]) AS stream
+	RETURNING workspace_agent_logs.agent_id, workspace_agent_logs.created_at, workspace_agent_logs.output, workspace_agent_logs.id, workspace_agent_logs.level, workspace_agent_logs.log_source_id, workspace_agent_logs.fields, workspace_agent_logs.stream
 `
 
 type InsertWorkspaceAgentLogsParams struct {
@@ -8879,6 +9336,8 @@ type InsertWorkspaceAgentLogsParams struct {
 	Level        []LogLevel `db:"level" json:"level"`
 	LogSourceID  uuid.UUID  `db:"log_source_id" json:"log_source_id"`
 	OutputLength int32      `db:"output_length" json:"output_length"`
+	Fields       []string   `db:"fields" json:"fields"`
+	Stream       []string   `db:"stream" json:"stream"`
 }
 
 func (q *sqlQuerier) InsertWorkspaceAgentLogs(ctx context.Context, arg InsertWorkspaceAgentLogsParams) ([]WorkspaceAgentLog, error) {
@@ -8889,6 +9348,8 @@ func (q *sqlQuerier) InsertWorkspaceAgentLogs(ctx context.Context, arg InsertWor
 		pq.Array(arg.Level),
 		arg.LogSourceID,
 		arg.OutputLength,
+		pq.Array(arg.Fields),
+		pq.Array(arg.Stream),
 	)
 	if err != nil {
 		return nil, err
@@ -8904,6 +9365,8 @@ func (q *sqlQuerier) InsertWorkspaceAgentLogs(ctx context.Context, arg InsertWor
 			&i.ID,
 			&i.Level,
 			&i.LogSourceID,
+			&i.Fields,
+			&i.Stream,
 		); err != nil {
 			return nil, err
 		}
@@ -8927,10 +9390,11 @@ INSERT INTO
 		script,
 		timeout,
 		interval,
-		display_order
+		display_order,
+		collector
 	)
 VALUES
-	($1, $2, $3, $4, $5, $6, $7)
+	($1, $2, $3, $4, $5, $6, $7, $8)
 `
 
 type InsertWorkspaceAgentMetadataParams struct {
@@ -8941,6 +9405,7 @@ type InsertWorkspaceAgentMetadataParams struct {
 	Timeout          int64     `db:"timeout" json:"timeout"`
 	Interval         int64     `db:"interval" json:"interval"`
 	DisplayOrder     int32     `db:"display_order" json:"display_order"`
+	Collector        string    `db:"collector" json:"collector"`
 }
 
 func (q *sqlQuerier) InsertWorkspaceAgentMetadata(ctx context.Context, arg InsertWorkspaceAgentMetadataParams) error {
@@ -8952,6 +9417,7 @@ func (q *sqlQuerier) InsertWorkspaceAgentMetadata(ctx context.Context, arg Inser
 		arg.Timeout,
 		arg.Interval,
 		arg.DisplayOrder,
+		arg.Collector,
 	)
 	return err
 }
@@ -9077,6 +9543,27 @@ func (q *sqlQuerier) UpdateWorkspaceAgentMetadata(ctx context.Context, arg Updat
 	return err
 }
 
+const updateWorkspaceAgentResourceIDByID = `-- name: UpdateWorkspaceAgentResourceIDByID :exec
+UPDATE
+	workspace_agents
+SET
+	resource_id = $2,
+	updated_at = $3
+WHERE
+	id = $1
+`
+
+type UpdateWorkspaceAgentResourceIDByIDParams struct {
+	ID         uuid.UUID `db:"id" json:"id"`
+	ResourceID uuid.UUID `db:"resource_id" json:"resource_id"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+}
+
+func (q *sqlQuerier) UpdateWorkspaceAgentResourceIDByID(ctx context.Context, arg UpdateWorkspaceAgentResourceIDByIDParams) error {
+	_, err := q.db.ExecContext(ctx, updateWorkspaceAgentResourceIDByID, arg.ID, arg.ResourceID, arg.UpdatedAt)
+	return err
+}
+
 const updateWorkspaceAgentStartupByID = `-- name: UpdateWorkspaceAgentStartupByID :exec
 UPDATE
 	workspace_agents
@@ -9617,8 +10104,189 @@ func (q *sqlQuerier) InsertWorkspaceAgentStats(ctx context.Context, arg InsertWo
 	return err
 }
 
+const appendWorkspaceAgentUploadChunk = `-- name: AppendWorkspaceAgentUploadChunk :one
+WITH upload AS (
+	UPDATE
+		workspace_agent_uploads
+	SET
+		received = received + octet_length($1 :: bytea),
+		updated_at = $2
+	WHERE
+		workspace_agent_id = $3
+		AND name = $4
+		AND checksum = $5
+		AND received = $6 :: bigint
+	RETURNING
+		workspace_agent_id, name, checksum, received
+), chunk AS (
+	INSERT INTO
+		workspace_agent_upload_chunks (workspace_agent_id, name, checksum, chunk_offset, data)
+	SELECT
+		workspace_agent_id, name, checksum, $6 :: bigint, $1 :: bytea
+	FROM
+		upload
+	WHERE
+		octet_length($1 :: bytea) > 0
+)
+SELECT
+	received
+FROM
+	upload
+`
+
+type AppendWorkspaceAgentUploadChunkParams struct {
+	Chunk            []byte    `db:"chunk" json:"chunk"`
+	UpdatedAt        time.Time `db:"updated_at" json:"updated_at"`
+	WorkspaceAgentID uuid.UUID `db:"workspace_agent_id" json:"workspace_agent_id"`
+	Name             string    `db:"name" json:"name"`
+	Checksum         string    `db:"checksum" json:"checksum"`
+	Offset           int64     `db:"offset" json:"offset"`
+}
+
+// Stores the chunk if the upload received exactly offset bytes so far, so
+// chunks can't be stored twice or out of order. Returns the number of bytes
+// received.
+func (q *sqlQuerier) AppendWorkspaceAgentUploadChunk(ctx context.Context, arg AppendWorkspaceAgentUploadChunkParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, appendWorkspaceAgentUploadChunk,
+		arg.Chunk,
+		arg.UpdatedAt,
+		arg.WorkspaceAgentID,
+		arg.Name,
+		arg.Checksum,
+		arg.Offset,
+	)
+	var received int64
+	err := row.Scan(&received)
+	return received, err
+}
+
+const deleteOldWorkspaceAgentUploads = `-- name: DeleteOldWorkspaceAgentUploads :exec
+DELETE FROM workspace_agent_uploads WHERE updated_at < NOW() - INTERVAL '1 day'
+`
+
+// Uploads that didn't receive a chunk for a day are abandoned, e.g. because
+// the workspace was stopped.
+func (q *sqlQuerier) DeleteOldWorkspaceAgentUploads(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteOldWorkspaceAgentUploads)
+	return err
+}
+
+const deleteWorkspaceAgentUpload = `-- name: DeleteWorkspaceAgentUpload :exec
+DELETE FROM
+	workspace_agent_uploads
+WHERE
+	workspace_agent_id = $1
+	AND name = $2
+	AND checksum = $3
+`
+
+type DeleteWorkspaceAgentUploadParams struct {
+	WorkspaceAgentID uuid.UUID `db:"workspace_agent_id" json:"workspace_agent_id"`
+	Name             string    `db:"name" json:"name"`
+	Checksum         string    `db:"checksum" json:"checksum"`
+}
+
+func (q *sqlQuerier) DeleteWorkspaceAgentUpload(ctx context.Context, arg DeleteWorkspaceAgentUploadParams) error {
+	_, err := q.db.ExecContext(ctx, deleteWorkspaceAgentUpload, arg.WorkspaceAgentID, arg.Name, arg.Checksum)
+	return err
+}
+
+const getWorkspaceAgentUpload = `-- name: GetWorkspaceAgentUpload :one
+SELECT
+	workspace_agent_id, name, checksum, size, created_at, updated_at, received
+FROM
+	workspace_agent_uploads
+WHERE
+	workspace_agent_id = $1
+	AND name = $2
+	AND checksum = $3
+`
+
+type GetWorkspaceAgentUploadParams struct {
+	WorkspaceAgentID uuid.UUID `db:"workspace_agent_id" json:"workspace_agent_id"`
+	Name             string    `db:"name" json:"name"`
+	Checksum         string    `db:"checksum" json:"checksum"`
+}
+
+func (q *sqlQuerier) GetWorkspaceAgentUpload(ctx context.Context, arg GetWorkspaceAgentUploadParams) (WorkspaceAgentUpload, error) {
+	row := q.db.QueryRowContext(ctx, getWorkspaceAgentUpload, arg.WorkspaceAgentID, arg.Name, arg.Checksum)
+	var i WorkspaceAgentUpload
+	err := row.Scan(
+		&i.WorkspaceAgentID,
+		&i.Name,
+		&i.Checksum,
+		&i.Size,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Received,
+	)
+	return i, err
+}
+
+const getWorkspaceAgentUploadData = `-- name: GetWorkspaceAgentUploadData :one
+SELECT
+	COALESCE(string_agg(data, ''::bytea ORDER BY chunk_offset), ''::bytea) :: bytea
+FROM
+	workspace_agent_upload_chunks
+WHERE
+	workspace_agent_id = $1
+	AND name = $2
+	AND checksum = $3
+`
+
+type GetWorkspaceAgentUploadDataParams struct {
+	WorkspaceAgentID uuid.UUID `db:"workspace_agent_id" json:"workspace_agent_id"`
+	Name             string    `db:"name" json:"name"`
+	Checksum         string    `db:"checksum" json:"checksum"`
+}
+
+// Assembles the chunks of the upload.
+func (q *sqlQuerier) GetWorkspaceAgentUploadData(ctx context.Context, arg GetWorkspaceAgentUploadDataParams) ([]byte, error) {
+	row := q.db.QueryRowContext(ctx, getWorkspaceAgentUploadData, arg.WorkspaceAgentID, arg.Name, arg.Checksum)
+	var column_1 []byte
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const insertWorkspaceAgentUpload = `-- name: InsertWorkspaceAgentUpload :execrows
+INSERT INTO
+	workspace_agent_uploads (workspace_agent_id, name, checksum, size, created_at, updated_at)
+SELECT
+	$1 :: uuid, $2 :: text, $3 :: text, $4 :: bigint, $5 :: timestamptz, $5 :: timestamptz
+WHERE
+	(SELECT COUNT(*) FROM workspace_agent_uploads WHERE workspace_agent_id = $1 :: uuid) < $6 :: bigint
+ON CONFLICT DO NOTHING
+`
+
+type InsertWorkspaceAgentUploadParams struct {
+	WorkspaceAgentID uuid.UUID `db:"workspace_agent_id" json:"workspace_agent_id"`
+	Name             string    `db:"name" json:"name"`
+	Checksum         string    `db:"checksum" json:"checksum"`
+	Size             int64     `db:"size" json:"size"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+	MaxUploads       int64     `db:"max_uploads" json:"max_uploads"`
+}
+
+// Starts an upload unless the agent already has max_uploads uploads in
+// progress. Returns 0 if the upload wasn't inserted, either because it
+// exists or because of the limit.
+func (q *sqlQuerier) InsertWorkspaceAgentUpload(ctx context.Context, arg InsertWorkspaceAgentUploadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, insertWorkspaceAgentUpload,
+		arg.WorkspaceAgentID,
+		arg.Name,
+		arg.Checksum,
+		arg.Size,
+		arg.CreatedAt,
+		arg.MaxUploads,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getWorkspaceAppByAgentIDAndSlug = `-- name: GetWorkspaceAppByAgentIDAndSlug :one
-SELECT id, created_at, agent_id, display_name, icon, command, url, healthcheck_url, healthcheck_interval, healthcheck_threshold, health, subdomain, sharing_level, slug, external, display_order FROM workspace_apps WHERE agent_id = $1 AND slug = $2
+SELECT id, created_at, agent_id, display_name, icon, command, url, healthcheck_url, healthcheck_interval, healthcheck_threshold, health, subdomain, sharing_level, slug, external, display_order, health_latency_ms, health_error, health_checked_at FROM workspace_apps WHERE agent_id = $1 AND slug = $2
 `
 
 type GetWorkspaceAppByAgentIDAndSlugParams struct {
@@ -9646,12 +10314,15 @@ func (q *sqlQuerier) GetWorkspaceAppByAgentIDAndSlug(ctx context.Context, arg Ge
 		&i.Slug,
 		&i.External,
 		&i.DisplayOrder,
+		&i.HealthLatencyMs,
+		&i.HealthError,
+		&i.HealthCheckedAt,
 	)
 	return i, err
 }
 
 const getWorkspaceAppsByAgentID = `-- name: GetWorkspaceAppsByAgentID :many
-SELECT id, created_at, agent_id, display_name, icon, command, url, healthcheck_url, healthcheck_interval, healthcheck_threshold, health, subdomain, sharing_level, slug, external, display_order FROM workspace_apps WHERE agent_id = $1 ORDER BY slug ASC
+SELECT id, created_at, agent_id, display_name, icon, command, url, healthcheck_url, healthcheck_interval, healthcheck_threshold, health, subdomain, sharing_level, slug, external, display_order, health_latency_ms, health_error, health_checked_at FROM workspace_apps WHERE agent_id = $1 ORDER BY slug ASC
 `
 
 func (q *sqlQuerier) GetWorkspaceAppsByAgentID(ctx context.Context, agentID uuid.UUID) ([]WorkspaceApp, error) {
@@ -9680,6 +10351,9 @@ func (q *sqlQuerier) GetWorkspaceAppsByAgentID(ctx context.Context, agentID uuid
 			&i.Slug,
 			&i.External,
 			&i.DisplayOrder,
+			&i.HealthLatencyMs,
+			&i.HealthError,
+			&i.HealthCheckedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -9695,7 +10369,7 @@ func (q *sqlQuerier) GetWorkspaceAppsByAgentID(ctx context.Context, agentID uuid
 }
 
 const getWorkspaceAppsByAgentIDs = `-- name: GetWorkspaceAppsByAgentIDs :many
-SELECT id, created_at, agent_id, display_name, icon, command, url, healthcheck_url, healthcheck_interval, healthcheck_threshold, health, subdomain, sharing_level, slug, external, display_order FROM workspace_apps WHERE agent_id = ANY($1 :: uuid [ ]) ORDER BY slug ASC
+SELECT id, created_at, agent_id, display_name, icon, command, url, healthcheck_url, healthcheck_interval, healthcheck_threshold, health, subdomain, sharing_level, slug, external, display_order, health_latency_ms, health_error, health_checked_at FROM workspace_apps WHERE agent_id = ANY($1 :: uuid [ ]) ORDER BY slug ASC
 `
 
 func (q *sqlQuerier) GetWorkspaceAppsByAgentIDs(ctx context.Context, ids []uuid.UUID) ([]WorkspaceApp, error) {
@@ -9724,6 +10398,9 @@ func (q *sqlQuerier) GetWorkspaceAppsByAgentIDs(ctx context.Context, ids []uuid.
 			&i.Slug,
 			&i.External,
 			&i.DisplayOrder,
+			&i.HealthLatencyMs,
+			&i.HealthError,
+			&i.HealthCheckedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -9739,7 +10416,7 @@ func (q *sqlQuerier) GetWorkspaceAppsByAgentIDs(ctx context.Context, ids []uuid.
 }
 
 const getWorkspaceAppsCreatedAfter = `-- name: GetWorkspaceAppsCreatedAfter :many
-SELECT id, created_at, agent_id, display_name, icon, command, url, healthcheck_url, healthcheck_interval, healthcheck_threshold, health, subdomain, sharing_level, slug, external, display_order FROM workspace_apps WHERE created_at > $1 ORDER BY slug ASC
+SELECT id, created_at, agent_id, display_name, icon, command, url, healthcheck_url, healthcheck_interval, healthcheck_threshold, health, subdomain, sharing_level, slug, external, display_order, health_latency_ms, health_error, health_checked_at FROM workspace_apps WHERE created_at > $1 ORDER BY slug ASC
 `
 
 func (q *sqlQuerier) GetWorkspaceAppsCreatedAfter(ctx context.Context, createdAt time.Time) ([]WorkspaceApp, error) {
@@ -9768,6 +10445,9 @@ func (q *sqlQuerier) GetWorkspaceAppsCreatedAfter(ctx context.Context, createdAt
 			&i.Slug,
 			&i.External,
 			&i.DisplayOrder,
+			&i.HealthLatencyMs,
+			&i.HealthError,
+			&i.HealthCheckedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -9803,7 +10483,7 @@ INSERT INTO
         display_order
     )
 VALUES
-    ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING id, created_at, agent_id, display_name, icon, command, url, healthcheck_url, healthcheck_interval, healthcheck_threshold, health, subdomain, sharing_level, slug, external, display_order
+    ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING id, created_at, agent_id, display_name, icon, command, url, healthcheck_url, healthcheck_interval, healthcheck_threshold, health, subdomain, sharing_level, slug, external, display_order, health_latency_ms, health_error, health_checked_at
 `
 
 type InsertWorkspaceAppParams struct {
@@ -9862,6 +10542,9 @@ func (q *sqlQuerier) InsertWorkspaceApp(ctx context.Context, arg InsertWorkspace
 		&i.Slug,
 		&i.External,
 		&i.DisplayOrder,
+		&i.HealthLatencyMs,
+		&i.HealthError,
+		&i.HealthCheckedAt,
 	)
 	return i, err
 }
@@ -9870,18 +10553,30 @@ const updateWorkspaceAppHealthByID = `-- name: UpdateWorkspaceAppHealthByID :exe
 UPDATE
 	workspace_apps
 SET
-	health = $2
+	health = $2,
+	health_latency_ms = $3,
+	health_error = $4,
+	health_checked_at = $5
 WHERE
 	id = $1
 `
 
 type UpdateWorkspaceAppHealthByIDParams struct {
-	ID     uuid.UUID          `db:"id" json:"id"`
-	Health WorkspaceAppHealth `db:"health" json:"health"`
+	ID              uuid.UUID          `db:"id" json:"id"`
+	Health          WorkspaceAppHealth `db:"health" json:"health"`
+	HealthLatencyMs float64            `db:"health_latency_ms" json:"health_latency_ms"`
+	HealthError     string             `db:"health_error" json:"health_error"`
+	HealthCheckedAt sql.NullTime       `db:"health_checked_at" json:"health_checked_at"`
 }
 
 func (q *sqlQuerier) UpdateWorkspaceAppHealthByID(ctx context.Context, arg UpdateWorkspaceAppHealthByIDParams) error {
-	_, err := q.db.ExecContext(ctx, updateWorkspaceAppHealthByID, arg.ID, arg.Health)
+	_, err := q.db.ExecContext(ctx, updateWorkspaceAppHealthByID,
+		arg.ID,
+		arg.Health,
+		arg.HealthLatencyMs,
+		arg.HealthError,
+		arg.HealthCheckedAt,
+	)
 	return err
 }
 
@@ -9951,6 +10646,132 @@ func (q *sqlQuerier) InsertWorkspaceAppStats(ctx context.Context, arg InsertWork
 	return err
 }
 
+const getLatestWorkspaceBuildCapacityFallbackByWorkspaceID = `-- name: GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID :one
+SELECT
+	workspace_build_capacity_fallbacks.workspace_build_id, workspace_build_capacity_fallbacks.selected, workspace_build_capacity_fallbacks.attempts
+FROM
+	workspace_build_capacity_fallbacks
+JOIN
+	workspace_builds ON workspace_builds.id = workspace_build_capacity_fallbacks.workspace_build_id
+WHERE
+	workspace_builds.workspace_id = $1
+ORDER BY
+	workspace_builds.build_number DESC
+LIMIT
+	1
+`
+
+func (q *sqlQuerier) GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID(ctx context.Context, workspaceID uuid.UUID) (WorkspaceBuildCapacityFallback, error) {
+	row := q.db.QueryRowContext(ctx, getLatestWorkspaceBuildCapacityFallbackByWorkspaceID, workspaceID)
+	var i WorkspaceBuildCapacityFallback
+	err := row.Scan(&i.WorkspaceBuildID, &i.Selected, &i.Attempts)
+	return i, err
+}
+
+const getWorkspaceBuildCapacityFallbackByBuildID = `-- name: GetWorkspaceBuildCapacityFallbackByBuildID :one
+SELECT
+	workspace_build_id, selected, attempts
+FROM
+	workspace_build_capacity_fallbacks
+WHERE
+	workspace_build_id = $1
+`
+
+func (q *sqlQuerier) GetWorkspaceBuildCapacityFallbackByBuildID(ctx context.Context, workspaceBuildID uuid.UUID) (WorkspaceBuildCapacityFallback, error) {
+	row := q.db.QueryRowContext(ctx, getWorkspaceBuildCapacityFallbackByBuildID, workspaceBuildID)
+	var i WorkspaceBuildCapacityFallback
+	err := row.Scan(&i.WorkspaceBuildID, &i.Selected, &i.Attempts)
+	return i, err
+}
+
+const insertWorkspaceBuildCapacityFallback = `-- name: InsertWorkspaceBuildCapacityFallback :exec
+INSERT INTO
+	workspace_build_capacity_fallbacks (workspace_build_id, selected, attempts)
+VALUES
+	($1, $2, $3)
+`
+
+type InsertWorkspaceBuildCapacityFallbackParams struct {
+	WorkspaceBuildID uuid.UUID       `db:"workspace_build_id" json:"workspace_build_id"`
+	Selected         string          `db:"selected" json:"selected"`
+	Attempts         json.RawMessage `db:"attempts" json:"attempts"`
+}
+
+func (q *sqlQuerier) InsertWorkspaceBuildCapacityFallback(ctx context.Context, arg InsertWorkspaceBuildCapacityFallbackParams) error {
+	_, err := q.db.ExecContext(ctx, insertWorkspaceBuildCapacityFallback, arg.WorkspaceBuildID, arg.Selected, arg.Attempts)
+	return err
+}
+
+const getWorkspaceBuildMetadataByBuildID = `-- name: GetWorkspaceBuildMetadataByBuildID :many
+SELECT
+	workspace_build_id, key, value, sensitive, display_order
+FROM
+	workspace_build_metadata
+WHERE
+	workspace_build_id = $1
+ORDER BY
+	display_order ASC
+`
+
+func (q *sqlQuerier) GetWorkspaceBuildMetadataByBuildID(ctx context.Context, workspaceBuildID uuid.UUID) ([]WorkspaceBuildMetadatum, error) {
+	rows, err := q.db.QueryContext(ctx, getWorkspaceBuildMetadataByBuildID, workspaceBuildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WorkspaceBuildMetadatum
+	for rows.Next() {
+		var i WorkspaceBuildMetadatum
+		if err := rows.Scan(
+			&i.WorkspaceBuildID,
+			&i.Key,
+			&i.Value,
+			&i.Sensitive,
+			&i.DisplayOrder,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const insertWorkspaceBuildMetadata = `-- name: InsertWorkspaceBuildMetadata :exec
+INSERT INTO
+	workspace_build_metadata (workspace_build_id, key, value, sensitive, display_order)
+SELECT
+	$1 :: uuid AS workspace_build_id,
+	unnest($2 :: text [ ]) AS key,
+	unnest($3 :: text [ ]) AS value,
+	unnest($4 :: boolean [ ]) AS sensitive,
+	unnest($5 :: integer [ ]) AS display_order
+`
+
+type InsertWorkspaceBuildMetadataParams struct {
+	WorkspaceBuildID uuid.UUID `db:"workspace_build_id" json:"workspace_build_id"`
+	Key              []string  `db:"key" json:"key"`
+	Value            []string  `db:"value" json:"value"`
+	Sensitive        []bool    `db:"sensitive" json:"sensitive"`
+	DisplayOrder     []int32   `db:"display_order" json:"display_order"`
+}
+
+func (q *sqlQuerier) InsertWorkspaceBuildMetadata(ctx context.Context, arg InsertWorkspaceBuildMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, insertWorkspaceBuildMetadata,
+		arg.WorkspaceBuildID,
+		pq.Array(arg.Key),
+		pq.Array(arg.Value),
+		pq.Array(arg.Sensitive),
+		pq.Array(arg.DisplayOrder),
+	)
+	return err
+}
+
 const getUserWorkspaceBuildParameters = `-- name: GetUserWorkspaceBuildParameters :many
 SELECT name, value
 FROM (
@@ -10014,7 +10835,7 @@ func (q *sqlQuerier) GetUserWorkspaceBuildParameters(ctx context.Context, arg Ge
 
 const getWorkspaceBuildParameters = `-- name: GetWorkspaceBuildParameters :many
 SELECT
-    workspace_build_id, name, value
+    workspace_build_id, name, value, source
 FROM
     workspace_build_parameters
 WHERE
@@ -10030,7 +10851,12 @@ func (q *sqlQuerier) GetWorkspaceBuildParameters(ctx context.Context, workspaceB
 	var items []WorkspaceBuildParameter
 	for rows.Next() {
 		var i WorkspaceBuildParameter
-		if err := rows.Scan(&i.WorkspaceBuildID, &i.Name, &i.Value); err != nil {
+		if err := rows.Scan(
+			&i.WorkspaceBuildID,
+			&i.Name,
+			&i.Value,
+			&i.Source,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -10046,22 +10872,29 @@ func (q *sqlQuerier) GetWorkspaceBuildParameters(ctx context.Context, workspaceB
 
 const insertWorkspaceBuildParameters = `-- name: InsertWorkspaceBuildParameters :exec
 INSERT INTO
-    workspace_build_parameters (workspace_build_id, name, value)
+    workspace_build_parameters (workspace_build_id, name, value, source)
 SELECT
     $1 :: uuid AS workspace_build_id,
     unnest($2 :: text[]) AS name,
-    unnest($3 :: text[]) AS value
-RETURNING workspace_build_id, name, value
+    unnest($3 :: text[]) AS value,
+    unnest($4 :: text[]) AS source
+RETURNING workspace_build_id, name, value, source
 `
 
 type InsertWorkspaceBuildParametersParams struct {
 	WorkspaceBuildID uuid.UUID `db:"workspace_build_id" json:"workspace_build_id"`
 	Name             []string  `db:"name" json:"name"`
 	Value            []string  `db:"value" json:"value"`
+	Source           []string  `db:"source" json:"source"`
 }
 
 func (q *sqlQuerier) InsertWorkspaceBuildParameters(ctx context.Context, arg InsertWorkspaceBuildParametersParams) error {
-	_, err := q.db.ExecContext(ctx, insertWorkspaceBuildParameters, arg.WorkspaceBuildID, pq.Array(arg.Name), pq.Array(arg.Value))
+	_, err := q.db.ExecContext(ctx, insertWorkspaceBuildParameters,
+		arg.WorkspaceBuildID,
+		pq.Array(arg.Name),
+		pq.Array(arg.Value),
+		pq.Array(arg.Source),
+	)
 	return err
 }
 
@@ -10648,9 +11481,21 @@ func (q *sqlQuerier) UpdateWorkspaceBuildProvisionerStateByID(ctx context.Contex
 	return err
 }
 
+const deleteWorkspaceResourceMetadataByResourceID = `-- name: DeleteWorkspaceResourceMetadataByResourceID :exec
+DELETE FROM
+	workspace_resource_metadata
+WHERE
+	workspace_resource_id = $1
+`
+
+func (q *sqlQuerier) DeleteWorkspaceResourceMetadataByResourceID(ctx context.Context, workspaceResourceID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteWorkspaceResourceMetadataByResourceID, workspaceResourceID)
+	return err
+}
+
 const getWorkspaceResourceByID = `-- name: GetWorkspaceResourceByID :one
 SELECT
-	id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost
+	id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost, action, address
 FROM
 	workspace_resources
 WHERE
@@ -10671,17 +11516,19 @@ func (q *sqlQuerier) GetWorkspaceResourceByID(ctx context.Context, id uuid.UUID)
 		&i.Icon,
 		&i.InstanceType,
 		&i.DailyCost,
+		&i.Action,
+		&i.Address,
 	)
 	return i, err
 }
 
 const getWorkspaceResourceMetadataByResourceIDs = `-- name: GetWorkspaceResourceMetadataByResourceIDs :many
 SELECT
-	workspace_resource_id, key, value, sensitive, id
+	workspace_resource_id, key, value, sensitive, id, display_order, display_group
 FROM
 	workspace_resource_metadata
 WHERE
-	workspace_resource_id = ANY($1 :: uuid [ ]) ORDER BY id ASC
+	workspace_resource_id = ANY($1 :: uuid [ ]) ORDER BY display_order ASC, id ASC
 `
 
 func (q *sqlQuerier) GetWorkspaceResourceMetadataByResourceIDs(ctx context.Context, ids []uuid.UUID) ([]WorkspaceResourceMetadatum, error) {
@@ -10699,6 +11546,8 @@ func (q *sqlQuerier) GetWorkspaceResourceMetadataByResourceIDs(ctx context.Conte
 			&i.Value,
 			&i.Sensitive,
 			&i.ID,
+			&i.DisplayOrder,
+			&i.DisplayGroup,
 		); err != nil {
 			return nil, err
 		}
@@ -10714,7 +11563,7 @@ func (q *sqlQuerier) GetWorkspaceResourceMetadataByResourceIDs(ctx context.Conte
 }
 
 const getWorkspaceResourceMetadataCreatedAfter = `-- name: GetWorkspaceResourceMetadataCreatedAfter :many
-SELECT workspace_resource_id, key, value, sensitive, id FROM workspace_resource_metadata WHERE workspace_resource_id = ANY(
+SELECT workspace_resource_id, key, value, sensitive, id, display_order, display_group FROM workspace_resource_metadata WHERE workspace_resource_id = ANY(
 	SELECT id FROM workspace_resources WHERE created_at > $1
 )
 `
@@ -10734,6 +11583,8 @@ func (q *sqlQuerier) GetWorkspaceResourceMetadataCreatedAfter(ctx context.Contex
 			&i.Value,
 			&i.Sensitive,
 			&i.ID,
+			&i.DisplayOrder,
+			&i.DisplayGroup,
 		); err != nil {
 			return nil, err
 		}
@@ -10750,7 +11601,7 @@ func (q *sqlQuerier) GetWorkspaceResourceMetadataCreatedAfter(ctx context.Contex
 
 const getWorkspaceResourcesByJobID = `-- name: GetWorkspaceResourcesByJobID :many
 SELECT
-	id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost
+	id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost, action, address
 FROM
 	workspace_resources
 WHERE
@@ -10777,6 +11628,8 @@ func (q *sqlQuerier) GetWorkspaceResourcesByJobID(ctx context.Context, jobID uui
 			&i.Icon,
 			&i.InstanceType,
 			&i.DailyCost,
+			&i.Action,
+			&i.Address,
 		); err != nil {
 			return nil, err
 		}
@@ -10793,7 +11646,7 @@ func (q *sqlQuerier) GetWorkspaceResourcesByJobID(ctx context.Context, jobID uui
 
 const getWorkspaceResourcesByJobIDs = `-- name: GetWorkspaceResourcesByJobIDs :many
 SELECT
-	id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost
+	id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost, action, address
 FROM
 	workspace_resources
 WHERE
@@ -10820,6 +11673,8 @@ func (q *sqlQuerier) GetWorkspaceResourcesByJobIDs(ctx context.Context, ids []uu
 			&i.Icon,
 			&i.InstanceType,
 			&i.DailyCost,
+			&i.Action,
+			&i.Address,
 		); err != nil {
 			return nil, err
 		}
@@ -10835,7 +11690,7 @@ func (q *sqlQuerier) GetWorkspaceResourcesByJobIDs(ctx context.Context, ids []uu
 }
 
 const getWorkspaceResourcesCreatedAfter = `-- name: GetWorkspaceResourcesCreatedAfter :many
-SELECT id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost FROM workspace_resources WHERE created_at > $1
+SELECT id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost, action, address FROM workspace_resources WHERE created_at > $1
 `
 
 func (q *sqlQuerier) GetWorkspaceResourcesCreatedAfter(ctx context.Context, createdAt time.Time) ([]WorkspaceResource, error) {
@@ -10858,6 +11713,8 @@ func (q *sqlQuerier) GetWorkspaceResourcesCreatedAfter(ctx context.Context, crea
 			&i.Icon,
 			&i.InstanceType,
 			&i.DailyCost,
+			&i.Action,
+			&i.Address,
 		); err != nil {
 			return nil, err
 		}
@@ -10874,9 +11731,9 @@ func (q *sqlQuerier) GetWorkspaceResourcesCreatedAfter(ctx context.Context, crea
 
 const insertWorkspaceResource = `-- name: InsertWorkspaceResource :one
 INSERT INTO
-	workspace_resources (id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost)
+	workspace_resources (id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost, action, address)
 VALUES
-	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost
+	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost, action, address
 `
 
 type InsertWorkspaceResourceParams struct {
@@ -10890,6 +11747,8 @@ type InsertWorkspaceResourceParams struct {
 	Icon         string              `db:"icon" json:"icon"`
 	InstanceType sql.NullString      `db:"instance_type" json:"instance_type"`
 	DailyCost    int32               `db:"daily_cost" json:"daily_cost"`
+	Action       string              `db:"action" json:"action"`
+	Address      string              `db:"address" json:"address"`
 }
 
 func (q *sqlQuerier) InsertWorkspaceResource(ctx context.Context, arg InsertWorkspaceResourceParams) (WorkspaceResource, error) {
@@ -10904,6 +11763,8 @@ func (q *sqlQuerier) InsertWorkspaceResource(ctx context.Context, arg InsertWork
 		arg.Icon,
 		arg.InstanceType,
 		arg.DailyCost,
+		arg.Action,
+		arg.Address,
 	)
 	var i WorkspaceResource
 	err := row.Scan(
@@ -10917,18 +11778,22 @@ func (q *sqlQuerier) InsertWorkspaceResource(ctx context.Context, arg InsertWork
 		&i.Icon,
 		&i.InstanceType,
 		&i.DailyCost,
+		&i.Action,
+		&i.Address,
 	)
 	return i, err
 }
 
 const insertWorkspaceResourceMetadata = `-- name: InsertWorkspaceResourceMetadata :many
 INSERT INTO
-	workspace_resource_metadata
+	workspace_resource_metadata (workspace_resource_id, key, value, sensitive, display_order, display_group)
 SELECT
 	$1 :: uuid AS workspace_resource_id,
 	unnest($2 :: text [ ]) AS key,
 	unnest($3 :: text [ ]) AS value,
-	unnest($4 :: boolean [ ]) AS sensitive RETURNING workspace_resource_id, key, value, sensitive, id
+	unnest($4 :: boolean [ ]) AS sensitive,
+	unnest($5 :: integer [ ]) AS display_order,
+	unnest($6 :: text [ ]) AS display_group RETURNING workspace_resource_id, key, value, sensitive, id, display_order, display_group
 `
 
 type InsertWorkspaceResourceMetadataParams struct {
@@ -10936,6 +11801,8 @@ type InsertWorkspaceResourceMetadataParams struct {
 	Key                 []string  `db:"key" json:"key"`
 	Value               []string  `db:"value" json:"value"`
 	Sensitive           []bool    `db:"sensitive" json:"sensitive"`
+	DisplayOrder        []int32   `db:"display_order" json:"display_order"`
+	DisplayGroup        []string  `db:"display_group" json:"display_group"`
 }
 
 func (q *sqlQuerier) InsertWorkspaceResourceMetadata(ctx context.Context, arg InsertWorkspaceResourceMetadataParams) ([]WorkspaceResourceMetadatum, error) {
@@ -10944,6 +11811,8 @@ func (q *sqlQuerier) InsertWorkspaceResourceMetadata(ctx context.Context, arg In
 		pq.Array(arg.Key),
 		pq.Array(arg.Value),
 		pq.Array(arg.Sensitive),
+		pq.Array(arg.DisplayOrder),
+		pq.Array(arg.DisplayGroup),
 	)
 	if err != nil {
 		return nil, err
@@ -10958,6 +11827,8 @@ func (q *sqlQuerier) InsertWorkspaceResourceMetadata(ctx context.Context, arg In
 			&i.Value,
 			&i.Sensitive,
 			&i.ID,
+			&i.DisplayOrder,
+			&i.DisplayGroup,
 		); err != nil {
 			return nil, err
 		}
@@ -11363,7 +12234,7 @@ LEFT JOIN LATERAL (
 ) latest_build ON TRUE
 LEFT JOIN LATERAL (
 	SELECT
-		id, created_at, updated_at, organization_id, deleted, name, provisioner, active_version_id, description, default_ttl, created_by, icon, user_acl, group_acl, display_name, allow_user_cancel_workspace_jobs, max_ttl, allow_user_autostart, allow_user_autostop, failure_ttl, time_til_dormant, time_til_dormant_autodelete, autostop_requirement_days_of_week, autostop_requirement_weeks, autostart_block_days_of_week, require_active_version, deprecated, use_max_ttl
+		id, created_at, updated_at, organization_id, deleted, name, provisioner, active_version_id, description, default_ttl, created_by, icon, user_acl, group_acl, display_name, allow_user_cancel_workspace_jobs, max_ttl, allow_user_autostart, allow_user_autostop, failure_ttl, time_til_dormant, time_til_dormant_autodelete, autostop_requirement_days_of_week, autostop_requirement_weeks, autostart_block_days_of_week, require_active_version, deprecated, use_max_ttl, max_app_sharing_level, code_server_enabled, docs_url, replace_on_failure
 	FROM
 		templates
 	WHERE
@@ -12044,8 +12915,86 @@ func (q *sqlQuerier) UpdateWorkspacesDormantDeletingAtByTemplateID(ctx context.C
 	return err
 }
 
+const deleteOldWorkspaceAgentScriptArtifacts = `-- name: DeleteOldWorkspaceAgentScriptArtifacts :exec
+DELETE FROM workspace_agent_script_artifacts WHERE created_at < NOW() - INTERVAL '7 days'
+`
+
+// Artifacts are kept for a week, scripts that run on a schedule upload new
+// ones every run.
+func (q *sqlQuerier) DeleteOldWorkspaceAgentScriptArtifacts(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteOldWorkspaceAgentScriptArtifacts)
+	return err
+}
+
+const getWorkspaceAgentScriptArtifactByID = `-- name: GetWorkspaceAgentScriptArtifactByID :one
+SELECT id, workspace_agent_id, log_source_id, archive, created_at FROM workspace_agent_script_artifacts WHERE id = $1
+`
+
+func (q *sqlQuerier) GetWorkspaceAgentScriptArtifactByID(ctx context.Context, id uuid.UUID) (WorkspaceAgentScriptArtifact, error) {
+	row := q.db.QueryRowContext(ctx, getWorkspaceAgentScriptArtifactByID, id)
+	var i WorkspaceAgentScriptArtifact
+	err := row.Scan(
+		&i.ID,
+		&i.WorkspaceAgentID,
+		&i.LogSourceID,
+		&i.Archive,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getWorkspaceAgentScriptArtifactsByAgentID = `-- name: GetWorkspaceAgentScriptArtifactsByAgentID :many
+SELECT
+	id, workspace_agent_id, log_source_id, octet_length(archive) :: bigint AS size, created_at
+FROM
+	workspace_agent_script_artifacts
+WHERE
+	workspace_agent_id = $1
+ORDER BY
+	created_at ASC
+`
+
+type GetWorkspaceAgentScriptArtifactsByAgentIDRow struct {
+	ID               uuid.UUID `db:"id" json:"id"`
+	WorkspaceAgentID uuid.UUID `db:"workspace_agent_id" json:"workspace_agent_id"`
+	LogSourceID      uuid.UUID `db:"log_source_id" json:"log_source_id"`
+	Size             int64     `db:"size" json:"size"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+}
+
+// The archives aren't returned, they're downloaded one at a time with
+// GetWorkspaceAgentScriptArtifactByID.
+func (q *sqlQuerier) GetWorkspaceAgentScriptArtifactsByAgentID(ctx context.Context, workspaceAgentID uuid.UUID) ([]GetWorkspaceAgentScriptArtifactsByAgentIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, getWorkspaceAgentScriptArtifactsByAgentID, workspaceAgentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetWorkspaceAgentScriptArtifactsByAgentIDRow
+	for rows.Next() {
+		var i GetWorkspaceAgentScriptArtifactsByAgentIDRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.WorkspaceAgentID,
+			&i.LogSourceID,
+			&i.Size,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getWorkspaceAgentScriptsByAgentIDs = `-- name: GetWorkspaceAgentScriptsByAgentIDs :many
-SELECT workspace_agent_id, log_source_id, log_path, created_at, script, cron, start_blocks_login, run_on_start, run_on_stop, timeout_seconds FROM workspace_agent_scripts WHERE workspace_agent_id = ANY($1 :: uuid [ ])
+SELECT workspace_agent_id, log_source_id, log_path, created_at, script, cron, start_blocks_login, run_on_start, run_on_stop, timeout_seconds, run_on_build_success, run_on_build_failure, run_on_post_start, login, disk_pressure_path, disk_pressure_threshold FROM workspace_agent_scripts WHERE workspace_agent_id = ANY($1 :: uuid [ ])
 `
 
 func (q *sqlQuerier) GetWorkspaceAgentScriptsByAgentIDs(ctx context.Context, ids []uuid.UUID) ([]WorkspaceAgentScript, error) {
@@ -12068,6 +13017,12 @@ func (q *sqlQuerier) GetWorkspaceAgentScriptsByAgentIDs(ctx context.Context, ids
 			&i.RunOnStart,
 			&i.RunOnStop,
 			&i.TimeoutSeconds,
+			&i.RunOnBuildSuccess,
+			&i.RunOnBuildFailure,
+			&i.RunOnPostStart,
+			&i.Login,
+			&i.DiskPressurePath,
+			&i.DiskPressureThreshold,
 		); err != nil {
 			return nil, err
 		}
@@ -12082,9 +13037,35 @@ func (q *sqlQuerier) GetWorkspaceAgentScriptsByAgentIDs(ctx context.Context, ids
 	return items, nil
 }
 
+const insertWorkspaceAgentScriptArtifact = `-- name: InsertWorkspaceAgentScriptArtifact :exec
+INSERT INTO
+	workspace_agent_script_artifacts (id, workspace_agent_id, log_source_id, archive, created_at)
+VALUES
+	($1, $2, $3, $4, $5)
+`
+
+type InsertWorkspaceAgentScriptArtifactParams struct {
+	ID               uuid.UUID `db:"id" json:"id"`
+	WorkspaceAgentID uuid.UUID `db:"workspace_agent_id" json:"workspace_agent_id"`
+	LogSourceID      uuid.UUID `db:"log_source_id" json:"log_source_id"`
+	Archive          []byte    `db:"archive" json:"archive"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+}
+
+func (q *sqlQuerier) InsertWorkspaceAgentScriptArtifact(ctx context.Context, arg InsertWorkspaceAgentScriptArtifactParams) error {
+	_, err := q.db.ExecContext(ctx, insertWorkspaceAgentScriptArtifact,
+		arg.ID,
+		arg.WorkspaceAgentID,
+		arg.LogSourceID,
+		arg.Archive,
+		arg.CreatedAt,
+	)
+	return err
+}
+
 const insertWorkspaceAgentScripts = `-- name: InsertWorkspaceAgentScripts :many
 INSERT INTO
-	workspace_agent_scripts (workspace_agent_id, created_at, log_source_id, log_path, script, cron, start_blocks_login, run_on_start, run_on_stop, timeout_seconds)
+	workspace_agent_scripts (workspace_agent_id, created_at, log_source_id, log_path, script, cron, start_blocks_login, run_on_start, run_on_stop, timeout_seconds, run_on_build_success, run_on_build_failure, run_on_post_start, login, disk_pressure_path, disk_pressure_threshold)
 SELECT
 	$1 :: uuid AS workspace_agent_id,
 	$2 :: timestamptz AS created_at,
@@ -12095,21 +13076,33 @@ SELECT
 	unnest($7 :: boolean [ ]) AS start_blocks_login,
 	unnest($8 :: boolean [ ]) AS run_on_start,
 	unnest($9 :: boolean [ ]) AS run_on_stop,
-	unnest($10 :: integer [ ]) AS timeout_seconds
-RETURNING workspace_agent_scripts.workspace_agent_id, workspace_agent_scripts.log_source_id, workspace_agent_scripts.log_path, workspace_agent_scripts.created_at, workspace_agent_scripts.script, workspace_agent_scripts.cron, workspace_agent_scripts.start_blocks_login, workspace_agent_scripts.run_on_start, workspace_agent_scripts.run_on_stop, workspace_agent_scripts.timeout_seconds
+	unnest($10 :: integer [ ]) AS timeout_seconds,
+	unnest($11 :: boolean [ ]) AS run_on_build_success,
+	unnest($12 :: boolean [ ]) AS run_on_build_failure,
+	unnest($13 :: boolean [ ]) AS run_on_post_start,
+	unnest($14 :: boolean [ ]) AS login,
+	unnest($15 :: text [ ]) AS disk_pressure_path,
+	unnest($16 :: integer [ ]) AS disk_pressure_threshold
+RETURNING workspace_agent_scripts.workspace_agent_id, workspace_agent_scripts.log_source_id, workspace_agent_scripts.log_path, workspace_agent_scripts.created_at, workspace_agent_scripts.script, workspace_agent_scripts.cron, workspace_agent_scripts.start_blocks_login, workspace_agent_scripts.run_on_start, workspace_agent_scripts.run_on_stop, workspace_agent_scripts.timeout_seconds, workspace_agent_scripts.run_on_build_success, workspace_agent_scripts.run_on_build_failure, workspace_agent_scripts.run_on_post_start, workspace_agent_scripts.login, workspace_agent_scripts.disk_pressure_path, workspace_agent_scripts.disk_pressure_threshold
 `
 
 type InsertWorkspaceAgentScriptsParams struct {
-	WorkspaceAgentID uuid.UUID   `db:"workspace_agent_id" json:"workspace_agent_id"`
-	CreatedAt        time.Time   `db:"created_at" json:"created_at"`
-	LogSourceID      []uuid.UUID `db:"log_source_id" json:"log_source_id"`
-	LogPath          []string    `db:"log_path" json:"log_path"`
-	Script           []string    `db:"script" json:"script"`
-	Cron             []string    `db:"cron" json:"cron"`
-	StartBlocksLogin []bool      `db:"start_blocks_login" json:"start_blocks_login"`
-	RunOnStart       []bool      `db:"run_on_start" json:"run_on_start"`
-	RunOnStop        []bool      `db:"run_on_stop" json:"run_on_stop"`
-	TimeoutSeconds   []int32     `db:"timeout_seconds" json:"timeout_seconds"`
+	WorkspaceAgentID      uuid.UUID   `db:"workspace_agent_id" json:"workspace_agent_id"`
+	CreatedAt             time.Time   `db:"created_at" json:"created_at"`
+	LogSourceID           []uuid.UUID `db:"log_source_id" json:"log_source_id"`
+	LogPath               []string    `db:"log_path" json:"log_path"`
+	Script                []string    `db:"script" json:"script"`
+	Cron                  []string    `db:"cron" json:"cron"`
+	StartBlocksLogin      []bool      `db:"start_blocks_login" json:"start_blocks_login"`
+	RunOnStart            []bool      `db:"run_on_start" json:"run_on_start"`
+	RunOnStop             []bool      `db:"run_on_stop" json:"run_on_stop"`
+	TimeoutSeconds        []int32     `db:"timeout_seconds" json:"timeout_seconds"`
+	RunOnBuildSuccess     []bool      `db:"run_on_build_success" json:"run_on_build_success"`
+	RunOnBuildFailure     []bool      `db:"run_on_build_failure" json:"run_on_build_failure"`
+	RunOnPostStart        []bool      `db:"run_on_post_start" json:"run_on_post_start"`
+	Login                 []bool      `db:"login" json:"login"`
+	DiskPressurePath      []string    `db:"disk_pressure_path" json:"disk_pressure_path"`
+	DiskPressureThreshold []int32     `db:"disk_pressure_threshold" json:"disk_pressure_threshold"`
 }
 
 func (q *sqlQuerier) InsertWorkspaceAgentScripts(ctx context.Context, arg InsertWorkspaceAgentScriptsParams) ([]WorkspaceAgentScript, error) {
@@ -12124,6 +13117,12 @@ func (q *sqlQuerier) InsertWorkspaceAgentScripts(ctx context.Context, arg Insert
 		pq.Array(arg.RunOnStart),
 		pq.Array(arg.RunOnStop),
 		pq.Array(arg.TimeoutSeconds),
+		pq.Array(arg.RunOnBuildSuccess),
+		pq.Array(arg.RunOnBuildFailure),
+		pq.Array(arg.RunOnPostStart),
+		pq.Array(arg.Login),
+		pq.Array(arg.DiskPressurePath),
+		pq.Array(arg.DiskPressureThreshold),
 	)
 	if err != nil {
 		return nil, err
@@ -12143,6 +13142,12 @@ func (q *sqlQuerier) InsertWorkspaceAgentScripts(ctx context.Context, arg Insert
 			&i.RunOnStart,
 			&i.RunOnStop,
 			&i.TimeoutSeconds,
+			&i.RunOnBuildSuccess,
+			&i.RunOnBuildFailure,
+			&i.RunOnPostStart,
+			&i.Login,
+			&i.DiskPressurePath,
+			&i.DiskPressureThreshold,
 		); err != nil {
 			return nil, err
 		}
@@ -28,6 +28,25 @@ FROM
 WHERE
 	organization_id = $1;
 
+-- name: GetGroupsByOrganizationAndUserID :many
+-- Returns the groups of the organization the user is a member of. The
+-- Everyone group isn't returned, since its members are implicit.
+SELECT
+	groups.*
+FROM
+	groups
+WHERE
+	groups.id IN (
+		SELECT
+			group_id
+		FROM
+			group_members
+		WHERE
+			group_members.user_id = @user_id
+	)
+AND
+	groups.organization_id = @organization_id;
+
 -- name: InsertGroup :one
 INSERT INTO groups (
 	id,
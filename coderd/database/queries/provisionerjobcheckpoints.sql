@@ -0,0 +1,33 @@
+-- name: UpsertProvisionerJobCheckpoint :exec
+INSERT INTO
+	provisioner_job_checkpoints (job_id, stage, checkpoint, created_at, updated_at)
+VALUES
+	(@job_id, @stage, @checkpoint, @created_at, @created_at)
+ON CONFLICT (job_id)
+DO UPDATE SET
+	stage = EXCLUDED.stage,
+	checkpoint = EXCLUDED.checkpoint,
+	updated_at = EXCLUDED.updated_at;
+
+-- name: GetProvisionerJobCheckpointByJobID :one
+SELECT
+	*
+FROM
+	provisioner_job_checkpoints
+WHERE
+	job_id = $1;
+
+-- name: UpdateProvisionerJobCheckpointResumedByJobID :exec
+UPDATE
+	provisioner_job_checkpoints
+SET
+	resume_count = resume_count + 1,
+	updated_at = $2
+WHERE
+	job_id = $1;
+
+-- name: DeleteProvisionerJobCheckpointByJobID :exec
+DELETE FROM
+	provisioner_job_checkpoints
+WHERE
+	job_id = $1;
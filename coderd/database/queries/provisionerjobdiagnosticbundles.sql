@@ -0,0 +1,13 @@
+-- name: InsertProvisionerJobDiagnosticBundle :exec
+INSERT INTO
+	provisioner_job_diagnostic_bundles (job_id, bundle, created_at)
+VALUES
+	($1, $2, $3);
+
+-- name: GetProvisionerJobDiagnosticBundleByJobID :one
+SELECT
+	*
+FROM
+	provisioner_job_diagnostic_bundles
+WHERE
+	job_id = $1;
@@ -129,6 +129,19 @@ SET
 WHERE
 	id = $1;
 
+-- Returns a started job to the queue, so another provisioner daemon
+-- acquires it, e.g. to resume it from its checkpoint.
+-- name: UpdateProvisionerJobWithRequeueByID :exec
+UPDATE
+	provisioner_jobs
+SET
+	updated_at = $2,
+	started_at = NULL,
+	worker_id = NULL
+WHERE
+	id = $1
+	AND completed_at IS NULL;
+
 -- name: GetHungProvisionerJobs :many
 SELECT
 	*
@@ -138,3 +151,20 @@ WHERE
 	updated_at < $1
 	AND started_at IS NOT NULL
 	AND completed_at IS NULL;
+
+-- name: GetUnfinishedWorkspaceRefreshJobByBuildID :one
+-- Refreshes of a build are deduplicated, so at most one is queued or running
+-- at a time.
+SELECT
+	*
+FROM
+	provisioner_jobs
+WHERE
+	type = 'workspace_refresh'
+	AND (input ->> 'workspace_build_id') :: uuid = @workspace_build_id :: uuid
+	AND completed_at IS NULL
+	AND canceled_at IS NULL
+ORDER BY
+	created_at DESC
+LIMIT
+	1;
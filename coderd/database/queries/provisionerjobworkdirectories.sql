@@ -0,0 +1,13 @@
+-- name: InsertProvisionerJobWorkDirectory :exec
+INSERT INTO
+	provisioner_job_work_directories (job_id, listing, created_at)
+VALUES
+	($1, $2, $3);
+
+-- name: GetProvisionerJobWorkDirectoryByJobID :one
+SELECT
+	*
+FROM
+	provisioner_job_work_directories
+WHERE
+	job_id = $1;
@@ -116,7 +116,11 @@ SET
 	icon = $5,
 	display_name = $6,
 	allow_user_cancel_workspace_jobs = $7,
-	group_acl = $8
+	group_acl = $8,
+	max_app_sharing_level = $9,
+	code_server_enabled = $10,
+	docs_url = $11,
+	replace_on_failure = $12
 WHERE
 	id = $1
 ;
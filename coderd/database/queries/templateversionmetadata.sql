@@ -0,0 +1,18 @@
+-- name: UpsertTemplateVersionMetadata :exec
+INSERT INTO
+	template_version_metadata (template_version_id, display_name, icon, description, docs_url)
+VALUES
+	($1, $2, $3, $4, $5)
+ON CONFLICT (template_version_id) DO UPDATE SET
+	display_name = $2,
+	icon = $3,
+	description = $4,
+	docs_url = $5;
+
+-- name: GetTemplateVersionMetadataByTemplateVersionID :one
+SELECT
+	*
+FROM
+	template_version_metadata
+WHERE
+	template_version_id = $1;
@@ -0,0 +1,20 @@
+-- name: GetUserAuthorizedKeys :one
+SELECT
+	*
+FROM
+	user_authorized_keys
+WHERE
+	user_id = $1;
+
+-- name: UpsertUserAuthorizedKeys :one
+INSERT INTO
+	user_authorized_keys (user_id, keys, required, updated_at)
+VALUES
+	($1, $2, $3, $4)
+ON CONFLICT
+	(user_id)
+DO UPDATE SET
+	keys = $2,
+	required = $3,
+	updated_at = $4
+RETURNING *;
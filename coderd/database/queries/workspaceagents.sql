@@ -46,10 +46,11 @@ INSERT INTO
 		connection_timeout_seconds,
 		troubleshooting_url,
 		motd_file,
-		display_apps
+		display_apps,
+		troubleshooting_urls
 	)
 VALUES
-	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING *;
+	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18) RETURNING *;
 
 -- name: UpdateWorkspaceAgentConnectionByID :exec
 UPDATE
@@ -74,6 +75,15 @@ SET
 WHERE
 	id = $1;
 
+-- name: UpdateWorkspaceAgentResourceIDByID :exec
+UPDATE
+	workspace_agents
+SET
+	resource_id = $2,
+	updated_at = $3
+WHERE
+	id = $1;
+
 -- name: GetWorkspaceAgentLifecycleStateByID :one
 SELECT
 	lifecycle_state,
@@ -104,10 +114,11 @@ INSERT INTO
 		script,
 		timeout,
 		interval,
-		display_order
+		display_order,
+		collector
 	)
 VALUES
-	($1, $2, $3, $4, $5, $6, $7);
+	($1, $2, $3, $4, $5, $6, $7, $8);
 
 -- name: UpdateWorkspaceAgentMetadata :exec
 WITH metadata AS (
@@ -155,7 +166,23 @@ WHERE
 	agent_id = $1
 	AND (
 		id > @created_after
-	) ORDER BY id ASC;
+	)
+	-- Filter by level
+	AND CASE
+		WHEN cardinality(@levels :: log_level[]) > 0 THEN
+			level = ANY(@levels :: log_level[])
+		ELSE true
+	END
+	-- Filter by log source
+	AND CASE
+		WHEN cardinality(@log_source_ids :: uuid[]) > 0 THEN
+			log_source_id = ANY(@log_source_ids :: uuid[])
+		ELSE true
+	END
+ORDER BY id ASC
+LIMIT
+	-- A null limit means "no limit", so 0 means return all
+	NULLIF(@limit_opt :: int, 0);
 
 -- name: InsertWorkspaceAgentLogs :many
 WITH new_length AS (
@@ -163,13 +190,15 @@ WITH new_length AS (
 	logs_length = logs_length + @output_length WHERE workspace_agents.id = @agent_id
 )
 INSERT INTO
-		workspace_agent_logs (agent_id, created_at, output, level, log_source_id)
+		workspace_agent_logs (agent_id, created_at, output, level, log_source_id, fields, stream)
 	SELECT
 		@agent_id :: uuid AS agent_id,
 		@created_at :: timestamptz AS created_at,
 		unnest(@output :: VARCHAR(1024) [ ]) AS output,
 		unnest(@level :: log_level [ ]) AS level,
-		@log_source_id :: uuid AS log_source_id
+		@log_source_id :: uuid AS log_source_id,
+		unnest(@fields :: text [ ]) :: jsonb AS fields,
+		unnest(@stream :: text [ ]) AS stream
 	RETURNING workspace_agent_logs.*;
 
 -- name: InsertWorkspaceAgentLogSources :many
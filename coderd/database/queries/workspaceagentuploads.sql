@@ -0,0 +1,77 @@
+-- name: InsertWorkspaceAgentUpload :execrows
+-- Starts an upload unless the agent already has max_uploads uploads in
+-- progress. Returns 0 if the upload wasn't inserted, either because it
+-- exists or because of the limit.
+INSERT INTO
+	workspace_agent_uploads (workspace_agent_id, name, checksum, size, created_at, updated_at)
+SELECT
+	@workspace_agent_id :: uuid, @name :: text, @checksum :: text, @size :: bigint, @created_at :: timestamptz, @created_at :: timestamptz
+WHERE
+	(SELECT COUNT(*) FROM workspace_agent_uploads WHERE workspace_agent_id = @workspace_agent_id :: uuid) < @max_uploads :: bigint
+ON CONFLICT DO NOTHING;
+
+-- name: GetWorkspaceAgentUpload :one
+SELECT
+	*
+FROM
+	workspace_agent_uploads
+WHERE
+	workspace_agent_id = $1
+	AND name = $2
+	AND checksum = $3;
+
+-- name: AppendWorkspaceAgentUploadChunk :one
+-- Stores the chunk if the upload received exactly offset bytes so far, so
+-- chunks can't be stored twice or out of order. Returns the number of bytes
+-- received.
+WITH upload AS (
+	UPDATE
+		workspace_agent_uploads
+	SET
+		received = received + octet_length(@chunk :: bytea),
+		updated_at = @updated_at
+	WHERE
+		workspace_agent_id = @workspace_agent_id
+		AND name = @name
+		AND checksum = @checksum
+		AND received = @offset :: bigint
+	RETURNING
+		workspace_agent_id, name, checksum, received
+), chunk AS (
+	INSERT INTO
+		workspace_agent_upload_chunks (workspace_agent_id, name, checksum, chunk_offset, data)
+	SELECT
+		workspace_agent_id, name, checksum, @offset :: bigint, @chunk :: bytea
+	FROM
+		upload
+	WHERE
+		octet_length(@chunk :: bytea) > 0
+)
+SELECT
+	received
+FROM
+	upload;
+
+-- name: GetWorkspaceAgentUploadData :one
+-- Assembles the chunks of the upload.
+SELECT
+	COALESCE(string_agg(data, ''::bytea ORDER BY chunk_offset), ''::bytea) :: bytea
+FROM
+	workspace_agent_upload_chunks
+WHERE
+	workspace_agent_id = $1
+	AND name = $2
+	AND checksum = $3;
+
+-- name: DeleteWorkspaceAgentUpload :exec
+DELETE FROM
+	workspace_agent_uploads
+WHERE
+	workspace_agent_id = $1
+	AND name = $2
+	AND checksum = $3;
+
+-- name: DeleteOldWorkspaceAgentUploads :exec
+-- Uploads that didn't receive a chunk for a day are abandoned, e.g. because
+-- the workspace was stopped.
+DELETE FROM workspace_agent_uploads WHERE updated_at < NOW() - INTERVAL '1 day';
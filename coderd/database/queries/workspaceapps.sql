@@ -37,6 +37,9 @@ VALUES
 UPDATE
 	workspace_apps
 SET
-	health = $2
+	health = $2,
+	health_latency_ms = $3,
+	health_error = $4,
+	health_checked_at = $5
 WHERE
 	id = $1;
@@ -0,0 +1,27 @@
+-- name: InsertWorkspaceBuildCapacityFallback :exec
+INSERT INTO
+	workspace_build_capacity_fallbacks (workspace_build_id, selected, attempts)
+VALUES
+	($1, $2, $3);
+
+-- name: GetWorkspaceBuildCapacityFallbackByBuildID :one
+SELECT
+	*
+FROM
+	workspace_build_capacity_fallbacks
+WHERE
+	workspace_build_id = $1;
+
+-- name: GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID :one
+SELECT
+	workspace_build_capacity_fallbacks.*
+FROM
+	workspace_build_capacity_fallbacks
+JOIN
+	workspace_builds ON workspace_builds.id = workspace_build_capacity_fallbacks.workspace_build_id
+WHERE
+	workspace_builds.workspace_id = $1
+ORDER BY
+	workspace_builds.build_number DESC
+LIMIT
+	1;
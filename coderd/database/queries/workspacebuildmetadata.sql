@@ -0,0 +1,19 @@
+-- name: InsertWorkspaceBuildMetadata :exec
+INSERT INTO
+	workspace_build_metadata (workspace_build_id, key, value, sensitive, display_order)
+SELECT
+	@workspace_build_id :: uuid AS workspace_build_id,
+	unnest(@key :: text [ ]) AS key,
+	unnest(@value :: text [ ]) AS value,
+	unnest(@sensitive :: boolean [ ]) AS sensitive,
+	unnest(@display_order :: integer [ ]) AS display_order;
+
+-- name: GetWorkspaceBuildMetadataByBuildID :many
+SELECT
+	*
+FROM
+	workspace_build_metadata
+WHERE
+	workspace_build_id = $1
+ORDER BY
+	display_order ASC;
@@ -1,10 +1,11 @@
 -- name: InsertWorkspaceBuildParameters :exec
 INSERT INTO
-    workspace_build_parameters (workspace_build_id, name, value)
+    workspace_build_parameters (workspace_build_id, name, value, source)
 SELECT
     @workspace_build_id :: uuid AS workspace_build_id,
     unnest(@name :: text[]) AS name,
-    unnest(@value :: text[]) AS value
+    unnest(@value :: text[]) AS value,
+    unnest(@source :: text[]) AS source
 RETURNING *;
 
 -- name: GetWorkspaceBuildParameters :many
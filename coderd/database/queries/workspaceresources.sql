@@ -27,9 +27,9 @@ SELECT * FROM workspace_resources WHERE created_at > $1;
 
 -- name: InsertWorkspaceResource :one
 INSERT INTO
-	workspace_resources (id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost)
+	workspace_resources (id, created_at, job_id, transition, type, name, hide, icon, instance_type, daily_cost, action, address)
 VALUES
-	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *;
+	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING *;
 
 -- name: GetWorkspaceResourceMetadataByResourceIDs :many
 SELECT
@@ -37,16 +37,24 @@ SELECT
 FROM
 	workspace_resource_metadata
 WHERE
-	workspace_resource_id = ANY(@ids :: uuid [ ]) ORDER BY id ASC;
+	workspace_resource_id = ANY(@ids :: uuid [ ]) ORDER BY display_order ASC, id ASC;
 
 -- name: InsertWorkspaceResourceMetadata :many
 INSERT INTO
-	workspace_resource_metadata
+	workspace_resource_metadata (workspace_resource_id, key, value, sensitive, display_order, display_group)
 SELECT
 	@workspace_resource_id :: uuid AS workspace_resource_id,
 	unnest(@key :: text [ ]) AS key,
 	unnest(@value :: text [ ]) AS value,
-	unnest(@sensitive :: boolean [ ]) AS sensitive RETURNING *; 
+	unnest(@sensitive :: boolean [ ]) AS sensitive,
+	unnest(@display_order :: integer [ ]) AS display_order,
+	unnest(@display_group :: text [ ]) AS display_group RETURNING *;
+
+-- name: DeleteWorkspaceResourceMetadataByResourceID :exec
+DELETE FROM
+	workspace_resource_metadata
+WHERE
+	workspace_resource_id = $1;
 
 -- name: GetWorkspaceResourceMetadataCreatedAfter :many
 SELECT * FROM workspace_resource_metadata WHERE workspace_resource_id = ANY(
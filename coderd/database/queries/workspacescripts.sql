@@ -1,6 +1,6 @@
 -- name: InsertWorkspaceAgentScripts :many
 INSERT INTO
-	workspace_agent_scripts (workspace_agent_id, created_at, log_source_id, log_path, script, cron, start_blocks_login, run_on_start, run_on_stop, timeout_seconds)
+	workspace_agent_scripts (workspace_agent_id, created_at, log_source_id, log_path, script, cron, start_blocks_login, run_on_start, run_on_stop, timeout_seconds, run_on_build_success, run_on_build_failure, run_on_post_start, login, disk_pressure_path, disk_pressure_threshold)
 SELECT
 	@workspace_agent_id :: uuid AS workspace_agent_id,
 	@created_at :: timestamptz AS created_at,
@@ -11,8 +11,40 @@ SELECT
 	unnest(@start_blocks_login :: boolean [ ]) AS start_blocks_login,
 	unnest(@run_on_start :: boolean [ ]) AS run_on_start,
 	unnest(@run_on_stop :: boolean [ ]) AS run_on_stop,
-	unnest(@timeout_seconds :: integer [ ]) AS timeout_seconds
+	unnest(@timeout_seconds :: integer [ ]) AS timeout_seconds,
+	unnest(@run_on_build_success :: boolean [ ]) AS run_on_build_success,
+	unnest(@run_on_build_failure :: boolean [ ]) AS run_on_build_failure,
+	unnest(@run_on_post_start :: boolean [ ]) AS run_on_post_start,
+	unnest(@login :: boolean [ ]) AS login,
+	unnest(@disk_pressure_path :: text [ ]) AS disk_pressure_path,
+	unnest(@disk_pressure_threshold :: integer [ ]) AS disk_pressure_threshold
 RETURNING workspace_agent_scripts.*;
 
 -- name: GetWorkspaceAgentScriptsByAgentIDs :many
 SELECT * FROM workspace_agent_scripts WHERE workspace_agent_id = ANY(@ids :: uuid [ ]);
+
+-- name: InsertWorkspaceAgentScriptArtifact :exec
+INSERT INTO
+	workspace_agent_script_artifacts (id, workspace_agent_id, log_source_id, archive, created_at)
+VALUES
+	($1, $2, $3, $4, $5);
+
+-- name: GetWorkspaceAgentScriptArtifactsByAgentID :many
+-- The archives aren't returned, they're downloaded one at a time with
+-- GetWorkspaceAgentScriptArtifactByID.
+SELECT
+	id, workspace_agent_id, log_source_id, octet_length(archive) :: bigint AS size, created_at
+FROM
+	workspace_agent_script_artifacts
+WHERE
+	workspace_agent_id = $1
+ORDER BY
+	created_at ASC;
+
+-- name: GetWorkspaceAgentScriptArtifactByID :one
+SELECT * FROM workspace_agent_script_artifacts WHERE id = $1;
+
+-- name: DeleteOldWorkspaceAgentScriptArtifacts :exec
+-- Artifacts are kept for a week, scripts that run on a schedule upload new
+-- ones every run.
+DELETE FROM workspace_agent_script_artifacts WHERE created_at < NOW() - INTERVAL '7 days';
@@ -32,6 +32,7 @@ import (
 	"github.com/coder/coder/v2/coderd/database/dbtime"
 	"github.com/coder/coder/v2/coderd/database/pubsub"
 	"github.com/coder/coder/v2/coderd/externalauth"
+	"github.com/coder/coder/v2/coderd/httpapi"
 	"github.com/coder/coder/v2/coderd/promoauth"
 	"github.com/coder/coder/v2/coderd/schedule"
 	"github.com/coder/coder/v2/coderd/telemetry"
@@ -501,46 +502,39 @@ func (s *server) acquireProtoJob(ctx context.Context, job database.ProvisionerJo
 			return nil, failJob(fmt.Sprintf("get workspace build parameters: %s", err))
 		}
 
-		externalAuthProviders := []*sdkproto.ExternalAuthProvider{}
-		for _, p := range templateVersion.ExternalAuthProviders {
-			link, err := s.Database.GetExternalAuthLink(ctx, database.GetExternalAuthLinkParams{
-				ProviderID: p,
-				UserID:     owner.ID,
-			})
-			if errors.Is(err, sql.ErrNoRows) {
-				continue
-			}
+		externalAuthProviders, err := s.externalAuthProviders(ctx, templateVersion, owner, workspaceBuild)
+		if err != nil {
+			return nil, failJob(err.Error())
+		}
+		capacityOption, err := s.capacityOption(ctx, workspace.ID)
+		if err != nil {
+			return nil, failJob(err.Error())
+		}
+		ownerGroups, err := s.ownerGroups(ctx, template.OrganizationID, owner.ID)
+		if err != nil {
+			return nil, failJob(err.Error())
+		}
+		var replaceResources []string
+		if template.ReplaceOnFailure && workspaceBuild.Transition == database.WorkspaceTransitionStart {
+			replaceResources, err = s.unhealthyResources(ctx, workspaceBuild)
 			if err != nil {
-				return nil, failJob(fmt.Sprintf("acquire external auth link: %s", err))
-			}
-			var config *externalauth.Config
-			for _, c := range s.ExternalAuthConfigs {
-				if c.ID != p {
-					continue
-				}
-				config = c
-				break
-			}
-			// We weren't able to find a matching config for the ID!
-			if config == nil {
-				s.Logger.Warn(ctx, "workspace build job is missing external auth provider",
-					slog.F("provider_id", p),
-					slog.F("template_version_id", templateVersion.ID),
-					slog.F("workspace_id", workspaceBuild.WorkspaceID))
-				continue
+				return nil, failJob(err.Error())
 			}
+		}
 
-			link, valid, err := config.RefreshToken(ctx, s.Database, link)
+		// A checkpoint exists if a previous attempt of the build was
+		// interrupted, the build resumes from it.
+		var checkpoint *sdkproto.Checkpoint
+		dbCheckpoint, err := s.Database.GetProvisionerJobCheckpointByJobID(ctx, job.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, failJob(fmt.Sprintf("get provisioner job checkpoint: %s", err))
+		}
+		if err == nil {
+			checkpoint = &sdkproto.Checkpoint{}
+			err = protobuf.Unmarshal(dbCheckpoint.Checkpoint, checkpoint)
 			if err != nil {
-				return nil, failJob(fmt.Sprintf("refresh external auth link %q: %s", p, err))
+				return nil, failJob(fmt.Sprintf("unmarshal provisioner job checkpoint: %s", err))
 			}
-			if !valid {
-				continue
-			}
-			externalAuthProviders = append(externalAuthProviders, &sdkproto.ExternalAuthProvider{
-				Id:          p,
-				AccessToken: link.OAuthAccessToken,
-			})
 		}
 
 		protoJob.Type = &proto.AcquiredJob_WorkspaceBuild_{
@@ -565,8 +559,104 @@ func (s *server) acquireProtoJob(ctx context.Context, job database.ProvisionerJo
 					TemplateName:                  template.Name,
 					TemplateVersion:               templateVersion.Name,
 					WorkspaceOwnerSessionToken:    sessionToken,
+					MaxAppSharingLevel:            string(template.MaxAppSharingLevel),
+					CapacityOption:                capacityOption,
+					WorkspaceAppHostname:          s.DeploymentValues.WildcardAccessURL.String(),
+					WorkspaceOwnerGroups:          ownerGroups,
+					ReplaceOnFailure:              template.ReplaceOnFailure,
+					ReplaceResources:              replaceResources,
+				},
+				LogLevel:   input.LogLevel,
+				Checkpoint: checkpoint,
+			},
+		}
+	case database.ProvisionerJobTypeWorkspaceRefresh:
+		var input WorkspaceRefreshJob
+		err = json.Unmarshal(job.Input, &input)
+		if err != nil {
+			return nil, failJob(fmt.Sprintf("unmarshal job input %q: %s", job.Input, err))
+		}
+		workspaceBuild, err := s.Database.GetWorkspaceBuildByID(ctx, input.WorkspaceBuildID)
+		if err != nil {
+			return nil, failJob(fmt.Sprintf("get workspace build: %s", err))
+		}
+		// Refreshing with the state of an older build would run concurrently
+		// with the newer build on the same resources.
+		latestBuild, err := s.Database.GetLatestWorkspaceBuildByWorkspaceID(ctx, workspaceBuild.WorkspaceID)
+		if err != nil {
+			return nil, failJob(fmt.Sprintf("get latest workspace build: %s", err))
+		}
+		if latestBuild.ID != workspaceBuild.ID {
+			return nil, failJob("the workspace was built after the refresh was queued")
+		}
+		workspace, err := s.Database.GetWorkspaceByID(ctx, workspaceBuild.WorkspaceID)
+		if err != nil {
+			return nil, failJob(fmt.Sprintf("get workspace: %s", err))
+		}
+		templateVersion, err := s.Database.GetTemplateVersionByID(ctx, workspaceBuild.TemplateVersionID)
+		if err != nil {
+			return nil, failJob(fmt.Sprintf("get template version: %s", err))
+		}
+		templateVariables, err := s.Database.GetTemplateVersionVariables(ctx, templateVersion.ID)
+		if err != nil && !xerrors.Is(err, sql.ErrNoRows) {
+			return nil, failJob(fmt.Sprintf("get template version variables: %s", err))
+		}
+		template, err := s.Database.GetTemplateByID(ctx, templateVersion.TemplateID.UUID)
+		if err != nil {
+			return nil, failJob(fmt.Sprintf("get template: %s", err))
+		}
+		owner, err := s.Database.GetUserByID(ctx, workspace.OwnerID)
+		if err != nil {
+			return nil, failJob(fmt.Sprintf("get owner: %s", err))
+		}
+		transition, err := convertWorkspaceTransition(workspaceBuild.Transition)
+		if err != nil {
+			return nil, failJob(fmt.Sprintf("convert workspace transition: %s", err))
+		}
+		workspaceBuildParameters, err := s.Database.GetWorkspaceBuildParameters(ctx, workspaceBuild.ID)
+		if err != nil {
+			return nil, failJob(fmt.Sprintf("get workspace build parameters: %s", err))
+		}
+		externalAuthProviders, err := s.externalAuthProviders(ctx, templateVersion, owner, workspaceBuild)
+		if err != nil {
+			return nil, failJob(err.Error())
+		}
+		capacityOption, err := s.capacityOption(ctx, workspace.ID)
+		if err != nil {
+			return nil, failJob(err.Error())
+		}
+		ownerGroups, err := s.ownerGroups(ctx, template.OrganizationID, owner.ID)
+		if err != nil {
+			return nil, failJob(err.Error())
+		}
+
+		// The refresh plans with the inputs of the build, so it refreshes
+		// the same resources. Session tokens aren't regenerated, since the
+		// plan is never applied.
+		protoJob.Type = &proto.AcquiredJob_WorkspaceRefresh_{
+			WorkspaceRefresh: &proto.AcquiredJob_WorkspaceRefresh{
+				WorkspaceBuildId:      workspaceBuild.ID.String(),
+				State:                 workspaceBuild.ProvisionerState,
+				RichParameterValues:   convertRichParameterValues(workspaceBuildParameters),
+				VariableValues:        asVariableValues(templateVariables),
+				ExternalAuthProviders: externalAuthProviders,
+				Metadata: &sdkproto.Metadata{
+					CoderUrl:             s.AccessURL.String(),
+					WorkspaceTransition:  transition,
+					WorkspaceName:        workspace.Name,
+					WorkspaceOwner:       owner.Username,
+					WorkspaceOwnerEmail:  owner.Email,
+					WorkspaceOwnerName:   owner.Name,
+					WorkspaceId:          workspace.ID.String(),
+					WorkspaceOwnerId:     owner.ID.String(),
+					TemplateId:           template.ID.String(),
+					TemplateName:         template.Name,
+					TemplateVersion:      templateVersion.Name,
+					MaxAppSharingLevel:   string(template.MaxAppSharingLevel),
+					CapacityOption:       capacityOption,
+					WorkspaceAppHostname: s.DeploymentValues.WildcardAccessURL.String(),
+					WorkspaceOwnerGroups: ownerGroups,
 				},
-				LogLevel: input.LogLevel,
 			},
 		}
 	case database.ProvisionerJobTypeTemplateVersionDryRun:
@@ -584,14 +674,20 @@ func (s *server) acquireProtoJob(ctx context.Context, job database.ProvisionerJo
 		if err != nil && !xerrors.Is(err, sql.ErrNoRows) {
 			return nil, failJob(fmt.Sprintf("get template version variables: %s", err))
 		}
+		maxAppSharingLevel, err := s.maxAppSharingLevel(ctx, templateVersion)
+		if err != nil {
+			return nil, failJob(err.Error())
+		}
 
 		protoJob.Type = &proto.AcquiredJob_TemplateDryRun_{
 			TemplateDryRun: &proto.AcquiredJob_TemplateDryRun{
 				RichParameterValues: convertRichParameterValues(input.RichParameterValues),
 				VariableValues:      asVariableValues(templateVariables),
 				Metadata: &sdkproto.Metadata{
-					CoderUrl:      s.AccessURL.String(),
-					WorkspaceName: input.WorkspaceName,
+					CoderUrl:             s.AccessURL.String(),
+					WorkspaceName:        input.WorkspaceName,
+					MaxAppSharingLevel:   maxAppSharingLevel,
+					WorkspaceAppHostname: s.DeploymentValues.WildcardAccessURL.String(),
 				},
 			},
 		}
@@ -606,12 +702,25 @@ func (s *server) acquireProtoJob(ctx context.Context, job database.ProvisionerJo
 		if err != nil {
 			return nil, failJob(err.Error())
 		}
+		var maxAppSharingLevel string
+		if input.TemplateVersionID != uuid.Nil {
+			templateVersion, err := s.Database.GetTemplateVersionByID(ctx, input.TemplateVersionID)
+			if err != nil {
+				return nil, failJob(fmt.Sprintf("get template version: %s", err))
+			}
+			maxAppSharingLevel, err = s.maxAppSharingLevel(ctx, templateVersion)
+			if err != nil {
+				return nil, failJob(err.Error())
+			}
+		}
 
 		protoJob.Type = &proto.AcquiredJob_TemplateImport_{
 			TemplateImport: &proto.AcquiredJob_TemplateImport{
 				UserVariableValues: convertVariableValues(userVariableValues),
 				Metadata: &sdkproto.Metadata{
-					CoderUrl: s.AccessURL.String(),
+					CoderUrl:             s.AccessURL.String(),
+					MaxAppSharingLevel:   maxAppSharingLevel,
+					WorkspaceAppHostname: s.DeploymentValues.WildcardAccessURL.String(),
 				},
 			},
 		}
@@ -633,6 +742,171 @@ func (s *server) acquireProtoJob(ctx context.Context, job database.ProvisionerJo
 	return protoJob, err
 }
 
+// externalAuthProviders returns the access tokens of the owner of a
+// workspace for the external auth providers of the template version of a
+// build. Providers the owner isn't linked to are skipped.
+func (s *server) externalAuthProviders(ctx context.Context, templateVersion database.TemplateVersion, owner database.User, workspaceBuild database.WorkspaceBuild) ([]*sdkproto.ExternalAuthProvider, error) {
+	providers := []*sdkproto.ExternalAuthProvider{}
+	for _, p := range templateVersion.ExternalAuthProviders {
+		link, err := s.Database.GetExternalAuthLink(ctx, database.GetExternalAuthLinkParams{
+			ProviderID: p,
+			UserID:     owner.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("acquire external auth link: %w", err)
+		}
+		var config *externalauth.Config
+		for _, c := range s.ExternalAuthConfigs {
+			if c.ID != p {
+				continue
+			}
+			config = c
+			break
+		}
+		// We weren't able to find a matching config for the ID!
+		if config == nil {
+			s.Logger.Warn(ctx, "workspace build job is missing external auth provider",
+				slog.F("provider_id", p),
+				slog.F("template_version_id", templateVersion.ID),
+				slog.F("workspace_id", workspaceBuild.WorkspaceID))
+			continue
+		}
+
+		link, valid, err := config.RefreshToken(ctx, s.Database, link)
+		if err != nil {
+			return nil, xerrors.Errorf("refresh external auth link %q: %w", p, err)
+		}
+		if !valid {
+			continue
+		}
+		providers = append(providers, &sdkproto.ExternalAuthProvider{
+			Id:          p,
+			AccessToken: link.OAuthAccessToken,
+		})
+	}
+	return providers, nil
+}
+
+// capacityOption returns the capacity option the last build of a workspace
+// that fell back to alternate capacity options succeeded with, empty if
+// there's none.
+func (s *server) capacityOption(ctx context.Context, workspaceID uuid.UUID) (string, error) {
+	fallback, err := s.Database.GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID(ctx, workspaceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", xerrors.Errorf("get capacity fallback: %w", err)
+	}
+	return fallback.Selected, nil
+}
+
+// ownerGroups returns the names of the groups of the workspace owner in the
+// organization, sorted, e.g. to attribute the costs of the workspace.
+func (s *server) ownerGroups(ctx context.Context, organizationID, ownerID uuid.UUID) ([]string, error) {
+	groups, err := s.Database.GetGroupsByOrganizationAndUserID(ctx, database.GetGroupsByOrganizationAndUserIDParams{
+		UserID:         ownerID,
+		OrganizationID: organizationID,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("get owner groups: %w", err)
+	}
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// unhealthyResources returns the addresses of the resources whose agents
+// failed to connect or start in the last build that started the workspace
+// before the build, sorted. The build stopping the workspace in between is
+// skipped, so restarts replace them too. Resources of builds from before
+// addresses were stored are never returned.
+func (s *server) unhealthyResources(ctx context.Context, workspaceBuild database.WorkspaceBuild) ([]string, error) {
+	getBuild := func(buildNumber int32) (database.WorkspaceBuild, error) {
+		return s.Database.GetWorkspaceBuildByWorkspaceIDAndBuildNumber(ctx, database.GetWorkspaceBuildByWorkspaceIDAndBuildNumberParams{
+			WorkspaceID: workspaceBuild.WorkspaceID,
+			BuildNumber: buildNumber,
+		})
+	}
+	previousBuild, err := getBuild(workspaceBuild.BuildNumber - 1)
+	if err == nil && previousBuild.Transition == database.WorkspaceTransitionStop {
+		previousBuild, err = getBuild(previousBuild.BuildNumber - 1)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("get previous workspace build: %w", err)
+	}
+	if previousBuild.Transition != database.WorkspaceTransitionStart {
+		return nil, nil
+	}
+	resources, err := s.Database.GetWorkspaceResourcesByJobID(ctx, previousBuild.JobID)
+	if err != nil {
+		return nil, xerrors.Errorf("get workspace resources: %w", err)
+	}
+	addresses := make(map[uuid.UUID]string, len(resources))
+	resourceIDs := make([]uuid.UUID, 0, len(resources))
+	for _, resource := range resources {
+		if resource.Address == "" {
+			continue
+		}
+		addresses[resource.ID] = resource.Address
+		resourceIDs = append(resourceIDs, resource.ID)
+	}
+	if len(resourceIDs) == 0 {
+		return nil, nil
+	}
+	agents, err := s.Database.GetWorkspaceAgentsByResourceIDs(ctx, resourceIDs)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.Errorf("get workspace agents: %w", err)
+	}
+	var unhealthy []string
+	for _, agent := range agents {
+		if !unhealthyAgent(agent) {
+			continue
+		}
+		address := addresses[agent.ResourceID]
+		if !slices.Contains(unhealthy, address) {
+			unhealthy = append(unhealthy, address)
+		}
+	}
+	slices.Sort(unhealthy)
+	return unhealthy, nil
+}
+
+// unhealthyAgent returns whether the agent timed out connecting, or its
+// startup scripts failed or timed out.
+func unhealthyAgent(agent database.WorkspaceAgent) bool {
+	switch agent.LifecycleState {
+	case database.WorkspaceAgentLifecycleStateStartError, database.WorkspaceAgentLifecycleStateStartTimeout:
+		return true
+	}
+	// The inactive timeout only tells connected agents from disconnected
+	// ones, which are left alone, e.g. workspaces stopped outside of Coder.
+	return agent.Status(0).Status == database.WorkspaceAgentStatusTimeout
+}
+
+// maxAppSharingLevel returns the widest sharing level the apps of the
+// template version may use, which provisioners enforce while planning. It's
+// empty if the version isn't part of a template yet.
+func (s *server) maxAppSharingLevel(ctx context.Context, templateVersion database.TemplateVersion) (string, error) {
+	if !templateVersion.TemplateID.Valid {
+		return "", nil
+	}
+	template, err := s.Database.GetTemplateByID(ctx, templateVersion.TemplateID.UUID)
+	if err != nil {
+		return "", xerrors.Errorf("get template: %w", err)
+	}
+	return string(template.MaxAppSharingLevel), nil
+}
+
 func (s *server) includeLastVariableValues(ctx context.Context, templateVersionID uuid.UUID, userVariableValues []codersdk.VariableValue) ([]codersdk.VariableValue, error) {
 	var values []codersdk.VariableValue
 	values = append(values, userVariableValues...)
@@ -796,6 +1070,26 @@ func (s *server) UpdateJob(ctx context.Context, request *proto.UpdateJobRequest)
 		s.Logger.Debug(ctx, "published job logs", slog.F("job_id", parsedID))
 	}
 
+	if request.Checkpoint != nil {
+		if job.Type != database.ProvisionerJobTypeWorkspaceBuild {
+			return nil, xerrors.Errorf("checkpoints are only supported for workspace builds, got %q", job.Type)
+		}
+		data, err := protobuf.Marshal(request.Checkpoint)
+		if err != nil {
+			return nil, xerrors.Errorf("marshal checkpoint: %w", err)
+		}
+		err = s.Database.UpsertProvisionerJobCheckpoint(ctx, database.UpsertProvisionerJobCheckpointParams{
+			JobID:      job.ID,
+			Stage:      request.Checkpoint.Stage,
+			Checkpoint: data,
+			CreatedAt:  dbtime.Now(),
+		})
+		if err != nil {
+			return nil, xerrors.Errorf("upsert provisioner job checkpoint: %w", err)
+		}
+		s.Logger.Debug(ctx, "saved job checkpoint", slog.F("job_id", parsedID), slog.F("stage", request.Checkpoint.Stage))
+	}
+
 	if len(request.Readme) > 0 {
 		err := s.Database.UpdateTemplateVersionDescriptionByJobID(ctx, database.UpdateTemplateVersionDescriptionByJobIDParams{
 			JobID:     job.ID,
@@ -807,6 +1101,14 @@ func (s *server) UpdateJob(ctx context.Context, request *proto.UpdateJobRequest)
 		}
 	}
 
+	if request.TemplateMetadata != nil {
+		// The metadata is only a convenience, so it doesn't fail the import.
+		err := s.saveTemplateMetadata(ctx, job.ID, request.TemplateMetadata)
+		if err != nil {
+			s.Logger.Error(ctx, "failed to save template metadata", slog.F("job_id", parsedID), slog.Error(err))
+		}
+	}
+
 	if len(request.TemplateVariables) > 0 {
 		templateVersion, err := s.Database.GetTemplateVersionByJobID(ctx, job.ID)
 		if err != nil {
@@ -867,6 +1169,38 @@ func (s *server) UpdateJob(ctx context.Context, request *proto.UpdateJobRequest)
 	}, nil
 }
 
+// saveTemplateMetadata saves the display name, icon, description and docs
+// URL the template describes itself with for the imported version. They're
+// applied to the template once the version is promoted. Invalid values are
+// ignored.
+func (s *server) saveTemplateMetadata(ctx context.Context, jobID uuid.UUID, metadata *sdkproto.TemplateMetadata) error {
+	templateVersion, err := s.Database.GetTemplateVersionByJobID(ctx, jobID)
+	if err != nil {
+		return xerrors.Errorf("get template version by job id: %w", err)
+	}
+	params := database.UpsertTemplateVersionMetadataParams{
+		TemplateVersionID: templateVersion.ID,
+		DisplayName:       metadata.DisplayName,
+		Icon:              metadata.Icon,
+		Description:       metadata.Description,
+		DocsURL:           metadata.DocsUrl,
+	}
+	if err := httpapi.TemplateDisplayNameValid(params.DisplayName); err != nil {
+		s.Logger.Warn(ctx, "ignoring invalid template display name", slog.F("job_id", jobID), slog.Error(err))
+		params.DisplayName = ""
+	}
+	// Descriptions are limited like in the API.
+	if len(params.Description) >= 128 {
+		s.Logger.Warn(ctx, "ignoring template description longer than 128 characters", slog.F("job_id", jobID))
+		params.Description = ""
+	}
+	err = s.Database.UpsertTemplateVersionMetadata(ctx, params)
+	if err != nil {
+		return xerrors.Errorf("upsert template version metadata: %w", err)
+	}
+	return nil
+}
+
 func (s *server) FailJob(ctx context.Context, failJob *proto.FailedJob) (*proto.Empty, error) {
 	ctx, span := s.startTrace(ctx, tracing.FuncName())
 	defer span.End()
@@ -950,6 +1284,45 @@ func (s *server) FailJob(ctx context.Context, failJob *proto.FailedJob) (*proto.
 				}
 			}
 
+			// The diagnostic bundle is kept for support escalations. The
+			// listing of the work directory is stored on its own, since it's
+			// served separately.
+			bundle, _ := protobuf.Clone(jobType.WorkspaceBuild.GetDiagnosticBundle()).(*sdkproto.DiagnosticBundle)
+			if bundle != nil {
+				bundle.WorkDirectory = nil
+			}
+			if protobuf.Size(bundle) > 0 {
+				data, err := protobuf.Marshal(bundle)
+				if err != nil {
+					return xerrors.Errorf("marshal diagnostic bundle: %w", err)
+				}
+				err = db.InsertProvisionerJobDiagnosticBundle(ctx, database.InsertProvisionerJobDiagnosticBundleParams{
+					JobID:     jobID,
+					Bundle:    data,
+					CreatedAt: dbtime.Now(),
+				})
+				if err != nil {
+					return xerrors.Errorf("insert diagnostic bundle: %w", err)
+				}
+			}
+
+			// The listing of the work directory is kept so the failed build
+			// can be debugged without a shell on the provisioner host.
+			if workDirectory := jobType.WorkspaceBuild.GetDiagnosticBundle().GetWorkDirectory(); workDirectory != nil {
+				listing, err := protobuf.Marshal(workDirectory)
+				if err != nil {
+					return xerrors.Errorf("marshal work directory listing: %w", err)
+				}
+				err = db.InsertProvisionerJobWorkDirectory(ctx, database.InsertProvisionerJobWorkDirectoryParams{
+					JobID:     jobID,
+					Listing:   listing,
+					CreatedAt: dbtime.Now(),
+				})
+				if err != nil {
+					return xerrors.Errorf("insert work directory listing: %w", err)
+				}
+			}
+
 			return nil
 		}, nil)
 		if err != nil {
@@ -961,6 +1334,20 @@ func (s *server) FailJob(ctx context.Context, failJob *proto.FailedJob) (*proto.
 			return nil, xerrors.Errorf("update workspace: %w", err)
 		}
 	case *proto.FailedJob_TemplateImport_:
+	case *proto.FailedJob_WorkspaceRefresh_:
+		var input WorkspaceRefreshJob
+		err = json.Unmarshal(job.Input, &input)
+		if err != nil {
+			return nil, xerrors.Errorf("unmarshal workspace refresh input: %w", err)
+		}
+		build, err := s.Database.GetWorkspaceBuildByID(ctx, input.WorkspaceBuildID)
+		if err != nil {
+			return nil, xerrors.Errorf("get workspace build: %w", err)
+		}
+		err = s.Pubsub.Publish(codersdk.WorkspaceNotifyChannel(build.WorkspaceID), []byte{})
+		if err != nil {
+			return nil, xerrors.Errorf("update workspace: %w", err)
+		}
 	}
 
 	// if failed job is a workspace build, audit the outcome
@@ -1016,6 +1403,8 @@ func (s *server) FailJob(ctx context.Context, failJob *proto.FailedJob) (*proto.
 		}
 	}
 
+	s.deleteCheckpoint(ctx, jobID)
+
 	data, err := json.Marshal(provisionersdk.ProvisionerJobLogsNotifyMessage{EndOfLogs: true})
 	if err != nil {
 		return nil, xerrors.Errorf("marshal job log: %w", err)
@@ -1245,6 +1634,16 @@ func (s *server) CompleteJob(ctx context.Context, completed *proto.CompletedJob)
 				return xerrors.Errorf("update workspace build deadline: %w", err)
 			}
 
+			if s.DeploymentValues.AgentCodeServerVersion.Value() != "" {
+				template, err := db.GetTemplateByID(ctx, workspace.TemplateID)
+				if err != nil {
+					return xerrors.Errorf("get template: %w", err)
+				}
+				if template.CodeServerEnabled {
+					addCodeServerApps(jobType.WorkspaceBuild.Resources, s.DeploymentValues.AgentCodeServerPort.Value())
+				}
+			}
+
 			agentTimeouts := make(map[time.Duration]bool) // A set of agent timeouts.
 			// This could be a bulk insert to improve performance.
 			for _, protoResource := range jobType.WorkspaceBuild.Resources {
@@ -1257,6 +1656,14 @@ func (s *server) CompleteJob(ctx context.Context, completed *proto.CompletedJob)
 					return xerrors.Errorf("insert provisioner job: %w", err)
 				}
 			}
+			err = insertWorkspaceBuildMetadata(ctx, db, workspaceBuild.ID, jobType.WorkspaceBuild.WorkspaceMetadata)
+			if err != nil {
+				return err
+			}
+			err = insertWorkspaceBuildCapacityFallback(ctx, db, workspaceBuild.ID, jobType.WorkspaceBuild.CapacityFallback)
+			if err != nil {
+				return err
+			}
 
 			// On start, we want to ensure that workspace agents timeout statuses
 			// are propagated. This method is simple and does not protect against
@@ -1371,6 +1778,56 @@ func (s *server) CompleteJob(ctx context.Context, completed *proto.CompletedJob)
 			})
 		}
 
+		err = s.Pubsub.Publish(codersdk.WorkspaceNotifyChannel(workspaceBuild.WorkspaceID), []byte{})
+		if err != nil {
+			return nil, xerrors.Errorf("update workspace: %w", err)
+		}
+	case *proto.CompletedJob_WorkspaceRefresh_:
+		var input WorkspaceRefreshJob
+		err = json.Unmarshal(job.Input, &input)
+		if err != nil {
+			return nil, xerrors.Errorf("unmarshal job data: %w", err)
+		}
+		workspaceBuild, err := s.Database.GetWorkspaceBuildByID(ctx, input.WorkspaceBuildID)
+		if err != nil {
+			return nil, xerrors.Errorf("get workspace build: %w", err)
+		}
+
+		err = s.Database.InTx(func(db database.Store) error {
+			now := s.timeNow()
+			err := db.UpdateProvisionerJobWithCompleteByID(ctx, database.UpdateProvisionerJobWithCompleteByIDParams{
+				ID:        jobID,
+				UpdatedAt: now,
+				CompletedAt: sql.NullTime{
+					Time:  now,
+					Valid: true,
+				},
+				Error:     sql.NullString{},
+				ErrorCode: sql.NullString{},
+			})
+			if err != nil {
+				return xerrors.Errorf("update provisioner job: %w", err)
+			}
+			// The workspace may have been built while the refresh ran, the
+			// resources of the newer build must not be overwritten.
+			latestBuild, err := db.GetLatestWorkspaceBuildByWorkspaceID(ctx, workspaceBuild.WorkspaceID)
+			if err != nil {
+				return xerrors.Errorf("get latest workspace build: %w", err)
+			}
+			if latestBuild.ID != workspaceBuild.ID {
+				s.Logger.Info(ctx, "discarding refresh of superseded workspace build",
+					slog.F("job_id", jobID),
+					slog.F("workspace_build_id", workspaceBuild.ID),
+					slog.F("latest_workspace_build_id", latestBuild.ID))
+				return nil
+			}
+			return refreshWorkspaceResources(ctx, db, workspaceBuild.JobID, jobType.WorkspaceRefresh.Resources, now)
+		}, nil)
+		if err != nil {
+			return nil, xerrors.Errorf("complete job: %w", err)
+		}
+		s.Logger.Debug(ctx, "marked workspace refresh job as completed", slog.F("job_id", jobID))
+
 		err = s.Pubsub.Publish(codersdk.WorkspaceNotifyChannel(workspaceBuild.WorkspaceID), []byte{})
 		if err != nil {
 			return nil, xerrors.Errorf("update workspace: %w", err)
@@ -1414,6 +1871,8 @@ func (s *server) CompleteJob(ctx context.Context, completed *proto.CompletedJob)
 			reflect.TypeOf(completed.Type).String())
 	}
 
+	s.deleteCheckpoint(ctx, jobID)
+
 	data, err := json.Marshal(provisionersdk.ProvisionerJobLogsNotifyMessage{EndOfLogs: true})
 	if err != nil {
 		return nil, xerrors.Errorf("marshal job log: %w", err)
@@ -1428,12 +1887,57 @@ func (s *server) CompleteJob(ctx context.Context, completed *proto.CompletedJob)
 	return &proto.Empty{}, nil
 }
 
+// deleteCheckpoint deletes the checkpoint of a job that won't be resumed
+// anymore. Checkpoints of completed jobs are never read, so failing to delete
+// one doesn't fail the job.
+func (s *server) deleteCheckpoint(ctx context.Context, jobID uuid.UUID) {
+	err := s.Database.DeleteProvisionerJobCheckpointByJobID(ctx, jobID)
+	if err != nil {
+		s.Logger.Warn(ctx, "failed to delete job checkpoint", slog.F("job_id", jobID), slog.Error(err))
+	}
+}
+
 func (s *server) startTrace(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
 	return s.Tracer.Start(ctx, name, append(opts, trace.WithAttributes(
 		semconv.ServiceNameKey.String("coderd.provisionerd"),
 	))...)
 }
 
+// codeServerAppSlug is the slug of the app exposing the code-server managed by
+// agents.
+const codeServerAppSlug = "code-server"
+
+// addCodeServerApps adds an app exposing the code-server managed by the agent
+// to each agent of the resources, unless the template defines an app with the
+// same slug.
+func addCodeServerApps(resources []*sdkproto.Resource, port int64) {
+	for _, resource := range resources {
+		for _, agent := range resource.Agents {
+			if slices.ContainsFunc(agent.Apps, func(app *sdkproto.App) bool {
+				return app.Slug == codeServerAppSlug
+			}) {
+				continue
+			}
+			appURL := fmt.Sprintf("http://localhost:%d", port)
+			if agent.Directory != "" {
+				appURL += "/?folder=" + url.QueryEscape(agent.Directory)
+			}
+			agent.Apps = append(agent.Apps, &sdkproto.App{
+				Slug:         codeServerAppSlug,
+				DisplayName:  "code-server",
+				Url:          appURL,
+				Icon:         "/icon/code.svg",
+				SharingLevel: sdkproto.AppSharingLevel_OWNER,
+				Healthcheck: &sdkproto.Healthcheck{
+					Url:       fmt.Sprintf("http://localhost:%d/healthz", port),
+					Interval:  5,
+					Threshold: 6,
+				},
+			})
+		}
+	}
+}
+
 func InsertWorkspaceResource(ctx context.Context, db database.Store, jobID uuid.UUID, transition database.WorkspaceTransition, protoResource *sdkproto.Resource, snapshot *telemetry.Snapshot) error {
 	resource, err := db.InsertWorkspaceResource(ctx, database.InsertWorkspaceResourceParams{
 		ID:         uuid.New(),
@@ -1449,16 +1953,15 @@ func InsertWorkspaceResource(ctx context.Context, db database.Store, jobID uuid.
 			String: protoResource.InstanceType,
 			Valid:  protoResource.InstanceType != "",
 		},
+		Action:  string(convertResourceAction(protoResource.Action)),
+		Address: protoResource.Address,
 	})
 	if err != nil {
 		return xerrors.Errorf("insert provisioner job resource %q: %w", protoResource.Name, err)
 	}
 	snapshot.WorkspaceResources = append(snapshot.WorkspaceResources, telemetry.ConvertWorkspaceResource(resource))
 
-	var (
-		agentNames = make(map[string]struct{})
-		appSlugs   = make(map[string]struct{})
-	)
+	agentNames := make(map[string]struct{})
 	for _, prAgent := range protoResource.Agents {
 		if _, ok := agentNames[prAgent.Name]; ok {
 			return xerrors.Errorf("duplicate agent name %q", prAgent.Name)
@@ -1497,6 +2000,14 @@ func InsertWorkspaceResource(ctx context.Context, db database.Store, jobID uuid.
 				Valid:      true,
 			}
 		}
+		troubleshootingURLs, err := json.Marshal(codersdk.WorkspaceAgentTroubleshootingURLs{
+			ConnectionTimeout: prAgent.GetTroubleshootingUrls().GetConnectionTimeout(),
+			StartError:        prAgent.GetTroubleshootingUrls().GetStartError(),
+			TokenInvalid:      prAgent.GetTroubleshootingUrls().GetTokenInvalid(),
+		})
+		if err != nil {
+			return xerrors.Errorf("marshal troubleshooting urls: %w", err)
+		}
 		authToken := uuid.New()
 		if prAgent.GetToken() != "" {
 			authToken, err = uuid.Parse(prAgent.GetToken())
@@ -1520,6 +2031,7 @@ func InsertWorkspaceResource(ctx context.Context, db database.Store, jobID uuid.
 			OperatingSystem:          prAgent.OperatingSystem,
 			ConnectionTimeoutSeconds: prAgent.GetConnectionTimeoutSeconds(),
 			TroubleshootingURL:       prAgent.GetTroubleshootingUrl(),
+			TroubleshootingURLs:      troubleshootingURLs,
 			MOTDFile:                 prAgent.GetMotdFile(),
 			DisplayApps:              convertDisplayApps(prAgent.GetDisplayApps()),
 			InstanceMetadata:         pqtype.NullRawMessage{},
@@ -1539,6 +2051,7 @@ func InsertWorkspaceResource(ctx context.Context, db database.Store, jobID uuid.
 				Timeout:          md.Timeout,
 				Interval:         md.Interval,
 				DisplayOrder:     int32(md.Order),
+				Collector:        md.Collector,
 			}
 			err := db.InsertWorkspaceAgentMetadata(ctx, p)
 			if err != nil {
@@ -1556,6 +2069,12 @@ func InsertWorkspaceResource(ctx context.Context, db database.Store, jobID uuid.
 		scriptStartBlocksLogin := make([]bool, 0, len(prAgent.Scripts))
 		scriptRunOnStart := make([]bool, 0, len(prAgent.Scripts))
 		scriptRunOnStop := make([]bool, 0, len(prAgent.Scripts))
+		scriptRunOnBuildSuccess := make([]bool, 0, len(prAgent.Scripts))
+		scriptRunOnBuildFailure := make([]bool, 0, len(prAgent.Scripts))
+		scriptRunOnPostStart := make([]bool, 0, len(prAgent.Scripts))
+		scriptLogin := make([]bool, 0, len(prAgent.Scripts))
+		scriptDiskPressurePath := make([]string, 0, len(prAgent.Scripts))
+		scriptDiskPressureThreshold := make([]int32, 0, len(prAgent.Scripts))
 
 		for _, script := range prAgent.Scripts {
 			logSourceIDs = append(logSourceIDs, uuid.New())
@@ -1568,6 +2087,12 @@ func InsertWorkspaceResource(ctx context.Context, db database.Store, jobID uuid.
 			scriptStartBlocksLogin = append(scriptStartBlocksLogin, script.StartBlocksLogin)
 			scriptRunOnStart = append(scriptRunOnStart, script.RunOnStart)
 			scriptRunOnStop = append(scriptRunOnStop, script.RunOnStop)
+			scriptRunOnBuildSuccess = append(scriptRunOnBuildSuccess, script.RunOnBuildSuccess)
+			scriptRunOnBuildFailure = append(scriptRunOnBuildFailure, script.RunOnBuildFailure)
+			scriptRunOnPostStart = append(scriptRunOnPostStart, script.RunOnPostStart)
+			scriptLogin = append(scriptLogin, script.Login)
+			scriptDiskPressurePath = append(scriptDiskPressurePath, script.DiskPressurePath)
+			scriptDiskPressureThreshold = append(scriptDiskPressureThreshold, script.DiskPressureThreshold)
 		}
 
 		_, err = db.InsertWorkspaceAgentLogSources(ctx, database.InsertWorkspaceAgentLogSourcesParams{
@@ -1582,21 +2107,29 @@ func InsertWorkspaceResource(ctx context.Context, db database.Store, jobID uuid.
 		}
 
 		_, err = db.InsertWorkspaceAgentScripts(ctx, database.InsertWorkspaceAgentScriptsParams{
-			WorkspaceAgentID: agentID,
-			LogSourceID:      logSourceIDs,
-			LogPath:          scriptLogPaths,
-			CreatedAt:        dbtime.Now(),
-			Script:           scriptSources,
-			Cron:             scriptCron,
-			TimeoutSeconds:   scriptTimeout,
-			StartBlocksLogin: scriptStartBlocksLogin,
-			RunOnStart:       scriptRunOnStart,
-			RunOnStop:        scriptRunOnStop,
+			WorkspaceAgentID:      agentID,
+			LogSourceID:           logSourceIDs,
+			LogPath:               scriptLogPaths,
+			CreatedAt:             dbtime.Now(),
+			Script:                scriptSources,
+			Cron:                  scriptCron,
+			TimeoutSeconds:        scriptTimeout,
+			StartBlocksLogin:      scriptStartBlocksLogin,
+			RunOnStart:            scriptRunOnStart,
+			RunOnStop:             scriptRunOnStop,
+			RunOnBuildSuccess:     scriptRunOnBuildSuccess,
+			RunOnBuildFailure:     scriptRunOnBuildFailure,
+			RunOnPostStart:        scriptRunOnPostStart,
+			Login:                 scriptLogin,
+			DiskPressurePath:      scriptDiskPressurePath,
+			DiskPressureThreshold: scriptDiskPressureThreshold,
 		})
 		if err != nil {
 			return xerrors.Errorf("insert agent scripts: %w", err)
 		}
 
+		// App slugs are unique per agent.
+		appSlugs := make(map[string]struct{})
 		for _, app := range prAgent.Apps {
 			slug := app.Slug
 			if slug == "" {
@@ -1606,7 +2139,7 @@ func InsertWorkspaceResource(ctx context.Context, db database.Store, jobID uuid.
 				return xerrors.Errorf("app slug %q does not match regex %q", slug, provisioner.AppSlugRegex.String())
 			}
 			if _, exists := appSlugs[slug]; exists {
-				return xerrors.Errorf("duplicate app slug, must be unique per template: %q", slug)
+				return xerrors.Errorf("duplicate app slug, must be unique per agent: %q", slug)
 			}
 			appSlugs[slug] = struct{}{}
 
@@ -1657,25 +2190,169 @@ func InsertWorkspaceResource(ctx context.Context, db database.Store, jobID uuid.
 		}
 	}
 
+	return insertWorkspaceResourceMetadata(ctx, db, resource.ID, protoResource.Metadata)
+}
+
+func insertWorkspaceResourceMetadata(ctx context.Context, db database.Store, resourceID uuid.UUID, metadata []*sdkproto.Resource_Metadata) error {
 	arg := database.InsertWorkspaceResourceMetadataParams{
-		WorkspaceResourceID: resource.ID,
+		WorkspaceResourceID: resourceID,
 		Key:                 []string{},
 		Value:               []string{},
 		Sensitive:           []bool{},
+		DisplayOrder:        []int32{},
+		DisplayGroup:        []string{},
 	}
-	for _, metadatum := range protoResource.Metadata {
+	for _, metadatum := range metadata {
 		if metadatum.IsNull {
 			continue
 		}
 		arg.Key = append(arg.Key, metadatum.Key)
 		arg.Value = append(arg.Value, metadatum.Value)
 		arg.Sensitive = append(arg.Sensitive, metadatum.Sensitive)
+		arg.DisplayOrder = append(arg.DisplayOrder, int32(metadatum.Order))
+		arg.DisplayGroup = append(arg.DisplayGroup, metadatum.Group)
 	}
-	_, err = db.InsertWorkspaceResourceMetadata(ctx, arg)
+	_, err := db.InsertWorkspaceResourceMetadata(ctx, arg)
 	if err != nil {
 		return xerrors.Errorf("insert workspace resource metadata: %w", err)
 	}
+	return nil
+}
+
+// insertWorkspaceBuildMetadata stores the outputs of the template with the
+// build. Outputs arrive sorted by name, which is kept as their display order.
+func insertWorkspaceBuildMetadata(ctx context.Context, db database.Store, buildID uuid.UUID, metadata []*sdkproto.Resource_Metadata) error {
+	arg := database.InsertWorkspaceBuildMetadataParams{
+		WorkspaceBuildID: buildID,
+		Key:              []string{},
+		Value:            []string{},
+		Sensitive:        []bool{},
+		DisplayOrder:     []int32{},
+	}
+	for index, metadatum := range metadata {
+		if metadatum.IsNull {
+			continue
+		}
+		arg.Key = append(arg.Key, metadatum.Key)
+		arg.Value = append(arg.Value, metadatum.Value)
+		arg.Sensitive = append(arg.Sensitive, metadatum.Sensitive)
+		arg.DisplayOrder = append(arg.DisplayOrder, int32(index))
+	}
+	if len(arg.Key) == 0 {
+		return nil
+	}
+	err := db.InsertWorkspaceBuildMetadata(ctx, arg)
+	if err != nil {
+		return xerrors.Errorf("insert workspace build metadata: %w", err)
+	}
+	return nil
+}
+
+// insertWorkspaceBuildCapacityFallback records the capacity options a build
+// tried, if the template falls back to alternate capacity options. Later
+// builds of the workspace start with the selected option.
+func insertWorkspaceBuildCapacityFallback(ctx context.Context, db database.Store, buildID uuid.UUID, fallback *sdkproto.CapacityFallback) error {
+	if fallback.GetSelected() == "" {
+		return nil
+	}
+	attempts := make([]codersdk.WorkspaceBuildCapacityAttempt, 0, len(fallback.Attempts))
+	for _, attempt := range fallback.Attempts {
+		attempts = append(attempts, codersdk.WorkspaceBuildCapacityAttempt{
+			Option: attempt.Option,
+			Error:  attempt.Error,
+		})
+	}
+	data, err := json.Marshal(attempts)
+	if err != nil {
+		return xerrors.Errorf("marshal capacity attempts: %w", err)
+	}
+	err = db.InsertWorkspaceBuildCapacityFallback(ctx, database.InsertWorkspaceBuildCapacityFallbackParams{
+		WorkspaceBuildID: buildID,
+		Selected:         fallback.Selected,
+		Attempts:         data,
+	})
+	if err != nil {
+		return xerrors.Errorf("insert workspace build capacity fallback: %w", err)
+	}
+	return nil
+}
 
+// refreshWorkspaceResources updates the metadata of the resources of a
+// build, and the resources its agents belong to, to match the resources of
+// a refresh. Resources are matched by their address, since the IDs of the
+// build are kept. Refreshes don't create or delete resources or agents, the
+// next build does.
+func refreshWorkspaceResources(ctx context.Context, db database.Store, buildJobID uuid.UUID, protoResources []*sdkproto.Resource, now time.Time) error {
+	resources, err := db.GetWorkspaceResourcesByJobID(ctx, buildJobID)
+	if err != nil {
+		return xerrors.Errorf("get workspace resources: %w", err)
+	}
+	resourcesByAddress := make(map[string]database.WorkspaceResource, len(resources))
+	// Resources of builds from before addresses were stored are matched by
+	// their type and name instead, unless instances of count, for_each or
+	// modules share them.
+	resourcesByName := make(map[string][]database.WorkspaceResource)
+	resourceIDs := make([]uuid.UUID, 0, len(resources))
+	for _, resource := range resources {
+		if resource.Address != "" {
+			resourcesByAddress[resource.Address] = resource
+		} else {
+			name := resource.Type + "." + resource.Name
+			resourcesByName[name] = append(resourcesByName[name], resource)
+		}
+		resourceIDs = append(resourceIDs, resource.ID)
+	}
+	protoResourcesByName := make(map[string]int, len(protoResources))
+	for _, protoResource := range protoResources {
+		protoResourcesByName[protoResource.Type+"."+protoResource.Name]++
+	}
+	findResource := func(protoResource *sdkproto.Resource) (database.WorkspaceResource, bool) {
+		if resource, ok := resourcesByAddress[protoResource.Address]; ok && protoResource.Address != "" {
+			return resource, true
+		}
+		name := protoResource.Type + "." + protoResource.Name
+		if len(resourcesByName[name]) != 1 || protoResourcesByName[name] != 1 {
+			return database.WorkspaceResource{}, false
+		}
+		return resourcesByName[name][0], true
+	}
+	agents, err := db.GetWorkspaceAgentsByResourceIDs(ctx, resourceIDs)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return xerrors.Errorf("get workspace agents: %w", err)
+	}
+	agentsByName := make(map[string]database.WorkspaceAgent, len(agents))
+	for _, agent := range agents {
+		agentsByName[agent.Name] = agent
+	}
+
+	for _, protoResource := range protoResources {
+		resource, ok := findResource(protoResource)
+		if !ok {
+			continue
+		}
+		err = db.DeleteWorkspaceResourceMetadataByResourceID(ctx, resource.ID)
+		if err != nil {
+			return xerrors.Errorf("delete workspace resource metadata %q: %w", protoResource.Name, err)
+		}
+		err = insertWorkspaceResourceMetadata(ctx, db, resource.ID, protoResource.Metadata)
+		if err != nil {
+			return err
+		}
+		for _, protoAgent := range protoResource.Agents {
+			agent, ok := agentsByName[protoAgent.Name]
+			if !ok || agent.ResourceID == resource.ID {
+				continue
+			}
+			err = db.UpdateWorkspaceAgentResourceIDByID(ctx, database.UpdateWorkspaceAgentResourceIDByIDParams{
+				ID:         agent.ID,
+				ResourceID: resource.ID,
+				UpdatedAt:  now,
+			})
+			if err != nil {
+				return xerrors.Errorf("update resource of workspace agent %q: %w", protoAgent.Name, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -1817,13 +2494,44 @@ func convertRichParameterValues(workspaceBuildParameters []database.WorkspaceBui
 	protoParameters := make([]*sdkproto.RichParameterValue, len(workspaceBuildParameters))
 	for i, buildParameter := range workspaceBuildParameters {
 		protoParameters[i] = &sdkproto.RichParameterValue{
-			Name:  buildParameter.Name,
-			Value: buildParameter.Value,
+			Name:   buildParameter.Name,
+			Value:  buildParameter.Value,
+			Source: convertParameterSource(buildParameter.Source),
 		}
 	}
 	return protoParameters
 }
 
+func convertParameterSource(source string) sdkproto.ParameterSource {
+	switch codersdk.WorkspaceBuildParameterSource(source) {
+	case codersdk.WorkspaceBuildParameterSourceTemplateDefault:
+		return sdkproto.ParameterSource_TEMPLATE_DEFAULT
+	case codersdk.WorkspaceBuildParameterSourcePreviousBuild:
+		return sdkproto.ParameterSource_PREVIOUS_BUILD
+	case codersdk.WorkspaceBuildParameterSourceUserInput:
+		return sdkproto.ParameterSource_USER_INPUT
+	default:
+		return sdkproto.ParameterSource_SOURCE_UNSPECIFIED
+	}
+}
+
+func convertResourceAction(action sdkproto.ResourceAction) codersdk.WorkspaceResourceAction {
+	switch action {
+	case sdkproto.ResourceAction_NO_OP:
+		return codersdk.WorkspaceResourceActionNoOp
+	case sdkproto.ResourceAction_CREATE:
+		return codersdk.WorkspaceResourceActionCreate
+	case sdkproto.ResourceAction_UPDATE:
+		return codersdk.WorkspaceResourceActionUpdate
+	case sdkproto.ResourceAction_REPLACE:
+		return codersdk.WorkspaceResourceActionReplace
+	case sdkproto.ResourceAction_DELETE:
+		return codersdk.WorkspaceResourceActionDelete
+	default:
+		return ""
+	}
+}
+
 func convertVariableValues(variableValues []codersdk.VariableValue) []*sdkproto.VariableValue {
 	protoVariableValues := make([]*sdkproto.VariableValue, len(variableValues))
 	for i, variableValue := range variableValues {
@@ -1874,6 +2582,13 @@ type WorkspaceProvisionJob struct {
 	LogLevel         string    `json:"log_level,omitempty"`
 }
 
+// WorkspaceRefreshJob is the payload for the "workspace_refresh" job type.
+type WorkspaceRefreshJob struct {
+	// WorkspaceBuildID is the build whose resources are refreshed. It must
+	// be the latest build of the workspace.
+	WorkspaceBuildID uuid.UUID `json:"workspace_build_id"`
+}
+
 // TemplateVersionDryRunJob is the payload for the "template_version_dry_run" job type.
 type TemplateVersionDryRunJob struct {
 	TemplateVersionID   uuid.UUID                          `json:"template_version_id"`
@@ -13,6 +13,7 @@ import (
 	"github.com/coder/coder/v2/coderd/database/dbgen"
 	"github.com/coder/coder/v2/coderd/database/dbmem"
 	"github.com/coder/coder/v2/coderd/database/dbtime"
+	sdkproto "github.com/coder/coder/v2/provisionersdk/proto"
 	"github.com/coder/coder/v2/testutil"
 )
 
@@ -61,3 +62,31 @@ func TestObtainOIDCAccessToken(t *testing.T) {
 		require.Equal(t, "token", link.OAuthAccessToken)
 	})
 }
+
+func TestAddCodeServerApps(t *testing.T) {
+	t.Parallel()
+
+	resources := []*sdkproto.Resource{{
+		Name: "dev",
+		Agents: []*sdkproto.Agent{{
+			Name:      "main",
+			Directory: "/home/coder/project",
+		}, {
+			Name: "custom",
+			Apps: []*sdkproto.App{{Slug: "code-server", Url: "http://localhost:8080"}},
+		}},
+	}}
+	addCodeServerApps(resources, 13337)
+
+	apps := resources[0].Agents[0].Apps
+	require.Len(t, apps, 1)
+	require.Equal(t, "code-server", apps[0].Slug)
+	require.Equal(t, "http://localhost:13337/?folder=%2Fhome%2Fcoder%2Fproject", apps[0].Url)
+	require.Equal(t, sdkproto.AppSharingLevel_OWNER, apps[0].SharingLevel)
+	require.Equal(t, "http://localhost:13337/healthz", apps[0].Healthcheck.Url)
+
+	// Apps of the template take precedence.
+	apps = resources[0].Agents[1].Apps
+	require.Len(t, apps, 1)
+	require.Equal(t, "http://localhost:8080", apps[0].Url)
+}
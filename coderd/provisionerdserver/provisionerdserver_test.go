@@ -22,6 +22,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/oauth2"
+	protobuf "google.golang.org/protobuf/proto"
 
 	"cdr.dev/slog/sloggers/slogtest"
 	"github.com/coder/coder/v2/buildinfo"
@@ -171,7 +172,10 @@ func TestAcquireJob(t *testing.T) {
 			// Set the max session token lifetime so we can assert we
 			// create an API key with an expiration within the bounds of the
 			// deployment config.
-			dv := &codersdk.DeploymentValues{MaxTokenLifetime: clibase.Duration(time.Hour)}
+			dv := &codersdk.DeploymentValues{
+				MaxTokenLifetime:  clibase.Duration(time.Hour),
+				WildcardAccessURL: "*.apps.example.com",
+			}
 			gitAuthProvider := "github"
 			srv, db, ps, _ := setup(t, false, &overrides{
 				deploymentValues: dv,
@@ -198,6 +202,13 @@ func TestAcquireJob(t *testing.T) {
 				Name:        "template",
 				Provisioner: database.ProvisionerTypeEcho,
 			})
+			for _, name := range []string{"platform", "finance"} {
+				group := dbgen.Group(t, db, database.Group{
+					Name:           name,
+					OrganizationID: template.OrganizationID,
+				})
+				dbgen.GroupMember(t, db, database.GroupMember{UserID: user.ID, GroupID: group.ID})
+			}
 			file := dbgen.File(t, db, database.File{CreatedBy: user.ID})
 			versionFile := dbgen.File(t, db, database.File{CreatedBy: user.ID})
 			version := dbgen.TemplateVersion(t, db, database.TemplateVersion{
@@ -255,6 +266,12 @@ func TestAcquireJob(t *testing.T) {
 				Transition:        database.WorkspaceTransitionStart,
 				Reason:            database.BuildReasonInitiator,
 			})
+			_ = dbgen.WorkspaceBuildParameters(t, db, []database.WorkspaceBuildParameter{{
+				WorkspaceBuildID: build.ID,
+				Name:             "region",
+				Value:            "eu",
+				Source:           string(codersdk.WorkspaceBuildParameterSourceTemplateDefault),
+			}})
 			_ = dbgen.ProvisionerJob(t, db, ps, database.ProvisionerJob{
 				ID:            build.ID,
 				InitiatorID:   user.ID,
@@ -309,6 +326,11 @@ func TestAcquireJob(t *testing.T) {
 				WorkspaceBuild: &proto.AcquiredJob_WorkspaceBuild{
 					WorkspaceBuildId: build.ID.String(),
 					WorkspaceName:    workspace.Name,
+					RichParameterValues: []*sdkproto.RichParameterValue{{
+						Name:   "region",
+						Value:  "eu",
+						Source: sdkproto.ParameterSource_TEMPLATE_DEFAULT,
+					}},
 					VariableValues: []*sdkproto.VariableValue{
 						{
 							Name:      "first",
@@ -338,6 +360,9 @@ func TestAcquireJob(t *testing.T) {
 						TemplateName:                  template.Name,
 						TemplateVersion:               version.Name,
 						WorkspaceOwnerSessionToken:    sessionToken,
+						MaxAppSharingLevel:            string(database.AppSharingLevelPublic),
+						WorkspaceAppHostname:          "*.apps.example.com",
+						WorkspaceOwnerGroups:          []string{"finance", "platform"},
 					},
 				},
 			})
@@ -504,6 +529,110 @@ func TestAcquireJob(t *testing.T) {
 	}
 }
 
+func TestAcquireJob_ReplaceResources(t *testing.T) {
+	t.Parallel()
+	srv, db, ps, _ := setup(t, false, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), testutil.WaitShort)
+	defer cancel()
+
+	user := dbgen.User(t, db, database.User{})
+	template := dbgen.Template(t, db, database.Template{
+		Name:        "template",
+		Provisioner: database.ProvisionerTypeEcho,
+	})
+	err := db.UpdateTemplateMetaByID(ctx, database.UpdateTemplateMetaByIDParams{
+		ID:                 template.ID,
+		UpdatedAt:          dbtime.Now(),
+		Name:               template.Name,
+		GroupACL:           template.GroupACL,
+		MaxAppSharingLevel: template.MaxAppSharingLevel,
+		ReplaceOnFailure:   true,
+	})
+	require.NoError(t, err)
+	file := dbgen.File(t, db, database.File{CreatedBy: user.ID})
+	version := dbgen.TemplateVersion(t, db, database.TemplateVersion{
+		TemplateID: uuid.NullUUID{UUID: template.ID, Valid: true},
+		JobID:      uuid.New(),
+	})
+	workspace := dbgen.Workspace(t, db, database.Workspace{
+		TemplateID: template.ID,
+		OwnerID:    user.ID,
+	})
+	build := func(number int32, transition database.WorkspaceTransition) database.WorkspaceBuild {
+		build := dbgen.WorkspaceBuild(t, db, database.WorkspaceBuild{
+			WorkspaceID:       workspace.ID,
+			BuildNumber:       number,
+			JobID:             uuid.New(),
+			TemplateVersionID: version.ID,
+			Transition:        transition,
+			Reason:            database.BuildReasonInitiator,
+		})
+		job := database.ProvisionerJob{
+			ID:          build.JobID,
+			InitiatorID: user.ID,
+			FileID:      file.ID,
+			Type:        database.ProvisionerJobTypeWorkspaceBuild,
+			Input: must(json.Marshal(provisionerdserver.WorkspaceProvisionJob{
+				WorkspaceBuildID: build.ID,
+			})),
+		}
+		if number < 3 {
+			job.StartedAt = sql.NullTime{Time: dbtime.Now(), Valid: true}
+			job.CompletedAt = sql.NullTime{Time: dbtime.Now(), Valid: true}
+		}
+		_ = dbgen.ProvisionerJob(t, db, ps, job)
+		return build
+	}
+	started := build(1, database.WorkspaceTransitionStart)
+	resource := func(address string) database.WorkspaceResource {
+		return dbgen.WorkspaceResource(t, db, database.WorkspaceResource{
+			JobID:      started.JobID,
+			Transition: database.WorkspaceTransitionStart,
+			Address:    address,
+		})
+	}
+	// The startup script of the agent failed.
+	failed := dbgen.WorkspaceAgent(t, db, database.WorkspaceAgent{
+		ResourceID: resource("docker_container.workspace[0]").ID,
+	})
+	err = db.UpdateWorkspaceAgentLifecycleStateByID(ctx, database.UpdateWorkspaceAgentLifecycleStateByIDParams{
+		ID:             failed.ID,
+		LifecycleState: database.WorkspaceAgentLifecycleStateStartError,
+	})
+	require.NoError(t, err)
+	// The agent never connected.
+	_ = dbgen.WorkspaceAgent(t, db, database.WorkspaceAgent{
+		ResourceID:               resource("module.vm.aws_instance.dev").ID,
+		CreatedAt:                dbtime.Now().Add(-time.Hour),
+		ConnectionTimeoutSeconds: 60,
+	})
+	// The agent is still connecting.
+	_ = dbgen.WorkspaceAgent(t, db, database.WorkspaceAgent{
+		ResourceID: resource("docker_container.sidecar").ID,
+	})
+	// The address of resources of older builds is unknown.
+	_ = dbgen.WorkspaceAgent(t, db, database.WorkspaceAgent{
+		ResourceID:               resource("").ID,
+		CreatedAt:                dbtime.Now().Add(-time.Hour),
+		ConnectionTimeoutSeconds: 60,
+	})
+	// The workspace is restarted.
+	_ = build(2, database.WorkspaceTransitionStop)
+	_ = build(3, database.WorkspaceTransitionStart)
+
+	var job *proto.AcquiredJob
+	for {
+		job, err = srv.AcquireJob(ctx, nil)
+		require.NoError(t, err)
+		if _, ok := job.Type.(*proto.AcquiredJob_WorkspaceBuild_); ok {
+			break
+		}
+	}
+	metadata := job.Type.(*proto.AcquiredJob_WorkspaceBuild_).WorkspaceBuild.Metadata
+	require.True(t, metadata.ReplaceOnFailure)
+	require.Equal(t, []string{"docker_container.workspace[0]", "module.vm.aws_instance.dev"}, metadata.ReplaceResources)
+}
+
 func TestUpdateJob(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -569,6 +698,10 @@ func TestUpdateJob(t *testing.T) {
 		})
 		require.NoError(t, err)
 		_, err = db.AcquireProvisionerJob(ctx, database.AcquireProvisionerJobParams{
+			StartedAt: sql.NullTime{
+				Time:  dbtime.Now(),
+				Valid: true,
+			},
 			WorkerID: uuid.NullUUID{
 				UUID:  srvID,
 				Valid: true,
@@ -635,6 +768,86 @@ func TestUpdateJob(t *testing.T) {
 		require.Equal(t, "# hello world", version.Readme)
 	})
 
+	t.Run("Checkpoint", func(t *testing.T) {
+		t.Parallel()
+		srv, db, _, pd := setup(t, false, &overrides{})
+		checkpoint := &sdkproto.Checkpoint{
+			Stage: "init",
+			Files: map[string][]byte{".terraform.lock.hcl": []byte("# lock")},
+		}
+
+		// Only workspace builds can be resumed.
+		job := setupJob(t, db, pd.ID)
+		_, err := srv.UpdateJob(ctx, &proto.UpdateJobRequest{
+			JobId:      job.String(),
+			Checkpoint: checkpoint,
+		})
+		require.ErrorContains(t, err, "checkpoints are only supported for workspace builds")
+
+		build, err := db.InsertProvisionerJob(ctx, database.InsertProvisionerJobParams{
+			ID:            uuid.New(),
+			Provisioner:   database.ProvisionerTypeEcho,
+			Type:          database.ProvisionerJobTypeWorkspaceBuild,
+			StorageMethod: database.ProvisionerStorageMethodFile,
+		})
+		require.NoError(t, err)
+		_, err = db.AcquireProvisionerJob(ctx, database.AcquireProvisionerJobParams{
+			StartedAt: sql.NullTime{
+				Time:  dbtime.Now(),
+				Valid: true,
+			},
+			WorkerID: uuid.NullUUID{
+				UUID:  pd.ID,
+				Valid: true,
+			},
+			Types: []database.ProvisionerType{database.ProvisionerTypeEcho},
+		})
+		require.NoError(t, err)
+		_, err = srv.UpdateJob(ctx, &proto.UpdateJobRequest{
+			JobId:      build.ID.String(),
+			Checkpoint: checkpoint,
+		})
+		require.NoError(t, err)
+
+		saved, err := db.GetProvisionerJobCheckpointByJobID(ctx, build.ID)
+		require.NoError(t, err)
+		require.Equal(t, "init", saved.Stage)
+		require.NotEmpty(t, saved.Checkpoint)
+	})
+
+	t.Run("TemplateMetadata", func(t *testing.T) {
+		t.Parallel()
+		srv, db, _, pd := setup(t, false, &overrides{})
+		job := setupJob(t, db, pd.ID)
+		// The first import of a template has no template yet.
+		versionID := uuid.New()
+		err := db.InsertTemplateVersion(ctx, database.InsertTemplateVersionParams{
+			ID:    versionID,
+			JobID: job,
+		})
+		require.NoError(t, err)
+		_, err = srv.UpdateJob(ctx, &proto.UpdateJobRequest{
+			JobId: job.String(),
+			TemplateMetadata: &sdkproto.TemplateMetadata{
+				DisplayName: " Docker",
+				Icon:        "/icon/docker.png",
+				Description: "Develop in a Docker container",
+				DocsUrl:     "https://example.com/docs",
+			},
+		})
+		require.NoError(t, err)
+
+		// The invalid display name is ignored.
+		metadata, err := db.GetTemplateVersionMetadataByTemplateVersionID(ctx, versionID)
+		require.NoError(t, err)
+		require.Equal(t, database.TemplateVersionMetadatum{
+			TemplateVersionID: versionID,
+			Icon:              "/icon/docker.png",
+			Description:       "Develop in a Docker container",
+			DocsURL:           "https://example.com/docs",
+		}, metadata)
+	})
+
 	t.Run("TemplateVariables", func(t *testing.T) {
 		t.Parallel()
 
@@ -861,6 +1074,10 @@ func TestFailJob(t *testing.T) {
 			Type: &proto.FailedJob_WorkspaceBuild_{
 				WorkspaceBuild: &proto.FailedJob_WorkspaceBuild{
 					State: []byte("some state"),
+					DiagnosticBundle: &sdkproto.DiagnosticBundle{
+						Graph:         "digraph {}",
+						WorkDirectory: &sdkproto.WorkDirectoryListing{Path: "/tmp/session"},
+					},
 				},
 			},
 		})
@@ -870,6 +1087,17 @@ func TestFailJob(t *testing.T) {
 		build, err := db.GetWorkspaceBuildByID(ctx, buildID)
 		require.NoError(t, err)
 		require.Equal(t, "some state", string(build.ProvisionerState))
+
+		// The bundle is stored without the listing, which is stored on its
+		// own.
+		dbBundle, err := db.GetProvisionerJobDiagnosticBundleByJobID(ctx, job.ID)
+		require.NoError(t, err)
+		var bundle sdkproto.DiagnosticBundle
+		require.NoError(t, protobuf.Unmarshal(dbBundle.Bundle, &bundle))
+		require.Equal(t, "digraph {}", bundle.Graph)
+		require.Nil(t, bundle.WorkDirectory)
+		_, err = db.GetProvisionerJobWorkDirectoryByJobID(ctx, job.ID)
+		require.NoError(t, err)
 	})
 }
 
@@ -1223,6 +1451,18 @@ func TestCompleteJob(t *testing.T) {
 								Name: "example",
 								Type: "aws_instance",
 							}},
+							WorkspaceMetadata: []*sdkproto.Resource_Metadata{
+								{Key: "endpoint", Value: "https://example.com"},
+								{Key: "missing", IsNull: true},
+								{Key: "token", Sensitive: true},
+							},
+							CapacityFallback: &sdkproto.CapacityFallback{
+								Attempts: []*sdkproto.CapacityFallback_Attempt{{
+									Option: "spot",
+									Error:  "InsufficientInstanceCapacity",
+								}},
+								Selected: "on-demand",
+							},
 						},
 					},
 				})
@@ -1235,6 +1475,26 @@ func TestCompleteJob(t *testing.T) {
 				require.NoError(t, err)
 				require.Equal(t, c.transition == database.WorkspaceTransitionDelete, workspace.Deleted)
 
+				metadata, err := db.GetWorkspaceBuildMetadataByBuildID(ctx, build.ID)
+				require.NoError(t, err)
+				require.Equal(t, []database.WorkspaceBuildMetadatum{{
+					WorkspaceBuildID: build.ID,
+					Key:              "endpoint",
+					Value:            "https://example.com",
+					DisplayOrder:     0,
+				}, {
+					WorkspaceBuildID: build.ID,
+					Key:              "token",
+					Sensitive:        true,
+					DisplayOrder:     2,
+				}}, metadata)
+
+				fallback, err := db.GetLatestWorkspaceBuildCapacityFallbackByWorkspaceID(ctx, workspace.ID)
+				require.NoError(t, err)
+				require.Equal(t, build.ID, fallback.WorkspaceBuildID)
+				require.Equal(t, "on-demand", fallback.Selected)
+				require.JSONEq(t, `[{"option": "spot", "error": "InsufficientInstanceCapacity"}]`, string(fallback.Attempts))
+
 				workspaceBuild, err := db.GetWorkspaceBuildByID(ctx, build.ID)
 				require.NoError(t, err)
 
@@ -1536,6 +1796,244 @@ func TestCompleteJob(t *testing.T) {
 		})
 		require.NoError(t, err)
 	})
+	t.Run("WorkspaceRefresh", func(t *testing.T) {
+		t.Parallel()
+		srv, db, _, pd := setup(t, false, &overrides{})
+		workspace := dbgen.Workspace(t, db, database.Workspace{})
+		// Only completed builds are refreshed.
+		buildJob := dbgen.ProvisionerJob(t, db, nil, database.ProvisionerJob{
+			Type:        database.ProvisionerJobTypeWorkspaceBuild,
+			StartedAt:   sql.NullTime{Time: dbtime.Now(), Valid: true},
+			CompletedAt: sql.NullTime{Time: dbtime.Now(), Valid: true},
+		})
+		build := dbgen.WorkspaceBuild(t, db, database.WorkspaceBuild{
+			WorkspaceID: workspace.ID,
+			JobID:       buildJob.ID,
+		})
+		for _, resource := range []*sdkproto.Resource{{
+			Name:     "dev",
+			Type:     "aws_instance",
+			Metadata: []*sdkproto.Resource_Metadata{{Key: "state", Value: "running"}},
+		}, {
+			Name:   "home",
+			Type:   "aws_ebs_volume",
+			Agents: []*sdkproto.Agent{{Name: "main", Auth: &sdkproto.Agent_Token{Token: uuid.NewString()}}},
+		}} {
+			err := provisionerdserver.InsertWorkspaceResource(ctx, db, buildJob.ID, database.WorkspaceTransitionStart, resource, &telemetry.Snapshot{})
+			require.NoError(t, err)
+		}
+
+		input, err := json.Marshal(provisionerdserver.WorkspaceRefreshJob{WorkspaceBuildID: build.ID})
+		require.NoError(t, err)
+		job, err := db.InsertProvisionerJob(ctx, database.InsertProvisionerJobParams{
+			ID:            uuid.New(),
+			Provisioner:   database.ProvisionerTypeEcho,
+			Type:          database.ProvisionerJobTypeWorkspaceRefresh,
+			StorageMethod: database.ProvisionerStorageMethodFile,
+			Input:         input,
+		})
+		require.NoError(t, err)
+		_, err = db.AcquireProvisionerJob(ctx, database.AcquireProvisionerJobParams{
+			WorkerID: uuid.NullUUID{
+				UUID:  pd.ID,
+				Valid: true,
+			},
+			Types: []database.ProvisionerType{database.ProvisionerTypeEcho},
+		})
+		require.NoError(t, err)
+
+		// The instance stopped and the agent moved to it.
+		_, err = srv.CompleteJob(ctx, &proto.CompletedJob{
+			JobId: job.ID.String(),
+			Type: &proto.CompletedJob_WorkspaceRefresh_{
+				WorkspaceRefresh: &proto.CompletedJob_WorkspaceRefresh{
+					Resources: []*sdkproto.Resource{{
+						Name:     "dev",
+						Type:     "aws_instance",
+						Metadata: []*sdkproto.Resource_Metadata{{Key: "state", Value: "stopped"}},
+						Agents:   []*sdkproto.Agent{{Name: "main"}},
+					}, {
+						Name: "home",
+						Type: "aws_ebs_volume",
+					}},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		resources, err := db.GetWorkspaceResourcesByJobID(ctx, buildJob.ID)
+		require.NoError(t, err)
+		require.Len(t, resources, 2)
+		var instance database.WorkspaceResource
+		for _, resource := range resources {
+			if resource.Name == "dev" {
+				instance = resource
+			}
+		}
+		metadata, err := db.GetWorkspaceResourceMetadataByResourceIDs(ctx, []uuid.UUID{instance.ID})
+		require.NoError(t, err)
+		require.Len(t, metadata, 1)
+		require.Equal(t, "stopped", metadata[0].Value.String)
+		agents, err := db.GetWorkspaceAgentsByResourceIDs(ctx, []uuid.UUID{instance.ID})
+		require.NoError(t, err)
+		require.Len(t, agents, 1)
+		require.Equal(t, "main", agents[0].Name)
+	})
+	t.Run("WorkspaceRefreshInstances", func(t *testing.T) {
+		t.Parallel()
+		srv, db, _, pd := setup(t, false, &overrides{})
+		workspace := dbgen.Workspace(t, db, database.Workspace{})
+		buildJob := dbgen.ProvisionerJob(t, db, nil, database.ProvisionerJob{
+			Type:        database.ProvisionerJobTypeWorkspaceBuild,
+			StartedAt:   sql.NullTime{Time: dbtime.Now(), Valid: true},
+			CompletedAt: sql.NullTime{Time: dbtime.Now(), Valid: true},
+		})
+		build := dbgen.WorkspaceBuild(t, db, database.WorkspaceBuild{
+			WorkspaceID: workspace.ID,
+			JobID:       buildJob.ID,
+		})
+		// Instances of count share their type and name.
+		for _, address := range []string{"aws_instance.dev[0]", "aws_instance.dev[1]"} {
+			err := provisionerdserver.InsertWorkspaceResource(ctx, db, buildJob.ID, database.WorkspaceTransitionStart, &sdkproto.Resource{
+				Name:     "dev",
+				Type:     "aws_instance",
+				Address:  address,
+				Metadata: []*sdkproto.Resource_Metadata{{Key: "state", Value: "running"}},
+			}, &telemetry.Snapshot{})
+			require.NoError(t, err)
+		}
+
+		input, err := json.Marshal(provisionerdserver.WorkspaceRefreshJob{WorkspaceBuildID: build.ID})
+		require.NoError(t, err)
+		job, err := db.InsertProvisionerJob(ctx, database.InsertProvisionerJobParams{
+			ID:            uuid.New(),
+			Provisioner:   database.ProvisionerTypeEcho,
+			Type:          database.ProvisionerJobTypeWorkspaceRefresh,
+			StorageMethod: database.ProvisionerStorageMethodFile,
+			Input:         input,
+		})
+		require.NoError(t, err)
+		_, err = db.AcquireProvisionerJob(ctx, database.AcquireProvisionerJobParams{
+			WorkerID: uuid.NullUUID{
+				UUID:  pd.ID,
+				Valid: true,
+			},
+			Types: []database.ProvisionerType{database.ProvisionerTypeEcho},
+		})
+		require.NoError(t, err)
+
+		// Only the second instance stopped.
+		_, err = srv.CompleteJob(ctx, &proto.CompletedJob{
+			JobId: job.ID.String(),
+			Type: &proto.CompletedJob_WorkspaceRefresh_{
+				WorkspaceRefresh: &proto.CompletedJob_WorkspaceRefresh{
+					Resources: []*sdkproto.Resource{{
+						Name:     "dev",
+						Type:     "aws_instance",
+						Address:  "aws_instance.dev[0]",
+						Metadata: []*sdkproto.Resource_Metadata{{Key: "state", Value: "running"}},
+					}, {
+						Name:     "dev",
+						Type:     "aws_instance",
+						Address:  "aws_instance.dev[1]",
+						Metadata: []*sdkproto.Resource_Metadata{{Key: "state", Value: "stopped"}},
+					}},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		resources, err := db.GetWorkspaceResourcesByJobID(ctx, buildJob.ID)
+		require.NoError(t, err)
+		require.Len(t, resources, 2)
+		for _, resource := range resources {
+			metadata, err := db.GetWorkspaceResourceMetadataByResourceIDs(ctx, []uuid.UUID{resource.ID})
+			require.NoError(t, err)
+			require.Len(t, metadata, 1)
+			expected := "running"
+			if resource.Address == "aws_instance.dev[1]" {
+				expected = "stopped"
+			}
+			require.Equal(t, expected, metadata[0].Value.String, resource.Address)
+		}
+	})
+	t.Run("WorkspaceRefreshSuperseded", func(t *testing.T) {
+		t.Parallel()
+		srv, db, _, pd := setup(t, false, &overrides{})
+		workspace := dbgen.Workspace(t, db, database.Workspace{})
+		buildJob := dbgen.ProvisionerJob(t, db, nil, database.ProvisionerJob{
+			Type:        database.ProvisionerJobTypeWorkspaceBuild,
+			StartedAt:   sql.NullTime{Time: dbtime.Now(), Valid: true},
+			CompletedAt: sql.NullTime{Time: dbtime.Now(), Valid: true},
+		})
+		build := dbgen.WorkspaceBuild(t, db, database.WorkspaceBuild{
+			WorkspaceID: workspace.ID,
+			JobID:       buildJob.ID,
+			BuildNumber: 1,
+		})
+		err := provisionerdserver.InsertWorkspaceResource(ctx, db, buildJob.ID, database.WorkspaceTransitionStart, &sdkproto.Resource{
+			Name:     "dev",
+			Type:     "aws_instance",
+			Metadata: []*sdkproto.Resource_Metadata{{Key: "state", Value: "running"}},
+		}, &telemetry.Snapshot{})
+		require.NoError(t, err)
+
+		input, err := json.Marshal(provisionerdserver.WorkspaceRefreshJob{WorkspaceBuildID: build.ID})
+		require.NoError(t, err)
+		job, err := db.InsertProvisionerJob(ctx, database.InsertProvisionerJobParams{
+			ID:            uuid.New(),
+			Provisioner:   database.ProvisionerTypeEcho,
+			Type:          database.ProvisionerJobTypeWorkspaceRefresh,
+			StorageMethod: database.ProvisionerStorageMethodFile,
+			Input:         input,
+		})
+		require.NoError(t, err)
+		_, err = db.AcquireProvisionerJob(ctx, database.AcquireProvisionerJobParams{
+			StartedAt: sql.NullTime{Time: dbtime.Now(), Valid: true},
+			WorkerID: uuid.NullUUID{
+				UUID:  pd.ID,
+				Valid: true,
+			},
+			Types: []database.ProvisionerType{database.ProvisionerTypeEcho},
+		})
+		require.NoError(t, err)
+
+		// The workspace is built again while the refresh runs.
+		newBuildJob := dbgen.ProvisionerJob(t, db, nil, database.ProvisionerJob{
+			Type:      database.ProvisionerJobTypeWorkspaceBuild,
+			StartedAt: sql.NullTime{Time: dbtime.Now(), Valid: true},
+		})
+		_ = dbgen.WorkspaceBuild(t, db, database.WorkspaceBuild{
+			WorkspaceID: workspace.ID,
+			JobID:       newBuildJob.ID,
+			BuildNumber: 2,
+		})
+
+		_, err = srv.CompleteJob(ctx, &proto.CompletedJob{
+			JobId: job.ID.String(),
+			Type: &proto.CompletedJob_WorkspaceRefresh_{
+				WorkspaceRefresh: &proto.CompletedJob_WorkspaceRefresh{
+					Resources: []*sdkproto.Resource{{
+						Name:     "dev",
+						Type:     "aws_instance",
+						Metadata: []*sdkproto.Resource_Metadata{{Key: "state", Value: "stopped"}},
+					}},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		completed, err := db.GetProvisionerJobByID(ctx, job.ID)
+		require.NoError(t, err)
+		require.True(t, completed.CompletedAt.Valid)
+		resources, err := db.GetWorkspaceResourcesByJobID(ctx, buildJob.ID)
+		require.NoError(t, err)
+		require.Len(t, resources, 1)
+		metadata, err := db.GetWorkspaceResourceMetadataByResourceIDs(ctx, []uuid.UUID{resources[0].ID})
+		require.NoError(t, err)
+		require.Len(t, metadata, 1)
+		require.Equal(t, "running", metadata[0].Value.String)
+	})
 }
 
 func TestInsertWorkspaceResource(t *testing.T) {
@@ -1556,6 +2054,22 @@ func TestInsertWorkspaceResource(t *testing.T) {
 		resources, err := db.GetWorkspaceResourcesByJobID(ctx, job)
 		require.NoError(t, err)
 		require.Len(t, resources, 1)
+		require.Empty(t, resources[0].Action)
+	})
+	t.Run("Action", func(t *testing.T) {
+		t.Parallel()
+		db := dbmem.New()
+		job := uuid.New()
+		err := insert(db, job, &sdkproto.Resource{
+			Name:   "something",
+			Type:   "aws_instance",
+			Action: sdkproto.ResourceAction_DELETE,
+		})
+		require.NoError(t, err)
+		resources, err := db.GetWorkspaceResourcesByJobID(ctx, job)
+		require.NoError(t, err)
+		require.Len(t, resources, 1)
+		require.Equal(t, string(codersdk.WorkspaceResourceActionDelete), resources[0].Action)
 	})
 	t.Run("InvalidAgentToken", func(t *testing.T) {
 		t.Parallel()
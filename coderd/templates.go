@@ -1,6 +1,7 @@
 package coderd
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -12,6 +13,8 @@ import (
 	"github.com/google/uuid"
 	"golang.org/x/xerrors"
 
+	"cdr.dev/slog"
+
 	"github.com/coder/coder/v2/coderd/audit"
 	"github.com/coder/coder/v2/coderd/database"
 	"github.com/coder/coder/v2/coderd/database/dbauthz"
@@ -419,6 +422,9 @@ func (api *API) postTemplateByOrganization(rw http.ResponseWriter, r *http.Reque
 		})
 		return
 	}
+	dbTemplate = api.applyTemplateVersionMetadata(ctx, dbTemplate, templateVersion.ID)
+	templateAudit.New = dbTemplate
+	template = api.convertTemplate(dbTemplate)
 
 	api.Telemetry.Report(&telemetry.Snapshot{
 		Templates:        []telemetry.Template{telemetry.ConvertTemplate(dbTemplate)},
@@ -615,6 +621,21 @@ func (api *API) patchTemplateMeta(rw http.ResponseWriter, r *http.Request) {
 	if req.DeprecationMessage != nil {
 		deprecationMessage = *req.DeprecationMessage
 	}
+	codeServerEnabled := template.CodeServerEnabled
+	if req.CodeServerEnabled != nil {
+		codeServerEnabled = *req.CodeServerEnabled
+	}
+	replaceOnFailure := template.ReplaceOnFailure
+	if req.ReplaceOnFailure != nil {
+		replaceOnFailure = *req.ReplaceOnFailure
+	}
+	maxAppSharingLevel := template.MaxAppSharingLevel
+	if req.MaxAppSharingLevel != nil {
+		maxAppSharingLevel = database.AppSharingLevel(*req.MaxAppSharingLevel)
+		if !maxAppSharingLevel.Valid() {
+			validErrs = append(validErrs, codersdk.ValidationError{Field: "max_app_sharing_level", Detail: "Must be one of: owner, authenticated, public."})
+		}
+	}
 
 	// The minimum valid value for a dormant TTL is 1 minute. This is
 	// to ensure an uninformed user does not send an unintentionally
@@ -657,6 +678,9 @@ func (api *API) patchTemplateMeta(rw http.ResponseWriter, r *http.Request) {
 			req.TimeTilDormantMillis == time.Duration(template.TimeTilDormant).Milliseconds() &&
 			req.TimeTilDormantAutoDeleteMillis == time.Duration(template.TimeTilDormantAutoDelete).Milliseconds() &&
 			req.RequireActiveVersion == template.RequireActiveVersion &&
+			maxAppSharingLevel == template.MaxAppSharingLevel &&
+			codeServerEnabled == template.CodeServerEnabled &&
+			replaceOnFailure == template.ReplaceOnFailure &&
 			(deprecationMessage == template.Deprecated) {
 			return nil
 		}
@@ -682,6 +706,10 @@ func (api *API) patchTemplateMeta(rw http.ResponseWriter, r *http.Request) {
 			Icon:                         req.Icon,
 			AllowUserCancelWorkspaceJobs: req.AllowUserCancelWorkspaceJobs,
 			GroupACL:                     groupACL,
+			MaxAppSharingLevel:           maxAppSharingLevel,
+			CodeServerEnabled:            codeServerEnabled,
+			DocsURL:                      template.DocsURL,
+			ReplaceOnFailure:             replaceOnFailure,
 		})
 		if err != nil {
 			return xerrors.Errorf("update template metadata: %w", err)
@@ -874,6 +902,7 @@ func (api *API) convertTemplate(
 		BuildTimeStats:                 buildTimeStats,
 		Description:                    template.Description,
 		Icon:                           template.Icon,
+		DocsURL:                        template.DocsURL,
 		DefaultTTLMillis:               time.Duration(template.DefaultTTL).Milliseconds(),
 		UseMaxTTL:                      template.UseMaxTtl,
 		MaxTTLMillis:                   time.Duration(template.MaxTTL).Milliseconds(),
@@ -896,5 +925,71 @@ func (api *API) convertTemplate(
 		RequireActiveVersion: templateAccessControl.RequireActiveVersion,
 		Deprecated:           templateAccessControl.IsDeprecated(),
 		DeprecationMessage:   templateAccessControl.Deprecated,
+		MaxAppSharingLevel:   codersdk.WorkspaceAppSharingLevel(template.MaxAppSharingLevel),
+		CodeServerEnabled:    template.CodeServerEnabled,
+		ReplaceOnFailure:     template.ReplaceOnFailure,
+	}
+}
+
+// applyTemplateVersionMetadata fills in the display name, icon and description
+// of the template from the metadata of the version, when they haven't been set
+// by a template admin. The docs URL can't be edited, so it follows the version.
+// The metadata is a convenience, so errors are only logged and the template is
+// returned unchanged.
+func (api *API) applyTemplateVersionMetadata(ctx context.Context, template database.Template, versionID uuid.UUID) database.Template {
+	metadata, err := api.Database.GetTemplateVersionMetadataByTemplateVersionID(ctx, versionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Versions imported before the metadata was saved, or templates
+		// without a coder_template local.
+		return template
+	}
+	if err != nil {
+		api.Logger.Error(ctx, "failed to get template version metadata",
+			slog.F("template_id", template.ID), slog.F("template_version_id", versionID), slog.Error(err))
+		return template
+	}
+
+	params := database.UpdateTemplateMetaByIDParams{
+		ID:                           template.ID,
+		UpdatedAt:                    dbtime.Now(),
+		Name:                         template.Name,
+		DisplayName:                  template.DisplayName,
+		Description:                  template.Description,
+		Icon:                         template.Icon,
+		AllowUserCancelWorkspaceJobs: template.AllowUserCancelWorkspaceJobs,
+		GroupACL:                     template.GroupACL,
+		MaxAppSharingLevel:           template.MaxAppSharingLevel,
+		CodeServerEnabled:            template.CodeServerEnabled,
+		DocsURL:                      metadata.DocsURL,
+		ReplaceOnFailure:             template.ReplaceOnFailure,
+	}
+	if params.DisplayName == "" {
+		params.DisplayName = metadata.DisplayName
+	}
+	if params.Description == "" {
+		params.Description = metadata.Description
+	}
+	if params.Icon == "" {
+		params.Icon = metadata.Icon
+	}
+	if params.DisplayName == template.DisplayName &&
+		params.Description == template.Description &&
+		params.Icon == template.Icon &&
+		params.DocsURL == template.DocsURL {
+		return template
+	}
+
+	err = api.Database.UpdateTemplateMetaByID(ctx, params)
+	if err != nil {
+		api.Logger.Error(ctx, "failed to apply template version metadata",
+			slog.F("template_id", template.ID), slog.F("template_version_id", versionID), slog.Error(err))
+		return template
+	}
+	updated, err := api.Database.GetTemplateByID(ctx, template.ID)
+	if err != nil {
+		api.Logger.Error(ctx, "failed to get template after applying version metadata",
+			slog.F("template_id", template.ID), slog.Error(err))
+		return template
 	}
+	return updated
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/coder/coder/v2/coderd/util/ptr"
 	"github.com/coder/coder/v2/codersdk"
 	"github.com/coder/coder/v2/provisioner/echo"
+	"github.com/coder/coder/v2/provisionersdk/proto"
 	"github.com/coder/coder/v2/testutil"
 )
 
@@ -74,6 +75,35 @@ func TestPostTemplateByOrganization(t *testing.T) {
 		assert.Equal(t, database.AuditActionCreate, auditor.AuditLogs()[2].Action)
 	})
 
+	t.Run("TemplateMetadata", func(t *testing.T) {
+		t.Parallel()
+		client := coderdtest.New(t, &coderdtest.Options{IncludeProvisionerDaemon: true})
+		user := coderdtest.CreateFirstUser(t, client)
+		version := coderdtest.CreateTemplateVersion(t, client, user.OrganizationID, &echo.Responses{
+			Parse: []*proto.Response{{
+				Type: &proto.Response_Parse{Parse: &proto.ParseComplete{
+					TemplateMetadata: &proto.TemplateMetadata{
+						DisplayName: "Docker",
+						Icon:        "/icon/docker.png",
+						Description: "Develop in a Docker container",
+						DocsUrl:     "https://example.com/docs",
+					},
+				}},
+			}},
+			ProvisionApply: echo.ApplyComplete,
+		})
+		_ = coderdtest.AwaitTemplateVersionJobCompleted(t, client, version.ID)
+
+		// The display name set by the template admin is kept.
+		template := coderdtest.CreateTemplate(t, client, user.OrganizationID, version.ID, func(ctr *codersdk.CreateTemplateRequest) {
+			ctr.DisplayName = "Custom"
+		})
+		require.Equal(t, "Custom", template.DisplayName)
+		require.Equal(t, "/icon/docker.png", template.Icon)
+		require.Equal(t, "Develop in a Docker container", template.Description)
+		require.Equal(t, "https://example.com/docs", template.DocsURL)
+	})
+
 	t.Run("AlreadyExists", func(t *testing.T) {
 		t.Parallel()
 		client := coderdtest.New(t, nil)
@@ -499,6 +529,105 @@ func TestTemplateByOrganizationAndName(t *testing.T) {
 func TestPatchTemplateMeta(t *testing.T) {
 	t.Parallel()
 
+	t.Run("MaxAppSharingLevel", func(t *testing.T) {
+		t.Parallel()
+
+		client := coderdtest.New(t, &coderdtest.Options{IncludeProvisionerDaemon: true})
+		user := coderdtest.CreateFirstUser(t, client)
+		version := coderdtest.CreateTemplateVersion(t, client, user.OrganizationID, nil)
+		template := coderdtest.CreateTemplate(t, client, user.OrganizationID, version.ID)
+		coderdtest.AwaitTemplateVersionJobCompleted(t, client, version.ID)
+		require.Equal(t, codersdk.WorkspaceAppSharingLevelPublic, template.MaxAppSharingLevel)
+
+		ctx := testutil.Context(t, testutil.WaitLong)
+
+		level := codersdk.WorkspaceAppSharingLevelOwner
+		updated, err := client.UpdateTemplateMeta(ctx, template.ID, codersdk.UpdateTemplateMeta{
+			Name:               template.Name,
+			DisplayName:        template.DisplayName,
+			Description:        template.Description,
+			Icon:               template.Icon,
+			MaxAppSharingLevel: &level,
+		})
+		require.NoError(t, err)
+		require.Equal(t, codersdk.WorkspaceAppSharingLevelOwner, updated.MaxAppSharingLevel)
+
+		level = "everyone"
+		_, err = client.UpdateTemplateMeta(ctx, template.ID, codersdk.UpdateTemplateMeta{
+			Name:               template.Name,
+			MaxAppSharingLevel: &level,
+		})
+		var apiErr *codersdk.Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusBadRequest, apiErr.StatusCode())
+	})
+
+	t.Run("CodeServerEnabled", func(t *testing.T) {
+		t.Parallel()
+
+		client := coderdtest.New(t, &coderdtest.Options{IncludeProvisionerDaemon: true})
+		user := coderdtest.CreateFirstUser(t, client)
+		version := coderdtest.CreateTemplateVersion(t, client, user.OrganizationID, nil)
+		template := coderdtest.CreateTemplate(t, client, user.OrganizationID, version.ID)
+		coderdtest.AwaitTemplateVersionJobCompleted(t, client, version.ID)
+		require.False(t, template.CodeServerEnabled)
+
+		ctx := testutil.Context(t, testutil.WaitLong)
+
+		updated, err := client.UpdateTemplateMeta(ctx, template.ID, codersdk.UpdateTemplateMeta{
+			Name:              template.Name,
+			DisplayName:       template.DisplayName,
+			Description:       template.Description,
+			Icon:              template.Icon,
+			CodeServerEnabled: ptr.Ref(true),
+		})
+		require.NoError(t, err)
+		require.True(t, updated.CodeServerEnabled)
+
+		// Omitting the setting leaves it unchanged.
+		updated, err = client.UpdateTemplateMeta(ctx, template.ID, codersdk.UpdateTemplateMeta{
+			Name:        template.Name,
+			DisplayName: template.DisplayName,
+			Description: "changed",
+			Icon:        template.Icon,
+		})
+		require.NoError(t, err)
+		require.True(t, updated.CodeServerEnabled)
+	})
+
+	t.Run("ReplaceOnFailure", func(t *testing.T) {
+		t.Parallel()
+
+		client := coderdtest.New(t, &coderdtest.Options{IncludeProvisionerDaemon: true})
+		user := coderdtest.CreateFirstUser(t, client)
+		version := coderdtest.CreateTemplateVersion(t, client, user.OrganizationID, nil)
+		template := coderdtest.CreateTemplate(t, client, user.OrganizationID, version.ID)
+		coderdtest.AwaitTemplateVersionJobCompleted(t, client, version.ID)
+		require.False(t, template.ReplaceOnFailure)
+
+		ctx := testutil.Context(t, testutil.WaitLong)
+
+		updated, err := client.UpdateTemplateMeta(ctx, template.ID, codersdk.UpdateTemplateMeta{
+			Name:             template.Name,
+			DisplayName:      template.DisplayName,
+			Description:      template.Description,
+			Icon:             template.Icon,
+			ReplaceOnFailure: ptr.Ref(true),
+		})
+		require.NoError(t, err)
+		require.True(t, updated.ReplaceOnFailure)
+
+		// Omitting the setting leaves it unchanged.
+		updated, err = client.UpdateTemplateMeta(ctx, template.ID, codersdk.UpdateTemplateMeta{
+			Name:        template.Name,
+			DisplayName: template.DisplayName,
+			Description: "changed",
+			Icon:        template.Icon,
+		})
+		require.NoError(t, err)
+		require.True(t, updated.ReplaceOnFailure)
+	})
+
 	t.Run("Modified", func(t *testing.T) {
 		t.Parallel()
 
@@ -1272,7 +1272,7 @@ func (api *API) patchActiveTemplateVersion(rw http.ResponseWriter, r *http.Reque
 	}
 	newTemplate := template
 	newTemplate.ActiveVersionID = req.ID
-	aReq.New = newTemplate
+	aReq.New = api.applyTemplateVersionMetadata(ctx, newTemplate, req.ID)
 
 	api.publishTemplateUpdate(ctx, template.ID)
 
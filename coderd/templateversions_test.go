@@ -671,6 +671,61 @@ func TestPatchActiveTemplateVersion(t *testing.T) {
 		require.Len(t, auditor.AuditLogs(), 6)
 		assert.Equal(t, database.AuditActionWrite, auditor.AuditLogs()[5].Action)
 	})
+
+	t.Run("TemplateMetadata", func(t *testing.T) {
+		t.Parallel()
+		auditor := audit.NewMock()
+		client := coderdtest.New(t, &coderdtest.Options{
+			IncludeProvisionerDaemon: true,
+			Auditor:                  auditor,
+		})
+		user := coderdtest.CreateFirstUser(t, client)
+		version := coderdtest.CreateTemplateVersion(t, client, user.OrganizationID, nil)
+		_ = coderdtest.AwaitTemplateVersionJobCompleted(t, client, version.ID)
+		template := coderdtest.CreateTemplate(t, client, user.OrganizationID, version.ID, func(ctr *codersdk.CreateTemplateRequest) {
+			ctr.Icon = "/icon/custom.png"
+		})
+		version = coderdtest.UpdateTemplateVersion(t, client, user.OrganizationID, &echo.Responses{
+			Parse: []*proto.Response{{
+				Type: &proto.Response_Parse{Parse: &proto.ParseComplete{
+					TemplateMetadata: &proto.TemplateMetadata{
+						DisplayName: "Docker",
+						Icon:        "/icon/docker.png",
+						Description: "Develop in a Docker container",
+						DocsUrl:     "https://example.com/docs",
+					},
+				}},
+			}},
+			ProvisionApply: echo.ApplyComplete,
+		}, template.ID)
+		_ = coderdtest.AwaitTemplateVersionJobCompleted(t, client, version.ID)
+
+		ctx := testutil.Context(t, testutil.WaitLong)
+
+		// The template isn't changed until the version is promoted.
+		got, err := client.Template(ctx, template.ID)
+		require.NoError(t, err)
+		require.Empty(t, got.DisplayName)
+		require.Empty(t, got.DocsURL)
+
+		auditor.ResetLogs()
+		err = client.UpdateActiveTemplateVersion(ctx, template.ID, codersdk.UpdateActiveTemplateVersion{
+			ID: version.ID,
+		})
+		require.NoError(t, err)
+
+		// The icon set by the template admin is kept.
+		got, err = client.Template(ctx, template.ID)
+		require.NoError(t, err)
+		require.Equal(t, "Docker", got.DisplayName)
+		require.Equal(t, "/icon/custom.png", got.Icon)
+		require.Equal(t, "Develop in a Docker container", got.Description)
+		require.Equal(t, "https://example.com/docs", got.DocsURL)
+		require.True(t, auditor.Contains(t, database.AuditLog{
+			Action:     database.AuditActionWrite,
+			ResourceID: template.ID,
+		}))
+	})
 }
 
 func TestTemplateVersionDryRun(t *testing.T) {
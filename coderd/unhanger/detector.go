@@ -16,13 +16,15 @@ import (
 	"github.com/coder/coder/v2/coderd/database"
 	"github.com/coder/coder/v2/coderd/database/dbauthz"
 	"github.com/coder/coder/v2/coderd/database/dbtime"
+	"github.com/coder/coder/v2/coderd/database/provisionerjobs"
 	"github.com/coder/coder/v2/coderd/database/pubsub"
 	"github.com/coder/coder/v2/provisionersdk"
 )
 
 const (
 	// HungJobDuration is the duration of time since the last update to a job
-	// before it is considered hung.
+	// before it is considered hung. Provisioner daemons stop jobs they
+	// couldn't update for as long, see runner.DefaultLeaseDuration.
 	HungJobDuration = 5 * time.Minute
 
 	// HungJobExitTimeout is the duration of time that provisioners should allow
@@ -36,6 +38,16 @@ const (
 	// MaxJobsPerRun is the maximum number of hung jobs that the detector will
 	// terminate in a single run.
 	MaxJobsPerRun = 10
+
+	// MaxCheckpointResumes is the number of times a hung workspace build is
+	// resumed from its checkpoint before it is terminated.
+	MaxCheckpointResumes = 3
+
+	// hungJobRequeueDuration is the duration of time since the last update
+	// to a job before it is requeued. The daemon running the job stops it
+	// once its lease expired after HungJobDuration, and may take up to
+	// HungJobExitTimeout to exit.
+	hungJobRequeueDuration = HungJobDuration + HungJobExitTimeout
 )
 
 // HungJobLogMessages are written to provisioner job logs when a job is hung and
@@ -48,6 +60,16 @@ var HungJobLogMessages = []string{
 	"",
 }
 
+// HungJobResumeLogMessages are written to provisioner job logs when a job is
+// hung and resumed from its checkpoint by another provisioner daemon.
+var HungJobResumeLogMessages = []string{
+	"",
+	"====================",
+	"Coder: Build has been detected as hung for 5 minutes and will be resumed from its last checkpoint.",
+	"====================",
+	"",
+}
+
 // acquireLockError is returned when the detector fails to acquire a lock and
 // cancels the current run.
 type acquireLockError struct{}
@@ -69,7 +91,9 @@ func (e jobInelligibleError) Error() string {
 }
 
 // Detector automatically detects hung provisioner jobs, sends messages into the
-// build log and terminates them as failed.
+// build log and terminates them as failed. Workspace builds with a checkpoint
+// are returned to the queue instead, so another provisioner daemon resumes
+// them.
 type Detector struct {
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -85,7 +109,7 @@ type Detector struct {
 // Stats contains statistics about the last run of the detector.
 type Stats struct {
 	// TerminatedJobIDs contains the IDs of all jobs that were detected as hung and
-	// terminated.
+	// terminated, or returned to the queue to be resumed from their checkpoint.
 	TerminatedJobIDs []uuid.UUID
 	// Error is the fatal error that occurred during the last run of the
 	// detector, if any. Error may be set to AcquireLockError if the detector
@@ -211,7 +235,12 @@ func (d *Detector) run(t time.Time) Stats {
 }
 
 func unhangJob(ctx context.Context, log slog.Logger, db database.Store, pub pubsub.Pubsub, jobID uuid.UUID) error {
-	var lowestLogID int64
+	var (
+		lowestLogID int64
+		// requeued is set if the job is returned to the queue to be resumed
+		// from its checkpoint.
+		requeued *database.ProvisionerJob
+	)
 
 	err := db.InTx(func(db database.Store) error {
 		locked, err := db.TryAcquireLock(ctx, database.GenLockID(fmt.Sprintf("hang-detector:%s", jobID)))
@@ -248,10 +277,28 @@ func unhangJob(ctx context.Context, log slog.Logger, db database.Store, pub pubs
 			}
 		}
 
-		log.Warn(
-			ctx, "detected hung provisioner job, forcefully terminating",
-			"threshold", HungJobDuration,
-		)
+		resume, err := shouldResume(ctx, db, job)
+		if err != nil {
+			return err
+		}
+		if resume && job.UpdatedAt.After(time.Now().Add(-hungJobRequeueDuration)) {
+			return jobInelligibleError{
+				Err: xerrors.New("job may still be running on the daemon whose lease expired"),
+			}
+		}
+		messages := HungJobLogMessages
+		if resume {
+			messages = HungJobResumeLogMessages
+			log.Warn(
+				ctx, "detected hung provisioner job, resuming from checkpoint",
+				"threshold", HungJobDuration,
+			)
+		} else {
+			log.Warn(
+				ctx, "detected hung provisioner job, forcefully terminating",
+				"threshold", HungJobDuration,
+			)
+		}
 
 		// First, get the latest logs from the build so we can make sure
 		// our messages are in the latest stage.
@@ -280,7 +327,7 @@ func unhangJob(ctx context.Context, log slog.Logger, db database.Store, pub pubs
 			Output:    nil,
 		}
 		now := dbtime.Now()
-		for i, msg := range HungJobLogMessages {
+		for i, msg := range messages {
 			// Set the created at in a way that ensures each message has
 			// a unique timestamp so they will be sorted correctly.
 			insertParams.CreatedAt = append(insertParams.CreatedAt, now.Add(time.Millisecond*time.Duration(i)))
@@ -295,6 +342,29 @@ func unhangJob(ctx context.Context, log slog.Logger, db database.Store, pub pubs
 		}
 		lowestLogID = newLogs[0].ID
 
+		if resume {
+			// The daemon that ran the job force stopped it once its lease
+			// expired, see hungJobRequeueDuration, so the requeued job is
+			// never run by two daemons at once.
+			now = dbtime.Now()
+			err = db.UpdateProvisionerJobWithRequeueByID(ctx, database.UpdateProvisionerJobWithRequeueByIDParams{
+				ID:        job.ID,
+				UpdatedAt: now,
+			})
+			if err != nil {
+				return xerrors.Errorf("requeue job: %w", err)
+			}
+			err = db.UpdateProvisionerJobCheckpointResumedByJobID(ctx, database.UpdateProvisionerJobCheckpointResumedByJobIDParams{
+				JobID:     job.ID,
+				UpdatedAt: now,
+			})
+			if err != nil {
+				return xerrors.Errorf("update job checkpoint: %w", err)
+			}
+			requeued = &job
+			return nil
+		}
+
 		// Mark the job as failed.
 		now = dbtime.Now()
 		err = db.UpdateProvisionerJobWithCompleteByID(ctx, database.UpdateProvisionerJobWithCompleteByIDParams{
@@ -359,7 +429,7 @@ func unhangJob(ctx context.Context, log slog.Logger, db database.Store, pub pubs
 	// inserted so the log stream will fetch everything after that point.
 	data, err := json.Marshal(provisionersdk.ProvisionerJobLogsNotifyMessage{
 		CreatedAfter: lowestLogID - 1,
-		EndOfLogs:    true,
+		EndOfLogs:    requeued == nil,
 	})
 	if err != nil {
 		return xerrors.Errorf("marshal log notification: %w", err)
@@ -369,5 +439,36 @@ func unhangJob(ctx context.Context, log slog.Logger, db database.Store, pub pubs
 		return xerrors.Errorf("publish log notification: %w", err)
 	}
 
+	if requeued != nil {
+		// Wake up provisioner daemons waiting for jobs, so the build is
+		// resumed right away.
+		err = provisionerjobs.PostJob(pub, *requeued)
+		if err != nil {
+			return xerrors.Errorf("post requeued job: %w", err)
+		}
+	}
+
 	return nil
 }
+
+// shouldResume returns whether a hung job is resumed from its checkpoint
+// instead of being terminated. Only builds that hung before their apply
+// started are resumed, since the state of a hung apply is never pushed back
+// and resuming against the state of the previous build would orphan the
+// resources it created.
+func shouldResume(ctx context.Context, db database.Store, job database.ProvisionerJob) (bool, error) {
+	if job.Type != database.ProvisionerJobTypeWorkspaceBuild {
+		return false, nil
+	}
+	checkpoint, err := db.GetProvisionerJobCheckpointByJobID(ctx, job.ID)
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, xerrors.Errorf("get provisioner job checkpoint: %w", err)
+	}
+	if checkpoint.Stage != string(provisionersdk.BuildStageInit) {
+		return false, nil
+	}
+	return checkpoint.ResumeCount < MaxCheckpointResumes, nil
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/coder/coder/v2/coderd/database/dbgen"
 	"github.com/coder/coder/v2/coderd/database/dbtestutil"
 	"github.com/coder/coder/v2/coderd/unhanger"
+	"github.com/coder/coder/v2/provisionerd/runner"
 	"github.com/coder/coder/v2/provisionersdk"
 	"github.com/coder/coder/v2/testutil"
 )
@@ -26,6 +27,15 @@ func TestMain(m *testing.M) {
 	goleak.VerifyTestMain(m)
 }
 
+func TestHungJobDurationExceedsLease(t *testing.T) {
+	t.Parallel()
+
+	// Daemons must not lose their lease before a job is detected as hung, and
+	// must stop jobs they can't update before they're requeued.
+	require.GreaterOrEqual(t, runner.DefaultLeaseDuration, unhanger.HungJobDuration)
+	require.Less(t, runner.DefaultLeaseDuration, unhanger.HungJobDuration+unhanger.HungJobExitTimeout)
+}
+
 func TestDetectorNoJobs(t *testing.T) {
 	t.Parallel()
 
@@ -434,6 +444,149 @@ func TestDetectorHungWorkspaceBuildNoOverrideStateIfNoExistingBuild(t *testing.T
 	detector.Wait()
 }
 
+func TestDetectorHungWorkspaceBuildResumeFromCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		// updatedAgo is how long ago the job was last updated.
+		updatedAgo time.Duration
+		stage      string
+		// terminated is set if the detector handles the job, requeued if it
+		// returns it to the queue instead of failing it.
+		terminated bool
+		requeued   bool
+	}{{
+		name:       "Init",
+		updatedAgo: 9 * time.Minute,
+		stage:      "init",
+		terminated: true,
+		requeued:   true,
+	}, {
+		// The daemon whose lease expired may still be exiting.
+		name:       "LeaseExiting",
+		updatedAgo: 6 * time.Minute,
+		stage:      "init",
+	}, {
+		// The apply may have changed resources, which aren't in the state
+		// of the previous build.
+		name:       "Plan",
+		updatedAgo: 9 * time.Minute,
+		stage:      "plan",
+		terminated: true,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				ctx        = testutil.Context(t, testutil.WaitLong)
+				db, pubsub = dbtestutil.NewDB(t)
+				log        = slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+				tickCh     = make(chan time.Time)
+				statsCh    = make(chan unhanger.Stats)
+			)
+
+			var (
+				now       = time.Now()
+				tenMinAgo = now.Add(-time.Minute * 10)
+				updatedAt = now.Add(-tc.updatedAgo)
+				org       = dbgen.Organization(t, db, database.Organization{})
+				user      = dbgen.User(t, db, database.User{})
+				file      = dbgen.File(t, db, database.File{})
+				template  = dbgen.Template(t, db, database.Template{
+					OrganizationID: org.ID,
+					CreatedBy:      user.ID,
+				})
+				templateVersion = dbgen.TemplateVersion(t, db, database.TemplateVersion{
+					OrganizationID: org.ID,
+					TemplateID: uuid.NullUUID{
+						UUID:  template.ID,
+						Valid: true,
+					},
+					CreatedBy: user.ID,
+				})
+				workspace = dbgen.Workspace(t, db, database.Workspace{
+					OwnerID:        user.ID,
+					OrganizationID: org.ID,
+					TemplateID:     template.ID,
+				})
+				currentWorkspaceBuildJob = dbgen.ProvisionerJob(t, db, pubsub, database.ProvisionerJob{
+					CreatedAt: tenMinAgo,
+					UpdatedAt: updatedAt,
+					// Acquiring the job sets its last update to when it started.
+					StartedAt: sql.NullTime{
+						Time:  updatedAt,
+						Valid: true,
+					},
+					OrganizationID: org.ID,
+					InitiatorID:    user.ID,
+					Provisioner:    database.ProvisionerTypeEcho,
+					StorageMethod:  database.ProvisionerStorageMethodFile,
+					FileID:         file.ID,
+					Type:           database.ProvisionerJobTypeWorkspaceBuild,
+					Input:          []byte("{}"),
+				})
+				_ = dbgen.WorkspaceBuild(t, db, database.WorkspaceBuild{
+					WorkspaceID:       workspace.ID,
+					TemplateVersionID: templateVersion.ID,
+					BuildNumber:       1,
+					JobID:             currentWorkspaceBuildJob.ID,
+				})
+			)
+
+			err := db.UpsertProvisionerJobCheckpoint(ctx, database.UpsertProvisionerJobCheckpointParams{
+				JobID:      currentWorkspaceBuildJob.ID,
+				Stage:      tc.stage,
+				Checkpoint: []byte{},
+				CreatedAt:  updatedAt,
+			})
+			require.NoError(t, err)
+
+			t.Log("current job ID: ", currentWorkspaceBuildJob.ID)
+
+			detector := unhanger.New(ctx, db, pubsub, log, tickCh).WithStatsChannel(statsCh)
+			detector.Start()
+			tickCh <- now
+
+			stats := <-statsCh
+			require.NoError(t, stats.Error)
+			if !tc.terminated {
+				require.Empty(t, stats.TerminatedJobIDs)
+			} else {
+				require.Len(t, stats.TerminatedJobIDs, 1)
+				require.Equal(t, currentWorkspaceBuildJob.ID, stats.TerminatedJobIDs[0])
+			}
+
+			job, err := db.GetProvisionerJobByID(ctx, currentWorkspaceBuildJob.ID)
+			require.NoError(t, err)
+			checkpoint, err := db.GetProvisionerJobCheckpointByJobID(ctx, currentWorkspaceBuildJob.ID)
+			require.NoError(t, err)
+			switch {
+			case tc.requeued:
+				// The job was returned to the queue instead of failed.
+				require.WithinDuration(t, now, job.UpdatedAt, 30*time.Second)
+				require.False(t, job.StartedAt.Valid)
+				require.False(t, job.WorkerID.Valid)
+				require.False(t, job.CompletedAt.Valid)
+				require.False(t, job.Error.Valid)
+				require.EqualValues(t, 1, checkpoint.ResumeCount)
+			case tc.terminated:
+				require.True(t, job.CompletedAt.Valid)
+				require.True(t, job.Error.Valid)
+				require.EqualValues(t, 0, checkpoint.ResumeCount)
+			default:
+				require.True(t, job.StartedAt.Valid)
+				require.False(t, job.CompletedAt.Valid)
+				require.EqualValues(t, 0, checkpoint.ResumeCount)
+			}
+
+			detector.Close()
+			detector.Wait()
+		})
+	}
+}
+
 func TestDetectorHungOtherJobTypes(t *testing.T) {
 	t.Parallel()
 
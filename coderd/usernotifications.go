@@ -0,0 +1,95 @@
+package coderd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/coderd/agentapi"
+	"github.com/coder/coder/v2/coderd/httpapi"
+	"github.com/coder/coder/v2/coderd/httpmw"
+	"github.com/coder/coder/v2/coderd/rbac"
+	"github.com/coder/coder/v2/codersdk"
+)
+
+// @Summary Watch notifications of user
+// @ID watch-notifications-of-user
+// @Security CoderSessionToken
+// @Produce text/event-stream
+// @Tags Users
+// @Param user path string true "User ID, name, or me"
+// @Success 200 {object} codersdk.UserNotification
+// @Router /users/{user}/notifications/watch [get]
+func (api *API) watchUserNotifications(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := httpmw.UserParam(r)
+
+	if !api.Authorize(r, rbac.ActionRead, rbac.ResourceUserData.WithOwner(user.ID.String()).WithID(user.ID)) {
+		httpapi.ResourceNotFound(rw)
+		return
+	}
+
+	sendEvent, senderClosed, err := httpapi.ServerSentEventSender(rw, r)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error setting up server-sent events.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	// Prevent handler from returning until the sender is closed.
+	defer func() {
+		<-senderClosed
+	}()
+
+	cancelSubscribe, err := api.Pubsub.Subscribe(agentapi.WatchUserNotificationsChannel(user.ID), func(_ context.Context, message []byte) {
+		var payload agentapi.UserNotificationChannelPayload
+		err := json.Unmarshal(message, &payload)
+		if err != nil {
+			api.Logger.Warn(ctx, "failed to unmarshal user notification", slog.F("user_id", user.ID), slog.Error(err))
+			return
+		}
+		_ = sendEvent(ctx, codersdk.ServerSentEvent{
+			Type: codersdk.ServerSentEventTypeData,
+			Data: convertUserNotification(payload),
+		})
+	})
+	if err != nil {
+		_ = sendEvent(ctx, codersdk.ServerSentEvent{
+			Type: codersdk.ServerSentEventTypeError,
+			Data: codersdk.Response{
+				Message: "Internal error subscribing to user notifications.",
+				Detail:  err.Error(),
+			},
+		})
+		return
+	}
+	defer cancelSubscribe()
+
+	// An initial ping signals to the request that the server is now ready
+	// and the client can begin servicing a channel with data.
+	_ = sendEvent(ctx, codersdk.ServerSentEvent{
+		Type: codersdk.ServerSentEventTypePing,
+	})
+
+	select {
+	case <-ctx.Done():
+	case <-senderClosed:
+	}
+}
+
+func convertUserNotification(payload agentapi.UserNotificationChannelPayload) codersdk.UserNotification {
+	return codersdk.UserNotification{
+		WorkspaceID:   payload.WorkspaceID,
+		WorkspaceName: payload.WorkspaceName,
+		AgentID:       payload.AgentID,
+		AgentName:     payload.AgentName,
+		Severity:      codersdk.UserNotificationSeverity(payload.Notification.Severity),
+		Kind:          payload.Notification.Kind,
+		Title:         payload.Notification.Title,
+		Message:       payload.Notification.Message,
+		CreatedAt:     payload.Notification.CreatedAt,
+		Labels:        payload.Notification.Labels,
+	}
+}
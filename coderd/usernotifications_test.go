@@ -0,0 +1,80 @@
+package coderd_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	agentproto "github.com/coder/coder/v2/agent/proto"
+	"github.com/coder/coder/v2/coderd/coderdtest"
+	"github.com/coder/coder/v2/coderd/database"
+	"github.com/coder/coder/v2/coderd/database/dbfake"
+	"github.com/coder/coder/v2/coderd/rbac"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestWatchUserNotifications(t *testing.T) {
+	t.Parallel()
+
+	t.Run("OK", func(t *testing.T) {
+		t.Parallel()
+		client, db := coderdtest.NewWithDatabase(t, nil)
+		user := coderdtest.CreateFirstUser(t, client)
+		r := dbfake.WorkspaceBuild(t, db, database.Workspace{
+			OrganizationID: user.OrganizationID,
+			OwnerID:        user.UserID,
+		}).WithAgent().Do()
+		ctx := testutil.Context(t, testutil.WaitLong)
+
+		notifications, err := client.WatchUserNotifications(ctx, codersdk.Me)
+		require.NoError(t, err)
+
+		agentClient := agentsdk.New(client.URL)
+		agentClient.SetSessionToken(r.AgentToken)
+		rpc, err := agentClient.ConnectRPC(ctx)
+		require.NoError(t, err)
+		defer rpc.Close()
+		postNotification := agentsdk.NotificationPoster(agentproto.NewDRPCAgentClient(rpc))
+		err = postNotification(ctx, agentsdk.Notification{
+			Severity: agentsdk.NotificationSeverityWarning,
+			Kind:     agentsdk.NotificationKindLowDisk,
+			Title:    "Disk almost full",
+			Message:  "/home/coder is 95% full.",
+			Labels:   map[string]string{"path": "/home/coder"},
+		})
+		require.NoError(t, err)
+
+		var notification codersdk.UserNotification
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for notification")
+		case notification = <-notifications:
+		}
+		require.Equal(t, r.Workspace.ID, notification.WorkspaceID)
+		require.Equal(t, r.Workspace.Name, notification.WorkspaceName)
+		require.NotZero(t, notification.AgentID)
+		require.Equal(t, codersdk.UserNotificationSeverityWarning, notification.Severity)
+		require.Equal(t, agentsdk.NotificationKindLowDisk, notification.Kind)
+		require.Equal(t, "Disk almost full", notification.Title)
+		require.Equal(t, "/home/coder is 95% full.", notification.Message)
+		require.Equal(t, map[string]string{"path": "/home/coder"}, notification.Labels)
+		require.False(t, notification.CreatedAt.IsZero())
+	})
+
+	t.Run("OtherUser", func(t *testing.T) {
+		t.Parallel()
+		client := coderdtest.New(t, nil)
+		owner := coderdtest.CreateFirstUser(t, client)
+		// Template admins can read users, but not their data.
+		memberClient, _ := coderdtest.CreateAnotherUser(t, client, owner.OrganizationID, rbac.RoleTemplateAdmin())
+		ctx := testutil.Context(t, testutil.WaitLong)
+
+		_, err := memberClient.WatchUserNotifications(ctx, owner.UserID.String())
+		var apiErr *codersdk.Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusNotFound, apiErr.StatusCode())
+	})
+}
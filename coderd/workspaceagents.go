@@ -14,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/sqlc-dev/pqtype"
 	"golang.org/x/exp/maps"
@@ -123,7 +124,7 @@ func (api *API) workspaceAgent(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	apiAgent, err := db2sdk.WorkspaceAgent(
-		api.DERPMap(), *api.TailnetCoordinator.Load(), workspaceAgent, db2sdk.Apps(dbApps, workspaceAgent, owner.Username, workspace), convertScripts(scripts), convertLogSources(logSources), api.AgentInactiveDisconnectTimeout,
+		api.DERPMap(), *api.TailnetCoordinator.Load(), workspaceAgent, db2sdk.Apps(dbApps, workspaceAgent, owner.Username, workspace), convertScripts(scripts, logSources), convertLogSources(logSources), api.AgentInactiveDisconnectTimeout,
 		api.DeploymentValues.AgentFallbackTroubleshootingURL.String(),
 	)
 	if err != nil {
@@ -151,11 +152,20 @@ func (api *API) workspaceAgentManifest(rw http.ResponseWriter, r *http.Request)
 	// As this API becomes deprecated, use the new protobuf API and convert the
 	// types back to the SDK types.
 	manifestAPI := &agentapi.ManifestAPI{
-		AccessURL:                api.AccessURL,
-		AppHostname:              api.AppHostname,
-		ExternalAuthConfigs:      api.ExternalAuthConfigs,
-		DisableDirectConnections: api.DeploymentValues.DERP.Config.BlockDirect.Value(),
-		DerpForceWebSockets:      api.DeploymentValues.DERP.Config.ForceWebSockets.Value(),
+		AccessURL:                      api.AccessURL,
+		AppHostname:                    api.AppHostname,
+		ExternalAuthConfigs:            api.ExternalAuthConfigs,
+		DisableDirectConnections:       api.DeploymentValues.DERP.Config.BlockDirect.Value(),
+		DerpForceWebSockets:            api.DeploymentValues.DERP.Config.ForceWebSockets.Value(),
+		ExecPolicy:                     agentExecPolicy(api.DeploymentValues),
+		ReconnectingPTYPersistence:     api.DeploymentValues.AgentReconnectingPTYPersistence.Value(),
+		ReconnectingPTYScrollbackLines: int(api.DeploymentValues.AgentReconnectingPTYScrollbackLines.Value()),
+		Proxy:                          agentProxyConfig(api.DeploymentValues),
+		MOTDTemplate:                   api.DeploymentValues.AgentMOTDTemplate.Value(),
+		CodeServer:                     agentCodeServerConfig(api.DeploymentValues),
+		SSHKeepAlive:                   agentSSHKeepAliveConfig(api.DeploymentValues),
+		UpdatePolicy:                   agentUpdatePolicy(api.DeploymentValues),
+		AgentBinarySHA256:              api.agentBinarySHA256,
 
 		AgentFn: func(_ context.Context) (database.WorkspaceAgent, error) { return workspaceAgent, nil },
 		WorkspaceIDFn: func(ctx context.Context, wa *database.WorkspaceAgent) (uuid.UUID, error) {
@@ -167,8 +177,9 @@ func (api *API) workspaceAgentManifest(rw http.ResponseWriter, r *http.Request)
 			}
 			return ws.Workspace.ID, nil
 		},
-		Database:  api.Database,
-		DerpMapFn: api.DERPMap,
+		Database:         api.Database,
+		DerpMapFn:        api.DERPMap,
+		DerpMapFallbacks: api.Options.DERPMapFallbacks,
 	}
 	manifest, err := manifestAPI.GetManifest(ctx, &agentproto.GetManifestRequest{})
 	if err != nil {
@@ -192,6 +203,292 @@ func (api *API) workspaceAgentManifest(rw http.ResponseWriter, r *http.Request)
 
 const AgentAPIVersionREST = "1.0"
 
+// @Summary Post workspace agent log source
+// @ID post-workspace-agent-log-source
+// @Security CoderSessionToken
+// @Accept json
+// @Produce json
+// @Tags Agents
+// @Param request body agentsdk.PostLogSource true "Log source request"
+// @Success 201 {object} codersdk.WorkspaceAgentLogSource
+// @Router /workspaceagents/me/log-source [post]
+func (api *API) workspaceAgentPostLogSource(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceAgent := httpmw.WorkspaceAgent(r)
+
+	var req agentsdk.PostLogSource
+	if !httpapi.Read(ctx, rw, r, &req) {
+		return
+	}
+	if req.ID == uuid.Nil || req.DisplayName == "" {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: "Log sources require an ID and a display name.",
+		})
+		return
+	}
+
+	// As this API becomes deprecated, use the new protobuf API and convert the
+	// types back to the SDK types.
+	logsAPI := &agentapi.LogsAPI{
+		AgentFn:  func(_ context.Context) (database.WorkspaceAgent, error) { return workspaceAgent, nil },
+		Database: api.Database,
+		Log:      api.Logger,
+		PublishWorkspaceUpdateFn: func(ctx context.Context, wa *database.WorkspaceAgent) error {
+			ws, err := api.Database.GetWorkspaceByAgentID(ctx, wa.ID)
+			if err != nil {
+				return err
+			}
+			api.publishWorkspaceUpdate(ctx, ws.Workspace.ID)
+			return nil
+		},
+	}
+	protoSource, err := logsAPI.CreateLogSource(ctx, agentsdk.ProtoFromLogSourceRequest(req))
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error creating log source.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	source, err := agentsdk.LogSourceFromProto(protoSource)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error converting log source.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	httpapi.Write(ctx, rw, http.StatusCreated, source)
+}
+
+// maxAgentConnectionFailures is the largest number of connection failures
+// accepted in a single report. Agents keep at most 20.
+const maxAgentConnectionFailures = 50
+
+// @Summary Submit workspace agent connection failures
+// @ID submit-workspace-agent-connection-failures
+// @Security CoderSessionToken
+// @Accept json
+// @Tags Agents
+// @Param request body agentsdk.PostConnectionFailuresRequest true "Connection failures"
+// @Success 204
+// @Router /workspaceagents/me/connection-failures [post]
+// @x-apidocgen {"skip": true}
+func (api *API) workspaceAgentPostConnectionFailures(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceAgent := httpmw.WorkspaceAgent(r)
+
+	var req agentsdk.PostConnectionFailuresRequest
+	if !httpapi.Read(ctx, rw, r, &req) {
+		return
+	}
+	if len(req.Failures) > maxAgentConnectionFailures {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: fmt.Sprintf("At most %d connection failures can be reported at once.", maxAgentConnectionFailures),
+		})
+		return
+	}
+	for _, failure := range req.Failures {
+		switch failure.Stage {
+		case agentsdk.ConnectionFailureStageCoderd, agentsdk.ConnectionFailureStageDERP:
+		default:
+			httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+				Message: fmt.Sprintf("Invalid connection failure stage %q.", failure.Stage),
+			})
+			return
+		}
+	}
+
+	// Failures are logged for admins debugging agents that never connected,
+	// they're reported once the agent is connected again.
+	for _, failure := range req.Failures {
+		api.Logger.Warn(ctx, "workspace agent connection failure",
+			slog.F("agent_id", workspaceAgent.ID),
+			slog.F("agent_name", workspaceAgent.Name),
+			slog.F("stage", failure.Stage),
+			slog.F("url", failure.URL),
+			slog.F("error", failure.Error),
+			slog.F("count", failure.Count),
+			slog.F("first_seen_at", failure.FirstSeenAt),
+			slog.F("last_seen_at", failure.LastSeenAt),
+			slog.F("dns_host", failure.DNS.Host),
+			slog.F("dns_addresses", failure.DNS.Addresses),
+			slog.F("dns_error", failure.DNS.Error),
+			slog.F("tls_error_class", failure.TLSErrorClass),
+			slog.F("tls_error", failure.TLSError),
+			slog.F("proxy_env", failure.ProxyEnv),
+			slog.F("captive_portal", failure.CaptivePortal),
+		)
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// maxScriptArtifactsSize is the size of the largest archive of script
+// artifacts accepted from a workspace agent. It leaves room for the
+// encryption of archives of the size agents are limited to.
+const maxScriptArtifactsSize = 10<<20 + 1<<10
+
+// @Summary Get workspace agent script artifacts upload offset
+// @ID get-workspace-agent-script-artifacts-upload-offset
+// @Security CoderSessionToken
+// @Tags Agents
+// @Param logsource path string true "Log source ID" format(uuid)
+// @Success 200
+// @Router /workspaceagents/me/script-artifacts/{logsource} [head]
+// @x-apidocgen {"skip": true}
+func (api *API) headWorkspaceAgentScriptArtifacts(rw http.ResponseWriter, r *http.Request) {
+	api.uploadWorkspaceAgentScriptArtifacts(rw, r)
+}
+
+// @Summary Upload workspace agent script artifacts chunk
+// @ID upload-workspace-agent-script-artifacts-chunk
+// @Security CoderSessionToken
+// @Tags Agents
+// @Param logsource path string true "Log source ID" format(uuid)
+// @Success 201
+// @Router /workspaceagents/me/script-artifacts/{logsource} [patch]
+// @x-apidocgen {"skip": true}
+func (api *API) patchWorkspaceAgentScriptArtifacts(rw http.ResponseWriter, r *http.Request) {
+	api.uploadWorkspaceAgentScriptArtifacts(rw, r)
+}
+
+// @Summary Upload workspace agent script artifacts
+// @ID upload-workspace-agent-script-artifacts
+// @Security CoderSessionToken
+// @Tags Agents
+// @Param logsource path string true "Log source ID" format(uuid)
+// @Success 201
+// @Router /workspaceagents/me/script-artifacts/{logsource} [post]
+// @x-apidocgen {"skip": true}
+func (api *API) postWorkspaceAgentScriptArtifacts(rw http.ResponseWriter, r *http.Request) {
+	api.uploadWorkspaceAgentScriptArtifacts(rw, r)
+}
+
+func (api *API) uploadWorkspaceAgentScriptArtifacts(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceAgent := httpmw.WorkspaceAgent(r)
+
+	logSourceID, err := uuid.Parse(chi.URLParam(r, "logsource"))
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: "Invalid log source ID.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	//nolint:gocritic // The agent was authenticated, it can read its own log sources.
+	logSources, err := api.Database.GetWorkspaceAgentLogSourcesByAgentIDs(dbauthz.AsSystemRestricted(ctx), []uuid.UUID{workspaceAgent.ID})
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching log sources.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	if !slices.ContainsFunc(logSources, func(source database.WorkspaceAgentLogSource) bool {
+		return source.ID == logSourceID
+	}) {
+		httpapi.Write(ctx, rw, http.StatusNotFound, codersdk.Response{
+			Message: fmt.Sprintf("Log source %s not found.", logSourceID),
+		})
+		return
+	}
+
+	api.handleAgentUpload(rw, r, workspaceAgent.ID, agentUpload{
+		Name:    "script-artifacts/" + logSourceID.String(),
+		MaxSize: maxScriptArtifactsSize,
+		Complete: func(ctx context.Context, data []byte) error {
+			return api.Database.InsertWorkspaceAgentScriptArtifact(ctx, database.InsertWorkspaceAgentScriptArtifactParams{
+				ID:               uuid.New(),
+				WorkspaceAgentID: workspaceAgent.ID,
+				LogSourceID:      logSourceID,
+				Archive:          data,
+				CreatedAt:        dbtime.Now(),
+			})
+		},
+	})
+}
+
+// @Summary Get script artifacts by workspace agent
+// @ID get-script-artifacts-by-workspace-agent
+// @Security CoderSessionToken
+// @Produce json
+// @Tags Agents
+// @Param workspaceagent path string true "Workspace agent ID" format(uuid)
+// @Success 200 {array} codersdk.WorkspaceAgentScriptArtifact
+// @Router /workspaceagents/{workspaceagent}/script-artifacts [get]
+func (api *API) workspaceAgentScriptArtifacts(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceAgent := httpmw.WorkspaceAgentParam(r)
+
+	artifacts, err := api.Database.GetWorkspaceAgentScriptArtifactsByAgentID(ctx, workspaceAgent.ID)
+	if httpapi.Is404Error(err) {
+		httpapi.ResourceNotFound(rw)
+		return
+	}
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching script artifacts.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	apiArtifacts := make([]codersdk.WorkspaceAgentScriptArtifact, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		apiArtifacts = append(apiArtifacts, codersdk.WorkspaceAgentScriptArtifact{
+			ID:          artifact.ID,
+			LogSourceID: artifact.LogSourceID,
+			Size:        artifact.Size,
+			CreatedAt:   artifact.CreatedAt,
+		})
+	}
+	httpapi.Write(ctx, rw, http.StatusOK, apiArtifacts)
+}
+
+// @Summary Download script artifact by workspace agent
+// @ID download-script-artifact-by-workspace-agent
+// @Security CoderSessionToken
+// @Tags Agents
+// @Param workspaceagent path string true "Workspace agent ID" format(uuid)
+// @Param artifact path string true "Artifact ID" format(uuid)
+// @Success 200
+// @Router /workspaceagents/{workspaceagent}/script-artifacts/{artifact} [get]
+func (api *API) workspaceAgentScriptArtifact(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceAgent := httpmw.WorkspaceAgentParam(r)
+
+	artifactID, err := uuid.Parse(chi.URLParam(r, "artifact"))
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: "Invalid artifact ID.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	artifact, err := api.Database.GetWorkspaceAgentScriptArtifactByID(ctx, artifactID)
+	// Artifacts of other agents are reported as missing, like artifacts that
+	// were deleted.
+	if httpapi.Is404Error(err) || (err == nil && artifact.WorkspaceAgentID != workspaceAgent.ID) {
+		httpapi.ResourceNotFound(rw)
+		return
+	}
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching script artifact.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	rw.Header().Set("Content-Type", codersdk.ContentTypeTar)
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.tar", workspaceAgent.Name, artifact.ID)))
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(artifact.Archive)
+}
+
 // @Summary Submit workspace agent startup
 // @ID submit-workspace-agent-startup
 // @Security CoderSessionToken
@@ -327,10 +624,35 @@ func (api *API) patchWorkspaceAgentLogs(rw http.ResponseWriter, r *http.Request)
 	}
 	output := make([]string, 0)
 	level := make([]database.LogLevel, 0)
+	fields := make([]string, 0)
+	stream := make([]string, 0)
 	outputLength := 0
 	for _, logEntry := range req.Logs {
 		output = append(output, logEntry.Output)
 		outputLength += len(logEntry.Output)
+		logFields := "{}"
+		if len(logEntry.Fields) > 0 {
+			data, err := json.Marshal(logEntry.Fields)
+			if err != nil {
+				httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+					Message: "Failed to encode log fields.",
+					Detail:  err.Error(),
+				})
+				return
+			}
+			logFields = string(data)
+		}
+		fields = append(fields, logFields)
+		switch logEntry.Stream {
+		case "", codersdk.LogStreamStdout, codersdk.LogStreamStderr:
+		default:
+			httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+				Message: "Invalid log stream provided.",
+				Detail:  fmt.Sprintf("invalid log stream: %q", logEntry.Stream),
+			})
+			return
+		}
+		stream = append(stream, string(logEntry.Stream))
 		if logEntry.Level == "" {
 			// Default to "info" to support older agents that didn't have the level field.
 			logEntry.Level = codersdk.LogLevelInfo
@@ -353,6 +675,8 @@ func (api *API) patchWorkspaceAgentLogs(rw http.ResponseWriter, r *http.Request)
 		Level:        level,
 		LogSourceID:  req.LogSourceID,
 		OutputLength: int32(outputLength),
+		Fields:       fields,
+		Stream:       stream,
 	})
 	if err != nil {
 		if !database.IsWorkspaceAgentLogsLimitError(err) {
@@ -453,6 +777,9 @@ func (api *API) patchWorkspaceAgentLogs(rw http.ResponseWriter, r *http.Request)
 // @Param after query int false "After log id"
 // @Param follow query bool false "Follow log stream"
 // @Param no_compression query bool false "Disable compression for WebSocket connection"
+// @Param limit query int false "Maximum number of logs, all if 0"
+// @Param level query string false "Comma-separated log levels to filter by"
+// @Param log_source_ids query string false "Comma-separated log source IDs to filter by"
 // @Success 200 {array} codersdk.WorkspaceAgentLog
 // @Router /workspaceagents/{workspaceagent}/logs [get]
 func (api *API) workspaceAgentLogs(rw http.ResponseWriter, r *http.Request) {
@@ -482,9 +809,39 @@ func (api *API) workspaceAgentLogs(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	p := httpapi.NewQueryParamParser()
+	vals := r.URL.Query()
+	limit := p.Int(vals, 0, "limit")
+	levels := httpapi.ParseCustomList(p, vals, []database.LogLevel{}, "level", func(v string) (database.LogLevel, error) {
+		level := database.LogLevel(v)
+		if !level.Valid() {
+			return "", xerrors.Errorf("invalid log level %q", v)
+		}
+		return level, nil
+	})
+	logSourceIDs := p.UUIDs(vals, []uuid.UUID{}, "log_source_ids")
+	if limit < 0 {
+		p.Errors = append(p.Errors, codersdk.ValidationError{
+			Field:  "limit",
+			Detail: "Must be an integer greater than or equal to zero",
+		})
+	}
+	if len(p.Errors) > 0 {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message:     "Query parameters have invalid values.",
+			Validations: p.Errors,
+		})
+		return
+	}
+
+	// The limit only applies to the initial fetch, followed logs are sent as
+	// they come in.
 	logs, err := api.Database.GetWorkspaceAgentLogsAfter(ctx, database.GetWorkspaceAgentLogsAfterParams{
 		AgentID:      workspaceAgent.ID,
 		CreatedAfter: after,
+		Levels:       levels,
+		LogSourceIDs: logSourceIDs,
+		LimitOpt:     int32(limit),
 	})
 	if errors.Is(err, sql.ErrNoRows) {
 		err = nil
@@ -658,6 +1015,8 @@ func (api *API) workspaceAgentLogs(rw http.ResponseWriter, r *http.Request) {
 			logs, err := api.Database.GetWorkspaceAgentLogsAfter(ctx, database.GetWorkspaceAgentLogsAfterParams{
 				AgentID:      workspaceAgent.ID,
 				CreatedAfter: lastSentLogID,
+				Levels:       levels,
+				LogSourceIDs: logSourceIDs,
 			})
 			if err != nil {
 				if xerrors.Is(err, context.Canceled) {
@@ -1109,18 +1468,29 @@ func convertLogSources(dbLogSources []database.WorkspaceAgentLogSource) []coders
 	return logSources
 }
 
-func convertScripts(dbScripts []database.WorkspaceAgentScript) []codersdk.WorkspaceAgentScript {
+func convertScripts(dbScripts []database.WorkspaceAgentScript, dbLogSources []database.WorkspaceAgentLogSource) []codersdk.WorkspaceAgentScript {
+	displayNames := make(map[uuid.UUID]string, len(dbLogSources))
+	for _, dbLogSource := range dbLogSources {
+		displayNames[dbLogSource.ID] = dbLogSource.DisplayName
+	}
 	scripts := make([]codersdk.WorkspaceAgentScript, 0)
 	for _, dbScript := range dbScripts {
 		scripts = append(scripts, codersdk.WorkspaceAgentScript{
-			LogPath:          dbScript.LogPath,
-			LogSourceID:      dbScript.LogSourceID,
-			Script:           dbScript.Script,
-			Cron:             dbScript.Cron,
-			RunOnStart:       dbScript.RunOnStart,
-			RunOnStop:        dbScript.RunOnStop,
-			StartBlocksLogin: dbScript.StartBlocksLogin,
-			Timeout:          time.Duration(dbScript.TimeoutSeconds) * time.Second,
+			LogPath:               dbScript.LogPath,
+			LogSourceID:           dbScript.LogSourceID,
+			Script:                dbScript.Script,
+			Cron:                  dbScript.Cron,
+			RunOnStart:            dbScript.RunOnStart,
+			RunOnStop:             dbScript.RunOnStop,
+			StartBlocksLogin:      dbScript.StartBlocksLogin,
+			Timeout:               time.Duration(dbScript.TimeoutSeconds) * time.Second,
+			RunOnBuildSuccess:     dbScript.RunOnBuildSuccess,
+			RunOnBuildFailure:     dbScript.RunOnBuildFailure,
+			RunOnPostStart:        dbScript.RunOnPostStart,
+			Login:                 dbScript.Login,
+			DiskPressurePath:      dbScript.DiskPressurePath,
+			DiskPressureThreshold: dbScript.DiskPressureThreshold,
+			DisplayName:           displayNames[dbScript.LogSourceID],
 		})
 	}
 	return scripts
@@ -1613,6 +1983,7 @@ func convertWorkspaceAgentMetadata(db []database.WorkspaceAgentMetadatum) []code
 				Script:      datum.Script,
 				Interval:    datum.Interval,
 				Timeout:     datum.Timeout,
+				Collector:   codersdk.WorkspaceAgentMetadataCollector(datum.Collector),
 			},
 		}
 	}
@@ -1733,7 +2104,10 @@ func (api *API) postWorkspaceAppHealth(rw http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var newApps []database.WorkspaceApp
+	var (
+		newApps       []database.WorkspaceApp
+		healthChanged bool
+	)
 	for id, newHealth := range req.Healths {
 		old := func() *database.WorkspaceApp {
 			for _, app := range apps {
@@ -1772,10 +2146,23 @@ func (api *API) postWorkspaceAppHealth(rw http.ResponseWriter, r *http.Request)
 			return
 		}
 
+		// only save healthchecks newer than the stored one, the agent
+		// resends them on a heartbeat
+		reportChanged := false
+		if report, ok := req.Reports[id]; ok && !report.CheckedAt.IsZero() {
+			reportChanged = !old.HealthCheckedAt.Valid || !old.HealthCheckedAt.Time.Equal(report.CheckedAt)
+			old.HealthLatencyMs = report.LatencyMilliseconds
+			old.HealthError = report.Error
+			old.HealthCheckedAt = sql.NullTime{Time: report.CheckedAt, Valid: true}
+		}
+
 		// don't save if the value hasn't changed
-		if old.Health == database.WorkspaceAppHealth(newHealth) {
+		if old.Health == database.WorkspaceAppHealth(newHealth) && !reportChanged {
 			continue
 		}
+		if old.Health != database.WorkspaceAppHealth(newHealth) {
+			healthChanged = true
+		}
 		old.Health = database.WorkspaceAppHealth(newHealth)
 
 		newApps = append(newApps, *old)
@@ -1783,8 +2170,11 @@ func (api *API) postWorkspaceAppHealth(rw http.ResponseWriter, r *http.Request)
 
 	for _, app := range newApps {
 		err = api.Database.UpdateWorkspaceAppHealthByID(ctx, database.UpdateWorkspaceAppHealthByIDParams{
-			ID:     app.ID,
-			Health: app.Health,
+			ID:              app.ID,
+			Health:          app.Health,
+			HealthLatencyMs: app.HealthLatencyMs,
+			HealthError:     app.HealthError,
+			HealthCheckedAt: app.HealthCheckedAt,
 		})
 		if err != nil {
 			httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
@@ -1794,6 +2184,12 @@ func (api *API) postWorkspaceAppHealth(rw http.ResponseWriter, r *http.Request)
 			return
 		}
 	}
+	if !healthChanged {
+		// Healthcheck results alone aren't published to the watchers of the
+		// workspace, they're served with the next update.
+		httpapi.Write(ctx, rw, http.StatusOK, nil)
+		return
+	}
 
 	resource, err := api.Database.GetWorkspaceResourceByID(ctx, workspaceAgent.ResourceID)
 	if err != nil {
@@ -2122,6 +2518,8 @@ func convertWorkspaceAgentLog(logEntry database.WorkspaceAgentLog) codersdk.Work
 		Output:    logEntry.Output,
 		Level:     codersdk.LogLevel(logEntry.Level),
 		SourceID:  logEntry.LogSourceID,
+		Fields:    logEntry.Fields,
+		Stream:    codersdk.LogStream(logEntry.Stream),
 	}
 }
 
@@ -2145,3 +2543,91 @@ func convertWorkspaceAgentSubsystems(ss []codersdk.AgentSubsystem) []database.Wo
 	})
 	return out
 }
+
+// agentExecPolicy converts the exec policy of the deployment to the rules
+// sent to agents in their manifest.
+func agentExecPolicy(vals *codersdk.DeploymentValues) []agentsdk.ExecPolicyRule {
+	if len(vals.AgentExecPolicy.Value) == 0 {
+		return nil
+	}
+	rules := make([]agentsdk.ExecPolicyRule, 0, len(vals.AgentExecPolicy.Value))
+	for _, rule := range vals.AgentExecPolicy.Value {
+		rules = append(rules, agentsdk.ExecPolicyRule{
+			Action: agentsdk.ExecPolicyAction(rule.Action),
+			Prefix: rule.Prefix,
+			Regex:  rule.Regex,
+		})
+	}
+	return rules
+}
+
+// agentProxyConfig returns the proxy configuration of the deployment sent to
+// agents in their manifest, nil if no proxy is configured.
+func agentProxyConfig(vals *codersdk.DeploymentValues) *agentsdk.ProxyConfig {
+	proxy := agentsdk.ProxyConfig{
+		HTTPProxy:  vals.AgentHTTPProxy.Value(),
+		HTTPSProxy: vals.AgentHTTPSProxy.Value(),
+		NoProxy:    vals.AgentNoProxy.Value(),
+	}
+	if proxy == (agentsdk.ProxyConfig{}) {
+		return nil
+	}
+	return &proxy
+}
+
+// agentCodeServerConfig returns the code-server configuration of the
+// deployment sent to the agents of templates enabling code-server, nil if
+// no version is configured. Checksums are configured as "<platform>=<sha256>",
+// malformed entries are ignored so agents refuse to install the release.
+func agentCodeServerConfig(vals *codersdk.DeploymentValues) *agentsdk.CodeServerConfig {
+	if vals.AgentCodeServerVersion.Value() == "" {
+		return nil
+	}
+	checksums := make(map[string]string)
+	for _, entry := range vals.AgentCodeServerChecksums.Value() {
+		platform, checksum, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		checksums[strings.TrimSpace(platform)] = strings.TrimSpace(checksum)
+	}
+	return &agentsdk.CodeServerConfig{
+		Version:    vals.AgentCodeServerVersion.Value(),
+		Port:       int(vals.AgentCodeServerPort.Value()),
+		Extensions: vals.AgentCodeServerExtensions.Value(),
+		Checksums:  checksums,
+	}
+}
+
+// agentSSHKeepAliveConfig returns the SSH keepalive configuration of the
+// deployment sent to agents in their manifest, nil if keepalives are
+// disabled.
+func agentSSHKeepAliveConfig(vals *codersdk.DeploymentValues) *agentsdk.SSHKeepAliveConfig {
+	interval := int(vals.AgentSSHKeepAliveInterval.Value().Seconds())
+	if interval <= 0 {
+		return nil
+	}
+	return &agentsdk.SSHKeepAliveConfig{
+		IntervalSeconds: interval,
+		CountMax:        int(vals.AgentSSHKeepAliveCountMax.Value()),
+	}
+}
+
+// agentBinarySHA256 returns the checksum of the agent binary for the platform
+// served by the deployment, which agents verify their updates with.
+func (api *API) agentBinarySHA256(goos, goarch string) (string, error) {
+	return api.SiteHandler.BinarySHA256(agentsdk.AgentBinaryName(goos, goarch))
+}
+
+// agentUpdatePolicy returns the update policy of the deployment sent to
+// agents in their manifest, nil if updates are disabled.
+func agentUpdatePolicy(vals *codersdk.DeploymentValues) *agentsdk.AgentUpdatePolicy {
+	if vals.AgentUpdateChannel.Value() == "" {
+		return nil
+	}
+	return &agentsdk.AgentUpdatePolicy{
+		Channel:      vals.AgentUpdateChannel.Value(),
+		VersionRange: vals.AgentUpdateVersionRange.Value(),
+		BinaryURL:    vals.AgentUpdateBinaryURL.Value(),
+	}
+}
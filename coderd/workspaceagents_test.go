@@ -1,6 +1,7 @@
 package coderd_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -17,6 +18,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"tailscale.com/tailcfg"
 
 	"cdr.dev/slog"
@@ -216,6 +218,7 @@ func TestWorkspaceAgentLogs(t *testing.T) {
 				{
 					CreatedAt: dbtime.Now(),
 					Output:    "testing2",
+					Stream:    codersdk.LogStreamStderr,
 				},
 			},
 		})
@@ -236,6 +239,59 @@ func TestWorkspaceAgentLogs(t *testing.T) {
 		require.Len(t, logChunk, 2) // No EOF.
 		require.Equal(t, "testing", logChunk[0].Output)
 		require.Equal(t, "testing2", logChunk[1].Output)
+		require.Empty(t, logChunk[0].Stream)
+		require.Equal(t, codersdk.LogStreamStderr, logChunk[1].Stream)
+	})
+	t.Run("Filter", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitMedium)
+		client, db := coderdtest.NewWithDatabase(t, nil)
+		user := coderdtest.CreateFirstUser(t, client)
+		r := dbfake.WorkspaceBuild(t, db, database.Workspace{
+			OrganizationID: user.OrganizationID,
+			OwnerID:        user.UserID,
+		}).WithAgent().Do()
+
+		agentClient := agentsdk.New(client.URL)
+		agentClient.SetSessionToken(r.AgentToken)
+		err := agentClient.PatchLogs(ctx, agentsdk.PatchLogs{
+			Logs: []agentsdk.Log{
+				{CreatedAt: dbtime.Now(), Output: "first", Level: codersdk.LogLevelInfo},
+				{CreatedAt: dbtime.Now(), Output: "second", Level: codersdk.LogLevelError},
+				{CreatedAt: dbtime.Now(), Output: "third", Level: codersdk.LogLevelInfo},
+				{CreatedAt: dbtime.Now(), Output: "fourth", Level: codersdk.LogLevelError},
+			},
+		})
+		require.NoError(t, err)
+		workspace, err := client.Workspace(ctx, r.Workspace.ID)
+		require.NoError(t, err)
+		agentID := workspace.LatestBuild.Resources[0].Agents[0].ID
+
+		logs, err := client.WorkspaceAgentLogs(ctx, agentID, codersdk.WorkspaceAgentLogsRequest{
+			Levels: []codersdk.LogLevel{codersdk.LogLevelError},
+		})
+		require.NoError(t, err)
+		require.Len(t, logs, 2)
+		require.Equal(t, "second", logs[0].Output)
+		require.Equal(t, "fourth", logs[1].Output)
+
+		var outputs []string
+		_, err = client.WorkspaceAgentLogsPages(ctx, agentID, codersdk.WorkspaceAgentLogsRequest{Limit: 3}, func(logs []codersdk.WorkspaceAgentLog) error {
+			require.LessOrEqual(t, len(logs), 3)
+			for _, log := range logs {
+				outputs = append(outputs, log.Output)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"first", "second", "third", "fourth"}, outputs)
+
+		_, err = client.WorkspaceAgentLogs(ctx, agentID, codersdk.WorkspaceAgentLogsRequest{
+			Levels: []codersdk.LogLevel{"verbose"},
+		})
+		var apiError *codersdk.Error
+		require.ErrorAs(t, err, &apiError)
+		require.Equal(t, http.StatusBadRequest, apiError.StatusCode())
 	})
 	t.Run("Close logs on outdated build", func(t *testing.T) {
 		t.Parallel()
@@ -319,6 +375,135 @@ func TestWorkspaceAgentLogs(t *testing.T) {
 	})
 }
 
+func TestWorkspaceAgentScriptArtifacts(t *testing.T) {
+	t.Parallel()
+	t.Run("Success", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitMedium)
+		client, db := coderdtest.NewWithDatabase(t, nil)
+		user := coderdtest.CreateFirstUser(t, client)
+		r := dbfake.WorkspaceBuild(t, db, database.Workspace{
+			OrganizationID: user.OrganizationID,
+			OwnerID:        user.UserID,
+		}).WithAgent().Do()
+
+		agentClient := agentsdk.New(client.URL)
+		agentClient.SetSessionToken(r.AgentToken)
+		logSource, err := agentClient.PostLogSource(ctx, agentsdk.PostLogSource{
+			ID:          uuid.New(),
+			DisplayName: "script",
+		})
+		require.NoError(t, err)
+
+		// Larger than a chunk, so the archive is uploaded in two chunks.
+		archive := bytes.Repeat([]byte("artifact"), agentsdk.DefaultUploadChunkSize/4)
+		err = agentClient.PostScriptArtifacts(ctx, agentsdk.ScriptArtifacts{
+			LogSourceID: logSource.ID,
+			Archive:     bytes.NewReader(archive),
+		})
+		require.NoError(t, err)
+
+		workspace, err := client.Workspace(ctx, r.Workspace.ID)
+		require.NoError(t, err)
+		agentID := workspace.LatestBuild.Resources[0].Agents[0].ID
+		artifacts, err := client.WorkspaceAgentScriptArtifacts(ctx, agentID)
+		require.NoError(t, err)
+		require.Len(t, artifacts, 1)
+		require.Equal(t, logSource.ID, artifacts[0].LogSourceID)
+		require.EqualValues(t, len(archive), artifacts[0].Size)
+		downloaded, err := client.WorkspaceAgentScriptArtifactArchive(ctx, agentID, artifacts[0].ID)
+		require.NoError(t, err)
+		require.Equal(t, archive, downloaded)
+
+		_, err = client.WorkspaceAgentScriptArtifactArchive(ctx, agentID, uuid.New())
+		var apiErr *codersdk.Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusNotFound, apiErr.StatusCode())
+	})
+	t.Run("UnknownLogSource", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitMedium)
+		client, db := coderdtest.NewWithDatabase(t, nil)
+		user := coderdtest.CreateFirstUser(t, client)
+		r := dbfake.WorkspaceBuild(t, db, database.Workspace{
+			OrganizationID: user.OrganizationID,
+			OwnerID:        user.UserID,
+		}).WithAgent().Do()
+
+		agentClient := agentsdk.New(client.URL)
+		agentClient.SetSessionToken(r.AgentToken)
+		err := agentClient.PostScriptArtifacts(ctx, agentsdk.ScriptArtifacts{
+			LogSourceID: uuid.New(),
+			Archive:     bytes.NewReader([]byte("artifact")),
+		})
+		var apiErr *codersdk.Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusNotFound, apiErr.StatusCode())
+	})
+}
+
+func TestWorkspaceAgentConnectionFailures(t *testing.T) {
+	t.Parallel()
+	t.Run("Success", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitMedium)
+		client, db := coderdtest.NewWithDatabase(t, nil)
+		user := coderdtest.CreateFirstUser(t, client)
+		r := dbfake.WorkspaceBuild(t, db, database.Workspace{
+			OrganizationID: user.OrganizationID,
+			OwnerID:        user.UserID,
+		}).WithAgent().Do()
+
+		agentClient := agentsdk.New(client.URL)
+		agentClient.SetSessionToken(r.AgentToken)
+		err := agentClient.PostConnectionFailures(ctx, agentsdk.PostConnectionFailuresRequest{
+			Failures: []agentsdk.ConnectionFailure{{
+				Stage:         agentsdk.ConnectionFailureStageCoderd,
+				URL:           "https://coder.example.com",
+				Error:         "x509: certificate signed by unknown authority",
+				Count:         3,
+				FirstSeenAt:   dbtime.Now(),
+				LastSeenAt:    dbtime.Now(),
+				TLSErrorClass: agentsdk.TLSErrorClassUnknownAuthority,
+			}},
+		})
+		require.NoError(t, err)
+	})
+	t.Run("InvalidStage", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitMedium)
+		client, db := coderdtest.NewWithDatabase(t, nil)
+		user := coderdtest.CreateFirstUser(t, client)
+		r := dbfake.WorkspaceBuild(t, db, database.Workspace{
+			OrganizationID: user.OrganizationID,
+			OwnerID:        user.UserID,
+		}).WithAgent().Do()
+
+		agentClient := agentsdk.New(client.URL)
+		agentClient.SetSessionToken(r.AgentToken)
+		err := agentClient.PostConnectionFailures(ctx, agentsdk.PostConnectionFailuresRequest{
+			Failures: []agentsdk.ConnectionFailure{{
+				Stage: "unknown",
+			}},
+		})
+		var apiErr *codersdk.Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusBadRequest, apiErr.StatusCode())
+	})
+	t.Run("Unauthenticated", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitMedium)
+		client := coderdtest.New(t, nil)
+
+		agentClient := agentsdk.New(client.URL)
+		agentClient.SetSessionToken(uuid.NewString())
+		err := agentClient.PostConnectionFailures(ctx, agentsdk.PostConnectionFailuresRequest{})
+		var apiErr *codersdk.Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode())
+	})
+}
+
 func TestWorkspaceAgentConnectRPC(t *testing.T) {
 	t.Parallel()
 
@@ -877,17 +1062,30 @@ func TestWorkspaceAgentAppHealth(t *testing.T) {
 	manifest = requireGetManifest(ctx, t, aAPI)
 	require.EqualValues(t, codersdk.WorkspaceAppHealthHealthy, manifest.Apps[1].Health)
 	// update to unhealthy
+	checkedAt := dbtime.Now()
 	_, err = aAPI.BatchUpdateAppHealths(ctx, &agentproto.BatchUpdateAppHealthRequest{
 		Updates: []*agentproto.BatchUpdateAppHealthRequest_HealthUpdate{
 			{
-				Id:     manifest.Apps[1].ID[:],
-				Health: agentproto.AppHealth_UNHEALTHY,
+				Id:        manifest.Apps[1].ID[:],
+				Health:    agentproto.AppHealth_UNHEALTHY,
+				LatencyMs: 2.5,
+				Error:     "error status code: 502",
+				CheckedAt: timestamppb.New(checkedAt),
 			},
 		},
 	})
 	require.NoError(t, err)
 	manifest = requireGetManifest(ctx, t, aAPI)
 	require.EqualValues(t, codersdk.WorkspaceAppHealthUnhealthy, manifest.Apps[1].Health)
+	// the healthcheck result is served with the app
+	workspaceAgent, err := client.WorkspaceAgent(ctx, manifest.AgentID)
+	require.NoError(t, err)
+	require.Nil(t, workspaceAgent.Apps[0].HealthReport)
+	require.Equal(t, &codersdk.WorkspaceAppHealthReport{
+		LatencyMilliseconds: 2.5,
+		Error:               "error status code: 502",
+		CheckedAt:           checkedAt,
+	}, workspaceAgent.Apps[1].HealthReport)
 }
 
 // TestWorkspaceAgentReportStats tests the legacy (agent API v1) report stats endpoint.
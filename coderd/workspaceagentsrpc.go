@@ -139,13 +139,23 @@ func (api *API) workspaceAgentRPC(rw http.ResponseWriter, r *http.Request) {
 		PublishWorkspaceUpdateFn:          api.publishWorkspaceUpdate,
 		PublishWorkspaceAgentLogsUpdateFn: api.publishWorkspaceAgentLogsUpdate,
 
-		AccessURL:                 api.AccessURL,
-		AppHostname:               api.AppHostname,
-		AgentStatsRefreshInterval: api.AgentStatsRefreshInterval,
-		DisableDirectConnections:  api.DeploymentValues.DERP.Config.BlockDirect.Value(),
-		DerpForceWebSockets:       api.DeploymentValues.DERP.Config.ForceWebSockets.Value(),
-		DerpMapUpdateFrequency:    api.Options.DERPMapUpdateFrequency,
-		ExternalAuthConfigs:       api.ExternalAuthConfigs,
+		AccessURL:                      api.AccessURL,
+		AppHostname:                    api.AppHostname,
+		AgentStatsRefreshInterval:      api.AgentStatsRefreshInterval,
+		DisableDirectConnections:       api.DeploymentValues.DERP.Config.BlockDirect.Value(),
+		DerpForceWebSockets:            api.DeploymentValues.DERP.Config.ForceWebSockets.Value(),
+		DerpMapUpdateFrequency:         api.Options.DERPMapUpdateFrequency,
+		DerpMapFallbacks:               api.Options.DERPMapFallbacks,
+		ExternalAuthConfigs:            api.ExternalAuthConfigs,
+		ExecPolicy:                     agentExecPolicy(api.DeploymentValues),
+		ReconnectingPTYPersistence:     api.DeploymentValues.AgentReconnectingPTYPersistence.Value(),
+		ReconnectingPTYScrollbackLines: int(api.DeploymentValues.AgentReconnectingPTYScrollbackLines.Value()),
+		Proxy:                          agentProxyConfig(api.DeploymentValues),
+		MOTDTemplate:                   api.DeploymentValues.AgentMOTDTemplate.Value(),
+		CodeServer:                     agentCodeServerConfig(api.DeploymentValues),
+		SSHKeepAlive:                   agentSSHKeepAliveConfig(api.DeploymentValues),
+		UpdatePolicy:                   agentUpdatePolicy(api.DeploymentValues),
+		AgentBinarySHA256:              api.agentBinarySHA256,
 
 		// Optional:
 		WorkspaceID:          build.WorkspaceID, // saves the extra lookup later
@@ -0,0 +1,314 @@
+package coderd
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"cdr.dev/slog"
+
+	"github.com/coder/coder/v2/coderd/database"
+	"github.com/coder/coder/v2/coderd/database/dbtime"
+	"github.com/coder/coder/v2/coderd/httpapi"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// maxAgentUploadChunkSize is the largest chunk of an upload accepted from a
+// workspace agent. Agents send chunks of agentsdk.DefaultUploadChunkSize.
+const maxAgentUploadChunkSize = 2 * agentsdk.DefaultUploadChunkSize
+
+// maxAgentUploadsInProgress bounds the uploads an agent may have in progress,
+// so an agent can't fill the database with uploads it never completes.
+const maxAgentUploadsInProgress = 8
+
+// agentUpload describes a file workspace agents upload in chunks with
+// agentsdk.Upload.
+type agentUpload struct {
+	// Name identifies what is uploaded, chunks of uploads with different
+	// names are stored separately.
+	Name string
+	// MaxSize is the size of the largest file accepted.
+	MaxSize int64
+	// Complete is called with the file once all of it was received and its
+	// checksum verified. If it fails, the upload is kept so the agent can
+	// retry completing it.
+	Complete func(ctx context.Context, data []byte) error
+}
+
+// handleAgentUpload implements the server side of the resumable upload
+// protocol of agentsdk.Upload. HEAD requests return the offset of the next
+// chunk, PATCH requests append a chunk. Chunks are stored in the database
+// until the upload completes, so uploads survive restarts of coderd and can
+// be resumed by any replica. POST requests upload the whole file at once,
+// for agents that predate chunked uploads.
+func (api *API) handleAgentUpload(rw http.ResponseWriter, r *http.Request, agentID uuid.UUID, upload agentUpload) {
+	ctx := r.Context()
+
+	if r.Method == http.MethodPost {
+		api.postAgentUpload(rw, r, upload)
+		return
+	}
+
+	size, err := strconv.ParseInt(r.Header.Get(agentsdk.UploadLengthHeader), 10, 64)
+	if err != nil || size < 0 {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: fmt.Sprintf("Invalid %s header.", agentsdk.UploadLengthHeader),
+		})
+		return
+	}
+	if size > upload.MaxSize {
+		httpapi.Write(ctx, rw, http.StatusRequestEntityTooLarge, codersdk.Response{
+			Message: fmt.Sprintf("Uploads must be <= %d bytes.", upload.MaxSize),
+		})
+		return
+	}
+	checksum := r.Header.Get(agentsdk.UploadChecksumHeader)
+	if !validUploadChecksum(checksum) {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: fmt.Sprintf("Invalid %s header, expected %q followed by a hex-encoded digest.", agentsdk.UploadChecksumHeader, "sha256="),
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		stored, err := api.Database.GetWorkspaceAgentUpload(ctx, database.GetWorkspaceAgentUploadParams{
+			WorkspaceAgentID: agentID,
+			Name:             upload.Name,
+			Checksum:         checksum,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set(agentsdk.UploadOffsetHeader, strconv.FormatInt(stored.Received, 10))
+		rw.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		api.patchAgentUploadChunk(rw, r, agentID, upload, size, checksum)
+	default:
+		httpapi.Write(ctx, rw, http.StatusMethodNotAllowed, codersdk.Response{
+			Message: fmt.Sprintf("Method %s is not allowed.", r.Method),
+		})
+	}
+}
+
+// postAgentUpload accepts the whole file in the body of the request. The
+// checksum is verified if the agent sends one.
+func (api *API) postAgentUpload(rw http.ResponseWriter, r *http.Request, upload agentUpload) {
+	ctx := r.Context()
+
+	data, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, upload.MaxSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			httpapi.Write(ctx, rw, http.StatusRequestEntityTooLarge, codersdk.Response{
+				Message: fmt.Sprintf("Uploads must be <= %d bytes.", upload.MaxSize),
+			})
+			return
+		}
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: "Failed to read upload.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	if checksum := r.Header.Get(agentsdk.UploadChecksumHeader); checksum != "" && uploadChecksum(data) != checksum {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: fmt.Sprintf("The uploaded content doesn't match the %s header.", agentsdk.UploadChecksumHeader),
+		})
+		return
+	}
+	err = upload.Complete(ctx, data)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error completing upload.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	rw.WriteHeader(http.StatusCreated)
+}
+
+func (api *API) patchAgentUploadChunk(rw http.ResponseWriter, r *http.Request, agentID uuid.UUID, upload agentUpload, size int64, checksum string) {
+	ctx := r.Context()
+
+	if r.Header.Get("Content-Type") != agentsdk.ContentTypeUploadChunk {
+		httpapi.Write(ctx, rw, http.StatusUnsupportedMediaType, codersdk.Response{
+			Message: fmt.Sprintf("Chunks must be of content type %q.", agentsdk.ContentTypeUploadChunk),
+		})
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get(agentsdk.UploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 || offset > size {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: fmt.Sprintf("Invalid %s header.", agentsdk.UploadOffsetHeader),
+		})
+		return
+	}
+	chunk, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxAgentUploadChunkSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			httpapi.Write(ctx, rw, http.StatusRequestEntityTooLarge, codersdk.Response{
+				Message: fmt.Sprintf("Chunks must be <= %d bytes.", maxAgentUploadChunkSize),
+			})
+			return
+		}
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: "Failed to read chunk.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	if offset+int64(len(chunk)) > size {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: fmt.Sprintf("The chunk exceeds the %s of the upload.", agentsdk.UploadLengthHeader),
+		})
+		return
+	}
+
+	if offset == 0 {
+		inserted, err := api.Database.InsertWorkspaceAgentUpload(ctx, database.InsertWorkspaceAgentUploadParams{
+			WorkspaceAgentID: agentID,
+			Name:             upload.Name,
+			Checksum:         checksum,
+			Size:             size,
+			CreatedAt:        dbtime.Now(),
+			MaxUploads:       maxAgentUploadsInProgress,
+		})
+		if err != nil {
+			httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+				Message: "Internal error starting upload.",
+				Detail:  err.Error(),
+			})
+			return
+		}
+		if inserted == 0 {
+			// The upload either exists, e.g. the agent restarts it, or the
+			// agent has too many uploads in progress.
+			_, err = api.Database.GetWorkspaceAgentUpload(ctx, database.GetWorkspaceAgentUploadParams{
+				WorkspaceAgentID: agentID,
+				Name:             upload.Name,
+				Checksum:         checksum,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				httpapi.Write(ctx, rw, http.StatusTooManyRequests, codersdk.Response{
+					Message: fmt.Sprintf("The agent has %d uploads in progress, complete them before starting another.", maxAgentUploadsInProgress),
+				})
+				return
+			}
+			if err != nil {
+				httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+					Message: "Internal error fetching upload.",
+					Detail:  err.Error(),
+				})
+				return
+			}
+		}
+	}
+	// The chunk is only appended if it starts where the previous one ended,
+	// so a chunk whose response got lost isn't appended twice. An empty
+	// chunk at the end completes an upload that failed to complete before.
+	received, err := api.Database.AppendWorkspaceAgentUploadChunk(ctx, database.AppendWorkspaceAgentUploadChunkParams{
+		Chunk:            chunk,
+		UpdatedAt:        dbtime.Now(),
+		WorkspaceAgentID: agentID,
+		Name:             upload.Name,
+		Checksum:         checksum,
+		Offset:           offset,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		httpapi.Write(ctx, rw, http.StatusConflict, codersdk.Response{
+			Message: "The chunk doesn't start at the offset of the upload, request the offset with a HEAD request.",
+		})
+		return
+	}
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error appending chunk.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	if received < size {
+		rw.Header().Set(agentsdk.UploadOffsetHeader, strconv.FormatInt(received, 10))
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// The chunks are assembled once the upload is complete.
+	data, err := api.Database.GetWorkspaceAgentUploadData(ctx, database.GetWorkspaceAgentUploadDataParams{
+		WorkspaceAgentID: agentID,
+		Name:             upload.Name,
+		Checksum:         checksum,
+	})
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching upload.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	deleteParams := database.DeleteWorkspaceAgentUploadParams{
+		WorkspaceAgentID: agentID,
+		Name:             upload.Name,
+		Checksum:         checksum,
+	}
+	if int64(len(data)) != size || uploadChecksum(data) != checksum {
+		// The upload can't be completed, the agent has to start over.
+		err = api.Database.DeleteWorkspaceAgentUpload(ctx, deleteParams)
+		if err != nil {
+			httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+				Message: "Internal error deleting upload.",
+				Detail:  err.Error(),
+			})
+			return
+		}
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: fmt.Sprintf("The uploaded content doesn't match the %s header.", agentsdk.UploadChecksumHeader),
+		})
+		return
+	}
+	err = upload.Complete(ctx, data)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error completing upload.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	err = api.Database.DeleteWorkspaceAgentUpload(ctx, deleteParams)
+	if err != nil {
+		// The upload is complete, it's purged eventually.
+		api.Logger.Warn(ctx, "delete completed workspace agent upload", slog.F("name", upload.Name), slog.Error(err))
+	}
+	rw.WriteHeader(http.StatusCreated)
+}
+
+func uploadChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256=" + hex.EncodeToString(sum[:])
+}
+
+func validUploadChecksum(checksum string) bool {
+	digest, ok := strings.CutPrefix(checksum, "sha256=")
+	if !ok || len(digest) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
@@ -0,0 +1,252 @@
+package coderd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog/sloggers/slogtest"
+
+	"github.com/coder/coder/v2/coderd/database"
+	"github.com/coder/coder/v2/coderd/database/dbmem"
+	"github.com/coder/coder/v2/coderd/database/dbtime"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestHandleAgentUpload(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Chunks", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := newAgentUploadServer(t, 1<<20)
+		content := randomUploadContent(t, 10_000)
+
+		err := srv.client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{ChunkSize: 4096})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{content}, srv.completed)
+		require.EqualValues(t, 3, srv.chunks.Load())
+		srv.requireNoUpload(ctx, t, content)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := newAgentUploadServer(t, 1<<20)
+		content := randomUploadContent(t, 10_000)
+		// The first chunk was received before e.g. the agent restarted.
+		checksum := uploadChecksum(content)
+		_, err := srv.db.InsertWorkspaceAgentUpload(ctx, database.InsertWorkspaceAgentUploadParams{
+			WorkspaceAgentID: srv.agentID,
+			Name:             "test",
+			Checksum:         checksum,
+			Size:             int64(len(content)),
+			CreatedAt:        dbtime.Now(),
+			MaxUploads:       maxAgentUploadsInProgress,
+		})
+		require.NoError(t, err)
+		_, err = srv.db.AppendWorkspaceAgentUploadChunk(ctx, database.AppendWorkspaceAgentUploadChunkParams{
+			Chunk:            content[:4096],
+			UpdatedAt:        dbtime.Now(),
+			WorkspaceAgentID: srv.agentID,
+			Name:             "test",
+			Checksum:         checksum,
+			Offset:           0,
+		})
+		require.NoError(t, err)
+
+		err = srv.client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{ChunkSize: 4096})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{content}, srv.completed)
+		require.EqualValues(t, 2, srv.chunks.Load())
+		srv.requireNoUpload(ctx, t, content)
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := newAgentUploadServer(t, 1000)
+		content := randomUploadContent(t, 1001)
+
+		err := srv.client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{})
+		var sdkErr *codersdk.Error
+		require.ErrorAs(t, err, &sdkErr)
+		require.Equal(t, http.StatusRequestEntityTooLarge, sdkErr.StatusCode())
+		require.Empty(t, srv.completed)
+		srv.requireNoUpload(ctx, t, content)
+	})
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := newAgentUploadServer(t, 1<<20)
+		content := randomUploadContent(t, 10_000)
+		// The first chunk received doesn't match the content, e.g. because
+		// the file changed while it was uploaded.
+		checksum := uploadChecksum(content)
+		_, err := srv.db.InsertWorkspaceAgentUpload(ctx, database.InsertWorkspaceAgentUploadParams{
+			WorkspaceAgentID: srv.agentID,
+			Name:             "test",
+			Checksum:         checksum,
+			Size:             int64(len(content)),
+			CreatedAt:        dbtime.Now(),
+			MaxUploads:       maxAgentUploadsInProgress,
+		})
+		require.NoError(t, err)
+		_, err = srv.db.AppendWorkspaceAgentUploadChunk(ctx, database.AppendWorkspaceAgentUploadChunkParams{
+			Chunk:            make([]byte, 4096),
+			UpdatedAt:        dbtime.Now(),
+			WorkspaceAgentID: srv.agentID,
+			Name:             "test",
+			Checksum:         checksum,
+			Offset:           0,
+		})
+		require.NoError(t, err)
+
+		err = srv.client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{ChunkSize: 4096})
+		require.ErrorContains(t, err, "doesn't match the Upload-Checksum header")
+		require.Empty(t, srv.completed)
+		// The agent starts over the next time.
+		srv.requireNoUpload(ctx, t, content)
+	})
+
+	t.Run("RetryComplete", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := newAgentUploadServer(t, 1<<20)
+		srv.failComplete.Store(true)
+		content := randomUploadContent(t, 10_000)
+
+		err := srv.client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{ChunkSize: 4096})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{content}, srv.completed)
+		// The agent completes the upload with an empty chunk.
+		require.EqualValues(t, 4, srv.chunks.Load())
+		srv.requireNoUpload(ctx, t, content)
+	})
+
+	t.Run("TooManyInProgress", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := newAgentUploadServer(t, 1<<20)
+		for i := 0; i < maxAgentUploadsInProgress; i++ {
+			inserted, err := srv.db.InsertWorkspaceAgentUpload(ctx, database.InsertWorkspaceAgentUploadParams{
+				WorkspaceAgentID: srv.agentID,
+				Name:             "test",
+				Checksum:         uploadChecksum(randomUploadContent(t, 10)),
+				Size:             10,
+				CreatedAt:        dbtime.Now(),
+				MaxUploads:       maxAgentUploadsInProgress,
+			})
+			require.NoError(t, err)
+			require.EqualValues(t, 1, inserted)
+		}
+		content := randomUploadContent(t, 10_000)
+
+		err := srv.client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{ChunkSize: 4096})
+		var sdkErr *codersdk.Error
+		require.ErrorAs(t, err, &sdkErr)
+		require.Equal(t, http.StatusTooManyRequests, sdkErr.StatusCode())
+		require.Empty(t, srv.completed)
+		srv.requireNoUpload(ctx, t, content)
+	})
+
+	t.Run("Post", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := newAgentUploadServer(t, 1<<20)
+		content := randomUploadContent(t, 10_000)
+
+		res, err := srv.client.SDK.Request(ctx, http.MethodPost, "/upload", bytes.NewReader(content))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+		require.Equal(t, [][]byte{content}, srv.completed)
+
+		// The checksum is verified if it's sent.
+		res, err = srv.client.SDK.Request(ctx, http.MethodPost, "/upload", bytes.NewReader(content), func(r *http.Request) {
+			r.Header.Set(agentsdk.UploadChecksumHeader, uploadChecksum(content[1:]))
+		})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		require.Len(t, srv.completed, 1)
+	})
+}
+
+type agentUploadServer struct {
+	db      database.Store
+	agentID uuid.UUID
+	client  *agentsdk.Client
+
+	chunks       atomic.Int64
+	failComplete atomic.Bool
+	completed    [][]byte
+}
+
+func newAgentUploadServer(t *testing.T, maxSize int64) *agentUploadServer {
+	t.Helper()
+
+	srv := &agentUploadServer{
+		db:      dbmem.New(),
+		agentID: uuid.New(),
+	}
+	api := &API{
+		Options: &Options{
+			Database: srv.db,
+			Logger:   slogtest.Make(t, nil),
+		},
+	}
+	upload := agentUpload{
+		Name:    "test",
+		MaxSize: maxSize,
+		Complete: func(_ context.Context, data []byte) error {
+			if srv.failComplete.CompareAndSwap(true, false) {
+				return xerrors.New("failed to complete")
+			}
+			srv.completed = append(srv.completed, data)
+			return nil
+		},
+	}
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			srv.chunks.Add(1)
+		}
+		api.handleAgentUpload(rw, r, srv.agentID, upload)
+	}))
+	t.Cleanup(httpSrv.Close)
+	u, err := url.Parse(httpSrv.URL)
+	require.NoError(t, err)
+	srv.client = agentsdk.New(u)
+	return srv
+}
+
+func (s *agentUploadServer) requireNoUpload(ctx context.Context, t *testing.T, content []byte) {
+	t.Helper()
+	_, err := s.db.GetWorkspaceAgentUpload(ctx, database.GetWorkspaceAgentUploadParams{
+		WorkspaceAgentID: s.agentID,
+		Name:             "test",
+		Checksum:         uploadChecksum(content),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func randomUploadContent(t *testing.T, size int) []byte {
+	t.Helper()
+	content := make([]byte, size)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	return content
+}
@@ -3,10 +3,12 @@ package coderd
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -14,6 +16,7 @@ import (
 	"golang.org/x/exp/slices"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/xerrors"
+	protobuf "google.golang.org/protobuf/proto"
 
 	"cdr.dev/slog"
 
@@ -28,6 +31,7 @@ import (
 	"github.com/coder/coder/v2/coderd/rbac"
 	"github.com/coder/coder/v2/coderd/wsbuilder"
 	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/provisionersdk/proto"
 )
 
 // @Summary Get workspace build
@@ -602,6 +606,79 @@ func (api *API) workspaceBuildParameters(rw http.ResponseWriter, r *http.Request
 	httpapi.Write(ctx, rw, http.StatusOK, apiParameters)
 }
 
+// @Summary Get template outputs for workspace build
+// @ID get-template-outputs-for-workspace-build
+// @Security CoderSessionToken
+// @Produce json
+// @Tags Builds
+// @Param workspacebuild path string true "Workspace build ID"
+// @Success 200 {array} codersdk.WorkspaceResourceMetadata
+// @Router /workspacebuilds/{workspacebuild}/metadata [get]
+func (api *API) workspaceBuildMetadata(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceBuild := httpmw.WorkspaceBuildParam(r)
+
+	metadata, err := api.Database.GetWorkspaceBuildMetadataByBuildID(ctx, workspaceBuild.ID)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching workspace build metadata.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	apiMetadata := make([]codersdk.WorkspaceResourceMetadata, 0, len(metadata))
+	for _, metadatum := range metadata {
+		apiMetadata = append(apiMetadata, codersdk.WorkspaceResourceMetadata{
+			Key:       metadatum.Key,
+			Value:     metadatum.Value,
+			Sensitive: metadatum.Sensitive,
+			Order:     metadatum.DisplayOrder,
+		})
+	}
+	httpapi.Write(ctx, rw, http.StatusOK, apiMetadata)
+}
+
+// @Summary Get capacity fallback of workspace build
+// @ID get-capacity-fallback-of-workspace-build
+// @Security CoderSessionToken
+// @Produce json
+// @Tags Builds
+// @Param workspacebuild path string true "Workspace build ID"
+// @Success 200 {object} codersdk.WorkspaceBuildCapacityFallback
+// @Router /workspacebuilds/{workspacebuild}/capacity-fallback [get]
+func (api *API) workspaceBuildCapacityFallback(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceBuild := httpmw.WorkspaceBuildParam(r)
+
+	fallback, err := api.Database.GetWorkspaceBuildCapacityFallbackByBuildID(ctx, workspaceBuild.ID)
+	if httpapi.Is404Error(err) {
+		httpapi.Write(ctx, rw, http.StatusNotFound, codersdk.Response{
+			Message: "The build didn't fall back to alternate capacity options.",
+		})
+		return
+	}
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching workspace build capacity fallback.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	apiFallback := codersdk.WorkspaceBuildCapacityFallback{
+		Selected: fallback.Selected,
+		Attempts: []codersdk.WorkspaceBuildCapacityAttempt{},
+	}
+	err = json.Unmarshal(fallback.Attempts, &apiFallback.Attempts)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error reading workspace build capacity attempts.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	httpapi.Write(ctx, rw, http.StatusOK, apiFallback)
+}
+
 // @Summary Get workspace build logs
 // @ID get-workspace-build-logs
 // @Security CoderSessionToken
@@ -667,6 +744,147 @@ func (api *API) workspaceBuildState(rw http.ResponseWriter, r *http.Request) {
 	_, _ = rw.Write(workspaceBuild.ProvisionerState)
 }
 
+// @Summary Get work directory listing of failed workspace build
+// @ID get-work-directory-listing-of-failed-workspace-build
+// @Security CoderSessionToken
+// @Produce json
+// @Tags Builds
+// @Param workspacebuild path string true "Workspace build ID"
+// @Success 200 {object} codersdk.WorkspaceBuildWorkDirectory
+// @Router /workspacebuilds/{workspacebuild}/work-directory [get]
+func (api *API) workspaceBuildWorkDirectory(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceBuild := httpmw.WorkspaceBuildParam(r)
+	workspace := httpmw.WorkspaceParam(r)
+	template, err := api.Database.GetTemplateByID(ctx, workspace.TemplateID)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Failed to get template",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	// The listing reveals the files of the template and the provisioner
+	// host, so it requires the same permissions as the state.
+	if !api.Authorize(r, rbac.ActionUpdate, template.RBACObject()) {
+		httpapi.ResourceNotFound(rw)
+		return
+	}
+
+	//nolint:gocritic // Listings are only stored by provisionerd.
+	dbWorkDirectory, err := api.Database.GetProvisionerJobWorkDirectoryByJobID(dbauthz.AsSystemRestricted(ctx), workspaceBuild.JobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpapi.Write(ctx, rw, http.StatusNotFound, codersdk.Response{
+			Message: "No work directory listing exists for this build.",
+			Detail:  "Listings are only reported for builds that failed to plan or apply.",
+		})
+		return
+	}
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching work directory listing.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	var listing proto.WorkDirectoryListing
+	err = protobuf.Unmarshal(dbWorkDirectory.Listing, &listing)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error decoding work directory listing.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	workDirectory := codersdk.WorkspaceBuildWorkDirectory{
+		Path:      listing.Path,
+		Entries:   make([]codersdk.WorkspaceBuildWorkDirectoryEntry, 0, len(listing.Entries)),
+		Truncated: listing.Truncated,
+		Kept:      listing.Kept,
+	}
+	for _, entry := range listing.Entries {
+		workDirectory.Entries = append(workDirectory.Entries, codersdk.WorkspaceBuildWorkDirectoryEntry{
+			Path: entry.Path,
+			Size: entry.Size,
+			Mode: entry.Mode,
+		})
+	}
+	httpapi.Write(ctx, rw, http.StatusOK, workDirectory)
+}
+
+// @Summary Get diagnostic bundle of failed workspace build
+// @ID get-diagnostic-bundle-of-failed-workspace-build
+// @Security CoderSessionToken
+// @Produce json
+// @Tags Builds
+// @Param workspacebuild path string true "Workspace build ID"
+// @Success 200 {object} codersdk.WorkspaceBuildDiagnosticBundle
+// @Router /workspacebuilds/{workspacebuild}/diagnostic-bundle [get]
+func (api *API) workspaceBuildDiagnosticBundle(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceBuild := httpmw.WorkspaceBuildParam(r)
+	workspace := httpmw.WorkspaceParam(r)
+	template, err := api.Database.GetTemplateByID(ctx, workspace.TemplateID)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Failed to get template",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	// The bundle reveals the plan and the provisioner host, so it requires
+	// the same permissions as the state.
+	if !api.Authorize(r, rbac.ActionUpdate, template.RBACObject()) {
+		httpapi.ResourceNotFound(rw)
+		return
+	}
+
+	//nolint:gocritic // Bundles are only stored by provisionerd.
+	dbBundle, err := api.Database.GetProvisionerJobDiagnosticBundleByJobID(dbauthz.AsSystemRestricted(ctx), workspaceBuild.JobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpapi.Write(ctx, rw, http.StatusNotFound, codersdk.Response{
+			Message: "No diagnostic bundle exists for this build.",
+			Detail:  "Bundles are only reported for builds that failed to plan or apply.",
+		})
+		return
+	}
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching diagnostic bundle.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	var bundle proto.DiagnosticBundle
+	err = protobuf.Unmarshal(dbBundle.Bundle, &bundle)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error decoding diagnostic bundle.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	resp := codersdk.WorkspaceBuildDiagnosticBundle{
+		PlanJSON:         bundle.PlanJson,
+		Graph:            bundle.Graph,
+		Logs:             make([]codersdk.WorkspaceBuildDiagnosticLog, 0, len(bundle.Logs)),
+		TerraformVersion: bundle.TerraformVersion,
+		Environment:      bundle.Environment,
+		Errors:           bundle.Errors,
+	}
+	for _, log := range bundle.Logs {
+		resp.Logs = append(resp.Logs, codersdk.WorkspaceBuildDiagnosticLog{
+			Level:  codersdk.LogLevel(strings.ToLower(log.Level.String())),
+			Output: log.Output,
+		})
+	}
+	httpapi.Write(ctx, rw, http.StatusOK, resp)
+}
+
 type workspaceBuildsData struct {
 	users            []database.User
 	jobs             []database.GetProvisionerJobsByIDsWithQueuePositionRow
@@ -913,7 +1131,7 @@ func (api *API) convertWorkspaceBuild(
 			scripts := scriptsByAgentID[agent.ID]
 			logSources := logSourcesByAgentID[agent.ID]
 			apiAgent, err := db2sdk.WorkspaceAgent(
-				api.DERPMap(), *api.TailnetCoordinator.Load(), agent, db2sdk.Apps(apps, agent, username, workspace), convertScripts(scripts), convertLogSources(logSources), api.AgentInactiveDisconnectTimeout,
+				api.DERPMap(), *api.TailnetCoordinator.Load(), agent, db2sdk.Apps(apps, agent, username, workspace), convertScripts(scripts, logSources), convertLogSources(logSources), api.AgentInactiveDisconnectTimeout,
 				api.DeploymentValues.AgentFallbackTroubleshootingURL.String(),
 			)
 			if err != nil {
@@ -958,6 +1176,8 @@ func convertWorkspaceResource(resource database.WorkspaceResource, agents []code
 			Key:       field.Key,
 			Value:     field.Value.String,
 			Sensitive: field.Sensitive,
+			Order:     field.DisplayOrder,
+			Group:     field.DisplayGroup,
 		})
 	}
 
@@ -973,6 +1193,7 @@ func convertWorkspaceResource(resource database.WorkspaceResource, agents []code
 		Agents:     agents,
 		Metadata:   convertedMetadata,
 		DailyCost:  resource.DailyCost,
+		Action:     codersdk.WorkspaceResourceAction(resource.Action),
 	}
 }
 
@@ -527,6 +527,92 @@ func TestWorkspaceBuildResources(t *testing.T) {
 	})
 }
 
+func TestWorkspaceBuildMetadata(t *testing.T) {
+	t.Parallel()
+	client := coderdtest.New(t, &coderdtest.Options{IncludeProvisionerDaemon: true})
+	user := coderdtest.CreateFirstUser(t, client)
+	version := coderdtest.CreateTemplateVersion(t, client, user.OrganizationID, &echo.Responses{
+		Parse: echo.ParseComplete,
+		ProvisionApply: []*proto.Response{{
+			Type: &proto.Response_Apply{
+				Apply: &proto.ApplyComplete{
+					WorkspaceMetadata: []*proto.Resource_Metadata{
+						{Key: "endpoint", Value: "https://example.com"},
+						{Key: "missing", IsNull: true},
+						{Key: "token", Sensitive: true},
+					},
+				},
+			},
+		}},
+	})
+	coderdtest.AwaitTemplateVersionJobCompleted(t, client, version.ID)
+	template := coderdtest.CreateTemplate(t, client, user.OrganizationID, version.ID)
+	workspace := coderdtest.CreateWorkspace(t, client, user.OrganizationID, template.ID)
+	coderdtest.AwaitWorkspaceBuildJobCompleted(t, client, workspace.LatestBuild.ID)
+
+	ctx := testutil.Context(t, testutil.WaitLong)
+
+	metadata, err := client.WorkspaceBuildMetadata(ctx, workspace.LatestBuild.ID)
+	require.NoError(t, err)
+	require.Equal(t, []codersdk.WorkspaceResourceMetadata{{
+		Key:   "endpoint",
+		Value: "https://example.com",
+	}, {
+		Key:       "token",
+		Sensitive: true,
+		Order:     2,
+	}}, metadata)
+}
+
+func TestWorkspaceBuildCapacityFallback(t *testing.T) {
+	t.Parallel()
+	client := coderdtest.New(t, &coderdtest.Options{IncludeProvisionerDaemon: true})
+	user := coderdtest.CreateFirstUser(t, client)
+	version := coderdtest.CreateTemplateVersion(t, client, user.OrganizationID, &echo.Responses{
+		Parse: echo.ParseComplete,
+		ProvisionApply: []*proto.Response{{
+			Type: &proto.Response_Apply{
+				Apply: &proto.ApplyComplete{
+					CapacityFallback: &proto.CapacityFallback{
+						Attempts: []*proto.CapacityFallback_Attempt{{
+							Option: "spot",
+							Error:  "InsufficientInstanceCapacity",
+						}},
+						Selected: "on-demand",
+					},
+				},
+			},
+		}},
+	})
+	coderdtest.AwaitTemplateVersionJobCompleted(t, client, version.ID)
+	template := coderdtest.CreateTemplate(t, client, user.OrganizationID, version.ID)
+	workspace := coderdtest.CreateWorkspace(t, client, user.OrganizationID, template.ID)
+	coderdtest.AwaitWorkspaceBuildJobCompleted(t, client, workspace.LatestBuild.ID)
+
+	ctx := testutil.Context(t, testutil.WaitLong)
+
+	fallback, err := client.WorkspaceBuildCapacityFallback(ctx, workspace.LatestBuild.ID)
+	require.NoError(t, err)
+	require.Equal(t, codersdk.WorkspaceBuildCapacityFallback{
+		Selected: "on-demand",
+		Attempts: []codersdk.WorkspaceBuildCapacityAttempt{{
+			Option: "spot",
+			Error:  "InsufficientInstanceCapacity",
+		}},
+	}, fallback)
+
+	// Builds of templates that don't fall back have no capacity fallback.
+	other := coderdtest.CreateTemplateVersion(t, client, user.OrganizationID, nil)
+	coderdtest.AwaitTemplateVersionJobCompleted(t, client, other.ID)
+	otherTemplate := coderdtest.CreateTemplate(t, client, user.OrganizationID, other.ID)
+	otherWorkspace := coderdtest.CreateWorkspace(t, client, user.OrganizationID, otherTemplate.ID)
+	coderdtest.AwaitWorkspaceBuildJobCompleted(t, client, otherWorkspace.LatestBuild.ID)
+	_, err = client.WorkspaceBuildCapacityFallback(ctx, otherWorkspace.LatestBuild.ID)
+	var apiErr *codersdk.Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode())
+}
+
 func TestWorkspaceBuildLogs(t *testing.T) {
 	t.Parallel()
 	client := coderdtest.New(t, &coderdtest.Options{IncludeProvisionerDaemon: true})
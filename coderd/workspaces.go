@@ -12,6 +12,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/sqlc-dev/pqtype"
 	"golang.org/x/xerrors"
 
 	"cdr.dev/slog"
@@ -23,10 +24,12 @@ import (
 	"github.com/coder/coder/v2/coderd/database/provisionerjobs"
 	"github.com/coder/coder/v2/coderd/httpapi"
 	"github.com/coder/coder/v2/coderd/httpmw"
+	"github.com/coder/coder/v2/coderd/provisionerdserver"
 	"github.com/coder/coder/v2/coderd/rbac"
 	"github.com/coder/coder/v2/coderd/schedule/cron"
 	"github.com/coder/coder/v2/coderd/searchquery"
 	"github.com/coder/coder/v2/coderd/telemetry"
+	"github.com/coder/coder/v2/coderd/tracing"
 	"github.com/coder/coder/v2/coderd/util/ptr"
 	"github.com/coder/coder/v2/coderd/wsbuilder"
 	"github.com/coder/coder/v2/codersdk"
@@ -1223,6 +1226,131 @@ func (api *API) putWorkspaceAutoupdates(rw http.ResponseWriter, r *http.Request)
 	rw.WriteHeader(http.StatusNoContent)
 }
 
+// @Summary Refresh workspace resources
+// @Description Refreshes the resources of the latest build without changing them, and updates their metadata.
+// @Description If a refresh of the latest build is already queued or running, it's returned instead.
+// @ID refresh-workspace-resources
+// @Security CoderSessionToken
+// @Produce json
+// @Tags Workspaces
+// @Param workspace path string true "Workspace ID" format(uuid)
+// @Success 201 {object} codersdk.ProvisionerJob
+// @Router /workspaces/{workspace}/refresh [post]
+func (api *API) postWorkspaceRefresh(rw http.ResponseWriter, r *http.Request) {
+	var (
+		ctx       = r.Context()
+		apiKey    = httpmw.APIKey(r)
+		workspace = httpmw.WorkspaceParam(r)
+	)
+
+	if !api.Authorize(r, rbac.ActionUpdate, workspace) {
+		httpapi.ResourceNotFound(rw)
+		return
+	}
+
+	build, err := api.Database.GetLatestWorkspaceBuildByWorkspaceID(ctx, workspace.ID)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching latest workspace build.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	if build.Transition == database.WorkspaceTransitionDelete {
+		httpapi.Write(ctx, rw, http.StatusBadRequest, codersdk.Response{
+			Message: "Deleted workspaces can't be refreshed.",
+		})
+		return
+	}
+	buildJob, err := api.Database.GetProvisionerJobByID(ctx, build.JobID)
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching provisioner job.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	if !buildJob.CompletedAt.Valid {
+		httpapi.Write(ctx, rw, http.StatusConflict, codersdk.Response{
+			Message: "The latest workspace build hasn't completed yet.",
+		})
+		return
+	}
+	// Refreshes plan the whole workspace, so repeated requests join the
+	// refresh that's already queued or running.
+	existing, err := api.Database.GetUnfinishedWorkspaceRefreshJobByBuildID(ctx, build.ID)
+	if err == nil {
+		httpapi.Write(ctx, rw, http.StatusCreated, convertProvisionerJob(database.GetProvisionerJobsByIDsWithQueuePositionRow{
+			ProvisionerJob: existing,
+			QueuePosition:  0,
+		}))
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error fetching workspace refresh.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	input, err := json.Marshal(provisionerdserver.WorkspaceRefreshJob{
+		WorkspaceBuildID: build.ID,
+	})
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error marshaling provisioner job.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	metadataRaw, err := json.Marshal(tracing.MetadataFromContext(ctx))
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error marshaling metadata.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+
+	// The refresh runs on the provisioners of the build, with the files of
+	// its template version.
+	provisionerJob, err := api.Database.InsertProvisionerJob(ctx, database.InsertProvisionerJobParams{
+		ID:             uuid.New(),
+		CreatedAt:      dbtime.Now(),
+		UpdatedAt:      dbtime.Now(),
+		OrganizationID: workspace.OrganizationID,
+		InitiatorID:    apiKey.UserID,
+		Provisioner:    buildJob.Provisioner,
+		StorageMethod:  buildJob.StorageMethod,
+		FileID:         buildJob.FileID,
+		Type:           database.ProvisionerJobTypeWorkspaceRefresh,
+		Input:          input,
+		Tags:           buildJob.Tags,
+		TraceMetadata: pqtype.NullRawMessage{
+			Valid:      true,
+			RawMessage: metadataRaw,
+		},
+	})
+	if err != nil {
+		httpapi.Write(ctx, rw, http.StatusInternalServerError, codersdk.Response{
+			Message: "Internal error inserting provisioner job.",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	err = provisionerjobs.PostJob(api.Pubsub, provisionerJob)
+	if err != nil {
+		// Client probably doesn't care about this error, so just log it.
+		api.Logger.Error(ctx, "failed to post provisioner job to pubsub", slog.Error(err))
+	}
+
+	httpapi.Write(ctx, rw, http.StatusCreated, convertProvisionerJob(database.GetProvisionerJobsByIDsWithQueuePositionRow{
+		ProvisionerJob: provisionerJob,
+		QueuePosition:  0,
+	}))
+}
+
 // @Summary Resolve workspace autostart by id.
 // @ID resolve-workspace-autostart-by-id
 // @Security CoderSessionToken
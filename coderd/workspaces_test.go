@@ -2740,8 +2740,8 @@ func TestWorkspaceWithRichParameters(t *testing.T) {
 	require.Equal(t, secondParameterValidationMonotonic, templateRichParameters[1].ValidationMonotonic)
 
 	expectedBuildParameters := []codersdk.WorkspaceBuildParameter{
-		{Name: firstParameterName, Value: firstParameterValue},
-		{Name: secondParameterName, Value: secondParameterValue},
+		{Name: firstParameterName, Value: firstParameterValue, Source: codersdk.WorkspaceBuildParameterSourceUserInput},
+		{Name: secondParameterName, Value: secondParameterValue, Source: codersdk.WorkspaceBuildParameterSourceUserInput},
 	}
 
 	template := coderdtest.CreateTemplate(t, client, user.OrganizationID, version.ID)
@@ -2838,8 +2838,8 @@ func TestWorkspaceWithOptionalRichParameters(t *testing.T) {
 
 	expectedBuildParameters := []codersdk.WorkspaceBuildParameter{
 		// Coderd inserts the default for the missing parameter
-		{Name: firstParameterName, Value: firstParameterDefaultValue},
-		{Name: secondParameterName, Value: secondParameterValue},
+		{Name: firstParameterName, Value: firstParameterDefaultValue, Source: codersdk.WorkspaceBuildParameterSourceTemplateDefault},
+		{Name: secondParameterName, Value: secondParameterValue, Source: codersdk.WorkspaceBuildParameterSourceUserInput},
 	}
 	require.ElementsMatch(t, expectedBuildParameters, workspaceBuildParameters)
 }
@@ -2915,8 +2915,8 @@ func TestWorkspaceWithEphemeralRichParameters(t *testing.T) {
 	require.NoError(t, err)
 
 	expectedBuildParameters := []codersdk.WorkspaceBuildParameter{
-		{Name: firstParameterName, Value: firstParameterDefaultValue},
-		{Name: ephemeralParameterName, Value: ephemeralParameterDefaultValue},
+		{Name: firstParameterName, Value: firstParameterDefaultValue, Source: codersdk.WorkspaceBuildParameterSourceTemplateDefault},
+		{Name: ephemeralParameterName, Value: ephemeralParameterDefaultValue, Source: codersdk.WorkspaceBuildParameterSourceTemplateDefault},
 	}
 	require.ElementsMatch(t, expectedBuildParameters, workspaceBuildParameters)
 
@@ -2939,8 +2939,8 @@ func TestWorkspaceWithEphemeralRichParameters(t *testing.T) {
 	require.NoError(t, err)
 
 	expectedBuildParameters = []codersdk.WorkspaceBuildParameter{
-		{Name: firstParameterName, Value: firstParameterDefaultValue},
-		{Name: ephemeralParameterName, Value: ephemeralParameterValue},
+		{Name: firstParameterName, Value: firstParameterDefaultValue, Source: codersdk.WorkspaceBuildParameterSourcePreviousBuild},
+		{Name: ephemeralParameterName, Value: ephemeralParameterValue, Source: codersdk.WorkspaceBuildParameterSourceUserInput},
 	}
 	require.ElementsMatch(t, expectedBuildParameters, workspaceBuildParameters)
 
@@ -2963,8 +2963,8 @@ func TestWorkspaceWithEphemeralRichParameters(t *testing.T) {
 	require.NoError(t, err)
 
 	expectedBuildParameters = []codersdk.WorkspaceBuildParameter{
-		{Name: firstParameterName, Value: firstParameterValue},
-		{Name: ephemeralParameterName, Value: ephemeralParameterDefaultValue},
+		{Name: firstParameterName, Value: firstParameterValue, Source: codersdk.WorkspaceBuildParameterSourceUserInput},
+		{Name: ephemeralParameterName, Value: ephemeralParameterDefaultValue, Source: codersdk.WorkspaceBuildParameterSourceTemplateDefault},
 	}
 	require.ElementsMatch(t, expectedBuildParameters, workspaceBuildParameters)
 }
@@ -3150,3 +3150,41 @@ func TestWorkspaceFavoriteUnfavorite(t *testing.T) {
 	require.ErrorAs(t, err, &sdkErr)
 	require.Equal(t, http.StatusForbidden, sdkErr.StatusCode())
 }
+
+func TestWorkspaceRefresh(t *testing.T) {
+	t.Parallel()
+	t.Run("OK", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		client, db := coderdtest.NewWithDatabase(t, nil)
+		owner := coderdtest.CreateFirstUser(t, client)
+		r := dbfake.WorkspaceBuild(t, db, database.Workspace{
+			OrganizationID: owner.OrganizationID,
+			OwnerID:        owner.UserID,
+		}).Do()
+
+		job, err := client.RefreshWorkspace(ctx, r.Workspace.ID)
+		require.NoError(t, err)
+		require.Equal(t, codersdk.ProvisionerJobPending, job.Status)
+
+		// The pending refresh is reused.
+		again, err := client.RefreshWorkspace(ctx, r.Workspace.ID)
+		require.NoError(t, err)
+		require.Equal(t, job.ID, again.ID)
+	})
+	t.Run("BuildRunning", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		client, db := coderdtest.NewWithDatabase(t, nil)
+		owner := coderdtest.CreateFirstUser(t, client)
+		r := dbfake.WorkspaceBuild(t, db, database.Workspace{
+			OrganizationID: owner.OrganizationID,
+			OwnerID:        owner.UserID,
+		}).Starting().Do()
+
+		_, err := client.RefreshWorkspace(ctx, r.Workspace.ID)
+		var apiErr *codersdk.Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusConflict, apiErr.StatusCode())
+	})
+}
@@ -358,7 +358,7 @@ func (b *Builder) buildTx(authFunc func(action rbac.Action, object rbac.Objecter
 			return BuildError{code, "insert workspace build", err}
 		}
 
-		names, values, err := b.getParameters()
+		names, values, sources, err := b.getParameters()
 		if err != nil {
 			// getParameters already wraps errors in BuildError
 			return err
@@ -367,6 +367,7 @@ func (b *Builder) buildTx(authFunc func(action rbac.Action, object rbac.Objecter
 			WorkspaceBuildID: workspaceBuildID,
 			Name:             names,
 			Value:            values,
+			Source:           sources,
 		})
 		if err != nil {
 			return BuildError{http.StatusInternalServerError, "insert workspace build parameters: %w", err}
@@ -500,18 +501,18 @@ func (b *Builder) getState() ([]byte, error) {
 	return bld.ProvisionerState, nil
 }
 
-func (b *Builder) getParameters() (names, values []string, err error) {
+func (b *Builder) getParameters() (names, values, sources []string, err error) {
 	templateVersionParameters, err := b.getTemplateVersionParameters()
 	if err != nil {
-		return nil, nil, BuildError{http.StatusInternalServerError, "failed to fetch template version parameters", err}
+		return nil, nil, nil, BuildError{http.StatusInternalServerError, "failed to fetch template version parameters", err}
 	}
 	lastBuildParameters, err := b.getLastBuildParameters()
 	if err != nil {
-		return nil, nil, BuildError{http.StatusInternalServerError, "failed to fetch last build parameters", err}
+		return nil, nil, nil, BuildError{http.StatusInternalServerError, "failed to fetch last build parameters", err}
 	}
 	err = b.verifyNoLegacyParameters()
 	if err != nil {
-		return nil, nil, BuildError{http.StatusBadRequest, "Unable to build workspace with unsupported parameters", err}
+		return nil, nil, nil, BuildError{http.StatusBadRequest, "Unable to build workspace with unsupported parameters", err}
 	}
 	resolver := codersdk.ParameterResolver{
 		Rich: db2sdk.WorkspaceBuildParameters(lastBuildParameters),
@@ -519,9 +520,9 @@ func (b *Builder) getParameters() (names, values []string, err error) {
 	for _, templateVersionParameter := range templateVersionParameters {
 		tvp, err := db2sdk.TemplateVersionParameter(templateVersionParameter)
 		if err != nil {
-			return nil, nil, BuildError{http.StatusInternalServerError, "failed to convert template version parameter", err}
+			return nil, nil, nil, BuildError{http.StatusInternalServerError, "failed to convert template version parameter", err}
 		}
-		value, err := resolver.ValidateResolve(
+		value, source, err := resolver.ValidateResolveSource(
 			tvp,
 			b.findNewBuildParameterValue(templateVersionParameter.Name),
 		)
@@ -529,12 +530,13 @@ func (b *Builder) getParameters() (names, values []string, err error) {
 			// At this point, we've queried all the data we need from the database,
 			// so the only errors are problems with the request (missing data, failed
 			// validation, immutable parameters, etc.)
-			return nil, nil, BuildError{http.StatusBadRequest, fmt.Sprintf("Unable to validate parameter %q", templateVersionParameter.Name), err}
+			return nil, nil, nil, BuildError{http.StatusBadRequest, fmt.Sprintf("Unable to validate parameter %q", templateVersionParameter.Name), err}
 		}
 		names = append(names, templateVersionParameter.Name)
 		values = append(values, value)
+		sources = append(sources, string(source))
 	}
-	return names, values, nil
+	return names, values, sources, nil
 }
 
 func (b *Builder) findNewBuildParameterValue(name string) *codersdk.WorkspaceBuildParameter {
@@ -15,6 +15,7 @@ import (
 	"cloud.google.com/go/compute/metadata"
 	"github.com/google/uuid"
 	"github.com/hashicorp/yamux"
+	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
 	"nhooyr.io/websocket"
 	"storj.io/drpc"
@@ -72,6 +73,77 @@ func (c *Client) GitSSHKey(ctx context.Context) (GitSSHKey, error) {
 	return gitSSHKey, json.NewDecoder(res.Body).Decode(&gitSSHKey)
 }
 
+// AuthorizedKey is a public key of the workspace owner that may authenticate
+// to the SSH server of the agent, e.g. a hardware-backed key. Connections
+// authenticated by coderd are accepted regardless.
+type AuthorizedKey struct {
+	// PublicKey is in the authorized_keys format.
+	PublicKey string `json:"public_key"`
+	// Principals limit the usernames the key may log in as. Any username is
+	// accepted if empty.
+	Principals []string `json:"principals,omitempty"`
+}
+
+type AuthorizedKeysResponse struct {
+	Keys []AuthorizedKey `json:"keys"`
+	// Required makes connections authenticate with one of the keys in
+	// addition to coderd, e.g. to require a hardware-backed key. Reconnecting
+	// PTYs and port forwarding can't present a key, so they're refused.
+	Required bool `json:"required"`
+}
+
+// AuthorizedKeys returns the additional public keys authorized to SSH into
+// the workspace.
+func (c *Client) AuthorizedKeys(ctx context.Context) (AuthorizedKeysResponse, error) {
+	res, err := c.SDK.Request(ctx, http.MethodGet, "/api/v2/workspaceagents/me/authorized-keys", nil)
+	if err != nil {
+		return AuthorizedKeysResponse{}, xerrors.Errorf("execute request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return AuthorizedKeysResponse{}, codersdk.ReadBodyAsError(res)
+	}
+
+	var resp AuthorizedKeysResponse
+	return resp, json.NewDecoder(res.Body).Decode(&resp)
+}
+
+// Manifest fetches the manifest of the agent over the HTTP API.
+func (c *Client) Manifest(ctx context.Context) (Manifest, error) {
+	res, err := c.SDK.Request(ctx, http.MethodGet, "/api/v2/workspaceagents/me/manifest", nil)
+	if err != nil {
+		return Manifest{}, xerrors.Errorf("execute request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return Manifest{}, codersdk.ReadBodyAsError(res)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return Manifest{}, xerrors.Errorf("read manifest: %w", err)
+	}
+	var manifest Manifest
+	err = json.Unmarshal(body, &manifest)
+	if err != nil {
+		return Manifest{}, xerrors.Errorf("decode manifest: %w", err)
+	}
+	// Versions of coderd before display apps were reported omit them.
+	var displayApps struct {
+		DisplayApps json.RawMessage `json:"display_apps"`
+	}
+	err = json.Unmarshal(body, &displayApps)
+	if err != nil {
+		return Manifest{}, xerrors.Errorf("decode manifest: %w", err)
+	}
+	if displayApps.DisplayApps == nil {
+		manifest.DisplayAppsUnset = true
+	}
+	return manifest, nil
+}
+
 type Metadata struct {
 	Key string `json:"key"`
 	codersdk.WorkspaceAgentMetadataResult
@@ -108,6 +180,8 @@ type Manifest struct {
 	OwnerName     string    `json:"owner_name"`
 	WorkspaceID   uuid.UUID `json:"workspace_id"`
 	WorkspaceName string    `json:"workspace_name"`
+	// OwnerEmail is available to scripts as a template variable.
+	OwnerEmail string `json:"owner_email,omitempty"`
 	// GitAuthConfigs stores the number of Git configurations
 	// the Coder deployment has. If this number is >0, we
 	// set up special configuration in the workspace.
@@ -122,6 +196,138 @@ type Manifest struct {
 	DisableDirectConnections bool                                         `json:"disable_direct_connections"`
 	Metadata                 []codersdk.WorkspaceAgentMetadataDescription `json:"metadata"`
 	Scripts                  []codersdk.WorkspaceAgentScript              `json:"scripts"`
+	// ExecPolicy is evaluated for every command users execute over SSH, in
+	// web terminals and as scheduled tasks.
+	ExecPolicy []ExecPolicyRule `json:"exec_policy,omitempty"`
+	// ReconnectingPTYPersistence keeps web terminal sessions running across
+	// agent restarts when they are backed by screen.
+	ReconnectingPTYPersistence bool `json:"reconnecting_pty_persistence,omitempty"`
+	// ReconnectingPTYScrollbackLines bounds the history kept for web
+	// terminal sessions backed by screen.
+	ReconnectingPTYScrollbackLines int `json:"reconnecting_pty_scrollback_lines,omitempty"`
+	// Proxy configures the proxies used by the agent and exported to scripts
+	// and SSH sessions.
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+	// MOTD configures the message shown on login to SSH and web terminal
+	// sessions. If unset, only the contents of MOTDFile are shown.
+	MOTD *MOTDConfig `json:"motd,omitempty"`
+	// CodeServer makes the agent install and supervise code-server, instead
+	// of installing it with a script.
+	CodeServer *CodeServerConfig `json:"code_server,omitempty"`
+	// SSHKeepAlive makes the agent send keepalive requests on SSH
+	// connections, so idle connections aren't dropped by NAT gateways and
+	// firewalls.
+	SSHKeepAlive *SSHKeepAliveConfig `json:"ssh_keepalive,omitempty"`
+	// UpdatePolicy makes the agent replace its binary with newer versions
+	// while the workspace is idle.
+	UpdatePolicy *AgentUpdatePolicy `json:"update_policy,omitempty"`
+	// BuildStatus is the status of the workspace build that created the
+	// agent. Scripts running on build success or failure run once it
+	// completes. It's empty if coderd doesn't report it.
+	BuildStatus codersdk.ProvisionerJobStatus `json:"build_status,omitempty"`
+	// DisplayApps are the display apps enabled for the agent, e.g. to hide
+	// the hints of disabled apps.
+	DisplayApps []codersdk.DisplayApp `json:"display_apps"`
+	// DisplayAppsUnset is set if coderd didn't report the display apps, in
+	// which case all of them are enabled. An empty DisplayApps disables all
+	// of them.
+	DisplayAppsUnset bool `json:"display_apps_unset,omitempty"`
+	// DERPMapFallbacks are the DERP maps the agent fails over to, in order,
+	// when none of the relays of DERPMap are reachable.
+	DERPMapFallbacks []DERPMapSource `json:"derp_map_fallbacks,omitempty"`
+}
+
+// DisplayAppEnabled reports whether the display app is enabled for the
+// agent.
+func (m Manifest) DisplayAppEnabled(app codersdk.DisplayApp) bool {
+	if m.DisplayAppsUnset {
+		return true
+	}
+	return slices.Contains(m.DisplayApps, app)
+}
+
+// AgentUpdateChannelDeployment makes the agent follow the version of the
+// Coder deployment it's connected to.
+const AgentUpdateChannelDeployment = "deployment"
+
+// AgentUpdatePolicy controls the self-update of the agent.
+type AgentUpdatePolicy struct {
+	// Channel is the release channel the agent follows, e.g.
+	// AgentUpdateChannelDeployment. Updates are disabled if it's empty.
+	Channel string `json:"channel"`
+	// VersionRange constrains the versions the agent updates to, e.g.
+	// ">= 2.6.0, < 3.0.0". Any newer version is allowed if it's empty.
+	VersionRange string `json:"version_range,omitempty"`
+	// BinaryURL overrides where the binary is downloaded from, e.g. an
+	// internal mirror. "{os}", "{arch}" and "{version}" are replaced with
+	// the platform of the agent and the version to update to.
+	BinaryURL string `json:"binary_url,omitempty"`
+	// SHA256 is the hex-encoded checksum of the binary of the deployment
+	// for the platform of the agent, sent by coderd. Downloaded binaries
+	// must match it, wherever they're downloaded from, so updates fail if
+	// it's empty.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// SSHKeepAliveConfig configures the keepalive requests the agent sends on
+// SSH connections, like ClientAliveInterval and ClientAliveCountMax of
+// OpenSSH.
+type SSHKeepAliveConfig struct {
+	// IntervalSeconds between keepalive requests. Keepalives are disabled
+	// if it's zero.
+	IntervalSeconds int `json:"interval_seconds"`
+	// CountMax is the number of unanswered keepalive requests after which
+	// the connection is closed. Defaults to 3.
+	CountMax int `json:"count_max,omitempty"`
+}
+
+// CodeServerConfig configures the code-server installed by the agent. It
+// listens on localhost, and coderd adds an app pointing to the port to the
+// agents of templates enabling code-server.
+type CodeServerConfig struct {
+	// Version is the release of code-server to install, e.g. "4.20.0".
+	Version string `json:"version"`
+	// Port defaults to 13337.
+	Port int `json:"port,omitempty"`
+	// Extensions are installed before code-server is started.
+	Extensions []string `json:"extensions,omitempty"`
+	// Checksums are the hex-encoded SHA256 checksums of the release
+	// archives by platform, e.g. "linux-amd64". Agents refuse to install
+	// releases without a matching checksum.
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// MOTDConfig configures the message of the day rendered by the agent.
+type MOTDConfig struct {
+	// Template is a text/template rendered on login. It defaults to the
+	// contents of the MOTD file followed by the deadline and the warnings.
+	Template string `json:"template,omitempty"`
+	// Deadline is when the workspace is stopped automatically.
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// Warnings are outstanding problems of the workspace shown on login,
+	// e.g. a failed build or an outdated template version.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type ExecPolicyAction string
+
+const (
+	// ExecPolicyActionBlock prevents a matching command from executing.
+	ExecPolicyActionBlock ExecPolicyAction = "block"
+	// ExecPolicyActionAudit logs a matching command, but allows it to
+	// execute.
+	ExecPolicyActionAudit ExecPolicyAction = "audit"
+	// ExecPolicyActionAllow allows a matching command to execute, even if a
+	// later block rule matches it.
+	ExecPolicyActionAllow ExecPolicyAction = "allow"
+)
+
+// ExecPolicyRule matches commands by prefix or regular expression. If both
+// are set, both must match, and a rule with neither matches every command.
+type ExecPolicyRule struct {
+	Action ExecPolicyAction `json:"action"`
+	Prefix string           `json:"prefix,omitempty"`
+	Regex  string           `json:"regex,omitempty"`
 }
 
 type LogSource struct {
@@ -134,6 +340,27 @@ type Script struct {
 	Script string `json:"script"`
 }
 
+// BuildInfo returns the build information of the deployment.
+func (c *Client) BuildInfo(ctx context.Context) (codersdk.BuildInfoResponse, error) {
+	return c.SDK.BuildInfo(ctx)
+}
+
+// AgentBinaryURL returns the URL of the agent binary served by the deployment
+// for the platform.
+func (c *Client) AgentBinaryURL(goos, goarch string) *url.URL {
+	return c.SDK.URL.JoinPath("bin", AgentBinaryName(goos, goarch))
+}
+
+// AgentBinaryName returns the name of the binary for the platform served by
+// coderd at /bin.
+func AgentBinaryName(goos, goarch string) string {
+	name := fmt.Sprintf("coder-%s-%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
 // RewriteDERPMap rewrites the DERP map to use the access URL of the SDK as the
 // "embedded relay" access URL. The passed derp map is modified in place.
 //
@@ -224,6 +451,20 @@ func (c *Client) ConnectRPC(ctx context.Context) (drpc.Conn, error) {
 type PostAppHealthsRequest struct {
 	// Healths is a map of the workspace app name and the health of the app.
 	Healths map[uuid.UUID]codersdk.WorkspaceAppHealth
+	// Reports are the results of the latest healthchecks of all apps with
+	// healthchecks, keyed like Healths.
+	Reports map[uuid.UUID]AppHealthReport `json:"reports,omitempty"`
+}
+
+// AppHealthReport is the result of the latest healthcheck of an app.
+type AppHealthReport struct {
+	Health codersdk.WorkspaceAppHealth `json:"health"`
+	// LatencyMilliseconds is how long the latest healthcheck took.
+	LatencyMilliseconds float64 `json:"latency_ms"`
+	// Error is why the latest healthcheck failed, so it's known why an app
+	// is unhealthy.
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
 }
 
 // BatchUpdateAppHealthsClient is a partial interface of proto.DRPCAgentClient.
@@ -427,6 +668,9 @@ type Stats struct {
 
 	// Metrics collected by the agent
 	Metrics []AgentMetric `json:"metrics"`
+	// AppUsage is the usage of apps during the interval, e.g. to find apps
+	// nobody uses in a template.
+	AppUsage []AppUsage `json:"app_usage,omitempty"`
 }
 
 func (s Stats) SessionCount() int64 {
@@ -452,6 +696,27 @@ type AgentMetricLabel struct {
 	Value string `json:"value" validate:"required"`
 }
 
+// AppUsageConnectionType is how an app was connected to.
+type AppUsageConnectionType string
+
+const (
+	AppUsageConnectionTypePath        AppUsageConnectionType = "path"
+	AppUsageConnectionTypeSubdomain   AppUsageConnectionType = "subdomain"
+	AppUsageConnectionTypePortForward AppUsageConnectionType = "port_forward"
+	AppUsageConnectionTypeSSH         AppUsageConnectionType = "ssh"
+)
+
+// AppUsage is the usage of an app during the stats interval.
+type AppUsage struct {
+	Slug           string                 `json:"slug" validate:"required"`
+	ConnectionType AppUsageConnectionType `json:"connection_type" enums:"path,subdomain,port_forward,ssh"`
+	// Duration is how long the app was in use during the interval.
+	Duration time.Duration `json:"duration"`
+	// SessionCount is the number of sessions of the app during the
+	// interval.
+	SessionCount int64 `json:"session_count"`
+}
+
 type StatsResponse struct {
 	// ReportInterval is the duration after which the agent should send stats
 	// again.
@@ -508,6 +773,14 @@ type Log struct {
 	CreatedAt time.Time         `json:"created_at"`
 	Output    string            `json:"output"`
 	Level     codersdk.LogLevel `json:"level"`
+	// Stream is the output stream of the process the log was written to,
+	// if it's known. It allows separating errors from regular output
+	// regardless of the log level.
+	Stream codersdk.LogStream `json:"stream,omitempty"`
+	// Fields are structured key/value fields of the log, e.g. parsed from
+	// the line by a LogsWriterParser. They're stored alongside the output so
+	// logs can be filtered by field.
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 type PatchLogs struct {
@@ -552,6 +825,26 @@ func (c *Client) PostLogSource(ctx context.Context, req PostLogSource) (codersdk
 	return logSource, json.NewDecoder(res.Body).Decode(&logSource)
 }
 
+type ScriptArtifacts struct {
+	// LogSourceID identifies the script that produced the artifacts.
+	LogSourceID uuid.UUID
+	// Archive is a tar archive of the script artifacts directory.
+	Archive io.ReadSeeker
+	// BytesPerSecond limits the bandwidth of the upload. Zero disables the
+	// limit.
+	BytesPerSecond int64
+}
+
+// PostScriptArtifacts uploads the artifacts produced by a workspace agent
+// script so they can be attached to the workspace build. Large archives are
+// uploaded in chunks, see Upload.
+func (c *Client) PostScriptArtifacts(ctx context.Context, req ScriptArtifacts) error {
+	return c.Upload(ctx, fmt.Sprintf("/api/v2/workspaceagents/me/script-artifacts/%s", req.LogSourceID), req.Archive, UploadOptions{
+		BytesPerSecond: req.BytesPerSecond,
+		ContentType:    codersdk.ContentTypeTar,
+	})
+}
+
 type ExternalAuthResponse struct {
 	AccessToken string                 `json:"access_token"`
 	TokenExtra  map[string]interface{} `json:"token_extra"`
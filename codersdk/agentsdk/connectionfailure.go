@@ -0,0 +1,291 @@
+package agentsdk
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/codersdk"
+)
+
+// ConnectionFailureStage is the connection that failed.
+type ConnectionFailureStage string
+
+const (
+	ConnectionFailureStageCoderd ConnectionFailureStage = "coderd"
+	ConnectionFailureStageDERP   ConnectionFailureStage = "derp"
+)
+
+// TLSErrorClass classifies a failed TLS handshake so common misconfigurations
+// can be told apart without parsing error messages.
+type TLSErrorClass string
+
+const (
+	TLSErrorClassNone               TLSErrorClass = ""
+	TLSErrorClassUnknownAuthority   TLSErrorClass = "unknown_authority"
+	TLSErrorClassHostnameMismatch   TLSErrorClass = "hostname_mismatch"
+	TLSErrorClassExpired            TLSErrorClass = "expired"
+	TLSErrorClassInvalidCertificate TLSErrorClass = "invalid_certificate"
+	TLSErrorClassNotTLS             TLSErrorClass = "not_tls"
+	TLSErrorClassHandshake          TLSErrorClass = "handshake"
+)
+
+// ConnectionFailureDNS is the result of resolving the host that couldn't be
+// reached.
+type ConnectionFailureDNS struct {
+	Host      string   `json:"host"`
+	Addresses []string `json:"addresses,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// ConnectionFailure holds diagnostics collected when the agent fails to
+// reach coderd or a DERP server. Failures are reported once the agent is
+// able to connect again.
+type ConnectionFailure struct {
+	Stage ConnectionFailureStage `json:"stage"`
+	URL   string                 `json:"url"`
+	Error string                 `json:"error"`
+	// Count is the number of consecutive failures with the same error.
+	Count       int       `json:"count"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+
+	DNS           ConnectionFailureDNS `json:"dns"`
+	TLSErrorClass TLSErrorClass        `json:"tls_error_class,omitempty"`
+	TLSError      string               `json:"tls_error,omitempty"`
+	// ProxyEnv contains the proxy environment variables of the agent with
+	// credentials redacted.
+	ProxyEnv map[string]string `json:"proxy_env,omitempty"`
+	// CaptivePortal is true if a plain HTTP request to the host was answered
+	// by something other than the host, e.g. a captive portal or an
+	// intercepting proxy.
+	CaptivePortal bool `json:"captive_portal"`
+}
+
+type PostConnectionFailuresRequest struct {
+	Failures []ConnectionFailure `json:"failures"`
+}
+
+// PostConnectionFailures reports connection failures that happened while the
+// agent was unable to reach coderd.
+func (c *Client) PostConnectionFailures(ctx context.Context, req PostConnectionFailuresRequest) error {
+	res, err := c.SDK.Request(ctx, http.MethodPost, "/api/v2/workspaceagents/me/connection-failures", req)
+	if err != nil {
+		return xerrors.Errorf("execute request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return codersdk.ReadBodyAsError(res)
+	}
+	return nil
+}
+
+// DiagnoseConnectionFailure collects diagnostics for a failed connection to
+// coderd.
+func (c *Client) DiagnoseConnectionFailure(ctx context.Context, err error) ConnectionFailure {
+	return DiagnoseConnectionFailure(ctx, c.SDK.HTTPClient, ConnectionFailureStageCoderd, c.SDK.URL, err)
+}
+
+// connectionProbeTimeout bounds each network probe made while diagnosing a
+// failure.
+const connectionProbeTimeout = 5 * time.Second
+
+// proxyEnvVars are the environment variables used by Go and most tools to
+// configure proxies.
+var proxyEnvVars = []string{
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "ALL_PROXY",
+	"http_proxy", "https_proxy", "no_proxy", "all_proxy",
+}
+
+// DiagnoseConnectionFailure collects diagnostics for a failed connection to
+// target. The host is resolved and probed, so this should only be called
+// after a connection failed.
+func DiagnoseConnectionFailure(ctx context.Context, httpClient *http.Client, stage ConnectionFailureStage, target *url.URL, connErr error) ConnectionFailure {
+	now := time.Now()
+	failure := ConnectionFailure{
+		Stage:       stage,
+		URL:         redactURL(target.String()),
+		Error:       connErr.Error(),
+		Count:       1,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+		DNS: ConnectionFailureDNS{
+			Host: target.Hostname(),
+		},
+	}
+
+	for _, name := range proxyEnvVars {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if failure.ProxyEnv == nil {
+			failure.ProxyEnv = make(map[string]string)
+		}
+		failure.ProxyEnv[name] = redactURL(value)
+	}
+
+	dnsCtx, cancel := context.WithTimeout(ctx, connectionProbeTimeout)
+	addrs, err := net.DefaultResolver.LookupHost(dnsCtx, target.Hostname())
+	cancel()
+	if err != nil {
+		failure.DNS.Error = err.Error()
+		// Nothing else can be probed without an address.
+		return failure
+	}
+	failure.DNS.Addresses = addrs
+
+	if target.Scheme == "https" || target.Scheme == "wss" {
+		failure.TLSErrorClass, failure.TLSError = probeTLS(ctx, httpClient, target)
+		if failure.TLSErrorClass == TLSErrorClassNone {
+			failure.TLSErrorClass = classifyTLSError(connErr)
+		}
+	}
+
+	// DERP servers don't serve a health endpoint, so there's nothing to
+	// compare a response against.
+	if stage == ConnectionFailureStageCoderd {
+		failure.CaptivePortal = detectCaptivePortal(ctx, target)
+	}
+	return failure
+}
+
+// probeTLS performs a TLS handshake with the target using the TLS
+// configuration of the HTTP client, if any.
+func probeTLS(ctx context.Context, httpClient *http.Client, target *url.URL) (TLSErrorClass, string) {
+	var config *tls.Config
+	if httpClient != nil {
+		if transport, ok := httpClient.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+			config = transport.TLSClientConfig.Clone()
+		}
+	}
+	if config == nil {
+		config = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	if config.ServerName == "" {
+		config.ServerName = target.Hostname()
+	}
+	port := target.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, connectionProbeTimeout)
+	defer cancel()
+	dialer := &tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(target.Hostname(), port))
+	if err != nil {
+		class := classifyTLSError(err)
+		if class == TLSErrorClassNone {
+			// The connection itself failed, which is already reported
+			// by the original error.
+			return TLSErrorClassNone, ""
+		}
+		return class, err.Error()
+	}
+	_ = conn.Close()
+	return TLSErrorClassNone, ""
+}
+
+func classifyTLSError(err error) TLSErrorClass {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+		verification     *tls.CertificateVerificationError
+	)
+	switch {
+	case err == nil:
+		return TLSErrorClassNone
+	case errors.As(err, &unknownAuthority):
+		return TLSErrorClassUnknownAuthority
+	case errors.As(err, &hostname):
+		return TLSErrorClassHostnameMismatch
+	case errors.As(err, &invalid):
+		if invalid.Reason == x509.Expired {
+			return TLSErrorClassExpired
+		}
+		return TLSErrorClassInvalidCertificate
+	case errors.As(err, &recordHeader):
+		return TLSErrorClassNotTLS
+	case errors.As(err, &verification):
+		return TLSErrorClassInvalidCertificate
+	case strings.Contains(err.Error(), "tls: "):
+		return TLSErrorClassHandshake
+	}
+	return TLSErrorClassNone
+}
+
+// detectCaptivePortal makes a plain HTTP request to the health endpoint of
+// coderd. A redirect to another host, or a successful response that isn't
+// from coderd, indicates the request was intercepted.
+func detectCaptivePortal(ctx context.Context, target *url.URL) bool {
+	probeURL := &url.URL{
+		Scheme: "http",
+		Host:   target.Hostname(),
+		Path:   "/healthz",
+	}
+	if target.Scheme == "http" || target.Scheme == "ws" {
+		probeURL.Host = target.Host
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, connectionProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return false
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 300 && res.StatusCode < 400:
+		location, err := res.Location()
+		if err != nil {
+			return false
+		}
+		// Redirecting to HTTPS on the same host is expected.
+		return location.Hostname() != target.Hostname()
+	case res.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(res.Body, 64))
+		if err != nil {
+			return false
+		}
+		return strings.TrimSpace(string(body)) != "OK"
+	}
+	return false
+}
+
+// redactURL removes the password from URLs, proxy URLs commonly contain
+// credentials.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "redacted")
+	}
+	return u.String()
+}
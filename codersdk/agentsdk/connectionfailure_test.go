@@ -0,0 +1,54 @@
+package agentsdk_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestDiagnoseConnectionFailure(t *testing.T) {
+	t.Parallel()
+
+	t.Run("UnknownAuthority", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		t.Cleanup(srv.Close)
+		srvURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		ctx := testutil.Context(t, testutil.WaitShort)
+		failure := agentsdk.DiagnoseConnectionFailure(ctx, &http.Client{}, agentsdk.ConnectionFailureStageCoderd, srvURL, xerrors.New("failed to dial"))
+		require.Equal(t, agentsdk.ConnectionFailureStageCoderd, failure.Stage)
+		require.Equal(t, "failed to dial", failure.Error)
+		require.Equal(t, 1, failure.Count)
+		require.Equal(t, []string{"127.0.0.1"}, failure.DNS.Addresses)
+		require.Equal(t, agentsdk.TLSErrorClassUnknownAuthority, failure.TLSErrorClass)
+		require.False(t, failure.CaptivePortal)
+
+		// Trusting the certificate resolves the TLS error.
+		failure = agentsdk.DiagnoseConnectionFailure(ctx, srv.Client(), agentsdk.ConnectionFailureStageCoderd, srvURL, xerrors.New("failed to dial"))
+		require.Equal(t, agentsdk.TLSErrorClassNone, failure.TLSErrorClass)
+	})
+
+	t.Run("CaptivePortal", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://portal.example.com/login", http.StatusFound)
+		}))
+		t.Cleanup(srv.Close)
+		srvURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		failure := agentsdk.DiagnoseConnectionFailure(context.Background(), srv.Client(), agentsdk.ConnectionFailureStageCoderd, srvURL, xerrors.New("unexpected status"))
+		require.True(t, failure.CaptivePortal)
+	})
+
+}
@@ -5,8 +5,10 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
 	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/coder/coder/v2/agent/proto"
 	"github.com/coder/coder/v2/codersdk"
@@ -34,6 +36,7 @@ func ManifestFromProto(manifest *proto.Manifest) (Manifest, error) {
 		AgentID:                  agentID,
 		AgentName:                manifest.AgentName,
 		OwnerName:                manifest.OwnerUsername,
+		OwnerEmail:               manifest.OwnerEmail,
 		WorkspaceID:              workspaceID,
 		WorkspaceName:            manifest.WorkspaceName,
 		Apps:                     apps,
@@ -47,6 +50,19 @@ func ManifestFromProto(manifest *proto.Manifest) (Manifest, error) {
 		MOTDFile:                 manifest.MotdPath,
 		DisableDirectConnections: manifest.DisableDirectConnections,
 		Metadata:                 MetadataDescriptionsFromProto(manifest.Metadata),
+		UpdatePolicy:             AgentUpdatePolicyFromProto(manifest.UpdatePolicy),
+		BuildStatus:              BuildStatusFromProto(manifest.BuildStatus),
+		DisplayApps:              DisplayAppsFromProto(manifest.DisplayApps),
+		DisplayAppsUnset:         manifest.DisplayApps == nil,
+		DERPMapFallbacks:         DERPMapSourcesFromProto(manifest.DerpMapFallbacks),
+		ExecPolicy:               ExecPolicyFromProto(manifest.ExecPolicy),
+
+		ReconnectingPTYPersistence:     manifest.ReconnectingPtyPersistence,
+		ReconnectingPTYScrollbackLines: int(manifest.ReconnectingPtyScrollbackLines),
+		Proxy:                          ProxyConfigFromProto(manifest.Proxy),
+		MOTD:                           MOTDConfigFromProto(manifest.Motd),
+		CodeServer:                     CodeServerConfigFromProto(manifest.CodeServer),
+		SSHKeepAlive:                   SSHKeepAliveConfigFromProto(manifest.SshKeepalive),
 	}, nil
 }
 
@@ -55,10 +71,15 @@ func ProtoFromManifest(manifest Manifest) (*proto.Manifest, error) {
 	if err != nil {
 		return nil, xerrors.Errorf("convert workspace apps: %w", err)
 	}
+	execPolicy, err := ProtoFromExecPolicy(manifest.ExecPolicy)
+	if err != nil {
+		return nil, xerrors.Errorf("convert exec policy: %w", err)
+	}
 	return &proto.Manifest{
 		AgentId:                  manifest.AgentID[:],
 		AgentName:                manifest.AgentName,
 		OwnerUsername:            manifest.OwnerName,
+		OwnerEmail:               manifest.OwnerEmail,
 		WorkspaceId:              manifest.WorkspaceID[:],
 		WorkspaceName:            manifest.WorkspaceName,
 		GitAuthConfigs:           uint32(manifest.GitAuthConfigs),
@@ -72,9 +93,283 @@ func ProtoFromManifest(manifest Manifest) (*proto.Manifest, error) {
 		Scripts:                  ProtoFromScripts(manifest.Scripts),
 		Apps:                     apps,
 		Metadata:                 ProtoFromMetadataDescriptions(manifest.Metadata),
+		UpdatePolicy:             ProtoFromAgentUpdatePolicy(manifest.UpdatePolicy),
+		BuildStatus:              ProtoFromBuildStatus(manifest.BuildStatus),
+		DisplayApps:              protoFromManifestDisplayApps(manifest),
+		DerpMapFallbacks:         ProtoFromDERPMapSources(manifest.DERPMapFallbacks),
+		ExecPolicy:               execPolicy,
+
+		ReconnectingPtyPersistence:     manifest.ReconnectingPTYPersistence,
+		ReconnectingPtyScrollbackLines: int32(manifest.ReconnectingPTYScrollbackLines),
+		Proxy:                          ProtoFromProxyConfig(manifest.Proxy),
+		Motd:                           ProtoFromMOTDConfig(manifest.MOTD),
+		CodeServer:                     ProtoFromCodeServerConfig(manifest.CodeServer),
+		SshKeepalive:                   ProtoFromSSHKeepAliveConfig(manifest.SSHKeepAlive),
 	}, nil
 }
 
+// ExecPolicyFromProto converts the exec policy of a manifest. Actions unknown
+// to the agent are kept, so they're reported when commands match them.
+func ExecPolicyFromProto(rules []*proto.ExecPolicyRule) []ExecPolicyRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	converted := make([]ExecPolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		converted = append(converted, ExecPolicyRule{
+			Action: ExecPolicyAction(strings.ToLower(rule.Action.String())),
+			Prefix: rule.Prefix,
+			Regex:  rule.Regex,
+		})
+	}
+	return converted
+}
+
+func ProtoFromExecPolicy(rules []ExecPolicyRule) ([]*proto.ExecPolicyRule, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	converted := make([]*proto.ExecPolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		action, ok := proto.ExecPolicyRule_Action_value[strings.ToUpper(string(rule.Action))]
+		if !ok {
+			return nil, xerrors.Errorf("unknown exec policy action: %q", rule.Action)
+		}
+		converted = append(converted, &proto.ExecPolicyRule{
+			Action: proto.ExecPolicyRule_Action(action),
+			Prefix: rule.Prefix,
+			Regex:  rule.Regex,
+		})
+	}
+	return converted, nil
+}
+
+// DERPMapSourcesFromProto converts the DERP map fallbacks of a manifest,
+// keeping their order.
+func DERPMapSourcesFromProto(sources []*proto.DERPMapSource) []DERPMapSource {
+	if len(sources) == 0 {
+		return nil
+	}
+	converted := make([]DERPMapSource, 0, len(sources))
+	for _, source := range sources {
+		converted = append(converted, DERPMapSource{
+			Name:    source.Name,
+			DERPMap: tailnet.DERPMapFromProto(source.DerpMap),
+		})
+	}
+	return converted
+}
+
+func ProtoFromDERPMapSources(sources []DERPMapSource) []*proto.DERPMapSource {
+	if len(sources) == 0 {
+		return nil
+	}
+	converted := make([]*proto.DERPMapSource, 0, len(sources))
+	for _, source := range sources {
+		converted = append(converted, &proto.DERPMapSource{
+			Name:    source.Name,
+			DerpMap: tailnet.DERPMapToProto(source.DERPMap),
+		})
+	}
+	return converted
+}
+
+// BuildStatusFromProto returns the status of the workspace build, which is
+// empty if coderd didn't report it.
+func BuildStatusFromProto(status proto.Manifest_BuildStatus) codersdk.ProvisionerJobStatus {
+	switch status {
+	case proto.Manifest_RUNNING:
+		return codersdk.ProvisionerJobRunning
+	case proto.Manifest_SUCCEEDED:
+		return codersdk.ProvisionerJobSucceeded
+	case proto.Manifest_FAILED:
+		return codersdk.ProvisionerJobFailed
+	default:
+		return ""
+	}
+}
+
+// ProtoFromBuildStatus returns the status of the workspace build as
+// reported to agents, which don't distinguish pending from running builds,
+// nor canceled from failed builds.
+func ProtoFromBuildStatus(status codersdk.ProvisionerJobStatus) proto.Manifest_BuildStatus {
+	switch status {
+	case codersdk.ProvisionerJobPending, codersdk.ProvisionerJobRunning:
+		return proto.Manifest_RUNNING
+	case codersdk.ProvisionerJobSucceeded:
+		return proto.Manifest_SUCCEEDED
+	case codersdk.ProvisionerJobCanceling, codersdk.ProvisionerJobCanceled, codersdk.ProvisionerJobFailed:
+		return proto.Manifest_FAILED
+	default:
+		return proto.Manifest_BUILD_STATUS_UNSPECIFIED
+	}
+}
+
+// DisplayAppsFromProto returns the enabled display apps. They're nil if
+// coderd didn't report them, see Manifest.DisplayAppsUnset.
+func DisplayAppsFromProto(apps *proto.DisplayApps) []codersdk.DisplayApp {
+	if apps == nil {
+		return nil
+	}
+	enabled := []codersdk.DisplayApp{}
+	if apps.Vscode {
+		enabled = append(enabled, codersdk.DisplayAppVSCodeDesktop)
+	}
+	if apps.VscodeInsiders {
+		enabled = append(enabled, codersdk.DisplayAppVSCodeInsiders)
+	}
+	if apps.WebTerminal {
+		enabled = append(enabled, codersdk.DisplayAppWebTerminal)
+	}
+	if apps.SshHelper {
+		enabled = append(enabled, codersdk.DisplayAppSSH)
+	}
+	if apps.PortForwardingHelper {
+		enabled = append(enabled, codersdk.DisplayAppPortForward)
+	}
+	return enabled
+}
+
+// ProtoFromDisplayApps returns the enabled display apps. coderd always
+// reports them, even if none are enabled.
+func ProtoFromDisplayApps(apps []codersdk.DisplayApp) *proto.DisplayApps {
+	return &proto.DisplayApps{
+		Vscode:               slices.Contains(apps, codersdk.DisplayAppVSCodeDesktop),
+		VscodeInsiders:       slices.Contains(apps, codersdk.DisplayAppVSCodeInsiders),
+		WebTerminal:          slices.Contains(apps, codersdk.DisplayAppWebTerminal),
+		SshHelper:            slices.Contains(apps, codersdk.DisplayAppSSH),
+		PortForwardingHelper: slices.Contains(apps, codersdk.DisplayAppPortForward),
+	}
+}
+
+// protoFromManifestDisplayApps omits the display apps if they're unset, so
+// they stay unset on the other end.
+func protoFromManifestDisplayApps(manifest Manifest) *proto.DisplayApps {
+	if manifest.DisplayAppsUnset {
+		return nil
+	}
+	return ProtoFromDisplayApps(manifest.DisplayApps)
+}
+
+func AgentUpdatePolicyFromProto(policy *proto.AgentUpdatePolicy) *AgentUpdatePolicy {
+	if policy == nil {
+		return nil
+	}
+	return &AgentUpdatePolicy{
+		Channel:      policy.Channel,
+		VersionRange: policy.VersionRange,
+		BinaryURL:    policy.BinaryUrl,
+		SHA256:       policy.Sha256,
+	}
+}
+
+func ProtoFromAgentUpdatePolicy(policy *AgentUpdatePolicy) *proto.AgentUpdatePolicy {
+	if policy == nil {
+		return nil
+	}
+	return &proto.AgentUpdatePolicy{
+		Channel:      policy.Channel,
+		VersionRange: policy.VersionRange,
+		BinaryUrl:    policy.BinaryURL,
+		Sha256:       policy.SHA256,
+	}
+}
+
+func ProxyConfigFromProto(proxy *proto.ProxyConfig) *ProxyConfig {
+	if proxy == nil {
+		return nil
+	}
+	return &ProxyConfig{
+		HTTPProxy:  proxy.HttpProxy,
+		HTTPSProxy: proxy.HttpsProxy,
+		NoProxy:    proxy.NoProxy,
+	}
+}
+
+func ProtoFromProxyConfig(proxy *ProxyConfig) *proto.ProxyConfig {
+	if proxy == nil {
+		return nil
+	}
+	return &proto.ProxyConfig{
+		HttpProxy:  proxy.HTTPProxy,
+		HttpsProxy: proxy.HTTPSProxy,
+		NoProxy:    proxy.NoProxy,
+	}
+}
+
+func MOTDConfigFromProto(motd *proto.MOTDConfig) *MOTDConfig {
+	if motd == nil {
+		return nil
+	}
+	converted := &MOTDConfig{
+		Template: motd.Template,
+		Warnings: motd.Warnings,
+	}
+	if motd.Deadline != nil {
+		deadline := motd.Deadline.AsTime()
+		converted.Deadline = &deadline
+	}
+	return converted
+}
+
+func ProtoFromMOTDConfig(motd *MOTDConfig) *proto.MOTDConfig {
+	if motd == nil {
+		return nil
+	}
+	converted := &proto.MOTDConfig{
+		Template: motd.Template,
+		Warnings: motd.Warnings,
+	}
+	if motd.Deadline != nil {
+		converted.Deadline = timestamppb.New(*motd.Deadline)
+	}
+	return converted
+}
+
+func CodeServerConfigFromProto(config *proto.CodeServerConfig) *CodeServerConfig {
+	if config == nil {
+		return nil
+	}
+	return &CodeServerConfig{
+		Version:    config.Version,
+		Port:       int(config.Port),
+		Extensions: config.Extensions,
+		Checksums:  config.Checksums,
+	}
+}
+
+func ProtoFromCodeServerConfig(config *CodeServerConfig) *proto.CodeServerConfig {
+	if config == nil {
+		return nil
+	}
+	return &proto.CodeServerConfig{
+		Version:    config.Version,
+		Port:       int32(config.Port),
+		Extensions: config.Extensions,
+		Checksums:  config.Checksums,
+	}
+}
+
+func SSHKeepAliveConfigFromProto(config *proto.SSHKeepAliveConfig) *SSHKeepAliveConfig {
+	if config == nil {
+		return nil
+	}
+	return &SSHKeepAliveConfig{
+		IntervalSeconds: int(config.IntervalSeconds),
+		CountMax:        int(config.CountMax),
+	}
+}
+
+func ProtoFromSSHKeepAliveConfig(config *SSHKeepAliveConfig) *proto.SSHKeepAliveConfig {
+	if config == nil {
+		return nil
+	}
+	return &proto.SSHKeepAliveConfig{
+		IntervalSeconds: int32(config.IntervalSeconds),
+		CountMax:        int32(config.CountMax),
+	}
+}
+
 func MetadataDescriptionsFromProto(descriptions []*proto.WorkspaceAgentMetadata_Description) []codersdk.WorkspaceAgentMetadataDescription {
 	ret := make([]codersdk.WorkspaceAgentMetadataDescription, len(descriptions))
 	for i, description := range descriptions {
@@ -98,6 +393,7 @@ func MetadataDescriptionFromProto(description *proto.WorkspaceAgentMetadata_Desc
 		Script:      description.Script,
 		Interval:    int64(description.Interval.AsDuration()),
 		Timeout:     int64(description.Timeout.AsDuration()),
+		Collector:   codersdk.WorkspaceAgentMetadataCollector(description.Collector),
 	}
 }
 
@@ -108,6 +404,7 @@ func ProtoFromMetadataDescription(d codersdk.WorkspaceAgentMetadataDescription)
 		Script:      d.Script,
 		Interval:    durationpb.New(time.Duration(d.Interval)),
 		Timeout:     durationpb.New(time.Duration(d.Timeout)),
+		Collector:   string(d.Collector),
 	}
 }
 
@@ -138,27 +435,41 @@ func AgentScriptFromProto(protoScript *proto.WorkspaceAgentScript) (codersdk.Wor
 	}
 
 	return codersdk.WorkspaceAgentScript{
-		LogSourceID:      id,
-		LogPath:          protoScript.LogPath,
-		Script:           protoScript.Script,
-		Cron:             protoScript.Cron,
-		RunOnStart:       protoScript.RunOnStart,
-		RunOnStop:        protoScript.RunOnStop,
-		StartBlocksLogin: protoScript.StartBlocksLogin,
-		Timeout:          protoScript.Timeout.AsDuration(),
+		LogSourceID:           id,
+		LogPath:               protoScript.LogPath,
+		Script:                protoScript.Script,
+		Cron:                  protoScript.Cron,
+		RunOnStart:            protoScript.RunOnStart,
+		RunOnStop:             protoScript.RunOnStop,
+		StartBlocksLogin:      protoScript.StartBlocksLogin,
+		Timeout:               protoScript.Timeout.AsDuration(),
+		RunOnBuildSuccess:     protoScript.RunOnBuildSuccess,
+		RunOnBuildFailure:     protoScript.RunOnBuildFailure,
+		RunOnPostStart:        protoScript.RunOnPostStart,
+		Login:                 protoScript.Login,
+		DiskPressurePath:      protoScript.DiskPressurePath,
+		DiskPressureThreshold: protoScript.DiskPressureThreshold,
+		DisplayName:           protoScript.DisplayName,
 	}, nil
 }
 
 func ProtoFromScript(s codersdk.WorkspaceAgentScript) *proto.WorkspaceAgentScript {
 	return &proto.WorkspaceAgentScript{
-		LogSourceId:      s.LogSourceID[:],
-		LogPath:          s.LogPath,
-		Script:           s.Script,
-		Cron:             s.Cron,
-		RunOnStart:       s.RunOnStart,
-		RunOnStop:        s.RunOnStop,
-		StartBlocksLogin: s.StartBlocksLogin,
-		Timeout:          durationpb.New(s.Timeout),
+		LogSourceId:           s.LogSourceID[:],
+		LogPath:               s.LogPath,
+		Script:                s.Script,
+		Cron:                  s.Cron,
+		RunOnStart:            s.RunOnStart,
+		RunOnStop:             s.RunOnStop,
+		StartBlocksLogin:      s.StartBlocksLogin,
+		Timeout:               durationpb.New(s.Timeout),
+		RunOnBuildSuccess:     s.RunOnBuildSuccess,
+		RunOnBuildFailure:     s.RunOnBuildFailure,
+		RunOnPostStart:        s.RunOnPostStart,
+		Login:                 s.Login,
+		DiskPressurePath:      s.DiskPressurePath,
+		DiskPressureThreshold: s.DiskPressureThreshold,
+		DisplayName:           s.DisplayName,
 	}
 }
 
@@ -291,10 +602,257 @@ func ProtoFromAppHealthsRequest(req PostAppHealthsRequest) (*proto.BatchUpdateAp
 		// one in the list).
 		var idCopy uuid.UUID
 		copy(idCopy[:], id[:])
-		pReq.Updates = append(pReq.Updates, &proto.BatchUpdateAppHealthRequest_HealthUpdate{
+		update := &proto.BatchUpdateAppHealthRequest_HealthUpdate{
 			Id:     idCopy[:],
 			Health: proto.AppHealth(hp),
-		})
+		}
+		if report, ok := req.Reports[id]; ok && !report.CheckedAt.IsZero() {
+			update.LatencyMs = report.LatencyMilliseconds
+			update.Error = report.Error
+			update.CheckedAt = timestamppb.New(report.CheckedAt)
+		}
+		pReq.Updates = append(pReq.Updates, update)
 	}
 	return pReq, nil
 }
+
+func StatsFromProto(s *proto.Stats) *Stats {
+	stats := &Stats{
+		ConnectionsByProto:          s.ConnectionsByProto,
+		ConnectionCount:             s.ConnectionCount,
+		ConnectionMedianLatencyMS:   s.ConnectionMedianLatencyMs,
+		RxPackets:                   s.RxPackets,
+		RxBytes:                     s.RxBytes,
+		TxPackets:                   s.TxPackets,
+		TxBytes:                     s.TxBytes,
+		SessionCountVSCode:          s.SessionCountVscode,
+		SessionCountJetBrains:       s.SessionCountJetbrains,
+		SessionCountReconnectingPTY: s.SessionCountReconnectingPty,
+		SessionCountSSH:             s.SessionCountSsh,
+	}
+	for _, m := range s.Metrics {
+		metric := AgentMetric{
+			Name:  m.Name,
+			Type:  AgentMetricType(strings.ToLower(m.Type.String())),
+			Value: m.Value,
+		}
+		for _, l := range m.Labels {
+			metric.Labels = append(metric.Labels, AgentMetricLabel{Name: l.Name, Value: l.Value})
+		}
+		stats.Metrics = append(stats.Metrics, metric)
+	}
+	for _, u := range s.AppUsage {
+		usage := AppUsage{
+			Slug:         u.Slug,
+			Duration:     u.Duration.AsDuration(),
+			SessionCount: u.SessionCount,
+		}
+		if u.ConnectionType != proto.Stats_AppUsage_CONNECTION_TYPE_UNSPECIFIED {
+			usage.ConnectionType = AppUsageConnectionType(strings.ToLower(u.ConnectionType.String()))
+		}
+		stats.AppUsage = append(stats.AppUsage, usage)
+	}
+	return stats
+}
+
+func ProtoFromStats(s *Stats) (*proto.Stats, error) {
+	stats := &proto.Stats{
+		ConnectionsByProto:          s.ConnectionsByProto,
+		ConnectionCount:             s.ConnectionCount,
+		ConnectionMedianLatencyMs:   s.ConnectionMedianLatencyMS,
+		RxPackets:                   s.RxPackets,
+		RxBytes:                     s.RxBytes,
+		TxPackets:                   s.TxPackets,
+		TxBytes:                     s.TxBytes,
+		SessionCountVscode:          s.SessionCountVSCode,
+		SessionCountJetbrains:       s.SessionCountJetBrains,
+		SessionCountReconnectingPty: s.SessionCountReconnectingPTY,
+		SessionCountSsh:             s.SessionCountSSH,
+	}
+	for _, m := range s.Metrics {
+		t, ok := proto.Stats_Metric_Type_value[strings.ToUpper(string(m.Type))]
+		if !ok {
+			return nil, xerrors.Errorf("unknown metric type: %s", m.Type)
+		}
+		metric := &proto.Stats_Metric{
+			Name:  m.Name,
+			Type:  proto.Stats_Metric_Type(t),
+			Value: m.Value,
+		}
+		for _, l := range m.Labels {
+			metric.Labels = append(metric.Labels, &proto.Stats_Metric_Label{Name: l.Name, Value: l.Value})
+		}
+		stats.Metrics = append(stats.Metrics, metric)
+	}
+	for _, u := range s.AppUsage {
+		var connectionType proto.Stats_AppUsage_ConnectionType
+		if u.ConnectionType != "" {
+			ct, ok := proto.Stats_AppUsage_ConnectionType_value[strings.ToUpper(string(u.ConnectionType))]
+			if !ok {
+				return nil, xerrors.Errorf("unknown app usage connection type: %s", u.ConnectionType)
+			}
+			connectionType = proto.Stats_AppUsage_ConnectionType(ct)
+		}
+		stats.AppUsage = append(stats.AppUsage, &proto.Stats_AppUsage{
+			Slug:           u.Slug,
+			ConnectionType: connectionType,
+			Duration:       durationpb.New(u.Duration),
+			SessionCount:   u.SessionCount,
+		})
+	}
+	return stats, nil
+}
+
+func LogsFromProto(req *proto.BatchCreateLogsRequest) (PatchLogs, error) {
+	sourceID, err := uuid.FromBytes(req.LogSourceId)
+	if err != nil {
+		return PatchLogs{}, xerrors.Errorf("parse log source ID: %w", err)
+	}
+	logs := PatchLogs{
+		LogSourceID: sourceID,
+		Logs:        make([]Log, 0, len(req.Logs)),
+	}
+	for _, l := range req.Logs {
+		logs.Logs = append(logs.Logs, Log{
+			CreatedAt: l.CreatedAt.AsTime(),
+			Output:    l.Output,
+			Level:     codersdk.LogLevel(strings.ToLower(l.Level.String())),
+			Stream:    logStreamFromProto(l.Stream),
+			Fields:    l.Fields,
+		})
+	}
+	return logs, nil
+}
+
+func MetadataFromProto(req *proto.BatchUpdateMetadataRequest) PostMetadataRequest {
+	metadata := PostMetadataRequest{
+		Metadata: make([]Metadata, 0, len(req.Metadata)),
+	}
+	for _, m := range req.Metadata {
+		metadata.Metadata = append(metadata.Metadata, Metadata{
+			Key: m.Key,
+			WorkspaceAgentMetadataResult: codersdk.WorkspaceAgentMetadataResult{
+				CollectedAt: m.Result.GetCollectedAt().AsTime(),
+				Age:         m.Result.GetAge(),
+				Value:       m.Result.GetValue(),
+				Error:       m.Result.GetError(),
+			},
+		})
+	}
+	return metadata
+}
+
+func ProtoFromLog(log Log) (*proto.Log, error) {
+	level, ok := proto.Log_Level_value[strings.ToUpper(string(log.Level))]
+	if !ok {
+		return nil, xerrors.Errorf("unknown log level: %s", log.Level)
+	}
+	return &proto.Log{
+		CreatedAt: timestamppb.New(log.CreatedAt),
+		Output:    log.Output,
+		Level:     proto.Log_Level(level),
+		Stream:    protoFromLogStream(log.Stream),
+		Fields:    log.Fields,
+	}, nil
+}
+
+func logStreamFromProto(stream proto.Log_Stream) codersdk.LogStream {
+	if stream == proto.Log_STREAM_UNSPECIFIED {
+		return ""
+	}
+	return codersdk.LogStream(strings.ToLower(stream.String()))
+}
+
+func protoFromLogStream(stream codersdk.LogStream) proto.Log_Stream {
+	// Unknown streams are sent as unspecified rather than failing the
+	// whole batch, the stream is only informational.
+	return proto.Log_Stream(proto.Log_Stream_value[strings.ToUpper(string(stream))])
+}
+
+func LogSourceRequestFromProto(req *proto.CreateLogSourceRequest) (PostLogSource, error) {
+	id, err := uuid.FromBytes(req.Id)
+	if err != nil {
+		return PostLogSource{}, xerrors.Errorf("parse log source ID: %w", err)
+	}
+	return PostLogSource{
+		ID:          id,
+		DisplayName: req.DisplayName,
+		Icon:        req.Icon,
+	}, nil
+}
+
+func ProtoFromLogSourceRequest(req PostLogSource) *proto.CreateLogSourceRequest {
+	return &proto.CreateLogSourceRequest{
+		Id:          req.ID[:],
+		DisplayName: req.DisplayName,
+		Icon:        req.Icon,
+	}
+}
+
+func LogSourceFromProto(protoSource *proto.LogSource) (codersdk.WorkspaceAgentLogSource, error) {
+	id, err := uuid.FromBytes(protoSource.Id)
+	if err != nil {
+		return codersdk.WorkspaceAgentLogSource{}, xerrors.Errorf("parse log source ID: %w", err)
+	}
+	agentID, err := uuid.FromBytes(protoSource.WorkspaceAgentId)
+	if err != nil {
+		return codersdk.WorkspaceAgentLogSource{}, xerrors.Errorf("parse workspace agent ID: %w", err)
+	}
+	return codersdk.WorkspaceAgentLogSource{
+		WorkspaceAgentID: agentID,
+		ID:               id,
+		CreatedAt:        protoSource.CreatedAt.AsTime(),
+		DisplayName:      protoSource.DisplayName,
+		Icon:             protoSource.Icon,
+	}, nil
+}
+
+func ProtoFromLogSource(source codersdk.WorkspaceAgentLogSource) *proto.LogSource {
+	return &proto.LogSource{
+		Id:               source.ID[:],
+		WorkspaceAgentId: source.WorkspaceAgentID[:],
+		CreatedAt:        timestamppb.New(source.CreatedAt),
+		DisplayName:      source.DisplayName,
+		Icon:             source.Icon,
+	}
+}
+
+func NotificationFromProto(protoNotification *proto.Notification) (Notification, error) {
+	if protoNotification == nil {
+		return Notification{}, xerrors.New("notification is required")
+	}
+	var severity NotificationSeverity
+	switch protoNotification.Severity {
+	case proto.Notification_INFO:
+		severity = NotificationSeverityInfo
+	case proto.Notification_WARNING:
+		severity = NotificationSeverityWarning
+	case proto.Notification_ERROR:
+		severity = NotificationSeverityError
+	default:
+		return Notification{}, xerrors.Errorf("unknown notification severity: %s", protoNotification.Severity)
+	}
+	return Notification{
+		Severity:  severity,
+		Kind:      protoNotification.Kind,
+		Title:     protoNotification.Title,
+		Message:   protoNotification.Message,
+		CreatedAt: protoNotification.CreatedAt.AsTime(),
+		Labels:    protoNotification.Labels,
+	}, nil
+}
+
+func ProtoFromNotification(notification Notification) (*proto.Notification, error) {
+	severity, ok := proto.Notification_Severity_value[strings.ToUpper(string(notification.Severity))]
+	if !ok {
+		return nil, xerrors.Errorf("unknown notification severity: %s", notification.Severity)
+	}
+	return &proto.Notification{
+		Severity:  proto.Notification_Severity(severity),
+		Kind:      notification.Kind,
+		Title:     notification.Title,
+		Message:   notification.Message,
+		CreatedAt: timestamppb.New(notification.CreatedAt),
+		Labels:    notification.Labels,
+	}, nil
+}
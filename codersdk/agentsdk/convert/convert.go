@@ -0,0 +1,247 @@
+// Package convert converts between the types of the agent API in
+// github.com/coder/coder/v2/agent/proto and the types of the SDK.
+//
+// The conversions are the reference for the wire format of the agent API.
+// Alternative agent implementations can verify they are compatible by
+// encoding the SDK fixtures in testdata and comparing the result with the
+// golden protobuf JSON files next to them. The functions of this package are
+// stable; changes to the conversions must keep the fixtures valid.
+package convert
+
+import (
+	"github.com/coder/coder/v2/agent/proto"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+// ManifestFromProto converts a manifest received from the agent API. It
+// fails if the agent or workspace ID isn't a UUID, or an app or script is
+// invalid.
+func ManifestFromProto(manifest *proto.Manifest) (agentsdk.Manifest, error) {
+	return agentsdk.ManifestFromProto(manifest)
+}
+
+// ProtoFromManifest converts a manifest to its wire format. It fails if an
+// app is invalid or an exec policy action is unknown.
+func ProtoFromManifest(manifest agentsdk.Manifest) (*proto.Manifest, error) {
+	return agentsdk.ProtoFromManifest(manifest)
+}
+
+// ExecPolicyFromProto converts the exec policy of a manifest. Actions unknown
+// to the SDK are kept.
+func ExecPolicyFromProto(rules []*proto.ExecPolicyRule) []agentsdk.ExecPolicyRule {
+	return agentsdk.ExecPolicyFromProto(rules)
+}
+
+// ProtoFromExecPolicy converts the exec policy of a manifest to its wire
+// format. It fails on unknown actions.
+func ProtoFromExecPolicy(rules []agentsdk.ExecPolicyRule) ([]*proto.ExecPolicyRule, error) {
+	return agentsdk.ProtoFromExecPolicy(rules)
+}
+
+// DERPMapSourcesFromProto converts the DERP maps an agent fails over to.
+func DERPMapSourcesFromProto(sources []*proto.DERPMapSource) []agentsdk.DERPMapSource {
+	return agentsdk.DERPMapSourcesFromProto(sources)
+}
+
+// ProtoFromDERPMapSources converts the DERP maps an agent fails over to to
+// their wire format.
+func ProtoFromDERPMapSources(sources []agentsdk.DERPMapSource) []*proto.DERPMapSource {
+	return agentsdk.ProtoFromDERPMapSources(sources)
+}
+
+// DisplayAppsFromProto converts the display apps enabled for an agent. They're
+// nil if coderd didn't report them, see agentsdk.Manifest.DisplayAppsUnset.
+func DisplayAppsFromProto(apps *proto.DisplayApps) []codersdk.DisplayApp {
+	return agentsdk.DisplayAppsFromProto(apps)
+}
+
+// ProtoFromDisplayApps converts the display apps enabled for an agent to
+// their wire format.
+func ProtoFromDisplayApps(apps []codersdk.DisplayApp) *proto.DisplayApps {
+	return agentsdk.ProtoFromDisplayApps(apps)
+}
+
+// BuildStatusFromProto converts the status of the workspace build that
+// created an agent. It's empty if the status is unspecified.
+func BuildStatusFromProto(status proto.Manifest_BuildStatus) codersdk.ProvisionerJobStatus {
+	return agentsdk.BuildStatusFromProto(status)
+}
+
+// ProtoFromBuildStatus converts the status of the workspace build that
+// created an agent to its wire format.
+func ProtoFromBuildStatus(status codersdk.ProvisionerJobStatus) proto.Manifest_BuildStatus {
+	return agentsdk.ProtoFromBuildStatus(status)
+}
+
+// AgentUpdatePolicyFromProto converts the self-update policy of an agent.
+func AgentUpdatePolicyFromProto(policy *proto.AgentUpdatePolicy) *agentsdk.AgentUpdatePolicy {
+	return agentsdk.AgentUpdatePolicyFromProto(policy)
+}
+
+// ProtoFromAgentUpdatePolicy converts the self-update policy of an agent to
+// its wire format.
+func ProtoFromAgentUpdatePolicy(policy *agentsdk.AgentUpdatePolicy) *proto.AgentUpdatePolicy {
+	return agentsdk.ProtoFromAgentUpdatePolicy(policy)
+}
+
+// ProxyConfigFromProto converts the proxies used by an agent.
+func ProxyConfigFromProto(proxy *proto.ProxyConfig) *agentsdk.ProxyConfig {
+	return agentsdk.ProxyConfigFromProto(proxy)
+}
+
+// ProtoFromProxyConfig converts the proxies used by an agent to their wire
+// format.
+func ProtoFromProxyConfig(proxy *agentsdk.ProxyConfig) *proto.ProxyConfig {
+	return agentsdk.ProtoFromProxyConfig(proxy)
+}
+
+// MOTDConfigFromProto converts the message shown on login.
+func MOTDConfigFromProto(motd *proto.MOTDConfig) *agentsdk.MOTDConfig {
+	return agentsdk.MOTDConfigFromProto(motd)
+}
+
+// ProtoFromMOTDConfig converts the message shown on login to its wire
+// format.
+func ProtoFromMOTDConfig(motd *agentsdk.MOTDConfig) *proto.MOTDConfig {
+	return agentsdk.ProtoFromMOTDConfig(motd)
+}
+
+// CodeServerConfigFromProto converts the code-server installation an agent
+// supervises.
+func CodeServerConfigFromProto(config *proto.CodeServerConfig) *agentsdk.CodeServerConfig {
+	return agentsdk.CodeServerConfigFromProto(config)
+}
+
+// ProtoFromCodeServerConfig converts the code-server installation an agent
+// supervises to its wire format.
+func ProtoFromCodeServerConfig(config *agentsdk.CodeServerConfig) *proto.CodeServerConfig {
+	return agentsdk.ProtoFromCodeServerConfig(config)
+}
+
+// SSHKeepAliveConfigFromProto converts the keepalives an agent sends on SSH
+// connections.
+func SSHKeepAliveConfigFromProto(config *proto.SSHKeepAliveConfig) *agentsdk.SSHKeepAliveConfig {
+	return agentsdk.SSHKeepAliveConfigFromProto(config)
+}
+
+// ProtoFromSSHKeepAliveConfig converts the keepalives an agent sends on SSH
+// connections to their wire format.
+func ProtoFromSSHKeepAliveConfig(config *agentsdk.SSHKeepAliveConfig) *proto.SSHKeepAliveConfig {
+	return agentsdk.ProtoFromSSHKeepAliveConfig(config)
+}
+
+// MetadataDescriptionsFromProto converts the metadata an agent collects.
+func MetadataDescriptionsFromProto(descriptions []*proto.WorkspaceAgentMetadata_Description) []codersdk.WorkspaceAgentMetadataDescription {
+	return agentsdk.MetadataDescriptionsFromProto(descriptions)
+}
+
+// ProtoFromMetadataDescriptions converts the metadata an agent collects to
+// its wire format.
+func ProtoFromMetadataDescriptions(descriptions []codersdk.WorkspaceAgentMetadataDescription) []*proto.WorkspaceAgentMetadata_Description {
+	return agentsdk.ProtoFromMetadataDescriptions(descriptions)
+}
+
+// MetadataDescriptionFromProto converts a single metadata description.
+func MetadataDescriptionFromProto(description *proto.WorkspaceAgentMetadata_Description) codersdk.WorkspaceAgentMetadataDescription {
+	return agentsdk.MetadataDescriptionFromProto(description)
+}
+
+// ProtoFromMetadataDescription converts a single metadata description to
+// its wire format.
+func ProtoFromMetadataDescription(description codersdk.WorkspaceAgentMetadataDescription) *proto.WorkspaceAgentMetadata_Description {
+	return agentsdk.ProtoFromMetadataDescription(description)
+}
+
+// AgentScriptsFromProto converts the scripts of an agent. It fails if the
+// log source of a script isn't a UUID.
+func AgentScriptsFromProto(scripts []*proto.WorkspaceAgentScript) ([]codersdk.WorkspaceAgentScript, error) {
+	return agentsdk.AgentScriptsFromProto(scripts)
+}
+
+// ProtoFromScripts converts the scripts of an agent to their wire format.
+func ProtoFromScripts(scripts []codersdk.WorkspaceAgentScript) []*proto.WorkspaceAgentScript {
+	return agentsdk.ProtoFromScripts(scripts)
+}
+
+// AgentScriptFromProto converts a single script.
+func AgentScriptFromProto(script *proto.WorkspaceAgentScript) (codersdk.WorkspaceAgentScript, error) {
+	return agentsdk.AgentScriptFromProto(script)
+}
+
+// ProtoFromScript converts a single script to its wire format.
+func ProtoFromScript(script codersdk.WorkspaceAgentScript) *proto.WorkspaceAgentScript {
+	return agentsdk.ProtoFromScript(script)
+}
+
+// AppsFromProto converts the apps of an agent. It fails if the ID of an app
+// isn't a UUID, or its sharing level or health is unknown.
+func AppsFromProto(apps []*proto.WorkspaceApp) ([]codersdk.WorkspaceApp, error) {
+	return agentsdk.AppsFromProto(apps)
+}
+
+// ProtoFromApps converts the apps of an agent to their wire format.
+func ProtoFromApps(apps []codersdk.WorkspaceApp) ([]*proto.WorkspaceApp, error) {
+	return agentsdk.ProtoFromApps(apps)
+}
+
+// AppFromProto converts a single app.
+func AppFromProto(app *proto.WorkspaceApp) (codersdk.WorkspaceApp, error) {
+	return agentsdk.AppFromProto(app)
+}
+
+// ProtoFromApp converts a single app to its wire format.
+func ProtoFromApp(app codersdk.WorkspaceApp) (*proto.WorkspaceApp, error) {
+	return agentsdk.ProtoFromApp(app)
+}
+
+// ServiceBannerFromProto converts the service banner shown on login.
+func ServiceBannerFromProto(banner *proto.ServiceBanner) codersdk.ServiceBannerConfig {
+	return agentsdk.ServiceBannerFromProto(banner)
+}
+
+// ProtoFromServiceBanner converts the service banner shown on login to its
+// wire format.
+func ProtoFromServiceBanner(banner codersdk.ServiceBannerConfig) *proto.ServiceBanner {
+	return agentsdk.ProtoFromServiceBanner(banner)
+}
+
+// ProtoFromSubsystems converts the subsystems an agent reports on startup.
+// It fails on unknown subsystems.
+func ProtoFromSubsystems(subsystems []codersdk.AgentSubsystem) ([]proto.Startup_Subsystem, error) {
+	return agentsdk.ProtoFromSubsystems(subsystems)
+}
+
+// ProtoFromAppHealthsRequest converts an app health report. The order of the
+// updates is unspecified. It fails on unknown health values.
+func ProtoFromAppHealthsRequest(req agentsdk.PostAppHealthsRequest) (*proto.BatchUpdateAppHealthRequest, error) {
+	return agentsdk.ProtoFromAppHealthsRequest(req)
+}
+
+// StatsFromProto converts the stats an agent reports.
+func StatsFromProto(stats *proto.Stats) *agentsdk.Stats {
+	return agentsdk.StatsFromProto(stats)
+}
+
+// ProtoFromStats converts the stats an agent reports to their wire format.
+// It fails on unknown metric types and app usage connection types.
+func ProtoFromStats(stats *agentsdk.Stats) (*proto.Stats, error) {
+	return agentsdk.ProtoFromStats(stats)
+}
+
+// LogsFromProto converts a batch of logs. It fails if the log source isn't a
+// UUID.
+func LogsFromProto(req *proto.BatchCreateLogsRequest) (agentsdk.PatchLogs, error) {
+	return agentsdk.LogsFromProto(req)
+}
+
+// ProtoFromLog converts a single log to its wire format. It fails on
+// unknown log levels.
+func ProtoFromLog(log agentsdk.Log) (*proto.Log, error) {
+	return agentsdk.ProtoFromLog(log)
+}
+
+// MetadataFromProto converts a batch of metadata results.
+func MetadataFromProto(req *proto.BatchUpdateMetadataRequest) agentsdk.PostMetadataRequest {
+	return agentsdk.MetadataFromProto(req)
+}
@@ -0,0 +1,173 @@
+package convert_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/coder/coder/v2/agent/proto"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk/convert"
+	"github.com/coder/coder/v2/tailnet"
+)
+
+var updateGoldenFiles = flag.Bool("update", false, "Update golden files")
+
+func TestManifest(t *testing.T) {
+	t.Parallel()
+
+	var manifest agentsdk.Manifest
+	readFixture(t, "manifest", &manifest)
+
+	p, err := convert.ProtoFromManifest(manifest)
+	require.NoError(t, err)
+	requireGolden(t, "manifest", p)
+
+	var golden proto.Manifest
+	readGolden(t, "manifest", &golden)
+	back, err := convert.ManifestFromProto(&golden)
+	require.NoError(t, err)
+	require.True(t, tailnet.CompareDERPMaps(manifest.DERPMap, back.DERPMap))
+	manifest.DERPMap, back.DERPMap = nil, nil
+	require.Len(t, back.DERPMapFallbacks, len(manifest.DERPMapFallbacks))
+	for i := range manifest.DERPMapFallbacks {
+		require.True(t, tailnet.CompareDERPMaps(manifest.DERPMapFallbacks[i].DERPMap, back.DERPMapFallbacks[i].DERPMap))
+		manifest.DERPMapFallbacks[i].DERPMap, back.DERPMapFallbacks[i].DERPMap = nil, nil
+	}
+	require.Equal(t, manifest, back)
+}
+
+func TestManifestFields(t *testing.T) {
+	t.Parallel()
+
+	var manifest agentsdk.Manifest
+	readFixture(t, "manifest", &manifest)
+
+	t.Run("ExecPolicy", func(t *testing.T) {
+		t.Parallel()
+		p, err := convert.ProtoFromExecPolicy(manifest.ExecPolicy)
+		require.NoError(t, err)
+		require.Equal(t, manifest.ExecPolicy, convert.ExecPolicyFromProto(p))
+
+		_, err = convert.ProtoFromExecPolicy([]agentsdk.ExecPolicyRule{{Action: "deny"}})
+		require.Error(t, err)
+	})
+
+	t.Run("DERPMapSources", func(t *testing.T) {
+		t.Parallel()
+		back := convert.DERPMapSourcesFromProto(convert.ProtoFromDERPMapSources(manifest.DERPMapFallbacks))
+		require.Len(t, back, len(manifest.DERPMapFallbacks))
+		for i := range manifest.DERPMapFallbacks {
+			require.Equal(t, manifest.DERPMapFallbacks[i].Name, back[i].Name)
+			require.True(t, tailnet.CompareDERPMaps(manifest.DERPMapFallbacks[i].DERPMap, back[i].DERPMap))
+		}
+	})
+
+	t.Run("DisplayApps", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, manifest.DisplayApps, convert.DisplayAppsFromProto(convert.ProtoFromDisplayApps(manifest.DisplayApps)))
+		require.Equal(t, []codersdk.DisplayApp{}, convert.DisplayAppsFromProto(convert.ProtoFromDisplayApps(nil)))
+		require.Nil(t, convert.DisplayAppsFromProto(nil))
+	})
+
+	t.Run("BuildStatus", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, manifest.BuildStatus, convert.BuildStatusFromProto(convert.ProtoFromBuildStatus(manifest.BuildStatus)))
+		require.Empty(t, convert.BuildStatusFromProto(convert.ProtoFromBuildStatus("")))
+	})
+
+	t.Run("AgentUpdatePolicy", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, manifest.UpdatePolicy, convert.AgentUpdatePolicyFromProto(convert.ProtoFromAgentUpdatePolicy(manifest.UpdatePolicy)))
+		require.Nil(t, convert.AgentUpdatePolicyFromProto(convert.ProtoFromAgentUpdatePolicy(nil)))
+	})
+
+	t.Run("ProxyConfig", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, manifest.Proxy, convert.ProxyConfigFromProto(convert.ProtoFromProxyConfig(manifest.Proxy)))
+		require.Nil(t, convert.ProxyConfigFromProto(convert.ProtoFromProxyConfig(nil)))
+	})
+
+	t.Run("MOTDConfig", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, manifest.MOTD, convert.MOTDConfigFromProto(convert.ProtoFromMOTDConfig(manifest.MOTD)))
+		require.Nil(t, convert.MOTDConfigFromProto(convert.ProtoFromMOTDConfig(nil)))
+	})
+
+	t.Run("CodeServerConfig", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, manifest.CodeServer, convert.CodeServerConfigFromProto(convert.ProtoFromCodeServerConfig(manifest.CodeServer)))
+		require.Nil(t, convert.CodeServerConfigFromProto(convert.ProtoFromCodeServerConfig(nil)))
+	})
+
+	t.Run("SSHKeepAliveConfig", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, manifest.SSHKeepAlive, convert.SSHKeepAliveConfigFromProto(convert.ProtoFromSSHKeepAliveConfig(manifest.SSHKeepAlive)))
+		require.Nil(t, convert.SSHKeepAliveConfigFromProto(convert.ProtoFromSSHKeepAliveConfig(nil)))
+	})
+}
+
+func TestServiceBanner(t *testing.T) {
+	t.Parallel()
+
+	var banner codersdk.ServiceBannerConfig
+	readFixture(t, "service_banner", &banner)
+	requireGolden(t, "service_banner", convert.ProtoFromServiceBanner(banner))
+
+	var golden proto.ServiceBanner
+	readGolden(t, "service_banner", &golden)
+	require.Equal(t, banner, convert.ServiceBannerFromProto(&golden))
+}
+
+// readFixture decodes the SDK JSON fixture of name.
+func readFixture(t *testing.T, name string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+	require.NoError(t, err)
+	err = json.Unmarshal(data, v)
+	require.NoError(t, err)
+}
+
+// readGolden decodes the protobuf JSON golden file of name.
+func readGolden(t *testing.T, name string, m protobuf.Message) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name+".golden"))
+	require.NoError(t, err)
+	err = protojson.Unmarshal(data, m)
+	require.NoError(t, err)
+}
+
+// requireGolden compares the protobuf JSON encoding of m with the golden
+// file of name.
+func requireGolden(t *testing.T, name string, m protobuf.Message) {
+	t.Helper()
+	data, err := protojson.Marshal(m)
+	require.NoError(t, err)
+	// protojson randomizes whitespace to prevent byte comparisons, so the
+	// output is reformatted.
+	var compacted bytes.Buffer
+	err = json.Compact(&compacted, data)
+	require.NoError(t, err)
+	var got bytes.Buffer
+	err = json.Indent(&got, compacted.Bytes(), "", "  ")
+	require.NoError(t, err)
+	got.WriteByte('\n')
+
+	goldenPath := filepath.Join("testdata", name+".golden")
+	if *updateGoldenFiles {
+		err = os.WriteFile(goldenPath, got.Bytes(), 0o600)
+		require.NoError(t, err)
+		return
+	}
+	want, err := os.ReadFile(goldenPath)
+	require.NoError(t, err, "golden file missing, run with -update")
+	require.Equal(t, string(want), got.String(), "golden file mismatch, run with -update if the change is intended")
+}
@@ -0,0 +1,155 @@
+package agentsdk
+
+import (
+	"sync"
+
+	"golang.org/x/xerrors"
+	"tailscale.com/tailcfg"
+)
+
+// DERPMapSourcePrimary is the name of the regions of the DERP map that
+// aren't part of a fallback.
+const DERPMapSourcePrimary = "primary"
+
+// DERPMapSource is a named set of DERP relays, e.g. the relays of a region.
+type DERPMapSource struct {
+	Name    string           `json:"name"`
+	DERPMap *tailcfg.DERPMap `json:"derp_map"`
+}
+
+// DERPMapWithFallbacks adds the regions of the fallbacks to the DERP map
+// coderd distributes to clients and agents. They are marked to be avoided
+// as home regions, so nodes only relay through them to reach agents that
+// failed over to them.
+func DERPMapWithFallbacks(derpMap *tailcfg.DERPMap, fallbacks []DERPMapSource) (*tailcfg.DERPMap, error) {
+	if len(fallbacks) == 0 {
+		return derpMap, nil
+	}
+	merged := derpMap.Clone()
+	if merged == nil {
+		merged = &tailcfg.DERPMap{}
+	}
+	if merged.Regions == nil {
+		merged.Regions = map[int]*tailcfg.DERPRegion{}
+	}
+	for _, fallback := range fallbacks {
+		if fallback.DERPMap == nil {
+			continue
+		}
+		for id, region := range fallback.DERPMap.Regions {
+			if _, ok := merged.Regions[id]; ok {
+				return nil, xerrors.Errorf("region %d of fallback %q is already part of the DERP map", id, fallback.Name)
+			}
+			region = region.Clone()
+			region.Avoid = true
+			merged.Regions[id] = region
+		}
+	}
+	return merged, nil
+}
+
+// DERPMapFailover selects the regions of the DERP map the agent picks its
+// home region from. It starts with the primary regions and advances through
+// the fallbacks in order when the current ones fail, wrapping around after
+// the last one. Every client and coderd gets all regions from coderd, so
+// they reach the agent on whichever of them it's connected to.
+type DERPMapFailover struct {
+	mu        sync.Mutex
+	fallbacks []DERPMapSource
+	// current is 0 for the primary regions, and the fallback at current-1
+	// otherwise.
+	current int
+	derpMap *tailcfg.DERPMap
+	apply   func(*tailcfg.DERPMap)
+}
+
+// NewDERPMapFailover fails over through the DERP map fallbacks of the
+// manifest. The DERP map the agent should use is passed to apply whenever
+// it changes.
+func NewDERPMapFailover(manifest Manifest, apply func(*tailcfg.DERPMap)) *DERPMapFailover {
+	fallbacks := make([]DERPMapSource, 0, len(manifest.DERPMapFallbacks))
+	for _, fallback := range manifest.DERPMapFallbacks {
+		if fallback.DERPMap == nil || len(fallback.DERPMap.Regions) == 0 {
+			continue
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	return &DERPMapFailover{
+		fallbacks: fallbacks,
+		derpMap:   manifest.DERPMap,
+		apply:     apply,
+	}
+}
+
+// Current returns the name of the regions the agent picks its home region
+// from.
+func (f *DERPMapFailover) Current() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.name(f.current)
+}
+
+// Fail marks the current regions as unreachable and returns the name of the
+// next ones. Failing regions is ignored if another caller already failed
+// them over, so concurrent reports of the same outage advance only once.
+func (f *DERPMapFailover) Fail(failed string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.fallbacks) == 0 || f.name(f.current) != failed {
+		return f.name(f.current)
+	}
+	f.current = (f.current + 1) % (len(f.fallbacks) + 1)
+	f.apply(f.currentDERPMap())
+	return f.name(f.current)
+}
+
+// SetDERPMap replaces the DERP map with an update streamed by coderd.
+func (f *DERPMapFailover) SetDERPMap(derpMap *tailcfg.DERPMap) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.derpMap = derpMap
+	f.apply(f.currentDERPMap())
+}
+
+// DERPMap returns the DERP map the agent should use.
+func (f *DERPMapFailover) DERPMap() *tailcfg.DERPMap {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.currentDERPMap()
+}
+
+func (f *DERPMapFailover) name(index int) string {
+	if index == 0 {
+		return DERPMapSourcePrimary
+	}
+	return f.fallbacks[index-1].Name
+}
+
+// currentDERPMap avoids every region of the DERP map that isn't part of the
+// current regions. The primary regions keep coderd's settings.
+func (f *DERPMapFailover) currentDERPMap() *tailcfg.DERPMap {
+	if f.derpMap == nil || len(f.fallbacks) == 0 {
+		return f.derpMap
+	}
+	fallbackOf := map[int]int{}
+	for i, fallback := range f.fallbacks {
+		for id := range fallback.DERPMap.Regions {
+			fallbackOf[id] = i + 1
+		}
+	}
+	derpMap := f.derpMap.Clone()
+	for id, region := range derpMap.Regions {
+		if region == nil {
+			continue
+		}
+		index, ok := fallbackOf[id]
+		if !ok {
+			if f.current != 0 {
+				region.Avoid = true
+			}
+			continue
+		}
+		region.Avoid = index != f.current
+	}
+	return derpMap
+}
@@ -0,0 +1,100 @@
+package agentsdk_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+func TestDERPMapWithFallbacks(t *testing.T) {
+	t.Parallel()
+
+	derpMap := func(regionIDs ...int) *tailcfg.DERPMap {
+		derpMap := &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{}}
+		for _, id := range regionIDs {
+			derpMap.Regions[id] = &tailcfg.DERPRegion{RegionID: id, RegionCode: "test"}
+		}
+		return derpMap
+	}
+
+	t.Run("Merge", func(t *testing.T) {
+		t.Parallel()
+		primary := derpMap(1)
+		merged, err := agentsdk.DERPMapWithFallbacks(primary, []agentsdk.DERPMapSource{
+			{Name: "eu", DERPMap: derpMap(2, 3)},
+			{Name: "empty"},
+		})
+		require.NoError(t, err)
+		require.Len(t, merged.Regions, 3)
+		require.False(t, merged.Regions[1].Avoid)
+		require.True(t, merged.Regions[2].Avoid)
+		require.True(t, merged.Regions[3].Avoid)
+		// The primary DERP map isn't modified.
+		require.Len(t, primary.Regions, 1)
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		t.Parallel()
+		_, err := agentsdk.DERPMapWithFallbacks(derpMap(1), []agentsdk.DERPMapSource{
+			{Name: "eu", DERPMap: derpMap(2)},
+			{Name: "us", DERPMap: derpMap(2)},
+		})
+		require.ErrorContains(t, err, `region 2 of fallback "us"`)
+	})
+}
+
+func TestDERPMapFailover(t *testing.T) {
+	t.Parallel()
+
+	fallbacks := []agentsdk.DERPMapSource{
+		{Name: "eu", DERPMap: &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{2: {RegionID: 2}}}},
+		{Name: "empty"},
+		{Name: "us", DERPMap: &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{3: {RegionID: 3}}}},
+	}
+	derpMap, err := agentsdk.DERPMapWithFallbacks(&tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{1: {RegionID: 1}},
+	}, fallbacks)
+	require.NoError(t, err)
+
+	avoided := func(derpMap *tailcfg.DERPMap) []int {
+		var ids []int
+		for id := 1; id <= len(derpMap.Regions); id++ {
+			if derpMap.Regions[id].Avoid {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	var applied *tailcfg.DERPMap
+	failover := agentsdk.NewDERPMapFailover(agentsdk.Manifest{
+		DERPMap:          derpMap,
+		DERPMapFallbacks: fallbacks,
+	}, func(derpMap *tailcfg.DERPMap) {
+		applied = derpMap
+	})
+	require.Equal(t, agentsdk.DERPMapSourcePrimary, failover.Current())
+	require.Equal(t, []int{2, 3}, avoided(failover.DERPMap()))
+
+	require.Equal(t, "eu", failover.Fail(agentsdk.DERPMapSourcePrimary))
+	require.Equal(t, []int{1, 3}, avoided(applied))
+	// A stale report of the primary regions failing doesn't skip a
+	// fallback.
+	require.Equal(t, "eu", failover.Fail(agentsdk.DERPMapSourcePrimary))
+
+	require.Equal(t, "us", failover.Fail("eu"))
+	require.Equal(t, []int{1, 2}, avoided(applied))
+
+	// Updates of the DERP map keep the current regions.
+	updated := derpMap.Clone()
+	updated.Regions[4] = &tailcfg.DERPRegion{RegionID: 4}
+	failover.SetDERPMap(updated)
+	require.Equal(t, []int{1, 2, 4}, avoided(applied))
+
+	require.Equal(t, agentsdk.DERPMapSourcePrimary, failover.Fail("us"))
+	require.Equal(t, []int{2, 3}, avoided(applied))
+	// The DERP map of coderd isn't modified.
+	require.Equal(t, []int{2, 3}, avoided(derpMap))
+}
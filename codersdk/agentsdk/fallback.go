@@ -0,0 +1,244 @@
+package agentsdk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/hashicorp/yamux"
+	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"storj.io/drpc"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/agent/proto"
+	"github.com/coder/coder/v2/codersdk"
+)
+
+// HTTPAgentAPI is the part of the HTTP API of agents that has an equivalent
+// in the DRPC agent API.
+type HTTPAgentAPI interface {
+	Manifest(ctx context.Context) (Manifest, error)
+	PostStats(ctx context.Context, stats *Stats) (StatsResponse, error)
+	PostLogSource(ctx context.Context, req PostLogSource) (codersdk.WorkspaceAgentLogSource, error)
+	PostMetadata(ctx context.Context, req PostMetadataRequest) error
+}
+
+// RPCDialer dials a new connection to the DRPC agent API, e.g.
+// Client.ConnectRPC.
+type RPCDialer func(ctx context.Context) (drpc.Conn, error)
+
+// FallbackAgentAPI is a DRPC agent API client that keeps requests for the
+// manifest, logs, log sources, metadata and stats working on degraded
+// networks. When one of them fails because the connection failed, the
+// WebSocket of the DRPC connection is redialed and the request is retried on
+// the new connection, which is used by later requests. Requests failing on
+// the new connection too are sent over the HTTP API, which uses a new
+// connection per request. Requests that aren't safe to send twice, i.e.
+// logs and stats, aren't retried, since coderd may have processed them before
+// the connection failed. Other requests are only sent over the initial
+// connection.
+type FallbackAgentAPI struct {
+	proto.DRPCAgentClient
+	dial   RPCDialer
+	http   HTTPAgentAPI
+	logger slog.Logger
+
+	mu sync.Mutex
+	// client is the client of the connection requests fall back to, the
+	// initial one until it fails.
+	client proto.DRPCAgentClient
+	// conn is the connection dialed after the initial one failed, if any.
+	conn   drpc.Conn
+	closed bool
+}
+
+// NewFallbackAgentAPI returns a client of the agent API over conn. Closing
+// conn is up to the caller, connections dialed with dial are closed by Close.
+func NewFallbackAgentAPI(conn drpc.Conn, dial RPCDialer, http HTTPAgentAPI, logger slog.Logger) *FallbackAgentAPI {
+	client := proto.NewDRPCAgentClient(conn)
+	return &FallbackAgentAPI{
+		DRPCAgentClient: client,
+		dial:            dial,
+		http:            http,
+		logger:          logger,
+		client:          client,
+	}
+}
+
+// Close closes the connection dialed after the initial one failed.
+func (f *FallbackAgentAPI) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.conn == nil {
+		return nil
+	}
+	return f.conn.Close()
+}
+
+func (f *FallbackAgentAPI) GetManifest(ctx context.Context, req *proto.GetManifestRequest) (*proto.Manifest, error) {
+	return callWithFallback(ctx, f, "GetManifest", func(client proto.DRPCAgentClient) (*proto.Manifest, error) {
+		return client.GetManifest(ctx, req)
+	}, func() (*proto.Manifest, error) {
+		manifest, err := f.http.Manifest(ctx)
+		if err != nil {
+			return nil, xerrors.Errorf("fetch manifest over HTTP: %w", err)
+		}
+		return ProtoFromManifest(manifest)
+	})
+}
+
+// UpdateStats only retries requests without stats, which request the report
+// interval. Stats the failed connection delivered would be counted twice, and
+// the next report has new stats anyway.
+func (f *FallbackAgentAPI) UpdateStats(ctx context.Context, req *proto.UpdateStatsRequest) (*proto.UpdateStatsResponse, error) {
+	call := func(client proto.DRPCAgentClient) (*proto.UpdateStatsResponse, error) {
+		return client.UpdateStats(ctx, req)
+	}
+	if req.GetStats() != nil {
+		return callWithoutRetry(ctx, f, "UpdateStats", call)
+	}
+	return callWithFallback(ctx, f, "UpdateStats", call, func() (*proto.UpdateStatsResponse, error) {
+		statsResp, err := f.http.PostStats(ctx, &Stats{})
+		if err != nil {
+			return nil, xerrors.Errorf("post stats over HTTP: %w", err)
+		}
+		return &proto.UpdateStatsResponse{
+			ReportInterval: durationpb.New(statsResp.ReportInterval),
+		}, nil
+	})
+}
+
+// BatchCreateLogs isn't retried, since logs the failed connection delivered
+// would be duplicated. Callers keep the logs to send them again if they can
+// tell they weren't stored.
+func (f *FallbackAgentAPI) BatchCreateLogs(ctx context.Context, req *proto.BatchCreateLogsRequest) (*proto.BatchCreateLogsResponse, error) {
+	return callWithoutRetry(ctx, f, "BatchCreateLogs", func(client proto.DRPCAgentClient) (*proto.BatchCreateLogsResponse, error) {
+		return client.BatchCreateLogs(ctx, req)
+	})
+}
+
+func (f *FallbackAgentAPI) CreateLogSource(ctx context.Context, req *proto.CreateLogSourceRequest) (*proto.LogSource, error) {
+	return callWithFallback(ctx, f, "CreateLogSource", func(client proto.DRPCAgentClient) (*proto.LogSource, error) {
+		return client.CreateLogSource(ctx, req)
+	}, func() (*proto.LogSource, error) {
+		source, err := LogSourceRequestFromProto(req)
+		if err != nil {
+			return nil, xerrors.Errorf("convert log source: %w", err)
+		}
+		created, err := f.http.PostLogSource(ctx, source)
+		if err != nil {
+			return nil, xerrors.Errorf("post log source over HTTP: %w", err)
+		}
+		return ProtoFromLogSource(created), nil
+	})
+}
+
+func (f *FallbackAgentAPI) BatchUpdateMetadata(ctx context.Context, req *proto.BatchUpdateMetadataRequest) (*proto.BatchUpdateMetadataResponse, error) {
+	return callWithFallback(ctx, f, "BatchUpdateMetadata", func(client proto.DRPCAgentClient) (*proto.BatchUpdateMetadataResponse, error) {
+		return client.BatchUpdateMetadata(ctx, req)
+	}, func() (*proto.BatchUpdateMetadataResponse, error) {
+		err := f.http.PostMetadata(ctx, MetadataFromProto(req))
+		if err != nil {
+			return nil, xerrors.Errorf("post metadata over HTTP: %w", err)
+		}
+		return &proto.BatchUpdateMetadataResponse{}, nil
+	})
+}
+
+// callWithFallback sends a request with call, retries it on a new
+// connection if the connection failed, and sends it with overHTTP if the new
+// connection fails too.
+func callWithFallback[T any](ctx context.Context, f *FallbackAgentAPI, method string, call func(proto.DRPCAgentClient) (T, error), overHTTP func() (T, error)) (T, error) {
+	f.mu.Lock()
+	client := f.client
+	f.mu.Unlock()
+	resp, err := call(client)
+	if !f.connectionFailed(ctx, err) {
+		return resp, err
+	}
+	f.logger.Warn(ctx, "agent API connection failed, reconnecting",
+		slog.F("method", method), slog.Error(err))
+	client, dialErr := f.reconnect(ctx, client)
+	if dialErr == nil {
+		resp, err = call(client)
+		if !f.connectionFailed(ctx, err) {
+			return resp, err
+		}
+	} else {
+		err = dialErr
+	}
+	f.logger.Warn(ctx, "agent API connection failed, retrying over HTTP",
+		slog.F("method", method), slog.Error(err))
+	return overHTTP()
+}
+
+// callWithoutRetry sends a request that isn't safe to send twice with call.
+// If the connection failed, the request isn't retried, but later requests
+// are sent on a new connection.
+func callWithoutRetry[T any](ctx context.Context, f *FallbackAgentAPI, method string, call func(proto.DRPCAgentClient) (T, error)) (T, error) {
+	f.mu.Lock()
+	client := f.client
+	f.mu.Unlock()
+	resp, err := call(client)
+	if !f.connectionFailed(ctx, err) {
+		return resp, err
+	}
+	f.logger.Warn(ctx, "agent API connection failed, reconnecting without retrying the request",
+		slog.F("method", method), slog.Error(err))
+	_, dialErr := f.reconnect(ctx, client)
+	if dialErr != nil {
+		f.logger.Warn(ctx, "reconnect agent API", slog.F("method", method), slog.Error(dialErr))
+	}
+	return resp, err
+}
+
+// reconnect dials a new connection to replace the one of the failed client.
+// Requests failing concurrently share the new connection.
+func (f *FallbackAgentAPI) reconnect(ctx context.Context, failed proto.DRPCAgentClient) (proto.DRPCAgentClient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.client != failed {
+		return f.client, nil
+	}
+	if f.closed {
+		return nil, xerrors.New("agent API client is closed")
+	}
+	if f.dial == nil {
+		return nil, xerrors.New("reconnecting is not supported")
+	}
+	conn, err := f.dial(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("dial agent API: %w", err)
+	}
+	if f.conn != nil {
+		_ = f.conn.Close()
+	}
+	f.conn = conn
+	f.client = proto.NewDRPCAgentClient(conn)
+	return f.client, nil
+}
+
+// connectionFailed returns whether a request failed with err because the
+// connection failed.
+func (*FallbackAgentAPI) connectionFailed(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() == nil && IsConnectionError(err)
+}
+
+// IsConnectionError returns whether err is caused by a failure of the
+// connection to the agent API, rather than an error returned by coderd.
+func IsConnectionError(err error) bool {
+	if drpc.ClosedError.Has(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, yamux.ErrSessionShutdown) ||
+		errors.As(err, &netErr)
+}
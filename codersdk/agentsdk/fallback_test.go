@@ -0,0 +1,232 @@
+package agentsdk_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"storj.io/drpc"
+	"storj.io/drpc/drpcmux"
+	"storj.io/drpc/drpcserver"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/coder/v2/agent/proto"
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	drpcsdk "github.com/coder/coder/v2/codersdk/drpc"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestFallbackAgentAPI(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Reconnect", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		httpAPI := &fakeHTTPAgentAPI{}
+		var dials int
+		dial := func(context.Context) (drpc.Conn, error) {
+			dials++
+			return serveFakeAgentAPI(t), nil
+		}
+		api := agentsdk.NewFallbackAgentAPI(&failingDRPCConn{err: drpc.ClosedError.New("connection closed")},
+			dial, httpAPI, slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}))
+		defer api.Close()
+
+		// The in-flight request is retried on the new connection, which
+		// later requests use too.
+		manifest, err := api.GetManifest(ctx, &proto.GetManifestRequest{})
+		require.NoError(t, err)
+		require.Equal(t, "reconnected", manifest.AgentName)
+		resp, err := api.UpdateStats(ctx, &proto.UpdateStatsRequest{Stats: &proto.Stats{ConnectionCount: 3}})
+		require.NoError(t, err)
+		require.Equal(t, 2*time.Minute, resp.ReportInterval.AsDuration())
+		require.Equal(t, 1, dials)
+		require.Nil(t, httpAPI.stats)
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		httpAPI := &fakeHTTPAgentAPI{}
+		dial := func(context.Context) (drpc.Conn, error) {
+			return nil, xerrors.New("network is unreachable")
+		}
+		api := agentsdk.NewFallbackAgentAPI(&failingDRPCConn{err: drpc.ClosedError.New("connection closed")},
+			dial, httpAPI, slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}))
+		defer api.Close()
+
+		manifest, err := api.GetManifest(ctx, &proto.GetManifestRequest{})
+		require.NoError(t, err)
+		require.Equal(t, "dev", manifest.AgentName)
+
+		// Requesting the report interval is safe to retry.
+		resp, err := api.UpdateStats(ctx, &proto.UpdateStatsRequest{})
+		require.NoError(t, err)
+		require.Equal(t, time.Minute, resp.ReportInterval.AsDuration())
+		require.NotNil(t, httpAPI.stats)
+
+		sourceID := uuid.New()
+		source, err := api.CreateLogSource(ctx, &proto.CreateLogSourceRequest{
+			Id:          sourceID[:],
+			DisplayName: "Dotfiles",
+		})
+		require.NoError(t, err)
+		require.Equal(t, sourceID[:], source.Id)
+		require.Equal(t, "Dotfiles", source.DisplayName)
+
+		_, err = api.BatchUpdateMetadata(ctx, &proto.BatchUpdateMetadataRequest{Metadata: []*proto.Metadata{{
+			Key:    "cpu",
+			Result: &proto.WorkspaceAgentMetadata_Result{Value: "50%"},
+		}}})
+		require.NoError(t, err)
+		require.Equal(t, "50%", httpAPI.metadata.Metadata[0].Value)
+	})
+
+	t.Run("NoRetry", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		httpAPI := &fakeHTTPAgentAPI{}
+		var dials int
+		dial := func(context.Context) (drpc.Conn, error) {
+			dials++
+			return serveFakeAgentAPI(t), nil
+		}
+		api := agentsdk.NewFallbackAgentAPI(&failingDRPCConn{err: drpc.ClosedError.New("connection closed")},
+			dial, httpAPI, slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}))
+		defer api.Close()
+
+		// coderd may have stored the stats and logs before the connection
+		// failed, so they aren't sent again.
+		_, err := api.UpdateStats(ctx, &proto.UpdateStatsRequest{Stats: &proto.Stats{ConnectionCount: 3}})
+		require.Error(t, err)
+		require.Nil(t, httpAPI.stats)
+		require.Equal(t, 1, dials)
+
+		// Later requests use the new connection.
+		resp, err := api.UpdateStats(ctx, &proto.UpdateStatsRequest{Stats: &proto.Stats{ConnectionCount: 3}})
+		require.NoError(t, err)
+		require.Equal(t, 2*time.Minute, resp.ReportInterval.AsDuration())
+		require.Equal(t, 1, dials)
+	})
+
+	t.Run("NoRetryLogs", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		dial := func(context.Context) (drpc.Conn, error) {
+			return nil, xerrors.New("network is unreachable")
+		}
+		api := agentsdk.NewFallbackAgentAPI(&failingDRPCConn{err: drpc.ClosedError.New("connection closed")},
+			dial, &fakeHTTPAgentAPI{}, slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}))
+		defer api.Close()
+
+		sourceID := uuid.New()
+		log, err := agentsdk.ProtoFromLog(agentsdk.Log{CreatedAt: time.Now(), Output: "hello", Level: codersdk.LogLevelWarn})
+		require.NoError(t, err)
+		_, err = api.BatchCreateLogs(ctx, &proto.BatchCreateLogsRequest{
+			LogSourceId: sourceID[:],
+			Logs:        []*proto.Log{log},
+		})
+		require.ErrorContains(t, err, "connection closed")
+	})
+
+	t.Run("OtherError", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		dial := func(context.Context) (drpc.Conn, error) {
+			t.Error("dialed although the connection didn't fail")
+			return nil, xerrors.New("unexpected dial")
+		}
+		api := agentsdk.NewFallbackAgentAPI(&failingDRPCConn{err: xerrors.New("forbidden")},
+			dial, &fakeHTTPAgentAPI{}, slogtest.Make(t, nil))
+		defer api.Close()
+
+		_, err := api.GetManifest(ctx, &proto.GetManifestRequest{})
+		require.ErrorContains(t, err, "forbidden")
+	})
+}
+
+// serveFakeAgentAPI returns a connection to a DRPC agent API.
+func serveFakeAgentAPI(t *testing.T) drpc.Conn {
+	t.Helper()
+	mux := drpcmux.New()
+	err := proto.DRPCRegisterAgent(mux, &fakeDRPCAgentServer{})
+	require.NoError(t, err)
+	server := drpcserver.New(mux)
+	conn, lis := drpcsdk.MemTransportPipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		_ = conn.Close()
+	})
+	go func() {
+		_ = server.Serve(ctx, lis)
+	}()
+	return conn
+}
+
+type fakeDRPCAgentServer struct {
+	proto.DRPCAgentUnimplementedServer
+}
+
+func (*fakeDRPCAgentServer) GetManifest(context.Context, *proto.GetManifestRequest) (*proto.Manifest, error) {
+	return &proto.Manifest{AgentName: "reconnected"}, nil
+}
+
+func (*fakeDRPCAgentServer) UpdateStats(context.Context, *proto.UpdateStatsRequest) (*proto.UpdateStatsResponse, error) {
+	return &proto.UpdateStatsResponse{ReportInterval: durationpb.New(2 * time.Minute)}, nil
+}
+
+// failingDRPCConn fails every request with err.
+type failingDRPCConn struct {
+	err error
+}
+
+func (*failingDRPCConn) Close() error {
+	return nil
+}
+
+func (*failingDRPCConn) Closed() <-chan struct{} {
+	return nil
+}
+
+func (c *failingDRPCConn) Invoke(context.Context, string, drpc.Encoding, drpc.Message, drpc.Message) error {
+	return c.err
+}
+
+func (c *failingDRPCConn) NewStream(context.Context, string, drpc.Encoding) (drpc.Stream, error) {
+	return nil, c.err
+}
+
+type fakeHTTPAgentAPI struct {
+	stats    *agentsdk.Stats
+	metadata agentsdk.PostMetadataRequest
+}
+
+func (*fakeHTTPAgentAPI) Manifest(context.Context) (agentsdk.Manifest, error) {
+	return agentsdk.Manifest{AgentID: uuid.New(), AgentName: "dev", WorkspaceID: uuid.New()}, nil
+}
+
+func (f *fakeHTTPAgentAPI) PostStats(_ context.Context, stats *agentsdk.Stats) (agentsdk.StatsResponse, error) {
+	f.stats = stats
+	return agentsdk.StatsResponse{ReportInterval: time.Minute}, nil
+}
+
+func (*fakeHTTPAgentAPI) PostLogSource(_ context.Context, req agentsdk.PostLogSource) (codersdk.WorkspaceAgentLogSource, error) {
+	return codersdk.WorkspaceAgentLogSource{
+		WorkspaceAgentID: uuid.New(),
+		ID:               req.ID,
+		CreatedAt:        time.Now(),
+		DisplayName:      req.DisplayName,
+		Icon:             req.Icon,
+	}, nil
+}
+
+func (f *fakeHTTPAgentAPI) PostMetadata(_ context.Context, req agentsdk.PostMetadataRequest) error {
+	f.metadata = req
+	return nil
+}
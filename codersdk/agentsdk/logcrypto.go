@@ -0,0 +1,241 @@
+package agentsdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/codersdk"
+)
+
+// EncryptedLogPrefix prefixes the output of logs encrypted by a LogCipher.
+// It's followed by the ID of the key and the base64 encoded nonce and
+// ciphertext, separated by colons.
+const EncryptedLogPrefix = "coder-encrypted:v1:"
+
+// EncryptedArtifactsPrefix prefixes archives of script artifacts encrypted
+// by a LogCipher. It's followed by the ID of the key, a colon, and the nonce
+// and ciphertext.
+const EncryptedArtifactsPrefix = "coder-encrypted-artifacts:v1:"
+
+// LogEncryptionKeySize is the size of the keys logs are encrypted with, in
+// bytes. Logs are encrypted with AES-256-GCM.
+const LogEncryptionKeySize = 32
+
+// LogCipher encrypts the output of logs before they're sent to coderd, so
+// coderd only stores ciphertext, e.g. for deployments whose compliance rules
+// forbid the control plane from reading workspace output. The key is scoped
+// to a workspace and must reach the agent without passing through coderd,
+// e.g. from the secret manager of the cloud the workspace runs in. The
+// output and the values of fields are encrypted, as are the archives of
+// script artifacts. The level, stream and the names of fields are not.
+type LogCipher struct {
+	aead  cipher.AEAD
+	keyID string
+}
+
+// NewLogCipher returns a cipher for a key of LogEncryptionKeySize bytes.
+func NewLogCipher(key []byte) (*LogCipher, error) {
+	if len(key) != LogEncryptionKeySize {
+		return nil, xerrors.Errorf("log encryption key must be %d bytes, got %d", LogEncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, xerrors.Errorf("create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, xerrors.Errorf("create gcm: %w", err)
+	}
+	return &LogCipher{aead: aead, keyID: LogEncryptionKeyID(key)}, nil
+}
+
+// ParseLogEncryptionKey decodes a base64 encoded key, as accepted by the
+// agent.
+func ParseLogEncryptionKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, xerrors.Errorf("decode log encryption key: %w", err)
+	}
+	if len(key) != LogEncryptionKeySize {
+		return nil, xerrors.Errorf("log encryption key must be %d bytes, got %d", LogEncryptionKeySize, len(key))
+	}
+	return key, nil
+}
+
+// LogEncryptionKeyID identifies a key without revealing it, so readers of
+// logs can tell which key of which workspace decrypts them.
+func LogEncryptionKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// KeyID returns the ID of the key of the cipher, see LogEncryptionKeyID.
+func (c *LogCipher) KeyID() string {
+	return c.keyID
+}
+
+// Encrypt returns the encrypted output. The ID of the key is authenticated
+// along with the output, so the output can't be attributed to another key.
+func (c *LogCipher) Encrypt(output string) (string, error) {
+	sealed, err := c.seal([]byte(output))
+	if err != nil {
+		return "", err
+	}
+	return EncryptedLogPrefix + c.keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of output encrypted by Encrypt. Output that
+// isn't encrypted is returned as is, since logs of a source may be sent
+// before the key was configured.
+func (c *LogCipher) Decrypt(output string) (string, error) {
+	if !IsEncryptedLog(output) {
+		return output, nil
+	}
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(output, EncryptedLogPrefix), ":")
+	if !ok {
+		return "", xerrors.New("malformed encrypted log")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", xerrors.Errorf("decode encrypted log: %w", err)
+	}
+	plaintext, err := c.open(keyID, sealed)
+	if err != nil {
+		return "", xerrors.Errorf("decrypt log: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// DecryptLog returns the log with its output and the values of its fields
+// decrypted.
+func (c *LogCipher) DecryptLog(log codersdk.WorkspaceAgentLog) (codersdk.WorkspaceAgentLog, error) {
+	output, err := c.Decrypt(log.Output)
+	if err != nil {
+		return codersdk.WorkspaceAgentLog{}, err
+	}
+	log.Output = output
+	if len(log.Fields) > 0 {
+		fields := make(map[string]string, len(log.Fields))
+		for name, value := range log.Fields {
+			fields[name], err = c.Decrypt(value)
+			if err != nil {
+				return codersdk.WorkspaceAgentLog{}, xerrors.Errorf("field %q: %w", name, err)
+			}
+		}
+		log.Fields = fields
+	}
+	return log, nil
+}
+
+// EncryptArtifacts returns the encrypted archive of script artifacts.
+func (c *LogCipher) EncryptArtifacts(archive []byte) ([]byte, error) {
+	sealed, err := c.seal(archive)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(EncryptedArtifactsPrefix+c.keyID+":"), sealed...), nil
+}
+
+// DecryptArtifacts returns the plaintext of an archive encrypted by
+// EncryptArtifacts. Archives that aren't encrypted are returned as is.
+func (c *LogCipher) DecryptArtifacts(archive []byte) ([]byte, error) {
+	if !IsEncryptedArtifacts(archive) {
+		return archive, nil
+	}
+	keyID, sealed, ok := bytes.Cut(bytes.TrimPrefix(archive, []byte(EncryptedArtifactsPrefix)), []byte(":"))
+	if !ok {
+		return nil, xerrors.New("malformed encrypted artifacts")
+	}
+	plaintext, err := c.open(string(keyID), sealed)
+	if err != nil {
+		return nil, xerrors.Errorf("decrypt artifacts: %w", err)
+	}
+	return plaintext, nil
+}
+
+func (c *LogCipher) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, xerrors.Errorf("generate nonce: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, []byte(c.keyID)), nil
+}
+
+func (c *LogCipher) open(keyID string, sealed []byte) ([]byte, error) {
+	if keyID != c.keyID {
+		return nil, xerrors.Errorf("encrypted with key %q, not %q", keyID, c.keyID)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, xerrors.New("malformed ciphertext")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, ciphertext, []byte(keyID))
+}
+
+// IsEncryptedLog returns whether the output of a log was encrypted by a
+// LogCipher.
+func IsEncryptedLog(output string) bool {
+	return strings.HasPrefix(output, EncryptedLogPrefix)
+}
+
+// IsEncryptedArtifacts returns whether an archive of script artifacts was
+// encrypted by a LogCipher.
+func IsEncryptedArtifacts(archive []byte) bool {
+	return bytes.HasPrefix(archive, []byte(EncryptedArtifactsPrefix))
+}
+
+// EncryptPatchLogs wraps patchLogs to encrypt the output and the values of
+// the fields of the logs with the cipher before they're sent.
+func EncryptPatchLogs(patchLogs func(ctx context.Context, req PatchLogs) error, c *LogCipher) func(ctx context.Context, req PatchLogs) error {
+	return func(ctx context.Context, req PatchLogs) error {
+		logs := make([]Log, 0, len(req.Logs))
+		for _, log := range req.Logs {
+			output, err := c.Encrypt(log.Output)
+			if err != nil {
+				return xerrors.Errorf("encrypt log: %w", err)
+			}
+			log.Output = output
+			if len(log.Fields) > 0 {
+				fields := make(map[string]string, len(log.Fields))
+				for name, value := range log.Fields {
+					fields[name], err = c.Encrypt(value)
+					if err != nil {
+						return xerrors.Errorf("encrypt log field %q: %w", name, err)
+					}
+				}
+				log.Fields = fields
+			}
+			logs = append(logs, log)
+		}
+		req.Logs = logs
+		return patchLogs(ctx, req)
+	}
+}
+
+// EncryptScriptArtifacts wraps upload to encrypt the archives of script
+// artifacts with the cipher before they're uploaded.
+func EncryptScriptArtifacts(upload func(ctx context.Context, req ScriptArtifacts) error, c *LogCipher) func(ctx context.Context, req ScriptArtifacts) error {
+	return func(ctx context.Context, req ScriptArtifacts) error {
+		archive, err := io.ReadAll(req.Archive)
+		if err != nil {
+			return xerrors.Errorf("read artifacts: %w", err)
+		}
+		encrypted, err := c.EncryptArtifacts(archive)
+		if err != nil {
+			return xerrors.Errorf("encrypt artifacts: %w", err)
+		}
+		req.Archive = bytes.NewReader(encrypted)
+		return upload(ctx, req)
+	}
+}
@@ -0,0 +1,143 @@
+package agentsdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+func TestLogCipher(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{1}, agentsdk.LogEncryptionKeySize)
+	c, err := agentsdk.NewLogCipher(key)
+	require.NoError(t, err)
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		t.Parallel()
+		encrypted, err := c.Encrypt("secret output")
+		require.NoError(t, err)
+		require.True(t, agentsdk.IsEncryptedLog(encrypted))
+		require.NotContains(t, encrypted, "secret output")
+		require.True(t, strings.HasPrefix(encrypted, agentsdk.EncryptedLogPrefix+c.KeyID()+":"))
+
+		decrypted, err := c.Decrypt(encrypted)
+		require.NoError(t, err)
+		require.Equal(t, "secret output", decrypted)
+	})
+
+	t.Run("Plaintext", func(t *testing.T) {
+		t.Parallel()
+		decrypted, err := c.Decrypt("plain output")
+		require.NoError(t, err)
+		require.Equal(t, "plain output", decrypted)
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		t.Parallel()
+		other, err := agentsdk.NewLogCipher(bytes.Repeat([]byte{2}, agentsdk.LogEncryptionKeySize))
+		require.NoError(t, err)
+		encrypted, err := other.Encrypt("secret output")
+		require.NoError(t, err)
+		_, err = c.Decrypt(encrypted)
+		require.ErrorContains(t, err, "encrypted with key")
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		t.Parallel()
+		encrypted, err := c.Encrypt("secret output")
+		require.NoError(t, err)
+		sealed, err := base64.StdEncoding.DecodeString(encrypted[strings.LastIndex(encrypted, ":")+1:])
+		require.NoError(t, err)
+		sealed[len(sealed)-1] ^= 1
+		tampered := agentsdk.EncryptedLogPrefix + c.KeyID() + ":" + base64.StdEncoding.EncodeToString(sealed)
+		_, err = c.Decrypt(tampered)
+		require.ErrorContains(t, err, "decrypt log")
+	})
+}
+
+func TestParseLogEncryptionKey(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{1}, agentsdk.LogEncryptionKeySize)
+	parsed, err := agentsdk.ParseLogEncryptionKey(base64.StdEncoding.EncodeToString(key) + "\n")
+	require.NoError(t, err)
+	require.Equal(t, key, parsed)
+
+	_, err = agentsdk.ParseLogEncryptionKey(base64.StdEncoding.EncodeToString(key[:16]))
+	require.ErrorContains(t, err, "must be 32 bytes")
+	_, err = agentsdk.ParseLogEncryptionKey("not base64!")
+	require.ErrorContains(t, err, "decode log encryption key")
+}
+
+func TestEncryptPatchLogs(t *testing.T) {
+	t.Parallel()
+
+	c, err := agentsdk.NewLogCipher(bytes.Repeat([]byte{1}, agentsdk.LogEncryptionKeySize))
+	require.NoError(t, err)
+	var sent agentsdk.PatchLogs
+	patchLogs := agentsdk.EncryptPatchLogs(func(_ context.Context, req agentsdk.PatchLogs) error {
+		sent = req
+		return nil
+	}, c)
+
+	logs := []agentsdk.Log{{Output: "first"}, {Output: "second", Fields: map[string]string{"stage": "start"}}}
+	err = patchLogs(context.Background(), agentsdk.PatchLogs{Logs: logs})
+	require.NoError(t, err)
+	require.Len(t, sent.Logs, 2)
+	for i, log := range sent.Logs {
+		require.True(t, agentsdk.IsEncryptedLog(log.Output))
+		output, err := c.Decrypt(log.Output)
+		require.NoError(t, err)
+		require.Equal(t, logs[i].Output, output)
+	}
+	// The names of fields are kept, their values are encrypted.
+	require.True(t, agentsdk.IsEncryptedLog(sent.Logs[1].Fields["stage"]))
+	decrypted, err := c.DecryptLog(codersdk.WorkspaceAgentLog{
+		Output: sent.Logs[1].Output,
+		Fields: sent.Logs[1].Fields,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"stage": "start"}, decrypted.Fields)
+	// The logs of the caller aren't modified.
+	require.Equal(t, "first", logs[0].Output)
+	require.Equal(t, "start", logs[1].Fields["stage"])
+}
+
+func TestEncryptScriptArtifacts(t *testing.T) {
+	t.Parallel()
+
+	c, err := agentsdk.NewLogCipher(bytes.Repeat([]byte{1}, agentsdk.LogEncryptionKeySize))
+	require.NoError(t, err)
+	var uploaded []byte
+	upload := agentsdk.EncryptScriptArtifacts(func(_ context.Context, req agentsdk.ScriptArtifacts) error {
+		uploaded, err = io.ReadAll(req.Archive)
+		return err
+	}, c)
+
+	err = upload(context.Background(), agentsdk.ScriptArtifacts{Archive: strings.NewReader("secret archive")})
+	require.NoError(t, err)
+	require.True(t, agentsdk.IsEncryptedArtifacts(uploaded))
+	require.NotContains(t, string(uploaded), "secret archive")
+
+	archive, err := c.DecryptArtifacts(uploaded)
+	require.NoError(t, err)
+	require.Equal(t, "secret archive", string(archive))
+
+	// Archives that aren't encrypted are kept.
+	archive, err = c.DecryptArtifacts([]byte("plain archive"))
+	require.NoError(t, err)
+	require.Equal(t, "plain archive", string(archive))
+
+	uploaded[len(uploaded)-1] ^= 1
+	_, err = c.DecryptArtifacts(uploaded)
+	require.ErrorContains(t, err, "decrypt artifacts")
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"time"
@@ -22,7 +23,23 @@ type startupLogsWriter struct {
 	ctx    context.Context
 	send   func(ctx context.Context, log ...Log) error
 	level  codersdk.LogLevel
+	stream codersdk.LogStream
 	source uuid.UUID
+	parse  LogLineParser
+}
+
+// log returns the log of a line written to the writer.
+func (w *startupLogsWriter) log(line string) Log {
+	log := Log{
+		CreatedAt: time.Now().UTC(), // UTC, like dbtime.Now().
+		Level:     w.level,
+		Stream:    w.stream,
+		Output:    line,
+	}
+	if w.parse != nil {
+		log.Output, log.Fields = w.parse(line)
+	}
+	return log
 }
 
 func (w *startupLogsWriter) Write(p []byte) (int, error) {
@@ -42,11 +59,7 @@ func (w *startupLogsWriter) Write(p []byte) (int, error) {
 			partial = w.buf.Bytes()
 			w.buf.Reset()
 		}
-		err := w.send(w.ctx, Log{
-			CreatedAt: time.Now().UTC(), // UTC, like dbtime.Now().
-			Level:     w.level,
-			Output:    string(partial) + string(p[:nl-cr]),
-		})
+		err := w.send(w.ctx, w.log(string(partial)+string(p[:nl-cr])))
 		if err != nil {
 			return n - len(p), err
 		}
@@ -64,11 +77,7 @@ func (w *startupLogsWriter) Write(p []byte) (int, error) {
 func (w *startupLogsWriter) Close() error {
 	if w.buf.Len() > 0 {
 		defer w.buf.Reset()
-		return w.send(w.ctx, Log{
-			CreatedAt: time.Now().UTC(), // UTC, like dbtime.Now().
-			Level:     w.level,
-			Output:    w.buf.String(),
-		})
+		return w.send(w.ctx, w.log(w.buf.String()))
 	}
 	return nil
 }
@@ -81,15 +90,46 @@ func (w *startupLogsWriter) Close() error {
 //
 // Neither Write nor Close is safe for concurrent use and must be used
 // by a single goroutine.
-func LogsWriter(ctx context.Context, sender func(ctx context.Context, log ...Log) error, source uuid.UUID, level codersdk.LogLevel) io.WriteCloser {
+func LogsWriter(ctx context.Context, sender func(ctx context.Context, log ...Log) error, source uuid.UUID, level codersdk.LogLevel, opts ...func(*logsWriterOptions)) io.WriteCloser {
+	return LogsStreamWriter(ctx, sender, source, level, "", opts...)
+}
+
+// LogsStreamWriter is like LogsWriter, but tags every log with the output
+// stream of the process it's written to, e.g. to send stdout and stderr of
+// a script as separate streams.
+func LogsStreamWriter(ctx context.Context, sender func(ctx context.Context, log ...Log) error, source uuid.UUID, level codersdk.LogLevel, stream codersdk.LogStream, opts ...func(*logsWriterOptions)) io.WriteCloser {
+	var o logsWriterOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	return &startupLogsWriter{
 		ctx:    ctx,
 		send:   sender,
 		level:  level,
+		stream: stream,
 		source: source,
+		parse:  o.parse,
+	}
+}
+
+// LogLineParser parses a line written to a LogsWriter, e.g. to extract the
+// fields of a structured log line. It returns the output of the log and
+// its fields, which may be nil.
+type LogLineParser func(line string) (output string, fields map[string]string)
+
+// LogsWriterParser parses every line written to the writer with the
+// parser, so logs can be filtered by field rather than by their output
+// only.
+func LogsWriterParser(parse LogLineParser) func(*logsWriterOptions) {
+	return func(o *logsWriterOptions) {
+		o.parse = parse
 	}
 }
 
+type logsWriterOptions struct {
+	parse LogLineParser
+}
+
 // LogsSenderFlushTimeout changes the default flush timeout (250ms),
 // this is mostly useful for tests.
 func LogsSenderFlushTimeout(timeout time.Duration) func(*logsSenderOptions) {
@@ -98,8 +138,196 @@ func LogsSenderFlushTimeout(timeout time.Duration) func(*logsSenderOptions) {
 	}
 }
 
+// LogsSenderDeduplicate collapses consecutive identical logs, e.g. from a
+// script stuck in a retry loop. The first log is sent as usual, and the
+// repeats are summarized by a single log with the repeat count, like
+// syslog's "message repeated N times". The summary is sent when a different
+// log is sent, when the sender is closed, or once the repeats span the
+// report interval, so long running loops are still visible. A zero
+// interval only reports repeats once they end.
+func LogsSenderDeduplicate(reportInterval time.Duration) func(*logsSenderOptions) {
+	return func(o *logsSenderOptions) {
+		o.dedupe = true
+		o.dedupeReportInterval = reportInterval
+	}
+}
+
+// LogsSenderRateLimit limits the rate of logs sent, so a script printing in a
+// tight loop can't flood the connection to coderd. Up to burst logs are sent
+// at once, which refills at linesPerSecond. Excess logs are dropped and
+// summarized by a single log with the count of suppressed logs, sent at most
+// once per logsRateLimitReportInterval and when the sender is closed. A
+// rate of zero disables the limit.
+func LogsSenderRateLimit(linesPerSecond float64, burst int) func(*logsSenderOptions) {
+	return func(o *logsSenderOptions) {
+		o.rateLimit = linesPerSecond
+		o.rateLimitBurst = burst
+	}
+}
+
+// LogsSenderOnDiscard calls fn with the number of logs the sender discarded,
+// because they were rejected as too large or the sender was closed before
+// they were sent.
+func LogsSenderOnDiscard(fn func(count int)) func(*logsSenderOptions) {
+	return func(o *logsSenderOptions) {
+		o.onDiscard = fn
+	}
+}
+
 type logsSenderOptions struct {
-	flushTimeout time.Duration
+	flushTimeout         time.Duration
+	dedupe               bool
+	dedupeReportInterval time.Duration
+	rateLimit            float64
+	rateLimitBurst       int
+	onDiscard            func(count int)
+}
+
+// logsRateLimitReportInterval is the interval at which suppressed logs are
+// reported while a script keeps exceeding the rate limit.
+const logsRateLimitReportInterval = 5 * time.Second
+
+// logRateLimiter drops logs exceeding the rate limit before they are added
+// to the backlog of the sender. It's a token bucket that is refilled with
+// the creation time of logs, rather than the time they're sent.
+type logRateLimiter struct {
+	rate  float64
+	burst float64
+
+	tokens float64
+	last   time.Time
+
+	suppressed int
+	// firstSuppressed and lastSuppressed are the times of the unreported
+	// suppressed logs.
+	firstSuppressed time.Time
+	lastSuppressed  time.Time
+}
+
+func newLogRateLimiter(rate float64, burst int) *logRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &logRateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// allow reports whether a log created at the time is within the rate limit.
+func (l *logRateLimiter) allow(t time.Time) bool {
+	if !l.last.IsZero() && t.After(l.last) {
+		l.tokens += t.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	if l.last.IsZero() || t.After(l.last) {
+		l.last = t
+	}
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// add appends the logs within the rate limit to the backlog.
+func (l *logRateLimiter) add(backlog []Log, logs ...Log) []Log {
+	for _, log := range logs {
+		if !l.allow(log.CreatedAt) {
+			if l.suppressed == 0 {
+				l.firstSuppressed = log.CreatedAt
+			}
+			l.suppressed++
+			l.lastSuppressed = log.CreatedAt
+			continue
+		}
+		backlog = l.flushExpired(backlog, log.CreatedAt)
+		backlog = append(backlog, log)
+	}
+	return backlog
+}
+
+// flushExpired reports the suppressed logs once per report interval.
+func (l *logRateLimiter) flushExpired(backlog []Log, now time.Time) []Log {
+	if l.suppressed == 0 || now.Sub(l.firstSuppressed) < logsRateLimitReportInterval {
+		return backlog
+	}
+	return l.flush(backlog)
+}
+
+// flush appends the summary of the suppressed logs to the backlog.
+func (l *logRateLimiter) flush(backlog []Log) []Log {
+	if l.suppressed == 0 {
+		return backlog
+	}
+	backlog = append(backlog, Log{
+		CreatedAt: l.lastSuppressed,
+		Level:     codersdk.LogLevelWarn,
+		Output:    fmt.Sprintf("suppressed %d log lines exceeding the rate limit of %g lines per second", l.suppressed, l.rate),
+	})
+	l.suppressed = 0
+	return backlog
+}
+
+// logDeduper collapses consecutive identical logs before they are added to
+// the backlog of the sender.
+type logDeduper struct {
+	reportInterval time.Duration
+
+	last    *Log
+	repeats int
+	// firstRepeat and lastRepeat are the times of the unreported repeats.
+	firstRepeat time.Time
+	lastRepeat  time.Time
+}
+
+// add appends the logs to the backlog, collapsing repeats.
+func (d *logDeduper) add(backlog []Log, logs ...Log) []Log {
+	for _, log := range logs {
+		if d.last != nil && d.last.Output == log.Output && d.last.Level == log.Level && d.last.Stream == log.Stream {
+			if d.repeats == 0 {
+				d.firstRepeat = log.CreatedAt
+			}
+			d.repeats++
+			d.lastRepeat = log.CreatedAt
+			if d.reportInterval > 0 && d.lastRepeat.Sub(d.firstRepeat) >= d.reportInterval {
+				backlog = d.flush(backlog)
+			}
+			continue
+		}
+		backlog = d.flush(backlog)
+		log := log
+		d.last = &log
+		backlog = append(backlog, log)
+	}
+	return backlog
+}
+
+// flushExpired reports repeats that span the report interval, even if no
+// logs are sent anymore.
+func (d *logDeduper) flushExpired(backlog []Log, now time.Time) []Log {
+	if d.repeats == 0 || d.reportInterval <= 0 || now.Sub(d.firstRepeat) < d.reportInterval {
+		return backlog
+	}
+	return d.flush(backlog)
+}
+
+// flush appends the summary of the unreported repeats to the backlog.
+func (d *logDeduper) flush(backlog []Log) []Log {
+	if d.repeats == 0 {
+		return backlog
+	}
+	backlog = append(backlog, Log{
+		CreatedAt: d.lastRepeat,
+		Level:     d.last.Level,
+		Stream:    d.last.Stream,
+		Output:    fmt.Sprintf("message repeated %d times: [%s]", d.repeats, d.last.Output),
+	})
+	d.repeats = 0
+	return backlog
 }
 
 // LogsSender will send agent startup logs to the server. Calls to
@@ -110,6 +338,7 @@ type logsSenderOptions struct {
 func LogsSender(sourceID uuid.UUID, patchLogs func(ctx context.Context, req PatchLogs) error, logger slog.Logger, opts ...func(*logsSenderOptions)) (sendLog func(ctx context.Context, log ...Log) error, flushAndClose func(context.Context) error) {
 	o := logsSenderOptions{
 		flushTimeout: 250 * time.Millisecond,
+		onDiscard:    func(int) {},
 	}
 	for _, opt := range opts {
 		opt(&o)
@@ -133,10 +362,31 @@ func LogsSender(sourceID uuid.UUID, patchLogs func(ctx context.Context, req Patc
 		flush := time.NewTicker(o.flushTimeout)
 
 		var backlog []Log
+		addLogs := func(logs []Log) {
+			backlog = append(backlog, logs...)
+		}
+		var limiter *logRateLimiter
+		if o.rateLimit > 0 {
+			limiter = newLogRateLimiter(o.rateLimit, o.rateLimitBurst)
+			addLogs = func(logs []Log) {
+				backlog = limiter.add(backlog, logs...)
+			}
+		}
+		// Repeats are collapsed before the rate limit is applied, so they
+		// don't count towards it.
+		var dedupe *logDeduper
+		if o.dedupe {
+			dedupe = &logDeduper{reportInterval: o.dedupeReportInterval}
+			limitLogs := addLogs
+			addLogs = func(logs []Log) {
+				limitLogs(dedupe.add(nil, logs...))
+			}
+		}
 		defer func() {
 			flush.Stop()
 			if len(backlog) > 0 {
 				logger.Warn(ctx, "startup logs sender exiting early, discarding logs", slog.F("discarded_logs_count", len(backlog)))
+				o.onDiscard(len(backlog))
 			}
 			logger.Debug(ctx, "startup logs sender exited")
 			close(sendDone)
@@ -154,13 +404,26 @@ func LogsSender(sourceID uuid.UUID, patchLogs func(ctx context.Context, req Patc
 				// Check queued logs before flushing.
 				select {
 				case logs := <-send:
-					backlog = append(backlog, logs...)
+					addLogs(logs)
 				default:
 				}
+				if dedupe != nil {
+					backlog = append(backlog, dedupe.flush(nil)...)
+				}
+				if limiter != nil {
+					backlog = limiter.flush(backlog)
+				}
 			case <-flush.C:
 				flushed = true
+				now := time.Now()
+				if dedupe != nil {
+					addLogs(dedupe.flushExpired(nil, now))
+				}
+				if limiter != nil {
+					backlog = limiter.flushExpired(backlog, now)
+				}
 			case logs := <-send:
-				backlog = append(backlog, logs...)
+				addLogs(logs)
 				flushed = len(backlog) >= backlogLimit
 			}
 
@@ -190,6 +453,7 @@ func LogsSender(sourceID uuid.UUID, patchLogs func(ctx context.Context, req Patc
 					if errors.As(err, &statusErr) {
 						if statusErr.StatusCode() == http.StatusRequestEntityTooLarge {
 							logger.Warn(ctx, "startup logs too large, discarding logs", slog.F("discarded_logs_count", len(backlog)), slog.Error(err))
+							o.onDiscard(len(backlog))
 							err = nil
 							break
 						}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -218,6 +219,57 @@ func TestStartupLogsWriter_Write(t *testing.T) {
 	}
 }
 
+func TestLogsStreamWriter(t *testing.T) {
+	t.Parallel()
+
+	var got []agentsdk.Log
+	send := func(_ context.Context, log ...agentsdk.Log) error {
+		got = append(got, log...)
+		return nil
+	}
+	w := agentsdk.LogsStreamWriter(context.Background(), send, uuid.New(), codersdk.LogLevelError, codersdk.LogStreamStderr)
+	_, err := w.Write([]byte("first\nsec"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.Len(t, got, 2)
+	for _, log := range got {
+		require.Equal(t, codersdk.LogLevelError, log.Level)
+		require.Equal(t, codersdk.LogStreamStderr, log.Stream)
+	}
+	require.Equal(t, "first", got[0].Output)
+	require.Equal(t, "sec", got[1].Output)
+}
+
+func TestLogsWriterParser(t *testing.T) {
+	t.Parallel()
+
+	var got []agentsdk.Log
+	send := func(_ context.Context, log ...agentsdk.Log) error {
+		got = append(got, log...)
+		return nil
+	}
+	parse := func(line string) (string, map[string]string) {
+		output, step, ok := strings.Cut(line, " step=")
+		if !ok {
+			return line, nil
+		}
+		return output, map[string]string{"step": step}
+	}
+	w := agentsdk.LogsWriter(context.Background(), send, uuid.New(), codersdk.LogLevelInfo, agentsdk.LogsWriterParser(parse))
+	_, err := w.Write([]byte("cloning step=git\nplain\ninstalling step=deps"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.Len(t, got, 3)
+	require.Equal(t, "cloning", got[0].Output)
+	require.Equal(t, map[string]string{"step": "git"}, got[0].Fields)
+	require.Equal(t, "plain", got[1].Output)
+	require.Nil(t, got[1].Fields)
+	require.Equal(t, "installing", got[2].Output)
+	require.Equal(t, map[string]string{"step": "deps"}, got[2].Fields)
+}
+
 type statusError int
 
 func (s statusError) StatusCode() int {
@@ -372,3 +424,125 @@ func TestStartupLogsSender(t *testing.T) {
 		// The patch request should have been canceled if it was active.
 	})
 }
+
+func TestLogsSenderDeduplicate(t *testing.T) {
+	t.Parallel()
+
+	ctx := testutil.Context(t, testutil.WaitMedium)
+	var got []agentsdk.Log
+	patchLogs := func(_ context.Context, req agentsdk.PatchLogs) error {
+		got = append(got, req.Logs...)
+		return nil
+	}
+	sendLog, flushAndClose := agentsdk.LogsSender(uuid.New(), patchLogs, slogtest.Make(t, nil),
+		agentsdk.LogsSenderFlushTimeout(time.Hour), agentsdk.LogsSenderDeduplicate(time.Minute))
+
+	start := time.Now()
+	log := func(offset time.Duration, output string, stream codersdk.LogStream) agentsdk.Log {
+		return agentsdk.Log{
+			CreatedAt: start.Add(offset),
+			Level:     codersdk.LogLevelError,
+			Stream:    stream,
+			Output:    output,
+		}
+	}
+	for _, l := range []agentsdk.Log{
+		log(0, "connection refused", codersdk.LogStreamStderr),
+		log(time.Second, "connection refused", codersdk.LogStreamStderr),
+		log(2*time.Second, "connection refused", codersdk.LogStreamStderr),
+		// The same output on another stream isn't a repeat.
+		log(3*time.Second, "connection refused", codersdk.LogStreamStdout),
+		log(4*time.Second, "retrying", codersdk.LogStreamStdout),
+		log(5*time.Second, "retrying", codersdk.LogStreamStdout),
+		// Repeats spanning the report interval are reported.
+		log(65*time.Second, "retrying", codersdk.LogStreamStdout),
+		log(66*time.Second, "retrying", codersdk.LogStreamStdout),
+	} {
+		require.NoError(t, sendLog(ctx, l))
+	}
+	require.NoError(t, flushAndClose(ctx))
+
+	require.Equal(t, []agentsdk.Log{
+		log(0, "connection refused", codersdk.LogStreamStderr),
+		log(2*time.Second, "message repeated 2 times: [connection refused]", codersdk.LogStreamStderr),
+		log(3*time.Second, "connection refused", codersdk.LogStreamStdout),
+		log(4*time.Second, "retrying", codersdk.LogStreamStdout),
+		log(65*time.Second, "message repeated 2 times: [retrying]", codersdk.LogStreamStdout),
+		log(66*time.Second, "message repeated 1 times: [retrying]", codersdk.LogStreamStdout),
+	}, got)
+}
+
+func TestLogsSenderRateLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx := testutil.Context(t, testutil.WaitMedium)
+	var got []agentsdk.Log
+	patchLogs := func(_ context.Context, req agentsdk.PatchLogs) error {
+		got = append(got, req.Logs...)
+		return nil
+	}
+	sendLog, flushAndClose := agentsdk.LogsSender(uuid.New(), patchLogs, slogtest.Make(t, nil),
+		agentsdk.LogsSenderFlushTimeout(time.Hour), agentsdk.LogsSenderRateLimit(1, 2))
+
+	start := time.Now()
+	log := func(offset time.Duration, level codersdk.LogLevel, output string) agentsdk.Log {
+		return agentsdk.Log{
+			CreatedAt: start.Add(offset),
+			Level:     level,
+			Output:    output,
+		}
+	}
+	for _, l := range []agentsdk.Log{
+		// The burst is sent, the rest is suppressed.
+		log(0, codersdk.LogLevelInfo, "1"),
+		log(0, codersdk.LogLevelInfo, "2"),
+		log(0, codersdk.LogLevelInfo, "3"),
+		log(0, codersdk.LogLevelInfo, "4"),
+		// The limit refills, but suppressed logs are only reported once
+		// per interval.
+		log(time.Second, codersdk.LogLevelInfo, "5"),
+		log(6*time.Second, codersdk.LogLevelInfo, "6"),
+		log(6*time.Second, codersdk.LogLevelInfo, "7"),
+		log(6*time.Second, codersdk.LogLevelInfo, "8"),
+		log(6*time.Second, codersdk.LogLevelInfo, "9"),
+	} {
+		require.NoError(t, sendLog(ctx, l))
+	}
+	require.NoError(t, flushAndClose(ctx))
+
+	require.Equal(t, []agentsdk.Log{
+		log(0, codersdk.LogLevelInfo, "1"),
+		log(0, codersdk.LogLevelInfo, "2"),
+		log(time.Second, codersdk.LogLevelInfo, "5"),
+		log(0, codersdk.LogLevelWarn, "suppressed 2 log lines exceeding the rate limit of 1 lines per second"),
+		log(6*time.Second, codersdk.LogLevelInfo, "6"),
+		log(6*time.Second, codersdk.LogLevelInfo, "7"),
+		log(6*time.Second, codersdk.LogLevelWarn, "suppressed 2 log lines exceeding the rate limit of 1 lines per second"),
+	}, got)
+}
+
+func TestLogsSenderOnDiscard(t *testing.T) {
+	t.Parallel()
+
+	ctx := testutil.Context(t, testutil.WaitMedium)
+	patchLogs := func(ctx context.Context, _ agentsdk.PatchLogs) error {
+		// Never succeeds, e.g. because coderd is unreachable.
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	var discarded int
+	sendLog, flushAndClose := agentsdk.LogsSender(uuid.New(), patchLogs, slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+		agentsdk.LogsSenderFlushTimeout(time.Hour), agentsdk.LogsSenderOnDiscard(func(count int) {
+			discarded += count
+		}))
+	for _, output := range []string{"1", "2", "3"} {
+		require.NoError(t, sendLog(ctx, agentsdk.Log{CreatedAt: time.Now(), Output: output}))
+	}
+
+	flushCtx, cancel := context.WithTimeout(ctx, testutil.IntervalFast)
+	defer cancel()
+	err := flushAndClose(flushCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	// flushAndClose waits for the sender to exit.
+	require.Equal(t, 3, discarded)
+}
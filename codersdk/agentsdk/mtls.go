@@ -0,0 +1,97 @@
+package agentsdk
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ClientCertificate is a TLS client certificate loaded from disk that is
+// transparently reloaded when the underlying files change. This allows
+// certificates provisioned into the workspace (e.g. by the template) to be
+// rotated without restarting the agent.
+type ClientCertificate struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex // Protects following.
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// NewClientCertificate loads the certificate and key pair from the provided
+// PEM encoded files. An error is returned if the pair cannot be loaded.
+func NewClientCertificate(certFile, keyFile string) (*ClientCertificate, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, xerrors.New("both a certificate and key file must be specified")
+	}
+	c := &ClientCertificate{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.reloadLocked()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate. If the
+// certificate or key file changed since they were last loaded, the pair is
+// reloaded. When reloading fails, e.g. because the files are in the middle of
+// being rotated, the previously loaded certificate is used.
+func (c *ClientCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.reloadLocked()
+	return c.cert, nil
+}
+
+// reloadLocked loads the certificate pair if either file changed since the
+// last load.
+func (c *ClientCertificate) reloadLocked() error {
+	certStat, err := os.Stat(c.certFile)
+	if err != nil {
+		return xerrors.Errorf("stat client certificate: %w", err)
+	}
+	keyStat, err := os.Stat(c.keyFile)
+	if err != nil {
+		return xerrors.Errorf("stat client key: %w", err)
+	}
+	if c.cert != nil && certStat.ModTime().Equal(c.certMod) && keyStat.ModTime().Equal(c.keyMod) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return xerrors.Errorf("load client certificate: %w", err)
+	}
+	c.cert = &cert
+	c.certMod = certStat.ModTime()
+	c.keyMod = keyStat.ModTime()
+	return nil
+}
+
+// UseClientCertificate configures the client to present the provided
+// certificate when the server requests one, enabling mutual TLS between the
+// agent and coderd. This applies to both regular API requests and the
+// agent RPC connection.
+func (c *Client) UseClientCertificate(cert *ClientCertificate) error {
+	transport, err := c.cloneTransport()
+	if err != nil {
+		return err
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	transport.TLSClientConfig.GetClientCertificate = cert.GetClientCertificate
+	c.SDK.HTTPClient.Transport = transport
+	return nil
+}
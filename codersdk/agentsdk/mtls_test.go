@@ -0,0 +1,77 @@
+package agentsdk_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	commonNames := make(chan string, 2)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commonNames <- r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAnyClientCert,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	writeClientCertificate(t, certFile, keyFile, "first", time.Now())
+
+	cert, err := agentsdk.NewClientCertificate(certFile, keyFile)
+	require.NoError(t, err)
+
+	srvURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	client := agentsdk.New(srvURL)
+	client.SDK.HTTPClient = srv.Client()
+	require.NoError(t, client.UseClientCertificate(cert))
+
+	ctx := testutil.Context(t, testutil.WaitShort)
+	err = client.PostLifecycle(ctx, agentsdk.PostLifecycleRequest{State: codersdk.WorkspaceAgentLifecycleReady})
+	require.NoError(t, err)
+	require.Equal(t, "first", <-commonNames)
+
+	// Rotate the certificate, new connections should use it.
+	writeClientCertificate(t, certFile, keyFile, "second", time.Now().Add(time.Minute))
+	client.SDK.HTTPClient.CloseIdleConnections()
+	err = client.PostLifecycle(ctx, agentsdk.PostLifecycleRequest{State: codersdk.WorkspaceAgentLifecycleReady})
+	require.NoError(t, err)
+	require.Equal(t, "second", <-commonNames)
+}
+
+func writeClientCertificate(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+	cert := testutil.GenerateTLSCertificate(t, commonName)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	// Explicitly set the modification time, filesystems may have a coarse
+	// timestamp resolution.
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
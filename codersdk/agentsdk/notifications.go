@@ -0,0 +1,97 @@
+package agentsdk
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/agent/proto"
+)
+
+// NotificationSeverity is how urgently a notification needs the attention
+// of the workspace owner.
+type NotificationSeverity string
+
+const (
+	NotificationSeverityInfo    NotificationSeverity = "info"
+	NotificationSeverityWarning NotificationSeverity = "warning"
+	NotificationSeverityError   NotificationSeverity = "error"
+)
+
+// Kinds of the notifications raised by the agent.
+const (
+	NotificationKindLowDisk      = "low_disk"
+	NotificationKindOOM          = "oom"
+	NotificationKindScriptFailed = "script_failed"
+)
+
+const (
+	// MaxNotificationTitleLength is the maximum length of the title of a
+	// notification.
+	MaxNotificationTitleLength = 256
+	// MaxNotificationMessageLength is the maximum length of the message of a
+	// notification.
+	MaxNotificationMessageLength = 4096
+)
+
+// Notification is a user-visible notification raised by the agent, e.g.
+// when the disk of the workspace is almost full. coderd routes
+// notifications to the notification channels of the workspace owner.
+type Notification struct {
+	Severity NotificationSeverity `json:"severity"`
+	// Kind groups notifications with the same cause, e.g. "low_disk", so
+	// they can be deduplicated and routed by kind.
+	Kind      string            `json:"kind"`
+	Title     string            `json:"title"`
+	Message   string            `json:"message"`
+	CreatedAt time.Time         `json:"created_at"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Validate checks that the notification can be shown to the user.
+func (n Notification) Validate() error {
+	switch n.Severity {
+	case NotificationSeverityInfo, NotificationSeverityWarning, NotificationSeverityError:
+	default:
+		return xerrors.Errorf("unknown notification severity %q", n.Severity)
+	}
+	if n.Kind == "" {
+		return xerrors.New("notification kind is required")
+	}
+	if n.Title == "" {
+		return xerrors.New("notification title is required")
+	}
+	if len(n.Title) > MaxNotificationTitleLength {
+		return xerrors.Errorf("notification title of %d bytes exceeds %d bytes", len(n.Title), MaxNotificationTitleLength)
+	}
+	if len(n.Message) > MaxNotificationMessageLength {
+		return xerrors.Errorf("notification message of %d bytes exceeds %d bytes", len(n.Message), MaxNotificationMessageLength)
+	}
+	return nil
+}
+
+// CreateNotificationClient is a partial interface of proto.DRPCAgentClient.
+type CreateNotificationClient interface {
+	CreateNotification(ctx context.Context, req *proto.CreateNotificationRequest) (*proto.CreateNotificationResponse, error)
+}
+
+// NotificationPoster returns a function that raises notifications over the
+// agent API.
+func NotificationPoster(aAPI CreateNotificationClient) func(ctx context.Context, notification Notification) error {
+	return func(ctx context.Context, notification Notification) error {
+		err := notification.Validate()
+		if err != nil {
+			return xerrors.Errorf("invalid notification: %w", err)
+		}
+		pNotification, err := ProtoFromNotification(notification)
+		if err != nil {
+			return xerrors.Errorf("convert notification: %w", err)
+		}
+		_, err = aAPI.CreateNotification(ctx, &proto.CreateNotificationRequest{Notification: pNotification})
+		if err != nil {
+			return xerrors.Errorf("create notification: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,49 @@
+package agentsdk_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/agent/proto"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+type fakeNotificationClient []*proto.Notification
+
+func (f *fakeNotificationClient) CreateNotification(_ context.Context, req *proto.CreateNotificationRequest) (*proto.CreateNotificationResponse, error) {
+	*f = append(*f, req.Notification)
+	return &proto.CreateNotificationResponse{}, nil
+}
+
+func TestNotificationPoster(t *testing.T) {
+	t.Parallel()
+
+	ctx := testutil.Context(t, testutil.WaitShort)
+	var client fakeNotificationClient
+	notify := agentsdk.NotificationPoster(&client)
+
+	err := notify(ctx, agentsdk.Notification{
+		Severity: agentsdk.NotificationSeverityError,
+		Kind:     agentsdk.NotificationKindScriptFailed,
+		Title:    "Backup script failed",
+		Message:  "exit status 1",
+	})
+	require.NoError(t, err)
+	require.Len(t, client, 1)
+	require.Equal(t, proto.Notification_ERROR, client[0].Severity)
+	require.Equal(t, agentsdk.NotificationKindScriptFailed, client[0].Kind)
+
+	for _, invalid := range []agentsdk.Notification{
+		{Kind: "oom", Title: "Out of memory"},
+		{Severity: agentsdk.NotificationSeverityInfo, Title: "No kind"},
+		{Severity: agentsdk.NotificationSeverityInfo, Kind: "oom"},
+		{Severity: agentsdk.NotificationSeverityInfo, Kind: "oom", Title: strings.Repeat("a", agentsdk.MaxNotificationTitleLength+1)},
+	} {
+		require.Error(t, notify(ctx, invalid))
+	}
+	require.Len(t, client, 1)
+}
@@ -0,0 +1,76 @@
+package agentsdk
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// DefaultMaxConnections is the default limit of connections the agent
+	// opens to coderd.
+	DefaultMaxConnections = 8
+	// DefaultIdleConnectionTimeout is how long idle connections to coderd are
+	// kept open by default.
+	DefaultIdleConnectionTimeout = 90 * time.Second
+)
+
+// ConnectionPoolOptions configure the connections the agent shares between
+// the API requests and the RPC connection to coderd.
+type ConnectionPoolOptions struct {
+	// MaxConnections limits the connections to coderd, requests wait for a
+	// connection once the limit is reached. The RPC and coordination
+	// websockets hold a connection for as long as they are open, so the limit
+	// must leave room for API requests. Defaults to DefaultMaxConnections.
+	MaxConnections int
+	// IdleTimeout is how long an idle connection is kept open to be reused.
+	// Defaults to DefaultIdleConnectionTimeout.
+	IdleTimeout time.Duration
+}
+
+// UseConnectionPool configures the client to reuse its connections to coderd
+// for logs, stats, metadata and the agent RPC connection, instead of opening
+// new ones when requests overlap. HTTP/2 is negotiated with coderd over TLS,
+// so concurrent requests are multiplexed over a single connection.
+func (c *Client) UseConnectionPool(opts ConnectionPoolOptions) error {
+	if opts.MaxConnections < 0 {
+		return xerrors.Errorf("max connections must not be negative, got %d", opts.MaxConnections)
+	}
+	if opts.MaxConnections == 0 {
+		opts.MaxConnections = DefaultMaxConnections
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultIdleConnectionTimeout
+	}
+	transport, err := c.cloneTransport()
+	if err != nil {
+		return err
+	}
+	transport.MaxConnsPerHost = opts.MaxConnections
+	// The default of two idle connections closes the connections of
+	// overlapping requests once they complete, and the next burst of requests
+	// pays for new TLS handshakes.
+	transport.MaxIdleConnsPerHost = opts.MaxConnections
+	transport.IdleConnTimeout = opts.IdleTimeout
+	transport.ForceAttemptHTTP2 = true
+	c.SDK.HTTPClient.Transport = transport
+	return nil
+}
+
+// cloneTransport returns a copy of the transport of the client, so it can be
+// configured without affecting other clients sharing it.
+func (c *Client) cloneTransport() (*http.Transport, error) {
+	switch t := c.SDK.HTTPClient.Transport.(type) {
+	case nil:
+		defaultTransport, ok := http.DefaultTransport.(*http.Transport)
+		if !ok {
+			return nil, xerrors.Errorf("unsupported default transport %T", http.DefaultTransport)
+		}
+		return defaultTransport.Clone(), nil
+	case *http.Transport:
+		return t.Clone(), nil
+	default:
+		return nil, xerrors.Errorf("unsupported transport %T", t)
+	}
+}
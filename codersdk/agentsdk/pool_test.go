@@ -0,0 +1,123 @@
+package agentsdk_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/coder/coder/v2/codersdk"
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestUseConnectionPool(t *testing.T) {
+	t.Parallel()
+
+	t.Run("HTTP2", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu          sync.Mutex
+			remoteAddrs = map[string]struct{}{}
+		)
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			remoteAddrs[r.RemoteAddr] = struct{}{}
+			mu.Unlock()
+			if r.ProtoMajor != 2 {
+				w.WriteHeader(http.StatusHTTPVersionNotSupported)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+
+		srvURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+		client := agentsdk.New(srvURL)
+		// A transport with a custom TLS configuration doesn't attempt
+		// HTTP/2 unless forced to.
+		srvTransport, ok := srv.Client().Transport.(*http.Transport)
+		require.True(t, ok)
+		client.SDK.HTTPClient = &http.Client{Transport: &http.Transport{
+			TLSClientConfig: srvTransport.TLSClientConfig,
+		}}
+		require.NoError(t, client.UseConnectionPool(agentsdk.ConnectionPoolOptions{}))
+
+		ctx := testutil.Context(t, testutil.WaitShort)
+		// The first request negotiates HTTP/2, the following ones are
+		// multiplexed over its connection.
+		require.NoError(t, client.PostLifecycle(ctx, agentsdk.PostLifecycleRequest{State: codersdk.WorkspaceAgentLifecycleReady}))
+		var eg errgroup.Group
+		for i := 0; i < 10; i++ {
+			eg.Go(func() error {
+				return client.PostLifecycle(ctx, agentsdk.PostLifecycleRequest{State: codersdk.WorkspaceAgentLifecycleReady})
+			})
+		}
+		require.NoError(t, eg.Wait())
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, remoteAddrs, 1)
+	})
+
+	t.Run("MaxConnections", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu          sync.Mutex
+			inFlight    int
+			maxInFlight int
+			remoteAddrs = map[string]struct{}{}
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			remoteAddrs[r.RemoteAddr] = struct{}{}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}()
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		t.Cleanup(srv.Close)
+
+		srvURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+		client := agentsdk.New(srvURL)
+		require.NoError(t, client.UseConnectionPool(agentsdk.ConnectionPoolOptions{MaxConnections: 2}))
+
+		ctx := testutil.Context(t, testutil.WaitShort)
+		var eg errgroup.Group
+		for i := 0; i < 20; i++ {
+			eg.Go(func() error {
+				return client.PostLifecycle(ctx, agentsdk.PostLifecycleRequest{State: codersdk.WorkspaceAgentLifecycleReady})
+			})
+		}
+		require.NoError(t, eg.Wait())
+		mu.Lock()
+		defer mu.Unlock()
+		require.LessOrEqual(t, maxInFlight, 2)
+		// Idle connections are reused instead of being closed.
+		require.LessOrEqual(t, len(remoteAddrs), 2)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+
+		client := agentsdk.New(&url.URL{Scheme: "http", Host: "localhost"})
+		err := client.UseConnectionPool(agentsdk.ConnectionPoolOptions{MaxConnections: -1})
+		require.Error(t, err)
+	})
+}
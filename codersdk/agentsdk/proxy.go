@@ -0,0 +1,48 @@
+package agentsdk
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig is the HTTP proxy configuration of a workspace. The values
+// have the format of the conventional proxy environment variables.
+type ProxyConfig struct {
+	HTTPProxy  string `json:"http_proxy,omitempty"`
+	HTTPSProxy string `json:"https_proxy,omitempty"`
+	NoProxy    string `json:"no_proxy,omitempty"`
+}
+
+// Environ returns the proxy environment variables of the configuration, in
+// both upper and lower case since tools disagree on which to read.
+func (c ProxyConfig) Environ() []string {
+	var env []string
+	for _, v := range []struct{ name, value string }{
+		{"HTTP_PROXY", c.HTTPProxy},
+		{"HTTPS_PROXY", c.HTTPSProxy},
+		{"NO_PROXY", c.NoProxy},
+	} {
+		if v.value == "" {
+			continue
+		}
+		env = append(env, v.name+"="+v.value, strings.ToLower(v.name)+"="+v.value)
+	}
+	return env
+}
+
+// ProxyFunc returns a function for http.Transport that selects the proxy of
+// a request according to the configuration. Requests to localhost aren't
+// proxied.
+func (c ProxyConfig) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  c.HTTPProxy,
+		HTTPSProxy: c.HTTPSProxy,
+		NoProxy:    c.NoProxy,
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
@@ -0,0 +1,44 @@
+package agentsdk_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+)
+
+func TestProxyConfig(t *testing.T) {
+	t.Parallel()
+
+	config := agentsdk.ProxyConfig{
+		HTTPSProxy: "http://proxy.corp:3128",
+		NoProxy:    ".internal.corp",
+	}
+	require.Equal(t, []string{
+		"HTTPS_PROXY=http://proxy.corp:3128",
+		"https_proxy=http://proxy.corp:3128",
+		"NO_PROXY=.internal.corp",
+		"no_proxy=.internal.corp",
+	}, config.Environ())
+
+	proxy := config.ProxyFunc()
+	for target, want := range map[string]string{
+		"https://github.com":          "http://proxy.corp:3128",
+		"https://git.internal.corp":   "",
+		"http://github.com":           "",
+		"https://localhost:8080/path": "",
+	} {
+		u, err := url.Parse(target)
+		require.NoError(t, err)
+		proxyURL, err := proxy(&http.Request{URL: u})
+		require.NoError(t, err)
+		if want == "" {
+			require.Nil(t, proxyURL, target)
+			continue
+		}
+		require.Equal(t, want, proxyURL.String(), target)
+	}
+}
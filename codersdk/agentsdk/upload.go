@@ -0,0 +1,294 @@
+package agentsdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/coder/retry"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/codersdk"
+)
+
+const (
+	// DefaultUploadChunkSize is the size of the chunks files are uploaded in
+	// by default.
+	DefaultUploadChunkSize = 4 << 20
+	// DefaultUploadMaxAttempts is the default number of consecutive failed
+	// attempts to upload a chunk before the upload fails.
+	DefaultUploadMaxAttempts = 5
+)
+
+// Headers of resumable uploads. The client asks how much of a file the
+// server received with a HEAD request, and sends the remainder in PATCH
+// requests of one chunk each, starting at UploadOffsetHeader. The server
+// responds to a chunk with the offset of the next one, and with 201
+// Created once it received the whole file and verified its checksum. A
+// 409 Conflict means the offset of the chunk isn't the one the server
+// expects, e.g. after a chunk was received but its response was lost.
+const (
+	UploadOffsetHeader = "Upload-Offset"
+	UploadLengthHeader = "Upload-Length"
+	// UploadChecksumHeader identifies the upload, the server stores the
+	// chunks of different files separately.
+	UploadChecksumHeader = "Upload-Checksum"
+	// ContentTypeUploadChunk is the content type of the chunks.
+	ContentTypeUploadChunk = "application/offset+octet-stream"
+)
+
+// UploadOptions configure a chunked upload.
+type UploadOptions struct {
+	// ChunkSize is the size of the chunks. Defaults to
+	// DefaultUploadChunkSize.
+	ChunkSize int64
+	// BytesPerSecond limits the bandwidth of the upload, so large files
+	// don't saturate the connection of the workspace. Zero disables the
+	// limit.
+	BytesPerSecond int64
+	// MaxAttempts is the number of consecutive failed attempts to upload a
+	// chunk before the upload fails. Defaults to DefaultUploadMaxAttempts.
+	MaxAttempts int
+	// ContentType is the content type of the whole file, sent if the server
+	// doesn't support chunked uploads and the file is uploaded at once.
+	ContentType string
+}
+
+// Upload uploads the content to the endpoint at path in chunks. Uploads are
+// resumed where the server left off, so a lost connection or a restart of
+// the agent doesn't upload the whole file again. The server verifies the
+// SHA-256 checksum of the content once it's complete.
+//
+// Servers predating chunked uploads don't accept HEAD requests, the content
+// is uploaded at once with a POST request to them instead.
+func (c *Client) Upload(ctx context.Context, path string, content io.ReadSeeker, opts UploadOptions) error {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultUploadChunkSize
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultUploadMaxAttempts
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, content)
+	if err != nil {
+		return xerrors.Errorf("hash content: %w", err)
+	}
+	u := &upload{
+		client:    c,
+		path:      path,
+		content:   content,
+		size:      size,
+		checksum:  "sha256=" + hex.EncodeToString(hash.Sum(nil)),
+		bandwidth: newBandwidthLimiter(opts.BytesPerSecond),
+	}
+
+	offset, err := u.offset(ctx)
+	if xerrors.Is(err, errChunkedUploadUnsupported) {
+		return u.post(ctx, opts.ContentType)
+	}
+	if err != nil {
+		return err
+	}
+	attempts := 0
+	for retrier := retry.New(100*time.Millisecond, 5*time.Second); ; {
+		next, done, err := u.sendChunk(ctx, offset, opts.ChunkSize)
+		if done {
+			return nil
+		}
+		if err == nil {
+			offset = next
+			attempts = 0
+			retrier.Reset()
+			continue
+		}
+		var permanent *permanentUploadError
+		if xerrors.As(err, &permanent) {
+			return permanent.err
+		}
+		attempts++
+		if attempts >= opts.MaxAttempts || !retrier.Wait(ctx) {
+			return xerrors.Errorf("upload chunk at offset %d: %w", offset, err)
+		}
+		// The server may have received the chunk even if the request
+		// failed, so the upload resumes at the offset it reports.
+		resumed, offsetErr := u.offset(ctx)
+		if offsetErr == nil {
+			offset = resumed
+		}
+	}
+}
+
+type upload struct {
+	client    *Client
+	path      string
+	content   io.ReadSeeker
+	size      int64
+	checksum  string
+	bandwidth *bandwidthLimiter
+}
+
+// permanentUploadError is returned for responses that retrying doesn't
+// change.
+type permanentUploadError struct {
+	err error
+}
+
+func (e *permanentUploadError) Error() string {
+	return e.err.Error()
+}
+
+func (u *upload) headers(r *http.Request) {
+	r.Header.Set(UploadLengthHeader, strconv.FormatInt(u.size, 10))
+	r.Header.Set(UploadChecksumHeader, u.checksum)
+}
+
+// errChunkedUploadUnsupported is returned by offset if the server only
+// accepts the whole file at once.
+var errChunkedUploadUnsupported = xerrors.New("server doesn't support chunked uploads")
+
+// offset returns the offset the server expects the next chunk at.
+func (u *upload) offset(ctx context.Context) (int64, error) {
+	res, err := u.client.SDK.Request(ctx, http.MethodHead, u.path, nil, u.headers)
+	if err != nil {
+		return 0, xerrors.Errorf("execute request: %w", err)
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return 0, nil
+	case http.StatusOK:
+		return parseUploadOffset(res, u.size)
+	case http.StatusMethodNotAllowed:
+		return 0, errChunkedUploadUnsupported
+	default:
+		return 0, codersdk.ReadBodyAsError(res)
+	}
+}
+
+// post uploads the whole content with a single request.
+func (u *upload) post(ctx context.Context, contentType string) error {
+	_, err := u.content.Seek(0, io.SeekStart)
+	if err != nil {
+		return xerrors.Errorf("seek content: %w", err)
+	}
+	body := u.bandwidth.reader(ctx, u.content)
+	res, err := u.client.SDK.Request(ctx, http.MethodPost, u.path, body, func(r *http.Request) {
+		r.Header.Set(UploadChecksumHeader, u.checksum)
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		r.ContentLength = u.size
+	})
+	if err != nil {
+		return xerrors.Errorf("execute request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return codersdk.ReadBodyAsError(res)
+	}
+	return nil
+}
+
+// sendChunk uploads the chunk at offset and returns the offset of the next
+// one, or done once the upload is complete.
+func (u *upload) sendChunk(ctx context.Context, offset, chunkSize int64) (next int64, done bool, err error) {
+	_, err = u.content.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, false, &permanentUploadError{err: xerrors.Errorf("seek content: %w", err)}
+	}
+	length := chunkSize
+	if remaining := u.size - offset; remaining < length {
+		length = remaining
+	}
+	body := u.bandwidth.reader(ctx, io.LimitReader(u.content, length))
+	res, err := u.client.SDK.Request(ctx, http.MethodPatch, u.path, body, u.headers, func(r *http.Request) {
+		r.Header.Set("Content-Type", ContentTypeUploadChunk)
+		r.Header.Set(UploadOffsetHeader, strconv.FormatInt(offset, 10))
+		r.ContentLength = length
+	})
+	if err != nil {
+		return 0, false, xerrors.Errorf("execute request: %w", err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusCreated:
+		return u.size, true, nil
+	case res.StatusCode == http.StatusNoContent:
+		next, err := parseUploadOffset(res, u.size)
+		if err != nil {
+			return 0, false, err
+		}
+		if next <= offset {
+			return 0, false, xerrors.Errorf("server didn't accept the chunk at offset %d", offset)
+		}
+		return next, false, nil
+	case res.StatusCode == http.StatusConflict, res.StatusCode >= http.StatusInternalServerError:
+		// Retried after resynchronizing the offset.
+		return 0, false, codersdk.ReadBodyAsError(res)
+	default:
+		// E.g. the checksum doesn't match the content.
+		return 0, false, &permanentUploadError{err: codersdk.ReadBodyAsError(res)}
+	}
+}
+
+func parseUploadOffset(res *http.Response, size int64) (int64, error) {
+	offset, err := strconv.ParseInt(res.Header.Get(UploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 || offset > size {
+		return 0, xerrors.Errorf("invalid %s header %q", UploadOffsetHeader, res.Header.Get(UploadOffsetHeader))
+	}
+	return offset, nil
+}
+
+// bandwidthLimiter paces the bytes read through its readers to a rate
+// shared by all chunks of an upload. A nil *bandwidthLimiter doesn't limit
+// anything.
+type bandwidthLimiter struct {
+	bytesPerSecond int64
+	start          time.Time
+	sent           int64
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond, start: time.Now()}
+}
+
+func (b *bandwidthLimiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	if b == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, limiter: b}
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// Reads are kept small so the rate is smooth.
+	if burst := l.limiter.bytesPerSecond/10 + 1; int64(len(p)) > burst {
+		p = p[:burst]
+	}
+	n, err := l.r.Read(p)
+	l.limiter.sent += int64(n)
+	due := l.limiter.start.Add(time.Duration(float64(l.limiter.sent) / float64(l.limiter.bytesPerSecond) * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-l.ctx.Done():
+			return n, l.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,236 @@
+package agentsdk_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/codersdk/agentsdk"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestUpload(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Chunks", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := &uploadServer{}
+		client := newUploadClient(t, srv)
+		content := randomContent(t, 10_000)
+
+		err := client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{ChunkSize: 4096})
+		require.NoError(t, err)
+		require.Equal(t, content, srv.completed)
+		require.Equal(t, 3, srv.chunks)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := &uploadServer{}
+		client := newUploadClient(t, srv)
+
+		err := client.Upload(ctx, "/upload", bytes.NewReader(nil), agentsdk.UploadOptions{})
+		require.NoError(t, err)
+		require.Empty(t, srv.completed)
+		require.Equal(t, 1, srv.chunks)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		// The second chunk is received, but its response is lost.
+		srv := &uploadServer{failAfterChunk: 2}
+		client := newUploadClient(t, srv)
+		content := randomContent(t, 10_000)
+
+		err := client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{ChunkSize: 4096})
+		require.NoError(t, err)
+		require.Equal(t, content, srv.completed)
+		// The upload resumes with the third chunk.
+		require.Equal(t, 3, srv.chunks)
+	})
+
+	t.Run("ResumeUploadedBefore", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := &uploadServer{}
+		client := newUploadClient(t, srv)
+		content := randomContent(t, 10_000)
+		srv.received = append([]byte(nil), content[:4096]...)
+
+		err := client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{ChunkSize: 4096})
+		require.NoError(t, err)
+		require.Equal(t, content, srv.completed)
+		require.Equal(t, 2, srv.chunks)
+	})
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := &uploadServer{corrupt: true}
+		client := newUploadClient(t, srv)
+
+		err := client.Upload(ctx, "/upload", bytes.NewReader(randomContent(t, 100)), agentsdk.UploadOptions{})
+		require.ErrorContains(t, err, "checksum mismatch")
+		require.Nil(t, srv.completed)
+	})
+
+	t.Run("BandwidthLimit", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		srv := &uploadServer{}
+		client := newUploadClient(t, srv)
+		content := randomContent(t, 64<<10)
+
+		start := time.Now()
+		err := client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{
+			ChunkSize:      16 << 10,
+			BytesPerSecond: 256 << 10,
+		})
+		require.NoError(t, err)
+		require.Equal(t, content, srv.completed)
+		require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	})
+
+	t.Run("FallbackPost", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		// Servers predating chunked uploads only accept the whole file.
+		srv := &uploadServer{postOnly: true}
+		client := newUploadClient(t, srv)
+		content := randomContent(t, 10_000)
+
+		err := client.Upload(ctx, "/upload", bytes.NewReader(content), agentsdk.UploadOptions{
+			ChunkSize:   4096,
+			ContentType: "application/x-tar",
+		})
+		require.NoError(t, err)
+		require.Equal(t, content, srv.completed)
+		require.Zero(t, srv.chunks)
+	})
+}
+
+func newUploadClient(t *testing.T, srv *uploadServer) *agentsdk.Client {
+	t.Helper()
+	server := httptest.NewServer(srv)
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return agentsdk.New(serverURL)
+}
+
+func randomContent(t *testing.T, size int) []byte {
+	t.Helper()
+	content := make([]byte, size)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	return content
+}
+
+// uploadServer implements the server side of a single chunked upload.
+type uploadServer struct {
+	// failAfterChunk fails the response of the chunk with the number after
+	// storing it.
+	failAfterChunk int
+	// corrupt corrupts the first byte received.
+	corrupt bool
+	// postOnly only accepts the whole file in a POST request, like servers
+	// predating chunked uploads.
+	postOnly bool
+
+	mu        sync.Mutex
+	received  []byte
+	completed []byte
+	chunks    int
+}
+
+func (s *uploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.postOnly {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/x-tar" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.completed = content
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	length, err := strconv.Atoi(r.Header.Get(agentsdk.UploadLengthHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodHead:
+		if s.received == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(agentsdk.UploadOffsetHeader, strconv.Itoa(len(s.received)))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		offset, err := strconv.Atoi(r.Header.Get(agentsdk.UploadOffsetHeader))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if offset != len(s.received) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		chunk, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.corrupt && offset == 0 && len(chunk) > 0 {
+			chunk[0]++
+		}
+		s.received = append(s.received, chunk...)
+		s.chunks++
+		if s.chunks == s.failAfterChunk {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(s.received) < length {
+			w.Header().Set(agentsdk.UploadOffsetHeader, strconv.Itoa(len(s.received)))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		sum := sha256.Sum256(s.received)
+		if r.Header.Get(agentsdk.UploadChecksumHeader) != "sha256="+hex.EncodeToString(sum[:]) {
+			s.received = nil
+			http.Error(w, "checksum mismatch", http.StatusBadRequest)
+			return
+		}
+		s.completed = s.received
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,68 @@
+package codersdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// UserAuthorizedKey is a public key that may authenticate to the SSH server
+// of the workspaces of a user, e.g. a hardware-backed key.
+type UserAuthorizedKey struct {
+	// PublicKey is in the authorized_keys format.
+	PublicKey string `json:"public_key"`
+	// Principals limit the usernames the key may log in as. Any username is
+	// accepted if empty.
+	Principals []string `json:"principals,omitempty"`
+}
+
+type UserAuthorizedKeys struct {
+	Keys []UserAuthorizedKey `json:"keys"`
+	// Required makes connections to workspaces authenticate with one of the
+	// keys in addition to coderd.
+	Required  bool      `json:"required"`
+	UpdatedAt time.Time `json:"updated_at" format:"date-time"`
+}
+
+type UpdateUserAuthorizedKeysRequest struct {
+	Keys     []UserAuthorizedKey `json:"keys"`
+	Required bool                `json:"required"`
+}
+
+// UserAuthorizedKeys returns the public keys authorized to SSH into the
+// workspaces of the user.
+func (c *Client) UserAuthorizedKeys(ctx context.Context, user string) (UserAuthorizedKeys, error) {
+	res, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("/api/v2/users/%s/authorized-keys", user), nil)
+	if err != nil {
+		return UserAuthorizedKeys{}, xerrors.Errorf("execute request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return UserAuthorizedKeys{}, ReadBodyAsError(res)
+	}
+
+	var keys UserAuthorizedKeys
+	return keys, json.NewDecoder(res.Body).Decode(&keys)
+}
+
+// UpdateUserAuthorizedKeys replaces the public keys authorized to SSH into
+// the workspaces of the user.
+func (c *Client) UpdateUserAuthorizedKeys(ctx context.Context, user string, req UpdateUserAuthorizedKeysRequest) (UserAuthorizedKeys, error) {
+	res, err := c.Request(ctx, http.MethodPut, fmt.Sprintf("/api/v2/users/%s/authorized-keys", user), req)
+	if err != nil {
+		return UserAuthorizedKeys{}, xerrors.Errorf("execute request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return UserAuthorizedKeys{}, ReadBodyAsError(res)
+	}
+
+	var keys UserAuthorizedKeys
+	return keys, json.NewDecoder(res.Body).Decode(&keys)
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -190,6 +191,23 @@ type DeploymentValues struct {
 	Healthcheck                     HealthcheckConfig                    `json:"healthcheck,omitempty" typescript:",notnull"`
 	CLIUpgradeMessage               clibase.String                       `json:"cli_upgrade_message,omitempty" typescript:",notnull"`
 
+	AgentExecPolicy                     clibase.Struct[[]AgentExecPolicyRule] `json:"agent_exec_policy,omitempty" typescript:",notnull"`
+	AgentReconnectingPTYPersistence     clibase.Bool                          `json:"agent_reconnecting_pty_persistence,omitempty" typescript:",notnull"`
+	AgentReconnectingPTYScrollbackLines clibase.Int64                         `json:"agent_reconnecting_pty_scrollback_lines,omitempty" typescript:",notnull"`
+	AgentHTTPProxy                      clibase.String                        `json:"agent_http_proxy,omitempty" typescript:",notnull"`
+	AgentHTTPSProxy                     clibase.String                        `json:"agent_https_proxy,omitempty" typescript:",notnull"`
+	AgentNoProxy                        clibase.String                        `json:"agent_no_proxy,omitempty" typescript:",notnull"`
+	AgentMOTDTemplate                   clibase.String                        `json:"agent_motd_template,omitempty" typescript:",notnull"`
+	AgentCodeServerVersion              clibase.String                        `json:"agent_code_server_version,omitempty" typescript:",notnull"`
+	AgentCodeServerPort                 clibase.Int64                         `json:"agent_code_server_port,omitempty" typescript:",notnull"`
+	AgentCodeServerExtensions           clibase.StringArray                   `json:"agent_code_server_extensions,omitempty" typescript:",notnull"`
+	AgentCodeServerChecksums            clibase.StringArray                   `json:"agent_code_server_checksums,omitempty" typescript:",notnull"`
+	AgentSSHKeepAliveInterval           clibase.Duration                      `json:"agent_ssh_keepalive_interval,omitempty" typescript:",notnull"`
+	AgentSSHKeepAliveCountMax           clibase.Int64                         `json:"agent_ssh_keepalive_count_max,omitempty" typescript:",notnull"`
+	AgentUpdateChannel                  clibase.String                        `json:"agent_update_channel,omitempty" typescript:",notnull"`
+	AgentUpdateVersionRange             clibase.String                        `json:"agent_update_version_range,omitempty" typescript:",notnull"`
+	AgentUpdateBinaryURL                clibase.String                        `json:"agent_update_binary_url,omitempty" typescript:",notnull"`
+
 	Config      clibase.YAMLConfigPath `json:"config,omitempty" typescript:",notnull"`
 	WriteConfig clibase.Bool           `json:"write_config,omitempty" typescript:",notnull"`
 
@@ -246,10 +264,11 @@ type DERPServerConfig struct {
 }
 
 type DERPConfig struct {
-	BlockDirect     clibase.Bool   `json:"block_direct" typescript:",notnull"`
-	ForceWebSockets clibase.Bool   `json:"force_websockets" typescript:",notnull"`
-	URL             clibase.String `json:"url" typescript:",notnull"`
-	Path            clibase.String `json:"path" typescript:",notnull"`
+	BlockDirect     clibase.Bool        `json:"block_direct" typescript:",notnull"`
+	ForceWebSockets clibase.Bool        `json:"force_websockets" typescript:",notnull"`
+	URL             clibase.String      `json:"url" typescript:",notnull"`
+	Path            clibase.String      `json:"path" typescript:",notnull"`
+	FallbackPaths   clibase.StringArray `json:"fallback_paths" typescript:",notnull"`
 }
 
 type PrometheusConfig struct {
@@ -372,6 +391,58 @@ type ProvisionerConfig struct {
 	DaemonPollJitter    clibase.Duration `json:"daemon_poll_jitter" typescript:",notnull"`
 	ForceCancelInterval clibase.Duration `json:"force_cancel_interval" typescript:",notnull"`
 	DaemonPSK           clibase.String   `json:"daemon_psk" typescript:",notnull"`
+
+	Sandbox                clibase.String      `json:"sandbox" typescript:",notnull"`
+	SandboxSeccompProfile  clibase.String      `json:"sandbox_seccomp_profile" typescript:",notnull"`
+	SandboxEgressAllowlist clibase.StringArray `json:"sandbox_egress_allowlist" typescript:",notnull"`
+
+	PrewarmTemplates clibase.Int64 `json:"prewarm_templates" typescript:",notnull"`
+	PrewarmMaxSizeMB clibase.Int64 `json:"prewarm_max_size_mb" typescript:",notnull"`
+
+	ProviderCredentials clibase.Struct[[]ProviderCredentialsConfig] `json:"provider_credentials" typescript:",notnull"`
+
+	MaxResources clibase.Int64 `json:"max_resources" typescript:",notnull"`
+	MaxDestroys  clibase.Int64 `json:"max_destroys" typescript:",notnull"`
+
+	FilesystemMirrors clibase.StringArray `json:"filesystem_mirrors" typescript:",notnull"`
+	NetworkMirrors    clibase.StringArray `json:"network_mirrors" typescript:",notnull"`
+
+	MaxApplyRetries  clibase.Int64       `json:"max_apply_retries" typescript:",notnull"`
+	SecretsResolvers clibase.StringArray `json:"secrets_resolvers" typescript:",notnull"`
+
+	VerifyProviders       clibase.Bool        `json:"verify_providers" typescript:",notnull"`
+	TrustedProviderHashes clibase.StringArray `json:"trusted_provider_hashes" typescript:",notnull"`
+
+	WorkDirectoryKeepOnFailure clibase.Bool     `json:"work_directory_keep_on_failure" typescript:",notnull"`
+	WorkDirectoryTTL           clibase.Duration `json:"work_directory_ttl" typescript:",notnull"`
+	WorkDirectoryMaxDisk       clibase.Int64    `json:"work_directory_max_disk" typescript:",notnull"`
+
+	HangTimeout       clibase.Duration `json:"hang_timeout" typescript:",notnull"`
+	DataSourceTimeout clibase.Duration `json:"data_source_timeout" typescript:",notnull"`
+}
+
+// ProviderCredentialsConfig exchanges a token of the workspace owner into
+// credentials of a Terraform provider for every build of the built-in
+// provisioner daemons.
+type ProviderCredentialsConfig struct {
+	// Type is the Terraform provider the credentials are for.
+	Type string `json:"type" yaml:"type" enums:"github,gitlab,aws,google,azurerm"`
+	// ExternalAuthID is the ID of the external auth provider whose access
+	// token is exchanged. The OIDC access token of the owner is used if
+	// empty.
+	ExternalAuthID string `json:"external_auth_id" yaml:"external_auth_id"`
+	// RoleARN is the AWS role assumed with the token.
+	RoleARN string `json:"role_arn" yaml:"role_arn"`
+	// Audience is the audience of the Google workload identity pool
+	// provider.
+	Audience string `json:"audience" yaml:"audience"`
+	// ServiceAccount is the email of the Google service account to
+	// impersonate, if any.
+	ServiceAccount string `json:"service_account" yaml:"service_account"`
+	// ClientID and TenantID identify the Azure application the token is
+	// federated with.
+	ClientID string `json:"client_id" yaml:"client_id"`
+	TenantID string `json:"tenant_id" yaml:"tenant_id"`
 }
 
 type RateLimitConfig struct {
@@ -907,6 +978,15 @@ when required by your organization's security policy.`,
 			Group:       &deploymentGroupNetworkingDERP,
 			YAML:        "configPath",
 		},
+		{
+			Name:        "DERP Config Fallback Paths",
+			Description: "Paths to read DERP mappings from that workspace agents fail over to, in order, when none of the relays of the primary DERP mapping are reachable. Clients relay through them to reach those agents, so their region IDs must be unique across all DERP mappings.",
+			Flag:        "derp-config-fallback-paths",
+			Env:         "CODER_DERP_CONFIG_FALLBACK_PATHS",
+			Value:       &c.DERP.Config.FallbackPaths,
+			Group:       &deploymentGroupNetworkingDERP,
+			YAML:        "fallbackPaths",
+		},
 		// TODO: support Git Auth settings.
 		// Prometheus settings
 		{
@@ -1408,6 +1488,191 @@ when required by your organization's security policy.`,
 			Group:       &deploymentGroupProvisioning,
 			YAML:        "daemonPSK",
 		},
+		{
+			Name:        "Provisioner Sandbox",
+			Description: "Execute Terraform of the built-in provisioner daemons in a sandbox to contain malicious templates or providers. The filesystem is read-only except for the working directory of the job. Supported values are \"nsjail\" and \"gvisor\".",
+			Flag:        "provisioner-sandbox",
+			Env:         "CODER_PROVISIONER_SANDBOX",
+			Value:       &c.Provisioner.Sandbox,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "sandbox",
+		},
+		{
+			Name:        "Provisioner Sandbox Seccomp Profile",
+			Description: "Path of a seccomp policy in the Kafel language applied to Terraform. Only supported by the nsjail sandbox.",
+			Flag:        "provisioner-sandbox-seccomp-profile",
+			Env:         "CODER_PROVISIONER_SANDBOX_SECCOMP_PROFILE",
+			Value:       &c.Provisioner.SandboxSeccompProfile,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "sandboxSeccompProfile",
+		},
+		{
+			Name:        "Provisioner Sandbox Egress Allowlist",
+			Description: "Hosts Terraform and providers in the sandbox may connect to through a proxy, e.g. \"registry.terraform.io\" or \"*.amazonaws.com\". Networking is disabled if it's empty.",
+			Flag:        "provisioner-sandbox-egress-allowlist",
+			Env:         "CODER_PROVISIONER_SANDBOX_EGRESS_ALLOWLIST",
+			Value:       &c.Provisioner.SandboxEgressAllowlist,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "sandboxEgressAllowlist",
+		},
+		{
+			Name:        "Provisioner Prewarm Templates",
+			Description: "Number of the most frequently built template versions the built-in provisioner daemons run \"terraform init\" for in advance while idle, so builds skip downloading providers and modules. Disabled if 0.",
+			Flag:        "provisioner-prewarm-templates",
+			Env:         "CODER_PROVISIONER_PREWARM_TEMPLATES",
+			Default:     "0",
+			Value:       &c.Provisioner.PrewarmTemplates,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "prewarmTemplates",
+		},
+		{
+			Name:        "Provisioner Prewarm Max Size",
+			Description: "Maximum disk usage in megabytes of the pre-warmed template versions of each built-in provisioner daemon. The least used template versions are evicted first. Unbounded if 0.",
+			Flag:        "provisioner-prewarm-max-size-mb",
+			Env:         "CODER_PROVISIONER_PREWARM_MAX_SIZE_MB",
+			Default:     "1024",
+			Value:       &c.Provisioner.PrewarmMaxSizeMB,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "prewarmMaxSizeMB",
+		},
+		{
+			Name:        "Provisioner Provider Credentials",
+			Description: "Credentials of Terraform providers exchanged from the external auth or OIDC tokens of the workspace owner for every build of the built-in provisioner daemons, instead of static credentials. Supported providers are \"github\", \"gitlab\", \"aws\", \"google\" and \"azurerm\".",
+			Flag:        "provisioner-provider-credentials",
+			Env:         "CODER_PROVISIONER_PROVIDER_CREDENTIALS",
+			Value:       &c.Provisioner.ProviderCredentials,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "providerCredentials",
+		},
+		{
+			Name:        "Provisioner Max Resources",
+			Description: "Maximum number of resources a workspace may have after a build of the built-in provisioner daemons, excluding resources of the Coder provider. Builds exceeding it fail before anything is applied. Unlimited if 0.",
+			Flag:        "provisioner-max-resources",
+			Env:         "CODER_PROVISIONER_MAX_RESOURCES",
+			Default:     "0",
+			Value:       &c.Provisioner.MaxResources,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "maxResources",
+		},
+		{
+			Name:        "Provisioner Max Destroys",
+			Description: "Maximum number of resources a build of the built-in provisioner daemons may delete or replace, excluding resources of the Coder provider and deleting the workspace. Protects against template bugs that would delete dozens of resources. Unlimited if 0.",
+			Flag:        "provisioner-max-destroys",
+			Env:         "CODER_PROVISIONER_MAX_DESTROYS",
+			Default:     "0",
+			Value:       &c.Provisioner.MaxDestroys,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "maxDestroys",
+		},
+		{
+			Name:        "Provisioner Filesystem Mirrors",
+			Description: "Directories of Terraform providers, as created by \"terraform providers mirror\", the built-in provisioner daemons install providers from. Setting mirrors enables the air-gapped mode: registries and Terraform releases aren't downloaded from, and builds using providers missing from the mirrors fail with an error naming them.",
+			Flag:        "provisioner-filesystem-mirrors",
+			Env:         "CODER_PROVISIONER_FILESYSTEM_MIRRORS",
+			Value:       &c.Provisioner.FilesystemMirrors,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "filesystemMirrors",
+		},
+		{
+			Name:        "Provisioner Network Mirrors",
+			Description: "HTTPS URLs of Terraform provider network mirrors the built-in provisioner daemons install providers from. Setting mirrors enables the air-gapped mode, see --provisioner-filesystem-mirrors.",
+			Flag:        "provisioner-network-mirrors",
+			Env:         "CODER_PROVISIONER_NETWORK_MIRRORS",
+			Value:       &c.Provisioner.NetworkMirrors,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "networkMirrors",
+		},
+		{
+			Name:        "Provisioner Max Apply Retries",
+			Description: "Maximum number of times the built-in provisioner daemons retry an apply that only failed with transient errors of providers, such as rate limits, eventual consistency or server errors of cloud APIs. Retries back off exponentially, starting at 10 seconds. Disabled if 0.",
+			Flag:        "provisioner-max-apply-retries",
+			Env:         "CODER_PROVISIONER_MAX_APPLY_RETRIES",
+			Default:     "0",
+			Value:       &c.Provisioner.MaxApplyRetries,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "maxApplyRetries",
+		},
+		{
+			Name:        "Provisioner Secrets Resolvers",
+			Description: `Secret stores the template variables of the built-in provisioner daemons can reference, of "vault" and "aws-secrets-manager". Variables set to "vault://<path>#<key>" or "awssm://<secret-id>#<key>" are resolved for every build and redacted from build logs. Vault is configured with the VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment variables, AWS Secrets Manager with the default AWS credentials.`,
+			Flag:        "provisioner-secrets-resolvers",
+			Env:         "CODER_PROVISIONER_SECRETS_RESOLVERS",
+			Value:       &c.Provisioner.SecretsResolvers,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "secretsResolvers",
+		},
+		{
+			Name:        "Provisioner Verify Providers",
+			Description: "Verify the providers installed by the built-in provisioner daemons before Terraform executes them. Builds fail with an untrusted provider error unless every provider package matches the checksums of the dependency lock file, and either the release archive signed by the registry of the provider or the hashes of --provisioner-trusted-provider-hashes.",
+			Flag:        "provisioner-verify-providers",
+			Env:         "CODER_PROVISIONER_VERIFY_PROVIDERS",
+			Default:     "false",
+			Value:       &c.Provisioner.VerifyProviders,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "verifyProviders",
+		},
+		{
+			Name:        "Provisioner Trusted Provider Hashes",
+			Description: `Provider packages the built-in provisioner daemons trust, as "<source>=<hash>" entries of a provider source address and a "h1:" hash of the dependency lock file, e.g. "registry.terraform.io/hashicorp/aws=h1:...". Packages of listed providers must match one of their hashes instead of the release archive signed by the registry, e.g. for providers installed from mirrors. Enables --provisioner-verify-providers.`,
+			Flag:        "provisioner-trusted-provider-hashes",
+			Env:         "CODER_PROVISIONER_TRUSTED_PROVIDER_HASHES",
+			Value:       &c.Provisioner.TrustedProviderHashes,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "trustedProviderHashes",
+		},
+		{
+			Name:        "Provisioner Work Directory Keep On Failure",
+			Description: "Keep the work directories of failed builds of the built-in provisioner daemons for debugging, until they expire. Secrets are removed from kept directories.",
+			Flag:        "provisioner-work-directory-keep-on-failure",
+			Env:         "CODER_PROVISIONER_WORK_DIRECTORY_KEEP_ON_FAILURE",
+			Default:     "false",
+			Value:       &c.Provisioner.WorkDirectoryKeepOnFailure,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "workDirectoryKeepOnFailure",
+		},
+		{
+			Name:        "Provisioner Work Directory TTL",
+			Description: "How long the work directories of the built-in provisioner daemons are kept after they were last modified.",
+			Flag:        "provisioner-work-directory-ttl",
+			Env:         "CODER_PROVISIONER_WORK_DIRECTORY_TTL",
+			Default:     (7 * 24 * time.Hour).String(),
+			Value:       &c.Provisioner.WorkDirectoryTTL,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "workDirectoryTTL",
+			Annotations: clibase.Annotations{}.Mark(annotationFormatDuration, "true"),
+		},
+		{
+			Name:        "Provisioner Work Directory Max Disk",
+			Description: "Maximum total size in bytes of the kept work directories of each built-in provisioner daemon. The oldest ones are removed first. Zero disables the limit.",
+			Flag:        "provisioner-work-directory-max-disk",
+			Env:         "CODER_PROVISIONER_WORK_DIRECTORY_MAX_DISK",
+			Default:     "0",
+			Value:       &c.Provisioner.WorkDirectoryMaxDisk,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "workDirectoryMaxDisk",
+		},
+		{
+			Name:        "Provisioner Hang Timeout",
+			Description: "Kill Terraform commands of the built-in provisioner daemons that don't write any output for the duration, and fail the build with an error pointing at the hang. The stack traces of Terraform and its providers are written to the build logs where supported. Keep it below 5 minutes, when builds are marked as hung, and above the time providers take to download. Disabled if 0.",
+			Flag:        "provisioner-hang-timeout",
+			Env:         "CODER_PROVISIONER_HANG_TIMEOUT",
+			Default:     "0s",
+			Value:       &c.Provisioner.HangTimeout,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "hangTimeout",
+			Annotations: clibase.Annotations{}.Mark(annotationFormatDuration, "true"),
+		},
+		{
+			Name:        "Provisioner Data Source Timeout",
+			Description: "Kill Terraform commands of the built-in provisioner daemons once a data source is read for longer than the duration, and fail the build with an error naming the data source. Reads are timed independently, so a single data source querying an unreachable API doesn't stall the plan with no explanation. Disabled if 0.",
+			Flag:        "provisioner-data-source-timeout",
+			Env:         "CODER_PROVISIONER_DATA_SOURCE_TIMEOUT",
+			Default:     "0s",
+			Value:       &c.Provisioner.DataSourceTimeout,
+			Group:       &deploymentGroupProvisioning,
+			YAML:        "dataSourceTimeout",
+			Annotations: clibase.Annotations{}.Mark(annotationFormatDuration, "true"),
+		},
 		// RateLimit settings
 		{
 			Name:        "Disable All Rate Limits",
@@ -1681,6 +1946,140 @@ when required by your organization's security policy.`,
 			Value:       &c.AgentFallbackTroubleshootingURL,
 			YAML:        "agentFallbackTroubleshootingURL",
 		},
+		{
+			Name:        "Agent Exec Policy",
+			Description: `Rules workspace agents evaluate for every command users execute over SSH, in web terminals and as scheduled tasks, e.g. to block "curl | sh" in CI-like workspaces. Rules have an action of "allow", "block" or "audit", and match commands by a "prefix" and/or a "regex". The first allow or block rule matching a command decides it, so a last block rule without a prefix and a regex only allows the commands of the rules before it.`,
+			Flag:        "agent-exec-policy",
+			Env:         "CODER_AGENT_EXEC_POLICY",
+			YAML:        "agentExecPolicy",
+			Value:       &c.AgentExecPolicy,
+		},
+		{
+			Name:        "Agent Reconnecting PTY Persistence",
+			Description: "Keep web terminal sessions running across workspace agent restarts, e.g. agent upgrades. Only sessions backed by screen are persisted, and they are quit if not reattached within the reconnecting PTY timeout.",
+			Flag:        "agent-reconnecting-pty-persistence",
+			Env:         "CODER_AGENT_RECONNECTING_PTY_PERSISTENCE",
+			YAML:        "agentReconnectingPTYPersistence",
+			Default:     "false",
+			Value:       &c.AgentReconnectingPTYPersistence,
+		},
+		{
+			Name:        "Agent Reconnecting PTY Scrollback Lines",
+			Description: "The number of lines of history workspace agents keep for web terminal sessions backed by screen. Capped at 100000.",
+			Flag:        "agent-reconnecting-pty-scrollback-lines",
+			Env:         "CODER_AGENT_RECONNECTING_PTY_SCROLLBACK_LINES",
+			YAML:        "agentReconnectingPTYScrollbackLines",
+			Default:     "1000",
+			Value:       &c.AgentReconnectingPTYScrollbackLines,
+		},
+		{
+			Name:        "Agent HTTP Proxy",
+			Description: "The proxy workspace agents use for HTTP requests, e.g. app health checks. It's also exported as HTTP_PROXY to scripts and SSH sessions.",
+			Flag:        "agent-http-proxy",
+			Env:         "CODER_AGENT_HTTP_PROXY",
+			Annotations: clibase.Annotations{}.Mark(annotationSecretKey, "true"),
+			Value:       &c.AgentHTTPProxy,
+		},
+		{
+			Name:        "Agent HTTPS Proxy",
+			Description: "The proxy workspace agents use for HTTPS requests. It's also exported as HTTPS_PROXY to scripts and SSH sessions.",
+			Flag:        "agent-https-proxy",
+			Env:         "CODER_AGENT_HTTPS_PROXY",
+			Annotations: clibase.Annotations{}.Mark(annotationSecretKey, "true"),
+			Value:       &c.AgentHTTPSProxy,
+		},
+		{
+			Name:        "Agent No Proxy",
+			Description: "Comma-separated hosts workspace agents reach without the proxy. It's also exported as NO_PROXY to scripts and SSH sessions.",
+			Flag:        "agent-no-proxy",
+			Env:         "CODER_AGENT_NO_PROXY",
+			YAML:        "agentNoProxy",
+			Value:       &c.AgentNoProxy,
+		},
+		{
+			Name:        "Agent MOTD Template",
+			Description: "A text/template rendered by workspace agents as the message of the day of SSH and web terminal sessions. It can use {{ .File }} for the contents of the MOTD file, {{ .Deadline }} for when the workspace stops and {{ .Warnings }} for outstanding problems like a failed build. If unset, only the MOTD file is shown.",
+			Flag:        "agent-motd-template",
+			Env:         "CODER_AGENT_MOTD_TEMPLATE",
+			YAML:        "agentMOTDTemplate",
+			Value:       &c.AgentMOTDTemplate,
+		},
+		{
+			Name:        "Agent code-server Version",
+			Description: "The release of code-server workspace agents install and supervise, e.g. \"4.20.0\". Agents only manage code-server if their template enables it.",
+			Flag:        "agent-code-server-version",
+			Env:         "CODER_AGENT_CODE_SERVER_VERSION",
+			YAML:        "agentCodeServerVersion",
+			Value:       &c.AgentCodeServerVersion,
+		},
+		{
+			Name:        "Agent code-server Port",
+			Description: "The localhost port of the code-server managed by workspace agents, which is exposed with a \"code-server\" app.",
+			Flag:        "agent-code-server-port",
+			Env:         "CODER_AGENT_CODE_SERVER_PORT",
+			YAML:        "agentCodeServerPort",
+			Default:     "13337",
+			Value:       &c.AgentCodeServerPort,
+		},
+		{
+			Name:        "Agent code-server Extensions",
+			Description: "The extensions workspace agents install before starting code-server, e.g. \"golang.go\".",
+			Flag:        "agent-code-server-extensions",
+			Env:         "CODER_AGENT_CODE_SERVER_EXTENSIONS",
+			YAML:        "agentCodeServerExtensions",
+			Value:       &c.AgentCodeServerExtensions,
+		},
+		{
+			Name:        "Agent code-server Checksums",
+			Description: "The SHA256 checksums of the code-server release archives by platform, e.g. \"linux-amd64=<sha256>\". Agents refuse to install releases without a matching checksum.",
+			Flag:        "agent-code-server-checksums",
+			Env:         "CODER_AGENT_CODE_SERVER_CHECKSUMS",
+			YAML:        "agentCodeServerChecksums",
+			Value:       &c.AgentCodeServerChecksums,
+		},
+		{
+			Name:        "Agent SSH Keepalive Interval",
+			Description: "How often workspace agents send keepalive requests on idle SSH connections, so they aren't dropped by NAT gateways and firewalls. Keepalives are disabled if it's 0.",
+			Flag:        "agent-ssh-keepalive-interval",
+			Env:         "CODER_AGENT_SSH_KEEPALIVE_INTERVAL",
+			YAML:        "agentSSHKeepaliveInterval",
+			Default:     "0s",
+			Value:       &c.AgentSSHKeepAliveInterval,
+			Annotations: clibase.Annotations{}.Mark(annotationFormatDuration, "true"),
+		},
+		{
+			Name:        "Agent SSH Keepalive Count Max",
+			Description: "The number of unanswered keepalive requests after which workspace agents close an SSH connection.",
+			Flag:        "agent-ssh-keepalive-count-max",
+			Env:         "CODER_AGENT_SSH_KEEPALIVE_COUNT_MAX",
+			YAML:        "agentSSHKeepaliveCountMax",
+			Default:     "3",
+			Value:       &c.AgentSSHKeepAliveCountMax,
+		},
+		{
+			Name:        "Agent Update Channel",
+			Description: "The release channel workspace agents follow to replace themselves with newer versions while the workspace is idle. \"deployment\" follows the version of the deployment. Updates are disabled if unset.",
+			Flag:        "agent-update-channel",
+			Env:         "CODER_AGENT_UPDATE_CHANNEL",
+			YAML:        "agentUpdateChannel",
+			Value:       &c.AgentUpdateChannel,
+		},
+		{
+			Name:        "Agent Update Version Range",
+			Description: "Constrains the versions workspace agents update to, e.g. \">= 2.6.0, < 3.0.0\". Any newer version is allowed if unset.",
+			Flag:        "agent-update-version-range",
+			Env:         "CODER_AGENT_UPDATE_VERSION_RANGE",
+			YAML:        "agentUpdateVersionRange",
+			Value:       &c.AgentUpdateVersionRange,
+		},
+		{
+			Name:        "Agent Update Binary URL",
+			Description: "Overrides where workspace agents download updates from, e.g. an internal mirror. {os}, {arch} and {version} are replaced with the platform of the agent and the version to update to. The mirror must serve the binaries of this deployment, agents refuse updates that don't match their checksum.",
+			Flag:        "agent-update-binary-url",
+			Env:         "CODER_AGENT_UPDATE_BINARY_URL",
+			YAML:        "agentUpdateBinaryURL",
+			Value:       &c.AgentUpdateBinaryURL,
+		},
 		{
 			Name:        "Browser Only",
 			Description: "Whether Coder only allows connections to workspaces via the browser.",
@@ -1921,6 +2320,30 @@ type SupportConfig struct {
 	Links clibase.Struct[[]LinkConfig] `json:"links" typescript:",notnull"`
 }
 
+// AgentExecPolicyRule is a rule of the exec policy of workspace agents. If
+// both Prefix and Regex are set, both must match, and a rule with neither
+// matches every command.
+type AgentExecPolicyRule struct {
+	Action string `json:"action" yaml:"action" enums:"allow,block,audit"`
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Regex  string `json:"regex,omitempty" yaml:"regex,omitempty"`
+}
+
+// Validate returns an error if the rule has an unknown action or an
+// invalid regular expression.
+func (r AgentExecPolicyRule) Validate() error {
+	if r.Action != "allow" && r.Action != "block" && r.Action != "audit" {
+		return xerrors.Errorf("unknown action %q, must be \"allow\", \"block\" or \"audit\"", r.Action)
+	}
+	if r.Regex != "" {
+		_, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return xerrors.Errorf("invalid regex %q: %w", r.Regex, err)
+		}
+	}
+	return nil
+}
+
 type LinkConfig struct {
 	Name   string `json:"name" yaml:"name"`
 	Target string `json:"target" yaml:"target"`
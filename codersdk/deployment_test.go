@@ -65,6 +65,12 @@ func TestDeploymentValues_HighlyConfigurable(t *testing.T) {
 		"External Token Encryption Keys": {
 			yaml: true,
 		},
+		"Agent HTTP Proxy": {
+			yaml: true,
+		},
+		"Agent HTTPS Proxy": {
+			yaml: true,
+		},
 		"External Auth Providers": {
 			// Technically External Auth Providers can be provided through the env,
 			// but bypassing clibase. See cli.ReadExternalAuthProvidersFromEnv.
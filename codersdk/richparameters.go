@@ -163,18 +163,30 @@ type ParameterResolver struct {
 // ValidateResolve checks the provided value, v, against the parameter, p, and the previous build.  If v is nil, it also
 // resolves the correct value.  It returns the value of the parameter, if valid, and an error if invalid.
 func (r *ParameterResolver) ValidateResolve(p TemplateVersionParameter, v *WorkspaceBuildParameter) (value string, err error) {
+	value, _, err = r.ValidateResolveSource(p, v)
+	return value, err
+}
+
+// ValidateResolveSource is like ValidateResolve, but also returns where the value came from. A provided value is user
+// input, even if it's equal to the default, unless it's marked as copied from the previous build and still matches it.
+func (r *ParameterResolver) ValidateResolveSource(p TemplateVersionParameter, v *WorkspaceBuildParameter) (value string, source WorkspaceBuildParameterSource, err error) {
 	prevV := r.findLastValue(p)
 	if !p.Mutable && v != nil && prevV != nil {
-		return "", xerrors.Errorf("Parameter %q is not mutable, so it can't be updated after creating a workspace.", p.Name)
+		return "", "", xerrors.Errorf("Parameter %q is not mutable, so it can't be updated after creating a workspace.", p.Name)
 	}
 	if p.Required && v == nil && prevV == nil {
-		return "", xerrors.Errorf("Parameter %q is required but not provided", p.Name)
+		return "", "", xerrors.Errorf("Parameter %q is required but not provided", p.Name)
 	}
 	// First, the provided value
 	resolvedValue := v
+	source = WorkspaceBuildParameterSourceUserInput
+	if v != nil && v.Source == WorkspaceBuildParameterSourcePreviousBuild && prevV != nil && v.Value == prevV.Value {
+		source = WorkspaceBuildParameterSourcePreviousBuild
+	}
 	// Second, previous value if not ephemeral
 	if resolvedValue == nil && !p.Ephemeral {
 		resolvedValue = prevV
+		source = WorkspaceBuildParameterSourcePreviousBuild
 	}
 	// Last, default value
 	if resolvedValue == nil {
@@ -182,12 +194,13 @@ func (r *ParameterResolver) ValidateResolve(p TemplateVersionParameter, v *Works
 			Name:  p.Name,
 			Value: p.DefaultValue,
 		}
+		source = WorkspaceBuildParameterSourceTemplateDefault
 	}
 	err = ValidateWorkspaceBuildParameter(p, resolvedValue, prevV)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	return resolvedValue.Value, nil
+	return resolvedValue.Value, source, nil
 }
 
 // findLastValue finds the value from the previous build and returns it, or nil if the parameter had no value in the
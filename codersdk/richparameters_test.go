@@ -37,6 +37,52 @@ func TestParameterResolver_ValidateResolve_Default(t *testing.T) {
 	require.Equal(t, "5", v)
 }
 
+func TestParameterResolver_ValidateResolveSource(t *testing.T) {
+	t.Parallel()
+	p := codersdk.TemplateVersionParameter{
+		Name:         "n",
+		Type:         "number",
+		Mutable:      true,
+		DefaultValue: "5",
+	}
+	for _, tc := range []struct {
+		name     string
+		previous []codersdk.WorkspaceBuildParameter
+		value    *codersdk.WorkspaceBuildParameter
+		source   codersdk.WorkspaceBuildParameterSource
+	}{{
+		name:   "Default",
+		source: codersdk.WorkspaceBuildParameterSourceTemplateDefault,
+	}, {
+		name:   "EnteredDefault",
+		value:  &codersdk.WorkspaceBuildParameter{Name: "n", Value: "5"},
+		source: codersdk.WorkspaceBuildParameterSourceUserInput,
+	}, {
+		name:     "Previous",
+		previous: []codersdk.WorkspaceBuildParameter{{Name: "n", Value: "6"}},
+		source:   codersdk.WorkspaceBuildParameterSourcePreviousBuild,
+	}, {
+		name:     "CopiedPrevious",
+		previous: []codersdk.WorkspaceBuildParameter{{Name: "n", Value: "6"}},
+		value:    &codersdk.WorkspaceBuildParameter{Name: "n", Value: "6", Source: codersdk.WorkspaceBuildParameterSourcePreviousBuild},
+		source:   codersdk.WorkspaceBuildParameterSourcePreviousBuild,
+	}, {
+		name:     "ChangedPrevious",
+		previous: []codersdk.WorkspaceBuildParameter{{Name: "n", Value: "6"}},
+		value:    &codersdk.WorkspaceBuildParameter{Name: "n", Value: "7", Source: codersdk.WorkspaceBuildParameterSourcePreviousBuild},
+		source:   codersdk.WorkspaceBuildParameterSourceUserInput,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			uut := codersdk.ParameterResolver{Rich: tc.previous}
+			_, source, err := uut.ValidateResolveSource(p, tc.value)
+			require.NoError(t, err)
+			require.Equal(t, tc.source, source)
+		})
+	}
+}
+
 func TestParameterResolver_ValidateResolve_MissingRequired(t *testing.T) {
 	t.Parallel()
 	uut := codersdk.ParameterResolver{}
@@ -29,8 +29,22 @@ type Template struct {
 	Description        string                 `json:"description"`
 	Deprecated         bool                   `json:"deprecated"`
 	DeprecationMessage string                 `json:"deprecation_message"`
-	Icon               string                 `json:"icon"`
-	DefaultTTLMillis   int64                  `json:"default_ttl_ms"`
+	// MaxAppSharingLevel is the widest sharing level the apps of workspaces
+	// built from the template may use.
+	MaxAppSharingLevel WorkspaceAppSharingLevel `json:"max_app_sharing_level" enums:"owner,authenticated,public"`
+	// CodeServerEnabled makes the agents of workspaces built from the
+	// template install and supervise the code-server release configured by
+	// the deployment, exposed with a "code-server" app.
+	CodeServerEnabled bool `json:"code_server_enabled"`
+	// ReplaceOnFailure makes builds replace the resources that failed to
+	// update in the previous build, or whose agents failed to connect or
+	// start in it.
+	ReplaceOnFailure bool   `json:"replace_on_failure"`
+	Icon             string `json:"icon"`
+	// DocsURL links to the documentation of the template, as described by
+	// the coder_template local of the active version.
+	DocsURL          string `json:"docs_url"`
+	DefaultTTLMillis int64  `json:"default_ttl_ms"`
 	// UseMaxTTL picks whether to use the deprecated max TTL for the template or
 	// the new autostop requirement.
 	UseMaxTTL bool `json:"use_max_ttl"`
@@ -247,6 +261,16 @@ type UpdateTemplateMeta struct {
 	// and must be explicitly granted to users or groups in the permissions settings
 	// of the template.
 	DisableEveryoneGroupAccess bool `json:"disable_everyone_group_access"`
+	// MaxAppSharingLevel limits the sharing level of the apps of workspaces
+	// built from the template. Builds planning apps shared more widely fail.
+	// If nil, the limit is unchanged.
+	MaxAppSharingLevel *WorkspaceAppSharingLevel `json:"max_app_sharing_level,omitempty" enums:"owner,authenticated,public"`
+	// CodeServerEnabled makes agents install and supervise code-server. It
+	// applies to workspaces when they're next built. If nil, it's unchanged.
+	CodeServerEnabled *bool `json:"code_server_enabled,omitempty"`
+	// ReplaceOnFailure makes builds replace the resources that failed in
+	// the previous build. If nil, it's unchanged.
+	ReplaceOnFailure *bool `json:"replace_on_failure,omitempty"`
 }
 
 type TemplateExample struct {
@@ -0,0 +1,99 @@
+package codersdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+)
+
+// UserNotificationSeverity is how urgently a notification needs the
+// attention of the user.
+type UserNotificationSeverity string
+
+const (
+	UserNotificationSeverityInfo    UserNotificationSeverity = "info"
+	UserNotificationSeverityWarning UserNotificationSeverity = "warning"
+	UserNotificationSeverityError   UserNotificationSeverity = "error"
+)
+
+// UserNotification is a notification raised by an agent of a workspace of
+// the user, e.g. when the disk of the workspace is almost full.
+type UserNotification struct {
+	WorkspaceID   uuid.UUID                `json:"workspace_id" format:"uuid"`
+	WorkspaceName string                   `json:"workspace_name"`
+	AgentID       uuid.UUID                `json:"agent_id" format:"uuid"`
+	AgentName     string                   `json:"agent_name"`
+	Severity      UserNotificationSeverity `json:"severity"`
+	// Kind groups notifications with the same cause, e.g. "low_disk".
+	Kind      string            `json:"kind"`
+	Title     string            `json:"title"`
+	Message   string            `json:"message"`
+	CreatedAt time.Time         `json:"created_at" format:"date-time"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// WatchUserNotifications streams the notifications raised by the agents of
+// the workspaces of the user from the time it returns. The channel is
+// closed when the context is canceled or the stream ends.
+func (c *Client) WatchUserNotifications(ctx context.Context, user string) (<-chan UserNotification, error) {
+	//nolint:bodyclose
+	res, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("/api/v2/users/%s/notifications/watch", user), nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, ReadBodyAsError(res)
+	}
+	nextEvent := ServerSentEventReader(ctx, res.Body)
+	// The server pings once it subscribed, so notifications raised after
+	// this returns aren't missed.
+	sse, err := nextEvent()
+	if err != nil {
+		_ = res.Body.Close()
+		return nil, xerrors.Errorf("read first event: %w", err)
+	}
+	if sse.Type == ServerSentEventTypeError {
+		_ = res.Body.Close()
+		var resp Response
+		b, _ := sse.Data.([]byte)
+		_ = json.Unmarshal(b, &resp)
+		return nil, xerrors.Errorf("watch user notifications: %s %s", resp.Message, resp.Detail)
+	}
+
+	notifications := make(chan UserNotification, 64)
+	go func() {
+		defer close(notifications)
+		defer res.Body.Close()
+
+		for {
+			sse, err := nextEvent()
+			if err != nil {
+				return
+			}
+			if sse.Type != ServerSentEventTypeData {
+				continue
+			}
+			b, ok := sse.Data.([]byte)
+			if !ok {
+				return
+			}
+			var notification UserNotification
+			err = json.Unmarshal(b, &notification)
+			if err != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case notifications <- notification:
+			}
+		}
+	}()
+	return notifications, nil
+}
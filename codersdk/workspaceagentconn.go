@@ -1,6 +1,7 @@
 package codersdk
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/json"
@@ -356,6 +357,93 @@ func (c *WorkspaceAgentConn) ListeningPorts(ctx context.Context) (WorkspaceAgent
 	return resp, json.NewDecoder(res.Body).Decode(&resp)
 }
 
+// WorkspaceAgentScheduledTask is a script the workspace owner scheduled at
+// runtime, in addition to the scripts of the template. Tasks are persisted
+// in the workspace and logged like scheduled scripts.
+type WorkspaceAgentScheduledTask struct {
+	ID             uuid.UUID `json:"id" format:"uuid"`
+	Name           string    `json:"name"`
+	Cron           string    `json:"cron"`
+	Script         string    `json:"script"`
+	TimeoutSeconds int32     `json:"timeout_seconds"`
+	CreatedAt      time.Time `json:"created_at" format:"date-time"`
+	UpdatedAt      time.Time `json:"updated_at" format:"date-time"`
+}
+
+// PutWorkspaceAgentScheduledTaskRequest creates or updates a scheduled task.
+type PutWorkspaceAgentScheduledTaskRequest struct {
+	Name string `json:"name" validate:"required"`
+	// Cron is a schedule with seconds like the cron of coder_script, e.g.
+	// "0 0 2 * * *", optionally prefixed with "CRON_TZ=<zone>".
+	Cron   string `json:"cron" validate:"required"`
+	Script string `json:"script" validate:"required"`
+	// TimeoutSeconds stops the task after the duration. Zero disables the
+	// timeout.
+	TimeoutSeconds int32 `json:"timeout_seconds"`
+}
+
+// ScheduledTasks lists the tasks the workspace owner scheduled.
+func (c *WorkspaceAgentConn) ScheduledTasks(ctx context.Context) ([]WorkspaceAgentScheduledTask, error) {
+	ctx, span := tracing.StartSpan(ctx)
+	defer span.End()
+	res, err := c.apiRequest(ctx, http.MethodGet, "/api/v0/scheduled-tasks", nil)
+	if err != nil {
+		return nil, xerrors.Errorf("do request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, ReadBodyAsError(res)
+	}
+
+	var resp []WorkspaceAgentScheduledTask
+	return resp, json.NewDecoder(res.Body).Decode(&resp)
+}
+
+// CreateScheduledTask schedules a new task.
+func (c *WorkspaceAgentConn) CreateScheduledTask(ctx context.Context, req PutWorkspaceAgentScheduledTaskRequest) (WorkspaceAgentScheduledTask, error) {
+	return c.putScheduledTask(ctx, http.MethodPost, "/api/v0/scheduled-tasks", req, http.StatusCreated)
+}
+
+// UpdateScheduledTask replaces the schedule and script of a task.
+func (c *WorkspaceAgentConn) UpdateScheduledTask(ctx context.Context, id uuid.UUID, req PutWorkspaceAgentScheduledTaskRequest) (WorkspaceAgentScheduledTask, error) {
+	return c.putScheduledTask(ctx, http.MethodPut, "/api/v0/scheduled-tasks/"+id.String(), req, http.StatusOK)
+}
+
+func (c *WorkspaceAgentConn) putScheduledTask(ctx context.Context, method, path string, req PutWorkspaceAgentScheduledTaskRequest, status int) (WorkspaceAgentScheduledTask, error) {
+	ctx, span := tracing.StartSpan(ctx)
+	defer span.End()
+	body, err := json.Marshal(req)
+	if err != nil {
+		return WorkspaceAgentScheduledTask{}, xerrors.Errorf("encode request: %w", err)
+	}
+	res, err := c.apiRequest(ctx, method, path, bytes.NewReader(body))
+	if err != nil {
+		return WorkspaceAgentScheduledTask{}, xerrors.Errorf("do request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != status {
+		return WorkspaceAgentScheduledTask{}, ReadBodyAsError(res)
+	}
+
+	var resp WorkspaceAgentScheduledTask
+	return resp, json.NewDecoder(res.Body).Decode(&resp)
+}
+
+// DeleteScheduledTask unschedules a task.
+func (c *WorkspaceAgentConn) DeleteScheduledTask(ctx context.Context, id uuid.UUID) error {
+	ctx, span := tracing.StartSpan(ctx)
+	defer span.End()
+	res, err := c.apiRequest(ctx, http.MethodDelete, "/api/v0/scheduled-tasks/"+id.String(), nil)
+	if err != nil {
+		return xerrors.Errorf("do request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return ReadBodyAsError(res)
+	}
+	return nil
+}
+
 // apiRequest makes a request to the workspace agent's HTTP API server.
 func (c *WorkspaceAgentConn) apiRequest(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
 	ctx, span := tracing.StartSpan(ctx)
@@ -129,6 +129,37 @@ type WorkspaceAgentMetadataDescription struct {
 	Script      string `json:"script"`
 	Interval    int64  `json:"interval"`
 	Timeout     int64  `json:"timeout"`
+	// Collector collects the metadata with a built-in collector of the
+	// agent instead of running the script.
+	Collector WorkspaceAgentMetadataCollector `json:"collector,omitempty"`
+}
+
+// WorkspaceAgentMetadataCollector is a built-in collector of agent metadata.
+// Collectors are container-aware: in a container, they report the usage and
+// limits of the container's cgroup rather than the totals of the host.
+type WorkspaceAgentMetadataCollector string
+
+const (
+	// WorkspaceAgentMetadataCollectorCPU reports the used and available
+	// cores.
+	WorkspaceAgentMetadataCollectorCPU WorkspaceAgentMetadataCollector = "cpu"
+	// WorkspaceAgentMetadataCollectorMemory reports the used and available
+	// memory.
+	WorkspaceAgentMetadataCollectorMemory WorkspaceAgentMetadataCollector = "memory"
+	// WorkspaceAgentMetadataCollectorDisk reports the used and available
+	// space of the disk of the home directory.
+	WorkspaceAgentMetadataCollectorDisk WorkspaceAgentMetadataCollector = "disk"
+)
+
+// Valid returns whether the collector is known, an empty collector is
+// valid.
+func (c WorkspaceAgentMetadataCollector) Valid() bool {
+	switch c {
+	case "", WorkspaceAgentMetadataCollectorCPU, WorkspaceAgentMetadataCollectorMemory, WorkspaceAgentMetadataCollectorDisk:
+		return true
+	default:
+		return false
+	}
 }
 
 type WorkspaceAgentMetadata struct {
@@ -171,14 +202,17 @@ type WorkspaceAgent struct {
 	APIVersion           string                  `json:"api_version"`
 	Apps                 []WorkspaceApp          `json:"apps"`
 	// DERPLatency is mapped by region name (e.g. "New York City", "Seattle").
-	DERPLatency              map[string]DERPRegion     `json:"latency,omitempty"`
-	ConnectionTimeoutSeconds int32                     `json:"connection_timeout_seconds"`
-	TroubleshootingURL       string                    `json:"troubleshooting_url"`
-	Subsystems               []AgentSubsystem          `json:"subsystems"`
-	Health                   WorkspaceAgentHealth      `json:"health"` // Health reports the health of the agent.
-	DisplayApps              []DisplayApp              `json:"display_apps"`
-	LogSources               []WorkspaceAgentLogSource `json:"log_sources"`
-	Scripts                  []WorkspaceAgentScript    `json:"scripts"`
+	DERPLatency              map[string]DERPRegion `json:"latency,omitempty"`
+	ConnectionTimeoutSeconds int32                 `json:"connection_timeout_seconds"`
+	TroubleshootingURL       string                `json:"troubleshooting_url"`
+	// TroubleshootingURLs are the troubleshooting URLs by class of failure,
+	// they default to TroubleshootingURL.
+	TroubleshootingURLs WorkspaceAgentTroubleshootingURLs `json:"troubleshooting_urls"`
+	Subsystems          []AgentSubsystem                  `json:"subsystems"`
+	Health              WorkspaceAgentHealth              `json:"health"` // Health reports the health of the agent.
+	DisplayApps         []DisplayApp                      `json:"display_apps"`
+	LogSources          []WorkspaceAgentLogSource         `json:"log_sources"`
+	Scripts             []WorkspaceAgentScript            `json:"scripts"`
 
 	// StartupScriptBehavior is a legacy field that is deprecated in favor
 	// of the `coder_script` resource. It's only referenced by old clients.
@@ -186,6 +220,18 @@ type WorkspaceAgent struct {
 	StartupScriptBehavior WorkspaceAgentStartupScriptBehavior `json:"startup_script_behavior"`
 }
 
+// WorkspaceAgentTroubleshootingURLs are the troubleshooting URLs of an agent
+// by class of failure, so users are sent to the runbook of the failure.
+type WorkspaceAgentTroubleshootingURLs struct {
+	// ConnectionTimeout is for agents that don't connect within their
+	// connection timeout.
+	ConnectionTimeout string `json:"connection_timeout"`
+	// StartError is for agents with a failed startup script.
+	StartError string `json:"start_error"`
+	// TokenInvalid is for agents that fail to authenticate with their token.
+	TokenInvalid string `json:"token_invalid"`
+}
+
 type WorkspaceAgentLogSource struct {
 	WorkspaceAgentID uuid.UUID `json:"workspace_agent_id" format:"uuid"`
 	ID               uuid.UUID `json:"id" format:"uuid"`
@@ -194,6 +240,16 @@ type WorkspaceAgentLogSource struct {
 	Icon             string    `json:"icon"`
 }
 
+// WorkspaceAgentScriptArtifact is a tar archive of the files a script of the
+// agent wrote to its artifacts directory.
+type WorkspaceAgentScriptArtifact struct {
+	ID          uuid.UUID `json:"id" format:"uuid"`
+	LogSourceID uuid.UUID `json:"log_source_id" format:"uuid"`
+	// Size is the size of the archive in bytes.
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at" format:"date-time"`
+}
+
 type WorkspaceAgentScript struct {
 	LogSourceID      uuid.UUID     `json:"log_source_id" format:"uuid"`
 	LogPath          string        `json:"log_path"`
@@ -203,6 +259,27 @@ type WorkspaceAgentScript struct {
 	RunOnStop        bool          `json:"run_on_stop"`
 	StartBlocksLogin bool          `json:"start_blocks_login"`
 	Timeout          time.Duration `json:"timeout"`
+	// RunOnBuildSuccess runs the script once the workspace build that
+	// created the agent succeeds, e.g. to prime caches.
+	RunOnBuildSuccess bool `json:"run_on_build_success,omitempty"`
+	// RunOnBuildFailure runs the script once the workspace build that
+	// created the agent fails.
+	RunOnBuildFailure bool `json:"run_on_build_failure,omitempty"`
+	// RunOnPostStart runs the script once the agent is ready, so
+	// non-critical scripts don't delay the startup of the workspace.
+	RunOnPostStart bool `json:"run_on_post_start,omitempty"`
+	// Login runs the script with the environment of a login shell of
+	// the user, so it sees the same PATH as interactive sessions.
+	Login bool `json:"login,omitempty"`
+	// DiskPressurePath makes the script a cleanup script, which the agent
+	// runs once the disk usage of the path crosses DiskPressureThreshold.
+	DiskPressurePath string `json:"disk_pressure_path,omitempty"`
+	// DiskPressureThreshold is the disk usage in percent that runs the
+	// script.
+	DiskPressureThreshold int32 `json:"disk_pressure_threshold,omitempty"`
+	// DisplayName is the display name of the log source of the script, which
+	// its logs are annotated with.
+	DisplayName string `json:"display_name,omitempty"`
 }
 
 type WorkspaceAgentHealth struct {
@@ -779,6 +856,35 @@ func (c *Client) WorkspaceAgentListeningPorts(ctx context.Context, agentID uuid.
 	return listeningPorts, json.NewDecoder(res.Body).Decode(&listeningPorts)
 }
 
+// WorkspaceAgentScriptArtifacts returns the artifacts the scripts of the
+// agent uploaded, oldest first. Artifacts are deleted after a week.
+func (c *Client) WorkspaceAgentScriptArtifacts(ctx context.Context, agentID uuid.UUID) ([]WorkspaceAgentScriptArtifact, error) {
+	res, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("/api/v2/workspaceagents/%s/script-artifacts", agentID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, ReadBodyAsError(res)
+	}
+	var artifacts []WorkspaceAgentScriptArtifact
+	return artifacts, json.NewDecoder(res.Body).Decode(&artifacts)
+}
+
+// WorkspaceAgentScriptArtifactArchive downloads the tar archive of the
+// artifact.
+func (c *Client) WorkspaceAgentScriptArtifactArchive(ctx context.Context, agentID, artifactID uuid.UUID) ([]byte, error) {
+	res, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("/api/v2/workspaceagents/%s/script-artifacts/%s", agentID, artifactID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, ReadBodyAsError(res)
+	}
+	return io.ReadAll(res.Body)
+}
+
 //nolint:revive // Follow is a control flag on the server as well.
 func (c *Client) WorkspaceAgentLogsAfter(ctx context.Context, agentID uuid.UUID, after int64, follow bool) (<-chan []WorkspaceAgentLog, io.Closer, error) {
 	var queryParams []string
@@ -870,14 +976,163 @@ func (c *Client) WorkspaceAgentLogsAfter(ctx context.Context, agentID uuid.UUID,
 	}), nil
 }
 
+// DefaultWorkspaceAgentLogsPageSize is the number of logs fetched per page by
+// WorkspaceAgentLogsPages if the request doesn't set a limit.
+const DefaultWorkspaceAgentLogsPageSize = 1000
+
+// WorkspaceAgentLogsRequest filters and paginates the logs of a workspace
+// agent.
+type WorkspaceAgentLogsRequest struct {
+	// After is the cursor of the page, only logs with a greater ID are
+	// returned. The ID of the last log of a page is the cursor of the next.
+	After int64 `json:"after,omitempty"`
+	// Limit is the maximum number of logs returned, all if 0.
+	Limit int `json:"limit,omitempty"`
+	// Levels only returns logs of the levels, all if empty.
+	Levels []LogLevel `json:"level,omitempty"`
+	// LogSourceIDs only returns logs of the sources, all if empty.
+	LogSourceIDs []uuid.UUID `json:"log_source_ids,omitempty" format:"uuid"`
+}
+
+// asRequestOption returns a function that can be used in (*Client).Request.
+// It modifies the request query parameters.
+func (r WorkspaceAgentLogsRequest) asRequestOption() RequestOption {
+	return func(req *http.Request) {
+		q := req.URL.Query()
+		if r.After > 0 {
+			q.Set("after", strconv.FormatInt(r.After, 10))
+		}
+		if r.Limit > 0 {
+			q.Set("limit", strconv.Itoa(r.Limit))
+		}
+		if len(r.Levels) > 0 {
+			levels := make([]string, 0, len(r.Levels))
+			for _, level := range r.Levels {
+				levels = append(levels, string(level))
+			}
+			q.Set("level", strings.Join(levels, ","))
+		}
+		if len(r.LogSourceIDs) > 0 {
+			ids := make([]string, 0, len(r.LogSourceIDs))
+			for _, id := range r.LogSourceIDs {
+				ids = append(ids, id.String())
+			}
+			q.Set("log_source_ids", strings.Join(ids, ","))
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+}
+
+// WorkspaceAgentLogs returns a page of the logs of a workspace agent.
+func (c *Client) WorkspaceAgentLogs(ctx context.Context, agentID uuid.UUID, req WorkspaceAgentLogsRequest) ([]WorkspaceAgentLog, error) {
+	res, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("/api/v2/workspaceagents/%s/logs", agentID), nil, req.asRequestOption())
+	if err != nil {
+		return nil, xerrors.Errorf("execute request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, ReadBodyAsError(res)
+	}
+	var logs []WorkspaceAgentLog
+	return logs, json.NewDecoder(res.Body).Decode(&logs)
+}
+
+// WorkspaceAgentLogsPages calls fn with every page of the logs of a workspace
+// agent, starting at the cursor of the request, until all logs were
+// returned, so histories of any size are fetched without holding them in
+// memory. Pages have DefaultWorkspaceAgentLogsPageSize logs if the request
+// doesn't set a limit. It returns the cursor of the last log passed to fn.
+func (c *Client) WorkspaceAgentLogsPages(ctx context.Context, agentID uuid.UUID, req WorkspaceAgentLogsRequest, fn func(logs []WorkspaceAgentLog) error) (int64, error) {
+	if req.Limit <= 0 {
+		req.Limit = DefaultWorkspaceAgentLogsPageSize
+	}
+	for {
+		logs, err := c.WorkspaceAgentLogs(ctx, agentID, req)
+		if err != nil {
+			return req.After, err
+		}
+		if len(logs) == 0 {
+			return req.After, nil
+		}
+		err = fn(logs)
+		if err != nil {
+			return req.After, err
+		}
+		req.After = logs[len(logs)-1].ID
+		if len(logs) < req.Limit {
+			return req.After, nil
+		}
+	}
+}
+
 type WorkspaceAgentLog struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"created_at" format:"date-time"`
 	Output    string    `json:"output"`
 	Level     LogLevel  `json:"level"`
 	SourceID  uuid.UUID `json:"source_id" format:"uuid"`
+	// Fields are structured key/value fields of the log.
+	Fields map[string]string `json:"fields,omitempty"`
+	// Stream is the output stream the log was written to, if it's known.
+	Stream LogStream `json:"stream,omitempty"`
 }
 
+// LogStream is the output stream of a process.
+type LogStream string
+
+const (
+	LogStreamStdout LogStream = "stdout"
+	LogStreamStderr LogStream = "stderr"
+)
+
+// WorkspaceAgentLogEvent is the event of a progress marker emitted by a
+// script, stored in the WorkspaceAgentLogFieldEvent field of its log.
+type WorkspaceAgentLogEvent string
+
+const (
+	// WorkspaceAgentLogEventGroupStart starts a collapsible section of the
+	// logs, titled by the output of the log.
+	WorkspaceAgentLogEventGroupStart WorkspaceAgentLogEvent = "group_start"
+	// WorkspaceAgentLogEventGroupEnd ends the section that was started last.
+	WorkspaceAgentLogEventGroupEnd WorkspaceAgentLogEvent = "group_end"
+	// WorkspaceAgentLogEventProgress reports the progress of the script in
+	// percent, in the WorkspaceAgentLogFieldProgress field.
+	WorkspaceAgentLogEventProgress WorkspaceAgentLogEvent = "progress"
+)
+
+// Fields of the logs of scripts emitting progress markers. The logs written
+// within a section carry the title of the section in
+// WorkspaceAgentLogFieldGroup.
+const (
+	WorkspaceAgentLogFieldEvent    = "event"
+	WorkspaceAgentLogFieldGroup    = "group"
+	WorkspaceAgentLogFieldProgress = "progress"
+)
+
+// Fields every log of a script is annotated with, so the output of scripts
+// running at the same time can be told apart. WorkspaceAgentLogFieldScript
+// is the display name of the script.
+const (
+	WorkspaceAgentLogFieldScript = "script"
+	WorkspaceAgentLogFieldStage  = "stage"
+)
+
+// WorkspaceAgentScriptStage is the stage a script ran in, stored in the
+// WorkspaceAgentLogFieldStage field of its logs.
+type WorkspaceAgentScriptStage string
+
+const (
+	WorkspaceAgentScriptStageStart        WorkspaceAgentScriptStage = "start"
+	WorkspaceAgentScriptStageStop         WorkspaceAgentScriptStage = "stop"
+	WorkspaceAgentScriptStageCron         WorkspaceAgentScriptStage = "cron"
+	WorkspaceAgentScriptStagePostStart    WorkspaceAgentScriptStage = "post_start"
+	WorkspaceAgentScriptStageBuildSuccess WorkspaceAgentScriptStage = "build_success"
+	WorkspaceAgentScriptStageBuildFailure WorkspaceAgentScriptStage = "build_failure"
+	// WorkspaceAgentScriptStageDiskPressure runs cleanup scripts once the
+	// disk usage crosses their threshold.
+	WorkspaceAgentScriptStageDiskPressure WorkspaceAgentScriptStage = "disk_pressure"
+)
+
 type AgentSubsystem string
 
 const (
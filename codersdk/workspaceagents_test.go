@@ -1,12 +1,19 @@
 package codersdk_test
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 	"tailscale.com/tailcfg"
 
+	"github.com/coder/coder/v2/codersdk"
 	"github.com/coder/coder/v2/codersdk/agentsdk"
 )
 
@@ -37,3 +44,54 @@ func TestWorkspaceRewriteDERPMap(t *testing.T) {
 	require.Equal(t, "coconuts.org", node.HostName)
 	require.Equal(t, 44558, node.DERPPort)
 }
+
+func TestWorkspaceAgentLogsPages(t *testing.T) {
+	t.Parallel()
+
+	agentID := uuid.New()
+	sourceID := uuid.New()
+	var queries []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v2/workspaceagents/"+agentID.String()+"/logs", r.URL.Path)
+		query := r.URL.Query()
+		queries = append(queries, query)
+		after, _ := strconv.ParseInt(query.Get("after"), 10, 64)
+		limit, err := strconv.Atoi(query.Get("limit"))
+		require.NoError(t, err)
+		logs := []codersdk.WorkspaceAgentLog{}
+		for id := after + 1; id <= 5 && len(logs) < limit; id++ {
+			logs = append(logs, codersdk.WorkspaceAgentLog{ID: id})
+		}
+		_ = json.NewEncoder(w).Encode(logs)
+	}))
+	t.Cleanup(srv.Close)
+	serverURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	client := codersdk.New(serverURL)
+
+	var pages [][]int64
+	cursor, err := client.WorkspaceAgentLogsPages(context.Background(), agentID, codersdk.WorkspaceAgentLogsRequest{
+		Limit:        2,
+		Levels:       []codersdk.LogLevel{codersdk.LogLevelWarn, codersdk.LogLevelError},
+		LogSourceIDs: []uuid.UUID{sourceID},
+	}, func(logs []codersdk.WorkspaceAgentLog) error {
+		var ids []int64
+		for _, log := range logs {
+			ids = append(ids, log.ID)
+		}
+		pages = append(pages, ids)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(5), cursor)
+	require.Equal(t, [][]int64{{1, 2}, {3, 4}, {5}}, pages)
+
+	require.Len(t, queries, 3)
+	require.False(t, queries[0].Has("after"))
+	require.Equal(t, "2", queries[1].Get("after"))
+	require.Equal(t, "4", queries[2].Get("after"))
+	for _, query := range queries {
+		require.Equal(t, "warn,error", query.Get("level"))
+		require.Equal(t, sourceID.String(), query.Get("log_source_ids"))
+	}
+}
@@ -1,6 +1,8 @@
 package codersdk
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -61,6 +63,19 @@ type WorkspaceApp struct {
 	// Healthcheck specifies the configuration for checking app health.
 	Healthcheck Healthcheck        `json:"healthcheck"`
 	Health      WorkspaceAppHealth `json:"health"`
+	// HealthReport is the result of the latest healthcheck reported by the
+	// agent, if any.
+	HealthReport *WorkspaceAppHealthReport `json:"health_report,omitempty"`
+}
+
+// WorkspaceAppHealthReport is the result of a healthcheck of an app, so it's
+// known why an app is unhealthy.
+type WorkspaceAppHealthReport struct {
+	// LatencyMilliseconds is how long the healthcheck took.
+	LatencyMilliseconds float64 `json:"latency_ms"`
+	// Error is why the healthcheck failed, empty if it succeeded.
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at" format:"date-time"`
 }
 
 type Healthcheck struct {
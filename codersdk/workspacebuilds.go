@@ -88,21 +88,54 @@ type WorkspaceResource struct {
 	Agents     []WorkspaceAgent            `json:"agents,omitempty"`
 	Metadata   []WorkspaceResourceMetadata `json:"metadata,omitempty"`
 	DailyCost  int32                       `json:"daily_cost"`
+	// Action is the change the build made to the resource, empty if
+	// unknown. Deleted resources only have a type and a name.
+	Action WorkspaceResourceAction `json:"action,omitempty"`
 }
 
+// WorkspaceResourceAction is the change a build made to a resource.
+type WorkspaceResourceAction string
+
+const (
+	WorkspaceResourceActionNoOp    WorkspaceResourceAction = "no_op"
+	WorkspaceResourceActionCreate  WorkspaceResourceAction = "create"
+	WorkspaceResourceActionUpdate  WorkspaceResourceAction = "update"
+	WorkspaceResourceActionReplace WorkspaceResourceAction = "replace"
+	WorkspaceResourceActionDelete  WorkspaceResourceAction = "delete"
+)
+
 // WorkspaceResourceMetadata annotates the workspace resource with custom key-value pairs.
 type WorkspaceResourceMetadata struct {
 	Key       string `json:"key"`
 	Value     string `json:"value"`
 	Sensitive bool   `json:"sensitive"`
+	// Order is the position of the item defined by the template. Items are
+	// sorted by it.
+	Order int32 `json:"order,omitempty"`
+	// Group is the name of the group the item is shown in, if any.
+	Group string `json:"group,omitempty"`
 }
 
 // WorkspaceBuildParameter represents a parameter specific for a workspace build.
 type WorkspaceBuildParameter struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
+	// Source is where the value came from. Clients that copy the value of
+	// the previous build should set it to "previous_build", any other value
+	// they send is considered user input.
+	Source WorkspaceBuildParameterSource `json:"source,omitempty"`
 }
 
+// WorkspaceBuildParameterSource is where the value of a parameter in a build
+// came from.
+type WorkspaceBuildParameterSource string
+
+const (
+	WorkspaceBuildParameterSourceTemplateDefault WorkspaceBuildParameterSource = "template_default"
+	WorkspaceBuildParameterSourcePreviousBuild   WorkspaceBuildParameterSource = "previous_build"
+	WorkspaceBuildParameterSourceUserInput       WorkspaceBuildParameterSource = "user_input"
+)
+
 // WorkspaceBuild returns a single workspace build for a workspace.
 // If history is "", the latest version is returned.
 func (c *Client) WorkspaceBuild(ctx context.Context, id uuid.UUID) (WorkspaceBuild, error) {
@@ -149,6 +182,130 @@ func (c *Client) WorkspaceBuildState(ctx context.Context, build uuid.UUID) ([]by
 	return io.ReadAll(res.Body)
 }
 
+// WorkspaceBuildWorkDirectory is the listing of the work directory of a
+// failed build on the provisioner host.
+type WorkspaceBuildWorkDirectory struct {
+	// Path is the work directory on the provisioner host.
+	Path    string                             `json:"path"`
+	Entries []WorkspaceBuildWorkDirectoryEntry `json:"entries"`
+	// Truncated is true if the work directory had more entries than were
+	// listed.
+	Truncated bool `json:"truncated"`
+	// Kept is true if the work directory was kept on the provisioner host.
+	Kept bool `json:"kept"`
+}
+
+// WorkspaceBuildWorkDirectoryEntry is a file or directory in the work
+// directory of a failed build.
+type WorkspaceBuildWorkDirectoryEntry struct {
+	// Path is relative to the work directory.
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Mode string `json:"mode"`
+}
+
+// WorkspaceBuildWorkDirectory returns the listing of the work directory of
+// a failed build.
+func (c *Client) WorkspaceBuildWorkDirectory(ctx context.Context, build uuid.UUID) (WorkspaceBuildWorkDirectory, error) {
+	res, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("/api/v2/workspacebuilds/%s/work-directory", build), nil)
+	if err != nil {
+		return WorkspaceBuildWorkDirectory{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return WorkspaceBuildWorkDirectory{}, ReadBodyAsError(res)
+	}
+	var workDirectory WorkspaceBuildWorkDirectory
+	return workDirectory, json.NewDecoder(res.Body).Decode(&workDirectory)
+}
+
+// WorkspaceBuildDiagnosticBundle collects the diagnostics of a failed build,
+// so support escalations are self-contained. Parts that couldn't be collected
+// are missing, with the reason in Errors.
+type WorkspaceBuildDiagnosticBundle struct {
+	// PlanJSON is the plan of the build, with variable and sensitive values
+	// redacted.
+	PlanJSON json.RawMessage `json:"plan_json,omitempty"`
+	// Graph is the dependency graph of the template in DOT format.
+	Graph string `json:"graph"`
+	// Logs are the last provisioner logs of the build.
+	Logs             []WorkspaceBuildDiagnosticLog `json:"logs"`
+	TerraformVersion string                        `json:"terraform_version"`
+	// Environment summarizes the host and the terraform environment
+	// variables of the provisioner, with values that may be secrets redacted.
+	Environment map[string]string `json:"environment"`
+	Errors      []string          `json:"errors"`
+}
+
+// WorkspaceBuildDiagnosticLog is a provisioner log of a diagnostic bundle.
+type WorkspaceBuildDiagnosticLog struct {
+	Level  LogLevel `json:"level"`
+	Output string   `json:"output"`
+}
+
+// WorkspaceBuildDiagnosticBundle returns the diagnostic bundle of a failed
+// build.
+func (c *Client) WorkspaceBuildDiagnosticBundle(ctx context.Context, build uuid.UUID) (WorkspaceBuildDiagnosticBundle, error) {
+	res, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("/api/v2/workspacebuilds/%s/diagnostic-bundle", build), nil)
+	if err != nil {
+		return WorkspaceBuildDiagnosticBundle{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return WorkspaceBuildDiagnosticBundle{}, ReadBodyAsError(res)
+	}
+	var bundle WorkspaceBuildDiagnosticBundle
+	return bundle, json.NewDecoder(res.Body).Decode(&bundle)
+}
+
+// WorkspaceBuildCapacityFallback records the capacity options a build of a
+// template that sets the coder_capacity_fallback variable tried.
+type WorkspaceBuildCapacityFallback struct {
+	// Selected is the option the build succeeded with. Later builds of the
+	// workspace start with it.
+	Selected string                          `json:"selected"`
+	Attempts []WorkspaceBuildCapacityAttempt `json:"attempts"`
+}
+
+// WorkspaceBuildCapacityAttempt is a capacity option that ran out of
+// capacity before the selected one.
+type WorkspaceBuildCapacityAttempt struct {
+	Option string `json:"option"`
+	// Error is the capacity error the apply with the option failed with.
+	Error string `json:"error"`
+}
+
+// WorkspaceBuildCapacityFallback returns the capacity options a build tried.
+// It returns a 404 if the template of the build doesn't fall back to
+// alternate capacity options.
+func (c *Client) WorkspaceBuildCapacityFallback(ctx context.Context, build uuid.UUID) (WorkspaceBuildCapacityFallback, error) {
+	res, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("/api/v2/workspacebuilds/%s/capacity-fallback", build), nil)
+	if err != nil {
+		return WorkspaceBuildCapacityFallback{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return WorkspaceBuildCapacityFallback{}, ReadBodyAsError(res)
+	}
+	var fallback WorkspaceBuildCapacityFallback
+	return fallback, json.NewDecoder(res.Body).Decode(&fallback)
+}
+
+// WorkspaceBuildMetadata returns the outputs of the template for a build.
+// Values of sensitive outputs are never stored and are returned empty.
+func (c *Client) WorkspaceBuildMetadata(ctx context.Context, build uuid.UUID) ([]WorkspaceResourceMetadata, error) {
+	res, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("/api/v2/workspacebuilds/%s/metadata", build), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, ReadBodyAsError(res)
+	}
+	var metadata []WorkspaceResourceMetadata
+	return metadata, json.NewDecoder(res.Body).Decode(&metadata)
+}
+
 func (c *Client) WorkspaceBuildByUsernameAndWorkspaceNameAndBuildNumber(ctx context.Context, username string, workspaceName string, buildNumber string) (WorkspaceBuild, error) {
 	res, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("/api/v2/users/%s/workspace/%s/builds/%s", username, workspaceName, buildNumber), nil)
 	if err != nil {
@@ -473,6 +473,23 @@ func (c *Client) ResolveAutostart(ctx context.Context, workspaceID string) (Reso
 	return response, json.NewDecoder(res.Body).Decode(&response)
 }
 
+// RefreshWorkspace refreshes the state of the resources of the latest build
+// of a workspace without changing them, and updates their metadata. The
+// returned job completes once the metadata is updated. If a refresh is
+// already queued or running, its job is returned.
+func (c *Client) RefreshWorkspace(ctx context.Context, workspaceID uuid.UUID) (ProvisionerJob, error) {
+	res, err := c.Request(ctx, http.MethodPost, fmt.Sprintf("/api/v2/workspaces/%s/refresh", workspaceID), nil)
+	if err != nil {
+		return ProvisionerJob{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return ProvisionerJob{}, ReadBodyAsError(res)
+	}
+	var job ProvisionerJob
+	return job, json.NewDecoder(res.Body).Decode(&job)
+}
+
 func (c *Client) FavoriteWorkspace(ctx context.Context, workspaceID uuid.UUID) error {
 	res, err := c.Request(ctx, http.MethodPut, fmt.Sprintf("/api/v2/workspaces/%s/favorite", workspaceID), nil)
 	if err != nil {
@@ -88,6 +88,10 @@ var auditableResourcesTypes = map[any]map[string]Action{
 		"time_til_dormant_autodelete":       ActionTrack,
 		"require_active_version":            ActionTrack,
 		"deprecated":                        ActionTrack,
+		"max_app_sharing_level":             ActionTrack,
+		"code_server_enabled":               ActionTrack,
+		"docs_url":                          ActionTrack,
+		"replace_on_failure":                ActionTrack,
 	},
 	&database.TemplateVersion{}: {
 		"id":                      ActionTrack,
@@ -67,6 +67,15 @@ func (r *RootCmd) provisionerDaemonStart() *clibase.Cmd {
 		pollJitter     time.Duration
 		preSharedKey   string
 		verbose        bool
+
+		workDirectory              string
+		workDirectoryKeepOnFailure bool
+		workDirectoryTTL           time.Duration
+		workDirectoryMaxDisk       int64
+
+		// terraformConfig holds the options of the Terraform provisioner
+		// shared with the built-in provisioner daemons.
+		terraformConfig codersdk.ProvisionerConfig
 	)
 	client := new(codersdk.Client)
 	cmd := &clibase.Cmd{
@@ -134,9 +143,18 @@ func (r *RootCmd) provisionerDaemonStart() *clibase.Cmd {
 				return xerrors.Errorf("mkdir %q: %w", cacheDir, err)
 			}
 
-			tempDir, err := os.MkdirTemp("", "provisionerd")
-			if err != nil {
-				return err
+			// Kept work directories only outlive the daemon in a work
+			// directory that isn't temporary.
+			if workDirectory == "" {
+				workDirectory, err = os.MkdirTemp("", "provisionerd")
+				if err != nil {
+					return err
+				}
+			} else {
+				err = os.MkdirAll(workDirectory, 0o700)
+				if err != nil {
+					return xerrors.Errorf("mkdir %q: %w", workDirectory, err)
+				}
 			}
 
 			terraformClient, terraformServer := drpc.MemTransportPipe()
@@ -146,18 +164,27 @@ func (r *RootCmd) provisionerDaemonStart() *clibase.Cmd {
 				_ = terraformServer.Close()
 			}()
 
+			options, err := agpl.TerraformServeOptions(&terraformConfig)
+			if err != nil {
+				return err
+			}
+			options.ServeOptions = &provisionersdk.ServeOptions{
+				Listener:      terraformServer,
+				Logger:        logger.Named("terraform"),
+				WorkDirectory: workDirectory,
+				WorkDirectoryRetention: provisionersdk.WorkDirectoryRetention{
+					KeepOnFailure: workDirectoryKeepOnFailure,
+					TTL:           workDirectoryTTL,
+					MaxDiskBytes:  workDirectoryMaxDisk,
+				},
+			}
+			options.CachePath = cacheDir
+
 			errCh := make(chan error, 1)
 			go func() {
 				defer cancel()
 
-				err := terraform.Serve(ctx, &terraform.ServeOptions{
-					ServeOptions: &provisionersdk.ServeOptions{
-						Listener:      terraformServer,
-						Logger:        logger.Named("terraform"),
-						WorkDirectory: tempDir,
-					},
-					CachePath: cacheDir,
-				})
+				err := terraform.Serve(ctx, options)
 				if err != nil && !xerrors.Is(err, context.Canceled) {
 					select {
 					case errCh <- err:
@@ -230,6 +257,123 @@ func (r *RootCmd) provisionerDaemonStart() *clibase.Cmd {
 			Description:   "Tags to filter provisioner jobs by.",
 			Value:         clibase.StringArrayOf(&rawTags),
 		},
+		{
+			Flag:        "work-directory",
+			Env:         "CODER_PROVISIONER_DAEMON_WORK_DIRECTORY",
+			Description: "Directory the work directories of builds are created in. Defaults to a temporary directory.",
+			Value:       clibase.StringOf(&workDirectory),
+		},
+		{
+			Flag:        "work-directory-keep-on-failure",
+			Env:         "CODER_PROVISIONER_DAEMON_WORK_DIRECTORY_KEEP_ON_FAILURE",
+			Description: "Keep the work directories of failed builds for debugging, until they expire.",
+			Value:       clibase.BoolOf(&workDirectoryKeepOnFailure),
+			Default:     "false",
+		},
+		{
+			Flag:        "work-directory-ttl",
+			Env:         "CODER_PROVISIONER_DAEMON_WORK_DIRECTORY_TTL",
+			Description: "How long work directories are kept after they were last modified.",
+			Value:       clibase.DurationOf(&workDirectoryTTL),
+			Default:     (7 * 24 * time.Hour).String(),
+		},
+		{
+			Flag:        "work-directory-max-disk",
+			Env:         "CODER_PROVISIONER_DAEMON_WORK_DIRECTORY_MAX_DISK",
+			Description: "Maximum total size in bytes of the kept work directories. The oldest ones are removed first. Zero disables the limit.",
+			Value:       clibase.Int64Of(&workDirectoryMaxDisk),
+			Default:     "0",
+		},
+		{
+			Flag:        "data-source-timeout",
+			Env:         "CODER_PROVISIONER_DAEMON_DATA_SOURCE_TIMEOUT",
+			Description: "Kill Terraform commands once a data source is read for longer than the duration, and fail the build with an error naming the data source. Reads are timed independently, so a single data source querying an unreachable API doesn't stall the plan with no explanation. Disabled if 0.",
+			Value:       &terraformConfig.DataSourceTimeout,
+			Default:     "0s",
+		},
+		{
+			Flag:        "hang-timeout",
+			Env:         "CODER_PROVISIONER_DAEMON_HANG_TIMEOUT",
+			Description: "Kill Terraform commands that don't write any output for the duration, and fail the build with an error pointing at the hang. The stack traces of Terraform and its providers are written to the build logs where supported. Keep it below 5 minutes, when builds are marked as hung, and above the time providers take to download. Disabled if 0.",
+			Value:       &terraformConfig.HangTimeout,
+			Default:     "0s",
+		},
+		{
+			Flag:        "sandbox",
+			Env:         "CODER_PROVISIONER_DAEMON_SANDBOX",
+			Description: "Execute Terraform in a sandbox to contain malicious templates or providers. The filesystem is read-only except for the working directory of the job. Supported values are \"nsjail\" and \"gvisor\".",
+			Value:       &terraformConfig.Sandbox,
+		},
+		{
+			Flag:        "sandbox-seccomp-profile",
+			Env:         "CODER_PROVISIONER_DAEMON_SANDBOX_SECCOMP_PROFILE",
+			Description: "Path of a seccomp policy in the Kafel language applied to Terraform. Only supported by the nsjail sandbox.",
+			Value:       &terraformConfig.SandboxSeccompProfile,
+		},
+		{
+			Flag:        "sandbox-egress-allowlist",
+			Env:         "CODER_PROVISIONER_DAEMON_SANDBOX_EGRESS_ALLOWLIST",
+			Description: "Hosts Terraform and providers in the sandbox may connect to through a proxy, e.g. \"registry.terraform.io\" or \"*.amazonaws.com\". Networking is disabled if it's empty.",
+			Value:       &terraformConfig.SandboxEgressAllowlist,
+		},
+		{
+			Flag:        "provider-credentials",
+			Env:         "CODER_PROVISIONER_DAEMON_PROVIDER_CREDENTIALS",
+			Description: "Credentials of Terraform providers exchanged from the external auth or OIDC tokens of the workspace owner for every build, instead of static credentials, as YAML. Supported providers are \"github\", \"gitlab\", \"aws\", \"google\" and \"azurerm\".",
+			Value:       &terraformConfig.ProviderCredentials,
+		},
+		{
+			Flag:        "max-resources",
+			Env:         "CODER_PROVISIONER_DAEMON_MAX_RESOURCES",
+			Description: "Maximum number of resources a workspace may have after a build, excluding resources of the Coder provider. Builds exceeding it fail before anything is applied. Unlimited if 0.",
+			Value:       &terraformConfig.MaxResources,
+			Default:     "0",
+		},
+		{
+			Flag:        "max-destroys",
+			Env:         "CODER_PROVISIONER_DAEMON_MAX_DESTROYS",
+			Description: "Maximum number of resources a build may delete or replace, excluding resources of the Coder provider and deleting the workspace. Protects against template bugs that would delete dozens of resources. Unlimited if 0.",
+			Value:       &terraformConfig.MaxDestroys,
+			Default:     "0",
+		},
+		{
+			Flag:        "filesystem-mirrors",
+			Env:         "CODER_PROVISIONER_DAEMON_FILESYSTEM_MIRRORS",
+			Description: "Directories of Terraform providers, as created by \"terraform providers mirror\", to install providers from. Setting mirrors enables the air-gapped mode: registries and Terraform releases aren't downloaded from, and builds using providers missing from the mirrors fail with an error naming them.",
+			Value:       &terraformConfig.FilesystemMirrors,
+		},
+		{
+			Flag:        "network-mirrors",
+			Env:         "CODER_PROVISIONER_DAEMON_NETWORK_MIRRORS",
+			Description: "HTTPS URLs of Terraform provider network mirrors to install providers from. Setting mirrors enables the air-gapped mode, see --filesystem-mirrors.",
+			Value:       &terraformConfig.NetworkMirrors,
+		},
+		{
+			Flag:        "max-apply-retries",
+			Env:         "CODER_PROVISIONER_DAEMON_MAX_APPLY_RETRIES",
+			Description: "Maximum number of times an apply that only failed with transient errors of providers is retried, such as rate limits, eventual consistency or server errors of cloud APIs. Retries back off exponentially, starting at 10 seconds. Disabled if 0.",
+			Value:       &terraformConfig.MaxApplyRetries,
+			Default:     "0",
+		},
+		{
+			Flag:        "secrets-resolvers",
+			Env:         "CODER_PROVISIONER_DAEMON_SECRETS_RESOLVERS",
+			Description: `Secret stores template variables can reference, of "vault" and "aws-secrets-manager". Variables set to "vault://<path>#<key>" or "awssm://<secret-id>#<key>" are resolved for every build and redacted from build logs. Vault is configured with the VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment variables, AWS Secrets Manager with the default AWS credentials.`,
+			Value:       &terraformConfig.SecretsResolvers,
+		},
+		{
+			Flag:        "verify-providers",
+			Env:         "CODER_PROVISIONER_DAEMON_VERIFY_PROVIDERS",
+			Description: "Verify the installed providers before Terraform executes them. Builds fail with an untrusted provider error unless every provider package matches the checksums of the dependency lock file, and either the release archive signed by the registry of the provider or the hashes of --trusted-provider-hashes.",
+			Value:       &terraformConfig.VerifyProviders,
+			Default:     "false",
+		},
+		{
+			Flag:        "trusted-provider-hashes",
+			Env:         "CODER_PROVISIONER_DAEMON_TRUSTED_PROVIDER_HASHES",
+			Description: `Provider packages to trust, as "<source>=<hash>" entries of a provider source address and a "h1:" hash of the dependency lock file, e.g. "registry.terraform.io/hashicorp/aws=h1:...". Packages of listed providers must match one of their hashes instead of the release archive signed by the registry, e.g. for providers installed from mirrors. Enables --verify-providers.`,
+			Value:       &terraformConfig.TrustedProviderHashes,
+		},
 		{
 			Flag:        "poll-interval",
 			Env:         "CODER_PROVISIONERD_POLL_INTERVAL",
@@ -240,6 +240,8 @@ func TarWithOptions(ctx context.Context, logger slog.Logger, responses *Response
 					Resources:             resp.GetApply().GetResources(),
 					Parameters:            resp.GetApply().GetParameters(),
 					ExternalAuthProviders: resp.GetApply().GetExternalAuthProviders(),
+					Network:               resp.GetApply().GetNetwork(),
+					Topology:              resp.GetApply().GetTopology(),
 				}},
 			})
 		}
@@ -0,0 +1,223 @@
+package terraform
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// instanceTypeAccelerators are the accelerators built into common GPU
+// instance types, by resource type and instance type. Instance types that
+// attach accelerators separately, e.g. through guest_accelerator, aren't
+// listed.
+var instanceTypeAccelerators = map[string]map[string]*proto.Resource_Accelerator{
+	"google_compute_instance": {
+		"a2-highgpu-1g":  {Vendor: "nvidia", Model: "nvidia-tesla-a100", Count: 1},
+		"a2-highgpu-2g":  {Vendor: "nvidia", Model: "nvidia-tesla-a100", Count: 2},
+		"a2-highgpu-4g":  {Vendor: "nvidia", Model: "nvidia-tesla-a100", Count: 4},
+		"a2-highgpu-8g":  {Vendor: "nvidia", Model: "nvidia-tesla-a100", Count: 8},
+		"a2-megagpu-16g": {Vendor: "nvidia", Model: "nvidia-tesla-a100", Count: 16},
+		"a2-ultragpu-1g": {Vendor: "nvidia", Model: "nvidia-a100-80gb", Count: 1},
+		"a2-ultragpu-2g": {Vendor: "nvidia", Model: "nvidia-a100-80gb", Count: 2},
+		"a2-ultragpu-4g": {Vendor: "nvidia", Model: "nvidia-a100-80gb", Count: 4},
+		"a2-ultragpu-8g": {Vendor: "nvidia", Model: "nvidia-a100-80gb", Count: 8},
+		"a3-highgpu-8g":  {Vendor: "nvidia", Model: "nvidia-h100-80gb", Count: 8},
+		"g2-standard-4":  {Vendor: "nvidia", Model: "nvidia-l4", Count: 1},
+		"g2-standard-8":  {Vendor: "nvidia", Model: "nvidia-l4", Count: 1},
+		"g2-standard-12": {Vendor: "nvidia", Model: "nvidia-l4", Count: 1},
+		"g2-standard-16": {Vendor: "nvidia", Model: "nvidia-l4", Count: 1},
+		"g2-standard-24": {Vendor: "nvidia", Model: "nvidia-l4", Count: 2},
+		"g2-standard-32": {Vendor: "nvidia", Model: "nvidia-l4", Count: 1},
+		"g2-standard-48": {Vendor: "nvidia", Model: "nvidia-l4", Count: 4},
+		"g2-standard-96": {Vendor: "nvidia", Model: "nvidia-l4", Count: 8},
+	},
+	"aws_instance": {
+		"p3.2xlarge":    {Vendor: "nvidia", Model: "V100", Count: 1},
+		"p3.8xlarge":    {Vendor: "nvidia", Model: "V100", Count: 4},
+		"p3.16xlarge":   {Vendor: "nvidia", Model: "V100", Count: 8},
+		"p3dn.24xlarge": {Vendor: "nvidia", Model: "V100", Count: 8},
+		"p4d.24xlarge":  {Vendor: "nvidia", Model: "A100", Count: 8},
+		"p4de.24xlarge": {Vendor: "nvidia", Model: "A100", Count: 8},
+		"p5.48xlarge":   {Vendor: "nvidia", Model: "H100", Count: 8},
+		"g4dn.xlarge":   {Vendor: "nvidia", Model: "T4", Count: 1},
+		"g4dn.2xlarge":  {Vendor: "nvidia", Model: "T4", Count: 1},
+		"g4dn.4xlarge":  {Vendor: "nvidia", Model: "T4", Count: 1},
+		"g4dn.8xlarge":  {Vendor: "nvidia", Model: "T4", Count: 1},
+		"g4dn.16xlarge": {Vendor: "nvidia", Model: "T4", Count: 1},
+		"g4dn.12xlarge": {Vendor: "nvidia", Model: "T4", Count: 4},
+		"g4dn.metal":    {Vendor: "nvidia", Model: "T4", Count: 8},
+		"g4ad.xlarge":   {Vendor: "amd", Model: "Radeon Pro V520", Count: 1},
+		"g4ad.2xlarge":  {Vendor: "amd", Model: "Radeon Pro V520", Count: 1},
+		"g4ad.4xlarge":  {Vendor: "amd", Model: "Radeon Pro V520", Count: 1},
+		"g4ad.8xlarge":  {Vendor: "amd", Model: "Radeon Pro V520", Count: 2},
+		"g4ad.16xlarge": {Vendor: "amd", Model: "Radeon Pro V520", Count: 4},
+		"g5.xlarge":     {Vendor: "nvidia", Model: "A10G", Count: 1},
+		"g5.2xlarge":    {Vendor: "nvidia", Model: "A10G", Count: 1},
+		"g5.4xlarge":    {Vendor: "nvidia", Model: "A10G", Count: 1},
+		"g5.8xlarge":    {Vendor: "nvidia", Model: "A10G", Count: 1},
+		"g5.16xlarge":   {Vendor: "nvidia", Model: "A10G", Count: 1},
+		"g5.12xlarge":   {Vendor: "nvidia", Model: "A10G", Count: 4},
+		"g5.24xlarge":   {Vendor: "nvidia", Model: "A10G", Count: 4},
+		"g5.48xlarge":   {Vendor: "nvidia", Model: "A10G", Count: 8},
+		"g6.xlarge":     {Vendor: "nvidia", Model: "L4", Count: 1},
+		"g6.2xlarge":    {Vendor: "nvidia", Model: "L4", Count: 1},
+		"g6.4xlarge":    {Vendor: "nvidia", Model: "L4", Count: 1},
+		"g6.8xlarge":    {Vendor: "nvidia", Model: "L4", Count: 1},
+		"g6.16xlarge":   {Vendor: "nvidia", Model: "L4", Count: 1},
+		"g6.12xlarge":   {Vendor: "nvidia", Model: "L4", Count: 4},
+		"g6.24xlarge":   {Vendor: "nvidia", Model: "L4", Count: 4},
+		"g6.48xlarge":   {Vendor: "nvidia", Model: "L4", Count: 8},
+	},
+	"azurerm_linux_virtual_machine": {
+		"Standard_NC6s_v3":         {Vendor: "nvidia", Model: "V100", Count: 1},
+		"Standard_NC12s_v3":        {Vendor: "nvidia", Model: "V100", Count: 2},
+		"Standard_NC24s_v3":        {Vendor: "nvidia", Model: "V100", Count: 4},
+		"Standard_NC4as_T4_v3":     {Vendor: "nvidia", Model: "T4", Count: 1},
+		"Standard_NC8as_T4_v3":     {Vendor: "nvidia", Model: "T4", Count: 1},
+		"Standard_NC16as_T4_v3":    {Vendor: "nvidia", Model: "T4", Count: 1},
+		"Standard_NC64as_T4_v3":    {Vendor: "nvidia", Model: "T4", Count: 4},
+		"Standard_NC24ads_A100_v4": {Vendor: "nvidia", Model: "A100", Count: 1},
+		"Standard_NC48ads_A100_v4": {Vendor: "nvidia", Model: "A100", Count: 2},
+		"Standard_NC96ads_A100_v4": {Vendor: "nvidia", Model: "A100", Count: 4},
+		"Standard_ND96asr_v4":      {Vendor: "nvidia", Model: "A100", Count: 8},
+	},
+}
+
+// instanceTypeAliases are resource types with the instance types of another.
+var instanceTypeAliases = map[string]string{
+	"aws_spot_instance_request":       "aws_instance",
+	"azurerm_windows_virtual_machine": "azurerm_linux_virtual_machine",
+}
+
+// resourceAccelerators returns the GPUs and other accelerators of a compute
+// resource. They're found in the instance type of common GPU instances, in
+// the guest_accelerator blocks of Google Cloud resources, and in the
+// resource limits of Kubernetes containers, e.g. "nvidia.com/gpu".
+func resourceAccelerators(resource *tfjson.StateResource) []*proto.Resource_Accelerator {
+	var accelerators []*proto.Resource_Accelerator
+	add := func(accelerator *proto.Resource_Accelerator) {
+		if accelerator.Count <= 0 {
+			return
+		}
+		for _, existing := range accelerators {
+			if existing.Vendor == accelerator.Vendor && existing.Model == accelerator.Model {
+				existing.Count += accelerator.Count
+				return
+			}
+		}
+		accelerators = append(accelerators, &proto.Resource_Accelerator{
+			Vendor: accelerator.Vendor,
+			Model:  accelerator.Model,
+			Count:  accelerator.Count,
+		})
+	}
+
+	resourceType := resource.Type
+	if alias, ok := instanceTypeAliases[resourceType]; ok {
+		resourceType = alias
+	}
+	if accelerator, ok := instanceTypeAccelerators[resourceType][applyInstanceType(resource)]; ok {
+		add(accelerator)
+	}
+
+	switch {
+	case strings.HasPrefix(resource.Type, "google_"):
+		for _, block := range attributeBlocks(resource.AttributeValues, "guest_accelerator") {
+			model, _ := block["type"].(string)
+			if model == "" {
+				continue
+			}
+			// The type may be the full URL of the accelerator type.
+			model = path.Base(model)
+			add(&proto.Resource_Accelerator{
+				Vendor: acceleratorVendor(model),
+				Model:  model,
+				Count:  quantity(block["count"]),
+			})
+		}
+	case strings.HasPrefix(resource.Type, "kubernetes_"):
+		for _, container := range kubernetesContainers(resource.AttributeValues) {
+			for _, resources := range attributeBlocks(container, "resources") {
+				// Extended resources must have equal requests and limits,
+				// so the limits are enough.
+				limits, _ := resources["limits"].(map[string]interface{})
+				names := make([]string, 0, len(limits))
+				for name := range limits {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					if !strings.HasSuffix(name, "/gpu") && !strings.HasPrefix(name, "gpu.intel.com/") {
+						continue
+					}
+					add(&proto.Resource_Accelerator{
+						Vendor: acceleratorVendor(name),
+						Model:  name,
+						Count:  quantity(limits[name]),
+					})
+				}
+			}
+		}
+	}
+	return accelerators
+}
+
+// kubernetesContainers returns the containers of pods, and of the pod
+// templates of workload resources such as deployments.
+func kubernetesContainers(attributes map[string]interface{}) []map[string]interface{} {
+	var containers []map[string]interface{}
+	for _, spec := range attributeBlocks(attributes, "spec") {
+		containers = append(containers, attributeBlocks(spec, "container")...)
+		for _, template := range attributeBlocks(spec, "template") {
+			containers = append(containers, kubernetesContainers(template)...)
+		}
+	}
+	return containers
+}
+
+// attributeBlocks returns the nested blocks of the attribute, which are
+// lists of objects in the state.
+func attributeBlocks(attributes map[string]interface{}, key string) []map[string]interface{} {
+	list, _ := attributes[key].([]interface{})
+	blocks := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if block, ok := item.(map[string]interface{}); ok {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// acceleratorVendor guesses the vendor from the name of the accelerator,
+// e.g. "nvidia-tesla-t4" or "amd.com/gpu".
+func acceleratorVendor(name string) string {
+	name = strings.ToLower(name)
+	for _, vendor := range []string{"nvidia", "amd", "intel"} {
+		if strings.Contains(name, vendor) {
+			return vendor
+		}
+	}
+	return ""
+}
+
+// quantity returns the count of a number or Kubernetes quantity, which
+// are strings in the state. Fractional quantities aren't valid for
+// accelerators and are ignored.
+func quantity(value interface{}) int32 {
+	switch v := value.(type) {
+	case float64:
+		return int32(v)
+	case string:
+		count, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return 0
+		}
+		return int32(count)
+	}
+	return 0
+}
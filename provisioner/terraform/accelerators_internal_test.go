@@ -0,0 +1,92 @@
+package terraform
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestResourceAccelerators(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		resource *tfjson.StateResource
+		expected []*proto.Resource_Accelerator
+	}{{
+		name: "InstanceType",
+		resource: &tfjson.StateResource{
+			Type:            "aws_spot_instance_request",
+			AttributeValues: map[string]interface{}{"instance_type": "g5.12xlarge"},
+		},
+		expected: []*proto.Resource_Accelerator{{Vendor: "nvidia", Model: "A10G", Count: 4}},
+	}, {
+		name: "NoAccelerators",
+		resource: &tfjson.StateResource{
+			Type:            "aws_instance",
+			AttributeValues: map[string]interface{}{"instance_type": "t3.micro"},
+		},
+	}, {
+		name: "GuestAccelerator",
+		resource: &tfjson.StateResource{
+			Type: "google_compute_instance",
+			AttributeValues: map[string]interface{}{
+				"machine_type": "n1-standard-8",
+				"guest_accelerator": []interface{}{
+					map[string]interface{}{"type": "nvidia-tesla-t4", "count": float64(1)},
+					map[string]interface{}{"type": "projects/p/zones/us-central1-a/acceleratorTypes/nvidia-tesla-t4", "count": float64(1)},
+				},
+			},
+		},
+		expected: []*proto.Resource_Accelerator{{Vendor: "nvidia", Model: "nvidia-tesla-t4", Count: 2}},
+	}, {
+		name: "KubernetesPod",
+		resource: &tfjson.StateResource{
+			Type: "kubernetes_pod_v1",
+			AttributeValues: map[string]interface{}{
+				"spec": []interface{}{map[string]interface{}{
+					"container": []interface{}{
+						map[string]interface{}{"resources": []interface{}{map[string]interface{}{
+							"limits": map[string]interface{}{"cpu": "2", "nvidia.com/gpu": "2"},
+						}}},
+						map[string]interface{}{"resources": []interface{}{map[string]interface{}{
+							"limits": map[string]interface{}{"amd.com/gpu": "1"},
+						}}},
+					},
+				}},
+			},
+		},
+		expected: []*proto.Resource_Accelerator{
+			{Vendor: "nvidia", Model: "nvidia.com/gpu", Count: 2},
+			{Vendor: "amd", Model: "amd.com/gpu", Count: 1},
+		},
+	}, {
+		name: "KubernetesDeployment",
+		resource: &tfjson.StateResource{
+			Type: "kubernetes_deployment",
+			AttributeValues: map[string]interface{}{
+				"spec": []interface{}{map[string]interface{}{
+					"template": []interface{}{map[string]interface{}{
+						"spec": []interface{}{map[string]interface{}{
+							"container": []interface{}{map[string]interface{}{
+								"resources": []interface{}{map[string]interface{}{
+									"limits": map[string]interface{}{"gpu.intel.com/i915": "1"},
+								}},
+							}},
+						}},
+					}},
+				}},
+			},
+		},
+		expected: []*proto.Resource_Accelerator{{Vendor: "intel", Model: "gpu.intel.com/i915", Count: 1}},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tc.expected, resourceAccelerators(tc.resource))
+		})
+	}
+}
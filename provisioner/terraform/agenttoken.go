@@ -0,0 +1,135 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// AgentTokenVariablePrefix is the prefix of Terraform variables that receive
+// a pre-generated agent token. A template declaring
+// `variable "coder_agent_token_main" {}` is passed the token of the agent
+// named "main", which allows the token to be handed to cloud-init or
+// user_data directly instead of relying on the coder_agent resource.
+//
+// These variables are not exposed as template variables.
+const AgentTokenVariablePrefix = "coder_agent_token_"
+
+// agentTokensFileName stores the tokens generated during plan so the same
+// tokens are reported after apply.
+const agentTokensFileName = "coder-agent-tokens.json"
+
+func isAgentTokenVariable(name string) bool {
+	return strings.HasPrefix(name, AgentTokenVariablePrefix) && len(name) > len(AgentTokenVariablePrefix)
+}
+
+// generateAgentTokens generates a token for every agent token variable
+// declared by the module in workdir. Tokens are persisted in the working
+// directory and are never logged.
+func generateAgentTokens(workdir string, logr logSink) (map[string]string, error) {
+	module, diags := tfconfig.LoadModule(workdir)
+	if diags.HasErrors() {
+		return nil, xerrors.Errorf("load module: %s", formatDiagnostics(workdir, diags))
+	}
+
+	names := make([]string, 0)
+	for name := range module.Variables {
+		if isAgentTokenVariable(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	tokens := make(map[string]string, len(names))
+	for _, name := range names {
+		if !module.Variables[name].Sensitive {
+			logr.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf(
+				"variable %q receives an agent token but is not marked as sensitive, its value may be exposed in the build logs", name))
+		}
+		logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf("injecting pre-generated agent token: %s=<value redacted>", name))
+		tokens[strings.TrimPrefix(name, AgentTokenVariablePrefix)] = uuid.NewString()
+	}
+
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return nil, xerrors.Errorf("marshal agent tokens: %w", err)
+	}
+	err = os.WriteFile(filepath.Join(workdir, agentTokensFileName), data, 0o600)
+	if err != nil {
+		return nil, xerrors.Errorf("write agent tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// readAgentTokens reads the tokens generated during plan. A nil map is
+// returned if no tokens were generated.
+func readAgentTokens(workdir string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(workdir, agentTokensFileName))
+	if err != nil {
+		if xerrors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, xerrors.Errorf("read agent tokens: %w", err)
+	}
+	var tokens map[string]string
+	err = json.Unmarshal(data, &tokens)
+	if err != nil {
+		return nil, xerrors.Errorf("unmarshal agent tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// removeAgentTokens removes the tokens generated during plan.
+func removeAgentTokens(workdir string) error {
+	err := os.Remove(filepath.Join(workdir, agentTokensFileName))
+	if err != nil && !xerrors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// agentTokenEnv passes the tokens to Terraform through the environment. The
+// environment is used instead of -var flags because command arguments are
+// logged and traced.
+func agentTokenEnv(tokens map[string]string) []string {
+	env := make([]string, 0, len(tokens))
+	for agentName, token := range tokens {
+		env = append(env, "TF_VAR_"+AgentTokenVariablePrefix+agentName+"="+token)
+	}
+	return env
+}
+
+// applyAgentTokens replaces the token of token-authenticated agents with the
+// pre-generated one, so the token coderd stores matches the one the template
+// passed to the workspace.
+func applyAgentTokens(resources []*proto.Resource, tokens map[string]string) {
+	if len(tokens) == 0 {
+		return
+	}
+	for _, resource := range resources {
+		for _, agent := range resource.Agents {
+			token, ok := tokens[agent.Name]
+			if !ok {
+				continue
+			}
+			if _, ok := agent.Auth.(*proto.Agent_Token); !ok {
+				continue
+			}
+			agent.Auth = &proto.Agent_Token{
+				Token: token,
+			}
+		}
+	}
+}
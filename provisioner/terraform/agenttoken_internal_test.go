@@ -0,0 +1,79 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestAgentTokens(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`
+variable "coder_agent_token_main" {
+	type      = string
+	sensitive = true
+}
+variable "coder_agent_token_dev" {
+	type = string
+}
+variable "region" {
+	type = string
+}
+`), 0o600)
+	require.NoError(t, err)
+
+	logr := &mockLogger{}
+	tokens, err := generateAgentTokens(dir, logr)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.NotEmpty(t, tokens["main"])
+	require.NotEmpty(t, tokens["dev"])
+
+	// Tokens must never be logged, and unsafe variables should be warned.
+	var warned bool
+	for _, log := range logr.logs {
+		require.NotContains(t, log.Output, tokens["main"])
+		require.NotContains(t, log.Output, tokens["dev"])
+		if log.Level == proto.LogLevel_WARN && strings.Contains(log.Output, "coder_agent_token_dev") {
+			warned = true
+		}
+	}
+	require.True(t, warned, "expected a warning for the non-sensitive variable")
+
+	require.Contains(t, agentTokenEnv(tokens), "TF_VAR_coder_agent_token_main="+tokens["main"])
+
+	read, err := readAgentTokens(dir)
+	require.NoError(t, err)
+	require.Equal(t, tokens, read)
+
+	resources := []*proto.Resource{{
+		Agents: []*proto.Agent{{
+			Name: "main",
+			Auth: &proto.Agent_Token{Token: "from-state"},
+		}, {
+			Name: "dev",
+			Auth: &proto.Agent_InstanceId{InstanceId: "instance"},
+		}},
+	}}
+	applyAgentTokens(resources, read)
+	require.Equal(t, tokens["main"], resources[0].Agents[0].GetToken())
+	require.Equal(t, "instance", resources[0].Agents[1].GetInstanceId())
+
+	t.Run("NoVariables", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		tokens, err := generateAgentTokens(dir, &mockLogger{})
+		require.NoError(t, err)
+		require.Empty(t, tokens)
+		read, err := readAgentTokens(dir)
+		require.NoError(t, err)
+		require.Nil(t, read)
+	})
+}
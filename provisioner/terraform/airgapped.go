@@ -0,0 +1,158 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// AirGappedOptions install providers only from mirrors. Registries aren't
+// accessed, even for providers that are missing from the mirrors, so
+// air-gapped deployments fail with an error naming the missing providers
+// instead of network timeouts.
+type AirGappedOptions struct {
+	// FilesystemMirrors are directories of providers, as created by
+	// "terraform providers mirror".
+	FilesystemMirrors []string
+	// NetworkMirrors are HTTPS URLs of provider network mirrors.
+	NetworkMirrors []string
+}
+
+// Enabled returns whether any mirror is configured.
+func (o AirGappedOptions) Enabled() bool {
+	return len(o.FilesystemMirrors) > 0 || len(o.NetworkMirrors) > 0
+}
+
+// Validate returns an error if a mirror is invalid.
+func (o AirGappedOptions) Validate() error {
+	for _, mirror := range o.FilesystemMirrors {
+		if !filepath.IsAbs(mirror) {
+			return xerrors.Errorf("filesystem mirror %q must be an absolute path", mirror)
+		}
+	}
+	for _, mirror := range o.NetworkMirrors {
+		parsed, err := url.Parse(mirror)
+		if err != nil {
+			return xerrors.Errorf("parse network mirror %q: %w", mirror, err)
+		}
+		// Terraform only supports network mirrors over HTTPS.
+		if parsed.Scheme != "https" || parsed.Host == "" {
+			return xerrors.Errorf("network mirror %q must be an https URL", mirror)
+		}
+	}
+	return nil
+}
+
+// mirrors returns all mirrors for error messages.
+func (o AirGappedOptions) mirrors() []string {
+	return append(append([]string{}, o.FilesystemMirrors...), o.NetworkMirrors...)
+}
+
+// cliConfig returns the Terraform CLI configuration that installs providers
+// from the mirrors. Without a "direct" block, providers missing from the
+// mirrors fail to install.
+func (o AirGappedOptions) cliConfig() string {
+	var config strings.Builder
+	_, _ = config.WriteString("provider_installation {\n")
+	for _, mirror := range o.FilesystemMirrors {
+		_, _ = fmt.Fprintf(&config, "  filesystem_mirror {\n    path = %s\n  }\n", strconv.Quote(mirror))
+	}
+	for _, mirror := range o.NetworkMirrors {
+		if !strings.HasSuffix(mirror, "/") {
+			mirror += "/"
+		}
+		_, _ = fmt.Fprintf(&config, "  network_mirror {\n    url = %s\n  }\n", strconv.Quote(mirror))
+	}
+	_, _ = config.WriteString("}\n")
+	return config.String()
+}
+
+// airGappedCLIConfigFile is the name of the CLI configuration in the cache
+// directory.
+const airGappedCLIConfigFile = "airgapped.tfrc"
+
+// writeCLIConfig writes the CLI configuration to the cache directory and
+// returns its path.
+func (o AirGappedOptions) writeCLIConfig(cachePath string) (string, error) {
+	if cachePath == "" {
+		return "", xerrors.New("air-gapped mode requires a cache path")
+	}
+	err := os.MkdirAll(cachePath, 0o700)
+	if err != nil {
+		return "", xerrors.Errorf("create cache path: %w", err)
+	}
+	configPath := filepath.Join(cachePath, airGappedCLIConfigFile)
+	err = os.WriteFile(configPath, []byte(o.cliConfig()), 0o600)
+	if err != nil {
+		return "", xerrors.Errorf("write terraform cli config: %w", err)
+	}
+	return configPath, nil
+}
+
+// MissingProvidersError is returned when "terraform init" fails because
+// providers are missing from the mirrors in air-gapped mode.
+type MissingProvidersError struct {
+	Providers []string
+	Mirrors   []string
+}
+
+func (e *MissingProvidersError) Error() string {
+	return fmt.Sprintf("providers missing from the mirrors %s: %s; add them with \"terraform providers mirror\"",
+		strings.Join(e.Mirrors, ", "), strings.Join(e.Providers, ", "))
+}
+
+// missingProviderRegex matches the providers that "terraform init" couldn't
+// find in any mirror, e.g.
+//
+//	Could not retrieve the list of available versions for provider coder/coder:
+//	provider registry.terraform.io/coder/coder was not found in any of the search
+//	locations
+//
+// Other install failures, e.g. checksum mismatches, aren't matched. Terraform
+// wraps its errors, so any space may be a line break.
+var missingProviderRegex = regexp.MustCompile(`versions\s+for\s+provider\s+([\w.-]+/[\w.-]+(?:/[\w.-]+)?):\s+provider\s+\S+\s+was\s+not\s+found\s+in\s+any\s+of\s+the\s+search\s+locations`)
+
+// missingProviders returns the providers that failed to install in the
+// output of "terraform init".
+func missingProviders(output string) []string {
+	seen := map[string]bool{}
+	var providers []string
+	for _, match := range missingProviderRegex.FindAllStringSubmatch(output, -1) {
+		if seen[match[1]] {
+			continue
+		}
+		seen[match[1]] = true
+		providers = append(providers, match[1])
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// maxCapturedOutput bounds the output kept by captureWriter.
+const maxCapturedOutput = 64 << 10
+
+// captureWriter keeps the start of the output written through it.
+type captureWriter struct {
+	io.WriteCloser
+	captured bytes.Buffer
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	if remaining := maxCapturedOutput - w.captured.Len(); remaining > 0 {
+		_, _ = w.captured.Write(p[:min(len(p), remaining)])
+	}
+	return w.WriteCloser.Write(p)
+}
+
+func (w *captureWriter) String() string {
+	return w.captured.String()
+}
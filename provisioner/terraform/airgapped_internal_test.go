@@ -0,0 +1,76 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAirGappedOptions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("CLIConfig", func(t *testing.T) {
+		t.Parallel()
+		opts := AirGappedOptions{
+			FilesystemMirrors: []string{"/opt/terraform/plugins"},
+			NetworkMirrors:    []string{"https://mirror.example.com/providers"},
+		}
+		require.NoError(t, opts.Validate())
+		require.Equal(t, `provider_installation {
+  filesystem_mirror {
+    path = "/opt/terraform/plugins"
+  }
+  network_mirror {
+    url = "https://mirror.example.com/providers/"
+  }
+}
+`, opts.cliConfig())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+		require.ErrorContains(t, AirGappedOptions{FilesystemMirrors: []string{"plugins"}}.Validate(), "absolute path")
+		require.ErrorContains(t, AirGappedOptions{NetworkMirrors: []string{"http://mirror.example.com"}}.Validate(), "https URL")
+	})
+
+	t.Run("MissingProviders", func(t *testing.T) {
+		t.Parallel()
+		output := `
+Error: Failed to query available provider packages
+
+Could not retrieve the list of available versions for provider coder/coder:
+provider registry.terraform.io/coder/coder was not found in any of the search
+locations
+
+- /opt/terraform/plugins
+
+Error: Failed to install provider
+
+Error while installing hashicorp/aws v5.31.0: the current package for
+registry.terraform.io/hashicorp/aws 5.31.0 doesn't match any of the checksums
+previously recorded in the dependency lock file
+
+Could not retrieve the list of available versions for provider
+hashicorp/google: provider registry.terraform.io/hashicorp/google was not found
+in any of the search locations
+
+Could not retrieve the list of available versions for provider coder/coder:
+provider registry.terraform.io/coder/coder was not found in any of the search
+locations
+`
+		require.Equal(t, []string{"coder/coder", "hashicorp/google"}, missingProviders(output))
+		require.Empty(t, missingProviders("Error: Unsupported argument"))
+	})
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		t.Parallel()
+		output := `
+Error: Failed to install provider
+
+Error while installing hashicorp/aws v5.31.0: the current package for
+registry.terraform.io/hashicorp/aws 5.31.0 doesn't match any of the checksums
+previously recorded in the dependency lock file
+`
+		require.Empty(t, missingProviders(output))
+	})
+}
@@ -0,0 +1,59 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// AppSharingLevelError is returned by ConvertState when an app is shared
+// more widely than the template allows.
+type AppSharingLevelError struct {
+	App          string
+	SharingLevel proto.AppSharingLevel
+	Max          proto.AppSharingLevel
+}
+
+func (e *AppSharingLevelError) Error() string {
+	return fmt.Sprintf("app %q is shared with %q, but the template allows at most %q",
+		e.App, strings.ToLower(e.SharingLevel.String()), strings.ToLower(e.Max.String()))
+}
+
+// parseAppSharingLevel converts the share attribute of an app. Unset or
+// unknown values default to the owner.
+func parseAppSharingLevel(share string) proto.AppSharingLevel {
+	switch strings.ToLower(share) {
+	case "authenticated":
+		return proto.AppSharingLevel_AUTHENTICATED
+	case "public":
+		return proto.AppSharingLevel_PUBLIC
+	}
+	return proto.AppSharingLevel_OWNER
+}
+
+// maxAppSharingLevel returns the sharing level limit of the template, which
+// coderd sends in the metadata of the job. Nil is returned if the job
+// doesn't limit sharing, e.g. when importing the first version of a
+// template.
+func maxAppSharingLevel(metadata *proto.Metadata) (*proto.AppSharingLevel, error) {
+	value := metadata.GetMaxAppSharingLevel()
+	if value == "" {
+		return nil, nil
+	}
+
+	var level proto.AppSharingLevel
+	switch value {
+	case "owner":
+		level = proto.AppSharingLevel_OWNER
+	case "authenticated":
+		level = proto.AppSharingLevel_AUTHENTICATED
+	case "public":
+		level = proto.AppSharingLevel_PUBLIC
+	default:
+		return nil, xerrors.Errorf("invalid max app sharing level %q, must be one of: owner, authenticated, public", value)
+	}
+	return &level, nil
+}
@@ -0,0 +1,24 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestMaxAppSharingLevel(t *testing.T) {
+	t.Parallel()
+
+	level, err := maxAppSharingLevel(nil)
+	require.NoError(t, err)
+	require.Nil(t, level, "jobs without a limit aren't limited")
+
+	level, err = maxAppSharingLevel(&proto.Metadata{MaxAppSharingLevel: "authenticated"})
+	require.NoError(t, err)
+	require.Equal(t, proto.AppSharingLevel_AUTHENTICATED, *level)
+
+	_, err = maxAppSharingLevel(&proto.Metadata{MaxAppSharingLevel: "everyone"})
+	require.ErrorContains(t, err, "invalid max app sharing level")
+}
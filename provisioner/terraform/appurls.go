@@ -0,0 +1,61 @@
+package terraform
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/coder/coder/v2/coderd/workspaceapps/appurl"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// appURLDiagnosticString formats the diagnostic for the logs of a build.
+func appURLDiagnosticString(d *proto.AppURLDiagnostic) string {
+	return fmt.Sprintf("app %q: url %q %s. %s", d.App, d.Url, d.Summary, d.Fix)
+}
+
+// validateAppURL checks the url of an app the agent proxies. External apps
+// are links opened by the browser, so they're not checked. appHostname is
+// the wildcard hostname of the deployment, see ConvertOptions.AppHostname.
+func validateAppURL(app agentAppAttributes, appHostname *string) []*proto.AppURLDiagnostic {
+	if app.URL == "" || app.External {
+		return nil
+	}
+	diagnostic := func(summary, fix string) []*proto.AppURLDiagnostic {
+		return []*proto.AppURLDiagnostic{{App: app.Slug, Url: app.URL, Summary: summary, Fix: fix}}
+	}
+
+	if app.Subdomain && appHostname != nil && *appHostname == "" {
+		return diagnostic("is served on a subdomain, but the deployment has no wildcard access URL, so the app can't be opened",
+			"Set subdomain = false to serve the app on a path, or ask an administrator to configure a wildcard access URL.")
+	}
+
+	u, err := url.Parse(app.URL)
+	if err != nil || u.Host == "" {
+		return diagnostic("isn't an absolute URL",
+			`Use the URL the app listens on in the workspace, e.g. "http://localhost:8080".`)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return diagnostic(fmt.Sprintf("uses the scheme %q, but apps are proxied over HTTP", u.Scheme),
+			`Use "http" or "https", or set external = true if the app is a link opened by the browser.`)
+	}
+	host := u.Hostname()
+	if strings.Contains(host, "*") {
+		fix := `Use the host the app listens on, e.g. "localhost".`
+		if !app.Subdomain && (appHostname == nil || *appHostname != "") {
+			// Templates use wildcards to serve apps on their own hostname.
+			fix += " To serve the app on a hostname of its own, set subdomain = true."
+		}
+		return diagnostic("has a wildcard host, which the agent can't connect to", fix)
+	}
+	if appHostname != nil && *appHostname != "" {
+		pattern, err := appurl.CompileHostnamePattern(*appHostname)
+		if err == nil && pattern.MatchString(host) {
+			// The agent would proxy the app to the deployment, rather
+			// than to the app in the workspace.
+			return diagnostic(fmt.Sprintf("is on the wildcard access URL of the deployment %q, which serves apps rather than the app itself", *appHostname),
+				`Use the URL the app listens on in the workspace, e.g. "http://localhost:8080".`)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAppURL(t *testing.T) {
+	t.Parallel()
+
+	wildcard := "*.apps.example.com"
+	noWildcard := ""
+	for _, tc := range []struct {
+		name        string
+		app         agentAppAttributes
+		appHostname *string
+		summary     string
+		fix         string
+		// notFix must not be part of the fix.
+		notFix string
+	}{{
+		name: "Localhost",
+		app:  agentAppAttributes{URL: "http://localhost:8080/path"},
+	}, {
+		name: "NoURL",
+		app:  agentAppAttributes{Command: "htop"},
+	}, {
+		name: "External",
+		app:  agentAppAttributes{URL: "vscode://coder.coder-remote/open", External: true},
+	}, {
+		name:    "Relative",
+		app:     agentAppAttributes{URL: "localhost:8080"},
+		summary: "isn't an absolute URL",
+	}, {
+		name:    "Scheme",
+		app:     agentAppAttributes{URL: "ws://localhost:8080"},
+		summary: `uses the scheme "ws"`,
+		fix:     "external = true",
+	}, {
+		name:    "Wildcard",
+		app:     agentAppAttributes{URL: "http://*.localhost:8080"},
+		summary: "wildcard host",
+		fix:     "subdomain = true",
+	}, {
+		name:    "WildcardSubdomain",
+		app:     agentAppAttributes{URL: "http://*.localhost:8080", Subdomain: true},
+		summary: "wildcard host",
+		notFix:  "subdomain = true",
+	}, {
+		name:        "WildcardNoWildcardAccessURL",
+		app:         agentAppAttributes{URL: "http://*.localhost:8080"},
+		appHostname: &noWildcard,
+		summary:     "wildcard host",
+		notFix:      "subdomain = true",
+	}, {
+		// Servers listen on it, but the agent connects to localhost on
+		// the operating systems workspaces run.
+		name: "Unspecified",
+		app:  agentAppAttributes{URL: "http://0.0.0.0:8080"},
+	}, {
+		name:        "Subdomain",
+		app:         agentAppAttributes{URL: "http://localhost:8080", Subdomain: true},
+		appHostname: &wildcard,
+	}, {
+		name: "SubdomainUnknownDeployment",
+		app:  agentAppAttributes{URL: "http://localhost:8080", Subdomain: true},
+	}, {
+		name:        "SubdomainNoWildcardAccessURL",
+		app:         agentAppAttributes{URL: "http://localhost:8080", Subdomain: true},
+		appHostname: &noWildcard,
+		summary:     "the deployment has no wildcard access URL",
+		fix:         "subdomain = false",
+	}, {
+		name:        "PathNoWildcardAccessURL",
+		app:         agentAppAttributes{URL: "http://localhost:8080"},
+		appHostname: &noWildcard,
+	}, {
+		name:        "WildcardAccessURL",
+		app:         agentAppAttributes{URL: "https://code--main--ws--user.apps.example.com"},
+		appHostname: &wildcard,
+		summary:     `wildcard access URL of the deployment "*.apps.example.com"`,
+	}, {
+		name:        "OtherHost",
+		app:         agentAppAttributes{URL: "https://apps.example.com"},
+		appHostname: &wildcard,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tc.app.Slug = "app"
+			diagnostics := validateAppURL(tc.app, tc.appHostname)
+			if tc.summary == "" {
+				require.Empty(t, diagnostics)
+				return
+			}
+			require.Len(t, diagnostics, 1)
+			require.Equal(t, "app", diagnostics[0].App)
+			require.Equal(t, tc.app.URL, diagnostics[0].Url)
+			require.Contains(t, diagnostics[0].Summary, tc.summary)
+			require.Contains(t, diagnostics[0].Fix, tc.fix)
+			if tc.notFix != "" {
+				require.NotContains(t, diagnostics[0].Fix, tc.notFix)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package terraform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/buildinfo"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+const (
+	// diagnosticBundleMaxLogs is the number of the last provisioner logs of a
+	// build kept for its diagnostic bundle.
+	diagnosticBundleMaxLogs = 1000
+	// diagnosticBundleMaxPlanSize limits the size of the plan in a
+	// diagnostic bundle, larger plans are left out.
+	diagnosticBundleMaxPlanSize = 1 << 20
+
+	redactedValue = "(sensitive value)"
+)
+
+// recordingLogSink records the last logs sent to the sink, for the
+// diagnostic bundle of a failed build.
+type recordingLogSink struct {
+	logSink
+
+	mu   sync.Mutex
+	logs []*proto.Log
+}
+
+func (r *recordingLogSink) ProvisionLog(level proto.LogLevel, output string) {
+	r.logSink.ProvisionLog(level, output)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs = append(r.logs, &proto.Log{Level: level, Output: output})
+	if len(r.logs) > diagnosticBundleMaxLogs {
+		r.logs = r.logs[len(r.logs)-diagnosticBundleMaxLogs:]
+	}
+}
+
+func (r *recordingLogSink) recorded() []*proto.Log {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*proto.Log(nil), r.logs...)
+}
+
+// diagnosticBundle collects the diagnostics of a failed build. Parts that
+// can't be collected are left out, and the reason is added to the errors of
+// the bundle.
+func (e *executor) diagnosticBundle(ctx, killCtx context.Context, logs []*proto.Log) *proto.DiagnosticBundle {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	bundle := &proto.DiagnosticBundle{
+		Logs:        logs,
+		Environment: diagnosticEnvironment(),
+	}
+	bundleErr := func(format string, args ...any) {
+		bundle.Errors = append(bundle.Errors, fmt.Sprintf(format, args...))
+	}
+
+	version, err := e.version(ctx)
+	if err != nil {
+		bundleErr("terraform version: %s", err)
+	} else {
+		bundle.TerraformVersion = version.String()
+	}
+
+	// Plans that failed don't write a plan file.
+	var plan *tfjson.Plan
+	_, err = os.Stat(e.planFilePath())
+	if err == nil {
+		plan, err = e.showPlan(ctx, killCtx, e.planFilePath())
+	}
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		bundleErr("no plan, the build failed before planning finished")
+	case err != nil:
+		bundleErr("show plan: %s", err)
+	default:
+		planJSON, err := sanitizedPlanJSON(plan)
+		switch {
+		case err != nil:
+			bundleErr("sanitize plan: %s", err)
+		case len(planJSON) > diagnosticBundleMaxPlanSize:
+			bundleErr("plan of %d bytes exceeds the limit of %d bytes", len(planJSON), diagnosticBundleMaxPlanSize)
+		default:
+			bundle.PlanJson = planJSON
+		}
+	}
+
+	graph, err := e.graph(ctx, killCtx)
+	if err != nil {
+		bundleErr("graph: %s", err)
+	} else {
+		bundle.Graph = graph
+	}
+	return bundle
+}
+
+// diagnosticEnvironment summarizes the host and the terraform environment
+// variables of the provisioner. Only the values of variables known not to
+// contain secrets are kept.
+func diagnosticEnvironment() map[string]string {
+	env := map[string]string{
+		"os":                  runtime.GOOS,
+		"arch":                runtime.GOARCH,
+		"provisioner_version": buildinfo.Version(),
+	}
+	for _, e := range safeEnviron() {
+		name, value, _ := strings.Cut(e, "=")
+		if !strings.HasPrefix(name, "TF_") {
+			continue
+		}
+		if !tfEnvSafeToPrint[name] {
+			value = "<value redacted>"
+		}
+		env[name] = value
+	}
+	return env
+}
+
+// sanitizedPlanJSON marshals the changes of the plan, with the values of
+// variables and values marked as sensitive redacted. The prior state and the
+// configuration are left out, since they may contain secrets that aren't
+// marked as sensitive.
+func sanitizedPlanJSON(plan *tfjson.Plan) ([]byte, error) {
+	sanitized := &tfjson.Plan{
+		FormatVersion:      plan.FormatVersion,
+		TerraformVersion:   plan.TerraformVersion,
+		ResourceDrift:      sanitizeResourceChanges(plan.ResourceDrift),
+		ResourceChanges:    sanitizeResourceChanges(plan.ResourceChanges),
+		RelevantAttributes: plan.RelevantAttributes,
+		Checks:             plan.Checks,
+		Timestamp:          plan.Timestamp,
+	}
+	if len(plan.Variables) > 0 {
+		sanitized.Variables = make(map[string]*tfjson.PlanVariable, len(plan.Variables))
+		for name := range plan.Variables {
+			sanitized.Variables[name] = &tfjson.PlanVariable{Value: redactedValue}
+		}
+	}
+	if len(plan.OutputChanges) > 0 {
+		sanitized.OutputChanges = make(map[string]*tfjson.Change, len(plan.OutputChanges))
+		for name, change := range plan.OutputChanges {
+			sanitized.OutputChanges[name] = sanitizeChange(change)
+		}
+	}
+	data, err := json.Marshal(sanitized)
+	if err != nil {
+		return nil, xerrors.Errorf("marshal plan: %w", err)
+	}
+	return data, nil
+}
+
+func sanitizeResourceChanges(changes []*tfjson.ResourceChange) []*tfjson.ResourceChange {
+	if len(changes) == 0 {
+		return nil
+	}
+	sanitized := make([]*tfjson.ResourceChange, 0, len(changes))
+	for _, change := range changes {
+		if change == nil {
+			continue
+		}
+		c := *change
+		c.Change = sanitizeChange(change.Change)
+		sanitized = append(sanitized, &c)
+	}
+	return sanitized
+}
+
+func sanitizeChange(change *tfjson.Change) *tfjson.Change {
+	if change == nil {
+		return nil
+	}
+	c := *change
+	c.Before = redactSensitive(change.Before, change.BeforeSensitive)
+	c.After = redactSensitive(change.After, change.AfterSensitive)
+	return &c
+}
+
+// redactSensitive replaces the parts of the value marked as sensitive. The
+// sensitivity mirrors the structure of the value, with true for sensitive
+// values.
+func redactSensitive(value, sensitive any) any {
+	if value == nil {
+		return nil
+	}
+	switch sensitive := sensitive.(type) {
+	case bool:
+		if sensitive {
+			return redactedValue
+		}
+		return value
+	case map[string]any:
+		values, ok := value.(map[string]any)
+		if !ok {
+			return value
+		}
+		redacted := make(map[string]any, len(values))
+		for key, v := range values {
+			redacted[key] = redactSensitive(v, sensitive[key])
+		}
+		return redacted
+	case []any:
+		values, ok := value.([]any)
+		if !ok {
+			return value
+		}
+		redacted := make([]any, len(values))
+		for i, v := range values {
+			var s any
+			if i < len(sensitive) {
+				s = sensitive[i]
+			}
+			redacted[i] = redactSensitive(v, s)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
@@ -0,0 +1,88 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestSanitizedPlanJSON(t *testing.T) {
+	t.Parallel()
+
+	plan := &tfjson.Plan{
+		FormatVersion: "1.2",
+		Variables: map[string]*tfjson.PlanVariable{
+			"db_password": {Value: "hunter2"},
+		},
+		ResourceChanges: []*tfjson.ResourceChange{{
+			Address: "coder_agent.main",
+			Type:    "coder_agent",
+			Change: &tfjson.Change{
+				Actions: tfjson.Actions{tfjson.ActionCreate},
+				After: map[string]any{
+					"os":    "linux",
+					"token": "secret-token",
+					"env": map[string]any{
+						"GREETING": "hello",
+						"API_KEY":  "secret-key",
+					},
+					"hosts": []any{"a", "secret-host"},
+				},
+				AfterSensitive: map[string]any{
+					"token": true,
+					"env": map[string]any{
+						"API_KEY": true,
+					},
+					"hosts": []any{false, true},
+				},
+			},
+		}},
+		OutputChanges: map[string]*tfjson.Change{
+			"password": {
+				After:          "secret-output",
+				AfterSensitive: true,
+			},
+		},
+		PriorState: &tfjson.State{FormatVersion: "1.0"},
+		Config:     &tfjson.Config{},
+	}
+
+	data, err := sanitizedPlanJSON(plan)
+	require.NoError(t, err)
+	for _, secret := range []string{"hunter2", "secret-token", "secret-key", "secret-host", "secret-output"} {
+		require.NotContains(t, string(data), secret)
+	}
+
+	var sanitized map[string]any
+	require.NoError(t, json.Unmarshal(data, &sanitized))
+	require.NotContains(t, sanitized, "prior_state")
+	require.NotContains(t, sanitized, "configuration")
+	after := sanitized["resource_changes"].([]any)[0].(map[string]any)["change"].(map[string]any)["after"]
+	require.Equal(t, map[string]any{
+		"os":    "linux",
+		"token": redactedValue,
+		"env": map[string]any{
+			"GREETING": "hello",
+			"API_KEY":  redactedValue,
+		},
+		"hosts": []any{"a", redactedValue},
+	}, after)
+}
+
+func TestRecordingLogSink(t *testing.T) {
+	t.Parallel()
+
+	sink := &recordingLogSink{logSink: discardLogSink{}}
+	for i := 0; i < diagnosticBundleMaxLogs+10; i++ {
+		sink.ProvisionLog(proto.LogLevel_INFO, fmt.Sprint(i))
+	}
+	logs := sink.recorded()
+	require.Len(t, logs, diagnosticBundleMaxLogs)
+	require.Equal(t, "10", logs[0].Output)
+	require.Equal(t, fmt.Sprint(diagnosticBundleMaxLogs+9), logs[len(logs)-1].Output)
+}
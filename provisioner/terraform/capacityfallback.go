@@ -0,0 +1,222 @@
+package terraform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// CapacityFallbackVariable is the template variable that lists alternate
+// capacity options in order of preference, e.g.
+// `variable "coder_capacity_fallback" { default = ["spot", "on-demand"] }`.
+//
+// The template provisions the first option of the list, e.g. with
+// `var.coder_capacity_fallback[0] == "spot"`. When an apply fails with
+// capacity errors only, the build is planned again with the options after
+// the failed one and applied, until an option succeeds or none are left.
+// The attempts and the selected option are recorded in the result of the
+// apply. coderd records the selected option with the build, and sends it
+// with the metadata of later builds of the workspace so they start with it.
+const CapacityFallbackVariable = "coder_capacity_fallback"
+
+// capacityFallbackFileName persists the capacity options of a plan that
+// enabled CapacityFallbackVariable, as the variables aren't passed to apply.
+const capacityFallbackFileName = "coder-capacity-fallback.json"
+
+// capacityErrorPatterns match the errors of providers that ran out of
+// capacity for the requested resources, which an alternate instance type,
+// purchase option or region may have. They're matched against the summary
+// and detail of error diagnostics.
+var capacityErrorPatterns = []*regexp.Regexp{
+	// AWS.
+	regexp.MustCompile(`InsufficientInstanceCapacity|InsufficientHostCapacity|InsufficientReservedInstanceCapacity|SpotMaxPriceTooLow|MaxSpotInstanceCountExceeded|InsufficientFreeAddressesInSubnet|capacity-not-available|capacity-oversubscribed`),
+	// Google Cloud.
+	regexp.MustCompile(`ZONE_RESOURCE_POOL_EXHAUSTED(_WITH_DETAILS)?|(?i)does not have enough resources available to fulfill the request`),
+	// Azure.
+	regexp.MustCompile(`SkuNotAvailable|AllocationFailed|OverconstrainedAllocationRequest|OverconstrainedZonalAllocationRequest|ZonalAllocationFailed`),
+	// Other providers.
+	regexp.MustCompile(`(?i)out of capacity|insufficient capacity|no capacity available`),
+}
+
+// isCapacityDiagnostic reports whether the diagnostic is an error of a
+// provider that ran out of capacity.
+func isCapacityDiagnostic(diag *tfjson.Diagnostic) bool {
+	if diag == nil || diag.Severity != tfjson.DiagnosticSeverityError {
+		return false
+	}
+	for _, pattern := range capacityErrorPatterns {
+		if pattern.MatchString(diag.Summary) || pattern.MatchString(diag.Detail) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCapacityFallback records the capacity options of the module in
+// workdir if it declares CapacityFallbackVariable with more than one
+// option, and returns them. The value of the variable is taken from the
+// template variables, or the default of the variable. The selected option
+// of the previous build, if it's still listed, is moved to the front.
+func writeCapacityFallback(workdir string, variables []*proto.VariableValue, selected string) ([]string, error) {
+	module, diags := tfconfig.LoadModule(workdir)
+	if diags.HasErrors() {
+		return nil, xerrors.Errorf("load module: %s", formatDiagnostics(workdir, diags))
+	}
+	path := filepath.Join(workdir, capacityFallbackFileName)
+	err := os.Remove(path)
+	if err != nil && !xerrors.Is(err, os.ErrNotExist) {
+		return nil, xerrors.Errorf("remove %q: %w", path, err)
+	}
+	variable, ok := module.Variables[CapacityFallbackVariable]
+	if !ok {
+		return nil, nil
+	}
+	var value string
+	if variable.Default != nil {
+		data, err := json.Marshal(variable.Default)
+		if err != nil {
+			return nil, xerrors.Errorf("marshal default of var.%s: %w", CapacityFallbackVariable, err)
+		}
+		value = string(data)
+	}
+	for _, v := range variables {
+		if v.Name == CapacityFallbackVariable {
+			value = v.Value
+		}
+	}
+	if value == "" || value == "null" {
+		return nil, nil
+	}
+	var options []string
+	err = json.Unmarshal([]byte(value), &options)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid value %q for var.%s, must be a list of strings", value, CapacityFallbackVariable)
+	}
+	seen := make(map[string]struct{}, len(options))
+	for _, option := range options {
+		if option == "" {
+			return nil, xerrors.Errorf("invalid value %q for var.%s, options must not be empty", value, CapacityFallbackVariable)
+		}
+		if _, ok := seen[option]; ok {
+			return nil, xerrors.Errorf("invalid value %q for var.%s, option %q is listed twice", value, CapacityFallbackVariable, option)
+		}
+		seen[option] = struct{}{}
+	}
+	// There's nothing to fall back to with a single option.
+	if len(options) < 2 {
+		return nil, nil
+	}
+	if _, ok := seen[selected]; ok {
+		reordered := make([]string, 0, len(options))
+		reordered = append(reordered, selected)
+		for _, option := range options {
+			if option != selected {
+				reordered = append(reordered, option)
+			}
+		}
+		options = reordered
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return nil, xerrors.Errorf("marshal capacity options: %w", err)
+	}
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		return nil, xerrors.Errorf("write %q: %w", path, err)
+	}
+	return options, nil
+}
+
+// readCapacityFallback returns the capacity options of the plan in workdir,
+// nil if it didn't enable CapacityFallbackVariable.
+func readCapacityFallback(workdir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(workdir, capacityFallbackFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read capacity options: %w", err)
+	}
+	var options []string
+	err = json.Unmarshal(data, &options)
+	if err != nil {
+		return nil, xerrors.Errorf("unmarshal capacity options: %w", err)
+	}
+	return options, nil
+}
+
+// capacityFallback returns whether the plan in workdir enabled
+// CapacityFallbackVariable.
+func capacityFallback(workdir string) bool {
+	_, err := os.Stat(filepath.Join(workdir, capacityFallbackFileName))
+	return err == nil
+}
+
+// withCapacityVar returns the variables of a plan with the value of
+// CapacityFallbackVariable set to the options.
+func withCapacityVar(vars, options []string) ([]string, error) {
+	value, err := json.Marshal(options)
+	if err != nil {
+		return nil, xerrors.Errorf("marshal capacity options: %w", err)
+	}
+	replaced := make([]string, 0, len(vars)+1)
+	for _, v := range vars {
+		if !strings.HasPrefix(v, CapacityFallbackVariable+"=") {
+			replaced = append(replaced, v)
+		}
+	}
+	return append(replaced, CapacityFallbackVariable+"="+string(value)), nil
+}
+
+// withCapacityOptions returns the arguments of a plan command that plans
+// the options, replacing the value of CapacityFallbackVariable passed to
+// the plan before.
+func withCapacityOptions(args, options []string) ([]string, error) {
+	value, err := json.Marshal(options)
+	if err != nil {
+		return nil, xerrors.Errorf("marshal capacity options: %w", err)
+	}
+	replaced := make([]string, 0, len(args)+2)
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-var" && i+1 < len(args) && strings.HasPrefix(args[i+1], CapacityFallbackVariable+"=") {
+			i++
+			continue
+		}
+		replaced = append(replaced, args[i])
+	}
+	return append(replaced, "-var", CapacityFallbackVariable+"="+string(value)), nil
+}
+
+// fallBackCapacity plans the build again with the capacity options after
+// the one that failed, and keeps the plan command so retries of the
+// apply plan the same option. It must only be called while the lock is
+// held.
+func (e *executor) fallBackCapacity(ctx, killCtx context.Context, logr logSink, options []string, next int, reason string) error {
+	plan := e.server.retryPlans.load(e.workdir, e.workspace)
+	if plan == nil {
+		return xerrors.New("the plan of the build wasn't kept")
+	}
+	logr.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf(
+		"Apply failed with a capacity error (%s), falling back to capacity option %q (%d of %d)",
+		reason, options[next], next+1, len(options),
+	))
+	args, err := withCapacityOptions(plan.args, options[next:])
+	if err != nil {
+		return err
+	}
+	fallback := *plan
+	fallback.args = args
+	e.server.retryPlans.store(e.workdir, e.workspace, &fallback)
+	_, err = e.planAgain(ctx, killCtx, &fallback, logr)
+	return err
+}
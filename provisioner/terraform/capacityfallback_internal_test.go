@@ -0,0 +1,167 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestWriteCapacityFallback(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	_, err := writeCapacityFallback(dir, nil, "")
+	require.NoError(t, err)
+	require.False(t, capacityFallback(dir), "modules without the variable don't fall back")
+
+	err = os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`
+variable "coder_capacity_fallback" {
+	type    = list(string)
+	default = ["spot", "on-demand"]
+}
+`), 0o600)
+	require.NoError(t, err)
+
+	written, err := writeCapacityFallback(dir, nil, "")
+	require.NoError(t, err)
+	require.True(t, capacityFallback(dir))
+	options, err := readCapacityFallback(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"spot", "on-demand"}, options)
+	require.Equal(t, options, written)
+
+	regions := []*proto.VariableValue{{Name: CapacityFallbackVariable, Value: `["us-east-1","us-west-2","eu-west-1"]`}}
+	_, err = writeCapacityFallback(dir, regions, "")
+	require.NoError(t, err)
+	options, err = readCapacityFallback(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"us-east-1", "us-west-2", "eu-west-1"}, options)
+
+	// The option selected by the previous build is tried first.
+	_, err = writeCapacityFallback(dir, regions, "us-west-2")
+	require.NoError(t, err)
+	options, err = readCapacityFallback(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"us-west-2", "us-east-1", "eu-west-1"}, options)
+	_, err = writeCapacityFallback(dir, regions, "ap-south-1")
+	require.NoError(t, err)
+	options, err = readCapacityFallback(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"us-east-1", "us-west-2", "eu-west-1"}, options, "options that are no longer listed are ignored")
+
+	single := []*proto.VariableValue{{Name: CapacityFallbackVariable, Value: `["on-demand"]`}}
+	_, err = writeCapacityFallback(dir, single, "")
+	require.NoError(t, err)
+	require.False(t, capacityFallback(dir), "there's nothing to fall back to with a single option")
+	options, err = readCapacityFallback(dir)
+	require.NoError(t, err)
+	require.Nil(t, options)
+
+	invalid := []*proto.VariableValue{{Name: CapacityFallbackVariable, Value: "spot"}}
+	_, err = writeCapacityFallback(dir, invalid, "")
+	require.ErrorContains(t, err, "must be a list of strings")
+	duplicate := []*proto.VariableValue{{Name: CapacityFallbackVariable, Value: `["spot","spot"]`}}
+	_, err = writeCapacityFallback(dir, duplicate, "")
+	require.ErrorContains(t, err, "listed twice")
+}
+
+func TestWithCapacityVar(t *testing.T) {
+	t.Parallel()
+
+	vars, err := withCapacityVar([]string{
+		`coder_capacity_fallback=["spot","on-demand"]`,
+		"region=eu",
+	}, []string{"on-demand", "spot"})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"region=eu",
+		`coder_capacity_fallback=["on-demand","spot"]`,
+	}, vars)
+}
+
+func TestApplyErrors_OutOfCapacity(t *testing.T) {
+	t.Parallel()
+
+	diagnostic := func(summary, detail string) *terraformProvisionLog {
+		return &terraformProvisionLog{
+			Level: "error",
+			Diagnostic: &tfjson.Diagnostic{
+				Severity: tfjson.DiagnosticSeverityError,
+				Summary:  summary,
+				Detail:   detail,
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name          string
+		logs          []*terraformProvisionLog
+		outOfCapacity bool
+	}{{
+		name: "AWS",
+		logs: []*terraformProvisionLog{
+			diagnostic("creating EC2 Instance: InsufficientInstanceCapacity: We currently do not have sufficient g5.xlarge capacity in the Availability Zone you requested.", "status code: 500"),
+		},
+		outOfCapacity: true,
+	}, {
+		name: "GoogleCloud",
+		logs: []*terraformProvisionLog{
+			diagnostic("Error waiting for instance to create", "The zone 'projects/coder/zones/us-central1-a' does not have enough resources available to fulfill the request. '(resource type:compute)'."),
+		},
+		outOfCapacity: true,
+	}, {
+		name: "Azure",
+		logs: []*terraformProvisionLog{
+			diagnostic("creating Linux Virtual Machine", "Code=\"SkuNotAvailable\" Message=\"The requested size for resource is currently not available in location 'eastus'.\""),
+		},
+		outOfCapacity: true,
+	}, {
+		name: "CapacityAndPermanent",
+		logs: []*terraformProvisionLog{
+			diagnostic("creating EC2 Instance: InsufficientInstanceCapacity", ""),
+			diagnostic("Unsupported argument", `An argument named "imag" is not expected here.`),
+		},
+	}, {
+		name: "Transient",
+		logs: []*terraformProvisionLog{
+			diagnostic("creating EC2 Instance: RequestLimitExceeded: Request limit exceeded.", ""),
+		},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			applyErrs := &applyErrors{}
+			for _, log := range tc.logs {
+				applyErrs.onLog(log)
+			}
+			require.Equal(t, tc.outOfCapacity, applyErrs.outOfCapacity())
+			if tc.outOfCapacity {
+				require.Equal(t, tc.logs[0].Diagnostic.Summary, applyErrs.capacitySummary)
+				// Capacity errors aren't retried, since they're unlikely to
+				// resolve within the backoff.
+				require.False(t, applyErrs.retryable())
+			}
+		})
+	}
+}
+
+func TestWithCapacityOptions(t *testing.T) {
+	t.Parallel()
+
+	args, err := withCapacityOptions([]string{
+		"plan", "-json",
+		"-var", `coder_capacity_fallback=["spot","on-demand"]`,
+		"-var", "region=eu",
+	}, []string{"on-demand"})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"plan", "-json",
+		"-var", "region=eu",
+		"-var", `coder_capacity_fallback=["on-demand"]`,
+	}, args)
+}
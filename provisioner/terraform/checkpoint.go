@@ -0,0 +1,89 @@
+package terraform
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// lockFileName is the dependency lock file written by "terraform init".
+const lockFileName = ".terraform.lock.hcl"
+
+// Checkpoints persist the files a workspace build needs to resume, so a
+// replacement daemon doesn't start the build from scratch. After init, the
+// dependency lock file is persisted, so the same providers are installed.
+//
+// Checkpoints are stored in plaintext, so they must never contain secrets.
+// The plan isn't checkpointed since it contains the values of secret
+// variables, and neither are the state and agent tokens. Provider
+// credentials and secret variables are brokered and resolved again when the
+// build is resumed.
+var checkpointFiles = map[string][]string{
+	string(provisionersdk.BuildStageInit): {lockFileName},
+}
+
+// readCheckpoint returns the checkpoint of the stage with the files of the
+// stage that exist in workdir.
+func readCheckpoint(workdir string, stage provisionersdk.BuildStage) (*proto.Checkpoint, error) {
+	names, ok := checkpointFiles[string(stage)]
+	if !ok {
+		return nil, xerrors.Errorf("no checkpoint for stage %q", stage)
+	}
+	checkpoint := &proto.Checkpoint{
+		Stage: string(stage),
+		Files: make(map[string][]byte, len(names)),
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(workdir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("read %s: %w", name, err)
+		}
+		checkpoint.Files[name] = data
+	}
+	return checkpoint, nil
+}
+
+// restoreCheckpoint writes the files of the checkpoint to workdir. Only the
+// files persisted for the stage of the checkpoint are restored.
+func restoreCheckpoint(workdir string, checkpoint *proto.Checkpoint) error {
+	names, ok := checkpointFiles[checkpoint.Stage]
+	if !ok {
+		return xerrors.Errorf("unknown checkpoint stage %q", checkpoint.Stage)
+	}
+	// Nothing is written unless every file is valid, since builds start
+	// from scratch if the checkpoint can't be restored.
+	for name := range checkpoint.Files {
+		if !slices.Contains(names, name) {
+			return xerrors.Errorf("unexpected file %q in %s checkpoint", name, checkpoint.Stage)
+		}
+	}
+	for name, data := range checkpoint.Files {
+		err := os.WriteFile(filepath.Join(workdir, name), data, 0o600)
+		if err != nil {
+			return xerrors.Errorf("write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// sendCheckpoint reports the checkpoint of the stage to the daemon. Builds
+// don't fail if a checkpoint can't be read, they just can't be resumed from
+// it.
+func sendCheckpoint(sess *provisionersdk.Session, stage provisionersdk.BuildStage) {
+	checkpoint, err := readCheckpoint(sess.WorkDirectory, stage)
+	if err != nil {
+		sess.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf("Failed to checkpoint the build: %s", err))
+		return
+	}
+	sess.ProvisionCheckpoint(checkpoint)
+}
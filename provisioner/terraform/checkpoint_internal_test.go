@@ -0,0 +1,63 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	workdir := t.TempDir()
+	for name, data := range map[string]string{
+		lockFileName:        "# lock",
+		"terraform.tfplan":  "plan",
+		"terraform.tfstate": "{}",
+		"main.tf":           "# template",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(workdir, name), []byte(data), 0o600))
+	}
+
+	checkpoint, err := readCheckpoint(workdir, provisionersdk.BuildStageInit)
+	require.NoError(t, err)
+	require.Equal(t, "init", checkpoint.Stage)
+	require.Equal(t, map[string][]byte{lockFileName: []byte("# lock")}, checkpoint.Files)
+
+	// The plan, state and agent tokens contain secrets, so they're never
+	// checkpointed.
+	for _, stage := range []provisionersdk.BuildStage{provisionersdk.BuildStagePlan, provisionersdk.BuildStageApplyCompute} {
+		_, err = readCheckpoint(workdir, stage)
+		require.Error(t, err)
+	}
+
+	resumed := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(resumed, lockFileName), []byte("stale"), 0o600))
+	require.NoError(t, restoreCheckpoint(resumed, checkpoint))
+	for name, data := range checkpoint.Files {
+		restored, err := os.ReadFile(filepath.Join(resumed, name))
+		require.NoError(t, err)
+		require.Equal(t, data, restored)
+	}
+
+	// Only the files of the stage are restored, so a checkpoint can't write
+	// outside of the work directory or replace the template.
+	for _, name := range []string{"main.tf", "../terraform.tfstate", agentTokensFileName + "/.."} {
+		err = restoreCheckpoint(resumed, &proto.Checkpoint{
+			Stage: "init",
+			Files: map[string][]byte{name: []byte("oops")},
+		})
+		require.ErrorContains(t, err, "unexpected file", name)
+	}
+	// Plan checkpoints of older versions aren't restored.
+	err = restoreCheckpoint(resumed, &proto.Checkpoint{
+		Stage: "plan",
+		Files: map[string][]byte{"terraform.tfplan": []byte("plan")},
+	})
+	require.ErrorContains(t, err, "unknown checkpoint stage")
+}
@@ -0,0 +1,107 @@
+package terraform
+
+import (
+	"sort"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// Cost is the daily cost of a workspace, as set by the daily_cost of
+// coder_metadata resources, broken down by module and resource so quota
+// enforcement can explain where the cost comes from.
+type Cost struct {
+	// DailyCost is the total of all resources, which is what quotas are
+	// enforced against.
+	DailyCost int32 `json:"daily_cost"`
+	// Modules lists the modules with a cost, ordered by address. The root
+	// module has an empty address.
+	Modules []ModuleCost `json:"modules"`
+}
+
+// ModuleCost is the cost of a module.
+type ModuleCost struct {
+	Address string `json:"address"`
+	// DailyCost includes the cost of the child modules.
+	DailyCost int32 `json:"daily_cost"`
+	// Resources lists the resources with a cost declared in the module
+	// itself, ordered by address.
+	Resources []ResourceCost `json:"resources"`
+}
+
+// ResourceCost is the cost of a resource instance.
+type ResourceCost struct {
+	Address   string `json:"address"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	DailyCost int32  `json:"daily_cost"`
+}
+
+// costBuilder collects the cost of resources while converting state.
+type costBuilder struct {
+	// parents maps module addresses to the address of their parent module.
+	parents map[string]string
+	modules map[string]*ModuleCost
+	total   int32
+}
+
+func newCostBuilder() *costBuilder {
+	return &costBuilder{
+		parents: map[string]string{},
+		modules: map[string]*ModuleCost{},
+	}
+}
+
+// addModule records the parent of a module.
+func (b *costBuilder) addModule(address, parent string) {
+	if address != "" {
+		b.parents[address] = parent
+	}
+}
+
+// addResource adds the cost of a resource declared in the module to the
+// module and its ancestors.
+func (b *costBuilder) addResource(module, address string, resource *proto.Resource) {
+	if resource.DailyCost == 0 {
+		return
+	}
+	b.total += resource.DailyCost
+	b.module(module).Resources = append(b.module(module).Resources, ResourceCost{
+		Address:   address,
+		Type:      resource.Type,
+		Name:      resource.Name,
+		DailyCost: resource.DailyCost,
+	})
+	for {
+		b.module(module).DailyCost += resource.DailyCost
+		if module == "" {
+			return
+		}
+		module = b.parents[module]
+	}
+}
+
+func (b *costBuilder) module(address string) *ModuleCost {
+	m, ok := b.modules[address]
+	if !ok {
+		m = &ModuleCost{Address: address, Resources: []ResourceCost{}}
+		b.modules[address] = m
+	}
+	return m
+}
+
+func (b *costBuilder) build() *Cost {
+	cost := &Cost{
+		DailyCost: b.total,
+		Modules:   make([]ModuleCost, 0, len(b.modules)),
+	}
+	for _, m := range b.modules {
+		sort.Slice(m.Resources, func(i, j int) bool {
+			return m.Resources[i].Address < m.Resources[j].Address
+		})
+		cost.Modules = append(cost.Modules, *m)
+	}
+	sort.Slice(cost.Modules, func(i, j int) bool {
+		return cost.Modules[i].Address < cost.Modules[j].Address
+	})
+	return cost
+}
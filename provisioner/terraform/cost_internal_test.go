@@ -0,0 +1,48 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestCostBuilder(t *testing.T) {
+	t.Parallel()
+
+	b := newCostBuilder()
+	b.addModule("module.dev", "")
+	b.addModule("module.dev.module.disk", "module.dev")
+	b.addModule("module.free", "")
+	b.addResource("", "null_resource.base", &proto.Resource{Type: "null_resource", Name: "base", DailyCost: 1})
+	b.addResource("module.dev", "module.dev.aws_instance.dev[1]", &proto.Resource{Type: "aws_instance", Name: "dev", DailyCost: 10})
+	b.addResource("module.dev", "module.dev.aws_instance.dev[0]", &proto.Resource{Type: "aws_instance", Name: "dev", DailyCost: 10})
+	b.addResource("module.dev.module.disk", "module.dev.module.disk.aws_ebs_volume.home", &proto.Resource{Type: "aws_ebs_volume", Name: "home", DailyCost: 5})
+	// Resources without a cost are omitted.
+	b.addResource("module.free", "module.free.null_resource.free", &proto.Resource{Type: "null_resource", Name: "free"})
+
+	require.Equal(t, &Cost{
+		DailyCost: 26,
+		Modules: []ModuleCost{{
+			Address:   "",
+			DailyCost: 26,
+			Resources: []ResourceCost{
+				{Address: "null_resource.base", Type: "null_resource", Name: "base", DailyCost: 1},
+			},
+		}, {
+			Address:   "module.dev",
+			DailyCost: 25,
+			Resources: []ResourceCost{
+				{Address: "module.dev.aws_instance.dev[0]", Type: "aws_instance", Name: "dev", DailyCost: 10},
+				{Address: "module.dev.aws_instance.dev[1]", Type: "aws_instance", Name: "dev", DailyCost: 10},
+			},
+		}, {
+			Address:   "module.dev.module.disk",
+			DailyCost: 5,
+			Resources: []ResourceCost{
+				{Address: "module.dev.module.disk.aws_ebs_volume.home", Type: "aws_ebs_volume", Name: "home", DailyCost: 5},
+			},
+		}},
+	}, b.build())
+}
@@ -0,0 +1,260 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// ProviderCredentialsType is the Terraform provider credentials are
+// brokered for.
+type ProviderCredentialsType string
+
+const (
+	ProviderCredentialsGitHub ProviderCredentialsType = "github"
+	ProviderCredentialsGitLab ProviderCredentialsType = "gitlab"
+	ProviderCredentialsAWS    ProviderCredentialsType = "aws"
+	ProviderCredentialsGoogle ProviderCredentialsType = "google"
+	ProviderCredentialsAzure  ProviderCredentialsType = "azurerm"
+)
+
+// credentialsDir is the directory in the working directory holding the
+// brokered credentials of a build. It's removed once the build completes.
+const credentialsDir = ".coder-credentials"
+
+// credentialsEnvFile persists the environment of the brokered credentials
+// from plan to apply, since tokens of external auth providers are only sent
+// with plans.
+const credentialsEnvFile = "env"
+
+// ProviderCredentials exchanges a token of the workspace owner into
+// credentials of a Terraform provider, so provisioners don't need
+// long-lived static credentials. The credentials are scoped to a build.
+type ProviderCredentials struct {
+	Type ProviderCredentialsType
+	// ExternalAuthID is the ID of the external auth provider whose access
+	// token is exchanged. The OIDC access token of the owner is used if
+	// it's empty, which must be a JWT for cloud providers.
+	ExternalAuthID string
+	// RoleARN is the AWS role assumed with the token.
+	RoleARN string
+	// Audience is the audience of the Google workload identity pool
+	// provider, e.g.
+	// "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/coder/providers/oidc".
+	Audience string
+	// ServiceAccount is the email of the Google service account to
+	// impersonate, if any.
+	ServiceAccount string
+	// ClientID and TenantID identify the Azure application the token is
+	// federated with.
+	ClientID string
+	TenantID string
+}
+
+// Validate reports missing settings of the provider.
+func (c ProviderCredentials) Validate() error {
+	var missing []string
+	switch c.Type {
+	case ProviderCredentialsGitHub, ProviderCredentialsGitLab:
+		if c.ExternalAuthID == "" {
+			missing = append(missing, "external auth ID")
+		}
+	case ProviderCredentialsAWS:
+		if c.RoleARN == "" {
+			missing = append(missing, "role ARN")
+		}
+	case ProviderCredentialsGoogle:
+		if c.Audience == "" {
+			missing = append(missing, "audience")
+		}
+	case ProviderCredentialsAzure:
+		if c.ClientID == "" {
+			missing = append(missing, "client ID")
+		}
+		if c.TenantID == "" {
+			missing = append(missing, "tenant ID")
+		}
+	default:
+		return xerrors.Errorf("unsupported provider credentials type %q", c.Type)
+	}
+	if len(missing) > 0 {
+		return xerrors.Errorf("%s provider credentials: missing %s", c.Type, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// tokenSource describes where the token of the credentials comes from.
+func (c ProviderCredentials) tokenSource() string {
+	if c.ExternalAuthID == "" {
+		return "the OIDC token of the workspace owner"
+	}
+	return fmt.Sprintf("external auth provider %q", c.ExternalAuthID)
+}
+
+// brokerCredentials writes the brokered credentials of the build to the
+// working directory and returns their environment variables. Credentials
+// without a token, e.g. because the owner didn't link the external auth
+// provider, are skipped.
+func brokerCredentials(
+	workdir string, credentials []ProviderCredentials, metadata *proto.Metadata,
+	externalAuth []*proto.ExternalAuthProvider, logr logSink,
+) ([]string, error) {
+	if len(credentials) == 0 {
+		return nil, nil
+	}
+	dir := filepath.Join(workdir, credentialsDir)
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, xerrors.Errorf("create credentials dir: %w", err)
+	}
+	tokens := map[string]string{}
+	for _, provider := range externalAuth {
+		tokens[provider.Id] = provider.AccessToken
+	}
+
+	var env []string
+	for i, c := range credentials {
+		token := metadata.GetWorkspaceOwnerOidcAccessToken()
+		if c.ExternalAuthID != "" {
+			token = tokens[c.ExternalAuthID]
+		}
+		if token == "" {
+			logr.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf("Skipping %s provider credentials: no token from %s", c.Type, c.tokenSource()))
+			continue
+		}
+		tokenPath := filepath.Join(dir, fmt.Sprintf("%d-%s-token", i, c.Type))
+		switch c.Type {
+		case ProviderCredentialsGitHub:
+			env = append(env, "GITHUB_TOKEN="+token)
+		case ProviderCredentialsGitLab:
+			env = append(env, "GITLAB_TOKEN="+token)
+		case ProviderCredentialsAWS:
+			err = os.WriteFile(tokenPath, []byte(token), 0o600)
+			if err != nil {
+				return nil, xerrors.Errorf("write aws token: %w", err)
+			}
+			env = append(env,
+				"AWS_ROLE_ARN="+c.RoleARN,
+				"AWS_WEB_IDENTITY_TOKEN_FILE="+tokenPath,
+				"AWS_ROLE_SESSION_NAME=coder-build-"+metadata.GetWorkspaceId(),
+			)
+		case ProviderCredentialsGoogle:
+			err = os.WriteFile(tokenPath, []byte(token), 0o600)
+			if err != nil {
+				return nil, xerrors.Errorf("write google token: %w", err)
+			}
+			// Workload identity federation, see
+			// https://cloud.google.com/iam/docs/workload-identity-federation-with-other-providers.
+			config := map[string]interface{}{
+				"type":               "external_account",
+				"audience":           c.Audience,
+				"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+				"token_url":          "https://sts.googleapis.com/v1/token",
+				"credential_source": map[string]string{
+					"file": tokenPath,
+				},
+			}
+			if c.ServiceAccount != "" {
+				config["service_account_impersonation_url"] = fmt.Sprintf(
+					"https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:generateAccessToken", c.ServiceAccount)
+			}
+			data, err := json.Marshal(config)
+			if err != nil {
+				return nil, xerrors.Errorf("encode google credentials: %w", err)
+			}
+			configPath := tokenPath + ".json"
+			err = os.WriteFile(configPath, data, 0o600)
+			if err != nil {
+				return nil, xerrors.Errorf("write google credentials: %w", err)
+			}
+			env = append(env, "GOOGLE_APPLICATION_CREDENTIALS="+configPath)
+		case ProviderCredentialsAzure:
+			env = append(env,
+				"ARM_USE_OIDC=true",
+				"ARM_OIDC_TOKEN="+token,
+				"ARM_CLIENT_ID="+c.ClientID,
+				"ARM_TENANT_ID="+c.TenantID,
+			)
+		default:
+			return nil, xerrors.Errorf("unsupported provider credentials type %q", c.Type)
+		}
+		logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf("Using %s provider credentials from %s", c.Type, c.tokenSource()))
+	}
+
+	err = os.WriteFile(filepath.Join(dir, credentialsEnvFile), []byte(strings.Join(env, "\n")), 0o600)
+	if err != nil {
+		return nil, xerrors.Errorf("write credentials env: %w", err)
+	}
+	return env, nil
+}
+
+// brokeredCredentialsEnv returns the environment of the credentials brokered
+// while planning the build.
+func brokeredCredentialsEnv(workdir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(workdir, credentialsDir, credentialsEnvFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read credentials env: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return strings.Split(string(data), "\n"), nil
+}
+
+// removeBrokeredCredentials removes the credentials of the build.
+func removeBrokeredCredentials(workdir string) error {
+	return os.RemoveAll(filepath.Join(workdir, credentialsDir))
+}
+
+// ScrubWorkDirectory removes the secrets of the build from a work directory
+// before it's kept: the brokered credentials, which include the secret
+// variables, the agent tokens, and the state and plan files, which hold
+// sensitive values of resources and variables in plain text. Kept
+// directories outlive the build, so they must be scrubbed whichever stage
+// failed. The plan commands kept in memory for the directory are forgotten
+// too.
+func (s *server) ScrubWorkDirectory(workdir string) error {
+	s.retryPlans.remove(workdir)
+	err := removeBrokeredCredentials(workdir)
+	if err != nil {
+		return xerrors.Errorf("remove brokered credentials: %w", err)
+	}
+	err = removeAgentTokens(workdir)
+	if err != nil {
+		return xerrors.Errorf("remove agent tokens: %w", err)
+	}
+	err = removeStateAndPlans(workdir)
+	if err != nil {
+		return xerrors.Errorf("remove state and plans: %w", err)
+	}
+	return nil
+}
+
+// removeStateAndPlans removes the state and plan files of the build and of
+// all its Terraform workspaces.
+func removeStateAndPlans(workdir string) error {
+	plans, err := filepath.Glob(filepath.Join(workdir, "terraform*.tfplan"))
+	if err != nil {
+		return err
+	}
+	states, err := filepath.Glob(getStateFilePath(workdir) + "*")
+	if err != nil {
+		return err
+	}
+	for _, path := range append(plans, states...) {
+		err := os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
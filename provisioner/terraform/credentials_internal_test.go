@@ -0,0 +1,138 @@
+package terraform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestProviderCredentialsValidate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, ProviderCredentials{Type: ProviderCredentialsGitHub, ExternalAuthID: "github"}.Validate())
+	require.NoError(t, ProviderCredentials{Type: ProviderCredentialsAWS, RoleARN: "arn:aws:iam::123:role/coder"}.Validate())
+	require.ErrorContains(t, ProviderCredentials{Type: ProviderCredentialsGitLab}.Validate(), "missing external auth ID")
+	require.ErrorContains(t, ProviderCredentials{Type: ProviderCredentialsAzure, ClientID: "client"}.Validate(), "missing tenant ID")
+	require.ErrorContains(t, ProviderCredentials{Type: "vault"}.Validate(), "unsupported")
+}
+
+func TestBrokerCredentials(t *testing.T) {
+	t.Parallel()
+
+	workdir := t.TempDir()
+	credentials := []ProviderCredentials{{
+		Type:           ProviderCredentialsGitHub,
+		ExternalAuthID: "github",
+	}, {
+		// The owner didn't link GitLab.
+		Type:           ProviderCredentialsGitLab,
+		ExternalAuthID: "gitlab",
+	}, {
+		Type:    ProviderCredentialsAWS,
+		RoleARN: "arn:aws:iam::123:role/coder",
+	}, {
+		Type:           ProviderCredentialsGoogle,
+		Audience:       "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/coder/providers/oidc",
+		ServiceAccount: "builds@project.iam.gserviceaccount.com",
+	}}
+	metadata := &proto.Metadata{
+		WorkspaceId:                   "workspace-id",
+		WorkspaceOwnerOidcAccessToken: "oidc-token",
+	}
+	externalAuth := []*proto.ExternalAuthProvider{{
+		Id:          "github",
+		AccessToken: "github-token",
+	}}
+
+	logr := &mockLogger{}
+	env, err := brokerCredentials(workdir, credentials, metadata, externalAuth, logr)
+	require.NoError(t, err)
+	vars := map[string]string{}
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		vars[name] = value
+	}
+	require.Equal(t, "github-token", vars["GITHUB_TOKEN"])
+	require.NotContains(t, vars, "GITLAB_TOKEN")
+	require.Equal(t, "arn:aws:iam::123:role/coder", vars["AWS_ROLE_ARN"])
+	require.Equal(t, "coder-build-workspace-id", vars["AWS_ROLE_SESSION_NAME"])
+	token, err := os.ReadFile(vars["AWS_WEB_IDENTITY_TOKEN_FILE"])
+	require.NoError(t, err)
+	require.Equal(t, "oidc-token", string(token))
+
+	data, err := os.ReadFile(vars["GOOGLE_APPLICATION_CREDENTIALS"])
+	require.NoError(t, err)
+	var config struct {
+		Type                           string            `json:"type"`
+		Audience                       string            `json:"audience"`
+		CredentialSource               map[string]string `json:"credential_source"`
+		ServiceAccountImpersonationURL string            `json:"service_account_impersonation_url"`
+	}
+	require.NoError(t, json.Unmarshal(data, &config))
+	require.Equal(t, "external_account", config.Type)
+	require.Equal(t, credentials[3].Audience, config.Audience)
+	require.Contains(t, config.ServiceAccountImpersonationURL, "builds@project.iam.gserviceaccount.com")
+	token, err = os.ReadFile(config.CredentialSource["file"])
+	require.NoError(t, err)
+	require.Equal(t, "oidc-token", string(token))
+
+	var skipped bool
+	for _, log := range logr.logs {
+		if log.Level == proto.LogLevel_WARN {
+			require.Contains(t, log.Output, `external auth provider "gitlab"`)
+			skipped = true
+		}
+		require.NotContains(t, log.Output, "github-token")
+		require.NotContains(t, log.Output, "oidc-token")
+	}
+	require.True(t, skipped)
+
+	// Apply uses the credentials brokered by plan.
+	applyEnv, err := brokeredCredentialsEnv(workdir)
+	require.NoError(t, err)
+	require.Equal(t, env, applyEnv)
+
+	require.NoError(t, removeBrokeredCredentials(workdir))
+	_, err = os.Stat(filepath.Join(workdir, credentialsDir))
+	require.True(t, os.IsNotExist(err))
+	applyEnv, err = brokeredCredentialsEnv(workdir)
+	require.NoError(t, err)
+	require.Empty(t, applyEnv)
+}
+
+func TestScrubWorkDirectory(t *testing.T) {
+	t.Parallel()
+
+	workdir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(workdir, credentialsDir), 0o700))
+	secretFiles := []string{
+		filepath.Join(workdir, credentialsDir, credentialsEnvFile),
+		filepath.Join(workdir, credentialsDir, secretsVarFile),
+		filepath.Join(workdir, agentTokensFileName),
+		getStateFilePath(workdir),
+		getStateFilePath(workdir) + ".backup",
+		getPlanFilePath(workdir),
+		filepath.Join(workdir, "terraform.network.tfplan"),
+		workspaceStateFilePath(workdir, "network"),
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(workspaceStateFilePath(workdir, "network")), 0o700))
+	for _, path := range secretFiles {
+		require.NoError(t, os.WriteFile(path, []byte("secret"), 0o600))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(workdir, "main.tf"), nil, 0o600))
+
+	require.NoError(t, (&server{}).ScrubWorkDirectory(workdir))
+	for _, path := range secretFiles {
+		_, err := os.Stat(path)
+		require.True(t, os.IsNotExist(err), path)
+	}
+	require.FileExists(t, filepath.Join(workdir, "main.tf"))
+	// Directories without secrets are scrubbed too.
+	require.NoError(t, (&server{}).ScrubWorkDirectory(workdir))
+}
@@ -0,0 +1,141 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cdr.dev/slog"
+)
+
+// DataSourceTimeoutError is returned when a Terraform command was killed
+// because reading a data source took longer than the data source timeout.
+type DataSourceTimeoutError struct {
+	Command string
+	Timeout time.Duration
+	// DataSources are the addresses of the data sources that were still
+	// being read for longer than the timeout.
+	DataSources []string
+}
+
+func (e *DataSourceTimeoutError) Error() string {
+	return fmt.Sprintf("terraform %s was killed because reading %s took longer than %s; this is usually caused by "+
+		"an API the data source queries that isn't reachable from the provisioner", e.Command,
+		strings.Join(e.DataSources, ", "), e.Timeout)
+}
+
+// dataSourceReads tracks the data sources Terraform is reading from its
+// JSON log stream, so a single data source waiting on an unreachable API
+// can be told apart from a slow plan. Terraform keeps reporting the
+// progress of the read, so the hang watchdog doesn't catch it.
+//
+// A nil *dataSourceReads doesn't track anything.
+type dataSourceReads struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	started map[string]time.Time
+	// timedOut are the data sources the command was killed for.
+	timedOut []string
+}
+
+// newDataSourceReads returns nil if the timeout is disabled.
+func newDataSourceReads(timeout time.Duration) *dataSourceReads {
+	if timeout <= 0 {
+		return nil
+	}
+	return &dataSourceReads{
+		timeout: timeout,
+		started: map[string]time.Time{},
+	}
+}
+
+// onLog records the reads of data sources reported by the log. Only data
+// sources are read with an apply hook, the refreshes of managed resources
+// have hooks of their own.
+func (r *dataSourceReads) onLog(log *terraformProvisionLog) {
+	if r == nil || log.Hook == nil || log.Hook.Action != "read" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch log.Type {
+	case "apply_start":
+		r.started[log.Hook.Resource.Addr] = time.Now()
+	case "apply_complete", "apply_errored":
+		delete(r.started, log.Hook.Resource.Addr)
+	}
+}
+
+// watch kills cmd once a data source is read for longer than the timeout,
+// like the watchdog kills hung commands. cmd must be started with
+// setProcessGroup. The returned function must be called once the command
+// exited.
+func (r *dataSourceReads) watch(ctx context.Context, logger slog.Logger, cmd *exec.Cmd) (stop func()) {
+	if r == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		interval := r.timeout / 4
+		if interval > time.Second {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			timedOut := r.expired(time.Now())
+			if len(timedOut) == 0 {
+				continue
+			}
+			logger.Warn(ctx, "terraform is reading data sources for too long, killing command",
+				slog.F("args", cmd.Args), slog.F("data_sources", timedOut), slog.F("timeout", r.timeout))
+			killHungCommand(ctx, logger, cmd, done)
+			return
+		}
+	}()
+	return func() { close(done) }
+}
+
+// expired records and returns the data sources read for longer than the
+// timeout at now.
+func (r *dataSourceReads) expired(now time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for addr, started := range r.started {
+		if now.Sub(started) >= r.timeout {
+			r.timedOut = append(r.timedOut, addr)
+		}
+	}
+	sort.Strings(r.timedOut)
+	return r.timedOut
+}
+
+// err returns a DataSourceTimeoutError if the command was killed because of
+// a data source, nil otherwise.
+func (r *dataSourceReads) err(command string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.timedOut) == 0 {
+		return nil
+	}
+	return &DataSourceTimeoutError{
+		Command:     command,
+		Timeout:     r.timeout,
+		DataSources: r.timedOut,
+	}
+}
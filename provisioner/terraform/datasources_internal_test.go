@@ -0,0 +1,53 @@
+package terraform
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+)
+
+func TestDataSourceReads(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("this test uses sleep")
+	}
+
+	read := func(typ, addr string) *terraformProvisionLog {
+		log := &terraformProvisionLog{Type: typ, Hook: &terraformProvisionHook{Action: "read"}}
+		log.Hook.Resource.Addr = addr
+		return log
+	}
+
+	reads := newDataSourceReads(500 * time.Millisecond)
+	reads.onLog(read("apply_start", "data.coder_workspace.me"))
+	reads.onLog(read("apply_complete", "data.coder_workspace.me"))
+	reads.onLog(read("apply_start", "module.corp.data.http.inventory"))
+	// Refreshes of managed resources aren't data sources.
+	reads.onLog(&terraformProvisionLog{Type: "refresh_start", Hook: &terraformProvisionHook{Action: "read"}})
+
+	cmd := exec.Command("sleep", "30")
+	setProcessGroup(cmd)
+	require.NoError(t, cmd.Start())
+	stop := reads.watch(context.Background(), slogtest.Make(t, nil), cmd)
+	start := time.Now()
+	_ = cmd.Wait()
+	stop()
+	require.Less(t, time.Since(start), 10*time.Second)
+
+	var timeoutErr *DataSourceTimeoutError
+	require.ErrorAs(t, reads.err("plan"), &timeoutErr)
+	require.Equal(t, []string{"module.corp.data.http.inventory"}, timeoutErr.DataSources)
+	require.Contains(t, timeoutErr.Error(), "terraform plan was killed because reading module.corp.data.http.inventory took longer than 500ms")
+
+	// Disabled timeouts don't track anything.
+	var disabled *dataSourceReads
+	disabled.onLog(read("apply_start", "data.http.inventory"))
+	disabled.watch(context.Background(), slogtest.Make(t, nil), cmd)()
+	require.NoError(t, disabled.err("plan"))
+}
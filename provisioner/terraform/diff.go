@@ -0,0 +1,166 @@
+package terraform
+
+import (
+	"sort"
+	"strconv"
+
+	"golang.org/x/exp/slices"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// DiffAction is how an item changed between template versions.
+type DiffAction string
+
+const (
+	DiffActionAdded   DiffAction = "added"
+	DiffActionRemoved DiffAction = "removed"
+	DiffActionChanged DiffAction = "changed"
+)
+
+// DiffChange is an item that changed between template versions.
+type DiffChange struct {
+	Action DiffAction `json:"action"`
+	// Key identifies the item: the name of parameters and agents, the slug
+	// of apps prefixed with the name of their agent, e.g. "main/code-server",
+	// and the type and name of resources, e.g. "docker_container.dev".
+	// Resources with multiple instances are suffixed with their position,
+	// e.g. "docker_container.dev#1".
+	Key string `json:"key"`
+	// Fields are the names of the fields that changed, as named by the
+	// provisioner protocol.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// TemplateVersionDiff is the structural difference of the converted plans
+// of two template versions, e.g. to show what's new in a template version.
+// Changes are ordered by key.
+type TemplateVersionDiff struct {
+	Parameters []DiffChange `json:"parameters"`
+	Resources  []DiffChange `json:"resources"`
+	Agents     []DiffChange `json:"agents"`
+	Apps       []DiffChange `json:"apps"`
+}
+
+// Empty reports whether the versions are structurally equal.
+func (d TemplateVersionDiff) Empty() bool {
+	return len(d.Parameters) == 0 && len(d.Resources) == 0 && len(d.Agents) == 0 && len(d.Apps) == 0
+}
+
+// DiffTemplateVersions compares the states converted from the plans of two
+// template versions.
+func DiffTemplateVersions(previous, current *State) TemplateVersionDiff {
+	if previous == nil {
+		previous = &State{}
+	}
+	if current == nil {
+		current = &State{}
+	}
+	return TemplateVersionDiff{
+		Parameters: diffMessages(parametersByKey(previous), parametersByKey(current)),
+		// Agents and apps are compared on their own.
+		Resources: diffMessages(resourcesByKey(previous), resourcesByKey(current), "agents"),
+		// Tokens and IDs are generated for every plan.
+		Agents: diffMessages(agentsByKey(previous), agentsByKey(current), "apps", "id", "token", "instance_id"),
+		Apps:   diffMessages(appsByKey(previous), appsByKey(current)),
+	}
+}
+
+func parametersByKey(state *State) map[string]protoreflect.Message {
+	items := map[string]protoreflect.Message{}
+	for _, parameter := range state.Parameters {
+		items[parameter.Name] = parameter.ProtoReflect()
+	}
+	return items
+}
+
+func resourcesByKey(state *State) map[string]protoreflect.Message {
+	items := map[string]protoreflect.Message{}
+	seen := map[string]int{}
+	for _, resource := range state.Resources {
+		key := resource.Type + "." + resource.Name
+		if n := seen[key]; n > 0 {
+			seen[key]++
+			key += "#" + strconv.Itoa(n)
+		} else {
+			seen[key] = 1
+		}
+		items[key] = resource.ProtoReflect()
+	}
+	return items
+}
+
+func agentsByKey(state *State) map[string]protoreflect.Message {
+	items := map[string]protoreflect.Message{}
+	for _, agent := range stateAgents(state) {
+		items[agent.Name] = agent.ProtoReflect()
+	}
+	return items
+}
+
+func appsByKey(state *State) map[string]protoreflect.Message {
+	items := map[string]protoreflect.Message{}
+	for _, agent := range stateAgents(state) {
+		for _, app := range agent.Apps {
+			items[agent.Name+"/"+app.Slug] = app.ProtoReflect()
+		}
+	}
+	return items
+}
+
+func stateAgents(state *State) []*proto.Agent {
+	var agents []*proto.Agent
+	for _, resource := range state.Resources {
+		agents = append(agents, resource.Agents...)
+	}
+	return agents
+}
+
+// diffMessages compares the messages with the same keys field by field,
+// skipping the ignored fields.
+func diffMessages(previous, current map[string]protoreflect.Message, ignore ...string) []DiffChange {
+	changes := make([]DiffChange, 0)
+	for key, prev := range previous {
+		cur, ok := current[key]
+		if !ok {
+			changes = append(changes, DiffChange{Action: DiffActionRemoved, Key: key})
+			continue
+		}
+		fields := changedFields(prev, cur, ignore)
+		if len(fields) > 0 {
+			changes = append(changes, DiffChange{Action: DiffActionChanged, Key: key, Fields: fields})
+		}
+	}
+	for key := range current {
+		if _, ok := previous[key]; !ok {
+			changes = append(changes, DiffChange{Action: DiffActionAdded, Key: key})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// changedFields returns the names of the fields of the messages that
+// differ, in the order they're declared.
+func changedFields(previous, current protoreflect.Message, ignore []string) []string {
+	var fields []string
+	descriptors := previous.Descriptor().Fields()
+	for i := 0; i < descriptors.Len(); i++ {
+		field := descriptors.Get(i)
+		name := string(field.Name())
+		if slices.Contains(ignore, name) {
+			continue
+		}
+		if oneof := field.ContainingOneof(); oneof != nil && slices.Contains(ignore, string(oneof.Name())) {
+			continue
+		}
+		// Unset fields equal their defaults, like they do on the wire.
+		if !previous.Get(field).Equal(current.Get(field)) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,86 @@
+package terraform_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisioner/terraform"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestDiffTemplateVersions(t *testing.T) {
+	t.Parallel()
+
+	previous := &terraform.State{
+		Parameters: []*proto.RichParameter{
+			{Name: "region", Type: "string", DefaultValue: "us"},
+			{Name: "size", Type: "number", DefaultValue: "10"},
+		},
+		Resources: []*proto.Resource{{
+			Type: "docker_container",
+			Name: "dev",
+			Agents: []*proto.Agent{{
+				Id:   "previous",
+				Name: "main",
+				Auth: &proto.Agent_Token{Token: "previous"},
+				Apps: []*proto.App{
+					{Slug: "code-server", DisplayName: "code-server"},
+					{Slug: "jupyter", DisplayName: "Jupyter"},
+				},
+			}},
+		}, {
+			Type: "docker_volume",
+			Name: "home",
+		}},
+	}
+	current := &terraform.State{
+		Parameters: []*proto.RichParameter{
+			{Name: "region", Type: "string", DefaultValue: "eu", Description: "Region of the workspace."},
+			{Name: "image", Type: "string"},
+		},
+		Resources: []*proto.Resource{{
+			Type: "docker_container",
+			Name: "dev",
+			Icon: "/icon/docker.svg",
+			Agents: []*proto.Agent{{
+				Id:       "current",
+				Name:     "main",
+				Auth:     &proto.Agent_Token{Token: "current"},
+				MotdFile: "/etc/motd",
+				Apps: []*proto.App{
+					{Slug: "code-server", DisplayName: "VS Code"},
+				},
+			}},
+		}, {
+			Type: "docker_volume",
+			Name: "home",
+		}, {
+			Type: "docker_volume",
+			Name: "home",
+		}},
+	}
+
+	diff := terraform.DiffTemplateVersions(previous, current)
+	require.False(t, diff.Empty())
+	require.Equal(t, terraform.TemplateVersionDiff{
+		Parameters: []terraform.DiffChange{
+			{Action: terraform.DiffActionAdded, Key: "image"},
+			{Action: terraform.DiffActionChanged, Key: "region", Fields: []string{"description", "default_value"}},
+			{Action: terraform.DiffActionRemoved, Key: "size"},
+		},
+		Resources: []terraform.DiffChange{
+			{Action: terraform.DiffActionChanged, Key: "docker_container.dev", Fields: []string{"icon"}},
+			{Action: terraform.DiffActionAdded, Key: "docker_volume.home#1"},
+		},
+		Agents: []terraform.DiffChange{
+			{Action: terraform.DiffActionChanged, Key: "main", Fields: []string{"motd_file"}},
+		},
+		Apps: []terraform.DiffChange{
+			{Action: terraform.DiffActionChanged, Key: "main/code-server", Fields: []string{"display_name"}},
+			{Action: terraform.DiffActionRemoved, Key: "main/jupyter"},
+		},
+	}, diff)
+
+	require.True(t, terraform.DiffTemplateVersions(current, current).Empty())
+}
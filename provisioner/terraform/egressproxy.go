@@ -0,0 +1,120 @@
+package terraform
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"cdr.dev/slog"
+)
+
+// egressProxy is an HTTP proxy that only connects to allowed hosts.
+// HTTPS is tunneled with CONNECT, so the proxy never sees the traffic.
+type egressProxy struct {
+	logger    slog.Logger
+	allowlist []string
+	transport *http.Transport
+	dialer    *net.Dialer
+}
+
+func newEgressProxy(logger slog.Logger, allowlist []string) *egressProxy {
+	return &egressProxy{
+		logger:    logger,
+		allowlist: allowlist,
+		transport: &http.Transport{Proxy: nil},
+		dialer:    &net.Dialer{Timeout: 30 * time.Second},
+	}
+}
+
+// allowed reports whether the host matches the allowlist. Entries starting
+// with "*." match any subdomain, but not the domain itself.
+func (p *egressProxy) allowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range p.allowlist {
+		entry = strings.ToLower(entry)
+		if domain, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+			continue
+		}
+		if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *egressProxy) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	host := r.URL.Hostname()
+	if r.Method == http.MethodConnect {
+		host, _, _ = net.SplitHostPort(r.Host)
+	}
+	if !p.allowed(host) {
+		p.logger.Warn(r.Context(), "blocked egress to host not in allowlist", slog.F("host", host))
+		http.Error(rw, "egress to "+host+" is blocked by the provisioner sandbox", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		p.tunnel(rw, r)
+		return
+	}
+	if r.URL.Host == "" {
+		http.Error(rw, "not a proxy request", http.StatusBadRequest)
+		return
+	}
+
+	// Hop-by-hop headers are removed by the transport.
+	r.RequestURI = ""
+	res, err := p.transport.RoundTrip(r)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	for key, values := range res.Header {
+		for _, value := range values {
+			rw.Header().Add(key, value)
+		}
+	}
+	rw.WriteHeader(res.StatusCode)
+	_, _ = io.Copy(rw, res.Body)
+}
+
+func (p *egressProxy) tunnel(rw http.ResponseWriter, r *http.Request) {
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := rw.(http.Hijacker)
+	if !ok {
+		_ = upstream.Close()
+		http.Error(rw, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		return
+	}
+	_, err = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	if err != nil {
+		_ = upstream.Close()
+		_ = conn.Close()
+		return
+	}
+	go func() {
+		defer upstream.Close()
+		defer conn.Close()
+		// Bytes read ahead by the server belong to the tunnel.
+		_, _ = io.Copy(upstream, buf)
+	}()
+	go func() {
+		defer upstream.Close()
+		defer conn.Close()
+		_, _ = io.Copy(conn, upstream)
+	}()
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-version"
 	tfjson "github.com/hashicorp/terraform-json"
@@ -21,6 +23,7 @@ import (
 
 	"cdr.dev/slog"
 	"github.com/coder/coder/v2/coderd/tracing"
+	"github.com/coder/coder/v2/provisionersdk"
 	"github.com/coder/coder/v2/provisionersdk/proto"
 )
 
@@ -32,6 +35,34 @@ type executor struct {
 	// cachePath and workdir must not be used by multiple processes at once.
 	cachePath string
 	workdir   string
+	// resourceTags are the tags passed to the module, planned resources
+	// missing them are reported.
+	resourceTags map[string]string
+	// maxAppSharingLevel limits the sharing level of planned apps.
+	maxAppSharingLevel *proto.AppSharingLevel
+	// appHostname is the wildcard hostname of the deployment the urls of
+	// planned apps are checked against.
+	appHostname *string
+	// varFiles are passed to commands taking variables, after the "-var"
+	// arguments.
+	varFiles []string
+	// workspace is the Terraform workspace commands run in, empty for the
+	// default workspace. See forWorkspace.
+	workspace string
+	// refreshOnly plans with "-refresh-only", so the plan only updates the
+	// state to match the infrastructure and is never applied.
+	refreshOnly bool
+	// restoreSnapshot is the ID of the snapshot the build restores, see
+	// RestoreSnapshotParameterName.
+	restoreSnapshot string
+	// replaceOnFailure taints the resources that failed to update when the
+	// apply fails. Terraform only taints resources that failed to be
+	// created, so the others are kept as is by the next build otherwise.
+	replaceOnFailure bool
+	// replaceResources are tainted before planning, so they're replaced.
+	// They're the resources whose agents were unhealthy in the previous
+	// build.
+	replaceResources []string
 }
 
 func (e *executor) basicEnv() []string {
@@ -43,11 +74,49 @@ func (e *executor) basicEnv() []string {
 	if e.cachePath != "" && runtime.GOOS == "linux" {
 		env = append(env, "TF_PLUGIN_CACHE_DIR="+e.cachePath)
 	}
+	// Overrides any configuration of the provisioner, so providers
+	// can't be installed from registries.
+	if e.server.cliConfigPath != "" {
+		env = append(env, "TF_CLI_CONFIG_FILE="+e.server.cliConfigPath)
+	}
 	return env
 }
 
+// command returns a command executing Terraform in the working directory,
+// in the sandbox if one is configured.
+func (e *executor) command(killCtx context.Context, args, env []string) *exec.Cmd {
+	if e.workspace != "" {
+		env = append(env[:len(env):len(env)], "TF_WORKSPACE="+e.workspace)
+	}
+	if e.server.sandbox != nil {
+		return e.server.sandbox.command(killCtx, e.workdir, e.cachePath, e.binaryPath, args, env)
+	}
+	// #nosec
+	cmd := exec.CommandContext(killCtx, e.binaryPath, args...)
+	cmd.Dir = e.workdir
+	cmd.Env = env
+	return cmd
+}
+
+// start starts a command returned by command.
+func (e *executor) start(cmd *exec.Cmd) error {
+	if e.server.sandbox != nil {
+		return e.server.sandbox.start(cmd)
+	}
+	return cmd.Start()
+}
+
 // execWriteOutput must only be called while the lock is held.
-func (e *executor) execWriteOutput(ctx, killCtx context.Context, args, env []string, stdOutWriter, stdErrWriter io.WriteCloser) (err error) {
+func (e *executor) execWriteOutput(ctx, killCtx context.Context, args, env []string, stdOutWriter, stdErrWriter io.WriteCloser) error {
+	return e.execWatchOutput(ctx, killCtx, args, env, stdOutWriter, stdErrWriter, nil)
+}
+
+// execWatchOutput is execWriteOutput, killing the command once one of the
+// data sources tracked by reads is read for longer than the data source
+// timeout. reads must be fed the JSON log stream written to stdOutWriter.
+//
+// execWatchOutput must only be called while the lock is held.
+func (e *executor) execWatchOutput(ctx, killCtx context.Context, args, env []string, stdOutWriter, stdErrWriter io.WriteCloser, reads *dataSourceReads) (err error) {
 	ctx, span := e.server.startTrace(ctx, fmt.Sprintf("exec - terraform %s", args[0]))
 	defer span.End()
 	span.SetAttributes(attribute.StringSlice("args", args))
@@ -73,14 +142,11 @@ func (e *executor) execWriteOutput(ctx, killCtx context.Context, args, env []str
 		return xerrors.New("environment variables not sanitized, this is a bug within Coder")
 	}
 
-	// #nosec
-	cmd := exec.CommandContext(killCtx, e.binaryPath, args...)
-	cmd.Dir = e.workdir
 	if env == nil {
 		// We don't want to passthrough host env when unset.
 		env = []string{}
 	}
-	cmd.Env = env
+	cmd := e.command(killCtx, args, env)
 
 	// We want logs to be written in the correct order, so we wrap all logging
 	// in a sync.Mutex.
@@ -88,22 +154,62 @@ func (e *executor) execWriteOutput(ctx, killCtx context.Context, args, env []str
 	cmd.Stdout = syncWriter{mut, stdOutWriter}
 	cmd.Stderr = syncWriter{mut, stdErrWriter}
 
+	var wd *watchdog
+	if e.server.hangTimeout > 0 {
+		wd = newWatchdog(e.server.hangTimeout)
+		cmd.Stdout = wd.writer(cmd.Stdout)
+		cmd.Stderr = wd.writer(cmd.Stderr)
+	}
+	if wd != nil || reads != nil {
+		// Hung commands are killed along with their providers.
+		setProcessGroup(cmd)
+	}
+
 	e.server.logger.Debug(ctx, "executing terraform command",
 		slog.F("binary_path", e.binaryPath),
 		slog.F("args", args),
 	)
-	err = cmd.Start()
+	err = e.start(cmd)
 	if err != nil {
 		e.logger.Debug(ctx, "failed to start command", slog.F("args", args))
 		return err
 	}
 	interruptCommandOnCancel(ctx, killCtx, e.logger, cmd)
+	if wd != nil {
+		stop := wd.watch(ctx, e.logger, cmd)
+		defer stop()
+	}
+	stopReads := reads.watch(ctx, e.logger, cmd)
+	defer stopReads()
 
 	err = cmd.Wait()
 	e.logger.Debug(ctx, "command done", slog.F("args", args), slog.Error(err))
+	if wd != nil && wd.hung.Load() {
+		return &HungCommandError{Command: args[0], Timeout: wd.timeout}
+	}
+	if readsErr := reads.err(args[0]); readsErr != nil {
+		return readsErr
+	}
 	return err
 }
 
+// execLogOutput runs a command writing the JSON log stream of Terraform,
+// and sends its output to logr.
+//
+// execLogOutput must only be called while the lock is held.
+func (e *executor) execLogOutput(ctx, killCtx context.Context, args, env []string, logr logSink) error {
+	reads := newDataSourceReads(e.server.dataSourceTimeout)
+	outWriter, doneOut := provisionLogWriter(logr, reads.onLog)
+	errWriter, doneErr := logWriter(logr, proto.LogLevel_ERROR)
+	defer func() {
+		_ = outWriter.Close()
+		_ = errWriter.Close()
+		<-doneOut
+		<-doneErr
+	}()
+	return e.execWatchOutput(ctx, killCtx, args, env, outWriter, errWriter, reads)
+}
+
 // execParseJSON must only be called while the lock is held.
 func (e *executor) execParseJSON(ctx, killCtx context.Context, args, env []string, v interface{}) error {
 	ctx, span := e.server.startTrace(ctx, fmt.Sprintf("exec - terraform %s", args[0]))
@@ -114,10 +220,7 @@ func (e *executor) execParseJSON(ctx, killCtx context.Context, args, env []strin
 		return ctx.Err()
 	}
 
-	// #nosec
-	cmd := exec.CommandContext(killCtx, e.binaryPath, args...)
-	cmd.Dir = e.workdir
-	cmd.Env = env
+	cmd := e.command(killCtx, args, env)
 	out := &bytes.Buffer{}
 	stdErr := &bytes.Buffer{}
 	cmd.Stdout = out
@@ -127,7 +230,7 @@ func (e *executor) execParseJSON(ctx, killCtx context.Context, args, env []strin
 		slog.F("binary_path", e.binaryPath),
 		slog.F("args", args),
 	)
-	err := cmd.Start()
+	err := e.start(cmd)
 	if err != nil {
 		return err
 	}
@@ -215,7 +318,31 @@ func (e *executor) init(ctx, killCtx context.Context, logr logSink) error {
 		"-input=false",
 	}
 
-	return e.execWriteOutput(ctx, killCtx, args, e.basicEnv(), outWriter, errWriter)
+	var stderr *captureWriter
+	if e.server.airGapped.Enabled() {
+		stderr = &captureWriter{WriteCloser: errWriter}
+		errWriter = stderr
+	}
+	err := e.execWriteOutput(ctx, killCtx, args, e.basicEnv(), outWriter, errWriter)
+	if err != nil && stderr != nil {
+		providers := missingProviders(stderr.String())
+		if len(providers) > 0 {
+			return &MissingProvidersError{Providers: providers, Mirrors: e.server.airGapped.mirrors()}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !e.server.providerVerification.enabled() {
+		return nil
+	}
+	// Verify the providers before any command executes them.
+	verified, err := verifyProviders(ctx, e.workdir, e.server.providerVerification, e.server.providerRegistry)
+	if err != nil {
+		return err
+	}
+	logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf("Verified the checksums of %d providers", verified))
+	return nil
 }
 
 func getPlanFilePath(workdir string) string {
@@ -226,52 +353,121 @@ func getStateFilePath(workdir string) string {
 	return filepath.Join(workdir, "terraform.tfstate")
 }
 
+// planFilePath returns the path of the plan file of the workspace of the
+// executor.
+func (e *executor) planFilePath() string {
+	if e.workspace == "" {
+		return getPlanFilePath(e.workdir)
+	}
+	return filepath.Join(e.workdir, "terraform."+e.workspace+".tfplan")
+}
+
+// stateFilePath returns the path of the state file of the workspace of the
+// executor.
+func (e *executor) stateFilePath() string {
+	if e.workspace == "" {
+		return getStateFilePath(e.workdir)
+	}
+	return workspaceStateFilePath(e.workdir, e.workspace)
+}
+
 // revive:disable-next-line:flag-parameter
-func (e *executor) plan(ctx, killCtx context.Context, env, vars []string, logr logSink, destroy bool) (*proto.PlanComplete, error) {
+func (e *executor) plan(ctx, killCtx context.Context, env, vars, targets []string, logr logSink, destroy bool) (*proto.PlanComplete, error) {
 	ctx, span := e.server.startTrace(ctx, tracing.FuncName())
 	defer span.End()
 
 	e.mut.Lock()
 	defer e.mut.Unlock()
 
-	planfilePath := getPlanFilePath(e.workdir)
+	// Avoid showing the plan of the many templates without snapshots.
+	priorState, err := os.ReadFile(e.stateFilePath())
+	if err != nil && !xerrors.Is(err, os.ErrNotExist) {
+		return nil, xerrors.Errorf("read statefile: %w", err)
+	}
+	snapshot := hasSnapshotResources(priorState)
+
+	if len(e.replaceResources) > 0 && !destroy && !e.refreshOnly {
+		err = e.taintResources(ctx, killCtx, env, e.replaceResources,
+			"Replacing the resources whose agents failed to connect or start in the previous build", logr)
+		if err != nil {
+			return nil, xerrors.Errorf("replace unhealthy resources: %w", err)
+		}
+	}
+
+	planfilePath := e.planFilePath()
+	args := e.planArgs(env, vars, targets, destroy)
+	err = e.execLogOutput(ctx, killCtx, args, env, logr)
+	if err != nil {
+		return nil, xerrors.Errorf("terraform plan: %w", err)
+	}
+	state, changes, err := e.planResources(ctx, killCtx, planfilePath, logr, destroy)
+	if err != nil {
+		return nil, err
+	}
+	if e.restoreSnapshot != "" && !destroy {
+		err = e.checkRestoreSnapshot(ctx, killCtx, planfilePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Terraform workspaces after the first are planned again before they're
+	// applied, see applyWorkspaces, builds falling back to alternate
+	// capacity options are planned again with them, and builds planned
+	// again after taking snapshots.
+	if e.server.applyRetry.MaxAttempts > 0 || e.workspace != "" || capacityFallback(e.workdir) || snapshot {
+		e.server.retryPlans.store(e.workdir, e.workspace, &retryPlan{
+			args:               args,
+			env:                env,
+			vars:               vars,
+			destroy:            destroy,
+			resourceTags:       e.resourceTags,
+			maxAppSharingLevel: e.maxAppSharingLevel,
+			appHostname:        e.appHostname,
+			changes:            changes,
+			snapshot:           snapshot && !e.refreshOnly,
+			restoreSnapshot:    e.restoreSnapshot,
+		})
+	}
+	return planComplete(state), nil
+}
+
+// planArgs returns the arguments of the plan command.
+func (e *executor) planArgs(env, vars, targets []string, destroy bool) []string {
 	args := []string{
 		"plan",
 		"-no-color",
 		"-input=false",
 		"-json",
 		"-refresh=true",
-		"-out=" + planfilePath,
+		"-out=" + e.planFilePath(),
 	}
 	if destroy {
 		args = append(args, "-destroy")
 	}
+	if e.refreshOnly {
+		args = append(args, "-refresh-only")
+	}
 	for _, variable := range vars {
 		args = append(args, "-var", variable)
 	}
-
-	outWriter, doneOut := provisionLogWriter(logr)
-	errWriter, doneErr := logWriter(logr, proto.LogLevel_ERROR)
-	defer func() {
-		_ = outWriter.Close()
-		_ = errWriter.Close()
-		<-doneOut
-		<-doneErr
-	}()
-
-	err := e.execWriteOutput(ctx, killCtx, args, env, outWriter, errWriter)
-	if err != nil {
-		return nil, xerrors.Errorf("terraform plan: %w", err)
+	for _, varFile := range e.varFiles {
+		args = append(args, "-var-file="+varFile)
 	}
-	state, err := e.planResources(ctx, killCtx, planfilePath)
-	if err != nil {
-		return nil, err
+	for _, target := range targets {
+		args = append(args, "-target="+target)
 	}
+	return args
+}
+
+func planComplete(state *State) *proto.PlanComplete {
 	return &proto.PlanComplete{
 		Parameters:            state.Parameters,
 		Resources:             state.Resources,
 		ExternalAuthProviders: state.ExternalAuthProviders,
-	}, nil
+		Network:               state.Network,
+		Topology:              convertTopology(state.Topology),
+		AppUrlDiagnostics:     state.AppURLDiagnostics,
+	}
 }
 
 func onlyDataResources(sm tfjson.StateModule) tfjson.StateModule {
@@ -291,19 +487,21 @@ func onlyDataResources(sm tfjson.StateModule) tfjson.StateModule {
 	return filtered
 }
 
-// planResources must only be called while the lock is held.
-func (e *executor) planResources(ctx, killCtx context.Context, planfilePath string) (*State, error) {
+// planResources returns the resources of the plan file and the actions it
+// plans for them, by address. It must only be called while the lock is
+// held.
+func (e *executor) planResources(ctx, killCtx context.Context, planfilePath string, logr logSink, destroy bool) (*State, map[string]string, error) {
 	ctx, span := e.server.startTrace(ctx, tracing.FuncName())
 	defer span.End()
 
 	plan, err := e.showPlan(ctx, killCtx, planfilePath)
 	if err != nil {
-		return nil, xerrors.Errorf("show terraform plan file: %w", err)
+		return nil, nil, xerrors.Errorf("show terraform plan file: %w", err)
 	}
 
 	rawGraph, err := e.graph(ctx, killCtx)
 	if err != nil {
-		return nil, xerrors.Errorf("graph: %w", err)
+		return nil, nil, xerrors.Errorf("graph: %w", err)
 	}
 	modules := []*tfjson.StateModule{}
 	if plan.PriorState != nil {
@@ -319,11 +517,24 @@ func (e *executor) planResources(ctx, killCtx context.Context, planfilePath stri
 	}
 	modules = append(modules, plan.PlannedValues.RootModule)
 
-	state, err := ConvertState(modules, rawGraph)
+	state, err := ConvertStateWithOptions(modules, rawGraph, ConvertOptions{
+		Plan:               true,
+		MaxAppSharingLevel: e.maxAppSharingLevel,
+		AppHostname:        e.appHostname,
+		ResourceChanges:    plan.ResourceChanges,
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return state, nil
+	err = e.server.guardrails.check(plan.ResourceChanges, destroy)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnUntaggedResources(logr, plan.PlannedValues.RootModule, e.resourceTags)
+	for _, diagnostic := range state.AppURLDiagnostics {
+		logr.ProvisionLog(proto.LogLevel_WARN, appURLDiagnosticString(diagnostic))
+	}
+	return state, plannedChanges(plan.ResourceChanges), nil
 }
 
 // showPlan must only be called while the lock is held.
@@ -347,16 +558,14 @@ func (e *executor) graph(ctx, killCtx context.Context) (string, error) {
 	}
 
 	var out strings.Builder
-	cmd := exec.CommandContext(killCtx, e.binaryPath, "graph") // #nosec
+	cmd := e.command(killCtx, []string{"graph"}, e.basicEnv())
 	cmd.Stdout = &out
-	cmd.Dir = e.workdir
-	cmd.Env = e.basicEnv()
 
 	e.server.logger.Debug(ctx, "executing terraform command graph",
 		slog.F("binary_path", e.binaryPath),
 		slog.F("args", "graph"),
 	)
-	err := cmd.Start()
+	err := e.start(cmd)
 	if err != nil {
 		return "", err
 	}
@@ -373,6 +582,7 @@ func (e *executor) apply(
 	ctx, killCtx context.Context,
 	env []string,
 	logr logSink,
+	reportStage func(stage provisionersdk.BuildStage),
 ) (*proto.ApplyComplete, error) {
 	ctx, span := e.server.startTrace(ctx, tracing.FuncName())
 	defer span.End()
@@ -380,47 +590,206 @@ func (e *executor) apply(
 	e.mut.Lock()
 	defer e.mut.Unlock()
 
-	args := []string{
-		"apply",
-		"-no-color",
-		"-auto-approve",
-		"-input=false",
-		"-json",
-		getPlanFilePath(e.workdir),
+	capacityOptions, err := readCapacityFallback(e.workdir)
+	if err != nil {
+		return nil, err
+	}
+	err = e.snapshotBeforeDestructiveChanges(ctx, killCtx, logr)
+	if err != nil {
+		return nil, err
+	}
+	stages := &buildStageTracker{report: reportStage}
+	errored, applyErrs, err := e.applyWithRetries(ctx, killCtx, env, logr, stages)
+	var fallback *proto.CapacityFallback
+	if len(capacityOptions) > 0 {
+		fallback = &proto.CapacityFallback{}
+	}
+	option := 0
+	var attemptErrs []error
+	for ; err != nil && applyErrs.outOfCapacity() && option+1 < len(capacityOptions); option++ {
+		fallback.Attempts = append(fallback.Attempts, &proto.CapacityFallback_Attempt{
+			Option: capacityOptions[option],
+			Error:  applyErrs.capacitySummary,
+		})
+		attemptErrs = append(attemptErrs, xerrors.Errorf("capacity option %q: %w", capacityOptions[option], err))
+		fallbackErr := e.fallBackCapacity(ctx, killCtx, logr, capacityOptions, option+1, applyErrs.capacitySummary)
+		if fallbackErr != nil {
+			logr.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf("Unable to fall back to another capacity option: %s", fallbackErr))
+			break
+		}
+		errored, applyErrs, err = e.applyWithRetries(ctx, killCtx, env, logr, stages)
 	}
-
-	outWriter, doneOut := provisionLogWriter(logr)
-	errWriter, doneErr := logWriter(logr, proto.LogLevel_ERROR)
-	defer func() {
-		_ = outWriter.Close()
-		_ = errWriter.Close()
-		<-doneOut
-		<-doneErr
-	}()
-
-	err := e.execWriteOutput(ctx, killCtx, args, env, outWriter, errWriter)
 	if err != nil {
+		if len(capacityOptions) > 0 && option+1 == len(capacityOptions) && applyErrs.outOfCapacity() {
+			logr.ProvisionLog(proto.LogLevel_ERROR, fmt.Sprintf(
+				"Apply failed with a capacity error with every capacity option: %s", strings.Join(capacityOptions, ", ")))
+			// Every option failed, so the errors of all attempts are
+			// returned rather than the last one.
+			err = errors.Join(append(attemptErrs, xerrors.Errorf("capacity option %q: %w", capacityOptions[option], err))...)
+		}
+		if e.replaceOnFailure {
+			taintErr := e.taintResources(ctx, killCtx, env, errored,
+				"Tainting the resources that failed to update so the next build replaces them", logr)
+			if taintErr != nil {
+				logr.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf("Failed to taint the resources that failed to update: %s", taintErr))
+			}
+		}
 		return nil, xerrors.Errorf("terraform apply: %w", err)
 	}
-	state, err := e.stateResources(ctx, killCtx)
+	// The resources are annotated with the actions of the plan that was
+	// applied last, since retries and capacity fallbacks plan again.
+	var appliedChanges []*tfjson.ResourceChange
+	appliedPlan, err := e.showPlan(ctx, killCtx, e.planFilePath())
+	if err != nil {
+		logr.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf("Unable to read the changes of the applied plan: %s", err))
+	} else {
+		appliedChanges = appliedPlan.ResourceChanges
+	}
+	state, err := e.stateResources(ctx, killCtx, appliedChanges)
 	if err != nil {
 		return nil, err
 	}
-	statefilePath := filepath.Join(e.workdir, "terraform.tfstate")
+	for _, warning := range state.Warnings {
+		logr.ProvisionLog(proto.LogLevel_WARN, warning)
+	}
+	statefilePath := e.stateFilePath()
+	if fallback != nil {
+		fallback.Selected = capacityOptions[option]
+		state.CapacityFallback = fallback
+		if len(fallback.Attempts) > 0 {
+			logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf(
+				"Applied with capacity option %q after %d options ran out of capacity", fallback.Selected, len(fallback.Attempts)))
+		}
+	}
 	stateContent, err := os.ReadFile(statefilePath)
 	if err != nil {
 		return nil, xerrors.Errorf("read statefile %q: %w", statefilePath, err)
 	}
+	for _, resource := range state.Resources {
+		if len(resource.Agents) > 0 {
+			stages.enter(provisionersdk.BuildStageAgentsConnecting)
+			break
+		}
+	}
 	return &proto.ApplyComplete{
 		Parameters:            state.Parameters,
 		Resources:             state.Resources,
 		ExternalAuthProviders: state.ExternalAuthProviders,
+		Network:               state.Network,
+		WorkspaceMetadata:     state.WorkspaceMetadata,
+		CapacityFallback:      state.CapacityFallback,
+		Topology:              convertTopology(state.Topology),
 		State:                 stateContent,
 	}, nil
 }
 
-// stateResources must only be called while the lock is held.
-func (e *executor) stateResources(ctx, killCtx context.Context) (*State, error) {
+// applyWithRetries applies the plan file and retries the apply while it
+// fails with transient errors. It must only be called while the lock is
+// held.
+func (e *executor) applyWithRetries(
+	ctx, killCtx context.Context,
+	env []string,
+	logr logSink,
+	stages *buildStageTracker,
+) ([]string, *applyErrors, error) {
+	errored, applyErrs, err := e.applyPlan(ctx, killCtx, env, logr, stages)
+	for retry := 1; err != nil && applyErrs.retryable() && retry <= e.server.applyRetry.MaxAttempts; retry++ {
+		retryErr := e.waitAndReplan(ctx, killCtx, logr, applyErrs.summary, retry)
+		if retryErr != nil {
+			logr.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf("Unable to retry the apply: %s", retryErr))
+			break
+		}
+		errored, applyErrs, err = e.applyPlan(ctx, killCtx, env, logr, stages)
+	}
+	return errored, applyErrs, err
+}
+
+// applyPlan applies the plan file and returns the resources that failed to
+// update and the errors of the apply. It must only be called while the lock
+// is held.
+func (e *executor) applyPlan(
+	ctx, killCtx context.Context,
+	env []string,
+	logr logSink,
+	stages *buildStageTracker,
+) ([]string, *applyErrors, error) {
+	args := []string{
+		"apply",
+		"-no-color",
+		"-auto-approve",
+		"-input=false",
+		"-json",
+		e.planFilePath(),
+	}
+
+	var errored []string
+	applyErrs := &applyErrors{}
+	// Data sources depending on values only known after apply are read
+	// during the apply.
+	reads := newDataSourceReads(e.server.dataSourceTimeout)
+	outWriter, doneOut := provisionLogWriter(logr, func(log *terraformProvisionLog) {
+		stages.onLog(log)
+		applyErrs.onLog(log)
+		reads.onLog(log)
+		if log.Type == "apply_errored" && log.Hook != nil && log.Hook.Action == "update" {
+			errored = append(errored, log.Hook.Resource.Addr)
+		}
+	})
+	errWriter, doneErr := logWriter(logr, proto.LogLevel_ERROR)
+
+	err := e.execWatchOutput(ctx, killCtx, args, env, outWriter, errWriter, reads)
+	// Wait for the log to be read to know the failed resources.
+	_ = outWriter.Close()
+	_ = errWriter.Close()
+	<-doneOut
+	<-doneErr
+	return errored, applyErrs, err
+}
+
+// waitAndReplan backs off before the retry of a failed apply and plans the
+// build again, since the plan of the failed apply is stale. It must only be
+// called while the lock is held.
+func (e *executor) waitAndReplan(ctx, killCtx context.Context, logr logSink, reason string, retry int) error {
+	plan := e.server.retryPlans.load(e.workdir, e.workspace)
+	if plan == nil {
+		return xerrors.New("the plan of the build wasn't kept")
+	}
+	backoff := e.server.applyRetry.backoff(retry)
+	logr.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf(
+		"Apply failed with a transient error (%s), retrying in %s (attempt %d of %d)",
+		reason, backoff, retry, e.server.applyRetry.MaxAttempts,
+	))
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	_, err := e.planAgain(ctx, killCtx, plan, logr)
+	return err
+}
+
+// planAgain runs the plan command kept by the first plan of the build, and
+// checks the new plan like the first one was, since the resources of a
+// stale plan may change. It returns the actions the new plan plans for the
+// resources, by address. It must only be called while the lock is held.
+func (e *executor) planAgain(ctx, killCtx context.Context, plan *retryPlan, logr logSink) (map[string]string, error) {
+	err := e.execLogOutput(ctx, killCtx, plan.args, plan.env, logr)
+	if err != nil {
+		return nil, xerrors.Errorf("terraform plan: %w", err)
+	}
+	e.resourceTags = plan.resourceTags
+	e.maxAppSharingLevel = plan.maxAppSharingLevel
+	e.appHostname = plan.appHostname
+	_, changes, err := e.planResources(ctx, killCtx, e.planFilePath(), logr, plan.destroy)
+	return changes, err
+}
+
+// stateResources converts the state, annotating the resources with the
+// changes of the plan it was applied from, if any. It must only be called
+// while the lock is held.
+func (e *executor) stateResources(ctx, killCtx context.Context, appliedChanges []*tfjson.ResourceChange) (*State, error) {
 	ctx, span := e.server.startTrace(ctx, tracing.FuncName())
 	defer span.End()
 
@@ -434,15 +803,22 @@ func (e *executor) stateResources(ctx, killCtx context.Context) (*State, error)
 	}
 	converted := &State{}
 	if state.Values == nil {
+		converted.Resources = deletedResources(appliedChanges)
 		return converted, nil
 	}
 
-	converted, err = ConvertState([]*tfjson.StateModule{
+	converted, err = ConvertStateWithOptions([]*tfjson.StateModule{
 		state.Values.RootModule,
-	}, rawGraph)
+	}, rawGraph, ConvertOptions{
+		AppliedChanges: appliedChanges,
+	})
 	if err != nil {
 		return nil, err
 	}
+	converted.WorkspaceMetadata, err = outputMetadata(state.Values.Outputs)
+	if err != nil {
+		return nil, xerrors.Errorf("convert outputs: %w", err)
+	}
 	return converted, nil
 }
 
@@ -529,14 +905,16 @@ func readAndLog(sink logSink, r io.Reader, done chan<- any, level proto.LogLevel
 // provisionLogWriter creates a WriteCloser that will log each JSON formatted terraform log.  The WriteCloser must be
 // closed by the caller to end logging, after which the returned channel will be closed to indicate that logging of the
 // written data has finished.  Failure to close the WriteCloser will leak a goroutine.
-func provisionLogWriter(sink logSink) (io.WriteCloser, <-chan any) {
+func provisionLogWriter(sink logSink, onLog func(log *terraformProvisionLog)) (io.WriteCloser, <-chan any) {
 	r, w := io.Pipe()
 	done := make(chan any)
-	go provisionReadAndLog(sink, r, done)
+	go provisionReadAndLog(sink, r, done, onLog)
 	return w, done
 }
 
-func provisionReadAndLog(sink logSink, r io.Reader, done chan<- any) {
+// provisionReadAndLog sends the JSON log stream of Terraform to sink. If
+// onLog isn't nil, it's called with every log as it's read.
+func provisionReadAndLog(sink logSink, r io.Reader, done chan<- any, onLog func(log *terraformProvisionLog)) {
 	defer close(done)
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
@@ -566,6 +944,9 @@ func provisionReadAndLog(sink logSink, r io.Reader, done chan<- any) {
 			log.Message = scanner.Text()
 		}
 
+		if onLog != nil {
+			onLog(&log)
+		}
 		logLevel := convertTerraformLogLevel(log.Level, sink)
 		sink.ProvisionLog(logLevel, log.Message)
 
@@ -603,6 +984,19 @@ type terraformProvisionLog struct {
 	Message string `json:"@message"`
 
 	Diagnostic *tfjson.Diagnostic `json:"diagnostic,omitempty"`
+
+	// Type and Hook describe progress of resource operations, e.g. an
+	// "apply_errored" message with the failed resource.
+	Type string                  `json:"type,omitempty"`
+	Hook *terraformProvisionHook `json:"hook,omitempty"`
+}
+
+type terraformProvisionHook struct {
+	Resource struct {
+		Addr         string `json:"addr"`
+		ResourceType string `json:"resource_type"`
+	} `json:"resource"`
+	Action string `json:"action"`
 }
 
 // syncWriter wraps an io.Writer in a sync.Mutex.
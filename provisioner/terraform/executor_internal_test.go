@@ -173,3 +173,16 @@ func TestOnlyDataResources(t *testing.T) {
 		})
 	}
 }
+
+func TestPlanArgs_RefreshOnly(t *testing.T) {
+	t.Parallel()
+
+	e := &executor{server: &server{}, workdir: t.TempDir()}
+	args := e.planArgs(nil, []string{"region=eu"}, nil, false)
+	require.NotContains(t, args, "-refresh-only")
+
+	e.refreshOnly = true
+	args = e.planArgs(nil, []string{"region=eu"}, nil, false)
+	require.Contains(t, args, "-refresh-only")
+	require.Contains(t, args, "region=eu")
+}
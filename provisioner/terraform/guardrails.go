@@ -0,0 +1,99 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/codersdk"
+)
+
+// Guardrails limit the blast radius of workspace builds, e.g. of template
+// bugs that would delete dozens of resources. Resources of the Coder
+// provider aren't counted, since they don't exist outside of Coder. Zero
+// values are unlimited.
+type Guardrails struct {
+	// MaxResources limits the resources of a workspace once the build
+	// completes.
+	MaxResources int
+	// MaxDestroys limits the resources a build deletes or replaces. Deleting
+	// the workspace isn't limited.
+	MaxDestroys int
+}
+
+// GuardrailExceededError is returned when a plan exceeds a guardrail. The
+// build fails before anything was applied.
+type GuardrailExceededError struct {
+	// Guardrail is "max_resources" or "max_destroys".
+	Guardrail string
+	Limit     int
+	// Addresses are the addresses of the counted resources.
+	Addresses []string
+}
+
+// maxGuardrailAddresses bounds the addresses listed in the error message.
+const maxGuardrailAddresses = 10
+
+func (e *GuardrailExceededError) Error() string {
+	verb := "has"
+	if e.Guardrail == "max_destroys" {
+		verb = "deletes or replaces"
+	}
+	addresses := e.Addresses
+	more := ""
+	if len(addresses) > maxGuardrailAddresses {
+		more = fmt.Sprintf(" and %d more", len(addresses)-maxGuardrailAddresses)
+		addresses = addresses[:maxGuardrailAddresses]
+	}
+	return fmt.Sprintf("guardrail %s exceeded: the plan %s %d resources, the limit is %d: %s%s",
+		e.Guardrail, verb, len(e.Addresses), e.Limit, strings.Join(addresses, ", "), more)
+}
+
+// planErrorCode returns the job error code of a failed plan, so coderd can
+// tell guardrail failures apart from other plan errors.
+func planErrorCode(err error) string {
+	var guardrailErr *GuardrailExceededError
+	if xerrors.As(err, &guardrailErr) {
+		return string(codersdk.GuardrailExceeded)
+	}
+	return ""
+}
+
+// check returns a *GuardrailExceededError if the resource changes of the
+// plan exceed the guardrails.
+func (g Guardrails) check(changes []*tfjson.ResourceChange, destroy bool) error {
+	if destroy {
+		return nil
+	}
+	var remaining, destroyed []string
+	for _, change := range changes {
+		if change == nil || change.Change == nil || change.Mode != tfjson.ManagedResourceMode || isCoderProvider(change.ProviderName) {
+			continue
+		}
+		actions := change.Change.Actions
+		if actions.Delete() || actions.Replace() {
+			destroyed = append(destroyed, change.Address)
+		}
+		if !actions.Delete() {
+			remaining = append(remaining, change.Address)
+		}
+	}
+	if g.MaxDestroys > 0 && len(destroyed) > g.MaxDestroys {
+		sort.Strings(destroyed)
+		return &GuardrailExceededError{Guardrail: "max_destroys", Limit: g.MaxDestroys, Addresses: destroyed}
+	}
+	if g.MaxResources > 0 && len(remaining) > g.MaxResources {
+		sort.Strings(remaining)
+		return &GuardrailExceededError{Guardrail: "max_resources", Limit: g.MaxResources, Addresses: remaining}
+	}
+	return nil
+}
+
+// isCoderProvider reports whether the provider is the Coder provider, e.g.
+// "registry.terraform.io/coder/coder".
+func isCoderProvider(name string) bool {
+	return name == "coder" || strings.HasSuffix(name, "/coder/coder")
+}
@@ -0,0 +1,96 @@
+package terraform
+
+import (
+	"fmt"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/codersdk"
+)
+
+func resourceChange(address, provider string, actions ...tfjson.Action) *tfjson.ResourceChange {
+	return &tfjson.ResourceChange{
+		Address:      address,
+		Mode:         tfjson.ManagedResourceMode,
+		ProviderName: provider,
+		Change:       &tfjson.Change{Actions: actions},
+	}
+}
+
+func TestGuardrails(t *testing.T) {
+	t.Parallel()
+
+	const docker = "registry.terraform.io/kreuzwerker/docker"
+	const coder = "registry.terraform.io/coder/coder"
+	changes := []*tfjson.ResourceChange{
+		resourceChange("docker_volume.home", docker, tfjson.ActionDelete),
+		resourceChange("docker_container.workspace", docker, tfjson.ActionDelete, tfjson.ActionCreate),
+		resourceChange("docker_image.main", docker, tfjson.ActionNoop),
+		resourceChange("docker_network.main", docker, tfjson.ActionCreate),
+		// Resources of the Coder provider aren't counted.
+		resourceChange("coder_agent.main", coder, tfjson.ActionDelete),
+		resourceChange("coder_app.code", coder, tfjson.ActionCreate),
+		{
+			Address: "data.coder_workspace.me",
+			Mode:    tfjson.DataResourceMode,
+			Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionRead}},
+		},
+	}
+
+	t.Run("Unlimited", func(t *testing.T) {
+		t.Parallel()
+		require.NoError(t, Guardrails{}.check(changes, false))
+	})
+
+	t.Run("Within", func(t *testing.T) {
+		t.Parallel()
+		require.NoError(t, Guardrails{MaxResources: 3, MaxDestroys: 2}.check(changes, false))
+	})
+
+	t.Run("MaxDestroys", func(t *testing.T) {
+		t.Parallel()
+		err := Guardrails{MaxDestroys: 1}.check(changes, false)
+		var guardrailErr *GuardrailExceededError
+		require.ErrorAs(t, err, &guardrailErr)
+		require.Equal(t, "max_destroys", guardrailErr.Guardrail)
+		require.Equal(t, []string{"docker_container.workspace", "docker_volume.home"}, guardrailErr.Addresses)
+		require.EqualError(t, err, "guardrail max_destroys exceeded: the plan deletes or replaces 2 resources, the limit is 1: docker_container.workspace, docker_volume.home")
+	})
+
+	t.Run("MaxResources", func(t *testing.T) {
+		t.Parallel()
+		err := Guardrails{MaxResources: 2}.check(changes, false)
+		var guardrailErr *GuardrailExceededError
+		require.ErrorAs(t, err, &guardrailErr)
+		require.Equal(t, "max_resources", guardrailErr.Guardrail)
+		require.Equal(t, []string{"docker_container.workspace", "docker_image.main", "docker_network.main"}, guardrailErr.Addresses)
+	})
+
+	t.Run("Destroy", func(t *testing.T) {
+		t.Parallel()
+		// Deleting the workspace deletes all of its resources.
+		require.NoError(t, Guardrails{MaxResources: 1, MaxDestroys: 1}.check(changes, true))
+	})
+
+	t.Run("ManyAddresses", func(t *testing.T) {
+		t.Parallel()
+		var many []*tfjson.ResourceChange
+		for i := 0; i < 15; i++ {
+			many = append(many, resourceChange(fmt.Sprintf("docker_volume.v%02d", i), docker, tfjson.ActionDelete))
+		}
+		err := Guardrails{MaxDestroys: 5}.check(many, false)
+		require.ErrorContains(t, err, "docker_volume.v09 and 5 more")
+	})
+
+	t.Run("ErrorCode", func(t *testing.T) {
+		t.Parallel()
+		err := Guardrails{MaxDestroys: 1}.check(changes, false)
+		// Errors of terraform workspaces are wrapped.
+		err = xerrors.Errorf("terraform workspace %q: %w", "network", err)
+		require.Equal(t, string(codersdk.GuardrailExceeded), planErrorCode(err))
+		require.Empty(t, planErrorCode(xerrors.New("plan failed")))
+	})
+}
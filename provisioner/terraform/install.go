@@ -56,7 +56,7 @@ func Install(ctx context.Context, log slog.Logger, dir string, wantVersion *vers
 	installer := &releases.ExactVersion{
 		InstallDir: dir,
 		Product:    product.Terraform,
-		Version:    TerraformVersion,
+		Version:    wantVersion,
 	}
 	installer.SetLogger(slog.Stdlib(ctx, log, slog.LevelDebug))
 	log.Debug(
@@ -64,7 +64,7 @@ func Install(ctx context.Context, log slog.Logger, dir string, wantVersion *vers
 		"installing terraform",
 		slog.F("prev_version", hasVersion),
 		slog.F("dir", dir),
-		slog.F("version", TerraformVersion),
+		slog.F("version", wantVersion),
 	)
 
 	path, err := installer.Install(ctx)
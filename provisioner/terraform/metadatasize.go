@@ -0,0 +1,204 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMaxMetadataValueSize is the largest value of a metadata item
+	// of a resource, in characters, if the options don't set a limit. It's
+	// the size of the database column storing the value.
+	DefaultMaxMetadataValueSize = 65536
+	// DefaultMaxMetadataTotalSize is the largest total size of the metadata
+	// of all resources and agents, in characters, if the options don't set
+	// a limit.
+	DefaultMaxMetadataTotalSize = 1 << 20
+)
+
+// The sizes of the database columns storing metadata, in characters. Each
+// field is checked against the column it's stored in.
+const (
+	maxResourceMetadataKeySize = 1024
+	maxAgentMetadataKeySize    = 127
+	maxAgentMetadataNameSize   = 127
+	maxAgentMetadataScriptSize = 65535
+)
+
+// maxMetadataSizeErrorKeys bounds the largest items listed when the total
+// size is exceeded.
+const maxMetadataSizeErrorKeys = 5
+
+// maxMetadataSizeWarnings bounds the warnings about truncated metadata of an
+// applied state.
+const maxMetadataSizeWarnings = 10
+
+// MetadataSizeError is returned by ConvertState when the metadata of
+// resources or agents of a plan exceeds the size limits.
+type MetadataSizeError struct {
+	// Total is true if the total size of the metadata exceeds the limit,
+	// false if a field of a single item does.
+	Total bool
+	// Field is the field of the item exceeding its limit, e.g. "value" or
+	// "script". It's empty if Total is set.
+	Field string
+	Size  int
+	Limit int
+	// Keys identify the offending items as `<address>["<key>"]`: the item
+	// exceeding the field limit, or the largest items if the total limit is
+	// exceeded.
+	Keys []string
+}
+
+func (e *MetadataSizeError) Error() string {
+	if !e.Total {
+		return fmt.Sprintf("metadata %s %s is %d characters, larger than the limit of %d characters",
+			strings.Join(e.Keys, ", "), e.Field, e.Size, e.Limit)
+	}
+	return fmt.Sprintf("metadata is %d characters in total, larger than the limit of %d characters; the largest items are %s",
+		e.Size, e.Limit, strings.Join(e.Keys, ", "))
+}
+
+// metadataSizes enforces the size limits of metadata while it's converted.
+// Plans fail when a limit is exceeded. The resources of an applied state
+// exist, so their metadata is truncated to fit and a warning is recorded
+// instead.
+type metadataSizes struct {
+	plan     bool
+	maxValue int
+	maxTotal int
+	total    int
+	items    []metadataItemSize
+	warnings []string
+}
+
+type metadataItemSize struct {
+	key  string
+	size int
+}
+
+func newMetadataSizes(opts ConvertOptions) *metadataSizes {
+	m := &metadataSizes{
+		plan:     opts.Plan,
+		maxValue: opts.MaxMetadataValueSize,
+		maxTotal: opts.MaxMetadataTotalSize,
+	}
+	if m.maxValue <= 0 {
+		m.maxValue = DefaultMaxMetadataValueSize
+	}
+	if m.maxTotal <= 0 {
+		m.maxTotal = DefaultMaxMetadataTotalSize
+	}
+	return m
+}
+
+// addResource records a metadata item of the resource at address, checking
+// the key and value against their columns. The fields may be truncated.
+func (m *metadataSizes) addResource(address string, key, value *string) error {
+	name := metadataItemKey(address, *key)
+	err := m.field(name, "key", key, maxResourceMetadataKeySize)
+	if err != nil {
+		return err
+	}
+	err = m.field(name, "value", value, m.maxValue)
+	if err != nil {
+		return err
+	}
+	m.record(name, *key, *value)
+	return nil
+}
+
+// addAgent records a metadata item of the agent at address, checking the
+// key, display name and script against their columns. The fields may be
+// truncated.
+func (m *metadataSizes) addAgent(address string, key, displayName, script *string) error {
+	name := metadataItemKey(address, *key)
+	err := m.field(name, "key", key, maxAgentMetadataKeySize)
+	if err != nil {
+		return err
+	}
+	err = m.field(name, "display_name", displayName, maxAgentMetadataNameSize)
+	if err != nil {
+		return err
+	}
+	err = m.field(name, "script", script, min(m.maxValue, maxAgentMetadataScriptSize))
+	if err != nil {
+		return err
+	}
+	m.record(name, *key, *displayName, *script)
+	return nil
+}
+
+// field checks the field of the item against the limit. Plans fail, applied
+// values are truncated.
+func (m *metadataSizes) field(name, field string, value *string, limit int) error {
+	size := utf8.RuneCountInString(*value)
+	if size <= limit {
+		return nil
+	}
+	if m.plan {
+		return &MetadataSizeError{Field: field, Size: size, Limit: limit, Keys: []string{name}}
+	}
+	*value = truncateRunes(*value, limit)
+	m.warn(fmt.Sprintf("Metadata %s %s is %d characters, it was truncated to the limit of %d characters.", name, field, size, limit))
+	return nil
+}
+
+func (m *metadataSizes) record(name string, fields ...string) {
+	item := metadataItemSize{key: name}
+	for _, field := range fields {
+		item.size += utf8.RuneCountInString(field)
+	}
+	m.total += item.size
+	m.items = append(m.items, item)
+}
+
+func (m *metadataSizes) warn(warning string) {
+	if len(m.warnings) == maxMetadataSizeWarnings {
+		return
+	}
+	m.warnings = append(m.warnings, warning)
+}
+
+// check returns an error if the recorded items of a plan exceed the total
+// limit. An applied state only records a warning.
+func (m *metadataSizes) check() error {
+	if m.total <= m.maxTotal {
+		return nil
+	}
+	sort.SliceStable(m.items, func(i, j int) bool {
+		return m.items[i].size > m.items[j].size
+	})
+	keys := make([]string, 0, maxMetadataSizeErrorKeys)
+	for _, item := range m.items {
+		if len(keys) == maxMetadataSizeErrorKeys {
+			break
+		}
+		keys = append(keys, item.key)
+	}
+	err := &MetadataSizeError{Total: true, Size: m.total, Limit: m.maxTotal, Keys: keys}
+	if m.plan {
+		return err
+	}
+	m.warn(err.Error())
+	return nil
+}
+
+func metadataItemKey(address, key string) string {
+	return fmt.Sprintf("%s[%q]", address, key)
+}
+
+// truncateRunes truncates s to at most n characters without splitting a
+// multi-byte character.
+func truncateRunes(s string, n int) string {
+	i := 0
+	for offset := range s {
+		if i == n {
+			return s[:offset]
+		}
+		i++
+	}
+	return s
+}
@@ -0,0 +1,139 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// MutateStage is the operation whose results are mutated.
+type MutateStage string
+
+const (
+	MutateStagePlan  MutateStage = "plan"
+	MutateStageApply MutateStage = "apply"
+)
+
+// MutateRequest holds the resources and parameters converted from Terraform.
+// Mutators change them in place, or replace the slices, e.g. to remove
+// resources.
+type MutateRequest struct {
+	Stage MutateStage
+	// Metadata describes the workspace and template being built. It must not
+	// be changed.
+	Metadata   *proto.Metadata
+	Resources  []*proto.Resource
+	Parameters []*proto.RichParameter
+}
+
+// Mutator changes the resources and parameters of a plan or apply before
+// they're returned to provisionerd, e.g. to add metadata every workspace of
+// an organization must have, or to remove apps a deployment disallows.
+//
+// Mutators are compiled into the provisioner and registered with
+// RegisterMutator, usually from the init function of their package.
+type Mutator interface {
+	Mutate(ctx context.Context, req *MutateRequest) error
+}
+
+// MutatorFunc is a Mutator implemented by a function.
+type MutatorFunc func(ctx context.Context, req *MutateRequest) error
+
+func (f MutatorFunc) Mutate(ctx context.Context, req *MutateRequest) error {
+	return f(ctx, req)
+}
+
+type registeredMutator struct {
+	name    string
+	order   int
+	mutator Mutator
+}
+
+// mutatorRegistry holds the mutators run by the provisioner.
+type mutatorRegistry struct {
+	mu       sync.Mutex
+	mutators []registeredMutator
+}
+
+var mutators mutatorRegistry
+
+// RegisterMutator registers a mutator under a unique name. Mutators run in
+// ascending order, and mutators of the same order by name, so the order
+// doesn't depend on the order packages are initialized in. Each mutator sees
+// the changes of the ones before it.
+//
+// A mutator returning an error, or panicking, fails the job and the
+// mutators after it don't run. The state of a failed apply is kept, so the
+// resources it created can still be destroyed.
+//
+// RegisterMutator panics if the name is already registered.
+func RegisterMutator(name string, order int, m Mutator) {
+	mutators.register(name, order, m)
+}
+
+func (r *mutatorRegistry) register(name string, order int, m Mutator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m == nil {
+		panic(fmt.Sprintf("terraform: mutator %q is nil", name))
+	}
+	for _, registered := range r.mutators {
+		if registered.name == name {
+			panic(fmt.Sprintf("terraform: mutator %q registered twice", name))
+		}
+	}
+	r.mutators = append(r.mutators, registeredMutator{name: name, order: order, mutator: m})
+	sort.SliceStable(r.mutators, func(i, j int) bool {
+		if r.mutators[i].order != r.mutators[j].order {
+			return r.mutators[i].order < r.mutators[j].order
+		}
+		return r.mutators[i].name < r.mutators[j].name
+	})
+}
+
+// run runs the mutators on req in order, stopping at the first error.
+func (r *mutatorRegistry) run(ctx context.Context, req *MutateRequest) error {
+	r.mu.Lock()
+	registered := append([]registeredMutator(nil), r.mutators...)
+	r.mu.Unlock()
+
+	for _, m := range registered {
+		err := runMutator(ctx, m.mutator, req)
+		if err != nil {
+			return xerrors.Errorf("mutator %q: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+func runMutator(ctx context.Context, m Mutator, req *MutateRequest) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = xerrors.Errorf("panic: %v", r)
+		}
+	}()
+	return m.Mutate(ctx, req)
+}
+
+// mutate runs the registered mutators on the resources and parameters of a
+// plan or apply.
+func mutate(ctx context.Context, stage MutateStage, metadata *proto.Metadata, resources *[]*proto.Resource, parameters *[]*proto.RichParameter) error {
+	req := &MutateRequest{
+		Stage:      stage,
+		Metadata:   metadata,
+		Resources:  *resources,
+		Parameters: *parameters,
+	}
+	err := mutators.run(ctx, req)
+	if err != nil {
+		return err
+	}
+	*resources = req.Resources
+	*parameters = req.Parameters
+	return nil
+}
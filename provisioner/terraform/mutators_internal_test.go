@@ -0,0 +1,72 @@
+package terraform
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestMutatorRegistry(t *testing.T) {
+	t.Parallel()
+
+	appendName := func(name string) Mutator {
+		return MutatorFunc(func(_ context.Context, req *MutateRequest) error {
+			req.Resources = append(req.Resources, &proto.Resource{Name: name})
+			return nil
+		})
+	}
+	names := func(resources []*proto.Resource) []string {
+		names := make([]string, 0, len(resources))
+		for _, resource := range resources {
+			names = append(names, resource.Name)
+		}
+		return names
+	}
+
+	t.Run("Order", func(t *testing.T) {
+		t.Parallel()
+		var r mutatorRegistry
+		r.register("c", 0, appendName("c"))
+		r.register("b", 10, appendName("b"))
+		r.register("a", 0, appendName("a"))
+		req := &MutateRequest{Stage: MutateStagePlan}
+		require.NoError(t, r.run(context.Background(), req))
+		require.Equal(t, []string{"a", "c", "b"}, names(req.Resources))
+	})
+
+	t.Run("ErrorStops", func(t *testing.T) {
+		t.Parallel()
+		var r mutatorRegistry
+		r.register("first", 0, MutatorFunc(func(context.Context, *MutateRequest) error {
+			return xerrors.New("disallowed app")
+		}))
+		r.register("second", 1, appendName("second"))
+		req := &MutateRequest{Stage: MutateStageApply}
+		err := r.run(context.Background(), req)
+		require.ErrorContains(t, err, `mutator "first": disallowed app`)
+		require.Empty(t, req.Resources)
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		t.Parallel()
+		var r mutatorRegistry
+		r.register("panics", 0, MutatorFunc(func(context.Context, *MutateRequest) error {
+			panic("oops")
+		}))
+		err := r.run(context.Background(), &MutateRequest{})
+		require.ErrorContains(t, err, `mutator "panics": panic: oops`)
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		t.Parallel()
+		var r mutatorRegistry
+		r.register("a", 0, appendName("a"))
+		require.Panics(t, func() {
+			r.register("a", 1, appendName("a"))
+		})
+	})
+}
@@ -0,0 +1,46 @@
+package terraform
+
+import (
+	"encoding/json"
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// outputMetadata converts the outputs of the template into workspace
+// metadata, ordered by name. String outputs are used as is, other values are
+// encoded as JSON. The values of sensitive outputs are never sent to coderd.
+func outputMetadata(outputs map[string]*tfjson.StateOutput) ([]*proto.Resource_Metadata, error) {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metadata := make([]*proto.Resource_Metadata, 0, len(names))
+	for _, name := range names {
+		output := outputs[name]
+		item := &proto.Resource_Metadata{Key: name}
+		switch {
+		case output == nil || output.Value == nil:
+			item.IsNull = true
+		case output.Sensitive:
+			item.Sensitive = true
+		default:
+			if value, ok := output.Value.(string); ok {
+				item.Value = value
+				break
+			}
+			value, err := json.Marshal(output.Value)
+			if err != nil {
+				return nil, xerrors.Errorf("encode output %q: %w", name, err)
+			}
+			item.Value = string(value)
+		}
+		metadata = append(metadata, item)
+	}
+	return metadata, nil
+}
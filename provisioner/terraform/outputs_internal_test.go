@@ -0,0 +1,43 @@
+package terraform
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestOutputMetadata(t *testing.T) {
+	t.Parallel()
+
+	metadata, err := outputMetadata(map[string]*tfjson.StateOutput{
+		"url":      {Value: "https://example.com"},
+		"ports":    {Value: []any{float64(80), float64(443)}},
+		"password": {Value: "hunter2", Sensitive: true},
+		"missing":  {Value: nil},
+	})
+	require.NoError(t, err)
+	require.Len(t, metadata, 4)
+	for i, want := range []*proto.Resource_Metadata{
+		{Key: "missing", IsNull: true},
+		{Key: "password", Sensitive: true},
+		{Key: "ports", Value: "[80,443]"},
+		{Key: "url", Value: "https://example.com"},
+	} {
+		require.Equal(t, want.Key, metadata[i].Key)
+		require.Equal(t, want.Value, metadata[i].Value, want.Key)
+		require.Equal(t, want.Sensitive, metadata[i].Sensitive, want.Key)
+		require.Equal(t, want.IsNull, metadata[i].IsNull, want.Key)
+	}
+
+	// Outputs derived from secret variables are redacted too.
+	metadata, err = outputMetadata(map[string]*tfjson.StateOutput{
+		"dsn": {Value: "postgres://coder:hunter2@db"},
+	})
+	require.NoError(t, err)
+	redactSecretMetadataItems(metadata, secretVariables{"db_password": "hunter2"})
+	require.True(t, metadata[0].Sensitive)
+	require.Equal(t, "postgres://coder:(sensitive value)@db", metadata[0].Value)
+}
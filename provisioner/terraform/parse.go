@@ -16,11 +16,13 @@ import (
 	"github.com/coder/coder/v2/provisionersdk/proto"
 )
 
-// Parse extracts Terraform variables from source-code.
+// Parse extracts Terraform variables and the template metadata from
+// source-code.
 func (s *server) Parse(sess *provisionersdk.Session, _ *proto.ParseRequest, _ <-chan struct{}) *proto.ParseComplete {
 	ctx := sess.Context()
 	_, span := s.startTrace(ctx, tracing.FuncName())
 	defer span.End()
+	defer s.prewarm.begin()()
 
 	// Load the module and print any parse errors.
 	module, diags := tfconfig.LoadModule(sess.WorkDirectory)
@@ -31,6 +33,11 @@ func (s *server) Parse(sess *provisionersdk.Session, _ *proto.ParseRequest, _ <-
 	// Sort variables by (filename, line) to make the ordering consistent
 	variables := make([]*tfconfig.Variable, 0, len(module.Variables))
 	for _, v := range module.Variables {
+		if isAgentTokenVariable(v.Name) || v.Name == ResourceTagsVariable {
+			// Agent tokens and resource tags are injected by the
+			// provisioner.
+			continue
+		}
 		variables = append(variables, v)
 	}
 	sort.Slice(variables, func(i, j int) bool {
@@ -46,8 +53,14 @@ func (s *server) Parse(sess *provisionersdk.Session, _ *proto.ParseRequest, _ <-
 		}
 		templateVariables = append(templateVariables, mv)
 	}
+
+	templateMetadata, err := parseTemplateMetadata(sess.WorkDirectory)
+	if err != nil {
+		return provisionersdk.ParseErrorf("can't read the template metadata: %s", err)
+	}
 	return &proto.ParseComplete{
 		TemplateVariables: templateVariables,
+		TemplateMetadata:  templateMetadata,
 	}
 }
 
@@ -0,0 +1,247 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// RetryFailedResourcesParameter is the rich parameter that requests a build
+// to only retry the resources that failed in the previous apply. Templates
+// opt in by declaring it as an ephemeral bool parameter, which makes it a
+// build option:
+//
+//	data "coder_parameter" "coder_retry_failed_resources" {
+//	  type      = "bool"
+//	  default   = false
+//	  mutable   = true
+//	  ephemeral = true
+//	}
+//
+// The plan of such a build targets the failed resources with `-target`, so
+// resources that were created successfully aren't refreshed or changed.
+// Resources missing from the state, e.g. because creating them failed before
+// Terraform recorded them, are targeted too, and so are the resources that
+// depend on targeted resources, since `-target` only includes dependencies.
+const RetryFailedResourcesParameter = "coder_retry_failed_resources"
+
+// rawState is the subset of the Terraform state file format needed to find
+// failed resources. `terraform show` doesn't expose the status of instances.
+type rawState struct {
+	Resources []rawResource `json:"resources"`
+}
+
+type rawResource struct {
+	Module    string `json:"module"`
+	Mode      string `json:"mode"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Instances []struct {
+		IndexKey any    `json:"index_key"`
+		Status   string `json:"status"`
+	} `json:"instances"`
+}
+
+// address returns the address of the resource without instance keys, e.g.
+// `module.vm.aws_instance.dev`, like the labels of the resources in the
+// output of "terraform graph".
+func (r rawResource) address() string {
+	return moduleInstanceKey.ReplaceAllString(r.instanceAddress(nil), "")
+}
+
+// moduleInstanceKey matches the instance keys of modules in addresses, e.g.
+// `["east"]` of `module.vm["east"]`.
+var moduleInstanceKey = regexp.MustCompile(`\[[^\]]*\]`)
+
+// instanceAddress returns the address of the instance of the resource with
+// the index key, e.g. `module.vm.aws_instance.dev["east"]`.
+func (r rawResource) instanceAddress(indexKey any) string {
+	address := r.Type + "." + r.Name
+	if r.Mode == "data" {
+		address = "data." + address
+	}
+	if r.Module != "" {
+		address = r.Module + "." + address
+	}
+	switch key := indexKey.(type) {
+	case string:
+		return fmt.Sprintf("%s[%s]", address, strconv.Quote(key))
+	case float64:
+		return fmt.Sprintf("%s[%d]", address, int(key))
+	default:
+		return address
+	}
+}
+
+// failedResources returns the addresses of the resource instances that
+// Terraform marked as tainted in the state, which happens when creating them
+// failed during apply.
+func failedResources(state []byte) ([]string, error) {
+	parsed, err := parseRawState(state)
+	if err != nil {
+		return nil, err
+	}
+	failed := make([]string, 0)
+	for _, resource := range parsed.Resources {
+		for _, instance := range resource.Instances {
+			if instance.Status != "tainted" {
+				continue
+			}
+			failed = append(failed, resource.instanceAddress(instance.IndexKey))
+		}
+	}
+	sort.Strings(failed)
+	return failed, nil
+}
+
+// parseRawState parses a state file, which is empty if nothing was applied
+// yet.
+func parseRawState(state []byte) (rawState, error) {
+	var parsed rawState
+	if len(state) == 0 {
+		return parsed, nil
+	}
+	err := json.Unmarshal(state, &parsed)
+	if err != nil {
+		return rawState{}, xerrors.Errorf("parse state: %w", err)
+	}
+	return parsed, nil
+}
+
+// retryTargets returns the addresses to target to retry the failed
+// resources of the state: the failed resource instances, the resources of
+// the graph missing from the state, and the resources depending on either.
+func retryTargets(state []byte, rawGraph string) ([]string, error) {
+	parsed, err := parseRawState(state)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := parseGraph(rawGraph)
+	if err != nil {
+		return nil, err
+	}
+	nodes := graphNodesByLabel(graph)
+
+	targets := make(map[string]struct{})
+	applied := make(map[string]struct{}, len(parsed.Resources))
+	// retried are the labels of the resources whose dependents are targeted.
+	retried := make([]string, 0)
+	for _, resource := range parsed.Resources {
+		applied[resource.address()] = struct{}{}
+		for _, instance := range resource.Instances {
+			if instance.Status != "tainted" {
+				continue
+			}
+			targets[resource.instanceAddress(instance.IndexKey)] = struct{}{}
+			retried = append(retried, resource.address())
+		}
+	}
+	for label, node := range nodes {
+		if !isManagedResourceNode(node) {
+			continue
+		}
+		if _, ok := applied[label]; ok {
+			continue
+		}
+		targets[label] = struct{}{}
+		retried = append(retried, label)
+	}
+
+	// The edges of the graph point from resources to their dependencies.
+	visited := make(map[string]struct{})
+	queue := make([]string, 0, len(retried))
+	for _, label := range retried {
+		if node, ok := nodes[label]; ok {
+			queue = append(queue, node.Name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for dependent := range graph.Edges.DstToSrcs[name] {
+			if _, ok := visited[dependent]; ok {
+				continue
+			}
+			visited[dependent] = struct{}{}
+			queue = append(queue, dependent)
+			node, ok := graph.Nodes.Lookup[dependent]
+			if ok && isManagedResourceNode(node) {
+				targets[graphNodeLabel(graph, dependent)] = struct{}{}
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(targets))
+	for target := range targets {
+		sorted = append(sorted, target)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// isManagedResourceNode returns whether the node of a graph is a managed
+// resource. Data sources are read by every plan, so they're never targeted.
+func isManagedResourceNode(node *gographviz.Node) bool {
+	return strings.Trim(node.Attrs["shape"], `"`) == "box" &&
+		!strings.HasPrefix(strings.Trim(node.Attrs["label"], `"`), "data.")
+}
+
+// retryFailedResources returns whether the build requested to only retry
+// failed resources.
+func retryFailedResources(values []*proto.RichParameterValue) bool {
+	for _, value := range values {
+		if value.Name == RetryFailedResourcesParameter {
+			retry, _ := strconv.ParseBool(value.Value)
+			return retry
+		}
+	}
+	return false
+}
+
+// planTargets returns the resources the plan of a build is limited to. Nil
+// is returned if the whole template should be planned. graph returns the
+// output of "terraform graph", it's only called if failed resources are
+// retried.
+func planTargets(logr logSink, request *proto.PlanRequest, state []byte, graph func() (string, error)) ([]string, error) {
+	if request.Metadata.GetWorkspaceTransition() != proto.WorkspaceTransition_START ||
+		!retryFailedResources(request.RichParameterValues) {
+		return nil, nil
+	}
+	rawGraph, err := graph()
+	if err != nil {
+		return nil, xerrors.Errorf("graph: %w", err)
+	}
+	targets, err := retryTargets(state, rawGraph)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		logr.ProvisionLog(proto.LogLevel_INFO, "No resources failed in the previous build, planning all resources")
+		return nil, nil
+	}
+	logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf(
+		"Retrying the resources that failed in the previous build, and the resources depending on them: %s",
+		strings.Join(targets, ", ")))
+	return targets, nil
+}
+
+// logFailedResources summarizes the resources that failed during an apply,
+// and how to retry only those.
+func logFailedResources(logr logSink, state []byte) {
+	failed, err := failedResources(state)
+	if err != nil || len(failed) == 0 {
+		return
+	}
+	logr.ProvisionLog(proto.LogLevel_ERROR, fmt.Sprintf(
+		"The following resources failed to apply: %s. Other resources were applied and are kept in the state. "+
+			"If the template declares the %q build option, it can be used to retry only the failed resources.",
+		strings.Join(failed, ", "), RetryFailedResourcesParameter))
+}
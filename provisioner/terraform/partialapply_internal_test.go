@@ -0,0 +1,181 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+const partiallyAppliedState = `{
+	"version": 4,
+	"resources": [
+		{
+			"mode": "managed",
+			"type": "docker_volume",
+			"name": "home",
+			"instances": [{"status": "", "attributes": {}}]
+		},
+		{
+			"mode": "managed",
+			"type": "docker_container",
+			"name": "workspace",
+			"instances": [{"index_key": 0, "status": "tainted", "attributes": {}}]
+		},
+		{
+			"module": "module.vm",
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "dev",
+			"instances": [{"index_key": "east", "status": "tainted", "attributes": {}}]
+		}
+	]
+}`
+
+func TestFailedResources(t *testing.T) {
+	t.Parallel()
+
+	failed, err := failedResources([]byte(partiallyAppliedState))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"docker_container.workspace[0]",
+		`module.vm.aws_instance.dev["east"]`,
+	}, failed)
+
+	failed, err = failedResources(nil)
+	require.NoError(t, err)
+	require.Empty(t, failed)
+
+	_, err = failedResources([]byte("{"))
+	require.Error(t, err)
+}
+
+// chainingGraph returns the graph of the chaining-resources test case, where
+// null_resource.a depends on null_resource.b, which depends on
+// coder_agent.main.
+func chainingGraph() (string, error) {
+	data, err := os.ReadFile(filepath.Join("testdata", "chaining-resources", "chaining-resources.tfstate.dot"))
+	return string(data), err
+}
+
+// chainingState returns a state of the chaining-resources test case with the
+// resources, optionally suffixed by the status of their instance, e.g.
+// "null_resource.a:tainted".
+func chainingState(resources ...string) []byte {
+	rawResources := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		address, status, _ := strings.Cut(resource, ":")
+		typ, name, _ := strings.Cut(address, ".")
+		rawResources = append(rawResources, fmt.Sprintf(
+			`{"mode": "managed", "type": %q, "name": %q, "instances": [{"status": %q, "attributes": {}}]}`, typ, name, status))
+	}
+	return []byte(`{"version": 4, "resources": [` + strings.Join(rawResources, ", ") + `]}`)
+}
+
+func TestRetryTargets(t *testing.T) {
+	t.Parallel()
+
+	graph, err := chainingGraph()
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name    string
+		state   []byte
+		targets []string
+	}{{
+		name:    "Applied",
+		state:   chainingState("coder_agent.main", "null_resource.b", "null_resource.a"),
+		targets: []string{},
+	}, {
+		// Dependents of failed resources are retried, even if they were
+		// applied.
+		name:    "Failed",
+		state:   chainingState("coder_agent.main:tainted", "null_resource.b", "null_resource.a"),
+		targets: []string{"coder_agent.main", "null_resource.a", "null_resource.b"},
+	}, {
+		// Creating null_resource.b failed before it was recorded in the
+		// state, so null_resource.a wasn't created either.
+		name:    "Missing",
+		state:   chainingState("coder_agent.main"),
+		targets: []string{"null_resource.a", "null_resource.b"},
+	}, {
+		name:    "Empty",
+		targets: []string{"coder_agent.main", "null_resource.a", "null_resource.b"},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			targets, err := retryTargets(tc.state, graph)
+			require.NoError(t, err)
+			require.Equal(t, tc.targets, targets)
+		})
+	}
+}
+
+func TestPlanTargets(t *testing.T) {
+	t.Parallel()
+
+	retry := []*proto.RichParameterValue{{Name: RetryFailedResourcesParameter, Value: "true"}}
+	failedGraph := func() (string, error) {
+		return "", xerrors.New("graph failed")
+	}
+
+	t.Run("Retry", func(t *testing.T) {
+		t.Parallel()
+		logr := &mockLogger{}
+		targets, err := planTargets(logr, &proto.PlanRequest{
+			Metadata:            &proto.Metadata{WorkspaceTransition: proto.WorkspaceTransition_START},
+			RichParameterValues: retry,
+		}, chainingState("coder_agent.main", "null_resource.b:tainted", "null_resource.a"), chainingGraph)
+		require.NoError(t, err)
+		require.Equal(t, []string{"null_resource.a", "null_resource.b"}, targets)
+		require.Len(t, logr.logs, 1)
+	})
+
+	t.Run("GraphFailed", func(t *testing.T) {
+		t.Parallel()
+		_, err := planTargets(&mockLogger{}, &proto.PlanRequest{
+			Metadata:            &proto.Metadata{WorkspaceTransition: proto.WorkspaceTransition_START},
+			RichParameterValues: retry,
+		}, chainingState("coder_agent.main"), failedGraph)
+		require.ErrorContains(t, err, "graph failed")
+	})
+
+	t.Run("NotRequested", func(t *testing.T) {
+		t.Parallel()
+		targets, err := planTargets(&mockLogger{}, &proto.PlanRequest{
+			Metadata: &proto.Metadata{WorkspaceTransition: proto.WorkspaceTransition_START},
+			RichParameterValues: []*proto.RichParameterValue{
+				{Name: RetryFailedResourcesParameter, Value: "false"},
+			},
+		}, []byte(partiallyAppliedState), failedGraph)
+		require.NoError(t, err)
+		require.Nil(t, targets)
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		t.Parallel()
+		targets, err := planTargets(&mockLogger{}, &proto.PlanRequest{
+			Metadata:            &proto.Metadata{WorkspaceTransition: proto.WorkspaceTransition_STOP},
+			RichParameterValues: retry,
+		}, []byte(partiallyAppliedState), failedGraph)
+		require.NoError(t, err)
+		require.Nil(t, targets)
+	})
+
+	t.Run("NothingFailed", func(t *testing.T) {
+		t.Parallel()
+		targets, err := planTargets(&mockLogger{}, &proto.PlanRequest{
+			Metadata:            &proto.Metadata{WorkspaceTransition: proto.WorkspaceTransition_START},
+			RichParameterValues: retry,
+		}, chainingState("coder_agent.main", "null_resource.b", "null_resource.a"), chainingGraph)
+		require.NoError(t, err)
+		require.Nil(t, targets)
+	})
+}
@@ -0,0 +1,66 @@
+package terraform
+
+import (
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// plannedActions returns the change the plan makes to every managed
+// resource, by the address of the resource.
+func plannedActions(changes []*tfjson.ResourceChange) map[string]proto.ResourceAction {
+	actions := map[string]proto.ResourceAction{}
+	for _, change := range changes {
+		if change.Change == nil || change.Mode == tfjson.DataResourceMode {
+			continue
+		}
+		actions[change.Address] = resourceAction(change.Change.Actions)
+	}
+	return actions
+}
+
+// deletedResources converts the managed resources the plan deletes. They
+// aren't part of the planned or applied state, so only their name and type
+// are known.
+func deletedResources(changes []*tfjson.ResourceChange) []*proto.Resource {
+	var resources []*proto.Resource
+	for _, change := range changes {
+		if change.Change == nil || change.Mode == tfjson.DataResourceMode {
+			continue
+		}
+		// Resources of the provider are converted into the agents and
+		// metadata of other resources.
+		if strings.HasPrefix(change.Type, "coder_") {
+			continue
+		}
+		if resourceAction(change.Change.Actions) != proto.ResourceAction_DELETE {
+			continue
+		}
+		resources = append(resources, &proto.Resource{
+			Name:    change.Name,
+			Type:    change.Type,
+			Action:  proto.ResourceAction_DELETE,
+			Address: change.Address,
+		})
+	}
+	return resources
+}
+
+func resourceAction(actions tfjson.Actions) proto.ResourceAction {
+	switch {
+	case actions.Replace():
+		return proto.ResourceAction_REPLACE
+	case actions.Create():
+		return proto.ResourceAction_CREATE
+	case actions.Update():
+		return proto.ResourceAction_UPDATE
+	case actions.Delete():
+		return proto.ResourceAction_DELETE
+	case actions.NoOp(), actions.Read():
+		return proto.ResourceAction_NO_OP
+	default:
+		return proto.ResourceAction_ACTION_UNSPECIFIED
+	}
+}
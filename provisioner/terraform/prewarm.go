@@ -0,0 +1,515 @@
+package terraform
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+const (
+	// prewarmModuleDir is the directory of an entry holding the template
+	// sources and, once warmed, the initialized .terraform directory.
+	prewarmModuleDir = "module"
+	// prewarmEntryFile is the file of an entry holding its usage.
+	prewarmEntryFile = "entry.json"
+	// defaultPrewarmIdleDelay is how long the provisioner must be idle
+	// before template versions are pre-warmed.
+	defaultPrewarmIdleDelay = time.Minute
+)
+
+// PrewarmOptions configures idle provisioners to run "terraform init" for
+// the most frequently built template versions in advance, so builds skip
+// downloading providers and modules.
+type PrewarmOptions struct {
+	// Dir holds the pre-warmed template versions. It must not be in
+	// CachePath, since stale plugins are cleaned from there.
+	Dir string
+	// MaxTemplates is the number of the most frequently built template
+	// versions that are kept.
+	MaxTemplates int
+	// MaxDiskBytes bounds the disk usage of the pre-warmed template
+	// versions. The least used ones are evicted first. Unbounded if zero.
+	MaxDiskBytes int64
+	// IdleDelay is how long the provisioner must be idle before a template
+	// version is pre-warmed. Defaults to a minute.
+	IdleDelay time.Duration
+}
+
+// prewarmEntry is a template version seen by the provisioner, identified by
+// the hash of its sources.
+type prewarmEntry struct {
+	Hash     string    `json:"-"`
+	Uses     int       `json:"uses"`
+	LastUsed time.Time `json:"last_used"`
+	// Ready is set once "terraform init" succeeded.
+	Ready bool `json:"ready"`
+	// Failed is set if "terraform init" failed, so it isn't retried until
+	// the template version is built again.
+	Failed bool  `json:"failed"`
+	Size   int64 `json:"size"`
+}
+
+type prewarmer struct {
+	logger slog.Logger
+	opts   PrewarmOptions
+	now    func() time.Time
+	// init runs "terraform init" in the directory.
+	init func(ctx context.Context, dir string) error
+
+	mu      sync.Mutex
+	entries map[string]*prewarmEntry
+	// active is the number of running provisioner requests. Template
+	// versions are only pre-warmed while there are none.
+	active     int
+	lastActive time.Time
+	// warming is the hash of the entry being pre-warmed, which must not be
+	// evicted, and cancelWarm cancels its pre-warm.
+	warming    string
+	cancelWarm context.CancelFunc
+}
+
+func newPrewarmer(logger slog.Logger, opts PrewarmOptions, init func(ctx context.Context, dir string) error) (*prewarmer, error) {
+	if opts.IdleDelay == 0 {
+		opts.IdleDelay = defaultPrewarmIdleDelay
+	}
+	err := os.MkdirAll(opts.Dir, 0o700)
+	if err != nil {
+		return nil, xerrors.Errorf("create prewarm dir: %w", err)
+	}
+	p := &prewarmer{
+		logger:  logger,
+		opts:    opts,
+		now:     time.Now,
+		init:    init,
+		entries: map[string]*prewarmEntry{},
+	}
+	err = p.load()
+	if err != nil {
+		return nil, err
+	}
+	p.lastActive = p.now()
+	return p, nil
+}
+
+// load reads the entries of a previous provisioner. Incomplete entries,
+// e.g. of a provisioner that crashed while copying sources, are removed.
+func (p *prewarmer) load() error {
+	dirs, err := os.ReadDir(p.opts.Dir)
+	if err != nil {
+		return xerrors.Errorf("read prewarm dir: %w", err)
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(p.opts.Dir, dir.Name())
+		data, err := os.ReadFile(filepath.Join(path, prewarmEntryFile))
+		var entry prewarmEntry
+		if err == nil {
+			err = json.Unmarshal(data, &entry)
+		}
+		if err != nil {
+			p.logger.Debug(context.Background(), "remove incomplete prewarm entry", slog.F("path", path), slog.Error(err))
+			_ = os.RemoveAll(path)
+			continue
+		}
+		entry.Hash = dir.Name()
+		p.entries[entry.Hash] = &entry
+	}
+	return nil
+}
+
+// begin marks the start of a provisioner request and cancels the running
+// pre-warm, so it doesn't delay the request. The returned function marks the
+// end of the request. It's a no-op if pre-warming is disabled.
+func (p *prewarmer) begin() func() {
+	if p == nil {
+		return func() {}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active++
+	p.lastActive = p.now()
+	if p.cancelWarm != nil {
+		p.cancelWarm()
+	}
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.active--
+		p.lastActive = p.now()
+	}
+}
+
+// restore records a build of the template version in the working directory
+// and copies its initialized .terraform directory if it was pre-warmed. The
+// sources of unknown template versions are saved to pre-warm them later.
+// It must be called before anything is written to the working directory.
+func (p *prewarmer) restore(ctx context.Context, workdir string, logr logSink) {
+	if p == nil {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(workdir, ".terraform")); err == nil {
+		// Already initialized in this session.
+		return
+	}
+	hash, err := hashModule(workdir)
+	if err != nil {
+		p.logger.Warn(ctx, "hash template version for prewarm", slog.Error(err))
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.entries[hash]
+	if !ok {
+		entry = &prewarmEntry{Hash: hash}
+	}
+	entry.Uses++
+	entry.LastUsed = p.now()
+	entry.Failed = false
+	moduleDir := filepath.Join(p.opts.Dir, hash, prewarmModuleDir)
+	switch {
+	case entry.Ready:
+		err = copyInitialized(moduleDir, workdir)
+		if err != nil {
+			p.logger.Warn(ctx, "copy prewarmed template version", slog.F("hash", hash), slog.Error(err))
+			_ = os.RemoveAll(filepath.Join(workdir, ".terraform"))
+			break
+		}
+		logr.ProvisionLog(proto.LogLevel_INFO, "Using pre-initialized Terraform providers and modules")
+	case !ok:
+		entry.Size, err = copySources(workdir, moduleDir)
+		if err != nil {
+			p.logger.Warn(ctx, "save template version for prewarm", slog.F("hash", hash), slog.Error(err))
+			_ = os.RemoveAll(filepath.Join(p.opts.Dir, hash))
+			return
+		}
+		p.entries[hash] = entry
+	}
+	err = p.saveLocked(entry)
+	if err != nil {
+		p.logger.Warn(ctx, "save prewarm entry", slog.F("hash", hash), slog.Error(err))
+	}
+	p.evictLocked(ctx)
+}
+
+// run pre-warms template versions whenever the provisioner has been idle
+// for the idle delay, until the context is canceled.
+func (p *prewarmer) run(ctx context.Context) {
+	ticker := time.NewTicker(p.opts.IdleDelay / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		p.warmNext(ctx)
+	}
+}
+
+// warmNext runs "terraform init" for the most used template version that
+// isn't warm yet, if the provisioner is idle.
+func (p *prewarmer) warmNext(ctx context.Context) {
+	p.mu.Lock()
+	if p.active > 0 || p.now().Sub(p.lastActive) < p.opts.IdleDelay {
+		p.mu.Unlock()
+		return
+	}
+	entry := p.candidateLocked()
+	if entry == nil {
+		p.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	p.warming = entry.Hash
+	p.cancelWarm = cancel
+	uses := entry.Uses
+	p.mu.Unlock()
+
+	moduleDir := filepath.Join(p.opts.Dir, entry.Hash, prewarmModuleDir)
+	start := p.now()
+	p.logger.Info(ctx, "prewarming template version", slog.F("hash", entry.Hash), slog.F("uses", uses))
+	err := p.init(ctx, moduleDir)
+	var size int64
+	if err == nil {
+		size, err = dirSize(moduleDir)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.warming = ""
+	p.cancelWarm = nil
+	if ctx.Err() != nil {
+		// Interrupted by a provisioner request, so try again later.
+		_ = os.RemoveAll(filepath.Join(moduleDir, ".terraform"))
+		return
+	}
+	if err != nil {
+		p.logger.Warn(ctx, "prewarm template version", slog.F("hash", entry.Hash), slog.Error(err))
+		_ = os.RemoveAll(filepath.Join(moduleDir, ".terraform"))
+		entry.Failed = true
+	} else {
+		p.logger.Info(ctx, "prewarmed template version",
+			slog.F("hash", entry.Hash), slog.F("size", size), slog.F("took", p.now().Sub(start)))
+		entry.Ready = true
+		entry.Size = size
+	}
+	err = p.saveLocked(entry)
+	if err != nil {
+		p.logger.Warn(ctx, "save prewarm entry", slog.F("hash", entry.Hash), slog.Error(err))
+	}
+	p.evictLocked(ctx)
+}
+
+// rankedLocked returns the entries ordered by how often they're used, most
+// used first.
+func (p *prewarmer) rankedLocked() []*prewarmEntry {
+	entries := make([]*prewarmEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Uses != entries[j].Uses {
+			return entries[i].Uses > entries[j].Uses
+		}
+		if !entries[i].LastUsed.Equal(entries[j].LastUsed) {
+			return entries[i].LastUsed.After(entries[j].LastUsed)
+		}
+		return entries[i].Hash < entries[j].Hash
+	})
+	return entries
+}
+
+// candidateLocked returns the most used entry of the kept ones that isn't
+// warm yet.
+func (p *prewarmer) candidateLocked() *prewarmEntry {
+	for i, entry := range p.rankedLocked() {
+		if i >= p.opts.MaxTemplates {
+			return nil
+		}
+		if !entry.Ready && !entry.Failed {
+			return entry
+		}
+	}
+	return nil
+}
+
+// evictLocked removes the least used entries exceeding the maximum number of
+// template versions or disk usage.
+func (p *prewarmer) evictLocked(ctx context.Context) {
+	var total int64
+	for i, entry := range p.rankedLocked() {
+		total += entry.Size
+		if entry.Hash == p.warming || i < p.opts.MaxTemplates && (p.opts.MaxDiskBytes == 0 || total <= p.opts.MaxDiskBytes) {
+			continue
+		}
+		total -= entry.Size
+		p.logger.Debug(ctx, "evict prewarmed template version", slog.F("hash", entry.Hash), slog.F("uses", entry.Uses))
+		err := os.RemoveAll(filepath.Join(p.opts.Dir, entry.Hash))
+		if err != nil {
+			p.logger.Warn(ctx, "remove prewarm entry", slog.F("hash", entry.Hash), slog.Error(err))
+			continue
+		}
+		delete(p.entries, entry.Hash)
+	}
+}
+
+// slogSink logs the output of pre-warms, which don't belong to a job.
+type slogSink struct {
+	logger slog.Logger
+}
+
+func (s slogSink) ProvisionLog(level proto.LogLevel, output string) {
+	s.logger.Debug(context.Background(), output, slog.F("level", level.String()))
+}
+
+func (p *prewarmer) saveLocked(entry *prewarmEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(p.opts.Dir, entry.Hash, prewarmEntryFile), data, 0o600)
+}
+
+// skipPrewarmPath reports whether a path relative to the working directory
+// isn't part of the sources of the template version.
+func skipPrewarmPath(rel string) bool {
+	switch rel {
+	case ".terraform", "terraform.tfstate", "terraform.tfplan":
+		return true
+	}
+	return false
+}
+
+// hashModule returns the hash of the sources of the template version in the
+// directory.
+func hashModule(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if skipPrewarmPath(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		_, _ = h.Write([]byte(filepath.ToSlash(rel) + "\x00"))
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			_, _ = h.Write([]byte("symlink:" + target + "\x00"))
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(h, f)
+		if err != nil {
+			return err
+		}
+		_, _ = h.Write([]byte{0})
+		return nil
+	})
+	if err != nil {
+		return "", xerrors.Errorf("hash module: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copySources copies the sources of the template version and returns their
+// size.
+func copySources(src, dst string) (int64, error) {
+	return copyTree(src, dst, skipPrewarmPath)
+}
+
+// copyInitialized copies the .terraform directory and the dependency lock
+// file created by "terraform init" into the working directory. Lock files
+// that are part of the template version are kept.
+func copyInitialized(moduleDir, workdir string) error {
+	_, err := copyTree(filepath.Join(moduleDir, ".terraform"), filepath.Join(workdir, ".terraform"), nil)
+	if err != nil {
+		return err
+	}
+	lockFile := filepath.Join(workdir, ".terraform.lock.hcl")
+	if _, err := os.Stat(lockFile); err == nil {
+		return nil
+	}
+	_, err = copyFile(filepath.Join(moduleDir, ".terraform.lock.hcl"), lockFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// copyTree copies the directory, preserving symlinks, e.g. to the plugin
+// cache. It returns the size of the copied files.
+func copyTree(src, dst string, skip func(rel string) bool) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if skip != nil && skip(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0o700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			n, err := copyFile(path, target)
+			size += n
+			return err
+		}
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("copy %q: %w", src, err)
+	}
+	return size, nil
+}
+
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if err != nil {
+		_ = out.Close()
+		return n, err
+	}
+	return n, out.Close()
+}
+
+// dirSize returns the size of the files in the directory, not following
+// symlinks.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("size of %q: %w", dir, err)
+	}
+	return size, nil
+}
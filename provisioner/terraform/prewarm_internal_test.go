@@ -0,0 +1,171 @@
+package terraform
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+type discardLogSink struct{}
+
+func (discardLogSink) ProvisionLog(proto.LogLevel, string) {}
+
+// writeModule writes a template version to a new working directory.
+func writeModule(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(content), 0o600))
+	return dir
+}
+
+// fakeInit creates the files "terraform init" would.
+func fakeInit(_ context.Context, dir string) error {
+	err := os.MkdirAll(filepath.Join(dir, ".terraform", "modules"), 0o700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(dir, ".terraform", "modules", "modules.json"), []byte(`{"Modules":[]}`), 0o600)
+	if err != nil {
+		return err
+	}
+	err = os.Symlink("/cache/provider", filepath.Join(dir, ".terraform", "provider"))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ".terraform.lock.hcl"), []byte("# lock"), 0o600)
+}
+
+func newTestPrewarmer(t *testing.T, opts PrewarmOptions) *prewarmer {
+	t.Helper()
+	opts.Dir = t.TempDir()
+	p, err := newPrewarmer(slogtest.Make(t, nil), opts, fakeInit)
+	require.NoError(t, err)
+	// Pretend the provisioner has been idle for long enough.
+	p.lastActive = time.Time{}
+	return p
+}
+
+func TestHashModule(t *testing.T) {
+	t.Parallel()
+
+	a := writeModule(t, `resource "null_resource" "a" {}`)
+	b := writeModule(t, `resource "null_resource" "a" {}`)
+	c := writeModule(t, `resource "null_resource" "c" {}`)
+	// Files written by the provisioner aren't part of the template version.
+	require.NoError(t, os.WriteFile(getStateFilePath(b), []byte("{}"), 0o600))
+	require.NoError(t, fakeInit(context.Background(), b))
+	require.NoError(t, os.Remove(filepath.Join(b, ".terraform.lock.hcl")))
+
+	hashA, err := hashModule(a)
+	require.NoError(t, err)
+	hashB, err := hashModule(b)
+	require.NoError(t, err)
+	hashC, err := hashModule(c)
+	require.NoError(t, err)
+	require.Equal(t, hashA, hashB)
+	require.NotEqual(t, hashA, hashC)
+}
+
+func TestPrewarm(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Restore", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		p := newTestPrewarmer(t, PrewarmOptions{MaxTemplates: 1})
+
+		// The first build saves the sources, which are pre-warmed once idle.
+		p.restore(ctx, writeModule(t, `resource "null_resource" "a" {}`), discardLogSink{})
+		p.warmNext(ctx)
+		require.Len(t, p.entries, 1)
+		for _, entry := range p.entries {
+			require.True(t, entry.Ready)
+			require.Equal(t, 1, entry.Uses)
+		}
+
+		workdir := writeModule(t, `resource "null_resource" "a" {}`)
+		p.restore(ctx, workdir, discardLogSink{})
+		data, err := os.ReadFile(filepath.Join(workdir, ".terraform", "modules", "modules.json"))
+		require.NoError(t, err)
+		require.Equal(t, `{"Modules":[]}`, string(data))
+		link, err := os.Readlink(filepath.Join(workdir, ".terraform", "provider"))
+		require.NoError(t, err)
+		require.Equal(t, "/cache/provider", link)
+		require.FileExists(t, filepath.Join(workdir, ".terraform.lock.hcl"))
+
+		// Entries outlive the provisioner.
+		loaded, err := newPrewarmer(slogtest.Make(t, nil), p.opts, fakeInit)
+		require.NoError(t, err)
+		require.Len(t, loaded.entries, 1)
+		for _, entry := range loaded.entries {
+			require.True(t, entry.Ready)
+			require.Equal(t, 2, entry.Uses)
+		}
+	})
+
+	t.Run("Busy", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		p := newTestPrewarmer(t, PrewarmOptions{MaxTemplates: 1})
+
+		end := p.begin()
+		p.restore(ctx, writeModule(t, `resource "null_resource" "a" {}`), discardLogSink{})
+		p.warmNext(ctx)
+		end()
+		// The provisioner was just active.
+		p.warmNext(ctx)
+		for _, entry := range p.entries {
+			require.False(t, entry.Ready)
+		}
+	})
+
+	t.Run("MostUsed", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		p := newTestPrewarmer(t, PrewarmOptions{MaxTemplates: 2})
+
+		for _, content := range []string{
+			`resource "null_resource" "a" {}`,
+			`resource "null_resource" "b" {}`,
+			`resource "null_resource" "b" {}`,
+			`resource "null_resource" "c" {}`,
+			`resource "null_resource" "c" {}`,
+			`resource "null_resource" "c" {}`,
+		} {
+			p.restore(ctx, writeModule(t, content), discardLogSink{})
+		}
+		// The least used template version was evicted.
+		require.Len(t, p.entries, 2)
+		p.warmNext(ctx)
+		ranked := p.rankedLocked()
+		require.Equal(t, 3, ranked[0].Uses)
+		require.True(t, ranked[0].Ready)
+		require.Equal(t, 2, ranked[1].Uses)
+		require.False(t, ranked[1].Ready)
+	})
+
+	t.Run("MaxDiskBytes", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		content := `resource "null_resource" "a" {}`
+		p := newTestPrewarmer(t, PrewarmOptions{MaxTemplates: 2, MaxDiskBytes: int64(len(content)) + 1})
+
+		p.restore(ctx, writeModule(t, content), discardLogSink{})
+		p.restore(ctx, writeModule(t, content), discardLogSink{})
+		p.restore(ctx, writeModule(t, `resource "null_resource" "b" {}`), discardLogSink{})
+		require.Len(t, p.entries, 1)
+		// The initialized template version exceeds the bound.
+		p.warmNext(ctx)
+		require.Empty(t, p.entries)
+		dirs, err := os.ReadDir(p.opts.Dir)
+		require.NoError(t, err)
+		require.Empty(t, dirs)
+	})
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package terraform
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes cmd the leader of a new process group, so the
+// providers started by Terraform can be signaled along with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// quitProcessGroup sends SIGQUIT to the process group of cmd, which makes
+// Go programs like Terraform and its providers print the stack traces of
+// all goroutines.
+func quitProcessGroup(cmd *exec.Cmd) error {
+	return signalProcessGroup(cmd, syscall.SIGQUIT)
+}
+
+// killProcessGroup kills the processes of the group of cmd.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return signalProcessGroup(cmd, syscall.SIGKILL)
+}
+
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	// The ID of the group is the PID of its leader. The group exists as long
+	// as any of its processes does, even if the leader exited.
+	err := syscall.Kill(-cmd.Process.Pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
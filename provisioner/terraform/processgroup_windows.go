@@ -0,0 +1,21 @@
+package terraform
+
+import (
+	"os/exec"
+
+	"golang.org/x/xerrors"
+)
+
+// setProcessGroup is a no-op, console processes can't be signaled on
+// Windows.
+func setProcessGroup(*exec.Cmd) {}
+
+func quitProcessGroup(*exec.Cmd) error {
+	return xerrors.New("SIGQUIT isn't supported on Windows")
+}
+
+// killProcessGroup kills cmd. The providers it started exit once their
+// connection to Terraform is closed.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
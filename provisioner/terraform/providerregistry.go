@@ -0,0 +1,235 @@
+package terraform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/xerrors"
+)
+
+// providerRegistry returns the packages of providers signed by their
+// registry, following the provider registry protocol:
+// https://developer.hashicorp.com/terraform/internals/provider-registry-protocol
+//
+// The registry is the root of trust, as it is for Terraform, so the
+// dependency lock file of a template can't vouch for a package.
+type providerRegistry struct {
+	client *http.Client
+
+	mu sync.Mutex
+	// hashes are the "h1:" hashes of the signed packages, by source,
+	// version and platform.
+	hashes map[string]string
+}
+
+func newProviderRegistry(client *http.Client) *providerRegistry {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &providerRegistry{
+		client: client,
+		hashes: map[string]string{},
+	}
+}
+
+// providerPackage is the response of the registry for the package of a
+// provider version for a platform.
+type providerPackage struct {
+	Filename            string `json:"filename"`
+	DownloadURL         string `json:"download_url"`
+	SHASumsURL          string `json:"shasums_url"`
+	SHASumsSignatureURL string `json:"shasums_signature_url"`
+	SHASum              string `json:"shasum"`
+	SigningKeys         struct {
+		GPGPublicKeys []struct {
+			ASCIIArmor string `json:"ascii_armor"`
+		} `json:"gpg_public_keys"`
+	} `json:"signing_keys"`
+}
+
+// maxRegistryResponseBytes bounds the responses of the registry, except
+// for the package archives.
+const maxRegistryResponseBytes = 1 << 20
+
+// signedPackageHash returns the "h1:" hash of the package of the provider
+// whose release archive the registry signed. Hashes are cached, so the
+// registry is only requested once for every package.
+func (r *providerRegistry) signedPackageHash(ctx context.Context, provider installedProvider) (string, error) {
+	key := provider.source + " " + provider.version + " " + provider.platform
+	r.mu.Lock()
+	hash, ok := r.hashes[key]
+	r.mu.Unlock()
+	if ok {
+		return hash, nil
+	}
+
+	hash, err := r.fetchPackageHash(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.hashes[key] = hash
+	r.mu.Unlock()
+	return hash, nil
+}
+
+func (r *providerRegistry) fetchPackageHash(ctx context.Context, provider installedProvider) (string, error) {
+	parts := strings.Split(provider.source, "/")
+	if len(parts) != 3 {
+		return "", xerrors.Errorf("invalid provider source %q", provider.source)
+	}
+	host, namespace, typ := parts[0], parts[1], parts[2]
+	goos, goarch, ok := strings.Cut(provider.platform, "_")
+	if !ok {
+		return "", xerrors.Errorf("invalid provider platform %q", provider.platform)
+	}
+
+	hostURL := &url.URL{Scheme: "https", Host: host, Path: "/"}
+	var services map[string]any
+	err := r.getJSON(ctx, hostURL.JoinPath(".well-known", "terraform.json"), &services)
+	if err != nil {
+		return "", xerrors.Errorf("discover services: %w", err)
+	}
+	rawBase, ok := services["providers.v1"].(string)
+	if !ok {
+		return "", xerrors.Errorf("%s isn't a provider registry", host)
+	}
+	base, err := hostURL.Parse(rawBase)
+	if err != nil {
+		return "", xerrors.Errorf("parse provider registry URL: %w", err)
+	}
+
+	var pkg providerPackage
+	err = r.getJSON(ctx, base.JoinPath(namespace, typ, provider.version, "download", goos, goarch), &pkg)
+	if err != nil {
+		return "", xerrors.Errorf("find package: %w", err)
+	}
+	var keyring openpgp.EntityList
+	for _, key := range pkg.SigningKeys.GPGPublicKeys {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.ASCIIArmor))
+		if err != nil {
+			return "", xerrors.Errorf("read signing key: %w", err)
+		}
+		keyring = append(keyring, entities...)
+	}
+	sums, err := r.get(ctx, base, pkg.SHASumsURL)
+	if err != nil {
+		return "", xerrors.Errorf("get checksums: %w", err)
+	}
+	signature, err := r.get(ctx, base, pkg.SHASumsSignatureURL)
+	if err != nil {
+		return "", xerrors.Errorf("get checksums signature: %w", err)
+	}
+	_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(sums), bytes.NewReader(signature), nil)
+	if err != nil {
+		return "", xerrors.Errorf("checksums aren't signed by the registry: %w", err)
+	}
+	sum, err := findChecksum(sums, pkg.Filename)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(sum, pkg.SHASum) {
+		return "", xerrors.Errorf("checksum of %s doesn't match the signed checksums", pkg.Filename)
+	}
+	return r.archiveHash(ctx, base, pkg.DownloadURL, sum)
+}
+
+// archiveHash downloads the release archive, and returns the "h1:" hash of
+// its contents if it matches the signed SHA256 checksum.
+func (r *providerRegistry) archiveHash(ctx context.Context, base *url.URL, rawURL, sum string) (string, error) {
+	res, err := r.do(ctx, base, rawURL)
+	if err != nil {
+		return "", xerrors.Errorf("download package: %w", err)
+	}
+	defer res.Body.Close()
+
+	file, err := os.CreateTemp("", "terraform-provider-*.zip")
+	if err != nil {
+		return "", xerrors.Errorf("create package archive: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+	digest := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, digest), res.Body)
+	if err != nil {
+		return "", xerrors.Errorf("download package: %w", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return "", xerrors.Errorf("write package archive: %w", err)
+	}
+	if !strings.EqualFold(hex.EncodeToString(digest.Sum(nil)), sum) {
+		return "", xerrors.New("package archive doesn't match the signed checksum")
+	}
+	hash, err := dirhash.HashZip(file.Name(), dirhash.Hash1)
+	if err != nil {
+		return "", xerrors.Errorf("hash package archive: %w", err)
+	}
+	return hash, nil
+}
+
+// findChecksum returns the SHA256 checksum of the file in a SHA256SUMS
+// file.
+func findChecksum(sums []byte, filename string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == filename {
+			return fields[0], nil
+		}
+	}
+	return "", xerrors.Errorf("no signed checksum of %s", filename)
+}
+
+func (r *providerRegistry) getJSON(ctx context.Context, u *url.URL, v any) error {
+	body, err := r.get(ctx, u, u.String())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (r *providerRegistry) get(ctx context.Context, base *url.URL, rawURL string) ([]byte, error) {
+	res, err := r.do(ctx, base, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return io.ReadAll(io.LimitReader(res.Body, maxRegistryResponseBytes))
+}
+
+// do requests the URL, resolved relative to base, and returns the response
+// if it succeeded.
+func (r *providerRegistry) do(ctx context.Context, base *url.URL, rawURL string) (*http.Response, error) {
+	u, err := base.Parse(rawURL)
+	if err != nil {
+		return nil, xerrors.Errorf("parse URL: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, xerrors.Errorf("GET %s: %s", u.Redacted(), res.Status)
+	}
+	return res, nil
+}
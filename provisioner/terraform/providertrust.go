@@ -0,0 +1,221 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/xerrors"
+)
+
+// ProviderVerificationOptions verify the providers installed by
+// "terraform init" before Terraform executes them, so builds don't run
+// plugins swapped in a cache, a mirror or the work directory.
+type ProviderVerificationOptions struct {
+	// Enabled verifies that the package of every installed provider matches
+	// the checksums of the dependency lock file, and the release archive
+	// signed by the registry of the provider. The signature is verified
+	// against the registry itself, since the lock file is uploaded with
+	// the template.
+	Enabled bool
+	// TrustedHashes allowlists the packages of providers by source address,
+	// e.g. "registry.terraform.io/hashicorp/aws", as "h1:" hashes of the
+	// dependency lock file. Installed packages of allowlisted providers must
+	// match a hash of the allowlist, instead of the release archive signed
+	// by the registry, e.g. for providers installed from mirrors. Implies
+	// Enabled.
+	TrustedHashes map[string][]string
+	// HTTPClient requests the registries of providers. Defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (o ProviderVerificationOptions) enabled() bool {
+	return o.Enabled || len(o.TrustedHashes) > 0
+}
+
+// UntrustedProviderError is returned when an installed provider fails the
+// verification, see ProviderVerificationOptions.
+type UntrustedProviderError struct {
+	Provider string
+	Version  string
+	Reason   string
+}
+
+func (e *UntrustedProviderError) Error() string {
+	return fmt.Sprintf("untrusted provider %s %s: %s", e.Provider, e.Version, e.Reason)
+}
+
+const dependencyLockFile = ".terraform.lock.hcl"
+
+// lockedProvider is a provider of the dependency lock file.
+type lockedProvider struct {
+	version string
+	hashes  []string
+}
+
+// installedProvider is a package of a provider installed by init.
+type installedProvider struct {
+	source   string
+	version  string
+	platform string
+	dir      string
+}
+
+// verifyProviders verifies the providers installed in the module in dir,
+// and returns how many packages were verified.
+func verifyProviders(ctx context.Context, dir string, opts ProviderVerificationOptions, registry *providerRegistry) (int, error) {
+	installed, err := installedProviders(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(installed) == 0 {
+		return 0, nil
+	}
+	locked, err := parseDependencyLockFile(filepath.Join(dir, dependencyLockFile))
+	if err != nil {
+		return 0, err
+	}
+	for _, provider := range installed {
+		lock, ok := locked[provider.source]
+		if !ok || lock.version != provider.version {
+			return 0, &UntrustedProviderError{Provider: provider.source, Version: provider.version, Reason: "not in the dependency lock file"}
+		}
+		hash, err := providerPackageHash(provider.dir)
+		if err != nil {
+			return 0, xerrors.Errorf("hash provider %s %s: %w", provider.source, provider.version, err)
+		}
+		if !slices.Contains(lock.hashes, hash) {
+			return 0, &UntrustedProviderError{
+				Provider: provider.source,
+				Version:  provider.version,
+				Reason:   fmt.Sprintf("the %s package doesn't match the checksums of the dependency lock file", provider.platform),
+			}
+		}
+		if trusted, ok := opts.TrustedHashes[provider.source]; ok {
+			if !slices.Contains(trusted, hash) {
+				return 0, &UntrustedProviderError{
+					Provider: provider.source,
+					Version:  provider.version,
+					Reason:   fmt.Sprintf("the %s package %s isn't in the allowlist", provider.platform, hash),
+				}
+			}
+			continue
+		}
+		signed, err := registry.signedPackageHash(ctx, provider)
+		if err != nil {
+			return 0, &UntrustedProviderError{
+				Provider: provider.source,
+				Version:  provider.version,
+				Reason:   fmt.Sprintf("verify the signature of the registry: %s; allowlist the hash of the package to trust it", err),
+			}
+		}
+		if signed != hash {
+			return 0, &UntrustedProviderError{
+				Provider: provider.source,
+				Version:  provider.version,
+				Reason:   fmt.Sprintf("the %s package doesn't match the package signed by the registry", provider.platform),
+			}
+		}
+	}
+	return len(installed), nil
+}
+
+// installedProviders returns the packages in the provider directory of the
+// module, laid out as <host>/<namespace>/<type>/<version>/<os>_<arch>.
+func installedProviders(dir string) ([]installedProvider, error) {
+	root := filepath.Join(dir, ".terraform", "providers")
+	matches, err := filepath.Glob(filepath.Join(root, "*", "*", "*", "*", "*"))
+	if err != nil {
+		return nil, xerrors.Errorf("find installed providers: %w", err)
+	}
+	sort.Strings(matches)
+	installed := make([]installedProvider, 0, len(matches))
+	for _, match := range matches {
+		rel, err := filepath.Rel(root, match)
+		if err != nil {
+			return nil, xerrors.Errorf("find installed providers: %w", err)
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		installed = append(installed, installedProvider{
+			source:   strings.Join(parts[:3], "/"),
+			version:  parts[3],
+			platform: parts[4],
+			dir:      match,
+		})
+	}
+	return installed, nil
+}
+
+// providerPackageHash returns the "h1:" hash of an unpacked provider
+// package, as recorded in the dependency lock file. Packages installed from
+// the plugin cache are symlinks to the cache.
+func providerPackageHash(dir string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	return dirhash.HashDir(resolved, "", dirhash.Hash1)
+}
+
+var (
+	lockFileSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "provider", LabelNames: []string{"source"}}},
+	}
+	lockedProviderSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "version", Required: true}, {Name: "hashes"}},
+	}
+)
+
+// parseDependencyLockFile returns the providers of the lock file, by source
+// address.
+func parseDependencyLockFile(path string) (map[string]lockedProvider, error) {
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, xerrors.Errorf("stat dependency lock file: %w", err)
+	}
+	file, diags := hclparse.NewParser().ParseHCLFile(path)
+	if diags.HasErrors() {
+		return nil, xerrors.Errorf("parse dependency lock file: %s", diags.Error())
+	}
+	content, _, diags := file.Body.PartialContent(lockFileSchema)
+	if diags.HasErrors() {
+		return nil, xerrors.Errorf("parse dependency lock file: %s", diags.Error())
+	}
+	providers := make(map[string]lockedProvider, len(content.Blocks))
+	for _, block := range content.Blocks {
+		attrs, _, diags := block.Body.PartialContent(lockedProviderSchema)
+		if diags.HasErrors() {
+			return nil, xerrors.Errorf("parse provider %s of the dependency lock file: %s", block.Labels[0], diags.Error())
+		}
+		version, diags := attrs.Attributes["version"].Expr.Value(nil)
+		if diags.HasErrors() || version.Type() != cty.String {
+			return nil, xerrors.Errorf("provider %s of the dependency lock file has an invalid version", block.Labels[0])
+		}
+		provider := lockedProvider{version: version.AsString()}
+		if attr, ok := attrs.Attributes["hashes"]; ok {
+			hashes, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || !hashes.CanIterateElements() {
+				return nil, xerrors.Errorf("provider %s of the dependency lock file has invalid hashes", block.Labels[0])
+			}
+			for it := hashes.ElementIterator(); it.Next(); {
+				_, hash := it.Element()
+				if hash.Type() != cty.String {
+					return nil, xerrors.Errorf("provider %s of the dependency lock file has invalid hashes", block.Labels[0])
+				}
+				provider.hashes = append(provider.hashes, hash.AsString())
+			}
+		}
+		providers[block.Labels[0]] = provider
+	}
+	return providers, nil
+}
@@ -0,0 +1,226 @@
+package terraform
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestVerifyProviders(t *testing.T) {
+	t.Parallel()
+
+	const (
+		version = "0.12.0"
+		binary  = "terraform-provider-coder_v0.12.0"
+	)
+
+	// setup installs a fake provider package of the registry and writes a
+	// lock file with the hashes, returning the module directory and the
+	// hash of the package.
+	setup := func(t *testing.T, registry *fakeRegistry, hashes ...string) (string, string) {
+		t.Helper()
+		dir := t.TempDir()
+		pkg := filepath.Join(dir, ".terraform", "providers", registry.source, version, "linux_amd64")
+		require.NoError(t, os.MkdirAll(pkg, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(pkg, binary), []byte("provider"), 0o600))
+		hash, err := providerPackageHash(pkg)
+		require.NoError(t, err)
+		for i, h := range hashes {
+			hashes[i] = fmt.Sprintf("%q,", strings.ReplaceAll(h, "INSTALLED", hash))
+		}
+		lock := fmt.Sprintf("provider %q {\n  version = %q\n  hashes = [\n    %s\n  ]\n}\n", registry.source, version, strings.Join(hashes, "\n    "))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, dependencyLockFile), []byte(lock), 0o600))
+		return dir, hash
+	}
+	verify := func(t *testing.T, registry *fakeRegistry, dir string, opts ProviderVerificationOptions) (int, error) {
+		t.Helper()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		return verifyProviders(ctx, dir, opts, newProviderRegistry(registry.Client()))
+	}
+
+	t.Run("Signed", func(t *testing.T) {
+		t.Parallel()
+		registry := newFakeRegistry(t, binary, []byte("provider"))
+		dir, _ := setup(t, registry, "INSTALLED", "zh:0123")
+		providers := newProviderRegistry(registry.Client())
+		ctx := testutil.Context(t, testutil.WaitLong)
+		verified, err := verifyProviders(ctx, dir, ProviderVerificationOptions{Enabled: true}, providers)
+		require.NoError(t, err)
+		require.Equal(t, 1, verified)
+
+		// Signed packages are only verified against the registry once.
+		requests := registry.requests.Load()
+		require.NotZero(t, requests)
+		_, err = verifyProviders(ctx, dir, ProviderVerificationOptions{Enabled: true}, providers)
+		require.NoError(t, err)
+		require.Equal(t, requests, registry.requests.Load())
+	})
+
+	t.Run("Modified", func(t *testing.T) {
+		t.Parallel()
+		registry := newFakeRegistry(t, binary, []byte("provider"))
+		dir, _ := setup(t, registry, "h1:other", "zh:0123")
+		_, err := verify(t, registry, dir, ProviderVerificationOptions{Enabled: true})
+		var untrusted *UntrustedProviderError
+		require.True(t, xerrors.As(err, &untrusted))
+		require.Equal(t, registry.source, untrusted.Provider)
+		require.Equal(t, version, untrusted.Version)
+		require.Contains(t, untrusted.Reason, "doesn't match the checksums")
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		t.Parallel()
+		// The lock file of the template vouches for the installed package,
+		// but the registry signed another one.
+		registry := newFakeRegistry(t, binary, []byte("released provider"))
+		dir, _ := setup(t, registry, "INSTALLED", "zh:0123")
+		_, err := verify(t, registry, dir, ProviderVerificationOptions{Enabled: true})
+		var untrusted *UntrustedProviderError
+		require.True(t, xerrors.As(err, &untrusted))
+		require.Contains(t, untrusted.Reason, "doesn't match the package signed by the registry")
+	})
+
+	t.Run("BadSignature", func(t *testing.T) {
+		t.Parallel()
+		registry := newFakeRegistry(t, binary, []byte("provider"))
+		registry.signer = newSigningKey(t)
+		dir, _ := setup(t, registry, "INSTALLED", "zh:0123")
+		_, err := verify(t, registry, dir, ProviderVerificationOptions{Enabled: true})
+		var untrusted *UntrustedProviderError
+		require.True(t, xerrors.As(err, &untrusted))
+		require.Contains(t, untrusted.Reason, "checksums aren't signed by the registry")
+	})
+
+	t.Run("Allowlisted", func(t *testing.T) {
+		t.Parallel()
+		// The registry isn't requested for allowlisted packages.
+		registry := newFakeRegistry(t, binary, []byte("released provider"))
+		dir, hash := setup(t, registry, "INSTALLED")
+		verified, err := verify(t, registry, dir, ProviderVerificationOptions{
+			TrustedHashes: map[string][]string{registry.source: {hash}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, verified)
+		require.Zero(t, registry.requests.Load())
+	})
+
+	t.Run("NotAllowlisted", func(t *testing.T) {
+		t.Parallel()
+		registry := newFakeRegistry(t, binary, []byte("provider"))
+		dir, _ := setup(t, registry, "INSTALLED", "zh:0123")
+		_, err := verify(t, registry, dir, ProviderVerificationOptions{
+			TrustedHashes: map[string][]string{registry.source: {"h1:other"}},
+		})
+		var untrusted *UntrustedProviderError
+		require.True(t, xerrors.As(err, &untrusted))
+		require.Contains(t, untrusted.Reason, "isn't in the allowlist")
+	})
+
+	t.Run("NotLocked", func(t *testing.T) {
+		t.Parallel()
+		registry := newFakeRegistry(t, binary, []byte("provider"))
+		dir, _ := setup(t, registry, "INSTALLED", "zh:0123")
+		require.NoError(t, os.WriteFile(filepath.Join(dir, dependencyLockFile), nil, 0o600))
+		_, err := verify(t, registry, dir, ProviderVerificationOptions{Enabled: true})
+		var untrusted *UntrustedProviderError
+		require.True(t, xerrors.As(err, &untrusted))
+		require.Contains(t, untrusted.Reason, "not in the dependency lock file")
+	})
+
+	t.Run("NoProviders", func(t *testing.T) {
+		t.Parallel()
+		registry := newFakeRegistry(t, binary, []byte("provider"))
+		verified, err := verify(t, registry, t.TempDir(), ProviderVerificationOptions{Enabled: true})
+		require.NoError(t, err)
+		require.Zero(t, verified)
+	})
+}
+
+// fakeRegistry is a provider registry serving a single release of the
+// "coder/coder" provider for linux_amd64.
+type fakeRegistry struct {
+	*httptest.Server
+	source string
+	// key signs the checksums of the release, and signer is the key the
+	// registry advertises.
+	key, signer *openpgp.Entity
+	archive     []byte
+	requests    atomic.Int64
+}
+
+func newFakeRegistry(t *testing.T, name string, content []byte) *fakeRegistry {
+	t.Helper()
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, err := zw.Create(name)
+	require.NoError(t, err)
+	_, err = w.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	key := newSigningKey(t)
+	r := &fakeRegistry{key: key, signer: key, archive: archive.Bytes()}
+	r.Server = httptest.NewTLSServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.Close)
+	r.source = r.Listener.Addr().String() + "/coder/coder"
+	return r
+}
+
+func (r *fakeRegistry) serveHTTP(rw http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	const filename = "terraform-provider-coder_0.12.0_linux_amd64.zip"
+	sum := sha256.Sum256(r.archive)
+	sums := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), filename)
+	switch req.URL.Path {
+	case "/.well-known/terraform.json":
+		_ = json.NewEncoder(rw).Encode(map[string]string{"providers.v1": "/v1/providers/"})
+	case "/v1/providers/coder/coder/0.12.0/download/linux/amd64":
+		var publicKey bytes.Buffer
+		w, _ := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+		_ = r.signer.Serialize(w)
+		_ = w.Close()
+		_ = json.NewEncoder(rw).Encode(map[string]any{
+			"filename":              filename,
+			"download_url":          "/files/" + filename,
+			"shasums_url":           "/files/SHA256SUMS",
+			"shasums_signature_url": "/files/SHA256SUMS.sig",
+			"shasum":                hex.EncodeToString(sum[:]),
+			"signing_keys": map[string]any{
+				"gpg_public_keys": []map[string]string{{"ascii_armor": publicKey.String()}},
+			},
+		})
+	case "/files/SHA256SUMS":
+		_, _ = rw.Write([]byte(sums))
+	case "/files/SHA256SUMS.sig":
+		_ = openpgp.DetachSign(rw, r.key, strings.NewReader(sums), nil)
+	case "/files/" + filename:
+		_, _ = rw.Write(r.archive)
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newSigningKey(t *testing.T) *openpgp.Entity {
+	t.Helper()
+	key, err := openpgp.NewEntity("registry", "", "registry@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	require.NoError(t, err)
+	return key
+}
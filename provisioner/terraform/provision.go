@@ -68,8 +68,13 @@ func (s *server) Plan(
 	ctx, cancel, killCtx, kill := s.setupContexts(ctx, canceledOrComplete)
 	defer cancel()
 	defer kill()
+	defer s.prewarm.begin()()
 
-	e := s.executor(sess.WorkDirectory)
+	binaryPath, err := s.binaryPathForModule(ctx, sess.WorkDirectory, sess)
+	if err != nil {
+		return provisionersdk.PlanErrorf("select terraform version: %s", err)
+	}
+	e := s.executor(sess.WorkDirectory, binaryPath)
 	if err := e.checkMinVersion(ctx); err != nil {
 		return provisionersdk.PlanErrorf(err.Error())
 	}
@@ -85,47 +90,221 @@ func (s *server) Plan(
 		return &proto.PlanComplete{}
 	}
 
+	// Copy the providers and modules of pre-warmed template versions before
+	// the state is written, since it isn't part of the template version.
+	s.prewarm.restore(ctx, sess.WorkDirectory, sess)
+
+	workspaces, err := parseTerraformWorkspaces(sess.WorkDirectory)
+	if err != nil {
+		return provisionersdk.PlanErrorf("parse terraform workspaces: %s", err)
+	}
 	statefilePath := getStateFilePath(sess.WorkDirectory)
-	if len(sess.Config.State) > 0 {
+	// bundled are the Terraform workspaces of the state, if the template no
+	// longer declares them.
+	var monolithic bool
+	var bundled []string
+	if len(workspaces) > 0 {
+		monolithic, err = writeWorkspaceStates(sess.WorkDirectory, workspaces, sess.Config.State)
+		if err != nil {
+			return provisionersdk.PlanErrorf("write terraform workspace states: %s", err)
+		}
+	} else if names, ok := bundledWorkspaces(sess.Config.State); ok {
+		_, err = writeWorkspaceStates(sess.WorkDirectory, names, sess.Config.State)
+		if err != nil {
+			return provisionersdk.PlanErrorf("write terraform workspace states: %s", err)
+		}
+		bundled = names
+	} else if len(sess.Config.State) > 0 {
 		err := os.WriteFile(statefilePath, sess.Config.State, 0o600)
 		if err != nil {
 			return provisionersdk.PlanErrorf("write statefile %q: %s", statefilePath, err)
 		}
 	}
 
-	err := CleanStaleTerraformPlugins(sess.Context(), s.cachePath, afero.NewOsFs(), time.Now(), s.logger)
+	// Checkpoints that can't be restored, e.g. plan checkpoints of older
+	// versions, don't fail the build, it just starts from scratch.
+	if checkpoint := request.GetCheckpoint(); checkpoint != nil {
+		err := restoreCheckpoint(sess.WorkDirectory, checkpoint)
+		if err != nil {
+			sess.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf("Ignoring the checkpoint of a previous attempt: %s", err))
+		} else {
+			sess.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf("Resuming the build after the %q stage of a previous attempt", checkpoint.Stage))
+		}
+	}
+
+	err = CleanStaleTerraformPlugins(sess.Context(), s.cachePath, afero.NewOsFs(), time.Now(), s.logger)
 	if err != nil {
 		return provisionersdk.PlanErrorf("unable to clean stale Terraform plugins: %s", err)
 	}
 
 	s.logger.Debug(ctx, "running initialization")
+	sess.ProvisionStage(provisionersdk.BuildStageInit)
 	err = e.init(ctx, killCtx, sess)
 	if err != nil {
 		s.logger.Debug(ctx, "init failed", slog.Error(err))
 		return provisionersdk.PlanErrorf("initialize terraform: %s", err)
 	}
 	s.logger.Debug(ctx, "ran initialization")
+	// Refreshes are never applied, so there's nothing to resume.
+	if !request.RefreshOnly {
+		sendCheckpoint(sess, provisionersdk.BuildStageInit)
+	}
 
 	env, err := provisionEnv(sess.Config, request.Metadata, request.RichParameterValues, request.ExternalAuthProviders)
 	if err != nil {
 		return provisionersdk.PlanErrorf("setup env: %s", err)
 	}
+	credentialsEnv, err := brokerCredentials(sess.WorkDirectory, s.providerCredentials, request.Metadata, request.ExternalAuthProviders, sess)
+	if err != nil {
+		return provisionersdk.PlanErrorf("broker provider credentials: %s", err)
+	}
+	env = append(env, credentialsEnv...)
+
+	agentTokens, err := generateAgentTokens(sess.WorkDirectory, sess)
+	if err != nil {
+		return provisionersdk.PlanErrorf("generate agent tokens: %s", err)
+	}
+	env = append(env, agentTokenEnv(agentTokens)...)
+
+	tags := resourceTags(request.Metadata)
+	tagsEnv, err := resourceTagsEnv(sess.WorkDirectory, tags)
+	if err != nil {
+		return provisionersdk.PlanErrorf("resource tags: %s", err)
+	}
+	if len(tagsEnv) > 0 {
+		env = append(env, tagsEnv...)
+		e.resourceTags = tags
+	}
 
-	vars, err := planVars(request)
+	e.maxAppSharingLevel, err = maxAppSharingLevel(request.Metadata)
+	if err != nil {
+		return provisionersdk.PlanErrorf("app sharing level: %s", err)
+	}
+	if request.Metadata != nil {
+		appHostname := request.Metadata.GetWorkspaceAppHostname()
+		e.appHostname = &appHostname
+	}
+	for _, value := range request.RichParameterValues {
+		if value.Name == RestoreSnapshotParameterName {
+			e.restoreSnapshot = value.Value
+		}
+	}
+
+	selectedCapacity := request.Metadata.GetCapacityOption()
+	capacityOptions, err := writeCapacityFallback(sess.WorkDirectory, request.VariableValues, selectedCapacity)
+	if err != nil {
+		return provisionersdk.PlanErrorf("capacity fallback: %s", err)
+	}
+	if len(capacityOptions) > 0 && capacityOptions[0] == selectedCapacity {
+		sess.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf("Starting with capacity option %q, which the previous build succeeded with", selectedCapacity))
+	}
+
+	secrets, err := resolveSecretVariables(ctx, s.secretsResolvers, request.VariableValues, sess)
+	if err != nil {
+		return provisionersdk.PlanErrorf("resolve secret variables: %s", err)
+	}
+	secretsVarFile, err := writeSecretVariables(sess.WorkDirectory, secrets)
+	if err != nil {
+		return provisionersdk.PlanErrorf("secret variables: %s", err)
+	}
+	if secretsVarFile != "" {
+		e.varFiles = append(e.varFiles, secretsVarFile)
+	}
+
+	vars, err := planVars(request, secrets)
 	if err != nil {
 		return provisionersdk.PlanErrorf("plan vars: %s", err)
 	}
+	if len(capacityOptions) > 0 {
+		vars, err = withCapacityVar(vars, capacityOptions)
+		if err != nil {
+			return provisionersdk.PlanErrorf("capacity fallback: %s", err)
+		}
+	}
 
-	resp, err := e.plan(
-		ctx, killCtx, env, vars, sess,
-		request.Metadata.GetWorkspaceTransition() == proto.WorkspaceTransition_DESTROY,
-	)
+	if monolithic {
+		err = e.migrateMonolithicState(ctx, killCtx, workspaces, env, vars, redactSecrets(sess, secrets))
+		if err != nil {
+			return provisionersdk.PlanErrorf("move state into terraform workspaces: %s", err)
+		}
+	}
+	if len(bundled) > 0 {
+		err = e.unbundleWorkspaceStates(ctx, killCtx, bundled, redactSecrets(sess, secrets))
+		if err != nil {
+			return provisionersdk.PlanErrorf("move terraform workspace states into the default workspace: %s", err)
+		}
+	}
+
+	// Failed resources can't be retried on their own, nor the resources of
+	// unhealthy agents replaced, in templates with Terraform workspaces,
+	// since their addresses are ambiguous across workspaces, nor in the build
+	// moving their states out of workspaces.
+	var targets []string
+	if len(workspaces) == 0 && len(bundled) == 0 && !request.RefreshOnly {
+		targets, err = planTargets(sess, request, sess.Config.State, func() (string, error) {
+			return e.graph(ctx, killCtx)
+		})
+		if err != nil {
+			return provisionersdk.PlanErrorf("find failed resources: %s", err)
+		}
+		if request.Metadata.GetReplaceOnFailure() {
+			e.replaceResources = request.Metadata.GetReplaceResources()
+		}
+	}
+
+	sess.ProvisionStage(provisionersdk.BuildStagePlan)
+	destroy := request.Metadata.GetWorkspaceTransition() == proto.WorkspaceTransition_DESTROY
+	if request.RefreshOnly {
+		sess.ProvisionLog(proto.LogLevel_INFO, "Refreshing the state of the resources, no changes will be made")
+		e.refreshOnly = true
+	}
+	// The logs of the plan are recorded for the diagnostic bundle.
+	logs := &recordingLogSink{logSink: sess}
+	var resp *proto.PlanComplete
+	if len(workspaces) > 0 {
+		resp, err = e.planWorkspaces(ctx, killCtx, workspaces, env, vars, redactSecrets(logs, secrets), destroy)
+	} else {
+		resp, err = e.plan(ctx, killCtx, env, vars, targets, redactSecrets(logs, secrets), destroy)
+	}
 	if err != nil {
-		return provisionersdk.PlanErrorf(err.Error())
+		return &proto.PlanComplete{
+			Error:            err.Error(),
+			ErrorCode:        planErrorCode(err),
+			DiagnosticBundle: e.diagnosticBundle(ctx, killCtx, logs.recorded()),
+		}
+	}
+	redactSecretMetadata(resp.Resources, secrets)
+	applyAgentTokens(resp.Resources, agentTokens)
+	parameterSources(resp.Parameters, request.RichParameterValues)
+	err = mutate(ctx, MutateStagePlan, request.Metadata, &resp.Resources, &resp.Parameters)
+	if err != nil {
+		return provisionersdk.PlanErrorf("mutate plan: %s", err)
+	}
+	resp.ParameterSchema, err = provisionersdk.ParametersJSONSchema(resp.Parameters)
+	if err != nil {
+		return provisionersdk.PlanErrorf("parameter schema: %s", err)
 	}
 	return resp
 }
 
+// parameterSources sets where the values of the parameters came from. Only
+// the caller knows whether a value was entered, even if it's equal to the
+// default, so the source it reported is used as is. Parameters it sent no
+// value for use the template default.
+func parameterSources(parameters []*proto.RichParameter, values []*proto.RichParameterValue) {
+	sources := make(map[string]proto.ParameterSource, len(values))
+	for _, value := range values {
+		sources[value.Name] = value.Source
+	}
+	for _, parameter := range parameters {
+		source, ok := sources[parameter.Name]
+		if !ok {
+			source = proto.ParameterSource_TEMPLATE_DEFAULT
+		}
+		parameter.DefaultSource = source
+	}
+}
+
 func (s *server) Apply(
 	sess *provisionersdk.Session, request *proto.ApplyRequest, canceledOrComplete <-chan struct{},
 ) *proto.ApplyComplete {
@@ -134,11 +313,26 @@ func (s *server) Apply(
 	ctx, cancel, killCtx, kill := s.setupContexts(ctx, canceledOrComplete)
 	defer cancel()
 	defer kill()
+	defer s.prewarm.begin()()
+	// The credentials brokered and the plan kept by Plan() are scoped
+	// to the build.
+	defer func() {
+		err := removeBrokeredCredentials(sess.WorkDirectory)
+		if err != nil {
+			s.logger.Warn(ctx, "remove brokered provider credentials", slog.Error(err))
+		}
+		s.retryPlans.remove(sess.WorkDirectory)
+	}()
 
-	e := s.executor(sess.WorkDirectory)
+	binaryPath, err := s.binaryPathForModule(ctx, sess.WorkDirectory, sess)
+	if err != nil {
+		return provisionersdk.ApplyErrorf("select terraform version: %s", err)
+	}
+	e := s.executor(sess.WorkDirectory, binaryPath)
 	if err := e.checkMinVersion(ctx); err != nil {
 		return provisionersdk.ApplyErrorf(err.Error())
 	}
+	e.replaceOnFailure = request.Metadata.GetReplaceOnFailure()
 	logTerraformEnvVars(sess)
 
 	// Exit early if there is no plan file. This is necessary to
@@ -157,25 +351,81 @@ func (s *server) Apply(
 	if err != nil {
 		return provisionersdk.ApplyErrorf("provision env: %s", err)
 	}
-	resp, err := e.apply(
-		ctx, killCtx, env, sess,
-	)
+	credentialsEnv, err := brokeredCredentialsEnv(sess.WorkDirectory)
+	if err != nil {
+		return provisionersdk.ApplyErrorf("provider credentials: %s", err)
+	}
+	env = append(env, credentialsEnv...)
+	agentTokens, err := readAgentTokens(sess.WorkDirectory)
+	if err != nil {
+		return provisionersdk.ApplyErrorf("read agent tokens: %s", err)
+	}
+	secrets, err := readSecretVariables(sess.WorkDirectory)
+	if err != nil {
+		return provisionersdk.ApplyErrorf("secret variables: %s", err)
+	}
+	// Only starting a workspace creates network and compute.
+	var reportStage func(stage provisionersdk.BuildStage)
+	if request.Metadata.GetWorkspaceTransition() == proto.WorkspaceTransition_START {
+		reportStage = sess.ProvisionStage
+	}
+	workspaces, err := parseTerraformWorkspaces(sess.WorkDirectory)
+	if err != nil {
+		return provisionersdk.ApplyErrorf("parse terraform workspaces: %s", err)
+	}
+	// The logs of the apply are recorded for the diagnostic bundle.
+	logs := &recordingLogSink{logSink: sess}
+	var resp *proto.ApplyComplete
+	if len(workspaces) > 0 {
+		destroy := request.Metadata.GetWorkspaceTransition() == proto.WorkspaceTransition_DESTROY
+		resp, err = e.applyWorkspaces(
+			ctx, killCtx, workspaces, env, redactSecrets(logs, secrets), reportStage, destroy,
+		)
+	} else {
+		resp, err = e.apply(
+			ctx, killCtx, env, redactSecrets(logs, secrets), reportStage,
+		)
+	}
 	if err != nil {
 		errorMessage := err.Error()
 		// Terraform can fail and apply and still need to store it's state.
 		// In this case, we return Complete with an explicit error message.
-		stateData, _ := os.ReadFile(statefilePath)
+		var stateData []byte
+		if len(workspaces) > 0 {
+			stateData, _ = readWorkspaceStates(sess.WorkDirectory, workspaces)
+		} else {
+			stateData, _ = os.ReadFile(statefilePath)
+			logFailedResources(redactSecrets(sess, secrets), stateData)
+		}
 		return &proto.ApplyComplete{
-			State: stateData,
-			Error: errorMessage,
+			State:            stateData,
+			Error:            errorMessage,
+			DiagnosticBundle: e.diagnosticBundle(ctx, killCtx, logs.recorded()),
+		}
+	}
+	redactSecretMetadata(resp.Resources, secrets)
+	redactSecretMetadataItems(resp.WorkspaceMetadata, secrets)
+	applyAgentTokens(resp.Resources, agentTokens)
+	err = mutate(ctx, MutateStageApply, request.Metadata, &resp.Resources, &resp.Parameters)
+	if err != nil {
+		// The resources were created, so the state is kept for them to be
+		// destroyed.
+		return &proto.ApplyComplete{
+			State: resp.State,
+			Error: fmt.Sprintf("mutate apply: %s", err),
 		}
 	}
 	return resp
 }
 
-func planVars(plan *proto.PlanRequest) ([]string, error) {
+// planVars returns the "-var" arguments of the variables, except the
+// secrets passed in a variable file.
+func planVars(plan *proto.PlanRequest, secrets secretVariables) ([]string, error) {
 	vars := []string{}
 	for _, variable := range plan.VariableValues {
+		if _, ok := secrets[variable.Name]; ok {
+			continue
+		}
 		vars = append(vars, fmt.Sprintf("%s=%s", variable.Name, variable.Value))
 	}
 	return vars, nil
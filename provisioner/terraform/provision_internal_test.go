@@ -0,0 +1,39 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestParameterSources(t *testing.T) {
+	t.Parallel()
+
+	parameters := []*proto.RichParameter{
+		{Name: "region", DefaultValue: "eu"},
+		{Name: "size"},
+		{Name: "image"},
+		{Name: "dotfiles"},
+		{Name: "shell", DefaultValue: "bash"},
+	}
+	parameterSources(parameters, []*proto.RichParameterValue{
+		// An entered value equal to the default is still user input.
+		{Name: "region", Value: "eu", Source: proto.ParameterSource_USER_INPUT},
+		{Name: "size", Value: "large", Source: proto.ParameterSource_PRESET},
+		{Name: "image", Value: "ubuntu", Source: proto.ParameterSource_PREVIOUS_BUILD},
+		{Name: "dotfiles", Value: "https://example.com"},
+	})
+	sources := make(map[string]proto.ParameterSource, len(parameters))
+	for _, parameter := range parameters {
+		sources[parameter.Name] = parameter.DefaultSource
+	}
+	require.Equal(t, map[string]proto.ParameterSource{
+		"region":   proto.ParameterSource_USER_INPUT,
+		"size":     proto.ParameterSource_PRESET,
+		"image":    proto.ParameterSource_PREVIOUS_BUILD,
+		"dotfiles": proto.ParameterSource_SOURCE_UNSPECIFIED,
+		"shell":    proto.ParameterSource_TEMPLATE_DEFAULT,
+	}, sources)
+}
@@ -31,6 +31,7 @@ import (
 type provisionerServeOptions struct {
 	binaryPath  string
 	exitTimeout time.Duration
+	hangTimeout time.Duration
 }
 
 func setupProvisioner(t *testing.T, opts *provisionerServeOptions) (context.Context, proto.DRPCProvisionerClient) {
@@ -61,6 +62,7 @@ func setupProvisioner(t *testing.T, opts *provisionerServeOptions) (context.Cont
 			BinaryPath:  opts.binaryPath,
 			CachePath:   cachePath,
 			ExitTimeout: opts.exitTimeout,
+			HangTimeout: opts.hangTimeout,
 		})
 	}()
 	api := proto.NewDRPCProvisionerClient(client)
@@ -282,6 +284,49 @@ func TestProvision_CancelTimeout(t *testing.T) {
 	}
 }
 
+// below we exec fake_cancel_hang.sh, which causes the kernel to execute it, and if more than
+// one process tries to do this, it can cause "text file busy"
+// nolint: paralleltest
+func TestProvision_HangTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("This test uses a shell script and is not supported on Windows")
+	}
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	fakeBin := filepath.Join(cwd, "testdata", "fake_cancel_hang.sh")
+
+	dir := t.TempDir()
+	binPath := filepath.Join(dir, "terraform")
+
+	content := fmt.Sprintf("#!/bin/sh\nexec %q %s \"$@\"\n", fakeBin, terraform.TerraformVersion.String())
+	err = os.WriteFile(binPath, []byte(content), 0o755) //#nosec
+	require.NoError(t, err)
+
+	ctx, api := setupProvisioner(t, &provisionerServeOptions{
+		binaryPath:  binPath,
+		hangTimeout: time.Second,
+	})
+
+	sess := configure(ctx, t, api, &proto.Config{
+		TemplateSourceArchive: makeTar(t, nil),
+	})
+
+	// The plan of the fake binary sleeps without writing any output.
+	err = sendPlan(sess, proto.WorkspaceTransition_START)
+	require.NoError(t, err)
+
+	for {
+		msg, err := sess.Recv()
+		require.NoError(t, err)
+
+		if c := msg.GetPlan(); c != nil {
+			require.Contains(t, c.Error, "terraform plan made no progress for 1s")
+			break
+		}
+	}
+}
+
 func TestProvision(t *testing.T) {
 	t.Parallel()
 
@@ -635,6 +680,10 @@ func TestProvision(t *testing.T) {
 				parametersWant, err := json.Marshal(testCase.Response.Parameters)
 				require.NoError(t, err)
 				require.Equal(t, string(parametersWant), string(parametersGot))
+
+				schemaWant, err := provisionersdk.ParametersJSONSchema(testCase.Response.Parameters)
+				require.NoError(t, err)
+				require.JSONEq(t, string(schemaWant), string(planComplete.ParameterSchema))
 			}
 
 			if testCase.Apply {
@@ -0,0 +1,78 @@
+package terraform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// untaintedResources returns the addresses that refer to resource instances
+// in the raw state that aren't tainted already. Resources that failed to be
+// created may not be in the state at all.
+func untaintedResources(state []byte, addresses []string) ([]string, error) {
+	if len(state) == 0 || len(addresses) == 0 {
+		return nil, nil
+	}
+	var parsed rawState
+	err := json.Unmarshal(state, &parsed)
+	if err != nil {
+		return nil, xerrors.Errorf("parse state: %w", err)
+	}
+	untainted := make(map[string]bool)
+	for _, resource := range parsed.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		for _, instance := range resource.Instances {
+			if instance.Status != "tainted" {
+				untainted[resource.instanceAddress(instance.IndexKey)] = true
+			}
+		}
+	}
+	taint := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if untainted[address] {
+			taint = append(taint, address)
+			// Ignore duplicates.
+			untainted[address] = false
+		}
+	}
+	return taint, nil
+}
+
+// taintResources marks the resources in the state as tainted, so the next
+// apply replaces them. The message is logged with the addresses of the
+// resources that are tainted.
+//
+// taintResources must only be called while the lock is held.
+func (e *executor) taintResources(ctx, killCtx context.Context, env, addresses []string, message string, logr logSink) error {
+	state, err := os.ReadFile(e.stateFilePath())
+	if err != nil {
+		return xerrors.Errorf("read statefile: %w", err)
+	}
+	taint, err := untaintedResources(state, addresses)
+	if err != nil {
+		return err
+	}
+	if len(taint) == 0 {
+		return nil
+	}
+	logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf("%s: %s", message, strings.Join(taint, ", ")))
+	for _, address := range taint {
+		outWriter, doneOut := logWriter(logr, proto.LogLevel_DEBUG)
+		errWriter, doneErr := logWriter(logr, proto.LogLevel_ERROR)
+		err := e.execWriteOutput(ctx, killCtx, []string{"taint", "-no-color", "-allow-missing", address}, env, outWriter, errWriter)
+		<-doneOut
+		<-doneErr
+		if err != nil {
+			return xerrors.Errorf("taint %s: %w", address, err)
+		}
+	}
+	return nil
+}
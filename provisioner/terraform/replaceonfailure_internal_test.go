@@ -0,0 +1,48 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUntaintedResources(t *testing.T) {
+	t.Parallel()
+
+	taint, err := untaintedResources([]byte(partiallyAppliedState), []string{
+		"docker_volume.home",
+		"docker_volume.home",
+		// Already tainted.
+		"docker_container.workspace[0]",
+		// Failed to be created.
+		"docker_image.main",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"docker_volume.home"}, taint)
+
+	taint, err = untaintedResources(nil, []string{"docker_volume.home"})
+	require.NoError(t, err)
+	require.Empty(t, taint)
+}
+
+func TestProvisionReadAndLog_OnLog(t *testing.T) {
+	t.Parallel()
+
+	logr := &mockLogger{}
+	var hooks []*terraformProvisionHook
+	done := make(chan any)
+	provisionReadAndLog(logr, strings.NewReader(
+		`{"@level":"info","@message":"docker_volume.home: Modifying...","type":"apply_start","hook":{"resource":{"addr":"docker_volume.home"},"action":"update"}}`+"\n"+
+			`{"@level":"error","@message":"docker_volume.home: Modifications errored after 1s","type":"apply_errored","hook":{"resource":{"addr":"docker_volume.home"},"action":"update"}}`+"\n",
+	), done, func(log *terraformProvisionLog) {
+		if log.Type == "apply_errored" {
+			hooks = append(hooks, log.Hook)
+		}
+	})
+	<-done
+	require.Len(t, logr.logs, 2)
+	require.Len(t, hooks, 1)
+	require.Equal(t, "docker_volume.home", hooks[0].Resource.Addr)
+	require.Equal(t, "update", hooks[0].Action)
+}
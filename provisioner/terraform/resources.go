@@ -2,12 +2,16 @@ package terraform
 
 import (
 	"fmt"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/awalterschulze/gographviz"
 	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/mitchellh/mapstructure"
 	"golang.org/x/xerrors"
+	protobuf "google.golang.org/protobuf/proto"
 
 	"github.com/coder/terraform-provider-coder/provider"
 
@@ -26,6 +30,10 @@ type agentMetadata struct {
 	Interval    int64  `mapstructure:"interval"`
 	Timeout     int64  `mapstructure:"timeout"`
 	Order       int64  `mapstructure:"order"`
+	// Collector collects the metadata with a built-in collector of the
+	// agent instead of running the script. No released version of the coder
+	// provider has it yet, and the provider requires the script.
+	Collector string `mapstructure:"collector"`
 }
 
 // A mapping of attributes on the "coder_agent" resource.
@@ -37,6 +45,9 @@ type agentAttributes struct {
 	ID              string            `mapstructure:"id"`
 	Token           string            `mapstructure:"token"`
 	Env             map[string]string `mapstructure:"env"`
+	// External marks an agent running on a machine that is not managed by
+	// the template, so no resource in the graph is expected to depend on it.
+	External bool `mapstructure:"external"`
 	// Deprecated, but remains here for backwards compatibility.
 	StartupScript                string `mapstructure:"startup_script"`
 	StartupScriptBehavior        string `mapstructure:"startup_script_behavior"`
@@ -50,8 +61,15 @@ type agentAttributes struct {
 	MOTDFile                 string                       `mapstructure:"motd_file"`
 	Metadata                 []agentMetadata              `mapstructure:"metadata"`
 	DisplayApps              []agentDisplayAppsAttributes `mapstructure:"display_apps"`
+	// TroubleshootingURLs override TroubleshootingURL for specific failures
+	// of the agent. No released version of the coder provider has them yet.
+	TroubleshootingURLs []agentTroubleshootingURLsAttributes `mapstructure:"troubleshooting_urls"`
 }
 
+// ExternalAgentResourceType is the type of the synthetic resource that
+// externally managed agents are attached to.
+const ExternalAgentResourceType = "coder_external_agent"
+
 type agentDisplayAppsAttributes struct {
 	VSCode               bool `mapstructure:"vscode"`
 	VSCodeInsiders       bool `mapstructure:"vscode_insiders"`
@@ -60,6 +78,12 @@ type agentDisplayAppsAttributes struct {
 	PortForwardingHelper bool `mapstructure:"port_forwarding_helper"`
 }
 
+type agentTroubleshootingURLsAttributes struct {
+	ConnectionTimeout string `mapstructure:"connection_timeout"`
+	StartError        string `mapstructure:"start_error"`
+	TokenInvalid      string `mapstructure:"token_invalid"`
+}
+
 // A mapping of attributes on the "coder_app" resource.
 type agentAppAttributes struct {
 	AgentID string `mapstructure:"agent_id"`
@@ -91,11 +115,29 @@ type agentScriptAttributes struct {
 	Icon             string `mapstructure:"icon"`
 	Script           string `mapstructure:"script"`
 	Cron             string `mapstructure:"cron"`
+	Timezone         string `mapstructure:"timezone"`
 	LogPath          string `mapstructure:"log_path"`
 	StartBlocksLogin bool   `mapstructure:"start_blocks_login"`
 	RunOnStart       bool   `mapstructure:"run_on_start"`
 	RunOnStop        bool   `mapstructure:"run_on_stop"`
-	TimeoutSeconds   int32  `mapstructure:"timeout"`
+	// RunOnBuildSuccess and RunOnBuildFailure run the script once the
+	// workspace build completes, e.g. to prime caches.
+	RunOnBuildSuccess bool `mapstructure:"run_on_build_success"`
+	RunOnBuildFailure bool `mapstructure:"run_on_build_failure"`
+	// RunOnPostStart runs the script once the agent is ready, so it doesn't
+	// delay the startup of the workspace. No released version of the coder
+	// provider has it yet.
+	RunOnPostStart bool `mapstructure:"run_on_post_start"`
+	// Login runs the script with the environment of a login shell of the
+	// user, i.e. after sourcing their profile files. No released version of
+	// the coder provider has it yet.
+	Login bool `mapstructure:"login"`
+	// DiskPressurePath makes the script a cleanup script, which the agent
+	// runs once the disk usage of the path crosses DiskPressureThreshold
+	// percent.
+	DiskPressurePath      string `mapstructure:"disk_pressure_path"`
+	DiskPressureThreshold int32  `mapstructure:"disk_pressure_threshold"`
+	TimeoutSeconds        int32  `mapstructure:"timeout"`
 }
 
 // A mapping of attributes on the "healthcheck" resource.
@@ -105,6 +147,54 @@ type appHealthcheckAttributes struct {
 	Threshold int32  `mapstructure:"threshold"`
 }
 
+// The interval of app healthchecks in seconds, and the number of failed
+// healthchecks before an app is unhealthy, must be within these bounds.
+const (
+	maxAppHealthcheckInterval  = 3600
+	maxAppHealthcheckThreshold = 100
+)
+
+// InvalidHealthcheckError is returned by ConvertStateWithOptions when
+// converting a plan and the healthcheck of an app would never mark it
+// healthy, e.g. because the URL can't be parsed.
+type InvalidHealthcheckError struct {
+	App string
+	// Field is the invalid attribute of the healthcheck.
+	Field  string
+	Reason string
+}
+
+func (e *InvalidHealthcheckError) Error() string {
+	return fmt.Sprintf("app %q has an invalid healthcheck %s: %s", e.App, e.Field, e.Reason)
+}
+
+// validate returns an *InvalidHealthcheckError if the healthcheck is invalid.
+// Attributes only known after apply are zero during plan, so zero values
+// aren't validated.
+func (h appHealthcheckAttributes) validate(app string) error {
+	invalid := func(field, format string, args ...any) error {
+		return &InvalidHealthcheckError{App: app, Field: field, Reason: fmt.Sprintf(format, args...)}
+	}
+	if h.URL != "" {
+		u, err := url.Parse(h.URL)
+		switch {
+		case err != nil:
+			return invalid("url", "%s", err)
+		case u.Scheme != "http" && u.Scheme != "https":
+			return invalid("url", "%q must use http or https", h.URL)
+		case u.Host == "":
+			return invalid("url", "%q has no host", h.URL)
+		}
+	}
+	if h.Interval != 0 && (h.Interval < 1 || h.Interval > maxAppHealthcheckInterval) {
+		return invalid("interval", "%d must be between 1 and %d seconds", h.Interval, maxAppHealthcheckInterval)
+	}
+	if h.Threshold != 0 && (h.Threshold < 1 || h.Threshold > maxAppHealthcheckThreshold) {
+		return invalid("threshold", "%d must be between 1 and %d", h.Threshold, maxAppHealthcheckThreshold)
+	}
+	return nil
+}
+
 // A mapping of attributes on the "coder_metadata" resource.
 type resourceMetadataAttributes struct {
 	ResourceID string                 `mapstructure:"resource_id"`
@@ -119,41 +209,216 @@ type resourceMetadataItem struct {
 	Value     string `mapstructure:"value"`
 	Sensitive bool   `mapstructure:"sensitive"`
 	IsNull    bool   `mapstructure:"is_null"`
+	Order     int64  `mapstructure:"order"`
+	Group     string `mapstructure:"group"`
+}
+
+// A mapping of attributes on the "coder_workspace_network" resource.
+type workspaceNetworkAttributes struct {
+	PreferredDERPRegion      string `mapstructure:"preferred_derp_region"`
+	DisableDirectConnections bool   `mapstructure:"disable_direct_connections"`
+	MTU                      int32  `mapstructure:"mtu"`
+}
+
+// The MTU of the tunnel may be overridden within these bounds. IPv6 requires
+// at least 1280 bytes, and the tunnel's packets must fit in a jumbo frame.
+const (
+	minWorkspaceNetworkMTU = 1280
+	maxWorkspaceNetworkMTU = 9000
+)
+
+// UnsupportedAgentPlatformError is returned by ConvertState when an agent
+// targets an operating system or architecture the agent isn't built for.
+type UnsupportedAgentPlatformError struct {
+	Agent           string
+	OperatingSystem string
+	Architecture    string
+	// Supported maps the supported operating systems to their supported
+	// architectures.
+	Supported map[string][]string
+}
+
+func (e *UnsupportedAgentPlatformError) Error() string {
+	architectures, ok := e.Supported[e.OperatingSystem]
+	if !ok {
+		operatingSystems := make([]string, 0, len(e.Supported))
+		for operatingSystem := range e.Supported {
+			operatingSystems = append(operatingSystems, operatingSystem)
+		}
+		sort.Strings(operatingSystems)
+		return fmt.Sprintf("agent %q has unsupported os %q, must be one of: %s",
+			e.Agent, e.OperatingSystem, strings.Join(operatingSystems, ", "))
+	}
+	return fmt.Sprintf("agent %q has unsupported arch %q for os %q, must be one of: %s",
+		e.Agent, e.Architecture, e.OperatingSystem, strings.Join(architectures, ", "))
+}
+
+// DefaultMaxModuleDepth is the deepest nesting of modules converted if the
+// options don't set a limit.
+const DefaultMaxModuleDepth = 32
+
+// ModuleDepthError is returned by ConvertState when modules are nested
+// deeper than allowed.
+type ModuleDepthError struct {
+	Module   string
+	MaxDepth int
+}
+
+func (e *ModuleDepthError) Error() string {
+	return fmt.Sprintf("module %q is nested deeper than the maximum depth of %d", e.Module, e.MaxDepth)
+}
+
+// GraphCycleError is returned by ConvertState when the dependency graph of
+// the resources has a cycle, which Terraform itself forbids.
+type GraphCycleError struct {
+	// Cycle are the labels of the nodes of the cycle, starting and ending
+	// with the same node.
+	Cycle []string
+}
+
+func (e *GraphCycleError) Error() string {
+	return fmt.Sprintf("dependency cycle in graph: %s", strings.Join(e.Cycle, " -> "))
+}
+
+// validateAgentPlatform returns an *UnsupportedAgentPlatformError if the agent
+// binary isn't built for the os and arch. Unset values aren't validated.
+func validateAgentPlatform(name, operatingSystem, architecture string) error {
+	if operatingSystem == "" {
+		return nil
+	}
+	supported := provisionersdk.AgentPlatforms()
+	architectures, ok := supported[operatingSystem]
+	if ok && (architecture == "" || slice.Contains(architectures, architecture)) {
+		return nil
+	}
+	return &UnsupportedAgentPlatformError{
+		Agent:           name,
+		OperatingSystem: operatingSystem,
+		Architecture:    architecture,
+		Supported:       supported,
+	}
 }
 
 type State struct {
 	Resources             []*proto.Resource
 	Parameters            []*proto.RichParameter
 	ExternalAuthProviders []string
+	// Topology associates the resources with their agents and apps.
+	Topology *Topology
+	// Cost breaks the daily cost of the resources down by module.
+	Cost *Cost
+	// Network tunes the connectivity of the agents, nil if the template
+	// doesn't have a coder_workspace_network.
+	Network *proto.WorkspaceNetwork
+	// WorkspaceMetadata are the outputs of the template, set after an apply.
+	WorkspaceMetadata []*proto.Resource_Metadata
+	// AppURLDiagnostics warn about apps with urls that can't be proxied.
+	AppURLDiagnostics []*proto.AppURLDiagnostic
+	// Warnings are reported to the logs of an apply, e.g. about metadata
+	// truncated to fit the size limits. The resources of an applied state
+	// exist, so what would fail a plan is repaired and reported instead.
+	Warnings []string
+	// CapacityFallback records the capacity options tried by an apply, nil
+	// if the template doesn't set coder_capacity_fallback.
+	CapacityFallback *proto.CapacityFallback
+}
+
+// ConvertOptions are policies enforced while converting state.
+type ConvertOptions struct {
+	// Plan is set when converting the planned values of a plan or import.
+	// Invalid app healthchecks only fail plans: the resources of an applied
+	// state exist, so they're always converted to be stored.
+	Plan bool
+	// MaxAppSharingLevel is the widest sharing level apps may use. Apps
+	// aren't limited if nil.
+	MaxAppSharingLevel *proto.AppSharingLevel
+	// AppHostname is the wildcard hostname of the deployment apps are
+	// served on, empty if it has none. The urls of apps are only checked
+	// against the deployment if it's set.
+	AppHostname *string
+	// MaxModuleDepth limits the nesting of modules. Defaults to
+	// DefaultMaxModuleDepth.
+	MaxModuleDepth int
+	// MaxMetadataValueSize limits the value of a metadata item of a
+	// resource, and the script of a metadata item of an agent, in
+	// characters. Keys and display names are limited by their columns.
+	// Defaults to DefaultMaxMetadataValueSize. Plans exceeding a limit
+	// fail, applied metadata is truncated with a warning.
+	MaxMetadataValueSize int
+	// MaxMetadataTotalSize limits the total size of the metadata of all
+	// resources and agents, in characters. Defaults to
+	// DefaultMaxMetadataTotalSize.
+	MaxMetadataTotalSize int
+	// ResourceChanges are the changes of the plan being converted. The
+	// attributes of agents and apps only known after apply are listed in
+	// their unknown attributes, so they can be told apart from empty ones,
+	// and resources are annotated with the action the plan takes.
+	ResourceChanges []*tfjson.ResourceChange
+	// AppliedChanges are the changes of the plan an applied state was
+	// applied from. Resources are annotated with the action the plan took.
+	AppliedChanges []*tfjson.ResourceChange
 }
 
 // ConvertState consumes Terraform state and a GraphViz representation
 // produced by `terraform graph` to produce resources consumable by Coder.
-// nolint:gocognit // This function makes more sense being large for now, until refactored.
 func ConvertState(modules []*tfjson.StateModule, rawGraph string) (*State, error) {
-	parsedGraph, err := gographviz.ParseString(rawGraph)
-	if err != nil {
-		return nil, xerrors.Errorf("parse graph: %w", err)
-	}
-	graph, err := gographviz.NewAnalysedGraph(parsedGraph)
-	if err != nil {
-		return nil, xerrors.Errorf("analyze graph: %w", err)
-	}
+	return ConvertStateWithOptions(modules, rawGraph, ConvertOptions{})
+}
+
+// ConvertStateWithOptions is ConvertState, enforcing the policies of opts.
+// nolint:gocognit // This function makes more sense being large for now, until refactored.
+func ConvertStateWithOptions(modules []*tfjson.StateModule, rawGraph string, opts ConvertOptions) (*State, error) {
+	// Parsing the graph dominates the conversion of large states, so it's
+	// parsed while the modules are walked.
+	parsedGraph := make(chan graphParseResult, 1)
+	go func() {
+		graph, err := parseGraph(rawGraph)
+		parsedGraph <- graphParseResult{graph: graph, err: err}
+	}()
 
 	resources := make([]*proto.Resource, 0)
 	resourceAgents := map[string][]*proto.Agent{}
+	// Labels of the synthetic resources created for external agents.
+	externalAgentLabels := make([]string, 0)
 
 	// Indexes Terraform resources by their label.
 	// The label is what "terraform graph" uses to reference nodes.
 	tfResourcesByLabel := map[string]map[string]*tfjson.StateResource{}
 
+	// Indexes Terraform resources by their type, in the order of the state.
+	tfResourcesByType := map[string][]*tfjson.StateResource{}
+
 	// Extra array to preserve the order of rich parameters.
 	tfResourcesRichParameters := make([]*tfjson.StateResource, 0)
 
-	var findTerraformResources func(mod *tfjson.StateModule)
-	findTerraformResources = func(mod *tfjson.StateModule) {
+	// Addresses of the modules declaring the resources, by the address of
+	// the resource.
+	tfResourceModules := map[string]string{}
+	cost := newCostBuilder()
+	unknown := unknownAttributes(opts.ResourceChanges)
+	changes := opts.ResourceChanges
+	if changes == nil {
+		changes = opts.AppliedChanges
+	}
+	actions := plannedActions(changes)
+
+	metadataSizes := newMetadataSizes(opts)
+	var warnings []string
+	maxModuleDepth := opts.MaxModuleDepth
+	if maxModuleDepth <= 0 {
+		maxModuleDepth = DefaultMaxModuleDepth
+	}
+	var findTerraformResources func(mod *tfjson.StateModule, depth int) error
+	findTerraformResources = func(mod *tfjson.StateModule, depth int) error {
+		if depth > maxModuleDepth {
+			return &ModuleDepthError{Module: mod.Address, MaxDepth: maxModuleDepth}
+		}
 		for _, module := range mod.ChildModules {
-			findTerraformResources(module)
+			cost.addModule(module.Address, mod.Address)
+			err := findTerraformResources(module, depth+1)
+			if err != nil {
+				return err
+			}
 		}
 		for _, resource := range mod.Resources {
 			if resource.Type == "coder_parameter" {
@@ -164,344 +429,432 @@ func ConvertState(modules []*tfjson.StateModule, rawGraph string) (*State, error
 			if tfResourcesByLabel[label] == nil {
 				tfResourcesByLabel[label] = map[string]*tfjson.StateResource{}
 			}
+			if _, exists := tfResourcesByLabel[label][resource.Address]; exists {
+				// Like in the index by label, the last resource with an
+				// address wins.
+				typed := tfResourcesByType[resource.Type]
+				for i := range typed {
+					if typed[i].Address == resource.Address {
+						typed[i] = resource
+					}
+				}
+			} else {
+				tfResourcesByType[resource.Type] = append(tfResourcesByType[resource.Type], resource)
+			}
 			tfResourcesByLabel[label][resource.Address] = resource
+			tfResourceModules[resource.Address] = mod.Address
 		}
+		return nil
 	}
 	for _, module := range modules {
-		findTerraformResources(module)
+		err := findTerraformResources(module, 0)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	graphResult := <-parsedGraph
+	graph, err := graphResult.graph, graphResult.err
+	if err != nil {
+		return nil, err
+	}
+	graphNodes := graphNodesByLabel(graph)
+
 	// Find all agents!
 	agentNames := map[string]struct{}{}
-	for _, tfResources := range tfResourcesByLabel {
-		for _, tfResource := range tfResources {
-			if tfResource.Type != "coder_agent" {
-				continue
-			}
-			var attrs agentAttributes
-			err = mapstructure.Decode(tfResource.AttributeValues, &attrs)
-			if err != nil {
-				return nil, xerrors.Errorf("decode agent attributes: %w", err)
-			}
-
-			if _, ok := agentNames[tfResource.Name]; ok {
-				return nil, xerrors.Errorf("duplicate agent name: %s", tfResource.Name)
-			}
-			agentNames[tfResource.Name] = struct{}{}
-
-			// Handling for deprecated attributes. login_before_ready was replaced
-			// by startup_script_behavior, but we still need to support it for
-			// backwards compatibility.
-			startupScriptBehavior := string(codersdk.WorkspaceAgentStartupScriptBehaviorNonBlocking)
-			if attrs.StartupScriptBehavior != "" {
-				startupScriptBehavior = attrs.StartupScriptBehavior
-			} else {
-				// Handling for provider pre-v0.6.10 (because login_before_ready
-				// defaulted to true, we must check for its presence).
-				if _, ok := tfResource.AttributeValues["login_before_ready"]; ok && !attrs.LoginBeforeReady {
-					startupScriptBehavior = string(codersdk.WorkspaceAgentStartupScriptBehaviorBlocking)
-				}
-			}
+	for _, tfResource := range tfResourcesByType["coder_agent"] {
+		var attrs agentAttributes
+		err = mapstructure.Decode(tfResource.AttributeValues, &attrs)
+		if err != nil {
+			return nil, xerrors.Errorf("decode agent attributes: %w", err)
+		}
 
-			var metadata []*proto.Agent_Metadata
-			for _, item := range attrs.Metadata {
-				metadata = append(metadata, &proto.Agent_Metadata{
-					Key:         item.Key,
-					DisplayName: item.DisplayName,
-					Script:      item.Script,
-					Interval:    item.Interval,
-					Timeout:     item.Timeout,
-					Order:       item.Order,
-				})
-			}
+		if _, ok := agentNames[tfResource.Name]; ok {
+			return nil, xerrors.Errorf("duplicate agent name: %s", tfResource.Name)
+		}
+		agentNames[tfResource.Name] = struct{}{}
 
-			// If a user doesn't specify 'display_apps' then they default
-			// into all apps except VSCode Insiders.
-			displayApps := provisionersdk.DefaultDisplayApps()
+		err = validateAgentPlatform(tfResource.Name, attrs.OperatingSystem, attrs.Architecture)
+		if err != nil {
+			return nil, err
+		}
 
-			if len(attrs.DisplayApps) != 0 {
-				displayApps = &proto.DisplayApps{
-					Vscode:               attrs.DisplayApps[0].VSCode,
-					VscodeInsiders:       attrs.DisplayApps[0].VSCodeInsiders,
-					WebTerminal:          attrs.DisplayApps[0].WebTerminal,
-					PortForwardingHelper: attrs.DisplayApps[0].PortForwardingHelper,
-					SshHelper:            attrs.DisplayApps[0].SSHHelper,
-				}
+		// Handling for deprecated attributes. login_before_ready was replaced
+		// by startup_script_behavior, but we still need to support it for
+		// backwards compatibility.
+		startupScriptBehavior := string(codersdk.WorkspaceAgentStartupScriptBehaviorNonBlocking)
+		if attrs.StartupScriptBehavior != "" {
+			startupScriptBehavior = attrs.StartupScriptBehavior
+		} else {
+			// Handling for provider pre-v0.6.10 (because login_before_ready
+			// defaulted to true, we must check for its presence).
+			if _, ok := tfResource.AttributeValues["login_before_ready"]; ok && !attrs.LoginBeforeReady {
+				startupScriptBehavior = string(codersdk.WorkspaceAgentStartupScriptBehaviorBlocking)
 			}
+		}
 
-			agent := &proto.Agent{
-				Name:                     tfResource.Name,
-				Id:                       attrs.ID,
-				Env:                      attrs.Env,
-				OperatingSystem:          attrs.OperatingSystem,
-				Architecture:             attrs.Architecture,
-				Directory:                attrs.Directory,
-				ConnectionTimeoutSeconds: attrs.ConnectionTimeoutSeconds,
-				TroubleshootingUrl:       attrs.TroubleshootingURL,
-				MotdFile:                 attrs.MOTDFile,
-				Metadata:                 metadata,
-				DisplayApps:              displayApps,
-			}
-			// Support the legacy script attributes in the agent!
-			if attrs.StartupScript != "" {
-				agent.Scripts = append(agent.Scripts, &proto.Script{
-					// This is ▶️
-					Icon:             "/emojis/25b6.png",
-					LogPath:          "coder-startup-script.log",
-					DisplayName:      "Startup Script",
-					Script:           attrs.StartupScript,
-					StartBlocksLogin: startupScriptBehavior == string(codersdk.WorkspaceAgentStartupScriptBehaviorBlocking),
-					RunOnStart:       true,
-				})
-			}
-			if attrs.ShutdownScript != "" {
-				agent.Scripts = append(agent.Scripts, &proto.Script{
-					// This is ◀️
-					Icon:        "/emojis/25c0.png",
-					LogPath:     "coder-shutdown-script.log",
-					DisplayName: "Shutdown Script",
-					Script:      attrs.ShutdownScript,
-					RunOnStop:   true,
-				})
+		var metadata []*proto.Agent_Metadata
+		for _, item := range attrs.Metadata {
+			if !codersdk.WorkspaceAgentMetadataCollector(item.Collector).Valid() {
+				return nil, xerrors.Errorf("agent %q metadata %q has an unknown collector %q", tfResource.Name, item.Key, item.Collector)
 			}
-			switch attrs.Auth {
-			case "token":
-				agent.Auth = &proto.Agent_Token{
-					Token: attrs.Token,
-				}
-			default:
-				// If token authentication isn't specified,
-				// assume instance auth. It's our only other
-				// authentication type!
-				agent.Auth = &proto.Agent_InstanceId{}
+			err = metadataSizes.addAgent(tfResource.Address, &item.Key, &item.DisplayName, &item.Script)
+			if err != nil {
+				return nil, err
 			}
+			metadata = append(metadata, &proto.Agent_Metadata{
+				Key:         item.Key,
+				DisplayName: item.DisplayName,
+				Script:      item.Script,
+				Interval:    item.Interval,
+				Timeout:     item.Timeout,
+				Order:       item.Order,
+				Collector:   item.Collector,
+			})
+		}
 
-			// The label is used to find the graph node!
-			agentLabel := convertAddressToLabel(tfResource.Address)
-
-			var agentNode *gographviz.Node
-			for _, node := range graph.Nodes.Lookup {
-				// The node attributes surround the label with quotes.
-				if strings.Trim(node.Attrs["label"], `"`) != agentLabel {
-					continue
-				}
-				agentNode = node
-				break
-			}
-			if agentNode == nil {
-				return nil, xerrors.Errorf("couldn't find node on graph: %q", agentLabel)
+		// If a user doesn't specify 'display_apps' then they default
+		// into all apps except VSCode Insiders.
+		displayApps := provisionersdk.DefaultDisplayApps()
+
+		if len(attrs.DisplayApps) != 0 {
+			displayApps = &proto.DisplayApps{
+				Vscode:               attrs.DisplayApps[0].VSCode,
+				VscodeInsiders:       attrs.DisplayApps[0].VSCodeInsiders,
+				WebTerminal:          attrs.DisplayApps[0].WebTerminal,
+				PortForwardingHelper: attrs.DisplayApps[0].PortForwardingHelper,
+				SshHelper:            attrs.DisplayApps[0].SSHHelper,
 			}
+		}
 
-			var agentResource *graphResource
-			for _, resource := range findResourcesInGraph(graph, tfResourcesByLabel, agentNode.Name, 0, true) {
-				if agentResource == nil {
-					// Default to the first resource because we have nothing to compare!
-					agentResource = resource
-					continue
-				}
-				if resource.Depth < agentResource.Depth {
-					// There's a closer resource!
-					agentResource = resource
+		var troubleshootingURLs *proto.TroubleshootingURLs
+		if len(attrs.TroubleshootingURLs) != 0 {
+			troubleshootingURLs = &proto.TroubleshootingURLs{
+				ConnectionTimeout: attrs.TroubleshootingURLs[0].ConnectionTimeout,
+				StartError:        attrs.TroubleshootingURLs[0].StartError,
+				TokenInvalid:      attrs.TroubleshootingURLs[0].TokenInvalid,
+			}
+			for _, troubleshootingURL := range []struct{ class, url string }{
+				{"connection_timeout", troubleshootingURLs.ConnectionTimeout},
+				{"start_error", troubleshootingURLs.StartError},
+				{"token_invalid", troubleshootingURLs.TokenInvalid},
+			} {
+				if troubleshootingURL.url == "" {
 					continue
 				}
-				if resource.Depth == agentResource.Depth && resource.Label < agentResource.Label {
-					agentResource = resource
-					continue
+				u, err := url.Parse(troubleshootingURL.url)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return nil, xerrors.Errorf("agent %q has an invalid %s troubleshooting URL %q, it must be an absolute http or https URL",
+						tfResource.Name, troubleshootingURL.class, troubleshootingURL.url)
 				}
 			}
+		}
 
-			if agentResource == nil {
-				continue
+		agent := &proto.Agent{
+			Name:                     tfResource.Name,
+			Id:                       attrs.ID,
+			Env:                      attrs.Env,
+			OperatingSystem:          attrs.OperatingSystem,
+			Architecture:             attrs.Architecture,
+			Directory:                attrs.Directory,
+			ConnectionTimeoutSeconds: attrs.ConnectionTimeoutSeconds,
+			TroubleshootingUrl:       attrs.TroubleshootingURL,
+			MotdFile:                 attrs.MOTDFile,
+			Metadata:                 metadata,
+			DisplayApps:              displayApps,
+			UnknownAttributes:        unknown[tfResource.Address],
+			TroubleshootingUrls:      troubleshootingURLs,
+		}
+		// Support the legacy script attributes in the agent!
+		if attrs.StartupScript != "" {
+			agent.Scripts = append(agent.Scripts, &proto.Script{
+				// This is ▶️
+				Icon:             "/emojis/25b6.png",
+				LogPath:          "coder-startup-script.log",
+				DisplayName:      "Startup Script",
+				Script:           attrs.StartupScript,
+				StartBlocksLogin: startupScriptBehavior == string(codersdk.WorkspaceAgentStartupScriptBehaviorBlocking),
+				RunOnStart:       true,
+			})
+		}
+		if attrs.ShutdownScript != "" {
+			agent.Scripts = append(agent.Scripts, &proto.Script{
+				// This is ◀️
+				Icon:        "/emojis/25c0.png",
+				LogPath:     "coder-shutdown-script.log",
+				DisplayName: "Shutdown Script",
+				Script:      attrs.ShutdownScript,
+				RunOnStop:   true,
+			})
+		}
+		switch attrs.Auth {
+		case "token":
+			agent.Auth = &proto.Agent_Token{
+				Token: attrs.Token,
 			}
+		default:
+			// If token authentication isn't specified,
+			// assume instance auth. It's our only other
+			// authentication type!
+			agent.Auth = &proto.Agent_InstanceId{}
+		}
 
-			agents, exists := resourceAgents[agentResource.Label]
-			if !exists {
-				agents = make([]*proto.Agent, 0)
-			}
-			agents = append(agents, agent)
-			resourceAgents[agentResource.Label] = agents
+		// External agents have no managed resource to attach to, so a
+		// synthetic parent is created for them instead.
+		if attrs.External {
+			label := ExternalAgentResourceType + "." + tfResource.Name
+			externalAgentLabels = append(externalAgentLabels, label)
+			resourceAgents[label] = []*proto.Agent{agent}
+			continue
 		}
-	}
 
-	// Manually associate agents with instance IDs.
-	for _, resources := range tfResourcesByLabel {
-		for _, resource := range resources {
-			if resource.Type != "coder_agent_instance" {
-				continue
-			}
-			agentIDRaw, valid := resource.AttributeValues["agent_id"]
-			if !valid {
-				continue
-			}
-			agentID, valid := agentIDRaw.(string)
-			if !valid {
+		// The label is used to find the graph node!
+		agentLabel := convertAddressToLabel(tfResource.Address)
+
+		agentNode, ok := graphNodes[agentLabel]
+		if !ok {
+			return nil, xerrors.Errorf("couldn't find node on graph: %q", agentLabel)
+		}
+
+		graphResources, err := findResourcesInGraph(graph, tfResourcesByLabel, agentNode.Name, 0, true, nil)
+		if err != nil {
+			return nil, err
+		}
+		var agentResource *graphResource
+		for _, resource := range graphResources {
+			if agentResource == nil {
+				// Default to the first resource because we have nothing to compare!
+				agentResource = resource
 				continue
 			}
-			instanceIDRaw, valid := resource.AttributeValues["instance_id"]
-			if !valid {
+			if resource.Depth < agentResource.Depth {
+				// There's a closer resource!
+				agentResource = resource
 				continue
 			}
-			instanceID, valid := instanceIDRaw.(string)
-			if !valid {
+			if resource.Depth == agentResource.Depth && resource.Label < agentResource.Label {
+				agentResource = resource
 				continue
 			}
+		}
 
-			for _, agents := range resourceAgents {
-				for _, agent := range agents {
-					if agent.Id != agentID {
-						continue
-					}
-					// Only apply the instance ID if the agent authentication
-					// type is set to do so. A user ran into a bug where they
-					// had the instance ID block, but auth was set to "token". See:
-					// https://github.com/coder/coder/issues/4551#issuecomment-1336293468
-					switch t := agent.Auth.(type) {
-					case *proto.Agent_Token:
-						continue
-					case *proto.Agent_InstanceId:
-						t.InstanceId = instanceID
-					}
-					break
-				}
-			}
+		if agentResource == nil {
+			continue
 		}
+
+		agents, exists := resourceAgents[agentResource.Label]
+		if !exists {
+			agents = make([]*proto.Agent, 0)
+		}
+		agents = append(agents, agent)
+		resourceAgents[agentResource.Label] = agents
 	}
 
-	// Associate Apps with agents.
-	appSlugs := make(map[string]struct{})
-	for _, resources := range tfResourcesByLabel {
-		for _, resource := range resources {
-			if resource.Type != "coder_app" {
+	// Indexes agents by their ID. In plans the IDs are unknown, so all
+	// agents share the empty ID.
+	agentsByID := map[string][]*proto.Agent{}
+	for _, agents := range resourceAgents {
+		for _, agent := range agents {
+			agentsByID[agent.Id] = append(agentsByID[agent.Id], agent)
+		}
+	}
+
+	// Manually associate agents with instance IDs.
+	for _, resource := range tfResourcesByType["coder_agent_instance"] {
+		agentIDRaw, valid := resource.AttributeValues["agent_id"]
+		if !valid {
+			continue
+		}
+		agentID, valid := agentIDRaw.(string)
+		if !valid {
+			continue
+		}
+		instanceIDRaw, valid := resource.AttributeValues["instance_id"]
+		if !valid {
+			continue
+		}
+		instanceID, valid := instanceIDRaw.(string)
+		if !valid {
+			continue
+		}
+
+		for _, agent := range agentsByID[agentID] {
+			// Only apply the instance ID if the agent authentication
+			// type is set to do so. A user ran into a bug where they
+			// had the instance ID block, but auth was set to "token". See:
+			// https://github.com/coder/coder/issues/4551#issuecomment-1336293468
+			switch t := agent.Auth.(type) {
+			case *proto.Agent_Token:
 				continue
+			case *proto.Agent_InstanceId:
+				t.InstanceId = instanceID
 			}
+			break
+		}
+	}
 
-			var attrs agentAppAttributes
-			err = mapstructure.Decode(resource.AttributeValues, &attrs)
-			if err != nil {
-				return nil, xerrors.Errorf("decode app attributes: %w", err)
-			}
+	// Associate Apps with agents.
+	agentCount := 0
+	for _, agents := range resourceAgents {
+		agentCount += len(agents)
+	}
+	var appURLDiagnostics []*proto.AppURLDiagnostic
+	for _, resource := range tfResourcesByType["coder_app"] {
+		var attrs agentAppAttributes
+		err = mapstructure.Decode(resource.AttributeValues, &attrs)
+		if err != nil {
+			return nil, xerrors.Errorf("decode app attributes: %w", err)
+		}
 
-			// Default to the resource name if none is set!
-			if attrs.Slug == "" {
-				attrs.Slug = resource.Name
+		// Default to the resource name if none is set!
+		if attrs.Slug == "" {
+			attrs.Slug = resource.Name
+		}
+		if attrs.DisplayName == "" {
+			if attrs.Name != "" {
+				// Name is deprecated but still accepted.
+				attrs.DisplayName = attrs.Name
+			} else {
+				attrs.DisplayName = attrs.Slug
 			}
-			if attrs.DisplayName == "" {
-				if attrs.Name != "" {
-					// Name is deprecated but still accepted.
-					attrs.DisplayName = attrs.Name
-				} else {
-					attrs.DisplayName = attrs.Slug
+		}
+
+		if !provisioner.AppSlugRegex.MatchString(attrs.Slug) {
+			return nil, xerrors.Errorf("invalid app slug %q, please update your coder/coder provider to the latest version and specify the slug property on each coder_app", attrs.Slug)
+		}
+
+		var healthcheck *proto.Healthcheck
+		if len(attrs.Healthcheck) != 0 {
+			if opts.Plan {
+				err = attrs.Healthcheck[0].validate(attrs.Slug)
+				if err != nil {
+					return nil, err
 				}
 			}
-
-			if !provisioner.AppSlugRegex.MatchString(attrs.Slug) {
-				return nil, xerrors.Errorf("invalid app slug %q, please update your coder/coder provider to the latest version and specify the slug property on each coder_app", attrs.Slug)
+			healthcheck = &proto.Healthcheck{
+				Url:       attrs.Healthcheck[0].URL,
+				Interval:  attrs.Healthcheck[0].Interval,
+				Threshold: attrs.Healthcheck[0].Threshold,
 			}
+		}
 
-			if _, exists := appSlugs[attrs.Slug]; exists {
-				return nil, xerrors.Errorf("duplicate app slug, they must be unique per template: %q", attrs.Slug)
+		sharingLevel := parseAppSharingLevel(attrs.Share)
+		if opts.MaxAppSharingLevel != nil && sharingLevel > *opts.MaxAppSharingLevel {
+			return nil, &AppSharingLevelError{
+				App:          attrs.Slug,
+				SharingLevel: sharingLevel,
+				Max:          *opts.MaxAppSharingLevel,
 			}
-			appSlugs[attrs.Slug] = struct{}{}
+		}
 
-			var healthcheck *proto.Healthcheck
-			if len(attrs.Healthcheck) != 0 {
-				healthcheck = &proto.Healthcheck{
-					Url:       attrs.Healthcheck[0].URL,
-					Interval:  attrs.Healthcheck[0].Interval,
-					Threshold: attrs.Healthcheck[0].Threshold,
-				}
-			}
+		// The url is only validated once it's known.
+		if !slice.Contains(unknown[resource.Address], "url") {
+			appURLDiagnostics = append(appURLDiagnostics, validateAppURL(attrs, opts.AppHostname)...)
+		}
 
-			sharingLevel := proto.AppSharingLevel_OWNER
-			switch strings.ToLower(attrs.Share) {
-			case "owner":
-				sharingLevel = proto.AppSharingLevel_OWNER
-			case "authenticated":
-				sharingLevel = proto.AppSharingLevel_AUTHENTICATED
-			case "public":
-				sharingLevel = proto.AppSharingLevel_PUBLIC
+		// Find agents with the matching ID and associate them!
+		for _, agent := range agentsByID[attrs.AgentID] {
+			app := &proto.App{
+				Slug:         attrs.Slug,
+				DisplayName:  attrs.DisplayName,
+				Command:      attrs.Command,
+				External:     attrs.External,
+				Url:          attrs.URL,
+				Icon:         attrs.Icon,
+				Subdomain:    attrs.Subdomain,
+				SharingLevel: sharingLevel,
+				Healthcheck:  healthcheck,
+				Order:        attrs.Order,
+
+				UnknownAttributes: unknown[resource.Address],
 			}
-
-			for _, agents := range resourceAgents {
-				for _, agent := range agents {
-					// Find agents with the matching ID and associate them!
-					if agent.Id != attrs.AgentID {
-						continue
-					}
-					agent.Apps = append(agent.Apps, &proto.App{
-						Slug:         attrs.Slug,
-						DisplayName:  attrs.DisplayName,
-						Command:      attrs.Command,
-						External:     attrs.External,
-						Url:          attrs.URL,
-						Icon:         attrs.Icon,
-						Subdomain:    attrs.Subdomain,
-						SharingLevel: sharingLevel,
-						Healthcheck:  healthcheck,
-						Order:        attrs.Order,
-					})
+			// Slugs are unique per agent, so apps generated for each
+			// agent with for_each may share a slug.
+			if existing := findApp(agent.Apps, app.Slug); existing != nil {
+				// In plans the agent IDs are unknown, so every app
+				// is associated with every agent. Apps generated for
+				// each agent are usually identical.
+				if protobuf.Equal(existing, app) {
+					continue
+				}
+				// The apps might belong to different agents, which
+				// can only be told apart once the agents exist.
+				if attrs.AgentID == "" && agentCount > 1 {
+					continue
 				}
+				return nil, xerrors.Errorf("duplicate app slug, they must be unique per agent: %q", attrs.Slug)
 			}
+			agent.Apps = append(agent.Apps, app)
 		}
 	}
 
 	// Associate envs with agents.
-	for _, resources := range tfResourcesByLabel {
-		for _, resource := range resources {
-			if resource.Type != "coder_env" {
-				continue
-			}
-			var attrs agentEnvAttributes
-			err = mapstructure.Decode(resource.AttributeValues, &attrs)
-			if err != nil {
-				return nil, xerrors.Errorf("decode env attributes: %w", err)
-			}
-			for _, agents := range resourceAgents {
-				for _, agent := range agents {
-					// Find agents with the matching ID and associate them!
-					if agent.Id != attrs.AgentID {
-						continue
-					}
-					agent.ExtraEnvs = append(agent.ExtraEnvs, &proto.Env{
-						Name:  attrs.Name,
-						Value: attrs.Value,
-					})
-				}
-			}
+	for _, resource := range tfResourcesByType["coder_env"] {
+		var attrs agentEnvAttributes
+		err = mapstructure.Decode(resource.AttributeValues, &attrs)
+		if err != nil {
+			return nil, xerrors.Errorf("decode env attributes: %w", err)
+		}
+		// Find agents with the matching ID and associate them!
+		for _, agent := range agentsByID[attrs.AgentID] {
+			agent.ExtraEnvs = append(agent.ExtraEnvs, &proto.Env{
+				Name:  attrs.Name,
+				Value: attrs.Value,
+			})
 		}
 	}
 
 	// Associate scripts with agents.
-	for _, resources := range tfResourcesByLabel {
-		for _, resource := range resources {
-			if resource.Type != "coder_script" {
-				continue
+	for _, resource := range tfResourcesByType["coder_script"] {
+		var attrs agentScriptAttributes
+		err = mapstructure.Decode(resource.AttributeValues, &attrs)
+		if err != nil {
+			return nil, xerrors.Errorf("decode script attributes: %w", err)
+		}
+		// The agent interprets the cron schedule in the timezone
+		// given by the CRON_TZ prefix.
+		if attrs.Timezone != "" && attrs.Cron != "" {
+			if strings.HasPrefix(attrs.Cron, "TZ=") || strings.HasPrefix(attrs.Cron, "CRON_TZ=") {
+				return nil, xerrors.Errorf("coder_script.%s sets a timezone in both cron and timezone", resource.Name)
 			}
-			var attrs agentScriptAttributes
-			err = mapstructure.Decode(resource.AttributeValues, &attrs)
-			if err != nil {
-				return nil, xerrors.Errorf("decode script attributes: %w", err)
+			if _, err := time.LoadLocation(attrs.Timezone); err != nil {
+				return nil, xerrors.Errorf("invalid timezone %q for coder_script.%s: %w", attrs.Timezone, resource.Name, err)
 			}
-			for _, agents := range resourceAgents {
-				for _, agent := range agents {
-					// Find agents with the matching ID and associate them!
-					if agent.Id != attrs.AgentID {
-						continue
-					}
-					agent.Scripts = append(agent.Scripts, &proto.Script{
-						DisplayName:      attrs.DisplayName,
-						Icon:             attrs.Icon,
-						Script:           attrs.Script,
-						Cron:             attrs.Cron,
-						LogPath:          attrs.LogPath,
-						StartBlocksLogin: attrs.StartBlocksLogin,
-						RunOnStart:       attrs.RunOnStart,
-						RunOnStop:        attrs.RunOnStop,
-						TimeoutSeconds:   attrs.TimeoutSeconds,
-					})
-				}
+			attrs.Cron = "CRON_TZ=" + attrs.Timezone + " " + attrs.Cron
+		}
+		if attrs.DiskPressurePath != "" || attrs.DiskPressureThreshold != 0 {
+			err := validateDiskPressure(resource.Name, attrs)
+			if err != nil && opts.Plan {
+				return nil, err
+			}
+			if err != nil {
+				// The script exists, so it's kept as a regular script
+				// that isn't run on disk pressure.
+				warnings = append(warnings, fmt.Sprintf("%s, it won't be run on disk pressure.", err))
+				attrs.DiskPressurePath = ""
+				attrs.DiskPressureThreshold = 0
 			}
 		}
+		// Find agents with the matching ID and associate them!
+		for _, agent := range agentsByID[attrs.AgentID] {
+			agent.Scripts = append(agent.Scripts, &proto.Script{
+				DisplayName:           attrs.DisplayName,
+				Icon:                  attrs.Icon,
+				Script:                attrs.Script,
+				Cron:                  attrs.Cron,
+				LogPath:               attrs.LogPath,
+				StartBlocksLogin:      attrs.StartBlocksLogin,
+				RunOnStart:            attrs.RunOnStart,
+				RunOnStop:             attrs.RunOnStop,
+				RunOnBuildSuccess:     attrs.RunOnBuildSuccess,
+				RunOnBuildFailure:     attrs.RunOnBuildFailure,
+				RunOnPostStart:        attrs.RunOnPostStart,
+				Login:                 attrs.Login,
+				DiskPressurePath:      attrs.DiskPressurePath,
+				DiskPressureThreshold: attrs.DiskPressureThreshold,
+				TimeoutSeconds:        attrs.TimeoutSeconds,
+			})
+		}
 	}
 
 	// Associate metadata blocks with resources.
@@ -511,79 +864,85 @@ func ConvertState(modules []*tfjson.StateModule, rawGraph string) (*State, error
 	resourceCost := map[string]int32{}
 
 	metadataTargetLabels := map[string]bool{}
-	for _, resources := range tfResourcesByLabel {
-		for _, resource := range resources {
-			if resource.Type != "coder_metadata" {
-				continue
-			}
-
-			var attrs resourceMetadataAttributes
-			err = mapstructure.Decode(resource.AttributeValues, &attrs)
-			if err != nil {
-				return nil, xerrors.Errorf("decode metadata attributes: %w", err)
-			}
-			resourceLabel := convertAddressToLabel(resource.Address)
+	for _, resource := range tfResourcesByType["coder_metadata"] {
+		var attrs resourceMetadataAttributes
+		err = mapstructure.Decode(resource.AttributeValues, &attrs)
+		if err != nil {
+			return nil, xerrors.Errorf("decode metadata attributes: %w", err)
+		}
+		resourceLabel := convertAddressToLabel(resource.Address)
 
-			var attachedNode *gographviz.Node
-			for _, node := range graph.Nodes.Lookup {
-				// The node attributes surround the label with quotes.
-				if strings.Trim(node.Attrs["label"], `"`) != resourceLabel {
-					continue
-				}
-				attachedNode = node
-				break
-			}
-			if attachedNode == nil {
+		attachedNode, ok := graphNodes[resourceLabel]
+		if !ok {
+			continue
+		}
+		graphResources, err := findResourcesInGraph(graph, tfResourcesByLabel, attachedNode.Name, 0, false, nil)
+		if err != nil {
+			return nil, err
+		}
+		var attachedResource *graphResource
+		for _, resource := range graphResources {
+			if attachedResource == nil {
+				// Default to the first resource because we have nothing to compare!
+				attachedResource = resource
 				continue
 			}
-			var attachedResource *graphResource
-			for _, resource := range findResourcesInGraph(graph, tfResourcesByLabel, attachedNode.Name, 0, false) {
-				if attachedResource == nil {
-					// Default to the first resource because we have nothing to compare!
-					attachedResource = resource
-					continue
-				}
-				if resource.Depth < attachedResource.Depth {
-					// There's a closer resource!
-					attachedResource = resource
-					continue
-				}
-				if resource.Depth == attachedResource.Depth && resource.Label < attachedResource.Label {
-					attachedResource = resource
-					continue
-				}
+			if resource.Depth < attachedResource.Depth {
+				// There's a closer resource!
+				attachedResource = resource
+				continue
 			}
-			if attachedResource == nil {
+			if resource.Depth == attachedResource.Depth && resource.Label < attachedResource.Label {
+				attachedResource = resource
 				continue
 			}
-			targetLabel := attachedResource.Label
+		}
+		if attachedResource == nil {
+			continue
+		}
+		targetLabel := attachedResource.Label
 
-			if metadataTargetLabels[targetLabel] {
-				return nil, xerrors.Errorf("duplicate metadata resource: %s", targetLabel)
-			}
-			metadataTargetLabels[targetLabel] = true
+		if metadataTargetLabels[targetLabel] {
+			return nil, xerrors.Errorf("duplicate metadata resource: %s", targetLabel)
+		}
+		metadataTargetLabels[targetLabel] = true
 
-			resourceHidden[targetLabel] = attrs.Hide
-			resourceIcon[targetLabel] = attrs.Icon
-			resourceCost[targetLabel] = attrs.DailyCost
-			for _, item := range attrs.Items {
-				resourceMetadata[targetLabel] = append(resourceMetadata[targetLabel],
-					&proto.Resource_Metadata{
-						Key:       item.Key,
-						Value:     item.Value,
-						Sensitive: item.Sensitive,
-						IsNull:    item.IsNull,
-					})
+		resourceHidden[targetLabel] = attrs.Hide
+		resourceIcon[targetLabel] = attrs.Icon
+		resourceCost[targetLabel] = attrs.DailyCost
+		for _, item := range attrs.Items {
+			err = metadataSizes.addResource(resource.Address, &item.Key, &item.Value)
+			if err != nil {
+				return nil, err
 			}
+			resourceMetadata[targetLabel] = append(resourceMetadata[targetLabel],
+				&proto.Resource_Metadata{
+					Key:       item.Key,
+					Value:     item.Value,
+					Sensitive: item.Sensitive,
+					IsNull:    item.IsNull,
+					Order:     item.Order,
+					Group:     item.Group,
+				})
 		}
+		// Items are shown in the order of the template, items without
+		// an order keep their position in the state.
+		sort.SliceStable(resourceMetadata[targetLabel], func(i, j int) bool {
+			return resourceMetadata[targetLabel][i].Order < resourceMetadata[targetLabel][j].Order
+		})
+	}
+	err = metadataSizes.check()
+	if err != nil {
+		return nil, err
 	}
 
+	topology := &Topology{}
 	for _, tfResources := range tfResourcesByLabel {
 		for _, resource := range tfResources {
 			if resource.Mode == tfjson.DataResourceMode {
 				continue
 			}
-			if resource.Type == "coder_script" || resource.Type == "coder_agent" || resource.Type == "coder_agent_instance" || resource.Type == "coder_app" || resource.Type == "coder_metadata" {
+			if resource.Type == "coder_script" || resource.Type == "coder_agent" || resource.Type == "coder_agent_instance" || resource.Type == "coder_app" || resource.Type == "coder_metadata" || resource.Type == "coder_workspace_network" {
 				continue
 			}
 			label := convertAddressToLabel(resource.Address)
@@ -593,19 +952,40 @@ func ConvertState(modules []*tfjson.StateModule, rawGraph string) (*State, error
 				applyAutomaticInstanceID(resource, agents)
 			}
 
-			resources = append(resources, &proto.Resource{
+			converted := &proto.Resource{
 				Name:         resource.Name,
 				Type:         resource.Type,
 				Agents:       agents,
-				Metadata:     resourceMetadata[label],
+				Metadata:     append(resourceMetadata[label], snapshotMetadata(resource)...),
 				Hide:         resourceHidden[label],
 				Icon:         resourceIcon[label],
 				DailyCost:    resourceCost[label],
 				InstanceType: applyInstanceType(resource),
-			})
+				Accelerators: resourceAccelerators(resource),
+				Action:       actions[resource.Address],
+				Address:      resource.Address,
+			}
+			resources = append(resources, converted)
+			topology.addResource(resource.Address, converted)
+			cost.addResource(tfResourceModules[resource.Address], resource.Address, converted)
 		}
 	}
 
+	sort.Strings(externalAgentLabels)
+	for _, label := range externalAgentLabels {
+		agents := resourceAgents[label]
+		converted := &proto.Resource{
+			Name:   agents[0].Name,
+			Type:   ExternalAgentResourceType,
+			Agents: agents,
+		}
+		resources = append(resources, converted)
+		topology.addResource(label, converted)
+	}
+	// Deleted resources have no agents, so they're not in the topology.
+	resources = append(resources, deletedResources(changes)...)
+	topology.normalize()
+
 	var duplicatedParamNames []string
 	parameters := make([]*proto.RichParameter, 0)
 	for _, resource := range tfResourcesRichParameters {
@@ -716,13 +1096,69 @@ func ConvertState(modules []*tfjson.StateModule, rawGraph string) (*State, error
 		externalAuthProviders = append(externalAuthProviders, id)
 	}
 
+	network, err := convertWorkspaceNetwork(tfResourcesByType)
+	if err != nil {
+		return nil, err
+	}
+
 	return &State{
 		Resources:             resources,
 		Parameters:            parameters,
 		ExternalAuthProviders: externalAuthProviders,
+		Topology:              topology,
+		Cost:                  cost.build(),
+		Network:               network,
+		AppURLDiagnostics:     appURLDiagnostics,
+		Warnings:              append(warnings, metadataSizes.warnings...),
 	}, nil
 }
 
+// validateDiskPressure checks the disk pressure settings of the cleanup
+// script.
+func validateDiskPressure(name string, attrs agentScriptAttributes) error {
+	if attrs.DiskPressurePath == "" {
+		return xerrors.Errorf("coder_script.%s sets a disk pressure threshold without a path", name)
+	}
+	if attrs.DiskPressureThreshold < 1 || attrs.DiskPressureThreshold > 100 {
+		return xerrors.Errorf("coder_script.%s has an invalid disk pressure threshold %d, it must be a percentage between 1 and 100", name, attrs.DiskPressureThreshold)
+	}
+	return nil
+}
+
+// convertWorkspaceNetwork converts the coder_workspace_network resource. A
+// workspace has a single network, so it may only be declared once.
+func convertWorkspaceNetwork(tfResourcesByType map[string][]*tfjson.StateResource) (*proto.WorkspaceNetwork, error) {
+	var (
+		network *proto.WorkspaceNetwork
+		address string
+	)
+	for _, resource := range tfResourcesByType["coder_workspace_network"] {
+		if network != nil {
+			first, second := address, resource.Address
+			if second < first {
+				first, second = second, first
+			}
+			return nil, xerrors.Errorf("only one coder_workspace_network is allowed, found %s and %s", first, second)
+		}
+		var attrs workspaceNetworkAttributes
+		err := mapstructure.Decode(resource.AttributeValues, &attrs)
+		if err != nil {
+			return nil, xerrors.Errorf("decode network attributes: %w", err)
+		}
+		if attrs.MTU != 0 && (attrs.MTU < minWorkspaceNetworkMTU || attrs.MTU > maxWorkspaceNetworkMTU) {
+			return nil, xerrors.Errorf("network %s has an mtu of %d, must be between %d and %d",
+				resource.Address, attrs.MTU, minWorkspaceNetworkMTU, maxWorkspaceNetworkMTU)
+		}
+		network = &proto.WorkspaceNetwork{
+			PreferredDerpRegion:      attrs.PreferredDERPRegion,
+			DisableDirectConnections: attrs.DisableDirectConnections,
+			Mtu:                      attrs.MTU,
+		}
+		address = resource.Address
+	}
+	return network, nil
+}
+
 func PtrInt32(number int) *int32 {
 	n := int32(number)
 	return &n
@@ -810,8 +1246,22 @@ func applyAutomaticInstanceID(resource *tfjson.StateResource, agents []*proto.Ag
 
 // findResourcesInGraph traverses directionally in a graph until a resource is found,
 // then it stores the depth it was found at, and continues working up the tree.
+// path are the nodes traversed to reach nodeName, a *GraphCycleError is
+// returned if they are reached again.
 // nolint:revive
-func findResourcesInGraph(graph *gographviz.Graph, tfResourcesByLabel map[string]map[string]*tfjson.StateResource, nodeName string, currentDepth uint, up bool) []*graphResource {
+func findResourcesInGraph(graph *gographviz.Graph, tfResourcesByLabel map[string]map[string]*tfjson.StateResource, nodeName string, currentDepth uint, up bool, path []string) ([]*graphResource, error) {
+	for i, name := range path {
+		if name != nodeName {
+			continue
+		}
+		cycle := make([]string, 0, len(path)-i+1)
+		for _, name := range append(path[i:], nodeName) {
+			cycle = append(cycle, graphNodeLabel(graph, name))
+		}
+		return nil, &GraphCycleError{Cycle: cycle}
+	}
+	path = append(path[:len(path):len(path)], nodeName)
+
 	graphResources := make([]*graphResource, 0)
 	mapping := graph.Edges.DstToSrcs
 	if !up {
@@ -820,7 +1270,11 @@ func findResourcesInGraph(graph *gographviz.Graph, tfResourcesByLabel map[string
 	for destination := range mapping[nodeName] {
 		destinationNode := graph.Nodes.Lookup[destination]
 		// Work our way up the tree!
-		graphResources = append(graphResources, findResourcesInGraph(graph, tfResourcesByLabel, destinationNode.Name, currentDepth+1, up)...)
+		found, err := findResourcesInGraph(graph, tfResourcesByLabel, destinationNode.Name, currentDepth+1, up, path)
+		if err != nil {
+			return nil, err
+		}
+		graphResources = append(graphResources, found...)
 
 		destinationLabel, exists := destinationNode.Attrs["label"]
 		if !exists {
@@ -847,5 +1301,63 @@ func findResourcesInGraph(graph *gographviz.Graph, tfResourcesByLabel map[string
 		}
 	}
 
-	return graphResources
+	return graphResources, nil
+}
+
+type graphParseResult struct {
+	graph *gographviz.Graph
+	err   error
+}
+
+// parseGraph parses the output of "terraform graph".
+func parseGraph(rawGraph string) (*gographviz.Graph, error) {
+	parsedGraph, err := gographviz.ParseString(rawGraph)
+	if err != nil {
+		return nil, xerrors.Errorf("parse graph: %w", err)
+	}
+	graph, err := gographviz.NewAnalysedGraph(parsedGraph)
+	if err != nil {
+		return nil, xerrors.Errorf("analyze graph: %w", err)
+	}
+	return graph, nil
+}
+
+// graphNodesByLabel indexes the nodes of the graph by their label, which is
+// the address of the resource. If labels collide, the node with the lowest
+// name is used so conversions are deterministic.
+func graphNodesByLabel(graph *gographviz.Graph) map[string]*gographviz.Node {
+	nodes := make(map[string]*gographviz.Node, len(graph.Nodes.Lookup))
+	for _, node := range graph.Nodes.Lookup {
+		// The node attributes surround the label with quotes.
+		label := strings.Trim(node.Attrs["label"], `"`)
+		if existing, ok := nodes[label]; ok && existing.Name < node.Name {
+			continue
+		}
+		nodes[label] = node
+	}
+	return nodes
+}
+
+// graphNodeLabel returns the label of a node, which is the address of the
+// resource, or its name if it has none.
+func graphNodeLabel(graph *gographviz.Graph, name string) string {
+	node, ok := graph.Nodes.Lookup[name]
+	if !ok {
+		return name
+	}
+	label, ok := node.Attrs["label"]
+	if !ok {
+		return name
+	}
+	return strings.Trim(label, `"`)
+}
+
+// findApp returns the app of an agent with the slug, or nil.
+func findApp(apps []*proto.App, slug string) *proto.App {
+	for _, app := range apps {
+		if app.Slug == slug {
+			return app
+		}
+	}
+	return nil
 }
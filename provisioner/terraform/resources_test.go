@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 	"testing"
 
 	tfjson "github.com/hashicorp/terraform-json"
@@ -218,6 +219,44 @@ func TestConvertResources(t *testing.T) {
 				}},
 			}},
 		},
+		// Apps generated for each agent may share a slug.
+		"multiple-agents-mapped-apps": {
+			resources: []*proto.Resource{{
+				Name: "dev1",
+				Type: "null_resource",
+				Agents: []*proto.Agent{{
+					Name:            "dev1",
+					OperatingSystem: "linux",
+					Architecture:    "amd64",
+					Apps: []*proto.App{
+						{
+							Slug:        "app",
+							DisplayName: "app",
+						},
+					},
+					Auth:                     &proto.Agent_Token{},
+					ConnectionTimeoutSeconds: 120,
+					DisplayApps:              &displayApps,
+				}},
+			}, {
+				Name: "dev2",
+				Type: "null_resource",
+				Agents: []*proto.Agent{{
+					Name:            "dev2",
+					OperatingSystem: "linux",
+					Architecture:    "amd64",
+					Apps: []*proto.App{
+						{
+							Slug:        "app",
+							DisplayName: "app",
+						},
+					},
+					Auth:                     &proto.Agent_Token{},
+					ConnectionTimeoutSeconds: 120,
+					DisplayApps:              &displayApps,
+				}},
+			}},
+		},
 		// Tests fetching metadata about workspace resources.
 		"resource-metadata": {
 			resources: []*proto.Resource{{
@@ -227,9 +266,6 @@ func TestConvertResources(t *testing.T) {
 				Icon:      "/icon/server.svg",
 				DailyCost: 29,
 				Metadata: []*proto.Resource_Metadata{{
-					Key:   "hello",
-					Value: "world",
-				}, {
 					Key:    "null",
 					IsNull: true,
 				}, {
@@ -238,6 +274,13 @@ func TestConvertResources(t *testing.T) {
 					Key:       "secret",
 					Value:     "squirrel",
 					Sensitive: true,
+					Order:     1,
+					Group:     "Credentials",
+				}, {
+					Key:   "hello",
+					Value: "world",
+					Order: 2,
+					Group: "General",
 				}},
 				Agents: []*proto.Agent{{
 					Name:            "main",
@@ -356,11 +399,15 @@ func TestConvertResources(t *testing.T) {
 				Name: "Example",
 				Type: "string",
 				Options: []*proto.RichParameterOption{{
-					Name:  "First Option",
-					Value: "first",
+					Name:        "First Option",
+					Description: "First option description",
+					Value:       "first",
+					Icon:        "/icon/first.svg",
 				}, {
-					Name:  "Second Option",
-					Value: "second",
+					Name:        "Second Option",
+					Description: "Second option description",
+					Value:       "second",
+					Icon:        "/icon/second.svg",
 				}},
 				Required: true,
 			}, {
@@ -548,6 +595,10 @@ func TestConvertResources(t *testing.T) {
 				require.NoError(t, err)
 				sortResources(state.Resources)
 				sort.Strings(state.ExternalAuthProviders)
+				// Addresses are tested separately.
+				for _, resource := range state.Resources {
+					resource.Address = ""
+				}
 
 				expectedNoMetadata := make([]*proto.Resource, 0)
 				for _, resource := range expected.resources {
@@ -603,6 +654,7 @@ func TestConvertResources(t *testing.T) {
 				sortResources(state.Resources)
 				sort.Strings(state.ExternalAuthProviders)
 				for _, resource := range state.Resources {
+					resource.Address = ""
 					for _, agent := range resource.Agents {
 						agent.Id = ""
 						if agent.GetToken() != "" {
@@ -675,6 +727,274 @@ func TestAppSlugValidation(t *testing.T) {
 	require.ErrorContains(t, err, "duplicate app slug")
 }
 
+func TestAgentMetadataCollectorValidation(t *testing.T) {
+	t.Parallel()
+
+	// nolint:dogsled
+	_, filename, _, _ := runtime.Caller(0)
+
+	// Load the resource-metadata plan file and edit it.
+	dir := filepath.Join(filepath.Dir(filename), "testdata", "resource-metadata")
+	tfPlanRaw, err := os.ReadFile(filepath.Join(dir, "resource-metadata.tfplan.json"))
+	require.NoError(t, err)
+	var tfPlan tfjson.Plan
+	err = json.Unmarshal(tfPlanRaw, &tfPlan)
+	require.NoError(t, err)
+	tfPlanGraph, err := os.ReadFile(filepath.Join(dir, "resource-metadata.tfplan.dot"))
+	require.NoError(t, err)
+
+	setCollector := func(collector string) {
+		for _, resource := range tfPlan.PlannedValues.RootModule.Resources {
+			if resource.Type != "coder_agent" {
+				continue
+			}
+			for _, metadata := range resource.AttributeValues["metadata"].([]interface{}) {
+				metadata.(map[string]interface{})["collector"] = collector
+			}
+		}
+	}
+
+	setCollector("gpu")
+	state, err := terraform.ConvertState([]*tfjson.StateModule{tfPlan.PlannedValues.RootModule}, string(tfPlanGraph))
+	require.Nil(t, state)
+	require.ErrorContains(t, err, `unknown collector "gpu"`)
+
+	setCollector("memory")
+	state, err = terraform.ConvertState([]*tfjson.StateModule{tfPlan.PlannedValues.RootModule}, string(tfPlanGraph))
+	require.NoError(t, err)
+	require.Equal(t, "memory", state.Resources[0].Agents[0].Metadata[0].Collector)
+}
+
+func TestTopology(t *testing.T) {
+	t.Parallel()
+
+	// nolint:dogsled
+	_, filename, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(filename), "testdata", "multiple-apps")
+	tfPlanRaw, err := os.ReadFile(filepath.Join(dir, "multiple-apps.tfplan.json"))
+	require.NoError(t, err)
+	var tfPlan tfjson.Plan
+	err = json.Unmarshal(tfPlanRaw, &tfPlan)
+	require.NoError(t, err)
+	tfPlanGraph, err := os.ReadFile(filepath.Join(dir, "multiple-apps.tfplan.dot"))
+	require.NoError(t, err)
+
+	state, err := terraform.ConvertState([]*tfjson.StateModule{tfPlan.PlannedValues.RootModule}, string(tfPlanGraph))
+	require.NoError(t, err)
+	require.NotNil(t, state.Topology)
+
+	ids := make([]string, 0, len(state.Topology.Nodes))
+	for _, node := range state.Topology.Nodes {
+		ids = append(ids, node.ID)
+	}
+	require.Equal(t, []string{
+		"agent:dev1",
+		"app:dev1/app1",
+		"app:dev1/app2",
+		"app:dev1/app3",
+		"resource:null_resource.dev",
+	}, ids)
+	require.Equal(t, []terraform.TopologyEdge{
+		{From: "agent:dev1", To: "app:dev1/app1"},
+		{From: "agent:dev1", To: "app:dev1/app2"},
+		{From: "agent:dev1", To: "app:dev1/app3"},
+		{From: "resource:null_resource.dev", To: "agent:dev1"},
+	}, state.Topology.Edges)
+}
+
+func TestCost(t *testing.T) {
+	t.Parallel()
+
+	// nolint:dogsled
+	_, filename, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(filename), "testdata", "resource-metadata")
+	tfStateRaw, err := os.ReadFile(filepath.Join(dir, "resource-metadata.tfstate.json"))
+	require.NoError(t, err)
+	var tfState tfjson.State
+	err = json.Unmarshal(tfStateRaw, &tfState)
+	require.NoError(t, err)
+	tfStateGraph, err := os.ReadFile(filepath.Join(dir, "resource-metadata.tfstate.dot"))
+	require.NoError(t, err)
+
+	state, err := terraform.ConvertState([]*tfjson.StateModule{tfState.Values.RootModule}, string(tfStateGraph))
+	require.NoError(t, err)
+	require.Equal(t, &terraform.Cost{
+		DailyCost: 29,
+		Modules: []terraform.ModuleCost{{
+			Address:   "",
+			DailyCost: 29,
+			Resources: []terraform.ResourceCost{{
+				Address:   "null_resource.about",
+				Type:      "null_resource",
+				Name:      "about",
+				DailyCost: 29,
+			}},
+		}},
+	}, state.Cost)
+}
+
+func TestMetadataSizeLimits(t *testing.T) {
+	t.Parallel()
+
+	load := func(t *testing.T) (*tfjson.StateModule, string) {
+		dir := filepath.Join("testdata", "resource-metadata")
+		tfPlanRaw, err := os.ReadFile(filepath.Join(dir, "resource-metadata.tfplan.json"))
+		require.NoError(t, err)
+		var tfPlan tfjson.Plan
+		err = json.Unmarshal(tfPlanRaw, &tfPlan)
+		require.NoError(t, err)
+		tfPlanGraph, err := os.ReadFile(filepath.Join(dir, "resource-metadata.tfplan.dot"))
+		require.NoError(t, err)
+		return tfPlan.PlannedValues.RootModule, string(tfPlanGraph)
+	}
+	// setItem sets the attribute of the metadata item with the key of the
+	// resource of the type.
+	setItem := func(module *tfjson.StateModule, resourceType, key, attribute, value string) {
+		for _, resource := range module.Resources {
+			if resource.Type != resourceType {
+				continue
+			}
+			items, ok := resource.AttributeValues["item"].([]interface{})
+			if !ok {
+				items, _ = resource.AttributeValues["metadata"].([]interface{})
+			}
+			for _, item := range items {
+				if item.(map[string]interface{})["key"] == key {
+					item.(map[string]interface{})[attribute] = value
+				}
+			}
+		}
+	}
+
+	t.Run("Value", func(t *testing.T) {
+		t.Parallel()
+		module, graph := load(t)
+		setItem(module, "coder_metadata", "hello", "value", strings.Repeat("a", 101))
+		_, err := terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{
+			Plan:                 true,
+			MaxMetadataValueSize: 100,
+		})
+		var sizeErr *terraform.MetadataSizeError
+		require.ErrorAs(t, err, &sizeErr)
+		require.False(t, sizeErr.Total)
+		require.Equal(t, "value", sizeErr.Field)
+		require.Equal(t, 101, sizeErr.Size)
+		require.Equal(t, []string{`coder_metadata.about_info["hello"]`}, sizeErr.Keys)
+	})
+
+	t.Run("Characters", func(t *testing.T) {
+		t.Parallel()
+		module, graph := load(t)
+		// Multi-byte characters are counted once, like the columns do.
+		setItem(module, "coder_metadata", "hello", "value", strings.Repeat("é", 100))
+		_, err := terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{
+			Plan:                 true,
+			MaxMetadataValueSize: 100,
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("AgentScript", func(t *testing.T) {
+		t.Parallel()
+		module, graph := load(t)
+		setItem(module, "coder_agent", "process_count", "script", strings.Repeat("a", 101))
+		_, err := terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{
+			Plan:                 true,
+			MaxMetadataValueSize: 100,
+		})
+		var sizeErr *terraform.MetadataSizeError
+		require.ErrorAs(t, err, &sizeErr)
+		require.Equal(t, "script", sizeErr.Field)
+		require.Equal(t, []string{`coder_agent.main["process_count"]`}, sizeErr.Keys)
+	})
+
+	t.Run("AgentDisplayName", func(t *testing.T) {
+		t.Parallel()
+		module, graph := load(t)
+		// The display name is limited by its own column, not the value
+		// limit.
+		setItem(module, "coder_agent", "process_count", "display_name", strings.Repeat("a", 128))
+		_, err := terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{
+			Plan: true,
+		})
+		var sizeErr *terraform.MetadataSizeError
+		require.ErrorAs(t, err, &sizeErr)
+		require.Equal(t, "display_name", sizeErr.Field)
+		require.Equal(t, 127, sizeErr.Limit)
+	})
+
+	t.Run("Total", func(t *testing.T) {
+		t.Parallel()
+		module, graph := load(t)
+		setItem(module, "coder_metadata", "hello", "value", strings.Repeat("a", 60))
+		setItem(module, "coder_metadata", "secret", "value", strings.Repeat("a", 50))
+		_, err := terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{
+			Plan:                 true,
+			MaxMetadataValueSize: 100,
+			MaxMetadataTotalSize: 100,
+		})
+		var sizeErr *terraform.MetadataSizeError
+		require.ErrorAs(t, err, &sizeErr)
+		require.True(t, sizeErr.Total)
+		require.Equal(t, 100, sizeErr.Limit)
+		require.Equal(t, `coder_metadata.about_info["hello"]`, sizeErr.Keys[0])
+		require.Equal(t, `coder_metadata.about_info["secret"]`, sizeErr.Keys[1])
+		require.ErrorContains(t, err, "larger than the limit of 100 characters")
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		t.Parallel()
+		module, graph := load(t)
+		setItem(module, "coder_metadata", "hello", "value", strings.Repeat("a", terraform.DefaultMaxMetadataValueSize))
+		state, err := terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{
+			Plan: true,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, state)
+
+		setItem(module, "coder_metadata", "hello", "value", strings.Repeat("a", terraform.DefaultMaxMetadataValueSize+1))
+		_, err = terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{
+			Plan: true,
+		})
+		var sizeErr *terraform.MetadataSizeError
+		require.ErrorAs(t, err, &sizeErr)
+	})
+
+	t.Run("AppliedTruncated", func(t *testing.T) {
+		t.Parallel()
+		module, graph := load(t)
+		// The resources of an applied state exist, so their metadata is
+		// truncated instead of failing the build.
+		setItem(module, "coder_metadata", "hello", "value", strings.Repeat("é", 101))
+		setItem(module, "coder_agent", "process_count", "display_name", strings.Repeat("a", 128))
+		state, err := terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{
+			MaxMetadataValueSize: 100,
+			MaxMetadataTotalSize: 100,
+		})
+		require.NoError(t, err)
+		require.Len(t, state.Warnings, 3)
+
+		var value string
+		var displayName string
+		for _, resource := range state.Resources {
+			for _, item := range resource.Metadata {
+				if item.Key == "hello" {
+					value = item.Value
+				}
+			}
+			for _, agent := range resource.Agents {
+				for _, item := range agent.Metadata {
+					if item.Key == "process_count" {
+						displayName = item.DisplayName
+					}
+				}
+			}
+		}
+		require.Equal(t, strings.Repeat("é", 100), value)
+		require.Equal(t, strings.Repeat("a", 127), displayName)
+	})
+}
+
 func TestMetadataResourceDuplicate(t *testing.T) {
 	t.Parallel()
 
@@ -881,6 +1201,454 @@ func TestInstanceIDAssociation(t *testing.T) {
 	}
 }
 
+func TestExternalAgent(t *testing.T) {
+	t.Parallel()
+	module, graph := loadState(t, "external-agent")
+
+	state, err := terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+	require.NoError(t, err)
+	require.Len(t, state.Resources, 1)
+	resource := state.Resources[0]
+	require.Equal(t, terraform.ExternalAgentResourceType, resource.Type)
+	require.Equal(t, "dev", resource.Name)
+	require.Len(t, resource.Agents, 1)
+	require.Equal(t, "dev", resource.Agents[0].Name)
+	require.Len(t, resource.Agents[0].Apps, 1)
+	require.Equal(t, "web", resource.Agents[0].Apps[0].Slug)
+	require.Len(t, resource.Agents[0].Scripts, 1)
+}
+
+func TestAgentTroubleshootingURLs(t *testing.T) {
+	t.Parallel()
+	convert := func(troubleshootingURLs map[string]interface{}) (*terraform.State, error) {
+		module, graph := loadState(t, "external-agent")
+		agent := stateResource(t, module, "coder_agent.dev")
+		agent.AttributeValues["troubleshooting_url"] = "https://example.com/runbook"
+		agent.AttributeValues["troubleshooting_urls"] = []interface{}{troubleshootingURLs}
+		return terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+	}
+
+	state, err := convert(map[string]interface{}{
+		"connection_timeout": "https://example.com/runbook#connection",
+		"token_invalid":      "https://example.com/runbook#token",
+	})
+	require.NoError(t, err)
+	agent := state.Resources[0].Agents[0]
+	require.Equal(t, "https://example.com/runbook", agent.TroubleshootingUrl)
+	require.Equal(t, "https://example.com/runbook#connection", agent.TroubleshootingUrls.ConnectionTimeout)
+	require.Empty(t, agent.TroubleshootingUrls.StartError)
+	require.Equal(t, "https://example.com/runbook#token", agent.TroubleshootingUrls.TokenInvalid)
+
+	for _, invalid := range []string{"/runbook", "ftp://example.com/runbook", "https://"} {
+		_, err = convert(map[string]interface{}{
+			"start_error": invalid,
+		})
+		require.ErrorContains(t, err, "invalid start_error troubleshooting URL", invalid)
+	}
+}
+
+func TestScriptTimezone(t *testing.T) {
+	t.Parallel()
+	convert := func(timezone string) (*terraform.State, error) {
+		module, graph := loadState(t, "external-agent")
+		stateResource(t, module, "coder_script.cleanup").AttributeValues["timezone"] = timezone
+		return terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+	}
+
+	state, err := convert("Europe/Berlin")
+	require.NoError(t, err)
+	require.Equal(t, "CRON_TZ=Europe/Berlin 0 0 2 * * *", state.Resources[0].Agents[0].Scripts[0].Cron)
+
+	state, err = convert("")
+	require.NoError(t, err)
+	require.Equal(t, "0 0 2 * * *", state.Resources[0].Agents[0].Scripts[0].Cron)
+
+	_, err = convert("Mars/Olympus_Mons")
+	require.ErrorContains(t, err, "invalid timezone")
+}
+
+func TestScriptBuildTriggers(t *testing.T) {
+	t.Parallel()
+	module, graph := loadState(t, "external-agent")
+	script := stateResource(t, module, "coder_script.cleanup")
+	script.AttributeValues["run_on_build_success"] = true
+	script.AttributeValues["run_on_build_failure"] = false
+
+	state, err := terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+	require.NoError(t, err)
+	require.Len(t, state.Resources[0].Agents[0].Scripts, 1)
+	converted := state.Resources[0].Agents[0].Scripts[0]
+	require.True(t, converted.RunOnBuildSuccess)
+	require.False(t, converted.RunOnBuildFailure)
+	require.False(t, converted.RunOnStart)
+}
+
+func TestScriptDiskPressure(t *testing.T) {
+	t.Parallel()
+	convert := func(plan bool, attributes map[string]interface{}) (*terraform.State, error) {
+		module, graph := loadState(t, "external-agent")
+		script := stateResource(t, module, "coder_script.cleanup")
+		for name, value := range attributes {
+			script.AttributeValues[name] = value
+		}
+		return terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{
+			Plan: plan,
+		})
+	}
+
+	state, err := convert(true, map[string]interface{}{
+		"disk_pressure_path":      "/home/coder",
+		"disk_pressure_threshold": 90,
+	})
+	require.NoError(t, err)
+	script := state.Resources[0].Agents[0].Scripts[0]
+	require.Equal(t, "/home/coder", script.DiskPressurePath)
+	require.EqualValues(t, 90, script.DiskPressureThreshold)
+
+	_, err = convert(true, map[string]interface{}{
+		"disk_pressure_threshold": 90,
+	})
+	require.ErrorContains(t, err, "coder_script.cleanup sets a disk pressure threshold without a path")
+
+	invalid := map[string]interface{}{
+		"disk_pressure_path":      "/home/coder",
+		"disk_pressure_threshold": 120,
+	}
+	_, err = convert(true, invalid)
+	require.ErrorContains(t, err, "invalid disk pressure threshold 120")
+
+	// The script of an applied state exists, so it's kept without the
+	// invalid settings.
+	state, err = convert(false, invalid)
+	require.NoError(t, err)
+	script = state.Resources[0].Agents[0].Scripts[0]
+	require.Empty(t, script.DiskPressurePath)
+	require.Zero(t, script.DiskPressureThreshold)
+	require.Len(t, state.Warnings, 1)
+	require.Contains(t, state.Warnings[0], "invalid disk pressure threshold 120")
+}
+
+func TestUnknownAttributes(t *testing.T) {
+	t.Parallel()
+	tfPlan, graph := loadPlan(t, "multiple-apps")
+	modules := []*tfjson.StateModule{tfPlan.PlannedValues.RootModule}
+
+	// Attributes unknown in every plan, e.g. ids and tokens, aren't listed.
+	state, err := terraform.ConvertStateWithOptions(modules, graph, terraform.ConvertOptions{
+		ResourceChanges: tfPlan.ResourceChanges,
+	})
+	require.NoError(t, err)
+	require.Empty(t, state.Resources[0].Agents[0].UnknownAttributes)
+	for _, app := range state.Resources[0].Agents[0].Apps {
+		require.Empty(t, app.UnknownAttributes, app.Slug)
+	}
+
+	for _, change := range tfPlan.ResourceChanges {
+		unknown, ok := change.Change.AfterUnknown.(map[string]interface{})
+		require.True(t, ok, change.Address)
+		switch change.Address {
+		case "coder_agent.dev1":
+			unknown["env"] = map[string]interface{}{"FOO": false, "HOST": true}
+			unknown["dir"] = false
+		case "coder_app.app2":
+			unknown["url"] = true
+			unknown["healthcheck"] = []interface{}{map[string]interface{}{"url": true}}
+		}
+	}
+	state, err = terraform.ConvertStateWithOptions(modules, graph, terraform.ConvertOptions{
+		ResourceChanges: tfPlan.ResourceChanges,
+	})
+	require.NoError(t, err)
+	sortResources(state.Resources)
+	agent := state.Resources[0].Agents[0]
+	require.Equal(t, []string{"env"}, agent.UnknownAttributes)
+	require.Empty(t, agent.Apps[0].UnknownAttributes)
+	require.Equal(t, []string{"healthcheck", "url"}, agent.Apps[1].UnknownAttributes)
+
+	// Unknown attributes are only listed with the changes of the plan.
+	state, err = terraform.ConvertState(modules, graph)
+	require.NoError(t, err)
+	require.Empty(t, state.Resources[0].Agents[0].UnknownAttributes)
+}
+
+func TestPlannedActions(t *testing.T) {
+	t.Parallel()
+	tfPlan, graph := loadPlan(t, "multiple-apps")
+	modules := []*tfjson.StateModule{tfPlan.PlannedValues.RootModule}
+	var change *tfjson.ResourceChange
+	for _, resourceChange := range tfPlan.ResourceChanges {
+		if resourceChange.Address == "null_resource.dev" {
+			change = resourceChange
+		}
+	}
+	require.NotNil(t, change)
+
+	for _, tc := range []struct {
+		actions tfjson.Actions
+		action  proto.ResourceAction
+	}{
+		{tfjson.Actions{tfjson.ActionCreate}, proto.ResourceAction_CREATE},
+		{tfjson.Actions{tfjson.ActionUpdate}, proto.ResourceAction_UPDATE},
+		{tfjson.Actions{tfjson.ActionDelete, tfjson.ActionCreate}, proto.ResourceAction_REPLACE},
+		{tfjson.Actions{tfjson.ActionNoop}, proto.ResourceAction_NO_OP},
+	} {
+		change.Change.Actions = tc.actions
+		state, err := terraform.ConvertStateWithOptions(modules, graph, terraform.ConvertOptions{
+			ResourceChanges: tfPlan.ResourceChanges,
+		})
+		require.NoError(t, err)
+		require.Len(t, state.Resources, 1)
+		require.Equal(t, tc.action, state.Resources[0].Action, tc.actions)
+	}
+
+	// Resources the plan deletes aren't planned, so they're converted from
+	// their changes.
+	change.Change.Actions = tfjson.Actions{tfjson.ActionUpdate}
+	changes := append([]*tfjson.ResourceChange{}, tfPlan.ResourceChanges...)
+	changes = append(changes, &tfjson.ResourceChange{
+		Address: "docker_volume.home",
+		Mode:    tfjson.ManagedResourceMode,
+		Type:    "docker_volume",
+		Name:    "home",
+		Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete}},
+	}, &tfjson.ResourceChange{
+		Address: "coder_agent.old",
+		Mode:    tfjson.ManagedResourceMode,
+		Type:    "coder_agent",
+		Name:    "old",
+		Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete}},
+	})
+	state, err := terraform.ConvertStateWithOptions(modules, graph, terraform.ConvertOptions{
+		ResourceChanges: changes,
+	})
+	require.NoError(t, err)
+	require.Len(t, state.Resources, 2)
+	require.Equal(t, proto.ResourceAction_UPDATE, state.Resources[0].Action)
+	require.Equal(t, &proto.Resource{
+		Name:    "home",
+		Type:    "docker_volume",
+		Action:  proto.ResourceAction_DELETE,
+		Address: "docker_volume.home",
+	}, state.Resources[1])
+
+	// Applied resources are annotated with the plan they were applied from.
+	state, err = terraform.ConvertStateWithOptions(modules, graph, terraform.ConvertOptions{
+		AppliedChanges: changes,
+	})
+	require.NoError(t, err)
+	require.Len(t, state.Resources, 2)
+	require.Equal(t, proto.ResourceAction_UPDATE, state.Resources[0].Action)
+	require.Equal(t, proto.ResourceAction_DELETE, state.Resources[1].Action)
+
+	// Resources converted without a plan have no action.
+	state, err = terraform.ConvertState(modules, graph)
+	require.NoError(t, err)
+	require.Equal(t, proto.ResourceAction_ACTION_UNSPECIFIED, state.Resources[0].Action)
+}
+
+func TestConvertResourcesAddress(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		fixture  string
+		resource string
+		address  string
+	}{
+		{"calling-module", "example", "module.module.null_resource.example"},
+		{"kubernetes-metadata", "main", "kubernetes_pod.main[0]"},
+	} {
+		module, graph := loadState(t, tc.fixture)
+		state, err := terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+		require.NoError(t, err)
+		var resource *proto.Resource
+		for _, r := range state.Resources {
+			if r.Name == tc.resource {
+				resource = r
+			}
+		}
+		require.NotNil(t, resource, tc.fixture)
+		require.Equal(t, tc.address, resource.Address, tc.fixture)
+	}
+}
+
+func TestWorkspaceNetwork(t *testing.T) {
+	t.Parallel()
+
+	module, graph := loadState(t, "workspace-network")
+	state, err := terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+	require.NoError(t, err)
+	require.Empty(t, state.Resources, "the network isn't a resource of the workspace")
+	require.Equal(t, &proto.WorkspaceNetwork{
+		PreferredDerpRegion:      "fra",
+		DisableDirectConnections: true,
+		Mtu:                      1400,
+	}, state.Network)
+
+	module, graph = loadState(t, "workspace-network")
+	module.Resources = nil
+	state, err = terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+	require.NoError(t, err)
+	require.Nil(t, state.Network)
+
+	module, graph = loadState(t, "workspace-network")
+	stateResource(t, module, "coder_workspace_network.main").AttributeValues["mtu"] = 576
+	_, err = terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+	require.ErrorContains(t, err, "must be between 1280 and 9000")
+
+	module, graph = loadState(t, "workspace-network")
+	other := *stateResource(t, module, "coder_workspace_network.main")
+	other.Address = "coder_workspace_network.other"
+	other.Name = "other"
+	module.Resources = append(module.Resources, &other)
+	_, err = terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+	require.ErrorContains(t, err, "only one coder_workspace_network is allowed, found coder_workspace_network.main and coder_workspace_network.other")
+}
+
+func TestAgentPlatformValidation(t *testing.T) {
+	t.Parallel()
+	convert := func(operatingSystem, architecture string) error {
+		module, graph := loadState(t, "multiple-apps")
+		agent := stateResource(t, module, "coder_agent.dev1")
+		agent.AttributeValues["os"] = operatingSystem
+		agent.AttributeValues["arch"] = architecture
+		_, err := terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+		return err
+	}
+
+	require.NoError(t, convert("linux", "armv7"))
+	require.NoError(t, convert("windows", "arm64"))
+
+	var platformErr *terraform.UnsupportedAgentPlatformError
+	err := convert("plan9", "amd64")
+	require.ErrorAs(t, err, &platformErr)
+	require.Equal(t, "dev1", platformErr.Agent)
+	require.ErrorContains(t, err, `unsupported os "plan9", must be one of: darwin, linux, windows`)
+
+	err = convert("darwin", "armv7")
+	require.ErrorAs(t, err, &platformErr)
+	require.Equal(t, []string{"amd64", "arm64"}, platformErr.Supported["darwin"])
+	require.ErrorContains(t, err, `unsupported arch "armv7" for os "darwin", must be one of: amd64, arm64`)
+}
+
+func TestAppSharingLevelPolicy(t *testing.T) {
+	t.Parallel()
+	convert := func(share string, maxLevel *proto.AppSharingLevel) (*terraform.State, error) {
+		module, graph := loadState(t, "multiple-apps")
+		stateResource(t, module, "coder_app.app1").AttributeValues["share"] = share
+		state, err := terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{
+			MaxAppSharingLevel: maxLevel,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sortResources(state.Resources)
+		return state, nil
+	}
+	authenticated := proto.AppSharingLevel_AUTHENTICATED
+
+	state, err := convert("public", nil)
+	require.NoError(t, err)
+	require.Equal(t, proto.AppSharingLevel_PUBLIC, state.Resources[0].Agents[0].Apps[0].SharingLevel)
+
+	state, err = convert("authenticated", &authenticated)
+	require.NoError(t, err)
+	require.Equal(t, proto.AppSharingLevel_AUTHENTICATED, state.Resources[0].Agents[0].Apps[0].SharingLevel)
+
+	_, err = convert("public", &authenticated)
+	var sharingErr *terraform.AppSharingLevelError
+	require.ErrorAs(t, err, &sharingErr)
+	require.Equal(t, "app1", sharingErr.App)
+	require.Equal(t, proto.AppSharingLevel_PUBLIC, sharingErr.SharingLevel)
+	require.ErrorContains(t, err, `app "app1" is shared with "public", but the template allows at most "authenticated"`)
+}
+
+func TestModuleDepthLimit(t *testing.T) {
+	t.Parallel()
+	// nested returns the calling-module state with its module nested n
+	// levels deeper than in the fixture, where it's one level deep.
+	nested := func(n int) ([]*tfjson.StateModule, string) {
+		module, graph := loadState(t, "calling-module")
+		for i := 0; i < n; i++ {
+			module.ChildModules = []*tfjson.StateModule{{
+				Address:      "module.wrapper",
+				ChildModules: module.ChildModules,
+			}}
+		}
+		return []*tfjson.StateModule{module}, graph
+	}
+
+	modules, graph := nested(2)
+	state, err := terraform.ConvertStateWithOptions(modules, graph, terraform.ConvertOptions{MaxModuleDepth: 3})
+	require.NoError(t, err)
+	require.Len(t, state.Resources, 1)
+
+	modules, graph = nested(3)
+	_, err = terraform.ConvertStateWithOptions(modules, graph, terraform.ConvertOptions{MaxModuleDepth: 3})
+	var depthErr *terraform.ModuleDepthError
+	require.ErrorAs(t, err, &depthErr)
+	require.Equal(t, 3, depthErr.MaxDepth)
+	require.ErrorContains(t, err, "nested deeper than the maximum depth of 3")
+
+	modules, graph = nested(terraform.DefaultMaxModuleDepth)
+	_, err = terraform.ConvertState(modules, graph)
+	require.ErrorAs(t, err, &depthErr)
+}
+
+func TestGraphCycle(t *testing.T) {
+	t.Parallel()
+	module, graph := loadState(t, "chaining-resources")
+	// Terraform refuses to graph cycles, so one is added to the graph of
+	// the fixture, where null_resource.a depends on null_resource.b.
+	graph = strings.Replace(graph, "\t}\n}",
+		"\t\t\"[root] null_resource.b (expand)\" -> \"[root] null_resource.a (expand)\"\n\t}\n}", 1)
+
+	_, err := terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+	var cycleErr *terraform.GraphCycleError
+	require.ErrorAs(t, err, &cycleErr)
+	require.Equal(t, []string{"null_resource.b", "null_resource.a", "null_resource.b"}, cycleErr.Cycle)
+}
+
+// loadState returns the root module and the graph of the state fixture in
+// the testdata directory.
+func loadState(t *testing.T, name string) (*tfjson.StateModule, string) {
+	t.Helper()
+	dir := filepath.Join("testdata", name)
+	tfStateRaw, err := os.ReadFile(filepath.Join(dir, name+".tfstate.json"))
+	require.NoError(t, err)
+	var tfState tfjson.State
+	err = json.Unmarshal(tfStateRaw, &tfState)
+	require.NoError(t, err)
+	tfStateGraph, err := os.ReadFile(filepath.Join(dir, name+".tfstate.dot"))
+	require.NoError(t, err)
+	return tfState.Values.RootModule, string(tfStateGraph)
+}
+
+// loadPlan returns the plan fixture in the testdata directory and its graph.
+func loadPlan(t *testing.T, name string) (*tfjson.Plan, string) {
+	t.Helper()
+	dir := filepath.Join("testdata", name)
+	tfPlanRaw, err := os.ReadFile(filepath.Join(dir, name+".tfplan.json"))
+	require.NoError(t, err)
+	var tfPlan tfjson.Plan
+	err = json.Unmarshal(tfPlanRaw, &tfPlan)
+	require.NoError(t, err)
+	tfPlanGraph, err := os.ReadFile(filepath.Join(dir, name+".tfplan.dot"))
+	require.NoError(t, err)
+	return &tfPlan, string(tfPlanGraph)
+}
+
+// stateResource returns the resource of the module with the address, to
+// edit the attributes of a fixture.
+func stateResource(t *testing.T, module *tfjson.StateModule, address string) *tfjson.StateResource {
+	t.Helper()
+	for _, resource := range module.Resources {
+		if resource.Address == address {
+			return resource
+		}
+	}
+	require.FailNow(t, "resource not found", address)
+	return nil
+}
+
 // sortResource ensures resources appear in a consistent ordering
 // to prevent tests from flaking.
 func sortResources(resources []*proto.Resource) {
@@ -901,3 +1669,124 @@ func sortResources(resources []*proto.Resource) {
 		})
 	}
 }
+
+func TestAppHealthcheckValidation(t *testing.T) {
+	t.Parallel()
+	convert := func(healthcheck map[string]interface{}) (*terraform.State, error) {
+		module, graph := loadState(t, "multiple-apps")
+		stateResource(t, module, "coder_app.app2").AttributeValues["healthcheck"] = []interface{}{healthcheck}
+		state, err := terraform.ConvertStateWithOptions([]*tfjson.StateModule{module}, graph, terraform.ConvertOptions{Plan: true})
+		if err != nil {
+			return nil, err
+		}
+		sortResources(state.Resources)
+		return state, nil
+	}
+
+	state, err := convert(map[string]interface{}{
+		"url":       "http://localhost:8080/healthz",
+		"interval":  5,
+		"threshold": 6,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:8080/healthz", state.Resources[0].Agents[0].Apps[1].Healthcheck.Url)
+
+	// Attributes only known after apply aren't validated.
+	_, err = convert(map[string]interface{}{})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name        string
+		healthcheck map[string]interface{}
+		field       string
+	}{
+		{"MalformedURL", map[string]interface{}{"url": "http://[::1"}, "url"},
+		{"RelativeURL", map[string]interface{}{"url": "/healthz"}, "url"},
+		{"UnsupportedScheme", map[string]interface{}{"url": "ftp://localhost/healthz"}, "url"},
+		{"NegativeInterval", map[string]interface{}{"interval": -1}, "interval"},
+		{"LongInterval", map[string]interface{}{"interval": 86400}, "interval"},
+		{"NegativeThreshold", map[string]interface{}{"threshold": -5}, "threshold"},
+		{"LargeThreshold", map[string]interface{}{"threshold": 1000}, "threshold"},
+	} {
+		_, err := convert(tc.healthcheck)
+		var healthcheckErr *terraform.InvalidHealthcheckError
+		require.ErrorAs(t, err, &healthcheckErr, tc.name)
+		require.Equal(t, "app2", healthcheckErr.App, tc.name)
+		require.Equal(t, tc.field, healthcheckErr.Field, tc.name)
+	}
+
+	// The resources of applied states exist, so they're always converted.
+	module, graph := loadState(t, "multiple-apps")
+	stateResource(t, module, "coder_app.app2").AttributeValues["healthcheck"] = []interface{}{
+		map[string]interface{}{"url": "/healthz"},
+	}
+	_, err = terraform.ConvertState([]*tfjson.StateModule{module}, graph)
+	require.NoError(t, err)
+}
+
+// largeState returns a state with n instances, each with an agent and an
+// app, and its graph.
+func largeState(n int) ([]*tfjson.StateModule, string) {
+	module := &tfjson.StateModule{}
+	var graph strings.Builder
+	_, _ = graph.WriteString("digraph {\n\tcompound = \"true\"\n\tnewrank = \"true\"\n\tsubgraph \"root\" {\n")
+	for i := 0; i < n; i++ {
+		agentID := fmt.Sprintf("agent-%d", i)
+		module.Resources = append(module.Resources, &tfjson.StateResource{
+			Address: fmt.Sprintf("coder_agent.dev%d", i),
+			Type:    "coder_agent",
+			Name:    fmt.Sprintf("dev%d", i),
+			Mode:    tfjson.ManagedResourceMode,
+			AttributeValues: map[string]interface{}{
+				"id":   agentID,
+				"os":   "linux",
+				"arch": "amd64",
+				"auth": "token",
+			},
+		}, &tfjson.StateResource{
+			Address: fmt.Sprintf("coder_app.code%d", i),
+			Type:    "coder_app",
+			Name:    fmt.Sprintf("code%d", i),
+			Mode:    tfjson.ManagedResourceMode,
+			AttributeValues: map[string]interface{}{
+				"agent_id": agentID,
+				"slug":     "code",
+			},
+		}, &tfjson.StateResource{
+			Address: fmt.Sprintf("null_resource.dev%d", i),
+			Type:    "null_resource",
+			Name:    fmt.Sprintf("dev%d", i),
+			Mode:    tfjson.ManagedResourceMode,
+		})
+		_, _ = fmt.Fprintf(&graph, "\t\t\"[root] coder_agent.dev%[1]d\" [label = \"coder_agent.dev%[1]d\", shape = \"box\"]\n", i)
+		_, _ = fmt.Fprintf(&graph, "\t\t\"[root] null_resource.dev%[1]d\" [label = \"null_resource.dev%[1]d\", shape = \"box\"]\n", i)
+		_, _ = fmt.Fprintf(&graph, "\t\t\"[root] null_resource.dev%[1]d\" -> \"[root] coder_agent.dev%[1]d\"\n", i)
+	}
+	_, _ = graph.WriteString("\t}\n}\n")
+	return []*tfjson.StateModule{module}, graph.String()
+}
+
+func TestLargeState(t *testing.T) {
+	t.Parallel()
+
+	modules, graph := largeState(200)
+	state, err := terraform.ConvertState(modules, graph)
+	require.NoError(t, err)
+	require.Len(t, state.Resources, 200)
+	for _, resource := range state.Resources {
+		require.Len(t, resource.Agents, 1, resource.Name)
+		require.Equal(t, resource.Name, resource.Agents[0].Name)
+		require.Len(t, resource.Agents[0].Apps, 1, resource.Name)
+	}
+}
+
+func BenchmarkConvertState(b *testing.B) {
+	modules, graph := largeState(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := terraform.ConvertState(modules, graph)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// ResourceTagsVariable is the Terraform variable that receives the standard
+// tags for cloud resources. A template declaring
+// `variable "coder_resource_tags" { type = map(string) }` can pass it to the
+// tags or labels of its resources, or to the default tags of a provider, so
+// costs can be attributed to workspaces without hand-rolling tags.
+//
+// The variable is not exposed as a template variable.
+const ResourceTagsVariable = "coder_resource_tags"
+
+// resourceTags returns the standard tags of the workspace. Keys
+// only use characters accepted by all major clouds.
+//
+// The cost center is the groups of the owner, joined by underscores, which
+// group names can't contain. The template version isn't a tag, since
+// resources would be updated by every new version.
+func resourceTags(metadata *proto.Metadata) map[string]string {
+	tags := map[string]string{
+		"coder_owner":        metadata.GetWorkspaceOwner(),
+		"coder_owner_id":     metadata.GetWorkspaceOwnerId(),
+		"coder_workspace":    metadata.GetWorkspaceName(),
+		"coder_workspace_id": metadata.GetWorkspaceId(),
+		"coder_template":     metadata.GetTemplateName(),
+		"coder_template_id":  metadata.GetTemplateId(),
+		"coder_cost_center":  strings.Join(metadata.GetWorkspaceOwnerGroups(), "_"),
+	}
+	for key, value := range tags {
+		if value == "" {
+			delete(tags, key)
+		}
+	}
+	return tags
+}
+
+// resourceTagsEnv returns the environment passing the tags to the module in
+// workdir. Nil is returned if the module doesn't declare ResourceTagsVariable.
+func resourceTagsEnv(workdir string, tags map[string]string) ([]string, error) {
+	module, diags := tfconfig.LoadModule(workdir)
+	if diags.HasErrors() {
+		return nil, xerrors.Errorf("load module: %s", formatDiagnostics(workdir, diags))
+	}
+	if _, ok := module.Variables[ResourceTagsVariable]; !ok {
+		return nil, nil
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return nil, xerrors.Errorf("marshal resource tags: %w", err)
+	}
+	return []string{"TF_VAR_" + ResourceTagsVariable + "=" + string(data)}, nil
+}
+
+// untaggedResources returns the addresses of the planned resources that
+// support tags or labels but are missing some of the standard tags. Resources
+// with tags that are unknown until apply are skipped.
+func untaggedResources(module *tfjson.StateModule, tags map[string]string) []string {
+	if module == nil || len(tags) == 0 {
+		return nil
+	}
+	var untagged []string
+	for _, child := range module.ChildModules {
+		untagged = append(untagged, untaggedResources(child, tags)...)
+	}
+	for _, resource := range module.Resources {
+		if resource.Mode != tfjson.ManagedResourceMode || strings.HasPrefix(resource.Type, "coder_") {
+			continue
+		}
+		resourceTags, ok := taggableAttribute(resource.AttributeValues)
+		if !ok {
+			continue
+		}
+		for key, value := range tags {
+			if resourceTags[key] != value {
+				untagged = append(untagged, resource.Address)
+				break
+			}
+		}
+	}
+	sort.Strings(untagged)
+	return untagged
+}
+
+// taggableAttribute returns the tags or labels of a resource. False is
+// returned if the resource doesn't support tags, or if they're unknown.
+func taggableAttribute(attrs map[string]interface{}) (map[string]interface{}, bool) {
+	// Kubernetes resources are labeled through their metadata.
+	if metadata, ok := attrs["metadata"].([]interface{}); ok && len(metadata) == 1 {
+		if nested, ok := metadata[0].(map[string]interface{}); ok {
+			attrs = nested
+		}
+	}
+	// tags_all includes the default tags of the AWS provider.
+	for _, name := range []string{"tags_all", "tags", "labels"} {
+		value, ok := attrs[name]
+		if !ok {
+			continue
+		}
+		if value == nil {
+			return map[string]interface{}{}, true
+		}
+		tags, ok := value.(map[string]interface{})
+		if !ok {
+			// Some providers use lists for labels, which aren't checked.
+			return nil, false
+		}
+		return tags, true
+	}
+	return nil, false
+}
+
+// warnUntaggedResources logs the resources that are missing the standard
+// tags, which means their costs can't be attributed to the workspace.
+func warnUntaggedResources(logr logSink, module *tfjson.StateModule, tags map[string]string) {
+	untagged := untaggedResources(module, tags)
+	if len(untagged) == 0 {
+		return
+	}
+	logr.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf(
+		"The following resources support tags but are missing the tags from var.%s: %s",
+		ResourceTagsVariable, strings.Join(untagged, ", ")))
+}
@@ -0,0 +1,108 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestResourceTags(t *testing.T) {
+	t.Parallel()
+
+	tags := resourceTags(&proto.Metadata{
+		WorkspaceOwner:  "alice",
+		WorkspaceName:   "dev",
+		TemplateName:    "aws-linux",
+		TemplateVersion: "v1",
+	})
+	require.Equal(t, map[string]string{
+		"coder_owner":     "alice",
+		"coder_workspace": "dev",
+		"coder_template":  "aws-linux",
+	}, tags)
+
+	grouped := resourceTags(&proto.Metadata{
+		WorkspaceOwner:       "bob",
+		WorkspaceOwnerGroups: []string{"finance", "platform"},
+	})
+	require.Equal(t, map[string]string{
+		"coder_owner":       "bob",
+		"coder_cost_center": "finance_platform",
+	}, grouped)
+
+	t.Run("Env", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		env, err := resourceTagsEnv(dir, tags)
+		require.NoError(t, err)
+		require.Nil(t, env, "tags must only be passed to modules declaring the variable")
+
+		err = os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`
+variable "coder_resource_tags" {
+	type = map(string)
+}
+`), 0o600)
+		require.NoError(t, err)
+		env, err = resourceTagsEnv(dir, tags)
+		require.NoError(t, err)
+		require.Equal(t, []string{`TF_VAR_coder_resource_tags={"coder_owner":"alice","coder_template":"aws-linux","coder_workspace":"dev"}`}, env)
+	})
+
+	t.Run("Untagged", func(t *testing.T) {
+		t.Parallel()
+		module := &tfjson.StateModule{
+			Resources: []*tfjson.StateResource{{
+				Address: "aws_instance.tagged",
+				Mode:    tfjson.ManagedResourceMode,
+				Type:    "aws_instance",
+				AttributeValues: map[string]interface{}{
+					"tags_all": map[string]interface{}{"coder_owner": "alice", "coder_workspace": "dev", "coder_template": "aws-linux", "Name": "dev"},
+				},
+			}, {
+				Address: "aws_ebs_volume.untagged",
+				Mode:    tfjson.ManagedResourceMode,
+				Type:    "aws_ebs_volume",
+				AttributeValues: map[string]interface{}{
+					"tags": nil,
+				},
+			}, {
+				Address: "aws_eip.unknown",
+				Mode:    tfjson.ManagedResourceMode,
+				Type:    "aws_eip",
+				// Unknown values are omitted from the plan.
+				AttributeValues: map[string]interface{}{},
+			}, {
+				Address: "coder_agent.main",
+				Mode:    tfjson.ManagedResourceMode,
+				Type:    "coder_agent",
+				AttributeValues: map[string]interface{}{
+					"tags": nil,
+				},
+			}},
+			ChildModules: []*tfjson.StateModule{{
+				Resources: []*tfjson.StateResource{{
+					Address: "module.k8s.kubernetes_pod.main",
+					Mode:    tfjson.ManagedResourceMode,
+					Type:    "kubernetes_pod",
+					AttributeValues: map[string]interface{}{
+						"metadata": []interface{}{map[string]interface{}{
+							"labels": map[string]interface{}{"coder_owner": "alice"},
+						}},
+					},
+				}},
+			}},
+		}
+		require.Equal(t, []string{"aws_ebs_volume.untagged", "module.k8s.kubernetes_pod.main"}, untaggedResources(module, tags))
+
+		logr := &mockLogger{}
+		warnUntaggedResources(logr, module, tags)
+		require.Len(t, logr.logs, 1)
+		require.Equal(t, proto.LogLevel_WARN, logr.logs[0].Level)
+		require.Contains(t, logr.logs[0].Output, "aws_ebs_volume.untagged")
+	})
+}
@@ -0,0 +1,189 @@
+package terraform
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// ApplyRetryOptions retry applies that failed with transient errors of
+// providers, such as rate limits, eventual consistency or server errors of
+// cloud APIs.
+type ApplyRetryOptions struct {
+	// MaxAttempts is the number of times a failed apply is retried.
+	// Defaults to no retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, which doubles
+	// with every further retry. Defaults to 10 seconds.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay before a retry. Defaults to 2 minutes,
+	// keep it well below the 5 minutes after which coderd marks jobs as
+	// hung (see unhanger package).
+	MaxBackoff time.Duration
+}
+
+// backoff returns the delay before the retry, counting from 1.
+func (o ApplyRetryOptions) backoff(retry int) time.Duration {
+	initial, maxBackoff := o.InitialBackoff, o.MaxBackoff
+	if initial <= 0 {
+		initial = 10 * time.Second
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 2 * time.Minute
+	}
+	backoff := initial
+	for i := 1; i < retry && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// transientErrorPatterns match the errors of providers that are likely to
+// succeed when retried. They're matched against the summary and detail of
+// error diagnostics.
+var transientErrorPatterns = []*regexp.Regexp{
+	// Rate limits.
+	regexp.MustCompile(`(?i)rate ?limit|rate exceeded|throttl|too many requests|RequestLimitExceeded|\b429\b`),
+	// Server errors.
+	regexp.MustCompile(`(?i)\b50[0234]\b|internal server error|bad gateway|service unavailable|gateway time-?out|InternalError|ServiceUnavailable`),
+	// Eventual consistency of cloud APIs, e.g. an instance profile that
+	// isn't propagated yet.
+	regexp.MustCompile(`(?i)eventual(ly)? consisten|InvalidInstanceID\.NotFound|not yet (available|propagated)|is not ready`),
+	// Connectivity.
+	regexp.MustCompile(`(?i)connection reset by peer|i/o timeout|TLS handshake timeout|unexpected EOF`),
+}
+
+// isTransientDiagnostic reports whether the diagnostic is an error likely to
+// succeed when retried.
+func isTransientDiagnostic(diag *tfjson.Diagnostic) bool {
+	if diag == nil || diag.Severity != tfjson.DiagnosticSeverityError {
+		return false
+	}
+	for _, pattern := range transientErrorPatterns {
+		if pattern.MatchString(diag.Summary) || pattern.MatchString(diag.Detail) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyErrors classifies the error diagnostics of the JSON log stream of an
+// apply.
+type applyErrors struct {
+	errors    int
+	transient int
+	// summary is the summary of the first transient error.
+	summary string
+	// capacity counts the errors of providers that ran out of capacity,
+	// which aren't transient, see capacityErrorPatterns.
+	capacity int
+	// capacitySummary is the summary of the first capacity error.
+	capacitySummary string
+}
+
+func (a *applyErrors) onLog(log *terraformProvisionLog) {
+	if log.Diagnostic == nil || log.Diagnostic.Severity != tfjson.DiagnosticSeverityError {
+		return
+	}
+	a.errors++
+	if isCapacityDiagnostic(log.Diagnostic) {
+		a.capacity++
+		if a.capacitySummary == "" {
+			a.capacitySummary = log.Diagnostic.Summary
+		}
+		return
+	}
+	if !isTransientDiagnostic(log.Diagnostic) {
+		return
+	}
+	a.transient++
+	if a.summary == "" {
+		a.summary = log.Diagnostic.Summary
+	}
+}
+
+// retryable reports whether the apply only failed with transient errors.
+func (a *applyErrors) retryable() bool {
+	return a.errors > 0 && a.errors == a.transient
+}
+
+// outOfCapacity reports whether the apply only failed with capacity errors,
+// so it may succeed with another capacity option.
+func (a *applyErrors) outOfCapacity() bool {
+	return a.errors > 0 && a.errors == a.capacity
+}
+
+// retryPlan is the plan command of a build, kept from plan to apply since
+// the plan of a failed apply is stale and must be created again before
+// retrying. It holds the tokens of the build, so it's only kept in memory
+// and forgotten once the build completes.
+type retryPlan struct {
+	args []string
+	env  []string
+	// vars are the "-var" arguments of the plan, which the apply taking
+	// snapshots is passed.
+	vars []string
+	// destroy, resourceTags, maxAppSharingLevel and appHostname are the
+	// checks of the first plan, which every plan of the build runs again.
+	destroy            bool
+	resourceTags       map[string]string
+	maxAppSharingLevel *proto.AppSharingLevel
+	appHostname        *string
+	// changes are the actions the first plan planned for the resources, by
+	// address, which were shown to coderd.
+	changes map[string]string
+	// snapshot is set if the state contains snapshot resources, see
+	// snapshotBeforeDestructiveChanges, and restoreSnapshot is the ID of
+	// the snapshot the build restores.
+	snapshot        bool
+	restoreSnapshot string
+}
+
+type retryPlanKey struct {
+	workdir   string
+	workspace string
+}
+
+// retryPlans are the plan commands of the builds in progress, by work
+// directory and Terraform workspace. Templates with Terraform workspaces
+// keep the command of every workspace.
+type retryPlans struct {
+	mut   sync.Mutex
+	plans map[retryPlanKey]*retryPlan
+}
+
+func (r *retryPlans) store(workdir, workspace string, plan *retryPlan) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.plans == nil {
+		r.plans = map[retryPlanKey]*retryPlan{}
+	}
+	r.plans[retryPlanKey{workdir: workdir, workspace: workspace}] = plan
+}
+
+// load returns the plan command of the Terraform workspace, nil if it
+// wasn't kept.
+func (r *retryPlans) load(workdir, workspace string) *retryPlan {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.plans[retryPlanKey{workdir: workdir, workspace: workspace}]
+}
+
+// remove forgets the plan commands of the build and of all its Terraform
+// workspaces.
+func (r *retryPlans) remove(workdir string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	for key := range r.plans {
+		if key.workdir == workdir {
+			delete(r.plans, key)
+		}
+	}
+}
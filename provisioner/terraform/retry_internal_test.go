@@ -0,0 +1,123 @@
+package terraform
+
+import (
+	"testing"
+	"time"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	opts := ApplyRetryOptions{}
+	require.Equal(t, 10*time.Second, opts.backoff(1))
+	require.Equal(t, 20*time.Second, opts.backoff(2))
+	require.Equal(t, 80*time.Second, opts.backoff(4))
+	require.Equal(t, 2*time.Minute, opts.backoff(5))
+	require.Equal(t, 2*time.Minute, opts.backoff(100))
+
+	opts = ApplyRetryOptions{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}
+	require.Equal(t, time.Second, opts.backoff(1))
+	require.Equal(t, 2*time.Second, opts.backoff(2))
+	require.Equal(t, 3*time.Second, opts.backoff(3))
+}
+
+func TestApplyErrors(t *testing.T) {
+	t.Parallel()
+
+	diagnostic := func(severity tfjson.DiagnosticSeverity, summary, detail string) *terraformProvisionLog {
+		return &terraformProvisionLog{
+			Level: "error",
+			Diagnostic: &tfjson.Diagnostic{
+				Severity: severity,
+				Summary:  summary,
+				Detail:   detail,
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		logs      []*terraformProvisionLog
+		retryable bool
+	}{{
+		name: "NoErrors",
+		logs: []*terraformProvisionLog{{Level: "info", Message: "Apply complete!"}},
+	}, {
+		name: "RateLimit",
+		logs: []*terraformProvisionLog{
+			diagnostic(tfjson.DiagnosticSeverityError, "creating EC2 Instance: RequestLimitExceeded: Request limit exceeded.", ""),
+		},
+		retryable: true,
+	}, {
+		name: "ServerError",
+		logs: []*terraformProvisionLog{
+			diagnostic(tfjson.DiagnosticSeverityError, "Error creating instance", "googleapi: Error 503: Service Unavailable"),
+		},
+		retryable: true,
+	}, {
+		name: "EventualConsistency",
+		logs: []*terraformProvisionLog{
+			diagnostic(tfjson.DiagnosticSeverityError, "waiting for EC2 Instance create: InvalidInstanceID.NotFound", ""),
+		},
+		retryable: true,
+	}, {
+		name: "Permanent",
+		logs: []*terraformProvisionLog{
+			diagnostic(tfjson.DiagnosticSeverityError, "Unsupported argument", `An argument named "imag" is not expected here.`),
+		},
+	}, {
+		name: "TransientAndPermanent",
+		logs: []*terraformProvisionLog{
+			diagnostic(tfjson.DiagnosticSeverityError, "Error: 429 Too Many Requests", ""),
+			diagnostic(tfjson.DiagnosticSeverityError, "Invalid reference", "A reference to a resource type must be followed by at least one attribute access."),
+		},
+	}, {
+		name: "Warning",
+		logs: []*terraformProvisionLog{
+			diagnostic(tfjson.DiagnosticSeverityWarning, "Throttled while refreshing", ""),
+		},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			applyErrs := &applyErrors{}
+			for _, log := range tc.logs {
+				applyErrs.onLog(log)
+			}
+			require.Equal(t, tc.retryable, applyErrs.retryable())
+			if tc.retryable {
+				require.Equal(t, tc.logs[0].Diagnostic.Summary, applyErrs.summary)
+			}
+		})
+	}
+}
+
+func TestRetryPlans(t *testing.T) {
+	t.Parallel()
+
+	var plans retryPlans
+	require.Nil(t, plans.load("/session", ""))
+
+	plans.store("/session", "", &retryPlan{
+		args: []string{"plan", "-var", "region=eu"},
+		env:  []string{"CODER_WORKSPACE_NAME=dev"},
+	})
+	require.Equal(t, &retryPlan{
+		args: []string{"plan", "-var", "region=eu"},
+		env:  []string{"CODER_WORKSPACE_NAME=dev"},
+	}, plans.load("/session", ""))
+
+	// Terraform workspaces are planned with commands of their own.
+	plans.store("/session", "network", &retryPlan{args: []string{"plan", "-out=network.tfplan"}})
+	require.Equal(t, []string{"plan", "-out=network.tfplan"}, plans.load("/session", "network").args)
+	plans.store("/other", "", &retryPlan{args: []string{"plan"}})
+
+	plans.remove("/session")
+	plans.remove("/session")
+	require.Nil(t, plans.load("/session", ""))
+	require.Nil(t, plans.load("/session", "network"))
+	require.NotNil(t, plans.load("/other", ""))
+}
@@ -0,0 +1,231 @@
+package terraform
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cli/safeexec"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+)
+
+// SandboxRuntime is the runtime Terraform is executed in.
+type SandboxRuntime string
+
+const (
+	// SandboxRuntimeNone executes Terraform directly.
+	SandboxRuntimeNone SandboxRuntime = ""
+	// SandboxRuntimeNsjail executes Terraform with nsjail, which isolates it
+	// with namespaces and an optional seccomp policy.
+	SandboxRuntimeNsjail SandboxRuntime = "nsjail"
+	// SandboxRuntimeGVisor executes Terraform with `runsc do`, which
+	// intercepts its syscalls in a userspace kernel.
+	SandboxRuntimeGVisor SandboxRuntime = "gvisor"
+)
+
+// SandboxOptions contain Terraform and the providers it runs, so malicious
+// templates or providers can't tamper with the provisioner or reach hosts
+// they don't need.
+//
+// The filesystem is read-only except for the working directory of the job,
+// the plugin cache and a private /tmp.
+type SandboxOptions struct {
+	Runtime SandboxRuntime
+	// BinaryPath is the path of nsjail or runsc. Defaults to looking it up
+	// in $PATH.
+	BinaryPath string
+	// SeccompProfile is the path of a seccomp policy in the Kafel language.
+	// Only nsjail supports it, gVisor filters syscalls itself.
+	SeccompProfile string
+	// EgressAllowlist lists the hosts Terraform and its providers may
+	// connect to, e.g. "registry.terraform.io" or "*.amazonaws.com".
+	// Networking is disabled if it's empty. Otherwise, Terraform runs in a
+	// network namespace whose only route out is a proxy that enforces the
+	// list, which is configured with $HTTP_PROXY and $HTTPS_PROXY. Creating
+	// the namespace requires CAP_SYS_ADMIN.
+	EgressAllowlist []string
+}
+
+// sandbox wraps Terraform commands in the configured runtime.
+type sandbox struct {
+	opts       SandboxOptions
+	binaryPath string
+	// network is the namespace Terraform runs in if egress is allowed,
+	// nil otherwise.
+	network *isolatedNetwork
+	// proxyURL is the address of the egress proxy in the namespace.
+	proxyURL string
+}
+
+// newSandbox validates the options and starts the egress proxy, which is
+// closed when the context is canceled.
+func newSandbox(ctx context.Context, logger slog.Logger, opts SandboxOptions) (*sandbox, error) {
+	var binaryName string
+	switch opts.Runtime {
+	case SandboxRuntimeNsjail:
+		binaryName = "nsjail"
+	case SandboxRuntimeGVisor:
+		binaryName = "runsc"
+		if opts.SeccompProfile != "" {
+			return nil, xerrors.New("seccomp profiles are only supported by nsjail")
+		}
+	default:
+		return nil, xerrors.Errorf("unknown sandbox runtime %q", opts.Runtime)
+	}
+	s := &sandbox{opts: opts, binaryPath: opts.BinaryPath}
+	if s.binaryPath == "" {
+		var err error
+		s.binaryPath, err = safeexec.LookPath(binaryName)
+		if err != nil {
+			return nil, xerrors.Errorf("%s binary not found: %w", binaryName, err)
+		}
+	}
+	for _, host := range opts.EgressAllowlist {
+		if !validEgressHost(host) {
+			return nil, xerrors.Errorf("invalid egress host %q, expected a hostname like \"example.com\" or \"*.example.com\"", host)
+		}
+	}
+	if len(opts.EgressAllowlist) > 0 {
+		network, err := newIsolatedNetwork(ctx)
+		if err != nil {
+			return nil, xerrors.Errorf("create network namespace: %w", err)
+		}
+		// The proxy listens in the namespace, but connects to allowed hosts
+		// from the network of the provisioner.
+		var listener net.Listener
+		err = network.run(func() error {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			return err
+		})
+		if err != nil {
+			return nil, xerrors.Errorf("listen egress proxy: %w", err)
+		}
+		srv := &http.Server{
+			Handler:           newEgressProxy(logger.Named("egress-proxy"), opts.EgressAllowlist),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			_ = srv.Serve(listener)
+		}()
+		go func() {
+			<-ctx.Done()
+			_ = srv.Close()
+		}()
+		s.network = network
+		s.proxyURL = "http://" + listener.Addr().String()
+	}
+	logger.Info(ctx, "executing terraform in sandbox",
+		slog.F("runtime", opts.Runtime),
+		slog.F("binary_path", s.binaryPath),
+		slog.F("egress_allowlist", opts.EgressAllowlist))
+	return s, nil
+}
+
+// command returns a command executing Terraform in the sandbox. Only the
+// working directory and the plugin cache are writable.
+func (s *sandbox) command(ctx context.Context, workdir, cachePath, binaryPath string, args, env []string) *exec.Cmd {
+	var sandboxArgs []string
+	switch s.opts.Runtime {
+	case SandboxRuntimeNsjail:
+		sandboxArgs = []string{
+			"--mode", "o",
+			"--quiet",
+			"--keep_env",
+			// nsjail limits resources and the runtime by default, which
+			// breaks large plans and long applies.
+			"--time_limit", "0",
+			"--rlimit_as", "inf",
+			"--rlimit_cpu", "inf",
+			"--rlimit_fsize", "inf",
+			"--rlimit_nofile", "max",
+			"--rlimit_nproc", "max",
+			// The root filesystem of the chroot is read-only.
+			"--chroot", "/",
+			"--tmpfsmount", "/tmp",
+			"--bindmount", workdir,
+			"--cwd", workdir,
+		}
+		if cachePath != "" {
+			sandboxArgs = append(sandboxArgs, "--bindmount", cachePath)
+		}
+		if s.network != nil {
+			// Share the namespace the command is started in, in which the
+			// proxy listens. Otherwise, nsjail creates an empty one.
+			sandboxArgs = append(sandboxArgs, "--disable_clone_newnet")
+		}
+		if s.opts.SeccompProfile != "" {
+			sandboxArgs = append(sandboxArgs, "--seccomp_policy", s.opts.SeccompProfile)
+		}
+	case SandboxRuntimeGVisor:
+		// The "host" network is the namespace the command is started in.
+		network := "none"
+		if s.network != nil {
+			network = "host"
+		}
+		sandboxArgs = []string{
+			"--rootless",
+			"--ignore-cgroups",
+			"--network", network,
+			// Writes outside of volumes go to an overlay in memory, which
+			// leaves the filesystem of the provisioner untouched.
+			"do",
+			"--cwd", workdir,
+			"--volume", workdir + ":" + workdir,
+		}
+		if cachePath != "" {
+			sandboxArgs = append(sandboxArgs, "--volume", cachePath+":"+cachePath)
+		}
+	}
+	sandboxArgs = append(sandboxArgs, "--", binaryPath)
+	sandboxArgs = append(sandboxArgs, args...)
+
+	// #nosec
+	cmd := exec.CommandContext(ctx, s.binaryPath, sandboxArgs...)
+	cmd.Dir = workdir
+	cmd.Env = s.environ(env)
+	return cmd
+}
+
+// start starts a command returned by command, in the network namespace if
+// egress is allowed.
+func (s *sandbox) start(cmd *exec.Cmd) error {
+	if s.network == nil {
+		return cmd.Start()
+	}
+	return s.network.run(cmd.Start)
+}
+
+// validEgressHost reports whether an allowlist entry is a hostname, or
+// "*." followed by one.
+func validEgressHost(host string) bool {
+	host = strings.TrimPrefix(host, "*.")
+	return host != "" && !strings.ContainsAny(host, "*/:")
+}
+
+// environ points Terraform and the providers at the egress proxy.
+func (s *sandbox) environ(env []string) []string {
+	if s.proxyURL == "" {
+		return env
+	}
+	filtered := make([]string, 0, len(env)+4)
+	for _, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		switch strings.ToUpper(name) {
+		case "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY":
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return append(filtered,
+		"HTTP_PROXY="+s.proxyURL,
+		"HTTPS_PROXY="+s.proxyURL,
+		"http_proxy="+s.proxyURL,
+		"https_proxy="+s.proxyURL,
+	)
+}
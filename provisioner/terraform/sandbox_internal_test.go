@@ -0,0 +1,205 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog/sloggers/slogtest"
+
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestSandboxCommand(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Nsjail", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		sb, err := newSandbox(ctx, slogtest.Make(t, nil), SandboxOptions{
+			Runtime:        SandboxRuntimeNsjail,
+			BinaryPath:     "/usr/bin/nsjail",
+			SeccompProfile: "/etc/coder/terraform.kafel",
+		})
+		require.NoError(t, err)
+
+		cmd := sb.command(ctx, "/work", "/cache", "/usr/bin/terraform", []string{"plan", "-json"}, []string{"HOME=/home/coder"})
+		require.Equal(t, "/usr/bin/nsjail", cmd.Path)
+		require.Equal(t, "/work", cmd.Dir)
+		require.Equal(t, []string{"HOME=/home/coder"}, cmd.Env)
+		require.Subset(t, cmd.Args, []string{"--chroot", "/", "--bindmount", "/work", "/cache", "--seccomp_policy", "/etc/coder/terraform.kafel"})
+		require.NotContains(t, cmd.Args, "--disable_clone_newnet")
+		require.Equal(t, []string{"--", "/usr/bin/terraform", "plan", "-json"}, cmd.Args[len(cmd.Args)-4:])
+	})
+
+	t.Run("GVisor", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		sb, err := newSandbox(ctx, slogtest.Make(t, nil), SandboxOptions{
+			Runtime:    SandboxRuntimeGVisor,
+			BinaryPath: "/usr/bin/runsc",
+		})
+		require.NoError(t, err)
+
+		cmd := sb.command(ctx, "/work", "", "/usr/bin/terraform", []string{"init"}, []string{"HOME=/home/coder"})
+		require.Equal(t, "/usr/bin/runsc", cmd.Path)
+		require.Subset(t, cmd.Args, []string{"--network", "none", "do", "--volume", "/work:/work"})
+		require.Equal(t, []string{"--", "/usr/bin/terraform", "init"}, cmd.Args[len(cmd.Args)-3:])
+		require.Equal(t, []string{"HOME=/home/coder"}, cmd.Env)
+	})
+
+	t.Run("Egress", func(t *testing.T) {
+		t.Parallel()
+		if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+			t.Skip("creating network namespaces requires root on Linux")
+		}
+		ctx := testutil.Context(t, testutil.WaitShort)
+		upstream := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		t.Cleanup(upstream.Close)
+		sb, err := newSandbox(ctx, slogtest.Make(t, nil), SandboxOptions{
+			Runtime:         SandboxRuntimeNsjail,
+			BinaryPath:      "/usr/bin/nsjail",
+			EgressAllowlist: []string{"registry.terraform.io"},
+		})
+		require.NoError(t, err)
+
+		cmd := sb.command(ctx, "/work", "", "/usr/bin/terraform", []string{"init"}, []string{"HTTPS_PROXY=http://other", "HOME=/home/coder"})
+		require.Contains(t, cmd.Args, "--disable_clone_newnet")
+		require.Contains(t, cmd.Env, "HOME=/home/coder")
+		require.Contains(t, cmd.Env, "HTTPS_PROXY="+sb.proxyURL)
+		require.NotContains(t, cmd.Env, "HTTPS_PROXY=http://other")
+
+		// Commands are started in a network namespace, in which only the
+		// proxy can be reached.
+		var out bytes.Buffer
+		cmd = exec.Command("readlink", "/proc/self/ns/net")
+		cmd.Stdout = &out
+		require.NoError(t, sb.start(cmd))
+		require.NoError(t, cmd.Wait())
+		hostNetwork, err := exec.Command("readlink", "/proc/self/ns/net").Output()
+		require.NoError(t, err)
+		require.NotEqual(t, string(hostNetwork), out.String())
+		err = sb.network.run(func() error {
+			proxyConn, err := net.Dial("tcp", strings.TrimPrefix(sb.proxyURL, "http://"))
+			if err != nil {
+				return err
+			}
+			_ = proxyConn.Close()
+			upstreamConn, err := net.Dial("tcp", upstream.Listener.Addr().String())
+			if err == nil {
+				_ = upstreamConn.Close()
+				return xerrors.New("upstream is reachable from the namespace")
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitShort)
+		for _, opts := range []SandboxOptions{
+			{Runtime: "docker", BinaryPath: "/usr/bin/docker"},
+			{Runtime: SandboxRuntimeGVisor, BinaryPath: "/usr/bin/runsc", SeccompProfile: "/etc/coder/terraform.kafel"},
+			{Runtime: SandboxRuntimeNsjail, BinaryPath: "/usr/bin/nsjail", EgressAllowlist: []string{"https://example.com"}},
+			{Runtime: SandboxRuntimeNsjail, BinaryPath: "/usr/bin/nsjail", EgressAllowlist: []string{"*"}},
+			{Runtime: SandboxRuntimeNsjail, BinaryPath: "/usr/bin/nsjail", EgressAllowlist: []string{"*amazonaws.com"}},
+			{Runtime: SandboxRuntimeNsjail, BinaryPath: "/usr/bin/nsjail", EgressAllowlist: []string{"s3.*.amazonaws.com"}},
+		} {
+			_, err := newSandbox(ctx, slogtest.Make(t, nil), opts)
+			require.Error(t, err, "%+v", opts)
+		}
+	})
+}
+
+func TestEgressProxy(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "hello from ", r.Host)
+	}))
+	t.Cleanup(upstream.Close)
+	upstreamURL, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name      string
+		allowlist []string
+		status    int
+	}{
+		{name: "Allowed", allowlist: []string{"127.0.0.1"}, status: http.StatusOK},
+		{name: "Wildcard", allowlist: []string{"*.0.0.1"}, status: http.StatusOK},
+		{name: "Blocked", allowlist: []string{"registry.terraform.io"}, status: http.StatusForbidden},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+			srv := httptest.NewServer(newEgressProxy(logger, tc.allowlist))
+			t.Cleanup(srv.Close)
+			proxyURL, err := url.Parse(srv.URL)
+			require.NoError(t, err)
+			client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+			t.Cleanup(client.CloseIdleConnections)
+
+			res, err := client.Get(upstreamURL.String())
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+			if tc.status == http.StatusOK {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				require.Equal(t, "hello from "+upstreamURL.Host, string(body))
+			}
+		})
+	}
+}
+
+func TestEgressProxy_Tunnel(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "hello over tls")
+	}))
+	t.Cleanup(upstream.Close)
+
+	srv := httptest.NewServer(newEgressProxy(slogtest.Make(t, nil), []string{"127.0.0.1"}))
+	t.Cleanup(srv.Close)
+	proxyURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	transport := upstream.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	client := &http.Client{Transport: transport}
+	t.Cleanup(client.CloseIdleConnections)
+
+	res, err := client.Get(upstream.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, "hello over tls", string(body))
+}
+
+func TestEgressProxy_Allowed(t *testing.T) {
+	t.Parallel()
+
+	p := newEgressProxy(slogtest.Make(t, nil), []string{"registry.terraform.io", "*.amazonaws.com"})
+	require.True(t, p.allowed("registry.terraform.io"))
+	require.True(t, p.allowed("Registry.Terraform.IO."))
+	require.True(t, p.allowed("s3.us-east-1.amazonaws.com"))
+	require.False(t, p.allowed("amazonaws.com"))
+	require.False(t, p.allowed("evil-amazonaws.com"))
+	require.False(t, p.allowed("terraform.io"))
+}
@@ -0,0 +1,90 @@
+package terraform
+
+import (
+	"context"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// isolatedNetwork is a network namespace with only a loopback interface.
+// Processes started in it can't reach any host, only listeners created in
+// it, e.g. the egress proxy.
+type isolatedNetwork struct {
+	funcs chan func()
+	done  chan struct{}
+}
+
+// newIsolatedNetwork creates a network namespace, which lives until the
+// context is canceled. Creating it requires CAP_SYS_ADMIN.
+func newIsolatedNetwork(ctx context.Context) (*isolatedNetwork, error) {
+	n := &isolatedNetwork{
+		funcs: make(chan func()),
+		done:  make(chan struct{}),
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(n.done)
+		// Namespaces belong to threads. The thread is never unlocked, so it
+		// exits with the goroutine instead of running other goroutines in
+		// the namespace.
+		runtime.LockOSThread()
+		err := unix.Unshare(unix.CLONE_NEWNET)
+		if err != nil {
+			errCh <- xerrors.Errorf("unshare network namespace: %w", err)
+			return
+		}
+		err = loopbackUp()
+		if err != nil {
+			errCh <- xerrors.Errorf("set up loopback interface: %w", err)
+			return
+		}
+		errCh <- nil
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case fn := <-n.funcs:
+				fn()
+			}
+		}
+	}()
+	err := <-errCh
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// run calls fn on a thread in the namespace. Sockets created and processes
+// started by fn are in the namespace.
+func (n *isolatedNetwork) run(fn func() error) error {
+	errCh := make(chan error, 1)
+	select {
+	case n.funcs <- func() { errCh <- fn() }:
+		return <-errCh
+	case <-n.done:
+		return xerrors.New("network namespace is closed")
+	}
+}
+
+// loopbackUp brings up the loopback interface, which is down in new
+// network namespaces.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr)
+	if err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package terraform
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+)
+
+// isolatedNetwork isn't supported on this platform, neither are the
+// sandbox runtimes.
+type isolatedNetwork struct{}
+
+func newIsolatedNetwork(context.Context) (*isolatedNetwork, error) {
+	return nil, xerrors.New("isolated networks are only supported on Linux")
+}
+
+func (*isolatedNetwork) run(func() error) error {
+	return xerrors.New("isolated networks are only supported on Linux")
+}
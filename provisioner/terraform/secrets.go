@@ -0,0 +1,371 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// SecretsResolver resolves template variables referencing a secret store
+// just-in-time for every build, e.g. "vault://secret/data/db#password".
+// Resolved values are passed to Terraform in a file scoped to the build, and
+// are redacted from logs and the metadata of resources.
+type SecretsResolver interface {
+	// Scheme is the URI scheme of the references resolved, e.g. "vault".
+	Scheme() string
+	// Resolve returns the value of the secret the reference points to.
+	Resolve(ctx context.Context, ref *url.URL) (string, error)
+}
+
+// secretsVarFile holds the resolved secret variables of a build in the
+// credentials dir, so they're removed along with the credentials.
+const secretsVarFile = "secrets.tfvars.json"
+
+// secretVariables maps the names of variables referencing secrets to their
+// resolved values.
+type secretVariables map[string]string
+
+// resolveSecretVariables resolves the variables whose value is a reference
+// with the scheme of one of the resolvers. Other variables are passed as is.
+func resolveSecretVariables(
+	ctx context.Context, resolvers []SecretsResolver, variables []*proto.VariableValue, logr logSink,
+) (secretVariables, error) {
+	if len(resolvers) == 0 {
+		return nil, nil
+	}
+	byScheme := make(map[string]SecretsResolver, len(resolvers))
+	for _, resolver := range resolvers {
+		byScheme[resolver.Scheme()] = resolver
+	}
+	secrets := secretVariables{}
+	for _, variable := range variables {
+		scheme, _, ok := strings.Cut(variable.Value, "://")
+		if !ok {
+			continue
+		}
+		resolver, ok := byScheme[scheme]
+		if !ok {
+			continue
+		}
+		ref, err := url.Parse(variable.Value)
+		if err != nil {
+			return nil, xerrors.Errorf("variable %q: parse secret reference: %w", variable.Name, err)
+		}
+		value, err := resolver.Resolve(ctx, ref)
+		if err != nil {
+			// The reference doesn't contain the secret, so it's safe to
+			// include it in the error.
+			return nil, xerrors.Errorf("variable %q: resolve %s: %w", variable.Name, variable.Value, err)
+		}
+		secrets[variable.Name] = value
+		logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf("Resolved variable %q from %s", variable.Name, scheme))
+	}
+	return secrets, nil
+}
+
+// writeSecretVariables writes the secret variables of the build to a
+// variable file in the credentials dir and returns its path, empty if there
+// are no secret variables. Unlike "-var" arguments, the file doesn't expose
+// the values in the arguments of the Terraform process.
+func writeSecretVariables(workdir string, secrets secretVariables) (string, error) {
+	if len(secrets) == 0 {
+		return "", nil
+	}
+	dir := filepath.Join(workdir, credentialsDir)
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return "", xerrors.Errorf("create credentials dir: %w", err)
+	}
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return "", xerrors.Errorf("encode secret variables: %w", err)
+	}
+	path := filepath.Join(dir, secretsVarFile)
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		return "", xerrors.Errorf("write secret variables: %w", err)
+	}
+	return path, nil
+}
+
+// readSecretVariables returns the secret variables resolved while planning
+// the build.
+func readSecretVariables(workdir string) (secretVariables, error) {
+	data, err := os.ReadFile(filepath.Join(workdir, credentialsDir, secretsVarFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read secret variables: %w", err)
+	}
+	var secrets secretVariables
+	err = json.Unmarshal(data, &secrets)
+	if err != nil {
+		return nil, xerrors.Errorf("decode secret variables: %w", err)
+	}
+	return secrets, nil
+}
+
+// replacer replaces the values of the secrets with redactedValue.
+func (s secretVariables) replacer() *strings.Replacer {
+	values := make([]string, 0, len(s))
+	for _, value := range s {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	// Longer values first, so secrets containing others are redacted
+	// entirely.
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	oldnew := make([]string, 0, len(values)*2)
+	for _, value := range values {
+		oldnew = append(oldnew, value, redactedValue)
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// redactingLogSink redacts the values of secrets from the logs sent to the
+// sink.
+type redactingLogSink struct {
+	logSink
+	replacer *strings.Replacer
+}
+
+func (r *redactingLogSink) ProvisionLog(level proto.LogLevel, output string) {
+	r.logSink.ProvisionLog(level, r.replacer.Replace(output))
+}
+
+// redactSecrets wraps the sink to redact the secrets, if there are any.
+func redactSecrets(logr logSink, secrets secretVariables) logSink {
+	replacer := secrets.replacer()
+	if replacer == nil {
+		return logr
+	}
+	return &redactingLogSink{logSink: logr, replacer: replacer}
+}
+
+// redactSecretMetadata marks the metadata of resources containing secrets as
+// sensitive, and redacts the secrets from their values.
+func redactSecretMetadata(resources []*proto.Resource, secrets secretVariables) {
+	for _, resource := range resources {
+		redactSecretMetadataItems(resource.Metadata, secrets)
+	}
+}
+
+// redactSecretMetadataItems is like redactSecretMetadata for metadata that
+// doesn't belong to a resource, e.g. the outputs of the template.
+func redactSecretMetadataItems(items []*proto.Resource_Metadata, secrets secretVariables) {
+	replacer := secrets.replacer()
+	if replacer == nil {
+		return
+	}
+	for _, item := range items {
+		redacted := replacer.Replace(item.Value)
+		if redacted != item.Value {
+			item.Value = redacted
+			item.Sensitive = true
+		}
+	}
+}
+
+// VaultSecretsResolver resolves "vault://<path>#<key>" references from
+// HashiCorp Vault. The path is the API path of the secret, e.g.
+// "vault://secret/data/db#password" for the key "password" of the secret
+// "db" in the KV version 2 engine mounted at "secret".
+type VaultSecretsResolver struct {
+	// Address of the Vault server, e.g. "https://vault.example.com:8200".
+	Address string
+	Token   string
+	// Namespace is the Vault Enterprise namespace, if any.
+	Namespace string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// VaultSecretsResolverFromEnv configures the resolver with the environment
+// variables of the Vault CLI.
+func VaultSecretsResolverFromEnv() *VaultSecretsResolver {
+	return &VaultSecretsResolver{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+}
+
+func (*VaultSecretsResolver) Scheme() string {
+	return "vault"
+}
+
+func (v *VaultSecretsResolver) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	if v.Address == "" {
+		return "", xerrors.New("vault address is not configured")
+	}
+	path := strings.Trim(ref.Host+ref.Path, "/")
+	if path == "" || ref.Fragment == "" {
+		return "", xerrors.New(`secret reference must be of the form "vault://<path>#<key>"`)
+	}
+	endpoint, err := url.JoinPath(v.Address, "v1", path)
+	if err != nil {
+		return "", xerrors.Errorf("vault url: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", xerrors.Errorf("create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	client := v.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", xerrors.Errorf("read secret: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", xerrors.Errorf("read secret: unexpected status %d", res.StatusCode)
+	}
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&secret)
+	if err != nil {
+		return "", xerrors.Errorf("decode secret: %w", err)
+	}
+	data := secret.Data
+	// The KV version 2 engine nests the data of the secret next to its
+	// metadata.
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	return secretKey(data, ref.Fragment)
+}
+
+// AWSSecretsManagerResolver resolves "awssm://<secret-id>#<key>"
+// references from AWS Secrets Manager, with the default credentials and
+// region of the AWS SDK. The key selects a field of secrets stored as JSON
+// objects, and is omitted for plain text secrets.
+type AWSSecretsManagerResolver struct {
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Endpoint overrides the regional endpoint of Secrets Manager.
+	Endpoint string
+}
+
+func (*AWSSecretsManagerResolver) Scheme() string {
+	return "awssm"
+}
+
+func (a *AWSSecretsManagerResolver) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	secretID := strings.Trim(ref.Host+ref.Path, "/")
+	if secretID == "" {
+		return "", xerrors.New(`secret reference must be of the form "awssm://<secret-id>[#<key>]"`)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("load aws config: %w", err)
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("retrieve aws credentials: %w", err)
+	}
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		if cfg.Region == "" {
+			return "", xerrors.New("aws region is not configured")
+		}
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", cfg.Region)
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", xerrors.Errorf("encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", xerrors.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	payloadHash := sha256.Sum256(body)
+	err = v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "secretsmanager", cfg.Region, time.Now())
+	if err != nil {
+		return "", xerrors.Errorf("sign request: %w", err)
+	}
+	client := a.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", xerrors.Errorf("get secret value: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		// Errors of the API don't contain the secret.
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return "", xerrors.Errorf("get secret value: unexpected status %d: %s", res.StatusCode, message)
+	}
+	var secret struct {
+		SecretString *string `json:"SecretString"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&secret)
+	if err != nil {
+		return "", xerrors.Errorf("decode secret: %w", err)
+	}
+	if secret.SecretString == nil {
+		return "", xerrors.New("binary secrets are not supported")
+	}
+	if ref.Fragment == "" {
+		return *secret.SecretString, nil
+	}
+	var data map[string]any
+	err = json.Unmarshal([]byte(*secret.SecretString), &data)
+	if err != nil {
+		return "", xerrors.New("secret is not a JSON object, remove the key from the reference")
+	}
+	return secretKey(data, ref.Fragment)
+}
+
+// secretKey returns the value of the key of a secret, strings as is and
+// other values as JSON.
+func secretKey(data map[string]any, key string) (string, error) {
+	value, ok := data[key]
+	if !ok {
+		return "", xerrors.Errorf("secret has no key %q", key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", xerrors.Errorf("encode key %q: %w", key, err)
+	}
+	return string(encoded), nil
+}
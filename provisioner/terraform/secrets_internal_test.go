@@ -0,0 +1,145 @@
+package terraform
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+	"github.com/coder/coder/v2/testutil"
+)
+
+type fakeSecretsResolver map[string]string
+
+func (fakeSecretsResolver) Scheme() string {
+	return "fake"
+}
+
+func (f fakeSecretsResolver) Resolve(_ context.Context, ref *url.URL) (string, error) {
+	value, ok := f[ref.Host]
+	if !ok {
+		return "", xerrors.New("not found")
+	}
+	return value, nil
+}
+
+type collectingLogSink []string
+
+func (c *collectingLogSink) ProvisionLog(_ proto.LogLevel, output string) {
+	*c = append(*c, output)
+}
+
+func TestResolveSecretVariables(t *testing.T) {
+	t.Parallel()
+
+	ctx := testutil.Context(t, testutil.WaitShort)
+	resolvers := []SecretsResolver{fakeSecretsResolver{"db": "hunter2"}}
+	variables := []*proto.VariableValue{
+		{Name: "region", Value: "us-east-1"},
+		{Name: "db_password", Value: "fake://db"},
+		{Name: "url", Value: "https://example.com"},
+	}
+	secrets, err := resolveSecretVariables(ctx, resolvers, variables, discardLogSink{})
+	require.NoError(t, err)
+	require.Equal(t, secretVariables{"db_password": "hunter2"}, secrets)
+
+	vars, err := planVars(&proto.PlanRequest{VariableValues: variables}, secrets)
+	require.NoError(t, err)
+	require.Equal(t, []string{"region=us-east-1", "url=https://example.com"}, vars)
+
+	workdir := t.TempDir()
+	path, err := writeSecretVariables(workdir, secrets)
+	require.NoError(t, err)
+	require.NotEmpty(t, path)
+	read, err := readSecretVariables(workdir)
+	require.NoError(t, err)
+	require.Equal(t, secrets, read)
+	require.NoError(t, removeBrokeredCredentials(workdir))
+	read, err = readSecretVariables(workdir)
+	require.NoError(t, err)
+	require.Empty(t, read)
+
+	_, err = resolveSecretVariables(ctx, resolvers, []*proto.VariableValue{
+		{Name: "missing", Value: "fake://missing"},
+	}, discardLogSink{})
+	require.ErrorContains(t, err, `variable "missing"`)
+
+	// Without resolvers, references are passed as is.
+	secrets, err = resolveSecretVariables(ctx, nil, variables, discardLogSink{})
+	require.NoError(t, err)
+	require.Empty(t, secrets)
+}
+
+func TestRedactSecrets(t *testing.T) {
+	t.Parallel()
+
+	secrets := secretVariables{"short": "hunter", "long": "hunter2", "empty": ""}
+	var logs collectingLogSink
+	redactSecrets(&logs, secrets).ProvisionLog(proto.LogLevel_INFO, "password is hunter2, not hunter")
+	require.Equal(t, collectingLogSink{"password is (sensitive value), not (sensitive value)"}, logs)
+
+	resources := []*proto.Resource{{
+		Metadata: []*proto.Resource_Metadata{
+			{Key: "region", Value: "us-east-1"},
+			{Key: "dsn", Value: "postgres://coder:hunter2@db"},
+		},
+	}}
+	redactSecretMetadata(resources, secrets)
+	require.False(t, resources[0].Metadata[0].Sensitive)
+	require.Equal(t, "us-east-1", resources[0].Metadata[0].Value)
+	require.True(t, resources[0].Metadata[1].Sensitive)
+	require.Equal(t, "postgres://coder:(sensitive value)@db", resources[0].Metadata[1].Value)
+
+	// Nothing to redact without secrets.
+	var sink collectingLogSink
+	require.Equal(t, &sink, redactSecrets(&sink, nil))
+}
+
+func TestVaultSecretsResolver(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/db":
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"hunter2","port":5432},"metadata":{"version":1}}}`))
+		case "/v1/kv/db":
+			_, _ = w.Write([]byte(`{"data":{"password":"hunter3"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	resolver := &VaultSecretsResolver{Address: srv.URL, Token: "token", Namespace: "team"}
+	for _, tc := range []struct {
+		ref   string
+		value string
+		err   string
+	}{
+		{ref: "vault://secret/data/db#password", value: "hunter2"},
+		{ref: "vault://secret/data/db#port", value: "5432"},
+		{ref: "vault://kv/db#password", value: "hunter3"},
+		{ref: "vault://kv/db#user", err: `no key "user"`},
+		{ref: "vault://kv/missing#password", err: "status 404"},
+		{ref: "vault://kv/db", err: "must be of the form"},
+	} {
+		ref, err := url.Parse(tc.ref)
+		require.NoError(t, err)
+		value, err := resolver.Resolve(testutil.Context(t, testutil.WaitShort), ref)
+		if tc.err != "" {
+			require.ErrorContains(t, err, tc.err, tc.ref)
+			continue
+		}
+		require.NoError(t, err, tc.ref)
+		require.Equal(t, tc.value, value, tc.ref)
+	}
+}
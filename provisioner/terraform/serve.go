@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/cli/safeexec"
+	"github.com/hashicorp/go-version"
 	semconv "go.opentelemetry.io/otel/semconv/v1.14.0"
 	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/xerrors"
@@ -26,6 +27,12 @@ type ServeOptions struct {
 	CachePath string
 	Tracer    trace.Tracer
 
+	// DisableManagedVersions prevents installing the Terraform version
+	// required by a template when BinaryPath doesn't satisfy its
+	// `required_version` constraint. This should be set in air-gapped
+	// deployments where Terraform releases can't be downloaded.
+	DisableManagedVersions bool
+
 	// ExitTimeout defines how long we will wait for a running Terraform
 	// command to exit (cleanly) if the provision was stopped. This
 	// happens when the provision is canceled via RPC and when the command is
@@ -37,6 +44,52 @@ type ServeOptions struct {
 	// be kept less than the value that Coder uses to mark hung jobs as failed,
 	// which is 5 minutes (see unhanger package).
 	ExitTimeout time.Duration
+
+	// HangTimeout kills Terraform commands that don't write any output for
+	// the duration, and fails the build with an error pointing at the hang
+	// instead of leaving it to be marked as hung by coderd. Stack traces of
+	// the command and its providers are captured in the logs where
+	// supported.
+	//
+	// Defaults to disabled. Keep it below 5 minutes (see unhanger package)
+	// and above the time providers take to download during init.
+	HangTimeout time.Duration
+
+	// DataSourceTimeout kills Terraform commands once a data source is read
+	// for longer than the duration, and fails the build with an error
+	// naming the data source. Reads are timed independently, so a single
+	// data source querying an unreachable API doesn't stall the plan with
+	// no explanation. Terraform reports the progress of reads, so they
+	// aren't caught by HangTimeout.
+	//
+	// Defaults to disabled.
+	DataSourceTimeout time.Duration
+
+	// Sandbox executes Terraform in a sandbox to contain malicious
+	// templates or providers. Defaults to no sandbox.
+	Sandbox *SandboxOptions
+
+	// Prewarm runs "terraform init" for the most frequently built template
+	// versions while the provisioner is idle. Defaults to disabled.
+	Prewarm *PrewarmOptions
+	// ProviderCredentials are brokered from the tokens of the workspace
+	// owner for every build.
+	ProviderCredentials []ProviderCredentials
+	// Guardrails fail builds whose plan exceeds them. Defaults to
+	// unlimited.
+	Guardrails Guardrails
+	// AirGapped installs providers only from the configured mirrors, and
+	// implies DisableManagedVersions. Defaults to disabled.
+	AirGapped AirGappedOptions
+	// ProviderVerification verifies the checksums of the providers installed
+	// by init before they're executed. Defaults to disabled.
+	ProviderVerification ProviderVerificationOptions
+	// ApplyRetry retries applies that failed with transient errors of
+	// providers. Defaults to no retries.
+	ApplyRetry ApplyRetryOptions
+	// SecretsResolvers resolve template variables referencing secret
+	// stores, by the scheme of the reference. Defaults to none.
+	SecretsResolvers []SecretsResolver
 }
 
 func absoluteBinaryPath(ctx context.Context, logger slog.Logger) (string, error) {
@@ -113,14 +166,73 @@ func Serve(ctx context.Context, options *ServeOptions) error {
 	if options.ExitTimeout == 0 {
 		options.ExitTimeout = unhanger.HungJobExitTimeout
 	}
-	return provisionersdk.Serve(ctx, &server{
-		execMut:     &sync.Mutex{},
-		binaryPath:  options.BinaryPath,
-		cachePath:   options.CachePath,
-		logger:      options.Logger,
-		tracer:      options.Tracer,
-		exitTimeout: options.ExitTimeout,
-	}, options.ServeOptions)
+	for _, credentials := range options.ProviderCredentials {
+		err := credentials.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	schemes := map[string]bool{}
+	for _, resolver := range options.SecretsResolvers {
+		if schemes[resolver.Scheme()] {
+			return xerrors.Errorf("multiple secrets resolvers for scheme %q", resolver.Scheme())
+		}
+		schemes[resolver.Scheme()] = true
+	}
+	var cliConfigPath string
+	if options.AirGapped.Enabled() {
+		err := options.AirGapped.Validate()
+		if err != nil {
+			return err
+		}
+		cliConfigPath, err = options.AirGapped.writeCLIConfig(options.CachePath)
+		if err != nil {
+			return err
+		}
+		// Terraform releases can't be downloaded either.
+		options.DisableManagedVersions = true
+		options.Logger.Info(ctx, "installing providers only from mirrors",
+			slog.F("filesystem_mirrors", options.AirGapped.FilesystemMirrors),
+			slog.F("network_mirrors", options.AirGapped.NetworkMirrors))
+	}
+	var sb *sandbox
+	if options.Sandbox != nil && options.Sandbox.Runtime != SandboxRuntimeNone {
+		var err error
+		sb, err = newSandbox(ctx, options.Logger.Named("sandbox"), *options.Sandbox)
+		if err != nil {
+			return xerrors.Errorf("create sandbox: %w", err)
+		}
+	}
+	srv := &server{
+		execMut:                &sync.Mutex{},
+		binaryPath:             options.BinaryPath,
+		cachePath:              options.CachePath,
+		logger:                 options.Logger,
+		tracer:                 options.Tracer,
+		exitTimeout:            options.ExitTimeout,
+		hangTimeout:            options.HangTimeout,
+		dataSourceTimeout:      options.DataSourceTimeout,
+		sandbox:                sb,
+		disableManagedVersions: options.DisableManagedVersions,
+		binaryVersions:         map[string]*version.Version{},
+		providerCredentials:    options.ProviderCredentials,
+		guardrails:             options.Guardrails,
+		airGapped:              options.AirGapped,
+		providerVerification:   options.ProviderVerification,
+		providerRegistry:       newProviderRegistry(options.ProviderVerification.HTTPClient),
+		applyRetry:             options.ApplyRetry,
+		secretsResolvers:       options.SecretsResolvers,
+		cliConfigPath:          cliConfigPath,
+	}
+	if options.Prewarm != nil && options.Prewarm.MaxTemplates > 0 {
+		var err error
+		srv.prewarm, err = newPrewarmer(options.Logger.Named("prewarm"), *options.Prewarm, srv.prewarmInit)
+		if err != nil {
+			return xerrors.Errorf("create prewarmer: %w", err)
+		}
+		go srv.prewarm.run(ctx)
+	}
+	return provisionersdk.Serve(ctx, srv, options.ServeOptions)
 }
 
 type server struct {
@@ -130,6 +242,35 @@ type server struct {
 	logger      slog.Logger
 	tracer      trace.Tracer
 	exitTimeout time.Duration
+	hangTimeout time.Duration
+	// dataSourceTimeout is disabled if zero.
+	dataSourceTimeout time.Duration
+	// sandbox is nil if Terraform isn't sandboxed.
+	sandbox *sandbox
+
+	disableManagedVersions bool
+	// versionMut guards binaryVersions and serializes the selection of
+	// managed Terraform versions.
+	versionMut     sync.Mutex
+	binaryVersions map[string]*version.Version
+
+	// prewarm is nil if pre-warming is disabled.
+	prewarm *prewarmer
+
+	providerCredentials []ProviderCredentials
+	guardrails          Guardrails
+
+	airGapped AirGappedOptions
+	// cliConfigPath is the Terraform CLI configuration of the air-gapped
+	// mode, empty if it's disabled.
+	cliConfigPath string
+
+	providerVerification ProviderVerificationOptions
+	providerRegistry     *providerRegistry
+
+	applyRetry       ApplyRetryOptions
+	retryPlans       retryPlans
+	secretsResolvers []SecretsResolver
 }
 
 func (s *server) startTrace(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
@@ -138,13 +279,26 @@ func (s *server) startTrace(ctx context.Context, name string, opts ...trace.Span
 	))...)
 }
 
-func (s *server) executor(workdir string) *executor {
+func (s *server) executor(workdir, binaryPath string) *executor {
 	return &executor{
 		server:     s,
 		mut:        s.execMut,
-		binaryPath: s.binaryPath,
+		binaryPath: binaryPath,
 		cachePath:  s.cachePath,
 		workdir:    workdir,
 		logger:     s.logger.Named("executor"),
 	}
 }
+
+// prewarmInit runs "terraform init" for a template version pre-warmed in the
+// directory.
+func (s *server) prewarmInit(ctx context.Context, dir string) error {
+	logr := slogSink{logger: s.logger.Named("prewarm")}
+	binaryPath, err := s.binaryPathForModule(ctx, dir, logr)
+	if err != nil {
+		return xerrors.Errorf("select terraform version: %w", err)
+	}
+	// There's no job to cancel gracefully, so the command is killed
+	// right away.
+	return s.executor(dir, binaryPath).init(ctx, ctx, logr)
+}
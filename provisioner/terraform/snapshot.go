@@ -0,0 +1,317 @@
+package terraform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// SnapshotResourceName is the name of the resources that snapshot the
+// volumes of a workspace. When the apply of a build is about to delete or
+// replace resources, e.g. after a bad template update, a snapshot resource
+// is replaced first so the data of the workspace can be restored afterwards:
+//
+//	resource "aws_ebs_snapshot" "coder_snapshot" {
+//	  # The number of snapshots kept.
+//	  count     = 3
+//	  volume_id = aws_ebs_volume.home.id
+//	  lifecycle {
+//	    # Only replaced by the provisioner, not when the volume changes.
+//	    ignore_changes = all
+//	  }
+//	}
+//
+// Snapshot resources with a count keep that many snapshots, the newest
+// first: the oldest instance is replaced and the instances are renumbered
+// in the state, so the new snapshot is at index 0.
+//
+// The ID of the snapshot is added to the metadata of the resource as
+// "snapshot_id". See RestoreSnapshotParameterName to restore them.
+const SnapshotResourceName = "coder_snapshot"
+
+// SnapshotIDMetadataKey is the resource metadata key of snapshot IDs.
+const SnapshotIDMetadataKey = "snapshot_id"
+
+// RestoreSnapshotParameterName is the name of the parameter templates
+// restore volumes from a kept snapshot with, by creating the volume from
+// the snapshot ID it's set to:
+//
+//	data "coder_parameter" "coder_restore_snapshot" {
+//	  name    = "coder_restore_snapshot"
+//	  default = ""
+//	  mutable = true
+//	}
+//
+// The build fails if the ID isn't one of the snapshots kept for the
+// workspace, and the snapshot being restored is never replaced by the
+// snapshots taken before the restore.
+const RestoreSnapshotParameterName = "coder_restore_snapshot"
+
+// destructiveChanges returns the addresses of the managed resources the plan
+// deletes or replaces. Snapshots are excluded, since replacing them doesn't
+// lose data.
+func destructiveChanges(plan *tfjson.Plan) []string {
+	var addresses []string
+	for _, change := range plan.ResourceChanges {
+		if change.Mode != tfjson.ManagedResourceMode || change.Name == SnapshotResourceName || change.Change == nil {
+			continue
+		}
+		if change.Change.Actions.Delete() || change.Change.Actions.Replace() {
+			addresses = append(addresses, change.Address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// snapshotInstance is an instance of a snapshot resource in the state.
+type snapshotInstance struct {
+	address string
+	// index is the count index of the instance, -1 for resources without a
+	// count.
+	index int
+	id    string
+}
+
+// snapshotInstances returns the instances of the snapshot resources that
+// exist in the state before the plan, by the address of their resource,
+// ordered by index. Snapshots can only be taken of volumes that exist.
+func snapshotInstances(plan *tfjson.Plan) map[string][]snapshotInstance {
+	if plan.PriorState == nil || plan.PriorState.Values == nil {
+		return nil
+	}
+	instances := map[string][]snapshotInstance{}
+	var walk func(module *tfjson.StateModule)
+	walk = func(module *tfjson.StateModule) {
+		if module == nil {
+			return
+		}
+		for _, resource := range module.Resources {
+			if resource.Mode != tfjson.ManagedResourceMode || resource.Name != SnapshotResourceName {
+				continue
+			}
+			instance := snapshotInstance{address: resource.Address, index: -1}
+			instance.id, _ = resource.AttributeValues["id"].(string)
+			resourceAddress := resource.Address
+			if resource.Index != nil {
+				index, ok := resource.Index.(float64)
+				if !ok {
+					// Instances of resources with for_each aren't ordered,
+					// so they're snapshotted on their own.
+					instances[resource.Address] = append(instances[resource.Address], instance)
+					continue
+				}
+				instance.index = int(index)
+				resourceAddress = strings.TrimSuffix(resource.Address, fmt.Sprintf("[%d]", instance.index))
+			}
+			instances[resourceAddress] = append(instances[resourceAddress], instance)
+		}
+		for _, child := range module.ChildModules {
+			walk(child)
+		}
+	}
+	walk(plan.PriorState.Values.RootModule)
+	for _, resourceInstances := range instances {
+		sort.Slice(resourceInstances, func(i, j int) bool {
+			return resourceInstances[i].index < resourceInstances[j].index
+		})
+	}
+	return instances
+}
+
+// snapshotIDs returns the IDs of the kept snapshots.
+func snapshotIDs(instances map[string][]snapshotInstance) []string {
+	var ids []string
+	for _, resourceInstances := range instances {
+		for _, instance := range resourceInstances {
+			if instance.id != "" {
+				ids = append(ids, instance.id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// snapshotMove renames an instance of a snapshot resource in the state.
+type snapshotMove struct {
+	from string
+	to   string
+}
+
+// rotateSnapshots returns the instance of a snapshot resource replaced to
+// take a snapshot, and the moves renumbering the instances afterwards so
+// the new snapshot is first. The oldest instance is replaced, unless its
+// snapshot is being restored. It returns an empty address if every
+// instance is being restored.
+func rotateSnapshots(resourceAddress string, instances []snapshotInstance, restore string) (string, []snapshotMove) {
+	replaced := -1
+	for i := len(instances) - 1; i >= 0; i-- {
+		if restore == "" || instances[i].id != restore {
+			replaced = i
+			break
+		}
+	}
+	if replaced == -1 {
+		return "", nil
+	}
+	if instances[replaced].index == -1 || replaced == 0 {
+		return instances[replaced].address, nil
+	}
+	// Moved out of the way while the newer instances are renumbered.
+	temporary := fmt.Sprintf("%s[%d]", resourceAddress, instances[len(instances)-1].index+1)
+	moves := []snapshotMove{{from: instances[replaced].address, to: temporary}}
+	for i := replaced - 1; i >= 0; i-- {
+		moves = append(moves, snapshotMove{from: instances[i].address, to: instances[i+1].address})
+	}
+	moves = append(moves, snapshotMove{from: temporary, to: instances[0].address})
+	return instances[replaced].address, moves
+}
+
+// hasSnapshotResources returns whether the raw state contains snapshot
+// resources.
+func hasSnapshotResources(state []byte) bool {
+	if len(state) == 0 {
+		return false
+	}
+	var parsed rawState
+	err := json.Unmarshal(state, &parsed)
+	if err != nil {
+		// Let Terraform report invalid states.
+		return false
+	}
+	for _, resource := range parsed.Resources {
+		if resource.Mode == string(tfjson.ManagedResourceMode) && resource.Name == SnapshotResourceName {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRestoreSnapshot returns an error if the snapshot being restored
+// isn't kept for the workspace. It must only be called while the lock is
+// held.
+func (e *executor) checkRestoreSnapshot(ctx, killCtx context.Context, planfilePath string) error {
+	plan, err := e.showPlan(ctx, killCtx, planfilePath)
+	if err != nil {
+		return xerrors.Errorf("show terraform plan file: %w", err)
+	}
+	ids := snapshotIDs(snapshotInstances(plan))
+	if slices.Contains(ids, e.restoreSnapshot) {
+		return nil
+	}
+	if len(ids) == 0 {
+		return xerrors.Errorf("snapshot %q can't be restored, no snapshots are kept for the workspace", e.restoreSnapshot)
+	}
+	return xerrors.Errorf("snapshot %q can't be restored, it isn't one of the snapshots kept for the workspace: %s",
+		e.restoreSnapshot, strings.Join(ids, ", "))
+}
+
+// snapshotBeforeDestructiveChanges replaces a snapshot instance of every
+// snapshot resource if the plan of the build deletes or replaces
+// resources, and plans the build again, since the snapshots changed the
+// state. The build fails if the new plan changes other resources than the
+// plan shown to coderd.
+//
+// snapshotBeforeDestructiveChanges must only be called while the lock is held.
+func (e *executor) snapshotBeforeDestructiveChanges(ctx, killCtx context.Context, logr logSink) error {
+	kept := e.server.retryPlans.load(e.workdir, e.workspace)
+	if kept == nil || !kept.snapshot || kept.destroy {
+		return nil
+	}
+	plan, err := e.showPlan(ctx, killCtx, e.planFilePath())
+	if err != nil {
+		return xerrors.Errorf("show terraform plan file: %w", err)
+	}
+	destroyed := destructiveChanges(plan)
+	if len(destroyed) == 0 {
+		return nil
+	}
+	instances := snapshotInstances(plan)
+	resources := make([]string, 0, len(instances))
+	for resource := range instances {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	var (
+		replaced []string
+		moves    []snapshotMove
+	)
+	for _, resource := range resources {
+		address, resourceMoves := rotateSnapshots(resource, instances[resource], kept.restoreSnapshot)
+		if address == "" {
+			logr.ProvisionLog(proto.LogLevel_WARN, fmt.Sprintf(
+				"Not taking a snapshot with %s, its only snapshot is being restored", resource))
+			continue
+		}
+		replaced = append(replaced, address)
+		moves = append(moves, resourceMoves...)
+	}
+	if len(replaced) == 0 {
+		return nil
+	}
+	logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf(
+		"The build deletes or replaces %s, taking snapshots first: %s",
+		strings.Join(destroyed, ", "), strings.Join(replaced, ", ")))
+
+	args := []string{
+		"apply",
+		"-no-color",
+		"-auto-approve",
+		"-input=false",
+		"-json",
+		"-refresh=false",
+	}
+	for _, variable := range kept.vars {
+		args = append(args, "-var", variable)
+	}
+	for _, varFile := range e.varFiles {
+		args = append(args, "-var-file="+varFile)
+	}
+	for _, address := range replaced {
+		args = append(args, "-target="+address, "-replace="+address)
+	}
+	err = e.execLogOutput(ctx, killCtx, args, kept.env, logr)
+	if err != nil {
+		return xerrors.Errorf("terraform apply snapshots: %w", err)
+	}
+	for _, move := range moves {
+		err = e.execLogOutput(ctx, killCtx, []string{"state", "mv", "-lock=false", move.from, move.to}, e.basicEnv(), logr)
+		if err != nil {
+			return xerrors.Errorf("move snapshot %s to %s: %w", move.from, move.to, err)
+		}
+	}
+
+	changes, err := e.planAgain(ctx, killCtx, kept, logr)
+	if err != nil {
+		return err
+	}
+	if diff := diffChanges(kept.changes, changes); len(diff) > 0 {
+		return xerrors.Errorf("the resources changed while taking snapshots (%s), "+
+			"start the build again to plan it with them", strings.Join(diff, ", "))
+	}
+	return nil
+}
+
+// snapshotMetadata returns the metadata of a snapshot resource.
+func snapshotMetadata(resource *tfjson.StateResource) []*proto.Resource_Metadata {
+	if resource.Name != SnapshotResourceName {
+		return nil
+	}
+	id, ok := resource.AttributeValues["id"].(string)
+	if !ok || id == "" {
+		return nil
+	}
+	return []*proto.Resource_Metadata{{
+		Key:   SnapshotIDMetadataKey,
+		Value: id,
+	}}
+}
@@ -0,0 +1,148 @@
+package terraform
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestSnapshotPlan(t *testing.T) {
+	t.Parallel()
+
+	plan := &tfjson.Plan{
+		PriorState: &tfjson.State{Values: &tfjson.StateValues{RootModule: &tfjson.StateModule{
+			Resources: []*tfjson.StateResource{
+				{Address: "aws_ebs_volume.home", Mode: tfjson.ManagedResourceMode, Name: "home"},
+			},
+			ChildModules: []*tfjson.StateModule{{
+				Resources: []*tfjson.StateResource{{
+					Address:         "module.home.aws_ebs_snapshot.coder_snapshot[1]",
+					Mode:            tfjson.ManagedResourceMode,
+					Name:            SnapshotResourceName,
+					Index:           float64(1),
+					AttributeValues: map[string]interface{}{"id": "snap-1"},
+				}, {
+					Address:         "module.home.aws_ebs_snapshot.coder_snapshot[0]",
+					Mode:            tfjson.ManagedResourceMode,
+					Name:            SnapshotResourceName,
+					Index:           float64(0),
+					AttributeValues: map[string]interface{}{"id": "snap-0"},
+				}, {
+					Address:         `aws_ebs_snapshot.coder_snapshot["data"]`,
+					Mode:            tfjson.ManagedResourceMode,
+					Name:            SnapshotResourceName,
+					Index:           "data",
+					AttributeValues: map[string]interface{}{"id": "snap-data"},
+				}},
+			}},
+		}}},
+		ResourceChanges: []*tfjson.ResourceChange{
+			{
+				Address: "aws_ebs_volume.home",
+				Mode:    tfjson.ManagedResourceMode,
+				Name:    "home",
+				Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete, tfjson.ActionCreate}},
+			},
+			{
+				Address: "aws_instance.dev",
+				Mode:    tfjson.ManagedResourceMode,
+				Name:    "dev",
+				Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}},
+			},
+			{
+				Address: "module.home.aws_ebs_snapshot.coder_snapshot",
+				Mode:    tfjson.ManagedResourceMode,
+				Name:    SnapshotResourceName,
+				Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete}},
+			},
+		},
+	}
+	require.Equal(t, []string{"aws_ebs_volume.home"}, destructiveChanges(plan))
+	instances := snapshotInstances(plan)
+	require.Equal(t, map[string][]snapshotInstance{
+		"module.home.aws_ebs_snapshot.coder_snapshot": {
+			{address: "module.home.aws_ebs_snapshot.coder_snapshot[0]", index: 0, id: "snap-0"},
+			{address: "module.home.aws_ebs_snapshot.coder_snapshot[1]", index: 1, id: "snap-1"},
+		},
+		`aws_ebs_snapshot.coder_snapshot["data"]`: {
+			{address: `aws_ebs_snapshot.coder_snapshot["data"]`, index: -1, id: "snap-data"},
+		},
+	}, instances)
+	require.Equal(t, []string{"snap-0", "snap-1", "snap-data"}, snapshotIDs(instances))
+
+	require.Empty(t, snapshotInstances(&tfjson.Plan{}))
+}
+
+func TestRotateSnapshots(t *testing.T) {
+	t.Parallel()
+
+	const resource = "aws_ebs_snapshot.coder_snapshot"
+	instances := []snapshotInstance{
+		{address: resource + "[0]", index: 0, id: "snap-0"},
+		{address: resource + "[1]", index: 1, id: "snap-1"},
+		{address: resource + "[2]", index: 2, id: "snap-2"},
+	}
+
+	t.Run("Oldest", func(t *testing.T) {
+		t.Parallel()
+		replaced, moves := rotateSnapshots(resource, instances, "")
+		require.Equal(t, resource+"[2]", replaced)
+		require.Equal(t, []snapshotMove{
+			{from: resource + "[2]", to: resource + "[3]"},
+			{from: resource + "[1]", to: resource + "[2]"},
+			{from: resource + "[0]", to: resource + "[1]"},
+			{from: resource + "[3]", to: resource + "[0]"},
+		}, moves)
+	})
+
+	t.Run("KeepsRestored", func(t *testing.T) {
+		t.Parallel()
+		replaced, moves := rotateSnapshots(resource, instances, "snap-2")
+		require.Equal(t, resource+"[1]", replaced)
+		require.Equal(t, []snapshotMove{
+			{from: resource + "[1]", to: resource + "[3]"},
+			{from: resource + "[0]", to: resource + "[1]"},
+			{from: resource + "[3]", to: resource + "[0]"},
+		}, moves)
+	})
+
+	t.Run("Single", func(t *testing.T) {
+		t.Parallel()
+		single := []snapshotInstance{{address: resource, index: -1, id: "snap"}}
+		replaced, moves := rotateSnapshots(resource, single, "")
+		require.Equal(t, resource, replaced)
+		require.Empty(t, moves)
+
+		replaced, _ = rotateSnapshots(resource, single, "snap")
+		require.Empty(t, replaced)
+	})
+}
+
+func TestHasSnapshotResources(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, hasSnapshotResources([]byte(`{"resources": [
+		{"mode": "managed", "type": "aws_ebs_snapshot", "name": "coder_snapshot", "instances": []}
+	]}`)))
+	require.False(t, hasSnapshotResources([]byte(partiallyAppliedState)))
+	require.False(t, hasSnapshotResources(nil))
+}
+
+func TestSnapshotMetadata(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, []*proto.Resource_Metadata{{Key: SnapshotIDMetadataKey, Value: "snap-0123"}},
+		snapshotMetadata(&tfjson.StateResource{
+			Name:            SnapshotResourceName,
+			AttributeValues: map[string]interface{}{"id": "snap-0123"},
+		}))
+	// The ID of snapshots is unknown in plans.
+	require.Empty(t, snapshotMetadata(&tfjson.StateResource{Name: SnapshotResourceName}))
+	require.Empty(t, snapshotMetadata(&tfjson.StateResource{
+		Name:            "home",
+		AttributeValues: map[string]interface{}{"id": "vol-0123"},
+	}))
+}
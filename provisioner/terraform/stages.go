@@ -0,0 +1,91 @@
+package terraform
+
+import (
+	"strings"
+
+	"github.com/coder/coder/v2/provisionersdk"
+)
+
+// networkResourceTypes are substrings of the types of resources that make
+// up the network of a workspace, e.g. "google_compute_firewall".
+var networkResourceTypes = []string{
+	"network",
+	"subnet",
+	"vpc",
+	"firewall",
+	"security_group",
+	"route",
+	"address",
+	"_eip",
+	"dns",
+	"gateway",
+	"load_balancer",
+	"_lb",
+}
+
+// computeResourceTypes are substrings of the types of resources that run
+// the agents of a workspace, e.g. "docker_container".
+var computeResourceTypes = []string{
+	"instance",
+	"container",
+	"virtual_machine",
+	"droplet",
+	"pod",
+	"deployment",
+	"stateful_set",
+	"machine",
+	"server",
+}
+
+// resourceBuildStage returns the stage applying the resource type belongs
+// to, or false if it doesn't belong to one, e.g. for volumes.
+func resourceBuildStage(resourceType string) (provisionersdk.BuildStage, bool) {
+	if strings.HasPrefix(resourceType, "coder_") {
+		return "", false
+	}
+	// Network is matched first, as network resources are often named
+	// after the compute they attach to, e.g. "hcloud_server_network".
+	for _, s := range networkResourceTypes {
+		if strings.Contains(resourceType, s) {
+			return provisionersdk.BuildStageApplyNetwork, true
+		}
+	}
+	for _, s := range computeResourceTypes {
+		if strings.Contains(resourceType, s) {
+			return provisionersdk.BuildStageApplyCompute, true
+		}
+	}
+	return "", false
+}
+
+// buildStageTracker reports the stages of an apply from the resources
+// Terraform starts to apply. Stages only advance, so a network resource
+// applied after compute doesn't go back to the network stage.
+type buildStageTracker struct {
+	report  func(stage provisionersdk.BuildStage)
+	current provisionersdk.BuildStage
+}
+
+func (t *buildStageTracker) enter(stage provisionersdk.BuildStage) {
+	if t.report == nil {
+		return
+	}
+	if t.current != "" && !t.current.Before(stage) {
+		return
+	}
+	t.current = stage
+	t.report(stage)
+}
+
+// onLog is a provisionLogWriter callback entering the stage of resources
+// that start to be applied.
+func (t *buildStageTracker) onLog(log *terraformProvisionLog) {
+	if log.Type != "apply_start" || log.Hook == nil {
+		return
+	}
+	stage, ok := resourceBuildStage(log.Hook.Resource.ResourceType)
+	if !ok {
+		return
+	}
+	t.enter(stage)
+}
@@ -0,0 +1,60 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk"
+)
+
+func TestResourceBuildStage(t *testing.T) {
+	t.Parallel()
+
+	for resourceType, want := range map[string]provisionersdk.BuildStage{
+		"docker_network":                provisionersdk.BuildStageApplyNetwork,
+		"google_compute_firewall":       provisionersdk.BuildStageApplyNetwork,
+		"aws_security_group":            provisionersdk.BuildStageApplyNetwork,
+		"hcloud_server_network":         provisionersdk.BuildStageApplyNetwork,
+		"docker_container":              provisionersdk.BuildStageApplyCompute,
+		"aws_instance":                  provisionersdk.BuildStageApplyCompute,
+		"azurerm_linux_virtual_machine": provisionersdk.BuildStageApplyCompute,
+		"kubernetes_deployment":         provisionersdk.BuildStageApplyCompute,
+		"docker_volume":                 "",
+		"coder_agent":                   "",
+	} {
+		stage, ok := resourceBuildStage(resourceType)
+		require.Equal(t, want != "", ok, resourceType)
+		require.Equal(t, want, stage, resourceType)
+	}
+}
+
+func TestBuildStageTracker(t *testing.T) {
+	t.Parallel()
+
+	var stages []provisionersdk.BuildStage
+	tracker := &buildStageTracker{report: func(stage provisionersdk.BuildStage) {
+		stages = append(stages, stage)
+	}}
+	applyStart := func(resourceType string) *terraformProvisionLog {
+		log := &terraformProvisionLog{Type: "apply_start", Hook: &terraformProvisionHook{}}
+		log.Hook.Resource.ResourceType = resourceType
+		return log
+	}
+	tracker.onLog(applyStart("docker_volume"))
+	tracker.onLog(applyStart("docker_network"))
+	tracker.onLog(&terraformProvisionLog{Type: "apply_complete", Hook: &terraformProvisionHook{}})
+	tracker.onLog(applyStart("docker_container"))
+	// Stages don't go back.
+	tracker.onLog(applyStart("docker_network"))
+	tracker.enter(provisionersdk.BuildStageAgentsConnecting)
+	require.Equal(t, []provisionersdk.BuildStage{
+		provisionersdk.BuildStageApplyNetwork,
+		provisionersdk.BuildStageApplyCompute,
+		provisionersdk.BuildStageAgentsConnecting,
+	}, stages)
+
+	// Stages aren't reported without a reporter.
+	tracker = &buildStageTracker{}
+	tracker.onLog(applyStart("docker_container"))
+}
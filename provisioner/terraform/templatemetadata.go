@@ -0,0 +1,150 @@
+package terraform
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// templateMetadataLocal is the local value templates describe themselves
+// with, e.g.
+//
+//	locals {
+//	  coder_template = {
+//	    display_name = "Docker"
+//	    icon         = "/icon/docker.png"
+//	    description  = "Develop in a Docker container"
+//	    docs_url     = "https://example.com/docs/docker"
+//	  }
+//	}
+//
+// It's read from the source, so its attributes must be literal strings.
+const templateMetadataLocal = "coder_template"
+
+var localsSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{{Type: "locals"}},
+}
+
+// parseTemplateMetadata returns the metadata of the template in the root
+// module in dir, or nil if the template doesn't describe itself.
+func parseTemplateMetadata(dir string) (*proto.TemplateMetadata, error) {
+	attr, err := findLocal(dir, templateMetadataLocal)
+	if err != nil {
+		return nil, err
+	}
+	if attr == nil {
+		return nil, nil
+	}
+	return convertTemplateMetadata(attr)
+}
+
+// findLocal returns the local value with the name in the root module in
+// dir, or nil if the module doesn't define it.
+func findLocal(dir, local string) (*hcl.Attribute, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("read module directory: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".tf") || strings.HasSuffix(entry.Name(), ".tf.json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	parser := hclparse.NewParser()
+	var found *hcl.Attribute
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		var (
+			file  *hcl.File
+			diags hcl.Diagnostics
+		)
+		if strings.HasSuffix(name, ".json") {
+			file, diags = parser.ParseJSONFile(path)
+		} else {
+			file, diags = parser.ParseHCLFile(path)
+		}
+		if diags.HasErrors() {
+			return nil, xerrors.Errorf("parse %s: %w", name, diags)
+		}
+		content, _, diags := file.Body.PartialContent(localsSchema)
+		if diags.HasErrors() {
+			return nil, xerrors.Errorf("parse %s: %w", name, diags)
+		}
+		for _, block := range content.Blocks {
+			attrs, diags := block.Body.JustAttributes()
+			if diags.HasErrors() {
+				return nil, xerrors.Errorf("parse locals in %s: %w", name, diags)
+			}
+			attr, ok := attrs[local]
+			if !ok {
+				continue
+			}
+			if found != nil {
+				return nil, xerrors.Errorf("local %q is defined more than once (%s, %s)",
+					local, found.NameRange, attr.NameRange)
+			}
+			found = attr
+		}
+	}
+	return found, nil
+}
+
+// convertTemplateMetadata converts the value of the coder_template local.
+func convertTemplateMetadata(attr *hcl.Attribute) (*proto.TemplateMetadata, error) {
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return nil, xerrors.Errorf("local %q must only contain literal values: %w", templateMetadataLocal, diags)
+	}
+	if value.IsNull() {
+		return nil, nil
+	}
+	if !value.Type().IsObjectType() && !value.Type().IsMapType() {
+		return nil, xerrors.Errorf("local %q must be an object (%s)", templateMetadataLocal, attr.NameRange)
+	}
+
+	metadata := &proto.TemplateMetadata{}
+	for it := value.ElementIterator(); it.Next(); {
+		key, element := it.Element()
+		name := key.AsString()
+		if element.IsNull() {
+			continue
+		}
+		if !element.Type().Equals(cty.String) {
+			return nil, xerrors.Errorf("%s.%s must be a string", templateMetadataLocal, name)
+		}
+		switch name {
+		case "display_name":
+			metadata.DisplayName = element.AsString()
+		case "icon":
+			metadata.Icon = element.AsString()
+		case "description":
+			metadata.Description = element.AsString()
+		case "docs_url":
+			metadata.DocsUrl = element.AsString()
+		default:
+			return nil, xerrors.Errorf("unsupported attribute %s.%s", templateMetadataLocal, name)
+		}
+	}
+	if metadata.DocsUrl != "" {
+		parsed, err := url.Parse(metadata.DocsUrl)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, xerrors.Errorf("%s.docs_url %q must be an http or https URL", templateMetadataLocal, metadata.DocsUrl)
+		}
+	}
+	return metadata, nil
+}
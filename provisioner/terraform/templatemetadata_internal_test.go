@@ -0,0 +1,94 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestParseTemplateMetadata(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		files    map[string]string
+		expected *proto.TemplateMetadata
+		err      string
+	}{{
+		name: "None",
+		files: map[string]string{
+			"main.tf": `locals { other = "value" }`,
+		},
+	}, {
+		name: "HCL",
+		files: map[string]string{
+			"main.tf": `resource "null_resource" "dev" {}`,
+			"template.tf": `
+locals {
+  coder_template = {
+    display_name = "Docker"
+    icon         = "/icon/docker.png"
+    description  = "Develop in a Docker container"
+    docs_url     = "https://example.com/docs"
+  }
+}`,
+		},
+		expected: &proto.TemplateMetadata{
+			DisplayName: "Docker",
+			Icon:        "/icon/docker.png",
+			Description: "Develop in a Docker container",
+			DocsUrl:     "https://example.com/docs",
+		},
+	}, {
+		name: "JSON",
+		files: map[string]string{
+			"main.tf.json": `{"locals": {"coder_template": {"display_name": "Docker"}}}`,
+		},
+		expected: &proto.TemplateMetadata{DisplayName: "Docker"},
+	}, {
+		name: "Duplicate",
+		files: map[string]string{
+			"a.tf": `locals { coder_template = { icon = "/icon/a.png" } }`,
+			"b.tf": `locals { coder_template = { icon = "/icon/b.png" } }`,
+		},
+		err: "defined more than once",
+	}, {
+		name: "Reference",
+		files: map[string]string{
+			"main.tf": `locals { coder_template = { display_name = var.name } }`,
+		},
+		err: "literal values",
+	}, {
+		name: "UnsupportedAttribute",
+		files: map[string]string{
+			"main.tf": `locals { coder_template = { name = "docker" } }`,
+		},
+		err: "unsupported attribute",
+	}, {
+		name: "InvalidDocsURL",
+		files: map[string]string{
+			"main.tf": `locals { coder_template = { docs_url = "docs/README.md" } }`,
+		},
+		err: "http or https URL",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			for name, content := range tc.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+			}
+			metadata, err := parseTemplateMetadata(dir)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, metadata)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+terraform {
+  required_providers {
+    coder = {
+      source  = "coder/coder"
+      version = "0.14.1"
+    }
+  }
+}
+
+# The agent runs outside of any resource of the workspace, e.g. on a
+# developer's machine.
+resource "coder_agent" "dev" {
+  os       = "linux"
+  arch     = "amd64"
+  external = true
+}
+
+resource "coder_app" "web" {
+  agent_id = coder_agent.dev.id
+  slug     = "web"
+  url      = "http://localhost:8080"
+}
+
+resource "coder_script" "cleanup" {
+  agent_id     = coder_agent.dev.id
+  display_name = "Cleanup"
+  script       = "rm -rf ~/.cache"
+  cron         = "0 0 2 * * *"
+}
@@ -0,0 +1,391 @@
+// gen generates the Terraform plan and state fixtures of the templates in
+// provisioner/terraform/testdata against one or more Terraform versions.
+//
+// Every template is planned and applied with each version, and the fixtures of
+// all versions must convert to the same resources, parameters and external
+// auth providers. The fixtures of the first version are written next to the
+// template.
+//
+//	go run ./provisioner/terraform/testdata/gen -versions 1.5.7,1.6.6 multiple-agents
+//
+// Without arguments, the fixtures of all templates are generated.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-version"
+	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/sloghuman"
+
+	"github.com/coder/coder/v2/provisioner/terraform"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// skipped are the directories of testdata that aren't templates whose
+// fixtures can be generated.
+var skipped = map[string]string{
+	"cleanup-stale-plugins": "it holds the golden files of the plugin cleanup",
+	"gen":                   "it holds this generator",
+	"kubernetes-metadata":   "its fixtures need care to update correctly",
+	// The fixtures below are written by hand, because no released version
+	// of the coder provider has the resources and attributes they use. Pin
+	// the provider version that adds them and remove the entries once it's
+	// released.
+	"external-agent":    "coder_agent.external isn't released in the coder provider",
+	"resource-metadata": "coder_metadata item order and group aren't released in the coder provider",
+	"workspace-network": "coder_workspace_network isn't released in the coder provider",
+}
+
+func main() {
+	var (
+		versionList string
+		installDir  string
+	)
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	flag.StringVar(&versionList, "versions", terraform.TerraformVersion.String(), "Comma separated list of Terraform versions to generate the fixtures with. The fixtures of the first version are written.")
+	flag.StringVar(&installDir, "install-dir", filepath.Join(cacheDir, "coder", "terraform-fixtures"), "Directory the Terraform versions are installed to.")
+	flag.Parse()
+
+	log := slog.Make(sloghuman.Sink(os.Stderr))
+	err = run(context.Background(), log, versionList, installDir, flag.Args())
+	if err != nil {
+		log.Fatal(context.Background(), "generate fixtures", slog.Error(err))
+	}
+}
+
+func run(ctx context.Context, log slog.Logger, versionList, installDir string, names []string) error {
+	testdata, err := testdataDir()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names, err = templates(testdata)
+		if err != nil {
+			return err
+		}
+	}
+	for i, name := range names {
+		// Names can be paths of the template directories.
+		names[i] = filepath.Base(filepath.Clean(name))
+		if reason, ok := skipped[names[i]]; ok {
+			return xerrors.Errorf("fixtures of %q can't be generated, %s", names[i], reason)
+		}
+	}
+
+	binaries := make([]string, 0)
+	versions := make([]string, 0)
+	for _, raw := range strings.Split(versionList, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		v, err := version.NewVersion(raw)
+		if err != nil {
+			return xerrors.Errorf("parse version %q: %w", raw, err)
+		}
+		binary, err := terraform.Install(ctx, log, filepath.Join(installDir, v.String()), v)
+		if err != nil {
+			return xerrors.Errorf("install terraform %s: %w", v, err)
+		}
+		binaries = append(binaries, binary)
+		versions = append(versions, v.String())
+	}
+	if len(binaries) == 0 {
+		return xerrors.New("at least one version is required")
+	}
+
+	for _, name := range names {
+		dir := filepath.Join(testdata, name)
+
+		var (
+			reference     *fixtures
+			referenceConv *conversion
+		)
+		for i, binary := range binaries {
+			log.Info(ctx, "generating fixtures", slog.F("template", name), slog.F("version", versions[i]))
+			generated, err := generate(ctx, binary, dir, name)
+			if err != nil {
+				return xerrors.Errorf("generate %s with terraform %s: %w", name, versions[i], err)
+			}
+			converted, err := generated.convert()
+			if err != nil {
+				return xerrors.Errorf("convert %s fixtures of terraform %s: %w", name, versions[i], err)
+			}
+			if reference == nil {
+				reference, referenceConv = generated, converted
+				continue
+			}
+			if diff := cmp.Diff(referenceConv, converted); diff != "" {
+				return xerrors.Errorf("%s fixtures of terraform %s and %s convert differently (-%s +%s):\n%s",
+					name, versions[0], versions[i], versions[0], versions[i], diff)
+			}
+		}
+
+		err = reference.write(dir, name)
+		if err != nil {
+			return xerrors.Errorf("write %s fixtures: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// testdataDir returns the testdata directory, the generator is run from the
+// root of the repository.
+func testdataDir() (string, error) {
+	dir := filepath.Join("provisioner", "terraform", "testdata")
+	_, err := os.Stat(dir)
+	if err != nil {
+		return "", xerrors.Errorf("run the generator from the root of the repository: %w", err)
+	}
+	return dir, nil
+}
+
+// templates returns the names of the templates in testdata.
+func templates(testdata string) ([]string, error) {
+	entries, err := os.ReadDir(testdata)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, ok := skipped[entry.Name()]; ok {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+// fixtures are the files the tests of the template read.
+type fixtures struct {
+	planJSON  []byte
+	planDOT   []byte
+	stateJSON []byte
+	stateDOT  []byte
+}
+
+// generate plans and applies a copy of the template, so the template
+// directory is left untouched if Terraform fails.
+func generate(ctx context.Context, binary, dir, name string) (*fixtures, error) {
+	workdir, err := os.MkdirTemp("", "coder-terraform-fixtures-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workdir)
+
+	err = copyTemplate(dir, workdir, name)
+	if err != nil {
+		return nil, xerrors.Errorf("copy template: %w", err)
+	}
+
+	tf := func(args ...string) ([]byte, error) {
+		var stdout, stderr bytes.Buffer
+		// #nosec
+		cmd := exec.CommandContext(ctx, binary, args...)
+		cmd.Dir = workdir
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		if err != nil {
+			return nil, xerrors.Errorf("terraform %s: %w: %s", args[0], err, stderr.String())
+		}
+		return stdout.Bytes(), nil
+	}
+
+	var generated fixtures
+	if _, err = tf("init", "-upgrade", "-input=false"); err != nil {
+		return nil, err
+	}
+	if _, err = tf("plan", "-input=false", "-out", "terraform.tfplan"); err != nil {
+		return nil, err
+	}
+	if generated.planJSON, err = tf("show", "-json", "terraform.tfplan"); err != nil {
+		return nil, err
+	}
+	if generated.planDOT, err = tf("graph"); err != nil {
+		return nil, err
+	}
+	if _, err = tf("apply", "-input=false", "-auto-approve", "terraform.tfplan"); err != nil {
+		return nil, err
+	}
+	if generated.stateJSON, err = tf("show", "-json", "terraform.tfstate"); err != nil {
+		return nil, err
+	}
+	// Like generate.sh, the graph of the state is rendered once the state
+	// is removed, so it only depends on the configuration.
+	err = os.Remove(filepath.Join(workdir, "terraform.tfstate"))
+	if err != nil {
+		return nil, err
+	}
+	if generated.stateDOT, err = tf("graph"); err != nil {
+		return nil, err
+	}
+
+	for _, raw := range []*[]byte{&generated.planJSON, &generated.stateJSON} {
+		var buf bytes.Buffer
+		err = json.Indent(&buf, *raw, "", "  ")
+		if err != nil {
+			return nil, xerrors.Errorf("indent json: %w", err)
+		}
+		buf.WriteByte('\n')
+		*raw = buf.Bytes()
+	}
+	return &generated, nil
+}
+
+// copyTemplate copies the configuration of the template, skipping the
+// fixtures and the files Terraform leaves behind.
+func copyTemplate(src, dst, name string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		base := d.Name()
+		if strings.HasPrefix(base, ".terraform") || strings.HasPrefix(base, "terraform.tf") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(base, name+".tfplan.") || strings.HasPrefix(base, name+".tfstate.") {
+			return nil
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0o700)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, rel), data, 0o600)
+	})
+}
+
+func (f *fixtures) write(dir, name string) error {
+	for suffix, data := range map[string][]byte{
+		".tfplan.json":  f.planJSON,
+		".tfplan.dot":   f.planDOT,
+		".tfstate.json": f.stateJSON,
+		".tfstate.dot":  f.stateDOT,
+	} {
+		err := os.WriteFile(filepath.Join(dir, name+suffix), data, 0o600)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conversion is what the tests of the template compare, fixtures of
+// different versions must convert to the same.
+type conversion struct {
+	Plan  string
+	State string
+}
+
+// convert converts the plan and the state like the tests of ConvertState,
+// dropping the values that change with every apply.
+func (f *fixtures) convert() (*conversion, error) {
+	var plan tfjson.Plan
+	err := json.Unmarshal(f.planJSON, &plan)
+	if err != nil {
+		return nil, xerrors.Errorf("unmarshal plan: %w", err)
+	}
+	modules := []*tfjson.StateModule{plan.PlannedValues.RootModule}
+	if plan.PriorState != nil {
+		modules = append(modules, plan.PriorState.Values.RootModule)
+	}
+	planned, err := terraform.ConvertState(modules, string(f.planDOT))
+	if err != nil {
+		return nil, xerrors.Errorf("convert plan: %w", err)
+	}
+
+	var state tfjson.State
+	err = json.Unmarshal(f.stateJSON, &state)
+	if err != nil {
+		return nil, xerrors.Errorf("unmarshal state: %w", err)
+	}
+	applied, err := terraform.ConvertState([]*tfjson.StateModule{state.Values.RootModule}, string(f.stateDOT))
+	if err != nil {
+		return nil, xerrors.Errorf("convert state: %w", err)
+	}
+
+	var converted conversion
+	converted.Plan, err = normalize(planned)
+	if err != nil {
+		return nil, err
+	}
+	converted.State, err = normalize(applied)
+	if err != nil {
+		return nil, err
+	}
+	return &converted, nil
+}
+
+func normalize(state *terraform.State) (string, error) {
+	sort.Slice(state.Resources, func(i, j int) bool {
+		if state.Resources[i].Name != state.Resources[j].Name {
+			return state.Resources[i].Name < state.Resources[j].Name
+		}
+		return state.Resources[i].Type < state.Resources[j].Type
+	})
+	for _, resource := range state.Resources {
+		sort.Slice(resource.Agents, func(i, j int) bool {
+			return resource.Agents[i].Name < resource.Agents[j].Name
+		})
+		for _, agent := range resource.Agents {
+			sort.Slice(agent.Apps, func(i, j int) bool {
+				return agent.Apps[i].Slug < agent.Apps[j].Slug
+			})
+			agent.Id = ""
+			if agent.GetToken() != "" {
+				agent.Auth = &proto.Agent_Token{}
+			}
+			if agent.GetInstanceId() != "" {
+				agent.Auth = &proto.Agent_InstanceId{}
+			}
+		}
+	}
+	sort.Strings(state.ExternalAuthProviders)
+
+	data, err := json.MarshalIndent(struct {
+		Resources             []*proto.Resource
+		Parameters            []*proto.RichParameter
+		ExternalAuthProviders []string
+	}{
+		Resources:             state.Resources,
+		Parameters:            state.Parameters,
+		ExternalAuthProviders: state.ExternalAuthProviders,
+	}, "", "  ")
+	if err != nil {
+		return "", xerrors.Errorf("marshal conversion: %w", err)
+	}
+	return string(data), nil
+}
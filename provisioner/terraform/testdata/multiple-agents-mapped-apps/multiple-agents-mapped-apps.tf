@@ -0,0 +1,45 @@
+terraform {
+  required_providers {
+    coder = {
+      source  = "coder/coder"
+      version = "0.12.1"
+    }
+  }
+}
+
+resource "coder_agent" "dev1" {
+  os   = "linux"
+  arch = "amd64"
+}
+
+resource "coder_agent" "dev2" {
+  os   = "linux"
+  arch = "amd64"
+}
+
+locals {
+  agents = {
+    "dev1" = coder_agent.dev1.id
+    "dev2" = coder_agent.dev2.id
+  }
+}
+
+resource "coder_app" "apps" {
+  for_each = local.agents
+
+  agent_id     = each.value
+  slug         = "app"
+  display_name = "app"
+}
+
+resource "null_resource" "dev1" {
+  depends_on = [
+    coder_agent.dev1
+  ]
+}
+
+resource "null_resource" "dev2" {
+  depends_on = [
+    coder_agent.dev2
+  ]
+}
@@ -34,6 +34,8 @@ resource "coder_metadata" "about_info" {
   item {
     key   = "hello"
     value = "world"
+    order = 2
+    group = "General"
   }
   item {
     key = "null"
@@ -46,5 +48,7 @@ resource "coder_metadata" "about_info" {
     key       = "secret"
     value     = "squirrel"
     sensitive = true
+    order     = 1
+    group     = "Credentials"
   }
 }
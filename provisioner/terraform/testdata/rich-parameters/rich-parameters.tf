@@ -22,12 +22,16 @@ data "coder_parameter" "example" {
   name = "Example"
   type = "string"
   option {
-    name  = "First Option"
-    value = "first"
+    name        = "First Option"
+    value       = "first"
+    description = "First option description"
+    icon        = "/icon/first.svg"
   }
   option {
-    name  = "Second Option"
-    value = "second"
+    name        = "Second Option"
+    value       = "second"
+    description = "Second option description"
+    icon        = "/icon/second.svg"
   }
 }
 
@@ -0,0 +1,14 @@
+terraform {
+  required_providers {
+    coder = {
+      source  = "coder/coder"
+      version = "0.14.1"
+    }
+  }
+}
+
+resource "coder_workspace_network" "main" {
+  preferred_derp_region      = "fra"
+  disable_direct_connections = true
+  mtu                        = 1400
+}
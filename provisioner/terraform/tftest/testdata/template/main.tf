@@ -0,0 +1,31 @@
+terraform {
+  required_providers {
+    coder = {
+      source  = "coder/coder"
+      version = "0.14.1"
+    }
+  }
+}
+
+variable "image" {
+  default = "ubuntu"
+}
+
+data "coder_parameter" "region" {
+  name    = "region"
+  type    = "string"
+  default = "us"
+}
+
+resource "coder_agent" "main" {
+  os   = "linux"
+  arch = "amd64"
+  env = {
+    IMAGE  = var.image
+    REGION = data.coder_parameter.region.value
+  }
+}
+
+resource "null_resource" "workspace" {
+  depends_on = [coder_agent.main]
+}
@@ -0,0 +1,304 @@
+// Package tftest plans templates with the Terraform provisioner, so template
+// authors can assert in Go tests on the resources, agents and parameters
+// Coder converts from their templates.
+//
+//	func TestTemplate(t *testing.T) {
+//		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+//		defer cancel()
+//		result := tftest.RequirePlan(ctx, t, ".", tftest.Options{
+//			Parameters: map[string]string{"region": "eu"},
+//		})
+//		require.NotNil(t, result.Agent("main"))
+//	}
+package tftest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"testing"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/codersdk/drpc"
+	"github.com/coder/coder/v2/provisioner/terraform"
+	"github.com/coder/coder/v2/provisionersdk"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// Options configure the plan of a template.
+type Options struct {
+	Logger slog.Logger
+	// BinaryPath is the Terraform binary. If empty, a compatible Terraform
+	// is looked up in $PATH, or installed into the cache path.
+	BinaryPath string
+	// CachePath stores installed Terraform binaries and providers. Sharing
+	// it between tests that don't run in parallel avoids downloading them
+	// for every plan, concurrent installs into the same cache conflict.
+	// Defaults to a temporary directory.
+	CachePath string
+	// Metadata is passed to the template like for a workspace build. The
+	// transition defaults to start.
+	Metadata *proto.Metadata
+	// Variables are the values of template variables. Variables that
+	// aren't set use their default.
+	Variables map[string]string
+	// Parameters are the values of rich parameters.
+	Parameters map[string]string
+	// State is the state of a previous build, if any.
+	State []byte
+}
+
+// Result is what Coder converted from the plan of a template.
+type Result struct {
+	Resources             []*proto.Resource
+	Parameters            []*proto.RichParameter
+	ExternalAuthProviders []string
+	// Logs are the logs of the provisioner and Terraform.
+	Logs []*proto.Log
+}
+
+// Agents returns the agents of all resources, ordered by name.
+func (r *Result) Agents() []*proto.Agent {
+	agents := make([]*proto.Agent, 0)
+	for _, resource := range r.Resources {
+		agents = append(agents, resource.Agents...)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Name < agents[j].Name
+	})
+	return agents
+}
+
+// Agent returns the agent with the name, or nil.
+func (r *Result) Agent(name string) *proto.Agent {
+	for _, agent := range r.Agents() {
+		if agent.Name == name {
+			return agent
+		}
+	}
+	return nil
+}
+
+// Resource returns the resource of the type with the name, or nil.
+func (r *Result) Resource(resourceType, name string) *proto.Resource {
+	for _, resource := range r.Resources {
+		if resource.Type == resourceType && resource.Name == name {
+			return resource
+		}
+	}
+	return nil
+}
+
+// Parameter returns the rich parameter with the name, or nil.
+func (r *Result) Parameter(name string) *proto.RichParameter {
+	for _, parameter := range r.Parameters {
+		if parameter.Name == name {
+			return parameter
+		}
+	}
+	return nil
+}
+
+// PlanError is returned by Plan if the template failed to plan.
+type PlanError struct {
+	Message string
+	// Logs are the logs of the failed plan, which usually contain the
+	// diagnostics of Terraform.
+	Logs []*proto.Log
+}
+
+func (e *PlanError) Error() string {
+	return e.Message
+}
+
+// RequirePlan is Plan, failing the test if the template fails to plan. The
+// context should have a deadline, since installing Terraform and the
+// providers may hang without network access.
+func RequirePlan(ctx context.Context, t testing.TB, dir string, opts Options) *Result {
+	t.Helper()
+	result, err := Plan(ctx, dir, opts)
+	if err != nil {
+		var planErr *PlanError
+		if errors.As(err, &planErr) {
+			for _, log := range planErr.Logs {
+				t.Log(log.Level.String(), log.Output)
+			}
+		}
+		t.Fatalf("plan template %q: %s", dir, err)
+	}
+	return result
+}
+
+// Plan runs the plan of the template in dir, like a workspace build would,
+// and returns the converted result. A *PlanError is returned if the
+// template failed to plan.
+func Plan(ctx context.Context, dir string, opts Options) (*Result, error) {
+	var archive bytes.Buffer
+	err := provisionersdk.Tar(&archive, opts.Logger, dir, provisionersdk.TemplateArchiveLimit)
+	if err != nil {
+		return nil, xerrors.Errorf("archive template: %w", err)
+	}
+
+	workDir, err := os.MkdirTemp("", "tftest-work-*")
+	if err != nil {
+		return nil, xerrors.Errorf("create work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+	cachePath := opts.CachePath
+	if cachePath == "" {
+		cachePath, err = os.MkdirTemp("", "tftest-cache-*")
+		if err != nil {
+			return nil, xerrors.Errorf("create cache directory: %w", err)
+		}
+		defer os.RemoveAll(cachePath)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	client, server := drpc.MemTransportPipe()
+	serveDone := make(chan struct{})
+	var serveErr error
+	go func() {
+		serveErr = terraform.Serve(ctx, &terraform.ServeOptions{
+			ServeOptions: &provisionersdk.ServeOptions{
+				Listener:      server,
+				Logger:        opts.Logger,
+				WorkDirectory: workDir,
+			},
+			BinaryPath: opts.BinaryPath,
+			CachePath:  cachePath,
+		})
+		close(serveDone)
+		if serveErr != nil {
+			// Dialing the session waits until it's accepted, so it's
+			// rejected when the provisioner fails to start, e.g. because
+			// Terraform can't be installed.
+			conn, err := server.Accept()
+			if err == nil {
+				_ = conn.Close()
+			}
+		}
+	}()
+	defer func() {
+		_ = client.Close()
+		_ = server.Close()
+		cancel()
+		<-serveDone
+	}()
+	// sessionError returns why the provisioner stopped, if it did, since the
+	// session only fails with a closed connection then.
+	sessionError := func(action string, err error) error {
+		select {
+		case <-serveDone:
+			if serveErr != nil {
+				return xerrors.Errorf("serve terraform provisioner: %w", serveErr)
+			}
+		default:
+		}
+		return xerrors.Errorf("%s: %w", action, err)
+	}
+
+	sess, err := proto.NewDRPCProvisionerClient(client).Session(ctx)
+	if err != nil {
+		return nil, sessionError("start session", err)
+	}
+	defer sess.Close()
+	err = sess.Send(&proto.Request{Type: &proto.Request_Config{Config: &proto.Config{
+		TemplateSourceArchive: archive.Bytes(),
+		State:                 opts.State,
+	}}})
+	if err != nil {
+		return nil, sessionError("send config", err)
+	}
+
+	// Template variables are parsed first to pass their defaults, like
+	// coderd does when importing a template version.
+	err = sess.Send(&proto.Request{Type: &proto.Request_Parse{Parse: &proto.ParseRequest{}}})
+	if err != nil {
+		return nil, sessionError("send parse", err)
+	}
+	var logs []*proto.Log
+	var parsed *proto.ParseComplete
+	for parsed == nil {
+		msg, err := sess.Recv()
+		if err != nil {
+			return nil, sessionError("receive parse", err)
+		}
+		if log := msg.GetLog(); log != nil {
+			logs = append(logs, log)
+		}
+		parsed = msg.GetParse()
+	}
+	if parsed.Error != "" {
+		return nil, &PlanError{Message: "parse: " + parsed.Error, Logs: logs}
+	}
+
+	metadata := opts.Metadata
+	if metadata == nil {
+		metadata = &proto.Metadata{}
+	}
+	err = sess.Send(&proto.Request{Type: &proto.Request_Plan{Plan: &proto.PlanRequest{
+		Metadata:            metadata,
+		RichParameterValues: richParameterValues(opts.Parameters),
+		VariableValues:      variableValues(parsed.TemplateVariables, opts.Variables),
+	}}})
+	if err != nil {
+		return nil, sessionError("send plan", err)
+	}
+	var plan *proto.PlanComplete
+	for plan == nil {
+		msg, err := sess.Recv()
+		if err != nil {
+			return nil, sessionError("receive plan", err)
+		}
+		if log := msg.GetLog(); log != nil {
+			logs = append(logs, log)
+		}
+		plan = msg.GetPlan()
+	}
+	if plan.Error != "" {
+		return nil, &PlanError{Message: plan.Error, Logs: logs}
+	}
+	return &Result{
+		Resources:             plan.Resources,
+		Parameters:            plan.Parameters,
+		ExternalAuthProviders: plan.ExternalAuthProviders,
+		Logs:                  logs,
+	}, nil
+}
+
+func variableValues(variables []*proto.TemplateVariable, values map[string]string) []*proto.VariableValue {
+	result := make([]*proto.VariableValue, 0, len(variables))
+	for _, variable := range variables {
+		value, ok := values[variable.Name]
+		if !ok {
+			if variable.Required {
+				// Let Terraform report the missing value.
+				continue
+			}
+			value = variable.DefaultValue
+		}
+		result = append(result, &proto.VariableValue{
+			Name:      variable.Name,
+			Value:     value,
+			Sensitive: variable.Sensitive,
+		})
+	}
+	return result
+}
+
+func richParameterValues(values map[string]string) []*proto.RichParameterValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]*proto.RichParameterValue, 0, len(values))
+	for _, name := range names {
+		result = append(result, &proto.RichParameterValue{Name: name, Value: values[name]})
+	}
+	return result
+}
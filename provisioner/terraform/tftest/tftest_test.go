@@ -0,0 +1,58 @@
+//go:build linux || darwin
+
+package tftest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/coder/v2/provisioner/terraform/tftest"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Defaults", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		result := tftest.RequirePlan(ctx, t, "testdata/template", tftest.Options{
+			Logger:    slogtest.Make(t, nil),
+			CachePath: t.TempDir(),
+		})
+		require.NotNil(t, result.Resource("null_resource", "workspace"))
+		agent := result.Agent("main")
+		require.NotNil(t, agent)
+		require.Equal(t, "ubuntu", agent.Env["IMAGE"])
+		require.Equal(t, "us", agent.Env["REGION"])
+		require.Equal(t, "us", result.Parameter("region").DefaultValue)
+	})
+
+	t.Run("Values", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		result := tftest.RequirePlan(ctx, t, "testdata/template", tftest.Options{
+			Logger:     slogtest.Make(t, nil),
+			CachePath:  t.TempDir(),
+			Variables:  map[string]string{"image": "debian"},
+			Parameters: map[string]string{"region": "eu"},
+		})
+		agent := result.Agent("main")
+		require.NotNil(t, agent)
+		require.Equal(t, "debian", agent.Env["IMAGE"])
+		require.Equal(t, "eu", agent.Env["REGION"])
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Parallel()
+		ctx := testutil.Context(t, testutil.WaitLong)
+		dir := t.TempDir()
+		_, err := tftest.Plan(ctx, dir+"/missing", tftest.Options{
+			Logger:    slogtest.Make(t, nil),
+			CachePath: t.TempDir(),
+		})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,132 @@
+package terraform
+
+import (
+	"sort"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// TopologyNodeKind is the kind of a node of a workspace topology.
+type TopologyNodeKind string
+
+const (
+	TopologyNodeKindResource TopologyNodeKind = "resource"
+	TopologyNodeKindAgent    TopologyNodeKind = "agent"
+	TopologyNodeKindApp      TopologyNodeKind = "app"
+)
+
+// Topology is a simplified dependency graph of a workspace, suitable for
+// rendering a diagram. Resources are associated with the agents running on
+// them, and agents with their apps, as resolved from the Terraform graph.
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+type TopologyNode struct {
+	// ID is unique within the topology.
+	ID   string           `json:"id"`
+	Kind TopologyNodeKind `json:"kind"`
+	// Type is the Terraform resource type of resources.
+	Type string `json:"type,omitempty"`
+	Name string `json:"name"`
+	Icon string `json:"icon,omitempty"`
+}
+
+// TopologyEdge associates a parent node with a child node.
+type TopologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// addResource adds a resource with its agents and apps.
+func (t *Topology) addResource(address string, resource *proto.Resource) {
+	resourceID := "resource:" + address
+	t.Nodes = append(t.Nodes, TopologyNode{
+		ID:   resourceID,
+		Kind: TopologyNodeKindResource,
+		Type: resource.Type,
+		Name: resource.Name,
+		Icon: resource.Icon,
+	})
+	for _, agent := range resource.Agents {
+		// Agent names are unique within a template.
+		agentID := "agent:" + agent.Name
+		t.Nodes = append(t.Nodes, TopologyNode{
+			ID:   agentID,
+			Kind: TopologyNodeKindAgent,
+			Name: agent.Name,
+		})
+		t.Edges = append(t.Edges, TopologyEdge{From: resourceID, To: agentID})
+		for _, app := range agent.Apps {
+			// App slugs are unique per agent.
+			appID := "app:" + agent.Name + "/" + app.Slug
+			t.Nodes = append(t.Nodes, TopologyNode{
+				ID:   appID,
+				Kind: TopologyNodeKindApp,
+				Name: app.DisplayName,
+				Icon: app.Icon,
+			})
+			t.Edges = append(t.Edges, TopologyEdge{From: agentID, To: appID})
+		}
+	}
+}
+
+// normalize removes duplicate nodes and edges, and orders them by their IDs
+// so topologies of the same state are equal. Agents of resources with
+// multiple instances are added once per instance.
+func (t *Topology) normalize() {
+	sort.SliceStable(t.Nodes, func(i, j int) bool {
+		return t.Nodes[i].ID < t.Nodes[j].ID
+	})
+	nodes := t.Nodes[:0]
+	for _, node := range t.Nodes {
+		if len(nodes) > 0 && node.ID == nodes[len(nodes)-1].ID {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	t.Nodes = nodes
+
+	sort.Slice(t.Edges, func(i, j int) bool {
+		if t.Edges[i].From != t.Edges[j].From {
+			return t.Edges[i].From < t.Edges[j].From
+		}
+		return t.Edges[i].To < t.Edges[j].To
+	})
+	edges := t.Edges[:0]
+	for _, edge := range t.Edges {
+		if len(edges) > 0 && edge == edges[len(edges)-1] {
+			continue
+		}
+		edges = append(edges, edge)
+	}
+	t.Edges = edges
+}
+
+// convertTopology converts a topology to its protobuf, nil topologies to nil.
+func convertTopology(t *Topology) *proto.Topology {
+	if t == nil {
+		return nil
+	}
+	converted := &proto.Topology{
+		Nodes: make([]*proto.Topology_Node, 0, len(t.Nodes)),
+		Edges: make([]*proto.Topology_Edge, 0, len(t.Edges)),
+	}
+	for _, node := range t.Nodes {
+		converted.Nodes = append(converted.Nodes, &proto.Topology_Node{
+			Id:   node.ID,
+			Kind: string(node.Kind),
+			Type: node.Type,
+			Name: node.Name,
+			Icon: node.Icon,
+		})
+	}
+	for _, edge := range t.Edges {
+		converted.Edges = append(converted.Edges, &proto.Topology_Edge{
+			From: edge.From,
+			To:   edge.To,
+		})
+	}
+	return converted
+}
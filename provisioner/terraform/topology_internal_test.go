@@ -0,0 +1,41 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestConvertTopology(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, convertTopology(nil))
+
+	topology := &Topology{}
+	topology.addResource("docker_container.dev", &proto.Resource{
+		Type: "docker_container",
+		Name: "dev",
+		Icon: "/icon/docker.svg",
+		Agents: []*proto.Agent{{
+			Name: "main",
+			Apps: []*proto.App{{
+				Slug:        "code-server",
+				DisplayName: "VS Code",
+			}},
+		}},
+	})
+	topology.normalize()
+
+	complete := planComplete(&State{Topology: topology})
+	require.Equal(t, []*proto.Topology_Node{
+		{Id: "agent:main", Kind: "agent", Name: "main"},
+		{Id: "app:main/code-server", Kind: "app", Name: "VS Code"},
+		{Id: "resource:docker_container.dev", Kind: "resource", Type: "docker_container", Name: "dev", Icon: "/icon/docker.svg"},
+	}, complete.GetTopology().GetNodes())
+	require.Equal(t, []*proto.Topology_Edge{
+		{From: "agent:main", To: "app:main/code-server"},
+		{From: "resource:docker_container.dev", To: "agent:main"},
+	}, complete.GetTopology().GetEdges())
+}
@@ -0,0 +1,67 @@
+package terraform
+
+import (
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/coder/coder/v2/coderd/util/slice"
+)
+
+// unknownIgnoredAttributes are the attributes of resources that are unknown
+// in every plan and aren't shown to users.
+var unknownIgnoredAttributes = map[string][]string{
+	"coder_agent": {"id", "token", "init_script"},
+	"coder_app":   {"id", "agent_id"},
+}
+
+// unknownAttributes returns the names of the attributes only known after
+// apply, by the address of the resource. Attributes with unknown nested
+// values, e.g. some variables of a map, are unknown as a whole.
+func unknownAttributes(changes []*tfjson.ResourceChange) map[string][]string {
+	unknown := map[string][]string{}
+	for _, change := range changes {
+		if change.Change == nil {
+			continue
+		}
+		values, ok := change.Change.AfterUnknown.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var names []string
+		for name, value := range values {
+			if slice.Contains(unknownIgnoredAttributes[change.Type], name) || !containsUnknown(value) {
+				continue
+			}
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		unknown[change.Address] = names
+	}
+	return unknown
+}
+
+// containsUnknown reports whether the value of after_unknown marks a value
+// or any nested value as unknown.
+func containsUnknown(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case map[string]interface{}:
+		for _, nested := range v {
+			if containsUnknown(nested) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, nested := range v {
+			if containsUnknown(nested) {
+				return true
+			}
+		}
+	}
+	return false
+}
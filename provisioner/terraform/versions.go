@@ -0,0 +1,169 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hc-install/product"
+	"github.com/hashicorp/hc-install/releases"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// managedVersionsDir is the directory in the cache path that stores the
+// Terraform binaries installed for templates requiring a version the default
+// binary doesn't satisfy. Each version is installed in its own directory.
+const managedVersionsDir = "terraform-versions"
+
+// requiredTerraformVersion returns the constraints declared with
+// `required_version` in the module. Nil is returned if the module doesn't
+// constrain the Terraform version.
+func requiredTerraformVersion(workdir string) (version.Constraints, error) {
+	module, diags := tfconfig.LoadModule(workdir)
+	if diags.HasErrors() {
+		return nil, xerrors.Errorf("load module: %s", formatDiagnostics(workdir, diags))
+	}
+	if len(module.RequiredCore) == 0 {
+		return nil, nil
+	}
+	constraints, err := version.NewConstraint(strings.Join(module.RequiredCore, ","))
+	if err != nil {
+		return nil, xerrors.Errorf("parse required_version %q: %w", module.RequiredCore, err)
+	}
+	return constraints, nil
+}
+
+// managedVersionPath returns the path a managed Terraform version is
+// installed to.
+func managedVersionPath(cachePath string, v *version.Version) string {
+	return filepath.Join(cachePath, managedVersionsDir, v.String(), product.Terraform.BinaryName())
+}
+
+// supportedTerraformVersion returns whether Coder supports a Terraform
+// version, which is the case for versions from minTerraformVersion up to,
+// but excluding, maxTerraformVersion.
+func supportedTerraformVersion(v *version.Version) bool {
+	return v.GreaterThanOrEqual(minTerraformVersion) && v.LessThan(maxTerraformVersion)
+}
+
+// selectTerraformVersion picks the version to install for the constraints.
+// The version bundled with Coder is preferred, followed by an already
+// installed managed version, and finally the newest release satisfying the
+// constraints. Only supported versions are selected, templates can't require
+// a newer version than Coder supports.
+func selectTerraformVersion(ctx context.Context, cachePath string, constraints version.Constraints) (*version.Version, error) {
+	if constraints.Check(TerraformVersion) {
+		return TerraformVersion, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(cachePath, managedVersionsDir))
+	if err != nil && !xerrors.Is(err, os.ErrNotExist) {
+		return nil, xerrors.Errorf("read managed versions: %w", err)
+	}
+	var installed *version.Version
+	for _, entry := range entries {
+		v, err := version.NewVersion(entry.Name())
+		if err != nil || !constraints.Check(v) || !supportedTerraformVersion(v) {
+			continue
+		}
+		if _, err := os.Stat(managedVersionPath(cachePath, v)); err != nil {
+			continue
+		}
+		if installed == nil || v.GreaterThan(installed) {
+			installed = v
+		}
+	}
+	if installed != nil {
+		return installed, nil
+	}
+
+	available, err := (&releases.Versions{
+		Product:     product.Terraform,
+		Constraints: constraints,
+	}).List(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("list terraform releases: %w", err)
+	}
+	// Releases are sorted in ascending order.
+	for i := len(available) - 1; i >= 0; i-- {
+		ev, ok := available[i].(*releases.ExactVersion)
+		if !ok || !supportedTerraformVersion(ev.Version) {
+			continue
+		}
+		return ev.Version, nil
+	}
+	return nil, xerrors.Errorf("no supported terraform release (>= %s, < %s) satisfies %q",
+		minTerraformVersion.String(), maxTerraformVersion.String(), constraints.String())
+}
+
+// binaryPathForModule returns the Terraform binary to use for the module in
+// workdir. The default binary is used unless the module requires a version it
+// doesn't satisfy, in which case a matching version is installed in the cache
+// directory. Downloads are verified against the checksums signed by
+// HashiCorp.
+func (s *server) binaryPathForModule(ctx context.Context, workdir string, logr logSink) (string, error) {
+	if s.disableManagedVersions || s.cachePath == "" {
+		return s.binaryPath, nil
+	}
+	constraints, err := requiredTerraformVersion(workdir)
+	if err != nil {
+		// Terraform reports invalid configuration with better
+		// diagnostics during init.
+		s.logger.Debug(ctx, "unable to determine required terraform version", slog.Error(err))
+		return s.binaryPath, nil
+	}
+	if constraints == nil {
+		return s.binaryPath, nil
+	}
+
+	current, err := s.binaryVersion(ctx, s.binaryPath)
+	if err != nil {
+		return "", xerrors.Errorf("get terraform version: %w", err)
+	}
+	if constraints.Check(current) {
+		return s.binaryPath, nil
+	}
+
+	s.versionMut.Lock()
+	defer s.versionMut.Unlock()
+
+	want, err := selectTerraformVersion(ctx, s.cachePath, constraints)
+	if err != nil {
+		return "", err
+	}
+	logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf(
+		"Template requires Terraform %s, using Terraform %s instead of %s", constraints.String(), want.String(), current.String()))
+
+	binPath := managedVersionPath(s.cachePath, want)
+	s.logger.Info(ctx, "selected managed terraform version",
+		slog.F("required_version", constraints.String()),
+		slog.F("version", want.String()),
+		slog.F("binary_path", binPath))
+	return Install(ctx, s.logger, filepath.Dir(binPath), want)
+}
+
+// binaryVersion returns the version of a Terraform binary. Versions are
+// cached since the binaries don't change while the server runs.
+func (s *server) binaryVersion(ctx context.Context, binaryPath string) (*version.Version, error) {
+	s.versionMut.Lock()
+	v, ok := s.binaryVersions[binaryPath]
+	s.versionMut.Unlock()
+	if ok {
+		return v, nil
+	}
+	v, err := versionFromBinaryPath(ctx, binaryPath)
+	if err != nil {
+		return nil, err
+	}
+	s.versionMut.Lock()
+	s.binaryVersions[binaryPath] = v
+	s.versionMut.Unlock()
+	return v, nil
+}
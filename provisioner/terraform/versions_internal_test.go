@@ -0,0 +1,97 @@
+package terraform
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredTerraformVersion(t *testing.T) {
+	t.Parallel()
+
+	t.Run("None", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`resource "null_resource" "a" {}`), 0o600))
+		constraints, err := requiredTerraformVersion(dir)
+		require.NoError(t, err)
+		require.Nil(t, constraints)
+	})
+
+	t.Run("Constrained", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`
+terraform {
+	required_version = ">= 1.3.0, < 1.5.0"
+}
+`), 0o600))
+		constraints, err := requiredTerraformVersion(dir)
+		require.NoError(t, err)
+		require.True(t, constraints.Check(version.Must(version.NewVersion("1.4.6"))))
+		require.False(t, constraints.Check(version.Must(version.NewVersion("1.5.0"))))
+	})
+}
+
+func TestSelectTerraformVersion(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Default", func(t *testing.T) {
+		t.Parallel()
+		constraints := version.MustConstraints(version.NewConstraint(">= 1.1.0"))
+		v, err := selectTerraformVersion(context.Background(), t.TempDir(), constraints)
+		require.NoError(t, err)
+		require.Equal(t, TerraformVersion, v)
+	})
+
+	t.Run("Installed", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		for _, raw := range []string{"1.3.9", "1.4.6", "1.5.7"} {
+			binPath := managedVersionPath(dir, version.Must(version.NewVersion(raw)))
+			require.NoError(t, os.MkdirAll(filepath.Dir(binPath), 0o750))
+			require.NoError(t, os.WriteFile(binPath, []byte{}, 0o600))
+		}
+		constraints := version.MustConstraints(version.NewConstraint("< 1.5.0"))
+		v, err := selectTerraformVersion(context.Background(), dir, constraints)
+		require.NoError(t, err)
+		require.Equal(t, "1.4.6", v.String())
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		for _, raw := range []string{"1.0.11", "1.6.9", "1.7.5"} {
+			binPath := managedVersionPath(dir, version.Must(version.NewVersion(raw)))
+			require.NoError(t, os.MkdirAll(filepath.Dir(binPath), 0o750))
+			require.NoError(t, os.WriteFile(binPath, []byte{}, 0o600))
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		// Releases aren't listed, versions are only selected from the
+		// installed ones.
+		cancel()
+		for _, raw := range []string{"< 1.1.0", ">= 1.6.9"} {
+			constraints := version.MustConstraints(version.NewConstraint(raw))
+			_, err := selectTerraformVersion(ctx, dir, constraints)
+			require.Error(t, err, raw)
+		}
+	})
+}
+
+func TestSupportedTerraformVersion(t *testing.T) {
+	t.Parallel()
+
+	for raw, supported := range map[string]bool{
+		"1.0.11": false,
+		"1.1.0":  true,
+		"1.6.6":  true,
+		"1.6.9":  false,
+		"1.7.0":  false,
+	} {
+		require.Equal(t, supported, supportedTerraformVersion(version.Must(version.NewVersion(raw))), raw)
+	}
+}
@@ -0,0 +1,124 @@
+package terraform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"cdr.dev/slog"
+)
+
+// hangKillDelay is how long a hung command is given to write its stack
+// traces before it's killed.
+const hangKillDelay = 10 * time.Second
+
+// HungCommandError is returned when a Terraform command was killed because
+// it didn't write any output for the hang timeout.
+type HungCommandError struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (e *HungCommandError) Error() string {
+	return fmt.Sprintf("terraform %s made no progress for %s and was killed; this is usually caused by a provider "+
+		"waiting on an unreachable API or a resource that never becomes ready. The stack traces of Terraform, if "+
+		"any, are in the logs above", e.Command, e.Timeout)
+}
+
+// watchdog kills commands that don't write any output for a timeout. Every
+// event of the JSON log stream of Terraform counts as progress, and
+// Terraform reports the progress of long operations every few seconds.
+type watchdog struct {
+	timeout  time.Duration
+	progress chan struct{}
+	hung     atomic.Bool
+}
+
+func newWatchdog(timeout time.Duration) *watchdog {
+	return &watchdog{
+		timeout:  timeout,
+		progress: make(chan struct{}, 1),
+	}
+}
+
+// writer returns a writer that reports progress on every write to w.
+func (w *watchdog) writer(wr io.Writer) io.Writer {
+	return progressWriter{w: wr, progress: w.progress}
+}
+
+// watch kills cmd when no progress is reported for the timeout, see
+// killHungCommand. cmd must be started with setProcessGroup. The returned
+// function must be called once the command exited.
+func (w *watchdog) watch(ctx context.Context, logger slog.Logger, cmd *exec.Cmd) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		timer := time.NewTimer(w.timeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				// Canceled commands are interrupted and killed by the
+				// provisioner.
+				return
+			case <-w.progress:
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(w.timeout)
+			case <-timer.C:
+				w.hung.Store(true)
+				logger.Warn(ctx, "terraform made no progress, killing command",
+					slog.F("args", cmd.Args), slog.F("timeout", w.timeout))
+				killHungCommand(ctx, logger, cmd, done)
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// killHungCommand kills the process group of cmd, which includes the
+// providers started by Terraform. Where supported, the group is sent
+// SIGQUIT first and given hangKillDelay to write its stack traces, unless
+// done is closed because cmd exited in the meantime. The group is killed
+// either way, so providers that outlived Terraform don't keep the output
+// of cmd open.
+func killHungCommand(ctx context.Context, logger slog.Logger, cmd *exec.Cmd, done <-chan struct{}) {
+	err := quitProcessGroup(cmd)
+	if err != nil {
+		logger.Debug(ctx, "failed to send SIGQUIT", slog.Error(err))
+	} else {
+		select {
+		case <-done:
+		case <-time.After(hangKillDelay):
+		}
+	}
+	err = killProcessGroup(cmd)
+	if errors.Is(err, os.ErrProcessDone) {
+		err = nil
+	}
+	logger.Debug(ctx, "killed hung command", slog.F("args", cmd.Args), slog.Error(err))
+}
+
+type progressWriter struct {
+	w        io.Writer
+	progress chan<- struct{}
+}
+
+func (pw progressWriter) Write(p []byte) (int, error) {
+	select {
+	case pw.progress <- struct{}{}:
+	default:
+	}
+	return pw.w.Write(p)
+}
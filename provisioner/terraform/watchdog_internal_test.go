@@ -0,0 +1,51 @@
+package terraform
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/coder/v2/testutil"
+)
+
+func TestKillHungCommand(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("This test uses a shell script and is not supported on Windows")
+	}
+
+	// The shell stands in for Terraform, which waits for its provider to
+	// exit. The provider is a stage of a pipeline, since asynchronous
+	// commands ignore SIGQUIT.
+	quit := filepath.Join(t.TempDir(), "quit")
+	provider := `trap 'touch "$1"; exit 0' QUIT; touch "$1.ready"; while :; do sleep 0.1; done`
+	cmd := exec.Command("sh", "-c", `trap : QUIT; sh -c "$1" sh "$2" | cat`, "sh", provider, quit)
+	setProcessGroup(cmd)
+	require.NoError(t, cmd.Start())
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(quit + ".ready")
+		return err == nil
+	}, testutil.WaitShort, testutil.IntervalFast)
+
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+	killed := make(chan struct{})
+	go func() {
+		killHungCommand(context.Background(), slogtest.Make(t, nil), cmd, done)
+		close(killed)
+	}()
+
+	ctx := testutil.Context(t, testutil.WaitShort)
+	testutil.RequireRecvCtx(ctx, t, killed)
+	testutil.RequireRecvCtx(ctx, t, done)
+	require.FileExists(t, quit)
+}
@@ -0,0 +1,556 @@
+package terraform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// terraformWorkspacesLocal is the local value templates split their
+// resources into Terraform workspaces with, e.g.
+//
+//	locals {
+//	  coder_terraform_workspaces = ["network", "compute"]
+//	}
+//
+// Every workspace has a state of its own, so layered templates don't keep
+// all resources in one large state. The configuration is shared, resources
+// select their workspace with terraform.workspace, e.g.
+// `count = terraform.workspace == "network" ? 1 : 0`. Later workspaces read
+// the outputs of earlier ones with a terraform_remote_state data source of
+// the local backend, whose defaults are used before the earlier workspace
+// was applied for the first time.
+//
+// Workspaces are planned and applied in order, and destroyed in reverse
+// order. Workspaces after the first are planned again right before they're
+// applied, so they read the outputs of the workspaces applied before them,
+// and the build fails if that plans other changes than the ones shown for
+// the build. The resources of all workspaces are merged into the resources
+// of the build.
+//
+// The resources of builds from before the template declared workspaces are
+// moved into the workspaces planning to create them, and the resources of
+// all workspaces are moved back into the default workspace once the
+// template no longer declares any.
+//
+// It's read from the source, so it must be a literal list of strings.
+const terraformWorkspacesLocal = "coder_terraform_workspaces"
+
+// terraformWorkspaceNameRegex matches the names of Terraform workspaces,
+// which are used in file names.
+var terraformWorkspaceNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// parseTerraformWorkspaces returns the Terraform workspaces declared by the
+// root module in dir, or nil if the template doesn't use workspaces.
+func parseTerraformWorkspaces(dir string) ([]string, error) {
+	attr, err := findLocal(dir, terraformWorkspacesLocal)
+	if err != nil {
+		return nil, err
+	}
+	if attr == nil {
+		return nil, nil
+	}
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return nil, xerrors.Errorf("local %q must only contain literal values: %w", terraformWorkspacesLocal, diags)
+	}
+	if value.IsNull() {
+		return nil, nil
+	}
+	if !value.Type().IsTupleType() && !value.Type().IsListType() {
+		return nil, xerrors.Errorf("local %q must be a list of strings (%s)", terraformWorkspacesLocal, attr.NameRange)
+	}
+
+	workspaces := make([]string, 0, value.LengthInt())
+	seen := map[string]struct{}{}
+	for it := value.ElementIterator(); it.Next(); {
+		_, element := it.Element()
+		if element.IsNull() || !element.Type().Equals(cty.String) {
+			return nil, xerrors.Errorf("local %q must be a list of strings (%s)", terraformWorkspacesLocal, attr.NameRange)
+		}
+		name := element.AsString()
+		if !terraformWorkspaceNameRegex.MatchString(name) || name == "default" {
+			return nil, xerrors.Errorf("invalid Terraform workspace %q in local %q, names must only contain letters, digits, "+
+				"underscores and dashes and must not be \"default\"", name, terraformWorkspacesLocal)
+		}
+		if _, ok := seen[name]; ok {
+			return nil, xerrors.Errorf("Terraform workspace %q is declared more than once in local %q", name, terraformWorkspacesLocal)
+		}
+		seen[name] = struct{}{}
+		workspaces = append(workspaces, name)
+	}
+	return workspaces, nil
+}
+
+// workspaceOrder returns the workspaces in the order they're planned and
+// applied. Later workspaces depend on earlier ones, so they're destroyed
+// first.
+func workspaceOrder(workspaces []string, destroy bool) []string {
+	if !destroy {
+		return workspaces
+	}
+	reversed := make([]string, 0, len(workspaces))
+	for i := len(workspaces) - 1; i >= 0; i-- {
+		reversed = append(reversed, workspaces[i])
+	}
+	return reversed
+}
+
+// workspaceStates is the state of a build of a template with Terraform
+// workspaces, which bundles the states of the workspaces by their name.
+type workspaceStates struct {
+	Workspaces map[string]json.RawMessage `json:"coder_terraform_workspaces"`
+}
+
+// workspaceStateFilePath returns the path the local backend stores the
+// state of the workspace at.
+func workspaceStateFilePath(workdir, workspace string) string {
+	return filepath.Join(workdir, "terraform.tfstate.d", workspace, "terraform.tfstate")
+}
+
+// bundledWorkspaces returns the Terraform workspaces bundled in the state
+// of a build, and whether it's a bundle at all.
+func bundledWorkspaces(state []byte) ([]string, bool) {
+	var states workspaceStates
+	if len(state) == 0 || json.Unmarshal(state, &states) != nil || states.Workspaces == nil {
+		return nil, false
+	}
+	workspaces := make([]string, 0, len(states.Workspaces))
+	for name := range states.Workspaces {
+		workspaces = append(workspaces, name)
+	}
+	sort.Strings(workspaces)
+	return workspaces, true
+}
+
+// monolithicStateFilePath returns the path the state of a build from before
+// the template declared Terraform workspaces is written to, until its
+// resources are moved into the workspaces, see migrateMonolithicState.
+func monolithicStateFilePath(workdir string) string {
+	return filepath.Join(workdir, "terraform.tfstate.monolithic")
+}
+
+// writeWorkspaceStates writes the states of the workspaces bundled in the
+// state of the build. The state of a build from before the template
+// declared Terraform workspaces is written to monolithicStateFilePath, and
+// monolithic is true.
+func writeWorkspaceStates(workdir string, workspaces []string, state []byte) (monolithic bool, err error) {
+	var states workspaceStates
+	if len(state) > 0 {
+		err := json.Unmarshal(state, &states)
+		if err != nil {
+			return false, xerrors.Errorf("unmarshal state: %w", err)
+		}
+		if states.Workspaces == nil {
+			err = os.WriteFile(monolithicStateFilePath(workdir), state, 0o600)
+			if err != nil {
+				return false, xerrors.Errorf("write state: %w", err)
+			}
+			monolithic = true
+		}
+	}
+	declared := map[string]struct{}{}
+	for _, name := range workspaces {
+		declared[name] = struct{}{}
+	}
+	for name := range states.Workspaces {
+		// The resources of the workspace would be orphaned.
+		if _, ok := declared[name]; !ok {
+			return false, xerrors.Errorf("the state has resources in Terraform workspace %q, which the template no longer declares", name)
+		}
+	}
+
+	for _, name := range workspaces {
+		path := workspaceStateFilePath(workdir, name)
+		// The local backend only selects workspaces that exist, which are
+		// the directories of their state.
+		err := os.MkdirAll(filepath.Dir(path), 0o700)
+		if err != nil {
+			return false, xerrors.Errorf("create directory of Terraform workspace %q: %w", name, err)
+		}
+		data, ok := states.Workspaces[name]
+		if !ok {
+			continue
+		}
+		err = os.WriteFile(path, data, 0o600)
+		if err != nil {
+			return false, xerrors.Errorf("write state of Terraform workspace %q: %w", name, err)
+		}
+	}
+	return monolithic, nil
+}
+
+// readWorkspaceStates bundles the states of the workspaces into the state
+// of the build. Workspaces that were never applied have no state.
+func readWorkspaceStates(workdir string, workspaces []string) ([]byte, error) {
+	states := workspaceStates{Workspaces: map[string]json.RawMessage{}}
+	for _, name := range workspaces {
+		data, err := os.ReadFile(workspaceStateFilePath(workdir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("read state of Terraform workspace %q: %w", name, err)
+		}
+		states.Workspaces[name] = data
+	}
+	data, err := json.Marshal(states)
+	if err != nil {
+		return nil, xerrors.Errorf("marshal state: %w", err)
+	}
+	return data, nil
+}
+
+// forWorkspace returns an executor running commands in the Terraform
+// workspace. It shares the lock of e.
+func (e *executor) forWorkspace(workspace string) *executor {
+	clone := *e
+	clone.workspace = workspace
+	return &clone
+}
+
+// planWorkspaces plans every Terraform workspace and merges their
+// resources.
+// revive:disable-next-line:flag-parameter
+func (e *executor) planWorkspaces(ctx, killCtx context.Context, workspaces, env, vars []string, logr logSink, destroy bool) (*proto.PlanComplete, error) {
+	merged := &proto.PlanComplete{}
+	for _, name := range workspaceOrder(workspaces, destroy) {
+		logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf("Planning Terraform workspace %q", name))
+		resp, err := e.forWorkspace(name).plan(ctx, killCtx, env, vars, nil, logr, destroy)
+		if err != nil {
+			return nil, xerrors.Errorf("terraform workspace %q: %w", name, err)
+		}
+		merged.Resources = append(merged.Resources, resp.Resources...)
+		merged.Parameters = mergeParameters(merged.Parameters, resp.Parameters)
+		merged.ExternalAuthProviders = mergeExternalAuthProviders(merged.ExternalAuthProviders, resp.ExternalAuthProviders)
+		if merged.Network == nil {
+			merged.Network = resp.Network
+		}
+		merged.Topology = mergeTopologies(merged.Topology, resp.Topology)
+	}
+	return merged, nil
+}
+
+// applyWorkspaces applies the plan of every Terraform workspace in order
+// and merges their resources. The state of the build bundles the states of
+// the workspaces.
+// revive:disable-next-line:flag-parameter
+func (e *executor) applyWorkspaces(
+	ctx, killCtx context.Context,
+	workspaces, env []string,
+	logr logSink,
+	reportStage func(stage provisionersdk.BuildStage),
+	destroy bool,
+) (*proto.ApplyComplete, error) {
+	merged := &proto.ApplyComplete{}
+	for i, name := range workspaceOrder(workspaces, destroy) {
+		workspace := e.forWorkspace(name)
+		if i > 0 {
+			err := workspace.replan(ctx, killCtx, logr)
+			if err != nil {
+				return nil, xerrors.Errorf("terraform workspace %q: %w", name, err)
+			}
+		}
+		logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf("Applying Terraform workspace %q", name))
+		resp, err := workspace.apply(ctx, killCtx, env, logr, reportStage)
+		if err != nil {
+			return nil, xerrors.Errorf("terraform workspace %q: %w", name, err)
+		}
+		merged.Resources = append(merged.Resources, resp.Resources...)
+		merged.Parameters = mergeParameters(merged.Parameters, resp.Parameters)
+		merged.ExternalAuthProviders = mergeExternalAuthProviders(merged.ExternalAuthProviders, resp.ExternalAuthProviders)
+		merged.WorkspaceMetadata = append(merged.WorkspaceMetadata, resp.WorkspaceMetadata...)
+		if merged.Network == nil {
+			merged.Network = resp.Network
+		}
+		if merged.CapacityFallback == nil {
+			merged.CapacityFallback = resp.CapacityFallback
+		}
+		merged.Topology = mergeTopologies(merged.Topology, resp.Topology)
+	}
+	state, err := readWorkspaceStates(e.workdir, workspaces)
+	if err != nil {
+		return nil, err
+	}
+	merged.State = state
+	return merged, nil
+}
+
+// replan plans the workspace again with the command of the build's plan,
+// since the workspaces applied before may have changed the outputs it
+// reads.
+func (e *executor) replan(ctx, killCtx context.Context, logr logSink) error {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	plan := e.server.retryPlans.load(e.workdir, e.workspace)
+	if plan == nil {
+		return xerrors.New("the plan of the workspace wasn't kept")
+	}
+	logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf(
+		"Planning Terraform workspace %q again with the outputs of the workspaces applied before it", e.workspace))
+	changes, err := e.planAgain(ctx, killCtx, plan, logr)
+	if err != nil {
+		return err
+	}
+	// The resources of the build were checked and shown with the first
+	// plan, so a plan changing other resources must not be applied.
+	if diff := diffChanges(plan.changes, changes); len(diff) > 0 {
+		return xerrors.Errorf("the outputs of the workspaces applied before it changed the plan of the workspace (%s), "+
+			"start the build again to plan it with them", strings.Join(diff, ", "))
+	}
+	return nil
+}
+
+// plannedChanges returns the actions planned for the managed resources, by
+// address. Resources without changes are omitted.
+func plannedChanges(resourceChanges []*tfjson.ResourceChange) map[string]string {
+	changes := map[string]string{}
+	for _, change := range resourceChanges {
+		if change.Mode != tfjson.ManagedResourceMode || change.Change == nil || change.Change.Actions.NoOp() {
+			continue
+		}
+		actions := make([]string, 0, len(change.Change.Actions))
+		for _, action := range change.Change.Actions {
+			actions = append(actions, string(action))
+		}
+		changes[change.Address] = strings.Join(actions, "-")
+	}
+	return changes
+}
+
+// diffChanges describes how the actions planned for resources differ, in
+// the order of their addresses.
+func diffChanges(planned, replanned map[string]string) []string {
+	addresses := make([]string, 0, len(planned)+len(replanned))
+	for address := range planned {
+		addresses = append(addresses, address)
+	}
+	for address := range replanned {
+		if _, ok := planned[address]; !ok {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	var diff []string
+	for _, address := range addresses {
+		before, after := planned[address], replanned[address]
+		if before == after {
+			continue
+		}
+		if before == "" {
+			before = "no-op"
+		}
+		if after == "" {
+			after = "no-op"
+		}
+		diff = append(diff, fmt.Sprintf("%s: %s instead of %s", address, after, before))
+	}
+	return diff
+}
+
+// migrateMonolithicState moves every resource of the state of a build from
+// before the template declared Terraform workspaces into the workspace
+// planning to create it. The build fails if resources aren't declared by any
+// workspace, rather than deleting them. It must be called after the state
+// was written by writeWorkspaceStates.
+func (e *executor) migrateMonolithicState(ctx, killCtx context.Context, workspaces, env, vars []string, logr logSink) error {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	statePath := monolithicStateFilePath(e.workdir)
+	remaining, err := e.stateAddresses(ctx, killCtx, statePath)
+	if err != nil {
+		return err
+	}
+	for _, name := range workspaces {
+		if len(remaining) == 0 {
+			break
+		}
+		logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf(
+			"Moving the resources of the state into Terraform workspace %q, which the template declares since the last build", name))
+		workspace := e.forWorkspace(name)
+		declared, err := workspace.declaredAddresses(ctx, killCtx, env, vars, logr)
+		if err != nil {
+			return xerrors.Errorf("terraform workspace %q: %w", name, err)
+		}
+		unmoved := remaining[:0]
+		for _, address := range remaining {
+			if _, ok := declared[address]; !ok {
+				unmoved = append(unmoved, address)
+				continue
+			}
+			err := e.moveState(ctx, killCtx, statePath, workspaceStateFilePath(e.workdir, name), address, logr)
+			if err != nil {
+				return err
+			}
+		}
+		remaining = unmoved
+	}
+	if len(remaining) > 0 {
+		return xerrors.Errorf("no Terraform workspace declares the resources %s of the state, "+
+			"declare them in one of the workspaces or remove them from the state", strings.Join(remaining, ", "))
+	}
+	return os.Remove(statePath)
+}
+
+// unbundleWorkspaceStates moves the resources of the Terraform workspaces
+// bundled in the state of the build into the default workspace, once the
+// template no longer declares workspaces. It must be called after the
+// states were written by writeWorkspaceStates.
+func (e *executor) unbundleWorkspaceStates(ctx, killCtx context.Context, workspaces []string, logr logSink) error {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	for _, name := range workspaces {
+		statePath := workspaceStateFilePath(e.workdir, name)
+		if _, err := os.Stat(statePath); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		logr.ProvisionLog(proto.LogLevel_INFO, fmt.Sprintf(
+			"Moving the resources of Terraform workspace %q into the default workspace, since the template no longer declares workspaces", name))
+		addresses, err := e.stateAddresses(ctx, killCtx, statePath)
+		if err != nil {
+			return xerrors.Errorf("terraform workspace %q: %w", name, err)
+		}
+		for _, address := range addresses {
+			err := e.moveState(ctx, killCtx, statePath, getStateFilePath(e.workdir), address, logr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return os.RemoveAll(filepath.Join(e.workdir, "terraform.tfstate.d"))
+}
+
+// declaredAddresses returns the addresses of the managed resources the
+// workspace plans to create without a state. It must only be called while
+// the lock is held.
+func (e *executor) declaredAddresses(ctx, killCtx context.Context, env, vars []string, logr logSink) (map[string]struct{}, error) {
+	planPath := filepath.Join(e.workdir, "terraform."+e.workspace+".migrate.tfplan")
+	defer os.Remove(planPath)
+	args := []string{"plan", "-no-color", "-input=false", "-json", "-refresh=false", "-lock=false", "-out=" + planPath}
+	for _, variable := range vars {
+		args = append(args, "-var", variable)
+	}
+	for _, varFile := range e.varFiles {
+		args = append(args, "-var-file="+varFile)
+	}
+	err := e.execLogOutput(ctx, killCtx, args, env, logr)
+	if err != nil {
+		return nil, xerrors.Errorf("terraform plan: %w", err)
+	}
+	plan, err := e.showPlan(ctx, killCtx, planPath)
+	if err != nil {
+		return nil, xerrors.Errorf("show terraform plan file: %w", err)
+	}
+	declared := map[string]struct{}{}
+	for _, change := range plan.ResourceChanges {
+		if change.Mode == tfjson.ManagedResourceMode && change.Change != nil && change.Change.Actions.Create() {
+			declared[change.Address] = struct{}{}
+		}
+	}
+	return declared, nil
+}
+
+// stateAddresses returns the addresses of the managed resources in the state
+// file. Data sources are read again by every plan, so they aren't moved. It
+// must only be called while the lock is held.
+func (e *executor) stateAddresses(ctx, killCtx context.Context, statePath string) ([]string, error) {
+	state := &tfjson.State{}
+	err := e.execParseJSON(ctx, killCtx, []string{"show", "-json", "-no-color", statePath}, e.basicEnv(), state)
+	if err != nil {
+		return nil, xerrors.Errorf("terraform show state: %w", err)
+	}
+	var addresses []string
+	var walk func(module *tfjson.StateModule)
+	walk = func(module *tfjson.StateModule) {
+		if module == nil {
+			return
+		}
+		for _, resource := range module.Resources {
+			if resource.Mode == tfjson.ManagedResourceMode {
+				addresses = append(addresses, resource.Address)
+			}
+		}
+		for _, child := range module.ChildModules {
+			walk(child)
+		}
+	}
+	if state.Values != nil {
+		walk(state.Values.RootModule)
+	}
+	return addresses, nil
+}
+
+// moveState moves a resource from the state file at from to the one at to.
+// It must only be called while the lock is held.
+func (e *executor) moveState(ctx, killCtx context.Context, from, to, address string, logr logSink) error {
+	args := []string{"state", "mv", "-lock=false", "-state=" + from, "-state-out=" + to, address, address}
+	err := e.execLogOutput(ctx, killCtx, args, e.basicEnv(), logr)
+	if err != nil {
+		return xerrors.Errorf("move %s: %w", address, err)
+	}
+	return nil
+}
+
+// mergeParameters appends the parameters that aren't in merged yet. Every
+// workspace shares the configuration, so they read the same parameters.
+func mergeParameters(merged, parameters []*proto.RichParameter) []*proto.RichParameter {
+	seen := make(map[string]struct{}, len(merged))
+	for _, parameter := range merged {
+		seen[parameter.Name] = struct{}{}
+	}
+	for _, parameter := range parameters {
+		if _, ok := seen[parameter.Name]; ok {
+			continue
+		}
+		seen[parameter.Name] = struct{}{}
+		merged = append(merged, parameter)
+	}
+	return merged
+}
+
+// mergeExternalAuthProviders appends the providers that aren't in merged
+// yet.
+func mergeExternalAuthProviders(merged, providers []string) []string {
+	seen := make(map[string]struct{}, len(merged))
+	for _, provider := range merged {
+		seen[provider] = struct{}{}
+	}
+	for _, provider := range providers {
+		if _, ok := seen[provider]; ok {
+			continue
+		}
+		seen[provider] = struct{}{}
+		merged = append(merged, provider)
+	}
+	return merged
+}
+
+// mergeTopologies adds the nodes and edges of a workspace's topology to the
+// merged topology.
+func mergeTopologies(merged, topology *proto.Topology) *proto.Topology {
+	if topology == nil {
+		return merged
+	}
+	if merged == nil {
+		merged = &proto.Topology{}
+	}
+	merged.Nodes = append(merged.Nodes, topology.Nodes...)
+	merged.Edges = append(merged.Edges, topology.Edges...)
+	return merged
+}
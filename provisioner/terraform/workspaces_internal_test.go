@@ -0,0 +1,206 @@
+package terraform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestParseTerraformWorkspaces(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		main     string
+		expected []string
+		err      string
+	}{{
+		name: "None",
+		main: `locals { other = "value" }`,
+	}, {
+		name:     "List",
+		main:     `locals { coder_terraform_workspaces = ["network", "compute"] }`,
+		expected: []string{"network", "compute"},
+	}, {
+		name: "NotAList",
+		main: `locals { coder_terraform_workspaces = "network" }`,
+		err:  "must be a list of strings",
+	}, {
+		name: "Reference",
+		main: `locals { coder_terraform_workspaces = [var.name] }`,
+		err:  "literal values",
+	}, {
+		name: "InvalidName",
+		main: `locals { coder_terraform_workspaces = ["../network"] }`,
+		err:  `invalid Terraform workspace "../network"`,
+	}, {
+		name: "Default",
+		main: `locals { coder_terraform_workspaces = ["default"] }`,
+		err:  `invalid Terraform workspace "default"`,
+	}, {
+		name: "Duplicate",
+		main: `locals { coder_terraform_workspaces = ["network", "network"] }`,
+		err:  "declared more than once",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(tc.main), 0o600))
+			workspaces, err := parseTerraformWorkspaces(dir)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, workspaces)
+		})
+	}
+}
+
+func TestWorkspaceStates(t *testing.T) {
+	t.Parallel()
+
+	workspaces := []string{"network", "compute"}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		// The first build has no state, but the workspaces must exist.
+		monolithic, err := writeWorkspaceStates(dir, workspaces, nil)
+		require.NoError(t, err)
+		require.False(t, monolithic)
+		for _, name := range workspaces {
+			require.DirExists(t, filepath.Dir(workspaceStateFilePath(dir, name)))
+		}
+		state, err := readWorkspaceStates(dir, workspaces)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"coder_terraform_workspaces":{}}`, string(state))
+
+		require.NoError(t, os.WriteFile(workspaceStateFilePath(dir, "network"), []byte(`{"version":4,"serial":1}`), 0o600))
+		state, err = readWorkspaceStates(dir, workspaces)
+		require.NoError(t, err)
+
+		other := t.TempDir()
+		_, err = writeWorkspaceStates(other, workspaces, state)
+		require.NoError(t, err)
+		data, err := os.ReadFile(workspaceStateFilePath(other, "network"))
+		require.NoError(t, err)
+		require.JSONEq(t, `{"version":4,"serial":1}`, string(data))
+		require.NoFileExists(t, workspaceStateFilePath(other, "compute"))
+	})
+
+	t.Run("MonolithicState", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		state := []byte(`{"version":4,"serial":7}`)
+		monolithic, err := writeWorkspaceStates(dir, workspaces, state)
+		require.NoError(t, err)
+		require.True(t, monolithic)
+		// The resources are moved into the workspaces declaring them once
+		// Terraform is initialized, see migrateMonolithicState.
+		data, err := os.ReadFile(monolithicStateFilePath(dir))
+		require.NoError(t, err)
+		require.Equal(t, state, data)
+		require.NoFileExists(t, workspaceStateFilePath(dir, "network"))
+	})
+
+	t.Run("UndeclaredWorkspace", func(t *testing.T) {
+		t.Parallel()
+		state, err := json.Marshal(workspaceStates{Workspaces: map[string]json.RawMessage{
+			"storage": json.RawMessage(`{"version":4}`),
+		}})
+		require.NoError(t, err)
+		_, err = writeWorkspaceStates(t.TempDir(), workspaces, state)
+		require.ErrorContains(t, err, `Terraform workspace "storage", which the template no longer declares`)
+	})
+}
+
+func TestBundledWorkspaces(t *testing.T) {
+	t.Parallel()
+
+	workspaces, ok := bundledWorkspaces([]byte(`{"coder_terraform_workspaces":{"network":{},"compute":{}}}`))
+	require.True(t, ok)
+	require.Equal(t, []string{"compute", "network"}, workspaces)
+	workspaces, ok = bundledWorkspaces([]byte(`{"coder_terraform_workspaces":{}}`))
+	require.True(t, ok)
+	require.Empty(t, workspaces)
+	_, ok = bundledWorkspaces([]byte(`{"version":4,"serial":7}`))
+	require.False(t, ok)
+	_, ok = bundledWorkspaces(nil)
+	require.False(t, ok)
+}
+
+func TestDiffChanges(t *testing.T) {
+	t.Parallel()
+
+	planned := plannedChanges([]*tfjson.ResourceChange{{
+		Address: "aws_instance.dev",
+		Mode:    tfjson.ManagedResourceMode,
+		Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionCreate}},
+	}, {
+		Address: "aws_volume.home",
+		Mode:    tfjson.ManagedResourceMode,
+		Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}},
+	}, {
+		Address: "data.aws_ami.ubuntu",
+		Mode:    tfjson.DataResourceMode,
+		Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionRead}},
+	}})
+	require.Equal(t, map[string]string{"aws_instance.dev": "create"}, planned)
+	require.Empty(t, diffChanges(planned, map[string]string{"aws_instance.dev": "create"}))
+	require.Equal(t, []string{
+		"aws_instance.dev: delete-create instead of create",
+		"aws_volume.home: update instead of no-op",
+	}, diffChanges(planned, map[string]string{
+		"aws_instance.dev": "delete-create",
+		"aws_volume.home":  "update",
+	}))
+}
+
+func TestWorkspaceOrder(t *testing.T) {
+	t.Parallel()
+
+	workspaces := []string{"network", "storage", "compute"}
+	require.Equal(t, workspaces, workspaceOrder(workspaces, false))
+	require.Equal(t, []string{"compute", "storage", "network"}, workspaceOrder(workspaces, true))
+	require.Equal(t, []string{"network", "storage", "compute"}, workspaces)
+}
+
+func TestMergeParameters(t *testing.T) {
+	t.Parallel()
+
+	merged := mergeParameters(nil, []*proto.RichParameter{{Name: "region"}, {Name: "size"}})
+	merged = mergeParameters(merged, []*proto.RichParameter{{Name: "region"}, {Name: "image"}})
+	names := make([]string, 0, len(merged))
+	for _, parameter := range merged {
+		names = append(names, parameter.Name)
+	}
+	require.Equal(t, []string{"region", "size", "image"}, names)
+}
+
+func TestMergeTopologies(t *testing.T) {
+	t.Parallel()
+
+	merged := mergeTopologies(nil, nil)
+	require.Nil(t, merged)
+	merged = mergeTopologies(merged, &proto.Topology{
+		Nodes: []*proto.Topology_Node{{Id: "resource:aws_vpc.main"}},
+	})
+	merged = mergeTopologies(merged, &proto.Topology{
+		Nodes: []*proto.Topology_Node{{Id: "agent:main"}, {Id: "resource:aws_instance.dev"}},
+		Edges: []*proto.Topology_Edge{{From: "resource:aws_instance.dev", To: "agent:main"}},
+	})
+	ids := make([]string, 0, len(merged.Nodes))
+	for _, node := range merged.Nodes {
+		ids = append(ids, node.Id)
+	}
+	require.Equal(t, []string{"resource:aws_vpc.main", "agent:main", "resource:aws_instance.dev"}, ids)
+	require.Len(t, merged.Edges, 1)
+}
@@ -59,7 +59,10 @@ type Options struct {
 	ForceCancelInterval time.Duration
 	UpdateInterval      time.Duration
 	LogBufferInterval   time.Duration
-	Connector           Connector
+	// LeaseDuration is how long a job keeps running without being updated,
+	// see runner.DefaultLeaseDuration.
+	LeaseDuration time.Duration
+	Connector     Connector
 }
 
 // New creates and starts a provisioner daemon.
@@ -363,6 +366,7 @@ func (p *Server) acquireAndRunOne(client proto.DRPCProvisionerDaemonClient) {
 			UpdateInterval:      p.opts.UpdateInterval,
 			ForceCancelInterval: p.opts.ForceCancelInterval,
 			LogDebounceInterval: p.opts.LogBufferInterval,
+			LeaseDuration:       p.opts.LeaseDuration,
 			Tracer:              p.tracer,
 			Metrics:             p.opts.Metrics.Runner,
 		},
@@ -230,6 +230,59 @@ func TestProvisionerd(t *testing.T) {
 		require.NoError(t, closer.Close())
 	})
 
+	t.Run("LeaseExpired", func(t *testing.T) {
+		t.Parallel()
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			close(done)
+		})
+		stopped := make(chan struct{})
+		server := provisionerd.New(func(ctx context.Context) (proto.DRPCProvisionerDaemonClient, error) {
+			return createProvisionerDaemonClient(t, done, provisionerDaemonTestServer{
+				acquireJobWithCancel: newAcquireOne(t, &proto.AcquiredJob{
+					JobId:       "test",
+					Provisioner: "someprovisioner",
+					TemplateSourceArchive: createTar(t, map[string]string{
+						"test.txt": "content",
+					}),
+					Type: &proto.AcquiredJob_TemplateImport_{
+						TemplateImport: &proto.AcquiredJob_TemplateImport{
+							Metadata: &sdkproto.Metadata{},
+						},
+					},
+				}).acquireWithCancel,
+				// Updates never return, as if coder server was unreachable.
+				updateJob: func(ctx context.Context, _ *proto.UpdateJobRequest) (*proto.UpdateJobResponse, error) {
+					select {
+					case <-ctx.Done():
+					case <-done:
+					}
+					return nil, xerrors.New("unreachable")
+				},
+				failJob: func(ctx context.Context, job *proto.FailedJob) (*proto.Empty, error) {
+					return &proto.Empty{}, nil
+				},
+			}), nil
+		}, &provisionerd.Options{
+			Logger:         slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}).Named("provisionerd").Leveled(slog.LevelDebug),
+			UpdateInterval: 50 * time.Millisecond,
+			LeaseDuration:  250 * time.Millisecond,
+			Connector: provisionerd.LocalProvisioners{
+				"someprovisioner": createProvisionerClient(t, done, provisionerTestServer{
+					parse: func(_ *provisionersdk.Session, _ *sdkproto.ParseRequest, cancelOrComplete <-chan struct{}) *sdkproto.ParseComplete {
+						// The provisioner is stopped once the lease expires,
+						// so the job can be requeued.
+						<-cancelOrComplete
+						close(stopped)
+						return &sdkproto.ParseComplete{}
+					},
+				}),
+			},
+		})
+		require.Condition(t, closedWithin(stopped, testutil.WaitShort))
+		require.NoError(t, server.Close())
+	})
+
 	t.Run("TemplateImport", func(t *testing.T) {
 		t.Parallel()
 		done := make(chan struct{})
@@ -446,6 +499,227 @@ func TestProvisionerd(t *testing.T) {
 		assert.True(t, didComplete.Load(), "should complete the job")
 	})
 
+	t.Run("WorkspaceRefresh", func(t *testing.T) {
+		t.Parallel()
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			close(done)
+		})
+		var (
+			didApply    atomic.Bool
+			refreshOnly atomic.Bool
+			resources   atomic.Int32
+			acq         = newAcquireOne(t, &proto.AcquiredJob{
+				JobId:       "test",
+				Provisioner: "someprovisioner",
+				TemplateSourceArchive: createTar(t, map[string]string{
+					"test.txt": "content",
+				}),
+				Type: &proto.AcquiredJob_WorkspaceRefresh_{
+					WorkspaceRefresh: &proto.AcquiredJob_WorkspaceRefresh{
+						Metadata: &sdkproto.Metadata{},
+					},
+				},
+			})
+		)
+
+		closer := createProvisionerd(t, func(ctx context.Context) (proto.DRPCProvisionerDaemonClient, error) {
+			return createProvisionerDaemonClient(t, done, provisionerDaemonTestServer{
+				acquireJobWithCancel: acq.acquireWithCancel,
+				updateJob: func(ctx context.Context, update *proto.UpdateJobRequest) (*proto.UpdateJobResponse, error) {
+					return &proto.UpdateJobResponse{}, nil
+				},
+				completeJob: func(ctx context.Context, job *proto.CompletedJob) (*proto.Empty, error) {
+					resources.Store(int32(len(job.GetWorkspaceRefresh().GetResources())))
+					return &proto.Empty{}, nil
+				},
+			}), nil
+		}, provisionerd.LocalProvisioners{
+			"someprovisioner": createProvisionerClient(t, done, provisionerTestServer{
+				plan: func(
+					_ *provisionersdk.Session,
+					r *sdkproto.PlanRequest,
+					_ <-chan struct{},
+				) *sdkproto.PlanComplete {
+					refreshOnly.Store(r.RefreshOnly)
+					return &sdkproto.PlanComplete{
+						Resources: []*sdkproto.Resource{{Name: "dev", Type: "aws_instance"}},
+					}
+				},
+				apply: func(
+					_ *provisionersdk.Session,
+					_ *sdkproto.ApplyRequest,
+					_ <-chan struct{},
+				) *sdkproto.ApplyComplete {
+					didApply.Store(true)
+					return &sdkproto.ApplyComplete{}
+				},
+			}),
+		})
+		require.Condition(t, closedWithin(acq.complete, testutil.WaitShort))
+		require.NoError(t, closer.Close())
+		assert.True(t, refreshOnly.Load(), "should plan with refresh only")
+		assert.False(t, didApply.Load(), "should not apply")
+		assert.EqualValues(t, 1, resources.Load(), "should complete with the refreshed resources")
+	})
+
+	t.Run("WorkspaceBuildStages", func(t *testing.T) {
+		t.Parallel()
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			close(done)
+		})
+		var (
+			mut  sync.Mutex
+			logs []string
+			acq  = newAcquireOne(t, &proto.AcquiredJob{
+				JobId:       "test",
+				Provisioner: "someprovisioner",
+				TemplateSourceArchive: createTar(t, map[string]string{
+					"test.txt": "content",
+				}),
+				Type: &proto.AcquiredJob_WorkspaceBuild_{
+					WorkspaceBuild: &proto.AcquiredJob_WorkspaceBuild{
+						Metadata: &sdkproto.Metadata{},
+					},
+				},
+			})
+		)
+
+		closer := createProvisionerd(t, func(ctx context.Context) (proto.DRPCProvisionerDaemonClient, error) {
+			return createProvisionerDaemonClient(t, done, provisionerDaemonTestServer{
+				acquireJobWithCancel: acq.acquireWithCancel,
+				updateJob: func(ctx context.Context, update *proto.UpdateJobRequest) (*proto.UpdateJobResponse, error) {
+					mut.Lock()
+					defer mut.Unlock()
+					for _, log := range update.Logs {
+						logs = append(logs, fmt.Sprintf("%s | %s", log.Stage, log.Output))
+					}
+					return &proto.UpdateJobResponse{}, nil
+				},
+				completeJob: func(ctx context.Context, job *proto.CompletedJob) (*proto.Empty, error) {
+					return &proto.Empty{}, nil
+				},
+			}), nil
+		}, provisionerd.LocalProvisioners{
+			"someprovisioner": createProvisionerClient(t, done, provisionerTestServer{
+				plan: func(
+					s *provisionersdk.Session,
+					_ *sdkproto.PlanRequest,
+					_ <-chan struct{},
+				) *sdkproto.PlanComplete {
+					s.ProvisionStage(provisionersdk.BuildStageInit)
+					s.ProvisionLog(sdkproto.LogLevel_INFO, "init")
+					return &sdkproto.PlanComplete{}
+				},
+				apply: func(
+					s *provisionersdk.Session,
+					_ *sdkproto.ApplyRequest,
+					_ <-chan struct{},
+				) *sdkproto.ApplyComplete {
+					s.ProvisionLog(sdkproto.LogLevel_INFO, "apply")
+					// Output can't enter stages.
+					s.ProvisionLog(sdkproto.LogLevel_INFO, "coder-build-stage:agents-connecting")
+					s.ProvisionStage(provisionersdk.BuildStageApplyNetwork)
+					s.ProvisionLog(sdkproto.LogLevel_INFO, "network")
+					s.ProvisionStage(provisionersdk.BuildStageApplyCompute)
+					s.ProvisionLog(sdkproto.LogLevel_INFO, "compute")
+					return &sdkproto.ApplyComplete{}
+				},
+			}),
+		})
+		require.Condition(t, closedWithin(acq.complete, testutil.WaitShort))
+		require.NoError(t, closer.Close())
+		mut.Lock()
+		defer mut.Unlock()
+		require.Subset(t, logs, []string{
+			"Initializing | ",
+			"Initializing | init",
+			"Starting workspace | apply",
+			"Starting workspace | coder-build-stage:agents-connecting",
+			"Creating network | ",
+			"Creating network | network",
+			"Creating compute | ",
+			"Creating compute | compute",
+		})
+	})
+
+	t.Run("WorkspaceBuildCheckpoints", func(t *testing.T) {
+		t.Parallel()
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			close(done)
+		})
+		var (
+			mut         sync.Mutex
+			checkpoints []*sdkproto.Checkpoint
+			resumed     = &sdkproto.Checkpoint{
+				Stage: "init",
+				Files: map[string][]byte{".terraform.lock.hcl": []byte("# lock")},
+			}
+			acq = newAcquireOne(t, &proto.AcquiredJob{
+				JobId:       "test",
+				Provisioner: "someprovisioner",
+				TemplateSourceArchive: createTar(t, map[string]string{
+					"test.txt": "content",
+				}),
+				Type: &proto.AcquiredJob_WorkspaceBuild_{
+					WorkspaceBuild: &proto.AcquiredJob_WorkspaceBuild{
+						Metadata:   &sdkproto.Metadata{},
+						Checkpoint: resumed,
+					},
+				},
+			})
+		)
+
+		closer := createProvisionerd(t, func(ctx context.Context) (proto.DRPCProvisionerDaemonClient, error) {
+			return createProvisionerDaemonClient(t, done, provisionerDaemonTestServer{
+				acquireJobWithCancel: acq.acquireWithCancel,
+				updateJob: func(ctx context.Context, update *proto.UpdateJobRequest) (*proto.UpdateJobResponse, error) {
+					mut.Lock()
+					defer mut.Unlock()
+					if update.Checkpoint != nil {
+						checkpoints = append(checkpoints, update.Checkpoint)
+					}
+					return &proto.UpdateJobResponse{}, nil
+				},
+				completeJob: func(ctx context.Context, job *proto.CompletedJob) (*proto.Empty, error) {
+					return &proto.Empty{}, nil
+				},
+			}), nil
+		}, provisionerd.LocalProvisioners{
+			"someprovisioner": createProvisionerClient(t, done, provisionerTestServer{
+				plan: func(
+					s *provisionersdk.Session,
+					request *sdkproto.PlanRequest,
+					_ <-chan struct{},
+				) *sdkproto.PlanComplete {
+					if request.Checkpoint.GetStage() != "init" {
+						return &sdkproto.PlanComplete{Error: "not resumed"}
+					}
+					s.ProvisionCheckpoint(&sdkproto.Checkpoint{Stage: "init"})
+					return &sdkproto.PlanComplete{}
+				},
+				apply: func(
+					_ *provisionersdk.Session,
+					_ *sdkproto.ApplyRequest,
+					_ <-chan struct{},
+				) *sdkproto.ApplyComplete {
+					return &sdkproto.ApplyComplete{}
+				},
+			}),
+		})
+		require.Condition(t, closedWithin(acq.complete, testutil.WaitShort))
+		require.NoError(t, closer.Close())
+		mut.Lock()
+		defer mut.Unlock()
+		// The daemon checkpoints the plan before the apply starts, so coder
+		// server never resumes a build that may have changed resources.
+		require.Len(t, checkpoints, 2)
+		require.Equal(t, "init", checkpoints[0].Stage)
+		require.Equal(t, "plan", checkpoints[1].Stage)
+	})
+
 	t.Run("WorkspaceBuildQuotaExceeded", func(t *testing.T) {
 		t.Parallel()
 		done := make(chan struct{})
@@ -565,6 +839,7 @@ func TestProvisionerd(t *testing.T) {
 				acquireJobWithCancel: acq.acquireWithCancel,
 				updateJob:            noopUpdateJob,
 				failJob: func(ctx context.Context, job *proto.FailedJob) (*proto.Empty, error) {
+					assert.Equal(t, "SOME_ERROR", job.ErrorCode)
 					didFail.Store(true)
 					return &proto.Empty{}, nil
 				},
@@ -577,7 +852,8 @@ func TestProvisionerd(t *testing.T) {
 					cancelOrComplete <-chan struct{},
 				) *sdkproto.PlanComplete {
 					return &sdkproto.PlanComplete{
-						Error: "some error",
+						Error:     "some error",
+						ErrorCode: "SOME_ERROR",
 					}
 				},
 				apply: func(
@@ -22,6 +22,7 @@ import (
 	"github.com/coder/coder/v2/coderd/tracing"
 	"github.com/coder/coder/v2/coderd/util/ptr"
 	"github.com/coder/coder/v2/provisionerd/proto"
+	"github.com/coder/coder/v2/provisionersdk"
 	sdkproto "github.com/coder/coder/v2/provisionersdk/proto"
 )
 
@@ -40,6 +41,14 @@ var errorCodes = map[string]string{
 
 var errUpdateSkipped = xerrors.New("update skipped; job complete or failed")
 
+// DefaultLeaseDuration is how long a runner keeps running a job without
+// successfully updating it, e.g. while coder server is unreachable. It's
+// the duration after which coder server considers a job hung, so brief
+// outages of coder server don't stop builds. Coder server only requeues hung
+// jobs once the daemon had the time to exit after its lease expired, so the
+// job is never run by two daemons at once.
+const DefaultLeaseDuration = 5 * time.Minute
+
 type Runner struct {
 	tracer              trace.Tracer
 	metrics             Metrics
@@ -49,6 +58,8 @@ type Runner struct {
 	logger              slog.Logger
 	provisioner         sdkproto.DRPCProvisionerClient
 	lastUpdate          atomic.Pointer[time.Time]
+	leaseRenewed        atomic.Pointer[time.Time]
+	leaseDuration       time.Duration
 	updateInterval      time.Duration
 	forceCancelInterval time.Duration
 	logBufferInterval   time.Duration
@@ -105,8 +116,10 @@ type Options struct {
 	UpdateInterval      time.Duration
 	ForceCancelInterval time.Duration
 	LogDebounceInterval time.Duration
-	Tracer              trace.Tracer
-	Metrics             Metrics
+	// LeaseDuration defaults to DefaultLeaseDuration.
+	LeaseDuration time.Duration
+	Tracer        trace.Tracer
+	Metrics       Metrics
 }
 
 func New(
@@ -132,8 +145,22 @@ func New(
 			slog.F("workspace_transition", strings.ToLower(build.Metadata.WorkspaceTransition.String())),
 		)
 	}
+	if refresh := job.GetWorkspaceRefresh(); refresh != nil {
+		logger = logger.With(
+			slog.F("template_name", refresh.Metadata.TemplateName),
+			slog.F("template_version", refresh.Metadata.TemplateVersion),
+			slog.F("workspace_build_id", refresh.WorkspaceBuildId),
+			slog.F("workspace_id", refresh.Metadata.WorkspaceId),
+			slog.F("workspace_name", refresh.Metadata.WorkspaceName),
+			slog.F("workspace_owner", refresh.Metadata.WorkspaceOwner),
+		)
+	}
+
+	if opts.LeaseDuration == 0 {
+		opts.LeaseDuration = DefaultLeaseDuration
+	}
 
-	return &Runner{
+	r := &Runner{
 		tracer:              opts.Tracer,
 		metrics:             opts.Metrics,
 		job:                 job,
@@ -141,6 +168,7 @@ func New(
 		quotaCommitter:      opts.QuotaCommitter,
 		logger:              logger,
 		provisioner:         opts.Provisioner,
+		leaseDuration:       opts.LeaseDuration,
 		updateInterval:      opts.UpdateInterval,
 		forceCancelInterval: opts.ForceCancelInterval,
 		logBufferInterval:   opts.LogDebounceInterval,
@@ -154,6 +182,9 @@ func New(
 		notCanceled:         gracefulContext,
 		cancel:              cancelFunc,
 	}
+	// The job was just acquired, which grants the lease.
+	r.leaseRenewed.Store(ptr.Ref(time.Now()))
+	return r
 }
 
 // Run executes the job.
@@ -198,6 +229,7 @@ func (r *Runner) Run() {
 
 	go r.doCleanFinish(ctx)
 	go r.heartbeatRoutine(ctx)
+	go r.leaseRoutine(ctx)
 	for r.failedJob == nil && r.completedJob == nil {
 		r.cond.Wait()
 	}
@@ -344,6 +376,7 @@ func (r *Runner) update(ctx context.Context, u *proto.UpdateJobRequest) (*proto.
 		attribute.Int64("template_variables_len", int64(len(u.TemplateVariables))),
 		attribute.Int64("user_variable_values_len", int64(len(u.UserVariableValues))),
 		attribute.Int64("readme_len", int64(len(u.Readme))),
+		attribute.String("checkpoint_stage", u.GetCheckpoint().GetStage()),
 	)
 
 	r.mutex.Lock()
@@ -352,7 +385,12 @@ func (r *Runner) update(ctx context.Context, u *proto.UpdateJobRequest) (*proto.
 		return nil, errUpdateSkipped
 	}
 
-	return r.sender.UpdateJob(ctx, u)
+	resp, err := r.sender.UpdateJob(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	r.leaseRenewed.Store(ptr.Ref(time.Now()))
+	return resp, nil
 }
 
 // doCleanFinish wraps a call to do() with cleaning up the job and setting the terminal messages
@@ -433,6 +471,12 @@ func (r *Runner) do(ctx context.Context) (*proto.CompletedJob, *proto.FailedJob)
 			slog.F("variable_values", redactVariableValues(jobType.WorkspaceBuild.VariableValues)),
 		)
 		return r.runWorkspaceBuild(ctx)
+	case *proto.AcquiredJob_WorkspaceRefresh_:
+		r.logger.Debug(context.Background(), "acquired job is workspace refresh",
+			slog.F("workspace_name", jobType.WorkspaceRefresh.Metadata.WorkspaceName),
+			slog.F("state_length", len(jobType.WorkspaceRefresh.State)),
+		)
+		return r.runWorkspaceRefresh(ctx)
 	default:
 		return nil, r.failedJobf("unknown job type %q; ensure your provisioner daemon is up-to-date",
 			reflect.TypeOf(r.job.Type).String())
@@ -499,6 +543,45 @@ func (r *Runner) heartbeatRoutine(ctx context.Context) {
 	}
 }
 
+// leaseRoutine force stops the job once the lease on it expires, i.e. it
+// wasn't updated successfully for the lease duration. Coder server requeues
+// jobs that aren't updated, so the job must stop before another daemon
+// acquires it.
+func (r *Runner) leaseRoutine(ctx context.Context) {
+	ticker := time.NewTicker(r.updateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.notStopped.Done():
+			return
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		// Heartbeats stop once the job is canceled, but the lease must be
+		// renewed until the job gracefully exits.
+		if r.notCanceled.Err() != nil {
+			_, _ = r.sendHeartbeat(ctx)
+		}
+
+		renewed := r.leaseRenewed.Load()
+		if time.Since(*renewed) < r.leaseDuration {
+			continue
+		}
+		r.logger.Error(ctx, "lease on job expired, force stopping",
+			slog.F("lease_renewed_at", *renewed),
+			slog.F("lease_duration", r.leaseDuration),
+		)
+		// The provisioner session is stopped before the mutex is acquired,
+		// since it may be held by an update that never returns.
+		r.stop()
+		r.ForceStop()
+		return
+	}
+}
+
 func (r *Runner) runTemplateImport(ctx context.Context) (*proto.CompletedJob, *proto.FailedJob) {
 	ctx, span := r.startTrace(ctx, tracing.FuncName())
 	defer span.End()
@@ -517,7 +600,7 @@ func (r *Runner) runTemplateImport(ctx context.Context) (*proto.CompletedJob, *p
 		Stage:     "Parsing template parameters",
 		CreatedAt: time.Now().UnixMilli(),
 	})
-	templateVariables, readme, err := r.runTemplateImportParse(ctx)
+	parse, err := r.runTemplateImportParse(ctx)
 	if err != nil {
 		return nil, r.failedJobf("run parse: %s", err)
 	}
@@ -526,9 +609,10 @@ func (r *Runner) runTemplateImport(ctx context.Context) (*proto.CompletedJob, *p
 	// to store in database and filter valid ones.
 	updateResponse, err := r.update(ctx, &proto.UpdateJobRequest{
 		JobId:              r.job.JobId,
-		TemplateVariables:  templateVariables,
+		TemplateVariables:  parse.TemplateVariables,
 		UserVariableValues: r.job.GetTemplateImport().GetUserVariableValues(),
-		Readme:             readme,
+		Readme:             parse.Readme,
+		TemplateMetadata:   parse.TemplateMetadata,
 	})
 	if err != nil {
 		return nil, r.failedJobf("update job: %s", err)
@@ -544,6 +628,7 @@ func (r *Runner) runTemplateImport(ctx context.Context) (*proto.CompletedJob, *p
 	startProvision, err := r.runTemplateImportProvision(ctx, updateResponse.VariableValues, &sdkproto.Metadata{
 		CoderUrl:            r.job.GetTemplateImport().Metadata.CoderUrl,
 		WorkspaceTransition: sdkproto.WorkspaceTransition_START,
+		MaxAppSharingLevel:  r.job.GetTemplateImport().Metadata.GetMaxAppSharingLevel(),
 	})
 	if err != nil {
 		return nil, r.failedJobf("template import provision for start: %s", err)
@@ -559,6 +644,7 @@ func (r *Runner) runTemplateImport(ctx context.Context) (*proto.CompletedJob, *p
 	stopProvision, err := r.runTemplateImportProvision(ctx, updateResponse.VariableValues, &sdkproto.Metadata{
 		CoderUrl:            r.job.GetTemplateImport().Metadata.CoderUrl,
 		WorkspaceTransition: sdkproto.WorkspaceTransition_STOP,
+		MaxAppSharingLevel:  r.job.GetTemplateImport().Metadata.GetMaxAppSharingLevel(),
 	})
 	if err != nil {
 		return nil, r.failedJobf("template import provision for stop: %s", err)
@@ -577,21 +663,19 @@ func (r *Runner) runTemplateImport(ctx context.Context) (*proto.CompletedJob, *p
 	}, nil
 }
 
-// Parses template variables and README from source.
-func (r *Runner) runTemplateImportParse(ctx context.Context) (
-	vars []*sdkproto.TemplateVariable, readme []byte, err error,
-) {
+// Parses template variables, README and metadata from source.
+func (r *Runner) runTemplateImportParse(ctx context.Context) (*sdkproto.ParseComplete, error) {
 	ctx, span := r.startTrace(ctx, tracing.FuncName())
 	defer span.End()
 
-	err = r.session.Send(&sdkproto.Request{Type: &sdkproto.Request_Parse{Parse: &sdkproto.ParseRequest{}}})
+	err := r.session.Send(&sdkproto.Request{Type: &sdkproto.Request_Parse{Parse: &sdkproto.ParseRequest{}}})
 	if err != nil {
-		return nil, nil, xerrors.Errorf("parse source: %w", err)
+		return nil, xerrors.Errorf("parse source: %w", err)
 	}
 	for {
 		msg, err := r.session.Recv()
 		if err != nil {
-			return nil, nil, xerrors.Errorf("recv parse source: %w", err)
+			return nil, xerrors.Errorf("recv parse source: %w", err)
 		}
 		switch msgType := msg.Type.(type) {
 		case *sdkproto.Response_Log:
@@ -615,12 +699,12 @@ func (r *Runner) runTemplateImportParse(ctx context.Context) (
 				slog.F("error", pc.Error),
 			)
 			if pc.Error != "" {
-				return nil, nil, xerrors.Errorf("parse error: %s", pc.Error)
+				return nil, xerrors.Errorf("parse error: %s", pc.Error)
 			}
 
-			return msgType.Parse.TemplateVariables, msgType.Parse.Readme, nil
+			return pc, nil
 		default:
-			return nil, nil, xerrors.Errorf("invalid message type %q received from provisioner",
+			return nil, xerrors.Errorf("invalid message type %q received from provisioner",
 				reflect.TypeOf(msg.Type).String())
 		}
 	}
@@ -690,6 +774,8 @@ func (r *Runner) runTemplateImportProvisionWithRichParameters(
 			return nil, xerrors.Errorf("recv import provision: %w", err)
 		}
 		switch msgType := msg.Type.(type) {
+		case *sdkproto.Response_BuildStage:
+			// Template imports keep their own stages.
 		case *sdkproto.Response_Log:
 			r.logger.Debug(context.Background(), "template import provision job logged",
 				slog.F("level", msgType.Log.Level),
@@ -820,11 +906,21 @@ func (r *Runner) buildWorkspace(ctx context.Context, stage string, req *sdkproto
 			return nil, r.failedWorkspaceBuildf("recv workspace provision: %s", err)
 		}
 		switch msgType := msg.Type.(type) {
+		case *sdkproto.Response_BuildStage:
+			// Group the following logs by the stage the provisioner
+			// entered, and mark its start like the stages of the daemon.
+			stage = provisionersdk.BuildStage(msgType.BuildStage.Name).DisplayName()
+			r.queueLog(ctx, &proto.Log{
+				Source:    proto.LogSource_PROVISIONER_DAEMON,
+				Level:     sdkproto.LogLevel_INFO,
+				Stage:     stage,
+				CreatedAt: time.Now().UnixMilli(),
+			})
 		case *sdkproto.Response_Log:
 			r.logProvisionerJobLog(context.Background(), msgType.Log.Level, "workspace provisioner job logged",
 				slog.F("level", msgType.Log.Level),
 				slog.F("output", msgType.Log.Output),
-				slog.F("workspace_build_id", r.job.GetWorkspaceBuild().WorkspaceBuildId),
+				slog.F("workspace_build_id", r.job.GetWorkspaceBuild().GetWorkspaceBuildId()),
 			)
 
 			r.queueLog(ctx, &proto.Log{
@@ -834,6 +930,8 @@ func (r *Runner) buildWorkspace(ctx context.Context, stage string, req *sdkproto
 				Output:    msgType.Log.Output,
 				Stage:     stage,
 			})
+		case *sdkproto.Response_Checkpoint:
+			r.saveCheckpoint(ctx, msgType.Checkpoint)
 		default:
 			// Stop looping!
 			return msg, nil
@@ -841,6 +939,19 @@ func (r *Runner) buildWorkspace(ctx context.Context, stage string, req *sdkproto
 	}
 }
 
+// saveCheckpoint persists a checkpoint of the workspace build, so another
+// daemon can resume the build if this one crashes. Builds continue if the
+// checkpoint can't be saved, they just can't be resumed from it.
+func (r *Runner) saveCheckpoint(ctx context.Context, checkpoint *sdkproto.Checkpoint) {
+	_, err := r.update(ctx, &proto.UpdateJobRequest{
+		JobId:      r.job.JobId,
+		Checkpoint: checkpoint,
+	})
+	if err != nil && !errors.Is(err, errUpdateSkipped) {
+		r.logger.Warn(ctx, "save checkpoint", slog.F("stage", checkpoint.Stage), slog.Error(err))
+	}
+}
+
 func (r *Runner) commitQuota(ctx context.Context, resources []*sdkproto.Resource) *proto.FailedJob {
 	cost := sumDailyCost(resources)
 	r.logger.Debug(ctx, "committing quota",
@@ -929,6 +1040,7 @@ func (r *Runner) runWorkspaceBuild(ctx context.Context) (*proto.CompletedJob, *p
 				RichParameterValues:   r.job.GetWorkspaceBuild().RichParameterValues,
 				VariableValues:        r.job.GetWorkspaceBuild().VariableValues,
 				ExternalAuthProviders: r.job.GetWorkspaceBuild().ExternalAuthProviders,
+				Checkpoint:            r.job.GetWorkspaceBuild().Checkpoint,
 			},
 		},
 	})
@@ -945,10 +1057,13 @@ func (r *Runner) runWorkspaceBuild(ctx context.Context) (*proto.CompletedJob, *p
 		)
 
 		return nil, &proto.FailedJob{
-			JobId: r.job.JobId,
-			Error: planComplete.Error,
+			JobId:     r.job.JobId,
+			Error:     planComplete.Error,
+			ErrorCode: planComplete.ErrorCode,
 			Type: &proto.FailedJob_WorkspaceBuild_{
-				WorkspaceBuild: &proto.FailedJob_WorkspaceBuild{},
+				WorkspaceBuild: &proto.FailedJob_WorkspaceBuild{
+					DiagnosticBundle: planComplete.DiagnosticBundle,
+				},
 			},
 		}
 	}
@@ -966,6 +1081,18 @@ func (r *Runner) runWorkspaceBuild(ctx context.Context) (*proto.CompletedJob, *p
 		}
 	}
 
+	// The apply changes the infrastructure, so the build must not be resumed
+	// against the state of the previous build if it hangs from now on. Coder
+	// server must know before anything is applied, the state of a failed
+	// apply is only pushed back once the job fails.
+	_, err := r.update(ctx, &proto.UpdateJobRequest{
+		JobId:      r.job.JobId,
+		Checkpoint: &sdkproto.Checkpoint{Stage: string(provisionersdk.BuildStagePlan)},
+	})
+	if err != nil {
+		return nil, r.failedWorkspaceBuildf("checkpoint the plan: %s", err)
+	}
+
 	r.queueLog(ctx, &proto.Log{
 		Source:    proto.LogSource_PROVISIONER_DAEMON,
 		Level:     sdkproto.LogLevel_INFO,
@@ -998,7 +1125,8 @@ func (r *Runner) runWorkspaceBuild(ctx context.Context) (*proto.CompletedJob, *p
 			Error: applyComplete.Error,
 			Type: &proto.FailedJob_WorkspaceBuild_{
 				WorkspaceBuild: &proto.FailedJob_WorkspaceBuild{
-					State: applyComplete.State,
+					State:            applyComplete.State,
+					DiagnosticBundle: applyComplete.DiagnosticBundle,
 				},
 			},
 		}
@@ -1015,8 +1143,74 @@ func (r *Runner) runWorkspaceBuild(ctx context.Context) (*proto.CompletedJob, *p
 		JobId: r.job.JobId,
 		Type: &proto.CompletedJob_WorkspaceBuild_{
 			WorkspaceBuild: &proto.CompletedJob_WorkspaceBuild{
-				State:     applyComplete.State,
-				Resources: applyComplete.Resources,
+				State:             applyComplete.State,
+				Resources:         applyComplete.Resources,
+				WorkspaceMetadata: applyComplete.WorkspaceMetadata,
+				CapacityFallback:  applyComplete.CapacityFallback,
+			},
+		},
+	}, nil
+}
+
+// runWorkspaceRefresh plans the latest build of a workspace with
+// "-refresh-only", so the resources reflect the current state of the
+// infrastructure without changing it. The plan is never applied.
+func (r *Runner) runWorkspaceRefresh(ctx context.Context) (*proto.CompletedJob, *proto.FailedJob) {
+	ctx, span := r.startTrace(ctx, tracing.FuncName())
+	defer span.End()
+
+	failedJob := r.configure(&sdkproto.Config{
+		TemplateSourceArchive: r.job.GetTemplateSourceArchive(),
+		State:                 r.job.GetWorkspaceRefresh().State,
+	})
+	if failedJob != nil {
+		return nil, failedJob
+	}
+
+	resp, failed := r.buildWorkspace(ctx, "Refreshing infrastructure", &sdkproto.Request{
+		Type: &sdkproto.Request_Plan{
+			Plan: &sdkproto.PlanRequest{
+				Metadata:              r.job.GetWorkspaceRefresh().Metadata,
+				RichParameterValues:   r.job.GetWorkspaceRefresh().RichParameterValues,
+				VariableValues:        r.job.GetWorkspaceRefresh().VariableValues,
+				ExternalAuthProviders: r.job.GetWorkspaceRefresh().ExternalAuthProviders,
+				RefreshOnly:           true,
+			},
+		},
+	})
+	if failed != nil {
+		failed.Type = &proto.FailedJob_WorkspaceRefresh_{}
+		return nil, failed
+	}
+	planComplete := resp.GetPlan()
+	if planComplete == nil {
+		return nil, r.failedJobf("invalid message type %T received from provisioner", resp.Type)
+	}
+	if planComplete.Error != "" {
+		r.logger.Warn(context.Background(), "refresh request failed",
+			slog.F("error", planComplete.Error),
+		)
+
+		return nil, &proto.FailedJob{
+			JobId:     r.job.JobId,
+			Error:     planComplete.Error,
+			ErrorCode: planComplete.ErrorCode,
+			Type: &proto.FailedJob_WorkspaceRefresh_{
+				WorkspaceRefresh: &proto.FailedJob_WorkspaceRefresh{},
+			},
+		}
+	}
+
+	r.logger.Info(context.Background(), "refresh request successful",
+		slog.F("resource_count", len(planComplete.Resources)),
+	)
+	r.flushQueuedLogs(ctx)
+
+	return &proto.CompletedJob{
+		JobId: r.job.JobId,
+		Type: &proto.CompletedJob_WorkspaceRefresh_{
+			WorkspaceRefresh: &proto.CompletedJob_WorkspaceRefresh{
+				Resources: planComplete.Resources,
 			},
 		},
 	}, nil
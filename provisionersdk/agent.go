@@ -3,6 +3,7 @@ package provisionersdk
 import (
 	_ "embed"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/coder/coder/v2/provisionersdk/proto"
@@ -64,3 +65,18 @@ func DefaultDisplayApps() *proto.DisplayApps {
 		SshHelper:            true,
 	}
 }
+
+// AgentPlatforms returns the architectures the agent supports for every
+// operating system, sorted.
+func AgentPlatforms() map[string][]string {
+	platforms := make(map[string][]string, len(agentScripts))
+	for operatingSystem, scripts := range agentScripts {
+		architectures := make([]string, 0, len(scripts))
+		for architecture := range scripts {
+			architectures = append(architectures, architecture)
+		}
+		sort.Strings(architectures)
+		platforms[operatingSystem] = architectures
+	}
+	return platforms
+}
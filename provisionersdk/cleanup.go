@@ -2,7 +2,9 @@ package provisionersdk
 
 import (
 	"context"
+	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/spf13/afero"
@@ -11,15 +13,57 @@ import (
 	"cdr.dev/slog"
 )
 
+// WorkDirectoryRetention configures how long the work directories of
+// sessions are kept. By default, a work directory is removed once its
+// session ends.
+type WorkDirectoryRetention struct {
+	// KeepOnFailure keeps the work directory of a session whose plan or
+	// apply failed, so the failed build can be debugged on the provisioner
+	// host.
+	KeepOnFailure bool
+	// TTL is how long the work directories of sessions are kept after they
+	// were last modified before they're removed. Defaults to 7 days.
+	TTL time.Duration
+	// MaxDiskBytes limits the total size of the kept work directories. The
+	// oldest ones are removed once the limit is exceeded. Zero disables the
+	// limit.
+	MaxDiskBytes int64
+}
+
+func (r WorkDirectoryRetention) ttl() time.Duration {
+	if r.TTL <= 0 {
+		return staleSessionRetention
+	}
+	return r.TTL
+}
+
 // CleanStaleSessions browses the work directory searching for stale session
 // directories. Coder provisioner is supposed to remove them once after finishing the provisioning,
 // but there is a risk of keeping them in case of a failure.
 func CleanStaleSessions(ctx context.Context, workDirectory string, fs afero.Fs, now time.Time, logger slog.Logger) error {
+	return CleanSessions(ctx, workDirectory, fs, now, WorkDirectoryRetention{}, logger)
+}
+
+// keptSessionFile marks the work directory of a session that ended and was
+// kept, see WorkDirectoryRetention.KeepOnFailure.
+const keptSessionFile = ".coder-kept"
+
+// CleanSessions removes the session directories in the work directory that
+// are past the TTL of the retention, and then the oldest kept ones until
+// their total size is within its MaxDiskBytes. Directories of sessions that
+// are still running, in this process or another one sharing the work
+// directory, aren't kept yet and don't count towards the limit.
+func CleanSessions(ctx context.Context, workDirectory string, fs afero.Fs, now time.Time, retention WorkDirectoryRetention, logger slog.Logger) error {
 	entries, err := afero.ReadDir(fs, workDirectory)
 	if err != nil {
 		return xerrors.Errorf("can't read %q directory", workDirectory)
 	}
 
+	type session struct {
+		path    string
+		modTime time.Time
+	}
+	var kept []session
 	for _, fi := range entries {
 		dirName := fi.Name()
 
@@ -28,7 +72,10 @@ func CleanStaleSessions(ctx context.Context, workDirectory string, fs afero.Fs,
 
 			modTime := fi.ModTime() // fallback to modTime if modTime is not available (afero)
 
-			if modTime.Add(staleSessionRetention).After(now) {
+			if modTime.Add(retention.ttl()).After(now) {
+				if ok, _ := afero.Exists(fs, filepath.Join(sessionDirPath, keptSessionFile)); ok {
+					kept = append(kept, session{path: sessionDirPath, modTime: modTime})
+				}
 				continue
 			}
 
@@ -39,9 +86,54 @@ func CleanStaleSessions(ctx context.Context, workDirectory string, fs afero.Fs,
 			}
 		}
 	}
+	if retention.MaxDiskBytes <= 0 {
+		return nil
+	}
+
+	sizes := make(map[string]int64, len(kept))
+	var total int64
+	for _, s := range kept {
+		size, err := dirSize(fs, s.path)
+		if err != nil {
+			return xerrors.Errorf("can't measure %q directory: %w", s.path, err)
+		}
+		sizes[s.path] = size
+		total += size
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].modTime.Before(kept[j].modTime)
+	})
+	for _, s := range kept {
+		if total <= retention.MaxDiskBytes {
+			break
+		}
+		logger.Info(ctx, "remove session directory exceeding the disk limit",
+			slog.F("session_path", s.path), slog.F("size", sizes[s.path]), slog.F("total_size", total),
+			slog.F("max_disk_bytes", retention.MaxDiskBytes))
+		err = fs.RemoveAll(s.path)
+		if err != nil {
+			return xerrors.Errorf("can't remove %q directory: %w", s.path, err)
+		}
+		total -= sizes[s.path]
+	}
 	return nil
 }
 
+// dirSize returns the total size of the regular files in the directory.
+func dirSize(fs afero.Fs, dir string) (int64, error) {
+	var size int64
+	err := afero.Walk(fs, dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
 func isValidSessionDir(dirName string) bool {
 	match, err := filepath.Match(sessionDirPrefix+"*", dirName)
 	return err == nil && match
@@ -104,6 +104,93 @@ func TestStaleSessions(t *testing.T) {
 		require.NoError(t, err)
 		require.Len(t, entries, 2, "both sessions should be present")
 	})
+
+	t.Run("custom TTL", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), testutil.WaitShort)
+		defer cancel()
+
+		fs, logger := prepare()
+
+		// given
+		first := provisionersdk.SessionDir(uuid.NewString())
+		addSessionFolder(t, fs, first, now.Add(-2*time.Hour))
+		second := provisionersdk.SessionDir(uuid.NewString())
+		addSessionFolder(t, fs, second, now.Add(-30*time.Minute))
+
+		// when
+		err := provisionersdk.CleanSessions(ctx, workDirectory, fs, now, provisionersdk.WorkDirectoryRetention{
+			TTL: time.Hour,
+		}, logger)
+		require.NoError(t, err)
+
+		// then
+		entries, err := afero.ReadDir(fs, workDirectory)
+		require.NoError(t, err)
+		require.Len(t, entries, 1, "one session should be present")
+		require.Equal(t, second, entries[0].Name())
+	})
+
+	t.Run("max disk", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), testutil.WaitShort)
+		defer cancel()
+
+		fs, logger := prepare()
+
+		// given
+		first := provisionersdk.SessionDir(uuid.NewString())
+		addSessionFolder(t, fs, first, now.Add(-3*time.Hour))
+		addSessionFile(t, fs, first, 600, now.Add(-3*time.Hour))
+		second := provisionersdk.SessionDir(uuid.NewString())
+		addSessionFolder(t, fs, second, now.Add(-2*time.Hour))
+		addSessionFile(t, fs, second, 600, now.Add(-2*time.Hour))
+		third := provisionersdk.SessionDir(uuid.NewString())
+		addSessionFolder(t, fs, third, now.Add(-time.Hour))
+		addSessionFile(t, fs, third, 600, now.Add(-time.Hour))
+		for _, session := range []string{first, second, third} {
+			markSessionKept(t, fs, session)
+		}
+		// Sessions still running are never removed for the disk limit.
+		active := provisionersdk.SessionDir(uuid.NewString())
+		addSessionFolder(t, fs, active, now.Add(-4*time.Hour))
+		addSessionFile(t, fs, active, 600, now.Add(-4*time.Hour))
+
+		// when
+		err := provisionersdk.CleanSessions(ctx, workDirectory, fs, now, provisionersdk.WorkDirectoryRetention{
+			MaxDiskBytes: 1000,
+		}, logger)
+		require.NoError(t, err)
+
+		// then
+		entries, err := afero.ReadDir(fs, workDirectory)
+		require.NoError(t, err)
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		require.ElementsMatch(t, []string{third, active}, names, "only the newest kept session and the active one should be present")
+	})
+}
+
+// addSessionFile adds a file of the size to the session folder, and restores
+// the modification time of the folder.
+func addSessionFile(t *testing.T, fs afero.Fs, sessionName string, size int, modTime time.Time) {
+	err := afero.WriteFile(fs, filepath.Join(workDirectory, sessionName, "main.tf"), make([]byte, size), 0o600)
+	require.NoError(t, err, "can't create session file")
+	require.NoError(t, fs.Chtimes(filepath.Join(workDirectory, sessionName), now, modTime), "can't chtime of session dir")
+}
+
+// markSessionKept marks the session folder like a session that ended and
+// was kept.
+func markSessionKept(t *testing.T, fs afero.Fs, sessionName string) {
+	dir := filepath.Join(workDirectory, sessionName)
+	info, err := fs.Stat(dir)
+	require.NoError(t, err)
+	require.NoError(t, afero.WriteFile(fs, filepath.Join(dir, ".coder-kept"), nil, 0o600), "can't mark session kept")
+	require.NoError(t, fs.Chtimes(dir, now, info.ModTime()), "can't chtime of session dir")
 }
 
 func addSessionFolder(t *testing.T, fs afero.Fs, sessionName string, modTime time.Time) {
@@ -0,0 +1,185 @@
+package provisionersdk
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// ParameterSchemaDialect is the JSON Schema dialect of ParametersJSONSchema.
+const ParameterSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// ParameterSchema is a JSON Schema document describing the rich parameters of
+// a template, where every parameter is a property of an object. Attributes
+// without a JSON Schema equivalent use "x-coder-" keywords.
+type ParameterSchema struct {
+	Schema               string                             `json:"$schema"`
+	Type                 string                             `json:"type"`
+	Properties           map[string]ParameterSchemaProperty `json:"properties"`
+	Required             []string                           `json:"required,omitempty"`
+	AdditionalProperties bool                               `json:"additionalProperties"`
+	// Order lists the parameters in the order they should be displayed.
+	Order []string `json:"x-coder-order,omitempty"`
+}
+
+// ParameterSchemaProperty describes a single parameter.
+type ParameterSchemaProperty struct {
+	Type        string                   `json:"type"`
+	Title       string                   `json:"title,omitempty"`
+	Description string                   `json:"description,omitempty"`
+	Default     any                      `json:"default,omitempty"`
+	OneOf       []ParameterSchemaOption  `json:"oneOf,omitempty"`
+	Items       *ParameterSchemaProperty `json:"items,omitempty"`
+	UniqueItems bool                     `json:"uniqueItems,omitempty"`
+	Pattern     string                   `json:"pattern,omitempty"`
+	Minimum     *int32                   `json:"minimum,omitempty"`
+	Maximum     *int32                   `json:"maximum,omitempty"`
+
+	ValidationError string `json:"x-coder-validation-error,omitempty"`
+	Monotonic       string `json:"x-coder-monotonic,omitempty"`
+	Icon            string `json:"x-coder-icon,omitempty"`
+	Mutable         bool   `json:"x-coder-mutable,omitempty"`
+	Ephemeral       bool   `json:"x-coder-ephemeral,omitempty"`
+}
+
+// ParameterSchemaOption is an allowed value of a parameter with options.
+type ParameterSchemaOption struct {
+	Const       any    `json:"const"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"x-coder-icon,omitempty"`
+}
+
+// ParametersJSONSchema returns a JSON Schema document describing parameters,
+// so forms can be rendered without knowledge of Coder parameter types.
+func ParametersJSONSchema(parameters []*proto.RichParameter) (json.RawMessage, error) {
+	schema := ParameterSchema{
+		Schema:     ParameterSchemaDialect,
+		Type:       "object",
+		Properties: make(map[string]ParameterSchemaProperty, len(parameters)),
+	}
+	for _, parameter := range parameters {
+		property, err := parameterSchemaProperty(parameter)
+		if err != nil {
+			return nil, xerrors.Errorf("parameter %q: %w", parameter.Name, err)
+		}
+		schema.Properties[parameter.Name] = property
+		if parameter.Required {
+			schema.Required = append(schema.Required, parameter.Name)
+		}
+	}
+	// Parameters are displayed by their order, and then in the order they
+	// are declared.
+	sorted := make([]*proto.RichParameter, len(parameters))
+	copy(sorted, parameters)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Order < sorted[j].Order
+	})
+	for _, parameter := range sorted {
+		schema.Order = append(schema.Order, parameter.Name)
+	}
+
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, xerrors.Errorf("marshal schema: %w", err)
+	}
+	return data, nil
+}
+
+func parameterSchemaProperty(parameter *proto.RichParameter) (ParameterSchemaProperty, error) {
+	property := ParameterSchemaProperty{
+		Title:           parameter.DisplayName,
+		Description:     parameter.Description,
+		Pattern:         parameter.ValidationRegex,
+		Minimum:         parameter.ValidationMin,
+		Maximum:         parameter.ValidationMax,
+		ValidationError: parameter.ValidationError,
+		Monotonic:       parameter.ValidationMonotonic,
+		Icon:            parameter.Icon,
+		Mutable:         parameter.Mutable,
+		Ephemeral:       parameter.Ephemeral,
+	}
+	if property.Title == "" {
+		property.Title = parameter.Name
+	}
+
+	options := make([]ParameterSchemaOption, 0, len(parameter.Options))
+	for _, option := range parameter.Options {
+		// Options of a list are values of its items.
+		optionType := parameter.Type
+		if optionType == "list(string)" {
+			optionType = "string"
+		}
+		value, err := parameterSchemaValue(optionType, option.Value)
+		if err != nil {
+			return ParameterSchemaProperty{}, xerrors.Errorf("option %q: %w", option.Name, err)
+		}
+		options = append(options, ParameterSchemaOption{
+			Const:       value,
+			Title:       option.Name,
+			Description: option.Description,
+			Icon:        option.Icon,
+		})
+	}
+
+	switch parameter.Type {
+	case "string":
+		property.Type = "string"
+		property.OneOf = options
+	case "number":
+		property.Type = "number"
+		property.OneOf = options
+	case "bool":
+		property.Type = "boolean"
+		property.OneOf = options
+	case "list(string)":
+		property.Type = "array"
+		property.UniqueItems = len(options) > 0
+		property.Items = &ParameterSchemaProperty{
+			Type:  "string",
+			OneOf: options,
+		}
+	default:
+		return ParameterSchemaProperty{}, xerrors.Errorf("unsupported type %q", parameter.Type)
+	}
+
+	if parameter.DefaultValue != "" {
+		value, err := parameterSchemaValue(parameter.Type, parameter.DefaultValue)
+		if err != nil {
+			return ParameterSchemaProperty{}, xerrors.Errorf("default value: %w", err)
+		}
+		property.Default = value
+	}
+	return property, nil
+}
+
+// parameterSchemaValue converts the string representation of a parameter
+// value to its JSON type.
+func parameterSchemaValue(typ, value string) (any, error) {
+	switch typ {
+	case "number":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("parse number %q: %w", value, err)
+		}
+		return number, nil
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, xerrors.Errorf("parse bool %q: %w", value, err)
+		}
+		return b, nil
+	case "list(string)":
+		var list []string
+		err := json.Unmarshal([]byte(value), &list)
+		if err != nil {
+			return nil, xerrors.Errorf("parse list %q: %w", value, err)
+		}
+		return list, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,104 @@
+package provisionersdk_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk"
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+func TestParametersJSONSchema(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Types", func(t *testing.T) {
+		t.Parallel()
+		minimum, maximum := int32(1), int32(8)
+		data, err := provisionersdk.ParametersJSONSchema([]*proto.RichParameter{{
+			Name:         "region",
+			DisplayName:  "Region",
+			Type:         "string",
+			DefaultValue: "eu",
+			Required:     true,
+			Order:        2,
+			Options: []*proto.RichParameterOption{
+				{Name: "Europe", Value: "eu"},
+				{Name: "United States", Value: "us"},
+			},
+		}, {
+			Name:          "cpu",
+			Type:          "number",
+			DefaultValue:  "2",
+			ValidationMin: &minimum,
+			ValidationMax: &maximum,
+			Order:         1,
+		}, {
+			Name:         "dotfiles",
+			Type:         "bool",
+			DefaultValue: "false",
+			Mutable:      true,
+		}, {
+			Name:         "ides",
+			Type:         "list(string)",
+			DefaultValue: `["vim"]`,
+			Options: []*proto.RichParameterOption{
+				{Name: "Vim", Value: "vim"},
+				{Name: "Emacs", Value: "emacs"},
+			},
+		}})
+		require.NoError(t, err)
+
+		var schema provisionersdk.ParameterSchema
+		require.NoError(t, json.Unmarshal(data, &schema))
+		require.Equal(t, provisionersdk.ParameterSchemaDialect, schema.Schema)
+		require.Equal(t, []string{"region"}, schema.Required)
+		require.Equal(t, []string{"dotfiles", "ides", "cpu", "region"}, schema.Order)
+
+		region := schema.Properties["region"]
+		require.Equal(t, "string", region.Type)
+		require.Equal(t, "Region", region.Title)
+		require.Equal(t, "eu", region.Default)
+		require.Len(t, region.OneOf, 2)
+		require.Equal(t, "us", region.OneOf[1].Const)
+
+		cpu := schema.Properties["cpu"]
+		require.Equal(t, "number", cpu.Type)
+		require.Equal(t, "cpu", cpu.Title)
+		require.EqualValues(t, 2, cpu.Default)
+		require.Equal(t, &minimum, cpu.Minimum)
+		require.Equal(t, &maximum, cpu.Maximum)
+
+		dotfiles := schema.Properties["dotfiles"]
+		require.Equal(t, "boolean", dotfiles.Type)
+		require.Equal(t, false, dotfiles.Default)
+		require.True(t, dotfiles.Mutable)
+
+		ides := schema.Properties["ides"]
+		require.Equal(t, "array", ides.Type)
+		require.Equal(t, []any{"vim"}, ides.Default)
+		require.True(t, ides.UniqueItems)
+		require.NotNil(t, ides.Items)
+		require.Len(t, ides.Items.OneOf, 2)
+	})
+
+	t.Run("InvalidDefault", func(t *testing.T) {
+		t.Parallel()
+		_, err := provisionersdk.ParametersJSONSchema([]*proto.RichParameter{{
+			Name:         "cpu",
+			Type:         "number",
+			DefaultValue: "many",
+		}})
+		require.ErrorContains(t, err, `parameter "cpu": default value`)
+	})
+
+	t.Run("UnsupportedType", func(t *testing.T) {
+		t.Parallel()
+		_, err := provisionersdk.ParametersJSONSchema([]*proto.RichParameter{{
+			Name: "map",
+			Type: "map(string)",
+		}})
+		require.ErrorContains(t, err, `unsupported type "map(string)"`)
+	})
+}
@@ -39,6 +39,9 @@ type ServeOptions struct {
 	Conn          drpc.Transport
 	Logger        slog.Logger
 	WorkDirectory string
+	// WorkDirectoryRetention configures how long the work directories of
+	// sessions are kept in WorkDirectory.
+	WorkDirectoryRetention WorkDirectoryRetention
 }
 
 type Server interface {
@@ -47,6 +50,14 @@ type Server interface {
 	Apply(s *Session, r *proto.ApplyRequest, canceledOrComplete <-chan struct{}) *proto.ApplyComplete
 }
 
+// WorkDirectoryScrubber is implemented by servers that write secrets to the
+// work directory of a session, or keep them for it. The secrets are scrubbed
+// once every session ends, and the work directory of a failed session is
+// removed instead of kept if they can't be.
+type WorkDirectoryScrubber interface {
+	ScrubWorkDirectory(workDirectory string) error
+}
+
 // Serve starts a dRPC connection for the provisioner and transport provided.
 func Serve(ctx context.Context, server Server, options *ServeOptions) error {
 	if options == nil {
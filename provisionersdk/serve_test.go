@@ -3,11 +3,14 @@ package provisionersdk_test
 import (
 	"context"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
+	"golang.org/x/xerrors"
 	"storj.io/drpc/drpcconn"
 
 	"github.com/coder/coder/v2/codersdk/drpc"
@@ -131,6 +134,87 @@ func TestProvisionerSDK(t *testing.T) {
 			require.NoError(t, err)
 		}
 	})
+
+	t.Run("KeepOnFailure", func(t *testing.T) {
+		t.Parallel()
+		for _, tc := range []struct {
+			name     string
+			scrubErr error
+			// kept is the number of kept work directories.
+			kept int
+		}{
+			{name: "Scrubbed", kept: 1},
+			// Directories that can't be scrubbed must not be kept.
+			{name: "ScrubFailed", scrubErr: xerrors.New("scrub failed")},
+		} {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+				client, server := drpc.MemTransportPipe()
+				defer client.Close()
+				defer server.Close()
+
+				ctx, cancelFunc := context.WithTimeout(context.Background(), testutil.WaitMedium)
+				defer cancelFunc()
+				workDirectory := t.TempDir()
+				srvErr := make(chan error, 1)
+				go func() {
+					srvErr <- provisionersdk.Serve(ctx, &secretServer{scrubErr: tc.scrubErr}, &provisionersdk.ServeOptions{
+						Listener:      server,
+						WorkDirectory: workDirectory,
+						WorkDirectoryRetention: provisionersdk.WorkDirectoryRetention{
+							KeepOnFailure: true,
+						},
+					})
+				}()
+
+				api := proto.NewDRPCProvisionerClient(client)
+				s, err := api.Session(ctx)
+				require.NoError(t, err)
+				err = s.Send(&proto.Request{Type: &proto.Request_Config{Config: &proto.Config{}}})
+				require.NoError(t, err)
+				err = s.Send(&proto.Request{Type: &proto.Request_Plan{Plan: &proto.PlanRequest{}}})
+				require.NoError(t, err)
+				msg, err := s.Recv()
+				require.NoError(t, err)
+				require.Equal(t, "plan failed", msg.GetPlan().GetError())
+				require.NoError(t, s.Close())
+
+				require.Eventually(t, func() bool {
+					secrets, _ := filepath.Glob(filepath.Join(workDirectory, "*", "secret"))
+					logs, _ := filepath.Glob(filepath.Join(workDirectory, "*", "log"))
+					return len(secrets) == 0 && len(logs) == tc.kept
+				}, testutil.WaitShort, testutil.IntervalFast)
+
+				cancelFunc()
+				<-srvErr
+			})
+		}
+	})
+}
+
+// secretServer fails plans after writing a secret to the work directory,
+// which it scrubs.
+type secretServer struct {
+	unimplementedServer
+	scrubErr error
+}
+
+func (*secretServer) Plan(s *provisionersdk.Session, _ *proto.PlanRequest, _ <-chan struct{}) *proto.PlanComplete {
+	for _, name := range []string{"secret", "log"} {
+		err := os.WriteFile(filepath.Join(s.WorkDirectory, name), []byte(name), 0o600)
+		if err != nil {
+			return provisionersdk.PlanErrorf("write %s: %s", name, err)
+		}
+	}
+	return &proto.PlanComplete{Error: "plan failed"}
+}
+
+func (s *secretServer) ScrubWorkDirectory(workDirectory string) error {
+	if s.scrubErr != nil {
+		return s.scrubErr
+	}
+	return os.Remove(filepath.Join(workDirectory, "secret"))
 }
 
 type unimplementedServer struct{}
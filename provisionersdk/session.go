@@ -43,7 +43,7 @@ func (p *protoServer) Session(stream proto.DRPCProvisioner_SessionStream) error
 		server: p.server,
 	}
 
-	err := CleanStaleSessions(s.Context(), p.opts.WorkDirectory, afero.NewOsFs(), time.Now(), s.Logger)
+	err := CleanSessions(s.Context(), p.opts.WorkDirectory, afero.NewOsFs(), time.Now(), p.opts.WorkDirectoryRetention, s.Logger)
 	if err != nil {
 		return xerrors.Errorf("unable to clean stale sessions %q: %w", s.WorkDirectory, err)
 	}
@@ -53,7 +53,27 @@ func (p *protoServer) Session(stream proto.DRPCProvisioner_SessionStream) error
 	if err != nil {
 		return xerrors.Errorf("create work directory %q: %w", s.WorkDirectory, err)
 	}
+	s.retention = p.opts.WorkDirectoryRetention
 	defer func() {
+		scrubErr := s.scrubWorkDirectory()
+		if s.keepWorkDirectory() {
+			if scrubErr == nil {
+				err := os.WriteFile(filepath.Join(s.WorkDirectory, keptSessionFile), nil, 0o600)
+				if err != nil {
+					s.Logger.Warn(s.Context(), "failed to mark kept work directory", slog.Error(err))
+				}
+				// The TTL of the directory starts once the session ended.
+				now := time.Now()
+				err = os.Chtimes(s.WorkDirectory, now, now)
+				if err != nil {
+					s.Logger.Warn(s.Context(), "failed to touch kept work directory", slog.Error(err))
+				}
+				s.Logger.Info(s.Context(), "keeping work directory of failed session", slog.F("path", s.WorkDirectory))
+				return
+			}
+			s.Logger.Error(s.Context(), "failed to scrub secrets from work directory, removing it instead of keeping it",
+				slog.F("path", s.WorkDirectory), slog.Error(scrubErr))
+		}
 		var err error
 		// Cleanup the work directory after execution.
 		for attempt := 0; attempt < 5; attempt++ {
@@ -156,10 +176,16 @@ func (s *Session) handleRequests() error {
 			if err != nil {
 				return err
 			}
-			resp.Type = &proto.Response_Plan{Plan: complete}
 			if complete.Error == "" {
 				planned = true
+			} else {
+				s.failed = true
+				if complete.DiagnosticBundle == nil {
+					complete.DiagnosticBundle = &proto.DiagnosticBundle{}
+				}
+				complete.DiagnosticBundle.WorkDirectory = s.listWorkDirectory()
 			}
+			resp.Type = &proto.Response_Plan{Plan: complete}
 		}
 		if apply := req.GetApply(); apply != nil {
 			if !planned {
@@ -175,6 +201,13 @@ func (s *Session) handleRequests() error {
 			if err != nil {
 				return err
 			}
+			if complete.Error != "" {
+				s.failed = true
+				if complete.DiagnosticBundle == nil {
+					complete.DiagnosticBundle = &proto.DiagnosticBundle{}
+				}
+				complete.DiagnosticBundle.WorkDirectory = s.listWorkDirectory()
+			}
 			resp.Type = &proto.Response_Apply{Apply: complete}
 		}
 		err := s.stream.Send(resp)
@@ -190,9 +223,36 @@ type Session struct {
 	WorkDirectory string
 	Config        *proto.Config
 
-	server   Server
-	stream   proto.DRPCProvisioner_SessionStream
-	logLevel int32
+	server    Server
+	stream    proto.DRPCProvisioner_SessionStream
+	logLevel  int32
+	retention WorkDirectoryRetention
+	// failed is set once a plan or apply of the session failed.
+	failed bool
+}
+
+// keepWorkDirectory returns whether the work directory is kept once the
+// session ends.
+func (s *Session) keepWorkDirectory() bool {
+	return s.failed && s.retention.KeepOnFailure
+}
+
+// listWorkDirectory lists the work directory of a failed plan or apply. It's
+// listed here rather than by every provisioner.
+func (s *Session) listWorkDirectory() *proto.WorkDirectoryListing {
+	listing := listWorkDirectory(s.WorkDirectory)
+	listing.Kept = s.keepWorkDirectory()
+	return listing
+}
+
+// scrubWorkDirectory removes the secrets the server wrote to the work
+// directory.
+func (s *Session) scrubWorkDirectory() error {
+	scrubber, ok := s.server.(WorkDirectoryScrubber)
+	if !ok {
+		return nil
+	}
+	return scrubber.ScrubWorkDirectory(s.WorkDirectory)
 }
 
 func (s *Session) Context() context.Context {
@@ -300,6 +360,24 @@ func (s *Session) ProvisionLog(level proto.LogLevel, output string) {
 	}
 }
 
+// ProvisionStage reports that the provisioner entered the build stage.
+// Stages are reported regardless of the log level.
+func (s *Session) ProvisionStage(stage BuildStage) {
+	err := s.stream.Send(&proto.Response{Type: &proto.Response_BuildStage{BuildStage: &proto.BuildStage{Name: string(stage)}}})
+	if err != nil {
+		s.Logger.Error(s.Context(), "failed to transmit build stage", slog.F("stage", stage))
+	}
+}
+
+// ProvisionCheckpoint reports a checkpoint of the build to the daemon, which
+// persists it so the build can be resumed from it.
+func (s *Session) ProvisionCheckpoint(checkpoint *proto.Checkpoint) {
+	err := s.stream.Send(&proto.Response{Type: &proto.Response_Checkpoint{Checkpoint: checkpoint}})
+	if err != nil {
+		s.Logger.Error(s.Context(), "failed to transmit checkpoint", slog.F("stage", checkpoint.Stage))
+	}
+}
+
 type pRequest interface {
 	*proto.ParseRequest | *proto.PlanRequest | *proto.ApplyRequest
 }
@@ -0,0 +1,61 @@
+package provisionersdk
+
+// BuildStage is a named stage of a workspace build. Provisioners report the
+// stage they enter, so the logs of the build are grouped by what's
+// happening instead of a single "Starting workspace" stage.
+type BuildStage string
+
+const (
+	BuildStageInit BuildStage = "init"
+	BuildStagePlan BuildStage = "plan"
+	// BuildStageApplyNetwork is entered when networks, firewalls, DNS
+	// records and the like are applied.
+	BuildStageApplyNetwork BuildStage = "apply:network"
+	// BuildStageApplyCompute is entered when instances, containers and
+	// other resources running agents are applied.
+	BuildStageApplyCompute BuildStage = "apply:compute"
+	// BuildStageAgentsConnecting is entered when the resources are
+	// applied, and the build waits for the agents to connect.
+	BuildStageAgentsConnecting BuildStage = "agents-connecting"
+)
+
+// BuildStages are the stages in the order they are entered.
+var BuildStages = []BuildStage{
+	BuildStageInit,
+	BuildStagePlan,
+	BuildStageApplyNetwork,
+	BuildStageApplyCompute,
+	BuildStageAgentsConnecting,
+}
+
+// DisplayName is the name of the stage shown to users.
+func (s BuildStage) DisplayName() string {
+	switch s {
+	case BuildStageInit:
+		return "Initializing"
+	case BuildStagePlan:
+		return "Planning infrastructure"
+	case BuildStageApplyNetwork:
+		return "Creating network"
+	case BuildStageApplyCompute:
+		return "Creating compute"
+	case BuildStageAgentsConnecting:
+		return "Waiting for agents"
+	default:
+		return string(s)
+	}
+}
+
+// Before returns whether s is entered before other.
+func (s BuildStage) Before(other BuildStage) bool {
+	return buildStageIndex(s) < buildStageIndex(other)
+}
+
+func buildStageIndex(stage BuildStage) int {
+	for i, s := range BuildStages {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
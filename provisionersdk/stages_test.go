@@ -0,0 +1,19 @@
+package provisionersdk_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/coder/v2/provisionersdk"
+)
+
+func TestBuildStage(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, provisionersdk.BuildStageInit.Before(provisionersdk.BuildStagePlan))
+	require.True(t, provisionersdk.BuildStageApplyNetwork.Before(provisionersdk.BuildStageApplyCompute))
+	require.False(t, provisionersdk.BuildStageAgentsConnecting.Before(provisionersdk.BuildStageApplyCompute))
+	require.Equal(t, "Creating compute", provisionersdk.BuildStageApplyCompute.DisplayName())
+	require.Equal(t, "custom", provisionersdk.BuildStage("custom").DisplayName())
+}
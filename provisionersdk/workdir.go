@@ -0,0 +1,43 @@
+package provisionersdk
+
+import (
+	"io/fs"
+	"path/filepath"
+
+	"github.com/coder/coder/v2/provisionersdk/proto"
+)
+
+// workDirectoryListingMaxEntries limits the entries of a work directory
+// listing, e.g. the provider plugins of a template can add up to thousands
+// of files.
+const workDirectoryListingMaxEntries = 1000
+
+// listWorkDirectory lists the files of the work directory of a session in
+// lexical order. Files that can't be read are left out.
+func listWorkDirectory(dir string) *proto.WorkDirectoryListing {
+	listing := &proto.WorkDirectoryListing{Path: dir}
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return nil
+		}
+		if len(listing.Entries) >= workDirectoryListingMaxEntries {
+			listing.Truncated = true
+			return filepath.SkipAll
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		listing.Entries = append(listing.Entries, &proto.WorkDirectoryListing_Entry{
+			Path: filepath.ToSlash(rel),
+			Size: info.Size(),
+			Mode: info.Mode().String(),
+		})
+		return nil
+	})
+	return listing
+}
@@ -75,6 +75,10 @@ type Process interface {
 	// returned error is as for os.Process.Signal(), on Windows it's
 	// as for os.Process.Kill().
 	Signal(sig os.Signal) error
+
+	// ProcessState returns the state of the exited process, including its
+	// resource usage. It returns nil until Wait() has returned.
+	ProcessState() *os.ProcessState
 }
 
 // WithFlags represents a PTY whose flags can be inspected, in particular
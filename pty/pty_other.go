@@ -174,6 +174,15 @@ func (p *otherProcess) Signal(sig os.Signal) error {
 	return p.cmd.Process.Signal(sig)
 }
 
+func (p *otherProcess) ProcessState() *os.ProcessState {
+	select {
+	case <-p.cmdDone:
+		return p.cmd.ProcessState
+	default:
+		return nil
+	}
+}
+
 func (p *otherProcess) waitInternal() {
 	// The GC can garbage collect the TTY FD before the command
 	// has finished running. See:
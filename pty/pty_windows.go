@@ -92,6 +92,7 @@ type windowsProcess struct {
 	// cmdDone protects access to cmdErr: anything reading cmdErr should read from cmdDone first.
 	cmdDone chan any
 	cmdErr  error
+	state   *os.ProcessState
 	proc    *os.Process
 	pw      *ptyWindows
 }
@@ -228,6 +229,7 @@ func (p *windowsProcess) waitInternal() {
 		p.cmdErr = err
 		return
 	}
+	p.state = state
 	if !state.Success() {
 		p.cmdErr = &exec.ExitError{ProcessState: state}
 		return
@@ -239,6 +241,15 @@ func (p *windowsProcess) Wait() error {
 	return p.cmdErr
 }
 
+func (p *windowsProcess) ProcessState() *os.ProcessState {
+	select {
+	case <-p.cmdDone:
+		return p.state
+	default:
+		return nil
+	}
+}
+
 func (p *windowsProcess) Kill() error {
 	return p.proc.Kill()
 }
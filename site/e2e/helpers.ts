@@ -422,6 +422,8 @@ const createTemplateVersionTar = async (
           resources: response.apply?.resources ?? [],
           parameters: response.apply?.parameters ?? [],
           externalAuthProviders: response.apply?.externalAuthProviders ?? [],
+          network: response.apply?.network,
+          topology: response.apply?.topology,
         },
       };
     });
@@ -433,6 +435,7 @@ const createTemplateVersionTar = async (
       templateVariables: [],
       error: "",
       readme: new Uint8Array(),
+      templateMetadata: undefined,
       ...response.parse,
     } as ParseComplete;
     tar.addFile(
@@ -503,6 +506,7 @@ const createTemplateVersionTar = async (
       );
     }
     return {
+      accelerators: [],
       agents: [],
       dailyCost: 0,
       hide: false,
@@ -522,6 +526,7 @@ const createTemplateVersionTar = async (
       resources: [],
       parameters: [],
       externalAuthProviders: [],
+      workspaceMetadata: [],
       ...response.apply,
     } as ApplyComplete;
     response.apply.resources = response.apply.resources?.map(fillResource);
@@ -537,6 +542,7 @@ const createTemplateVersionTar = async (
       resources: [],
       parameters: [],
       externalAuthProviders: [],
+      appUrlDiagnostics: [],
       ...response.plan,
     } as PlanComplete;
     response.plan.resources = response.plan.resources?.map(fillResource);
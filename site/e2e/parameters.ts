@@ -1,4 +1,4 @@
-import { RichParameter } from "./provisionerGenerated";
+import { ParameterSource, RichParameter } from "./provisionerGenerated";
 
 // Rich parameters
 
@@ -19,6 +19,7 @@ const emptyParameter: RichParameter = {
   displayName: "",
   order: 0,
   ephemeral: false,
+  defaultSource: ParameterSource.SOURCE_UNSPECIFIED,
 };
 
 // firstParameter is mutable string with a default value (parameter value not required).
@@ -4,6 +4,17 @@ import { Observable } from "rxjs";
 
 export const protobufPackage = "provisioner";
 
+/** ParameterSource is where the value of a parameter in a build came from. */
+export enum ParameterSource {
+  /** SOURCE_UNSPECIFIED - SOURCE_UNSPECIFIED is sent by clients that don't track the source. */
+  SOURCE_UNSPECIFIED = 0,
+  TEMPLATE_DEFAULT = 1,
+  PRESET = 2,
+  PREVIOUS_BUILD = 3,
+  USER_INPUT = 4,
+  UNRECOGNIZED = -1,
+}
+
 /** LogLevel represents severity of the log. */
 export enum LogLevel {
   TRACE = 0,
@@ -21,6 +32,22 @@ export enum AppSharingLevel {
   UNRECOGNIZED = -1,
 }
 
+/** ResourceAction is the change a plan makes to a resource. */
+export enum ResourceAction {
+  /** ACTION_UNSPECIFIED - ACTION_UNSPECIFIED is used for resources converted without a plan. */
+  ACTION_UNSPECIFIED = 0,
+  NO_OP = 1,
+  CREATE = 2,
+  UPDATE = 3,
+  REPLACE = 4,
+  /**
+   * DELETE - DELETE resources only have a name and a type, since they aren't part
+   * of the planned or applied state.
+   */
+  DELETE = 5,
+  UNRECOGNIZED = -1,
+}
+
 /** WorkspaceTransition is the desired outcome of a build */
 export enum WorkspaceTransition {
   START = 0,
@@ -69,12 +96,18 @@ export interface RichParameter {
   displayName: string;
   order: number;
   ephemeral: boolean;
+  /**
+   * default_source is where the value of the parameter in the build came
+   * from, e.g. to show that it was changed from the template default.
+   */
+  defaultSource: ParameterSource;
 }
 
 /** RichParameterValue holds the key/value mapping of a parameter. */
 export interface RichParameterValue {
   name: string;
   value: string;
+  source: ParameterSource;
 }
 
 /** VariableValue holds the key/value mapping of a Terraform variable. */
@@ -123,6 +156,16 @@ export interface Agent {
   displayApps: DisplayApps | undefined;
   scripts: Script[];
   extraEnvs: Env[];
+  /**
+   * unknown_attributes are the names of the attributes only known after
+   * apply, which are empty in plans.
+   */
+  unknownAttributes: string[];
+  /**
+   * troubleshooting_urls override troubleshooting_url for specific
+   * failures of the agent.
+   */
+  troubleshootingUrls: TroubleshootingURLs | undefined;
 }
 
 export interface Agent_Metadata {
@@ -132,6 +175,7 @@ export interface Agent_Metadata {
   interval: number;
   timeout: number;
   order: number;
+  collector: string;
 }
 
 export interface Agent_EnvEntry {
@@ -147,6 +191,22 @@ export interface DisplayApps {
   portForwardingHelper: boolean;
 }
 
+/** TroubleshootingURLs are the runbooks of an agent by class of failure. */
+export interface TroubleshootingURLs {
+  /**
+   * connection_timeout is shown when the agent doesn't connect within its
+   * connection timeout.
+   */
+  connectionTimeout: string;
+  /** start_error is shown when a startup script of the agent fails. */
+  startError: string;
+  /**
+   * token_invalid is shown when the agent fails to authenticate with its
+   * token.
+   */
+  tokenInvalid: string;
+}
+
 export interface Env {
   name: string;
   value: string;
@@ -163,6 +223,16 @@ export interface Script {
   runOnStop: boolean;
   timeoutSeconds: number;
   logPath: string;
+  runOnBuildSuccess: boolean;
+  runOnBuildFailure: boolean;
+  runOnPostStart: boolean;
+  login: boolean;
+  /**
+   * disk_pressure_path is a path whose disk usage is watched by the agent,
+   * the script runs once the usage crosses disk_pressure_threshold percent.
+   */
+  diskPressurePath: string;
+  diskPressureThreshold: number;
 }
 
 /** App represents a dev-accessible application on the workspace. */
@@ -181,6 +251,11 @@ export interface App {
   sharingLevel: AppSharingLevel;
   external: boolean;
   order: number;
+  /**
+   * unknown_attributes are the names of the attributes only known after
+   * apply, e.g. URLs derived from resources, which are empty in plans.
+   */
+  unknownAttributes: string[];
 }
 
 /** Healthcheck represents configuration for checking for app readiness. */
@@ -200,6 +275,19 @@ export interface Resource {
   icon: string;
   instanceType: string;
   dailyCost: number;
+  accelerators: Resource_Accelerator[];
+  /**
+   * action is the change the plan makes to the resource. Applied
+   * resources are annotated with the action of the plan they were
+   * applied from.
+   */
+  action: ResourceAction;
+  /**
+   * address is the Terraform address of the resource, including its
+   * module path and its count or for_each index. Unlike the type and
+   * name, it's unique within a workspace.
+   */
+  address: string;
 }
 
 export interface Resource_Metadata {
@@ -207,6 +295,64 @@ export interface Resource_Metadata {
   value: string;
   sensitive: boolean;
   isNull: boolean;
+  order: number;
+  group: string;
+}
+
+/**
+ * Accelerator is a GPU or other accelerator attached to a compute
+ * resource.
+ */
+export interface Resource_Accelerator {
+  /** vendor is e.g. "nvidia", "amd" or "intel", empty if unknown. */
+  vendor: string;
+  /**
+   * model is e.g. "nvidia-tesla-t4" or "nvidia.com/gpu", as named
+   * by the resource.
+   */
+  model: string;
+  count: number;
+}
+
+/**
+ * WorkspaceNetwork tunes the connectivity of the agents of a workspace, e.g.
+ * for templates of restricted networks.
+ */
+export interface WorkspaceNetwork {
+  /**
+   * preferred_derp_region is the code of the DERP region agents should
+   * prefer, empty for the closest one.
+   */
+  preferredDerpRegion: string;
+  disableDirectConnections: boolean;
+  /** mtu overrides the MTU of the tunnel, zero for the default. */
+  mtu: number;
+}
+
+/**
+ * Topology is a simplified dependency graph of a workspace, suitable for
+ * rendering a diagram. Edges associate resources with the agents running on
+ * them, and agents with their apps.
+ */
+export interface Topology {
+  nodes: Topology_Node[];
+  edges: Topology_Edge[];
+}
+
+export interface Topology_Node {
+  /** id is unique within the topology. */
+  id: string;
+  /** kind is one of "resource", "agent" or "app". */
+  kind: string;
+  /** type is the Terraform resource type of resources. */
+  type: string;
+  name: string;
+  icon: string;
+}
+
+export interface Topology_Edge {
+  from: string;
+  to: string;
 }
 
 /** Metadata is information about a workspace used in the execution of a build */
@@ -224,6 +370,39 @@ export interface Metadata {
   workspaceOwnerSessionToken: string;
   templateId: string;
   workspaceOwnerName: string;
+  /**
+   * max_app_sharing_level is the widest sharing level apps may use, one
+   * of "owner", "authenticated" or "public". Apps aren't limited if empty.
+   */
+  maxAppSharingLevel: string;
+  /**
+   * capacity_option is the capacity option the last build of the
+   * workspace that fell back succeeded with, see coder_capacity_fallback.
+   * Builds start with it while the template still lists it.
+   */
+  capacityOption: string;
+  /**
+   * workspace_app_hostname is the wildcard hostname subdomain apps are
+   * served on, e.g. "*.apps.example.com". Empty if the deployment has no
+   * wildcard access URL, so apps can't be served on subdomains.
+   */
+  workspaceAppHostname: string;
+  /**
+   * workspace_owner_groups are the names of the groups of the workspace
+   * owner in the organization of the template.
+   */
+  workspaceOwnerGroups: string[];
+  /**
+   * replace_on_failure is set by templates that replace the resources that
+   * failed to update, so they're tainted when the apply fails.
+   */
+  replaceOnFailure: boolean;
+  /**
+   * replace_resources are the addresses of the resources of the previous
+   * build whose agents failed to connect or start, which are replaced if
+   * replace_on_failure is set.
+   */
+  replaceResources: string[];
 }
 
 /** Config represents execution configuration shared by all subsequent requests in the Session */
@@ -238,11 +417,50 @@ export interface Config {
 /** ParseRequest consumes source-code to produce inputs. */
 export interface ParseRequest {}
 
+/**
+ * TemplateMetadata describes the template, e.g. to populate its gallery
+ * entry on import.
+ */
+export interface TemplateMetadata {
+  displayName: string;
+  icon: string;
+  description: string;
+  docsUrl: string;
+}
+
 /** ParseComplete indicates a request to parse completed. */
 export interface ParseComplete {
   error: string;
   templateVariables: TemplateVariable[];
   readme: Uint8Array;
+  templateMetadata: TemplateMetadata | undefined;
+}
+
+/**
+ * Checkpoint is the progress of a workspace build, persisted by the daemon
+ * so a replacement daemon can resume the build if the daemon crashes.
+ */
+export interface Checkpoint {
+  /** stage is the last build stage that completed, e.g. "init" or "plan". */
+  stage: string;
+  /**
+   * files are the files of the work directory the provisioner needs to
+   * resume, by their path relative to the work directory.
+   */
+  files: { [key: string]: Uint8Array };
+}
+
+export interface Checkpoint_FilesEntry {
+  key: string;
+  value: Uint8Array;
+}
+
+/**
+ * BuildStage reports that the provisioner entered a named stage of a
+ * workspace build, e.g. "init" or "apply:compute".
+ */
+export interface BuildStage {
+  name: string;
 }
 
 /** PlanRequest asks the provisioner to plan what resources & parameters it will create */
@@ -251,6 +469,16 @@ export interface PlanRequest {
   richParameterValues: RichParameterValue[];
   variableValues: VariableValue[];
   externalAuthProviders: ExternalAuthProvider[];
+  /**
+   * checkpoint is set when a build is resumed, so the provisioner can skip
+   * the stages that already completed.
+   */
+  checkpoint: Checkpoint | undefined;
+  /**
+   * refresh_only plans without changes, so the resources reflect the
+   * current state of the infrastructure.
+   */
+  refreshOnly: boolean;
 }
 
 /** PlanComplete indicates a request to plan completed. */
@@ -259,6 +487,34 @@ export interface PlanComplete {
   resources: Resource[];
   parameters: RichParameter[];
   externalAuthProviders: string[];
+  network: WorkspaceNetwork | undefined;
+  topology: Topology | undefined;
+  /** parameter_schema is a JSON Schema document describing the parameters. */
+  parameterSchema: Uint8Array;
+  /** diagnostic_bundle is set when the plan failed. */
+  diagnosticBundle: DiagnosticBundle | undefined;
+  /** app_url_diagnostics warn about apps with urls that can't be proxied. */
+  appUrlDiagnostics: AppURLDiagnostic[];
+  /**
+   * error_code classifies the error, e.g. GUARDRAIL_EXCEEDED, so coderd
+   * can tell it apart from other plan failures.
+   */
+  errorCode: string;
+}
+
+/**
+ * AppURLDiagnostic is a warning about the url of a coder_app that can't be
+ * proxied as configured. Builds don't fail on them, since the app may still
+ * work, e.g. if the url is only used on some operating systems.
+ */
+export interface AppURLDiagnostic {
+  /** app is the slug of the app. */
+  app: string;
+  url: string;
+  /** summary describes the problem. */
+  summary: string;
+  /** fix describes how to change the template to fix the problem. */
+  fix: string;
 }
 
 /**
@@ -269,6 +525,63 @@ export interface ApplyRequest {
   metadata: Metadata | undefined;
 }
 
+/**
+ * DiagnosticBundle collects the diagnostics of a failed build, so support
+ * escalations are self-contained.
+ */
+export interface DiagnosticBundle {
+  /**
+   * plan_json is the plan of the build as JSON, with variable and sensitive
+   * values redacted.
+   */
+  planJson: Uint8Array;
+  /** graph is the dependency graph of the template in DOT format. */
+  graph: string;
+  /** logs are the last provisioner logs of the build. */
+  logs: Log[];
+  terraformVersion: string;
+  /**
+   * environment summarizes the host and the terraform environment
+   * variables of the provisioner, with values that may be secrets redacted.
+   */
+  environment: { [key: string]: string };
+  /** errors are the reasons parts of the bundle are missing. */
+  errors: string[];
+  /** work_directory lists the files of the work directory of the session. */
+  workDirectory: WorkDirectoryListing | undefined;
+}
+
+export interface DiagnosticBundle_EnvironmentEntry {
+  key: string;
+  value: string;
+}
+
+/**
+ * WorkDirectoryListing lists the files of the work directory of a failed
+ * session, since debugging a failed build otherwise requires a shell on the
+ * provisioner host.
+ */
+export interface WorkDirectoryListing {
+  /** path is the path of the work directory on the provisioner host. */
+  path: string;
+  entries: WorkDirectoryListing_Entry[];
+  /** truncated is set when the directory has more entries than listed. */
+  truncated: boolean;
+  /**
+   * kept is set when the work directory is kept on the provisioner host
+   * after the session ended.
+   */
+  kept: boolean;
+}
+
+export interface WorkDirectoryListing_Entry {
+  /** path is relative to the work directory, separated by slashes. */
+  path: string;
+  size: number;
+  /** mode is the file mode in the format of ls, e.g. "-rw-r--r--". */
+  mode: string;
+}
+
 /** ApplyComplete indicates a request to apply completed. */
 export interface ApplyComplete {
   state: Uint8Array;
@@ -276,6 +589,35 @@ export interface ApplyComplete {
   resources: Resource[];
   parameters: RichParameter[];
   externalAuthProviders: string[];
+  network: WorkspaceNetwork | undefined;
+  /** diagnostic_bundle is set when the apply failed. */
+  diagnosticBundle: DiagnosticBundle | undefined;
+  /**
+   * workspace_metadata are the outputs of the template, in the order of
+   * their names. The values of sensitive outputs are redacted.
+   */
+  workspaceMetadata: Resource_Metadata[];
+  /**
+   * capacity_fallback is set when the template falls back to alternate
+   * capacity options, see coder_capacity_fallback.
+   */
+  capacityFallback: CapacityFallback | undefined;
+  topology: Topology | undefined;
+}
+
+/**
+ * CapacityFallback records the capacity options an apply tried in order,
+ * e.g. spot before on-demand instances, and the option it succeeded with.
+ */
+export interface CapacityFallback {
+  attempts: CapacityFallback_Attempt[];
+  selected: string;
+}
+
+export interface CapacityFallback_Attempt {
+  option: string;
+  /** error is the capacity error the apply with the option failed with. */
+  error: string;
 }
 
 /** CancelRequest requests that the previous request be canceled gracefully. */
@@ -294,6 +636,8 @@ export interface Response {
   parse?: ParseComplete | undefined;
   plan?: PlanComplete | undefined;
   apply?: ApplyComplete | undefined;
+  checkpoint?: Checkpoint | undefined;
+  buildStage?: BuildStage | undefined;
 }
 
 export const Empty = {
@@ -403,6 +747,9 @@ export const RichParameter = {
     if (message.ephemeral === true) {
       writer.uint32(136).bool(message.ephemeral);
     }
+    if (message.defaultSource !== 0) {
+      writer.uint32(144).int32(message.defaultSource);
+    }
     return writer;
   },
 };
@@ -418,6 +765,9 @@ export const RichParameterValue = {
     if (message.value !== "") {
       writer.uint32(18).string(message.value);
     }
+    if (message.source !== 0) {
+      writer.uint32(24).int32(message.source);
+    }
     return writer;
   },
 };
@@ -535,6 +885,15 @@ export const Agent = {
     for (const v of message.extraEnvs) {
       Env.encode(v!, writer.uint32(178).fork()).ldelim();
     }
+    for (const v of message.unknownAttributes) {
+      writer.uint32(186).string(v!);
+    }
+    if (message.troubleshootingUrls !== undefined) {
+      TroubleshootingURLs.encode(
+        message.troubleshootingUrls,
+        writer.uint32(194).fork(),
+      ).ldelim();
+    }
     return writer;
   },
 };
@@ -562,6 +921,9 @@ export const Agent_Metadata = {
     if (message.order !== 0) {
       writer.uint32(48).int64(message.order);
     }
+    if (message.collector !== "") {
+      writer.uint32(58).string(message.collector);
+    }
     return writer;
   },
 };
@@ -605,6 +967,24 @@ export const DisplayApps = {
   },
 };
 
+export const TroubleshootingURLs = {
+  encode(
+    message: TroubleshootingURLs,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.connectionTimeout !== "") {
+      writer.uint32(10).string(message.connectionTimeout);
+    }
+    if (message.startError !== "") {
+      writer.uint32(18).string(message.startError);
+    }
+    if (message.tokenInvalid !== "") {
+      writer.uint32(26).string(message.tokenInvalid);
+    }
+    return writer;
+  },
+};
+
 export const Env = {
   encode(message: Env, writer: _m0.Writer = _m0.Writer.create()): _m0.Writer {
     if (message.name !== "") {
@@ -649,6 +1029,24 @@ export const Script = {
     if (message.logPath !== "") {
       writer.uint32(74).string(message.logPath);
     }
+    if (message.runOnBuildSuccess === true) {
+      writer.uint32(80).bool(message.runOnBuildSuccess);
+    }
+    if (message.runOnBuildFailure === true) {
+      writer.uint32(88).bool(message.runOnBuildFailure);
+    }
+    if (message.runOnPostStart === true) {
+      writer.uint32(96).bool(message.runOnPostStart);
+    }
+    if (message.login === true) {
+      writer.uint32(104).bool(message.login);
+    }
+    if (message.diskPressurePath !== "") {
+      writer.uint32(114).string(message.diskPressurePath);
+    }
+    if (message.diskPressureThreshold !== 0) {
+      writer.uint32(120).int32(message.diskPressureThreshold);
+    }
     return writer;
   },
 };
@@ -688,6 +1086,9 @@ export const App = {
     if (message.order !== 0) {
       writer.uint32(80).int64(message.order);
     }
+    for (const v of message.unknownAttributes) {
+      writer.uint32(90).string(v!);
+    }
     return writer;
   },
 };
@@ -739,6 +1140,15 @@ export const Resource = {
     if (message.dailyCost !== 0) {
       writer.uint32(64).int32(message.dailyCost);
     }
+    for (const v of message.accelerators) {
+      Resource_Accelerator.encode(v!, writer.uint32(74).fork()).ldelim();
+    }
+    if (message.action !== 0) {
+      writer.uint32(80).int32(message.action);
+    }
+    if (message.address !== "") {
+      writer.uint32(90).string(message.address);
+    }
     return writer;
   },
 };
@@ -760,6 +1170,102 @@ export const Resource_Metadata = {
     if (message.isNull === true) {
       writer.uint32(32).bool(message.isNull);
     }
+    if (message.order !== 0) {
+      writer.uint32(40).int64(message.order);
+    }
+    if (message.group !== "") {
+      writer.uint32(50).string(message.group);
+    }
+    return writer;
+  },
+};
+
+export const Resource_Accelerator = {
+  encode(
+    message: Resource_Accelerator,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.vendor !== "") {
+      writer.uint32(10).string(message.vendor);
+    }
+    if (message.model !== "") {
+      writer.uint32(18).string(message.model);
+    }
+    if (message.count !== 0) {
+      writer.uint32(24).int32(message.count);
+    }
+    return writer;
+  },
+};
+
+export const WorkspaceNetwork = {
+  encode(
+    message: WorkspaceNetwork,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.preferredDerpRegion !== "") {
+      writer.uint32(10).string(message.preferredDerpRegion);
+    }
+    if (message.disableDirectConnections === true) {
+      writer.uint32(16).bool(message.disableDirectConnections);
+    }
+    if (message.mtu !== 0) {
+      writer.uint32(24).int32(message.mtu);
+    }
+    return writer;
+  },
+};
+
+export const Topology = {
+  encode(
+    message: Topology,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    for (const v of message.nodes) {
+      Topology_Node.encode(v!, writer.uint32(10).fork()).ldelim();
+    }
+    for (const v of message.edges) {
+      Topology_Edge.encode(v!, writer.uint32(18).fork()).ldelim();
+    }
+    return writer;
+  },
+};
+
+export const Topology_Node = {
+  encode(
+    message: Topology_Node,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.id !== "") {
+      writer.uint32(10).string(message.id);
+    }
+    if (message.kind !== "") {
+      writer.uint32(18).string(message.kind);
+    }
+    if (message.type !== "") {
+      writer.uint32(26).string(message.type);
+    }
+    if (message.name !== "") {
+      writer.uint32(34).string(message.name);
+    }
+    if (message.icon !== "") {
+      writer.uint32(42).string(message.icon);
+    }
+    return writer;
+  },
+};
+
+export const Topology_Edge = {
+  encode(
+    message: Topology_Edge,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.from !== "") {
+      writer.uint32(10).string(message.from);
+    }
+    if (message.to !== "") {
+      writer.uint32(18).string(message.to);
+    }
     return writer;
   },
 };
@@ -808,6 +1314,24 @@ export const Metadata = {
     if (message.workspaceOwnerName !== "") {
       writer.uint32(106).string(message.workspaceOwnerName);
     }
+    if (message.maxAppSharingLevel !== "") {
+      writer.uint32(114).string(message.maxAppSharingLevel);
+    }
+    if (message.capacityOption !== "") {
+      writer.uint32(122).string(message.capacityOption);
+    }
+    if (message.workspaceAppHostname !== "") {
+      writer.uint32(130).string(message.workspaceAppHostname);
+    }
+    for (const v of message.workspaceOwnerGroups) {
+      writer.uint32(138).string(v!);
+    }
+    if (message.replaceOnFailure === true) {
+      writer.uint32(144).bool(message.replaceOnFailure);
+    }
+    for (const v of message.replaceResources) {
+      writer.uint32(154).string(v!);
+    }
     return writer;
   },
 };
@@ -839,6 +1363,27 @@ export const ParseRequest = {
   },
 };
 
+export const TemplateMetadata = {
+  encode(
+    message: TemplateMetadata,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.displayName !== "") {
+      writer.uint32(10).string(message.displayName);
+    }
+    if (message.icon !== "") {
+      writer.uint32(18).string(message.icon);
+    }
+    if (message.description !== "") {
+      writer.uint32(26).string(message.description);
+    }
+    if (message.docsUrl !== "") {
+      writer.uint32(34).string(message.docsUrl);
+    }
+    return writer;
+  },
+};
+
 export const ParseComplete = {
   encode(
     message: ParseComplete,
@@ -853,6 +1398,57 @@ export const ParseComplete = {
     if (message.readme.length !== 0) {
       writer.uint32(26).bytes(message.readme);
     }
+    if (message.templateMetadata !== undefined) {
+      TemplateMetadata.encode(
+        message.templateMetadata,
+        writer.uint32(34).fork(),
+      ).ldelim();
+    }
+    return writer;
+  },
+};
+
+export const Checkpoint = {
+  encode(
+    message: Checkpoint,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.stage !== "") {
+      writer.uint32(10).string(message.stage);
+    }
+    Object.entries(message.files).forEach(([key, value]) => {
+      Checkpoint_FilesEntry.encode(
+        { key: key as any, value },
+        writer.uint32(18).fork(),
+      ).ldelim();
+    });
+    return writer;
+  },
+};
+
+export const Checkpoint_FilesEntry = {
+  encode(
+    message: Checkpoint_FilesEntry,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.key !== "") {
+      writer.uint32(10).string(message.key);
+    }
+    if (message.value.length !== 0) {
+      writer.uint32(18).bytes(message.value);
+    }
+    return writer;
+  },
+};
+
+export const BuildStage = {
+  encode(
+    message: BuildStage,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.name !== "") {
+      writer.uint32(10).string(message.name);
+    }
     return writer;
   },
 };
@@ -874,6 +1470,12 @@ export const PlanRequest = {
     for (const v of message.externalAuthProviders) {
       ExternalAuthProvider.encode(v!, writer.uint32(34).fork()).ldelim();
     }
+    if (message.checkpoint !== undefined) {
+      Checkpoint.encode(message.checkpoint, writer.uint32(42).fork()).ldelim();
+    }
+    if (message.refreshOnly === true) {
+      writer.uint32(48).bool(message.refreshOnly);
+    }
     return writer;
   },
 };
@@ -895,6 +1497,51 @@ export const PlanComplete = {
     for (const v of message.externalAuthProviders) {
       writer.uint32(34).string(v!);
     }
+    if (message.network !== undefined) {
+      WorkspaceNetwork.encode(
+        message.network,
+        writer.uint32(42).fork(),
+      ).ldelim();
+    }
+    if (message.topology !== undefined) {
+      Topology.encode(message.topology, writer.uint32(50).fork()).ldelim();
+    }
+    if (message.parameterSchema.length !== 0) {
+      writer.uint32(58).bytes(message.parameterSchema);
+    }
+    if (message.diagnosticBundle !== undefined) {
+      DiagnosticBundle.encode(
+        message.diagnosticBundle,
+        writer.uint32(66).fork(),
+      ).ldelim();
+    }
+    for (const v of message.appUrlDiagnostics) {
+      AppURLDiagnostic.encode(v!, writer.uint32(74).fork()).ldelim();
+    }
+    if (message.errorCode !== "") {
+      writer.uint32(82).string(message.errorCode);
+    }
+    return writer;
+  },
+};
+
+export const AppURLDiagnostic = {
+  encode(
+    message: AppURLDiagnostic,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.app !== "") {
+      writer.uint32(10).string(message.app);
+    }
+    if (message.url !== "") {
+      writer.uint32(18).string(message.url);
+    }
+    if (message.summary !== "") {
+      writer.uint32(26).string(message.summary);
+    }
+    if (message.fix !== "") {
+      writer.uint32(34).string(message.fix);
+    }
     return writer;
   },
 };
@@ -911,6 +1558,96 @@ export const ApplyRequest = {
   },
 };
 
+export const DiagnosticBundle = {
+  encode(
+    message: DiagnosticBundle,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.planJson.length !== 0) {
+      writer.uint32(10).bytes(message.planJson);
+    }
+    if (message.graph !== "") {
+      writer.uint32(18).string(message.graph);
+    }
+    for (const v of message.logs) {
+      Log.encode(v!, writer.uint32(26).fork()).ldelim();
+    }
+    if (message.terraformVersion !== "") {
+      writer.uint32(34).string(message.terraformVersion);
+    }
+    Object.entries(message.environment).forEach(([key, value]) => {
+      DiagnosticBundle_EnvironmentEntry.encode(
+        { key: key as any, value },
+        writer.uint32(42).fork(),
+      ).ldelim();
+    });
+    for (const v of message.errors) {
+      writer.uint32(50).string(v!);
+    }
+    if (message.workDirectory !== undefined) {
+      WorkDirectoryListing.encode(
+        message.workDirectory,
+        writer.uint32(58).fork(),
+      ).ldelim();
+    }
+    return writer;
+  },
+};
+
+export const DiagnosticBundle_EnvironmentEntry = {
+  encode(
+    message: DiagnosticBundle_EnvironmentEntry,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.key !== "") {
+      writer.uint32(10).string(message.key);
+    }
+    if (message.value !== "") {
+      writer.uint32(18).string(message.value);
+    }
+    return writer;
+  },
+};
+
+export const WorkDirectoryListing = {
+  encode(
+    message: WorkDirectoryListing,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.path !== "") {
+      writer.uint32(10).string(message.path);
+    }
+    for (const v of message.entries) {
+      WorkDirectoryListing_Entry.encode(v!, writer.uint32(18).fork()).ldelim();
+    }
+    if (message.truncated === true) {
+      writer.uint32(24).bool(message.truncated);
+    }
+    if (message.kept === true) {
+      writer.uint32(32).bool(message.kept);
+    }
+    return writer;
+  },
+};
+
+export const WorkDirectoryListing_Entry = {
+  encode(
+    message: WorkDirectoryListing_Entry,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.path !== "") {
+      writer.uint32(10).string(message.path);
+    }
+    if (message.size !== 0) {
+      writer.uint32(16).int64(message.size);
+    }
+    if (message.mode !== "") {
+      writer.uint32(26).string(message.mode);
+    }
+    return writer;
+  },
+};
+
 export const ApplyComplete = {
   encode(
     message: ApplyComplete,
@@ -931,6 +1668,60 @@ export const ApplyComplete = {
     for (const v of message.externalAuthProviders) {
       writer.uint32(42).string(v!);
     }
+    if (message.network !== undefined) {
+      WorkspaceNetwork.encode(
+        message.network,
+        writer.uint32(50).fork(),
+      ).ldelim();
+    }
+    if (message.diagnosticBundle !== undefined) {
+      DiagnosticBundle.encode(
+        message.diagnosticBundle,
+        writer.uint32(58).fork(),
+      ).ldelim();
+    }
+    for (const v of message.workspaceMetadata) {
+      Resource_Metadata.encode(v!, writer.uint32(66).fork()).ldelim();
+    }
+    if (message.capacityFallback !== undefined) {
+      CapacityFallback.encode(
+        message.capacityFallback,
+        writer.uint32(74).fork(),
+      ).ldelim();
+    }
+    if (message.topology !== undefined) {
+      Topology.encode(message.topology, writer.uint32(82).fork()).ldelim();
+    }
+    return writer;
+  },
+};
+
+export const CapacityFallback = {
+  encode(
+    message: CapacityFallback,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    for (const v of message.attempts) {
+      CapacityFallback_Attempt.encode(v!, writer.uint32(10).fork()).ldelim();
+    }
+    if (message.selected !== "") {
+      writer.uint32(18).string(message.selected);
+    }
+    return writer;
+  },
+};
+
+export const CapacityFallback_Attempt = {
+  encode(
+    message: CapacityFallback_Attempt,
+    writer: _m0.Writer = _m0.Writer.create(),
+  ): _m0.Writer {
+    if (message.option !== "") {
+      writer.uint32(10).string(message.option);
+    }
+    if (message.error !== "") {
+      writer.uint32(18).string(message.error);
+    }
     return writer;
   },
 };
@@ -985,6 +1776,12 @@ export const Response = {
     if (message.apply !== undefined) {
       ApplyComplete.encode(message.apply, writer.uint32(34).fork()).ldelim();
     }
+    if (message.checkpoint !== undefined) {
+      Checkpoint.encode(message.checkpoint, writer.uint32(42).fork()).ldelim();
+    }
+    if (message.buildStage !== undefined) {
+      BuildStage.encode(message.buildStage, writer.uint32(50).fork()).ldelim();
+    }
     return writer;
   },
 };
@@ -5,12 +5,14 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha1" //#nosec // Not used for cryptography.
+	"crypto/sha256"
 	"database/sql"
 	_ "embed"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"html"
 	htmltemplate "html/template"
 	"io"
@@ -80,6 +82,7 @@ func New(opts *Options) *Handler {
 	handler := &Handler{
 		opts:          opts,
 		secureHeaders: secureHeaders(),
+		binSHA256:     newBinHashCache(opts.BinFS, nil, sha256.New),
 	}
 
 	// html files are handled by a text/template. Non-html files
@@ -90,7 +93,7 @@ func New(opts *Options) *Handler {
 		panic(fmt.Sprintf("Failed to parse html files: %v", err))
 	}
 
-	binHashCache := newBinHashCache(opts.BinFS, opts.BinHashes)
+	binHashCache := newBinHashCache(opts.BinFS, opts.BinHashes, sha1.New)
 
 	mux := http.NewServeMux()
 	mux.Handle("/bin/", http.StripPrefix("/bin", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
@@ -153,6 +156,7 @@ type Handler struct {
 	htmlTemplates *template.Template
 
 	buildInfoJSON string
+	binSHA256     *binHashCache
 
 	// RegionsFetcher will attempt to fetch the more detailed WorkspaceProxy data, but will fall back to the
 	// regions if the user does not have the correct permissions.
@@ -803,8 +807,19 @@ func RenderStaticErrorPage(rw http.ResponseWriter, r *http.Request, data ErrorPa
 	}
 }
 
+// BinarySHA256 returns the hex-encoded SHA256 checksum of the binary served
+// at /bin/<name>, e.g. "coder-linux-amd64". Agents verify their updates with
+// it.
+func (h *Handler) BinarySHA256(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", os.ErrNotExist
+	}
+	return h.binSHA256.getHash(name)
+}
+
 type binHashCache struct {
-	binFS http.FileSystem
+	binFS   http.FileSystem
+	newHash func() hash.Hash
 
 	hashes map[string]string
 	mut    sync.RWMutex
@@ -812,13 +827,14 @@ type binHashCache struct {
 	sem    chan struct{}
 }
 
-func newBinHashCache(binFS http.FileSystem, binHashes map[string]string) *binHashCache {
+func newBinHashCache(binFS http.FileSystem, binHashes map[string]string, newHash func() hash.Hash) *binHashCache {
 	b := &binHashCache{
-		binFS:  binFS,
-		hashes: make(map[string]string, len(binHashes)),
-		mut:    sync.RWMutex{},
-		sf:     singleflight.Group{},
-		sem:    make(chan struct{}, 4),
+		binFS:   binFS,
+		newHash: newHash,
+		hashes:  make(map[string]string, len(binHashes)),
+		mut:     sync.RWMutex{},
+		sf:      singleflight.Group{},
+		sem:     make(chan struct{}, 4),
 	}
 	// Make a copy since we're gonna be mutating it.
 	for k, v := range binHashes {
@@ -847,7 +863,7 @@ func (b *binHashCache) getHash(name string) (string, error) {
 		}
 		defer f.Close()
 
-		h := sha1.New() //#nosec // Not used for cryptography.
+		h := b.newHash()
 		_, err = io.Copy(h, f)
 		if err != nil {
 			return "", err
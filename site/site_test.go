@@ -3,6 +3,8 @@ package site_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html"
@@ -512,6 +514,30 @@ func TestServingBin(t *testing.T) {
 	}
 }
 
+func TestBinarySHA256(t *testing.T) {
+	t.Parallel()
+
+	binary := []byte("coder-linux-amd64-bytes")
+	handler := site.New(&site.Options{
+		BinFS: http.FS(fstest.MapFS{
+			"coder-linux-amd64": &fstest.MapFile{Data: binary},
+		}),
+		SiteFS: fstest.MapFS{
+			"index.html": &fstest.MapFile{Data: []byte("index-bytes")},
+		},
+	})
+
+	sum := sha256.Sum256(binary)
+	got, err := handler.BinarySHA256("coder-linux-amd64")
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(sum[:]), got)
+
+	_, err = handler.BinarySHA256("coder-windows-amd64.exe")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = handler.BinarySHA256("../coder-linux-amd64")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
 func TestExtractOrReadBinFS(t *testing.T) {
 	t.Parallel()
 	t.Run("DoubleExtractDoesNotModifyFiles", func(t *testing.T) {
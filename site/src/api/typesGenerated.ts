@@ -32,6 +32,13 @@ export interface AddLicenseRequest {
   readonly license: string;
 }
 
+// From codersdk/deployment.go
+export interface AgentExecPolicyRule {
+  readonly action: string;
+  readonly prefix?: string;
+  readonly regex?: string;
+}
+
 // From codersdk/templates.go
 export interface AgentStatsReportResponse {
   readonly num_comms: number;
@@ -343,6 +350,7 @@ export interface DERPConfig {
   readonly force_websockets: boolean;
   readonly url: string;
   readonly path: string;
+  readonly fallback_paths: string[];
 }
 
 // From codersdk/workspaceagents.go
@@ -440,6 +448,22 @@ export interface DeploymentValues {
   readonly allow_workspace_renames?: boolean;
   readonly healthcheck?: HealthcheckConfig;
   readonly cli_upgrade_message?: string;
+  readonly agent_exec_policy?: AgentExecPolicyRule[];
+  readonly agent_reconnecting_pty_persistence?: boolean;
+  readonly agent_reconnecting_pty_scrollback_lines?: number;
+  readonly agent_http_proxy?: string;
+  readonly agent_https_proxy?: string;
+  readonly agent_no_proxy?: string;
+  readonly agent_motd_template?: string;
+  readonly agent_code_server_version?: string;
+  readonly agent_code_server_port?: number;
+  readonly agent_code_server_extensions?: string[];
+  readonly agent_code_server_checksums?: string[];
+  readonly agent_ssh_keepalive_interval?: number;
+  readonly agent_ssh_keepalive_count_max?: number;
+  readonly agent_update_channel?: string;
+  readonly agent_update_version_range?: string;
+  readonly agent_update_binary_url?: string;
   readonly config?: string;
   readonly write_config?: boolean;
   readonly address?: string;
@@ -825,6 +849,17 @@ export interface PrometheusConfig {
   readonly collect_db_metrics: boolean;
 }
 
+// From codersdk/deployment.go
+export interface ProviderCredentialsConfig {
+  readonly type: string;
+  readonly external_auth_id: string;
+  readonly role_arn: string;
+  readonly audience: string;
+  readonly service_account: string;
+  readonly client_id: string;
+  readonly tenant_id: string;
+}
+
 // From codersdk/deployment.go
 export interface ProvisionerConfig {
   readonly daemons: number;
@@ -833,6 +868,25 @@ export interface ProvisionerConfig {
   readonly daemon_poll_jitter: number;
   readonly force_cancel_interval: number;
   readonly daemon_psk: string;
+  readonly sandbox: string;
+  readonly sandbox_seccomp_profile: string;
+  readonly sandbox_egress_allowlist: string[];
+  readonly prewarm_templates: number;
+  readonly prewarm_max_size_mb: number;
+  readonly provider_credentials: ProviderCredentialsConfig[];
+  readonly max_resources: number;
+  readonly max_destroys: number;
+  readonly filesystem_mirrors: string[];
+  readonly network_mirrors: string[];
+  readonly max_apply_retries: number;
+  readonly secrets_resolvers: string[];
+  readonly verify_providers: boolean;
+  readonly trusted_provider_hashes: string[];
+  readonly work_directory_keep_on_failure: boolean;
+  readonly work_directory_ttl: number;
+  readonly work_directory_max_disk: number;
+  readonly hang_timeout: number;
+  readonly data_source_timeout: number;
 }
 
 // From codersdk/provisionerdaemons.go
@@ -892,6 +946,14 @@ export interface PutOAuth2ProviderAppRequest {
   readonly icon: string;
 }
 
+// From codersdk/workspaceagentconn.go
+export interface PutWorkspaceAgentScheduledTaskRequest {
+  readonly name: string;
+  readonly cron: string;
+  readonly script: string;
+  readonly timeout_seconds: number;
+}
+
 // From codersdk/deployment.go
 export interface RateLimitConfig {
   readonly disable_all: boolean;
@@ -1026,7 +1088,11 @@ export interface Template {
   readonly description: string;
   readonly deprecated: boolean;
   readonly deprecation_message: string;
+  readonly max_app_sharing_level: WorkspaceAppSharingLevel;
+  readonly code_server_enabled: boolean;
+  readonly replace_on_failure: boolean;
   readonly icon: string;
+  readonly docs_url: string;
   readonly default_ttl_ms: number;
   readonly use_max_ttl: boolean;
   readonly max_ttl_ms: number;
@@ -1299,6 +1365,9 @@ export interface UpdateTemplateMeta {
   readonly require_active_version: boolean;
   readonly deprecation_message?: string;
   readonly disable_everyone_group_access: boolean;
+  readonly max_app_sharing_level?: WorkspaceAppSharingLevel;
+  readonly code_server_enabled?: boolean;
+  readonly replace_on_failure?: boolean;
 }
 
 // From codersdk/users.go
@@ -1306,6 +1375,12 @@ export interface UpdateUserAppearanceSettingsRequest {
   readonly theme_preference: string;
 }
 
+// From codersdk/authorizedkeys.go
+export interface UpdateUserAuthorizedKeysRequest {
+  readonly keys: UserAuthorizedKey[];
+  readonly required: boolean;
+}
+
 // From codersdk/users.go
 export interface UpdateUserPasswordRequest {
   readonly old_password: string;
@@ -1404,6 +1479,19 @@ export interface UserActivityInsightsResponse {
   readonly report: UserActivityInsightsReport;
 }
 
+// From codersdk/authorizedkeys.go
+export interface UserAuthorizedKey {
+  readonly public_key: string;
+  readonly principals?: string[];
+}
+
+// From codersdk/authorizedkeys.go
+export interface UserAuthorizedKeys {
+  readonly keys: UserAuthorizedKey[];
+  readonly required: boolean;
+  readonly updated_at: string;
+}
+
 // From codersdk/insights.go
 export interface UserLatency {
   readonly template_ids: string[];
@@ -1438,6 +1526,20 @@ export interface UserLoginType {
   readonly login_type: LoginType;
 }
 
+// From codersdk/usernotifications.go
+export interface UserNotification {
+  readonly workspace_id: string;
+  readonly workspace_name: string;
+  readonly agent_id: string;
+  readonly agent_name: string;
+  readonly severity: UserNotificationSeverity;
+  readonly kind: string;
+  readonly title: string;
+  readonly message: string;
+  readonly created_at: string;
+  readonly labels?: Record<string, string>;
+}
+
 // From codersdk/users.go
 export interface UserParameter {
   readonly name: string;
@@ -1541,6 +1643,7 @@ export interface WorkspaceAgent {
   readonly latency?: Record<string, DERPRegion>;
   readonly connection_timeout_seconds: number;
   readonly troubleshooting_url: string;
+  readonly troubleshooting_urls: WorkspaceAgentTroubleshootingURLs;
   readonly subsystems: AgentSubsystem[];
   readonly health: WorkspaceAgentHealth;
   readonly display_apps: DisplayApp[];
@@ -1574,6 +1677,8 @@ export interface WorkspaceAgentLog {
   readonly output: string;
   readonly level: LogLevel;
   readonly source_id: string;
+  readonly fields?: Record<string, string>;
+  readonly stream?: LogStream;
 }
 
 // From codersdk/workspaceagents.go
@@ -1585,6 +1690,14 @@ export interface WorkspaceAgentLogSource {
   readonly icon: string;
 }
 
+// From codersdk/workspaceagents.go
+export interface WorkspaceAgentLogsRequest {
+  readonly after?: number;
+  readonly limit?: number;
+  readonly level?: LogLevel[];
+  readonly log_source_ids?: string[];
+}
+
 // From codersdk/workspaceagents.go
 export interface WorkspaceAgentMetadata {
   readonly result: WorkspaceAgentMetadataResult;
@@ -1598,6 +1711,7 @@ export interface WorkspaceAgentMetadataDescription {
   readonly script: string;
   readonly interval: number;
   readonly timeout: number;
+  readonly collector?: WorkspaceAgentMetadataCollector;
 }
 
 // From codersdk/workspaceagents.go
@@ -1608,6 +1722,17 @@ export interface WorkspaceAgentMetadataResult {
   readonly error: string;
 }
 
+// From codersdk/workspaceagentconn.go
+export interface WorkspaceAgentScheduledTask {
+  readonly id: string;
+  readonly name: string;
+  readonly cron: string;
+  readonly script: string;
+  readonly timeout_seconds: number;
+  readonly created_at: string;
+  readonly updated_at: string;
+}
+
 // From codersdk/workspaceagents.go
 export interface WorkspaceAgentScript {
   readonly log_source_id: string;
@@ -1618,6 +1743,28 @@ export interface WorkspaceAgentScript {
   readonly run_on_stop: boolean;
   readonly start_blocks_login: boolean;
   readonly timeout: number;
+  readonly run_on_build_success?: boolean;
+  readonly run_on_build_failure?: boolean;
+  readonly run_on_post_start?: boolean;
+  readonly login?: boolean;
+  readonly disk_pressure_path?: string;
+  readonly disk_pressure_threshold?: number;
+  readonly display_name?: string;
+}
+
+// From codersdk/workspaceagents.go
+export interface WorkspaceAgentScriptArtifact {
+  readonly id: string;
+  readonly log_source_id: string;
+  readonly size: number;
+  readonly created_at: string;
+}
+
+// From codersdk/workspaceagents.go
+export interface WorkspaceAgentTroubleshootingURLs {
+  readonly connection_timeout: string;
+  readonly start_error: string;
+  readonly token_invalid: string;
 }
 
 // From codersdk/workspaceapps.go
@@ -1634,6 +1781,14 @@ export interface WorkspaceApp {
   readonly sharing_level: WorkspaceAppSharingLevel;
   readonly healthcheck: Healthcheck;
   readonly health: WorkspaceAppHealth;
+  readonly health_report?: WorkspaceAppHealthReport;
+}
+
+// From codersdk/workspaceapps.go
+export interface WorkspaceAppHealthReport {
+  readonly latency_ms: number;
+  readonly error?: string;
+  readonly checked_at: string;
 }
 
 // From codersdk/workspacebuilds.go
@@ -1661,10 +1816,54 @@ export interface WorkspaceBuild {
   readonly daily_cost: number;
 }
 
+// From codersdk/workspacebuilds.go
+export interface WorkspaceBuildCapacityAttempt {
+  readonly option: string;
+  readonly error: string;
+}
+
+// From codersdk/workspacebuilds.go
+export interface WorkspaceBuildCapacityFallback {
+  readonly selected: string;
+  readonly attempts: WorkspaceBuildCapacityAttempt[];
+}
+
+// From codersdk/workspacebuilds.go
+export interface WorkspaceBuildDiagnosticBundle {
+  readonly plan_json?: Record<string, string>;
+  readonly graph: string;
+  readonly logs: WorkspaceBuildDiagnosticLog[];
+  readonly terraform_version: string;
+  readonly environment: Record<string, string>;
+  readonly errors: string[];
+}
+
+// From codersdk/workspacebuilds.go
+export interface WorkspaceBuildDiagnosticLog {
+  readonly level: LogLevel;
+  readonly output: string;
+}
+
 // From codersdk/workspacebuilds.go
 export interface WorkspaceBuildParameter {
   readonly name: string;
   readonly value: string;
+  readonly source?: WorkspaceBuildParameterSource;
+}
+
+// From codersdk/workspacebuilds.go
+export interface WorkspaceBuildWorkDirectory {
+  readonly path: string;
+  readonly entries: WorkspaceBuildWorkDirectoryEntry[];
+  readonly truncated: boolean;
+  readonly kept: boolean;
+}
+
+// From codersdk/workspacebuilds.go
+export interface WorkspaceBuildWorkDirectoryEntry {
+  readonly path: string;
+  readonly size: number;
+  readonly mode: string;
 }
 
 // From codersdk/workspaces.go
@@ -1749,6 +1948,7 @@ export interface WorkspaceResource {
   readonly agents?: WorkspaceAgent[];
   readonly metadata?: WorkspaceResourceMetadata[];
   readonly daily_cost: number;
+  readonly action?: WorkspaceResourceAction;
 }
 
 // From codersdk/workspacebuilds.go
@@ -1756,6 +1956,8 @@ export interface WorkspaceResourceMetadata {
   readonly key: string;
   readonly value: string;
   readonly sensitive: boolean;
+  readonly order?: number;
+  readonly group?: string;
 }
 
 // From codersdk/workspaces.go
@@ -1926,8 +2128,11 @@ export const InsightsReportIntervals: InsightsReportInterval[] = [
 ];
 
 // From codersdk/provisionerdaemons.go
-export type JobErrorCode = "REQUIRED_TEMPLATE_VARIABLES";
-export const JobErrorCodes: JobErrorCode[] = ["REQUIRED_TEMPLATE_VARIABLES"];
+export type JobErrorCode = "GUARDRAIL_EXCEEDED" | "REQUIRED_TEMPLATE_VARIABLES";
+export const JobErrorCodes: JobErrorCode[] = [
+  "GUARDRAIL_EXCEEDED",
+  "REQUIRED_TEMPLATE_VARIABLES",
+];
 
 // From codersdk/provisionerdaemons.go
 export type LogLevel = "debug" | "error" | "info" | "trace" | "warn";
@@ -1943,6 +2148,10 @@ export const LogLevels: LogLevel[] = [
 export type LogSource = "provisioner" | "provisioner_daemon";
 export const LogSources: LogSource[] = ["provisioner", "provisioner_daemon"];
 
+// From codersdk/workspaceagents.go
+export type LogStream = "stderr" | "stdout";
+export const LogStreams: LogStream[] = ["stderr", "stdout"];
+
 // From codersdk/apikey.go
 export type LoginType = "" | "github" | "none" | "oidc" | "password" | "token";
 export const LoginTypes: LoginType[] = [
@@ -2111,6 +2320,14 @@ export const TemplateVersionWarnings: TemplateVersionWarning[] = [
   "UNSUPPORTED_WORKSPACES",
 ];
 
+// From codersdk/usernotifications.go
+export type UserNotificationSeverity = "error" | "info" | "warning";
+export const UserNotificationSeverities: UserNotificationSeverity[] = [
+  "error",
+  "info",
+  "warning",
+];
+
 // From codersdk/users.go
 export type UserStatus = "active" | "dormant" | "suspended";
 export const UserStatuses: UserStatus[] = ["active", "dormant", "suspended"];
@@ -2145,6 +2362,38 @@ export const WorkspaceAgentLifecycles: WorkspaceAgentLifecycle[] = [
   "starting",
 ];
 
+// From codersdk/workspaceagents.go
+export type WorkspaceAgentLogEvent = "group_end" | "group_start" | "progress";
+export const WorkspaceAgentLogEvents: WorkspaceAgentLogEvent[] = [
+  "group_end",
+  "group_start",
+  "progress",
+];
+
+// From codersdk/workspaceagents.go
+export type WorkspaceAgentMetadataCollector = "cpu" | "disk" | "memory";
+export const WorkspaceAgentMetadataCollectors: WorkspaceAgentMetadataCollector[] =
+  ["cpu", "disk", "memory"];
+
+// From codersdk/workspaceagents.go
+export type WorkspaceAgentScriptStage =
+  | "build_failure"
+  | "build_success"
+  | "cron"
+  | "disk_pressure"
+  | "post_start"
+  | "start"
+  | "stop";
+export const WorkspaceAgentScriptStages: WorkspaceAgentScriptStage[] = [
+  "build_failure",
+  "build_success",
+  "cron",
+  "disk_pressure",
+  "post_start",
+  "start",
+  "stop",
+];
+
 // From codersdk/workspaceagents.go
 export type WorkspaceAgentStartupScriptBehavior = "blocking" | "non-blocking";
 export const WorkspaceAgentStartupScriptBehaviors: WorkspaceAgentStartupScriptBehavior[] =
@@ -2184,6 +2433,29 @@ export const WorkspaceAppSharingLevels: WorkspaceAppSharingLevel[] = [
   "public",
 ];
 
+// From codersdk/workspacebuilds.go
+export type WorkspaceBuildParameterSource =
+  | "previous_build"
+  | "template_default"
+  | "user_input";
+export const WorkspaceBuildParameterSources: WorkspaceBuildParameterSource[] =
+  ["previous_build", "template_default", "user_input"];
+
+// From codersdk/workspacebuilds.go
+export type WorkspaceResourceAction =
+  | "create"
+  | "delete"
+  | "no_op"
+  | "replace"
+  | "update";
+export const WorkspaceResourceActions: WorkspaceResourceAction[] = [
+  "create",
+  "delete",
+  "no_op",
+  "replace",
+  "update",
+];
+
 // From codersdk/workspacebuilds.go
 export type WorkspaceStatus =
   | "canceled"
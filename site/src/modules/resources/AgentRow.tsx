@@ -459,6 +459,12 @@ export const AgentRow: FC<AgentRowProps> = ({
   );
 };
 
+// The output of logs encrypted by the agent starts with this prefix, see
+// agentsdk.EncryptedLogPrefix. Only the CLI has the key to decrypt them.
+const encryptedLogPrefix = "coder-encrypted:v1:";
+const encryptedLogOutput =
+  'This log is encrypted. Read it with "coder logs --log-encryption-key".';
+
 const useAgentLogs = (
   agentId: string,
   { enabled, initialData }: { enabled: boolean; initialData?: LineWithID[] },
@@ -486,7 +492,9 @@ const useAgentLogs = (
           const newLogs: LineWithID[] = logs.map((log) => ({
             id: log.id,
             level: log.level || "info",
-            output: log.output,
+            output: log.output.startsWith(encryptedLogPrefix)
+              ? encryptedLogOutput
+              : log.output,
             time: log.created_at,
             source_id: log.source_id,
           }));
@@ -60,7 +60,7 @@ const StartTimeoutLifecycle: FC<AgentStatusProps> = ({ agent }) => {
           <Link
             target="_blank"
             rel="noreferrer"
-            href={agent.troubleshooting_url}
+            href={agent.troubleshooting_urls.connection_timeout}
           >
             Troubleshoot
           </Link>
@@ -84,7 +84,7 @@ const StartErrorLifecycle: FC<AgentStatusProps> = ({ agent }) => {
           <Link
             target="_blank"
             rel="noreferrer"
-            href={agent.troubleshooting_url}
+            href={agent.troubleshooting_urls.start_error}
           >
             Troubleshoot
           </Link>
@@ -240,7 +240,7 @@ const TimeoutStatus: FC<AgentStatusProps> = ({ agent }) => {
           <Link
             target="_blank"
             rel="noreferrer"
-            href={agent.troubleshooting_url}
+            href={agent.troubleshooting_urls.connection_timeout}
           >
             Troubleshoot
           </Link>
@@ -458,6 +458,7 @@ export const MockTemplate: TypesGen.Template = {
     },
   },
   description: "This is a test description.",
+  docs_url: "",
   default_ttl_ms: 24 * 60 * 60 * 1000,
   use_max_ttl: false,
   max_ttl_ms: 0,
@@ -488,6 +489,9 @@ export const MockTemplate: TypesGen.Template = {
   require_active_version: false,
   deprecated: false,
   deprecation_message: "",
+  max_app_sharing_level: "public",
+  code_server_enabled: false,
+  replace_on_failure: false,
 };
 
 export const MockTemplateVersionFiles: TemplateVersionFiles = {
@@ -615,6 +619,11 @@ export const MockWorkspaceAgent: TypesGen.WorkspaceAgent = {
   },
   connection_timeout_seconds: 120,
   troubleshooting_url: "https://coder.com/troubleshoot",
+  troubleshooting_urls: {
+    connection_timeout: "https://coder.com/troubleshoot",
+    start_error: "https://coder.com/troubleshoot",
+    token_invalid: "https://coder.com/troubleshoot",
+  },
   lifecycle_state: "starting",
   logs_length: 0,
   logs_overflowed: false,
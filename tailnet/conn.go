@@ -29,6 +29,7 @@ import (
 	"tailscale.com/types/key"
 	tslogger "tailscale.com/types/logger"
 	"tailscale.com/types/netlogtype"
+	"tailscale.com/types/nettype"
 	"tailscale.com/wgengine"
 	"tailscale.com/wgengine/capture"
 	"tailscale.com/wgengine/magicsock"
@@ -94,6 +95,11 @@ type Options struct {
 	BlockEndpoints bool
 	Logger         slog.Logger
 	ListenPort     uint16
+
+	// ForwardFilter is called for inbound connections to ports the conn
+	// isn't listening on, which are forwarded to the local host. The
+	// connection is refused if it returns an error.
+	ForwardFilter func(network string, dst netip.AddrPort) error
 }
 
 // NodeID creates a Tailscale NodeID from the last 8 bytes of a UUID. It ensures
@@ -241,6 +247,7 @@ func NewConn(options *Options) (conn *Conn, err error) {
 		magicConn:        magicConn,
 		dialer:           dialer,
 		listeners:        map[listenKey]*listener{},
+		forwardFilter:    options.ForwardFilter,
 		tunDevice:        sys.Tun.Get(),
 		netStack:         netStack,
 		wireguardMonitor: wireguardMonitor,
@@ -258,6 +265,7 @@ func NewConn(options *Options) (conn *Conn, err error) {
 	}()
 
 	netStack.GetTCPHandlerForFlow = server.forwardTCP
+	netStack.GetUDPHandlerForFlow = server.forwardUDP
 
 	err = netStack.Start(nil)
 	if err != nil {
@@ -307,6 +315,7 @@ type Conn struct {
 	wireguardRouter  *router.Config
 	wireguardEngine  wgengine.Engine
 	listeners        map[listenKey]*listener
+	forwardFilter    func(network string, dst netip.AddrPort) error
 
 	trafficStats *connstats.Statistics
 }
@@ -585,7 +594,8 @@ func (c *Conn) forwardTCP(src, dst netip.AddrPort) (handler func(net.Conn), opts
 	ln, ok := c.listeners[listenKey{"tcp", "", fmt.Sprint(dst.Port())}]
 	c.mutex.Unlock()
 	if !ok {
-		return nil, nil, false
+		// Refusing is done by intercepting the flow without a handler.
+		return nil, nil, c.refuseForward(logger, "tcp", dst)
 	}
 	// See: https://github.com/tailscale/tailscale/blob/c7cea825aea39a00aca71ea02bab7266afc03e7c/wgengine/netstack/netstack.go#L888
 	if dst.Port() == WorkspaceAgentSSHPort || dst.Port() == 22 {
@@ -611,6 +621,25 @@ func (c *Conn) forwardTCP(src, dst netip.AddrPort) (handler func(net.Conn), opts
 	}, opts, true
 }
 
+func (c *Conn) forwardUDP(src, dst netip.AddrPort) (handler func(nettype.ConnPacketConn), intercept bool) {
+	logger := c.logger.Named("udp").With(slog.F("src", src.String()), slog.F("dst", dst.String()))
+	return nil, c.refuseForward(logger, "udp", dst)
+}
+
+// refuseForward reports whether a connection forwarded to the local host is
+// refused by the forward filter.
+func (c *Conn) refuseForward(logger slog.Logger, network string, dst netip.AddrPort) bool {
+	if c.forwardFilter == nil {
+		return false
+	}
+	err := c.forwardFilter(network, dst)
+	if err == nil {
+		return false
+	}
+	logger.Info(context.Background(), "refused forwarded connection", slog.Error(err))
+	return true
+}
+
 // SetConnStatsCallback sets a callback to be called after maxPeriod or
 // maxConns, whichever comes first. Multiple calls overwrites the callback.
 func (c *Conn) SetConnStatsCallback(maxPeriod time.Duration, maxConns int, dump func(start, end time.Time, virtual, physical map[netlogtype.Connection]netlogtype.Counts)) {